@@ -1,47 +1,936 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"html/template"
 	"log"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	"github.com/quic-go/quic-go/http3"
 
+	"acortador-urls/internal/acme"
+	"acortador-urls/internal/analytics"
+	"acortador-urls/internal/auth"
+	"acortador-urls/internal/backup"
+	"acortador-urls/internal/cache"
+	"acortador-urls/internal/cluster"
+	"acortador-urls/internal/config"
+	"acortador-urls/internal/eventsink"
+	"acortador-urls/internal/geo"
 	"acortador-urls/internal/handlers"
+	"acortador-urls/internal/oidc"
+	"acortador-urls/internal/ratelimit"
 	"acortador-urls/internal/shortener"
+	"acortador-urls/internal/threat"
+	"acortador-urls/internal/webhooks"
+	"acortador-urls/internal/writebehind"
 )
 
+// webhookWorkers es el número de entregas de webhooks en paralelo
+const webhookWorkers = 4
+
 func main() {
-	// Crear el servicio de acortador
-	store := shortener.NewStore()
-	service := shortener.NewService(store)
-	handler := handlers.NewHandler(service)
+	// Cargar configuración desde variables de entorno
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal("Configuración inválida:", err)
+	}
+
+	// Crear el servicio de acortador con la estrategia y el formato de código configurados
+	codeFormat := shortener.CodeFormat{Length: cfg.CodeLength, Alphabet: cfg.CodeAlphabet}
+	generator, err := shortener.NewCodeGenerator(shortener.GeneratorConfig{
+		Strategy: cfg.CodeStrategy,
+		Format:   codeFormat,
+		NodeID:   cfg.NodeID,
+		Stages:   shortener.AttemptStages{EntropyAfter: cfg.CodeRetry.EntropyAfter, TimestampAfter: cfg.CodeRetry.TimestampAfter},
+	})
+	if err != nil {
+		log.Fatal("Configuración inválida:", err)
+	}
+	log.Printf("Códigos de %d caracteres sobre un alfabeto de %d (%.3g combinaciones)",
+		codeFormat.Length, len(codeFormat.Alphabet), codeFormat.Keyspace())
+	if cfg.CaseInsensitiveCodes {
+		log.Printf("Los códigos no distinguen mayúsculas de minúsculas")
+	}
+
+	// Las rutas del router se agregan al registro una vez definidas, más abajo
+	reserved := append(append([]string{}, shortener.DefaultReservedWords...), cfg.ReservedWords...)
+	routes := shortener.NewRouteRegistry()
+	filter := shortener.NewCodeFilter(reserved, cfg.ProfanityWords).WithRoutes(routes)
+
+	// Geolocalización opcional para los enlaces con destinos por país
+	var geoResolver geo.Resolver
+	if cfg.GeoIP.LocationsFile != "" {
+		ranges, err := geo.LoadGeoLite2Files(cfg.GeoIP.LocationsFile, cfg.GeoIP.BlockFiles...)
+		if err != nil {
+			log.Fatal("No se pudo cargar la base GeoIP:", err)
+		}
+		log.Printf("Base GeoIP cargada: %d rangos", ranges.Len())
+		geoResolver = ranges
+	}
+
+	store := shortener.NewStore(shortener.WithEviction(cfg.StoreMaxEntries, cfg.StoreEvictionPolicy))
+	if cfg.StoreMaxEntries > 0 {
+		log.Printf("Almacén limitado a %d enlaces (expulsión %s)", cfg.StoreMaxEntries, cfg.StoreEvictionPolicy)
+	}
+	var linkStore shortener.LinkStore = store
+	var node *cluster.Node
+	if len(cfg.Cluster.Peers) > 0 {
+		node = cluster.NewNode(store, cfg.Cluster.NodeID, cfg.Cluster.Peers, cfg.Cluster.Secret)
+		linkStore = node
+		log.Printf("Modo clúster (experimental): nodo %s con %d pares", cfg.Cluster.NodeID, len(cfg.Cluster.Peers))
+	}
+	var writeBuffer *writebehind.Store
+	if cfg.WriteBuffer.Size > 0 {
+		writeBuffer = writebehind.NewStore(linkStore, cfg.WriteBuffer.Size)
+		linkStore = writeBuffer
+		log.Printf("Búfer de escritura: lotes de %d enlaces o cada %s", cfg.WriteBuffer.Size, cfg.WriteBuffer.Interval)
+	}
+	var linkCache *cache.Store
+	if cfg.Cache.Size > 0 {
+		var cacheOpts []cache.StoreOption
+		if cfg.Cache.PubSubURL != "" {
+			bus, err := cache.NewRedisBus(cfg.Cache.PubSubURL, cfg.Cache.PubSubChannel)
+			if err != nil {
+				log.Fatal("Configuración inválida:", err)
+			}
+			cacheOpts = append(cacheOpts, cache.WithBus(bus))
+		}
+		linkCache = cache.NewStore(linkStore, cache.NewLRU(cfg.Cache.Size), cfg.Cache.TTL, cfg.Cache.NegativeTTL, cacheOpts...)
+		go linkCache.RunInvalidationListener(context.Background())
+		linkStore = linkCache
+		log.Printf("Caché de enlaces: %d códigos durante %s", cfg.Cache.Size, cfg.Cache.TTL)
+	}
+	// Las generaciones con demasiadas colisiones anticipan la saturación del espacio de códigos
+	retryWarnAfter := cfg.CodeRetry.WarnAfter
+	if retryWarnAfter == 0 {
+		retryWarnAfter = -1
+	}
+	// Las claves de API_KEY_ROLES, junto con las de tenants y cuotas propias, son las únicas que
+	// identifican al cliente en el limitador y en la medición de uso
+	apiKeyNames := make([]string, 0, len(cfg.APIKeyRoles))
+	for apiKey := range cfg.APIKeyRoles {
+		apiKeyNames = append(apiKeyNames, apiKey)
+	}
+	serviceOpts := []shortener.ServiceOption{
+		shortener.WithDeduplication(cfg.Deduplicate),
+		shortener.WithCodeGenerator(generator),
+		shortener.WithCodeFilter(filter),
+		shortener.WithAliasSuggestions(cfg.AliasSuggestions),
+		shortener.WithCaseInsensitiveCodes(cfg.CaseInsensitiveCodes),
+		shortener.WithUnicodeAliases(cfg.UnicodeAliases),
+		shortener.WithRetryPolicy(shortener.RetryPolicy{
+			MaxRetries: cfg.CodeRetry.MaxRetries,
+			WarnAfter:  retryWarnAfter,
+			OnWarning: func(warning shortener.CollisionWarning) {
+				if warning.Saturated {
+					log.Printf("Espacio de códigos saturado: ningún código libre tras %d intentos (tenant %q, dominio %q); aumenta CODE_LENGTH",
+						warning.Attempts, warning.Tenant, warning.Domain)
+					return
+				}
+				log.Printf("Generación de código con %d intentos por colisiones (tenant %q, dominio %q); considera aumentar CODE_LENGTH",
+					warning.Attempts, warning.Tenant, warning.Domain)
+			},
+		}),
+		shortener.WithIdempotencyTTL(cfg.IdempotencyTTL),
+		shortener.WithQueryForwarding(cfg.ForwardQuery),
+		shortener.WithGeoResolver(geoResolver),
+		shortener.WithInterstitialDomains(cfg.Interstitial.Domains),
+		shortener.WithIPAccess(shortener.IPAccessPolicy{Allow: cfg.IPAccess.Allowlist, Deny: cfg.IPAccess.Denylist}),
+		shortener.WithURLSigning([]byte(cfg.URLSigningSecret)),
+		shortener.WithQuarantineThreshold(cfg.QuarantineThreshold),
+		shortener.WithDomainPolicySource(shortener.DomainPolicySource{
+			Blocklist:       cfg.Domains.Blocklist,
+			BlocklistSource: cfg.Domains.BlocklistSource,
+			Allowlist:       cfg.Domains.Allowlist,
+			AllowlistSource: cfg.Domains.AllowlistSource,
+		}),
+		shortener.WithPrivateDestinations(cfg.AllowPrivateDestinations),
+		shortener.WithMaxURLLength(cfg.MaxURLLength),
+		shortener.WithLinkQuotas(cfg.MaxLinks, cfg.MaxLinksPerClient),
+		shortener.WithCustomDomains(cfg.CustomDomains),
+		shortener.WithAPIKeys(apiKeyNames...),
+		shortener.WithTenants(cfg.TenantAPIKeys, cfg.TenantHosts),
+		shortener.WithTenantQuota(cfg.MaxLinksPerTenant),
+		shortener.WithUsageQuotas(shortener.UsageLimits{
+			Shortens:  int64(cfg.UsageQuotas.Shortens),
+			Redirects: int64(cfg.UsageQuotas.Redirects),
+		}, usageLimits(cfg.UsageQuotas.PerKey)),
+		shortener.WithBotPatterns(cfg.BotUserAgents),
+		shortener.WithBotExclusion(cfg.ExcludeBots),
+	}
+	if cfg.BloomFilterSize > 0 {
+		serviceOpts = append(serviceOpts, shortener.WithBloomFilter(cfg.BloomFilterSize, cfg.BloomFilterFPRate))
+	}
+	if cfg.ResolveDestinations {
+		serviceOpts = append(serviceOpts, shortener.WithDestinationResolver(net.DefaultResolver))
+	}
+	prober := shortener.NewHTTPProber(cfg.Reachability.Timeout, cfg.AllowPrivateDestinations)
+	if cfg.Reachability.Mode != shortener.ReachabilityOff {
+		serviceOpts = append(serviceOpts, shortener.WithReachabilityCheck(cfg.Reachability.Mode, prober))
+	}
+	if cfg.DeadLinks.Interval > 0 {
+		serviceOpts = append(serviceOpts, shortener.WithDeadLinkScanner(prober, cfg.DeadLinks.Failures))
+	}
+	if cfg.Metadata.Mode != "off" {
+		fetcher := shortener.NewHTMLMetadataFetcher(cfg.Metadata.Timeout, cfg.Metadata.MaxBytes, cfg.AllowPrivateDestinations)
+		serviceOpts = append(serviceOpts, shortener.WithMetadataFetcher(fetcher, cfg.Metadata.CacheTTL, cfg.Metadata.Mode == "on_create"))
+	}
+
+	// Reputación opcional de los destinos; la caché respeta las cuotas del proveedor
+	if cfg.Threats.Provider != "" {
+		checker, err := threat.NewChecker(cfg.Threats.Provider, cfg.Threats.APIKey)
+		if err != nil {
+			log.Fatal("Configuración inválida:", err)
+		}
+		cached := threat.NewCache(checker, cfg.Threats.CacheTTL, threat.DefaultCacheSize)
+		serviceOpts = append(serviceOpts, shortener.WithThreatChecker(cached, cfg.Threats.Timeout))
+		log.Printf("Destinos comprobados contra %s", cfg.Threats.Provider)
+	}
+
+	// Detección de picos de visitas; las anomalías se registran en el log y llegan a los
+	// webhooks como link.anomaly
+	if cfg.Anomalies.LinkClicks > 0 || cfg.Anomalies.SourceClicks > 0 || cfg.Anomalies.SpikeFactor > 0 {
+		serviceOpts = append(serviceOpts, shortener.WithAnomalyDetection(shortener.AnomalyPolicy{
+			Window:         cfg.Anomalies.Window,
+			LinkClicks:     cfg.Anomalies.LinkClicks,
+			SourceClicks:   cfg.Anomalies.SourceClicks,
+			SpikeFactor:    cfg.Anomalies.SpikeFactor,
+			SpikeMinClicks: cfg.Anomalies.SpikeMinClicks,
+			SpikeAlpha:     cfg.Anomalies.SpikeAlpha,
+			Action:         cfg.Anomalies.Action,
+			ThrottleFor:    cfg.Anomalies.ThrottleFor,
+			OnAnomaly: func(anomaly shortener.Anomaly) {
+				log.Printf("Tráfico anómalo (%s) en %q desde %q: %d visitas en %s, umbral %.1f; acción: %s",
+					anomaly.Type, anomaly.ShortCode, anomaly.Source, anomaly.Clicks, anomaly.Window, anomaly.Threshold, anomaly.Action)
+			},
+		}))
+		log.Printf("Detección de tráfico anómalo por ventanas de %s (acción: %s)", cfg.Anomalies.Window, cfg.Anomalies.Action)
+	}
+
+	if len(cfg.IPAccess.Allowlist) > 0 || len(cfg.IPAccess.Denylist) > 0 {
+		log.Printf("Redirecciones limitadas por red: %d redes permitidas, %d rechazadas",
+			len(cfg.IPAccess.Allowlist), len(cfg.IPAccess.Denylist))
+	}
+
+	// Webhooks de los eventos de los enlaces, entregados en segundo plano
+	var dispatcher *webhooks.Dispatcher
+	if len(cfg.Webhooks.URLs) > 0 {
+		endpoints := make([]webhooks.Endpoint, 0, len(cfg.Webhooks.URLs))
+		for _, endpoint := range cfg.Webhooks.URLs {
+			endpoints = append(endpoints, webhooks.Endpoint{URL: endpoint, Secret: cfg.Webhooks.Secret, Events: cfg.Webhooks.Events})
+		}
+		dispatcher = webhooks.NewDispatcher(endpoints, webhooks.WithMaxAttempts(cfg.Webhooks.MaxAttempts))
+		serviceOpts = append(serviceOpts, shortener.WithEventListener(dispatcher),
+			shortener.WithExpiryNotice(time.Duration(cfg.Webhooks.ExpiryNoticeDays)*24*time.Hour))
+		log.Printf("Webhooks: %d endpoints para %s", len(endpoints), strings.Join(cfg.Webhooks.Events, ", "))
+	}
+	// Envío de los eventos a Kafka o NATS para pipelines externos
+	var forwarder *eventsink.Forwarder
+	if cfg.EventSink.Type != "" {
+		var sink eventsink.Sink
+		var err error
+		switch cfg.EventSink.Type {
+		case "nats":
+			sink, err = eventsink.NewNATSSink(cfg.EventSink.URL, cfg.EventSink.Topic)
+		case "kafka":
+			sink, err = eventsink.NewKafkaSink(cfg.EventSink.URL, cfg.EventSink.Topic)
+		}
+		if err != nil {
+			log.Fatal("Configuración inválida:", err)
+		}
+		forwarder = eventsink.NewForwarder(sink,
+			eventsink.WithBatchSize(cfg.EventSink.BatchSize),
+			eventsink.WithFlushInterval(cfg.EventSink.FlushInterval))
+		serviceOpts = append(serviceOpts, shortener.WithEventListener(forwarder))
+		log.Printf("Eventos enviados a %s (%s)", cfg.EventSink.Type, cfg.EventSink.Topic)
+	}
+
+	// Stream de eventos en tiempo real para los dashboards
+	broker := shortener.NewEventBroker()
+	serviceOpts = append(serviceOpts, shortener.WithEventListener(broker))
+	service := shortener.NewService(linkStore, serviceOpts...)
+	if cfg.BloomFilterSize > 0 {
+		loaded, err := service.LoadBloomFilter(context.Background())
+		if err != nil {
+			log.Fatal("No se pudo cargar el filtro de Bloom:", err)
+		}
+		log.Printf("Filtro de Bloom cargado: %d códigos", loaded)
+	}
+
+	// Listas de dominios: se cargan al arrancar y se recargan con SIGHUP sin reiniciar
+	policy, err := service.ReloadDomainPolicy(context.Background())
+	if err != nil {
+		log.Fatal("No se pudieron cargar las listas de dominios:", err)
+	}
+	log.Printf("Listas de dominios cargadas: %d bloqueados, %d permitidos", policy.Blocked(), policy.Allowed())
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	go func() {
+		for range reload {
+			policy, err := service.ReloadDomainPolicy(context.Background())
+			if err != nil {
+				log.Printf("Recarga de listas de dominios fallida, se conserva la anterior: %v", err)
+				continue
+			}
+			log.Printf("Listas de dominios recargadas: %d bloqueados, %d permitidos", policy.Blocked(), policy.Allowed())
+		}
+	}()
+
+	// Worker de verificación de destinos en modo async
+	go service.RunReachabilityWorker(context.Background())
+
+	// Worker de metadatos Open Graph de los enlaces recién creados
+	go service.RunMetadataWorker(context.Background())
+
+	// Revisión periódica: los destinos marcados después de crear el enlace pasan a cuarentena
+	if cfg.Threats.Provider != "" {
+		go every(cfg.Threats.RescanInterval, func() {
+			quarantined, err := service.RescanThreats(context.Background())
+			if err != nil {
+				log.Printf("Revisión de amenazas interrumpida: %v", err)
+			}
+			if quarantined > 0 {
+				log.Printf("Revisión de amenazas: %d enlaces en cuarentena", quarantined)
+			}
+		})
+	}
+
+	// Replicación del clúster: envío de las escrituras locales y sincronización periódica
+	if node != nil {
+		go node.RunPusher(context.Background())
+		go every(cfg.Cluster.GossipInterval, func() {
+			if applied, err := node.Gossip(context.Background()); err != nil {
+				log.Printf("Sincronización del clúster fallida: %v", err)
+			} else if applied > 0 {
+				log.Printf("Sincronización del clúster: %d enlaces actualizados", applied)
+			}
+		})
+	}
+
+	// Vaciado periódico del búfer de escritura
+	if writeBuffer != nil {
+		go every(cfg.WriteBuffer.Interval, func() {
+			if err := writeBuffer.Flush(context.Background()); err != nil {
+				log.Printf("Vaciado del búfer de escritura fallido, se reintentará: %v", err)
+			}
+		})
+	}
+
+	// Envío de eventos: se detiene al apagar el servidor, tras enviar los pendientes
+	forwardCtx, stopForwarding := context.WithCancel(context.Background())
+	forwarded := make(chan struct{})
+	if forwarder != nil {
+		go func() {
+			forwarder.Run(forwardCtx)
+			close(forwarded)
+		}()
+	} else {
+		close(forwarded)
+	}
+
+	// Métricas en vivo y agregados diarios para los informes a partir del stream de eventos
+	tracker := analytics.NewTracker(cfg.LiveAnalytics.Window)
+	go tracker.Run(context.Background(), broker)
+	aggregator := analytics.NewAggregator(cfg.LiveAnalytics.Retention)
+	go aggregator.Run(context.Background(), broker)
+
+	// Entrega de webhooks y búsqueda periódica de enlaces expirados para notificarlos
+	if dispatcher != nil {
+		go dispatcher.Run(context.Background(), webhookWorkers)
+		go every(cfg.Webhooks.ExpiryInterval, func() {
+			if _, err := service.NotifyExpired(context.Background()); err != nil {
+				log.Printf("Búsqueda de enlaces expirados interrumpida: %v", err)
+			}
+		})
+	}
+
+	// Compactación del almacén en memoria tras muchos borrados o expulsiones
+	go every(cfg.StoreCompactionInterval, func() {
+		result, compacted, err := service.CompactIfNeeded(context.Background(), cfg.StoreCompactionThreshold)
+		switch {
+		case err != nil:
+			log.Printf("Compactación del almacén interrumpida: %v", err)
+		case compacted:
+			log.Printf("Almacén compactado en %v: %d → %d bytes estimados",
+				result.Duration, result.Before.Bytes, result.After.Bytes)
+		}
+	})
+
+	// Escáner de enlaces rotos
+	go every(cfg.DeadLinks.Interval, func() {
+		result, err := service.ScanLinks(context.Background())
+		if err != nil {
+			log.Printf("Escaneo de enlaces rotos interrumpido: %v", err)
+		}
+		log.Printf("Escaneo de enlaces rotos: %d comprobados, %d rotos, %d recuperados",
+			result.Checked, result.Broken, result.Recovered)
+	})
+
+	// Copias de seguridad periódicas de los enlaces
+	var backups *backup.Manager
+	if cfg.Backups.URL != "" {
+		target, err := newBackupTarget(cfg.Backups)
+		if err != nil {
+			log.Fatal("No se pudo configurar el destino de las copias de seguridad:", err)
+		}
+		backups = backup.NewManager(service, target, backup.WithRetention(cfg.Backups.Retention))
+		log.Printf("Copias de seguridad en %s cada %v, se conservan %d", cfg.Backups.URL, cfg.Backups.Interval, cfg.Backups.Retention)
+		go every(cfg.Backups.Interval, func() {
+			snapshot, err := backups.Backup(context.Background())
+			if err != nil {
+				log.Printf("Copia de seguridad fallida: %v", err)
+			}
+			if snapshot.Name != "" {
+				log.Printf("Copia de seguridad %s: %d enlaces, %d bytes", snapshot.Name, snapshot.Links, snapshot.Size)
+			}
+		})
+	}
+
+	// El mismo limitador cubre la creación de enlaces, cada URL de un lote y cada contraseña
+	// probada en las redirecciones, por cualquier método
+	var limiter ratelimit.Limiter
+	switch {
+	case cfg.RateLimit.Enabled && cfg.RateLimit.RedisURL != "":
+		// Con varias réplicas el límite de cada cliente se comparte en Redis
+		redisLimiter, err := ratelimit.NewRedisTokenBucket(cfg.RateLimit.RedisURL, cfg.RateLimit.Rate, cfg.RateLimit.Burst)
+		if err != nil {
+			log.Fatal("Configuración inválida:", err)
+		}
+		limiter = redisLimiter
+		log.Printf("Limitador compartido en Redis: %.3g peticiones/s, ráfaga de %d", cfg.RateLimit.Rate, cfg.RateLimit.Burst)
+	case cfg.RateLimit.Enabled:
+		limiter = ratelimit.NewTokenBucket(cfg.RateLimit.Rate, cfg.RateLimit.Burst)
+	}
+
+	handlerOpts := []handlers.Option{
+		handlers.WithMaxBatchSize(cfg.MaxBatchSize),
+		handlers.WithCountryHeader(cfg.GeoIP.CountryHeader),
+		handlers.WithInterstitialCountdown(cfg.Interstitial.Countdown),
+		handlers.WithRedirectCache(cfg.RedirectMaxAge, cfg.PermanentRedirectMaxAge),
+		handlers.WithPrivacyMode(cfg.PrivacyMode),
+		handlers.WithUserDataConfirmation([]byte(cfg.JWTSecret), handlers.DefaultConfirmationTTL),
+		handlers.WithFallbackURL(cfg.NotFoundRedirect),
+		handlers.WithEventStream(broker),
+		handlers.WithLiveAnalytics(tracker, cfg.LiveAnalytics.Interval),
+		handlers.WithSummaryReports(aggregator),
+	}
+	if dispatcher != nil {
+		handlerOpts = append(handlerOpts, handlers.WithWebhookLog(dispatcher))
+	}
+	if backups != nil {
+		handlerOpts = append(handlerOpts, handlers.WithBackups(backups))
+	}
+	if limiter != nil {
+		handlerOpts = append(handlerOpts, handlers.WithBatchRateLimit(limiter))
+	}
+	// Archivos de los dominios de redirección que reemplazan a los incluidos en el binario
+	if cfg.SiteFiles.RobotsFile != "" {
+		robots, err := os.ReadFile(cfg.SiteFiles.RobotsFile)
+		if err != nil {
+			log.Fatal("No se pudo cargar ROBOTS_TXT_FILE:", err)
+		}
+		handlerOpts = append(handlerOpts, handlers.WithRobotsTxt(string(robots)))
+	}
+	if cfg.SiteFiles.FaviconFile != "" {
+		favicon, err := os.ReadFile(cfg.SiteFiles.FaviconFile)
+		if err != nil {
+			log.Fatal("No se pudo cargar FAVICON_FILE:", err)
+		}
+		handlerOpts = append(handlerOpts, handlers.WithFavicon(favicon))
+	}
+	handlerOpts = append(handlerOpts, handlers.WithSecurityTxt(handlers.SecurityTxt{
+		Contacts: cfg.SiteFiles.SecurityContacts,
+		Policy:   cfg.SiteFiles.SecurityPolicy,
+	}))
+	// Página de marca para los códigos inexistentes o expirados
+	if cfg.NotFoundPage != "" {
+		page, err := template.ParseFiles(cfg.NotFoundPage)
+		if err != nil {
+			log.Fatal("No se pudo cargar NOT_FOUND_PAGE:", err)
+		}
+		handlerOpts = append(handlerOpts, handlers.WithNotFoundPage(page))
+	}
+	// Inicio de sesión con un proveedor de identidad externo
+	if cfg.OIDC.Issuer != "" {
+		login, err := newOIDCLogin(cfg.OIDC)
+		if err != nil {
+			log.Fatal("No se pudo configurar el inicio de sesión OIDC:", err)
+		}
+		handlerOpts = append(handlerOpts, handlers.WithOIDCLogin(login))
+		log.Printf("Inicio de sesión con %s habilitado en %s", login.Name, handlers.OIDCPath)
+	}
+	if linkCache != nil {
+		handlerOpts = append(handlerOpts, handlers.WithCacheStats(linkCache.Stats))
+	}
+	handler := handlers.NewHandler(service, handlerOpts...)
+
+	// Gestor de tokens JWT; sin JWT_SECRET los endpoints autenticados rechazan todo token
+	if cfg.JWTSecret == "" {
+		log.Printf("JWT_SECRET no configurado: los endpoints /api no aceptarán tokens")
+	}
+	tokens := auth.NewTokenManager([]byte(cfg.JWTSecret), cfg.JWTTTL)
+	apiKeys, err := auth.ParseAPIKeys(cfg.APIKeyRoles)
+	if err != nil {
+		log.Fatal("API_KEY_ROLES inválido:", err)
+	}
+	trustedProxies, err := handlers.ParseTrustedProxies(cfg.TrustedProxies)
+	if err != nil {
+		log.Fatal("TRUSTED_PROXIES inválido:", err)
+	}
 
 	// Configurar el router
 	r := chi.NewRouter()
 
 	// Middleware básico
-	r.Use(middleware.Logger)
-	r.Use(middleware.Recoverer)
+	// Antes que el log, para que registre la IP real del cliente detrás de los proxies y el
+	// identificador de cada petición
+	r.Use(handlers.TrustedProxies(trustedProxies))
 	r.Use(middleware.RequestID)
+	if cfg.AccessLog.Format != "off" {
+		// Los formatos para pipelines van a stdout, una línea por petición
+		output := log.Writer()
+		if cfg.AccessLog.Format != handlers.AccessLogText {
+			output = os.Stdout
+		}
+		r.Use(handlers.AccessLog(handlers.AccessLogOptions{
+			Format:      cfg.AccessLog.Format,
+			SampleRate:  cfg.AccessLog.SamplePercent / 100,
+			RedactQuery: cfg.AccessLog.RedactQuery,
+			PrivacyMode: cfg.PrivacyMode,
+			Output:      output,
+		}))
+	}
+	r.Use(middleware.Recoverer)
+	r.Use(handlers.CORS(handlers.CORSOptions{
+		AllowedOrigins: cfg.CORS.AllowedOrigins,
+		AllowedMethods: cfg.CORS.AllowedMethods,
+		AllowedHeaders: cfg.CORS.AllowedHeaders,
+		MaxAge:         cfg.CORS.MaxAge,
+	}))
+	r.Use(handlers.Compress(cfg.CompressionLevel))
+	r.Use(handlers.Authenticate(tokens))
+	r.Use(handlers.AuthenticateAPIKeys(apiKeys))
+
+	// Replicación entre nodos, autenticada con CLUSTER_SECRET
+	if node != nil {
+		r.Handle("/cluster/*", node.Handler())
+	}
+
+	// Stream de eventos y métricas en vivo: conexiones de larga duración, fuera del timeout por
+	// petición
+	r.With(handlers.RequireAuth).Get("/api/events/stream", handler.StreamEvents)
+	r.With(handlers.RequireAuth).Get("/api/analytics/live", handler.LiveAnalytics)
+	r.With(handlers.RequireAuth).Get("/api/reports/summary", handler.SummaryReport)
+
+	// Diagnóstico con pprof y el estado del proceso, solo para administradores y fuera del
+	// timeout por petición porque los perfiles muestrean durante varios segundos
+	r.With(handlers.RequireAuth, handlers.RequireAdmin).Mount(handlers.DebugPath, handler.Debug())
+
+	// Administración. La importación y exportación masivas quedan fuera del timeout por
+	// petición porque transmiten archivos de cientos de miles de filas
+	r.Route("/admin", func(r chi.Router) {
+		r.Use(handlers.RequireAuth, handlers.RequireAdmin)
+		r.Post("/import", handler.ImportLinks)
+		r.Get("/export", handler.ExportLinks)
+		r.Get("/audit", handler.AuditLog)
+		r.Get("/reports", handler.ListReports)
+		r.Post("/reports/disable", handler.DisableReported)
+		r.Post("/reports/{short_code}:dismiss", handler.DismissReports)
+		r.Post("/domains/reload", handler.ReloadDomains)
+		r.Get("/custom-domains", handler.ListCustomDomains)
+		r.Put("/custom-domains/{host}", handler.RegisterCustomDomain)
+		r.Delete("/custom-domains/{host}", handler.RemoveCustomDomain)
+		r.Get("/tenants", handler.ListTenants)
+		r.Get("/keys/{id}/usage", handler.KeyUsage)
+		r.Get("/broken-links", handler.BrokenLinks)
+		r.Get("/webhooks/deliveries", handler.WebhookDeliveries)
+		r.Get("/backups", handler.ListBackups)
+		r.Post("/backups", handler.CreateBackup)
+		r.Post("/restore", handler.RestoreBackup)
+		r.Post("/store/compact", handler.CompactStore)
+	})
+
+	// Panel web de administración, con su propia sesión por cookie
+	r.Mount(handlers.AdminUIPath, handler.AdminUI(tokens))
+	if cfg.OIDC.Issuer != "" {
+		r.Mount(handlers.OIDCPath, handler.OIDC(tokens))
+	}
+
+	r.Group(func(r chi.Router) {
+		r.Use(handlers.Timeout(cfg.RequestTimeout))
+
+		// Rutas
+		r.Group(func(r chi.Router) {
+			if limiter != nil {
+				r.Use(handlers.RateLimit(limiter, service.KnownAPIKey))
+			}
+			r.With(handlers.MaxBodySize(cfg.MaxBodyBytes)).Post("/shorten", handler.ShortenURL)
+			r.With(handlers.MaxBodySize(cfg.MaxBodyBytes)).Post("/shorten/form", handler.ShortenForm)
+			r.Get("/api/shorten", handler.ShortenGet)
+			r.Post("/shorten/batch", handler.ShortenBatch)
+
+			// GraphQL comparte el limitador porque la mutación shortenUrl también crea enlaces
+			r.With(handlers.MaxBodySize(cfg.MaxBodyBytes)).Post("/graphql", handler.GraphQL)
+			r.Get("/graphql", handler.GraphQL)
+
+			// Formulario de los enlaces con contraseña; limitado para frenar la fuerza bruta
+			r.With(handlers.MaxBodySize(cfg.MaxBodyBytes)).Post("/{short_code}", handler.RedirectURL)
+			r.With(handlers.MaxBodySize(cfg.MaxBodyBytes)).Post("/t/{tenant}/{short_code}", handler.RedirectURL)
+
+			// Denuncias públicas de abuso; limitadas para que no se use para saturar la revisión
+			r.With(handlers.MaxBodySize(cfg.MaxBodyBytes)).Post("/report/{short_code}", handler.ReportURL)
+
+			// Inspección pública para pasarelas de correo; limitada porque consulta al proveedor
+			// de reputación
+			r.With(handlers.MaxBodySize(cfg.MaxBodyBytes)).Post("/api/inspect", handler.InspectURL)
+		})
+
+		r.Route("/api", func(r chi.Router) {
+			// Resolución masiva y vista previa públicas (escáneres de correo, dashboards)
+			r.Post("/resolve", handler.ResolveBatch)
+			r.Get("/urls/{short_code}", handler.PreviewURL)
+			r.Get("/urls/{short_code}/preview", handler.LinkMetadata)
+
+			// Gestión de enlaces del usuario autenticado
+			r.Group(func(r chi.Router) {
+				r.Use(handlers.RequireAuth)
+				r.Get("/me/urls", handler.ListMyURLs)
+				r.Get("/urls", handler.ListURLs)
+				r.Get("/urls/search", handler.SearchURLs)
+				r.Patch("/urls/{short_code}", handler.UpdateURL)
+				r.Patch("/urls/{short_code}/details", handler.UpdateDetails)
+				r.Post("/urls/{short_code}/extend", handler.ExtendURL)
+				r.Post("/urls/{short_code}/sign", handler.SignURL)
+				r.Post("/urls/{short_code}/transfer", handler.TransferURL)
+				r.Delete("/urls/{short_code}/transfer", handler.CancelTransfer)
+				r.Patch("/urls/{short_code}/tags", handler.UpdateTags)
+				r.Get("/urls/{short_code}/events/export", handler.ExportLinkEvents)
+				r.Get("/tags", handler.ListTags)
+				r.Get("/collections", handler.ListCollections)
+				r.Post("/collections", handler.CreateCollection)
+				r.Patch("/collections/{id}", handler.RenameCollection)
+				r.Delete("/collections/{id}", handler.DeleteCollection)
+				r.Post("/collections/{id}/links", handler.AddCollectionLinks)
+				r.Post("/collections/{id}/links:remove", handler.RemoveCollectionLinks)
+				r.Get("/users/{id}/export", handler.ExportUserData)
+				r.Delete("/users/{id}/data", handler.DeleteUserData)
+				r.With(handlers.RequireRole(auth.RoleOwner, auth.RoleAdmin)).Delete("/urls/{short_code}", handler.DeleteURL)
+				r.Post("/urls/{short_code}:disable", handler.DisableURL)
+				r.Post("/urls/{short_code}:enable", handler.EnableURL)
+				r.Post("/urls:batchUpdate", handler.BatchUpdateURLs)
+				r.With(handlers.RequireRole(auth.RoleOwner, auth.RoleAdmin)).Post("/urls:batchDelete", handler.BatchDeleteURLs)
+			})
+
+			// Estadísticas globales para los paneles de control
+			r.With(handlers.RequireAuth, handlers.RequireAdmin).Get("/stats", handler.Stats)
+		})
 
-	// Rutas
-	r.Post("/shorten", handler.ShortenURL)
-	r.Get("/{short_code}", handler.RedirectURL)
+		// Página de inicio con el formulario para acortar desde el navegador
+		r.Get("/", handler.Home)
 
-	// Puerto del servidor
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8089"
+		// Documentación de la API
+		r.Get("/openapi.json", handler.OpenAPI)
+		r.Get("/docs", handler.SwaggerUI)
+
+		// Archivos que piden rastreadores, navegadores y escáneres de seguridad; sin ellos cada
+		// petición buscaría un código inexistente
+		r.Get("/robots.txt", handler.RobotsTxt)
+		r.Get("/favicon.ico", handler.Favicon)
+		r.Get("/.well-known/security.txt", handler.SecurityTxt)
+
+		r.Get("/{short_code}+", handler.PreviewURL)
+
+		// Enlaces de los tenants que solo se identifican por clave de API
+		r.Get("/t/{tenant}/{short_code}+", handler.PreviewURL)
+
+		// Las redirecciones solo consumen el limitador cuando aportan una contraseña
+		r.Group(func(r chi.Router) {
+			if limiter != nil {
+				r.Use(handlers.RateLimitPasswords(limiter, service.KnownAPIKey))
+			}
+			r.Get("/{short_code}", handler.RedirectURL)
+			r.Get("/t/{tenant}/{short_code}", handler.RedirectURL)
+		})
+	})
+
+	// Los primeros segmentos de las rutas no pueden reclamarse como códigos; los enlaces creados
+	// antes de que existiera una ruta quedan tapados por ella
+	if err := handlers.ReserveRoutes(r, routes); err != nil {
+		log.Fatal("No se pudieron reservar las rutas:", err)
+	}
+	shadowed, err := service.ShadowedLinks(context.Background(), routes)
+	if err != nil {
+		log.Printf("No se pudieron comprobar los enlaces tapados por rutas: %v", err)
+	}
+	for _, link := range shadowed {
+		pattern, _ := routes.Route(link.ShortCode)
+		log.Printf("El enlace %q queda tapado por la ruta %s y ya no redirige", link.ShortCode, pattern)
+	}
+
+	// Puerto del servidor; con TLS los endpoints se sirven en TLS_PORT
+	port, scheme, wsScheme := cfg.Port, "http", "ws"
+	tlsConfig, redirect, err := newTLS(cfg.TLS, cfg.Port)
+	if err != nil {
+		log.Fatal("No se pudo configurar TLS:", err)
+	}
+	if tlsConfig != nil {
+		port, scheme, wsScheme = cfg.TLS.Port, "https", "wss"
+		log.Printf("HTTPS en puerto %s (HTTP/2: %t, HTTP/3: %t); el puerto %s redirige a HTTPS", port, cfg.TLS.HTTP2, cfg.TLS.HTTP3, cfg.Port)
 	}
 
 	log.Printf("Servidor iniciado en puerto %s", port)
-	log.Printf("Endpoints disponibles:")
-	log.Printf("  POST http://localhost:%s/shorten", port)
-	log.Printf("  GET  http://localhost:%s/{short_code}", port)
+	log.Printf("Endpoints disponibles (%s):", scheme)
+	log.Printf("  GET  %s://localhost:%s/", scheme, port)
+	log.Printf("  POST %s://localhost:%s/shorten", scheme, port)
+	log.Printf("  POST %s://localhost:%s/shorten/batch", scheme, port)
+	log.Printf("  GET  %s://localhost:%s/api/shorten?url=", scheme, port)
+	log.Printf("  GET  %s://localhost:%s/{short_code}", scheme, port)
+	log.Printf("  GET  %s://localhost:%s/{short_code}+", scheme, port)
+	log.Printf("  POST %s://localhost:%s/api/resolve", scheme, port)
+	log.Printf("  POST %s://localhost:%s/api/inspect", scheme, port)
+	log.Printf("  GET  %s://localhost:%s/api/me/urls", scheme, port)
+	log.Printf("  GET  %s://localhost:%s/api/urls/{short_code}/preview", scheme, port)
+	log.Printf("  PATCH/DELETE %s://localhost:%s/api/urls/{short_code}", scheme, port)
+	log.Printf("  POST %s://localhost:%s/api/urls/{short_code}/sign", scheme, port)
+	log.Printf("  POST %s://localhost:%s/api/urls/{short_code}/transfer", scheme, port)
+	log.Printf("  POST %s://localhost:%s/api/urls:batchUpdate", scheme, port)
+	log.Printf("  POST %s://localhost:%s/api/urls:batchDelete", scheme, port)
+	log.Printf("  GET  %s://localhost:%s/api/users/{id}/export", scheme, port)
+	log.Printf("  DELETE %s://localhost:%s/api/users/{id}/data", scheme, port)
+	log.Printf("  GET  %s://localhost:%s/api/events/stream", scheme, port)
+	log.Printf("  GET  %s://localhost:%s/api/analytics/live", wsScheme, port)
+	log.Printf("  GET  %s://localhost:%s/api/reports/summary", scheme, port)
+	log.Printf("  GET  %s://localhost:%s/api/stats", scheme, port)
+	log.Printf("  GET  %s://localhost:%s/api/urls/{short_code}/events/export", scheme, port)
+	log.Printf("  POST %s://localhost:%s/graphql", scheme, port)
+	log.Printf("  POST %s://localhost:%s/admin/import", scheme, port)
+	log.Printf("  GET  %s://localhost:%s/admin/export", scheme, port)
+	log.Printf("  GET  %s://localhost:%s/admin/broken-links", scheme, port)
+	log.Printf("  GET  %s://localhost:%s/admin/webhooks/deliveries", scheme, port)
+	log.Printf("  GET/PUT/DELETE %s://localhost:%s/admin/custom-domains", scheme, port)
+	log.Printf("  GET  %s://localhost:%s/admin/tenants", scheme, port)
+	log.Printf("  POST %s://localhost:%s/admin/store/compact", scheme, port)
+	log.Printf("  GET  %s://localhost:%s/admin/ui/", scheme, port)
+	log.Printf("  GET  %s://localhost:%s/docs", scheme, port)
+	log.Printf("  GET  %s://localhost:%s/robots.txt, /favicon.ico, /.well-known/security.txt", scheme, port)
+	log.Printf("  GET  %s://localhost:%s/debug/stats", scheme, port)
+	log.Printf("  GET  %s://localhost:%s/debug/pprof/", scheme, port)
+
+	// ReadHeaderTimeout corta a los clientes lentos antes de que la petición llegue al router
+	server := &http.Server{
+		Addr:              ":" + port,
+		Handler:           r,
+		ReadHeaderTimeout: 5 * time.Second,
+		TLSConfig:         tlsConfig,
+	}
+	if !cfg.TLS.HTTP2 {
+		// Un mapa vacío impide que net/http active HTTP/2 por su cuenta
+		server.TLSNextProto = map[string]func(*http.Server, *tls.Conn, http.Handler){}
+	}
+	go func() {
+		var err error
+		if tlsConfig != nil {
+			// Los certificados ya están en TLSConfig
+			err = server.ListenAndServeTLS("", "")
+		} else {
+			err = server.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
+			log.Fatal("Error al iniciar el servidor:", err)
+		}
+	}()
+
+	// HTTP/3 experimental: escucha por UDP en el mismo puerto y las respuestas por TCP lo
+	// anuncian con Alt-Svc para que los clientes cambien en su siguiente conexión
+	var quicServer *http3.Server
+	if tlsConfig != nil && cfg.TLS.HTTP3 {
+		quicServer = &http3.Server{Addr: ":" + port, Handler: handlers.RejectEarlyData(r), TLSConfig: tlsConfig}
+		server.Handler = advertiseHTTP3(quicServer, r)
+		go func() {
+			if err := quicServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Fatal("Error al iniciar el listener HTTP/3:", err)
+			}
+		}()
+	}
+
+	// Con TLS, el puerto HTTP redirige a HTTPS y responde los desafíos ACME
+	var redirectServer *http.Server
+	if redirect != nil {
+		redirectServer = &http.Server{Addr: ":" + cfg.Port, Handler: redirect, ReadHeaderTimeout: 5 * time.Second}
+		go func() {
+			if err := redirectServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Fatal("Error al iniciar la redirección a HTTPS:", err)
+			}
+		}()
+	}
+
+	// Apagado ordenado: se terminan las peticiones en curso y se escriben los enlaces pendientes
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	<-stop
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("Apagado interrumpido: %v", err)
+	}
+	if redirectServer != nil {
+		redirectServer.Shutdown(ctx)
+	}
+	if quicServer != nil {
+		quicServer.Shutdown(ctx)
+	}
+	if writeBuffer != nil {
+		if err := writeBuffer.Flush(ctx); err != nil {
+			log.Printf("No se pudieron escribir %d enlaces pendientes: %v", writeBuffer.Stats().Pending, err)
+		}
+	}
+	stopForwarding()
+	<-forwarded
+	if forwarder != nil && forwarder.Stats().Dropped > 0 {
+		log.Printf("Eventos descartados sin enviar: %d", forwarder.Stats().Dropped)
+	}
+	log.Println("Servidor detenido")
+}
+
+// every ejecuta job cada interval, sin solapar ejecuciones; un intervalo cero o negativo no
+// programa nada
+func every(interval time.Duration, job func()) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		job()
+	}
+}
+
+// newBackupTarget crea el destino de las copias de seguridad de BACKUP_URL. Los buckets gs://
+// usan la API compatible con S3 de Google Cloud Storage.
+func newBackupTarget(cfg config.BackupConfig) (backup.Target, error) {
+	parsed, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, err
+	}
+	if parsed.Scheme == "file" {
+		return backup.NewDirTarget(parsed.Path)
+	}
+
+	s3 := backup.S3Config{
+		Endpoint:  cfg.S3Endpoint,
+		Region:    cfg.S3Region,
+		Bucket:    parsed.Host,
+		Prefix:    strings.TrimPrefix(parsed.Path, "/"),
+		AccessKey: cfg.AccessKey,
+		SecretKey: cfg.SecretKey,
+	}
+	if s3.Prefix != "" && !strings.HasSuffix(s3.Prefix, "/") {
+		s3.Prefix += "/"
+	}
+	switch {
+	case s3.Region == "" && parsed.Scheme == "gs":
+		s3.Region = "auto"
+	case s3.Region == "":
+		s3.Region = "us-east-1"
+	}
+	switch {
+	case s3.Endpoint == "" && parsed.Scheme == "gs":
+		s3.Endpoint = "https://storage.googleapis.com"
+	case s3.Endpoint == "":
+		s3.Endpoint = "https://s3." + s3.Region + ".amazonaws.com"
+	}
+	return backup.NewS3Target(s3)
+}
+
+// newOIDCLogin crea el proveedor de identidad configurado, descubriendo sus endpoints si es
+// OpenID Connect, y traduce OIDC_USERS a usuarios internos
+func newOIDCLogin(cfg config.OIDCConfig) (*handlers.OIDCLogin, error) {
+	users, err := auth.ParseGrants(cfg.Users)
+	if err != nil {
+		return nil, err
+	}
+	login := &handlers.OIDCLogin{SubjectClaim: cfg.SubjectClaim, Users: users, DefaultRole: cfg.DefaultRole}
+	if cfg.Issuer == "github" {
+		scopes := cfg.Scopes
+		if len(scopes) == 0 {
+			scopes = []string{"read:user"}
+		}
+		login.Provider = oidc.NewProvider(oidc.GitHub, cfg.ClientID, cfg.ClientSecret, cfg.RedirectURL, scopes)
+		login.Name = "GitHub"
+		return login, nil
+	}
+
+	scopes := cfg.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"openid", "email", "profile"}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if login.Provider, err = oidc.Discover(ctx, cfg.Issuer, cfg.ClientID, cfg.ClientSecret, cfg.RedirectURL, scopes); err != nil {
+		return nil, err
+	}
+	login.Name = cfg.Issuer
+	if u, err := url.Parse(cfg.Issuer); err == nil {
+		login.Name = u.Host
+	}
+	return login, nil
+}
+
+// newTLS prepara HTTPS con los ficheros del certificado o con certificados automáticos ACME.
+// Retorna la configuración del servidor HTTPS y el manejador del puerto HTTP, que redirige a
+// HTTPS y responde los desafíos HTTP-01; ambos nil si TLS está desactivado.
+func newTLS(cfg config.TLSConfig, httpPort string) (*tls.Config, http.Handler, error) {
+	// HTTP/2 se negocia por ALPN; multiplexa las peticiones de un cliente en una conexión y
+	// ahorra el handshake de las redirecciones siguientes
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12, NextProtos: []string{"http/1.1"}}
+	if cfg.HTTP2 {
+		tlsConfig.NextProtos = []string{"h2", "http/1.1"}
+	}
+	redirect := acme.RedirectHTTPS(cfg.Port)
+	switch {
+	case cfg.CertFile != "":
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+		return tlsConfig, redirect, nil
+	case len(cfg.AutocertHosts) > 0:
+		if httpPort != "80" {
+			log.Printf("Aviso: el desafío HTTP-01 llega al puerto 80; PORT=%s debe recibirlo", httpPort)
+		}
+		manager := acme.NewManager(cfg.AutocertDirectory, cfg.AutocertEmail, cfg.AutocertCacheDir, cfg.AutocertHosts)
+		tlsConfig.GetCertificate = manager.GetCertificate
+		return tlsConfig, manager.HTTPHandler(redirect), nil
+	}
+	return nil, nil, nil
+}
+
+// advertiseHTTP3 agrega a las respuestas la cabecera Alt-Svc del listener HTTP/3. Hasta que el
+// listener está activo no hay puerto que anunciar y las respuestas salen sin ella.
+func advertiseHTTP3(quicServer *http3.Server, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		quicServer.SetQUICHeaders(w.Header())
+		next.ServeHTTP(w, r)
+	})
+}
 
-	if err := http.ListenAndServe(":"+port, r); err != nil {
-		log.Fatal("Error al iniciar el servidor:", err)
+// usageLimits convierte las cuotas por clave de API de la configuración a las del servicio
+func usageLimits(perKey map[string]config.UsageQuotaLimits) map[string]shortener.UsageLimits {
+	limits := make(map[string]shortener.UsageLimits, len(perKey))
+	for apiKey, quota := range perKey {
+		limits[apiKey] = shortener.UsageLimits{Shortens: int64(quota.Shortens), Redirects: int64(quota.Redirects)}
 	}
+	return limits
 }
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"acortador-urls/internal/shortener"
+	"acortador-urls/pkg/client"
+)
+
+// backend abstrae el destino de los comandos: la API HTTP o un servicio en memoria local
+type backend interface {
+	Shorten(ctx context.Context, longURL, alias string, ttl time.Duration) (string, error)
+	Resolve(ctx context.Context, codes []string) ([]resolved, error)
+	List(ctx context.Context) ([]listedLink, error)
+	Stats(ctx context.Context) (int, error)
+}
+
+// resolved es el resultado de resolver un código
+type resolved struct {
+	code    string
+	longURL string
+	status  string // "ok", "expirado" o la descripción del error
+}
+
+// listedLink es un enlace mostrado por el comando list
+type listedLink struct {
+	code      string
+	longURL   string
+	createdAt time.Time
+	expiresAt time.Time
+}
+
+// httpBackend usa el cliente oficial contra la API
+type httpBackend struct {
+	client *client.Client
+}
+
+func newHTTPBackend(server, token, apiKey string) *httpBackend {
+	return &httpBackend{client: client.New(server, client.WithToken(token), client.WithAPIKey(apiKey))}
+}
+
+func (b *httpBackend) Shorten(ctx context.Context, longURL, alias string, ttl time.Duration) (string, error) {
+	result, err := b.client.Shorten(ctx, longURL, client.WithAlias(alias), client.WithTTL(ttl))
+	if err != nil {
+		return "", err
+	}
+	return result.ShortURL, nil
+}
+
+func (b *httpBackend) Resolve(ctx context.Context, codes []string) ([]resolved, error) {
+	results, err := b.client.Resolve(ctx, codes...)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]resolved, 0, len(results))
+	for _, result := range results {
+		item := resolved{code: result.ShortCode, longURL: result.LongURL, status: "ok"}
+		switch {
+		case result.Err != nil:
+			item.status = result.Err.Error()
+			if errors.Is(result.Err, client.ErrNotFound) {
+				item.status = "no encontrado"
+			}
+		case result.Expired:
+			item.status = "expirado"
+		}
+		out = append(out, item)
+	}
+	return out, nil
+}
+
+func (b *httpBackend) List(ctx context.Context) ([]listedLink, error) {
+	links, err := b.client.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]listedLink, 0, len(links))
+	for _, link := range links {
+		item := listedLink{code: link.ShortCode, longURL: link.LongURL, createdAt: link.CreatedAt}
+		if link.ExpiresAt != nil {
+			item.expiresAt = *link.ExpiresAt
+		}
+		out = append(out, item)
+	}
+	return out, nil
+}
+
+func (b *httpBackend) Stats(ctx context.Context) (int, error) {
+	stats, err := b.client.Stats(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return stats.TotalURLs, nil
+}
+
+// localBackend ejecuta los comandos contra un servicio en memoria del propio proceso. Como el
+// almacén no persiste, sirve para validar datos (p. ej. un CSV) sin un servidor.
+type localBackend struct {
+	service *shortener.Service
+}
+
+func newLocalBackend() *localBackend {
+	return &localBackend{service: shortener.NewService(shortener.NewStore())}
+}
+
+func (b *localBackend) Shorten(ctx context.Context, longURL, alias string, ttl time.Duration) (string, error) {
+	link, _, err := b.service.Shorten(ctx, shortener.ShortenInput{LongURL: longURL, Alias: alias, TTL: ttl})
+	if err != nil {
+		return "", err
+	}
+	return link.ShortCode, nil
+}
+
+func (b *localBackend) Resolve(ctx context.Context, codes []string) ([]resolved, error) {
+	out := make([]resolved, 0, len(codes))
+	for _, code := range codes {
+		item := resolved{code: code, status: "ok"}
+		link, err := b.service.GetLink(ctx, code)
+		switch {
+		case errors.Is(err, shortener.ErrURLNotFound):
+			item.status = "no encontrado"
+		case err != nil:
+			return nil, err
+		default:
+			item.longURL = link.LongURL
+			if link.IsExpired(time.Now()) {
+				item.status = "expirado"
+			}
+		}
+		out = append(out, item)
+	}
+	return out, nil
+}
+
+func (b *localBackend) List(ctx context.Context) ([]listedLink, error) {
+	links, err := b.service.ListByOwner(ctx, "", "")
+	if err != nil {
+		return nil, err
+	}
+	out := make([]listedLink, 0, len(links))
+	for _, link := range links {
+		out = append(out, listedLink{code: link.ShortCode, longURL: link.LongURL, createdAt: link.CreatedAt, expiresAt: link.ExpiresAt})
+	}
+	return out, nil
+}
+
+func (b *localBackend) Stats(ctx context.Context) (int, error) {
+	stats, err := b.service.GetStats(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return stats.TotalLinks, nil
+}
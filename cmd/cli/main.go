@@ -0,0 +1,239 @@
+// Comando acortador: herramienta de línea de comandos para scripting y operación.
+//
+//	acortador [opciones] shorten [-alias a] [-ttl 24h] <url>
+//	acortador [opciones] resolve <código>...
+//	acortador [opciones] list
+//	acortador [opciones] stats
+//	acortador [opciones] import <archivo.csv>
+//
+// Por defecto habla con la API HTTP (-server, -token, -api-key o las variables ACORTADOR_URL,
+// ACORTADOR_TOKEN y ACORTADOR_API_KEY). Con -local usa un servicio en memoria dentro del propio
+// proceso, útil para validar un CSV antes de importarlo.
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run ejecuta la CLI y retorna el código de salida
+func run(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("acortador", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	server := flags.String("server", getEnv("ACORTADOR_URL", "http://localhost:8089"), "URL base de la API")
+	token := flags.String("token", os.Getenv("ACORTADOR_TOKEN"), "token JWT para los comandos autenticados")
+	apiKey := flags.String("api-key", os.Getenv("ACORTADOR_API_KEY"), "clave de API (X-API-Key)")
+	timeout := flags.Duration("timeout", 30*time.Second, "tiempo máximo de cada comando")
+	local := flags.Bool("local", false, "usar un almacén en memoria en lugar de la API HTTP")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "Uso: acortador [opciones] <shorten|resolve|list|stats|import> [argumentos]")
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	var b backend
+	if *local {
+		b = newLocalBackend()
+	} else {
+		b = newHTTPBackend(*server, *token, *apiKey)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	command, commandArgs := flags.Arg(0), flags.Args()[1:]
+	var err error
+	switch command {
+	case "shorten":
+		err = runShorten(ctx, b, commandArgs, stdout, stderr)
+	case "resolve":
+		err = runResolve(ctx, b, commandArgs, stdout)
+	case "list":
+		err = runList(ctx, b, stdout)
+	case "stats":
+		err = runStats(ctx, b, stdout)
+	case "import":
+		err = runImport(ctx, b, commandArgs, stdout, stderr)
+	default:
+		err = fmt.Errorf("comando desconocido %q", command)
+	}
+
+	if err != nil {
+		fmt.Fprintln(stderr, "error:", err)
+		if errors.Is(err, errUsage) {
+			return 2
+		}
+		return 1
+	}
+	return 0
+}
+
+// errUsage marca los errores de uso (argumentos faltantes o inválidos)
+var errUsage = errors.New("uso incorrecto")
+
+func runShorten(ctx context.Context, b backend, args []string, stdout, stderr io.Writer) error {
+	flags := flag.NewFlagSet("shorten", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	alias := flags.String("alias", "", "código personalizado")
+	ttl := flags.Duration("ttl", 0, "tiempo de vida del enlace (p. ej. 24h)")
+	if err := flags.Parse(args); err != nil {
+		return fmt.Errorf("%w: %v", errUsage, err)
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("%w: shorten requiere exactamente una URL", errUsage)
+	}
+
+	shortURL, err := b.Shorten(ctx, flags.Arg(0), *alias, *ttl)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(stdout, shortURL)
+	return nil
+}
+
+func runResolve(ctx context.Context, b backend, codes []string, stdout io.Writer) error {
+	if len(codes) == 0 {
+		return fmt.Errorf("%w: resolve requiere al menos un código", errUsage)
+	}
+	results, err := b.Resolve(ctx, codes)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "CÓDIGO\tDESTINO\tESTADO")
+	for _, result := range results {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", result.code, dash(result.longURL), result.status)
+	}
+	return w.Flush()
+}
+
+func runList(ctx context.Context, b backend, stdout io.Writer) error {
+	links, err := b.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "CÓDIGO\tDESTINO\tCREADO\tEXPIRA")
+	for _, link := range links {
+		expires := "-"
+		if !link.expiresAt.IsZero() {
+			expires = link.expiresAt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", link.code, link.longURL, link.createdAt.Format(time.RFC3339), expires)
+	}
+	return w.Flush()
+}
+
+func runStats(ctx context.Context, b backend, stdout io.Writer) error {
+	total, err := b.Stats(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "total_urls: %d\n", total)
+	return nil
+}
+
+// runImport acorta cada fila del CSV (long_url[,alias[,ttl]]) leyéndolo en streaming. La
+// primera fila se omite si es una cabecera. Los errores por fila se reportan sin detener la
+// importación; el comando falla si alguna fila falló.
+func runImport(ctx context.Context, b backend, args []string, stdout, stderr io.Writer) error {
+	if len(args) != 1 {
+		return fmt.Errorf("%w: import requiere un archivo CSV (o - para la entrada estándar)", errUsage)
+	}
+
+	var in io.Reader = os.Stdin
+	if args[0] != "-" {
+		file, err := os.Open(args[0])
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		in = file
+	}
+
+	reader := csv.NewReader(in)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	succeeded, failed := 0, 0
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("CSV inválido: %w", err)
+		}
+		if line == 1 && strings.EqualFold(strings.TrimSpace(record[0]), "long_url") {
+			continue
+		}
+
+		alias, ttl, err := parseImportRecord(record)
+		if err == nil {
+			var shortURL string
+			if shortURL, err = b.Shorten(ctx, strings.TrimSpace(record[0]), alias, ttl); err == nil {
+				fmt.Fprintf(stdout, "%s,%s\n", record[0], shortURL)
+				succeeded++
+				continue
+			}
+		}
+		fmt.Fprintf(stderr, "línea %d: %v\n", line, err)
+		failed++
+	}
+
+	fmt.Fprintf(stderr, "importadas: %d, fallidas: %d\n", succeeded, failed)
+	if failed > 0 {
+		return fmt.Errorf("%d filas no se pudieron importar", failed)
+	}
+	return nil
+}
+
+// parseImportRecord lee las columnas opcionales alias y ttl (duración Go, p. ej. 720h)
+func parseImportRecord(record []string) (alias string, ttl time.Duration, err error) {
+	if len(record) > 1 {
+		alias = strings.TrimSpace(record[1])
+	}
+	if len(record) > 2 && strings.TrimSpace(record[2]) != "" {
+		if ttl, err = time.ParseDuration(strings.TrimSpace(record[2])); err != nil {
+			return "", 0, fmt.Errorf("ttl inválido %q", record[2])
+		}
+	}
+	return alias, ttl, nil
+}
+
+// getEnv retorna la variable de entorno o el valor por defecto si está vacía
+func getEnv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// dash muestra "-" para valores vacíos en las tablas
+func dash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
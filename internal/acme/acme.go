@@ -0,0 +1,629 @@
+// Package acme obtiene y renueva certificados TLS de Let's Encrypt u otra autoridad ACME
+// (RFC 8555) con el desafío HTTP-01, en la medida en que lo necesita el servicio: una cuenta
+// con clave ECDSA P-256, un pedido por host y certificados ECDSA guardados en un directorio.
+// Manager se conecta a tls.Config con GetCertificate y sirve los desafíos en el puerto 80 con
+// HTTPHandler.
+package acme
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LetsEncryptURL es el directorio de producción de Let's Encrypt
+const LetsEncryptURL = "https://acme-v02.api.letsencrypt.org/directory"
+
+// ChallengePath es el prefijo de las rutas de los desafíos HTTP-01
+const ChallengePath = "/.well-known/acme-challenge/"
+
+// Valores por defecto de la renovación y del cliente HTTP
+const (
+	// DefaultRenewBefore es la antelación con la que se renueva un certificado
+	DefaultRenewBefore = 30 * 24 * time.Hour
+	defaultHTTPTimeout = 30 * time.Second
+
+	// obtainTimeout acota la obtención completa de un certificado
+	obtainTimeout     = 2 * time.Minute
+	maxResponseBytes  = 1 << 20
+	accountKeyFile    = "acme_account.key"
+	badNonceErrorType = "urn:ietf:params:acme:error:badNonce"
+)
+
+// Errores de la obtención de certificados
+var (
+	// ErrHostNotAllowed indica un SNI que no está en la lista de hosts del Manager
+	ErrHostNotAllowed = errors.New("host no permitido para certificados automáticos")
+	// ErrACME indica que la autoridad rechazó una petición o no completó la validación
+	ErrACME = errors.New("error de la autoridad ACME")
+)
+
+// Manager obtiene, guarda y renueva los certificados de los hosts permitidos
+type Manager struct {
+	// DirectoryURL es el directorio ACME; LetsEncryptURL por defecto
+	DirectoryURL string
+	// Email es el contacto de la cuenta para los avisos de la autoridad; opcional
+	Email string
+	// CacheDir guarda la clave de la cuenta y los certificados; vacío los mantiene solo en
+	// memoria, lo que no se recomienda por los límites de emisión de la autoridad
+	CacheDir string
+	// RenewBefore es la antelación de la renovación; DefaultRenewBefore por defecto
+	RenewBefore time.Duration
+	Client      *http.Client
+
+	hosts map[string]bool
+	now   func() time.Time
+	// poll es la espera entre consultas del estado de autorizaciones y pedidos
+	poll time.Duration
+
+	mu         sync.Mutex
+	certs      map[string]*tls.Certificate
+	pending    map[string]chan struct{} // host -> cierre al terminar la obtención en curso
+	tokens     map[string]string        // token HTTP-01 -> autorización de clave
+	key        *ecdsa.PrivateKey
+	kid        string
+	dir        *directory
+	nonces     []string
+	registerMu sync.Mutex // serializa el registro de la cuenta
+}
+
+// NewManager crea un Manager para los hosts indicados
+func NewManager(directoryURL, email, cacheDir string, hosts []string) *Manager {
+	m := &Manager{
+		DirectoryURL: directoryURL,
+		Email:        email,
+		CacheDir:     cacheDir,
+		RenewBefore:  DefaultRenewBefore,
+		Client:       &http.Client{Timeout: defaultHTTPTimeout},
+		hosts:        make(map[string]bool, len(hosts)),
+		now:          time.Now,
+		poll:         time.Second,
+		certs:        make(map[string]*tls.Certificate),
+		pending:      make(map[string]chan struct{}),
+		tokens:       make(map[string]string),
+	}
+	if m.DirectoryURL == "" {
+		m.DirectoryURL = LetsEncryptURL
+	}
+	for _, host := range hosts {
+		m.hosts[normalizeHost(host)] = true
+	}
+	return m
+}
+
+// normalizeHost pasa el host a minúsculas y quita el punto final
+func normalizeHost(host string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(host)), ".")
+}
+
+// GetCertificate implementa tls.Config.GetCertificate: retorna el certificado del SNI, lo
+// obtiene la primera vez y lo renueva en segundo plano cuando se acerca su expiración
+func (m *Manager) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	host := normalizeHost(hello.ServerName)
+	if !m.hosts[host] {
+		return nil, fmt.Errorf("%w: %q", ErrHostNotAllowed, hello.ServerName)
+	}
+
+	cert := m.cached(host)
+	switch {
+	case cert == nil:
+		ctx, cancel := context.WithTimeout(context.Background(), obtainTimeout)
+		defer cancel()
+		return m.certificate(ctx, host)
+	case m.now().Add(m.RenewBefore).After(cert.Leaf.NotAfter):
+		// El certificado actual sigue siendo válido mientras se renueva
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), obtainTimeout)
+			defer cancel()
+			if _, err := m.certificate(ctx, host); err != nil {
+				log.Printf("No se pudo renovar el certificado de %s: %v", host, err)
+			}
+		}()
+	}
+	return cert, nil
+}
+
+// cached retorna el certificado del host en memoria o en el directorio, o nil
+func (m *Manager) cached(host string) *tls.Certificate {
+	m.mu.Lock()
+	cert, ok := m.certs[host]
+	m.mu.Unlock()
+	if ok {
+		return cert
+	}
+	if m.CacheDir == "" {
+		return nil
+	}
+	data, err := os.ReadFile(filepath.Join(m.CacheDir, host))
+	if err != nil {
+		return nil
+	}
+	if cert, err = parseCertificate(data, data); err != nil || !m.now().Before(cert.Leaf.NotAfter) {
+		return nil
+	}
+	m.mu.Lock()
+	m.certs[host] = cert
+	m.mu.Unlock()
+	return cert
+}
+
+// certificate obtiene un certificado nuevo para el host. Las peticiones concurrentes del mismo
+// host esperan a la obtención en curso en lugar de iniciar otra.
+func (m *Manager) certificate(ctx context.Context, host string) (*tls.Certificate, error) {
+	m.mu.Lock()
+	if done, ok := m.pending[host]; ok {
+		m.mu.Unlock()
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if cert := m.cached(host); cert != nil {
+			return cert, nil
+		}
+		return nil, fmt.Errorf("%w: no se obtuvo el certificado de %s", ErrACME, host)
+	}
+	done := make(chan struct{})
+	m.pending[host] = done
+	m.mu.Unlock()
+	defer func() {
+		m.mu.Lock()
+		delete(m.pending, host)
+		m.mu.Unlock()
+		close(done)
+	}()
+
+	certPEM, keyPEM, err := m.obtain(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := parseCertificate(certPEM, keyPEM)
+	if err != nil {
+		return nil, err
+	}
+	if m.CacheDir != "" {
+		if err := os.MkdirAll(m.CacheDir, 0o700); err == nil {
+			err = os.WriteFile(filepath.Join(m.CacheDir, host), append(keyPEM, certPEM...), 0o600)
+		}
+		if err != nil {
+			log.Printf("No se pudo guardar el certificado de %s: %v", host, err)
+		}
+	}
+	m.mu.Lock()
+	m.certs[host] = cert
+	m.mu.Unlock()
+	return cert, nil
+}
+
+// parseCertificate construye el certificado TLS con su hoja ya decodificada
+func parseCertificate(certPEM, keyPEM []byte) (*tls.Certificate, error) {
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, err
+	}
+	if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+		return nil, err
+	}
+	return &cert, nil
+}
+
+// HTTPHandler sirve los desafíos HTTP-01 y pasa el resto de peticiones a fallback; nil las
+// redirige a HTTPS con RedirectHTTPS(443)
+func (m *Manager) HTTPHandler(fallback http.Handler) http.Handler {
+	if fallback == nil {
+		fallback = RedirectHTTPS("443")
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.URL.Path, ChallengePath)
+		if !ok {
+			fallback.ServeHTTP(w, r)
+			return
+		}
+		m.mu.Lock()
+		authorization, found := m.tokens[token]
+		m.mu.Unlock()
+		if !found {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		io.WriteString(w, authorization)
+	})
+}
+
+// RedirectHTTPS redirige cada petición a la misma URL en HTTPS en el puerto indicado
+func RedirectHTTPS(port string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+		// 308 conserva el método y el cuerpo de los POST
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+}
+
+// directory son los endpoints de la autoridad
+type directory struct {
+	NewNonce   string `json:"newNonce"`
+	NewAccount string `json:"newAccount"`
+	NewOrder   string `json:"newOrder"`
+}
+
+// order es un pedido de certificado
+type order struct {
+	Status         string   `json:"status"`
+	Authorizations []string `json:"authorizations"`
+	Finalize       string   `json:"finalize"`
+	Certificate    string   `json:"certificate"`
+}
+
+// authorization es la autorización de un host con sus desafíos
+type authorization struct {
+	Status     string `json:"status"`
+	Challenges []struct {
+		Type   string `json:"type"`
+		URL    string `json:"url"`
+		Token  string `json:"token"`
+		Status string `json:"status"`
+	} `json:"challenges"`
+}
+
+// problem es un error de la autoridad (RFC 7807)
+type problem struct {
+	Type   string `json:"type"`
+	Detail string `json:"detail"`
+}
+
+// obtain ejecuta el flujo ACME para el host y retorna la cadena de certificados y la clave en PEM
+func (m *Manager) obtain(ctx context.Context, host string) (certPEM, keyPEM []byte, err error) {
+	if err := m.register(ctx); err != nil {
+		return nil, nil, err
+	}
+
+	var o order
+	orderURL, err := m.post(ctx, m.dir.NewOrder, map[string]interface{}{
+		"identifiers": []map[string]string{{"type": "dns", "value": host}},
+	}, &o)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, authzURL := range o.Authorizations {
+		if err := m.authorize(ctx, authzURL); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	certKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: host},
+		DNSNames: []string{host},
+	}, certKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err := m.post(ctx, o.Finalize, map[string]string{"csr": base64.RawURLEncoding.EncodeToString(csr)}, &o); err != nil {
+		return nil, nil, err
+	}
+	for o.Status != "valid" {
+		if o.Status == "invalid" {
+			return nil, nil, fmt.Errorf("%w: el pedido de %s quedó inválido", ErrACME, host)
+		}
+		if err := m.wait(ctx, m.poll); err != nil {
+			return nil, nil, err
+		}
+		if _, err := m.post(ctx, orderURL, nil, &o); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var chain bytes.Buffer
+	if _, err := m.post(ctx, o.Certificate, nil, &chain); err != nil {
+		return nil, nil, err
+	}
+	der, err := x509.MarshalECPrivateKey(certKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	return chain.Bytes(), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), nil
+}
+
+// authorize completa el desafío HTTP-01 de una autorización pendiente
+func (m *Manager) authorize(ctx context.Context, authzURL string) error {
+	var authz authorization
+	if _, err := m.post(ctx, authzURL, nil, &authz); err != nil {
+		return err
+	}
+	if authz.Status == "valid" {
+		return nil
+	}
+	for _, challenge := range authz.Challenges {
+		if challenge.Type != "http-01" {
+			continue
+		}
+		m.mu.Lock()
+		m.tokens[challenge.Token] = challenge.Token + "." + thumbprint(&m.key.PublicKey)
+		m.mu.Unlock()
+		defer func() {
+			m.mu.Lock()
+			delete(m.tokens, challenge.Token)
+			m.mu.Unlock()
+		}()
+
+		// Un objeto vacío pide a la autoridad que valide el desafío
+		if _, err := m.post(ctx, challenge.URL, struct{}{}, nil); err != nil {
+			return err
+		}
+		for {
+			if err := m.wait(ctx, m.poll); err != nil {
+				return err
+			}
+			if _, err := m.post(ctx, authzURL, nil, &authz); err != nil {
+				return err
+			}
+			switch authz.Status {
+			case "valid":
+				return nil
+			case "pending", "processing":
+			default:
+				return fmt.Errorf("%w: la autorización quedó %s", ErrACME, authz.Status)
+			}
+		}
+	}
+	return fmt.Errorf("%w: la autoridad no ofrece el desafío http-01", ErrACME)
+}
+
+// wait espera d salvo que se cancele el contexto
+func (m *Manager) wait(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// register lee el directorio y registra la cuenta la primera vez; la clave de la cuenta se
+// reutiliza entre reinicios si hay CacheDir
+func (m *Manager) register(ctx context.Context) error {
+	m.registerMu.Lock()
+	defer m.registerMu.Unlock()
+	if m.kid != "" {
+		return nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, m.DirectoryURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := m.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrACME, err)
+	}
+	defer resp.Body.Close()
+	var dir directory
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponseBytes)).Decode(&dir); err != nil || dir.NewOrder == "" {
+		return fmt.Errorf("%w: directorio inválido en %s", ErrACME, m.DirectoryURL)
+	}
+	m.dir = &dir
+
+	if m.key, err = m.accountKey(); err != nil {
+		return err
+	}
+	account := map[string]interface{}{"termsOfServiceAgreed": true}
+	if m.Email != "" {
+		account["contact"] = []string{"mailto:" + m.Email}
+	}
+	kid, err := m.post(ctx, dir.NewAccount, account, nil)
+	if err != nil {
+		return err
+	}
+	if kid == "" {
+		return fmt.Errorf("%w: la autoridad no retornó la cuenta", ErrACME)
+	}
+	m.kid = kid
+	return nil
+}
+
+// accountKey carga la clave de la cuenta del directorio o genera una nueva
+func (m *Manager) accountKey() (*ecdsa.PrivateKey, error) {
+	path := filepath.Join(m.CacheDir, accountKeyFile)
+	if m.CacheDir != "" {
+		if data, err := os.ReadFile(path); err == nil {
+			if block, _ := pem.Decode(data); block != nil {
+				return x509.ParseECPrivateKey(block.Bytes)
+			}
+		}
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	if m.CacheDir != "" {
+		der, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.MkdirAll(m.CacheDir, 0o700); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+			return nil, err
+		}
+	}
+	return key, nil
+}
+
+// post envía una petición firmada con JWS y decodifica la respuesta en v (JSON, o el cuerpo sin
+// decodificar si v es un *bytes.Buffer). payload nil es un POST-as-GET. Retorna la cabecera
+// Location. Se reintenta una vez si la autoridad rechaza el nonce.
+func (m *Manager) post(ctx context.Context, url string, payload interface{}, v interface{}) (string, error) {
+	for attempt := 0; ; attempt++ {
+		nonce, err := m.nonce(ctx)
+		if err != nil {
+			return "", err
+		}
+		body, err := m.sign(url, nonce, payload)
+		if err != nil {
+			return "", err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+		if err != nil {
+			return "", err
+		}
+		req.Header.Set("Content-Type", "application/jose+json")
+		resp, err := m.Client.Do(req)
+		if err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return "", ctxErr
+			}
+			return "", fmt.Errorf("%w: %v", ErrACME, err)
+		}
+		data, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBytes))
+		resp.Body.Close()
+		if nonce := resp.Header.Get("Replay-Nonce"); nonce != "" {
+			m.mu.Lock()
+			m.nonces = append(m.nonces, nonce)
+			m.mu.Unlock()
+		}
+		if err != nil {
+			return "", fmt.Errorf("%w: %v", ErrACME, err)
+		}
+
+		if resp.StatusCode >= 400 {
+			var p problem
+			json.Unmarshal(data, &p)
+			if p.Type == badNonceErrorType && attempt == 0 {
+				continue
+			}
+			return "", fmt.Errorf("%w: %s respondió %s: %s", ErrACME, url, resp.Status, p.Detail)
+		}
+		switch out := v.(type) {
+		case nil:
+		case *bytes.Buffer:
+			out.Write(data)
+		default:
+			if err := json.Unmarshal(data, v); err != nil {
+				return "", fmt.Errorf("%w: respuesta inválida de %s: %v", ErrACME, url, err)
+			}
+		}
+		return resp.Header.Get("Location"), nil
+	}
+}
+
+// nonce retorna un nonce recibido en una respuesta anterior o pide uno nuevo
+func (m *Manager) nonce(ctx context.Context) (string, error) {
+	m.mu.Lock()
+	if n := len(m.nonces); n > 0 {
+		nonce := m.nonces[n-1]
+		m.nonces = m.nonces[:n-1]
+		m.mu.Unlock()
+		return nonce, nil
+	}
+	m.mu.Unlock()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, m.dir.NewNonce, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := m.Client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrACME, err)
+	}
+	resp.Body.Close()
+	nonce := resp.Header.Get("Replay-Nonce")
+	if nonce == "" {
+		return "", fmt.Errorf("%w: %s no retornó un nonce", ErrACME, m.dir.NewNonce)
+	}
+	return nonce, nil
+}
+
+// sign construye el JWS (serialización JSON plana, ES256) de la petición. Antes de registrar
+// la cuenta se identifica con su clave pública (jwk) y después con su URL (kid).
+func (m *Manager) sign(url, nonce string, payload interface{}) ([]byte, error) {
+	protected := map[string]interface{}{"alg": "ES256", "nonce": nonce, "url": url}
+	if m.kid == "" {
+		protected["jwk"] = jwk(&m.key.PublicKey)
+	} else {
+		protected["kid"] = m.kid
+	}
+	header, err := json.Marshal(protected)
+	if err != nil {
+		return nil, err
+	}
+	encodedPayload := ""
+	if payload != nil {
+		raw, err := json.Marshal(payload)
+		if err != nil {
+			return nil, err
+		}
+		encodedPayload = base64.RawURLEncoding.EncodeToString(raw)
+	}
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + encodedPayload
+	digest := sha256.Sum256([]byte(signingInput))
+	r, s, err := ecdsa.Sign(rand.Reader, m.key, digest[:])
+	if err != nil {
+		return nil, err
+	}
+	// ES256 es r || s con 32 bytes cada uno (RFC 7518 3.4)
+	signature := make([]byte, 64)
+	r.FillBytes(signature[:32])
+	s.FillBytes(signature[32:])
+	return json.Marshal(map[string]string{
+		"protected": base64.RawURLEncoding.EncodeToString(header),
+		"payload":   encodedPayload,
+		"signature": base64.RawURLEncoding.EncodeToString(signature),
+	})
+}
+
+// jwk es la clave pública de la cuenta en formato JWK, con los miembros en el orden de RFC 7638
+func jwk(key *ecdsa.PublicKey) map[string]string {
+	return map[string]string{
+		"crv": "P-256",
+		"kty": "EC",
+		"x":   base64.RawURLEncoding.EncodeToString(padded(key.X)),
+		"y":   base64.RawURLEncoding.EncodeToString(padded(key.Y)),
+	}
+}
+
+// padded retorna la coordenada con la longitud fija de 32 bytes de P-256
+func padded(n *big.Int) []byte {
+	return n.FillBytes(make([]byte, 32))
+}
+
+// thumbprint es la huella SHA-256 de la clave de la cuenta (RFC 7638) usada en la autorización
+// de clave de los desafíos. json.Marshal ordena las claves del mapa como exige la huella.
+func thumbprint(key *ecdsa.PublicKey) string {
+	raw, _ := json.Marshal(jwk(key))
+	sum := sha256.Sum256(raw)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
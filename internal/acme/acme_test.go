@@ -0,0 +1,340 @@
+package acme
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeCA es una autoridad ACME de prueba que comprueba las firmas JWS, valida el desafío
+// HTTP-01 contra el Manager y emite certificados firmados con una CA propia
+type fakeCA struct {
+	server  *httptest.Server
+	manager *Manager
+	caKey   *ecdsa.PrivateKey
+	caCert  *x509.Certificate
+
+	mu       sync.Mutex
+	nonce    int
+	accounts map[string]*ecdsa.PublicKey // kid -> clave de la cuenta
+	host     string
+	token    string
+	status   string
+	issued   []byte
+	orders   int
+	// badNonce rechaza la siguiente petición firmada con badNonce
+	badNonce bool
+	// wrongToken consulta otro token al validar el desafío, que así falla
+	wrongToken bool
+}
+
+func newFakeCA(t *testing.T) *fakeCA {
+	f := &fakeCA{accounts: make(map[string]*ecdsa.PublicKey)}
+	f.caKey, _ = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "CA de prueba"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, _ := x509.CreateCertificate(rand.Reader, template, template, &f.caKey.PublicKey, f.caKey)
+	f.caCert, _ = x509.ParseCertificate(der)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/directory", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"newNonce":   f.server.URL + "/nonce",
+			"newAccount": f.server.URL + "/account",
+			"newOrder":   f.server.URL + "/order",
+		})
+	})
+	mux.HandleFunc("/nonce", func(w http.ResponseWriter, r *http.Request) {
+		f.setNonce(w)
+	})
+	mux.HandleFunc("/account", func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := f.verify(w, r); !ok {
+			return
+		}
+		w.Header().Set("Location", f.server.URL+"/account/1")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"status":"valid"}`))
+	})
+	mux.HandleFunc("/order", func(w http.ResponseWriter, r *http.Request) {
+		payload, ok := f.verify(w, r)
+		if !ok {
+			return
+		}
+		var req struct {
+			Identifiers []struct{ Value string } `json:"identifiers"`
+		}
+		json.Unmarshal(payload, &req)
+		f.mu.Lock()
+		f.host, f.token, f.status, f.issued = req.Identifiers[0].Value, "token-"+strconv.Itoa(f.nonce), "pending", nil
+		f.orders++
+		f.mu.Unlock()
+		w.Header().Set("Location", f.server.URL+"/order/1")
+		w.WriteHeader(http.StatusCreated)
+		f.writeOrder(w)
+	})
+	mux.HandleFunc("/order/1", func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := f.verify(w, r); ok {
+			f.writeOrder(w)
+		}
+	})
+	mux.HandleFunc("/authz/1", func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := f.verify(w, r); !ok {
+			return
+		}
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status": f.status,
+			"challenges": []map[string]string{
+				{"type": "dns-01", "url": f.server.URL + "/challenge/dns", "token": "dns"},
+				{"type": "http-01", "url": f.server.URL + "/challenge/1", "token": f.token},
+			},
+		})
+	})
+	mux.HandleFunc("/challenge/1", func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := f.verify(w, r); !ok {
+			return
+		}
+		// La autoridad consulta el desafío en el puerto 80 del host
+		f.mu.Lock()
+		token, path := f.token, f.token
+		if f.wrongToken {
+			path = "otro"
+		}
+		f.mu.Unlock()
+		rec := httptest.NewRecorder()
+		f.manager.HTTPHandler(nil).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "http://"+f.host+ChallengePath+path, nil))
+		f.mu.Lock()
+		f.status = "invalid"
+		if rec.Code == http.StatusOK && rec.Body.String() == token+"."+thumbprint(&f.manager.key.PublicKey) {
+			f.status = "valid"
+		}
+		f.mu.Unlock()
+		w.Write([]byte(`{"status":"processing"}`))
+	})
+	mux.HandleFunc("/finalize/1", func(w http.ResponseWriter, r *http.Request) {
+		payload, ok := f.verify(w, r)
+		if !ok {
+			return
+		}
+		var req struct{ CSR string }
+		json.Unmarshal(payload, &req)
+		der, _ := base64.RawURLEncoding.DecodeString(req.CSR)
+		csr, err := x509.ParseCertificateRequest(der)
+		if err != nil || csr.CheckSignature() != nil {
+			f.problem(w, http.StatusBadRequest, "urn:ietf:params:acme:error:badCSR")
+			return
+		}
+		leaf := &x509.Certificate{
+			SerialNumber: big.NewInt(time.Now().UnixNano()),
+			Subject:      csr.Subject,
+			DNSNames:     csr.DNSNames,
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(90 * 24 * time.Hour),
+		}
+		cert, _ := x509.CreateCertificate(rand.Reader, leaf, f.caCert, csr.PublicKey, f.caKey)
+		f.mu.Lock()
+		f.issued = append(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert}),
+			pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: f.caCert.Raw})...)
+		f.mu.Unlock()
+		f.writeOrder(w)
+	})
+	mux.HandleFunc("/cert/1", func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := f.verify(w, r); !ok {
+			return
+		}
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		w.Header().Set("Content-Type", "application/pem-certificate-chain")
+		w.Write(f.issued)
+	})
+	f.server = httptest.NewServer(mux)
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+func (f *fakeCA) setNonce(w http.ResponseWriter) {
+	f.mu.Lock()
+	f.nonce++
+	w.Header().Set("Replay-Nonce", "nonce-"+strconv.Itoa(f.nonce))
+	f.mu.Unlock()
+}
+
+func (f *fakeCA) problem(w http.ResponseWriter, status int, kind string) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"type": kind, "detail": "rechazado por la autoridad de prueba"})
+}
+
+func (f *fakeCA) writeOrder(w http.ResponseWriter) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	order := map[string]interface{}{
+		"status":         "pending",
+		"authorizations": []string{f.server.URL + "/authz/1"},
+		"finalize":       f.server.URL + "/finalize/1",
+	}
+	switch {
+	case f.issued != nil:
+		order["status"] = "valid"
+		order["certificate"] = f.server.URL + "/cert/1"
+	case f.status == "valid":
+		order["status"] = "ready"
+	}
+	json.NewEncoder(w).Encode(order)
+}
+
+// verify comprueba el JWS de la petición: la URL protegida, el nonce y la firma con la clave
+// de la cuenta (jwk al registrarla, kid después). Retorna el payload decodificado.
+func (f *fakeCA) verify(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	f.setNonce(w)
+	if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/jose+json" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return nil, false
+	}
+	var jws struct{ Protected, Payload, Signature string }
+	json.NewDecoder(r.Body).Decode(&jws)
+	raw, _ := base64.RawURLEncoding.DecodeString(jws.Protected)
+	var protected struct {
+		Alg, Nonce, URL, Kid string
+		JWK                  map[string]string
+	}
+	json.Unmarshal(raw, &protected)
+
+	f.mu.Lock()
+	badNonce := f.badNonce
+	f.badNonce = false
+	key := f.accounts[protected.Kid]
+	f.mu.Unlock()
+	if badNonce || !strings.HasPrefix(protected.Nonce, "nonce-") {
+		f.problem(w, http.StatusBadRequest, badNonceErrorType)
+		return nil, false
+	}
+	if protected.JWK != nil && r.URL.Path == "/account" {
+		x, _ := base64.RawURLEncoding.DecodeString(protected.JWK["x"])
+		y, _ := base64.RawURLEncoding.DecodeString(protected.JWK["y"])
+		key = &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		f.mu.Lock()
+		f.accounts[f.server.URL+"/account/1"] = key
+		f.mu.Unlock()
+	}
+	sig, _ := base64.RawURLEncoding.DecodeString(jws.Signature)
+	digest := sha256.Sum256([]byte(jws.Protected + "." + jws.Payload))
+	if key == nil || protected.Alg != "ES256" || protected.URL != f.server.URL+r.URL.Path || len(sig) != 64 ||
+		!ecdsa.Verify(key, digest[:], new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])) {
+		f.problem(w, http.StatusUnauthorized, "urn:ietf:params:acme:error:malformed")
+		return nil, false
+	}
+	payload, _ := base64.RawURLEncoding.DecodeString(jws.Payload)
+	return payload, true
+}
+
+func TestManager_GetCertificate(t *testing.T) {
+	ca := newFakeCA(t)
+	dir := t.TempDir()
+	m := NewManager(ca.server.URL+"/directory", "admin@sho.rt", dir, []string{"Sho.rt"})
+	m.poll = time.Millisecond
+	ca.manager = m
+	ca.badNonce = true
+
+	cert, err := m.GetCertificate(&tls.ClientHelloInfo{ServerName: "sho.rt"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.caCert)
+	if _, err := cert.Leaf.Verify(x509.VerifyOptions{DNSName: "sho.rt", Roots: roots}); err != nil {
+		t.Errorf("Expected a certificate for sho.rt issued by the CA, got %v", err)
+	}
+	if len(m.tokens) != 0 {
+		t.Errorf("Expected the challenge tokens to be removed, got %v", m.tokens)
+	}
+
+	// Los certificados y la clave de la cuenta se reutilizan tras un reinicio
+	restarted := NewManager(ca.server.URL+"/directory", "", dir, []string{"sho.rt"})
+	again, err := restarted.GetCertificate(&tls.ClientHelloInfo{ServerName: "SHO.RT"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if ca.orders != 1 || again.Leaf.SerialNumber.Cmp(cert.Leaf.SerialNumber) != 0 {
+		t.Errorf("Expected the cached certificate, got %d orders", ca.orders)
+	}
+	if key, err := restarted.accountKey(); err != nil || !key.Equal(m.key) {
+		t.Errorf("Expected the cached account key, got %v", err)
+	}
+
+	if _, err := m.GetCertificate(&tls.ClientHelloInfo{ServerName: "otro.example"}); !errors.Is(err, ErrHostNotAllowed) {
+		t.Errorf("Expected ErrHostNotAllowed, got %v", err)
+	}
+}
+
+func TestManager_GetCertificateFailedChallenge(t *testing.T) {
+	ca := newFakeCA(t)
+	m := NewManager(ca.server.URL+"/directory", "", "", []string{"sho.rt"})
+	m.poll = time.Millisecond
+	ca.manager = m
+	ca.wrongToken = true
+
+	if _, err := m.GetCertificate(&tls.ClientHelloInfo{ServerName: "sho.rt"}); !errors.Is(err, ErrACME) {
+		t.Errorf("Expected ErrACME, got %v", err)
+	}
+	if len(m.certs) != 0 {
+		t.Errorf("Expected no certificate, got %v", m.certs)
+	}
+}
+
+func TestManager_HTTPHandler(t *testing.T) {
+	m := NewManager("", "", "", []string{"sho.rt"})
+	m.tokens["abc"] = "abc.huella"
+	handler := m.HTTPHandler(RedirectHTTPS("8443"))
+
+	tests := []struct {
+		name             string
+		target           string
+		expectedStatus   int
+		expectedBody     string
+		expectedLocation string
+	}{
+		{"Desafío conocido", "http://sho.rt" + ChallengePath + "abc", http.StatusOK, "abc.huella", ""},
+		{"Desafío desconocido", "http://sho.rt" + ChallengePath + "otro", http.StatusNotFound, "", ""},
+		{"Redirección a HTTPS", "http://sho.rt:8080/abc?utm=1", http.StatusPermanentRedirect, "", "https://sho.rt:8443/abc?utm=1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.target, nil))
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, rec.Code)
+			}
+			if tt.expectedBody != "" && rec.Body.String() != tt.expectedBody {
+				t.Errorf("Expected body %q, got %q", tt.expectedBody, rec.Body.String())
+			}
+			if rec.Header().Get("Location") != tt.expectedLocation {
+				t.Errorf("Expected location %q, got %q", tt.expectedLocation, rec.Header().Get("Location"))
+			}
+		})
+	}
+}
@@ -0,0 +1,210 @@
+// Package analytics agrega en memoria la actividad de los enlaces a partir del bus de eventos del
+// servicio: la reciente (visitas por minuto y visitantes únicos) para los paneles en vivo y la
+// diaria para los informes periódicos.
+package analytics
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"acortador-urls/internal/shortener"
+)
+
+// DefaultWindow es el periodo sobre el que se calculan las métricas en vivo
+const DefaultWindow = 5 * time.Minute
+
+// maxVisitorsPerLink acota la memoria de los visitantes de cada enlace; por encima, la cifra de
+// visitantes únicos deja de crecer
+const maxVisitorsPerLink = 100000
+
+// subscriptionBuffer es el buffer de la suscripción del tracker al broker
+const subscriptionBuffer = 1024
+
+// LinkCounters son las métricas en vivo de un enlace
+type LinkCounters struct {
+	ShortCode string
+	Owner     string
+	// Clicks es el contador total de visitas del enlace tras la última visita
+	Clicks int64
+	// ClicksPerMinute es la media de visitas por minuto en la ventana
+	ClicksPerMinute float64
+	// UniqueVisitors es el número de visitantes distintos en la ventana
+	UniqueVisitors int
+}
+
+// Filter selecciona los enlaces de un snapshot; los campos vacíos no filtran
+type Filter struct {
+	ShortCode string
+	Owner     string
+	// Tag selecciona los enlaces con esa etiqueta
+	Tag string
+}
+
+// linkActivity es la actividad reciente de un enlace
+type linkActivity struct {
+	shortCode string
+	owner     string
+	tags      []string
+	clicks    int64
+	// seconds son las visitas agrupadas por segundo Unix, de la más antigua a la más reciente
+	seconds []secondCount
+	// visitors es la última visita de cada visitante
+	visitors map[string]time.Time
+}
+
+type secondCount struct {
+	second int64
+	count  int
+}
+
+// Tracker mantiene las métricas en vivo de los enlaces con visitas en la ventana
+type Tracker struct {
+	window time.Duration
+
+	mu sync.Mutex
+	// links es la actividad por clave del enlace (shortener.Link.Key): el mismo código puede
+	// existir en otros dominios y tenants
+	links map[string]*linkActivity
+
+	now func() time.Time
+}
+
+// NewTracker crea un tracker con la ventana indicada (DefaultWindow si no es positiva)
+func NewTracker(window time.Duration) *Tracker {
+	if window <= 0 {
+		window = DefaultWindow
+	}
+	return &Tracker{window: window, links: make(map[string]*linkActivity), now: time.Now}
+}
+
+// Window retorna la ventana de las métricas
+func (t *Tracker) Window() time.Duration {
+	return t.window
+}
+
+// Run se suscribe a las visitas del broker y las agrega hasta que se cancela ctx. Cada ventana
+// olvida los enlaces sin actividad.
+func (t *Tracker) Run(ctx context.Context, broker *shortener.EventBroker) {
+	events, cancel := broker.Subscribe(shortener.EventFilter{Types: []string{shortener.EventClicked}}, subscriptionBuffer)
+	defer cancel()
+	sweep := time.NewTicker(t.window)
+	defer sweep.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-events:
+			t.Record(event)
+		case <-sweep.C:
+			t.mu.Lock()
+			t.pruneLocked(t.now())
+			t.mu.Unlock()
+		}
+	}
+}
+
+// Record agrega una visita
+func (t *Tracker) Record(event shortener.Event) {
+	if event.Type != shortener.EventClicked {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	key := event.Link.Key()
+	activity, ok := t.links[key]
+	if !ok {
+		activity = &linkActivity{shortCode: event.Link.ShortCode, visitors: make(map[string]time.Time)}
+		t.links[key] = activity
+	}
+	activity.owner = event.Link.Owner
+	activity.tags = event.Link.Tags
+	activity.clicks = event.Link.Clicks
+
+	at := event.Time
+	if at.IsZero() {
+		at = t.now()
+	}
+	second := at.Unix()
+	if n := len(activity.seconds); n > 0 && activity.seconds[n-1].second >= second {
+		activity.seconds[n-1].count++
+	} else {
+		activity.seconds = append(activity.seconds, secondCount{second: second, count: 1})
+	}
+	// Los bots suman visitas pero no visitantes
+	if event.Visitor != "" && !event.Bot {
+		if _, seen := activity.visitors[event.Visitor]; seen || len(activity.visitors) < maxVisitorsPerLink {
+			activity.visitors[event.Visitor] = at
+		}
+	}
+}
+
+// Forget descarta la actividad reciente de los enlaces con las claves indicadas, p. ej. al
+// borrar los datos de su propietario
+func (t *Tracker) Forget(keys ...string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, key := range keys {
+		delete(t.links, key)
+	}
+}
+
+// pruneLocked descarta la actividad anterior a la ventana y los enlaces sin actividad; requiere mu
+func (t *Tracker) pruneLocked(now time.Time) {
+	cutoff := now.Add(-t.window)
+	for key, activity := range t.links {
+		i := 0
+		for i < len(activity.seconds) && activity.seconds[i].second < cutoff.Unix() {
+			i++
+		}
+		activity.seconds = activity.seconds[i:]
+		for visitor, seen := range activity.visitors {
+			if seen.Before(cutoff) {
+				delete(activity.visitors, visitor)
+			}
+		}
+		if len(activity.seconds) == 0 {
+			delete(t.links, key)
+		}
+	}
+}
+
+// Snapshot retorna las métricas de los enlaces con visitas en la ventana que pasan el filtro,
+// de más a menos visitas por minuto
+func (t *Tracker) Snapshot(filter Filter) []LinkCounters {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.pruneLocked(t.now())
+
+	counters := make([]LinkCounters, 0, len(t.links))
+	for _, activity := range t.links {
+		if (filter.ShortCode != "" && activity.shortCode != filter.ShortCode) || (filter.Owner != "" && activity.owner != filter.Owner) {
+			continue
+		}
+		if filter.Tag != "" && !(shortener.Link{Tags: activity.tags}).HasTag(filter.Tag) {
+			continue
+		}
+		clicks := 0
+		for _, second := range activity.seconds {
+			clicks += second.count
+		}
+		counters = append(counters, LinkCounters{
+			ShortCode:       activity.shortCode,
+			Owner:           activity.owner,
+			Clicks:          activity.clicks,
+			ClicksPerMinute: float64(clicks) / t.window.Minutes(),
+			UniqueVisitors:  len(activity.visitors),
+		})
+	}
+	sort.Slice(counters, func(i, j int) bool {
+		if counters[i].ClicksPerMinute != counters[j].ClicksPerMinute {
+			return counters[i].ClicksPerMinute > counters[j].ClicksPerMinute
+		}
+		if counters[i].ShortCode != counters[j].ShortCode {
+			return counters[i].ShortCode < counters[j].ShortCode
+		}
+		return counters[i].Owner < counters[j].Owner
+	})
+	return counters
+}
@@ -0,0 +1,223 @@
+package analytics
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"acortador-urls/internal/shortener"
+)
+
+func click(code, owner, visitor string, clicks int64, at time.Time) shortener.Event {
+	return shortener.Event{
+		Type:    shortener.EventClicked,
+		Time:    at,
+		Link:    shortener.Link{ShortCode: code, Owner: owner, Clicks: clicks},
+		Visitor: visitor,
+	}
+}
+
+func TestTracker_Snapshot(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	tracker := NewTracker(2 * time.Minute)
+	tracker.now = func() time.Time { return now }
+
+	// Visita fuera de la ventana: no cuenta
+	tracker.Record(click("uno", "alice", "v0", 1, now.Add(-3*time.Minute)))
+	tracker.Record(click("uno", "alice", "v1", 2, now.Add(-time.Minute)))
+	tracker.Record(click("uno", "alice", "v1", 3, now.Add(-30*time.Second)))
+	tracker.Record(click("uno", "alice", "v2", 4, now.Add(-30*time.Second)))
+	tracker.Record(click("uno", "alice", "v3", 5, now))
+	dos := click("dos", "bob", "v1", 10, now)
+	dos.Link.Tags = []string{"newsletter"}
+	tracker.Record(dos)
+	tracker.Record(shortener.Event{Type: shortener.EventCreated, Link: shortener.Link{ShortCode: "tres"}})
+	// El mismo código en otro tenant es otro enlace, con su propio propietario y contadores
+	otro := click("uno", "carol", "v9", 7, now)
+	otro.Link.Tenant = "equipo-a"
+	tracker.Record(otro)
+
+	tests := []struct {
+		name     string
+		filter   Filter
+		expected []LinkCounters
+	}{
+		{name: "Todos", expected: []LinkCounters{
+			{ShortCode: "uno", Owner: "alice", Clicks: 5, ClicksPerMinute: 2, UniqueVisitors: 3},
+			{ShortCode: "dos", Owner: "bob", Clicks: 10, ClicksPerMinute: 0.5, UniqueVisitors: 1},
+			{ShortCode: "uno", Owner: "carol", Clicks: 7, ClicksPerMinute: 0.5, UniqueVisitors: 1},
+		}},
+		{name: "Mismo código en otro tenant", filter: Filter{Owner: "alice"}, expected: []LinkCounters{
+			{ShortCode: "uno", Owner: "alice", Clicks: 5, ClicksPerMinute: 2, UniqueVisitors: 3},
+		}},
+		{name: "Por propietario", filter: Filter{Owner: "bob"}, expected: []LinkCounters{
+			{ShortCode: "dos", Owner: "bob", Clicks: 10, ClicksPerMinute: 0.5, UniqueVisitors: 1},
+		}},
+		{name: "Por etiqueta", filter: Filter{Tag: "Newsletter"}, expected: []LinkCounters{
+			{ShortCode: "dos", Owner: "bob", Clicks: 10, ClicksPerMinute: 0.5, UniqueVisitors: 1},
+		}},
+		{name: "Por etiqueta sin enlaces", filter: Filter{Tag: "q3-campaign"}, expected: []LinkCounters{}},
+		{name: "Por código sin actividad", filter: Filter{ShortCode: "tres"}, expected: []LinkCounters{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tracker.Snapshot(tt.filter)
+			if len(got) != len(tt.expected) {
+				t.Fatalf("Expected %d links, got %+v", len(tt.expected), got)
+			}
+			for i := range got {
+				if got[i] != tt.expected[i] {
+					t.Errorf("Expected %+v, got %+v", tt.expected[i], got[i])
+				}
+			}
+		})
+	}
+
+	// Olvidar un enlace no toca el mismo código de otro tenant
+	tracker.Forget(shortener.Link{ShortCode: "uno"}.Key())
+	if got := tracker.Snapshot(Filter{ShortCode: "uno"}); len(got) != 1 || got[0].Owner != "carol" {
+		t.Errorf("Expected only the other tenant's link to remain, got %+v", got)
+	}
+
+	// Pasada la ventana, los enlaces sin actividad desaparecen
+	now = now.Add(3 * time.Minute)
+	if got := tracker.Snapshot(Filter{}); len(got) != 0 {
+		t.Errorf("Expected no links after the window, got %+v", got)
+	}
+}
+
+func TestTracker_Run(t *testing.T) {
+	broker := shortener.NewEventBroker()
+	tracker := NewTracker(time.Minute)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go tracker.Run(ctx, broker)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for broker.Subscribers() == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	broker.HandleEvent(click("uno", "alice", "v1", 1, time.Now()))
+	for len(tracker.Snapshot(Filter{})) == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if got := tracker.Snapshot(Filter{}); len(got) != 1 || got[0].ShortCode != "uno" {
+		t.Errorf("Expected click from the broker to be tracked, got %+v", got)
+	}
+}
+
+func TestAggregator_Summary(t *testing.T) {
+	now := time.Date(2024, 1, 10, 12, 0, 0, 0, time.UTC)
+	aggregator := NewAggregator(30 * 24 * time.Hour)
+	aggregator.now = func() time.Time { return now }
+
+	visit := func(code, owner, referrer, country string, bot bool, at time.Time) {
+		event := click(code, owner, "", 0, at)
+		event.Referrer, event.Country, event.Bot = referrer, country, bot
+		aggregator.Record(event)
+	}
+	created := func(code, owner string, at time.Time) {
+		aggregator.Record(shortener.Event{Type: shortener.EventCreated, Time: at, Link: shortener.Link{ShortCode: code, Owner: owner}})
+	}
+	created("uno", "alice", now.Add(-2*24*time.Hour))
+	created("dos", "bob", now.Add(-time.Hour))
+	// Fuera de un periodo de 7 días, dentro del de 30
+	created("viejo", "alice", now.Add(-10*24*time.Hour))
+	visit("viejo", "alice", "old.example", "FR", false, now.Add(-10*24*time.Hour))
+	visit("uno", "alice", "news.example", "ES", false, now.Add(-2*24*time.Hour))
+	visit("uno", "alice", "news.example", "ES", false, now.Add(-24*time.Hour))
+	visit("uno", "alice", "", "", true, now)
+	visit("dos", "bob", "social.example", "US", false, now)
+	visit("dos", "bob", "news.example", "", false, now)
+
+	tests := []struct {
+		name     string
+		filter   Filter
+		days     int
+		top      int
+		expected Summary
+	}{
+		{name: "Últimos 7 días", days: 7, expected: Summary{
+			From: time.Date(2024, 1, 4, 0, 0, 0, 0, time.UTC), To: time.Date(2024, 1, 11, 0, 0, 0, 0, time.UTC),
+			Clicks: 5, BotClicks: 1, NewLinks: 2,
+			TopLinks:     []LinkTotal{{ShortCode: "uno", Owner: "alice", Clicks: 3}, {ShortCode: "dos", Owner: "bob", Clicks: 2}},
+			TopReferrers: []Total{{Key: "news.example", Clicks: 3}, {Key: "social.example", Clicks: 1}},
+			TopCountries: []Total{{Key: "ES", Clicks: 2}, {Key: "US", Clicks: 1}},
+		}},
+		{name: "Por propietario con límite", filter: Filter{Owner: "alice"}, days: 30, top: 1, expected: Summary{
+			From: time.Date(2023, 12, 12, 0, 0, 0, 0, time.UTC), To: time.Date(2024, 1, 11, 0, 0, 0, 0, time.UTC),
+			Clicks: 4, BotClicks: 1, NewLinks: 2,
+			TopLinks:     []LinkTotal{{ShortCode: "uno", Owner: "alice", Clicks: 3}},
+			TopReferrers: []Total{{Key: "news.example", Clicks: 2}},
+			TopCountries: []Total{{Key: "ES", Clicks: 2}},
+		}},
+		{name: "Periodo acotado a la retención", filter: Filter{ShortCode: "viejo"}, days: 365, expected: Summary{
+			From: time.Date(2023, 12, 12, 0, 0, 0, 0, time.UTC), To: time.Date(2024, 1, 11, 0, 0, 0, 0, time.UTC),
+			Clicks: 1, NewLinks: 1,
+			TopLinks:     []LinkTotal{{ShortCode: "viejo", Owner: "alice", Clicks: 1}},
+			TopReferrers: []Total{{Key: "old.example", Clicks: 1}},
+			TopCountries: []Total{{Key: "FR", Clicks: 1}},
+		}},
+		{name: "Solo hoy", filter: Filter{Owner: "carol"}, days: 1, expected: Summary{
+			From: time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC), To: time.Date(2024, 1, 11, 0, 0, 0, 0, time.UTC),
+			TopLinks: []LinkTotal{}, TopReferrers: []Total{}, TopCountries: []Total{},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := aggregator.Summary(tt.filter, tt.days, tt.top)
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Expected %+v, got %+v", tt.expected, got)
+			}
+		})
+	}
+
+	// Los enlaces olvidados desaparecen de todos los días
+	aggregator.Forget("uno")
+	if got := aggregator.Summary(Filter{Owner: "alice"}, 7, 0); got.Clicks != 0 || got.NewLinks != 0 {
+		t.Errorf("Expected forgotten link to be gone, got %+v", got)
+	}
+	// Los días fuera de la retención se descartan
+	now = now.Add(30 * 24 * time.Hour)
+	aggregator.Summary(Filter{}, 1, 0)
+	if len(aggregator.days) != 0 {
+		t.Errorf("Expected days outside the retention to be pruned, got %d", len(aggregator.days))
+	}
+}
+
+func TestAggregator_Visits(t *testing.T) {
+	now := time.Date(2024, 1, 10, 12, 0, 0, 0, time.UTC)
+	aggregator := NewAggregator(30 * 24 * time.Hour)
+	aggregator.now = func() time.Time { return now }
+
+	link := shortener.Link{ShortCode: "uno", Owner: "alice"}
+	tenantLink := shortener.Link{ShortCode: "uno", Owner: "bob", Tenant: "acme"}
+	for _, at := range []time.Time{now.Add(-48 * time.Hour), now.Add(-25 * time.Hour), now.Add(-time.Hour), now} {
+		aggregator.Record(shortener.Event{Type: shortener.EventClicked, Time: at, Link: link, Referrer: "news.example", Country: "ES", Variant: "a"})
+	}
+	aggregator.Record(shortener.Event{Type: shortener.EventClicked, Time: now, Link: link, Bot: true})
+	// El mismo código en otro tenant es otro enlace
+	aggregator.Record(shortener.Event{Type: shortener.EventClicked, Time: now, Link: tenantLink})
+
+	visits := aggregator.Visits(link.Key(), now.Add(-30*time.Hour), now)
+	expected := []Visit{
+		{Time: now.Add(-25 * time.Hour), Variant: "a", Referrer: "news.example", Country: "ES"},
+		{Time: now.Add(-time.Hour), Variant: "a", Referrer: "news.example", Country: "ES"},
+	}
+	if !reflect.DeepEqual(visits, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, visits)
+	}
+
+	totals := aggregator.DayTotals(link.Key(), now.Add(-30*time.Hour), now.Add(time.Hour))
+	expectedTotals := []DayTotal{
+		{Day: time.Date(2024, 1, 9, 0, 0, 0, 0, time.UTC), Clicks: 1},
+		{Day: time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC), Clicks: 3, BotClicks: 1},
+	}
+	if !reflect.DeepEqual(totals, expectedTotals) {
+		t.Errorf("Expected %+v, got %+v", expectedTotals, totals)
+	}
+	if got := aggregator.Visits(tenantLink.Key(), time.Time{}, now.Add(time.Hour)); len(got) != 1 {
+		t.Errorf("Expected 1 visit on the tenant link, got %+v", got)
+	}
+}
@@ -0,0 +1,355 @@
+package analytics
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"acortador-urls/internal/shortener"
+)
+
+// DefaultRetention es el número de días de agregados que conserva el Aggregator por defecto
+const DefaultRetention = 90 * 24 * time.Hour
+
+// DefaultTop es el número de entradas de cada clasificación del resumen
+const DefaultTop = 10
+
+// maxKeysPerLinkDay acota los referrers y países distintos que se cuentan por enlace y día; por
+// encima, los nuevos dejan de contarse en las clasificaciones pero sí en el total de visitas
+const maxKeysPerLinkDay = 1000
+
+// MaxVisitsPerLinkDay acota las visitas individuales que se conservan por enlace y día para
+// exportarlas; por encima solo se cuentan en los agregados
+const MaxVisitsPerLinkDay = 10000
+
+// Summary resume la actividad de los enlaces en un periodo de días completos (UTC)
+type Summary struct {
+	// From es el inicio del primer día del periodo y To el final del último
+	From time.Time
+	To   time.Time
+	// Clicks son todas las visitas del periodo, incluidas las de bots (BotClicks)
+	Clicks    int64
+	BotClicks int64
+	// NewLinks son los enlaces creados en el periodo
+	NewLinks int
+	// TopLinks son los enlaces con más visitas, de más a menos
+	TopLinks []LinkTotal
+	// TopReferrers son los dominios de procedencia con más visitas. Las visitas directas, las
+	// privadas (Do Not Track) y las de origen desconocido no cuentan.
+	TopReferrers []Total
+	// TopCountries son los países con más visitas; las visitas sin país conocido no cuentan
+	TopCountries []Total
+}
+
+// LinkTotal son las visitas de un enlace en el periodo
+type LinkTotal struct {
+	ShortCode string
+	Owner     string
+	Clicks    int64
+}
+
+// Total son las visitas de un referrer o país en el periodo
+type Total struct {
+	Key    string
+	Clicks int64
+}
+
+// Visit es una visita individual tal como se exporta. No identifica al visitante.
+type Visit struct {
+	Time     time.Time
+	Variant  string
+	Bot      bool
+	Referrer string
+	Country  string
+}
+
+// DayTotal son las visitas de un enlace en un día
+type DayTotal struct {
+	// Day es el inicio (UTC) del día
+	Day       time.Time
+	Clicks    int64
+	BotClicks int64
+}
+
+// linkDay es la actividad de un enlace en un día
+type linkDay struct {
+	shortCode string
+	owner     string
+	tags      []string
+	created   bool
+	clicks    int64
+	botClicks int64
+	referrers map[string]int64
+	countries map[string]int64
+	// visits son las visitas del día en orden de llegada, hasta MaxVisitsPerLinkDay
+	visits []Visit
+}
+
+// Aggregator agrega por día las visitas y altas de enlaces del bus de eventos para los informes
+// periódicos y guarda las visitas individuales para exportarlas. Conserva los días de la
+// retención y, como Tracker, solo ve los eventos de esta instancia desde que arrancó.
+type Aggregator struct {
+	retention time.Duration
+
+	mu sync.Mutex
+	// days son los agregados de cada día (días Unix) por clave del enlace (shortener.Link.Key)
+	days map[int64]map[string]*linkDay
+
+	now func() time.Time
+}
+
+// NewAggregator crea un agregador que conserva los días de retention (DefaultRetention si es
+// menor de un día)
+func NewAggregator(retention time.Duration) *Aggregator {
+	if retention < 24*time.Hour {
+		retention = DefaultRetention
+	}
+	return &Aggregator{retention: retention, days: make(map[int64]map[string]*linkDay), now: time.Now}
+}
+
+// RetentionDays es el periodo máximo, en días, de los resúmenes
+func (a *Aggregator) RetentionDays() int {
+	return int(a.retention / (24 * time.Hour))
+}
+
+// Run se suscribe a las altas y visitas del broker y las agrega hasta que se cancela ctx. Cada
+// hora descarta los días fuera de la retención.
+func (a *Aggregator) Run(ctx context.Context, broker *shortener.EventBroker) {
+	events, cancel := broker.Subscribe(shortener.EventFilter{Types: []string{shortener.EventCreated, shortener.EventClicked}}, subscriptionBuffer)
+	defer cancel()
+	sweep := time.NewTicker(time.Hour)
+	defer sweep.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-events:
+			a.Record(event)
+		case <-sweep.C:
+			a.mu.Lock()
+			a.pruneLocked(a.now())
+			a.mu.Unlock()
+		}
+	}
+}
+
+// Record agrega un alta o una visita
+func (a *Aggregator) Record(event shortener.Event) {
+	if event.Type != shortener.EventCreated && event.Type != shortener.EventClicked {
+		return
+	}
+	at := event.Time
+	if at.IsZero() {
+		at = a.now()
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	day := unixDay(at)
+	links, ok := a.days[day]
+	if !ok {
+		links = make(map[string]*linkDay)
+		a.days[day] = links
+	}
+	key := event.Link.Key()
+	activity, ok := links[key]
+	if !ok {
+		activity = &linkDay{shortCode: event.Link.ShortCode, referrers: make(map[string]int64), countries: make(map[string]int64)}
+		links[key] = activity
+	}
+	activity.owner = event.Link.Owner
+	activity.tags = event.Link.Tags
+
+	if event.Type == shortener.EventCreated {
+		activity.created = true
+		return
+	}
+	activity.clicks++
+	if event.Bot {
+		activity.botClicks++
+	}
+	countKey(activity.referrers, event.Referrer)
+	countKey(activity.countries, event.Country)
+	if len(activity.visits) < MaxVisitsPerLinkDay {
+		activity.visits = append(activity.visits, Visit{Time: at.UTC(), Variant: event.Variant, Bot: event.Bot,
+			Referrer: event.Referrer, Country: event.Country})
+	}
+}
+
+// countKey suma una visita a key si no está vacía y cabe en el límite
+func countKey(counts map[string]int64, key string) {
+	if _, seen := counts[key]; key != "" && (seen || len(counts) < maxKeysPerLinkDay) {
+		counts[key]++
+	}
+}
+
+// Forget descarta los agregados de los enlaces con las claves indicadas, p. ej. al borrar los
+// datos de su propietario
+func (a *Aggregator) Forget(keys ...string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, links := range a.days {
+		for _, key := range keys {
+			delete(links, key)
+		}
+	}
+}
+
+// pruneLocked descarta los días fuera de la retención; requiere mu
+func (a *Aggregator) pruneLocked(now time.Time) {
+	oldest := unixDay(now) - int64(a.RetentionDays()) + 1
+	for day := range a.days {
+		if day < oldest {
+			delete(a.days, day)
+		}
+	}
+}
+
+// Summary resume los days últimos días, incluido el actual, de los enlaces que pasan el
+// filtro, con las top primeras entradas de cada clasificación (DefaultTop si no es positivo).
+// days se acota a la retención.
+func (a *Aggregator) Summary(filter Filter, days, top int) Summary {
+	if days < 1 {
+		days = 1
+	}
+	if max := a.RetentionDays(); days > max {
+		days = max
+	}
+	if top <= 0 {
+		top = DefaultTop
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	now := a.now()
+	a.pruneLocked(now)
+
+	last := unixDay(now)
+	first := last - int64(days) + 1
+	summary := Summary{From: dayStart(first), To: dayStart(last + 1)}
+	links := make(map[string]*LinkTotal)
+	referrers := make(map[string]int64)
+	countries := make(map[string]int64)
+	for day := first; day <= last; day++ {
+		for key, activity := range a.days[day] {
+			if (filter.ShortCode != "" && activity.shortCode != filter.ShortCode) || (filter.Owner != "" && activity.owner != filter.Owner) {
+				continue
+			}
+			if filter.Tag != "" && !(shortener.Link{Tags: activity.tags}).HasTag(filter.Tag) {
+				continue
+			}
+			if activity.created {
+				summary.NewLinks++
+			}
+			summary.Clicks += activity.clicks
+			summary.BotClicks += activity.botClicks
+			if activity.clicks > 0 {
+				total, ok := links[key]
+				if !ok {
+					total = &LinkTotal{ShortCode: activity.shortCode}
+					links[key] = total
+				}
+				total.Owner = activity.owner
+				total.Clicks += activity.clicks
+			}
+			for referrer, clicks := range activity.referrers {
+				referrers[referrer] += clicks
+			}
+			for country, clicks := range activity.countries {
+				countries[country] += clicks
+			}
+		}
+	}
+
+	summary.TopLinks = make([]LinkTotal, 0, len(links))
+	for _, total := range links {
+		summary.TopLinks = append(summary.TopLinks, *total)
+	}
+	sort.Slice(summary.TopLinks, func(i, j int) bool {
+		if summary.TopLinks[i].Clicks != summary.TopLinks[j].Clicks {
+			return summary.TopLinks[i].Clicks > summary.TopLinks[j].Clicks
+		}
+		return summary.TopLinks[i].ShortCode < summary.TopLinks[j].ShortCode
+	})
+	if len(summary.TopLinks) > top {
+		summary.TopLinks = summary.TopLinks[:top]
+	}
+	summary.TopReferrers = topTotals(referrers, top)
+	summary.TopCountries = topTotals(countries, top)
+	return summary
+}
+
+// Visits retorna las visitas conservadas del enlace con la clave indicada entre from
+// (incluido) y to (excluido), de la más antigua a la más reciente
+func (a *Aggregator) Visits(key string, from, to time.Time) []Visit {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.pruneLocked(a.now())
+
+	visits := make([]Visit, 0)
+	for _, day := range a.daysBetween(from, to) {
+		if activity, ok := a.days[day][key]; ok {
+			for _, visit := range activity.visits {
+				if !visit.Time.Before(from) && visit.Time.Before(to) {
+					visits = append(visits, visit)
+				}
+			}
+		}
+	}
+	return visits
+}
+
+// DayTotals retorna las visitas por día del enlace con la clave indicada en los días que se
+// solapan con [from, to), del más antiguo al más reciente; los días sin visitas se omiten
+func (a *Aggregator) DayTotals(key string, from, to time.Time) []DayTotal {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.pruneLocked(a.now())
+
+	totals := make([]DayTotal, 0)
+	for _, day := range a.daysBetween(from, to) {
+		if activity, ok := a.days[day][key]; ok && activity.clicks > 0 {
+			totals = append(totals, DayTotal{Day: dayStart(day), Clicks: activity.clicks, BotClicks: activity.botClicks})
+		}
+	}
+	return totals
+}
+
+// daysBetween retorna en orden los días con datos que se solapan con [from, to); requiere mu
+func (a *Aggregator) daysBetween(from, to time.Time) []int64 {
+	days := make([]int64, 0, len(a.days))
+	for day := range a.days {
+		if dayStart(day+1).After(from) && dayStart(day).Before(to) {
+			days = append(days, day)
+		}
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i] < days[j] })
+	return days
+}
+
+// topTotals ordena los contadores de más a menos visitas y retorna los top primeros
+func topTotals(counts map[string]int64, top int) []Total {
+	totals := make([]Total, 0, len(counts))
+	for key, clicks := range counts {
+		totals = append(totals, Total{Key: key, Clicks: clicks})
+	}
+	sort.Slice(totals, func(i, j int) bool {
+		if totals[i].Clicks != totals[j].Clicks {
+			return totals[i].Clicks > totals[j].Clicks
+		}
+		return totals[i].Key < totals[j].Key
+	})
+	if len(totals) > top {
+		totals = totals[:top]
+	}
+	return totals
+}
+
+// unixDay es el número de días UTC desde la época Unix
+func unixDay(t time.Time) int64 {
+	return t.Unix() / int64(24*time.Hour/time.Second)
+}
+
+// dayStart es el inicio (UTC) del día Unix
+func dayStart(day int64) time.Time {
+	return time.Unix(day*int64(24*time.Hour/time.Second), 0).UTC()
+}
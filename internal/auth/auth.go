@@ -0,0 +1,254 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Roles soportados por el servicio
+const (
+	// RoleOwner es el rol por defecto: crea enlaces y gestiona los propios
+	RoleOwner = "owner"
+	// RoleUser es el nombre anterior de RoleOwner; Verify lo normaliza a RoleOwner
+	RoleUser = "user"
+	// RoleEditor crea enlaces en un espacio compartido (Claims.Workspace) y edita los de ese
+	// espacio, pero no elimina enlaces
+	RoleEditor = "editor"
+	// RoleAdmin puede gestionar enlaces de cualquier usuario y acceder a /admin
+	RoleAdmin = "admin"
+)
+
+// Errores predefinidos de autenticación
+var (
+	ErrInvalidToken = errors.New("token inválido")
+	ErrExpiredToken = errors.New("token expirado")
+	ErrMissingKey   = errors.New("clave de firma no configurada")
+	ErrInvalidRole  = errors.New("rol desconocido o sin espacio compartido")
+)
+
+// Claims representa la identidad contenida en un token JWT
+type Claims struct {
+	Subject   string `json:"sub"`
+	Role      string `json:"role,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+
+	// Workspace es el espacio compartido de un editor; obligatorio con RoleEditor
+	Workspace string `json:"workspace,omitempty"`
+}
+
+// IsAdmin indica si las claims pertenecen a un administrador
+func (c *Claims) IsAdmin() bool {
+	return c.Role == RoleAdmin
+}
+
+// HasRole indica si las claims tienen alguno de los roles indicados
+func (c *Claims) HasRole(roles ...string) bool {
+	for _, role := range roles {
+		if c.Role == role {
+			return true
+		}
+	}
+	return false
+}
+
+// normalize completa el rol por defecto y valida que sea conocido; los editores deben
+// pertenecer a un espacio compartido
+func (c *Claims) normalize() error {
+	switch c.Role {
+	case "", RoleUser:
+		c.Role = RoleOwner
+	case RoleOwner, RoleAdmin:
+	case RoleEditor:
+		if c.Workspace == "" {
+			return ErrInvalidRole
+		}
+	default:
+		return ErrInvalidRole
+	}
+	return nil
+}
+
+// jwtHeader es la cabecera fija de los tokens emitidos (HS256)
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ"`
+}
+
+// TokenManager emite y verifica tokens JWT firmados con HMAC-SHA256
+type TokenManager struct {
+	secret []byte
+	ttl    time.Duration
+	now    func() time.Time
+}
+
+// NewTokenManager crea un gestor de tokens con la clave y duración indicadas
+func NewTokenManager(secret []byte, ttl time.Duration) *TokenManager {
+	return &TokenManager{
+		secret: secret,
+		ttl:    ttl,
+		now:    time.Now,
+	}
+}
+
+// Issue emite un token firmado para el sujeto y rol indicados
+func (m *TokenManager) Issue(subject, role string) (string, error) {
+	return m.IssueClaims(Claims{Subject: subject, Role: role})
+}
+
+// IssueClaims emite un token firmado con las claims indicadas, p. ej. las de un editor con su
+// espacio compartido. Las fechas de emisión y expiración se calculan al emitirlo.
+func (m *TokenManager) IssueClaims(claims Claims) (string, error) {
+	if len(m.secret) == 0 {
+		return "", ErrMissingKey
+	}
+	if err := claims.normalize(); err != nil {
+		return "", err
+	}
+
+	now := m.now()
+	claims.IssuedAt = now.Unix()
+	claims.ExpiresAt = 0
+	if m.ttl > 0 {
+		claims.ExpiresAt = now.Add(m.ttl).Unix()
+	}
+
+	header, err := json.Marshal(jwtHeader{Alg: "HS256", Typ: "JWT"})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := encodeSegment(header) + "." + encodeSegment(payload)
+	return signingInput + "." + encodeSegment(m.sign(signingInput)), nil
+}
+
+// Verify valida la firma y la expiración de un token y retorna sus claims
+func (m *TokenManager) Verify(token string) (*Claims, error) {
+	if len(m.secret) == 0 {
+		return nil, ErrMissingKey
+	}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+
+	// Validar la cabecera antes de comprobar la firma para rechazar "alg": "none"
+	var header jwtHeader
+	if raw, err := decodeSegment(parts[0]); err != nil {
+		return nil, ErrInvalidToken
+	} else if err := json.Unmarshal(raw, &header); err != nil || header.Alg != "HS256" {
+		return nil, ErrInvalidToken
+	}
+
+	signature, err := decodeSegment(parts[2])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	if !hmac.Equal(signature, m.sign(parts[0]+"."+parts[1])) {
+		return nil, ErrInvalidToken
+	}
+
+	var claims Claims
+	if raw, err := decodeSegment(parts[1]); err != nil {
+		return nil, ErrInvalidToken
+	} else if err := json.Unmarshal(raw, &claims); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	if claims.Subject == "" {
+		return nil, ErrInvalidToken
+	}
+	if claims.ExpiresAt != 0 && m.now().Unix() >= claims.ExpiresAt {
+		return nil, ErrExpiredToken
+	}
+	// Un rol desconocido invalida el token en lugar de degradarse a propietario
+	if err := claims.normalize(); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	return &claims, nil
+}
+
+// APIKeys asocia cada clave de API con la identidad con la que actúa
+type APIKeys map[string]*Claims
+
+// ParseAPIKeys construye las identidades de las claves de API a partir de pares clave ->
+// "sujeto:rol" o "sujeto:editor:espacio"
+func ParseAPIKeys(grants map[string]string) (APIKeys, error) {
+	keys, err := ParseGrants(grants)
+	return APIKeys(keys), err
+}
+
+// ParseGrants construye la identidad de cada entrada de grants (nombre -> "sujeto:rol" o
+// "sujeto:editor:espacio"), p. ej. la de cada identidad externa de OIDC_USERS
+func ParseGrants(grants map[string]string) (map[string]*Claims, error) {
+	identities := make(map[string]*Claims, len(grants))
+	for name, grant := range grants {
+		claims, err := ParseGrant(grant)
+		if err != nil {
+			return nil, err
+		}
+		identities[name] = claims
+	}
+	return identities, nil
+}
+
+// ParseGrant construye la identidad descrita por "sujeto:rol" o "sujeto:editor:espacio"
+func ParseGrant(grant string) (*Claims, error) {
+	parts := strings.Split(grant, ":")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" {
+		return nil, fmt.Errorf("%w: %q debe tener la forma sujeto:rol[:espacio]", ErrInvalidRole, grant)
+	}
+	claims := &Claims{Subject: parts[0], Role: parts[1]}
+	if len(parts) == 3 {
+		if claims.Role != RoleEditor {
+			return nil, fmt.Errorf("%w: solo los editores tienen espacio compartido: %q", ErrInvalidRole, grant)
+		}
+		claims.Workspace = parts[2]
+	}
+	if err := claims.normalize(); err != nil {
+		return nil, fmt.Errorf("%w: %q", err, grant)
+	}
+	return claims, nil
+}
+
+// sign calcula la firma HMAC-SHA256 de la entrada
+func (m *TokenManager) sign(input string) []byte {
+	mac := hmac.New(sha256.New, m.secret)
+	mac.Write([]byte(input))
+	return mac.Sum(nil)
+}
+
+func encodeSegment(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeSegment(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(s)
+}
+
+// contextKey evita colisiones con otras claves de contexto
+type contextKey struct{}
+
+// WithClaims retorna un contexto que transporta las claims autenticadas
+func WithClaims(ctx context.Context, claims *Claims) context.Context {
+	return context.WithValue(ctx, contextKey{}, claims)
+}
+
+// ClaimsFromContext obtiene las claims autenticadas del contexto, si existen
+func ClaimsFromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(contextKey{}).(*Claims)
+	return claims, ok && claims != nil
+}
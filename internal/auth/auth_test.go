@@ -0,0 +1,145 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTokenManager_IssueAndVerify(t *testing.T) {
+	tokens := NewTokenManager([]byte("secreto-de-prueba"), time.Hour)
+
+	token, err := tokens.Issue("user-1", RoleAdmin)
+	if err != nil {
+		t.Fatalf("Unexpected error issuing token: %v", err)
+	}
+
+	claims, err := tokens.Verify(token)
+	if err != nil {
+		t.Fatalf("Unexpected error verifying token: %v", err)
+	}
+	if claims.Subject != "user-1" {
+		t.Errorf("Expected subject user-1, got %s", claims.Subject)
+	}
+	if !claims.IsAdmin() {
+		t.Errorf("Expected admin role, got %s", claims.Role)
+	}
+}
+
+func TestTokenManager_RejectsInvalidTokens(t *testing.T) {
+	tokens := NewTokenManager([]byte("secreto-de-prueba"), time.Hour)
+	other := NewTokenManager([]byte("otro-secreto"), time.Hour)
+
+	valid, _ := tokens.Issue("user-1", RoleUser)
+	foreign, _ := other.Issue("user-1", RoleAdmin)
+	parts := strings.Split(valid, ".")
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{name: "Token vacío", token: ""},
+		{name: "Segmentos insuficientes", token: "abc.def"},
+		{name: "Firma de otra clave", token: foreign},
+		{name: "Payload alterado", token: parts[0] + "." + encodeSegment([]byte(`{"sub":"admin","role":"admin"}`)) + "." + parts[2]},
+		{name: "Algoritmo none", token: encodeSegment([]byte(`{"alg":"none","typ":"JWT"}`)) + "." + parts[1] + "."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tokens.Verify(tt.token); err != ErrInvalidToken {
+				t.Errorf("Expected ErrInvalidToken, got %v", err)
+			}
+		})
+	}
+}
+
+func TestTokenManager_ExpiredToken(t *testing.T) {
+	tokens := NewTokenManager([]byte("secreto-de-prueba"), time.Minute)
+	issuedAt := time.Now()
+	tokens.now = func() time.Time { return issuedAt }
+
+	token, err := tokens.Issue("user-1", "")
+	if err != nil {
+		t.Fatalf("Unexpected error issuing token: %v", err)
+	}
+
+	tokens.now = func() time.Time { return issuedAt.Add(2 * time.Minute) }
+	if _, err := tokens.Verify(token); err != ErrExpiredToken {
+		t.Errorf("Expected ErrExpiredToken, got %v", err)
+	}
+}
+
+func TestTokenManager_Roles(t *testing.T) {
+	tokens := NewTokenManager([]byte("secreto-de-prueba"), time.Hour)
+	// signed firma un payload arbitrario, como haría un emisor externo con la misma clave
+	signed := func(payload string) string {
+		input := encodeSegment([]byte(`{"alg":"HS256","typ":"JWT"}`)) + "." + encodeSegment([]byte(payload))
+		return input + "." + encodeSegment(tokens.sign(input))
+	}
+
+	tests := []struct {
+		name              string
+		token             string
+		expectedRole      string
+		expectedWorkspace string
+		expectError       bool
+	}{
+		{name: "Rol anterior user", token: signed(`{"sub":"u1","role":"user"}`), expectedRole: RoleOwner},
+		{name: "Sin rol", token: signed(`{"sub":"u1"}`), expectedRole: RoleOwner},
+		{name: "Editor con espacio", token: signed(`{"sub":"u1","role":"editor","workspace":"marketing"}`), expectedRole: RoleEditor, expectedWorkspace: "marketing"},
+		{name: "Editor sin espacio", token: signed(`{"sub":"u1","role":"editor"}`), expectError: true},
+		{name: "Rol desconocido", token: signed(`{"sub":"u1","role":"root"}`), expectError: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := tokens.Verify(tt.token)
+			if tt.expectError {
+				if err != ErrInvalidToken {
+					t.Errorf("Expected ErrInvalidToken, got %v", err)
+				}
+				return
+			}
+			if err != nil || claims.Role != tt.expectedRole || claims.Workspace != tt.expectedWorkspace {
+				t.Errorf("Expected role %s in %q, got %+v (%v)", tt.expectedRole, tt.expectedWorkspace, claims, err)
+			}
+		})
+	}
+
+	if _, err := tokens.IssueClaims(Claims{Subject: "u1", Role: RoleEditor}); !errors.Is(err, ErrInvalidRole) {
+		t.Errorf("Expected ErrInvalidRole issuing an editor without workspace, got %v", err)
+	}
+}
+
+func TestParseAPIKeys(t *testing.T) {
+	keys, err := ParseAPIKeys(map[string]string{"k1": "bot:admin", "k2": "equipo:editor:marketing"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if claims := keys["k1"]; claims.Subject != "bot" || !claims.IsAdmin() {
+		t.Errorf("Expected admin bot, got %+v", claims)
+	}
+	if claims := keys["k2"]; claims.Role != RoleEditor || claims.Workspace != "marketing" {
+		t.Errorf("Expected editor in marketing, got %+v", claims)
+	}
+
+	for _, grant := range []string{"bot", ":owner", "bot:root", "bot:editor", "bot:owner:marketing"} {
+		if _, err := ParseAPIKeys(map[string]string{"k": grant}); !errors.Is(err, ErrInvalidRole) {
+			t.Errorf("Expected ErrInvalidRole for %q, got %v", grant, err)
+		}
+	}
+}
+
+func TestClaimsContext(t *testing.T) {
+	if _, ok := ClaimsFromContext(context.Background()); ok {
+		t.Error("Expected no claims in empty context")
+	}
+
+	ctx := WithClaims(context.Background(), &Claims{Subject: "user-1"})
+	claims, ok := ClaimsFromContext(ctx)
+	if !ok || claims.Subject != "user-1" {
+		t.Errorf("Expected claims for user-1, got %+v", claims)
+	}
+}
@@ -0,0 +1,254 @@
+// Package backup guarda copias de los enlaces del almacén en un directorio local o en un bucket
+// compatible con S3 (Amazon S3, Google Cloud Storage, MinIO...) y las restaura. Cada copia es
+// un archivo JSON Lines comprimido con gzip: una cabecera seguida de un enlace por línea. Las
+// copias se crean periódicamente y se conservan las más recientes según la política de
+// retención.
+package backup
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"acortador-urls/internal/errcode"
+	"acortador-urls/internal/shortener"
+)
+
+// Formato de las copias
+const (
+	// Format identifica el contenido en la cabecera de cada copia
+	Format = "acortador-urls/links"
+	// Version es la versión del formato; las copias de versiones posteriores no se restauran
+	Version = 1
+)
+
+// Nombres de las copias: "links-<momento UTC>.jsonl.gz", que se ordenan cronológicamente
+const (
+	namePrefix = "links-"
+	nameSuffix = ".jsonl.gz"
+	timeLayout = "20060102T150405.000Z"
+)
+
+// DefaultRetention es el número de copias que se conservan por defecto
+const DefaultRetention = 7
+
+// maxLineSize acota cada línea de una copia al restaurarla
+const maxLineSize = 4 << 20
+
+// Errores de las copias
+var (
+	ErrSnapshotNotFound = errcode.New(errcode.SnapshotNotFound, "copia de seguridad no encontrada")
+	ErrInvalidSnapshot  = errcode.New(errcode.InvalidSnapshot, "copia de seguridad inválida")
+)
+
+// Object es un archivo guardado en el destino
+type Object struct {
+	Name string
+	Size int64
+}
+
+// Target es el lugar donde se guardan las copias. Get retorna ErrSnapshotNotFound si el
+// archivo no existe.
+type Target interface {
+	Put(ctx context.Context, name string, data []byte) error
+	Get(ctx context.Context, name string) ([]byte, error)
+	List(ctx context.Context) ([]Object, error)
+	Delete(ctx context.Context, name string) error
+}
+
+// Source son los enlaces que se copian y restauran; lo implementa *shortener.Service
+type Source interface {
+	EachLink(ctx context.Context, fn func(shortener.Link) error) error
+	RestoreLink(ctx context.Context, link shortener.Link) error
+}
+
+// Snapshot describe una copia guardada
+type Snapshot struct {
+	Name      string
+	Size      int64
+	CreatedAt time.Time
+	// Links es el número de enlaces copiados; solo se conoce al crear la copia
+	Links int
+}
+
+// header es la primera línea de cada copia
+type header struct {
+	Format    string    `json:"format"`
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Option configura el gestor de copias
+type Option func(*Manager)
+
+// WithRetention cambia el número de copias que se conservan; cero las conserva todas
+func WithRetention(retention int) Option {
+	return func(m *Manager) {
+		if retention >= 0 {
+			m.retention = retention
+		}
+	}
+}
+
+// Manager crea, lista y restaura las copias de los enlaces. Las copias y restauraciones se
+// hacen de una en una.
+type Manager struct {
+	source    Source
+	target    Target
+	retention int
+
+	mu  sync.Mutex
+	now func() time.Time
+}
+
+// NewManager crea un gestor que copia los enlaces de source en target
+func NewManager(source Source, target Target, opts ...Option) *Manager {
+	m := &Manager{source: source, target: target, retention: DefaultRetention, now: time.Now}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// Backup guarda una copia de todos los enlaces y elimina las que exceden la retención. Un
+// fallo al eliminar las antiguas no invalida la copia nueva: se retorna junto con ella.
+func (m *Manager) Backup(ctx context.Context) (Snapshot, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	createdAt := m.now().UTC()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	encoder := json.NewEncoder(gz)
+	if err := encoder.Encode(header{Format: Format, Version: Version, CreatedAt: createdAt}); err != nil {
+		return Snapshot{}, err
+	}
+	links := 0
+	if err := m.source.EachLink(ctx, func(link shortener.Link) error {
+		links++
+		return encoder.Encode(link)
+	}); err != nil {
+		return Snapshot{}, err
+	}
+	if err := gz.Close(); err != nil {
+		return Snapshot{}, err
+	}
+
+	snapshot := Snapshot{Name: snapshotName(createdAt), Size: int64(buf.Len()), CreatedAt: createdAt, Links: links}
+	if err := m.target.Put(ctx, snapshot.Name, buf.Bytes()); err != nil {
+		return Snapshot{}, fmt.Errorf("guardando %s: %w", snapshot.Name, err)
+	}
+	return snapshot, m.pruneLocked(ctx)
+}
+
+// pruneLocked elimina las copias más antiguas que exceden la retención; requiere mu
+func (m *Manager) pruneLocked(ctx context.Context) error {
+	if m.retention == 0 {
+		return nil
+	}
+	snapshots, err := m.snapshots(ctx)
+	if err != nil {
+		return err
+	}
+	for i := m.retention; i < len(snapshots); i++ {
+		if err := m.target.Delete(ctx, snapshots[i].Name); err != nil {
+			return fmt.Errorf("eliminando %s: %w", snapshots[i].Name, err)
+		}
+	}
+	return nil
+}
+
+// Snapshots retorna las copias guardadas de la más reciente a la más antigua. Los archivos del
+// destino que no son copias se ignoran.
+func (m *Manager) Snapshots(ctx context.Context) ([]Snapshot, error) {
+	return m.snapshots(ctx)
+}
+
+// snapshots implementa Snapshots
+func (m *Manager) snapshots(ctx context.Context) ([]Snapshot, error) {
+	objects, err := m.target.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	snapshots := make([]Snapshot, 0, len(objects))
+	for _, object := range objects {
+		if createdAt, ok := parseSnapshotName(object.Name); ok {
+			snapshots = append(snapshots, Snapshot{Name: object.Name, Size: object.Size, CreatedAt: createdAt})
+		}
+	}
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].Name > snapshots[j].Name })
+	return snapshots, nil
+}
+
+// Restore carga los enlaces de la copia name y retorna cuántos restauró. Cada enlace reemplaza
+// al que tenga el mismo código; los enlaces creados después de la copia se conservan. Si la
+// copia está dañada se detiene en el primer error, con los enlaces anteriores ya restaurados.
+func (m *Manager) Restore(ctx context.Context, name string) (int, error) {
+	if _, ok := parseSnapshotName(name); !ok {
+		return 0, ErrSnapshotNotFound
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	data, err := m.target.Get(ctx, name)
+	if err != nil {
+		return 0, err
+	}
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrInvalidSnapshot, err)
+	}
+	defer gz.Close()
+
+	scanner := bufio.NewScanner(gz)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+	var head header
+	if !scanner.Scan() || json.Unmarshal(scanner.Bytes(), &head) != nil || head.Format != Format {
+		return 0, fmt.Errorf("%w: falta la cabecera", ErrInvalidSnapshot)
+	}
+	if head.Version > Version {
+		return 0, fmt.Errorf("%w: versión %d no soportada", ErrInvalidSnapshot, head.Version)
+	}
+
+	restored := 0
+	for line := 2; scanner.Scan(); line++ {
+		var link shortener.Link
+		if err := json.Unmarshal(scanner.Bytes(), &link); err != nil || link.ShortCode == "" {
+			return restored, fmt.Errorf("%w: línea %d", ErrInvalidSnapshot, line)
+		}
+		if err := m.source.RestoreLink(ctx, link); err != nil {
+			return restored, err
+		}
+		restored++
+	}
+	if err := scanner.Err(); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, gzip.ErrChecksum) || errors.Is(err, bufio.ErrTooLong) {
+			return restored, fmt.Errorf("%w: %v", ErrInvalidSnapshot, err)
+		}
+		return restored, err
+	}
+	return restored, nil
+}
+
+// snapshotName es el nombre de la copia creada en t
+func snapshotName(t time.Time) string {
+	return namePrefix + t.UTC().Format(timeLayout) + nameSuffix
+}
+
+// parseSnapshotName retorna el momento de una copia a partir de su nombre
+func parseSnapshotName(name string) (time.Time, bool) {
+	if !strings.HasPrefix(name, namePrefix) || !strings.HasSuffix(name, nameSuffix) {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(timeLayout, strings.TrimSuffix(strings.TrimPrefix(name, namePrefix), nameSuffix))
+	return t, err == nil
+}
@@ -0,0 +1,279 @@
+package backup
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"acortador-urls/internal/shortener"
+)
+
+// clock avanza un segundo en cada llamada para que cada copia tenga un nombre distinto
+type clock struct{ t time.Time }
+
+func (c *clock) now() time.Time {
+	c.t = c.t.Add(time.Second)
+	return c.t
+}
+
+func TestManager_BackupAndRestore(t *testing.T) {
+	ctx := context.Background()
+	store := shortener.NewStore()
+	service := shortener.NewService(store)
+	for _, code := range []string{"uno", "dos", "tres"} {
+		store.SaveLink(ctx, shortener.Link{ShortCode: code, LongURL: "https://www.example.com/" + code, Owner: "alice",
+			Tags: []string{"ventas"}, Clicks: 7})
+	}
+
+	target, err := NewDirTarget(filepath.Join(t.TempDir(), "copias"))
+	if err != nil {
+		t.Fatalf("Unexpected error creating target: %v", err)
+	}
+	c := &clock{t: time.Date(2024, 1, 1, 3, 0, 0, 0, time.UTC)}
+	manager := NewManager(service, target, WithRetention(2))
+	manager.now = c.now
+
+	var names []string
+	for i := 0; i < 3; i++ {
+		snapshot, err := manager.Backup(ctx)
+		if err != nil {
+			t.Fatalf("Unexpected error backing up: %v", err)
+		}
+		if snapshot.Links != 3 || snapshot.Size == 0 {
+			t.Errorf("Expected 3 links in a non-empty snapshot, got %+v", snapshot)
+		}
+		names = append(names, snapshot.Name)
+	}
+	if names[0] != "links-20240101T030001.000Z.jsonl.gz" {
+		t.Errorf("Unexpected snapshot name %s", names[0])
+	}
+
+	// La retención conserva las dos más recientes, de la más nueva a la más antigua
+	snapshots, err := manager.Snapshots(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected error listing: %v", err)
+	}
+	if len(snapshots) != 2 || snapshots[0].Name != names[2] || snapshots[1].Name != names[1] {
+		t.Fatalf("Expected the two newest snapshots, got %+v", snapshots)
+	}
+
+	// Se pierde un enlace y otro cambia; el creado después de la copia se conserva
+	store.Delete(ctx, "dos")
+	store.SaveLink(ctx, shortener.Link{ShortCode: "uno", LongURL: "https://www.example.com/cambiado"})
+	store.SaveLink(ctx, shortener.Link{ShortCode: "nuevo", LongURL: "https://www.example.com/nuevo"})
+
+	restored, err := manager.Restore(ctx, names[2])
+	if err != nil || restored != 3 {
+		t.Fatalf("Expected 3 links restored, got %d (%v)", restored, err)
+	}
+	for _, code := range []string{"uno", "dos", "tres"} {
+		link, found, _ := store.GetLink(ctx, code)
+		if !found || link.LongURL != "https://www.example.com/"+code || link.Owner != "alice" || link.Clicks != 7 || !link.HasTag("ventas") {
+			t.Errorf("Expected %s to be restored as it was, got %+v", code, link)
+		}
+	}
+	if _, found, _ := store.GetLink(ctx, "nuevo"); !found {
+		t.Errorf("Expected links created after the snapshot to be kept")
+	}
+
+	tests := []struct {
+		name        string
+		snapshot    string
+		content     []byte
+		expectedErr error
+	}{
+		{name: "Eliminada por la retención", snapshot: names[0], expectedErr: ErrSnapshotNotFound},
+		{name: "Nombre que no es una copia", snapshot: "../secreto", expectedErr: ErrSnapshotNotFound},
+		{name: "Sin comprimir", snapshot: "links-20240102T000000.000Z.jsonl.gz", content: []byte("{}"), expectedErr: ErrInvalidSnapshot},
+		{name: "Sin cabecera", snapshot: "links-20240103T000000.000Z.jsonl.gz", content: gzipLines(`{"ShortCode":"x"}`),
+			expectedErr: ErrInvalidSnapshot},
+		{name: "Versión posterior", snapshot: "links-20240104T000000.000Z.jsonl.gz",
+			content: gzipLines(`{"format":"acortador-urls/links","version":99}`), expectedErr: ErrInvalidSnapshot},
+		{name: "Línea dañada", snapshot: "links-20240105T000000.000Z.jsonl.gz",
+			content: gzipLines(`{"format":"acortador-urls/links","version":1}`, `{"ShortCode":`), expectedErr: ErrInvalidSnapshot},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.content != nil {
+				target.Put(ctx, tt.snapshot, tt.content)
+			}
+			if _, err := manager.Restore(ctx, tt.snapshot); !errors.Is(err, tt.expectedErr) {
+				t.Errorf("Expected %v, got %v", tt.expectedErr, err)
+			}
+		})
+	}
+}
+
+// gzipLines comprime las líneas como una copia
+func gzipLines(lines ...string) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	io.WriteString(gz, strings.Join(lines, "\n")+"\n")
+	gz.Close()
+	return buf.Bytes()
+}
+
+func TestDirTarget(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	target, _ := NewDirTarget(dir)
+
+	if err := target.Put(ctx, "a.jsonl.gz", []byte("datos")); err != nil {
+		t.Fatalf("Unexpected error writing: %v", err)
+	}
+	os.Mkdir(filepath.Join(dir, "subdirectorio"), 0o750)
+	objects, err := target.List(ctx)
+	if err != nil || len(objects) != 1 || objects[0] != (Object{Name: "a.jsonl.gz", Size: 5}) {
+		t.Errorf("Expected only the written file, got %+v (%v)", objects, err)
+	}
+	if data, err := target.Get(ctx, "a.jsonl.gz"); err != nil || string(data) != "datos" {
+		t.Errorf("Expected to read the file back, got %q (%v)", data, err)
+	}
+	if err := target.Delete(ctx, "a.jsonl.gz"); err != nil {
+		t.Errorf("Unexpected error deleting: %v", err)
+	}
+	if err := target.Delete(ctx, "a.jsonl.gz"); err != nil {
+		t.Errorf("Expected deleting a missing file to succeed, got %v", err)
+	}
+	if _, err := target.Get(ctx, "a.jsonl.gz"); !errors.Is(err, ErrSnapshotNotFound) {
+		t.Errorf("Expected ErrSnapshotNotFound, got %v", err)
+	}
+}
+
+// fakeS3 es un bucket en memoria que comprueba la forma de las peticiones firmadas
+type fakeS3 struct {
+	t       *testing.T
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	sum := sha256.Sum256(body)
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=clave/20240101/eu-west-1/s3/aws4_request, SignedHeaders=host;x-amz-content-sha256;x-amz-date, Signature=") ||
+		r.Header.Get("X-Amz-Content-Sha256") != hex.EncodeToString(sum[:]) || r.Header.Get("X-Amz-Date") != "20240101T030000Z" {
+		f.t.Errorf("Unexpected signature headers %v", r.Header)
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	key := strings.TrimPrefix(r.URL.Path, "/copias/")
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/copias":
+		prefix := r.URL.Query().Get("prefix")
+		var result struct {
+			XMLName     xml.Name `xml:"ListBucketResult"`
+			IsTruncated bool
+			Contents    []struct {
+				Key  string
+				Size int64
+			}
+		}
+		var keys []string
+		for key := range f.objects {
+			if strings.HasPrefix(key, prefix) && key > r.URL.Query().Get("marker") {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		// Páginas de un objeto para probar la paginación
+		if len(keys) > 1 {
+			keys, result.IsTruncated = keys[:1], true
+		}
+		for _, key := range keys {
+			result.Contents = append(result.Contents, struct {
+				Key  string
+				Size int64
+			}{key, int64(len(f.objects[key]))})
+		}
+		xml.NewEncoder(w).Encode(result)
+	case r.Method == http.MethodPut:
+		f.objects[key] = body
+	case r.Method == http.MethodGet:
+		data, ok := f.objects[key]
+		if !ok {
+			http.Error(w, "<Error><Code>NoSuchKey</Code></Error>", http.StatusNotFound)
+			return
+		}
+		w.Write(data)
+	case r.Method == http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func TestS3Target(t *testing.T) {
+	ctx := context.Background()
+	bucket := &fakeS3{t: t, objects: map[string][]byte{"otro/ajeno.txt": []byte("x")}}
+	server := httptest.NewServer(bucket)
+	defer server.Close()
+
+	target, err := NewS3Target(S3Config{Endpoint: server.URL, Region: "eu-west-1", Bucket: "copias", Prefix: "acortador/",
+		AccessKey: "clave", SecretKey: "secreto"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	target.now = func() time.Time { return time.Date(2024, 1, 1, 3, 0, 0, 0, time.UTC) }
+
+	for _, name := range []string{"a.jsonl.gz", "b.jsonl.gz"} {
+		if err := target.Put(ctx, name, []byte("datos de "+name)); err != nil {
+			t.Fatalf("Unexpected error writing %s: %v", name, err)
+		}
+	}
+	if _, ok := bucket.objects["acortador/a.jsonl.gz"]; !ok {
+		t.Errorf("Expected objects under the prefix, got %v", bucket.objects)
+	}
+	objects, err := target.List(ctx)
+	if err != nil || len(objects) != 2 || objects[0].Name != "a.jsonl.gz" || objects[1] != (Object{Name: "b.jsonl.gz", Size: 19}) {
+		t.Errorf("Expected both objects across pages, got %+v (%v)", objects, err)
+	}
+	if data, err := target.Get(ctx, "b.jsonl.gz"); err != nil || string(data) != "datos de b.jsonl.gz" {
+		t.Errorf("Expected to read the object back, got %q (%v)", data, err)
+	}
+	if err := target.Delete(ctx, "b.jsonl.gz"); err != nil {
+		t.Errorf("Unexpected error deleting: %v", err)
+	}
+	if _, err := target.Get(ctx, "b.jsonl.gz"); !errors.Is(err, ErrSnapshotNotFound) {
+		t.Errorf("Expected ErrSnapshotNotFound, got %v", err)
+	}
+
+	if _, err := NewS3Target(S3Config{Endpoint: "ftp://s3.example.com", Region: "auto", Bucket: "b", AccessKey: "k", SecretKey: "s"}); err == nil {
+		t.Errorf("Expected error for a non-http endpoint")
+	}
+}
+
+func TestS3Escape(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"No reservados", "links-2024.jsonl.gz~_", "links-2024.jsonl.gz~_"},
+		{"Espacios y barras", "a b/c", "a%20b%2Fc"},
+		{"Unicode", "año", "a%C3%B1o"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := s3Escape(tt.input); got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
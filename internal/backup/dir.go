@@ -0,0 +1,92 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// DirTarget guarda las copias en un directorio local. Cada archivo se escribe primero con un
+// nombre temporal y se renombra al terminar, para que una copia a medias no parezca completa.
+type DirTarget struct {
+	dir string
+}
+
+// Verificación en compilación de que DirTarget implementa Target
+var _ Target = (*DirTarget)(nil)
+
+// NewDirTarget crea el destino en dir, creando el directorio si no existe
+func NewDirTarget(dir string) (*DirTarget, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, err
+	}
+	return &DirTarget{dir: dir}, nil
+}
+
+// Put implementa Target
+func (t *DirTarget) Put(ctx context.Context, name string, data []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(t.dir, ".tmp-"+name+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(t.dir, name))
+}
+
+// Get implementa Target
+func (t *DirTarget) Get(ctx context.Context, name string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(filepath.Join(t.dir, filepath.Base(name)))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrSnapshotNotFound
+	}
+	return data, err
+}
+
+// List implementa Target
+func (t *DirTarget) List(ctx context.Context) ([]Object, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(t.dir)
+	if err != nil {
+		return nil, err
+	}
+	objects := make([]Object, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		objects = append(objects, Object{Name: entry.Name(), Size: info.Size()})
+	}
+	return objects, nil
+}
+
+// Delete implementa Target; eliminar un archivo inexistente no es un error
+func (t *DirTarget) Delete(ctx context.Context, name string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := os.Remove(filepath.Join(t.dir, filepath.Base(name))); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,249 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// s3Timeout acota cada petición al bucket
+const s3Timeout = 5 * time.Minute
+
+// S3Config configura un bucket compatible con S3
+type S3Config struct {
+	// Endpoint es la URL base del servicio, p. ej. https://s3.eu-west-1.amazonaws.com o
+	// https://storage.googleapis.com
+	Endpoint string
+	// Region es la región con la que se firman las peticiones ("auto" en Google Cloud Storage)
+	Region string
+	Bucket string
+	// Prefix se antepone al nombre de cada copia, p. ej. "acortador/"
+	Prefix    string
+	AccessKey string
+	SecretKey string
+}
+
+// S3Target guarda las copias en un bucket a través de la API REST de S3 con firma AWS
+// Signature Version 4. Google Cloud Storage ofrece la misma API con claves HMAC, así que sirve
+// para ambos sin depender de sus SDK. Las peticiones usan el estilo de ruta
+// (endpoint/bucket/clave).
+type S3Target struct {
+	config S3Config
+	base   *url.URL
+	client *http.Client
+	now    func() time.Time
+}
+
+// Verificación en compilación de que S3Target implementa Target
+var _ Target = (*S3Target)(nil)
+
+// NewS3Target crea el destino del bucket
+func NewS3Target(config S3Config) (*S3Target, error) {
+	base, err := url.Parse(strings.TrimSuffix(config.Endpoint, "/"))
+	if err != nil || (base.Scheme != "http" && base.Scheme != "https") || base.Host == "" {
+		return nil, fmt.Errorf("endpoint de S3 inválido: %q", config.Endpoint)
+	}
+	if config.Bucket == "" || config.Region == "" || config.AccessKey == "" || config.SecretKey == "" {
+		return nil, fmt.Errorf("el bucket de S3 requiere bucket, región y credenciales")
+	}
+	return &S3Target{config: config, base: base, client: &http.Client{Timeout: s3Timeout}, now: time.Now}, nil
+}
+
+// Put implementa Target
+func (t *S3Target) Put(ctx context.Context, name string, data []byte) error {
+	resp, err := t.do(ctx, http.MethodPut, t.config.Prefix+name, nil, data)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Get implementa Target
+func (t *S3Target) Get(ctx context.Context, name string) ([]byte, error) {
+	resp, err := t.do(ctx, http.MethodGet, t.config.Prefix+name, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return io.ReadAll(resp.Body)
+}
+
+// s3ListResult es la respuesta de ListObjects (versión 1, la que también ofrece Cloud Storage)
+type s3ListResult struct {
+	IsTruncated bool `xml:"IsTruncated"`
+	Contents    []struct {
+		Key  string `xml:"Key"`
+		Size int64  `xml:"Size"`
+	} `xml:"Contents"`
+}
+
+// List implementa Target recorriendo todas las páginas del listado bajo el prefijo
+func (t *S3Target) List(ctx context.Context) ([]Object, error) {
+	var objects []Object
+	marker := ""
+	for {
+		query := url.Values{"prefix": {t.config.Prefix}}
+		if marker != "" {
+			query.Set("marker", marker)
+		}
+		resp, err := t.do(ctx, http.MethodGet, "", query, nil)
+		if err != nil {
+			return nil, err
+		}
+		var result s3ListResult
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("listado de S3 inválido: %w", err)
+		}
+		for _, content := range result.Contents {
+			name := strings.TrimPrefix(content.Key, t.config.Prefix)
+			if name != "" && !strings.Contains(name, "/") {
+				objects = append(objects, Object{Name: name, Size: content.Size})
+			}
+		}
+		if !result.IsTruncated || len(result.Contents) == 0 {
+			return objects, nil
+		}
+		marker = result.Contents[len(result.Contents)-1].Key
+	}
+}
+
+// Delete implementa Target
+func (t *S3Target) Delete(ctx context.Context, name string) error {
+	resp, err := t.do(ctx, http.MethodDelete, t.config.Prefix+name, nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// do hace una petición firmada sobre la clave del bucket (vacía para el propio bucket). Las
+// respuestas 404 se traducen en ErrSnapshotNotFound y el resto de errores HTTP incluyen el
+// cuerpo de la respuesta.
+func (t *S3Target) do(ctx context.Context, method, key string, query url.Values, body []byte) (*http.Response, error) {
+	u := *t.base
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + t.config.Bucket
+	u.RawPath = strings.TrimSuffix(u.EscapedPath(), "/") + "/" + s3Escape(t.config.Bucket)
+	if key != "" {
+		u.Path += "/" + key
+		segments := strings.Split(key, "/")
+		for i, segment := range segments {
+			segments[i] = s3Escape(segment)
+		}
+		u.RawPath += "/" + strings.Join(segments, "/")
+	}
+	u.RawQuery = s3Query(query)
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if body == nil {
+		req.Body, req.ContentLength = http.NoBody, 0
+	}
+	t.sign(req, body)
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		if resp.StatusCode == http.StatusNotFound && key != "" {
+			return nil, ErrSnapshotNotFound
+		}
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("S3 respondió %d: %s", resp.StatusCode, strings.TrimSpace(string(message)))
+	}
+	return resp, nil
+}
+
+// sign agrega a la petición la firma AWS Signature Version 4 del servicio s3
+func (t *S3Target) sign(req *http.Request, body []byte) {
+	now := t.now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256Hex(body)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	const signedHeaders = "host;x-amz-content-sha256;x-amz-date"
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		"host:" + req.URL.Host,
+		"x-amz-content-sha256:" + payloadHash,
+		"x-amz-date:" + amzDate,
+		"",
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := date + "/" + t.config.Region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+t.config.SecretKey), date)
+	key = hmacSHA256(key, t.config.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		t.config.AccessKey, scope, signedHeaders, signature))
+}
+
+// s3Query codifica la query como la espera la firma: claves ordenadas y todo escapado salvo
+// los caracteres no reservados
+func s3Query(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, key := range keys {
+		for _, value := range query[key] {
+			parts = append(parts, s3Escape(key)+"="+s3Escape(value))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// s3Escape escapa todo salvo los caracteres no reservados de RFC 3986
+func s3Escape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// sha256Hex es el SHA-256 de data en hexadecimal
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// hmacSHA256 calcula el HMAC-SHA256 de data con key
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,144 @@
+// Package cache implementa una caché de lectura delante de un shortener.LinkStore para el
+// camino caliente de las redirecciones: los enlaces leídos, y también los códigos inexistentes,
+// se sirven desde memoria hasta que caducan o se invalidan al modificarse.
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"acortador-urls/internal/shortener"
+)
+
+// Valores por defecto de la caché
+const (
+	DefaultSize        = 10000
+	DefaultTTL         = time.Minute
+	DefaultNegativeTTL = 10 * time.Second
+)
+
+// Entry es el resultado cacheado de buscar un código: el enlace o, si Found es false, su
+// ausencia
+type Entry struct {
+	Link  shortener.Link
+	Found bool
+}
+
+// Cache guarda entradas por código corto con caducidad. LRU la implementa en memoria; una
+// implementación sobre Redis permitiría compartirla entre instancias.
+type Cache interface {
+	// Get retorna la entrada vigente del código
+	Get(shortCode string) (entry Entry, ok bool)
+	// Set guarda la entrada durante ttl
+	Set(shortCode string, entry Entry, ttl time.Duration)
+	// Update reemplaza la entrada vigente del código por fn(entry) conservando su caducidad;
+	// no hace nada si el código no está en la caché
+	Update(shortCode string, fn func(Entry) Entry)
+	// Delete elimina la entrada del código
+	Delete(shortCode string)
+	// Clear elimina todas las entradas
+	Clear()
+}
+
+// lruItem es una entrada de la caché junto con su caducidad
+type lruItem struct {
+	shortCode string
+	entry     Entry
+	expiresAt time.Time
+}
+
+// LRU es una caché en memoria de tamaño fijo que descarta la entrada usada hace más tiempo
+type LRU struct {
+	mu    sync.Mutex
+	size  int
+	order *list.List // frente: usada más recientemente
+	items map[string]*list.Element
+
+	now func() time.Time
+}
+
+// Verificación en compilación de que LRU implementa Cache
+var _ Cache = (*LRU)(nil)
+
+// NewLRU crea una caché LRU de como máximo size entradas
+func NewLRU(size int) *LRU {
+	if size < 1 {
+		size = 1
+	}
+	return &LRU{size: size, order: list.New(), items: make(map[string]*list.Element), now: time.Now}
+}
+
+// Get implementa Cache
+func (c *LRU) Get(shortCode string) (Entry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element, ok := c.items[shortCode]
+	if !ok {
+		return Entry{}, false
+	}
+	item := element.Value.(*lruItem)
+	if !c.now().Before(item.expiresAt) {
+		c.removeLocked(element)
+		return Entry{}, false
+	}
+	c.order.MoveToFront(element)
+	return item.entry, true
+}
+
+// Set implementa Cache
+func (c *LRU) Set(shortCode string, entry Entry, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	expiresAt := c.now().Add(ttl)
+	if element, ok := c.items[shortCode]; ok {
+		item := element.Value.(*lruItem)
+		item.entry, item.expiresAt = entry, expiresAt
+		c.order.MoveToFront(element)
+		return
+	}
+	for c.order.Len() >= c.size {
+		c.removeLocked(c.order.Back())
+	}
+	c.items[shortCode] = c.order.PushFront(&lruItem{shortCode: shortCode, entry: entry, expiresAt: expiresAt})
+}
+
+// Update implementa Cache
+func (c *LRU) Update(shortCode string, fn func(Entry) Entry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, ok := c.items[shortCode]; ok {
+		item := element.Value.(*lruItem)
+		item.entry = fn(item.entry)
+	}
+}
+
+// Delete implementa Cache
+func (c *LRU) Delete(shortCode string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, ok := c.items[shortCode]; ok {
+		c.removeLocked(element)
+	}
+}
+
+// Clear implementa Cache
+func (c *LRU) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.order.Init()
+	c.items = make(map[string]*list.Element)
+}
+
+// Len retorna el número de entradas, incluidas las caducadas que aún no se descartaron
+func (c *LRU) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// removeLocked elimina la entrada; requiere el lock
+func (c *LRU) removeLocked(element *list.Element) {
+	c.order.Remove(element)
+	delete(c.items, element.Value.(*lruItem).shortCode)
+}
@@ -0,0 +1,295 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"acortador-urls/internal/redis"
+	"acortador-urls/internal/shortener"
+)
+
+func TestLRU(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cache := NewLRU(2)
+	cache.now = func() time.Time { return now }
+	link := func(code string) Entry {
+		return Entry{Link: shortener.Link{ShortCode: code}, Found: true}
+	}
+
+	cache.Set("aaa", link("aaa"), time.Minute)
+	cache.Set("bbb", link("bbb"), time.Minute)
+	cache.Get("aaa")
+	cache.Set("ccc", link("ccc"), time.Minute)
+
+	tests := []struct {
+		name      string
+		code      string
+		expectHit bool
+	}{
+		{name: "Usada recientemente se conserva", code: "aaa", expectHit: true},
+		{name: "Menos reciente se descarta", code: "bbb"},
+		{name: "Nueva entrada", code: "ccc", expectHit: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry, ok := cache.Get(tt.code)
+			if ok != tt.expectHit || (ok && entry.Link.ShortCode != tt.code) {
+				t.Errorf("Expected hit=%v for %s, got %v (%+v)", tt.expectHit, tt.code, ok, entry)
+			}
+		})
+	}
+
+	// Update conserva la caducidad y Delete elimina
+	cache.Update("aaa", func(e Entry) Entry { e.Link.Clicks = 7; return e })
+	if entry, _ := cache.Get("aaa"); entry.Link.Clicks != 7 {
+		t.Errorf("Expected updated entry, got %+v", entry)
+	}
+	now = now.Add(time.Minute)
+	if _, ok := cache.Get("aaa"); ok {
+		t.Errorf("Expected entry to expire after its TTL")
+	}
+	cache.Delete("ccc")
+	if cache.Len() != 0 {
+		t.Errorf("Expected empty cache, got %d entries", cache.Len())
+	}
+}
+
+// countingStore cuenta las lecturas que llegan al almacén envuelto
+type countingStore struct {
+	*shortener.Store
+	reads int
+}
+
+func (s *countingStore) GetLink(ctx context.Context, shortCode string) (shortener.Link, bool, error) {
+	s.reads++
+	return s.Store.GetLink(ctx, shortCode)
+}
+
+func TestStore(t *testing.T) {
+	ctx := context.Background()
+	backend := &countingStore{Store: shortener.NewStore()}
+	backend.SaveLink(ctx, shortener.Link{ShortCode: "abc123", LongURL: "https://www.example.com/"})
+	store := NewStore(backend, NewLRU(100), time.Minute, time.Minute)
+
+	// Las lecturas repetidas, también de códigos inexistentes, no llegan al almacén
+	for i := 0; i < 3; i++ {
+		if link, found, err := store.GetLink(ctx, "abc123"); err != nil || !found || link.LongURL != "https://www.example.com/" {
+			t.Fatalf("Expected cached link, got %+v found=%v (err %v)", link, found, err)
+		}
+		if exists, err := store.Exists(ctx, "nuevo"); err != nil || exists {
+			t.Fatalf("Expected missing code, got exists=%v (err %v)", exists, err)
+		}
+	}
+	if backend.reads != 2 {
+		t.Errorf("Expected 2 backend reads, got %d", backend.reads)
+	}
+	if stats := store.Stats(); stats.Hits != 4 || stats.Misses != 2 {
+		t.Errorf("Expected 4 hits and 2 misses, got %+v", stats)
+	}
+
+	// Guardar invalida la entrada negativa del código
+	store.SaveLink(ctx, shortener.Link{ShortCode: "nuevo", LongURL: "https://www.example.com/nuevo"})
+	if exists, _ := store.Exists(ctx, "nuevo"); !exists {
+		t.Errorf("Expected saved code to exist")
+	}
+
+	// Las visitas se suman a la copia cacheada
+	store.IncrementClicks(ctx, "abc123", shortener.Visit{})
+	if link, _, _ := store.GetLink(ctx, "abc123"); link.Clicks != 1 {
+		t.Errorf("Expected cached clicks to be updated, got %d", link.Clicks)
+	}
+
+	// Editar y eliminar invalidan la entrada
+	store.SaveLink(ctx, shortener.Link{ShortCode: "abc123", LongURL: "https://www.example.com/editado"})
+	if link, _, _ := store.GetLink(ctx, "abc123"); link.LongURL != "https://www.example.com/editado" {
+		t.Errorf("Expected updated link, got %s", link.LongURL)
+	}
+	store.Delete(ctx, "abc123")
+	if _, found, _ := store.GetLink(ctx, "abc123"); found {
+		t.Errorf("Expected deleted link to be gone")
+	}
+
+	t.Run("Servicio sobre la caché", func(t *testing.T) {
+		service := shortener.NewService(NewStore(shortener.NewStore(), NewLRU(100), time.Minute, time.Minute))
+		link, _, err := service.Shorten(ctx, shortener.ShortenInput{LongURL: "https://www.example.com/a", Owner: "alice"})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if err := service.RecordClick(ctx, link.ShortCode, shortener.Click{}); err != nil {
+			t.Fatalf("Unexpected error recording click: %v", err)
+		}
+		updated, err := service.UpdateURL(ctx, shortener.Actor{UserID: "alice"}, link.ShortCode, "https://www.example.com/b")
+		if err != nil || updated.Clicks != 1 {
+			t.Errorf("Expected clicks to survive update, got %d (err %v)", updated.Clicks, err)
+		}
+	})
+}
+
+// memoryBus entrega cada mensaje publicado a todos los suscriptores del proceso
+type memoryBus struct {
+	mu       sync.Mutex
+	handlers []func(string)
+	ready    chan struct{}
+}
+
+func newMemoryBus() *memoryBus {
+	return &memoryBus{ready: make(chan struct{}, 10)}
+}
+
+func (b *memoryBus) Publish(ctx context.Context, message string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, handler := range b.handlers {
+		handler(message)
+	}
+	return nil
+}
+
+func (b *memoryBus) Subscribe(ctx context.Context, handler func(string)) error {
+	b.mu.Lock()
+	b.handlers = append(b.handlers, handler)
+	b.mu.Unlock()
+	b.ready <- struct{}{}
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestStore_Invalidation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	backend := shortener.NewStore()
+	backend.SaveLink(ctx, shortener.Link{ShortCode: "abc123", LongURL: "https://www.example.com/"})
+
+	// Dos instancias con su propia caché sobre el mismo almacén
+	bus := newMemoryBus()
+	first := NewStore(backend, NewLRU(100), time.Hour, time.Hour, WithBus(bus))
+	second := NewStore(backend, NewLRU(100), time.Hour, time.Hour, WithBus(bus))
+	go first.RunInvalidationListener(ctx)
+	go second.RunInvalidationListener(ctx)
+	<-bus.ready
+	<-bus.ready
+
+	second.GetLink(ctx, "abc123")
+	second.GetLink(ctx, "nuevo")
+
+	// Los cambios de una instancia invalidan la caché de la otra
+	first.SaveLink(ctx, shortener.Link{ShortCode: "abc123", LongURL: "https://www.example.com/editado"})
+	first.SaveLink(ctx, shortener.Link{ShortCode: "nuevo", LongURL: "https://www.example.com/nuevo"})
+	if link, _, _ := second.GetLink(ctx, "abc123"); link.LongURL != "https://www.example.com/editado" {
+		t.Errorf("Expected edited link in the other instance, got %s", link.LongURL)
+	}
+	if exists, _ := second.Exists(ctx, "nuevo"); !exists {
+		t.Errorf("Expected new code to be visible in the other instance")
+	}
+	first.Delete(ctx, "abc123")
+	if _, found, _ := second.GetLink(ctx, "abc123"); found {
+		t.Errorf("Expected deleted link to be gone in the other instance")
+	}
+}
+
+// fakeRedis implementa lo justo de Redis para SUBSCRIBE y PUBLISH
+func fakeRedis(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	var mu sync.Mutex
+	var subscribers []net.Conn
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				reader := redis.NewConn(conn)
+				for {
+					reply, err := reader.Read()
+					if err != nil {
+						return
+					}
+					args, _ := reply.([]interface{})
+					switch {
+					case len(args) == 2 && args[0] == "SUBSCRIBE":
+						mu.Lock()
+						subscribers = append(subscribers, conn)
+						mu.Unlock()
+						fmt.Fprintf(conn, "*3\r\n$9\r\nsubscribe\r\n$%d\r\n%s\r\n:1\r\n", len(args[1].(string)), args[1])
+					case len(args) == 3 && args[0] == "PUBLISH":
+						channel, message := args[1].(string), args[2].(string)
+						mu.Lock()
+						for _, sub := range subscribers {
+							fmt.Fprintf(sub, "*3\r\n$7\r\nmessage\r\n$%d\r\n%s\r\n$%d\r\n%s\r\n", len(channel), channel, len(message), message)
+						}
+						fmt.Fprintf(conn, ":%d\r\n", len(subscribers))
+						mu.Unlock()
+					default:
+						fmt.Fprint(conn, "-ERR unknown command\r\n")
+					}
+				}
+			}()
+		}
+	}()
+	return "redis://" + listener.Addr().String()
+}
+
+func TestRedisBus(t *testing.T) {
+	tests := []struct {
+		name    string
+		url     string
+		wantErr bool
+	}{
+		{name: "URL válida", url: "redis://localhost:6379"},
+		{name: "Puerto por defecto", url: "redis://:secreto@localhost"},
+		{name: "Esquema inválido", url: "http://localhost:6379", wantErr: true},
+		{name: "Sin host", url: "redis://", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewRedisBus(tt.url, ""); (err != nil) != tt.wantErr {
+				t.Errorf("Expected error=%v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	bus, err := NewRedisBus(fakeRedis(t), "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	received := make(chan string, 1)
+	subscribed := make(chan error, 1)
+	go func() { subscribed <- bus.Subscribe(ctx, func(message string) { received <- message }) }()
+
+	// Se publica hasta que la suscripción está activa
+	deadline := time.After(2 * time.Second)
+	for {
+		if err := bus.Publish(ctx, "instancia abc123"); err != nil {
+			t.Fatalf("Unexpected publish error: %v", err)
+		}
+		select {
+		case message := <-received:
+			if message != "instancia abc123" {
+				t.Errorf("Expected published message, got %q", message)
+			}
+			cancel()
+			if err := <-subscribed; !errors.Is(err, context.Canceled) {
+				t.Errorf("Expected context.Canceled after cancel, got %v", err)
+			}
+			return
+		case <-time.After(10 * time.Millisecond):
+		case <-deadline:
+			t.Fatalf("Expected message to be delivered")
+		}
+	}
+}
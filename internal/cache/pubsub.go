@@ -0,0 +1,83 @@
+package cache
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+	"time"
+)
+
+// Bus difunde las invalidaciones entre las instancias que comparten un almacén, cada una con
+// su propia caché. RedisBus lo implementa sobre Redis pub/sub; otra implementación (p. ej. NATS)
+// solo tiene que entregar cada mensaje publicado a todos los suscriptores.
+type Bus interface {
+	// Publish envía el mensaje a todas las instancias suscritas, incluida la propia
+	Publish(ctx context.Context, message string) error
+	// Subscribe llama a handler con cada mensaje recibido hasta que se cancela ctx o se pierde
+	// la conexión, y retorna el motivo
+	Subscribe(ctx context.Context, handler func(message string)) error
+}
+
+// resubscribeDelay es la espera antes de volver a suscribirse tras perder la conexión
+const resubscribeDelay = time.Second
+
+// StoreOption configura comportamientos opcionales de Store
+type StoreOption func(*Store)
+
+// WithBus publica en bus cada invalidación local para que las demás instancias descarten el
+// código de sus cachés; RunInvalidationListener aplica las que llegan de ellas
+func WithBus(bus Bus) StoreOption {
+	return func(s *Store) {
+		s.bus = bus
+		s.instanceID = newInstanceID()
+	}
+}
+
+// newInstanceID identifica los mensajes propios para no aplicarlos dos veces
+func newInstanceID() string {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return time.Now().Format("150405.000000000")
+	}
+	return hex.EncodeToString(id)
+}
+
+// publish difunde la invalidación del código. Un fallo no afecta a la escritura, que ya se
+// hizo: las demás instancias verán el cambio al caducar su entrada.
+func (s *Store) publish(shortCode string) {
+	if s.bus == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := s.bus.Publish(ctx, s.instanceID+" "+shortCode); err != nil {
+		s.publishErrors.Add(1)
+	}
+}
+
+// RunInvalidationListener aplica las invalidaciones publicadas por otras instancias hasta que
+// se cancela ctx, volviendo a suscribirse si se pierde la conexión. Al (re)suscribirse vacía
+// la caché, porque pudo perder mensajes mientras no estaba suscrita. Sin bus no hace nada.
+func (s *Store) RunInvalidationListener(ctx context.Context) {
+	if s.bus == nil {
+		return
+	}
+	for ctx.Err() == nil {
+		s.generation.Add(1)
+		s.cache.Clear()
+		err := s.bus.Subscribe(ctx, func(message string) {
+			origin, shortCode, ok := strings.Cut(message, " ")
+			if ok && origin != s.instanceID {
+				s.invalidateLocal(shortCode)
+			}
+		})
+		if err != nil && ctx.Err() == nil {
+			s.subscribeErrors.Add(1)
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(resubscribeDelay):
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package cache
+
+import (
+	"context"
+
+	"acortador-urls/internal/redis"
+)
+
+// DefaultChannel es el canal de Redis en el que se publican las invalidaciones
+const DefaultChannel = "acortador:invalidaciones"
+
+// RedisBus implementa Bus con PUBLISH y SUBSCRIBE de Redis sobre el cliente mínimo de
+// internal/redis: solo necesita esos dos comandos y AUTH.
+type RedisBus struct {
+	client  *redis.Client
+	channel string
+}
+
+// Verificación en compilación de que RedisBus implementa Bus
+var _ Bus = (*RedisBus)(nil)
+
+// NewRedisBus crea un bus sobre el servidor de rawURL (redis://[usuario:contraseña@]host:puerto)
+// que publica en channel, o en DefaultChannel si está vacío. No se conecta hasta el primer uso.
+func NewRedisBus(rawURL, channel string) (*RedisBus, error) {
+	client, err := redis.NewClient(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if channel == "" {
+		channel = DefaultChannel
+	}
+	return &RedisBus{client: client, channel: channel}, nil
+}
+
+// Publish implementa Bus
+func (b *RedisBus) Publish(ctx context.Context, message string) error {
+	_, err := b.client.Do(ctx, "PUBLISH", b.channel, message)
+	return err
+}
+
+// Subscribe implementa Bus
+func (b *RedisBus) Subscribe(ctx context.Context, handler func(message string)) error {
+	conn, err := b.client.Dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if _, err := conn.Do(ctx, "SUBSCRIBE", b.channel); err != nil {
+		return err
+	}
+
+	// Cancelar ctx cierra la conexión para desbloquear la lectura
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	for {
+		reply, err := conn.Read()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		// Los mensajes llegan como ["message", canal, contenido]
+		if parts, ok := reply.([]interface{}); ok && len(parts) == 3 && parts[0] == "message" {
+			if message, ok := parts[2].(string); ok {
+				handler(message)
+			}
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package cache
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"acortador-urls/internal/shortener"
+)
+
+// Store es un shortener.LinkStore que sirve GetLink, Get y Exists desde una caché y delega el
+// resto en el almacén envuelto. Las escrituras que pasan por Store invalidan el código afectado
+// y las visitas se suman también a la copia cacheada; los cambios hechos por otras instancias
+// sobre el mismo almacén se ven al caducar la entrada o, con WithBus, al recibir su
+// invalidación.
+type Store struct {
+	shortener.LinkStore
+
+	cache       Cache
+	ttl         time.Duration
+	negativeTTL time.Duration
+
+	// generation cambia con cada invalidación: una lectura del almacén que se cruzó con una
+	// escritura no se cachea, porque podría ser anterior a ella
+	generation atomic.Uint64
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
+
+	// bus difunde las invalidaciones a las demás instancias; nil si la caché es solo local
+	bus             Bus
+	instanceID      string
+	publishErrors   atomic.Uint64
+	subscribeErrors atomic.Uint64
+}
+
+// Verificación en compilación de que Store implementa LinkStore
+var _ shortener.LinkStore = (*Store)(nil)
+
+// Stats resume la actividad de la caché
+type Stats struct {
+	Hits   uint64
+	Misses uint64
+	// PublishErrors y SubscribeErrors cuentan los fallos del bus de invalidaciones
+	PublishErrors   uint64
+	SubscribeErrors uint64
+}
+
+// NewStore envuelve backend con la caché. Los enlaces se guardan durante ttl y los códigos
+// inexistentes durante negativeTTL; un negativeTTL cero desactiva la caché negativa.
+func NewStore(backend shortener.LinkStore, cache Cache, ttl, negativeTTL time.Duration, opts ...StoreOption) *Store {
+	s := &Store{LinkStore: backend, cache: cache, ttl: ttl, negativeTTL: negativeTTL}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Stats retorna los aciertos y fallos de la caché desde el arranque
+func (s *Store) Stats() Stats {
+	return Stats{
+		Hits:            s.hits.Load(),
+		Misses:          s.misses.Load(),
+		PublishErrors:   s.publishErrors.Load(),
+		SubscribeErrors: s.subscribeErrors.Load(),
+	}
+}
+
+// Invalidate descarta la entrada cacheada de un código y, con bus, también la de las demás
+// instancias
+func (s *Store) Invalidate(shortCode string) {
+	s.invalidateLocal(shortCode)
+	s.publish(shortCode)
+}
+
+// invalidateLocal descarta la entrada cacheada de un código solo en esta instancia
+func (s *Store) invalidateLocal(shortCode string) {
+	s.generation.Add(1)
+	s.cache.Delete(shortCode)
+}
+
+// GetLink obtiene el enlace desde la caché o, si no está, desde el almacén
+func (s *Store) GetLink(ctx context.Context, shortCode string) (shortener.Link, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return shortener.Link{}, false, err
+	}
+	if entry, ok := s.cache.Get(shortCode); ok {
+		s.hits.Add(1)
+		return entry.Link, entry.Found, nil
+	}
+	s.misses.Add(1)
+
+	generation := s.generation.Load()
+	link, found, err := s.LinkStore.GetLink(ctx, shortCode)
+	if err != nil {
+		return shortener.Link{}, false, err
+	}
+	switch {
+	case s.generation.Load() != generation:
+	case found:
+		s.cache.Set(shortCode, Entry{Link: link, Found: true}, s.ttl)
+	case s.negativeTTL > 0:
+		s.cache.Set(shortCode, Entry{}, s.negativeTTL)
+	}
+	return link, found, nil
+}
+
+// Exists verifica si un código existe usando la caché
+func (s *Store) Exists(ctx context.Context, shortCode string) (bool, error) {
+	_, found, err := s.GetLink(ctx, shortCode)
+	return found, err
+}
+
+// Get obtiene la URL larga de un código usando la caché
+func (s *Store) Get(ctx context.Context, shortCode string) (string, bool, error) {
+	link, found, err := s.GetLink(ctx, shortCode)
+	return link.LongURL, found, err
+}
+
+// SaveLink guarda el enlace e invalida su entrada, incluida la negativa de un código nuevo
+func (s *Store) SaveLink(ctx context.Context, link shortener.Link) error {
+	defer s.Invalidate(link.Key())
+	return s.LinkStore.SaveLink(ctx, link)
+}
+
+// SaveLinkIfAbsent guarda el enlace si el código está libre e invalida su entrada
+func (s *Store) SaveLinkIfAbsent(ctx context.Context, link shortener.Link) (bool, error) {
+	created, err := s.LinkStore.SaveLinkIfAbsent(ctx, link)
+	if created {
+		s.Invalidate(link.Key())
+	}
+	return created, err
+}
+
+// GetOrSave delega en el almacén e invalida el código guardado
+func (s *Store) GetOrSave(ctx context.Context, link shortener.Link) (shortener.Link, bool, error) {
+	result, created, err := s.LinkStore.GetOrSave(ctx, link)
+	if created {
+		s.Invalidate(link.Key())
+	}
+	return result, created, err
+}
+
+// IncrementClicks suma la visita en el almacén y en la copia cacheada, para que las escrituras
+// posteriores basadas en ella no pierdan clics
+func (s *Store) IncrementClicks(ctx context.Context, shortCode string, visit shortener.Visit) error {
+	if err := s.LinkStore.IncrementClicks(ctx, shortCode, visit); err != nil {
+		return err
+	}
+	s.cache.Update(shortCode, func(entry Entry) Entry {
+		if entry.Found {
+			entry.Link = entry.Link.WithVisit(visit)
+		}
+		return entry
+	})
+	return nil
+}
+
+// Delete elimina el enlace e invalida su entrada
+func (s *Store) Delete(ctx context.Context, shortCode string) (bool, error) {
+	defer s.Invalidate(shortCode)
+	return s.LinkStore.Delete(ctx, shortCode)
+}
+
+// SetHealth guarda el estado del destino e invalida la entrada
+func (s *Store) SetHealth(ctx context.Context, shortCode, longURL string, health shortener.LinkHealth) (bool, error) {
+	defer s.Invalidate(shortCode)
+	return s.LinkStore.SetHealth(ctx, shortCode, longURL, health)
+}
+
+// SetMetadata guarda los metadatos del destino e invalida la entrada
+func (s *Store) SetMetadata(ctx context.Context, shortCode, longURL string, metadata shortener.LinkMetadata) (bool, error) {
+	defer s.Invalidate(shortCode)
+	return s.LinkStore.SetMetadata(ctx, shortCode, longURL, metadata)
+}
+
+// EvictionStats reenvía las estadísticas de expulsión del almacén envuelto, si las tiene
+func (s *Store) EvictionStats() shortener.EvictionStats {
+	if reporter, ok := s.LinkStore.(shortener.EvictionReporter); ok {
+		return reporter.EvictionStats()
+	}
+	return shortener.EvictionStats{}
+}
+
+// MemoryUsage reenvía la estimación de memoria del almacén envuelto, si la tiene; no incluye la
+// de la caché, que está acotada por su capacidad
+func (s *Store) MemoryUsage() (shortener.MemoryUsage, bool) {
+	if compactor, ok := s.LinkStore.(shortener.Compactor); ok {
+		return compactor.MemoryUsage()
+	}
+	return shortener.MemoryUsage{}, false
+}
+
+// Compact compacta el almacén envuelto, si lo admite; las entradas de la caché siguen siendo válidas
+func (s *Store) Compact(ctx context.Context) (shortener.CompactionResult, error) {
+	if compactor, ok := s.LinkStore.(shortener.Compactor); ok {
+		return compactor.Compact(ctx)
+	}
+	return shortener.CompactionResult{}, shortener.ErrCompactionUnsupported
+}
+
+// Backend implementa shortener.BackendReporter anteponiendo la caché al almacén envuelto
+func (s *Store) Backend() string {
+	return "cache/" + shortener.BackendName(s.LinkStore)
+}
@@ -0,0 +1,352 @@
+// Package cluster implementa un modo experimental en el que varias instancias con el almacén
+// en memoria se replican los enlaces entre sí, de modo que cualquiera puede servir cualquier
+// redirección sin una base de datos externa. Cada escritura local se envía a los demás nodos y,
+// además, cada cierto tiempo cada nodo compara su estado con el de un nodo al azar (gossip)
+// para recuperar lo que se haya perdido. La replicación es asíncrona: un enlace recién creado
+// tarda un momento en verse en los demás nodos.
+package cluster
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"acortador-urls/internal/shortener"
+)
+
+// Version ordena las escrituras de un código entre nodos: primero por tiempo y, en empate, por
+// nodo, de modo que todos los nodos eligen el mismo ganador
+type Version struct {
+	Time int64  `json:"time"` // UnixNano
+	Node string `json:"node"`
+}
+
+// after indica si v es posterior a other
+func (v Version) after(other Version) bool {
+	if v.Time != other.Time {
+		return v.Time > other.Time
+	}
+	return v.Node > other.Node
+}
+
+// Entry es el estado replicado de un código: el enlace o, si Deleted, su eliminación
+type Entry struct {
+	Link    shortener.Link `json:"link"`
+	Deleted bool           `json:"deleted,omitempty"`
+	// Origin es la versión de la creación del enlace: dos entradas con el mismo Origin son
+	// versiones del mismo enlace y con distinto, creaciones independientes del mismo código
+	Origin Version `json:"origin"`
+	// Version es la versión de la última escritura
+	Version Version `json:"version"`
+}
+
+// wins indica si la entrada recibida debe reemplazar a la local. Entre versiones del mismo
+// enlace gana la última escritura. Entre creaciones concurrentes del mismo código gana la más
+// antigua, para que el primer enlace no cambie de destino; un enlace creado después de que se
+// eliminara el otro gana a la eliminación.
+func (in Entry) wins(current Entry) bool {
+	switch {
+	case in.Origin == current.Origin:
+		return in.Version.after(current.Version)
+	case current.Deleted && in.Origin.after(current.Version):
+		return true
+	case in.Deleted && current.Origin.after(in.Version):
+		return false
+	default:
+		return current.Origin.after(in.Origin)
+	}
+}
+
+// Stats resume la actividad de replicación del nodo
+type Stats struct {
+	// Applied es el número de entradas de otros nodos aplicadas
+	Applied uint64
+	// Conflicts es el número de enlaces locales reemplazados por una creación concurrente del
+	// mismo código en otro nodo
+	Conflicts uint64
+	// PushErrors y GossipErrors cuentan los fallos al enviar escrituras y al sincronizar
+	PushErrors   uint64
+	GossipErrors uint64
+}
+
+// Node es un shortener.LinkStore que replica las escrituras del almacén local con los demás
+// nodos. Las visitas no se replican: cada nodo cuenta las que sirve.
+type Node struct {
+	shortener.LinkStore
+
+	id     string
+	peers  []string
+	secret string
+	client httpDoer
+
+	// mu serializa las escrituras para que el orden de las versiones coincida con el del
+	// almacén local
+	mu      sync.Mutex
+	entries map[string]Entry // código -> última versión conocida, incluidas las eliminaciones
+	clock   int64
+
+	outbox chan Entry
+
+	applied      atomic.Uint64
+	conflicts    atomic.Uint64
+	pushErrors   atomic.Uint64
+	gossipErrors atomic.Uint64
+
+	now func() time.Time
+}
+
+// Verificación en compilación de que Node implementa LinkStore
+var _ shortener.LinkStore = (*Node)(nil)
+
+// outboxSize es el máximo de escrituras pendientes de enviar; si se llena se descartan y las
+// recupera el gossip
+const outboxSize = 1000
+
+// NewNode crea el nodo id sobre el almacén local. peers son las URLs base de los demás nodos
+// (p. ej. http://10.0.0.2:8080) y secret la clave compartida que autentica sus peticiones.
+func NewNode(local shortener.LinkStore, id string, peers []string, secret string) *Node {
+	for i, peer := range peers {
+		peers[i] = strings.TrimSuffix(peer, "/")
+	}
+	return &Node{
+		LinkStore: local,
+		id:        id,
+		peers:     peers,
+		secret:    secret,
+		client:    defaultClient(),
+		entries:   make(map[string]Entry),
+		outbox:    make(chan Entry, outboxSize),
+		now:       time.Now,
+	}
+}
+
+// Stats retorna la actividad de replicación
+func (n *Node) Stats() Stats {
+	return Stats{
+		Applied:      n.applied.Load(),
+		Conflicts:    n.conflicts.Load(),
+		PushErrors:   n.pushErrors.Load(),
+		GossipErrors: n.gossipErrors.Load(),
+	}
+}
+
+// Backend implementa shortener.BackendReporter anteponiendo la réplica al almacén local
+func (n *Node) Backend() string {
+	return "cluster/" + shortener.BackendName(n.LinkStore)
+}
+
+// MemoryUsage reenvía la estimación de memoria del almacén local, si la tiene
+func (n *Node) MemoryUsage() (shortener.MemoryUsage, bool) {
+	if compactor, ok := n.LinkStore.(shortener.Compactor); ok {
+		return compactor.MemoryUsage()
+	}
+	return shortener.MemoryUsage{}, false
+}
+
+// Compact compacta el almacén local, si lo admite; no afecta a los pares
+func (n *Node) Compact(ctx context.Context) (shortener.CompactionResult, error) {
+	if compactor, ok := n.LinkStore.(shortener.Compactor); ok {
+		return compactor.Compact(ctx)
+	}
+	return shortener.CompactionResult{}, shortener.ErrCompactionUnsupported
+}
+
+// nextVersionLocked retorna una versión local posterior a todas las anteriores; requiere mu
+func (n *Node) nextVersionLocked() Version {
+	now := n.now().UnixNano()
+	if now <= n.clock {
+		now = n.clock + 1
+	}
+	n.clock = now
+	return Version{Time: now, Node: n.id}
+}
+
+// observeLocked adelanta el reloj a una versión recibida, para que las escrituras locales
+// posteriores la superen aunque los relojes de los nodos no estén sincronizados; requiere mu
+func (n *Node) observeLocked(v Version) {
+	if v.Time > n.clock {
+		n.clock = v.Time
+	}
+}
+
+// recordLocked registra una escritura local y la encola para los demás nodos; requiere mu
+func (n *Node) recordLocked(link shortener.Link, deleted, created bool) {
+	version := n.nextVersionLocked()
+	entry := Entry{Link: link, Deleted: deleted, Version: version, Origin: version}
+	if current, ok := n.entries[link.Key()]; ok && !created && !current.Deleted {
+		entry.Origin = current.Origin
+	}
+	n.entries[link.Key()] = entry
+	select {
+	case n.outbox <- entry:
+	default:
+		n.pushErrors.Add(1)
+	}
+}
+
+// SaveLink guarda el enlace y replica la escritura
+func (n *Node) SaveLink(ctx context.Context, link shortener.Link) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if err := n.LinkStore.SaveLink(ctx, link); err != nil {
+		return err
+	}
+	_, known := n.entries[link.Key()]
+	n.recordLocked(link, false, !known)
+	return nil
+}
+
+// SaveLinkIfAbsent guarda el enlace si el código está libre en este nodo y replica la creación.
+// Otro nodo puede crear el mismo código a la vez: al replicarse gana la creación más antigua.
+func (n *Node) SaveLinkIfAbsent(ctx context.Context, link shortener.Link) (bool, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	created, err := n.LinkStore.SaveLinkIfAbsent(ctx, link)
+	if created {
+		n.recordLocked(link, false, true)
+	}
+	return created, err
+}
+
+// GetOrSave delega en el almacén local y replica el enlace si se creó
+func (n *Node) GetOrSave(ctx context.Context, link shortener.Link) (shortener.Link, bool, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	result, created, err := n.LinkStore.GetOrSave(ctx, link)
+	if created {
+		n.recordLocked(result, false, true)
+	}
+	return result, created, err
+}
+
+// Delete elimina el enlace y replica la eliminación
+func (n *Node) Delete(ctx context.Context, shortCode string) (bool, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	deleted, err := n.LinkStore.Delete(ctx, shortCode)
+	if deleted {
+		n.recordLocked(shortener.Link{ShortCode: shortCode}, true, false)
+	}
+	return deleted, err
+}
+
+// SetHealth guarda el estado del destino y replica el enlace
+func (n *Node) SetHealth(ctx context.Context, shortCode, longURL string, health shortener.LinkHealth) (bool, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	updated, err := n.LinkStore.SetHealth(ctx, shortCode, longURL, health)
+	if updated {
+		n.recordCurrentLocked(ctx, shortCode)
+	}
+	return updated, err
+}
+
+// SetMetadata guarda los metadatos del destino y replica el enlace
+func (n *Node) SetMetadata(ctx context.Context, shortCode, longURL string, metadata shortener.LinkMetadata) (bool, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	updated, err := n.LinkStore.SetMetadata(ctx, shortCode, longURL, metadata)
+	if updated {
+		n.recordCurrentLocked(ctx, shortCode)
+	}
+	return updated, err
+}
+
+// recordCurrentLocked replica el estado actual del enlace tras una actualización parcial;
+// requiere mu
+func (n *Node) recordCurrentLocked(ctx context.Context, shortCode string) {
+	if link, found, err := n.LinkStore.GetLink(ctx, shortCode); err == nil && found {
+		n.recordLocked(link, false, false)
+	}
+}
+
+// Apply aplica las entradas recibidas de otro nodo que ganan a la versión local y retorna
+// cuántas aplicó
+func (n *Node) Apply(ctx context.Context, entries []Entry) (int, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	applied := 0
+	for _, in := range entries {
+		code := in.Link.Key()
+		n.observeLocked(in.Version)
+		current, known := n.entries[code]
+		if known && !in.wins(current) {
+			continue
+		}
+
+		local, found, err := n.LinkStore.GetLink(ctx, code)
+		if err != nil {
+			return applied, err
+		}
+		if in.Deleted {
+			if _, err := n.LinkStore.Delete(ctx, code); err != nil {
+				return applied, err
+			}
+		} else {
+			link := in.Link
+			if found && known && current.Origin == in.Origin {
+				keepClicks(&link, local)
+			} else {
+				link.Clicks = 0
+			}
+			if err := n.LinkStore.SaveLink(ctx, link); err != nil {
+				return applied, err
+			}
+		}
+		if found && known && current.Origin != in.Origin && !in.Deleted {
+			n.conflicts.Add(1)
+		}
+		n.entries[code] = in
+		applied++
+	}
+	n.applied.Add(uint64(applied))
+	return applied, nil
+}
+
+// keepClicks conserva los clics contados por este nodo al aplicar otra versión del enlace
+func keepClicks(link *shortener.Link, local shortener.Link) {
+	link.Clicks = local.Clicks
+	clicks := make(map[string]int64, len(local.Variants))
+	for _, variant := range local.Variants {
+		clicks[variant.Name] = variant.Clicks
+	}
+	variants := make([]shortener.Variant, len(link.Variants))
+	for i, variant := range link.Variants {
+		variant.Clicks = clicks[variant.Name]
+		variants[i] = variant
+	}
+	link.Variants = variants
+}
+
+// Snapshot retorna todas las entradas conocidas por el nodo, incluidas las eliminaciones, para
+// que otro nodo se sincronice
+func (n *Node) Snapshot(ctx context.Context) ([]Entry, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	entries := make([]Entry, 0, len(n.entries))
+	seen := make(map[string]bool, len(n.entries))
+	err := n.LinkStore.Each(ctx, func(link shortener.Link) error {
+		seen[link.Key()] = true
+		entry, known := n.entries[link.Key()]
+		if !known {
+			// Enlace anterior al clúster o guardado sin pasar por el nodo
+			version := Version{Time: link.CreatedAt.UnixNano(), Node: n.id}
+			entry = Entry{Origin: version, Version: version}
+			n.entries[link.Key()] = entry
+		}
+		entry.Link = link
+		entries = append(entries, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for code, entry := range n.entries {
+		if entry.Deleted && !seen[code] {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
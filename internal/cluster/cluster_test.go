@@ -0,0 +1,195 @@
+package cluster
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"acortador-urls/internal/shortener"
+)
+
+// newTestCluster crea nodos conectados entre sí a través de servidores HTTP de prueba
+func newTestCluster(t *testing.T, ids ...string) []*Node {
+	t.Helper()
+	nodes := make([]*Node, len(ids))
+	servers := make([]*httptest.Server, len(ids))
+	for i, id := range ids {
+		nodes[i] = NewNode(shortener.NewStore(), id, nil, "secreto")
+		servers[i] = httptest.NewServer(nodes[i].Handler())
+		t.Cleanup(servers[i].Close)
+	}
+	for i, node := range nodes {
+		for j, server := range servers {
+			if i != j {
+				node.peers = append(node.peers, server.URL)
+			}
+		}
+	}
+	return nodes
+}
+
+// fixedClock hace que el nodo asigne versiones a partir del instante indicado
+func fixedClock(n *Node, at time.Time) {
+	n.now = func() time.Time { return at }
+}
+
+func link(code, longURL string) shortener.Link {
+	return shortener.Link{ShortCode: code, LongURL: longURL}
+}
+
+func TestNode_Replication(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	nodes := newTestCluster(t, "a", "b")
+	a, b := nodes[0], nodes[1]
+	go a.RunPusher(ctx)
+	go b.RunPusher(ctx)
+
+	waitFor := func(check func() bool) bool {
+		deadline := time.Now().Add(2 * time.Second)
+		for time.Now().Before(deadline) {
+			if check() {
+				return true
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+		return false
+	}
+
+	// Las creaciones, ediciones y eliminaciones de un nodo llegan al otro
+	a.SaveLinkIfAbsent(ctx, link("abc123", "https://www.example.com/"))
+	if !waitFor(func() bool { _, found, _ := b.GetLink(ctx, "abc123"); return found }) {
+		t.Fatalf("Expected link to be replicated")
+	}
+
+	// Las visitas son locales y sobreviven a las ediciones replicadas
+	b.IncrementClicks(ctx, "abc123", shortener.Visit{})
+	edited := link("abc123", "https://www.example.com/editado")
+	a.SaveLink(ctx, edited)
+	if !waitFor(func() bool { l, _, _ := b.GetLink(ctx, "abc123"); return l.LongURL == edited.LongURL }) {
+		t.Fatalf("Expected edit to be replicated")
+	}
+	if l, _, _ := b.GetLink(ctx, "abc123"); l.Clicks != 1 {
+		t.Errorf("Expected local clicks to be kept, got %d", l.Clicks)
+	}
+
+	b.Delete(ctx, "abc123")
+	if !waitFor(func() bool { _, found, _ := a.GetLink(ctx, "abc123"); return !found }) {
+		t.Errorf("Expected deletion to be replicated")
+	}
+}
+
+func TestNode_ConflictResolution(t *testing.T) {
+	ctx := context.Background()
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		setup    func(a, b *Node)
+		expected string // destino final en ambos nodos; vacío si el código quedó eliminado
+	}{
+		{
+			name: "Creaciones concurrentes: gana la más antigua",
+			setup: func(a, b *Node) {
+				fixedClock(b, base)
+				b.SaveLinkIfAbsent(ctx, link("shared", "https://b.example.com/"))
+				fixedClock(a, base.Add(time.Second))
+				a.SaveLinkIfAbsent(ctx, link("shared", "https://a.example.com/"))
+			},
+			expected: "https://b.example.com/",
+		},
+		{
+			name: "Ediciones del mismo enlace: gana la última",
+			setup: func(a, b *Node) {
+				fixedClock(a, base)
+				a.SaveLinkIfAbsent(ctx, link("shared", "https://www.example.com/"))
+				b.Gossip(ctx)
+				fixedClock(b, base.Add(2*time.Second))
+				b.SaveLink(ctx, link("shared", "https://b.example.com/"))
+				fixedClock(a, base.Add(time.Second))
+				a.SaveLink(ctx, link("shared", "https://a.example.com/"))
+			},
+			expected: "https://b.example.com/",
+		},
+		{
+			name: "Creación posterior a la eliminación",
+			setup: func(a, b *Node) {
+				fixedClock(a, base)
+				a.SaveLinkIfAbsent(ctx, link("shared", "https://www.example.com/"))
+				a.Delete(ctx, "shared")
+				fixedClock(b, base.Add(time.Second))
+				b.SaveLinkIfAbsent(ctx, link("shared", "https://b.example.com/"))
+			},
+			expected: "https://b.example.com/",
+		},
+		{
+			name: "Eliminación posterior a la edición",
+			setup: func(a, b *Node) {
+				fixedClock(a, base)
+				a.SaveLinkIfAbsent(ctx, link("shared", "https://www.example.com/"))
+				b.Gossip(ctx)
+				fixedClock(a, base.Add(time.Second))
+				a.SaveLink(ctx, link("shared", "https://a.example.com/"))
+				fixedClock(b, base.Add(2*time.Second))
+				b.Delete(ctx, "shared")
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodes := newTestCluster(t, "a", "b")
+			a, b := nodes[0], nodes[1]
+			tt.setup(a, b)
+
+			// Sincronizar en ambos sentidos, dos rondas para que converjan
+			for i := 0; i < 2; i++ {
+				if _, err := a.Gossip(ctx); err != nil {
+					t.Fatalf("Unexpected gossip error: %v", err)
+				}
+				if _, err := b.Gossip(ctx); err != nil {
+					t.Fatalf("Unexpected gossip error: %v", err)
+				}
+			}
+			for _, node := range nodes {
+				l, found, _ := node.GetLink(ctx, "shared")
+				if tt.expected == "" && found {
+					t.Errorf("Expected shared to be deleted in node %s, got %s", node.id, l.LongURL)
+				}
+				if tt.expected != "" && l.LongURL != tt.expected {
+					t.Errorf("Expected %s in node %s, got %q", tt.expected, node.id, l.LongURL)
+				}
+			}
+		})
+	}
+}
+
+func TestNode_Handler(t *testing.T) {
+	node := NewNode(shortener.NewStore(), "a", nil, "secreto")
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		secret         string
+		expectedStatus int
+	}{
+		{name: "Sin clave", method: http.MethodGet, path: snapshotPath, expectedStatus: http.StatusUnauthorized},
+		{name: "Clave incorrecta", method: http.MethodGet, path: snapshotPath, secret: "otra", expectedStatus: http.StatusUnauthorized},
+		{name: "Estado completo", method: http.MethodGet, path: snapshotPath, secret: "secreto", expectedStatus: http.StatusOK},
+		{name: "Método no permitido", method: http.MethodGet, path: replicatePath, secret: "secreto", expectedStatus: http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.secret != "" {
+				req.Header.Set(SecretHeader, tt.secret)
+			}
+			rec := httptest.NewRecorder()
+			node.Handler().ServeHTTP(rec, req)
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, rec.Code)
+			}
+		})
+	}
+}
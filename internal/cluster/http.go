@@ -0,0 +1,173 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// SecretHeader es la cabecera con la clave compartida que autentica a los nodos
+const SecretHeader = "X-Cluster-Secret"
+
+// Rutas del protocolo de replicación, relativas a la URL base de cada nodo
+const (
+	replicatePath = "/cluster/replicate"
+	snapshotPath  = "/cluster/snapshot"
+)
+
+// maxPushBatch es el máximo de escrituras enviadas en cada petición
+const maxPushBatch = 100
+
+// requestTimeout acota cada petición a otro nodo
+const requestTimeout = 10 * time.Second
+
+// httpDoer es el cliente HTTP con el que se contacta a los demás nodos
+type httpDoer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+func defaultClient() httpDoer {
+	return &http.Client{Timeout: requestTimeout}
+}
+
+// Handler sirve el protocolo de replicación: POST /cluster/replicate aplica escrituras de otro
+// nodo y GET /cluster/snapshot retorna el estado completo. Se monta en la raíz del router.
+func (n *Node) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(replicatePath, n.handleReplicate)
+	mux.HandleFunc(snapshotPath, n.handleSnapshot)
+	return n.authenticate(mux)
+}
+
+// authenticate rechaza las peticiones sin la clave compartida
+func (n *Node) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		secret := r.Header.Get(SecretHeader)
+		if n.secret == "" || subtle.ConstantTimeCompare([]byte(secret), []byte(n.secret)) != 1 {
+			http.Error(w, "clave de clúster inválida", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (n *Node) handleReplicate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "método no permitido", http.StatusMethodNotAllowed)
+		return
+	}
+	var entries []Entry
+	if err := json.NewDecoder(r.Body).Decode(&entries); err != nil {
+		http.Error(w, "entradas inválidas", http.StatusBadRequest)
+		return
+	}
+	if _, err := n.Apply(r.Context(), entries); err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (n *Node) handleSnapshot(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "método no permitido", http.StatusMethodNotAllowed)
+		return
+	}
+	entries, err := n.Snapshot(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
+
+// RunPusher envía a los demás nodos las escrituras locales, agrupadas en lotes, hasta que se
+// cancela ctx. Un nodo que no responde no recibe reintentos: se pone al día con el gossip.
+func (n *Node) RunPusher(ctx context.Context) {
+	for {
+		var batch []Entry
+		select {
+		case <-ctx.Done():
+			return
+		case entry := <-n.outbox:
+			batch = append(batch, entry)
+		}
+	drain:
+		for len(batch) < maxPushBatch {
+			select {
+			case entry := <-n.outbox:
+				batch = append(batch, entry)
+			default:
+				break drain
+			}
+		}
+		for _, peer := range n.peers {
+			if err := n.push(ctx, peer, batch); err != nil {
+				n.pushErrors.Add(1)
+			}
+		}
+	}
+}
+
+// push envía un lote de escrituras a un nodo
+func (n *Node) push(ctx context.Context, peer string, entries []Entry) error {
+	body, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+	resp, err := n.request(ctx, http.MethodPost, peer+replicatePath, body)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Gossip se sincroniza con un nodo elegido al azar: descarga su estado y aplica lo que gana a
+// la versión local. Retorna cuántas entradas aplicó.
+func (n *Node) Gossip(ctx context.Context) (int, error) {
+	if len(n.peers) == 0 {
+		return 0, nil
+	}
+	peer := n.peers[rand.Intn(len(n.peers))]
+	resp, err := n.request(ctx, http.MethodGet, peer+snapshotPath, nil)
+	if err != nil {
+		n.gossipErrors.Add(1)
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	var entries []Entry
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		n.gossipErrors.Add(1)
+		return 0, fmt.Errorf("estado de %s inválido: %w", peer, err)
+	}
+	return n.Apply(ctx, entries)
+}
+
+// request hace una petición autenticada a otro nodo y falla si no responde 2xx
+func (n *Node) request(ctx context.Context, method, url string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set(SecretHeader, n.secret)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s %s: estado %d", method, url, resp.StatusCode)
+	}
+	return resp, nil
+}
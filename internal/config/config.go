@@ -0,0 +1,1372 @@
+package config
+
+import (
+	"fmt"
+	"net/netip"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config agrupa la configuración del servidor leída de variables de entorno
+type Config struct {
+	// Port es el puerto HTTP en el que escucha el servidor. Con TLS solo redirige a HTTPS y
+	// responde los desafíos ACME.
+	Port string
+	// TLS configura HTTPS nativo, sin un proxy delante
+	TLS TLSConfig
+	// AccessLog configura el log de peticiones
+	AccessLog AccessLogConfig
+	// TrustedProxies son las IPs o CIDRs de los proxies cuyas cabeceras X-Forwarded-For,
+	// X-Forwarded-Proto y X-Forwarded-Host se atienden; vacío las ignora
+	TrustedProxies []string
+	// JWTSecret es la clave HMAC para verificar tokens de usuario
+	JWTSecret string
+	// URLSigningSecret es la clave HMAC de las URLs de los enlaces firmados; vacío no admite
+	// crearlos
+	URLSigningSecret string
+	// JWTTTL es la duración de los tokens emitidos por el servicio
+	JWTTTL time.Duration
+	// RateLimit configura el limitador de peticiones de /shorten
+	RateLimit RateLimitConfig
+	// MaxBatchSize es el número máximo de URLs por petición a /shorten/batch y de códigos por
+	// lote de gestión
+	MaxBatchSize int
+	// Deduplicate hace que acortar la misma URL retorne el código existente
+	Deduplicate bool
+	// CodeStrategy selecciona el generador de códigos: "hash", "random", "sequential" o "snowflake"
+	CodeStrategy string
+	// NodeID identifica a esta réplica en la estrategia snowflake
+	NodeID int64
+	// CodeLength es la longitud de los códigos generados
+	CodeLength int
+	// CodeAlphabet es el conjunto de caracteres de los códigos generados
+	CodeAlphabet string
+	// CaseInsensitiveCodes guarda y busca los códigos en minúsculas; el alfabeto por defecto
+	// pasa a ser a-z0-9 y no admite mayúsculas
+	CaseInsensitiveCodes bool
+	// UnicodeAliases admite alias con letras no ASCII y emoji, como /🔥sale
+	UnicodeAliases bool
+	// CodeRetry configura los reintentos ante colisiones al generar códigos
+	CodeRetry CodeRetryConfig
+	// AliasSuggestions es el número de alternativas que acompañan a un alias ocupado (0 ninguna)
+	AliasSuggestions int
+	// ReservedWords son códigos adicionales que no pueden generarse ni reclamarse como alias
+	ReservedWords []string
+	// ProfanityWords son palabras que no pueden aparecer dentro de un código
+	ProfanityWords []string
+	// RequestTimeout es la duración máxima de cada petición (0 desactiva el límite)
+	RequestTimeout time.Duration
+	// MaxBodyBytes es el tamaño máximo del cuerpo aceptado por POST /shorten
+	MaxBodyBytes int64
+	// StoreMaxEntries es la capacidad del almacén en memoria (0 sin límite)
+	StoreMaxEntries int
+	// StoreEvictionPolicy es "lru" o "lfu": qué enlace se expulsa al alcanzar la capacidad
+	StoreEvictionPolicy string
+	// StoreCompactionInterval es la frecuencia con la que se comprueba si compactar el almacén en
+	// memoria (0 lo desactiva)
+	StoreCompactionInterval time.Duration
+	// StoreCompactionThreshold es la fracción de los huecos de los mapas del almacén que deben
+	// ser de enlaces borrados para compactarlo
+	StoreCompactionThreshold float64
+	// Cache configura la caché de lectura delante del almacén
+	Cache CacheConfig
+	// WriteBuffer configura el búfer que agrupa las escrituras al almacén
+	WriteBuffer WriteBufferConfig
+	// Cluster configura la replicación experimental entre instancias con almacén en memoria
+	Cluster ClusterConfig
+	// LiveAnalytics configura el canal WebSocket de métricas en vivo
+	LiveAnalytics LiveAnalyticsConfig
+	// EventSink configura el envío de los eventos de los enlaces a Kafka o NATS
+	EventSink EventSinkConfig
+	// Webhooks configura las notificaciones HTTP de los eventos de los enlaces
+	Webhooks WebhookConfig
+	// Backups configura las copias de seguridad periódicas de los enlaces
+	Backups BackupConfig
+	// BloomFilterSize es el número de códigos previsto en el filtro de Bloom que evita consultar
+	// al almacén al generar códigos (0 lo desactiva)
+	BloomFilterSize int
+	// BloomFilterFPRate es la tasa de falsos positivos del filtro de Bloom
+	BloomFilterFPRate float64
+	// MaxURLLength es la longitud máxima de las URLs de destino (0 sin límite)
+	MaxURLLength int
+	// MaxLinks es el máximo de enlaces almacenados en total (0 sin límite)
+	MaxLinks int
+	// MaxLinksPerClient es el máximo de enlaces almacenados por usuario, API key o IP (0 sin límite)
+	MaxLinksPerClient int
+	// MaxLinksPerTenant es el máximo de enlaces almacenados por tenant (0 sin límite)
+	MaxLinksPerTenant int
+	// CORS configura el acceso desde navegadores en otros dominios
+	CORS CORSConfig
+	// CompressionLevel es el nivel gzip/deflate de las respuestas (0 desactiva la compresión)
+	CompressionLevel int
+	// IdempotencyTTL es el tiempo durante el que se recuerda cada Idempotency-Key
+	IdempotencyTTL time.Duration
+	// ForwardQuery agrega la query de la URL corta al destino en todas las redirecciones
+	ForwardQuery bool
+	// RedirectMaxAge y PermanentRedirectMaxAge son el max-age de Cache-Control en las
+	// redirecciones temporales (307) y permanentes (301) que pueden guardarse en caché
+	RedirectMaxAge          time.Duration
+	PermanentRedirectMaxAge time.Duration
+	// BotUserAgents son fragmentos de User-Agent que se clasifican como bots además de los
+	// rastreadores conocidos
+	BotUserAgents []string
+	// ExcludeBots evita que las visitas de bots consuman la cuota de redirecciones y participen
+	// en las pruebas A/B
+	ExcludeBots bool
+	// PrivacyMode contabiliza todas las visitas solo en los contadores agregados, como las que
+	// llegan con DNT o GPC, y omite la IP, el Referer y el User-Agent del log de peticiones
+	PrivacyMode bool
+	// GeoIP configura la geolocalización de visitantes para los destinos por país
+	GeoIP GeoIPConfig
+	// Interstitial configura la página de aviso previa a la redirección
+	Interstitial InterstitialConfig
+	// IPAccess son las redes desde las que se admiten redirecciones de cualquier enlace
+	IPAccess IPAccessConfig
+	// Domains configura las listas de dominios de destino bloqueados y permitidos
+	Domains DomainListConfig
+	// CustomDomains son los dominios personalizados registrados al arrancar (host -> propietario)
+	CustomDomains map[string]string
+	// TenantAPIKeys y TenantHosts asignan claves de API y hosts a tenants, cada uno con su
+	// propio espacio de códigos (clave o host -> tenant)
+	TenantAPIKeys map[string]string
+	TenantHosts   map[string]string
+	// APIKeyRoles son las identidades de las claves de API que actúan como usuarios
+	// autenticados (clave -> "sujeto:rol" o "sujeto:editor:espacio")
+	APIKeyRoles map[string]string
+	// UsageQuotas configura las cuotas mensuales de cada clave de API
+	UsageQuotas UsageQuotaConfig
+	// OIDC configura el inicio de sesión con un proveedor de identidad externo
+	OIDC OIDCConfig
+	// QuarantineThreshold es el número de denunciantes distintos que pone un enlace en
+	// cuarentena tras la página de aviso (0 la desactiva)
+	QuarantineThreshold int
+	// AllowPrivateDestinations acepta destinos en redes privadas o internas (intranets)
+	AllowPrivateDestinations bool
+	// ResolveDestinations resuelve el dominio de cada destino para rechazar los que apuntan a la
+	// red interna
+	ResolveDestinations bool
+	// Reachability configura la verificación de que los destinos responden
+	Reachability ReachabilityConfig
+	// DeadLinks configura el escáner periódico de enlaces rotos
+	DeadLinks DeadLinkConfig
+	// Metadata configura la obtención de metadatos Open Graph de los destinos
+	Metadata MetadataConfig
+	// Threats configura la comprobación de destinos contra un servicio de reputación
+	Threats ThreatConfig
+	// Anomalies configura la detección de picos de visitas por enlace y por IP
+	Anomalies AnomalyConfig
+	// NotFoundPage es una plantilla HTML servida al visitar códigos inexistentes o expirados
+	NotFoundPage string
+	// NotFoundRedirect es la URL a la que se redirige al visitar códigos inexistentes o expirados
+	NotFoundRedirect string
+	// SiteFiles configura /robots.txt, /favicon.ico y /.well-known/security.txt
+	SiteFiles SiteFilesConfig
+}
+
+// SiteFilesConfig reemplaza los archivos que se sirven desde el binario en todos los dominios
+type SiteFilesConfig struct {
+	// RobotsFile es un robots.txt propio; vacío usa el que impide rastrear las redirecciones
+	RobotsFile string
+	// FaviconFile es un favicon.ico (o PNG) propio; vacío usa el incluido en el binario
+	FaviconFile string
+	// SecurityContacts son las URIs Contact de security.txt (mailto:, https: o tel:); sin
+	// ninguna /.well-known/security.txt responde 404
+	SecurityContacts []string
+	// SecurityPolicy es la URL de la política de divulgación de vulnerabilidades
+	SecurityPolicy string
+}
+
+// DomainListConfig indica las reglas de dominio en línea y los archivos o URLs de los que se
+// leen más reglas; se recargan con SIGHUP o POST /admin/domains/reload
+type DomainListConfig struct {
+	Blocklist       []string
+	BlocklistSource string
+	Allowlist       []string
+	AllowlistSource string
+}
+
+// ReachabilityConfig configura la verificación de los destinos con HEAD/GET
+type ReachabilityConfig struct {
+	// Mode es "off", "async" (comprobación en segundo plano) o "reject" (rechaza al crear)
+	Mode string
+	// Timeout acota cada comprobación
+	Timeout time.Duration
+}
+
+// MetadataConfig configura la obtención de título, descripción e imagen de los destinos
+type MetadataConfig struct {
+	// Mode es "off", "on_demand" (al consultar la vista previa) u "on_create" (además, en
+	// segundo plano al crear o editar cada enlace)
+	Mode string
+	// Timeout acota cada descarga
+	Timeout time.Duration
+	// MaxBytes es el máximo de bytes leídos de cada página
+	MaxBytes int64
+	// CacheTTL es el tiempo durante el que se reutilizan los metadatos obtenidos
+	CacheTTL time.Duration
+}
+
+// CacheConfig configura la caché de enlaces leídos en las redirecciones
+type CacheConfig struct {
+	// Size es el máximo de códigos cacheados (0 desactiva la caché)
+	Size int
+	// TTL es el tiempo durante el que se sirve un enlace cacheado
+	TTL time.Duration
+	// NegativeTTL es el tiempo durante el que se recuerda un código inexistente (0 no los cachea)
+	NegativeTTL time.Duration
+	// PubSubURL es el Redis (redis://...) por el que las réplicas se avisan de los enlaces
+	// modificados para invalidar sus cachés; vacío si cada caché solo conoce sus cambios
+	PubSubURL string
+	// PubSubChannel es el canal de Redis de las invalidaciones
+	PubSubChannel string
+}
+
+// WriteBufferConfig configura el búfer de escritura. Los enlaces pendientes se pierden si el
+// proceso termina de forma abrupta: Size e Interval acotan cuántos y durante cuánto tiempo.
+type WriteBufferConfig struct {
+	// Size es el número de enlaces que se acumulan antes de escribirlos (0 desactiva el búfer)
+	Size int
+	// Interval es el tiempo máximo que un enlace espera a escribirse
+	Interval time.Duration
+}
+
+// CodeRetryConfig configura los reintentos ante colisiones al generar códigos
+type CodeRetryConfig struct {
+	// MaxRetries es el máximo de candidatos por código antes de responder 503
+	MaxRetries int
+	// WarnAfter es el número de candidatos a partir del cual se registra un aviso (0 no avisa)
+	WarnAfter int
+	// EntropyAfter y TimestampAfter son los intentos a partir de los cuales la estrategia hash
+	// agrega más entropía y la marca de tiempo a la entrada
+	EntropyAfter   int
+	TimestampAfter int
+}
+
+// UsageQuotaConfig configura las cuotas mensuales de las claves de API. Cero no limita.
+type UsageQuotaConfig struct {
+	// Shortens es el máximo de enlaces creados al mes con cada clave
+	Shortens int
+	// Redirects es el máximo de redirecciones al mes de los enlaces creados con cada clave
+	Redirects int
+	// PerKey reemplaza ambas cuotas para claves concretas (clave -> cuotas)
+	PerKey map[string]UsageQuotaLimits
+}
+
+// UsageQuotaLimits son las cuotas mensuales de una clave de API
+type UsageQuotaLimits struct {
+	Shortens  int
+	Redirects int
+}
+
+// AccessLogConfig configura el log de peticiones
+type AccessLogConfig struct {
+	// Format es "text", "json", "combined" (Apache) u "off"
+	Format string
+	// SamplePercent es el porcentaje de peticiones registradas; los errores 5xx se registran
+	// siempre
+	SamplePercent float64
+	// RedactQuery oculta la query de las URLs de destino, que puede llevar tokens
+	RedactQuery bool
+}
+
+// TLSConfig configura HTTPS con un certificado propio o con certificados automáticos ACME (Let's
+// Encrypt). Sin CertFile ni AutocertHosts el servidor solo sirve HTTP.
+type TLSConfig struct {
+	// Port es el puerto HTTPS
+	Port     string
+	CertFile string
+	KeyFile  string
+	// AutocertHosts son los hosts para los que se obtienen certificados automáticos con el
+	// desafío HTTP-01, que necesita PORT accesible en el puerto 80
+	AutocertHosts []string
+	// AutocertEmail es el contacto de la cuenta ACME; opcional
+	AutocertEmail string
+	// AutocertCacheDir guarda la cuenta y los certificados entre reinicios
+	AutocertCacheDir string
+	// AutocertDirectory es la URL del directorio ACME; Let's Encrypt por defecto
+	AutocertDirectory string
+	// HTTP2 negocia HTTP/2 por ALPN con los clientes que lo soportan
+	HTTP2 bool
+	// HTTP3 activa el listener HTTP/3 (QUIC) experimental en el puerto UDP de TLS_PORT
+	HTTP3 bool
+}
+
+// OIDCConfig configura el inicio de sesión con un proveedor OpenID Connect (Google, Keycloak...)
+// o con GitHub. Cada identidad se traduce a un usuario interno con su rol.
+type OIDCConfig struct {
+	// Issuer es la URL del emisor OpenID Connect o "github"; vacío desactiva el inicio de sesión
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL es la URL pública de /auth/oidc/callback registrada en el proveedor
+	RedirectURL string
+	// Scopes son los alcances pedidos; vacío usa los de cada proveedor
+	Scopes []string
+	// SubjectClaim es el claim que identifica al usuario: "email" por defecto y "login" con GitHub
+	SubjectClaim string
+	// Users asigna a cada identidad su usuario interno (identidad -> "sujeto:rol" o
+	// "sujeto:editor:espacio")
+	Users map[string]string
+	// DefaultRole es el rol de las identidades que no están en Users, que actúan con su propio
+	// nombre: "owner", o vacío para rechazarlas
+	DefaultRole string
+}
+
+// ClusterConfig configura el modo clúster: los nodos se replican los enlaces sin una base de
+// datos externa
+type ClusterConfig struct {
+	// Peers son las URLs base de los demás nodos; vacío desactiva el modo clúster
+	Peers []string
+	// NodeID identifica a este nodo; por defecto, el nombre del host
+	NodeID string
+	// Secret es la clave compartida con la que se autentican los nodos
+	Secret string
+	// GossipInterval es la frecuencia con la que el nodo se sincroniza con otro al azar
+	GossipInterval time.Duration
+}
+
+// LiveAnalyticsConfig configura las métricas en vivo de GET /api/analytics/live
+type LiveAnalyticsConfig struct {
+	// Interval es la frecuencia con la que se envían las métricas a cada cliente
+	Interval time.Duration
+	// Window es el periodo sobre el que se calculan las visitas por minuto y los visitantes únicos
+	Window time.Duration
+	// Retention es el periodo durante el que se conservan los agregados diarios de
+	// GET /api/reports/summary, que acota el periodo de los resúmenes
+	Retention time.Duration
+}
+
+// EventSinkConfig configura el envío de los eventos de los enlaces a un sistema externo
+type EventSinkConfig struct {
+	// Type es "nats", "kafka" (a través de Kafka REST Proxy) o vacío para no enviarlos
+	Type string
+	// URL es el servidor NATS (nats://...) o el REST Proxy de Kafka (http(s)://...)
+	URL string
+	// Topic es el topic de Kafka o el prefijo de los subjects de NATS
+	Topic string
+	// BatchSize es el máximo de eventos por envío
+	BatchSize int
+	// FlushInterval es el tiempo máximo que un evento espera a completar su lote
+	FlushInterval time.Duration
+}
+
+// WebhookConfig configura las notificaciones de los eventos de los enlaces a endpoints externos
+type WebhookConfig struct {
+	// URLs son los endpoints que reciben los eventos; vacío desactiva los webhooks
+	URLs []string
+	// Secret firma las entregas con HMAC-SHA256
+	Secret string
+	// Events son los tipos de evento notificados
+	Events []string
+	// MaxAttempts es el número máximo de intentos de cada entrega
+	MaxAttempts int
+	// ExpiryInterval es la frecuencia con la que se buscan enlaces expirados para notificarlos
+	ExpiryInterval time.Duration
+	// ExpiryNoticeDays son los días de antelación con los que se avisa de que un enlace va a
+	// expirar (link.expiring); cero no avisa
+	ExpiryNoticeDays int
+}
+
+// webhookEvents son los tipos de evento que pueden notificarse
+var webhookEvents = []string{"link.created", "link.clicked", "link.expiring", "link.expired", "link.disabled"}
+
+// BackupConfig configura las copias de seguridad de los enlaces en un directorio o un bucket
+type BackupConfig struct {
+	// URL es el destino: file:///ruta, s3://bucket/prefijo o gs://bucket/prefijo; vacío
+	// desactiva las copias
+	URL string
+	// Interval es la frecuencia de las copias (0 solo las crea bajo demanda)
+	Interval time.Duration
+	// Retention es el número de copias que se conservan (0 las conserva todas)
+	Retention int
+	// S3Endpoint y S3Region reemplazan el endpoint y la región del bucket; por defecto los de
+	// Amazon S3 en us-east-1 o los de Google Cloud Storage con gs://
+	S3Endpoint string
+	S3Region   string
+	// AccessKey y SecretKey son las credenciales del bucket (claves HMAC en Cloud Storage)
+	AccessKey string
+	SecretKey string
+}
+
+// DeadLinkConfig configura el escáner periódico de enlaces rotos
+type DeadLinkConfig struct {
+	// Interval es la frecuencia del escaneo (0 lo desactiva)
+	Interval time.Duration
+	// Failures es el número de comprobaciones fallidas seguidas que marca un enlace como roto
+	Failures int
+}
+
+// ThreatConfig configura la consulta de reputación de los destinos (Safe Browsing o URLhaus)
+type ThreatConfig struct {
+	// Provider es "safebrowsing", "urlhaus" o vacío para no comprobar los destinos
+	Provider string
+	// APIKey es la API key de Safe Browsing o la Auth-Key de URLhaus
+	APIKey string
+	// Timeout acota la consulta al crear o editar un enlace
+	Timeout time.Duration
+	// CacheTTL es el tiempo durante el que se reutiliza cada veredicto
+	CacheTTL time.Duration
+	// RescanInterval es la frecuencia de la revisión de los enlaces existentes (0 la desactiva)
+	RescanInterval time.Duration
+}
+
+// AnomalyConfig configura la detección de picos de visitas (fraude de clics)
+type AnomalyConfig struct {
+	// Window es la ventana en la que se cuentan las visitas
+	Window time.Duration
+	// LinkClicks es el máximo de visitas por enlace en la ventana (0 no lo comprueba)
+	LinkClicks int
+	// SourceClicks es el máximo de visitas de una IP en la ventana (0 no lo comprueba)
+	SourceClicks int
+	// SpikeFactor avisa cuando las visitas de un enlace superan ese múltiplo de su media
+	// móvil (EWMA) por ventana (0 no lo comprueba)
+	SpikeFactor float64
+	// SpikeMinClicks son las visitas mínimas en la ventana para considerar un pico
+	SpikeMinClicks int
+	// SpikeAlpha es el peso de la última ventana en la media móvil
+	SpikeAlpha float64
+	// Action es "alert", "throttle" o "quarantine"
+	Action string
+	// ThrottleFor es la duración de la limitación con Action "throttle"
+	ThrottleFor time.Duration
+}
+
+// InterstitialConfig define cuándo se avisa al visitante antes de salir hacia el destino
+type InterstitialConfig struct {
+	// Domains son los dominios de destino que siempre muestran el aviso; "*" lo aplica a todos
+	Domains []string
+	// Countdown es la espera antes de continuar automáticamente (0 exige pulsar Continuar)
+	Countdown time.Duration
+}
+
+// IPAccessConfig son las reglas de red globales de las redirecciones, como IPs o CIDRs
+type IPAccessConfig struct {
+	// Allowlist son las redes desde las que redirigen los enlaces; vacío admite todas
+	Allowlist []string
+	// Denylist son las redes rechazadas aunque estén en Allowlist
+	Denylist []string
+}
+
+// GeoIPConfig indica de dónde se obtiene el país de los visitantes
+type GeoIPConfig struct {
+	// LocationsFile es GeoLite2-Country-Locations-en.csv de MaxMind
+	LocationsFile string
+	// BlockFiles son los GeoLite2-Country-Blocks-IPv4.csv / -IPv6.csv
+	BlockFiles []string
+	// CountryHeader es una cabecera con el país puesta por el CDN (p. ej. CF-IPCountry)
+	CountryHeader string
+}
+
+// RateLimitConfig configura el token bucket por cliente
+type RateLimitConfig struct {
+	Enabled bool
+	// Rate es el número de tokens repuestos por segundo
+	Rate float64
+	// Burst es la capacidad máxima del bucket
+	Burst int
+	// RedisURL es el Redis (redis://...) en el que las réplicas comparten los buckets; vacío si
+	// cada réplica limita en memoria
+	RedisURL string
+}
+
+// CORSConfig configura las cabeceras CORS; sin orígenes permitidos CORS queda desactivado
+type CORSConfig struct {
+	AllowedOrigins []string
+	AllowedMethods []string
+	AllowedHeaders []string
+	// MaxAge es el tiempo de caché de las respuestas preflight
+	MaxAge time.Duration
+}
+
+// Load construye la configuración a partir del entorno aplicando valores por defecto
+func Load() (*Config, error) {
+	cfg := &Config{
+		Port:         getEnv("PORT", "8089"),
+		JWTSecret:    os.Getenv("JWT_SECRET"),
+		CodeStrategy: getEnv("CODE_STRATEGY", "hash"),
+		CodeAlphabet: getEnv("CODE_ALPHABET", "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"),
+	}
+
+	var err error
+	if cfg.JWTTTL, err = getEnvDuration("JWT_TTL", 24*time.Hour); err != nil {
+		return nil, err
+	}
+	cfg.URLSigningSecret = os.Getenv("URL_SIGNING_SECRET")
+	if cfg.RateLimit.Enabled, err = getEnvBool("RATE_LIMIT_ENABLED", true); err != nil {
+		return nil, err
+	}
+	if cfg.RateLimit.Rate, err = getEnvFloat("RATE_LIMIT_RPS", 5); err != nil {
+		return nil, err
+	}
+	if cfg.RateLimit.Burst, err = getEnvInt("RATE_LIMIT_BURST", 10); err != nil {
+		return nil, err
+	}
+	cfg.RateLimit.RedisURL = getEnv("RATE_LIMIT_REDIS_URL", "")
+	if cfg.MaxBatchSize, err = getEnvInt("BATCH_MAX_SIZE", 1000); err != nil {
+		return nil, err
+	}
+	if cfg.Deduplicate, err = getEnvBool("DEDUPLICATE_URLS", false); err != nil {
+		return nil, err
+	}
+	if cfg.ForwardQuery, err = getEnvBool("FORWARD_QUERY", false); err != nil {
+		return nil, err
+	}
+	cfg.BotUserAgents = getEnvList("BOT_USER_AGENTS")
+	if cfg.ExcludeBots, err = getEnvBool("EXCLUDE_BOTS", false); err != nil {
+		return nil, err
+	}
+	if cfg.PrivacyMode, err = getEnvBool("PRIVACY_MODE", false); err != nil {
+		return nil, err
+	}
+	if cfg.CodeLength, err = getEnvInt("CODE_LENGTH", 6); err != nil {
+		return nil, err
+	}
+	if cfg.CaseInsensitiveCodes, err = getEnvBool("CASE_INSENSITIVE_CODES", false); err != nil {
+		return nil, err
+	}
+	if cfg.UnicodeAliases, err = getEnvBool("UNICODE_ALIASES", false); err != nil {
+		return nil, err
+	}
+	if cfg.CaseInsensitiveCodes && os.Getenv("CODE_ALPHABET") == "" {
+		cfg.CodeAlphabet = "abcdefghijklmnopqrstuvwxyz0123456789"
+	}
+	if cfg.AliasSuggestions, err = getEnvInt("ALIAS_SUGGESTIONS", 3); err != nil {
+		return nil, err
+	}
+	if cfg.CodeRetry.MaxRetries, err = getEnvInt("CODE_MAX_RETRIES", 10); err != nil {
+		return nil, err
+	}
+	if cfg.CodeRetry.WarnAfter, err = getEnvInt("CODE_RETRY_WARN_AFTER", 3); err != nil {
+		return nil, err
+	}
+	if cfg.CodeRetry.EntropyAfter, err = getEnvInt("CODE_RETRY_ENTROPY_AFTER", 3); err != nil {
+		return nil, err
+	}
+	if cfg.CodeRetry.TimestampAfter, err = getEnvInt("CODE_RETRY_TIMESTAMP_AFTER", 7); err != nil {
+		return nil, err
+	}
+	if cfg.RequestTimeout, err = getEnvDuration("REQUEST_TIMEOUT", 10*time.Second); err != nil {
+		return nil, err
+	}
+	maxBodyBytes, err := getEnvInt("MAX_BODY_BYTES", 64<<10)
+	if err != nil {
+		return nil, err
+	}
+	cfg.MaxBodyBytes = int64(maxBodyBytes)
+	if cfg.StoreMaxEntries, err = getEnvInt("STORE_MAX_ENTRIES", 0); err != nil {
+		return nil, err
+	}
+	cfg.StoreEvictionPolicy = strings.ToLower(getEnv("STORE_EVICTION_POLICY", "lru"))
+	if cfg.StoreCompactionInterval, err = getEnvDuration("STORE_COMPACTION_INTERVAL", 0); err != nil {
+		return nil, err
+	}
+	if cfg.StoreCompactionThreshold, err = getEnvFloat("STORE_COMPACTION_THRESHOLD", 0.5); err != nil {
+		return nil, err
+	}
+	if cfg.Cache.Size, err = getEnvInt("CACHE_SIZE", 0); err != nil {
+		return nil, err
+	}
+	if cfg.Cache.TTL, err = getEnvDuration("CACHE_TTL", time.Minute); err != nil {
+		return nil, err
+	}
+	if cfg.Cache.NegativeTTL, err = getEnvDuration("CACHE_NEGATIVE_TTL", 10*time.Second); err != nil {
+		return nil, err
+	}
+	cfg.Cache.PubSubURL = getEnv("CACHE_PUBSUB_URL", "")
+	cfg.Cache.PubSubChannel = getEnv("CACHE_PUBSUB_CHANNEL", "acortador:invalidaciones")
+	if cfg.WriteBuffer.Size, err = getEnvInt("WRITE_BUFFER_SIZE", 0); err != nil {
+		return nil, err
+	}
+	if cfg.WriteBuffer.Interval, err = getEnvDuration("WRITE_BUFFER_INTERVAL", time.Second); err != nil {
+		return nil, err
+	}
+	hostname, _ := os.Hostname()
+	cfg.Cluster.Peers = getEnvList("CLUSTER_PEERS")
+	cfg.Cluster.NodeID = getEnv("CLUSTER_NODE_ID", hostname)
+	cfg.Cluster.Secret = getEnv("CLUSTER_SECRET", "")
+	if cfg.Cluster.GossipInterval, err = getEnvDuration("CLUSTER_GOSSIP_INTERVAL", 10*time.Second); err != nil {
+		return nil, err
+	}
+	if cfg.LiveAnalytics.Interval, err = getEnvDuration("LIVE_ANALYTICS_INTERVAL", 5*time.Second); err != nil {
+		return nil, err
+	}
+	if cfg.LiveAnalytics.Window, err = getEnvDuration("LIVE_ANALYTICS_WINDOW", 5*time.Minute); err != nil {
+		return nil, err
+	}
+	if cfg.LiveAnalytics.Retention, err = getEnvDuration("ANALYTICS_RETENTION", 90*24*time.Hour); err != nil {
+		return nil, err
+	}
+	cfg.EventSink.Type = getEnv("EVENT_SINK", "")
+	cfg.EventSink.URL = getEnv("EVENT_SINK_URL", "")
+	cfg.EventSink.Topic = getEnv("EVENT_SINK_TOPIC", "acortador.eventos")
+	if cfg.EventSink.BatchSize, err = getEnvInt("EVENT_SINK_BATCH_SIZE", 100); err != nil {
+		return nil, err
+	}
+	if cfg.EventSink.FlushInterval, err = getEnvDuration("EVENT_SINK_FLUSH_INTERVAL", time.Second); err != nil {
+		return nil, err
+	}
+	cfg.Webhooks.URLs = getEnvList("WEBHOOK_URLS")
+	cfg.Webhooks.Secret = getEnv("WEBHOOK_SECRET", "")
+	cfg.Webhooks.Events = getEnvListDefault("WEBHOOK_EVENTS", webhookEvents)
+	if cfg.Webhooks.MaxAttempts, err = getEnvInt("WEBHOOK_MAX_ATTEMPTS", 5); err != nil {
+		return nil, err
+	}
+	if cfg.Webhooks.ExpiryInterval, err = getEnvDuration("WEBHOOK_EXPIRY_INTERVAL", time.Minute); err != nil {
+		return nil, err
+	}
+	if cfg.Webhooks.ExpiryNoticeDays, err = getEnvInt("WEBHOOK_EXPIRY_NOTICE_DAYS", 0); err != nil {
+		return nil, err
+	}
+	cfg.Backups.URL = getEnv("BACKUP_URL", "")
+	if cfg.Backups.Interval, err = getEnvDuration("BACKUP_INTERVAL", 24*time.Hour); err != nil {
+		return nil, err
+	}
+	if cfg.Backups.Retention, err = getEnvInt("BACKUP_RETENTION", 7); err != nil {
+		return nil, err
+	}
+	cfg.Backups.S3Endpoint = getEnv("BACKUP_S3_ENDPOINT", "")
+	cfg.Backups.S3Region = getEnv("BACKUP_S3_REGION", "")
+	cfg.Backups.AccessKey = getEnv("BACKUP_ACCESS_KEY", "")
+	cfg.Backups.SecretKey = getEnv("BACKUP_SECRET_KEY", "")
+	if cfg.BloomFilterSize, err = getEnvInt("BLOOM_FILTER_SIZE", 0); err != nil {
+		return nil, err
+	}
+	if cfg.BloomFilterFPRate, err = getEnvFloat("BLOOM_FILTER_FP_RATE", 0.01); err != nil {
+		return nil, err
+	}
+	if cfg.MaxURLLength, err = getEnvInt("MAX_URL_LENGTH", 2048); err != nil {
+		return nil, err
+	}
+	if cfg.MaxLinks, err = getEnvInt("MAX_LINKS", 0); err != nil {
+		return nil, err
+	}
+	if cfg.MaxLinksPerClient, err = getEnvInt("MAX_LINKS_PER_CLIENT", 0); err != nil {
+		return nil, err
+	}
+	if cfg.MaxLinksPerTenant, err = getEnvInt("MAX_LINKS_PER_TENANT", 0); err != nil {
+		return nil, err
+	}
+	cfg.CORS.AllowedOrigins = getEnvList("CORS_ALLOWED_ORIGINS")
+	cfg.CORS.AllowedMethods = getEnvListDefault("CORS_ALLOWED_METHODS", []string{"GET", "POST", "PATCH", "DELETE", "OPTIONS"})
+	cfg.CORS.AllowedHeaders = getEnvListDefault("CORS_ALLOWED_HEADERS", []string{"Content-Type", "Authorization", "X-API-Key", "Idempotency-Key"})
+	if cfg.CORS.MaxAge, err = getEnvDuration("CORS_MAX_AGE", 10*time.Minute); err != nil {
+		return nil, err
+	}
+	if cfg.CompressionLevel, err = getEnvInt("COMPRESSION_LEVEL", 5); err != nil {
+		return nil, err
+	}
+	if cfg.IdempotencyTTL, err = getEnvDuration("IDEMPOTENCY_TTL", 24*time.Hour); err != nil {
+		return nil, err
+	}
+	nodeID, err := getEnvInt("NODE_ID", 0)
+	if err != nil {
+		return nil, err
+	}
+	cfg.NodeID = int64(nodeID)
+	cfg.GeoIP.LocationsFile = os.Getenv("GEOIP_LOCATIONS_FILE")
+	cfg.GeoIP.BlockFiles = getEnvList("GEOIP_BLOCKS_FILES")
+	cfg.GeoIP.CountryHeader = os.Getenv("GEOIP_COUNTRY_HEADER")
+	cfg.NotFoundPage = os.Getenv("NOT_FOUND_PAGE")
+	cfg.NotFoundRedirect = os.Getenv("NOT_FOUND_REDIRECT")
+	cfg.SiteFiles.RobotsFile = os.Getenv("ROBOTS_TXT_FILE")
+	cfg.SiteFiles.FaviconFile = os.Getenv("FAVICON_FILE")
+	cfg.SiteFiles.SecurityContacts = getEnvList("SECURITY_CONTACTS")
+	cfg.SiteFiles.SecurityPolicy = os.Getenv("SECURITY_POLICY")
+	if cfg.RedirectMaxAge, err = getEnvDuration("REDIRECT_CACHE_MAX_AGE", 0); err != nil {
+		return nil, err
+	}
+	if cfg.PermanentRedirectMaxAge, err = getEnvDuration("REDIRECT_PERMANENT_MAX_AGE", 365*24*time.Hour); err != nil {
+		return nil, err
+	}
+	cfg.Interstitial.Domains = getEnvList("INTERSTITIAL_DOMAINS")
+	if cfg.Interstitial.Countdown, err = getEnvDuration("INTERSTITIAL_COUNTDOWN", 5*time.Second); err != nil {
+		return nil, err
+	}
+	cfg.IPAccess.Allowlist = getEnvList("REDIRECT_IP_ALLOWLIST")
+	cfg.IPAccess.Denylist = getEnvList("REDIRECT_IP_DENYLIST")
+	cfg.Domains.Blocklist = getEnvList("DOMAIN_BLOCKLIST")
+	cfg.Domains.BlocklistSource = os.Getenv("DOMAIN_BLOCKLIST_SOURCE")
+	cfg.Domains.Allowlist = getEnvList("DOMAIN_ALLOWLIST")
+	cfg.Domains.AllowlistSource = os.Getenv("DOMAIN_ALLOWLIST_SOURCE")
+	if cfg.CustomDomains, err = getEnvMap("CUSTOM_DOMAINS"); err != nil {
+		return nil, err
+	}
+	if cfg.TenantAPIKeys, err = getEnvKeyMap("TENANT_API_KEYS"); err != nil {
+		return nil, err
+	}
+	if cfg.TenantHosts, err = getEnvMap("TENANT_HOSTS"); err != nil {
+		return nil, err
+	}
+	if cfg.APIKeyRoles, err = getEnvKeyMap("API_KEY_ROLES"); err != nil {
+		return nil, err
+	}
+	if cfg.UsageQuotas.Shortens, err = getEnvInt("API_KEY_SHORTEN_QUOTA", 0); err != nil {
+		return nil, err
+	}
+	if cfg.UsageQuotas.Redirects, err = getEnvInt("API_KEY_REDIRECT_QUOTA", 0); err != nil {
+		return nil, err
+	}
+	if cfg.UsageQuotas.PerKey, err = getEnvUsageQuotas("API_KEY_QUOTAS"); err != nil {
+		return nil, err
+	}
+	cfg.TrustedProxies = getEnvList("TRUSTED_PROXIES")
+	cfg.AccessLog.Format = strings.ToLower(getEnv("ACCESS_LOG_FORMAT", "text"))
+	if cfg.AccessLog.SamplePercent, err = getEnvFloat("ACCESS_LOG_SAMPLE_PERCENT", 100); err != nil {
+		return nil, err
+	}
+	if cfg.AccessLog.RedactQuery, err = getEnvBool("ACCESS_LOG_REDACT_QUERY", true); err != nil {
+		return nil, err
+	}
+	cfg.TLS.Port = getEnv("TLS_PORT", "443")
+	cfg.TLS.CertFile = os.Getenv("TLS_CERT_FILE")
+	cfg.TLS.KeyFile = os.Getenv("TLS_KEY_FILE")
+	cfg.TLS.AutocertHosts = getEnvList("TLS_AUTOCERT_HOSTS")
+	cfg.TLS.AutocertEmail = os.Getenv("TLS_AUTOCERT_EMAIL")
+	cfg.TLS.AutocertCacheDir = getEnv("TLS_AUTOCERT_CACHE_DIR", "certs")
+	cfg.TLS.AutocertDirectory = os.Getenv("TLS_AUTOCERT_DIRECTORY")
+	if cfg.TLS.HTTP2, err = getEnvBool("TLS_HTTP2", true); err != nil {
+		return nil, err
+	}
+	if cfg.TLS.HTTP3, err = getEnvBool("TLS_HTTP3", false); err != nil {
+		return nil, err
+	}
+	cfg.OIDC.Issuer = os.Getenv("OIDC_ISSUER")
+	cfg.OIDC.ClientID = os.Getenv("OIDC_CLIENT_ID")
+	cfg.OIDC.ClientSecret = os.Getenv("OIDC_CLIENT_SECRET")
+	cfg.OIDC.RedirectURL = os.Getenv("OIDC_REDIRECT_URL")
+	cfg.OIDC.Scopes = getEnvList("OIDC_SCOPES")
+	defaultSubjectClaim := "email"
+	if strings.EqualFold(cfg.OIDC.Issuer, "github") {
+		cfg.OIDC.Issuer = "github"
+		defaultSubjectClaim = "login"
+	}
+	cfg.OIDC.SubjectClaim = getEnv("OIDC_SUBJECT_CLAIM", defaultSubjectClaim)
+	if cfg.OIDC.Users, err = getEnvMap("OIDC_USERS"); err != nil {
+		return nil, err
+	}
+	cfg.OIDC.DefaultRole = strings.ToLower(os.Getenv("OIDC_DEFAULT_ROLE"))
+	if cfg.QuarantineThreshold, err = getEnvInt("REPORT_QUARANTINE_THRESHOLD", 0); err != nil {
+		return nil, err
+	}
+	if cfg.AllowPrivateDestinations, err = getEnvBool("ALLOW_PRIVATE_DESTINATIONS", false); err != nil {
+		return nil, err
+	}
+	if cfg.ResolveDestinations, err = getEnvBool("RESOLVE_DESTINATIONS", false); err != nil {
+		return nil, err
+	}
+	cfg.Reachability.Mode = strings.ToLower(getEnv("REACHABILITY_CHECK", "off"))
+	if cfg.Reachability.Timeout, err = getEnvDuration("REACHABILITY_TIMEOUT", 5*time.Second); err != nil {
+		return nil, err
+	}
+	cfg.Metadata.Mode = strings.ToLower(getEnv("METADATA_FETCH", "off"))
+	if cfg.Metadata.Timeout, err = getEnvDuration("METADATA_TIMEOUT", 5*time.Second); err != nil {
+		return nil, err
+	}
+	metadataMaxBytes, err := getEnvInt("METADATA_MAX_BYTES", 512<<10)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Metadata.MaxBytes = int64(metadataMaxBytes)
+	if cfg.Metadata.CacheTTL, err = getEnvDuration("METADATA_CACHE_TTL", 24*time.Hour); err != nil {
+		return nil, err
+	}
+	if cfg.DeadLinks.Interval, err = getEnvDuration("DEAD_LINK_SCAN_INTERVAL", 0); err != nil {
+		return nil, err
+	}
+	if cfg.DeadLinks.Failures, err = getEnvInt("DEAD_LINK_FAILURES", 3); err != nil {
+		return nil, err
+	}
+	cfg.Threats.Provider = strings.ToLower(os.Getenv("THREAT_PROVIDER"))
+	cfg.Threats.APIKey = os.Getenv("THREAT_API_KEY")
+	if cfg.Threats.Timeout, err = getEnvDuration("THREAT_CHECK_TIMEOUT", 2*time.Second); err != nil {
+		return nil, err
+	}
+	if cfg.Threats.CacheTTL, err = getEnvDuration("THREAT_CACHE_TTL", time.Hour); err != nil {
+		return nil, err
+	}
+	if cfg.Threats.RescanInterval, err = getEnvDuration("THREAT_RESCAN_INTERVAL", 24*time.Hour); err != nil {
+		return nil, err
+	}
+	if cfg.Anomalies.Window, err = getEnvDuration("ANOMALY_WINDOW", time.Minute); err != nil {
+		return nil, err
+	}
+	if cfg.Anomalies.LinkClicks, err = getEnvInt("ANOMALY_LINK_CLICKS", 0); err != nil {
+		return nil, err
+	}
+	if cfg.Anomalies.SourceClicks, err = getEnvInt("ANOMALY_SOURCE_CLICKS", 0); err != nil {
+		return nil, err
+	}
+	if cfg.Anomalies.SpikeFactor, err = getEnvFloat("ANOMALY_SPIKE_FACTOR", 0); err != nil {
+		return nil, err
+	}
+	if cfg.Anomalies.SpikeMinClicks, err = getEnvInt("ANOMALY_SPIKE_MIN_CLICKS", 20); err != nil {
+		return nil, err
+	}
+	if cfg.Anomalies.SpikeAlpha, err = getEnvFloat("ANOMALY_SPIKE_ALPHA", 0.3); err != nil {
+		return nil, err
+	}
+	cfg.Anomalies.Action = strings.ToLower(getEnv("ANOMALY_ACTION", "alert"))
+	if cfg.Anomalies.ThrottleFor, err = getEnvDuration("ANOMALY_THROTTLE_DURATION", 10*time.Minute); err != nil {
+		return nil, err
+	}
+	cfg.ReservedWords = getEnvList("RESERVED_WORDS")
+	cfg.ProfanityWords = getEnvList("PROFANITY_WORDS")
+	if path := os.Getenv("PROFANITY_FILE"); path != "" {
+		words, err := readWordList(path)
+		if err != nil {
+			return nil, err
+		}
+		cfg.ProfanityWords = append(cfg.ProfanityWords, words...)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Validate comprueba la coherencia de los valores configurados
+func (c *Config) Validate() error {
+	if c.RateLimit.Enabled {
+		if c.RateLimit.Rate <= 0 {
+			return fmt.Errorf("RATE_LIMIT_RPS debe ser mayor que cero")
+		}
+		if c.RateLimit.Burst < 1 {
+			return fmt.Errorf("RATE_LIMIT_BURST debe ser al menos 1")
+		}
+		if c.RateLimit.RedisURL != "" && !strings.HasPrefix(c.RateLimit.RedisURL, "redis://") {
+			return fmt.Errorf("RATE_LIMIT_REDIS_URL debe ser una URL redis://")
+		}
+	} else if c.RateLimit.RedisURL != "" {
+		return fmt.Errorf("RATE_LIMIT_REDIS_URL requiere RATE_LIMIT_ENABLED")
+	}
+	if c.MaxBatchSize < 1 {
+		return fmt.Errorf("BATCH_MAX_SIZE debe ser al menos 1")
+	}
+	if c.CaseInsensitiveCodes && strings.ToLower(c.CodeAlphabet) != c.CodeAlphabet {
+		return fmt.Errorf("CODE_ALPHABET no puede tener mayúsculas con CASE_INSENSITIVE_CODES")
+	}
+	if c.AliasSuggestions < 0 || c.AliasSuggestions > 10 {
+		return fmt.Errorf("ALIAS_SUGGESTIONS debe estar entre 0 y 10")
+	}
+	if c.CodeRetry.MaxRetries < 1 {
+		return fmt.Errorf("CODE_MAX_RETRIES debe ser al menos 1")
+	}
+	if c.CodeRetry.WarnAfter < 0 {
+		return fmt.Errorf("CODE_RETRY_WARN_AFTER no puede ser negativo")
+	}
+	if c.CodeRetry.EntropyAfter < 0 || c.CodeRetry.TimestampAfter < c.CodeRetry.EntropyAfter {
+		return fmt.Errorf("CODE_RETRY_TIMESTAMP_AFTER debe ser mayor o igual que CODE_RETRY_ENTROPY_AFTER, y este no negativo")
+	}
+	if c.RequestTimeout < 0 {
+		return fmt.Errorf("REQUEST_TIMEOUT no puede ser negativo")
+	}
+	if c.MaxBodyBytes < 1 {
+		return fmt.Errorf("MAX_BODY_BYTES debe ser al menos 1")
+	}
+	if c.StoreMaxEntries < 0 {
+		return fmt.Errorf("STORE_MAX_ENTRIES no puede ser negativo")
+	}
+	if c.StoreEvictionPolicy != "lru" && c.StoreEvictionPolicy != "lfu" {
+		return fmt.Errorf("STORE_EVICTION_POLICY debe ser lru o lfu")
+	}
+	if c.StoreCompactionInterval < 0 {
+		return fmt.Errorf("STORE_COMPACTION_INTERVAL no puede ser negativo")
+	}
+	if c.StoreCompactionThreshold <= 0 || c.StoreCompactionThreshold > 1 {
+		return fmt.Errorf("STORE_COMPACTION_THRESHOLD debe estar entre 0 y 1")
+	}
+	if c.Cache.Size < 0 {
+		return fmt.Errorf("CACHE_SIZE no puede ser negativo")
+	}
+	if c.Cache.Size > 0 && c.Cache.TTL <= 0 {
+		return fmt.Errorf("CACHE_TTL debe ser positivo")
+	}
+	if c.Cache.NegativeTTL < 0 {
+		return fmt.Errorf("CACHE_NEGATIVE_TTL no puede ser negativo")
+	}
+	if c.Cache.PubSubURL != "" && c.Cache.Size == 0 {
+		return fmt.Errorf("CACHE_PUBSUB_URL requiere CACHE_SIZE")
+	}
+	if c.WriteBuffer.Size < 0 {
+		return fmt.Errorf("WRITE_BUFFER_SIZE no puede ser negativo")
+	}
+	if c.WriteBuffer.Size > 0 && c.WriteBuffer.Interval <= 0 {
+		return fmt.Errorf("WRITE_BUFFER_INTERVAL debe ser positivo")
+	}
+	if len(c.Cluster.Peers) > 0 {
+		for _, peer := range c.Cluster.Peers {
+			if parsed, err := url.Parse(peer); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+				return fmt.Errorf("CLUSTER_PEERS debe contener URLs http(s): %q", peer)
+			}
+		}
+		if c.Cluster.NodeID == "" {
+			return fmt.Errorf("CLUSTER_NODE_ID es obligatorio en modo clúster")
+		}
+		if c.Cluster.Secret == "" {
+			return fmt.Errorf("CLUSTER_SECRET es obligatorio en modo clúster")
+		}
+		if c.Cluster.GossipInterval <= 0 {
+			return fmt.Errorf("CLUSTER_GOSSIP_INTERVAL debe ser positivo")
+		}
+		if c.Cache.Size > 0 || c.WriteBuffer.Size > 0 {
+			return fmt.Errorf("el modo clúster no admite CACHE_SIZE ni WRITE_BUFFER_SIZE")
+		}
+	}
+	if c.LiveAnalytics.Interval <= 0 {
+		return fmt.Errorf("LIVE_ANALYTICS_INTERVAL debe ser positivo")
+	}
+	if c.LiveAnalytics.Window < time.Minute {
+		return fmt.Errorf("LIVE_ANALYTICS_WINDOW debe ser de al menos 1m")
+	}
+	if c.LiveAnalytics.Retention < 24*time.Hour {
+		return fmt.Errorf("ANALYTICS_RETENTION debe ser de al menos 24h")
+	}
+	switch c.EventSink.Type {
+	case "":
+	case "nats", "kafka":
+		if c.EventSink.URL == "" {
+			return fmt.Errorf("EVENT_SINK_URL es obligatorio con EVENT_SINK=%s", c.EventSink.Type)
+		}
+		if c.EventSink.Topic == "" {
+			return fmt.Errorf("EVENT_SINK_TOPIC no puede estar vacío")
+		}
+		if c.EventSink.BatchSize < 1 {
+			return fmt.Errorf("EVENT_SINK_BATCH_SIZE debe ser al menos 1")
+		}
+		if c.EventSink.FlushInterval <= 0 {
+			return fmt.Errorf("EVENT_SINK_FLUSH_INTERVAL debe ser positivo")
+		}
+	default:
+		return fmt.Errorf("EVENT_SINK debe ser nats o kafka: %q", c.EventSink.Type)
+	}
+	if len(c.Webhooks.URLs) > 0 {
+		for _, endpoint := range c.Webhooks.URLs {
+			if parsed, err := url.Parse(endpoint); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+				return fmt.Errorf("WEBHOOK_URLS debe contener URLs http(s): %q", endpoint)
+			}
+		}
+		if c.Webhooks.Secret == "" {
+			return fmt.Errorf("WEBHOOK_SECRET es obligatorio si se configuran WEBHOOK_URLS")
+		}
+		for _, event := range c.Webhooks.Events {
+			if !contains(webhookEvents, event) {
+				return fmt.Errorf("WEBHOOK_EVENTS debe contener %s: %q", strings.Join(webhookEvents, ", "), event)
+			}
+		}
+		if c.Webhooks.MaxAttempts < 1 {
+			return fmt.Errorf("WEBHOOK_MAX_ATTEMPTS debe ser al menos 1")
+		}
+		if c.Webhooks.ExpiryInterval <= 0 {
+			return fmt.Errorf("WEBHOOK_EXPIRY_INTERVAL debe ser positivo")
+		}
+		if c.Webhooks.ExpiryNoticeDays < 0 {
+			return fmt.Errorf("WEBHOOK_EXPIRY_NOTICE_DAYS no puede ser negativo")
+		}
+	}
+	if c.Backups.URL != "" {
+		parsed, err := url.Parse(c.Backups.URL)
+		if err != nil {
+			return fmt.Errorf("BACKUP_URL inválida: %v", err)
+		}
+		switch parsed.Scheme {
+		case "file":
+			if parsed.Path == "" {
+				return fmt.Errorf("BACKUP_URL debe indicar un directorio: %q", c.Backups.URL)
+			}
+		case "s3", "gs":
+			if parsed.Host == "" {
+				return fmt.Errorf("BACKUP_URL debe indicar el bucket: %q", c.Backups.URL)
+			}
+			if c.Backups.AccessKey == "" || c.Backups.SecretKey == "" {
+				return fmt.Errorf("BACKUP_ACCESS_KEY y BACKUP_SECRET_KEY son obligatorias con BACKUP_URL=%s://", parsed.Scheme)
+			}
+		default:
+			return fmt.Errorf("BACKUP_URL debe empezar por file://, s3:// o gs://: %q", c.Backups.URL)
+		}
+		if c.Backups.Interval < 0 {
+			return fmt.Errorf("BACKUP_INTERVAL no puede ser negativo")
+		}
+		if c.Backups.Retention < 0 {
+			return fmt.Errorf("BACKUP_RETENTION no puede ser negativo")
+		}
+	}
+	if c.BloomFilterSize < 0 {
+		return fmt.Errorf("BLOOM_FILTER_SIZE no puede ser negativo")
+	}
+	if c.BloomFilterFPRate <= 0 || c.BloomFilterFPRate >= 1 {
+		return fmt.Errorf("BLOOM_FILTER_FP_RATE debe estar entre 0 y 1")
+	}
+	if c.MaxURLLength < 0 {
+		return fmt.Errorf("MAX_URL_LENGTH no puede ser negativo")
+	}
+	if c.MaxLinks < 0 || c.MaxLinksPerClient < 0 || c.MaxLinksPerTenant < 0 {
+		return fmt.Errorf("MAX_LINKS, MAX_LINKS_PER_CLIENT y MAX_LINKS_PER_TENANT no pueden ser negativos")
+	}
+	if c.CORS.MaxAge < 0 {
+		return fmt.Errorf("CORS_MAX_AGE no puede ser negativo")
+	}
+	if c.CompressionLevel < 0 || c.CompressionLevel > 9 {
+		return fmt.Errorf("COMPRESSION_LEVEL debe estar entre 0 y 9")
+	}
+	if (c.GeoIP.LocationsFile == "") != (len(c.GeoIP.BlockFiles) == 0) {
+		return fmt.Errorf("GEOIP_LOCATIONS_FILE y GEOIP_BLOCKS_FILES deben configurarse juntos")
+	}
+	for _, contact := range c.SiteFiles.SecurityContacts {
+		if !strings.HasPrefix(contact, "mailto:") && !strings.HasPrefix(contact, "https://") && !strings.HasPrefix(contact, "tel:") {
+			return fmt.Errorf("SECURITY_CONTACTS solo admite URIs mailto:, https:// o tel:: %q", contact)
+		}
+	}
+	if c.SiteFiles.SecurityPolicy != "" && !strings.HasPrefix(c.SiteFiles.SecurityPolicy, "https://") {
+		return fmt.Errorf("SECURITY_POLICY debe ser una URL https")
+	}
+	if c.NotFoundPage != "" && c.NotFoundRedirect != "" {
+		return fmt.Errorf("NOT_FOUND_PAGE y NOT_FOUND_REDIRECT son excluyentes")
+	}
+	if c.NotFoundRedirect != "" {
+		if parsed, err := url.Parse(c.NotFoundRedirect); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return fmt.Errorf("NOT_FOUND_REDIRECT debe ser una URL http o https absoluta")
+		}
+	}
+	if c.RedirectMaxAge < 0 || c.PermanentRedirectMaxAge < 0 {
+		return fmt.Errorf("REDIRECT_CACHE_MAX_AGE y REDIRECT_PERMANENT_MAX_AGE no pueden ser negativos")
+	}
+	if c.Interstitial.Countdown < 0 {
+		return fmt.Errorf("INTERSTITIAL_COUNTDOWN no puede ser negativo")
+	}
+	for host, owner := range c.CustomDomains {
+		if !strings.Contains(host, ".") || strings.ContainsAny(host, "/: ") || owner == "" {
+			return fmt.Errorf("CUSTOM_DOMAINS debe tener la forma host=propietario (p. ej. go.acme.com=user-123): %q", host)
+		}
+	}
+	for apiKey, tenant := range c.TenantAPIKeys {
+		if !validTenant(tenant) {
+			return fmt.Errorf("TENANT_API_KEYS debe tener la forma clave=tenant con tenants en minúsculas, números y '-': %q", apiKey)
+		}
+	}
+	for apiKey, grant := range c.APIKeyRoles {
+		if !validGrant(grant) {
+			return fmt.Errorf("API_KEY_ROLES debe tener la forma clave=sujeto:rol con rol owner, editor o admin, y sujeto:editor:espacio para los editores: %q", apiKey)
+		}
+	}
+	if c.UsageQuotas.Shortens < 0 || c.UsageQuotas.Redirects < 0 {
+		return fmt.Errorf("API_KEY_SHORTEN_QUOTA y API_KEY_REDIRECT_QUOTA no pueden ser negativos")
+	}
+	switch c.AccessLog.Format {
+	case "text", "json", "combined", "off":
+	default:
+		return fmt.Errorf("ACCESS_LOG_FORMAT debe ser text, json, combined u off")
+	}
+	if c.AccessLog.SamplePercent < 0 || c.AccessLog.SamplePercent > 100 {
+		return fmt.Errorf("ACCESS_LOG_SAMPLE_PERCENT debe estar entre 0 y 100")
+	}
+	for _, proxy := range c.TrustedProxies {
+		if _, err := netip.ParsePrefix(proxy); err != nil {
+			if _, err := netip.ParseAddr(proxy); err != nil {
+				return fmt.Errorf("TRUSTED_PROXIES debe contener IPs o CIDRs (p. ej. 10.0.0.0/8): %q", proxy)
+			}
+		}
+	}
+	for _, rule := range append(append([]string{}, c.IPAccess.Allowlist...), c.IPAccess.Denylist...) {
+		if _, err := netip.ParsePrefix(rule); err != nil {
+			if _, err := netip.ParseAddr(rule); err != nil {
+				return fmt.Errorf("REDIRECT_IP_ALLOWLIST y REDIRECT_IP_DENYLIST deben contener IPs o CIDRs (p. ej. 10.0.0.0/8): %q", rule)
+			}
+		}
+	}
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		return fmt.Errorf("TLS_CERT_FILE y TLS_KEY_FILE deben configurarse juntos")
+	}
+	if c.TLS.CertFile != "" && len(c.TLS.AutocertHosts) > 0 {
+		return fmt.Errorf("TLS_CERT_FILE y TLS_AUTOCERT_HOSTS son excluyentes")
+	}
+	if c.TLS.CertFile != "" || len(c.TLS.AutocertHosts) > 0 {
+		if c.TLS.Port == "" || c.TLS.Port == c.Port {
+			return fmt.Errorf("TLS_PORT debe ser distinto de PORT, que redirige a HTTPS")
+		}
+	} else if c.TLS.HTTP3 {
+		return fmt.Errorf("TLS_HTTP3 requiere TLS_CERT_FILE o TLS_AUTOCERT_HOSTS")
+	}
+	for _, host := range c.TLS.AutocertHosts {
+		if !strings.Contains(host, ".") || strings.ContainsAny(host, "/:* ") {
+			return fmt.Errorf("TLS_AUTOCERT_HOSTS debe contener nombres de dominio sin puerto ni comodines: %q", host)
+		}
+	}
+	if c.TLS.AutocertDirectory != "" {
+		if parsed, err := url.Parse(c.TLS.AutocertDirectory); err != nil || parsed.Scheme != "https" || parsed.Host == "" {
+			return fmt.Errorf("TLS_AUTOCERT_DIRECTORY debe ser una URL https absoluta")
+		}
+	}
+	if c.OIDC.Issuer != "" {
+		if c.OIDC.Issuer != "github" && !strings.HasPrefix(c.OIDC.Issuer, "https://") && !strings.HasPrefix(c.OIDC.Issuer, "http://") {
+			return fmt.Errorf("OIDC_ISSUER debe ser la URL del emisor o github")
+		}
+		if c.OIDC.ClientID == "" || c.OIDC.RedirectURL == "" {
+			return fmt.Errorf("OIDC_ISSUER requiere OIDC_CLIENT_ID y OIDC_REDIRECT_URL")
+		}
+		if c.JWTSecret == "" {
+			return fmt.Errorf("OIDC_ISSUER requiere JWT_SECRET para emitir los tokens de sesión")
+		}
+	}
+	for identity, grant := range c.OIDC.Users {
+		if !validGrant(grant) {
+			return fmt.Errorf("OIDC_USERS debe tener la forma identidad=sujeto:rol con rol owner, editor o admin, y sujeto:editor:espacio para los editores: %q", identity)
+		}
+	}
+	if c.OIDC.DefaultRole != "" && c.OIDC.DefaultRole != "owner" {
+		return fmt.Errorf("OIDC_DEFAULT_ROLE debe ser owner o vacío")
+	}
+	for host, tenant := range c.TenantHosts {
+		if !strings.Contains(host, ".") || strings.ContainsAny(host, "/ ") || !validTenant(tenant) {
+			return fmt.Errorf("TENANT_HOSTS debe tener la forma host=tenant (p. ej. go.equipo-a.com=equipo-a): %q", host)
+		}
+	}
+	if c.QuarantineThreshold < 0 {
+		return fmt.Errorf("REPORT_QUARANTINE_THRESHOLD no puede ser negativo")
+	}
+	if c.Reachability.Mode != "off" && c.Reachability.Mode != "async" && c.Reachability.Mode != "reject" {
+		return fmt.Errorf("REACHABILITY_CHECK debe ser off, async o reject")
+	}
+	if c.Reachability.Timeout <= 0 {
+		return fmt.Errorf("REACHABILITY_TIMEOUT debe ser mayor que cero")
+	}
+	if c.Metadata.Mode != "off" && c.Metadata.Mode != "on_demand" && c.Metadata.Mode != "on_create" {
+		return fmt.Errorf("METADATA_FETCH debe ser off, on_demand u on_create")
+	}
+	if c.Metadata.Timeout <= 0 {
+		return fmt.Errorf("METADATA_TIMEOUT debe ser mayor que cero")
+	}
+	if c.Metadata.MaxBytes < 1 {
+		return fmt.Errorf("METADATA_MAX_BYTES debe ser al menos 1")
+	}
+	if c.Metadata.CacheTTL <= 0 {
+		return fmt.Errorf("METADATA_CACHE_TTL debe ser mayor que cero")
+	}
+	if c.DeadLinks.Interval < 0 {
+		return fmt.Errorf("DEAD_LINK_SCAN_INTERVAL no puede ser negativo")
+	}
+	if c.DeadLinks.Failures < 1 {
+		return fmt.Errorf("DEAD_LINK_FAILURES debe ser al menos 1")
+	}
+	switch c.Threats.Provider {
+	case "", "urlhaus":
+	case "safebrowsing":
+		if c.Threats.APIKey == "" {
+			return fmt.Errorf("THREAT_PROVIDER=safebrowsing requiere THREAT_API_KEY")
+		}
+	default:
+		return fmt.Errorf("THREAT_PROVIDER debe ser safebrowsing o urlhaus")
+	}
+	if c.Threats.Timeout <= 0 || c.Threats.CacheTTL <= 0 {
+		return fmt.Errorf("THREAT_CHECK_TIMEOUT y THREAT_CACHE_TTL deben ser mayores que cero")
+	}
+	if c.Threats.RescanInterval < 0 {
+		return fmt.Errorf("THREAT_RESCAN_INTERVAL no puede ser negativo")
+	}
+	if c.Anomalies.Window <= 0 || c.Anomalies.ThrottleFor <= 0 {
+		return fmt.Errorf("ANOMALY_WINDOW y ANOMALY_THROTTLE_DURATION deben ser mayores que cero")
+	}
+	if c.Anomalies.LinkClicks < 0 || c.Anomalies.SourceClicks < 0 {
+		return fmt.Errorf("ANOMALY_LINK_CLICKS y ANOMALY_SOURCE_CLICKS no pueden ser negativos")
+	}
+	if c.Anomalies.SpikeFactor != 0 && c.Anomalies.SpikeFactor <= 1 {
+		return fmt.Errorf("ANOMALY_SPIKE_FACTOR debe ser 0 o mayor que 1")
+	}
+	if c.Anomalies.SpikeMinClicks < 1 {
+		return fmt.Errorf("ANOMALY_SPIKE_MIN_CLICKS debe ser al menos 1")
+	}
+	if c.Anomalies.SpikeAlpha <= 0 || c.Anomalies.SpikeAlpha > 1 {
+		return fmt.Errorf("ANOMALY_SPIKE_ALPHA debe estar entre 0 (excluido) y 1")
+	}
+	if c.Anomalies.Action != "alert" && c.Anomalies.Action != "throttle" && c.Anomalies.Action != "quarantine" {
+		return fmt.Errorf("ANOMALY_ACTION debe ser alert, throttle o quarantine")
+	}
+	if c.IdempotencyTTL <= 0 {
+		return fmt.Errorf("IDEMPOTENCY_TTL debe ser mayor que cero")
+	}
+	return nil
+}
+
+// getEnv retorna la variable de entorno o el valor por defecto si está vacía
+func getEnv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// getEnvList lee una lista separada por comas ignorando elementos vacíos
+func getEnvList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// validTenant indica si name es un identificador de tenant: de 1 a 63 letras minúsculas,
+// números y '-', sin empezar por '-'
+func validTenant(name string) bool {
+	if name == "" || len(name) > 63 || name[0] == '-' {
+		return false
+	}
+	for _, c := range name {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '-' {
+			return false
+		}
+	}
+	return true
+}
+
+// validGrant indica si grant tiene la forma sujeto:owner, sujeto:admin o sujeto:editor:espacio
+func validGrant(grant string) bool {
+	parts := strings.Split(grant, ":")
+	if parts[0] == "" {
+		return false
+	}
+	switch {
+	case len(parts) == 2:
+		return parts[1] == "owner" || parts[1] == "admin"
+	case len(parts) == 3:
+		return parts[1] == "editor" && parts[2] != ""
+	default:
+		return false
+	}
+}
+
+// getEnvMap lee una lista separada por comas de pares clave=valor; las claves (hosts o
+// identificadores) se pasan a minúsculas
+func getEnvMap(key string) (map[string]string, error) {
+	values, err := getEnvKeyMap(key)
+	if err != nil {
+		return nil, err
+	}
+	lower := make(map[string]string, len(values))
+	for k, v := range values {
+		lower[strings.ToLower(k)] = v
+	}
+	return lower, nil
+}
+
+// getEnvUsageQuotas lee pares clave=acortados:redirecciones con las cuotas mensuales de cada
+// clave de API
+func getEnvUsageQuotas(key string) (map[string]UsageQuotaLimits, error) {
+	pairs, err := getEnvKeyMap(key)
+	if err != nil {
+		return nil, err
+	}
+	quotas := make(map[string]UsageQuotaLimits, len(pairs))
+	for apiKey, value := range pairs {
+		shortens, redirects, ok := strings.Cut(value, ":")
+		limits := UsageQuotaLimits{}
+		var errShortens, errRedirects error
+		limits.Shortens, errShortens = strconv.Atoi(shortens)
+		limits.Redirects, errRedirects = strconv.Atoi(redirects)
+		if !ok || errShortens != nil || errRedirects != nil || limits.Shortens < 0 || limits.Redirects < 0 {
+			return nil, fmt.Errorf("%s debe tener la forma clave=acortados:redirecciones con enteros no negativos: %q", key, value)
+		}
+		quotas[apiKey] = limits
+	}
+	return quotas, nil
+}
+
+// getEnvKeyMap lee pares clave=valor como getEnvMap pero conserva las mayúsculas de las
+// claves, que son claves de API y se comparan tal cual
+func getEnvKeyMap(key string) (map[string]string, error) {
+	values := make(map[string]string)
+	for _, pair := range getEnvList(key) {
+		k, v, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("%s debe contener pares clave=valor separados por comas: %q", key, pair)
+		}
+		values[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+	return values, nil
+}
+
+// getEnvListDefault lee una lista separada por comas o retorna el valor por defecto si está vacía
+func getEnvListDefault(key string, fallback []string) []string {
+	if values := getEnvList(key); len(values) > 0 {
+		return values
+	}
+	return fallback
+}
+
+// contains indica si values incluye value
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// readWordList lee un archivo con una palabra por línea; las líneas con # son comentarios
+func readWordList(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("no se pudo leer %s: %w", path, err)
+	}
+
+	var words []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+			words = append(words, line)
+		}
+	}
+	return words, nil
+}
+
+func getEnvInt(key string, fallback int) (int, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback, nil
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("%s debe ser un entero: %w", key, err)
+	}
+	return parsed, nil
+}
+
+func getEnvFloat(key string, fallback float64) (float64, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback, nil
+	}
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s debe ser un número: %w", key, err)
+	}
+	return parsed, nil
+}
+
+func getEnvBool(key string, fallback bool) (bool, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback, nil
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("%s debe ser true o false: %w", key, err)
+	}
+	return parsed, nil
+}
+
+func getEnvDuration(key string, fallback time.Duration) (time.Duration, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback, nil
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("%s debe ser una duración (ej. 30s, 5m): %w", key, err)
+	}
+	return parsed, nil
+}
@@ -0,0 +1,179 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLoad_Defaults(t *testing.T) {
+	t.Setenv("PORT", "")
+	t.Setenv("RATE_LIMIT_RPS", "")
+	t.Setenv("RATE_LIMIT_BURST", "")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if cfg.Port != "8089" {
+		t.Errorf("Expected default port 8089, got %s", cfg.Port)
+	}
+	if !cfg.RateLimit.Enabled || cfg.RateLimit.Rate != 5 || cfg.RateLimit.Burst != 10 {
+		t.Errorf("Unexpected rate limit defaults: %+v", cfg.RateLimit)
+	}
+	if cfg.JWTTTL != 24*time.Hour {
+		t.Errorf("Expected JWT TTL 24h, got %v", cfg.JWTTTL)
+	}
+	if cfg.RequestTimeout != 10*time.Second || cfg.MaxBodyBytes != 64<<10 {
+		t.Errorf("Unexpected request limits: timeout %v, body %d", cfg.RequestTimeout, cfg.MaxBodyBytes)
+	}
+	if cfg.TLS.Port != "443" || !cfg.TLS.HTTP2 || cfg.TLS.HTTP3 || cfg.TLS.CertFile != "" || len(cfg.TLS.AutocertHosts) != 0 {
+		t.Errorf("Unexpected TLS defaults: %+v", cfg.TLS)
+	}
+	if len(cfg.CORS.AllowedOrigins) != 0 || len(cfg.CORS.AllowedMethods) == 0 || cfg.CORS.MaxAge != 10*time.Minute {
+		t.Errorf("Unexpected CORS defaults: %+v", cfg.CORS)
+	}
+}
+
+func TestLoad_APIKeyMaps(t *testing.T) {
+	t.Setenv("API_KEY_ROLES", "Kx9=bot:admin")
+	t.Setenv("TENANT_API_KEYS", "Kx9=equipo-a")
+	t.Setenv("TENANT_HOSTS", "Go.Equipo-A.com=equipo-a")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// Las claves de API conservan las mayúsculas; los hosts se normalizan
+	if cfg.APIKeyRoles["Kx9"] != "bot:admin" || cfg.TenantAPIKeys["Kx9"] != "equipo-a" {
+		t.Errorf("Expected API keys to keep their case, got %v and %v", cfg.APIKeyRoles, cfg.TenantAPIKeys)
+	}
+	if cfg.TenantHosts["go.equipo-a.com"] != "equipo-a" {
+		t.Errorf("Expected lowercase hosts, got %v", cfg.TenantHosts)
+	}
+}
+
+func TestLoad_CaseInsensitiveCodes(t *testing.T) {
+	t.Setenv("CASE_INSENSITIVE_CODES", "true")
+	t.Setenv("CODE_ALPHABET", "")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if cfg.CodeAlphabet != "abcdefghijklmnopqrstuvwxyz0123456789" {
+		t.Errorf("Expected lowercase default alphabet, got %q", cfg.CodeAlphabet)
+	}
+
+	// Un alfabeto explícito con mayúsculas tendría códigos imposibles de distinguir
+	t.Setenv("CODE_ALPHABET", "abcABC123")
+	if _, err := Load(); err == nil {
+		t.Error("Expected error for uppercase alphabet with case-insensitive codes")
+	}
+}
+
+func TestLoad_InvalidValues(t *testing.T) {
+	tests := []struct {
+		name  string
+		key   string
+		value string
+	}{
+		{name: "Tasa no numérica", key: "RATE_LIMIT_RPS", value: "rápido"},
+		{name: "Tasa cero", key: "RATE_LIMIT_RPS", value: "0"},
+		{name: "Ráfaga cero", key: "RATE_LIMIT_BURST", value: "0"},
+		{name: "Duración inválida", key: "JWT_TTL", value: "un-día"},
+		{name: "Timeout negativo", key: "REQUEST_TIMEOUT", value: "-1s"},
+		{name: "Cuerpo máximo cero", key: "MAX_BODY_BYTES", value: "0"},
+		{name: "Sin reintentos de código", key: "CODE_MAX_RETRIES", value: "0"},
+		{name: "Demasiadas sugerencias de alias", key: "ALIAS_SUGGESTIONS", value: "11"},
+		{name: "Aviso de reintentos negativo", key: "CODE_RETRY_WARN_AFTER", value: "-1"},
+		{name: "Etapa de marca de tiempo antes que la de entropía", key: "CODE_RETRY_TIMESTAMP_AFTER", value: "2"},
+		{name: "Caché CORS negativa", key: "CORS_MAX_AGE", value: "-1m"},
+		{name: "Nivel de compresión fuera de rango", key: "COMPRESSION_LEVEL", value: "10"},
+		{name: "Idempotencia sin duración", key: "IDEMPOTENCY_TTL", value: "0s"},
+		{name: "Caché de redirecciones negativa", key: "REDIRECT_CACHE_MAX_AGE", value: "-1m"},
+		{name: "Caché de redirecciones permanentes negativa", key: "REDIRECT_PERMANENT_MAX_AGE", value: "-1h"},
+		{name: "Exclusión de bots no booleana", key: "EXCLUDE_BOTS", value: "quizás"},
+		{name: "Modo privado no booleano", key: "PRIVACY_MODE", value: "a veces"},
+		{name: "Códigos sin distinción de mayúsculas no booleano", key: "CASE_INSENSITIVE_CODES", value: "quizás"},
+		{name: "Alias Unicode no booleano", key: "UNICODE_ALIASES", value: "🔥"},
+		{name: "Aviso con espera negativa", key: "INTERSTITIAL_COUNTDOWN", value: "-5s"},
+		{name: "Respaldo relativo", key: "NOT_FOUND_REDIRECT", value: "/inicio"},
+		{name: "Contacto de seguridad sin esquema", key: "SECURITY_CONTACTS", value: "seguridad@example.com"},
+		{name: "Política de seguridad sin HTTPS", key: "SECURITY_POLICY", value: "http://example.com/politica"},
+		{name: "Dominio personalizado sin propietario", key: "CUSTOM_DOMAINS", value: "go.acme.com"},
+		{name: "Dominio personalizado con ruta", key: "CUSTOM_DOMAINS", value: "go.acme.com/x=user-1"},
+		{name: "Tenant con mayúsculas", key: "TENANT_API_KEYS", value: "clave-1=Equipo"},
+		{name: "Host de tenant sin dominio", key: "TENANT_HOSTS", value: "localhost=equipo-a"},
+		{name: "Cuota por tenant negativa", key: "MAX_LINKS_PER_TENANT", value: "-1"},
+		{name: "Clave de API con rol desconocido", key: "API_KEY_ROLES", value: "k1=bot:superuser"},
+		{name: "Editor sin espacio compartido", key: "API_KEY_ROLES", value: "k1=bot:editor"},
+		{name: "Cuota mensual negativa", key: "API_KEY_SHORTEN_QUOTA", value: "-1"},
+		{name: "Cuota por clave sin redirecciones", key: "API_KEY_QUOTAS", value: "k1=100"},
+		{name: "Formato de log desconocido", key: "ACCESS_LOG_FORMAT", value: "xml"},
+		{name: "Muestreo de log fuera de rango", key: "ACCESS_LOG_SAMPLE_PERCENT", value: "150"},
+		{name: "Proxy de confianza sin IP", key: "TRUSTED_PROXIES", value: "proxy.interno"},
+		{name: "Red permitida sin CIDR", key: "REDIRECT_IP_ALLOWLIST", value: "10.0.0.0/8,intranet"},
+		{name: "Red rechazada inválida", key: "REDIRECT_IP_DENYLIST", value: "10.0.0.0/33"},
+		{name: "Certificado TLS sin clave", key: "TLS_CERT_FILE", value: "cert.pem"},
+		{name: "Certificado automático con comodín", key: "TLS_AUTOCERT_HOSTS", value: "*.sho.rt"},
+		{name: "HTTP/2 inválido", key: "TLS_HTTP2", value: "quizás"},
+		{name: "HTTP/3 sin TLS", key: "TLS_HTTP3", value: "true"},
+		{name: "Directorio ACME sin https", key: "TLS_AUTOCERT_DIRECTORY", value: "http://acme.example/directory"},
+		{name: "Emisor OIDC sin cliente", key: "OIDC_ISSUER", value: "https://accounts.google.com"},
+		{name: "Usuario OIDC con rol desconocido", key: "OIDC_USERS", value: "ana@example.com=ana:root"},
+		{name: "Rol OIDC por defecto inválido", key: "OIDC_DEFAULT_ROLE", value: "admin"},
+		{name: "Umbral de cuarentena negativo", key: "REPORT_QUARANTINE_THRESHOLD", value: "-1"},
+		{name: "Proveedor de reputación desconocido", key: "THREAT_PROVIDER", value: "virustotal"},
+		{name: "Safe Browsing sin API key", key: "THREAT_PROVIDER", value: "safebrowsing"},
+		{name: "Revisión de amenazas negativa", key: "THREAT_RESCAN_INTERVAL", value: "-1h"},
+		{name: "Ventana de anomalías cero", key: "ANOMALY_WINDOW", value: "0s"},
+		{name: "Límite de visitas por IP negativo", key: "ANOMALY_SOURCE_CLICKS", value: "-5"},
+		{name: "Factor de pico no mayor que 1", key: "ANOMALY_SPIKE_FACTOR", value: "0.5"},
+		{name: "Alpha de la media fuera de rango", key: "ANOMALY_SPIKE_ALPHA", value: "1.5"},
+		{name: "Acción ante anomalías desconocida", key: "ANOMALY_ACTION", value: "bloquear"},
+		{name: "Resolución de destinos inválida", key: "RESOLVE_DESTINATIONS", value: "quizás"},
+		{name: "Modo de verificación desconocido", key: "REACHABILITY_CHECK", value: "siempre"},
+		{name: "Verificación sin timeout", key: "REACHABILITY_TIMEOUT", value: "0s"},
+		{name: "Capacidad del almacén negativa", key: "STORE_MAX_ENTRIES", value: "-1"},
+		{name: "Tamaño de caché negativo", key: "CACHE_SIZE", value: "-1"},
+		{name: "TTL negativo de caché negativa", key: "CACHE_NEGATIVE_TTL", value: "-1s"},
+		{name: "Invalidación sin caché", key: "CACHE_PUBSUB_URL", value: "redis://localhost:6379"},
+		{name: "Limitador en Redis sin redis://", key: "RATE_LIMIT_REDIS_URL", value: "localhost:6379"},
+		{name: "Clúster sin clave", key: "CLUSTER_PEERS", value: "http://10.0.0.2:8080"},
+		{name: "Métricas en vivo sin intervalo", key: "LIVE_ANALYTICS_INTERVAL", value: "0s"},
+		{name: "Ventana de métricas corta", key: "LIVE_ANALYTICS_WINDOW", value: "30s"},
+		{name: "Retención de informes corta", key: "ANALYTICS_RETENTION", value: "12h"},
+		{name: "Destino de eventos desconocido", key: "EVENT_SINK", value: "rabbitmq"},
+		{name: "Destino de eventos sin URL", key: "EVENT_SINK", value: "nats"},
+		{name: "Webhooks sin clave", key: "WEBHOOK_URLS", value: "https://hooks.example.com/"},
+		{name: "Webhook sin esquema http", key: "WEBHOOK_URLS", value: "ftp://hooks.example.com/"},
+		{name: "Intentos de webhook inválidos", key: "WEBHOOK_MAX_ATTEMPTS", value: "muchos"},
+		{name: "Aviso de expiración inválido", key: "WEBHOOK_EXPIRY_NOTICE_DAYS", value: "pronto"},
+		{name: "Copias en un destino desconocido", key: "BACKUP_URL", value: "ftp://copias.example.com/"},
+		{name: "Copias en S3 sin credenciales", key: "BACKUP_URL", value: "s3://copias/acortador"},
+		{name: "Retención de copias inválida", key: "BACKUP_RETENTION", value: "siempre"},
+		{name: "Búfer de escritura negativo", key: "WRITE_BUFFER_SIZE", value: "-1"},
+		{name: "Filtro de Bloom negativo", key: "BLOOM_FILTER_SIZE", value: "-1"},
+		{name: "Tasa de falsos positivos fuera de rango", key: "BLOOM_FILTER_FP_RATE", value: "1.5"},
+		{name: "Política de expulsión desconocida", key: "STORE_EVICTION_POLICY", value: "fifo"},
+		{name: "Compactación negativa", key: "STORE_COMPACTION_INTERVAL", value: "-1m"},
+		{name: "Umbral de compactación nulo", key: "STORE_COMPACTION_THRESHOLD", value: "0"},
+		{name: "Umbral de compactación mayor que 1", key: "STORE_COMPACTION_THRESHOLD", value: "1.5"},
+		{name: "Longitud de URL negativa", key: "MAX_URL_LENGTH", value: "-1"},
+		{name: "Cuota por cliente negativa", key: "MAX_LINKS_PER_CLIENT", value: "-5"},
+		{name: "Modo de metadatos desconocido", key: "METADATA_FETCH", value: "always"},
+		{name: "Metadatos sin bytes", key: "METADATA_MAX_BYTES", value: "0"},
+		{name: "Escaneo de enlaces negativo", key: "DEAD_LINK_SCAN_INTERVAL", value: "-1h"},
+		{name: "Enlace roto sin fallos", key: "DEAD_LINK_FAILURES", value: "0"},
+		{name: "GeoIP sin bloques", key: "GEOIP_LOCATIONS_FILE", value: "GeoLite2-Country-Locations-en.csv"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(tt.key, tt.value)
+			if _, err := Load(); err == nil {
+				t.Errorf("Expected error for %s=%s", tt.key, tt.value)
+			}
+		})
+	}
+}
@@ -0,0 +1,180 @@
+// Package errcode define los códigos de error estables de la API. El servicio los asocia a sus
+// errores predefinidos y los handlers los publican en el campo error de las respuestas, de modo
+// que los clientes pueden decidir con ellos sin depender del texto del mensaje, que cambia con
+// el idioma.
+package errcode
+
+import (
+	"errors"
+	"sort"
+)
+
+// Code es un código de error estable de la API. Un código publicado no se renombra ni se
+// reutiliza con otro significado.
+type Code string
+
+// Errores del servidor
+const (
+	Internal           Code = "internal_error"
+	Critical           Code = "critical_error"
+	Panic              Code = "panic_error"
+	GenerationFailed   Code = "generation_failed"
+	CodeSpaceSaturated Code = "code_space_saturated"
+	ServiceUnavailable Code = "service_unavailable"
+	Timeout            Code = "timeout"
+	RequestCanceled    Code = "request_canceled"
+	RequestTimeout     Code = "request_timeout"
+)
+
+// Errores de la petición
+const (
+	InvalidJSON           Code = "invalid_json"
+	InvalidBody           Code = "invalid_body"
+	InvalidForm           Code = "invalid_form"
+	InvalidContentType    Code = "invalid_content_type"
+	InvalidQuery          Code = "invalid_query"
+	InvalidFormat         Code = "invalid_format"
+	InvalidArgument       Code = "invalid_argument"
+	InvalidIdempotencyKey Code = "invalid_idempotency_key"
+	MethodNotAllowed      Code = "method_not_allowed"
+	PayloadTooLarge       Code = "payload_too_large"
+	MissingCode           Code = "missing_code"
+	MissingQuery          Code = "missing_query"
+	EmptyBatch            Code = "empty_batch"
+	BatchTooLarge         Code = "batch_too_large"
+	WebSocketRequired     Code = "websocket_required"
+	StreamingUnsupported  Code = "streaming_unsupported"
+	TooEarly              Code = "too_early"
+)
+
+// Errores de validación de enlaces
+const (
+	InvalidURL           Code = "invalid_url"
+	EmptyURL             Code = "empty_url"
+	URLTooLong           Code = "url_too_long"
+	InvalidAlias         Code = "invalid_alias"
+	AliasNotAllowed      Code = "alias_not_allowed"
+	AliasTaken           Code = "alias_taken"
+	MaliciousURL         Code = "malicious_url"
+	UnreachableURL       Code = "unreachable_url"
+	IdempotencyKeyReused Code = "idempotency_key_reused"
+	InvalidReport        Code = "invalid_report"
+)
+
+// Errores de los enlaces y de su gestión
+const (
+	NotFound            Code = "not_found"
+	Expired             Code = "expired"
+	Disabled            Code = "disabled"
+	PasswordProtected   Code = "password_protected"
+	PasswordRequired    Code = "password_required"
+	InvalidPassword     Code = "invalid_password"
+	PasswordLocked      Code = "password_locked"
+	ReferrerNotAllowed  Code = "referrer_not_allowed"
+	IPNotAllowed        Code = "ip_not_allowed"
+	SignatureRequired   Code = "signature_required"
+	InvalidSignature    Code = "invalid_signature"
+	SignatureExpired    Code = "signature_expired"
+	Forbidden           Code = "forbidden"
+	MetadataDisabled    Code = "metadata_disabled"
+	MetadataUnavailable Code = "metadata_unavailable"
+	InvalidCollection   Code = "invalid_collection"
+	CollectionNotFound  Code = "collection_not_found"
+	CollectionExists    Code = "collection_exists"
+)
+
+// Errores de cuotas y límites
+const (
+	QuotaExceeded       Code = "quota_exceeded"
+	TenantQuotaExceeded Code = "tenant_quota_exceeded"
+	UsageQuotaExceeded  Code = "usage_quota_exceeded"
+	StoreFull           Code = "store_full"
+	RateLimited         Code = "rate_limited"
+	LinkThrottled       Code = "link_throttled"
+)
+
+// Errores de autenticación
+const (
+	Unauthorized          Code = "unauthorized"
+	InvalidToken          Code = "invalid_token"
+	ExpiredToken          Code = "expired_token"
+	InvalidKeyID          Code = "invalid_key_id"
+	InvalidState          Code = "invalid_state"
+	AccessDenied          Code = "access_denied"
+	IdentityProviderError Code = "identity_provider_error"
+	UnknownIdentity       Code = "unknown_identity"
+)
+
+// Errores de administración
+const (
+	InvalidDomain         Code = "invalid_domain"
+	DomainTaken           Code = "domain_taken"
+	DomainNotFound        Code = "domain_not_found"
+	DomainPolicyInvalid   Code = "domain_policy_invalid"
+	TenantNotFound        Code = "tenant_not_found"
+	InvalidCSV            Code = "invalid_csv"
+	InvalidRow            Code = "invalid_row"
+	InvalidExpiry         Code = "invalid_expiry"
+	WebhooksDisabled      Code = "webhooks_disabled"
+	EventStreamDisabled   Code = "event_stream_disabled"
+	LiveAnalyticsDisabled Code = "live_analytics_disabled"
+	ReportsDisabled       Code = "reports_disabled"
+	BackupsDisabled       Code = "backups_disabled"
+	SigningDisabled       Code = "signing_disabled"
+	SnapshotNotFound      Code = "snapshot_not_found"
+	InvalidSnapshot       Code = "invalid_snapshot"
+	InvalidConfirmation   Code = "invalid_confirmation"
+	CompactionUnsupported Code = "compaction_unsupported"
+)
+
+// registry son todos los códigos publicados; lo recorren la especificación OpenAPI y el
+// catálogo de mensajes
+var registry = []Code{
+	Internal, Critical, Panic, GenerationFailed, CodeSpaceSaturated, ServiceUnavailable, Timeout, RequestCanceled, RequestTimeout,
+	InvalidJSON, InvalidBody, InvalidForm, InvalidContentType, InvalidQuery, InvalidFormat, InvalidArgument,
+	InvalidIdempotencyKey, MethodNotAllowed, PayloadTooLarge, MissingCode, MissingQuery, EmptyBatch,
+	BatchTooLarge, WebSocketRequired, StreamingUnsupported, TooEarly,
+	InvalidURL, EmptyURL, URLTooLong, InvalidAlias, AliasNotAllowed, AliasTaken, MaliciousURL, UnreachableURL,
+	IdempotencyKeyReused, InvalidReport,
+	NotFound, Expired, Disabled, PasswordProtected, PasswordRequired, InvalidPassword, PasswordLocked, ReferrerNotAllowed, IPNotAllowed,
+	SignatureRequired, InvalidSignature, SignatureExpired, Forbidden, MetadataDisabled, MetadataUnavailable,
+	InvalidCollection, CollectionNotFound, CollectionExists,
+	QuotaExceeded, TenantQuotaExceeded, UsageQuotaExceeded, StoreFull, RateLimited, LinkThrottled,
+	Unauthorized, InvalidToken, ExpiredToken, InvalidKeyID, InvalidState, AccessDenied, IdentityProviderError,
+	UnknownIdentity,
+	InvalidDomain, DomainTaken, DomainNotFound, DomainPolicyInvalid, TenantNotFound, InvalidCSV, InvalidRow,
+	InvalidExpiry, WebhooksDisabled, EventStreamDisabled, LiveAnalyticsDisabled, ReportsDisabled, BackupsDisabled,
+	SigningDisabled, SnapshotNotFound, InvalidSnapshot, InvalidConfirmation, CompactionUnsupported,
+}
+
+// All retorna todos los códigos publicados en orden alfabético
+func All() []Code {
+	codes := append([]Code(nil), registry...)
+	sort.Slice(codes, func(i, j int) bool { return codes[i] < codes[j] })
+	return codes
+}
+
+// Error es un error predefinido con su código de la API. Se compara con errors.Is como
+// cualquier error de errors.New.
+type Error struct {
+	Code Code
+	msg  string
+}
+
+// New crea un error predefinido con el código indicado
+func New(code Code, msg string) *Error {
+	return &Error{Code: code, msg: msg}
+}
+
+func (e *Error) Error() string {
+	return e.msg
+}
+
+// Of retorna el código del primer *Error de la cadena de err, o Internal si no tiene ninguno
+func Of(err error) Code {
+	var coded *Error
+	if errors.As(err, &coded) {
+		return coded.Code
+	}
+	return Internal
+}
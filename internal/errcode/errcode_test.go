@@ -0,0 +1,58 @@
+package errcode
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestOf(t *testing.T) {
+	errNotFound := New(NotFound, "no encontrado")
+
+	tests := []struct {
+		name     string
+		err      error
+		expected Code
+	}{
+		{"Error predefinido", errNotFound, NotFound},
+		{"Error envuelto", fmt.Errorf("buscando abc: %w", errNotFound), NotFound},
+		{"Errores combinados", errors.Join(errors.New("otro"), New(AliasTaken, "en uso")), AliasTaken},
+		{"Error sin código", errors.New("fallo"), Internal},
+		{"Sin error", nil, Internal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Of(tt.err); got != tt.expected {
+				t.Errorf("Expected code %s, got %s", tt.expected, got)
+			}
+		})
+	}
+
+	if !errors.Is(fmt.Errorf("%w en la operación", errNotFound), errNotFound) {
+		t.Errorf("Expected wrapped error to match its sentinel")
+	}
+	if errNotFound.Error() != "no encontrado" {
+		t.Errorf("Expected message to be kept, got %q", errNotFound.Error())
+	}
+}
+
+func TestAll(t *testing.T) {
+	codes := All()
+	if len(codes) != len(registry) {
+		t.Fatalf("Expected %d codes, got %d", len(registry), len(codes))
+	}
+	for i, code := range codes {
+		if code == "" {
+			t.Errorf("Unexpected empty code at %d", i)
+		}
+		if i > 0 && codes[i-1] >= code {
+			t.Errorf("Expected sorted unique codes, got %s before %s", codes[i-1], code)
+		}
+	}
+
+	// All retorna una copia: modificarla no altera el registro
+	codes[0] = "modificado"
+	if All()[0] == "modificado" {
+		t.Errorf("Expected All to return a copy")
+	}
+}
@@ -0,0 +1,232 @@
+package eventsink
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"acortador-urls/internal/shortener"
+)
+
+// memorySink guarda los lotes recibidos y falla los primeros failures envíos
+type memorySink struct {
+	mu       sync.Mutex
+	batches  [][]Record
+	failures int
+	closed   bool
+}
+
+func (s *memorySink) Publish(ctx context.Context, records []Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failures > 0 {
+		s.failures--
+		return errors.New("destino caído")
+	}
+	s.batches = append(s.batches, append([]Record(nil), records...))
+	return nil
+}
+
+func (s *memorySink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	return nil
+}
+
+func clicked(code string) shortener.Event {
+	return shortener.Event{Type: shortener.EventClicked, Time: time.Now(), Link: shortener.Link{ShortCode: code, LongURL: "https://www.example.com/"}, Visitor: "v1"}
+}
+
+func TestForwarder(t *testing.T) {
+	tests := []struct {
+		name            string
+		failures        int
+		events          int
+		expectedBatches []int
+		expectedDropped uint64
+	}{
+		{name: "Lotes completos y resto al detener", events: 5, expectedBatches: []int{2, 2, 1}},
+		{name: "Reintento tras un fallo", failures: 1, events: 2, expectedBatches: []int{2}},
+		{name: "Intentos agotados", failures: 10, events: 2, expectedDropped: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink := &memorySink{failures: tt.failures}
+			forwarder := NewForwarder(sink, WithBatchSize(2), WithFlushInterval(time.Hour), WithMaxAttempts(2))
+			forwarder.backoff = time.Millisecond
+			for i := 0; i < tt.events; i++ {
+				forwarder.HandleEvent(clicked(fmt.Sprintf("code%d", i)))
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan struct{})
+			go func() {
+				forwarder.Run(ctx)
+				close(done)
+			}()
+			// Esperar a que se consuma la cola antes de detener el reenvío
+			for len(forwarder.queue) > 0 {
+				time.Sleep(time.Millisecond)
+			}
+			cancel()
+			<-done
+
+			sink.mu.Lock()
+			defer sink.mu.Unlock()
+			if len(sink.batches) != len(tt.expectedBatches) {
+				t.Fatalf("Expected %d batches, got %d", len(tt.expectedBatches), len(sink.batches))
+			}
+			for i, size := range tt.expectedBatches {
+				if len(sink.batches[i]) != size {
+					t.Errorf("Expected batch %d with %d records, got %d", i, size, len(sink.batches[i]))
+				}
+			}
+			if stats := forwarder.Stats(); stats.Dropped != tt.expectedDropped {
+				t.Errorf("Expected %d dropped, got %+v", tt.expectedDropped, stats)
+			}
+			if !sink.closed {
+				t.Errorf("Expected sink to be closed")
+			}
+		})
+	}
+}
+
+// fakeNATS es un servidor NATS mínimo que guarda los subjects y mensajes publicados
+func fakeNATS(t *testing.T, reject string) (string, chan string) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unexpected listen error: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	published := make(chan string, 10)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		io.WriteString(conn, "INFO {\"server_id\":\"prueba\"}\r\n")
+		reader := bufio.NewReader(conn)
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			fields := strings.Fields(line)
+			switch {
+			case len(fields) == 0:
+			case fields[0] == "CONNECT":
+				if !strings.Contains(line, `"user":"app"`) || !strings.Contains(line, `"pass":"clave"`) {
+					io.WriteString(conn, "-ERR 'Authorization Violation'\r\n")
+					return
+				}
+			case fields[0] == "PING":
+				io.WriteString(conn, "PONG\r\n")
+			case fields[0] == "PUB" && len(fields) == 3:
+				n, _ := strconv.Atoi(fields[2])
+				payload := make([]byte, n+2)
+				io.ReadFull(reader, payload)
+				if fields[1] == reject {
+					io.WriteString(conn, "-ERR 'Permissions Violation for Publish'\r\n")
+					continue
+				}
+				published <- fields[1] + " " + string(payload[:n])
+			}
+		}
+	}()
+	return listener.Addr().String(), published
+}
+
+func TestNATSSink(t *testing.T) {
+	ctx := context.Background()
+	addr, published := fakeNATS(t, "")
+	sink, err := NewNATSSink("nats://app:clave@"+addr, "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer sink.Close()
+
+	if err := sink.Publish(ctx, []Record{NewRecord(clicked("abc123"))}); err != nil {
+		t.Fatalf("Unexpected publish error: %v", err)
+	}
+	subject, payload, _ := strings.Cut(<-published, " ")
+	if subject != "acortador.eventos.link.clicked" {
+		t.Errorf("Expected subject acortador.eventos.link.clicked, got %s", subject)
+	}
+	var record Record
+	if err := json.Unmarshal([]byte(payload), &record); err != nil || record.ShortCode != "abc123" || record.Visitor != "v1" {
+		t.Errorf("Unexpected payload %s (%v)", payload, err)
+	}
+
+	// Un -ERR del servidor hace fallar el lote
+	addr, _ = fakeNATS(t, "acortador.eventos.link.clicked")
+	rejecting, _ := NewNATSSink("nats://app:clave@"+addr, "")
+	defer rejecting.Close()
+	if err := rejecting.Publish(ctx, []Record{NewRecord(clicked("abc123"))}); err == nil || !strings.Contains(err.Error(), "Permissions Violation") {
+		t.Errorf("Expected permissions error, got %v", err)
+	}
+
+	if _, err := NewNATSSink("http://localhost:4222", ""); err == nil {
+		t.Errorf("Expected error for non-nats URL")
+	}
+}
+
+func TestKafkaSink(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		response    string
+		expectError bool
+	}{
+		{name: "Registros aceptados", status: http.StatusOK, response: `{"offsets":[{"partition":0,"offset":1,"error_code":null,"error":null}]}`},
+		{name: "Registro rechazado", status: http.StatusOK, response: `{"offsets":[{"partition":null,"offset":null,"error_code":40403,"error":"Topic not found"}]}`, expectError: true},
+		{name: "Error del proxy", status: http.StatusInternalServerError, response: `{"error_code":50001}`, expectError: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/topics/acortador.eventos" || r.Header.Get("Content-Type") != kafkaContentType {
+					t.Errorf("Unexpected request %s %s", r.URL.Path, r.Header.Get("Content-Type"))
+				}
+				if user, pass, ok := r.BasicAuth(); !ok || user != "app" || pass != "clave" {
+					t.Errorf("Expected basic auth credentials")
+				}
+				var body struct {
+					Records []struct {
+						Key   string `json:"key"`
+						Value Record `json:"value"`
+					} `json:"records"`
+				}
+				json.NewDecoder(r.Body).Decode(&body)
+				if len(body.Records) != 1 || body.Records[0].Key != "abc123" || body.Records[0].Value.Type != shortener.EventClicked {
+					t.Errorf("Unexpected records %+v", body.Records)
+				}
+				w.WriteHeader(tt.status)
+				io.WriteString(w, tt.response)
+			}))
+			defer server.Close()
+
+			sink, err := NewKafkaSink(strings.Replace(server.URL, "http://", "http://app:clave@", 1), "")
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			err = sink.Publish(context.Background(), []Record{NewRecord(clicked("abc123"))})
+			if (err != nil) != tt.expectError {
+				t.Errorf("Expected error %v, got %v", tt.expectError, err)
+			}
+		})
+	}
+}
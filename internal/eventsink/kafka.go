@@ -0,0 +1,116 @@
+package eventsink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// kafkaTimeout acota cada petición al REST Proxy
+const kafkaTimeout = 10 * time.Second
+
+// kafkaContentType es el formato de la API v2 del REST Proxy con valores JSON
+const kafkaContentType = "application/vnd.kafka.json.v2+json"
+
+// KafkaSink produce los eventos en un topic de Kafka a través de la API v2 de Kafka REST Proxy
+// (POST /topics/{topic}), con el código corto como clave para que los eventos de un enlace
+// caigan en la misma partición. Usar el proxy evita depender de un cliente del protocolo binario.
+type KafkaSink struct {
+	endpoint string
+	username string
+	password string
+	client   *http.Client
+}
+
+// Verificación en compilación de que KafkaSink implementa Sink
+var _ Sink = (*KafkaSink)(nil)
+
+// NewKafkaSink crea un sink sobre el REST Proxy de rawURL
+// (http(s)://[usuario:contraseña@]host:puerto) que produce en topic, o DefaultTopic si está vacío
+func NewKafkaSink(rawURL, topic string) (*KafkaSink, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("URL de Kafka REST Proxy inválida: %q", rawURL)
+	}
+	if topic == "" {
+		topic = DefaultTopic
+	}
+	sink := &KafkaSink{client: &http.Client{Timeout: kafkaTimeout}}
+	if u.User != nil {
+		sink.username = u.User.Username()
+		sink.password, _ = u.User.Password()
+		u.User = nil
+	}
+	sink.endpoint = strings.TrimSuffix(u.String(), "/") + "/topics/" + url.PathEscape(topic)
+	return sink, nil
+}
+
+// kafkaRecord es un registro de la petición de producción
+type kafkaRecord struct {
+	Key   string          `json:"key"`
+	Value json.RawMessage `json:"value"`
+}
+
+// kafkaOffset es el resultado de cada registro en la respuesta
+type kafkaOffset struct {
+	ErrorCode *int   `json:"error_code"`
+	Error     string `json:"error"`
+}
+
+// Publish implementa Sink. Falla si el proxy rechaza la petición o cualquiera de los registros.
+func (s *KafkaSink) Publish(ctx context.Context, records []Record) error {
+	request := struct {
+		Records []kafkaRecord `json:"records"`
+	}{Records: make([]kafkaRecord, len(records))}
+	for i, record := range records {
+		request.Records[i] = kafkaRecord{Key: record.Key(), Value: marshalRecord(record)}
+	}
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", kafkaContentType)
+	req.Header.Set("Accept", "application/vnd.kafka.v2+json")
+	if s.username != "" {
+		req.SetBasicAuth(s.username, s.password)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("kafka REST Proxy respondió %d: %s", resp.StatusCode, strings.TrimSpace(string(message)))
+	}
+
+	var response struct {
+		Offsets []kafkaOffset `json:"offsets"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return fmt.Errorf("respuesta de Kafka REST Proxy inválida: %w", err)
+	}
+	for _, offset := range response.Offsets {
+		if offset.ErrorCode != nil {
+			return fmt.Errorf("kafka rechazó un registro (%d): %s", *offset.ErrorCode, offset.Error)
+		}
+	}
+	return nil
+}
+
+// Close implementa Sink
+func (s *KafkaSink) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
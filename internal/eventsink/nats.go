@@ -0,0 +1,189 @@
+package eventsink
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// natsTimeout acota la conexión y cada envío a NATS si ctx no tiene un plazo menor
+const natsTimeout = 5 * time.Second
+
+// NATSSink publica cada evento en el subject <subject>.<tipo> (p. ej.
+// acortador.eventos.link.clicked), de modo que los consumidores pueden suscribirse a un tipo o,
+// con comodines, a todos. Habla el protocolo de texto de NATS directamente para no depender de
+// un cliente: solo necesita CONNECT, PUB y PING.
+type NATSSink struct {
+	addr     string
+	user     string
+	password string
+	token    string
+	subject  string
+
+	// mu protege la conexión, que se reabre tras un error
+	mu   sync.Mutex
+	conn *natsConn
+}
+
+// Verificación en compilación de que NATSSink implementa Sink
+var _ Sink = (*NATSSink)(nil)
+
+// NewNATSSink crea un sink sobre el servidor de rawURL (nats://[usuario:contraseña@]host:puerto
+// o nats://token@host:puerto) que publica bajo subject, o DefaultTopic si está vacío. No se
+// conecta hasta el primer envío.
+func NewNATSSink(rawURL, subject string) (*NATSSink, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme != "nats" || u.Host == "" {
+		return nil, fmt.Errorf("URL de NATS inválida: %q", rawURL)
+	}
+	if subject == "" {
+		subject = DefaultTopic
+	}
+	if strings.ContainsAny(subject, " \t\r\n*>") {
+		return nil, fmt.Errorf("subject de NATS inválido: %q", subject)
+	}
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), "4222")
+	}
+	sink := &NATSSink{addr: addr, subject: subject}
+	if u.User != nil {
+		if password, ok := u.User.Password(); ok {
+			sink.user, sink.password = u.User.Username(), password
+		} else {
+			sink.token = u.User.Username()
+		}
+	}
+	return sink, nil
+}
+
+// Publish implementa Sink. El lote se confirma con un PING: si el servidor responde PONG sin
+// un -ERR antes, recibió todos los mensajes.
+func (s *NATSSink) Publish(ctx context.Context, records []Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		conn, err := s.dial(ctx)
+		if err != nil {
+			return err
+		}
+		s.conn = conn
+	}
+	if err := s.conn.publish(ctx, s.subject, records); err != nil {
+		s.conn.Close()
+		s.conn = nil
+		return err
+	}
+	return nil
+}
+
+// Close implementa Sink
+func (s *NATSSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+// dial abre una conexión y se identifica
+func (s *NATSSink) dial(ctx context.Context) (*natsConn, error) {
+	dialer := net.Dialer{Timeout: natsTimeout}
+	netConn, err := dialer.DialContext(ctx, "tcp", s.addr)
+	if err != nil {
+		return nil, err
+	}
+	conn := &natsConn{Conn: netConn, reader: bufio.NewReader(netConn), writer: bufio.NewWriter(netConn)}
+	conn.SetDeadline(natsDeadline(ctx))
+	defer conn.SetDeadline(time.Time{})
+
+	// El servidor saluda con INFO
+	line, err := conn.reader.ReadString('\n')
+	if err != nil || !strings.HasPrefix(line, "INFO ") {
+		conn.Close()
+		return nil, fmt.Errorf("saludo de NATS inesperado: %q", strings.TrimSpace(line))
+	}
+	options, _ := json.Marshal(natsConnect{Name: "acortador-urls", Lang: "go", User: s.user, Pass: s.password, AuthToken: s.token})
+	fmt.Fprintf(conn.writer, "CONNECT %s\r\n", options)
+	if err := conn.ping(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// natsDeadline es el plazo de ctx o, si es posterior o no tiene, natsTimeout desde ahora
+func natsDeadline(ctx context.Context) time.Time {
+	deadline := time.Now().Add(natsTimeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		return ctxDeadline
+	}
+	return deadline
+}
+
+// natsConnect son las opciones del comando CONNECT
+type natsConnect struct {
+	Verbose   bool   `json:"verbose"`
+	Pedantic  bool   `json:"pedantic"`
+	Name      string `json:"name"`
+	Lang      string `json:"lang"`
+	User      string `json:"user,omitempty"`
+	Pass      string `json:"pass,omitempty"`
+	AuthToken string `json:"auth_token,omitempty"`
+}
+
+// natsConn es una conexión con el servidor NATS
+type natsConn struct {
+	net.Conn
+	reader *bufio.Reader
+	writer *bufio.Writer
+}
+
+// publish envía los eventos y espera la confirmación del servidor respetando el deadline de ctx
+func (c *natsConn) publish(ctx context.Context, subject string, records []Record) error {
+	c.SetDeadline(natsDeadline(ctx))
+	defer c.SetDeadline(time.Time{})
+
+	for _, record := range records {
+		data := marshalRecord(record)
+		fmt.Fprintf(c.writer, "PUB %s.%s %d\r\n", subject, record.Type, len(data))
+		c.writer.Write(data)
+		c.writer.WriteString("\r\n")
+	}
+	return c.ping()
+}
+
+// ping envía PING y lee hasta el PONG, respondiendo a los PING del servidor y fallando con su
+// primer -ERR
+func (c *natsConn) ping() error {
+	c.writer.WriteString("PING\r\n")
+	if err := c.writer.Flush(); err != nil {
+		return err
+	}
+	for {
+		line, err := c.reader.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		switch line = strings.TrimSpace(line); {
+		case line == "PONG":
+			return nil
+		case line == "PING":
+			c.writer.WriteString("PONG\r\n")
+			c.writer.Flush()
+		case strings.HasPrefix(line, "-ERR"):
+			return errors.New("nats: " + strings.Trim(strings.TrimSpace(strings.TrimPrefix(line, "-ERR")), "'"))
+		}
+		// +OK e INFO se ignoran
+	}
+}
@@ -0,0 +1,237 @@
+// Package eventsink envía los eventos de los enlaces (creaciones, visitas, expiraciones y
+// desactivaciones) a un sistema externo, como Kafka o NATS, para que los consuman pipelines de
+// análisis o detección de fraude. Los eventos se agrupan en lotes y se envían en segundo plano.
+package eventsink
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"sync/atomic"
+	"time"
+
+	"acortador-urls/internal/shortener"
+)
+
+// Valores por defecto del reenvío
+const (
+	DefaultTopic         = "acortador.eventos"
+	DefaultBatchSize     = 100
+	DefaultFlushInterval = time.Second
+	DefaultMaxAttempts   = 3
+)
+
+// drainTimeout acota el envío de los eventos pendientes al detener el reenvío
+const drainTimeout = 5 * time.Second
+
+// queueSize es el máximo de eventos pendientes de enviar; si se llena se descartan
+const queueSize = 10000
+
+// Record es un evento tal como se envía al sistema externo
+type Record struct {
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	Time      time.Time `json:"time"`
+	ShortCode string    `json:"short_code"`
+	LongURL   string    `json:"long_url"`
+	Owner     string    `json:"owner,omitempty"`
+	Clicks    int64     `json:"clicks"`
+	Variant   string    `json:"variant,omitempty"`
+	Visitor   string    `json:"visitor,omitempty"`
+	Bot       bool      `json:"bot,omitempty"`
+	Referrer  string    `json:"referrer,omitempty"`
+	Country   string    `json:"country,omitempty"`
+}
+
+// Key es la clave de partición del evento: los eventos de un mismo enlace van en orden
+func (r Record) Key() string {
+	return r.ShortCode
+}
+
+// NewRecord convierte un evento del servicio
+func NewRecord(event shortener.Event) Record {
+	id := make([]byte, 16)
+	rand.Read(id)
+	return Record{
+		ID:        hex.EncodeToString(id),
+		Type:      event.Type,
+		Time:      event.Time.UTC(),
+		ShortCode: event.Link.ShortCode,
+		LongURL:   event.Link.LongURL,
+		Owner:     event.Link.Owner,
+		Clicks:    event.Link.Clicks,
+		Variant:   event.Variant,
+		Visitor:   event.Visitor,
+		Bot:       event.Bot,
+		Referrer:  event.Referrer,
+		Country:   event.Country,
+	}
+}
+
+// Sink es un destino de eventos. Publish envía un lote completo o retorna error; un lote
+// reintentado puede llegar duplicado, así que los consumidores deben deduplicar por ID.
+type Sink interface {
+	Publish(ctx context.Context, records []Record) error
+	Close() error
+}
+
+// marshalRecord serializa un evento; Record siempre es serializable
+func marshalRecord(record Record) []byte {
+	data, _ := json.Marshal(record)
+	return data
+}
+
+// Stats resume la actividad del reenvío
+type Stats struct {
+	// Sent es el número de eventos enviados
+	Sent uint64
+	// Dropped es el número de eventos descartados por la cola llena o por agotar los intentos
+	Dropped uint64
+	// Errors es el número de envíos fallidos, incluidos los reintentados
+	Errors uint64
+}
+
+// Option configura el reenvío
+type Option func(*Forwarder)
+
+// WithBatchSize cambia el máximo de eventos de cada lote
+func WithBatchSize(size int) Option {
+	return func(f *Forwarder) {
+		if size > 0 {
+			f.batchSize = size
+		}
+	}
+}
+
+// WithFlushInterval cambia el tiempo máximo que un evento espera a completar su lote
+func WithFlushInterval(interval time.Duration) Option {
+	return func(f *Forwarder) {
+		if interval > 0 {
+			f.flushInterval = interval
+		}
+	}
+}
+
+// WithMaxAttempts cambia los intentos de cada lote antes de descartarlo
+func WithMaxAttempts(attempts int) Option {
+	return func(f *Forwarder) {
+		if attempts > 0 {
+			f.maxAttempts = attempts
+		}
+	}
+}
+
+// Forwarder recibe los eventos del servicio y los envía por lotes al Sink. Implementa
+// shortener.EventListener.
+type Forwarder struct {
+	sink          Sink
+	batchSize     int
+	flushInterval time.Duration
+	maxAttempts   int
+	backoff       time.Duration
+
+	queue chan Record
+
+	sent    atomic.Uint64
+	dropped atomic.Uint64
+	errors  atomic.Uint64
+}
+
+// Verificación en compilación de que Forwarder implementa EventListener
+var _ shortener.EventListener = (*Forwarder)(nil)
+
+// NewForwarder crea un reenvío hacia sink; el envío empieza con Run
+func NewForwarder(sink Sink, opts ...Option) *Forwarder {
+	f := &Forwarder{
+		sink:          sink,
+		batchSize:     DefaultBatchSize,
+		flushInterval: DefaultFlushInterval,
+		maxAttempts:   DefaultMaxAttempts,
+		backoff:       500 * time.Millisecond,
+		queue:         make(chan Record, queueSize),
+	}
+	for _, opt := range opts {
+		opt(f)
+	}
+	return f
+}
+
+// HandleEvent encola el evento
+func (f *Forwarder) HandleEvent(event shortener.Event) {
+	select {
+	case f.queue <- NewRecord(event):
+	default:
+		f.dropped.Add(1)
+	}
+}
+
+// Stats retorna la actividad del reenvío
+func (f *Forwarder) Stats() Stats {
+	return Stats{Sent: f.sent.Load(), Dropped: f.dropped.Load(), Errors: f.errors.Load()}
+}
+
+// Run envía los eventos encolados hasta que se cancela ctx; entonces envía lo que quede en la
+// cola, cierra el Sink y retorna
+func (f *Forwarder) Run(ctx context.Context) {
+	defer f.sink.Close()
+	ticker := time.NewTicker(f.flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]Record, 0, f.batchSize)
+	for {
+		select {
+		case <-ctx.Done():
+			drainCtx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+			defer cancel()
+		drain:
+			for {
+				select {
+				case record := <-f.queue:
+					if batch = append(batch, record); len(batch) >= f.batchSize {
+						f.send(drainCtx, batch)
+						batch = batch[:0]
+					}
+				default:
+					break drain
+				}
+			}
+			f.send(drainCtx, batch)
+			return
+		case record := <-f.queue:
+			if batch = append(batch, record); len(batch) >= f.batchSize {
+				f.send(ctx, batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			f.send(ctx, batch)
+			batch = batch[:0]
+		}
+	}
+}
+
+// send publica el lote reintentando con espera exponencial; si se agotan los intentos el lote
+// se descarta
+func (f *Forwarder) send(ctx context.Context, batch []Record) {
+	if len(batch) == 0 {
+		return
+	}
+	wait := f.backoff
+	for attempt := 1; ; attempt++ {
+		err := f.sink.Publish(ctx, batch)
+		if err == nil {
+			f.sent.Add(uint64(len(batch)))
+			return
+		}
+		f.errors.Add(1)
+		if attempt >= f.maxAttempts || ctx.Err() != nil {
+			f.dropped.Add(uint64(len(batch)))
+			return
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(wait):
+		}
+		wait *= 2
+	}
+}
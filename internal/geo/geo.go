@@ -0,0 +1,141 @@
+// Package geo resuelve el país de un visitante a partir de su IP para las redirecciones
+// geolocalizadas. Resolver es el punto de extensión; el paquete incluye una tabla de rangos
+// que se carga desde las bases CSV GeoLite2 Country de MaxMind.
+package geo
+
+import (
+	"context"
+	"net/netip"
+	"sort"
+	"strings"
+)
+
+// Resolver obtiene el código de país ISO 3166-1 alfa-2 (en mayúsculas) de una IP. Retorna
+// vacío si el país es desconocido.
+type Resolver interface {
+	Country(ctx context.Context, ip netip.Addr) (string, error)
+}
+
+// ResolverFunc adapta una función al interfaz Resolver
+type ResolverFunc func(ctx context.Context, ip netip.Addr) (string, error)
+
+// Country implementa Resolver
+func (f ResolverFunc) Country(ctx context.Context, ip netip.Addr) (string, error) {
+	return f(ctx, ip)
+}
+
+// EU son los países miembros de la Unión Europea; el código de región "EU" los abarca
+var EU = []string{
+	"AT", "BE", "BG", "CY", "CZ", "DE", "DK", "EE", "ES", "FI", "FR", "GR", "HR", "HU",
+	"IE", "IT", "LT", "LU", "LV", "MT", "NL", "PL", "PT", "RO", "SE", "SI", "SK",
+}
+
+// Regions agrupa países bajo códigos de región utilizables como destino
+var Regions = map[string][]string{
+	"EU": EU,
+}
+
+// InRegion indica si el país pertenece a la región indicada
+func InRegion(country, region string) bool {
+	for _, member := range Regions[region] {
+		if member == country {
+			return true
+		}
+	}
+	return false
+}
+
+// NormalizeCountry valida y pasa a mayúsculas un código de país o de región. ok es false si
+// no tiene dos letras ni es una región conocida.
+func NormalizeCountry(code string) (normalized string, ok bool) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if _, region := Regions[code]; region {
+		return code, true
+	}
+	if len(code) != 2 || code[0] < 'A' || code[0] > 'Z' || code[1] < 'A' || code[1] > 'Z' {
+		return "", false
+	}
+	return code, true
+}
+
+// ipRange es un rango contiguo de direcciones asignado a un país
+type ipRange struct {
+	first, last netip.Addr
+	country     string
+}
+
+// RangeResolver resuelve países buscando la IP en una tabla ordenada de rangos. Es de solo
+// lectura tras construirse, por lo que puede usarse concurrentemente.
+type RangeResolver struct {
+	ranges []ipRange
+}
+
+// NewRangeResolver construye la tabla a partir de prefijos CIDR y su país
+func NewRangeResolver(prefixes map[netip.Prefix]string) *RangeResolver {
+	r := &RangeResolver{ranges: make([]ipRange, 0, len(prefixes))}
+	for prefix, country := range prefixes {
+		r.add(prefix, country)
+	}
+	r.sort()
+	return r
+}
+
+// add agrega un prefijo a la tabla sin ordenarla
+func (r *RangeResolver) add(prefix netip.Prefix, country string) {
+	prefix = prefix.Masked()
+	r.ranges = append(r.ranges, ipRange{first: prefix.Addr(), last: lastAddr(prefix), country: country})
+}
+
+// sort ordena la tabla por inicio de rango para la búsqueda binaria
+func (r *RangeResolver) sort() {
+	sort.Slice(r.ranges, func(i, j int) bool {
+		return r.ranges[i].first.Less(r.ranges[j].first)
+	})
+}
+
+// Len retorna el número de rangos cargados
+func (r *RangeResolver) Len() int {
+	return len(r.ranges)
+}
+
+// Country implementa Resolver con una búsqueda binaria del último rango que empieza antes de ip
+func (r *RangeResolver) Country(ctx context.Context, ip netip.Addr) (string, error) {
+	ip = ip.Unmap()
+	i := sort.Search(len(r.ranges), func(i int) bool {
+		return ip.Less(r.ranges[i].first)
+	})
+	if i == 0 {
+		return "", nil
+	}
+	candidate := r.ranges[i-1]
+	if candidate.first.BitLen() != ip.BitLen() || candidate.last.Less(ip) {
+		return "", nil
+	}
+	return candidate.country, nil
+}
+
+// lastAddr calcula la última dirección de un prefijo
+func lastAddr(prefix netip.Prefix) netip.Addr {
+	bytes := prefix.Addr().AsSlice()
+	for bit := prefix.Bits(); bit < len(bytes)*8; bit++ {
+		bytes[bit/8] |= 0x80 >> (bit % 8)
+	}
+	addr, _ := netip.AddrFromSlice(bytes)
+	return addr
+}
+
+// Chain consulta los resolvers en orden y retorna el primer país conocido
+func Chain(resolvers ...Resolver) Resolver {
+	return ResolverFunc(func(ctx context.Context, ip netip.Addr) (string, error) {
+		for _, resolver := range resolvers {
+			country, err := resolver.Country(ctx, ip)
+			if err != nil {
+				return "", err
+			}
+			if country != "" {
+				return country, nil
+			}
+		}
+		return "", nil
+	})
+}
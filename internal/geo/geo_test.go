@@ -0,0 +1,87 @@
+package geo
+
+import (
+	"context"
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+const testLocations = `geoname_id,locale_code,continent_code,continent_name,country_iso_code,country_name,is_in_european_union
+2921044,en,EU,Europe,DE,Germany,1
+3017382,en,EU,Europe,FR,France,1
+6252001,en,NA,"North America",US,"United States",0
+`
+
+const testBlocksIPv4 = `network,geoname_id,registered_country_geoname_id,represented_country_geoname_id,is_anonymous_proxy,is_satellite_provider
+2.16.0.0/13,2921044,2921044,,0,0
+5.39.0.0/17,,3017382,,0,0
+8.8.8.0/24,6252001,6252001,,0,0
+`
+
+const testBlocksIPv6 = `network,geoname_id,registered_country_geoname_id,represented_country_geoname_id,is_anonymous_proxy,is_satellite_provider
+2a00:1450::/32,2921044,2921044,,0,0
+`
+
+func TestLoadGeoLite2CSV(t *testing.T) {
+	resolver, err := LoadGeoLite2CSV(strings.NewReader(testLocations), strings.NewReader(testBlocksIPv4), strings.NewReader(testBlocksIPv6))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if resolver.Len() != 4 {
+		t.Errorf("Expected 4 ranges, got %d", resolver.Len())
+	}
+
+	tests := []struct {
+		name     string
+		ip       string
+		expected string
+	}{
+		{name: "Inicio de rango", ip: "2.16.0.0", expected: "DE"},
+		{name: "Final de rango", ip: "2.23.255.255", expected: "DE"},
+		{name: "Justo después del rango", ip: "2.24.0.0", expected: ""},
+		{name: "País registrado como respaldo", ip: "5.39.10.1", expected: "FR"},
+		{name: "IPv4 mapeada en IPv6", ip: "::ffff:8.8.8.8", expected: "US"},
+		{name: "IPv6", ip: "2a00:1450:4001::1", expected: "DE"},
+		{name: "IP desconocida", ip: "192.0.2.1", expected: ""},
+		{name: "Antes del primer rango", ip: "1.1.1.1", expected: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			country, err := resolver.Country(context.Background(), netip.MustParseAddr(tt.ip))
+			if err != nil || country != tt.expected {
+				t.Errorf("Expected %q, got %q (%v)", tt.expected, country, err)
+			}
+		})
+	}
+
+	if _, err := LoadGeoLite2CSV(strings.NewReader("id,code\n"), strings.NewReader(testBlocksIPv4)); err == nil {
+		t.Error("Expected error for missing columns")
+	}
+}
+
+func TestNormalizeCountryAndRegions(t *testing.T) {
+	tests := []struct {
+		code     string
+		expected string
+		ok       bool
+	}{
+		{"de", "DE", true},
+		{" EU ", "EU", true},
+		{"DEU", "", false},
+		{"1A", "", false},
+	}
+	for _, tt := range tests {
+		if got, ok := NormalizeCountry(tt.code); got != tt.expected || ok != tt.ok {
+			t.Errorf("NormalizeCountry(%q) = %q, %v; expected %q, %v", tt.code, got, ok, tt.expected, tt.ok)
+		}
+	}
+	if !InRegion("FR", "EU") || InRegion("US", "EU") {
+		t.Error("Unexpected EU membership")
+	}
+
+	chained := Chain(NewRangeResolver(nil), NewRangeResolver(map[netip.Prefix]string{netip.MustParsePrefix("10.0.0.0/8"): "ES"}))
+	if country, _ := chained.Country(context.Background(), netip.MustParseAddr("10.1.2.3")); country != "ES" {
+		t.Errorf("Expected ES from the second resolver, got %q", country)
+	}
+}
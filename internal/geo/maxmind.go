@@ -0,0 +1,125 @@
+package geo
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"strings"
+)
+
+// LoadGeoLite2CSV carga las bases CSV GeoLite2 Country de MaxMind: locations es
+// GeoLite2-Country-Locations-en.csv y cada blocks un GeoLite2-Country-Blocks-IPv4.csv o
+// -IPv6.csv. Los bloques sin país propio usan el país registrado.
+func LoadGeoLite2CSV(locations io.Reader, blocks ...io.Reader) (*RangeResolver, error) {
+	countries, err := readLocations(locations)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &RangeResolver{}
+	for _, block := range blocks {
+		if err := r.readBlocks(block, countries); err != nil {
+			return nil, err
+		}
+	}
+	r.sort()
+	return r, nil
+}
+
+// LoadGeoLite2Files abre los archivos CSV y los carga con LoadGeoLite2CSV
+func LoadGeoLite2Files(locationsPath string, blockPaths ...string) (*RangeResolver, error) {
+	locations, err := os.Open(locationsPath)
+	if err != nil {
+		return nil, fmt.Errorf("geo: %w", err)
+	}
+	defer locations.Close()
+
+	readers := make([]io.Reader, 0, len(blockPaths))
+	for _, path := range blockPaths {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("geo: %w", err)
+		}
+		defer file.Close()
+		readers = append(readers, file)
+	}
+	return LoadGeoLite2CSV(locations, readers...)
+}
+
+// readLocations lee geoname_id -> country_iso_code
+func readLocations(in io.Reader) (map[string]string, error) {
+	reader := csv.NewReader(in)
+	columns, err := readHeader(reader, "geoname_id", "country_iso_code")
+	if err != nil {
+		return nil, fmt.Errorf("geo: locations: %w", err)
+	}
+
+	countries := make(map[string]string)
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return countries, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("geo: locations: %w", err)
+		}
+		if code := strings.ToUpper(record[columns[1]]); code != "" {
+			countries[record[columns[0]]] = code
+		}
+	}
+}
+
+// readBlocks agrega a la tabla las redes de un archivo de bloques
+func (r *RangeResolver) readBlocks(in io.Reader, countries map[string]string) error {
+	reader := csv.NewReader(in)
+	reader.ReuseRecord = true
+	columns, err := readHeader(reader, "network", "geoname_id", "registered_country_geoname_id")
+	if err != nil {
+		return fmt.Errorf("geo: blocks: %w", err)
+	}
+
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("geo: blocks: %w", err)
+		}
+		prefix, err := netip.ParsePrefix(record[columns[0]])
+		if err != nil {
+			return fmt.Errorf("geo: blocks: red inválida %q: %w", record[columns[0]], err)
+		}
+		country := countries[record[columns[1]]]
+		if country == "" {
+			country = countries[record[columns[2]]]
+		}
+		if country != "" {
+			r.add(prefix, country)
+		}
+	}
+}
+
+// readHeader lee la cabecera y retorna la posición de cada columna requerida
+func readHeader(reader *csv.Reader, names ...string) ([]int, error) {
+	header, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	positions := make([]int, len(names))
+	for i, name := range names {
+		positions[i] = -1
+		for j, column := range header {
+			if column == name {
+				positions[i] = j
+			}
+		}
+		if positions[i] < 0 {
+			return nil, fmt.Errorf("falta la columna %s", name)
+		}
+	}
+	return positions, nil
+}
@@ -0,0 +1,158 @@
+package graphql
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+)
+
+// Resolver resuelve un campo raíz a partir de sus argumentos. Los objetos se representan
+// como map[string]interface{} y las listas como slices; el ejecutor proyecta sobre ellos
+// la subselección pedida.
+type Resolver func(ctx context.Context, args map[string]interface{}) (interface{}, error)
+
+// Schema agrupa los campos raíz de query y mutation
+type Schema struct {
+	Query    map[string]Resolver
+	Mutation map[string]Resolver
+
+	// ErrorCode clasifica los errores de los resolvers en extensions.code; opcional
+	ErrorCode func(error) string
+}
+
+// Request es el cuerpo estándar de una petición GraphQL sobre HTTP
+type Request struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+}
+
+// Response es el cuerpo estándar de una respuesta GraphQL
+type Response struct {
+	Data   map[string]interface{} `json:"data"`
+	Errors []Error                `json:"errors,omitempty"`
+}
+
+// Error describe un error de ejecución asociado opcionalmente a un campo
+type Error struct {
+	Message    string                 `json:"message"`
+	Path       []string               `json:"path,omitempty"`
+	Extensions map[string]interface{} `json:"extensions,omitempty"`
+}
+
+// Execute analiza y ejecuta la petición. Los errores de sintaxis retornan Data nulo; los
+// errores de un campo dejan ese campo en null y el resto de la respuesta se conserva.
+// Las mutaciones se ejecutan en orden, como exige la especificación.
+func (s *Schema) Execute(ctx context.Context, req Request) Response {
+	op, err := Parse(req.Query, req.OperationName, req.Variables)
+	if err != nil {
+		return Response{Errors: []Error{{Message: err.Error(), Extensions: map[string]interface{}{"code": "graphql_parse_failed"}}}}
+	}
+
+	root := s.Query
+	if op.Type == "mutation" {
+		root = s.Mutation
+	}
+
+	response := Response{Data: make(map[string]interface{}, len(op.Selections))}
+	for _, field := range op.Selections {
+		if field.Name == "__typename" {
+			response.Data[field.Alias] = typeName(op.Type)
+			continue
+		}
+
+		resolve, ok := root[field.Name]
+		if !ok {
+			response.Data[field.Alias] = nil
+			response.Errors = append(response.Errors, Error{
+				Message:    fmt.Sprintf("el campo %q no existe en %s", field.Name, typeName(op.Type)),
+				Path:       []string{field.Alias},
+				Extensions: map[string]interface{}{"code": "graphql_validation_failed"},
+			})
+			continue
+		}
+
+		value, err := resolve(ctx, field.Arguments)
+		if err != nil {
+			response.Data[field.Alias] = nil
+			response.Errors = append(response.Errors, s.fieldError(err, []string{field.Alias}))
+			continue
+		}
+
+		projected, projectErr := project(value, field, []string{field.Alias})
+		if projectErr != nil {
+			response.Data[field.Alias] = nil
+			response.Errors = append(response.Errors, *projectErr)
+			continue
+		}
+		response.Data[field.Alias] = projected
+	}
+	return response
+}
+
+// fieldError construye el error de un resolver con su código si el esquema lo clasifica
+func (s *Schema) fieldError(err error, path []string) Error {
+	e := Error{Message: err.Error(), Path: path}
+	if s.ErrorCode != nil {
+		if code := s.ErrorCode(err); code != "" {
+			e.Extensions = map[string]interface{}{"code": code}
+		}
+	}
+	return e
+}
+
+// project aplica la subselección del campo sobre el valor resuelto
+func project(value interface{}, field Field, path []string) (interface{}, *Error) {
+	if value == nil {
+		return nil, nil
+	}
+
+	if object, ok := value.(map[string]interface{}); ok {
+		if len(field.Selections) == 0 {
+			return nil, &Error{Message: fmt.Sprintf("el campo %q requiere una selección de subcampos", field.Name), Path: path}
+		}
+		result := make(map[string]interface{}, len(field.Selections))
+		for _, sub := range field.Selections {
+			subPath := append(append([]string{}, path...), sub.Alias)
+			child, exists := object[sub.Name]
+			if !exists {
+				return nil, &Error{
+					Message:    fmt.Sprintf("el campo %q no existe", sub.Name),
+					Path:       subPath,
+					Extensions: map[string]interface{}{"code": "graphql_validation_failed"},
+				}
+			}
+			projected, err := project(child, sub, subPath)
+			if err != nil {
+				return nil, err
+			}
+			result[sub.Alias] = projected
+		}
+		return result, nil
+	}
+
+	if v := reflect.ValueOf(value); v.Kind() == reflect.Slice {
+		list := make([]interface{}, v.Len())
+		for i := range list {
+			projected, err := project(v.Index(i).Interface(), field, path)
+			if err != nil {
+				return nil, err
+			}
+			list[i] = projected
+		}
+		return list, nil
+	}
+
+	if len(field.Selections) > 0 {
+		return nil, &Error{Message: fmt.Sprintf("el campo %q es escalar y no admite subselección", field.Name), Path: path}
+	}
+	return value, nil
+}
+
+// typeName retorna el nombre del tipo raíz de la operación
+func typeName(operation string) string {
+	if operation == "mutation" {
+		return "Mutation"
+	}
+	return "Query"
+}
@@ -0,0 +1,132 @@
+package graphql
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name          string
+		query         string
+		operationName string
+		variables     map[string]interface{}
+		expectedType  string
+		expectedField Field
+		expectError   bool
+	}{
+		{
+			name:          "Consulta abreviada con alias y selección anidada",
+			query:         `{ enlace: url(shortCode: "abc123") { shortCode longUrl } }`,
+			expectedType:  "query",
+			expectedField: Field{Alias: "enlace", Name: "url", Arguments: map[string]interface{}{"shortCode": "abc123"}, Selections: []Field{{Alias: "shortCode", Name: "shortCode"}, {Alias: "longUrl", Name: "longUrl"}}},
+		},
+		{
+			name:          "Mutación con variables y valor por defecto",
+			query:         `mutation Crear($url: String!, $ttl: Int = 60) { shortenUrl(longUrl: $url, ttlSeconds: $ttl) { shortCode } }`,
+			variables:     map[string]interface{}{"url": "https://www.example.com"},
+			expectedType:  "mutation",
+			expectedField: Field{Alias: "shortenUrl", Name: "shortenUrl", Arguments: map[string]interface{}{"longUrl": "https://www.example.com", "ttlSeconds": int64(60)}, Selections: []Field{{Alias: "shortCode", Name: "shortCode"}}},
+		},
+		{
+			name:          "Selección de operación por nombre",
+			query:         `query A { stats { totalUrls } } query B { urls { shortCode } }`,
+			operationName: "B",
+			expectedType:  "query",
+			expectedField: Field{Alias: "urls", Name: "urls", Selections: []Field{{Alias: "shortCode", Name: "shortCode"}}},
+		},
+		{name: "Varias operaciones sin nombre", query: `query A { stats { totalUrls } } query B { urls { shortCode } }`, expectError: true},
+		{name: "Llave sin cerrar", query: `{ stats { totalUrls }`, expectError: true},
+		{name: "String sin cerrar", query: `{ url(shortCode: "abc) { shortCode } }`, expectError: true},
+		{name: "Fragmentos no soportados", query: `fragment F on Link { shortCode }`, expectError: true},
+		{name: "Documento vacío", query: `  # solo un comentario`, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			op, err := Parse(tt.query, tt.operationName, tt.variables)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Expected error, got operation %+v", op)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if op.Type != tt.expectedType || len(op.Selections) != 1 {
+				t.Fatalf("Unexpected operation: %+v", op)
+			}
+
+			got := op.Selections[0]
+			if !reflect.DeepEqual(got, tt.expectedField) {
+				t.Errorf("Expected field %+v, got %+v", tt.expectedField, got)
+			}
+		})
+	}
+}
+
+func TestSchema_Execute(t *testing.T) {
+	errBoom := errors.New("fallo")
+	schema := &Schema{
+		Query: map[string]Resolver{
+			"link": func(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+				return map[string]interface{}{"code": args["code"], "clicks": int64(3), "owner": nil}, nil
+			},
+			"links": func(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+				return []map[string]interface{}{{"code": "a"}, {"code": "b"}}, nil
+			},
+			"broken": func(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+				return nil, errBoom
+			},
+		},
+		ErrorCode: func(err error) string {
+			if errors.Is(err, errBoom) {
+				return "boom"
+			}
+			return ""
+		},
+	}
+
+	response := schema.Execute(context.Background(), Request{
+		Query: `{ link(code: "x") { code total: clicks } links { code } broken missing __typename }`,
+	})
+
+	expectedData := map[string]interface{}{
+		"link":       map[string]interface{}{"code": "x", "total": int64(3)},
+		"links":      []interface{}{map[string]interface{}{"code": "a"}, map[string]interface{}{"code": "b"}},
+		"broken":     nil,
+		"missing":    nil,
+		"__typename": "Query",
+	}
+	if !reflect.DeepEqual(response.Data, expectedData) {
+		t.Errorf("Expected data %+v, got %+v", expectedData, response.Data)
+	}
+	if len(response.Errors) != 2 || response.Errors[0].Extensions["code"] != "boom" || response.Errors[1].Path[0] != "missing" {
+		t.Errorf("Unexpected errors: %+v", response.Errors)
+	}
+
+	tests := []struct {
+		name  string
+		query string
+	}{
+		{name: "Subcampo inexistente", query: `{ link(code: "x") { nope } }`},
+		{name: "Objeto sin selección", query: `{ link(code: "x") }`},
+		{name: "Escalar con selección", query: `{ link(code: "x") { clicks { value } } }`},
+		{name: "Mutación sin resolvers", query: `mutation { link(code: "x") { code } }`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := schema.Execute(context.Background(), Request{Query: tt.query})
+			if len(response.Errors) != 1 {
+				t.Errorf("Expected one error, got %+v", response.Errors)
+			}
+		})
+	}
+
+	if response := schema.Execute(context.Background(), Request{Query: `{`}); response.Data != nil || len(response.Errors) != 1 {
+		t.Errorf("Expected parse error with null data, got %+v", response)
+	}
+}
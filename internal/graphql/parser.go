@@ -0,0 +1,427 @@
+// Package graphql implementa el subconjunto de GraphQL que usa la API: operaciones query y
+// mutation con variables, argumentos, alias y selecciones anidadas. No soporta fragmentos,
+// directivas ni introspección.
+package graphql
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ErrSyntax se retorna cuando el documento no es GraphQL válido para este subconjunto
+var ErrSyntax = errors.New("error de sintaxis GraphQL")
+
+// Operation es la operación seleccionada de un documento con las variables ya sustituidas
+type Operation struct {
+	Type       string // "query" o "mutation"
+	Name       string
+	Selections []Field
+}
+
+// Field es un campo seleccionado con sus argumentos y subselección
+type Field struct {
+	Alias      string // nombre bajo el que se retorna; igual a Name si no hay alias
+	Name       string
+	Arguments  map[string]interface{}
+	Selections []Field
+}
+
+// Parse analiza el documento y retorna la operación indicada por operationName (o la única
+// operación del documento), sustituyendo las variables recibidas y sus valores por defecto
+func Parse(query, operationName string, variables map[string]interface{}) (*Operation, error) {
+	p := &parser{tokens: tokenize(query)}
+	var operations []*Operation
+	for !p.done() {
+		op, err := p.parseOperation(variables)
+		if err != nil {
+			return nil, err
+		}
+		operations = append(operations, op)
+	}
+
+	switch {
+	case len(operations) == 0:
+		return nil, fmt.Errorf("%w: documento vacío", ErrSyntax)
+	case operationName != "":
+		for _, op := range operations {
+			if op.Name == operationName {
+				return op, nil
+			}
+		}
+		return nil, fmt.Errorf("operación %q no encontrada", operationName)
+	case len(operations) > 1:
+		return nil, fmt.Errorf("el documento tiene varias operaciones: se requiere operationName")
+	default:
+		return operations[0], nil
+	}
+}
+
+// token es una unidad léxica del documento
+type token struct {
+	kind  byte // 'n' nombre, 's' string, 'i' entero, 'f' decimal, 'p' puntuación, 'e' error
+	value string
+}
+
+// tokenize divide el documento ignorando espacios, comas y comentarios
+func tokenize(src string) []token {
+	var tokens []token
+	runes := []rune(src)
+	for i := 0; i < len(runes); {
+		c := runes[i]
+		switch {
+		case unicode.IsSpace(c) || c == ',' || c == '\uFEFF':
+			i++
+		case c == '#':
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+		case strings.ContainsRune("{}()[]:!$=", c):
+			tokens = append(tokens, token{kind: 'p', value: string(c)})
+			i++
+		case c == '"':
+			value, next, ok := readString(runes, i)
+			if !ok {
+				return append(tokens, token{kind: 'e', value: "string sin cerrar"})
+			}
+			tokens = append(tokens, token{kind: 's', value: value})
+			i = next
+		case c == '-' || unicode.IsDigit(c):
+			start := i
+			i++
+			kind := byte('i')
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || strings.ContainsRune(".eE+-", runes[i])) {
+				if !unicode.IsDigit(runes[i]) {
+					kind = 'f'
+				}
+				i++
+			}
+			tokens = append(tokens, token{kind: kind, value: string(runes[start:i])})
+		case c == '_' || unicode.IsLetter(c):
+			start := i
+			for i < len(runes) && (runes[i] == '_' || unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i])) {
+				i++
+			}
+			tokens = append(tokens, token{kind: 'n', value: string(runes[start:i])})
+		default:
+			return append(tokens, token{kind: 'e', value: fmt.Sprintf("carácter inesperado %q", c)})
+		}
+	}
+	return tokens
+}
+
+// readString lee un string entre comillas a partir de runes[start] resolviendo escapes
+func readString(runes []rune, start int) (string, int, bool) {
+	var sb strings.Builder
+	for i := start + 1; i < len(runes); i++ {
+		switch runes[i] {
+		case '"':
+			return sb.String(), i + 1, true
+		case '\\':
+			if i+1 >= len(runes) {
+				return "", 0, false
+			}
+			i++
+			switch runes[i] {
+			case 'n':
+				sb.WriteRune('\n')
+			case 't':
+				sb.WriteRune('\t')
+			case 'r':
+				sb.WriteRune('\r')
+			case 'u':
+				if i+4 >= len(runes) {
+					return "", 0, false
+				}
+				code, err := strconv.ParseUint(string(runes[i+1:i+5]), 16, 32)
+				if err != nil {
+					return "", 0, false
+				}
+				sb.WriteRune(rune(code))
+				i += 4
+			default:
+				sb.WriteRune(runes[i])
+			}
+		case '\n':
+			return "", 0, false
+		default:
+			sb.WriteRune(runes[i])
+		}
+	}
+	return "", 0, false
+}
+
+// parser recorre los tokens con descenso recursivo
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) done() bool {
+	return p.pos >= len(p.tokens)
+}
+
+func (p *parser) peek() token {
+	if p.done() {
+		return token{}
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+// expect consume el signo de puntuación indicado o falla
+func (p *parser) expect(punct string) error {
+	if t := p.next(); t.kind != 'p' || t.value != punct {
+		return p.unexpected(t, punct)
+	}
+	return nil
+}
+
+// accept consume el signo de puntuación si es el siguiente token
+func (p *parser) accept(punct string) bool {
+	if t := p.peek(); t.kind == 'p' && t.value == punct {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) name() (string, error) {
+	t := p.next()
+	if t.kind != 'n' {
+		return "", p.unexpected(t, "un nombre")
+	}
+	return t.value, nil
+}
+
+func (p *parser) unexpected(t token, expected string) error {
+	switch {
+	case t.kind == 'e':
+		return fmt.Errorf("%w: %s", ErrSyntax, t.value)
+	case t.kind == 0:
+		return fmt.Errorf("%w: fin inesperado del documento, se esperaba %s", ErrSyntax, expected)
+	default:
+		return fmt.Errorf("%w: se esperaba %s y se encontró %q", ErrSyntax, expected, t.value)
+	}
+}
+
+// parseOperation analiza una operación completa; "{ ... }" abreviado equivale a query
+func (p *parser) parseOperation(variables map[string]interface{}) (*Operation, error) {
+	op := &Operation{Type: "query"}
+	vars := make(map[string]interface{}, len(variables))
+	for k, v := range variables {
+		vars[k] = v
+	}
+
+	if t := p.peek(); t.kind == 'n' {
+		switch t.value {
+		case "query", "mutation":
+			op.Type = t.value
+		case "subscription", "fragment":
+			return nil, fmt.Errorf("%w: %s no está soportado", ErrSyntax, t.value)
+		default:
+			return nil, p.unexpected(t, "query o mutation")
+		}
+		p.next()
+		if p.peek().kind == 'n' {
+			op.Name, _ = p.name()
+		}
+		if p.accept("(") {
+			if err := p.parseVariableDefinitions(vars); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	selections, err := p.parseSelectionSet(vars)
+	if err != nil {
+		return nil, err
+	}
+	op.Selections = selections
+	return op, nil
+}
+
+// parseVariableDefinitions lee "($a: Tipo = defecto, ...)" aplicando los valores por defecto
+// de las variables no recibidas; los tipos se aceptan pero no se verifican
+func (p *parser) parseVariableDefinitions(vars map[string]interface{}) error {
+	for !p.accept(")") {
+		if err := p.expect("$"); err != nil {
+			return err
+		}
+		name, err := p.name()
+		if err != nil {
+			return err
+		}
+		if err := p.expect(":"); err != nil {
+			return err
+		}
+		if err := p.skipType(); err != nil {
+			return err
+		}
+		if p.accept("=") {
+			value, err := p.parseValue(nil)
+			if err != nil {
+				return err
+			}
+			if _, given := vars[name]; !given {
+				vars[name] = value
+			}
+		}
+	}
+	return nil
+}
+
+// skipType consume una referencia de tipo como String!, [Int] o [String!]!
+func (p *parser) skipType() error {
+	if p.accept("[") {
+		if err := p.skipType(); err != nil {
+			return err
+		}
+		if err := p.expect("]"); err != nil {
+			return err
+		}
+	} else if _, err := p.name(); err != nil {
+		return err
+	}
+	p.accept("!")
+	return nil
+}
+
+// parseSelectionSet lee "{ campo, alias: campo(arg: valor) { ... } }"
+func (p *parser) parseSelectionSet(vars map[string]interface{}) ([]Field, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	var fields []Field
+	for !p.accept("}") {
+		if p.done() {
+			return nil, p.unexpected(token{}, "}")
+		}
+		field, err := p.parseField(vars)
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, field)
+	}
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("%w: selección vacía", ErrSyntax)
+	}
+	return fields, nil
+}
+
+func (p *parser) parseField(vars map[string]interface{}) (Field, error) {
+	name, err := p.name()
+	if err != nil {
+		return Field{}, err
+	}
+	field := Field{Alias: name, Name: name}
+	if p.accept(":") {
+		if field.Name, err = p.name(); err != nil {
+			return Field{}, err
+		}
+	}
+
+	if p.accept("(") {
+		field.Arguments = make(map[string]interface{})
+		for !p.accept(")") {
+			arg, err := p.name()
+			if err != nil {
+				return Field{}, err
+			}
+			if err := p.expect(":"); err != nil {
+				return Field{}, err
+			}
+			if field.Arguments[arg], err = p.parseValue(vars); err != nil {
+				return Field{}, err
+			}
+		}
+	}
+
+	if t := p.peek(); t.kind == 'p' && t.value == "{" {
+		if field.Selections, err = p.parseSelectionSet(vars); err != nil {
+			return Field{}, err
+		}
+	}
+	return field, nil
+}
+
+// parseValue lee un valor literal o una variable; vars es nil en valores por defecto
+func (p *parser) parseValue(vars map[string]interface{}) (interface{}, error) {
+	t := p.next()
+	switch t.kind {
+	case 's':
+		return t.value, nil
+	case 'i':
+		n, err := strconv.ParseInt(t.value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: entero inválido %q", ErrSyntax, t.value)
+		}
+		return n, nil
+	case 'f':
+		f, err := strconv.ParseFloat(t.value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: número inválido %q", ErrSyntax, t.value)
+		}
+		return f, nil
+	case 'n':
+		switch t.value {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		default:
+			// Los valores de enum se tratan como strings
+			return t.value, nil
+		}
+	case 'p':
+		switch t.value {
+		case "$":
+			if vars == nil {
+				return nil, fmt.Errorf("%w: una variable no puede usarse como valor por defecto", ErrSyntax)
+			}
+			name, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			return vars[name], nil
+		case "[":
+			list := make([]interface{}, 0)
+			for !p.accept("]") {
+				if p.done() {
+					return nil, p.unexpected(token{}, "]")
+				}
+				value, err := p.parseValue(vars)
+				if err != nil {
+					return nil, err
+				}
+				list = append(list, value)
+			}
+			return list, nil
+		case "{":
+			object := make(map[string]interface{})
+			for !p.accept("}") {
+				key, err := p.name()
+				if err != nil {
+					return nil, err
+				}
+				if err := p.expect(":"); err != nil {
+					return nil, err
+				}
+				if object[key], err = p.parseValue(vars); err != nil {
+					return nil, err
+				}
+			}
+			return object, nil
+		}
+	}
+	return nil, p.unexpected(t, "un valor")
+}
@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"acortador-urls/internal/shortener"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// Formatos del log de peticiones
+const (
+	// AccessLogText es una línea legible por petición, con la fecha del paquete log
+	AccessLogText = "text"
+	// AccessLogJSON es un objeto JSON por línea para los pipelines de logs
+	AccessLogJSON = "json"
+	// AccessLogCombined es el formato combined de Apache
+	AccessLogCombined = "combined"
+)
+
+// redacted reemplaza los valores ocultos en el log
+const redacted = "REDACTED"
+
+// redactedParams son los parámetros de query cuyo valor se oculta siempre: la clave de API, la
+// contraseña de un enlace protegido, los tokens de confirmación y la firma de las URLs firmadas,
+// que bastan para repetir la petición
+var redactedParams = map[string]bool{
+	APIKeyParam:                   true,
+	shortener.PasswordQueryParam:  true,
+	ConfirmParam:                  true,
+	shortener.SignatureQueryParam: true,
+}
+
+// urlParams son los parámetros de query que llevan una URL de destino, cuya query se oculta
+var urlParams = map[string]bool{"url": true, "long_url": true}
+
+// AccessLogOptions configura el log de peticiones
+type AccessLogOptions struct {
+	// Format es AccessLogText, AccessLogJSON o AccessLogCombined
+	Format string
+	// SampleRate es la fracción de peticiones registradas, entre 0 y 1; los errores 5xx se
+	// registran siempre
+	SampleRate float64
+	// RedactQuery oculta la query de las URLs de destino (en los parámetros url y long_url y
+	// en la cabecera Location), que puede llevar tokens
+	RedactQuery bool
+	// PrivacyMode omite la IP, el Referer y el User-Agent de todas las peticiones; sin él se
+	// omiten solo en las que piden no ser rastreadas (ver TrackingOptOut)
+	PrivacyMode bool
+	Output      io.Writer
+}
+
+// accessLogEntry es una petición registrada en formato JSON
+type accessLogEntry struct {
+	Time       time.Time `json:"time"`
+	RequestID  string    `json:"request_id,omitempty"`
+	RemoteIP   string    `json:"remote_ip"`
+	Method     string    `json:"method"`
+	URI        string    `json:"uri"`
+	Proto      string    `json:"proto"`
+	Host       string    `json:"host"`
+	Status     int       `json:"status"`
+	Bytes      int       `json:"bytes"`
+	DurationMS float64   `json:"duration_ms"`
+	Location   string    `json:"location,omitempty"`
+	Referer    string    `json:"referer,omitempty"`
+	UserAgent  string    `json:"user_agent,omitempty"`
+}
+
+// AccessLog registra las peticiones en el formato configurado. La IP es la de ClientIP, por lo
+// que debe ir después de TrustedProxies, y el identificador el de middleware.RequestID. La
+// clave de API de la query se oculta siempre.
+func AccessLog(opts AccessLogOptions) func(http.Handler) http.Handler {
+	var mu sync.Mutex
+	text := log.New(opts.Output, "", log.LstdFlags)
+	write := func(entry accessLogEntry) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch opts.Format {
+		case AccessLogJSON:
+			json.NewEncoder(opts.Output).Encode(entry)
+		case AccessLogCombined:
+			fmt.Fprintf(opts.Output, "%s - - [%s] %q %d %d %q %q\n", entry.RemoteIP,
+				entry.Time.Format("02/Jan/2006:15:04:05 -0700"), entry.Method+" "+entry.URI+" "+entry.Proto,
+				entry.Status, entry.Bytes, orDash(entry.Referer), orDash(entry.UserAgent))
+		default:
+			line := fmt.Sprintf("%s %s %s desde %s - %d %dB en %s", entry.Method, entry.URI, entry.Proto,
+				entry.RemoteIP, entry.Status, entry.Bytes, time.Duration(entry.DurationMS*float64(time.Millisecond)))
+			if entry.Location != "" {
+				line += " -> " + entry.Location
+			}
+			text.Print(line)
+		}
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			// WrapResponseWriter conserva Flusher y Hijacker para SSE y WebSocket
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			next.ServeHTTP(ww, r)
+
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+			if status < 500 && rand.Float64() >= opts.SampleRate {
+				return
+			}
+			uri, location := r.URL.RequestURI(), ww.Header().Get("Location")
+			if opts.RedactQuery {
+				location = redactURLQuery(location)
+			}
+			remoteIP, referer, userAgent := ClientIP(r), r.Referer(), r.UserAgent()
+			if opts.PrivacyMode || TrackingOptOut(r) {
+				remoteIP, referer, userAgent = "-", "", ""
+			}
+			write(accessLogEntry{
+				Time:       start,
+				RequestID:  middleware.GetReqID(r.Context()),
+				RemoteIP:   remoteIP,
+				Method:     r.Method,
+				URI:        redactRequestURI(uri, opts.RedactQuery),
+				Proto:      r.Proto,
+				Host:       r.Host,
+				Status:     status,
+				Bytes:      ww.BytesWritten(),
+				DurationMS: float64(time.Since(start).Microseconds()) / 1000,
+				Location:   location,
+				Referer:    referer,
+				UserAgent:  userAgent,
+			})
+		})
+	}
+}
+
+// orDash retorna "-" para los campos vacíos del formato combined
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+// redactRequestURI oculta en la URI de la petición la clave de API y, con urls, la query de las
+// URLs de destino. Conserva el orden y la codificación del resto de parámetros.
+func redactRequestURI(uri string, urls bool) string {
+	path, query, found := strings.Cut(uri, "?")
+	if !found {
+		return uri
+	}
+	params := strings.Split(query, "&")
+	for i, param := range params {
+		key, value, _ := strings.Cut(param, "=")
+		switch {
+		case redactedParams[key]:
+			params[i] = key + "=" + redacted
+		case urls && urlParams[key]:
+			// La URL de destino va codificada: su "?" aparece como %3F
+			if cut := strings.Index(strings.ToUpper(value), "%3F"); cut >= 0 {
+				params[i] = key + "=" + value[:cut] + "%3F" + redacted
+			} else if cut := strings.Index(value, "?"); cut >= 0 {
+				params[i] = key + "=" + value[:cut] + "?" + redacted
+			}
+		}
+	}
+	return path + "?" + strings.Join(params, "&")
+}
+
+// redactURLQuery oculta la query y el fragmento de una URL
+func redactURLQuery(rawURL string) string {
+	if cut := strings.IndexAny(rawURL, "?#"); cut >= 0 {
+		return rawURL[:cut] + "?" + redacted
+	}
+	return rawURL
+}
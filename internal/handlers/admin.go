@@ -0,0 +1,638 @@
+package handlers
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"acortador-urls/internal/errcode"
+	"acortador-urls/internal/shortener"
+	"acortador-urls/internal/webhooks"
+)
+
+// MaxImportErrors es el número máximo de errores por fila detallados en la respuesta de
+// POST /admin/import; el resto solo se contabiliza en Failed
+const MaxImportErrors = 100
+
+// exportFlushEvery es cada cuántas filas se vacía el buffer de la exportación hacia el cliente
+const exportFlushEvery = 1000
+
+// ImportRowError describe una fila que no se pudo importar
+type ImportRowError struct {
+	Line    int          `json:"line"`
+	LongURL string       `json:"long_url,omitempty"`
+	Error   errcode.Code `json:"error"`
+	Message string       `json:"message"`
+}
+
+// ImportResponse resume una importación masiva
+type ImportResponse struct {
+	Imported int              `json:"imported"`
+	Failed   int              `json:"failed"`
+	Errors   []ImportRowError `json:"errors"`
+}
+
+// ImportLinks maneja POST /admin/import. El cuerpo es CSV (o TSV con Content-Type
+// text/tab-separated-values o ?format=tsv) con las columnas long_url, alias opcional y
+// expires_at opcional (RFC 3339). Las filas se leen y crean una a una, por lo que el tamaño
+// del archivo no condiciona la memoria usada. La primera fila se omite si es una cabecera.
+func (h *Handler) ImportLinks(w http.ResponseWriter, r *http.Request) {
+	comma := tabularSeparator(r.URL.Query().Get("format"), r.Header.Get("Content-Type"))
+	tenant, ok := h.adminTenant(w, r)
+	if !ok {
+		return
+	}
+	response, err := h.importLinks(r.Context(), r.Body, comma, ownerFromRequest(r), tenant)
+	if err != nil {
+		h.sendImportError(w, r, err)
+		return
+	}
+	for i, rowErr := range response.Errors {
+		localized := itemError(r, ErrorResponse{Error: rowErr.Error, Message: rowErr.Message})
+		response.Errors[i].Message = localized.Message
+	}
+
+	h.sendJSON(w, http.StatusOK, response)
+}
+
+// sendImportError responde a una importación abortada
+func (h *Handler) sendImportError(w http.ResponseWriter, r *http.Request, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		h.sendDecodeError(w, r, err)
+		return
+	}
+	if status, code, message, ok := storeErrorStatus(err); ok {
+		h.sendErrorResponse(w, r, status, code, message)
+		return
+	}
+	h.sendErrorResponse(w, r, http.StatusBadRequest, errcode.InvalidCSV, err.Error())
+}
+
+// importLinks crea los enlaces de un CSV o TSV a nombre de owner en el espacio de tenant. Solo
+// retorna error si la importación se aborta: archivo ilegible, cuerpo demasiado grande o
+// almacén no disponible.
+func (h *Handler) importLinks(ctx context.Context, body io.Reader, comma rune, owner, tenant string) (ImportResponse, error) {
+	reader := csv.NewReader(body)
+	reader.Comma = comma
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	reader.ReuseRecord = true
+
+	now := time.Now()
+	response := ImportResponse{Errors: make([]ImportRowError, 0)}
+	addError := func(line int, longURL string, code errcode.Code, message string) {
+		response.Failed++
+		if len(response.Errors) < MaxImportErrors {
+			response.Errors = append(response.Errors, ImportRowError{Line: line, LongURL: longURL, Error: code, Message: message})
+		}
+	}
+
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				return response, err
+			}
+			// Un error de formato CSV en una fila no impide seguir leyendo las siguientes
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) && !errors.Is(parseErr.Err, csv.ErrQuote) {
+				addError(line, "", errcode.InvalidRow, err.Error())
+				continue
+			}
+			return response, fmt.Errorf("CSV inválido: %v", err)
+		}
+
+		longURL := strings.TrimSpace(record[0])
+		if line == 1 && strings.EqualFold(longURL, "long_url") {
+			continue
+		}
+
+		input := shortener.ShortenInput{LongURL: longURL, Owner: owner, Tenant: tenant}
+		if len(record) > 1 {
+			input.Alias = strings.TrimSpace(record[1])
+		}
+		if len(record) > 2 && strings.TrimSpace(record[2]) != "" {
+			expiresAt, err := time.Parse(time.RFC3339, strings.TrimSpace(record[2]))
+			if err != nil {
+				addError(line, longURL, errcode.InvalidExpiry, "expires_at debe tener formato RFC 3339")
+				continue
+			}
+			if !expiresAt.After(now) {
+				addError(line, longURL, errcode.InvalidExpiry, "expires_at debe estar en el futuro")
+				continue
+			}
+			input.TTL = expiresAt.Sub(now)
+		}
+
+		if _, _, err := h.service.Shorten(ctx, input); err != nil {
+			// Un contexto cancelado aborta la importación en lugar de fallar cada fila restante
+			if _, _, _, ok := storeErrorStatus(err); ok {
+				return response, err
+			}
+			_, code, message := shortenErrorStatus(err)
+			addError(line, longURL, code, message)
+			continue
+		}
+		response.Imported++
+	}
+	return response, nil
+}
+
+// exportHeader son las columnas de GET /admin/export
+var exportHeader = []string{"short_code", "long_url", "owner", "created_at", "expires_at", "clicks", "domain"}
+
+// ExportLinks maneja GET /admin/export?format=csv|tsv&tenant= escribiendo los enlaces del
+// tenant a medida que se recorren, sin construir el archivo completo en memoria
+func (h *Handler) ExportLinks(w http.ResponseWriter, r *http.Request) {
+	tenant, ok := h.adminTenant(w, r)
+	if !ok {
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "csv"
+	}
+	if format != "csv" && format != "tsv" {
+		h.sendErrorResponse(w, r, http.StatusBadRequest, errcode.InvalidFormat, "format debe ser csv o tsv")
+		return
+	}
+
+	contentType := "text/csv; charset=utf-8"
+	if format == "tsv" {
+		contentType = "text/tab-separated-values; charset=utf-8"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="enlaces.%s"`, format))
+
+	writer := csv.NewWriter(w)
+	writer.Comma = tabularSeparator(format, "")
+	flusher, _ := w.(http.Flusher)
+
+	rows := 0
+	err := h.service.EachLink(r.Context(), func(link shortener.Link) error {
+		if link.Tenant != tenant {
+			return nil
+		}
+		if rows == 0 {
+			if err := writer.Write(exportHeader); err != nil {
+				return err
+			}
+		}
+		expiresAt := ""
+		if !link.ExpiresAt.IsZero() {
+			expiresAt = link.ExpiresAt.UTC().Format(time.RFC3339)
+		}
+		if err := writer.Write([]string{
+			link.ShortCode,
+			link.LongURL,
+			link.Owner,
+			link.CreatedAt.UTC().Format(time.RFC3339),
+			expiresAt,
+			strconv.FormatInt(link.Clicks, 10),
+			link.Domain,
+		}); err != nil {
+			return err
+		}
+
+		if rows++; rows%exportFlushEvery == 0 {
+			writer.Flush()
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		return writer.Error()
+	})
+
+	// Si falla antes de escribir nada todavía se puede responder con un error JSON; a mitad
+	// del archivo la respuesta ya está comprometida y solo queda cortarla
+	if err != nil && rows == 0 {
+		w.Header().Del("Content-Disposition")
+		h.sendManagementError(w, r, err)
+		return
+	}
+	if rows == 0 {
+		writer.Write(exportHeader)
+	}
+	writer.Flush()
+}
+
+// adminTenant retorna el tenant con el que opera un endpoint de administración: el del
+// parámetro tenant o, en su defecto, el de la petición. Responde 404 si el parámetro nombra un
+// tenant no registrado.
+func (h *Handler) adminTenant(w http.ResponseWriter, r *http.Request) (string, bool) {
+	tenant := r.URL.Query().Get(TenantParam)
+	if tenant == "" {
+		return h.tenant(r), true
+	}
+	if !h.service.HasTenant(tenant) {
+		h.sendErrorResponse(w, r, http.StatusNotFound, errcode.TenantNotFound, "El tenant no está registrado")
+		return "", false
+	}
+	return tenant, true
+}
+
+// tabularSeparator elige tabulador para TSV y coma en cualquier otro caso
+func tabularSeparator(format, contentType string) rune {
+	if format == "tsv" || strings.HasPrefix(contentType, "text/tab-separated-values") {
+		return '\t'
+	}
+	return ','
+}
+
+// AuditEntryResponse representa una entrada del log de auditoría
+type AuditEntryResponse struct {
+	ID        int64     `json:"id"`
+	Time      time.Time `json:"time"`
+	Actor     string    `json:"actor,omitempty"`
+	Admin     bool      `json:"admin,omitempty"`
+	Action    string    `json:"action"`
+	ShortCode string    `json:"short_code"`
+	// Before y After son el enlace antes y después de la operación
+	Before *LinkResponse `json:"before,omitempty"`
+	After  *LinkResponse `json:"after,omitempty"`
+}
+
+// AuditListResponse es una página del log de auditoría
+type AuditListResponse struct {
+	Entries []AuditEntryResponse `json:"entries"`
+	Total   int                  `json:"total"`
+	Page    int                  `json:"page"`
+	PerPage int                  `json:"per_page"`
+}
+
+// AuditLog maneja GET /admin/audit?actor=&short_code=&action=&since=&until=&page=&per_page=.
+// since y until son fechas RFC 3339; las entradas se listan de la más reciente a la más antigua.
+func (h *Handler) AuditLog(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	query := shortener.AuditQuery{
+		Actor:     params.Get("actor"),
+		ShortCode: params.Get("short_code"),
+		Action:    params.Get("action"),
+	}
+
+	page, perPage, errs := pageParams(params)
+	for _, bound := range []struct {
+		field string
+		dest  *time.Time
+	}{{"since", &query.Since}, {"until", &query.Until}} {
+		if value := params.Get(bound.field); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				errs = append(errs, &shortener.ValidationError{Field: bound.field, Value: value, Msg: "debe ser una fecha RFC 3339"})
+			}
+			*bound.dest = parsed
+		}
+	}
+	if len(errs) > 0 {
+		h.sendQueryError(w, r, errors.Join(errs...))
+		return
+	}
+	query.Offset, query.Limit = (page-1)*perPage, perPage
+
+	result, err := h.service.AuditLog(r.Context(), actorFromRequest(r), query)
+	if err != nil {
+		if errors.As(err, new(*shortener.ValidationError)) {
+			h.sendQueryError(w, r, err)
+			return
+		}
+		h.sendManagementError(w, r, err)
+		return
+	}
+	response := AuditListResponse{
+		Entries: make([]AuditEntryResponse, 0, len(result.Entries)),
+		Total:   result.Total,
+		Page:    page,
+		PerPage: perPage,
+	}
+	for _, entry := range result.Entries {
+		response.Entries = append(response.Entries, h.auditEntryResponse(r, entry))
+	}
+
+	h.sendJSON(w, http.StatusOK, response)
+}
+
+// auditEntryResponse convierte una entrada del log de auditoría en su representación HTTP
+func (h *Handler) auditEntryResponse(r *http.Request, entry shortener.AuditEntry) AuditEntryResponse {
+	item := AuditEntryResponse{
+		ID:        entry.ID,
+		Time:      entry.Time,
+		Actor:     entry.Actor.UserID,
+		Admin:     entry.Actor.Admin,
+		Action:    entry.Action,
+		ShortCode: entry.ShortCode,
+	}
+	if entry.Before != nil {
+		before := h.toLinkResponse(r, *entry.Before)
+		item.Before = &before
+	}
+	if entry.After != nil {
+		after := h.toLinkResponse(r, *entry.After)
+		item.After = &after
+	}
+	return item
+}
+
+// DomainPolicyResponse resume las listas de dominios vigentes
+type DomainPolicyResponse struct {
+	Blocked int `json:"blocked"`
+	Allowed int `json:"allowed"`
+}
+
+// ReloadDomains maneja POST /admin/domains/reload releyendo las listas de dominios bloqueados y
+// permitidos. Si la carga falla se conservan las listas anteriores.
+func (h *Handler) ReloadDomains(w http.ResponseWriter, r *http.Request) {
+	policy, err := h.service.ReloadDomainPolicy(r.Context())
+	if err != nil {
+		if status, code, message, ok := storeErrorStatus(err); ok {
+			h.sendErrorResponse(w, r, status, code, message)
+			return
+		}
+		h.sendErrorResponse(w, r, http.StatusInternalServerError, errcode.DomainPolicyInvalid, err.Error())
+		return
+	}
+
+	h.sendJSON(w, http.StatusOK, DomainPolicyResponse{Blocked: policy.Blocked(), Allowed: policy.Allowed()})
+}
+
+// CustomDomainRequest es el cuerpo de PUT /admin/custom-domains/{host}
+type CustomDomainRequest struct {
+	Owner string `json:"owner" example:"user-123"`
+}
+
+// CustomDomainResponse es un dominio personalizado y el propietario cuyos enlaces sirve
+type CustomDomainResponse struct {
+	Host  string `json:"host"`
+	Owner string `json:"owner"`
+}
+
+// CustomDomainListResponse es la respuesta de GET /admin/custom-domains
+type CustomDomainListResponse struct {
+	Domains []CustomDomainResponse `json:"domains"`
+}
+
+// ListCustomDomains maneja GET /admin/custom-domains
+func (h *Handler) ListCustomDomains(w http.ResponseWriter, r *http.Request) {
+	response := CustomDomainListResponse{Domains: make([]CustomDomainResponse, 0)}
+	for _, domain := range h.service.CustomDomains() {
+		response.Domains = append(response.Domains, CustomDomainResponse{Host: domain.Host, Owner: domain.Owner})
+	}
+	h.sendJSON(w, http.StatusOK, response)
+}
+
+// RegisterCustomDomain maneja PUT /admin/custom-domains/{host}: los enlaces que cree el
+// propietario a partir de ahora viven en el espacio de códigos del host y se sirven en él
+func (h *Handler) RegisterCustomDomain(w http.ResponseWriter, r *http.Request) {
+	var req CustomDomainRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.sendDecodeError(w, r, err)
+		return
+	}
+
+	domain, err := h.service.RegisterDomain(chi.URLParam(r, "host"), req.Owner)
+	switch {
+	case errors.Is(err, shortener.ErrDomainTaken):
+		h.sendErrorResponse(w, r, http.StatusConflict, errcode.DomainTaken, "El dominio ya está asignado a otro propietario")
+	case err != nil:
+		h.sendJSON(w, http.StatusBadRequest, localizeError(w, r, ErrorResponse{Error: errcode.InvalidDomain, Message: "Dominio personalizado inválido", Errors: validationErrors(err)}))
+	default:
+		h.sendJSON(w, http.StatusOK, CustomDomainResponse{Host: domain.Host, Owner: domain.Owner})
+	}
+}
+
+// RemoveCustomDomain maneja DELETE /admin/custom-domains/{host}. Los enlaces del dominio se
+// conservan y vuelven a redirigir si se registra de nuevo.
+func (h *Handler) RemoveCustomDomain(w http.ResponseWriter, r *http.Request) {
+	if err := h.service.RemoveDomain(chi.URLParam(r, "host")); err != nil {
+		h.sendErrorResponse(w, r, http.StatusNotFound, errcode.DomainNotFound, "Dominio personalizado no registrado")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// TenantStatsResponse son los enlaces y visitas de un tenant; Tenant vacío es el espacio común
+type TenantStatsResponse struct {
+	Tenant string `json:"tenant"`
+	Host   string `json:"host,omitempty"`
+	Links  int    `json:"links"`
+	Clicks int64  `json:"clicks"`
+	// BotClicks son las visitas de bots incluidas en Clicks
+	BotClicks int64 `json:"bot_clicks"`
+}
+
+// TenantListResponse son las estadísticas de todos los tenants
+type TenantListResponse struct {
+	Tenants []TenantStatsResponse `json:"tenants"`
+}
+
+// ListTenants maneja GET /admin/tenants con los enlaces y visitas de cada tenant registrado,
+// precedidos por los del espacio común
+func (h *Handler) ListTenants(w http.ResponseWriter, r *http.Request) {
+	stats, err := h.service.TenantStatistics(r.Context())
+	if err != nil {
+		h.sendManagementError(w, r, err)
+		return
+	}
+	response := TenantListResponse{Tenants: make([]TenantStatsResponse, 0, len(stats))}
+	for _, tenant := range stats {
+		response.Tenants = append(response.Tenants, TenantStatsResponse{
+			Tenant: tenant.Tenant,
+			Host:   h.service.TenantHost(tenant.Tenant),
+			Links:  tenant.Links,
+			Clicks: tenant.Clicks,
+
+			BotClicks: tenant.BotClicks,
+		})
+	}
+	h.sendCacheableJSON(w, r, response)
+}
+
+// BrokenLinkResponse es un enlace cuyo destino se marcó como roto
+type BrokenLinkResponse struct {
+	ShortCode    string    `json:"short_code"`
+	LongURL      string    `json:"long_url"`
+	Owner        string    `json:"owner,omitempty"`
+	StatusCode   int       `json:"status_code,omitempty"`
+	Error        string    `json:"error,omitempty"`
+	Failures     int       `json:"failures"`
+	FailingSince time.Time `json:"failing_since"`
+	CheckedAt    time.Time `json:"checked_at"`
+}
+
+// BrokenLinksResponse es una página del informe de enlaces rotos
+type BrokenLinksResponse struct {
+	Links   []BrokenLinkResponse `json:"links"`
+	Total   int                  `json:"total"`
+	Page    int                  `json:"page"`
+	PerPage int                  `json:"per_page"`
+}
+
+// BrokenLinks maneja GET /admin/broken-links?owner=&domain=&tenant=&page=&per_page=, el informe
+// de los enlaces cuyo destino falla de forma persistente según el escáner de enlaces rotos
+func (h *Handler) BrokenLinks(w http.ResponseWriter, r *http.Request) {
+	tenant, ok := h.adminTenant(w, r)
+	if !ok {
+		return
+	}
+	params := r.URL.Query()
+	query := shortener.ListQuery{AnyOwner: true, Tenant: tenant, Domain: params.Get("domain"), Status: shortener.ListStatusBroken}
+	if owner := params.Get("owner"); owner != "" {
+		query.Owner, query.AnyOwner = owner, false
+	}
+
+	page, perPage, errs := pageParams(params)
+	if len(errs) > 0 {
+		h.sendQueryError(w, r, errors.Join(errs...))
+		return
+	}
+	query.Offset, query.Limit = (page-1)*perPage, perPage
+
+	result, err := h.service.ListLinks(r.Context(), actorFromRequest(r), query)
+	if err != nil {
+		if errors.As(err, new(*shortener.ValidationError)) {
+			h.sendQueryError(w, r, err)
+			return
+		}
+		h.sendManagementError(w, r, err)
+		return
+	}
+	response := BrokenLinksResponse{
+		Links:   make([]BrokenLinkResponse, 0, len(result.Links)),
+		Total:   result.Total,
+		Page:    page,
+		PerPage: perPage,
+	}
+	for _, link := range result.Links {
+		response.Links = append(response.Links, BrokenLinkResponse{
+			ShortCode:    link.ShortCode,
+			LongURL:      link.LongURL,
+			Owner:        link.Owner,
+			StatusCode:   link.Health.StatusCode,
+			Error:        link.Health.Error,
+			Failures:     link.Health.Failures,
+			FailingSince: link.Health.FailingSince,
+			CheckedAt:    link.Health.CheckedAt,
+		})
+	}
+
+	h.sendJSON(w, http.StatusOK, response)
+}
+
+// WithWebhookLog expone el log de entregas del despachador en GET /admin/webhooks/deliveries
+func WithWebhookLog(dispatcher *webhooks.Dispatcher) Option {
+	return func(h *Handler) {
+		h.webhooks = dispatcher
+	}
+}
+
+// WebhookDeliveryResponse es una entrega de un evento a un endpoint de webhook
+type WebhookDeliveryResponse struct {
+	ID         int64     `json:"id"`
+	EventID    string    `json:"event_id"`
+	Event      string    `json:"event"`
+	ShortCode  string    `json:"short_code"`
+	Endpoint   string    `json:"endpoint"`
+	Status     string    `json:"status"`
+	Attempts   int       `json:"attempts"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// WebhookDeliveriesResponse es una página del log de entregas de webhooks
+type WebhookDeliveriesResponse struct {
+	Deliveries []WebhookDeliveryResponse `json:"deliveries"`
+	Total      int                       `json:"total"`
+	Page       int                       `json:"page"`
+	PerPage    int                       `json:"per_page"`
+}
+
+// WebhookDeliveries maneja GET /admin/webhooks/deliveries?status=&event=&short_code=&page=&per_page=,
+// las entregas recientes de webhooks de la más reciente a la más antigua
+func (h *Handler) WebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	if h.webhooks == nil {
+		h.sendErrorResponse(w, r, http.StatusNotFound, errcode.WebhooksDisabled, "No hay webhooks configurados")
+		return
+	}
+	params := r.URL.Query()
+	query := webhooks.DeliveryQuery{
+		Status:    params.Get("status"),
+		Event:     params.Get("event"),
+		ShortCode: params.Get("short_code"),
+	}
+
+	page, perPage, errs := pageParams(params)
+	if perPage < 1 || perPage > shortener.MaxListLimit {
+		errs = append(errs, &shortener.ValidationError{Field: "per_page", Value: params.Get("per_page"),
+			Msg: fmt.Sprintf("debe estar entre 1 y %d", shortener.MaxListLimit)})
+	}
+	switch query.Status {
+	case "", webhooks.StatusPending, webhooks.StatusDelivered, webhooks.StatusFailed:
+	default:
+		errs = append(errs, &shortener.ValidationError{Field: "status", Value: query.Status,
+			Msg: "debe ser pending, delivered o failed"})
+	}
+	if query.Event != "" && !validEventType(query.Event) {
+		errs = append(errs, &shortener.ValidationError{Field: "event", Value: query.Event,
+			Msg: "debe ser " + strings.Join(shortener.EventTypes, ", ")})
+	}
+	if len(errs) > 0 {
+		h.sendQueryError(w, r, errors.Join(errs...))
+		return
+	}
+	query.Offset, query.Limit = (page-1)*perPage, perPage
+
+	deliveries, total := h.webhooks.Deliveries(query)
+	response := WebhookDeliveriesResponse{
+		Deliveries: make([]WebhookDeliveryResponse, 0, len(deliveries)),
+		Total:      total,
+		Page:       page,
+		PerPage:    perPage,
+	}
+	for _, delivery := range deliveries {
+		response.Deliveries = append(response.Deliveries, webhookDeliveryResponse(delivery))
+	}
+
+	h.sendJSON(w, http.StatusOK, response)
+}
+
+// webhookDeliveryResponse convierte una entrega del log en su representación HTTP
+func webhookDeliveryResponse(delivery webhooks.Delivery) WebhookDeliveryResponse {
+	return WebhookDeliveryResponse{
+		ID:         delivery.ID,
+		EventID:    delivery.EventID,
+		Event:      delivery.Event,
+		ShortCode:  delivery.ShortCode,
+		Endpoint:   delivery.Endpoint,
+		Status:     delivery.Status,
+		Attempts:   delivery.Attempts,
+		StatusCode: delivery.StatusCode,
+		Error:      delivery.Error,
+		CreatedAt:  delivery.CreatedAt,
+		UpdatedAt:  delivery.UpdatedAt,
+	}
+}
+
+// validEventType indica si value es un tipo de evento de los enlaces
+func validEventType(value string) bool {
+	for _, eventType := range shortener.EventTypes {
+		if value == eventType {
+			return true
+		}
+	}
+	return false
+}
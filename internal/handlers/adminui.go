@@ -0,0 +1,527 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"acortador-urls/internal/auth"
+	"acortador-urls/internal/shortener"
+)
+
+// AdminUIPath es la ruta en la que se monta el panel de administración
+const AdminUIPath = "/admin/ui"
+
+// adminSessionCookie guarda el token del administrador que inició sesión en el panel
+const adminSessionCookie = "admin_session"
+
+// maxAdminFormBytes limita los formularios del panel salvo la importación, que se lee en streaming
+const maxAdminFormBytes = 64 << 10
+
+//go:embed ui/*.html
+var adminUIFiles embed.FS
+
+// adminUITemplates son las páginas del panel; cada una define su bloque "content" dentro de
+// la plantilla común "layout"
+var adminUITemplates = func() map[string]*template.Template {
+	funcs := template.FuncMap{
+		"toggle": func(page adminUIPage, link shortener.Link) adminUIToggle {
+			return adminUIToggle{Base: page.Base, CSRF: page.CSRF, Link: link}
+		},
+	}
+	pages := make(map[string]*template.Template)
+	for _, name := range []string{"login", "links", "link", "import"} {
+		pages[name] = template.Must(template.New(name).Funcs(funcs).ParseFS(adminUIFiles,
+			"ui/layout.html", "ui/partials.html", "ui/"+name+".html"))
+	}
+	return pages
+}()
+
+// csrfKey firma los tokens CSRF del panel; es aleatoria por proceso, así que reiniciar el
+// servidor invalida los formularios abiertos pero no las sesiones
+var csrfKey = func() []byte {
+	key := make([]byte, 32)
+	rand.Read(key)
+	return key
+}()
+
+// csrfToken deriva el token CSRF de la sesión: solo quien puede leer la página la conoce
+func csrfToken(session string) string {
+	mac := hmac.New(sha256.New, csrfKey)
+	mac.Write([]byte(session))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// adminUIPage son los datos comunes de las páginas del panel
+type adminUIPage struct {
+	Title string
+	Base  string
+	User  string
+	CSRF  string
+	Flash string
+	Error string
+	Data  interface{}
+	// OIDC es el nombre del proveedor de identidad con el que se puede iniciar sesión
+	OIDC string
+}
+
+// adminUIToggle son los datos del botón para desactivar o reactivar un enlace
+type adminUIToggle struct {
+	Base string
+	CSRF string
+	Link shortener.Link
+}
+
+// adminUILinks son los datos del listado de enlaces
+type adminUILinks struct {
+	Stats    shortener.Stats
+	Links    []shortener.Link
+	Total    int
+	Page     int
+	Prev     string
+	Next     string
+	Owner    string
+	Domain   string
+	Status   string
+	Sort     string
+	Statuses []string
+	Sorts    []string
+	// Collections agrupan los enlaces del tenant con sus totales; Collection es el ID filtrado
+	// en texto para mantener la selección del formulario
+	Collections     []shortener.CollectionStats
+	CollectionNames map[int64]string
+	Collection      string
+}
+
+// adminUILink son los datos del detalle de un enlace
+type adminUILink struct {
+	Link     shortener.Link
+	ShortURL string
+}
+
+// adminUIFlashes son los avisos mostrados tras redirigir después de un formulario; se indican
+// por clave para que un enlace no pueda inyectar texto arbitrario en el panel
+var adminUIFlashes = map[string]string{
+	"created":  "Enlace %s creado",
+	"disabled": "Enlace %s desactivado",
+	"enabled":  "Enlace %s reactivado",
+}
+
+// AdminUI retorna el panel web de administración, que se monta en AdminUIPath. Permite listar
+// enlaces, ver sus estadísticas, crearlos, desactivarlos e importar CSV. Como el navegador no
+// puede enviar la cabecera Authorization, el administrador inicia sesión con su token JWT, que
+// se verifica igual que en Authenticate y se guarda en una cookie HttpOnly limitada al panel;
+// los formularios llevan un token CSRF derivado de esa cookie.
+func (h *Handler) AdminUI(tokens *auth.TokenManager) http.Handler {
+	r := chi.NewRouter()
+	r.Get("/login", h.adminUILogin)
+	r.Post("/login", h.adminUILoginSubmit(tokens))
+	r.Group(func(r chi.Router) {
+		r.Use(adminUISession(tokens))
+		r.Get("/", h.adminUIListLinks)
+		r.Get("/links/{short_code}", h.adminUIShowLink)
+		r.Group(func(r chi.Router) {
+			r.Use(adminUICSRF)
+			r.Post("/logout", h.adminUILogout)
+			r.Post("/links", h.adminUICreateLink)
+			r.Post("/links/{short_code}/disable", h.adminUISetDisabled(true))
+			r.Post("/links/{short_code}/enable", h.adminUISetDisabled(false))
+		})
+		r.Get("/import", h.adminUIImport)
+		r.Post("/import", h.adminUIImportSubmit)
+	})
+	return r
+}
+
+// adminUISession exige una sesión de administrador válida: sin ella redirige al inicio de
+// sesión
+func adminUISession(tokens *auth.TokenManager) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			cookie, err := r.Cookie(adminSessionCookie)
+			if err != nil {
+				http.Redirect(w, r, AdminUIPath+"/login", http.StatusSeeOther)
+				return
+			}
+			claims, err := tokens.Verify(cookie.Value)
+			if err != nil || !claims.IsAdmin() {
+				clearAdminSession(w, r)
+				http.Redirect(w, r, AdminUIPath+"/login", http.StatusSeeOther)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(auth.WithClaims(r.Context(), claims)))
+		})
+	}
+}
+
+// adminUICSRF limita el formulario y comprueba su token CSRF. Debe ir después de
+// adminUISession. La importación, que llega como multipart, lo comprueba al leer sus partes.
+func adminUICSRF(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, maxAdminFormBytes)
+		if !validCSRF(r, r.PostFormValue("csrf")) {
+			http.Error(w, "Token CSRF inválido, recarga la página", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// validCSRF indica si token corresponde a la sesión de la petición
+func validCSRF(r *http.Request, token string) bool {
+	cookie, err := r.Cookie(adminSessionCookie)
+	return err == nil && hmac.Equal([]byte(token), []byte(csrfToken(cookie.Value)))
+}
+
+// setAdminSession guarda el token en la cookie de sesión del panel hasta que expira
+func setAdminSession(w http.ResponseWriter, r *http.Request, token string, claims *auth.Claims) {
+	cookie := &http.Cookie{
+		Name:     adminSessionCookie,
+		Value:    token,
+		Path:     AdminUIPath,
+		HttpOnly: true,
+		Secure:   RequestScheme(r) == "https",
+		SameSite: http.SameSiteStrictMode,
+	}
+	if claims.ExpiresAt > 0 {
+		cookie.Expires = time.Unix(claims.ExpiresAt, 0)
+	}
+	http.SetCookie(w, cookie)
+}
+
+// clearAdminSession borra la cookie de sesión del panel
+func clearAdminSession(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     adminSessionCookie,
+		Path:     AdminUIPath,
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   RequestScheme(r) == "https",
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+// renderAdminUI completa los datos comunes de la página y la escribe con el estado indicado.
+// La plantilla se ejecuta sobre un buffer para no enviar una página a medias si falla.
+func (h *Handler) renderAdminUI(w http.ResponseWriter, r *http.Request, status int, name string, page adminUIPage) {
+	page.Base = AdminUIPath
+	if h.oidc != nil {
+		page.OIDC = h.oidc.Name
+	}
+	if claims, ok := auth.ClaimsFromContext(r.Context()); ok {
+		page.User = claims.Subject
+	}
+	if cookie, err := r.Cookie(adminSessionCookie); err == nil && page.User != "" {
+		page.CSRF = csrfToken(cookie.Value)
+	}
+
+	var buf bytes.Buffer
+	if err := adminUITemplates[name].ExecuteTemplate(&buf, "layout", page); err != nil {
+		log.Printf("Error renderizando el panel %s: %v", name, err)
+		http.Error(w, "Error interno", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.WriteHeader(status)
+	w.Write(buf.Bytes())
+}
+
+// adminUIRedirect vuelve a path tras un formulario mostrando el aviso flash sobre shortCode
+func adminUIRedirect(w http.ResponseWriter, r *http.Request, path, flash, shortCode string) {
+	target := AdminUIPath + path
+	if flash != "" {
+		target += "?" + url.Values{"done": {flash}, "code": {shortCode}}.Encode()
+	}
+	http.Redirect(w, r, target, http.StatusSeeOther)
+}
+
+// adminUILinkRedirect vuelve al detalle del enlace mostrando el aviso flash; los enlaces de un
+// dominio personalizado llevan el dominio en la query
+func adminUILinkRedirect(w http.ResponseWriter, r *http.Request, flash string, link shortener.Link) {
+	query := url.Values{"done": {flash}, "code": {link.ShortCode}}
+	if link.Domain != "" {
+		query.Set(DomainParam, link.Domain)
+	}
+	http.Redirect(w, r, AdminUIPath+"/links/"+url.PathEscape(link.ShortCode)+"?"+query.Encode(), http.StatusSeeOther)
+}
+
+// adminUIFlash es el aviso indicado en la query tras una redirección
+func adminUIFlash(r *http.Request) string {
+	format, ok := adminUIFlashes[r.URL.Query().Get("done")]
+	if !ok {
+		return ""
+	}
+	return fmt.Sprintf(format, r.URL.Query().Get("code"))
+}
+
+// adminUILogin maneja GET /admin/ui/login
+func (h *Handler) adminUILogin(w http.ResponseWriter, r *http.Request) {
+	h.renderAdminUI(w, r, http.StatusOK, "login", adminUIPage{Title: "Iniciar sesión"})
+}
+
+// adminUILoginSubmit maneja POST /admin/ui/login verificando el token pegado en el formulario
+func (h *Handler) adminUILoginSubmit(tokens *auth.TokenManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, maxAdminFormBytes)
+		token := strings.TrimSpace(r.PostFormValue("token"))
+		claims, err := tokens.Verify(token)
+		switch {
+		case errors.Is(err, auth.ErrExpiredToken):
+			h.renderAdminUI(w, r, http.StatusUnauthorized, "login", adminUIPage{Title: "Iniciar sesión", Error: "El token ha expirado"})
+		case err != nil:
+			h.renderAdminUI(w, r, http.StatusUnauthorized, "login", adminUIPage{Title: "Iniciar sesión", Error: "Token inválido"})
+		case !claims.IsAdmin():
+			h.renderAdminUI(w, r, http.StatusForbidden, "login", adminUIPage{Title: "Iniciar sesión", Error: "Se requieren permisos de administrador"})
+		default:
+			setAdminSession(w, r, token, claims)
+			adminUIRedirect(w, r, "/", "", "")
+		}
+	}
+}
+
+// adminUILogout maneja POST /admin/ui/logout
+func (h *Handler) adminUILogout(w http.ResponseWriter, r *http.Request) {
+	clearAdminSession(w, r)
+	adminUIRedirect(w, r, "/login", "", "")
+}
+
+// adminUISorts son las opciones de orden del listado, empezando por la usada por defecto
+var adminUISorts = func() []string {
+	sorts := make([]string, 0, 2*len(shortener.ListSortFields))
+	for _, field := range shortener.ListSortFields {
+		sorts = append(sorts, "-"+field, field)
+	}
+	return sorts
+}()
+
+// adminUIListLinks maneja GET /admin/ui/ con el listado filtrado de enlaces y las estadísticas
+func (h *Handler) adminUIListLinks(w http.ResponseWriter, r *http.Request) {
+	h.renderAdminUILinks(w, r, http.StatusOK, adminUIPage{Flash: adminUIFlash(r)})
+}
+
+// renderAdminUILinks escribe el listado; también se usa para mostrar los errores al crear
+func (h *Handler) renderAdminUILinks(w http.ResponseWriter, r *http.Request, status int, page adminUIPage) {
+	params := r.URL.Query()
+	data := adminUILinks{
+		Owner:      params.Get("owner"),
+		Domain:     params.Get("domain"),
+		Status:     params.Get("status"),
+		Sort:       params.Get("sort"),
+		Collection: params.Get("collection_id"),
+		Statuses:   []string{shortener.ListStatusActive, shortener.ListStatusExpired, shortener.ListStatusDisabled, shortener.ListStatusBroken},
+		Sorts:      adminUISorts,
+		Page:       1,
+	}
+	if data.Sort == "" {
+		data.Sort = adminUISorts[0]
+	}
+	if value, err := strconv.Atoi(params.Get("page")); err == nil && value > 1 {
+		data.Page = value
+	}
+	page.Title = "Enlaces"
+	page.Data = &data
+
+	stats, err := h.service.GetStats(r.Context())
+	if err != nil {
+		status, response := managementErrorResponse(err)
+		page.Error = response.Message
+		h.renderAdminUI(w, r, status, "links", page)
+		return
+	}
+	data.Stats = stats
+
+	collections, err := h.service.ListCollections(r.Context(), actorFromRequest(r), h.tenant(r))
+	if err != nil {
+		status, response := managementErrorResponse(err)
+		page.Error = response.Message
+		h.renderAdminUI(w, r, status, "links", page)
+		return
+	}
+	data.Collections = collections
+	data.CollectionNames = make(map[int64]string, len(collections))
+	for _, collection := range collections {
+		data.CollectionNames[collection.ID] = collection.Name
+	}
+
+	query := shortener.ListQuery{
+		Owner:    data.Owner,
+		AnyOwner: data.Owner == "",
+		Tenant:   h.tenant(r),
+		Domain:   data.Domain,
+		Status:   data.Status,
+		Sort:     data.Sort,
+		Offset:   (data.Page - 1) * shortener.DefaultListLimit,
+		Limit:    shortener.DefaultListLimit,
+	}
+	if id, err := strconv.ParseInt(data.Collection, 10, 64); err == nil {
+		query.CollectionID = id
+	}
+	result, err := h.service.ListLinks(r.Context(), actorFromRequest(r), query)
+	if err != nil {
+		status, response := managementErrorResponse(err)
+		page.Error = response.Message
+		h.renderAdminUI(w, r, status, "links", page)
+		return
+	}
+	data.Links, data.Total = result.Links, result.Total
+
+	pageURL := func(n int) string {
+		values := url.Values{"page": {strconv.Itoa(n)}}
+		for _, key := range []string{"owner", "domain", "status", "sort", "collection_id"} {
+			if value := params.Get(key); value != "" {
+				values.Set(key, value)
+			}
+		}
+		return AdminUIPath + "/?" + values.Encode()
+	}
+	if data.Page > 1 {
+		data.Prev = pageURL(data.Page - 1)
+	}
+	if data.Page*shortener.DefaultListLimit < data.Total {
+		data.Next = pageURL(data.Page + 1)
+	}
+	h.renderAdminUI(w, r, status, "links", page)
+}
+
+// adminUICreateLink maneja POST /admin/ui/links creando el enlace a nombre del administrador
+func (h *Handler) adminUICreateLink(w http.ResponseWriter, r *http.Request) {
+	input := shortener.ShortenInput{
+		LongURL: strings.TrimSpace(r.PostFormValue("long_url")),
+		Alias:   strings.TrimSpace(r.PostFormValue("alias")),
+		Owner:   ownerFromRequest(r),
+		Tenant:  h.tenant(r),
+	}
+	if value := r.PostFormValue("expires_at"); value != "" {
+		// datetime-local no lleva zona horaria; se interpreta en la del servidor
+		expiresAt, err := time.ParseInLocation("2006-01-02T15:04", value, time.Local)
+		if err != nil || !expiresAt.After(time.Now()) {
+			h.renderAdminUILinks(w, r, http.StatusBadRequest, adminUIPage{Error: "La expiración debe ser una fecha futura"})
+			return
+		}
+		input.TTL = time.Until(expiresAt)
+	}
+
+	link, _, err := h.service.Shorten(r.Context(), input)
+	if err != nil {
+		status, _, message := shortenErrorStatus(err)
+		h.renderAdminUILinks(w, r, status, adminUIPage{Error: message})
+		return
+	}
+	adminUILinkRedirect(w, r, "created", link)
+}
+
+// adminUIShowLink maneja GET /admin/ui/links/{short_code} con el detalle de un enlace
+func (h *Handler) adminUIShowLink(w http.ResponseWriter, r *http.Request) {
+	page := adminUIPage{Flash: adminUIFlash(r)}
+	link, err := h.service.GetLink(r.Context(), h.managedLinkKey(r))
+	if err != nil {
+		status, response := managementErrorResponse(err)
+		page.Title, page.Error = "Enlace", response.Message
+		h.renderAdminUI(w, r, status, "link", page)
+		return
+	}
+	page.Title = link.ShortCode
+	page.Data = adminUILink{Link: link, ShortURL: h.shortURL(r, link)}
+	h.renderAdminUI(w, r, http.StatusOK, "link", page)
+}
+
+// adminUISetDisabled maneja POST /admin/ui/links/{short_code}/disable y /enable
+func (h *Handler) adminUISetDisabled(disable bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := h.managedLinkKey(r)
+		var link shortener.Link
+		var err error
+		flash := "enabled"
+		if disable {
+			link, err = h.service.DisableURL(r.Context(), actorFromRequest(r), key, strings.TrimSpace(r.PostFormValue("reason")))
+			flash = "disabled"
+		} else {
+			link, err = h.service.EnableURL(r.Context(), actorFromRequest(r), key)
+		}
+		if err != nil {
+			status, response := managementErrorResponse(err)
+			h.renderAdminUI(w, r, status, "link", adminUIPage{Title: "Enlace", Error: response.Message})
+			return
+		}
+		adminUILinkRedirect(w, r, flash, link)
+	}
+}
+
+// adminUIImport maneja GET /admin/ui/import
+func (h *Handler) adminUIImport(w http.ResponseWriter, r *http.Request) {
+	h.renderAdminUI(w, r, http.StatusOK, "import", adminUIPage{Title: "Importar"})
+}
+
+// adminUIImportSubmit maneja POST /admin/ui/import. El formulario multipart se lee parte a
+// parte, así que el archivo se importa en streaming como en POST /admin/import; el campo csrf
+// debe llegar antes que el archivo, como ocurre con el formulario del panel.
+func (h *Handler) adminUIImportSubmit(w http.ResponseWriter, r *http.Request) {
+	page := adminUIPage{Title: "Importar"}
+	reader, err := r.MultipartReader()
+	if err != nil {
+		page.Error = "El formulario debe enviarse como multipart/form-data"
+		h.renderAdminUI(w, r, http.StatusBadRequest, "import", page)
+		return
+	}
+	csrfValid := false
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			page.Error = "Selecciona un archivo"
+			h.renderAdminUI(w, r, http.StatusBadRequest, "import", page)
+			return
+		}
+		if err != nil {
+			page.Error = "Formulario inválido"
+			h.renderAdminUI(w, r, http.StatusBadRequest, "import", page)
+			return
+		}
+
+		switch part.FormName() {
+		case "csrf":
+			value, _ := io.ReadAll(io.LimitReader(part, 256))
+			csrfValid = validCSRF(r, string(value))
+		case "file":
+			if !csrfValid {
+				http.Error(w, "Token CSRF inválido, recarga la página", http.StatusForbidden)
+				return
+			}
+			format := ""
+			if strings.HasSuffix(strings.ToLower(part.FileName()), ".tsv") {
+				format = "tsv"
+			}
+			comma := tabularSeparator(format, part.Header.Get("Content-Type"))
+			response, err := h.importLinks(r.Context(), part, comma, ownerFromRequest(r), h.tenant(r))
+			if err != nil {
+				if status, _, message, ok := storeErrorStatus(err); ok {
+					page.Error = message
+					h.renderAdminUI(w, r, status, "import", page)
+					return
+				}
+				page.Error = err.Error()
+				h.renderAdminUI(w, r, http.StatusBadRequest, "import", page)
+				return
+			}
+			page.Data = response
+			h.renderAdminUI(w, r, http.StatusOK, "import", page)
+			return
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"acortador-urls/internal/backup"
+	"acortador-urls/internal/errcode"
+)
+
+// WithBackups expone las copias de seguridad del gestor en GET/POST /admin/backups y
+// POST /admin/restore
+func WithBackups(manager *backup.Manager) Option {
+	return func(h *Handler) {
+		h.backups = manager
+	}
+}
+
+// BackupResponse describe una copia de seguridad guardada
+type BackupResponse struct {
+	Name      string    `json:"name"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"created_at"`
+	// Links solo se informa al crear la copia
+	Links int `json:"links,omitempty"`
+}
+
+// BackupListResponse son las copias guardadas, de la más reciente a la más antigua
+type BackupListResponse struct {
+	Backups []BackupResponse `json:"backups"`
+}
+
+// RestoreRequest indica la copia que se restaura
+type RestoreRequest struct {
+	Snapshot string `json:"snapshot" example:"links-20240101T030000.000Z.jsonl.gz"`
+}
+
+// RestoreResponse resume una restauración
+type RestoreResponse struct {
+	Snapshot string `json:"snapshot"`
+	Restored int    `json:"restored"`
+}
+
+// backupResponse convierte una copia en su representación HTTP
+func backupResponse(snapshot backup.Snapshot) BackupResponse {
+	return BackupResponse{Name: snapshot.Name, Size: snapshot.Size, CreatedAt: snapshot.CreatedAt, Links: snapshot.Links}
+}
+
+// backupsEnabled responde 404 si no hay copias de seguridad configuradas
+func (h *Handler) backupsEnabled(w http.ResponseWriter, r *http.Request) bool {
+	if h.backups == nil {
+		h.sendErrorResponse(w, r, http.StatusNotFound, errcode.BackupsDisabled, "No hay copias de seguridad configuradas")
+		return false
+	}
+	return true
+}
+
+// ListBackups maneja GET /admin/backups
+func (h *Handler) ListBackups(w http.ResponseWriter, r *http.Request) {
+	if !h.backupsEnabled(w, r) {
+		return
+	}
+	snapshots, err := h.backups.Snapshots(r.Context())
+	if err != nil {
+		h.sendBackupError(w, r, err)
+		return
+	}
+	response := BackupListResponse{Backups: make([]BackupResponse, 0, len(snapshots))}
+	for _, snapshot := range snapshots {
+		response.Backups = append(response.Backups, backupResponse(snapshot))
+	}
+
+	h.sendJSON(w, http.StatusOK, response)
+}
+
+// CreateBackup maneja POST /admin/backups creando una copia en el momento, además de las
+// periódicas
+func (h *Handler) CreateBackup(w http.ResponseWriter, r *http.Request) {
+	if !h.backupsEnabled(w, r) {
+		return
+	}
+	snapshot, err := h.backups.Backup(r.Context())
+	if err != nil && snapshot.Name == "" {
+		h.sendBackupError(w, r, err)
+		return
+	}
+	if err != nil {
+		log.Printf("Limpieza de copias de seguridad antiguas fallida: %v", err)
+	}
+
+	h.sendJSON(w, http.StatusCreated, backupResponse(snapshot))
+}
+
+// RestoreBackup maneja POST /admin/restore cargando los enlaces de la copia indicada
+func (h *Handler) RestoreBackup(w http.ResponseWriter, r *http.Request) {
+	if !h.backupsEnabled(w, r) {
+		return
+	}
+	var req RestoreRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.sendDecodeError(w, r, err)
+		return
+	}
+
+	restored, err := h.backups.Restore(r.Context(), req.Snapshot)
+	if err != nil {
+		log.Printf("Restauración de %q interrumpida tras %d enlaces: %v", req.Snapshot, restored, err)
+		h.sendBackupError(w, r, err)
+		return
+	}
+	log.Printf("Restauración de %q: %d enlaces", req.Snapshot, restored)
+
+	h.sendJSON(w, http.StatusOK, RestoreResponse{Snapshot: req.Snapshot, Restored: restored})
+}
+
+// sendBackupError responde a un fallo de las copias de seguridad; el resto de fallos vienen del
+// destino de las copias o del almacén y se tratan como una indisponibilidad temporal
+func (h *Handler) sendBackupError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, backup.ErrSnapshotNotFound):
+		h.sendErrorResponse(w, r, http.StatusNotFound, errcode.SnapshotNotFound, "Copia de seguridad no encontrada")
+	case errors.Is(err, backup.ErrInvalidSnapshot):
+		h.sendErrorResponse(w, r, http.StatusUnprocessableEntity, errcode.InvalidSnapshot, fmt.Sprintf("Copia de seguridad inválida: %v", err))
+	default:
+		log.Printf("Error en las copias de seguridad: %v", err)
+		h.sendErrorResponse(w, r, http.StatusServiceUnavailable, errcode.ServiceUnavailable,
+			"El destino de las copias de seguridad no está disponible")
+	}
+}
@@ -0,0 +1,343 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"acortador-urls/internal/errcode"
+	"acortador-urls/internal/shortener"
+)
+
+// BatchShortenRequest representa la petición POST /shorten/batch
+type BatchShortenRequest struct {
+	URLs []ShortenRequest `json:"urls"`
+}
+
+// BatchItemResult representa el resultado de un elemento del lote
+type BatchItemResult struct {
+	Index     int            `json:"index"`
+	LongURL   string         `json:"long_url"`
+	ShortCode string         `json:"short_code,omitempty"`
+	ShortURL  string         `json:"short_url,omitempty"`
+	ExpiresAt *time.Time     `json:"expires_at,omitempty"`
+	Error     *ErrorResponse `json:"error,omitempty"`
+}
+
+// BatchShortenResponse resume el procesamiento del lote con resultados por elemento
+type BatchShortenResponse struct {
+	Results   []BatchItemResult `json:"results"`
+	Succeeded int               `json:"succeeded"`
+	Failed    int               `json:"failed"`
+}
+
+// ShortenBatch maneja POST /shorten/batch; cada URL se procesa de forma independiente
+// y los errores de validación se reportan por elemento sin abortar el lote. Con
+// WithBatchRateLimit cada URL consume un token del limitador, como una petición a /shorten.
+func (h *Handler) ShortenBatch(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Content-Type") != "application/json" {
+		h.sendErrorResponse(w, r, http.StatusBadRequest, errcode.InvalidContentType, "Content-Type debe ser application/json")
+		return
+	}
+
+	var req BatchShortenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.sendDecodeError(w, r, err)
+		return
+	}
+
+	// Validación temprana del tamaño del lote
+	switch {
+	case len(req.URLs) == 0:
+		h.sendErrorResponse(w, r, http.StatusBadRequest, errcode.EmptyBatch, "El lote debe contener al menos una URL")
+		return
+	case len(req.URLs) > h.maxBatchSize:
+		h.sendErrorResponse(w, r, http.StatusRequestEntityTooLarge, errcode.BatchTooLarge,
+			fmt.Sprintf("El lote no puede superar %d URLs", h.maxBatchSize))
+		return
+	}
+
+	owner, client, tenant, workspace := ownerFromRequest(r), h.quotaClient(r), h.tenant(r), workspaceFromRequest(r)
+	apiKey := apiKeyFromRequest(r)
+	limitKey := rateLimitKey(r, h.service.KnownAPIKey)
+	response := BatchShortenResponse{
+		Results: make([]BatchItemResult, 0, len(req.URLs)),
+	}
+
+	for i, item := range req.URLs {
+		result := BatchItemResult{Index: i, LongURL: item.LongURL}
+
+		// La primera URL ya la cobró el middleware con la petición
+		if h.batchLimiter != nil && i > 0 {
+			if allowed, _ := h.batchLimiter.Allow(limitKey); !allowed {
+				result.Error = itemError(r, ErrorResponse{Error: errcode.RateLimited, Message: "Demasiadas peticiones, intenta de nuevo más tarde"})
+				response.Failed++
+				response.Results = append(response.Results, result)
+				continue
+			}
+		}
+
+		input := item.toInput(owner)
+		input.Client = client
+		input.APIKey = apiKey
+		input.Tenant = tenant
+		input.Workspace = workspace
+		link, _, err := h.service.Shorten(r.Context(), input)
+		if err != nil {
+			_, errResp := shortenErrorResponse(err)
+			result.Error = itemError(r, errResp)
+			response.Failed++
+		} else {
+			result.ShortCode = link.ShortCode
+			result.ShortURL = h.shortURL(r, link)
+			if !link.ExpiresAt.IsZero() {
+				result.ExpiresAt = &link.ExpiresAt
+			}
+			response.Succeeded++
+		}
+
+		response.Results = append(response.Results, result)
+	}
+
+	h.sendJSON(w, http.StatusOK, response)
+}
+
+// ResolveRequest representa la petición POST /api/resolve
+type ResolveRequest struct {
+	Codes []string `json:"codes"`
+}
+
+// ResolveItemResult describe el destino y metadatos de un código corto sin seguir la redirección
+type ResolveItemResult struct {
+	ShortCode string `json:"short_code"`
+	Found     bool   `json:"found"`
+	// LongURL se omite en los enlaces con contraseña, firmados, desactivados o que no redirigen
+	// desde la red del llamador
+	LongURL   string     `json:"long_url,omitempty"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Expired   bool       `json:"expired,omitempty"`
+	// PasswordProtected indica que el destino se oculta hasta aportar la contraseña
+	PasswordProtected bool `json:"password_protected,omitempty"`
+	// Disabled indica un enlace desactivado; su destino también se oculta
+	Disabled       bool           `json:"disabled,omitempty"`
+	DisabledReason string         `json:"disabled_reason,omitempty"`
+	Error          *ErrorResponse `json:"error,omitempty"`
+}
+
+// ResolveResponse agrupa los resultados de la resolución masiva
+type ResolveResponse struct {
+	Results []ResolveItemResult `json:"results"`
+}
+
+// ResolveBatch maneja POST /api/resolve expandiendo varios códigos cortos en una sola respuesta
+func (h *Handler) ResolveBatch(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Content-Type") != "application/json" {
+		h.sendErrorResponse(w, r, http.StatusBadRequest, errcode.InvalidContentType, "Content-Type debe ser application/json")
+		return
+	}
+
+	var req ResolveRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.sendDecodeError(w, r, err)
+		return
+	}
+
+	switch {
+	case len(req.Codes) == 0:
+		h.sendErrorResponse(w, r, http.StatusBadRequest, errcode.EmptyBatch, "Se debe indicar al menos un código")
+		return
+	case len(req.Codes) > h.maxBatchSize:
+		h.sendErrorResponse(w, r, http.StatusRequestEntityTooLarge, errcode.BatchTooLarge,
+			fmt.Sprintf("No se pueden resolver más de %d códigos por petición", h.maxBatchSize))
+		return
+	}
+
+	now := time.Now()
+	response := ResolveResponse{
+		Results: make([]ResolveItemResult, 0, len(req.Codes)),
+	}
+
+	for _, code := range req.Codes {
+		result := ResolveItemResult{ShortCode: code}
+
+		link, err := h.service.GetLink(r.Context(), h.tenantCode(r, code))
+		switch {
+		case errors.Is(err, shortener.ErrURLNotFound):
+			result.Error = itemError(r, ErrorResponse{Error: errcode.NotFound, Message: "Código corto no encontrado"})
+		case errors.Is(err, shortener.ErrEmptyURL):
+			result.Error = itemError(r, ErrorResponse{Error: errcode.MissingCode, Message: "Código corto requerido"})
+		case err != nil:
+			if _, code, message, ok := storeErrorStatus(err); ok {
+				result.Error = itemError(r, ErrorResponse{Error: code, Message: message})
+				break
+			}
+			result.Error = itemError(r, ErrorResponse{Error: errcode.Internal, Message: fmt.Sprintf("Error interno: %v", err)})
+		default:
+			result.Found = true
+			result.PasswordProtected = link.PasswordProtected()
+			result.Disabled, result.DisabledReason = link.IsDisabled(), link.DisabledReason
+			if !h.hidesDestination(r, link) {
+				result.LongURL = link.LongURL
+			}
+			result.CreatedAt = &link.CreatedAt
+			if !link.ExpiresAt.IsZero() {
+				result.ExpiresAt = &link.ExpiresAt
+				result.Expired = link.IsExpired(now)
+			}
+		}
+
+		response.Results = append(response.Results, result)
+	}
+
+	h.sendJSON(w, http.StatusOK, response)
+}
+
+// BatchUpdateRequest representa la petición POST /api/urls:batchUpdate: los códigos y los
+// cambios que se aplican a todos ellos; los campos ausentes no cambian
+type BatchUpdateRequest struct {
+	ShortCodes []string `json:"short_codes"`
+	// Tags reemplaza las etiquetas; [] las elimina
+	Tags *[]string `json:"tags,omitempty"`
+	// ExpiresAt y TTLSeconds renuevan la expiración como POST /api/urls/{short_code}/extend
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+	TTLSeconds   int64      `json:"ttl_seconds,omitempty" example:"2592000"`
+	RedirectType *string    `json:"redirect_type,omitempty" example:"temporary"`
+}
+
+// toChanges convierte los cambios de la petición en los del servicio
+func (req BatchUpdateRequest) toChanges() shortener.LinkChanges {
+	changes := shortener.LinkChanges{Tags: req.Tags, RedirectType: req.RedirectType}
+	if req.ExpiresAt != nil || req.TTLSeconds != 0 {
+		changes.Expiry = &shortener.Extension{TTL: time.Duration(req.TTLSeconds) * time.Second}
+		if req.ExpiresAt != nil {
+			changes.Expiry.ExpiresAt = *req.ExpiresAt
+		}
+	}
+	return changes
+}
+
+// BatchUpdateResult es el resultado de actualizar uno de los enlaces del lote
+type BatchUpdateResult struct {
+	ShortCode string         `json:"short_code"`
+	Updated   bool           `json:"updated"`
+	Link      *LinkResponse  `json:"link,omitempty"`
+	Error     *ErrorResponse `json:"error,omitempty"`
+}
+
+// BatchUpdateResponse resume la actualización del lote con resultados por elemento
+type BatchUpdateResponse struct {
+	Results   []BatchUpdateResult `json:"results"`
+	Succeeded int                 `json:"succeeded"`
+	Failed    int                 `json:"failed"`
+}
+
+// BatchDeleteRequest representa la petición POST /api/urls:batchDelete
+type BatchDeleteRequest struct {
+	ShortCodes []string `json:"short_codes"`
+}
+
+// BatchDeleteResult es el resultado de eliminar uno de los enlaces del lote
+type BatchDeleteResult struct {
+	ShortCode string         `json:"short_code"`
+	Deleted   bool           `json:"deleted"`
+	Error     *ErrorResponse `json:"error,omitempty"`
+}
+
+// BatchDeleteResponse resume la eliminación del lote con resultados por elemento
+type BatchDeleteResponse struct {
+	Results   []BatchDeleteResult `json:"results"`
+	Succeeded int                 `json:"succeeded"`
+	Failed    int                 `json:"failed"`
+}
+
+// BatchUpdateURLs maneja POST /api/urls:batchUpdate aplicando los mismos cambios a varios
+// enlaces. Cada enlace se actualiza entero o no se actualiza, y los enlaces ajenos, inexistentes
+// o que no admiten los cambios se reportan por elemento sin abortar el lote.
+func (h *Handler) BatchUpdateURLs(w http.ResponseWriter, r *http.Request) {
+	var req BatchUpdateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.sendDecodeError(w, r, err)
+		return
+	}
+	if !h.checkBatchCodes(w, r, req.ShortCodes, "actualizar") {
+		return
+	}
+
+	links, errs, err := h.service.BatchUpdate(r.Context(), actorFromRequest(r), h.managedCodeKeys(r, req.ShortCodes), req.toChanges())
+	if err != nil {
+		h.sendManagementError(w, r, err)
+		return
+	}
+	response := BatchUpdateResponse{Results: make([]BatchUpdateResult, 0, len(req.ShortCodes))}
+	for i, code := range req.ShortCodes {
+		result := BatchUpdateResult{ShortCode: code, Updated: errs[i] == nil}
+		if errs[i] != nil {
+			_, errResponse := managementErrorResponse(errs[i])
+			result.Error = itemError(r, errResponse)
+			response.Failed++
+		} else {
+			link := h.toLinkResponse(r, links[i])
+			result.Link = &link
+			response.Succeeded++
+		}
+		response.Results = append(response.Results, result)
+	}
+
+	h.sendJSON(w, http.StatusOK, response)
+}
+
+// BatchDeleteURLs maneja POST /api/urls:batchDelete eliminando varios enlaces como
+// DELETE /api/urls/{short_code}; los errores se reportan por elemento sin abortar el lote
+func (h *Handler) BatchDeleteURLs(w http.ResponseWriter, r *http.Request) {
+	var req BatchDeleteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.sendDecodeError(w, r, err)
+		return
+	}
+	if !h.checkBatchCodes(w, r, req.ShortCodes, "eliminar") {
+		return
+	}
+
+	errs := h.service.BatchDelete(r.Context(), actorFromRequest(r), h.managedCodeKeys(r, req.ShortCodes))
+	response := BatchDeleteResponse{Results: make([]BatchDeleteResult, 0, len(req.ShortCodes))}
+	for i, code := range req.ShortCodes {
+		result := BatchDeleteResult{ShortCode: code, Deleted: errs[i] == nil}
+		if errs[i] != nil {
+			_, errResponse := managementErrorResponse(errs[i])
+			result.Error = itemError(r, errResponse)
+			response.Failed++
+		} else {
+			response.Succeeded++
+		}
+		response.Results = append(response.Results, result)
+	}
+
+	h.sendJSON(w, http.StatusOK, response)
+}
+
+// checkBatchCodes responde 400 o 413 si el lote está vacío o supera el tamaño máximo; verb
+// completa el mensaje ("No se pueden actualizar más de...")
+func (h *Handler) checkBatchCodes(w http.ResponseWriter, r *http.Request, codes []string, verb string) bool {
+	switch {
+	case len(codes) == 0:
+		h.sendErrorResponse(w, r, http.StatusBadRequest, errcode.EmptyBatch, "Se debe indicar al menos un código")
+		return false
+	case len(codes) > h.maxBatchSize:
+		h.sendErrorResponse(w, r, http.StatusRequestEntityTooLarge, errcode.BatchTooLarge,
+			fmt.Sprintf("No se pueden %s más de %d códigos por petición", verb, h.maxBatchSize))
+		return false
+	}
+	return true
+}
+
+// managedCodeKeys aplica managedCodeKey a los códigos del lote
+func (h *Handler) managedCodeKeys(r *http.Request, codes []string) []string {
+	keys := make([]string, len(codes))
+	for i, code := range codes {
+		keys[i] = h.managedCodeKey(r, code)
+	}
+	return keys
+}
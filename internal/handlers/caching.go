@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"acortador-urls/internal/shortener"
+)
+
+// DefaultPermanentRedirectMaxAge es el tiempo durante el que navegadores y proxies pueden
+// reutilizar una redirección permanente sin volver a consultar el servidor
+const DefaultPermanentRedirectMaxAge = 365 * 24 * time.Hour
+
+// WithRedirectCache define durante cuánto tiempo se pueden guardar en caché las redirecciones
+// temporales (307) y permanentes (301). Cero en las temporales obliga a revalidar cada visita,
+// de modo que todas se contabilizan; es el valor por defecto.
+func WithRedirectCache(temporary, permanent time.Duration) Option {
+	return func(h *Handler) {
+		h.redirectMaxAge = temporary
+		h.permanentRedirectMaxAge = permanent
+	}
+}
+
+// redirectStatus fija el Cache-Control de la redirección y retorna su código: 301 en los
+// enlaces permanentes y 307 en el resto. Los destinos que dependen del visitante no se guardan
+// en caché y el resto se guarda como máximo hasta que el destino pueda cambiar (expiración del
+// enlace o UTM con {date}). Las redirecciones temporales solo se guardan en el navegador
+// (private) para que las cachés compartidas no oculten las visitas.
+func (h *Handler) redirectStatus(w http.ResponseWriter, redirect shortener.Redirect) int {
+	status, maxAge, scope := http.StatusTemporaryRedirect, h.redirectMaxAge, "private"
+	if redirect.Permanent {
+		status, maxAge, scope = http.StatusMovedPermanently, h.permanentRedirectMaxAge, "public"
+	}
+	if !redirect.Cacheable {
+		w.Header().Set("Cache-Control", "no-store")
+		return status
+	}
+	if !redirect.ValidUntil.IsZero() {
+		if remaining := time.Until(redirect.ValidUntil); remaining < maxAge {
+			maxAge = remaining
+		}
+	}
+	if seconds := int64(maxAge / time.Second); seconds > 0 {
+		w.Header().Set("Cache-Control", fmt.Sprintf("%s, max-age=%d", scope, seconds))
+	} else {
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+	return status
+}
+
+// sendCacheableJSON envía una respuesta JSON 200 con un ETag de su contenido para que los
+// clientes puedan repetir la petición con If-None-Match (ver sendCacheable)
+func (h *Handler) sendCacheableJSON(w http.ResponseWriter, r *http.Request, payload interface{}) {
+	var body bytes.Buffer
+	if err := json.NewEncoder(&body).Encode(payload); err != nil {
+		h.sendJSON(w, http.StatusOK, payload)
+		return
+	}
+	h.sendCacheable(w, r, "application/json", body.Bytes())
+}
+
+// sendCacheable envía body con su ETag y Cache-Control: no-cache, de modo que los clientes lo
+// revaliden siempre. Si If-None-Match incluye el ETag responde 304 Not Modified sin cuerpo. El
+// ETag es débil porque la compresión puede cambiar los bytes enviados.
+func (h *Handler) sendCacheable(w http.ResponseWriter, r *http.Request, contentType string, body []byte) {
+	sum := sha256.Sum256(body)
+	etag := `W/"` + hex.EncodeToString(sum[:16]) + `"`
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "no-cache")
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+// etagMatches aplica la comparación débil de If-None-Match (RFC 9110): "*" o cualquiera de los
+// ETags de la lista, con o sin el prefijo W/
+func etagMatches(header, etag string) bool {
+	if header == "" {
+		return false
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
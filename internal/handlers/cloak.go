@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"html/template"
+	"net/http"
+	"net/url"
+
+	"acortador-urls/internal/shortener"
+)
+
+// CloakParams configura la página que se sirve en lugar de la redirección
+type CloakParams struct {
+	// Mode es refresh (página con etiquetas Open Graph y meta refresh) o frame (el destino en un
+	// iframe, conservando la URL corta en la barra de direcciones)
+	Mode string `json:"mode" example:"frame"`
+	// Title, Description e Image son las etiquetas de la página; vacías se toman del destino
+	Title       string `json:"title,omitempty" example:"Rebajas de otoño"`
+	Description string `json:"description,omitempty"`
+	Image       string `json:"image,omitempty" example:"https://cdn.example.com/otono.png"`
+}
+
+// toCloak convierte los parámetros de la petición en los del servicio
+func (c *CloakParams) toCloak() shortener.Cloak {
+	if c == nil {
+		return shortener.Cloak{}
+	}
+	return shortener.Cloak{Mode: c.Mode, Title: c.Title, Description: c.Description, Image: c.Image}
+}
+
+// cloakResponse convierte el enmascaramiento del enlace en su representación HTTP
+func cloakResponse(cloak shortener.Cloak) *CloakParams {
+	if cloak.IsZero() {
+		return nil
+	}
+	return &CloakParams{Mode: cloak.Mode, Title: cloak.Title, Description: cloak.Description, Image: cloak.Image}
+}
+
+// cloakTemplate es la página servida en lugar de la redirección. En modo frame el destino
+// ocupa toda la ventana; en modo refresh la página solo existe para que los rastreadores de las
+// redes sociales lean las etiquetas, y el enlace visible es para los navegadores sin meta
+// refresh.
+var cloakTemplate = template.Must(template.New("cloak").Parse(`<!DOCTYPE html>
+<html lang="es">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+{{if .Description}}<meta name="description" content="{{.Description}}">
+{{end}}<meta property="og:title" content="{{.Title}}">
+{{if .Description}}<meta property="og:description" content="{{.Description}}">
+{{end}}{{if .Image}}<meta property="og:image" content="{{.Image}}">
+{{end}}<meta property="og:url" content="{{.ShortURL}}">
+<meta name="twitter:card" content="{{if .Image}}summary_large_image{{else}}summary{{end}}">
+{{if .Frame}}<style>html, body { margin: 0; height: 100%; overflow: hidden; } iframe { display: block; border: 0; width: 100%; height: 100%; }</style>
+{{else}}<meta http-equiv="refresh" content="0; url={{.Destination}}">
+{{end}}</head>
+<body>
+{{if .Frame}}<iframe src="{{.Destination}}" title="{{.Title}}" allow="fullscreen"></iframe>
+{{else}}<p><a href="{{.Destination}}">{{.Title}}</a></p>
+{{end}}</body>
+</html>
+`))
+
+// cloakPage son los datos de la página de enmascaramiento
+type cloakPage struct {
+	// Destination es template.URL por la misma razón que en interstitialPage
+	Destination template.URL
+	ShortURL    string
+	Frame       bool
+	Title       string
+	Description string
+	Image       string
+}
+
+// sendCloak responde con la página de enmascaramiento en lugar de la redirección. Los destinos
+// que no son http ni https (enlaces profundos a aplicaciones) no se pueden enmarcar y usan meta
+// refresh aunque el enlace esté en modo frame.
+func (h *Handler) sendCloak(w http.ResponseWriter, r *http.Request, redirect shortener.Redirect) {
+	cloak := redirect.Cloak
+	page := cloakPage{
+		Destination: template.URL(redirect.URL),
+		ShortURL:    h.getBaseURL(r) + r.URL.EscapedPath(),
+		Title:       cloak.Title,
+		Description: cloak.Description,
+		Image:       cloak.Image,
+	}
+	parsed, err := url.Parse(redirect.URL)
+	if err == nil && (parsed.Scheme == "http" || parsed.Scheme == "https") {
+		page.Frame = cloak.Mode == shortener.CloakFrame
+		if page.Title == "" {
+			page.Title = parsed.Host
+		}
+	}
+	if page.Title == "" {
+		page.Title = redirect.URL
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	cloakTemplate.Execute(w, page)
+}
@@ -0,0 +1,218 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"acortador-urls/internal/errcode"
+	"acortador-urls/internal/shortener"
+)
+
+// CollectionRequest representa la petición para crear o renombrar una colección
+type CollectionRequest struct {
+	Name string `json:"name" example:"Campaña de otoño"`
+}
+
+// CollectionResponse representa una colección con sus enlaces y visitas
+type CollectionResponse struct {
+	ID        int64     `json:"id"`
+	Name      string    `json:"name"`
+	Owner     string    `json:"owner,omitempty"`
+	Workspace string    `json:"workspace,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// Links, Clicks y BotClicks se calculan en el listado; al crear o renombrar se informan en
+	// cero. BotClicks son las visitas de bots incluidas en Clicks.
+	Links     int   `json:"links"`
+	Clicks    int64 `json:"clicks"`
+	BotClicks int64 `json:"bot_clicks"`
+}
+
+// CollectionListResponse representa las colecciones del usuario
+type CollectionListResponse struct {
+	Collections []CollectionResponse `json:"collections"`
+}
+
+// CollectionLinksRequest representa los enlaces que se mueven a una colección o se sacan de ella
+type CollectionLinksRequest struct {
+	ShortCodes []string `json:"short_codes"`
+}
+
+// CollectionLinkResult es el resultado de mover uno de los enlaces
+type CollectionLinkResult struct {
+	ShortCode string         `json:"short_code"`
+	Moved     bool           `json:"moved"`
+	Error     *ErrorResponse `json:"error,omitempty"`
+}
+
+// CollectionLinksResponse agrupa los resultados de mover varios enlaces
+type CollectionLinksResponse struct {
+	Results []CollectionLinkResult `json:"results"`
+}
+
+// collectionResponse convierte una colección en su representación HTTP
+func collectionResponse(stats shortener.CollectionStats) CollectionResponse {
+	return CollectionResponse{
+		ID:        stats.ID,
+		Name:      stats.Name,
+		Owner:     stats.Owner,
+		Workspace: stats.Workspace,
+		CreatedAt: stats.CreatedAt,
+		UpdatedAt: stats.UpdatedAt,
+		Links:     stats.Links,
+		Clicks:    stats.Clicks,
+		BotClicks: stats.BotClicks,
+	}
+}
+
+// collectionID lee el ID de la colección de la ruta; un ID mal formado se trata como una
+// colección inexistente
+func collectionID(r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	return id, err == nil && id > 0
+}
+
+// ListCollections maneja GET /api/collections con las colecciones que el usuario puede
+// gestionar; los administradores ven todas las del tenant
+func (h *Handler) ListCollections(w http.ResponseWriter, r *http.Request) {
+	collections, err := h.service.ListCollections(r.Context(), actorFromRequest(r), h.tenant(r))
+	if err != nil {
+		h.sendManagementError(w, r, err)
+		return
+	}
+	response := CollectionListResponse{Collections: make([]CollectionResponse, 0, len(collections))}
+	for _, collection := range collections {
+		response.Collections = append(response.Collections, collectionResponse(collection))
+	}
+
+	h.sendCacheableJSON(w, r, response)
+}
+
+// CreateCollection maneja POST /api/collections
+func (h *Handler) CreateCollection(w http.ResponseWriter, r *http.Request) {
+	var req CollectionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.sendDecodeError(w, r, err)
+		return
+	}
+
+	collection, err := h.service.CreateCollection(r.Context(), actorFromRequest(r), h.tenant(r), req.Name)
+	if err != nil {
+		h.sendManagementError(w, r, err)
+		return
+	}
+
+	h.sendJSON(w, http.StatusCreated, collectionResponse(shortener.CollectionStats{Collection: collection}))
+}
+
+// RenameCollection maneja PATCH /api/collections/{id}
+func (h *Handler) RenameCollection(w http.ResponseWriter, r *http.Request) {
+	id, ok := collectionID(r)
+	if !ok {
+		h.sendManagementError(w, r, shortener.ErrCollectionNotFound)
+		return
+	}
+	var req CollectionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.sendDecodeError(w, r, err)
+		return
+	}
+
+	collection, err := h.service.RenameCollection(r.Context(), actorFromRequest(r), h.tenant(r), id, req.Name)
+	if err != nil {
+		h.sendManagementError(w, r, err)
+		return
+	}
+
+	h.sendJSON(w, http.StatusOK, collectionResponse(shortener.CollectionStats{Collection: collection}))
+}
+
+// DeleteCollection maneja DELETE /api/collections/{id}; sus enlaces se conservan fuera de
+// cualquier colección
+func (h *Handler) DeleteCollection(w http.ResponseWriter, r *http.Request) {
+	id, ok := collectionID(r)
+	if !ok {
+		h.sendManagementError(w, r, shortener.ErrCollectionNotFound)
+		return
+	}
+	if err := h.service.DeleteCollection(r.Context(), actorFromRequest(r), h.tenant(r), id); err != nil {
+		h.sendManagementError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AddCollectionLinks maneja POST /api/collections/{id}/links moviendo los enlaces a la
+// colección, aunque estuvieran en otra
+func (h *Handler) AddCollectionLinks(w http.ResponseWriter, r *http.Request) {
+	id, ok := collectionID(r)
+	if !ok {
+		h.sendManagementError(w, r, shortener.ErrCollectionNotFound)
+		return
+	}
+	h.moveCollectionLinks(w, r, id, false)
+}
+
+// RemoveCollectionLinks maneja POST /api/collections/{id}/links:remove sacando los enlaces de
+// la colección; los que estén en otra no cambian
+func (h *Handler) RemoveCollectionLinks(w http.ResponseWriter, r *http.Request) {
+	id, ok := collectionID(r)
+	if !ok {
+		h.sendManagementError(w, r, shortener.ErrCollectionNotFound)
+		return
+	}
+	h.moveCollectionLinks(w, r, id, true)
+}
+
+// moveCollectionLinks lee los códigos del cuerpo y los mete en la colección id o, con remove,
+// los saca de ella, con un resultado por código. El parámetro domain aplica a todos los códigos.
+func (h *Handler) moveCollectionLinks(w http.ResponseWriter, r *http.Request, id int64, remove bool) {
+	var req CollectionLinksRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.sendDecodeError(w, r, err)
+		return
+	}
+
+	switch {
+	case len(req.ShortCodes) == 0:
+		h.sendErrorResponse(w, r, http.StatusBadRequest, errcode.EmptyBatch, "Se debe indicar al menos un código")
+		return
+	case len(req.ShortCodes) > h.maxBatchSize:
+		h.sendErrorResponse(w, r, http.StatusRequestEntityTooLarge, errcode.BatchTooLarge,
+			fmt.Sprintf("No se pueden mover más de %d códigos por petición", h.maxBatchSize))
+		return
+	}
+
+	domain := strings.ToLower(r.URL.Query().Get(DomainParam))
+	keys := make([]string, len(req.ShortCodes))
+	for i, code := range req.ShortCodes {
+		keys[i] = h.tenantCode(r, shortener.LinkKey(domain, code))
+	}
+	move := h.service.MoveLinks
+	if remove {
+		move = h.service.RemoveLinks
+	}
+	errs, err := move(r.Context(), actorFromRequest(r), h.tenant(r), id, keys)
+	if err != nil {
+		h.sendManagementError(w, r, err)
+		return
+	}
+	response := CollectionLinksResponse{Results: make([]CollectionLinkResult, 0, len(req.ShortCodes))}
+	for i, code := range req.ShortCodes {
+		result := CollectionLinkResult{ShortCode: code, Moved: errs[i] == nil}
+		if errs[i] != nil {
+			_, errResponse := managementErrorResponse(errs[i])
+			result.Error = itemError(r, errResponse)
+		}
+		response.Results = append(response.Results, result)
+	}
+
+	h.sendJSON(w, http.StatusOK, response)
+}
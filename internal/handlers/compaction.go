@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"net/http"
+
+	"acortador-urls/internal/shortener"
+)
+
+// CompactionResponse es la memoria estimada del almacén antes y después de compactarlo
+type CompactionResponse struct {
+	Before StoreMemoryResponse `json:"before"`
+	After  StoreMemoryResponse `json:"after"`
+	// FreedBytes es la diferencia estimada entre Before y After
+	FreedBytes int64  `json:"freed_bytes"`
+	Duration   string `json:"duration" example:"12ms"`
+}
+
+// CompactStore maneja POST /admin/store/compact reconstruyendo los mapas del almacén en memoria
+// para liberar los huecos de los enlaces borrados. Bloquea el almacén mientras copia, por lo que
+// conviene usarlo con poco tráfico; STORE_COMPACTION_INTERVAL lo hace solo cuando hace falta.
+func (h *Handler) CompactStore(w http.ResponseWriter, r *http.Request) {
+	result, err := h.service.CompactStore(r.Context(), actorFromRequest(r))
+	if err != nil {
+		h.sendManagementError(w, r, err)
+		return
+	}
+	h.sendJSON(w, http.StatusOK, compactionResponse(result))
+}
+
+// compactionResponse convierte el resultado de una compactación en su respuesta
+func compactionResponse(result shortener.CompactionResult) CompactionResponse {
+	return CompactionResponse{
+		Before:     *storeMemoryResponse(&result.Before),
+		After:      *storeMemoryResponse(&result.After),
+		FreedBytes: result.Before.Bytes - result.After.Bytes,
+		Duration:   result.Duration.String(),
+	}
+}
@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"acortador-urls/internal/cache"
+)
+
+// DebugPath es la ruta en la que se montan pprof y las estadísticas del proceso. net/http/pprof
+// espera sus perfiles bajo /debug/pprof/.
+const DebugPath = "/debug"
+
+// WithCacheStats agrega a GET /debug/stats los aciertos de la caché de enlaces
+func WithCacheStats(stats func() cache.Stats) Option {
+	return func(h *Handler) {
+		h.cacheStats = stats
+	}
+}
+
+// DebugStatsResponse es el estado del proceso para investigar el rendimiento en producción
+type DebugStatsResponse struct {
+	Goroutines int                `json:"goroutines"`
+	Heap       HeapStatsResponse  `json:"heap"`
+	Store      StoreStatsResponse `json:"store"`
+	// CodeGeneration son los reintentos por colisión al generar códigos
+	CodeGeneration CodeGenerationStatsResponse `json:"code_generation"`
+	// Cache se omite si la caché de enlaces está desactivada
+	Cache  *CacheStatsResponse `json:"cache,omitempty"`
+	Uptime string              `json:"uptime"`
+}
+
+// HeapStatsResponse resume runtime.MemStats
+type HeapStatsResponse struct {
+	AllocBytes   uint64 `json:"alloc_bytes"`
+	InUseBytes   uint64 `json:"in_use_bytes"`
+	SysBytes     uint64 `json:"sys_bytes"`
+	Objects      uint64 `json:"objects"`
+	GCCycles     uint32 `json:"gc_cycles"`
+	GCPauseTotal string `json:"gc_pause_total"`
+	NextGCBytes  uint64 `json:"next_gc_bytes"`
+}
+
+// StoreStatsResponse es la ocupación del almacén de enlaces
+type StoreStatsResponse struct {
+	// Backend identifica el almacén y sus capas, p. ej. "cache/memory"
+	Backend string `json:"backend"`
+	Links   int    `json:"links"`
+	// Capacity es cero si el almacén no tiene máximo de enlaces
+	Capacity  int    `json:"capacity"`
+	Policy    string `json:"eviction_policy,omitempty"`
+	Evictions uint64 `json:"evictions"`
+	// Memory se omite si el almacén no estima su memoria
+	Memory *StoreMemoryResponse `json:"memory,omitempty"`
+}
+
+// StoreMemoryResponse es la estimación de la memoria del almacén en memoria. Es aproximada: no
+// cuenta la fragmentación del heap, que se ve en heap.
+type StoreMemoryResponse struct {
+	Bytes int64 `json:"bytes"`
+	// ReclaimableBytes es lo que liberaría POST /admin/store/compact
+	ReclaimableBytes int64 `json:"reclaimable_bytes"`
+	// Reclaimable es la fracción de los huecos de los mapas que ocupaban enlaces borrados
+	Reclaimable float64 `json:"reclaimable"`
+	// PeakLinks es el máximo de enlaces desde la última compactación
+	PeakLinks   int        `json:"peak_links"`
+	CompactedAt *time.Time `json:"compacted_at,omitempty"`
+}
+
+// CacheStatsResponse son los aciertos de la caché de enlaces desde el arranque
+type CacheStatsResponse struct {
+	Hits     uint64  `json:"hits"`
+	Misses   uint64  `json:"misses"`
+	HitRatio float64 `json:"hit_ratio"`
+}
+
+// startedAt es el arranque del proceso para el uptime de GET /debug/stats
+var startedAt = time.Now()
+
+// Debug retorna las rutas de diagnóstico que se montan en DebugPath, solo para administradores:
+// los perfiles de net/http/pprof en /pprof/ y el estado del proceso en GET /stats. Se montan
+// fuera del timeout por petición porque /pprof/profile y /pprof/trace muestrean durante
+// ?seconds= (30 por defecto).
+func (h *Handler) Debug() http.Handler {
+	r := chi.NewRouter()
+	r.Get("/stats", h.DebugStats)
+	r.Get("/pprof/", pprof.Index)
+	r.Get("/pprof/cmdline", pprof.Cmdline)
+	r.Get("/pprof/profile", pprof.Profile)
+	r.Get("/pprof/symbol", pprof.Symbol)
+	r.Post("/pprof/symbol", pprof.Symbol)
+	r.Get("/pprof/trace", pprof.Trace)
+	// pprof.Index sirve los perfiles con nombre (heap, goroutine, allocs, block, mutex...)
+	r.Get("/pprof/{profile}", pprof.Index)
+	return r
+}
+
+// DebugStats maneja GET /debug/stats con las goroutines, el heap, la ocupación del almacén y los
+// aciertos de la caché. runtime.ReadMemStats detiene brevemente el proceso, por lo que no debe
+// consultarse con mucha frecuencia.
+func (h *Handler) DebugStats(w http.ResponseWriter, r *http.Request) {
+	store, err := h.service.StoreStats(r.Context())
+	if err != nil {
+		h.sendManagementError(w, r, err)
+		return
+	}
+
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	response := DebugStatsResponse{
+		Goroutines: runtime.NumGoroutine(),
+		Heap: HeapStatsResponse{
+			AllocBytes:   mem.HeapAlloc,
+			InUseBytes:   mem.HeapInuse,
+			SysBytes:     mem.Sys,
+			Objects:      mem.HeapObjects,
+			GCCycles:     mem.NumGC,
+			GCPauseTotal: time.Duration(mem.PauseTotalNs).String(),
+			NextGCBytes:  mem.NextGC,
+		},
+		Store:          storeStatsResponse(store),
+		CodeGeneration: codeGenerationStatsResponse(h.service.CollisionStats()),
+		Uptime:         time.Since(startedAt).Round(time.Second).String(),
+	}
+	if h.cacheStats != nil {
+		stats := h.cacheStats()
+		response.Cache = &CacheStatsResponse{Hits: stats.Hits, Misses: stats.Misses}
+		if total := stats.Hits + stats.Misses; total > 0 {
+			response.Cache.HitRatio = float64(stats.Hits) / float64(total)
+		}
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	h.sendJSON(w, http.StatusOK, response)
+}
@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"errors"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+
+	"acortador-urls/internal/errcode"
+	"acortador-urls/internal/parquet"
+	"acortador-urls/internal/shortener"
+)
+
+// ParquetContentType es el tipo MIME de los ficheros Apache Parquet
+const ParquetContentType = "application/vnd.apache.parquet"
+
+// AggregateDay agrupa la exportación de visitas por día
+const AggregateDay = "day"
+
+// Columnas de GET /api/urls/{short_code}/events/export, visita a visita y por día
+var (
+	visitColumns = []parquet.Column{
+		{Name: "time", Type: parquet.Timestamp}, {Name: "short_code", Type: parquet.String},
+		{Name: "variant", Type: parquet.String}, {Name: "bot", Type: parquet.Bool},
+		{Name: "referrer", Type: parquet.String}, {Name: "country", Type: parquet.String},
+	}
+	dayColumns = []parquet.Column{
+		{Name: "day", Type: parquet.Timestamp}, {Name: "short_code", Type: parquet.String},
+		{Name: "clicks", Type: parquet.Int64}, {Name: "bot_clicks", Type: parquet.Int64},
+	}
+)
+
+// ExportLinkEvents maneja GET /api/urls/{short_code}/events/export?format=&from=&to=&aggregate=,
+// que descarga las visitas del enlace en CSV (por defecto) o Parquet para analizarlas con otras
+// herramientas. from y to son fechas RFC 3339 o días (2006-01-02) que acotan el periodo [from, to);
+// con aggregate=day se exporta una fila por día con visitas en lugar de una por visita. Solo
+// pueden exportarlas el propietario del enlace, los editores de su espacio y los administradores.
+func (h *Handler) ExportLinkEvents(w http.ResponseWriter, r *http.Request) {
+	if h.summaries == nil {
+		h.sendErrorResponse(w, r, http.StatusNotFound, errcode.ReportsDisabled, "Los informes de analítica no están habilitados")
+		return
+	}
+	params := r.URL.Query()
+	format := params.Get("format")
+	if format == "" {
+		format = "csv"
+	}
+	if format != "csv" && format != "parquet" {
+		h.sendErrorResponse(w, r, http.StatusBadRequest, errcode.InvalidFormat, "format debe ser csv o parquet")
+		return
+	}
+
+	var errs []error
+	from, err := exportTimeParam(params.Get("from"), "from")
+	errs = append(errs, err)
+	to, err := exportTimeParam(params.Get("to"), "to")
+	errs = append(errs, err)
+	if to.IsZero() {
+		to = time.Now()
+	}
+	if !from.IsZero() && !from.Before(to) {
+		errs = append(errs, &shortener.ValidationError{Field: "to", Value: params.Get("to"), Msg: "debe ser posterior a from"})
+	}
+	aggregate := params.Get("aggregate")
+	if aggregate != "" && aggregate != AggregateDay {
+		errs = append(errs, &shortener.ValidationError{Field: "aggregate", Value: aggregate, Msg: "debe ser day"})
+	}
+	if err := errors.Join(errs...); err != nil {
+		h.sendQueryError(w, r, err)
+		return
+	}
+
+	link, err := h.service.ManagedLink(r.Context(), actorFromRequest(r), h.managedLinkKey(r))
+	if err != nil {
+		h.sendManagementError(w, r, err)
+		return
+	}
+
+	columns, rows := visitColumns, h.visitRows(link, from, to)
+	if aggregate == AggregateDay {
+		columns, rows = dayColumns, h.dayRows(link, from, to)
+	}
+	contentType := "text/csv; charset=utf-8"
+	if format == "parquet" {
+		contentType = ParquetContentType
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": "eventos-" + link.ShortCode + "." + format}))
+
+	if format == "parquet" {
+		writer := parquet.NewWriter(w, columns)
+		for _, row := range rows {
+			writer.Write(row...)
+		}
+		writer.Close()
+		return
+	}
+
+	writer := csv.NewWriter(w)
+	flusher, _ := w.(http.Flusher)
+	header := make([]string, len(columns))
+	for i, column := range columns {
+		header[i] = column.Name
+	}
+	writer.Write(header)
+	for i, row := range rows {
+		if err := writer.Write(csvRecord(row, aggregate == AggregateDay)); err != nil {
+			return
+		}
+		if (i+1)%exportFlushEvery == 0 {
+			writer.Flush()
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+	}
+	writer.Flush()
+}
+
+// visitRows son las filas de visitColumns con las visitas del enlace en el periodo
+func (h *Handler) visitRows(link shortener.Link, from, to time.Time) [][]any {
+	visits := h.summaries.Visits(link.Key(), from, to)
+	rows := make([][]any, 0, len(visits))
+	for _, visit := range visits {
+		rows = append(rows, []any{visit.Time, link.ShortCode, visit.Variant, visit.Bot, visit.Referrer, visit.Country})
+	}
+	return rows
+}
+
+// dayRows son las filas de dayColumns con las visitas por día del enlace en el periodo
+func (h *Handler) dayRows(link shortener.Link, from, to time.Time) [][]any {
+	totals := h.summaries.DayTotals(link.Key(), from, to)
+	rows := make([][]any, 0, len(totals))
+	for _, total := range totals {
+		rows = append(rows, []any{total.Day, link.ShortCode, total.Clicks, total.BotClicks})
+	}
+	return rows
+}
+
+// csvRecord convierte una fila en texto; los días se escriben sin hora
+func csvRecord(row []any, daily bool) []string {
+	record := make([]string, len(row))
+	for i, value := range row {
+		switch v := value.(type) {
+		case string:
+			record[i] = v
+		case int64:
+			record[i] = strconv.FormatInt(v, 10)
+		case bool:
+			record[i] = strconv.FormatBool(v)
+		case time.Time:
+			if daily {
+				record[i] = v.Format(time.DateOnly)
+			} else {
+				record[i] = v.UTC().Format(time.RFC3339Nano)
+			}
+		}
+	}
+	return record
+}
+
+// exportTimeParam interpreta un límite del periodo exportado: una fecha RFC 3339 o un día, que
+// empieza a medianoche UTC. Vacío es el tiempo cero.
+func exportTimeParam(value, field string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if parsed, err := time.Parse(time.RFC3339, value); err == nil {
+		return parsed, nil
+	}
+	if parsed, err := time.Parse(time.DateOnly, value); err == nil {
+		return parsed, nil
+	}
+	return time.Time{}, &shortener.ValidationError{Field: field, Value: value, Msg: "debe ser una fecha RFC 3339 o un día 2006-01-02"}
+}
@@ -0,0 +1,279 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"acortador-urls/internal/auth"
+	"acortador-urls/internal/errcode"
+	"acortador-urls/internal/graphql"
+	"acortador-urls/internal/shortener"
+)
+
+// Errores propios de los resolvers GraphQL
+var (
+	// errGraphQLUnauthorized se retorna en operaciones que requieren un usuario autenticado
+	errGraphQLUnauthorized = errcode.New(errcode.Unauthorized, "se requiere autenticación")
+	// errGraphQLForbidden se retorna en consultas reservadas a los administradores
+	errGraphQLForbidden = errcode.New(errcode.Forbidden, "se requieren permisos de administrador")
+	// errGraphQLArgument se retorna cuando falta un argumento o tiene un tipo incorrecto
+	errGraphQLArgument = errcode.New(errcode.InvalidArgument, "argumento inválido")
+)
+
+// GraphQL maneja POST /graphql (y GET con ?query=) sobre la misma capa de servicio que la API
+// REST. Esquema soportado:
+//
+//	type Query {
+//	  url(shortCode: String!): Link
+//	  urls: [Link!]!            # enlaces del usuario autenticado
+//	  stats: Stats!             # solo administradores, como GET /api/stats
+//	}
+//	type Mutation {
+//	  shortenUrl(longUrl: String!, alias: String, ttlSeconds: Int): Link
+//	  updateUrl(shortCode: String!, longUrl: String!): Link
+//	  deleteUrl(shortCode: String!): Boolean
+//	}
+//	type Link { shortCode shortUrl longUrl owner createdAt updatedAt expiresAt expired disabled broken clicks botClicks uniqueVisitors passwordProtected }
+//	type Stats { totalUrls activeUrls expiredUrls disabledUrls brokenUrls evictedUrls clicksToday }
+func (h *Handler) GraphQL(w http.ResponseWriter, r *http.Request) {
+	var req graphql.Request
+	switch r.Method {
+	case http.MethodGet:
+		req.Query = r.URL.Query().Get("query")
+		req.OperationName = r.URL.Query().Get("operationName")
+		if variables := r.URL.Query().Get("variables"); variables != "" {
+			if err := json.Unmarshal([]byte(variables), &req.Variables); err != nil {
+				h.sendErrorResponse(w, r, http.StatusBadRequest, errcode.InvalidJSON, fmt.Sprintf("Variables inválidas: %v", err))
+				return
+			}
+		}
+	default:
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			h.sendDecodeError(w, r, err)
+			return
+		}
+	}
+
+	if strings.TrimSpace(req.Query) == "" {
+		h.sendErrorResponse(w, r, http.StatusBadRequest, errcode.MissingQuery, "El campo query es obligatorio")
+		return
+	}
+
+	// Por GET solo se permiten consultas para que un enlace no pueda disparar mutaciones
+	schema := h.graphQLSchema(r)
+	if r.Method == http.MethodGet {
+		schema.Mutation = nil
+	}
+
+	h.sendJSON(w, http.StatusOK, schema.Execute(r.Context(), req))
+}
+
+// graphQLSchema construye los resolvers ligados a la petición (autenticación y URL base)
+func (h *Handler) graphQLSchema(r *http.Request) *graphql.Schema {
+	return &graphql.Schema{
+		Query: map[string]graphql.Resolver{
+			"url": func(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+				code, err := stringArg(args, "shortCode")
+				if err != nil {
+					return nil, err
+				}
+				link, err := h.service.GetLink(ctx, h.tenantCode(r, code))
+				if errors.Is(err, shortener.ErrURLNotFound) {
+					return nil, nil
+				}
+				if err != nil {
+					return nil, err
+				}
+				// La consulta es pública: oculta el destino igual que la vista previa
+				object := h.linkObject(r, link)
+				if h.hidesDestination(r, link) {
+					object["longUrl"] = nil
+				}
+				return object, nil
+			},
+			"urls": func(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+				claims, ok := auth.ClaimsFromContext(ctx)
+				if !ok {
+					return nil, errGraphQLUnauthorized
+				}
+				links, err := h.service.ListByOwner(ctx, h.tenant(r), claims.Subject)
+				if err != nil {
+					return nil, err
+				}
+				objects := make([]map[string]interface{}, 0, len(links))
+				for _, link := range links {
+					objects = append(objects, h.linkObject(r, link))
+				}
+				return objects, nil
+			},
+			"stats": func(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+				// Recorre todo el almacén: se restringe como la ruta REST para que no sirva a
+				// cualquiera para cargar el servicio
+				if claims, ok := auth.ClaimsFromContext(ctx); !ok || !claims.IsAdmin() {
+					return nil, errGraphQLForbidden
+				}
+				stats, err := h.service.GetStats(ctx)
+				if err != nil {
+					return nil, err
+				}
+				return map[string]interface{}{
+					"totalUrls":    stats.TotalLinks,
+					"activeUrls":   stats.ActiveLinks,
+					"expiredUrls":  stats.ExpiredLinks,
+					"disabledUrls": stats.DisabledLinks,
+					"brokenUrls":   stats.BrokenLinks,
+					"evictedUrls":  stats.Store.Evictions,
+					"clicksToday":  stats.ClicksToday,
+				}, nil
+			},
+		},
+		Mutation: map[string]graphql.Resolver{
+			"shortenUrl": func(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+				longURL, err := stringArg(args, "longUrl")
+				if err != nil {
+					return nil, err
+				}
+				alias, err := optionalStringArg(args, "alias")
+				if err != nil {
+					return nil, err
+				}
+				ttl, err := optionalIntArg(args, "ttlSeconds")
+				if err != nil {
+					return nil, err
+				}
+				req := ShortenRequest{LongURL: longURL, Alias: alias, TTLSeconds: ttl}
+				input := req.toInput(ownerFromRequest(r))
+				input.Client = h.quotaClient(r)
+				input.APIKey = apiKeyFromRequest(r)
+				input.Tenant = h.tenant(r)
+				input.Workspace = workspaceFromRequest(r)
+				link, _, err := h.service.Shorten(ctx, input)
+				if err != nil {
+					return nil, err
+				}
+				return h.linkObject(r, link), nil
+			},
+			"updateUrl": func(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+				if _, ok := auth.ClaimsFromContext(ctx); !ok {
+					return nil, errGraphQLUnauthorized
+				}
+				code, err := stringArg(args, "shortCode")
+				if err != nil {
+					return nil, err
+				}
+				longURL, err := stringArg(args, "longUrl")
+				if err != nil {
+					return nil, err
+				}
+				link, err := h.service.UpdateURL(ctx, actorFromRequest(r), h.tenantCode(r, code), longURL)
+				if err != nil {
+					return nil, err
+				}
+				return h.linkObject(r, link), nil
+			},
+			"deleteUrl": func(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+				if _, ok := auth.ClaimsFromContext(ctx); !ok {
+					return nil, errGraphQLUnauthorized
+				}
+				code, err := stringArg(args, "shortCode")
+				if err != nil {
+					return nil, err
+				}
+				if err := h.service.DeleteURL(ctx, actorFromRequest(r), h.tenantCode(r, code)); err != nil {
+					return nil, err
+				}
+				return true, nil
+			},
+		},
+		ErrorCode: graphQLErrorCode,
+	}
+}
+
+// linkObject representa un enlace como objeto GraphQL
+func (h *Handler) linkObject(r *http.Request, link shortener.Link) map[string]interface{} {
+	object := map[string]interface{}{
+		"shortCode": link.ShortCode,
+		"shortUrl":  h.shortURL(r, link),
+		"longUrl":   link.LongURL,
+		"owner":     nil,
+		"createdAt": link.CreatedAt.Format(time.RFC3339),
+		"updatedAt": link.UpdatedAt.Format(time.RFC3339),
+		"expiresAt": nil,
+		"expired":   link.IsExpired(time.Now()),
+		"disabled":  link.IsDisabled(),
+		"broken":    link.Health.Broken,
+		"clicks":    link.Clicks,
+
+		"botClicks":         link.BotClicks,
+		"uniqueVisitors":    link.UniqueVisitors(),
+		"passwordProtected": link.PasswordProtected(),
+	}
+	// url es pública: el propietario solo se muestra a él mismo y a los administradores
+	if actor := actorFromRequest(r); link.Owner != "" && (actor.Admin || actor.UserID == link.Owner) {
+		object["owner"] = link.Owner
+	}
+	if !link.ExpiresAt.IsZero() {
+		object["expiresAt"] = link.ExpiresAt.Format(time.RFC3339)
+	}
+	return object
+}
+
+// graphQLErrorCode reutiliza los códigos de error de la API REST en extensions.code
+func graphQLErrorCode(err error) string {
+	if _, code, _, ok := storeErrorStatus(err); ok {
+		return string(code)
+	}
+	switch {
+	case errors.Is(err, errGraphQLUnauthorized), errors.Is(err, errGraphQLForbidden), errors.Is(err, errGraphQLArgument),
+		errors.Is(err, shortener.ErrURLNotFound), errors.Is(err, shortener.ErrForbidden):
+		return string(errcode.Of(err))
+	}
+	_, code, _ := shortenErrorStatus(err)
+	return string(code)
+}
+
+// stringArg lee un argumento String! obligatorio
+func stringArg(args map[string]interface{}, name string) (string, error) {
+	value, err := optionalStringArg(args, name)
+	if err != nil {
+		return "", err
+	}
+	if value == "" {
+		return "", fmt.Errorf("%w: %s es obligatorio", errGraphQLArgument, name)
+	}
+	return value, nil
+}
+
+// optionalStringArg lee un argumento String opcional
+func optionalStringArg(args map[string]interface{}, name string) (string, error) {
+	switch value := args[name].(type) {
+	case nil:
+		return "", nil
+	case string:
+		return value, nil
+	default:
+		return "", fmt.Errorf("%w: %s debe ser un String", errGraphQLArgument, name)
+	}
+}
+
+// optionalIntArg lee un argumento Int opcional; las variables JSON llegan como float64
+func optionalIntArg(args map[string]interface{}, name string) (int64, error) {
+	switch value := args[name].(type) {
+	case nil:
+		return 0, nil
+	case int64:
+		return value, nil
+	case float64:
+		if value != float64(int64(value)) {
+			return 0, fmt.Errorf("%w: %s debe ser un Int", errGraphQLArgument, name)
+		}
+		return int64(value), nil
+	default:
+		return 0, fmt.Errorf("%w: %s debe ser un Int", errGraphQLArgument, name)
+	}
+}
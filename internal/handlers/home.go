@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"errors"
+	"html/template"
+	"net/http"
+	"strings"
+
+	"acortador-urls/internal/qrcode"
+	"acortador-urls/internal/shortener"
+)
+
+// qrScale son los píxeles por módulo del código QR de la página de inicio
+const qrScale = 6
+
+// homeTemplate es la página de inicio con el formulario para acortar desde el navegador. Funciona
+// sin JavaScript; el script solo agrega el botón de copiar.
+var homeTemplate = template.Must(template.New("home").Parse(`<!DOCTYPE html>
+<html lang="es">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Acortador de URLs</title>
+<style>
+body{font-family:system-ui,sans-serif;max-width:40rem;margin:3rem auto;padding:0 1rem;color:#1f2933}
+form p{display:flex;gap:.5rem}input,button{font:inherit;padding:.5rem}input[name=long_url]{flex:1}
+.error{padding:.75rem 1rem;border-radius:.5rem;background:#fde8e8}
+.result{margin-top:2rem;text-align:center}.result input{width:100%;text-align:center}
+</style>
+</head>
+<body>
+<h1>Acortador de URLs</h1>
+<form method="post" action="/shorten/form">
+<p><input type="url" name="long_url" value="{{.LongURL}}" placeholder="https://www.example.com/una/url/muy/larga" required autofocus>
+<button>Acortar</button></p>
+<p><input type="text" name="alias" value="{{.Alias}}" placeholder="Alias personalizado (opcional)" maxlength="64"></p>
+</form>
+{{with .Error}}<p class="error">{{.}}</p>{{end}}
+{{if .ShortURL}}<div class="result">
+<p>Tu enlace corto:</p>
+<p><input id="corto" type="text" value="{{.ShortURL}}" readonly> <button type="button" id="copiar" hidden>Copiar</button></p>
+<p><a href="{{.ShortURL}}+">Vista previa del destino</a></p>
+{{.QR}}
+</div>
+<script>
+(function () {
+  var boton = document.getElementById("copiar");
+  if (!navigator.clipboard) { return; }
+  boton.hidden = false;
+  boton.onclick = function () {
+    navigator.clipboard.writeText(document.getElementById("corto").value);
+    boton.textContent = "Copiado";
+  };
+})();
+</script>{{end}}
+</body>
+</html>
+`))
+
+// homePage son los datos de la página de inicio
+type homePage struct {
+	LongURL  string
+	Alias    string
+	ShortURL string
+	// QR es el SVG generado por el paquete qrcode, que solo contiene números y rutas
+	QR    template.HTML
+	Error string
+}
+
+// Home maneja GET / con el formulario para acortar URLs desde el navegador
+func (h *Handler) Home(w http.ResponseWriter, r *http.Request) {
+	h.sendHome(w, http.StatusOK, homePage{})
+}
+
+// ShortenForm maneja POST /shorten/form, el envío del formulario de la página de inicio
+// (application/x-www-form-urlencoded con long_url y alias opcional). Responde con la misma
+// página mostrando la URL corta y su código QR, o el error junto a los valores enviados.
+func (h *Handler) ShortenForm(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			h.sendHome(w, http.StatusRequestEntityTooLarge, homePage{Error: bodyTooLargeMessage(tooLarge.Limit)})
+			return
+		}
+		h.sendHome(w, http.StatusBadRequest, homePage{Error: "Formulario inválido"})
+		return
+	}
+
+	page := homePage{
+		LongURL: strings.TrimSpace(r.PostForm.Get("long_url")),
+		Alias:   strings.TrimSpace(r.PostForm.Get("alias")),
+	}
+	input := shortener.ShortenInput{LongURL: page.LongURL, Alias: page.Alias, Owner: ownerFromRequest(r),
+		Client: h.quotaClient(r), APIKey: apiKeyFromRequest(r), Tenant: h.tenant(r), Workspace: workspaceFromRequest(r)}
+	link, created, err := h.service.Shorten(r.Context(), input)
+	if err != nil {
+		status, _, message := shortenErrorStatus(err)
+		page.Error = message
+		h.sendHome(w, status, page)
+		return
+	}
+
+	page.ShortURL = h.shortURL(r, link)
+	if code, err := qrcode.Encode(page.ShortURL, qrcode.Medium); err == nil {
+		page.QR = template.HTML(code.SVG(qrScale))
+	}
+	status := http.StatusCreated
+	if !created {
+		status = http.StatusOK
+	}
+	h.sendHome(w, status, page)
+}
+
+// sendHome escribe la página de inicio con el estado indicado
+func (h *Handler) sendHome(w http.ResponseWriter, status int, page homePage) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	homeTemplate.Execute(w, page)
+}
@@ -1,32 +1,283 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"html/template"
+	"io"
+	"math"
+	"mime"
 	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 
+	"acortador-urls/internal/analytics"
+	"acortador-urls/internal/auth"
+	"acortador-urls/internal/backup"
+	"acortador-urls/internal/cache"
+	"acortador-urls/internal/errcode"
+	"acortador-urls/internal/ratelimit"
 	"acortador-urls/internal/shortener"
+	"acortador-urls/internal/webhooks"
 )
 
+// DefaultMaxBatchSize es el número máximo de URLs aceptadas por POST /shorten/batch
+const DefaultMaxBatchSize = 1000
+
+// IdempotencyKeyHeader es la cabecera con la que los clientes hacen idempotente POST /shorten
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// MaxIdempotencyKeyLength es la longitud máxima aceptada para IdempotencyKeyHeader
+const MaxIdempotencyKeyLength = 255
+
+// DomainParam es el parámetro de query con el que los endpoints de gestión seleccionan un
+// enlace de un dominio personalizado
+const DomainParam = "domain"
+
+// TenantParam es el parámetro de ruta de los enlaces de un tenant sin host propio
+// (/t/{tenant}/{short_code}) y el de query con el que los administradores eligen un tenant
+const TenantParam = "tenant"
+
 // Handler maneja las peticiones HTTP
 type Handler struct {
-	service *shortener.Service
+	service      *shortener.Service
+	maxBatchSize int
+
+	// batchLimiter cobra las URLs de un lote a partir de la segunda; nil si no hay límite
+	batchLimiter ratelimit.Limiter
+
+	// countryHeader es la cabecera con el país del visitante puesta por el CDN o proxy
+	countryHeader string
+
+	// interstitialCountdown es la espera de la página de aviso antes de redirigir
+	interstitialCountdown time.Duration
+
+	// notFoundPage y fallbackURL reemplazan el error JSON de los códigos inexistentes o expirados
+	notFoundPage *template.Template
+	fallbackURL  string
+
+	// webhooks es el despachador de webhooks cuyo log de entregas se consulta en la API de
+	// administración; nil si no hay webhooks configurados
+	webhooks *webhooks.Dispatcher
+
+	// backups crea y restaura las copias de seguridad; nil si no están configuradas
+	backups *backup.Manager
+
+	// events es el broker del stream de eventos; nil si GET /api/events/stream no está habilitado
+	events *shortener.EventBroker
+
+	// live son las métricas de GET /api/analytics/live y liveInterval la frecuencia de envío
+	live         *analytics.Tracker
+	liveInterval time.Duration
+
+	// summaries son los agregados diarios de GET /api/reports/summary; nil si no está habilitado
+	summaries *analytics.Aggregator
+
+	// oidc es el inicio de sesión con un proveedor de identidad; nil si no está configurado
+	oidc *OIDCLogin
+
+	// cacheStats son los aciertos de la caché de enlaces de GET /debug/stats; nil sin caché
+	cacheStats func() cache.Stats
+
+	// redirectMaxAge y permanentRedirectMaxAge son el max-age de las redirecciones temporales
+	// y permanentes que pueden guardarse en caché
+	redirectMaxAge          time.Duration
+	permanentRedirectMaxAge time.Duration
+	// privacyMode trata todas las visitas como privadas (ver privateVisit)
+	privacyMode bool
+
+	// confirmationKey firma los tokens de confirmación de las operaciones sobre los datos de un
+	// usuario (nil usa una clave aleatoria por proceso) y confirmationTTL es su vigencia
+	confirmationKey []byte
+	confirmationTTL time.Duration
+
+	// robotsTxt, favicon y securityTxt son los archivos que se sirven en todos los dominios
+	robotsTxt   string
+	favicon     []byte
+	securityTxt SecurityTxt
+}
+
+// Option configura aspectos opcionales del handler
+type Option func(*Handler)
+
+// WithMaxBatchSize define el tamaño máximo de lote en POST /shorten/batch
+func WithMaxBatchSize(size int) Option {
+	return func(h *Handler) {
+		h.maxBatchSize = size
+	}
+}
+
+// WithBatchRateLimit cobra en el limitador cada URL de POST /shorten/batch, no solo la
+// petición. La primera la cobra el middleware RateLimit de la ruta, que debe usar el mismo
+// limitador; el resto se cobra aquí y las que no caben fallan con rate_limited.
+func WithBatchRateLimit(limiter ratelimit.Limiter) Option {
+	return func(h *Handler) {
+		h.batchLimiter = limiter
+	}
+}
+
+// WithCountryHeader toma el país del visitante de una cabecera (p. ej. CF-IPCountry) en lugar
+// de geolocalizar su IP. Solo debe usarse detrás de un proxy que la fije.
+func WithCountryHeader(name string) Option {
+	return func(h *Handler) {
+		h.countryHeader = name
+	}
 }
 
 // NewHandler crea una nueva instancia del handler
-func NewHandler(service *shortener.Service) *Handler {
-	return &Handler{
-		service: service,
+func NewHandler(service *shortener.Service, opts ...Option) *Handler {
+	h := &Handler{
+		service:      service,
+		maxBatchSize: DefaultMaxBatchSize,
+
+		interstitialCountdown: DefaultInterstitialCountdown,
+
+		permanentRedirectMaxAge: DefaultPermanentRedirectMaxAge,
+		confirmationTTL:         DefaultConfirmationTTL,
+
+		robotsTxt: DefaultRobotsTxt,
+		favicon:   defaultFavicon,
+	}
+	for _, opt := range opts {
+		opt(h)
 	}
+	return h
 }
 
 // ShortenRequest representa la petición para acortar una URL con validaciones
 type ShortenRequest struct {
-	LongURL string `json:"long_url" validate:"required,url" example:"https://www.example.com"`
+	LongURL    string `json:"long_url" validate:"required,url" example:"https://www.example.com"`
+	Alias      string `json:"alias,omitempty" example:"campania-q3"`
+	TTLSeconds int64  `json:"ttl_seconds,omitempty" example:"86400"`
+	// ForwardQuery agrega la query de la URL corta al destino al redirigir
+	ForwardQuery bool `json:"forward_query,omitempty"`
+	// UTM son parámetros de campaña agregados al destino; admiten {code} y {date}
+	UTM *UTMParams `json:"utm,omitempty"`
+	// Password protege la redirección; se almacena solo su hash
+	Password string `json:"password,omitempty"`
+	// GeoTargets son destinos por país ISO 3166-1 alfa-2 o región (EU); long_url es el de por defecto
+	GeoTargets map[string]string `json:"geo_targets,omitempty"`
+	// DeviceTargets son destinos por dispositivo (ios, android, desktop); admiten enlaces profundos
+	DeviceTargets map[string]string `json:"device_targets,omitempty"`
+	// Variants reparten las visitas entre varios destinos según su peso (prueba A/B)
+	Variants []Variant `json:"variants,omitempty"`
+	// StickyVariants recuerda con una cookie la variante de cada visitante
+	StickyVariants bool `json:"sticky_variants,omitempty"`
+	// Interstitial muestra una página de aviso con el destino antes de redirigir
+	Interstitial bool `json:"interstitial,omitempty"`
+	// RedirectType es temporary (307, por defecto) o permanent (301, cacheable por navegadores y
+	// proxies); no se puede cambiar después
+	RedirectType string `json:"redirect_type,omitempty" example:"permanent"`
+	// Cloak sirve el destino dentro de una página HTML en lugar de redirigir; no admite
+	// redirect_type permanent
+	Cloak *CloakParams `json:"cloak,omitempty"`
+	// Referrers limita las redirecciones a las visitas procedentes de ciertos dominios; no
+	// admite redirect_type permanent
+	Referrers *ReferrerParams `json:"referrers,omitempty"`
+	// IPAccess limita las redirecciones a las visitas desde ciertas redes; no admite
+	// redirect_type permanent
+	IPAccess *IPAccessParams `json:"ip_access,omitempty"`
+	// Signed exige una URL firmada (?sig=) para redirigir; las firmas se obtienen con
+	// POST /api/urls/{short_code}/sign. No admite redirect_type permanent.
+	Signed bool `json:"signed,omitempty"`
+	// Tags son etiquetas para agrupar y filtrar enlaces; se guardan en minúsculas
+	Tags []string `json:"tags,omitempty" example:"newsletter,q3-campaign"`
+	// Description es una nota libre sobre el enlace
+	Description string `json:"description,omitempty"`
+	// CustomMetadata es un objeto JSON libre del integrador (p. ej. {"ticket": "OPS-123"})
+	CustomMetadata json.RawMessage `json:"custom_metadata,omitempty"`
+}
+
+// UTMParams representa los parámetros de campaña de un enlace
+type UTMParams struct {
+	Source   string `json:"source,omitempty" example:"newsletter"`
+	Medium   string `json:"medium,omitempty" example:"email"`
+	Campaign string `json:"campaign,omitempty" example:"otono-{date}"`
+}
+
+// Variant representa un destino de una prueba A/B
+type Variant struct {
+	Name   string `json:"name,omitempty" example:"a"`
+	URL    string `json:"url" example:"https://www.example.com/landing-a"`
+	Weight int    `json:"weight" example:"50"`
+	// Clicks solo se informa en las respuestas
+	Clicks int64 `json:"clicks"`
+}
+
+// toVariants convierte las variantes de la petición en las del servicio
+func toVariants(variants []Variant) []shortener.Variant {
+	if len(variants) == 0 {
+		return nil
+	}
+	converted := make([]shortener.Variant, len(variants))
+	for i, v := range variants {
+		converted[i] = shortener.Variant{Name: v.Name, URL: v.URL, Weight: v.Weight}
+	}
+	return converted
+}
+
+// variantsResponse convierte las variantes del enlace en su representación HTTP
+func variantsResponse(variants []shortener.Variant) []Variant {
+	if len(variants) == 0 {
+		return nil
+	}
+	converted := make([]Variant, len(variants))
+	for i, v := range variants {
+		converted[i] = Variant{Name: v.Name, URL: v.URL, Weight: v.Weight, Clicks: v.Clicks}
+	}
+	return converted
+}
+
+// toUTM convierte los parámetros de la petición en los del servicio
+func (u *UTMParams) toUTM() shortener.UTMParams {
+	if u == nil {
+		return shortener.UTMParams{}
+	}
+	return shortener.UTMParams{Source: u.Source, Medium: u.Medium, Campaign: u.Campaign}
+}
+
+// utmResponse convierte los parámetros del enlace en su representación HTTP
+func utmResponse(utm shortener.UTMParams) *UTMParams {
+	if utm.IsZero() {
+		return nil
+	}
+	return &UTMParams{Source: utm.Source, Medium: utm.Medium, Campaign: utm.Campaign}
+}
+
+// toInput convierte la petición en la entrada del servicio
+func (req ShortenRequest) toInput(owner string) shortener.ShortenInput {
+	return shortener.ShortenInput{
+		LongURL: req.LongURL,
+		Owner:   owner,
+		Alias:   strings.TrimSpace(req.Alias),
+		TTL:     time.Duration(req.TTLSeconds) * time.Second,
+
+		ForwardQuery: req.ForwardQuery,
+		UTM:          req.UTM.toUTM(),
+		Password:     req.Password,
+		GeoTargets:   req.GeoTargets,
+
+		DeviceTargets: req.DeviceTargets,
+
+		Variants:       toVariants(req.Variants),
+		StickyVariants: req.StickyVariants,
+		Interstitial:   req.Interstitial,
+		RedirectType:   req.RedirectType,
+		Cloak:          req.Cloak.toCloak(),
+		Referrers:      req.Referrers.toReferrerPolicy(),
+		IPAccess:       req.IPAccess.toIPAccessPolicy(),
+		Signed:         req.Signed,
+		Tags:           req.Tags,
+		Description:    req.Description,
+		CustomMetadata: req.CustomMetadata,
+	}
 }
 
 // ShortenResponse representa la respuesta con la URL acortada
@@ -36,128 +287,483 @@ type ShortenResponse struct {
 
 // ErrorResponse representa una respuesta de error
 type ErrorResponse struct {
-	Error   string `json:"error"`
-	Message string `json:"message"`
+	Error   errcode.Code `json:"error"`
+	Message string       `json:"message"`
+	// Errors detalla los campos inválidos cuando el error es de validación
+	Errors []FieldError `json:"errors,omitempty"`
+	// Suggestions son alias libres alternativos cuando el solicitado está ocupado
+	Suggestions []string `json:"suggestions,omitempty"`
 }
 
+// FieldError describe un campo inválido de la petición
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
 
-
-// ShortenURL maneja las peticiones POST /shorten con validación temprana
+// ShortenURL maneja las peticiones POST /shorten con validación temprana. El cuerpo puede ser
+// JSON, un formulario (application/x-www-form-urlencoded con long_url, alias y ttl_seconds) o
+// solo la URL en text/plain, para usarlo con curl -d o desde un bookmarklet. La respuesta es
+// JSON salvo que Accept prefiera text/plain; entonces es solo la URL corta o el mensaje de error.
 func (h *Handler) ShortenURL(w http.ResponseWriter, r *http.Request) {
-	// Configurar headers de respuesta
-	w.Header().Set("Content-Type", "application/json")
-
-	// Validación temprana: verificar Content-Type
-	if r.Header.Get("Content-Type") != "application/json" {
-		h.sendErrorResponse(w, http.StatusBadRequest, "invalid_content_type", "Content-Type debe ser application/json")
-		return
-	}
+	plain := wantsPlainText(r)
 
 	// Validación temprana: verificar método HTTP
 	if r.Method != http.MethodPost {
-		h.sendErrorResponse(w, http.StatusMethodNotAllowed, "method_not_allowed", "Método no permitido")
-		return
-	}
-
-	// Decodificar el cuerpo de la petición
-	var req ShortenRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		h.sendErrorResponse(w, http.StatusBadRequest, "invalid_json", fmt.Sprintf("Formato JSON inválido: %v", err))
+		h.sendShortenError(w, r, plain, http.StatusMethodNotAllowed, ErrorResponse{Error: errcode.MethodNotAllowed, Message: "Método no permitido"})
 		return
 	}
 
-	// Validación temprana: verificar que la URL no esté vacía (redundante pero defensiva)
-	if strings.TrimSpace(req.LongURL) == "" {
-		h.sendErrorResponse(w, http.StatusBadRequest, "empty_url", "La URL no puede estar vacía")
+	// Decodificar el cuerpo de la petición según su Content-Type
+	req, status, errResponse := decodeShortenRequest(r)
+	if status != 0 {
+		h.sendShortenError(w, r, plain, status, errResponse)
 		return
 	}
 
 	// Defer para logging de requests siguiendo la Guía 2
 	defer func() {
-		if r := recover(); r != nil {
-			h.sendErrorResponse(w, http.StatusInternalServerError, "panic_error", fmt.Sprintf("Error crítico: %v", r))
+		if p := recover(); p != nil {
+			h.sendShortenError(w, r, plain, http.StatusInternalServerError, ErrorResponse{Error: errcode.Panic, Message: fmt.Sprintf("Error crítico: %v", p)})
 		}
 	}()
 
-	// Acortar la URL con manejo idiomático de errores
-	if shortCode, err := h.service.ShortenURL(req.LongURL); err != nil {
-		// Switch idiomático para diferentes tipos de error
-		switch {
-		case errors.Is(err, shortener.ErrInvalidURL):
-			h.sendErrorResponse(w, http.StatusBadRequest, "invalid_url", "URL inválida")
-		case errors.Is(err, shortener.ErrEmptyURL):
-			h.sendErrorResponse(w, http.StatusBadRequest, "empty_url", "La URL no puede estar vacía")
-		case errors.Is(err, shortener.ErrMaxRetries):
-			h.sendErrorResponse(w, http.StatusInternalServerError, "generation_failed", "No se pudo generar un código único")
-		case strings.Contains(err.Error(), "crítico"):
-			h.sendErrorResponse(w, http.StatusInternalServerError, "critical_error", "Error crítico del sistema")
-		default:
-			h.sendErrorResponse(w, http.StatusInternalServerError, "internal_error", fmt.Sprintf("Error interno: %v", err))
-		}
+	// Idempotency-Key permite reintentar sin crear enlaces duplicados
+	idempotencyKey := strings.TrimSpace(r.Header.Get(IdempotencyKeyHeader))
+	if len(idempotencyKey) > MaxIdempotencyKeyLength {
+		h.sendShortenError(w, r, plain, http.StatusBadRequest, ErrorResponse{Error: errcode.InvalidIdempotencyKey,
+			Message: fmt.Sprintf("%s no puede superar %d caracteres", IdempotencyKeyHeader, MaxIdempotencyKeyLength)})
+		return
+	}
+
+	// Acortar la URL con manejo idiomático de errores; el propietario es el usuario autenticado
+	input := req.toInput(ownerFromRequest(r))
+	input.Client = h.quotaClient(r)
+	input.APIKey = apiKeyFromRequest(r)
+	input.Tenant = h.tenant(r)
+	input.Workspace = workspaceFromRequest(r)
+	if link, created, err := h.service.ShortenIdempotent(r.Context(), idempotencyKey, input); err != nil {
+		status, response := shortenErrorResponse(err)
+		h.sendShortenError(w, r, plain, status, response)
 		return
 	} else {
 		// Construir la URL corta completa solo si fue exitoso
-		baseURL := h.getBaseURL(r)
-		shortURL := fmt.Sprintf("%s/%s", baseURL, shortCode)
+		shortURL := h.shortURL(r, link)
+
+		// Un enlace existente reutilizado por deduplicación responde 200 en lugar de 201
+		status := http.StatusCreated
+		if !created {
+			status = http.StatusOK
+		}
+		if plain {
+			sendPlainText(w, status, shortURL)
+			return
+		}
+		h.sendJSON(w, status, ShortenResponse{ShortURL: shortURL})
+	}
+}
+
+// ShortenGet maneja GET /api/shorten?url=...&api_key=..., pensado para bookmarklets y fórmulas
+// de hojas de cálculo que solo pueden hacer un GET. Reutiliza el enlace existente del mismo
+// propietario para esa URL en lugar de crear uno nuevo en cada llamada, así que repetirla (o que
+// un proxy la reintente) no multiplica los enlaces. Responde siempre en texto plano.
+func (h *Handler) ShortenGet(w http.ResponseWriter, r *http.Request) {
+	// La respuesta depende del estado: ningún intermediario debe guardarla
+	w.Header().Set("Cache-Control", "no-store")
+
+	input := shortener.ShortenInput{
+		LongURL:     strings.TrimSpace(r.URL.Query().Get("url")),
+		Owner:       ownerFromRequest(r),
+		Client:      h.quotaClient(r),
+		APIKey:      apiKeyFromRequest(r),
+		Tenant:      h.tenant(r),
+		Workspace:   workspaceFromRequest(r),
+		Deduplicate: true,
+	}
+	link, created, err := h.service.Shorten(r.Context(), input)
+	if err != nil {
+		status, response := shortenErrorResponse(err)
+		h.sendShortenError(w, r, true, status, response)
+		return
+	}
+
+	status := http.StatusCreated
+	if !created {
+		status = http.StatusOK
+	}
+	sendPlainText(w, status, h.shortURL(r, link))
+}
+
+// decodeShortenRequest lee el cuerpo de POST /shorten según su Content-Type. Si falla retorna
+// el estado y el error a responder; status es 0 si el cuerpo es válido.
+func decodeShortenRequest(r *http.Request) (req ShortenRequest, status int, response ErrorResponse) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "application/json":
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			status, response = decodeErrorResponse(err, errcode.InvalidJSON, "Formato JSON inválido")
+			return
+		}
+	case "application/x-www-form-urlencoded":
+		if err := r.ParseForm(); err != nil {
+			status, response = decodeErrorResponse(err, errcode.InvalidForm, "Formulario inválido")
+			return
+		}
+		req.LongURL = r.PostForm.Get("long_url")
+		req.Alias = r.PostForm.Get("alias")
+		if value := r.PostForm.Get("ttl_seconds"); value != "" {
+			ttl, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return req, http.StatusBadRequest, ErrorResponse{Error: errcode.InvalidForm, Message: "ttl_seconds debe ser un entero",
+					Errors: []FieldError{{Field: "ttl_seconds", Message: "debe ser un entero"}}}
+			}
+			req.TTLSeconds = ttl
+		}
+	case "text/plain":
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			status, response = decodeErrorResponse(err, errcode.InvalidBody, "Cuerpo inválido")
+			return
+		}
+		req.LongURL = strings.TrimSpace(string(body))
+	default:
+		return req, http.StatusBadRequest, ErrorResponse{Error: errcode.InvalidContentType,
+			Message: "Content-Type debe ser application/json, application/x-www-form-urlencoded o text/plain"}
+	}
+	return req, 0, ErrorResponse{}
+}
+
+// decodeErrorResponse es el error de un cuerpo ilegible: 413 si supera el límite de tamaño o
+// 400 con code y el detalle en otro caso
+func decodeErrorResponse(err error, code errcode.Code, message string) (int, ErrorResponse) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return http.StatusRequestEntityTooLarge, ErrorResponse{Error: errcode.PayloadTooLarge, Message: bodyTooLargeMessage(tooLarge.Limit)}
+	}
+	return http.StatusBadRequest, ErrorResponse{Error: code, Message: fmt.Sprintf("%s: %v", message, err)}
+}
+
+// wantsPlainText indica si el cliente prefiere texto plano sobre JSON
+func wantsPlainText(r *http.Request) bool {
+	accept := r.Header.Get("Accept")
+	return strings.Contains(accept, "text/plain") && !strings.Contains(accept, "application/json")
+}
+
+// sendShortenError responde a un error de POST /shorten en JSON o, si plain, con el mensaje y
+// una línea por cada campo inválido
+func (h *Handler) sendShortenError(w http.ResponseWriter, r *http.Request, plain bool, status int, response ErrorResponse) {
+	response = localizeError(w, r, response)
+	if !plain {
+		h.sendJSON(w, status, response)
+		return
+	}
+	lines := []string{response.Message}
+	for _, field := range response.Errors {
+		lines = append(lines, fmt.Sprintf("%s: %s", field.Field, field.Message))
+	}
+	sendPlainText(w, status, strings.Join(lines, "\n"))
+}
+
+// sendPlainText responde con una línea de texto plano
+func sendPlainText(w http.ResponseWriter, status int, text string) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(status)
+	fmt.Fprintln(w, text)
+}
+
+// shortenErrorStatus traduce errores de creación de enlaces a estado HTTP, código y mensaje
+func shortenErrorStatus(err error) (int, errcode.Code, string) {
+	if status, code, message, ok := storeErrorStatus(err); ok {
+		return status, code, message
+	}
 
-		// Enviar respuesta exitosa
-		response := ShortenResponse{
-			ShortURL: shortURL,
+	// Switch idiomático para diferentes tipos de error
+	switch {
+	case errors.Is(err, shortener.ErrURLTooLong):
+		return http.StatusRequestEntityTooLarge, errcode.URLTooLong, "La URL supera la longitud máxima permitida"
+	case errors.Is(err, shortener.ErrQuotaExceeded):
+		return http.StatusTooManyRequests, errcode.QuotaExceeded, "Alcanzaste el máximo de enlaces permitidos"
+	case errors.Is(err, shortener.ErrUsageQuotaExceeded):
+		return http.StatusPaymentRequired, errcode.UsageQuotaExceeded, "La clave de API agotó su cuota mensual de enlaces"
+	case errors.Is(err, shortener.ErrTenantQuotaExceeded):
+		return http.StatusTooManyRequests, errcode.TenantQuotaExceeded, "El tenant alcanzó el máximo de enlaces permitidos"
+	case errors.Is(err, shortener.ErrStoreFull):
+		return http.StatusTooManyRequests, errcode.StoreFull, "El servicio alcanzó el máximo de enlaces almacenados"
+	case errors.Is(err, shortener.ErrMaliciousURL):
+		return http.StatusUnprocessableEntity, errcode.MaliciousURL, "El destino figura en una lista de sitios maliciosos"
+	case errors.Is(err, shortener.ErrUnreachableURL):
+		return http.StatusUnprocessableEntity, errcode.UnreachableURL, "El destino no responde"
+	case errors.Is(err, shortener.ErrInvalidURL):
+		return http.StatusBadRequest, errcode.InvalidURL, "URL inválida"
+	case errors.Is(err, shortener.ErrEmptyURL):
+		return http.StatusBadRequest, errcode.EmptyURL, "La URL no puede estar vacía"
+	case errors.Is(err, shortener.ErrInvalidAlias):
+		return http.StatusBadRequest, errcode.InvalidAlias, err.Error()
+	case errors.Is(err, shortener.ErrAliasNotAllowed):
+		return http.StatusUnprocessableEntity, errcode.AliasNotAllowed, err.Error()
+	case errors.Is(err, shortener.ErrAliasTaken):
+		return http.StatusConflict, errcode.AliasTaken, "El alias solicitado ya está en uso"
+	case errors.Is(err, shortener.ErrIdempotencyKeyReused):
+		return http.StatusUnprocessableEntity, errcode.IdempotencyKeyReused, "La clave de idempotencia ya se usó con una petición distinta"
+	case errors.Is(err, shortener.ErrCodeSpaceSaturated):
+		return http.StatusServiceUnavailable, errcode.CodeSpaceSaturated,
+			"El espacio de códigos está saturado; aumenta la longitud de los códigos (CODE_LENGTH) o el alfabeto"
+	case errors.Is(err, shortener.ErrMaxRetries):
+		return http.StatusInternalServerError, errcode.GenerationFailed, "No se pudo generar un código único"
+	case errors.As(err, new(*shortener.ValidationError)):
+		return http.StatusBadRequest, errcode.InvalidURL, err.Error()
+	case errors.Is(err, shortener.ErrCritical):
+		return http.StatusInternalServerError, errcode.Critical, "Error crítico del sistema"
+	default:
+		return http.StatusInternalServerError, errcode.Internal, fmt.Sprintf("Error interno: %v", err)
+	}
+}
+
+// shortenErrorResponse construye el cuerpo de error de una creación fallida, con el detalle
+// por campo si el error es de validación y las alternativas si el alias está ocupado
+func shortenErrorResponse(err error) (int, ErrorResponse) {
+	status, code, message := shortenErrorStatus(err)
+	response := ErrorResponse{Error: code, Message: message, Errors: validationErrors(err)}
+	var aliasErr *shortener.AliasTakenError
+	if errors.As(err, &aliasErr) {
+		response.Suggestions = aliasErr.Suggestions
+	}
+	return status, response
+}
+
+// validationErrors extrae los *shortener.ValidationError de err, incluidos los combinados con
+// errors.Join; retorna nil si no hay ninguno
+func validationErrors(err error) []FieldError {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		var fields []FieldError
+		for _, e := range joined.Unwrap() {
+			fields = append(fields, validationErrors(e)...)
 		}
+		return fields
+	}
+
+	var validationErr *shortener.ValidationError
+	if errors.As(err, &validationErr) {
+		return []FieldError{{Field: validationErr.Field, Message: validationErr.Msg}}
+	}
+	return nil
+}
 
-		w.WriteHeader(http.StatusCreated)
-		json.NewEncoder(w).Encode(response)
+// storeErrorStatus traduce fallos de infraestructura (contexto cancelado, deadline vencido o
+// almacén no disponible) a 503; ok es false si el error pertenece a otra categoría
+func storeErrorStatus(err error) (status int, code errcode.Code, message string, ok bool) {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusServiceUnavailable, errcode.Timeout, "La operación excedió el tiempo límite", true
+	case errors.Is(err, context.Canceled):
+		return http.StatusServiceUnavailable, errcode.RequestCanceled, "La petición fue cancelada", true
+	case errors.Is(err, shortener.ErrServiceUnavailable):
+		return http.StatusServiceUnavailable, errcode.ServiceUnavailable, "Servicio no disponible temporalmente", true
+	default:
+		return 0, "", "", false
 	}
 }
 
+// quotaClient identifica al cliente para la cuota de enlaces: el usuario autenticado o, si la
+// petición es anónima, la API key configurada o la IP como en el rate limiting
+func (h *Handler) quotaClient(r *http.Request) string {
+	if owner := ownerFromRequest(r); owner != "" {
+		return "user:" + owner
+	}
+	return rateLimitKey(r, h.service.KnownAPIKey)
+}
+
+// ownerFromRequest retorna el usuario autenticado de la petición o vacío si es anónima
+func ownerFromRequest(r *http.Request) string {
+	if claims, ok := auth.ClaimsFromContext(r.Context()); ok {
+		return claims.Subject
+	}
+	return ""
+}
+
+// workspaceFromRequest retorna el espacio compartido del editor autenticado o vacío si la
+// petición no es de un editor
+func workspaceFromRequest(r *http.Request) string {
+	if claims, ok := auth.ClaimsFromContext(r.Context()); ok && claims.Role == auth.RoleEditor {
+		return claims.Workspace
+	}
+	return ""
+}
+
 // RedirectURL maneja las peticiones GET /{short_code} con patrones idiomáticos de Go
 func (h *Handler) RedirectURL(w http.ResponseWriter, r *http.Request) {
 	// Defer para logging y panic recovery siguiendo la Guía 2
 	defer func() {
-		if r := recover(); r != nil {
-			h.sendErrorResponse(w, http.StatusInternalServerError, "panic_error", fmt.Sprintf("Error crítico en redirección: %v", r))
+		if p := recover(); p != nil {
+			h.sendErrorResponse(w, r, http.StatusInternalServerError, errcode.Panic, fmt.Sprintf("Error crítico en redirección: %v", p))
 		}
 	}()
 
 	// Obtener y validar el código corto con if idiomático
-	if shortCode := chi.URLParam(r, "short_code"); shortCode == "" {
-		h.sendErrorResponse(w, http.StatusBadRequest, "missing_code", "Código corto requerido")
+	if shortCode := shortCodeParam(r); shortCode == "" {
+		h.sendErrorResponse(w, r, http.StatusBadRequest, errcode.MissingCode, "Código corto requerido")
 		return
 	} else {
-		// Buscar la URL larga con manejo idiomático de errores
-		if longURL, err := h.service.GetLongURL(shortCode); err != nil {
+		// Buscar la URL larga en el espacio de códigos del host con manejo idiomático de errores
+		key := h.linkKey(r)
+		if redirect, err := h.service.ResolveRedirect(r.Context(), key, h.redirectRequest(r)); err != nil {
+			if status, code, message, ok := storeErrorStatus(err); ok {
+				h.sendErrorResponse(w, r, status, code, message)
+				return
+			}
+
 			// Switch idiomático para diferentes tipos de error
 			switch {
 			case errors.Is(err, shortener.ErrURLNotFound):
-				h.sendErrorResponse(w, http.StatusNotFound, "not_found", "Código corto no encontrado")
-			case strings.Contains(err.Error(), "crítico"):
-				h.sendErrorResponse(w, http.StatusInternalServerError, "critical_error", "Error crítico del sistema")
+				h.sendMissingLink(w, r, http.StatusNotFound, errcode.NotFound, "Código corto no encontrado")
+			case errors.Is(err, shortener.ErrURLExpired):
+				h.sendMissingLink(w, r, http.StatusGone, errcode.Expired, "El enlace ha expirado")
+			case errors.Is(err, shortener.ErrLinkDisabled):
+				h.sendMissingLink(w, r, http.StatusGone, errcode.Disabled, disabledMessage(err))
+			case errors.Is(err, shortener.ErrPasswordRequired), errors.Is(err, shortener.ErrInvalidPassword):
+				h.sendPasswordError(w, r, err)
+			case errors.Is(err, shortener.ErrPasswordLocked):
+				h.sendPasswordLockedError(w, r, err)
+			case errors.Is(err, shortener.ErrUsageQuotaExceeded):
+				h.sendUsageQuotaError(w, r, err)
+			case errors.Is(err, shortener.ErrReferrerNotAllowed):
+				h.sendErrorResponse(w, r, http.StatusForbidden, errcode.ReferrerNotAllowed,
+					"Este enlace solo se puede abrir desde los sitios autorizados")
+			case errors.Is(err, shortener.ErrSignatureRequired), errors.Is(err, shortener.ErrInvalidSignature),
+				errors.Is(err, shortener.ErrSignatureExpired):
+				h.sendSignatureError(w, r, err)
+			case errors.Is(err, shortener.ErrIPNotAllowed):
+				h.sendErrorResponse(w, r, http.StatusForbidden, errcode.IPNotAllowed,
+					"Este enlace no está disponible desde tu red")
+			case errors.Is(err, shortener.ErrLinkThrottled):
+				h.sendThrottledError(w, r, err)
+			case errors.Is(err, shortener.ErrCritical):
+				h.sendErrorResponse(w, r, http.StatusInternalServerError, errcode.Critical, "Error crítico del sistema")
 			default:
-				h.sendErrorResponse(w, http.StatusInternalServerError, "internal_error", fmt.Sprintf("Error interno: %v", err))
+				h.sendErrorResponse(w, r, http.StatusInternalServerError, errcode.Internal, fmt.Sprintf("Error interno: %v", err))
 			}
 			return
 		} else {
-			// Redirigir a la URL larga usando HTTP 307 (Temporary Redirect)
+			// Redirigir a la URL larga usando HTTP 307 (Temporary Redirect), o 301 en los
+			// enlaces creados como permanentes
 			// Justificación: HTTP 307 preserva el método HTTP original y es más apropiado
 			// para redirecciones temporales que pueden cambiar en el futuro
-			w.Header().Set("Location", longURL)
-			w.WriteHeader(http.StatusTemporaryRedirect)
+			// Un fallo al contabilizar la visita no debe impedir la redirección
+			_ = h.service.RecordClick(r.Context(), key, h.visitClick(r, redirect))
+			if redirect.Sticky && redirect.Variant != "" {
+				http.SetCookie(w, variantCookie(shortCode, redirect.Variant))
+			}
+			if redirect.Interstitial {
+				h.sendInterstitial(w, redirect)
+				return
+			}
+			if !redirect.Cloak.IsZero() {
+				h.sendCloak(w, r, redirect)
+				return
+			}
+			w.Header().Set("Location", redirect.URL)
+			status := h.redirectStatus(w, redirect)
+			// Tras el formulario de contraseña (POST) se usa 303 para que el navegador siga con
+			// GET y no reenvíe la contraseña al destino
+			if r.Method == http.MethodPost {
+				w.WriteHeader(http.StatusSeeOther)
+				return
+			}
+			w.WriteHeader(status)
 		}
 	}
 }
 
-// getBaseURL construye la URL base del servidor
-func (h *Handler) getBaseURL(r *http.Request) string {
-	scheme := "http"
-	if r.TLS != nil {
-		scheme = "https"
+// disabledMessage describe un enlace desactivado incluyendo el motivo si se conoce
+func disabledMessage(err error) string {
+	var disabled *shortener.DisabledError
+	if errors.As(err, &disabled) && disabled.Reason != "" {
+		return "El enlace está desactivado: " + disabled.Reason
+	}
+	return "El enlace está desactivado"
+}
+
+// sendThrottledError responde 429 a las visitas limitadas por tráfico anómalo, con Retry-After
+// hasta que se levanta la limitación
+func (h *Handler) sendThrottledError(w http.ResponseWriter, r *http.Request, err error) {
+	var throttled *shortener.ThrottledError
+	if errors.As(err, &throttled) {
+		if seconds := int(math.Ceil(time.Until(throttled.Until).Seconds())); seconds > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(seconds))
+		}
+	}
+	h.sendErrorResponse(w, r, http.StatusTooManyRequests, errcode.LinkThrottled,
+		"El enlace recibe un tráfico anómalo, intenta de nuevo más tarde")
+}
+
+// redirectRequest extrae de la visita los datos que usa el servicio para elegir el destino
+func (h *Handler) redirectRequest(r *http.Request) shortener.RedirectRequest {
+	req := shortener.RedirectRequest{Query: r.URL.Query(), Password: linkPassword(r), UserAgent: r.UserAgent(),
+		Locate: !h.privateVisit(r), Referrer: referrerHost(r)}
+	if cookie, err := r.Cookie(VariantCookiePrefix + url.PathEscape(shortCodeParam(r))); err == nil {
+		req.Variant = cookie.Value
+	}
+	if ip, err := netip.ParseAddr(ClientIP(r)); err == nil {
+		req.ClientIP = ip
+	}
+	if h.countryHeader != "" {
+		req.Country = r.Header.Get(h.countryHeader)
 	}
+	return req
+}
+
+// VariantCookiePrefix es el prefijo de la cookie que recuerda la variante A/B de cada enlace
+const VariantCookiePrefix = "ab_"
 
-	// Verificar headers de proxy
-	if forwarded := r.Header.Get("X-Forwarded-Proto"); forwarded != "" {
-		scheme = forwarded
+// VariantCookieMaxAge es el tiempo durante el que un visitante conserva su variante
+const VariantCookieMaxAge = 30 * 24 * time.Hour
+
+// variantCookie construye la cookie de la variante asignada; su ruta es la del enlace para no
+// enviarla al resto del sitio. El código va codificado como en la URL porque los alias Unicode
+// no son válidos en el nombre de una cookie.
+func variantCookie(shortCode, variant string) *http.Cookie {
+	escaped := url.PathEscape(shortCode)
+	return &http.Cookie{
+		Name:     VariantCookiePrefix + escaped,
+		Value:    variant,
+		Path:     "/" + escaped,
+		MaxAge:   int(VariantCookieMaxAge.Seconds()),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
 	}
+}
+
+// sendPasswordError responde a un enlace protegido sin contraseña válida: los navegadores
+// reciben el formulario y el resto de clientes un error JSON
+func (h *Handler) sendPasswordError(w http.ResponseWriter, r *http.Request, err error) {
+	status, code, message := http.StatusUnauthorized, errcode.PasswordRequired, "El enlace requiere contraseña"
+	if errors.Is(err, shortener.ErrInvalidPassword) {
+		status, code, message = http.StatusForbidden, errcode.InvalidPassword, "Contraseña incorrecta"
+	}
+	if wantsHTML(r) {
+		h.sendPasswordForm(w, r, status)
+		return
+	}
+	h.sendErrorResponse(w, r, status, code, message)
+}
+
+// sendPasswordLockedError responde 429 mientras el enlace rechaza contraseñas tras demasiados
+// intentos fallidos, con Retry-After hasta que se vuelven a admitir
+func (h *Handler) sendPasswordLockedError(w http.ResponseWriter, r *http.Request, err error) {
+	var locked *shortener.PasswordLockedError
+	if errors.As(err, &locked) {
+		if seconds := int(math.Ceil(time.Until(locked.Until).Seconds())); seconds > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(seconds))
+		}
+	}
+	h.sendErrorResponse(w, r, http.StatusTooManyRequests, errcode.PasswordLocked,
+		"Demasiados intentos de contraseña, intenta de nuevo más tarde")
+}
 
+// getBaseURL construye la URL base del servidor
+func (h *Handler) getBaseURL(r *http.Request) string {
+	// Detrás de un proxy de confianza el esquema es el que declara X-Forwarded-Proto
+	scheme := RequestScheme(r)
 	host := r.Host
 	if host == "" {
 		host = "localhost:8080"
@@ -166,14 +772,109 @@ func (h *Handler) getBaseURL(r *http.Request) string {
 	return fmt.Sprintf("%s://%s", scheme, host)
 }
 
+// shortURL construye la URL corta del enlace: sobre su dominio personalizado si lo tiene, con
+// el mismo esquema que la petición, y sobre la URL base del servidor si no. Los alias Unicode
+// se codifican con porcentajes (/%F0%9F%94%A5sale) y los dominios internacionalizados ya se
+// guardan en Punycode, de modo que la URL siempre es ASCII.
+func (h *Handler) shortURL(r *http.Request, link shortener.Link) string {
+	host, path := link.Domain, url.PathEscape(link.ShortCode)
+	if host == "" && link.Tenant != "" {
+		// Los tenants identificados solo por clave de API se sirven bajo /t/{tenant}/
+		if host = h.service.TenantHost(link.Tenant); host == "" {
+			path = "t/" + link.Tenant + "/" + path
+		}
+	}
+	if host == "" {
+		return fmt.Sprintf("%s/%s", h.getBaseURL(r), path)
+	}
+	scheme, _, _ := strings.Cut(h.getBaseURL(r), "://")
+	return fmt.Sprintf("%s://%s/%s", scheme, host, path)
+}
+
+// tenant retorna el tenant de la petición: el de la ruta /t/{tenant}/... y si no el de su
+// clave de API o su host. Vacío es el espacio común.
+func (h *Handler) tenant(r *http.Request) string {
+	if tenant := chi.URLParam(r, TenantParam); tenant != "" {
+		return tenant
+	}
+	return h.service.ResolveTenant(apiKeyFromRequest(r), r.Host)
+}
+
+// linkKey retorna la clave del código de la ruta en el espacio del tenant y el host de la
+// petición, de modo que go.acme.com/abc, el dominio principal y cada tenant resuelven enlaces
+// distintos
+func (h *Handler) linkKey(r *http.Request) string {
+	return shortener.TenantKey(h.tenant(r), h.service.ScopeCode(r.Host, shortCodeParam(r)))
+}
+
+// shortCodeParam retorna el código de la ruta decodificado. chi entrega el segmento tal como
+// llegó cuando el cliente no lo codificó de la forma canónica (p. ej. %f0 en minúsculas), así
+// que un alias Unicode puede llegar aún codificado.
+func shortCodeParam(r *http.Request) string {
+	code := chi.URLParam(r, "short_code")
+	if decoded, err := url.PathUnescape(code); err == nil {
+		return decoded
+	}
+	return code
+}
+
+// tenantCode retorna la clave en el espacio del tenant de la petición de un código recibido
+// en el cuerpo o en una consulta; el código vacío se conserva para que el servicio lo rechace
+func (h *Handler) tenantCode(r *http.Request, code string) string {
+	if code == "" {
+		return code
+	}
+	return shortener.TenantKey(h.tenant(r), code)
+}
+
+// managedLinkKey es linkKey para los endpoints de gestión, que se llaman desde el dominio
+// principal: el parámetro domain selecciona el dominio personalizado del enlace
+func (h *Handler) managedLinkKey(r *http.Request) string {
+	if domain := r.URL.Query().Get(DomainParam); domain != "" {
+		return shortener.TenantKey(h.tenant(r), shortener.DomainLinkKey(domain, shortCodeParam(r)))
+	}
+	return h.linkKey(r)
+}
+
+// managedCodeKey es managedLinkKey para los códigos recibidos en el cuerpo de la petición; el
+// código vacío se conserva para que el servicio lo rechace
+func (h *Handler) managedCodeKey(r *http.Request, code string) string {
+	switch domain := r.URL.Query().Get(DomainParam); {
+	case code == "":
+		return code
+	case domain != "":
+		return shortener.TenantKey(h.tenant(r), shortener.DomainLinkKey(domain, code))
+	default:
+		return shortener.TenantKey(h.tenant(r), h.service.ScopeCode(r.Host, code))
+	}
+}
+
+// sendDecodeError responde al fallo de decodificación del cuerpo JSON: 413 si se superó el
+// límite impuesto por MaxBodySize y 400 en cualquier otro caso
+func (h *Handler) sendDecodeError(w http.ResponseWriter, r *http.Request, err error) {
+	status, response := decodeErrorResponse(err, errcode.InvalidJSON, "Formato JSON inválido")
+	h.sendJSON(w, status, localizeError(w, r, response))
+}
+
 // sendErrorResponse envía una respuesta de error en formato JSON
-func (h *Handler) sendErrorResponse(w http.ResponseWriter, statusCode int, errorCode, message string) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(statusCode)
-	
-	errorResponse := ErrorResponse{
+func (h *Handler) sendErrorResponse(w http.ResponseWriter, r *http.Request, statusCode int, errorCode errcode.Code, message string) {
+	writeErrorResponse(w, r, statusCode, errorCode, message)
+}
+
+// sendServiceError responde al error de una creación de enlace incluyendo el detalle por campo
+func (h *Handler) sendServiceError(w http.ResponseWriter, r *http.Request, err error) {
+	status, response := shortenErrorResponse(err)
+	h.sendJSON(w, status, localizeError(w, r, response))
+}
+
+// writeErrorResponse escribe el cuerpo ErrorResponse estándar en el idioma de la petición; lo
+// comparten handlers y middlewares
+func writeErrorResponse(w http.ResponseWriter, r *http.Request, statusCode int, errorCode errcode.Code, message string) {
+	errorResponse := localizeError(w, r, ErrorResponse{
 		Error:   errorCode,
 		Message: message,
-	}
+	})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
 	json.NewEncoder(w).Encode(errorResponse)
 }
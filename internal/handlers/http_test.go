@@ -1,16 +1,38 @@
 package handlers
 
 import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"context"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
+	"html/template"
+	"io"
+	"mime/multipart"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 
+	"acortador-urls/internal/analytics"
+	"acortador-urls/internal/auth"
+	"acortador-urls/internal/backup"
+	"acortador-urls/internal/cache"
+	"acortador-urls/internal/errcode"
+	"acortador-urls/internal/oidc"
+	"acortador-urls/internal/ratelimit"
 	"acortador-urls/internal/shortener"
+	"acortador-urls/internal/threat"
+	"acortador-urls/internal/webhooks"
 )
 
 func TestHandler_ShortenURL(t *testing.T) {
@@ -66,6 +88,12 @@ func TestHandler_ShortenURL(t *testing.T) {
 			expectedStatus: http.StatusBadRequest,
 			expectShortURL: false,
 		},
+		{
+			name:           "Alias reservado",
+			requestBody:    `{"long_url": "https://example.com", "alias": "shorten"}`,
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectShortURL: false,
+		},
 	}
 
 	for _, tt := range tests {
@@ -107,217 +135,4964 @@ func TestHandler_ShortenURL(t *testing.T) {
 	}
 }
 
-func TestHandler_RedirectURL(t *testing.T) {
-	store := shortener.NewStore()
-	service := shortener.NewService(store)
-	handler := NewHandler(service)
+func TestHandler_ShortenURL_ContentNegotiation(t *testing.T) {
+	handler := NewHandler(shortener.NewService(shortener.NewStore()))
 
-	// Crear una URL de prueba
-	testURL := "https://www.example.com/test"
-	shortCode, err := service.ShortenURL(testURL)
-	if err != nil {
-		t.Fatalf("Error creating test URL: %v", err)
+	tests := []struct {
+		name                string
+		contentType         string
+		accept              string
+		body                string
+		expectedStatus      int
+		expectedContentType string
+		expectedBody        string
+	}{
+		{name: "JSON con charset", contentType: "application/json; charset=utf-8", body: `{"long_url": "https://www.example.com/json"}`,
+			expectedStatus: http.StatusCreated, expectedContentType: "application/json", expectedBody: `"short_url":"http://example.com/`},
+		{name: "Formulario", contentType: "application/x-www-form-urlencoded", body: "long_url=https%3A%2F%2Fwww.example.com%2Fform&alias=formulario",
+			expectedStatus: http.StatusCreated, expectedContentType: "application/json", expectedBody: `{"short_url":"http://example.com/formulario"}`},
+		{name: "Formulario con respuesta en texto", contentType: "application/x-www-form-urlencoded", accept: "text/plain",
+			body: "long_url=https%3A%2F%2Fwww.example.com%2Ftexto&alias=texto", expectedStatus: http.StatusCreated,
+			expectedContentType: "text/plain; charset=utf-8", expectedBody: "http://example.com/texto\n"},
+		{name: "Formulario con TTL inválido", contentType: "application/x-www-form-urlencoded", body: "long_url=https%3A%2F%2Fwww.example.com%2F&ttl_seconds=mañana",
+			expectedStatus: http.StatusBadRequest, expectedContentType: "application/json", expectedBody: `"field":"ttl_seconds"`},
+		{name: "Texto plano", contentType: "text/plain", accept: "text/plain, */*", body: "  https://www.example.com/plano\n",
+			expectedStatus: http.StatusCreated, expectedContentType: "text/plain; charset=utf-8", expectedBody: "http://example.com/"},
+		{name: "Texto plano con URL inválida", contentType: "text/plain", accept: "text/plain", body: "no-es-una-url",
+			expectedStatus: http.StatusBadRequest, expectedContentType: "text/plain; charset=utf-8", expectedBody: "long_url: "},
+		{name: "JSON preferido sobre texto", contentType: "text/plain", accept: "application/json, text/plain", body: "https://www.example.com/",
+			expectedStatus: http.StatusCreated, expectedContentType: "application/json", expectedBody: `"short_url"`},
+		{name: "Content-Type no soportado", contentType: "application/xml", accept: "text/plain", body: "<url/>",
+			expectedStatus: http.StatusBadRequest, expectedContentType: "text/plain; charset=utf-8", expectedBody: "text/plain\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/shorten", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			rr := httptest.NewRecorder()
+			handler.ShortenURL(rr, req)
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if ct := rr.Header().Get("Content-Type"); ct != tt.expectedContentType {
+				t.Errorf("Expected Content-Type %q, got %q", tt.expectedContentType, ct)
+			}
+			if !strings.Contains(rr.Body.String(), tt.expectedBody) {
+				t.Errorf("Expected body to contain %q, got %q", tt.expectedBody, rr.Body.String())
+			}
+		})
 	}
+}
+
+func TestHandler_ShortenGet(t *testing.T) {
+	service := shortener.NewService(shortener.NewStore(), shortener.WithLinkQuotas(0, 2), shortener.WithAPIKeys("clave", "otra"))
+	handler := NewHandler(service)
 
 	tests := []struct {
 		name           string
-		shortCode      string
+		query          string
 		expectedStatus int
-		expectedURL    string
+		expectedBody   string
 	}{
-		{
-			name:           "Código válido",
-			shortCode:      shortCode,
-			expectedStatus: http.StatusTemporaryRedirect,
-			expectedURL:    testURL,
-		},
-		{
-			name:           "Código no existente",
-			shortCode:      "nonexistent",
-			expectedStatus: http.StatusNotFound,
-			expectedURL:    "",
-		},
-		{
-			name:           "Código vacío",
-			shortCode:      "",
-			expectedStatus: http.StatusBadRequest,
-			expectedURL:    "",
-		},
+		{name: "Enlace creado", query: "?url=https%3A%2F%2Fwww.example.com%2Fmarcador&api_key=clave", expectedStatus: http.StatusCreated,
+			expectedBody: "http://example.com/"},
+		{name: "Enlace reutilizado", query: "?url=https%3A%2F%2Fwww.example.com%2Fmarcador&api_key=clave", expectedStatus: http.StatusOK,
+			expectedBody: "http://example.com/"},
+		{name: "Sin URL", query: "?api_key=clave", expectedStatus: http.StatusBadRequest, expectedBody: "URL"},
+		{name: "URL inválida", query: "?url=no-es-una-url&api_key=clave", expectedStatus: http.StatusBadRequest, expectedBody: "long_url: "},
+		// La cuota se cuenta por api_key: la segunda URL distinta de la misma clave la agota
+		{name: "Cuota por clave de API", query: "?url=https%3A%2F%2Fwww.example.com%2Fotra&api_key=clave", expectedStatus: http.StatusCreated},
+		{name: "Cuota agotada", query: "?url=https%3A%2F%2Fwww.example.com%2Ftercera&api_key=clave", expectedStatus: http.StatusTooManyRequests},
+		{name: "Otra clave de API", query: "?url=https%3A%2F%2Fwww.example.com%2Ftercera&api_key=otra", expectedStatus: http.StatusCreated},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			// Configurar router con chi para manejar parámetros de URL
-			r := chi.NewRouter()
-			r.Get("/{short_code}", handler.RedirectURL)
-
-			req := httptest.NewRequest(http.MethodGet, "/"+tt.shortCode, nil)
 			rr := httptest.NewRecorder()
-
-			r.ServeHTTP(rr, req)
-
+			handler.ShortenGet(rr, httptest.NewRequest(http.MethodGet, "/api/shorten"+tt.query, nil))
 			if rr.Code != tt.expectedStatus {
-				t.Errorf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
 			}
-
-			if tt.expectedStatus == http.StatusTemporaryRedirect {
-				location := rr.Header().Get("Location")
-				if location != tt.expectedURL {
-					t.Errorf("Expected Location header %s, got %s", tt.expectedURL, location)
-				}
+			if ct := rr.Header().Get("Content-Type"); ct != "text/plain; charset=utf-8" {
+				t.Errorf("Expected plain text, got %q", ct)
+			}
+			if rr.Header().Get("Cache-Control") != "no-store" {
+				t.Errorf("Expected Cache-Control no-store")
+			}
+			if !strings.Contains(rr.Body.String(), tt.expectedBody) {
+				t.Errorf("Expected body to contain %q, got %q", tt.expectedBody, rr.Body.String())
 			}
 		})
 	}
+
+	get := func(query string) string {
+		rr := httptest.NewRecorder()
+		handler.ShortenGet(rr, httptest.NewRequest(http.MethodGet, "/api/shorten"+query, nil))
+		return rr.Body.String()
+	}
+	if first, second := get("?url=https%3A%2F%2Fwww.example.com%2Fmarcador&api_key=otra"), get("?url=https%3A%2F%2Fwww.example.com%2Fmarcador&api_key=otra"); first != second {
+		t.Errorf("Expected repeated calls to return the same short URL, got %q and %q", first, second)
+	}
 }
 
-func TestHandler_Integration(t *testing.T) {
-	store := shortener.NewStore()
-	service := shortener.NewService(store)
+func TestHandler_CustomDomains(t *testing.T) {
+	service := shortener.NewService(shortener.NewStore())
 	handler := NewHandler(service)
+	tokens := auth.NewTokenManager([]byte("secreto-de-prueba"), time.Hour)
 
-	// Configurar router completo
 	r := chi.NewRouter()
+	r.Use(Authenticate(tokens))
 	r.Post("/shorten", handler.ShortenURL)
+	r.Route("/admin", func(r chi.Router) {
+		r.Use(RequireAuth, RequireAdmin)
+		r.Get("/custom-domains", handler.ListCustomDomains)
+		r.Put("/custom-domains/{host}", handler.RegisterCustomDomain)
+		r.Delete("/custom-domains/{host}", handler.RemoveCustomDomain)
+	})
+	r.With(RequireAuth).Patch("/api/urls/{short_code}", handler.UpdateURL)
 	r.Get("/{short_code}", handler.RedirectURL)
 
-	// Test flujo completo: acortar y luego redirigir
-	testURL := "https://www.example.com/integration/test?param=value"
-
-	// 1. Acortar URL
-	requestBody := `{"long_url": "` + testURL + `"}`
-	req := httptest.NewRequest(http.MethodPost, "/shorten", strings.NewReader(requestBody))
-	req.Header.Set("Content-Type", "application/json")
-
-	rr := httptest.NewRecorder()
-	r.ServeHTTP(rr, req)
+	aliceToken, _ := tokens.Issue("alice", auth.RoleUser)
+	adminToken, _ := tokens.Issue("root", auth.RoleAdmin)
 
-	if rr.Code != http.StatusCreated {
-		t.Fatalf("Expected status %d for shorten, got %d", http.StatusCreated, rr.Code)
+	do := func(method, host, path, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Host = host
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
 	}
 
-	var response ShortenResponse
-	if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
-		t.Fatalf("Error decoding shorten response: %v", err)
+	// Registro de dominios reservado a los administradores
+	registration := []struct {
+		name           string
+		method         string
+		path           string
+		token          string
+		body           string
+		expectedStatus int
+	}{
+		{"Dominio registrado", http.MethodPut, "/admin/custom-domains/go.acme.com", adminToken, `{"owner": "alice"}`, http.StatusOK},
+		{"Dominio de otro propietario", http.MethodPut, "/admin/custom-domains/go.acme.com", adminToken, `{"owner": "bob"}`, http.StatusConflict},
+		{"Host inválido", http.MethodPut, "/admin/custom-domains/localhost", adminToken, `{"owner": "alice"}`, http.StatusBadRequest},
+		{"Sin propietario", http.MethodPut, "/admin/custom-domains/links.acme.com", adminToken, `{}`, http.StatusBadRequest},
+		{"Usuario sin permisos", http.MethodPut, "/admin/custom-domains/mio.example.com", aliceToken, `{"owner": "alice"}`, http.StatusForbidden},
+	}
+	for _, tt := range registration {
+		t.Run(tt.name, func(t *testing.T) {
+			if rr := do(tt.method, "example.com", tt.path, tt.token, tt.body); rr.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+		})
+	}
+	var domains CustomDomainListResponse
+	json.NewDecoder(do(http.MethodGet, "example.com", "/admin/custom-domains", adminToken, "").Body).Decode(&domains)
+	if len(domains.Domains) != 1 || domains.Domains[0] != (CustomDomainResponse{Host: "go.acme.com", Owner: "alice"}) {
+		t.Errorf("Expected go.acme.com for alice, got %+v", domains)
 	}
 
-	// Extraer el código corto de la URL
-	parts := strings.Split(response.ShortURL, "/")
-	shortCode := parts[len(parts)-1]
-
-	// 2. Redirigir usando el código corto
-	req = httptest.NewRequest(http.MethodGet, "/"+shortCode, nil)
-	rr = httptest.NewRecorder()
+	// La URL corta de los enlaces de Alice usa su dominio aunque se creen desde el principal
+	rr := do(http.MethodPost, "example.com", "/shorten", aliceToken, `{"long_url": "https://www.acme.com/", "alias": "promo"}`)
+	var created ShortenResponse
+	json.NewDecoder(rr.Body).Decode(&created)
+	if rr.Code != http.StatusCreated || created.ShortURL != "http://go.acme.com/promo" {
+		t.Fatalf("Expected http://go.acme.com/promo, got %d %+v", rr.Code, created)
+	}
+	do(http.MethodPost, "example.com", "/shorten", "", `{"long_url": "https://www.example.com/", "alias": "promo"}`)
 
-	r.ServeHTTP(rr, req)
+	redirects := []struct {
+		name             string
+		host             string
+		expectedLocation string
+	}{
+		{"Dominio personalizado", "go.acme.com", "https://www.acme.com/"},
+		{"Dominio principal", "example.com", "https://www.example.com/"},
+	}
+	for _, tt := range redirects {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := do(http.MethodGet, tt.host, "/promo", "", "")
+			if rr.Code != http.StatusTemporaryRedirect || rr.Header().Get("Location") != tt.expectedLocation {
+				t.Errorf("Expected redirect to %s, got %d %s", tt.expectedLocation, rr.Code, rr.Header().Get("Location"))
+			}
+		})
+	}
 
-	if rr.Code != http.StatusTemporaryRedirect {
-		t.Errorf("Expected status %d for redirect, got %d", http.StatusTemporaryRedirect, rr.Code)
+	// La gestión desde el dominio principal selecciona el enlace con ?domain=
+	rr = do(http.MethodPatch, "example.com", "/api/urls/promo?domain=go.acme.com", aliceToken, `{"long_url": "https://www.acme.com/nueva"}`)
+	var updated LinkResponse
+	json.NewDecoder(rr.Body).Decode(&updated)
+	if rr.Code != http.StatusOK || updated.Domain != "go.acme.com" || updated.ShortURL != "http://go.acme.com/promo" {
+		t.Errorf("Expected scoped link updated, got %d %+v", rr.Code, updated)
+	}
+	// domain se normaliza como el host: mayúsculas y puerto no cambian el enlace seleccionado
+	rr = do(http.MethodPatch, "example.com", "/api/urls/promo?domain=GO.Acme.com:8443", aliceToken, `{"long_url": "https://www.acme.com/puerto"}`)
+	if json.NewDecoder(rr.Body).Decode(&updated); rr.Code != http.StatusOK || updated.Domain != "go.acme.com" {
+		t.Errorf("Expected the normalized domain to select the scoped link, got %d %+v", rr.Code, updated)
+	}
+	if rr := do(http.MethodPatch, "example.com", "/api/urls/promo", aliceToken, `{"long_url": "https://www.acme.com/otra"}`); rr.Code != http.StatusForbidden {
+		t.Errorf("Expected the main domain link to stay out of reach, got %d", rr.Code)
 	}
 
-	location := rr.Header().Get("Location")
-	if location != testURL {
-		t.Errorf("Expected redirect to %s, got %s", testURL, location)
+	if rr := do(http.MethodDelete, "example.com", "/admin/custom-domains/go.acme.com", adminToken, ""); rr.Code != http.StatusNoContent {
+		t.Errorf("Expected status %d, got %d", http.StatusNoContent, rr.Code)
+	}
+	if rr := do(http.MethodDelete, "example.com", "/admin/custom-domains/go.acme.com", adminToken, ""); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, rr.Code)
 	}
 }
 
-func TestHandler_ConcurrentRequests(t *testing.T) {
-	store := shortener.NewStore()
-	service := shortener.NewService(store)
+func TestHandler_Tenants(t *testing.T) {
+	service := shortener.NewService(shortener.NewStore(),
+		shortener.WithTenants(map[string]string{"clave-a": "equipo-a"}, map[string]string{"go.equipo-b.com": "equipo-b"}))
 	handler := NewHandler(service)
+	tokens := auth.NewTokenManager([]byte("secreto-de-prueba"), time.Hour)
 
 	r := chi.NewRouter()
+	r.Use(Authenticate(tokens))
 	r.Post("/shorten", handler.ShortenURL)
+	r.Route("/admin", func(r chi.Router) {
+		r.Use(RequireAuth, RequireAdmin)
+		r.Get("/export", handler.ExportLinks)
+		r.Get("/tenants", handler.ListTenants)
+	})
 	r.Get("/{short_code}", handler.RedirectURL)
+	r.Get("/t/{tenant}/{short_code}", handler.RedirectURL)
 
-	// Crear servidor de prueba
-	server := httptest.NewServer(r)
-	defer server.Close()
-
-	// Realizar múltiples peticiones concurrentes
-	numRequests := 50
-	results := make(chan string, numRequests)
-	errors := make(chan error, numRequests)
-
-	for i := 0; i < numRequests; i++ {
-		go func(id int) {
-			testURL := fmt.Sprintf("https://concurrent%d.com", id)
-			requestBody := fmt.Sprintf(`{"long_url": "%s"}`, testURL)
+	adminToken, _ := tokens.Issue("root", auth.RoleAdmin)
 
-			resp, err := http.Post(server.URL+"/shorten", "application/json", strings.NewReader(requestBody))
-			if err != nil {
-				errors <- err
-				return
-			}
-			defer resp.Body.Close()
+	do := func(method, host, path, apiKey, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Host = host
+		req.Header.Set("Content-Type", "application/json")
+		if apiKey != "" {
+			req.Header.Set(APIKeyHeader, apiKey)
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
 
-			if resp.StatusCode != http.StatusCreated {
-				errors <- fmt.Errorf("unexpected status: %d", resp.StatusCode)
-				return
+	// El mismo alias en el espacio común y en cada tenant
+	creations := []struct {
+		name        string
+		host        string
+		apiKey      string
+		longURL     string
+		expectedURL string
+	}{
+		{"Espacio común", "example.com", "", "https://www.example.com/", "http://example.com/promo"},
+		{"Tenant por clave de API", "example.com", "clave-a", "https://www.equipo-a.com/", "http://example.com/t/equipo-a/promo"},
+		{"Tenant por host", "go.equipo-b.com", "", "https://www.equipo-b.com/", "http://go.equipo-b.com/promo"},
+	}
+	for _, tt := range creations {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := do(http.MethodPost, tt.host, "/shorten", tt.apiKey, "", `{"long_url": "`+tt.longURL+`", "alias": "promo"}`)
+			var created ShortenResponse
+			json.NewDecoder(rr.Body).Decode(&created)
+			if rr.Code != http.StatusCreated || created.ShortURL != tt.expectedURL {
+				t.Errorf("Expected %s, got %d %s", tt.expectedURL, rr.Code, rr.Body.String())
 			}
+		})
+	}
 
-			var response ShortenResponse
-			if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-				errors <- err
-				return
+	redirects := []struct {
+		name             string
+		host             string
+		path             string
+		expectedLocation string
+	}{
+		{"Espacio común", "example.com", "/promo", "https://www.example.com/"},
+		{"Ruta del tenant", "example.com", "/t/equipo-a/promo", "https://www.equipo-a.com/"},
+		{"Host del tenant", "go.equipo-b.com", "/promo", "https://www.equipo-b.com/"},
+	}
+	for _, tt := range redirects {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := do(http.MethodGet, tt.host, tt.path, "", "", "")
+			if rr.Code != http.StatusTemporaryRedirect || rr.Header().Get("Location") != tt.expectedLocation {
+				t.Errorf("Expected redirect to %s, got %d %s", tt.expectedLocation, rr.Code, rr.Header().Get("Location"))
 			}
-
-			results <- response.ShortURL
-		}(i)
+		})
 	}
 
-	// Recopilar resultados
-	shortURLs := make(map[string]bool)
-	for i := 0; i < numRequests; i++ {
-		select {
-		case url := <-results:
-			if shortURLs[url] {
-				t.Errorf("Duplicate short URL generated: %s", url)
-			}
-			shortURLs[url] = true
-		case err := <-errors:
-			t.Errorf("Error in concurrent request: %v", err)
-		}
+	// La exportación solo incluye los enlaces del tenant elegido
+	rr := do(http.MethodGet, "example.com", "/admin/export?tenant=equipo-a", "", adminToken, "")
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "https://www.equipo-a.com/") || strings.Contains(rr.Body.String(), "https://www.example.com/") {
+		t.Errorf("Expected only equipo-a links, got %d %s", rr.Code, rr.Body.String())
+	}
+	if rr := do(http.MethodGet, "example.com", "/admin/export?tenant=desconocido", "", adminToken, ""); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, rr.Code)
 	}
 
-	if len(shortURLs) != numRequests {
-		t.Errorf("Expected %d unique URLs, got %d", numRequests, len(shortURLs))
+	var tenants TenantListResponse
+	json.NewDecoder(do(http.MethodGet, "example.com", "/admin/tenants", "", adminToken, "").Body).Decode(&tenants)
+	// Las redirecciones de la prueba no llevan User-Agent y cuentan como visitas de bots
+	expected := []TenantStatsResponse{
+		{Tenant: "", Links: 1, Clicks: 1, BotClicks: 1},
+		{Tenant: "equipo-a", Links: 1, Clicks: 1, BotClicks: 1},
+		{Tenant: "equipo-b", Host: "go.equipo-b.com", Links: 1, Clicks: 1, BotClicks: 1},
+	}
+	if !reflect.DeepEqual(tenants.Tenants, expected) {
+		t.Errorf("Expected tenants %+v, got %+v", expected, tenants.Tenants)
 	}
 }
 
-func BenchmarkHandler_ShortenURL(b *testing.B) {
-	store := shortener.NewStore()
-	service := shortener.NewService(store)
+func TestHandler_Roles(t *testing.T) {
+	service := shortener.NewService(shortener.NewStore())
 	handler := NewHandler(service)
+	tokens := auth.NewTokenManager([]byte("secreto-de-prueba"), time.Hour)
+	keys, err := auth.ParseAPIKeys(map[string]string{"k-editor": "bot:editor:marketing", "k-admin": "ops:admin"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
 
-	requestBody := `{"long_url": "https://www.example.com/benchmark/test"}`
+	r := chi.NewRouter()
+	r.Use(Authenticate(tokens), AuthenticateAPIKeys(keys))
+	r.Post("/shorten", handler.ShortenURL)
+	r.With(RequireAuth, RequireAdmin).Get("/admin/export", handler.ExportLinks)
+	r.With(RequireAuth).Patch("/api/urls/{short_code}", handler.UpdateURL)
+	r.With(RequireAuth, RequireRole(auth.RoleOwner, auth.RoleAdmin)).Delete("/api/urls/{short_code}", handler.DeleteURL)
 
-	b.ResetTimer()
-	for i := 0; i < b.N; i++ {
-		req := httptest.NewRequest(http.MethodPost, "/shorten", strings.NewReader(requestBody))
-		req.Header.Set("Content-Type", "application/json")
+	editorToken, _ := tokens.IssueClaims(auth.Claims{Subject: "ana", Role: auth.RoleEditor, Workspace: "marketing"})
+	ownerToken, _ := tokens.Issue("luis", auth.RoleOwner)
 
+	do := func(method, path, apiKey, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if apiKey != "" {
+			req.Header.Set(APIKeyHeader, apiKey)
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
 		rr := httptest.NewRecorder()
-		handler.ShortenURL(rr, req)
+		r.ServeHTTP(rr, req)
+		return rr
 	}
-}
 
-func BenchmarkHandler_RedirectURL(b *testing.B) {
-	store := shortener.NewStore()
-	service := shortener.NewService(store)
-	handler := NewHandler(service)
+	// La clave del editor crea enlaces en su espacio compartido
+	rr := do(http.MethodPost, "/shorten", "k-editor", "", `{"long_url": "https://www.example.com/", "alias": "campana"}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+	do(http.MethodPost, "/shorten", "", ownerToken, `{"long_url": "https://www.example.com/luis", "alias": "luis"}`)
 
-	// Preparar datos de prueba
-	testURL := "https://www.example.com/benchmark"
-	shortCode, _ := service.ShortenURL(testURL)
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		apiKey         string
+		token          string
+		expectedStatus int
+	}{
+		{"Editor del espacio edita", http.MethodPatch, "/api/urls/campana", "", editorToken, http.StatusOK},
+		{"Editor no edita enlaces ajenos", http.MethodPatch, "/api/urls/luis", "", editorToken, http.StatusForbidden},
+		{"Editor no elimina", http.MethodDelete, "/api/urls/campana", "k-editor", "", http.StatusForbidden},
+		{"Editor sin acceso a admin", http.MethodGet, "/admin/export", "k-editor", "", http.StatusForbidden},
+		{"Clave de admin en admin", http.MethodGet, "/admin/export", "k-admin", "", http.StatusOK},
+		{"Clave sin identidad", http.MethodPatch, "/api/urls/campana", "k-otra", "", http.StatusUnauthorized},
+		{"Propietario elimina", http.MethodDelete, "/api/urls/luis", "", ownerToken, http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := ""
+			if tt.method == http.MethodPatch {
+				body = `{"long_url": "https://www.example.com/nueva"}`
+			}
+			if rr := do(tt.method, tt.path, tt.apiKey, tt.token, body); rr.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
 
+func TestHandler_OIDC(t *testing.T) {
+	// Proveedor OAuth 2.0 de prueba cuyo endpoint de usuario retorna identity
+	var identity map[string]interface{}
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/token":
+			if r.PostFormValue("code") != "codigo" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]string{"access_token": "acceso"})
+		case "/user":
+			json.NewEncoder(w).Encode(identity)
+		}
+	}))
+	defer provider.Close()
+
+	users, err := auth.ParseGrants(map[string]string{"ana@example.com": "ana:admin", "bot@example.com": "bot:editor:marketing"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	handler := NewHandler(shortener.NewService(shortener.NewStore()), WithOIDCLogin(&OIDCLogin{
+		Provider: oidc.NewProvider(oidc.Endpoints{AuthURL: provider.URL + "/authorize", TokenURL: provider.URL + "/token",
+			UserInfoURL: provider.URL + "/user"}, "cliente", "secreto", "http://example.com/auth/oidc/callback", nil),
+		Name:         "Keycloak",
+		SubjectClaim: "email",
+		Users:        users,
+	}))
+	tokens := auth.NewTokenManager([]byte("secreto-de-prueba"), time.Hour)
 	r := chi.NewRouter()
-	r.Get("/{short_code}", handler.RedirectURL)
+	r.Mount(OIDCPath, handler.OIDC(tokens))
+	r.Mount(AdminUIPath, handler.AdminUI(tokens))
 
-	b.ResetTimer()
-	for i := 0; i < b.N; i++ {
-		req := httptest.NewRequest(http.MethodGet, "/"+shortCode, nil)
+	// login inicia el flujo y retorna la cookie y el state enviados al proveedor
+	login := func(mode string) (*http.Cookie, string) {
 		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, OIDCPath+"/login?mode="+mode, nil))
+		location, err := url.Parse(rr.Header().Get("Location"))
+		if rr.Code != http.StatusFound || err != nil || len(rr.Result().Cookies()) != 1 {
+			t.Fatalf("Expected redirect to the provider with a flow cookie, got %d %q", rr.Code, rr.Header().Get("Location"))
+		}
+		return rr.Result().Cookies()[0], location.Query().Get("state")
+	}
 
-		r.ServeHTTP(rr, req)
+	tests := []struct {
+		name           string
+		mode           string
+		identity       map[string]interface{}
+		code           string
+		wrongState     bool
+		expectedStatus int
+		expectedRole   string
+	}{
+		{"API con usuario registrado", "api", map[string]interface{}{"email": "Ana@example.com"}, "codigo", false, http.StatusOK, auth.RoleAdmin},
+		{"API con editor", "api", map[string]interface{}{"email": "bot@example.com"}, "codigo", false, http.StatusOK, auth.RoleEditor},
+		{"Identidad desconocida", "api", map[string]interface{}{"email": "otro@example.com"}, "codigo", false, http.StatusForbidden, ""},
+		{"Email no verificado", "api", map[string]interface{}{"email": "ana@example.com", "email_verified": false}, "codigo", false, http.StatusForbidden, ""},
+		{"State distinto", "api", map[string]interface{}{"email": "ana@example.com"}, "codigo", true, http.StatusBadRequest, ""},
+		{"Código rechazado", "api", map[string]interface{}{"email": "ana@example.com"}, "otro", false, http.StatusBadGateway, ""},
+		{"Panel con editor", "ui", map[string]interface{}{"email": "bot@example.com"}, "codigo", false, http.StatusForbidden, ""},
+		{"Panel con administrador", "ui", map[string]interface{}{"email": "ana@example.com"}, "codigo", false, http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			identity = tt.identity
+			cookie, state := login(tt.mode)
+			if tt.wrongState {
+				state = "otro"
+			}
+			req := httptest.NewRequest(http.MethodGet, OIDCPath+"/callback?"+url.Values{"code": {tt.code}, "state": {state}}.Encode(), nil)
+			req.AddCookie(cookie)
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+
+			if tt.expectedRole != "" {
+				var response OIDCTokenResponse
+				json.NewDecoder(rr.Body).Decode(&response)
+				claims, err := tokens.Verify(response.Token)
+				if err != nil || claims.Role != tt.expectedRole || response.Role != tt.expectedRole || response.ExpiresAt == nil {
+					t.Errorf("Expected a valid %s token, got %+v (%v)", tt.expectedRole, response, err)
+				}
+			}
+			if tt.mode == "ui" && tt.expectedStatus == http.StatusOK {
+				var session *http.Cookie
+				for _, c := range rr.Result().Cookies() {
+					if c.Name == adminSessionCookie {
+						session = c
+					}
+				}
+				if session == nil || !strings.Contains(rr.Body.String(), AdminUIPath+"/") {
+					t.Fatalf("Expected admin session and a link to the panel, got %s", rr.Body.String())
+				}
+				req := httptest.NewRequest(http.MethodGet, AdminUIPath+"/", nil)
+				req.AddCookie(session)
+				rr := httptest.NewRecorder()
+				r.ServeHTTP(rr, req)
+				if rr.Code != http.StatusOK {
+					t.Errorf("Expected the panel with the new session, got %d", rr.Code)
+				}
+			}
+		})
+	}
+
+	// El callback sin la cookie del flujo se rechaza y el panel ofrece el botón del proveedor
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, OIDCPath+"/callback?code=codigo&state=x", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d without flow cookie, got %d", http.StatusBadRequest, rr.Code)
+	}
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, AdminUIPath+"/login", nil))
+	if !strings.Contains(rr.Body.String(), "Iniciar sesión con Keycloak") {
+		t.Errorf("Expected OIDC login button, got %s", rr.Body.String())
+	}
+}
+
+// fixedGenerator propone siempre el mismo código
+type fixedGenerator string
+
+func (g fixedGenerator) Generate(_ string, _ int) string { return string(g) }
+
+func TestHandler_CodeSpaceSaturated(t *testing.T) {
+	store := shortener.NewStore()
+	store.SaveLink(context.Background(), shortener.Link{ShortCode: "ocupado", LongURL: "https://www.example.com/"})
+	service := shortener.NewService(store, shortener.WithCodeGenerator(fixedGenerator("ocupado")),
+		shortener.WithRetryPolicy(shortener.RetryPolicy{MaxRetries: 3}))
+	handler := NewHandler(service)
+
+	tests := []struct {
+		name            string
+		language        string
+		expectedMessage string
+	}{
+		{name: "Mensaje en español", expectedMessage: "aumenta la longitud de los códigos (CODE_LENGTH)"},
+		{name: "Mensaje en inglés", language: "en", expectedMessage: "increase the code length (CODE_LENGTH)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/shorten", strings.NewReader(`{"long_url": "https://www.example.com/nuevo"}`))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Accept-Language", tt.language)
+			rr := httptest.NewRecorder()
+			handler.ShortenURL(rr, req)
+			if rr.Code != http.StatusServiceUnavailable || !strings.Contains(rr.Body.String(), `"error":"code_space_saturated"`) {
+				t.Fatalf("Expected status %d with code_space_saturated, got %d: %s", http.StatusServiceUnavailable, rr.Code, rr.Body.String())
+			}
+			if !strings.Contains(rr.Body.String(), tt.expectedMessage) {
+				t.Errorf("Expected message to contain %q, got %s", tt.expectedMessage, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestHandler_AliasSuggestions(t *testing.T) {
+	store := shortener.NewStore()
+	store.SaveLink(context.Background(), shortener.Link{ShortCode: "promo", LongURL: "https://www.example.com/"})
+	store.SaveLink(context.Background(), shortener.Link{ShortCode: "promo-2", LongURL: "https://www.example.com/"})
+	handler := NewHandler(shortener.NewService(store, shortener.WithAliasSuggestions(2)))
+	year := strconv.Itoa(time.Now().Year())
+
+	tests := []struct {
+		name         string
+		path         string
+		body         string
+		expectedBody string
+	}{
+		{name: "Creación individual", path: "/shorten", body: `{"long_url": "https://www.example.com/nuevo", "alias": "promo"}`,
+			expectedBody: `"suggestions":["promo` + year + `","promo-3"]`},
+		{name: "Elemento de un lote", path: "/shorten/batch", body: `{"urls": [{"long_url": "https://www.example.com/nuevo", "alias": "promo"}]}`,
+			expectedBody: `"error":{"error":"alias_taken","message":"El alias solicitado ya está en uso","suggestions":["promo` + year + `","promo-3"]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			rr := httptest.NewRecorder()
+			if tt.path == "/shorten" {
+				handler.ShortenURL(rr, req)
+				if rr.Code != http.StatusConflict {
+					t.Fatalf("Expected status %d, got %d: %s", http.StatusConflict, rr.Code, rr.Body.String())
+				}
+			} else {
+				handler.ShortenBatch(rr, req)
+			}
+			if !strings.Contains(rr.Body.String(), tt.expectedBody) {
+				t.Errorf("Expected body to contain %q, got %s", tt.expectedBody, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestHandler_KeyUsage(t *testing.T) {
+	service := shortener.NewService(shortener.NewStore(), shortener.WithAPIKeys("clave-socio"),
+		shortener.WithUsageQuotas(shortener.UsageLimits{Shortens: 1, Redirects: 1}, nil))
+	handler := NewHandler(service)
+	r := chi.NewRouter()
+	r.Post("/shorten", handler.ShortenURL)
+	r.Get("/admin/keys/{id}/usage", handler.KeyUsage)
+	r.Get("/{short_code}", handler.RedirectURL)
+
+	shorten := func(alias string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/shorten", strings.NewReader(`{"long_url": "https://www.example.com/", "alias": "`+alias+`"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(APIKeyHeader, "clave-socio")
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+	get := func(path string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		return rr
+	}
+
+	if rr := shorten("socio"); rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+	if rr := shorten("otro"); rr.Code != http.StatusPaymentRequired || !strings.Contains(rr.Body.String(), "usage_quota_exceeded") {
+		t.Errorf("Expected status %d with usage_quota_exceeded, got %d: %s", http.StatusPaymentRequired, rr.Code, rr.Body.String())
+	}
+	if rr := get("/socio"); rr.Code != http.StatusTemporaryRedirect {
+		t.Fatalf("Expected status %d, got %d", http.StatusTemporaryRedirect, rr.Code)
+	}
+	if rr := get("/socio"); rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") == "" {
+		t.Errorf("Expected status %d with Retry-After, got %d %q", http.StatusTooManyRequests, rr.Code, rr.Header().Get("Retry-After"))
+	}
+
+	rr := get("/admin/keys/" + shortener.APIKeyID("clave-socio") + "/usage")
+	var usage KeyUsageResponse
+	if err := json.NewDecoder(rr.Body).Decode(&usage); err != nil || rr.Code != http.StatusOK {
+		t.Fatalf("Expected usage response, got %d (%v)", rr.Code, err)
+	}
+	if usage.Shortens != 1 || usage.Redirects != 1 || usage.ShortenQuota != 1 || usage.RedirectQuota != 1 || usage.ResetsAt.IsZero() {
+		t.Errorf("Unexpected usage: %+v", usage)
+	}
+	if rr := get("/admin/keys/clave-socio/usage"); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for a raw key, got %d", http.StatusBadRequest, rr.Code)
+	}
+}
+
+func TestHandler_RedirectURL(t *testing.T) {
+	store := shortener.NewStore()
+	service := shortener.NewService(store)
+	handler := NewHandler(service)
+
+	// Crear una URL de prueba
+	testURL := "https://www.example.com/test"
+	shortCode, err := service.ShortenURL(context.Background(), testURL)
+	if err != nil {
+		t.Fatalf("Error creating test URL: %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		shortCode      string
+		expectedStatus int
+		expectedURL    string
+	}{
+		{
+			name:           "Código válido",
+			shortCode:      shortCode,
+			expectedStatus: http.StatusTemporaryRedirect,
+			expectedURL:    testURL,
+		},
+		{
+			name:           "Código no existente",
+			shortCode:      "nonexistent",
+			expectedStatus: http.StatusNotFound,
+			expectedURL:    "",
+		},
+		{
+			name:           "Código vacío",
+			shortCode:      "",
+			expectedStatus: http.StatusBadRequest,
+			expectedURL:    "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Configurar router con chi para manejar parámetros de URL
+			r := chi.NewRouter()
+			r.Get("/{short_code}", handler.RedirectURL)
+
+			req := httptest.NewRequest(http.MethodGet, "/"+tt.shortCode, nil)
+			rr := httptest.NewRecorder()
+
+			r.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+
+			if tt.expectedStatus == http.StatusTemporaryRedirect {
+				location := rr.Header().Get("Location")
+				if location != tt.expectedURL {
+					t.Errorf("Expected Location header %s, got %s", tt.expectedURL, location)
+				}
+			}
+		})
+	}
+}
+
+func TestHandler_RedirectURL_CaseInsensitive(t *testing.T) {
+	service := shortener.NewService(shortener.NewStore(), shortener.WithCaseInsensitiveCodes(true))
+	handler := NewHandler(service)
+	if _, _, err := service.Shorten(context.Background(), shortener.ShortenInput{LongURL: "https://www.example.com/folleto", Alias: "Folleto"}); err != nil {
+		t.Fatalf("Error creating test URL: %v", err)
+	}
+
+	r := chi.NewRouter()
+	r.Get("/{short_code}", handler.RedirectURL)
+	for _, code := range []string{"folleto", "FOLLETO", "Folleto"} {
+		req := httptest.NewRequest(http.MethodGet, "/"+code, nil)
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		if rr.Code != http.StatusTemporaryRedirect || rr.Header().Get("Location") != "https://www.example.com/folleto" {
+			t.Errorf("Expected /%s to redirect to the link, got %d %q", code, rr.Code, rr.Header().Get("Location"))
+		}
+	}
+}
+
+func TestHandler_UnicodeAliases(t *testing.T) {
+	handler := NewHandler(shortener.NewService(shortener.NewStore(), shortener.WithUnicodeAliases(true)))
+
+	req := httptest.NewRequest(http.MethodPost, "/shorten", strings.NewReader(`{"long_url": "https://www.example.com/rebajas", "alias": "🔥sale"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	handler.ShortenURL(rr, req)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+	var response ShortenResponse
+	if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+		t.Fatalf("Error decoding response: %v", err)
+	}
+	if response.ShortURL != "http://example.com/%F0%9F%94%A5sale" {
+		t.Errorf("Expected percent-encoded short URL, got %s", response.ShortURL)
+	}
+
+	r := chi.NewRouter()
+	r.Get("/{short_code}", handler.RedirectURL)
+	tests := []struct {
+		name string
+		path string
+	}{
+		{name: "Codificación canónica", path: "/%F0%9F%94%A5sale"},
+		{name: "Codificación en minúsculas", path: "/%f0%9f%94%a5sale"},
+		{name: "UTF-8 sin codificar", path: "/🔥sale"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+			if rr.Code != http.StatusTemporaryRedirect || rr.Header().Get("Location") != "https://www.example.com/rebajas" {
+				t.Errorf("Expected redirect to the link, got %d %q", rr.Code, rr.Header().Get("Location"))
+			}
+		})
+	}
+}
+
+func TestHandler_Integration(t *testing.T) {
+	store := shortener.NewStore()
+	service := shortener.NewService(store)
+	handler := NewHandler(service)
+
+	// Configurar router completo
+	r := chi.NewRouter()
+	r.Post("/shorten", handler.ShortenURL)
+	r.Get("/{short_code}", handler.RedirectURL)
+
+	// Test flujo completo: acortar y luego redirigir
+	testURL := "https://www.example.com/integration/test?param=value"
+
+	// 1. Acortar URL
+	requestBody := `{"long_url": "` + testURL + `"}`
+	req := httptest.NewRequest(http.MethodPost, "/shorten", strings.NewReader(requestBody))
+	req.Header.Set("Content-Type", "application/json")
+
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d for shorten, got %d", http.StatusCreated, rr.Code)
+	}
+
+	var response ShortenResponse
+	if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+		t.Fatalf("Error decoding shorten response: %v", err)
+	}
+
+	// Extraer el código corto de la URL
+	parts := strings.Split(response.ShortURL, "/")
+	shortCode := parts[len(parts)-1]
+
+	// 2. Redirigir usando el código corto
+	req = httptest.NewRequest(http.MethodGet, "/"+shortCode, nil)
+	rr = httptest.NewRecorder()
+
+	r.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusTemporaryRedirect {
+		t.Errorf("Expected status %d for redirect, got %d", http.StatusTemporaryRedirect, rr.Code)
+	}
+
+	location := rr.Header().Get("Location")
+	if location != testURL {
+		t.Errorf("Expected redirect to %s, got %s", testURL, location)
+	}
+}
+
+func TestHandler_ConcurrentRequests(t *testing.T) {
+	store := shortener.NewStore()
+	service := shortener.NewService(store)
+	handler := NewHandler(service)
+
+	r := chi.NewRouter()
+	r.Post("/shorten", handler.ShortenURL)
+	r.Get("/{short_code}", handler.RedirectURL)
+
+	// Crear servidor de prueba
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	// Realizar múltiples peticiones concurrentes
+	numRequests := 50
+	results := make(chan string, numRequests)
+	errors := make(chan error, numRequests)
+
+	for i := 0; i < numRequests; i++ {
+		go func(id int) {
+			testURL := fmt.Sprintf("https://concurrent%d.com", id)
+			requestBody := fmt.Sprintf(`{"long_url": "%s"}`, testURL)
+
+			resp, err := http.Post(server.URL+"/shorten", "application/json", strings.NewReader(requestBody))
+			if err != nil {
+				errors <- err
+				return
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != http.StatusCreated {
+				errors <- fmt.Errorf("unexpected status: %d", resp.StatusCode)
+				return
+			}
+
+			var response ShortenResponse
+			if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+				errors <- err
+				return
+			}
+
+			results <- response.ShortURL
+		}(i)
+	}
+
+	// Recopilar resultados
+	shortURLs := make(map[string]bool)
+	for i := 0; i < numRequests; i++ {
+		select {
+		case url := <-results:
+			if shortURLs[url] {
+				t.Errorf("Duplicate short URL generated: %s", url)
+			}
+			shortURLs[url] = true
+		case err := <-errors:
+			t.Errorf("Error in concurrent request: %v", err)
+		}
+	}
+
+	if len(shortURLs) != numRequests {
+		t.Errorf("Expected %d unique URLs, got %d", numRequests, len(shortURLs))
+	}
+}
+
+func TestHandler_UserOwnedURLs(t *testing.T) {
+	store := shortener.NewStore()
+	service := shortener.NewService(store)
+	handler := NewHandler(service)
+	tokens := auth.NewTokenManager([]byte("secreto-de-prueba"), time.Hour)
+
+	r := chi.NewRouter()
+	r.Use(Authenticate(tokens))
+	r.Post("/shorten", handler.ShortenURL)
+	r.Route("/api", func(r chi.Router) {
+		r.Use(RequireAuth)
+		r.Get("/me/urls", handler.ListMyURLs)
+		r.Get("/urls", handler.ListURLs)
+		r.Get("/urls/search", handler.SearchURLs)
+		r.Patch("/urls/{short_code}", handler.UpdateURL)
+		r.Delete("/urls/{short_code}", handler.DeleteURL)
+	})
+
+	aliceToken, _ := tokens.Issue("alice", auth.RoleUser)
+	bobToken, _ := tokens.Issue("bob", auth.RoleUser)
+	adminToken, _ := tokens.Issue("root", auth.RoleAdmin)
+
+	do := func(method, path, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// Alice crea un enlace y un usuario anónimo crea otro
+	rr := do(http.MethodPost, "/shorten", aliceToken, `{"long_url": "https://www.example.com/alice"}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d", http.StatusCreated, rr.Code)
+	}
+	var created ShortenResponse
+	json.NewDecoder(rr.Body).Decode(&created)
+	parts := strings.Split(created.ShortURL, "/")
+	code := parts[len(parts)-1]
+
+	do(http.MethodPost, "/shorten", "", `{"long_url": "https://www.example.com/anon"}`)
+
+	// El listado solo incluye los enlaces de Alice
+	rr = do(http.MethodGet, "/api/me/urls", aliceToken, "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+	var list LinkListResponse
+	if err := json.NewDecoder(rr.Body).Decode(&list); err != nil {
+		t.Fatalf("Error decoding list response: %v", err)
+	}
+	if list.Total != 1 || list.URLs[0].ShortCode != code || list.URLs[0].Owner != "alice" {
+		t.Errorf("Expected only alice's link, got %+v", list)
+	}
+
+	// El listado paginado filtra por dominio y respeta la página pedida
+	do(http.MethodPost, "/shorten", aliceToken, `{"long_url": "https://docs.example.org/alice"}`)
+	rr = do(http.MethodGet, "/api/urls?per_page=1&page=2&sort=-created_at&filter=domain:example.com,status:active", aliceToken, "")
+	list = LinkListResponse{}
+	json.NewDecoder(rr.Body).Decode(&list)
+	if rr.Code != http.StatusOK || list.Total != 1 || len(list.URLs) != 0 || list.Page != 2 || list.PerPage != 1 {
+		t.Errorf("Expected empty second page of one link, got %d %+v", rr.Code, list)
+	}
+	rr = do(http.MethodGet, "/api/urls?sort=-created_at", aliceToken, "")
+	list = LinkListResponse{}
+	json.NewDecoder(rr.Body).Decode(&list)
+	if list.Total != 2 || list.URLs[0].LongURL != "https://docs.example.org/alice" {
+		t.Errorf("Expected alice's two links newest first, got %+v", list)
+	}
+	rr = do(http.MethodGet, "/api/urls/search?q=docs+alice", aliceToken, "")
+	list = LinkListResponse{}
+	json.NewDecoder(rr.Body).Decode(&list)
+	if rr.Code != http.StatusOK || list.Total != 1 || list.URLs[0].LongURL != "https://docs.example.org/alice" {
+		t.Errorf("Expected search to find alice's docs link, got %d %+v", rr.Code, list)
+	}
+	if rr = do(http.MethodGet, "/api/urls/search?q=docs", bobToken, ""); !strings.Contains(rr.Body.String(), `"total":0`) {
+		t.Errorf("Expected bob's search to exclude alice's links, got %s", rr.Body.String())
+	}
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		token          string
+		body           string
+		expectedStatus int
+	}{
+		{"Sin token", http.MethodGet, "/api/me/urls", "", "", http.StatusUnauthorized},
+		{"Token inválido", http.MethodGet, "/api/me/urls", "no-es-un-jwt", "", http.StatusUnauthorized},
+		{"Búsqueda sin texto", http.MethodGet, "/api/urls/search?q=", aliceToken, "", http.StatusBadRequest},
+		{"Listado con filtro desconocido", http.MethodGet, "/api/urls?filter=color:rojo", aliceToken, "", http.StatusBadRequest},
+		{"Listado con página inválida", http.MethodGet, "/api/urls?page=0&per_page=500", aliceToken, "", http.StatusBadRequest},
+		{"Listado de otro propietario", http.MethodGet, "/api/urls?filter=owner:alice", bobToken, "", http.StatusForbidden},
+		{"Admin lista otro propietario", http.MethodGet, "/api/urls?filter=owner:alice", adminToken, "", http.StatusOK},
+		{"Editar enlace ajeno", http.MethodPatch, "/api/urls/" + code, bobToken, `{"long_url": "https://evil.example.com"}`, http.StatusForbidden},
+		{"Eliminar enlace ajeno", http.MethodDelete, "/api/urls/" + code, bobToken, "", http.StatusForbidden},
+		{"Editar enlace propio", http.MethodPatch, "/api/urls/" + code, aliceToken, `{"long_url": "https://www.example.com/nuevo"}`, http.StatusOK},
+		{"Editar con URL inválida", http.MethodPatch, "/api/urls/" + code, aliceToken, `{"long_url": "not-a-url"}`, http.StatusBadRequest},
+		{"Admin elimina enlace ajeno", http.MethodDelete, "/api/urls/" + code, adminToken, "", http.StatusNoContent},
+		{"Eliminar enlace inexistente", http.MethodDelete, "/api/urls/" + code, aliceToken, "", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := do(tt.method, tt.path, tt.token, tt.body)
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+		})
+	}
+}
+
+func TestRateLimit_Middleware(t *testing.T) {
+	store := shortener.NewStore()
+	service := shortener.NewService(store, shortener.WithAPIKeys("clave-1"))
+	handler := NewHandler(service)
+
+	r := chi.NewRouter()
+	r.With(RateLimit(ratelimit.NewTokenBucket(0.5, 2), service.KnownAPIKey)).Post("/shorten", handler.ShortenURL)
+
+	shorten := func(remoteAddr, apiKey string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/shorten", strings.NewReader(`{"long_url": "https://www.example.com"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.RemoteAddr = remoteAddr
+		if apiKey != "" {
+			req.Header.Set(APIKeyHeader, apiKey)
+		}
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// La ráfaga permite dos peticiones por IP
+	for i := 0; i < 2; i++ {
+		if rr := shorten("10.0.0.1:1234", ""); rr.Code != http.StatusCreated {
+			t.Fatalf("Expected status %d, got %d", http.StatusCreated, rr.Code)
+		}
+	}
+
+	rr := shorten("10.0.0.1:5678", "")
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected status %d, got %d", http.StatusTooManyRequests, rr.Code)
+	}
+	if rr.Header().Get("Retry-After") != "2" {
+		t.Errorf("Expected Retry-After 2, got %q", rr.Header().Get("Retry-After"))
+	}
+	var errorResponse ErrorResponse
+	if err := json.NewDecoder(rr.Body).Decode(&errorResponse); err != nil || errorResponse.Error != "rate_limited" {
+		t.Errorf("Expected rate_limited error response, got %+v (%v)", errorResponse, err)
+	}
+
+	// Una clave inventada no da un bucket nuevo: cuenta para su IP
+	if rr := shorten("10.0.0.1:1234", "inventada-1"); rr.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected an unknown API key to share the IP bucket, got %d", rr.Code)
+	}
+
+	// Una clave de API configurada tiene su propio bucket aunque comparta IP
+	if rr := shorten("10.0.0.1:1234", "clave-1"); rr.Code != http.StatusCreated {
+		t.Errorf("Expected API key bucket to be independent, got %d", rr.Code)
+	}
+}
+
+func TestRejectEarlyData(t *testing.T) {
+	handler := RejectEarlyData(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	tests := []struct {
+		name           string
+		method         string
+		tls            *tls.ConnectionState
+		expectedStatus int
+	}{
+		{name: "Redirección en 0-RTT", method: http.MethodGet, tls: &tls.ConnectionState{}, expectedStatus: http.StatusNoContent},
+		{name: "Creación en 0-RTT", method: http.MethodPost, tls: &tls.ConnectionState{}, expectedStatus: http.StatusTooEarly},
+		{name: "Creación tras el handshake", method: http.MethodPost, tls: &tls.ConnectionState{HandshakeComplete: true}, expectedStatus: http.StatusNoContent},
+		{name: "Creación sin TLS", method: http.MethodPost, expectedStatus: http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/shorten", nil)
+			req.TLS = tt.tls
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestRateLimitPasswords(t *testing.T) {
+	service := shortener.NewService(shortener.NewStore())
+	link, _, err := service.Shorten(context.Background(), shortener.ShortenInput{LongURL: "https://www.example.com/privado", Password: "abre-sesamo"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	r := chi.NewRouter()
+	r.With(RateLimitPasswords(ratelimit.NewTokenBucket(0.5, 1), nil)).Get("/{short_code}", NewHandler(service).RedirectURL)
+
+	tests := []struct {
+		name           string
+		path           string
+		password       string
+		expectedStatus int
+	}{
+		{name: "Sin contraseña no consume el bucket", path: "/" + link.ShortCode, expectedStatus: http.StatusUnauthorized},
+		{name: "Primera contraseña", path: "/" + link.ShortCode, password: "otra", expectedStatus: http.StatusForbidden},
+		{name: "Segunda contraseña por cabecera", path: "/" + link.ShortCode, password: "abre-sesamo", expectedStatus: http.StatusTooManyRequests},
+		{name: "Segunda contraseña por query", path: "/" + link.ShortCode + "?key=abre-sesamo", expectedStatus: http.StatusTooManyRequests},
+		{name: "Sin contraseña tras agotar el bucket", path: "/" + link.ShortCode, expectedStatus: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.RemoteAddr = "10.0.0.1:1234"
+			if tt.password != "" {
+				req.Header.Set(LinkPasswordHeader, tt.password)
+			}
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+		})
+	}
+}
+
+func TestHandler_ShortenBatch(t *testing.T) {
+	store := shortener.NewStore()
+	service := shortener.NewService(store)
+	handler := NewHandler(service, WithMaxBatchSize(3))
+
+	tests := []struct {
+		name              string
+		requestBody       string
+		expectedStatus    int
+		expectedSucceeded int
+		expectedFailed    int
+	}{
+		{
+			name: "Lote mixto",
+			requestBody: `{"urls": [
+				{"long_url": "https://www.example.com/1"},
+				{"long_url": "not-a-url"},
+				{"long_url": "https://www.example.com/3", "alias": "lote-alias", "ttl_seconds": 3600}
+			]}`,
+			expectedStatus:    http.StatusOK,
+			expectedSucceeded: 2,
+			expectedFailed:    1,
+		},
+		{
+			name:           "Lote vacío",
+			requestBody:    `{"urls": []}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Lote demasiado grande",
+			requestBody:    `{"urls": [{"long_url": "https://a.com"}, {"long_url": "https://b.com"}, {"long_url": "https://c.com"}, {"long_url": "https://d.com"}]}`,
+			expectedStatus: http.StatusRequestEntityTooLarge,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/shorten/batch", strings.NewReader(tt.requestBody))
+			req.Header.Set("Content-Type", "application/json")
+			rr := httptest.NewRecorder()
+			handler.ShortenBatch(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var response BatchShortenResponse
+			if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+				t.Fatalf("Error decoding batch response: %v", err)
+			}
+			if response.Succeeded != tt.expectedSucceeded || response.Failed != tt.expectedFailed {
+				t.Errorf("Expected %d/%d succeeded/failed, got %d/%d",
+					tt.expectedSucceeded, tt.expectedFailed, response.Succeeded, response.Failed)
+			}
+			if response.Results[1].Error == nil || response.Results[1].Error.Error != "invalid_url" {
+				t.Errorf("Expected invalid_url error for item 1, got %+v", response.Results[1].Error)
+			}
+			if response.Results[2].ShortCode != "lote-alias" || response.Results[2].ExpiresAt == nil {
+				t.Errorf("Expected alias with expiry for item 2, got %+v", response.Results[2])
+			}
+		})
+	}
+}
+
+func TestHandler_ShortenBatchRateLimit(t *testing.T) {
+	service := shortener.NewService(shortener.NewStore())
+	limiter := ratelimit.NewTokenBucket(0.001, 3)
+	r := chi.NewRouter()
+	r.With(RateLimit(limiter, service.KnownAPIKey)).Post("/shorten/batch", NewHandler(service, WithBatchRateLimit(limiter)).ShortenBatch)
+
+	send := func(urls ...string) (int, BatchShortenResponse) {
+		items := make([]string, len(urls))
+		for i, u := range urls {
+			items[i] = fmt.Sprintf(`{"long_url": %q}`, u)
+		}
+		req := httptest.NewRequest(http.MethodPost, "/shorten/batch", strings.NewReader(`{"urls": [`+strings.Join(items, ",")+`]}`))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		var response BatchShortenResponse
+		json.NewDecoder(rr.Body).Decode(&response)
+		return rr.Code, response
+	}
+
+	// Cada URL cuesta un token: con una ráfaga de 3, la cuarta del lote no cabe
+	status, response := send("https://www.example.com/1", "https://www.example.com/2", "https://www.example.com/3", "https://www.example.com/4")
+	if status != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, status)
+	}
+	if response.Succeeded != 3 || response.Failed != 1 {
+		t.Fatalf("Expected 3/1 succeeded/failed, got %d/%d", response.Succeeded, response.Failed)
+	}
+	if err := response.Results[3].Error; err == nil || err.Error != errcode.RateLimited {
+		t.Errorf("Expected rate_limited for the item over the burst, got %+v", err)
+	}
+
+	// Agotado el bucket, el siguiente lote se rechaza entero
+	if status, _ := send("https://www.example.com/5"); status != http.StatusTooManyRequests {
+		t.Errorf("Expected status %d once the bucket is empty, got %d", http.StatusTooManyRequests, status)
+	}
+}
+
+func TestHandler_ResolveBatch(t *testing.T) {
+	store := shortener.NewStore()
+	service := shortener.NewService(store)
+	handler := NewHandler(service)
+
+	link, _, err := service.Shorten(context.Background(), shortener.ShortenInput{LongURL: "https://www.example.com/resolve", TTL: time.Hour})
+	if err != nil {
+		t.Fatalf("Error creating test URL: %v", err)
+	}
+
+	body := fmt.Sprintf(`{"codes": [%q, "nonexistent"]}`, link.ShortCode)
+	req := httptest.NewRequest(http.MethodPost, "/api/resolve", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	handler.ResolveBatch(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+
+	var response ResolveResponse
+	if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+		t.Fatalf("Error decoding resolve response: %v", err)
+	}
+	if len(response.Results) != 2 {
+		t.Fatalf("Expected 2 results, got %d", len(response.Results))
+	}
+
+	found := response.Results[0]
+	if !found.Found || found.LongURL != "https://www.example.com/resolve" || found.ExpiresAt == nil || found.Expired {
+		t.Errorf("Unexpected result for existing code: %+v", found)
+	}
+
+	missing := response.Results[1]
+	if missing.Found || missing.Error == nil || missing.Error.Error != "not_found" {
+		t.Errorf("Unexpected result for missing code: %+v", missing)
+	}
+}
+
+func TestHandler_Inspect(t *testing.T) {
+	ctx := context.Background()
+	service := shortener.NewService(shortener.NewStore(),
+		shortener.WithTenants(map[string]string{"clave-a": "equipo-a"}, map[string]string{"go.equipo-b.com": "equipo-b"}))
+	handler := NewHandler(service)
+
+	for _, input := range []shortener.ShortenInput{
+		{LongURL: "https://www.example.com/promo", Alias: "promo", TTL: time.Hour},
+		{LongURL: "https://www.example.com/secreto", Alias: "secreto", Password: "clave-segura-1"},
+		{LongURL: "https://www.equipo-a.com/", Alias: "promo", Tenant: "equipo-a"},
+		{LongURL: "https://www.equipo-b.com/", Alias: "promo", Tenant: "equipo-b"},
+	} {
+		if _, _, err := service.Shorten(ctx, input); err != nil {
+			t.Fatalf("Error creating test URL: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name                string
+		contentType         string
+		body                string
+		expectedStatus      int
+		expectedDestination string
+		expectedProtected   bool
+	}{
+		{name: "Enlace seguro", body: `{"url": "https://example.com/promo"}`, expectedStatus: http.StatusOK,
+			expectedDestination: "https://www.example.com/promo"},
+		{name: "Sufijo de vista previa", body: `{"url": "http://example.com/promo+"}`, expectedStatus: http.StatusOK,
+			expectedDestination: "https://www.example.com/promo"},
+		{name: "Con contraseña oculta el destino", body: `{"url": "https://example.com/secreto"}`, expectedStatus: http.StatusOK,
+			expectedProtected: true},
+		{name: "Ruta del tenant", body: `{"url": "https://example.com/t/equipo-a/promo"}`, expectedStatus: http.StatusOK,
+			expectedDestination: "https://www.equipo-a.com/"},
+		{name: "Host del tenant", body: `{"url": "https://go.equipo-b.com/promo"}`, expectedStatus: http.StatusOK,
+			expectedDestination: "https://www.equipo-b.com/"},
+		{name: "Código inexistente", body: `{"url": "https://example.com/nonexistent"}`, expectedStatus: http.StatusNotFound},
+		{name: "URL relativa", body: `{"url": "/promo"}`, expectedStatus: http.StatusBadRequest},
+		{name: "Sin código", body: `{"url": "https://example.com/"}`, expectedStatus: http.StatusBadRequest},
+		{name: "Content-Type inválido", contentType: "text/plain", body: `{"url": "https://example.com/promo"}`,
+			expectedStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			contentType := tt.contentType
+			if contentType == "" {
+				contentType = "application/json"
+			}
+			req := httptest.NewRequest(http.MethodPost, "/api/inspect", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", contentType)
+			rr := httptest.NewRecorder()
+			handler.InspectURL(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if rr.Code != http.StatusOK {
+				return
+			}
+			var response InspectResponse
+			if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+				t.Fatalf("Error decoding inspect response: %v", err)
+			}
+			if response.Destination != tt.expectedDestination || response.PasswordProtected != tt.expectedProtected {
+				t.Errorf("Expected destination %q (protected %v), got %q (%v)", tt.expectedDestination, tt.expectedProtected,
+					response.Destination, response.PasswordProtected)
+			}
+			if response.Verdict != shortener.VerdictSafe || response.ThreatCheck != shortener.ThreatCheckDisabled || response.Expired {
+				t.Errorf("Expected safe unexpired link without threat check, got %+v", response)
+			}
+			if rr.Header().Get("Cache-Control") != "no-store" {
+				t.Errorf("Expected Cache-Control no-store, got %s", rr.Header().Get("Cache-Control"))
+			}
+		})
+	}
+
+	// La inspección no cuenta como visita
+	link, err := service.GetLink(ctx, "promo")
+	if err != nil || link.Clicks != 0 {
+		t.Errorf("Expected no clicks after inspection, got %d (%v)", link.Clicks, err)
+	}
+}
+
+func TestHandler_PreviewURL(t *testing.T) {
+	store := shortener.NewStore()
+	service := shortener.NewService(store)
+	handler := NewHandler(service)
+
+	r := chi.NewRouter()
+	r.Get("/api/urls/{short_code}", handler.PreviewURL)
+	r.Get("/{short_code}+", handler.PreviewURL)
+	r.Get("/{short_code}", handler.RedirectURL)
+
+	testURL := "https://www.example.com/preview"
+	shortCode, err := service.ShortenURL(context.Background(), testURL)
+	if err != nil {
+		t.Fatalf("Error creating test URL: %v", err)
+	}
+
+	// Una redirección real cuenta como visita; la del rastreador, además, como visita de bot
+	for _, userAgent := range []string{"Mozilla/5.0 (X11; Linux x86_64) Firefox/126.0", "Twitterbot/1.0"} {
+		visit := httptest.NewRequest(http.MethodGet, "/"+shortCode, nil)
+		visit.Header.Set("User-Agent", userAgent)
+		r.ServeHTTP(httptest.NewRecorder(), visit)
+	}
+
+	for _, path := range []string{"/" + shortCode + "+", "/api/urls/" + shortCode} {
+		t.Run(path, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+
+			if rr.Code != http.StatusOK {
+				t.Fatalf("Expected status %d, got %d", http.StatusOK, rr.Code)
+			}
+
+			var preview PreviewResponse
+			if err := json.NewDecoder(rr.Body).Decode(&preview); err != nil {
+				t.Fatalf("Error decoding preview: %v", err)
+			}
+			if preview.LongURL != testURL || preview.Clicks != 2 || preview.BotClicks != 1 || preview.UniqueVisitors != 1 {
+				t.Errorf("Expected %s with 2 clicks (1 from bots) from 1 visitor, got %s with %d (%d) from %d", testURL,
+					preview.LongURL, preview.Clicks, preview.BotClicks, preview.UniqueVisitors)
+			}
+		})
+	}
+
+	// Los navegadores reciben HTML y la vista previa no suma visitas
+	req := httptest.NewRequest(http.MethodGet, "/"+shortCode+"+", nil)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+
+	if !strings.HasPrefix(rr.Header().Get("Content-Type"), "text/html") {
+		t.Errorf("Expected HTML preview, got %s", rr.Header().Get("Content-Type"))
+	}
+	if !strings.Contains(rr.Body.String(), testURL) || !strings.Contains(rr.Body.String(), "Visitas: 2") {
+		t.Errorf("Expected destination and click count in HTML preview")
+	}
+
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/nonexistent+", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d for unknown code, got %d", http.StatusNotFound, rr.Code)
+	}
+}
+
+func TestHandler_TrackingOptOut(t *testing.T) {
+	const browser = "Mozilla/5.0 (X11; Linux x86_64) Firefox/126.0"
+	tests := []struct {
+		name             string
+		privacyMode      bool
+		header           string
+		expectedVisitors int64
+	}{
+		{name: "Visita rastreable", expectedVisitors: 1},
+		{name: "Do Not Track", header: "DNT"},
+		{name: "Global Privacy Control", header: "Sec-GPC"},
+		{name: "Modo privado", privacyMode: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var clicks []shortener.Event
+			service := shortener.NewService(shortener.NewStore(), shortener.WithEventListener(shortener.EventListenerFunc(func(event shortener.Event) {
+				if event.Type == shortener.EventClicked {
+					clicks = append(clicks, event)
+				}
+			})))
+			handler := NewHandler(service, WithPrivacyMode(tt.privacyMode), WithCountryHeader("CF-IPCountry"))
+			r := chi.NewRouter()
+			r.Get("/{short_code}", handler.RedirectURL)
+
+			shortCode, _ := service.ShortenURL(context.Background(), "https://www.example.com/privada")
+			req := httptest.NewRequest(http.MethodGet, "/"+shortCode, nil)
+			req.Header.Set("User-Agent", browser)
+			req.Header.Set("Referer", "https://www.News.example/portada")
+			req.Header.Set("CF-IPCountry", "es")
+			if tt.header != "" {
+				req.Header.Set(tt.header, "1")
+			}
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+			if rr.Code != http.StatusTemporaryRedirect {
+				t.Fatalf("Expected status %d, got %d", http.StatusTemporaryRedirect, rr.Code)
+			}
+
+			// La visita se cuenta siempre, pero solo las rastreables identifican al visitante
+			link, _ := service.GetLink(context.Background(), shortCode)
+			if link.Clicks != 1 || link.UniqueVisitors() != tt.expectedVisitors {
+				t.Errorf("Expected 1 click from %d visitors, got %d from %d", tt.expectedVisitors, link.Clicks, link.UniqueVisitors())
+			}
+			if len(clicks) != 1 {
+				t.Fatalf("Expected 1 click event, got %d", len(clicks))
+			}
+			trackable := tt.expectedVisitors > 0
+			if (clicks[0].Visitor != "") != trackable {
+				t.Errorf("Expected a click event with visitor only when trackable, got %q", clicks[0].Visitor)
+			}
+			if trackable && (clicks[0].Referrer != "news.example" || clicks[0].Country != "ES") {
+				t.Errorf("Expected referrer news.example from ES, got %q from %q", clicks[0].Referrer, clicks[0].Country)
+			}
+			if !trackable && (clicks[0].Referrer != "" || clicks[0].Country != "") {
+				t.Errorf("Expected no referrer or country on private visits, got %q from %q", clicks[0].Referrer, clicks[0].Country)
+			}
+		})
+	}
+}
+
+func TestHandler_RedirectCaching(t *testing.T) {
+	ctx := context.Background()
+	store := shortener.NewStore()
+	service := shortener.NewService(store)
+	handler := NewHandler(service, WithRedirectCache(time.Minute, 24*time.Hour))
+
+	r := chi.NewRouter()
+	r.Post("/shorten", handler.ShortenURL)
+	r.Get("/{short_code}", handler.RedirectURL)
+
+	store.SaveLink(ctx, shortener.Link{ShortCode: "temporal", LongURL: "https://www.example.com/temporal"})
+	store.SaveLink(ctx, shortener.Link{ShortCode: "caduca", LongURL: "https://www.example.com/caduca",
+		RedirectType: shortener.RedirectPermanent, ExpiresAt: time.Now().Add(90*time.Second + 500*time.Millisecond)})
+	store.SaveLink(ctx, shortener.Link{ShortCode: "ab", LongURL: "https://www.example.com/ab", RedirectType: shortener.RedirectPermanent,
+		Variants: []shortener.Variant{{Name: "a", URL: "https://www.example.com/a", Weight: 1}}})
+
+	shorten := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/shorten", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// El tipo se elige al crear el enlace
+	rr := shorten(`{"long_url": "https://www.example.com/permanente", "alias": "permanente", "redirect_type": "permanent"}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+	rr = shorten(`{"long_url": "https://www.example.com/", "redirect_type": "301"}`)
+	if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), `"field":"redirect_type"`) {
+		t.Errorf("Expected a validation error on redirect_type, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	tests := []struct {
+		name                 string
+		code                 string
+		expectedStatus       int
+		expectedCacheControl string
+	}{
+		{name: "Temporal", code: "temporal", expectedStatus: http.StatusTemporaryRedirect, expectedCacheControl: "private, max-age=60"},
+		{name: "Permanente", code: "permanente", expectedStatus: http.StatusMovedPermanently, expectedCacheControl: "public, max-age=86400"},
+		{name: "Permanente hasta la expiración", code: "caduca", expectedStatus: http.StatusMovedPermanently, expectedCacheControl: "public, max-age=90"},
+		{name: "Prueba A/B", code: "ab", expectedStatus: http.StatusMovedPermanently, expectedCacheControl: "no-store"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/"+tt.code, nil))
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if got := rr.Header().Get("Cache-Control"); got != tt.expectedCacheControl {
+				t.Errorf("Expected Cache-Control %q, got %q", tt.expectedCacheControl, got)
+			}
+		})
+	}
+
+	// Sin caché configurada las redirecciones temporales se revalidan en cada visita
+	defaults := chi.NewRouter()
+	defaults.Get("/{short_code}", NewHandler(service).RedirectURL)
+	rr = httptest.NewRecorder()
+	defaults.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/temporal", nil))
+	if rr.Code != http.StatusTemporaryRedirect || rr.Header().Get("Cache-Control") != "no-cache" {
+		t.Errorf("Expected 307 with no-cache by default, got %d %q", rr.Code, rr.Header().Get("Cache-Control"))
+	}
+}
+
+func TestHandler_ConditionalRequests(t *testing.T) {
+	store := shortener.NewStore()
+	service := shortener.NewService(store)
+	handler := NewHandler(service)
+
+	r := chi.NewRouter()
+	r.Get("/api/urls/{short_code}", handler.PreviewURL)
+	r.Get("/{short_code}+", handler.PreviewURL)
+	r.Get("/{short_code}", handler.RedirectURL)
+
+	store.SaveLink(context.Background(), shortener.Link{ShortCode: "promo", LongURL: "https://www.example.com/promo"})
+
+	get := func(path, accept, ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+
+	first := get("/api/urls/promo", "", "")
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || !strings.HasPrefix(etag, `W/"`) || first.Header().Get("Cache-Control") != "no-cache" {
+		t.Fatalf("Expected 200 with a weak ETag and no-cache, got %d %q %q", first.Code, etag, first.Header().Get("Cache-Control"))
+	}
+	html := get("/promo+", "text/html", "").Header().Get("ETag")
+	if html == "" || html == etag {
+		t.Errorf("Expected a different ETag for the HTML preview, got %q", html)
+	}
+
+	tests := []struct {
+		name           string
+		ifNoneMatch    string
+		expectedStatus int
+	}{
+		{name: "ETag vigente", ifNoneMatch: etag, expectedStatus: http.StatusNotModified},
+		{name: "ETag fuerte equivalente", ifNoneMatch: strings.TrimPrefix(etag, "W/"), expectedStatus: http.StatusNotModified},
+		{name: "Lista de ETags", ifNoneMatch: `"otro", ` + etag, expectedStatus: http.StatusNotModified},
+		{name: "Comodín", ifNoneMatch: "*", expectedStatus: http.StatusNotModified},
+		{name: "ETag distinto", ifNoneMatch: `W/"otro"`, expectedStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := get("/api/urls/promo", "", tt.ifNoneMatch)
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+			if rr.Code == http.StatusNotModified && (rr.Body.Len() != 0 || rr.Header().Get("ETag") != etag) {
+				t.Errorf("Expected an empty 304 with the ETag, got %q %q", rr.Header().Get("ETag"), rr.Body.String())
+			}
+		})
+	}
+
+	// Una visita cambia las estadísticas y con ellas el ETag
+	get("/promo", "", "")
+	if rr := get("/api/urls/promo", "", etag); rr.Code != http.StatusOK || rr.Header().Get("ETag") == etag {
+		t.Errorf("Expected a new representation after a visit, got %d %q", rr.Code, rr.Header().Get("ETag"))
+	}
+}
+
+func BenchmarkHandler_ShortenURL(b *testing.B) {
+	store := shortener.NewStore()
+	service := shortener.NewService(store)
+	handler := NewHandler(service)
+
+	requestBody := `{"long_url": "https://www.example.com/benchmark/test"}`
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/shorten", strings.NewReader(requestBody))
+		req.Header.Set("Content-Type", "application/json")
+
+		rr := httptest.NewRecorder()
+		handler.ShortenURL(rr, req)
+	}
+}
+
+func BenchmarkHandler_RedirectURL(b *testing.B) {
+	store := shortener.NewStore()
+	service := shortener.NewService(store)
+	handler := NewHandler(service)
+
+	// Preparar datos de prueba
+	testURL := "https://www.example.com/benchmark"
+	shortCode, _ := service.ShortenURL(context.Background(), testURL)
+
+	r := chi.NewRouter()
+	r.Get("/{short_code}", handler.RedirectURL)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/"+shortCode, nil)
+		rr := httptest.NewRecorder()
+
+		r.ServeHTTP(rr, req)
+	}
+}
+
+func TestHandler_CanceledContext(t *testing.T) {
+	store := shortener.NewStore()
+	service := shortener.NewService(store)
+	handler := NewHandler(service)
+
+	r := chi.NewRouter()
+	r.Post("/shorten", handler.ShortenURL)
+	r.Get("/{short_code}", handler.RedirectURL)
+
+	shortCode, err := service.ShortenURL(context.Background(), "https://www.example.com")
+	if err != nil {
+		t.Fatalf("Error creating test URL: %v", err)
+	}
+
+	tests := []struct {
+		name         string
+		cancel       func() (context.Context, context.CancelFunc)
+		method       string
+		path         string
+		body         string
+		expectedCode errcode.Code
+	}{
+		{
+			name:         "Acortar con petición cancelada",
+			cancel:       func() (context.Context, context.CancelFunc) { return context.WithCancel(context.Background()) },
+			method:       http.MethodPost,
+			path:         "/shorten",
+			body:         `{"long_url": "https://www.example.com/cancelada"}`,
+			expectedCode: "request_canceled",
+		},
+		{
+			name: "Redirigir con deadline vencido",
+			cancel: func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), -time.Second)
+			},
+			method:       http.MethodGet,
+			path:         "/" + shortCode,
+			expectedCode: "timeout",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := tt.cancel()
+			cancel()
+
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)).WithContext(ctx)
+			req.Header.Set("Content-Type", "application/json")
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusServiceUnavailable {
+				t.Fatalf("Expected status %d, got %d", http.StatusServiceUnavailable, rr.Code)
+			}
+
+			var errResp ErrorResponse
+			if err := json.NewDecoder(rr.Body).Decode(&errResp); err != nil {
+				t.Fatalf("Error decoding response: %v", err)
+			}
+			if errResp.Error != tt.expectedCode {
+				t.Errorf("Expected error code %s, got %s", tt.expectedCode, errResp.Error)
+			}
+		})
+	}
+}
+
+func TestRequestLimits_Middleware(t *testing.T) {
+	store := shortener.NewStore()
+	service := shortener.NewService(store)
+	handler := NewHandler(service)
+
+	r := chi.NewRouter()
+	r.Use(Timeout(20 * time.Millisecond))
+	r.With(MaxBodySize(64)).Post("/shorten", handler.ShortenURL)
+	r.Get("/lento", func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		w.WriteHeader(http.StatusOK)
+	})
+
+	longBody := fmt.Sprintf(`{"long_url": "https://www.example.com/%s"}`, strings.Repeat("a", 100))
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		body           string
+		chunked        bool
+		expectedStatus int
+		expectedCode   errcode.Code
+	}{
+		{
+			name:           "Cuerpo dentro del límite",
+			method:         http.MethodPost,
+			path:           "/shorten",
+			body:           `{"long_url": "https://www.example.com"}`,
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "Cuerpo con Content-Length excesivo",
+			method:         http.MethodPost,
+			path:           "/shorten",
+			body:           longBody,
+			expectedStatus: http.StatusRequestEntityTooLarge,
+			expectedCode:   "payload_too_large",
+		},
+		{
+			name:           "Cuerpo excesivo sin Content-Length",
+			method:         http.MethodPost,
+			path:           "/shorten",
+			body:           longBody,
+			chunked:        true,
+			expectedStatus: http.StatusRequestEntityTooLarge,
+			expectedCode:   "payload_too_large",
+		},
+		{
+			name:           "Handler que supera el timeout",
+			method:         http.MethodGet,
+			path:           "/lento",
+			expectedStatus: http.StatusRequestTimeout,
+			expectedCode:   "request_timeout",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.chunked {
+				req.ContentLength = -1
+			}
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+			if tt.expectedCode == "" {
+				return
+			}
+
+			var errResp ErrorResponse
+			if err := json.NewDecoder(rr.Body).Decode(&errResp); err != nil {
+				t.Fatalf("Error decoding response: %v", err)
+			}
+			if errResp.Error != tt.expectedCode {
+				t.Errorf("Expected error code %s, got %s", tt.expectedCode, errResp.Error)
+			}
+		})
+	}
+}
+
+func TestCORS_Middleware(t *testing.T) {
+	store := shortener.NewStore()
+	service := shortener.NewService(store)
+	handler := NewHandler(service)
+
+	r := chi.NewRouter()
+	r.Use(CORS(CORSOptions{
+		AllowedOrigins: []string{"https://app.example.com"},
+		AllowedMethods: []string{"GET", "POST"},
+		AllowedHeaders: []string{"Content-Type", "Authorization"},
+		MaxAge:         10 * time.Minute,
+	}))
+	r.Post("/shorten", handler.ShortenURL)
+
+	tests := []struct {
+		name           string
+		method         string
+		origin         string
+		preflight      bool
+		expectedStatus int
+		expectedOrigin string
+	}{
+		{name: "Preflight de origen permitido", method: http.MethodOptions, origin: "https://app.example.com", preflight: true, expectedStatus: http.StatusNoContent, expectedOrigin: "https://app.example.com"},
+		{name: "POST de origen permitido", method: http.MethodPost, origin: "https://app.example.com", expectedStatus: http.StatusCreated, expectedOrigin: "https://app.example.com"},
+		{name: "POST de origen no permitido", method: http.MethodPost, origin: "https://evil.example.com", expectedStatus: http.StatusCreated, expectedOrigin: ""},
+		{name: "POST sin origen", method: http.MethodPost, expectedStatus: http.StatusCreated, expectedOrigin: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/shorten", strings.NewReader(`{"long_url": "https://www.example.com"}`))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			if tt.preflight {
+				req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+			}
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+			if got := rr.Header().Get("Access-Control-Allow-Origin"); got != tt.expectedOrigin {
+				t.Errorf("Expected Access-Control-Allow-Origin %q, got %q", tt.expectedOrigin, got)
+			}
+			if tt.preflight {
+				if rr.Header().Get("Access-Control-Allow-Methods") != "GET, POST" || rr.Header().Get("Access-Control-Max-Age") != "600" {
+					t.Errorf("Unexpected preflight headers: %v", rr.Header())
+				}
+			}
+		})
+	}
+}
+
+func TestAccessLog_Middleware(t *testing.T) {
+	r := func(opts AccessLogOptions) http.Handler {
+		r := chi.NewRouter()
+		r.Use(AccessLog(opts))
+		r.Get("/ir", func(w http.ResponseWriter, r *http.Request) {
+			http.Redirect(w, r, "https://www.example.com/destino?token=secreto", http.StatusTemporaryRedirect)
+		})
+		r.Get("/api/shorten", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("ok"))
+		})
+		r.Get("/falla", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		})
+		return r
+	}
+
+	tests := []struct {
+		name        string
+		opts        AccessLogOptions
+		target      string
+		optOut      string
+		referer     string
+		expected    []string
+		notExpected []string
+	}{
+		{
+			name:        "JSON con destino oculto",
+			opts:        AccessLogOptions{Format: AccessLogJSON, SampleRate: 1, RedactQuery: true},
+			target:      "/ir",
+			expected:    []string{`"status":307`, `"location":"https://www.example.com/destino?REDACTED"`, `"remote_ip":"192.0.2.1"`},
+			notExpected: []string{"secreto"},
+		},
+		{
+			name:        "Query de la URL de destino oculta",
+			opts:        AccessLogOptions{Format: AccessLogCombined, SampleRate: 1, RedactQuery: true},
+			target:      "/api/shorten?url=https%3A%2F%2Fx.com%2Fa%3Ftoken%3Dsecreto&api_key=clave&alias=promo",
+			expected:    []string{`"GET /api/shorten?url=https%3A%2F%2Fx.com%2Fa%3FREDACTED&api_key=REDACTED&alias=promo HTTP/1.1" 200 2 "-" "Go-test"`},
+			notExpected: []string{"secreto", "clave"},
+		},
+		{
+			name:        "Sin ocultar la query, la clave de API se oculta igual",
+			opts:        AccessLogOptions{Format: AccessLogText, SampleRate: 1},
+			target:      "/api/shorten?url=https://x.com/a?token=visible&api_key=clave",
+			expected:    []string{"token=visible", "api_key=REDACTED", "- 200 2B"},
+			notExpected: []string{"clave"},
+		},
+		{
+			name:        "Contraseña del enlace oculta",
+			opts:        AccessLogOptions{Format: AccessLogText, SampleRate: 1},
+			target:      "/ir?key=hunter2",
+			expected:    []string{"/ir?key=REDACTED"},
+			notExpected: []string{"hunter2"},
+		},
+		{
+			name:        "Token de confirmación oculto",
+			opts:        AccessLogOptions{Format: AccessLogText, SampleRate: 1},
+			target:      "/api/shorten?confirm=tokensecreto&alias=promo",
+			expected:    []string{"confirm=REDACTED&alias=promo"},
+			notExpected: []string{"tokensecreto"},
+		},
+		{
+			name:        "Firma de la URL firmada oculta",
+			opts:        AccessLogOptions{Format: AccessLogCombined, SampleRate: 1},
+			target:      "/ir?exp=1700000000&sig=firmasecreta",
+			expected:    []string{`"GET /ir?exp=1700000000&sig=REDACTED HTTP/1.1" 307`},
+			notExpected: []string{"firmasecreta"},
+		},
+		{
+			name:        "Do Not Track sin IP ni User-Agent",
+			opts:        AccessLogOptions{Format: AccessLogCombined, SampleRate: 1},
+			target:      "/api/shorten",
+			optOut:      "DNT",
+			referer:     "https://www.example.com/origen",
+			expected:    []string{`- - - [`, `200 2 "-" "-"`},
+			notExpected: []string{"192.0.2.1", "Go-test", "origen"},
+		},
+		{
+			name:        "Modo privado",
+			opts:        AccessLogOptions{Format: AccessLogJSON, SampleRate: 1, PrivacyMode: true},
+			target:      "/ir",
+			referer:     "https://www.example.com/origen",
+			expected:    []string{`"remote_ip":"-"`, `"status":307`},
+			notExpected: []string{"192.0.2.1", "Go-test", "origen"},
+		},
+		{
+			name:   "Petición fuera de la muestra",
+			opts:   AccessLogOptions{Format: AccessLogJSON, SampleRate: 0},
+			target: "/api/shorten",
+		},
+		{
+			name:     "Los errores se registran siempre",
+			opts:     AccessLogOptions{Format: AccessLogJSON, SampleRate: 0},
+			target:   "/falla",
+			expected: []string{`"status":503`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out strings.Builder
+			tt.opts.Output = &out
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			req.Header.Set("User-Agent", "Go-test")
+			req.Header.Set("Referer", tt.referer)
+			if tt.optOut != "" {
+				req.Header.Set(tt.optOut, "1")
+			}
+			r(tt.opts).ServeHTTP(httptest.NewRecorder(), req)
+
+			logged := out.String()
+			if len(tt.expected) == 0 && logged != "" {
+				t.Errorf("Expected no log line, got %s", logged)
+			}
+			for _, expected := range tt.expected {
+				if !strings.Contains(logged, expected) {
+					t.Errorf("Expected log to contain %s, got %s", expected, logged)
+				}
+			}
+			for _, notExpected := range tt.notExpected {
+				if strings.Contains(logged, notExpected) {
+					t.Errorf("Expected log not to contain %s, got %s", notExpected, logged)
+				}
+			}
+		})
+	}
+}
+
+func TestCompress_Middleware(t *testing.T) {
+	store := shortener.NewStore()
+	service := shortener.NewService(store)
+	handler := NewHandler(service)
+
+	r := chi.NewRouter()
+	r.Use(Compress(5))
+	r.Post("/api/resolve", handler.ResolveBatch)
+
+	testURL := "https://www.example.com/comprimida"
+	shortCode, err := service.ShortenURL(context.Background(), testURL)
+	if err != nil {
+		t.Fatalf("Error creating test URL: %v", err)
+	}
+
+	tests := []struct {
+		name             string
+		acceptEncoding   string
+		expectedEncoding string
+		reader           func(io.Reader) (io.Reader, error)
+	}{
+		{
+			name:             "Gzip",
+			acceptEncoding:   "gzip",
+			expectedEncoding: "gzip",
+			reader:           func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) },
+		},
+		{
+			name:             "Deflate",
+			acceptEncoding:   "deflate",
+			expectedEncoding: "deflate",
+			reader:           func(r io.Reader) (io.Reader, error) { return flate.NewReader(r), nil },
+		},
+		{
+			name:             "Sin compresión",
+			expectedEncoding: "",
+			reader:           func(r io.Reader) (io.Reader, error) { return r, nil },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/resolve", strings.NewReader(fmt.Sprintf(`{"codes": [%q]}`, shortCode)))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+
+			if got := rr.Header().Get("Content-Encoding"); got != tt.expectedEncoding {
+				t.Fatalf("Expected Content-Encoding %q, got %q", tt.expectedEncoding, got)
+			}
+
+			body, err := tt.reader(rr.Body)
+			if err != nil {
+				t.Fatalf("Error opening body: %v", err)
+			}
+			var response ResolveResponse
+			if err := json.NewDecoder(body).Decode(&response); err != nil {
+				t.Fatalf("Error decoding response: %v", err)
+			}
+			if len(response.Results) != 1 || response.Results[0].LongURL != testURL {
+				t.Errorf("Unexpected resolve response: %+v", response)
+			}
+		})
+	}
+}
+
+func TestTrustedProxies_Middleware(t *testing.T) {
+	store := shortener.NewStore()
+	service := shortener.NewService(store)
+	handler := NewHandler(service)
+	trusted, err := ParseTrustedProxies([]string{"10.0.0.0/8", "192.168.1.1"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	r := chi.NewRouter()
+	r.Use(TrustedProxies(trusted))
+	r.Post("/shorten", handler.ShortenURL)
+	r.Get("/ip", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(ClientIP(r)))
+	})
+
+	tests := []struct {
+		name          string
+		remoteAddr    string
+		forwardedFor  string
+		proto         string
+		host          string
+		expectedIP    string
+		expectedShort string
+	}{
+		{"Sin proxy", "203.0.113.7:4000", "", "", "", "203.0.113.7", "http://example.com/"},
+		{"Cabeceras de un cliente no confiable", "203.0.113.7:4000", "1.2.3.4", "https", "sho.rt", "203.0.113.7", "http://example.com/"},
+		{"Proxy de confianza", "10.0.0.2:4000", "198.51.100.9", "https", "sho.rt", "198.51.100.9", "https://sho.rt/"},
+		{"Cadena de proxies", "10.0.0.2:4000", "1.2.3.4, 198.51.100.9, 192.168.1.1", "https", "", "198.51.100.9", "https://example.com/"},
+		{"Todos los saltos de confianza", "10.0.0.2:4000", "10.1.1.1, 10.2.2.2", "", "", "10.1.1.1", "http://example.com/"},
+		{"Entrada inválida", "10.0.0.2:4000", "basura, 10.2.2.2", "ftp", "", "10.2.2.2", "http://example.com/"},
+		{"IPv6 con puerto", "[::ffff:10.0.0.2]:4000", "[2001:db8::1]:5555", "", "", "2001:db8::1", "http://example.com/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setHeaders := func(req *http.Request) {
+				req.RemoteAddr = tt.remoteAddr
+				if tt.forwardedFor != "" {
+					req.Header.Set("X-Forwarded-For", tt.forwardedFor)
+				}
+				if tt.proto != "" {
+					req.Header.Set("X-Forwarded-Proto", tt.proto)
+				}
+				if tt.host != "" {
+					req.Header.Set("X-Forwarded-Host", tt.host)
+				}
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/ip", nil)
+			setHeaders(req)
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+			if rr.Body.String() != tt.expectedIP {
+				t.Errorf("Expected client IP %s, got %s", tt.expectedIP, rr.Body.String())
+			}
+
+			req = httptest.NewRequest(http.MethodPost, "/shorten", strings.NewReader(`{"long_url": "https://www.example.com"}`))
+			req.Header.Set("Content-Type", "application/json")
+			setHeaders(req)
+			rr = httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+			var resp ShortenResponse
+			json.NewDecoder(rr.Body).Decode(&resp)
+			if !strings.HasPrefix(resp.ShortURL, tt.expectedShort) {
+				t.Errorf("Expected short URL under %s, got %s", tt.expectedShort, resp.ShortURL)
+			}
+		})
+	}
+
+	if _, err := ParseTrustedProxies([]string{"10.0.0.0/33"}); err == nil {
+		t.Errorf("Expected error for an invalid CIDR")
+	}
+}
+
+func TestHandler_Debug(t *testing.T) {
+	store := shortener.NewStore(shortener.WithEviction(10, shortener.EvictionLRU))
+	service := shortener.NewService(store)
+	handler := NewHandler(service, WithCacheStats(func() cache.Stats { return cache.Stats{Hits: 3, Misses: 1} }))
+	service.Shorten(context.Background(), shortener.ShortenInput{LongURL: "https://www.example.com"})
+
+	tokens := auth.NewTokenManager([]byte("secreto-de-prueba"), time.Hour)
+	userToken, _ := tokens.Issue("alice", auth.RoleUser)
+	adminToken, _ := tokens.Issue("root", auth.RoleAdmin)
+	r := chi.NewRouter()
+	r.Use(Authenticate(tokens))
+	r.With(RequireAuth, RequireAdmin).Mount(DebugPath, handler.Debug())
+
+	get := func(path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+
+	tests := []struct {
+		name           string
+		path           string
+		token          string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{"Sin autenticación", "/debug/stats", "", http.StatusUnauthorized, "unauthorized"},
+		{"Usuario sin permisos", "/debug/pprof/", userToken, http.StatusForbidden, "forbidden"},
+		{"Índice de pprof", "/debug/pprof/", adminToken, http.StatusOK, "goroutine"},
+		{"Perfil con nombre", "/debug/pprof/goroutine?debug=1", adminToken, http.StatusOK, "goroutine profile"},
+		{"Estadísticas", "/debug/stats", adminToken, http.StatusOK, `"goroutines"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := get(tt.path, tt.token)
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+			if !strings.Contains(rr.Body.String(), tt.expectedBody) {
+				t.Errorf("Expected body to contain %q, got %s", tt.expectedBody, rr.Body.String())
+			}
+		})
+	}
+
+	var stats DebugStatsResponse
+	if err := json.NewDecoder(get("/debug/stats", adminToken).Body).Decode(&stats); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if stats.Goroutines == 0 || stats.Heap.AllocBytes == 0 {
+		t.Errorf("Unexpected runtime stats: %+v", stats)
+	}
+	if stats.Store.Links != 1 || stats.Store.Capacity != 10 || stats.Store.Policy != shortener.EvictionLRU {
+		t.Errorf("Unexpected store stats: %+v", stats.Store)
+	}
+	if stats.Cache == nil || stats.Cache.HitRatio != 0.75 {
+		t.Errorf("Expected cache hit ratio 0.75, got %+v", stats.Cache)
+	}
+}
+
+func TestHandler_SiteFiles(t *testing.T) {
+	service := shortener.NewService(shortener.NewStore())
+	security := WithSecurityTxt(SecurityTxt{Contacts: []string{"mailto:seguridad@example.com", "https://example.com/contacto"}, Policy: "https://example.com/politica"})
+
+	tests := []struct {
+		name                string
+		opts                []Option
+		path                string
+		expectedStatus      int
+		expectedContentType string
+		expectedBody        []string
+	}{
+		{name: "robots.txt por defecto", path: "/robots.txt", expectedStatus: http.StatusOK, expectedContentType: "text/plain; charset=utf-8",
+			expectedBody: []string{DefaultRobotsTxt}},
+		{name: "robots.txt propio", opts: []Option{WithRobotsTxt("User-agent: *\nDisallow: /api/\n")}, path: "/robots.txt",
+			expectedStatus: http.StatusOK, expectedBody: []string{"Disallow: /api/"}},
+		{name: "Favicon incluido", path: "/favicon.ico", expectedStatus: http.StatusOK, expectedContentType: "image/x-icon"},
+		{name: "Favicon PNG propio", opts: []Option{WithFavicon([]byte("\x89PNG\r\n\x1a\n"))}, path: "/favicon.ico",
+			expectedStatus: http.StatusOK, expectedContentType: "image/png"},
+		{name: "security.txt", opts: []Option{security}, path: "/.well-known/security.txt", expectedStatus: http.StatusOK,
+			expectedContentType: "text/plain; charset=utf-8",
+			expectedBody: []string{"Contact: mailto:seguridad@example.com\nContact: https://example.com/contacto\n", "Expires: ",
+				"Policy: https://example.com/politica", "Canonical: http://example.com/.well-known/security.txt"}},
+		{name: "security.txt sin contactos", path: "/.well-known/security.txt", expectedStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewHandler(service, tt.opts...)
+			r := chi.NewRouter()
+			r.Get("/robots.txt", handler.RobotsTxt)
+			r.Get("/favicon.ico", handler.Favicon)
+			r.Get("/.well-known/security.txt", handler.SecurityTxt)
+			r.Get("/{short_code}", handler.RedirectURL)
+
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if tt.expectedContentType != "" && rr.Header().Get("Content-Type") != tt.expectedContentType {
+				t.Errorf("Expected Content-Type %s, got %s", tt.expectedContentType, rr.Header().Get("Content-Type"))
+			}
+			for _, want := range tt.expectedBody {
+				if !strings.Contains(rr.Body.String(), want) {
+					t.Errorf("Expected body to contain %q, got %s", want, rr.Body.String())
+				}
+			}
+		})
+	}
+
+	// Expires es una fecha RFC 3339 futura y a menos de un año
+	rr := httptest.NewRecorder()
+	NewHandler(service, security).SecurityTxt(rr, httptest.NewRequest(http.MethodGet, "/.well-known/security.txt", nil))
+	_, rest, _ := strings.Cut(rr.Body.String(), "Expires: ")
+	value, _, _ := strings.Cut(rest, "\n")
+	expires, err := time.Parse(time.RFC3339, value)
+	if err != nil || !expires.After(time.Now()) || expires.After(time.Now().AddDate(1, 0, 0)) {
+		t.Errorf("Expected Expires within a year, got %q (%v)", value, err)
+	}
+}
+
+func TestHandler_OpenAPI(t *testing.T) {
+	handler := NewHandler(shortener.NewService(shortener.NewStore()))
+
+	r := chi.NewRouter()
+	r.Get("/openapi.json", handler.OpenAPI)
+	r.Get("/docs", handler.SwaggerUI)
+
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+
+	var spec struct {
+		OpenAPI string                            `json:"openapi"`
+		Paths   map[string]map[string]interface{} `json:"paths"`
+		Servers []struct {
+			URL string `json:"url"`
+		} `json:"servers"`
+		Components struct {
+			Schemas map[string]struct {
+				Properties map[string]map[string]interface{} `json:"properties"`
+				Required   []string                          `json:"required"`
+				Enum       []string                          `json:"enum"`
+			} `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&spec); err != nil {
+		t.Fatalf("Error decoding spec: %v", err)
+	}
+	if spec.OpenAPI != "3.0.3" || len(spec.Servers) != 1 || spec.Servers[0].URL != "http://example.com" {
+		t.Errorf("Unexpected spec header: %s %+v", spec.OpenAPI, spec.Servers)
+	}
+
+	tests := []struct {
+		name   string
+		path   string
+		method string
+	}{
+		{name: "Acortar", path: "/shorten", method: "post"},
+		{name: "Lote", path: "/shorten/batch", method: "post"},
+		{name: "Redirección", path: "/{short_code}", method: "get"},
+		{name: "Listado del usuario", path: "/api/me/urls", method: "get"},
+		{name: "Eliminar", path: "/api/urls/{short_code}", method: "delete"},
+		{name: "Desactivar", path: "/api/urls/{short_code}:disable", method: "post"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, ok := spec.Paths[tt.path][tt.method]; !ok {
+				t.Errorf("Expected operation %s %s in spec", tt.method, tt.path)
+			}
+		})
+	}
+
+	// Los esquemas se derivan de las etiquetas json de los structs
+	shorten := spec.Components.Schemas["ShortenRequest"]
+	if _, ok := shorten.Properties["ttl_seconds"]; !ok || len(shorten.Required) != 1 || shorten.Required[0] != "long_url" {
+		t.Errorf("Unexpected ShortenRequest schema: %+v", shorten)
+	}
+	if items := spec.Components.Schemas["BatchShortenRequest"].Properties["urls"]["items"]; items == nil {
+		t.Errorf("Expected items in BatchShortenRequest.urls")
+	}
+
+	// Los códigos de error se publican como enumeración
+	if ref := spec.Components.Schemas["ErrorResponse"].Properties["error"]["$ref"]; ref != "#/components/schemas/ErrorCode" {
+		t.Errorf("Expected ErrorResponse.error to reference ErrorCode, got %v", ref)
+	}
+	if codes := spec.Components.Schemas["ErrorCode"].Enum; len(codes) != len(errcode.All()) {
+		t.Errorf("Expected %d error codes in ErrorCode, got %d", len(errcode.All()), len(codes))
+	}
+
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/docs", nil))
+	if !strings.HasPrefix(rr.Header().Get("Content-Type"), "text/html") || !strings.Contains(rr.Body.String(), "/openapi.json") {
+		t.Errorf("Expected Swagger UI page pointing to /openapi.json")
+	}
+}
+
+func TestHandler_GraphQL(t *testing.T) {
+	store := shortener.NewStore()
+	service := shortener.NewService(store)
+	handler := NewHandler(service)
+	tokens := auth.NewTokenManager([]byte("secreto-de-prueba"), time.Hour)
+
+	r := chi.NewRouter()
+	r.Use(Authenticate(tokens))
+	r.Post("/graphql", handler.GraphQL)
+	r.Get("/graphql", handler.GraphQL)
+
+	aliceToken, _ := tokens.Issue("alice", auth.RoleUser)
+	bobToken, _ := tokens.Issue("bob", auth.RoleUser)
+	adminToken, _ := tokens.Issue("root", auth.RoleAdmin)
+
+	type graphQLResponse struct {
+		Data   map[string]json.RawMessage `json:"data"`
+		Errors []struct {
+			Message    string            `json:"message"`
+			Extensions map[string]string `json:"extensions"`
+		} `json:"errors"`
+	}
+	execute := func(token, query string, variables map[string]interface{}) graphQLResponse {
+		body, _ := json.Marshal(map[string]interface{}{"query": query, "variables": variables})
+		req := httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(string(body)))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d", http.StatusOK, rr.Code)
+		}
+		var response graphQLResponse
+		if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+			t.Fatalf("Error decoding response: %v", err)
+		}
+		return response
+	}
+
+	// Alice crea un enlace con alias mediante una mutación con variables
+	created := execute(aliceToken, `mutation ($url: String!) { shortenUrl(longUrl: $url, alias: "gql-alice") { shortCode owner } }`,
+		map[string]interface{}{"url": "https://www.example.com/graphql"})
+	if len(created.Errors) != 0 || string(created.Data["shortenUrl"]) != `{"owner":"alice","shortCode":"gql-alice"}` {
+		t.Fatalf("Unexpected shortenUrl response: %+v", created)
+	}
+
+	listed := execute(aliceToken, `{ urls { shortCode longUrl clicks } }`, nil)
+	if len(listed.Errors) != 0 {
+		t.Fatalf("Unexpected errors: %+v", listed.Errors)
+	}
+	if string(listed.Data["urls"]) != `[{"clicks":0,"longUrl":"https://www.example.com/graphql","shortCode":"gql-alice"}]` {
+		t.Errorf("Unexpected urls: %s", listed.Data["urls"])
+	}
+
+	// Las estadísticas globales son solo para administradores, como GET /api/stats
+	stats := execute(adminToken, `{ stats { totalUrls } }`, nil)
+	if len(stats.Errors) != 0 || string(stats.Data["stats"]) != `{"totalUrls":1}` {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+
+	tests := []struct {
+		name         string
+		token        string
+		query        string
+		expectedCode string
+	}{
+		{name: "Listado anónimo", query: `{ urls { shortCode } }`, expectedCode: "unauthorized"},
+		{name: "Estadísticas anónimas", query: `{ stats { totalUrls } }`, expectedCode: "forbidden"},
+		{name: "Estadísticas sin ser admin", token: aliceToken, query: `{ stats { totalUrls } }`, expectedCode: "forbidden"},
+		{name: "Borrado ajeno", token: bobToken, query: `mutation { deleteUrl(shortCode: "gql-alice") }`, expectedCode: "forbidden"},
+		{name: "Alias en uso", token: bobToken, query: `mutation { shortenUrl(longUrl: "https://www.example.com", alias: "gql-alice") { shortCode } }`, expectedCode: "alias_taken"},
+		{name: "URL inválida", query: `mutation { shortenUrl(longUrl: "ftp://example.com") { shortCode } }`, expectedCode: "invalid_url"},
+		{name: "Argumento faltante", query: `{ url { shortCode } }`, expectedCode: "invalid_argument"},
+		{name: "Sintaxis inválida", query: `{ url(shortCode: "x" { shortCode } }`, expectedCode: "graphql_parse_failed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := execute(tt.token, tt.query, nil)
+			if len(response.Errors) != 1 || response.Errors[0].Extensions["code"] != tt.expectedCode {
+				t.Errorf("Expected error code %s, got %+v", tt.expectedCode, response.Errors)
+			}
+		})
+	}
+
+	// Un código inexistente se resuelve como null sin error
+	if missing := execute("", `{ url(shortCode: "no-existe") { shortCode } }`, nil); len(missing.Errors) != 0 || string(missing.Data["url"]) != "null" {
+		t.Errorf("Expected null url, got %+v", missing)
+	}
+
+	// Por GET no se aceptan mutaciones
+	req := httptest.NewRequest(http.MethodGet, "/graphql?query="+url.QueryEscape(`mutation { deleteUrl(shortCode: "gql-alice") }`), nil)
+	req.Header.Set("Authorization", "Bearer "+aliceToken)
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	if _, err := service.GetLink(context.Background(), "gql-alice"); err != nil {
+		t.Errorf("Expected link to survive a GET mutation, got %v", err)
+	}
+
+	// La consulta url es pública: el propietario solo lo ven él y los administradores
+	ownerQuery := `{ url(shortCode: "gql-alice") { owner } }`
+	for _, tt := range []struct{ token, expected string }{
+		{"", `{"owner":null}`}, {bobToken, `{"owner":null}`}, {aliceToken, `{"owner":"alice"}`}, {adminToken, `{"owner":"alice"}`},
+	} {
+		if response := execute(tt.token, ownerQuery, nil); len(response.Errors) != 0 || string(response.Data["url"]) != tt.expected {
+			t.Errorf("Expected %s, got %+v", tt.expected, response)
+		}
+	}
+
+	// Un enlace desactivado no revela su destino, como en la vista previa
+	service.DisableURL(context.Background(), shortener.Actor{UserID: "alice"}, "gql-alice", "")
+	disabled := execute("", `{ url(shortCode: "gql-alice") { longUrl disabled } }`, nil)
+	if len(disabled.Errors) != 0 || string(disabled.Data["url"]) != `{"disabled":true,"longUrl":null}` {
+		t.Errorf("Expected the disabled link to hide its destination, got %+v", disabled)
+	}
+}
+
+func TestHandler_ImportExport(t *testing.T) {
+	store := shortener.NewStore()
+	service := shortener.NewService(store)
+	handler := NewHandler(service)
+	tokens := auth.NewTokenManager([]byte("secreto-de-prueba"), time.Hour)
+
+	r := chi.NewRouter()
+	r.Use(Authenticate(tokens))
+	r.Route("/admin", func(r chi.Router) {
+		r.Use(RequireAuth, RequireAdmin)
+		r.Post("/import", handler.ImportLinks)
+		r.Get("/export", handler.ExportLinks)
+		r.Get("/audit", handler.AuditLog)
+		r.Post("/domains/reload", handler.ReloadDomains)
+	})
+
+	adminToken, _ := tokens.Issue("root", auth.RoleAdmin)
+	userToken, _ := tokens.Issue("alice", auth.RoleUser)
+
+	do := func(method, path, token, contentType, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+
+	expiresAt := time.Now().Add(24 * time.Hour).UTC().Format(time.RFC3339)
+	csvBody := "long_url,alias,expires_at\n" +
+		"https://www.example.com/uno,uno-import,\n" +
+		"https://www.example.com/dos,," + expiresAt + "\n" +
+		"not-a-url,,\n" +
+		"https://www.example.com/tres,,mañana\n" +
+		"https://www.example.com/cuatro,uno-import,\n"
+
+	rr := do(http.MethodPost, "/admin/import", adminToken, "text/csv", csvBody)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	var imported ImportResponse
+	if err := json.NewDecoder(rr.Body).Decode(&imported); err != nil {
+		t.Fatalf("Error decoding import response: %v", err)
+	}
+	if imported.Imported != 2 || imported.Failed != 3 || len(imported.Errors) != 3 {
+		t.Fatalf("Expected 2 imported and 3 failed, got %+v", imported)
+	}
+	expectedErrors := []struct {
+		line int
+		code errcode.Code
+	}{{4, "invalid_url"}, {5, "invalid_expiry"}, {6, "alias_taken"}}
+	for i, expected := range expectedErrors {
+		if got := imported.Errors[i]; got.Line != expected.line || got.Error != expected.code {
+			t.Errorf("Expected error %s on line %d, got %+v", expected.code, expected.line, got)
+		}
+	}
+
+	// TSV por Content-Type, sin cabecera
+	rr = do(http.MethodPost, "/admin/import", adminToken, "text/tab-separated-values", "https://www.example.com/tsv\ttsv-import\n")
+	if err := json.NewDecoder(rr.Body).Decode(&imported); err != nil || imported.Imported != 1 {
+		t.Errorf("Expected TSV row imported, got %+v (%v)", imported, err)
+	}
+
+	rr = do(http.MethodGet, "/admin/export", adminToken, "", "")
+	if rr.Code != http.StatusOK || !strings.HasPrefix(rr.Header().Get("Content-Type"), "text/csv") {
+		t.Fatalf("Expected CSV export, got %d %q", rr.Code, rr.Header().Get("Content-Type"))
+	}
+	lines := strings.Split(strings.TrimSpace(rr.Body.String()), "\n")
+	if len(lines) != 4 || lines[0] != "short_code,long_url,owner,created_at,expires_at,clicks,domain" {
+		t.Fatalf("Unexpected export:\n%s", rr.Body.String())
+	}
+	if !strings.Contains(rr.Body.String(), "\nuno-import,https://www.example.com/uno,root,") {
+		t.Errorf("Expected imported alias with owner, got:\n%s", rr.Body.String())
+	}
+
+	rr = do(http.MethodGet, "/admin/export?format=tsv", adminToken, "", "")
+	if !strings.Contains(rr.Body.String(), "tsv-import\thttps://www.example.com/tsv\troot\t") {
+		t.Errorf("Expected TSV export, got:\n%s", rr.Body.String())
+	}
+
+	// Cada fila importada queda en el log de auditoría a nombre del admin
+	rr = do(http.MethodGet, "/admin/audit?action=create&actor=root&per_page=2", adminToken, "", "")
+	var audit AuditListResponse
+	if err := json.NewDecoder(rr.Body).Decode(&audit); err != nil || rr.Code != http.StatusOK {
+		t.Fatalf("Expected audit page, got %d (%v)", rr.Code, err)
+	}
+	if audit.Total != 3 || len(audit.Entries) != 2 || audit.Entries[0].ShortCode != "tsv-import" || audit.Entries[0].After == nil || audit.Entries[0].Before != nil {
+		t.Errorf("Expected three create entries newest first, got %+v", audit)
+	}
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		token          string
+		expectedStatus int
+	}{
+		{"Sin token", http.MethodGet, "/admin/export", "", http.StatusUnauthorized},
+		{"Usuario sin permisos consulta auditoría", http.MethodGet, "/admin/audit", userToken, http.StatusForbidden},
+		{"Auditoría con fecha inválida", http.MethodGet, "/admin/audit?since=ayer", adminToken, http.StatusBadRequest},
+		{"Auditoría con acción desconocida", http.MethodGet, "/admin/audit?action=purge", adminToken, http.StatusBadRequest},
+		{"Recargar listas de dominios", http.MethodPost, "/admin/domains/reload", adminToken, http.StatusOK},
+		{"Usuario sin permisos recarga dominios", http.MethodPost, "/admin/domains/reload", userToken, http.StatusForbidden},
+		{"Usuario sin permisos exporta", http.MethodGet, "/admin/export", userToken, http.StatusForbidden},
+		{"Usuario sin permisos importa", http.MethodPost, "/admin/import", userToken, http.StatusForbidden},
+		{"Formato desconocido", http.MethodGet, "/admin/export?format=xml", adminToken, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := do(tt.method, tt.path, tt.token, "text/csv", "")
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+		})
+	}
+}
+
+func TestHandler_IdempotencyKey(t *testing.T) {
+	store := shortener.NewStore()
+	service := shortener.NewService(store)
+	handler := NewHandler(service)
+
+	shorten := func(key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/shorten", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if key != "" {
+			req.Header.Set(IdempotencyKeyHeader, key)
+		}
+		rr := httptest.NewRecorder()
+		handler.ShortenURL(rr, req)
+		return rr
+	}
+
+	first := shorten("pedido-42", `{"long_url": "https://www.example.com/idem"}`)
+	if first.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d", http.StatusCreated, first.Code)
+	}
+
+	tests := []struct {
+		name           string
+		key            string
+		body           string
+		expectedStatus int
+		expectedError  errcode.Code
+		sameURL        bool
+	}{
+		{"Reintento con la misma clave", "pedido-42", `{"long_url": "https://www.example.com/idem"}`, http.StatusCreated, "", true},
+		{"Misma clave con otro cuerpo", "pedido-42", `{"long_url": "https://www.example.com/otra"}`, http.StatusUnprocessableEntity, "idempotency_key_reused", false},
+		{"Clave demasiado larga", strings.Repeat("k", MaxIdempotencyKeyLength+1), `{"long_url": "https://www.example.com/idem"}`, http.StatusBadRequest, "invalid_idempotency_key", false},
+		{"Sin clave", "", `{"long_url": "https://www.example.com/idem"}`, http.StatusCreated, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := shorten(tt.key, tt.body)
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+			if tt.expectedError != "" {
+				var errResp ErrorResponse
+				json.NewDecoder(rr.Body).Decode(&errResp)
+				if errResp.Error != tt.expectedError {
+					t.Errorf("Expected error %s, got %s", tt.expectedError, errResp.Error)
+				}
+				return
+			}
+			if (rr.Body.String() == first.Body.String()) != tt.sameURL {
+				t.Errorf("Expected same short URL %v, got %s (original %s)", tt.sameURL, rr.Body.String(), first.Body.String())
+			}
+		})
+	}
+
+	if count, _ := store.Count(context.Background()); count != 2 {
+		t.Errorf("Expected 2 links stored, got %d", count)
+	}
+}
+
+func TestHandler_ErrorLanguage(t *testing.T) {
+	handler := NewHandler(shortener.NewService(shortener.NewStore()))
+
+	tests := []struct {
+		name             string
+		acceptLanguage   string
+		expectedLanguage string
+		expectedMessage  string
+	}{
+		{"Sin Accept-Language", "", LanguageES, "URL inválida"},
+		{"Inglés", "en", LanguageEN, "Invalid URL"},
+		{"Variante regional", "en-US,en;q=0.9", LanguageEN, "Invalid URL"},
+		{"Preferencia por peso", "en;q=0.4, es-AR;q=0.8", LanguageES, "URL inválida"},
+		{"Idioma sin catálogo", "fr-FR, en;q=0.5", LanguageEN, "Invalid URL"},
+		{"Solo idiomas sin catálogo", "de", LanguageES, "URL inválida"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/shorten", strings.NewReader(`{"long_url": "ftp://example.com"}`))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.acceptLanguage != "" {
+				req.Header.Set("Accept-Language", tt.acceptLanguage)
+			}
+			rr := httptest.NewRecorder()
+			handler.ShortenURL(rr, req)
+
+			var response ErrorResponse
+			if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			// El código es estable en todos los idiomas
+			if response.Error != "invalid_url" {
+				t.Errorf("Expected error invalid_url, got %s", response.Error)
+			}
+			if !strings.HasPrefix(response.Message, tt.expectedMessage) {
+				t.Errorf("Expected message %q, got %q", tt.expectedMessage, response.Message)
+			}
+			if got := rr.Header().Get("Content-Language"); got != tt.expectedLanguage {
+				t.Errorf("Expected Content-Language %s, got %s", tt.expectedLanguage, got)
+			}
+			if got := rr.Header().Get("Vary"); !strings.Contains(got, "Accept-Language") {
+				t.Errorf("Expected Vary to include Accept-Language, got %q", got)
+			}
+		})
+	}
+
+	t.Run("Catálogo completo", func(t *testing.T) {
+		for _, code := range errcode.All() {
+			for _, language := range []string{LanguageES, LanguageEN} {
+				if errorMessages[code][language] == "" {
+					t.Errorf("Expected %s message for %s", language, code)
+				}
+			}
+		}
+	})
+
+	t.Run("Errores por elemento", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/api/resolve", strings.NewReader(`{"codes": ["noexiste"]}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept-Language", "en")
+		rr := httptest.NewRecorder()
+		handler.ResolveBatch(rr, req)
+
+		var response ResolveResponse
+		if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(response.Results) != 1 || response.Results[0].Error == nil {
+			t.Fatalf("Expected one failed result, got %+v", response.Results)
+		}
+		if got := *response.Results[0].Error; got.Error != "not_found" || got.Message != "Short code not found" {
+			t.Errorf("Unexpected item error: %+v", got)
+		}
+	})
+}
+
+func TestHandler_ValidationErrorDetails(t *testing.T) {
+	checker := threat.CheckerFunc(func(ctx context.Context, rawURL string) (threat.Verdict, error) {
+		return threat.Verdict{Malicious: rawURL == "https://malo.example/descarga", Threat: "MALWARE", Source: "safebrowsing"}, nil
+	})
+	handler := NewHandler(shortener.NewService(shortener.NewStore(), shortener.WithThreatChecker(checker, time.Second)))
+
+	tests := []struct {
+		name           string
+		requestBody    string
+		expectedError  errcode.Code
+		expectedFields []FieldError
+	}{
+		{
+			name:           "Esquema no soportado",
+			requestBody:    `{"long_url": "ftp://example.com"}`,
+			expectedError:  "invalid_url",
+			expectedFields: []FieldError{{Field: "long_url", Message: "debe usar esquema http o https"}},
+		},
+		{
+			name:           "URL vacía",
+			requestBody:    `{"long_url": "  "}`,
+			expectedError:  "empty_url",
+			expectedFields: []FieldError{{Field: "long_url", Message: "no puede estar vacía"}},
+		},
+		{
+			name:          "Varios campos inválidos",
+			requestBody:   `{"long_url": "example.com", "alias": "a", "ttl_seconds": -5}`,
+			expectedError: "invalid_url",
+			expectedFields: []FieldError{
+				{Field: "long_url", Message: "debe usar esquema http o https"},
+				{Field: "ttl_seconds", Message: "no puede ser negativo"},
+				{Field: "alias", Message: "debe tener entre 3 y 32 caracteres"},
+			},
+		},
+		{
+			name:          "Alias reservado sin detalle de campo",
+			requestBody:   `{"long_url": "https://example.com", "alias": "shorten"}`,
+			expectedError: "alias_not_allowed",
+		},
+		{
+			name:           "Destino malicioso",
+			requestBody:    `{"long_url": "https://malo.example/descarga"}`,
+			expectedError:  "malicious_url",
+			expectedFields: []FieldError{{Field: "long_url", Message: "figura como amenaza (MALWARE) en safebrowsing"}},
+		},
+		{
+			name:           "URL demasiado larga",
+			requestBody:    `{"long_url": "https://www.example.com/` + strings.Repeat("a", 2048) + `"}`,
+			expectedError:  "url_too_long",
+			expectedFields: []FieldError{{Field: "long_url", Message: "supera la longitud máxima de 2048 caracteres"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/shorten", strings.NewReader(tt.requestBody))
+			req.Header.Set("Content-Type", "application/json")
+			rr := httptest.NewRecorder()
+			handler.ShortenURL(rr, req)
+
+			var response ErrorResponse
+			if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+				t.Fatalf("Error decoding error response: %v", err)
+			}
+			if response.Error != tt.expectedError {
+				t.Errorf("Expected error %s, got %s", tt.expectedError, response.Error)
+			}
+			if fmt.Sprint(response.Errors) != fmt.Sprint(tt.expectedFields) {
+				t.Errorf("Expected field errors %v, got %v", tt.expectedFields, response.Errors)
+			}
+		})
+	}
+}
+
+func TestHandler_LinkQuotas(t *testing.T) {
+	handler := NewHandler(shortener.NewService(shortener.NewStore(), shortener.WithLinkQuotas(3, 2), shortener.WithAPIKeys("clave")))
+	tokens := auth.NewTokenManager([]byte("secreto-de-prueba"), time.Hour)
+	aliceToken, _ := tokens.Issue("alice", auth.RoleUser)
+
+	r := chi.NewRouter()
+	r.Use(Authenticate(tokens))
+	r.Post("/shorten", handler.ShortenURL)
+
+	tests := []struct {
+		name           string
+		remoteAddr     string
+		apiKey         string
+		token          string
+		expectedStatus int
+		expectedError  string
+	}{
+		{name: "Primer enlace de la IP", remoteAddr: "203.0.113.1:5000", expectedStatus: http.StatusCreated},
+		{name: "Segundo enlace de la IP", remoteAddr: "203.0.113.1:5001", expectedStatus: http.StatusCreated},
+		{name: "Cuota de la IP agotada", remoteAddr: "203.0.113.1:5002", expectedStatus: http.StatusTooManyRequests, expectedError: "quota_exceeded"},
+		{name: "Una API key inventada cuenta para la IP", remoteAddr: "203.0.113.1:5003", apiKey: "inventada", expectedStatus: http.StatusTooManyRequests, expectedError: "quota_exceeded"},
+		{name: "La API key tiene su propia cuota", remoteAddr: "203.0.113.1:5003", apiKey: "clave", expectedStatus: http.StatusCreated},
+		{name: "Límite global alcanzado", remoteAddr: "203.0.113.2:5000", token: aliceToken, expectedStatus: http.StatusTooManyRequests, expectedError: "store_full"},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := fmt.Sprintf(`{"long_url": "https://www.example.com/%d"}`, i)
+			req := httptest.NewRequest(http.MethodPost, "/shorten", strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			req.RemoteAddr = tt.remoteAddr
+			if tt.apiKey != "" {
+				req.Header.Set(APIKeyHeader, tt.apiKey)
+			}
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if tt.expectedError != "" && !strings.Contains(rr.Body.String(), `"error":"`+tt.expectedError+`"`) {
+				t.Errorf("Expected error %s, got %s", tt.expectedError, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestHandler_MissingLinkPage(t *testing.T) {
+	store := shortener.NewStore()
+	store.SaveLink(context.Background(), shortener.Link{ShortCode: "viejo", LongURL: "https://www.example.com/", ExpiresAt: time.Now().Add(-time.Hour)})
+	service := shortener.NewService(store)
+	page := template.Must(template.New("404").Parse(`<h1>{{if .Expired}}Caducado{{else}}No existe{{end}}: {{.ShortCode}}</h1>`))
+
+	tests := []struct {
+		name             string
+		opts             []Option
+		path             string
+		accept           string
+		expectedStatus   int
+		expectedLocation string
+		expectedBody     string
+	}{
+		{name: "Sin configurar responde JSON", path: "/nada", expectedStatus: http.StatusNotFound, expectedBody: `"not_found"`},
+		{name: "Página de marca", opts: []Option{WithNotFoundPage(page)}, path: "/nada", expectedStatus: http.StatusNotFound, expectedBody: "<h1>No existe: nada</h1>"},
+		{name: "Página de marca para expirados", opts: []Option{WithNotFoundPage(page)}, path: "/viejo", expectedStatus: http.StatusGone, expectedBody: "<h1>Caducado: viejo</h1>"},
+		{name: "Clientes JSON reciben el error", opts: []Option{WithNotFoundPage(page)}, path: "/nada", accept: "application/json", expectedStatus: http.StatusNotFound, expectedBody: `"not_found"`},
+		{name: "URL de respaldo", opts: []Option{WithFallbackURL("https://www.example.com/inicio")}, path: "/viejo", expectedStatus: http.StatusFound, expectedLocation: "https://www.example.com/inicio"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := chi.NewRouter()
+			r.Get("/{short_code}", NewHandler(service, tt.opts...).RedirectURL)
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+			if location := rr.Header().Get("Location"); location != tt.expectedLocation {
+				t.Errorf("Expected Location %q, got %q", tt.expectedLocation, location)
+			}
+			if !strings.Contains(rr.Body.String(), tt.expectedBody) {
+				t.Errorf("Expected body to contain %q, got %s", tt.expectedBody, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestHandler_DisableURL(t *testing.T) {
+	store := shortener.NewStore()
+	service := shortener.NewService(store)
+	handler := NewHandler(service)
+	tokens := auth.NewTokenManager([]byte("secreto-de-prueba"), time.Hour)
+
+	r := chi.NewRouter()
+	r.Use(Authenticate(tokens))
+	r.Get("/{short_code}", handler.RedirectURL)
+	r.Route("/api", func(r chi.Router) {
+		r.Get("/urls/{short_code}", handler.PreviewURL)
+		r.Group(func(r chi.Router) {
+			r.Use(RequireAuth)
+			r.Get("/urls", handler.ListURLs)
+			r.Delete("/urls/{short_code}", handler.DeleteURL)
+			r.Post("/urls/{short_code}:disable", handler.DisableURL)
+			r.Post("/urls/{short_code}:enable", handler.EnableURL)
+		})
+	})
+
+	store.SaveLink(context.Background(), shortener.Link{ShortCode: "promo", LongURL: "https://www.example.com/promo", Owner: "alice"})
+	aliceToken, _ := tokens.Issue("alice", auth.RoleUser)
+	bobToken, _ := tokens.Issue("bob", auth.RoleUser)
+	adminToken, _ := tokens.Issue("root", auth.RoleAdmin)
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		token          string
+		body           string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{name: "Desactivar enlace ajeno", method: http.MethodPost, path: "/api/urls/promo:disable", token: bobToken, expectedStatus: http.StatusForbidden},
+		{name: "Desactivar sin token", method: http.MethodPost, path: "/api/urls/promo:disable", expectedStatus: http.StatusUnauthorized},
+		{name: "Motivo demasiado largo", method: http.MethodPost, path: "/api/urls/promo:disable", token: aliceToken,
+			body: `{"reason": "` + strings.Repeat("x", shortener.MaxDisableReasonLength+1) + `"}`, expectedStatus: http.StatusBadRequest},
+		{name: "Desactivar con motivo", method: http.MethodPost, path: "/api/urls/promo:disable", token: aliceToken,
+			body: `{"reason": "Campaña finalizada"}`, expectedStatus: http.StatusOK, expectedBody: `"disabled_reason":"Campaña finalizada"`},
+		{name: "Redirección de enlace desactivado", method: http.MethodGet, path: "/promo", expectedStatus: http.StatusGone, expectedBody: "Campaña finalizada"},
+		{name: "Vista previa oculta el destino", method: http.MethodGet, path: "/api/urls/promo", expectedStatus: http.StatusOK, expectedBody: `"disabled":true`},
+		{name: "Listado de desactivados", method: http.MethodGet, path: "/api/urls?filter=status:disabled", token: aliceToken, expectedStatus: http.StatusOK, expectedBody: `"total":1`},
+		{name: "Listado de activos", method: http.MethodGet, path: "/api/urls?filter=status:active", token: aliceToken, expectedStatus: http.StatusOK, expectedBody: `"total":0`},
+		{name: "Restaurar", method: http.MethodPost, path: "/api/urls/promo:enable", token: aliceToken, expectedStatus: http.StatusOK},
+		{name: "Redirección restaurada", method: http.MethodGet, path: "/promo", expectedStatus: http.StatusTemporaryRedirect},
+		{name: "Propietario elimina", method: http.MethodDelete, path: "/api/urls/promo", token: aliceToken, expectedStatus: http.StatusNoContent},
+		{name: "Redirección de enlace eliminado", method: http.MethodGet, path: "/promo", expectedStatus: http.StatusGone, expectedBody: shortener.DeletedReason},
+		{name: "Restaurar enlace eliminado", method: http.MethodPost, path: "/api/urls/promo:enable", token: aliceToken, expectedStatus: http.StatusOK},
+		{name: "Desactivar sin cuerpo", method: http.MethodPost, path: "/api/urls/promo:disable", token: aliceToken,
+			expectedStatus: http.StatusOK, expectedBody: shortener.DefaultDisableReason},
+		{name: "Admin purga", method: http.MethodDelete, path: "/api/urls/promo", token: adminToken, expectedStatus: http.StatusNoContent},
+		{name: "Redirección de enlace purgado", method: http.MethodGet, path: "/promo", expectedStatus: http.StatusNotFound},
+		{name: "Restaurar enlace purgado", method: http.MethodPost, path: "/api/urls/promo:enable", token: aliceToken, expectedStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if !strings.Contains(rr.Body.String(), tt.expectedBody) {
+				t.Errorf("Expected body to contain %q, got %s", tt.expectedBody, rr.Body.String())
+			}
+			if strings.Contains(tt.name, "Vista previa") && strings.Contains(rr.Body.String(), "long_url") {
+				t.Errorf("Expected preview to hide the destination, got %s", rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestHandler_LinkDetails(t *testing.T) {
+	store := shortener.NewStore()
+	service := shortener.NewService(store)
+	handler := NewHandler(service)
+	tokens := auth.NewTokenManager([]byte("secreto-de-prueba"), time.Hour)
+
+	r := chi.NewRouter()
+	r.Use(Authenticate(tokens))
+	r.Post("/shorten", handler.ShortenURL)
+	r.Route("/api", func(r chi.Router) {
+		r.Use(RequireAuth)
+		r.Get("/urls", handler.ListURLs)
+		r.Get("/urls/search", handler.SearchURLs)
+		r.Patch("/urls/{short_code}/details", handler.UpdateDetails)
+	})
+
+	aliceToken, _ := tokens.Issue("alice", auth.RoleUser)
+	bobToken, _ := tokens.Issue("bob", auth.RoleUser)
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		token          string
+		body           string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{name: "Crear con descripción y metadatos", method: http.MethodPost, path: "/shorten", token: aliceToken,
+			body:           `{"long_url": "https://www.example.com/promo", "alias": "promo", "description": "Campaña Q3", "custom_metadata": {"ticket": "OPS-123"}}`,
+			expectedStatus: http.StatusCreated},
+		{name: "Metadatos que no son un objeto", method: http.MethodPost, path: "/shorten", token: aliceToken,
+			body: `{"long_url": "https://www.example.com/otra", "custom_metadata": "OPS-123"}`, expectedStatus: http.StatusBadRequest,
+			expectedBody: `"field":"custom_metadata"`},
+		{name: "Listado con metadatos", method: http.MethodGet, path: "/api/urls", token: aliceToken, expectedStatus: http.StatusOK,
+			expectedBody: `"description":"Campaña Q3","custom_metadata":{"ticket":"OPS-123"}`},
+		{name: "Búsqueda por metadatos", method: http.MethodGet, path: "/api/urls/search?q=ops-123", token: aliceToken,
+			expectedStatus: http.StatusOK, expectedBody: `"total":1`},
+		{name: "Editar enlace ajeno", method: http.MethodPatch, path: "/api/urls/promo/details", token: bobToken,
+			body: `{"description": "Mía"}`, expectedStatus: http.StatusForbidden},
+		{name: "Editar descripción", method: http.MethodPatch, path: "/api/urls/promo/details", token: aliceToken,
+			body: `{"description": "Campaña Q4"}`, expectedStatus: http.StatusOK,
+			expectedBody: `"description":"Campaña Q4","custom_metadata":{"ticket":"OPS-123"}`},
+		{name: "Eliminar metadatos", method: http.MethodPatch, path: "/api/urls/promo/details", token: aliceToken,
+			body: `{"custom_metadata": null}`, expectedStatus: http.StatusOK, expectedBody: `"description":"Campaña Q4"}`},
+		{name: "Búsqueda sin metadatos", method: http.MethodGet, path: "/api/urls/search?q=ops-123", token: aliceToken,
+			expectedStatus: http.StatusOK, expectedBody: `"total":0`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if !strings.Contains(rr.Body.String(), tt.expectedBody) {
+				t.Errorf("Expected body to contain %q, got %s", tt.expectedBody, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestHandler_ExtendURL(t *testing.T) {
+	store := shortener.NewStore()
+	service := shortener.NewService(store)
+	handler := NewHandler(service)
+	tokens := auth.NewTokenManager([]byte("secreto-de-prueba"), time.Hour)
+
+	r := chi.NewRouter()
+	r.Use(Authenticate(tokens))
+	r.Route("/api", func(r chi.Router) {
+		r.Use(RequireAuth)
+		r.Post("/urls/{short_code}/extend", handler.ExtendURL)
+	})
+
+	store.SaveLink(context.Background(), shortener.Link{ShortCode: "promo", LongURL: "https://www.example.com/promo",
+		Owner: "alice", ExpiresAt: time.Now().Add(-time.Hour)})
+	aliceToken, _ := tokens.Issue("alice", auth.RoleUser)
+	bobToken, _ := tokens.Issue("bob", auth.RoleUser)
+
+	tests := []struct {
+		name           string
+		token          string
+		body           string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{name: "Sin autenticar", body: `{"ttl_seconds": 3600}`, expectedStatus: http.StatusUnauthorized},
+		{name: "Enlace ajeno", token: bobToken, body: `{"ttl_seconds": 3600}`, expectedStatus: http.StatusForbidden},
+		{name: "Sin fecha ni plazo", token: aliceToken, body: `{}`, expectedStatus: http.StatusBadRequest,
+			expectedBody: `"error":"invalid_expiry"`},
+		{name: "Fecha pasada", token: aliceToken, body: `{"expires_at": "2020-01-01T00:00:00Z"}`,
+			expectedStatus: http.StatusBadRequest, expectedBody: `"field":"expires_at"`},
+		{name: "Fecha concreta", token: aliceToken, body: `{"expires_at": "2099-01-01T00:00:00Z"}`,
+			expectedStatus: http.StatusOK, expectedBody: `"expires_at":"2099-01-01T00:00:00Z"`},
+		{name: "Plazo sumado", token: aliceToken, body: `{"ttl_seconds": 86400}`,
+			expectedStatus: http.StatusOK, expectedBody: `"expires_at":"2099-01-02T00:00:00Z"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/urls/promo/extend", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if !strings.Contains(rr.Body.String(), tt.expectedBody) {
+				t.Errorf("Expected body to contain %q, got %s", tt.expectedBody, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestHandler_TransferURL(t *testing.T) {
+	store := shortener.NewStore()
+	service := shortener.NewService(store)
+	handler := NewHandler(service)
+	tokens := auth.NewTokenManager([]byte("secreto-de-prueba"), time.Hour)
+
+	r := chi.NewRouter()
+	r.Use(Authenticate(tokens))
+	r.Route("/api", func(r chi.Router) {
+		r.Use(RequireAuth)
+		r.Post("/urls/{short_code}/transfer", handler.TransferURL)
+		r.Delete("/urls/{short_code}/transfer", handler.CancelTransfer)
+	})
+
+	store.SaveLink(context.Background(), shortener.Link{ShortCode: "promo", LongURL: "https://www.example.com/promo", Owner: "alice"})
+	aliceToken, _ := tokens.Issue("alice", auth.RoleUser)
+	bobToken, _ := tokens.Issue("bob", auth.RoleUser)
+	carolToken, _ := tokens.Issue("carol", auth.RoleUser)
+
+	send := func(token, query, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/urls/promo/transfer"+query, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := send(aliceToken, "", `{"to": "bob"}`)
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusAccepted, rr.Code, rr.Body.String())
+	}
+	var pending TransferResponse
+	json.NewDecoder(rr.Body).Decode(&pending)
+	if pending.From != "alice" || pending.To != "bob" || pending.ConfirmationToken == "" {
+		t.Fatalf("Expected pending transfer from alice to bob, got %+v", pending)
+	}
+	expired := handler.signConfirmation(confirmation{Operation: linkTransfer, UserID: "alice", Actor: "bob",
+		Link: "promo", ExpiresAt: time.Now().Add(-time.Minute).Unix()})
+	forged := handler.signConfirmation(confirmation{Operation: userDataDelete, UserID: "alice", Actor: "bob",
+		Link: "promo", ExpiresAt: time.Now().Add(time.Hour).Unix()})
+
+	tests := []struct {
+		name           string
+		token          string
+		query          string
+		body           string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{name: "Enlace ajeno", token: bobToken, body: `{"to": "bob"}`, expectedStatus: http.StatusForbidden,
+			expectedBody: `"error":"forbidden"`},
+		{name: "Sin receptor", token: aliceToken, body: `{}`, expectedStatus: http.StatusBadRequest,
+			expectedBody: `"field":"to"`},
+		{name: "Confirmado por otro usuario", token: carolToken, query: "?confirm=" + pending.ConfirmationToken,
+			expectedStatus: http.StatusForbidden, expectedBody: `"error":"invalid_confirmation"`},
+		{name: "Confirmado por quien lo pide", token: aliceToken, query: "?confirm=" + pending.ConfirmationToken,
+			expectedStatus: http.StatusForbidden, expectedBody: `"error":"invalid_confirmation"`},
+		{name: "Token de otra operación", token: bobToken, query: "?confirm=" + forged,
+			expectedStatus: http.StatusForbidden, expectedBody: `"error":"invalid_confirmation"`},
+		{name: "Token expirado", token: bobToken, query: "?confirm=" + expired,
+			expectedStatus: http.StatusForbidden, expectedBody: "expirado"},
+		{name: "Aceptado por el receptor", token: bobToken, query: "?confirm=" + pending.ConfirmationToken,
+			expectedStatus: http.StatusOK, expectedBody: `"owner":"bob"`},
+		{name: "Confirmación repetida", token: bobToken, query: "?confirm=" + pending.ConfirmationToken,
+			expectedStatus: http.StatusForbidden, expectedBody: `"error":"invalid_confirmation"`},
+		{name: "Antiguo propietario", token: aliceToken, body: `{"to": "carol"}`, expectedStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := send(tt.token, tt.query, tt.body)
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if !strings.Contains(rr.Body.String(), tt.expectedBody) {
+				t.Errorf("Expected body to contain %q, got %s", tt.expectedBody, rr.Body.String())
+			}
+		})
+	}
+
+	// El propietario retira la oferta y su token deja de servir
+	var offer TransferResponse
+	json.NewDecoder(send(bobToken, "", `{"to": "carol"}`).Body).Decode(&offer)
+	cancel := httptest.NewRequest(http.MethodDelete, "/api/urls/promo/transfer", nil)
+	cancel.Header.Set("Authorization", "Bearer "+bobToken)
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, cancel)
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusNoContent, rr.Code, rr.Body.String())
+	}
+	if rr := send(carolToken, "?confirm="+offer.ConfirmationToken, ""); rr.Code != http.StatusForbidden {
+		t.Errorf("Expected a withdrawn transfer to be rejected, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestHandler_BatchUpdateURLs(t *testing.T) {
+	store := shortener.NewStore()
+	service := shortener.NewService(store)
+	handler := NewHandler(service, WithMaxBatchSize(3))
+	tokens := auth.NewTokenManager([]byte("secreto-de-prueba"), time.Hour)
+
+	r := chi.NewRouter()
+	r.Use(Authenticate(tokens))
+	r.Route("/api", func(r chi.Router) {
+		r.Use(RequireAuth)
+		r.Post("/urls:batchUpdate", handler.BatchUpdateURLs)
+		r.Post("/urls:batchDelete", handler.BatchDeleteURLs)
+	})
+
+	for _, code := range []string{"promo1", "promo2"} {
+		store.SaveLink(context.Background(), shortener.Link{ShortCode: code, LongURL: "https://www.example.com/" + code, Owner: "alice"})
+	}
+	store.SaveLink(context.Background(), shortener.Link{ShortCode: "ajeno", LongURL: "https://www.example.com/ajeno", Owner: "bob"})
+	aliceToken, _ := tokens.Issue("alice", auth.RoleUser)
+
+	tests := []struct {
+		name           string
+		path           string
+		body           string
+		expectedStatus int
+		expectedBody   []string
+	}{
+		{name: "Lote vacío", path: "/api/urls:batchUpdate", body: `{"short_codes": [], "tags": ["q4"]}`,
+			expectedStatus: http.StatusBadRequest, expectedBody: []string{`"error":"empty_batch"`}},
+		{name: "Lote demasiado grande", path: "/api/urls:batchDelete", body: `{"short_codes": ["a", "b", "c", "d"]}`,
+			expectedStatus: http.StatusRequestEntityTooLarge, expectedBody: []string{`"error":"batch_too_large"`}},
+		{name: "Sin cambios", path: "/api/urls:batchUpdate", body: `{"short_codes": ["promo1"]}`,
+			expectedStatus: http.StatusBadRequest, expectedBody: []string{`"field":"changes"`}},
+		{name: "Tipo de redirección inválido", path: "/api/urls:batchUpdate", body: `{"short_codes": ["promo1"], "redirect_type": "found"}`,
+			expectedStatus: http.StatusBadRequest, expectedBody: []string{`"field":"redirect_type"`}},
+		{name: "Actualización parcial", path: "/api/urls:batchUpdate",
+			body:           `{"short_codes": ["promo1", "promo2", "ajeno"], "tags": ["q4"], "expires_at": "2099-01-01T00:00:00Z", "redirect_type": "permanent"}`,
+			expectedStatus: http.StatusOK,
+			expectedBody: []string{`"succeeded":2`, `"failed":1`, `"tags":["q4"]`, `"redirect_type":"permanent"`,
+				`"expires_at":"2099-01-01T00:00:00Z"`, `{"short_code":"ajeno","updated":false,"error":{"error":"forbidden"`}},
+		{name: "Eliminación parcial", path: "/api/urls:batchDelete", body: `{"short_codes": ["promo1", "no-existe"]}`,
+			expectedStatus: http.StatusOK,
+			expectedBody:   []string{`"succeeded":1`, `{"short_code":"promo1","deleted":true}`, `"error":{"error":"not_found"`}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", "Bearer "+aliceToken)
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+			for _, expected := range tt.expectedBody {
+				if !strings.Contains(rr.Body.String(), expected) {
+					t.Errorf("Expected body to contain %q, got %s", expected, rr.Body.String())
+				}
+			}
+		})
+	}
+
+	if link, _ := service.GetLink(context.Background(), "ajeno"); len(link.Tags) != 0 || link.PermanentRedirect() {
+		t.Errorf("Expected the foreign link untouched, got %+v", link)
+	}
+}
+
+func TestReserveRoutes(t *testing.T) {
+	admin := chi.NewRouter()
+	admin.Get("/", func(w http.ResponseWriter, r *http.Request) {})
+
+	r := chi.NewRouter()
+	r.Post("/shorten", func(w http.ResponseWriter, r *http.Request) {})
+	r.Route("/api", func(r chi.Router) {
+		r.Get("/urls/{short_code}", func(w http.ResponseWriter, r *http.Request) {})
+	})
+	r.Mount("/panel", admin)
+	r.Get("/robots.txt", func(w http.ResponseWriter, r *http.Request) {})
+	r.Get("/{short_code}", func(w http.ResponseWriter, r *http.Request) {})
+	r.Get("/t/{tenant}/{short_code}", func(w http.ResponseWriter, r *http.Request) {})
+
+	routes := shortener.NewRouteRegistry()
+	if err := ReserveRoutes(r, routes); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got, want := strings.Join(routes.Segments(), ","), "api,panel,robots.txt,shorten,t"; got != want {
+		t.Errorf("Expected reserved segments %s, got %s", want, got)
+	}
+
+	service := shortener.NewService(shortener.NewStore(), shortener.WithCodeFilter(shortener.NewCodeFilter(nil, nil).WithRoutes(routes)))
+	if _, _, err := service.Shorten(context.Background(), shortener.ShortenInput{LongURL: "https://www.example.com", Alias: "panel"}); errcode.Of(err) != errcode.AliasNotAllowed {
+		t.Errorf("Expected the mounted route to reserve its alias, got %v", err)
+	}
+}
+
+func TestHandler_SignedURLs(t *testing.T) {
+	store := shortener.NewStore()
+	service := shortener.NewService(store, shortener.WithURLSigning([]byte("clave-de-firma")))
+	handler := NewHandler(service)
+	tokens := auth.NewTokenManager([]byte("secreto-de-prueba"), time.Hour)
+
+	r := chi.NewRouter()
+	r.Use(Authenticate(tokens))
+	r.Get("/{short_code}", handler.RedirectURL)
+	r.Get("/api/urls/{short_code}", handler.PreviewURL)
+	r.Route("/api", func(r chi.Router) {
+		r.Use(RequireAuth)
+		r.Post("/urls/{short_code}/sign", handler.SignURL)
+	})
+
+	store.SaveLink(context.Background(), shortener.Link{ShortCode: "informe", LongURL: "https://www.example.com/informe",
+		Owner: "alice", Signed: true})
+	aliceToken, _ := tokens.Issue("alice", auth.RoleUser)
+	bobToken, _ := tokens.Issue("bob", auth.RoleUser)
+
+	sign := func(token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/urls/informe/sign", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+	if rr := sign(bobToken, `{"ttl_seconds": 3600}`); rr.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d signing another user's link, got %d", http.StatusForbidden, rr.Code)
+	}
+	if rr := sign(aliceToken, `{"expires_at": "2020-01-01T00:00:00Z"}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d with past expiry, got %d", http.StatusBadRequest, rr.Code)
+	}
+	rr := sign(aliceToken, `{"ttl_seconds": 3600}`)
+	var signed SignedURLResponse
+	if err := json.NewDecoder(rr.Body).Decode(&signed); err != nil || rr.Code != http.StatusOK || signed.ExpiresAt == nil {
+		t.Fatalf("Expected signed URL, got %d %+v (%v)", rr.Code, signed, err)
+	}
+	signedURL, _ := url.Parse(signed.SignedURL)
+
+	tests := []struct {
+		name           string
+		path           string
+		expectedStatus int
+		expectedError  string
+	}{
+		{name: "URL firmada", path: signedURL.RequestURI(), expectedStatus: http.StatusTemporaryRedirect},
+		{name: "Sin firma", path: "/informe", expectedStatus: http.StatusForbidden, expectedError: "signature_required"},
+		{name: "Firma alterada", path: "/informe?" + strings.Replace(signedURL.RawQuery, "sig=", "sig=x", 1),
+			expectedStatus: http.StatusForbidden, expectedError: "invalid_signature"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if tt.expectedError != "" {
+				var response ErrorResponse
+				json.NewDecoder(rr.Body).Decode(&response)
+				if string(response.Error) != tt.expectedError {
+					t.Errorf("Expected error %q, got %q", tt.expectedError, response.Error)
+				}
+			} else if location := rr.Header().Get("Location"); location != "https://www.example.com/informe" {
+				t.Errorf("Expected redirect without signature, got %q", location)
+			}
+		})
+	}
+
+	// La vista previa pública no revela el destino de un enlace firmado
+	req := httptest.NewRequest(http.MethodGet, "/api/urls/informe", nil)
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	var preview PreviewResponse
+	json.NewDecoder(rr.Body).Decode(&preview)
+	if !preview.Signed || preview.LongURL != "" {
+		t.Errorf("Expected preview to hide the destination, got %+v", preview)
+	}
+}
+
+func TestHandler_Tags(t *testing.T) {
+	store := shortener.NewStore()
+	service := shortener.NewService(store)
+	handler := NewHandler(service)
+	tokens := auth.NewTokenManager([]byte("secreto-de-prueba"), time.Hour)
+
+	r := chi.NewRouter()
+	r.Use(Authenticate(tokens))
+	r.Post("/shorten", handler.ShortenURL)
+	r.Route("/api", func(r chi.Router) {
+		r.Use(RequireAuth)
+		r.Get("/urls", handler.ListURLs)
+		r.Patch("/urls/{short_code}/tags", handler.UpdateTags)
+		r.Get("/tags", handler.ListTags)
+	})
+
+	store.SaveLink(context.Background(), shortener.Link{ShortCode: "otro", LongURL: "https://www.example.com/otro", Owner: "bob", Clicks: 4, BotClicks: 1, Tags: []string{"newsletter"}})
+	aliceToken, _ := tokens.Issue("alice", auth.RoleUser)
+	bobToken, _ := tokens.Issue("bob", auth.RoleUser)
+	adminToken, _ := tokens.Issue("root", auth.RoleAdmin)
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		token          string
+		body           string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{name: "Crear con etiquetas", method: http.MethodPost, path: "/shorten", token: aliceToken,
+			body: `{"long_url": "https://www.example.com/promo", "alias": "promo", "tags": ["Newsletter", "q3-campaign"]}`, expectedStatus: http.StatusCreated},
+		{name: "Crear con etiqueta inválida", method: http.MethodPost, path: "/shorten", token: aliceToken,
+			body: `{"long_url": "https://www.example.com/otra", "tags": ["con espacio"]}`, expectedStatus: http.StatusBadRequest, expectedBody: `"field":"tags"`},
+		{name: "Listado por etiqueta", method: http.MethodGet, path: "/api/urls?filter=tag:newsletter", token: aliceToken,
+			expectedStatus: http.StatusOK, expectedBody: `"tags":["newsletter","q3-campaign"]`},
+		{name: "Filtro de etiqueta inválido", method: http.MethodGet, path: "/api/urls?filter=tag:a.b", token: aliceToken, expectedStatus: http.StatusBadRequest},
+		{name: "Estadísticas del usuario", method: http.MethodGet, path: "/api/tags", token: aliceToken,
+			expectedStatus: http.StatusOK, expectedBody: `{"tags":[{"tag":"newsletter","links":1,"clicks":0,"bot_clicks":0},{"tag":"q3-campaign","links":1,"clicks":0,"bot_clicks":0}]}`},
+		{name: "Estadísticas del admin", method: http.MethodGet, path: "/api/tags", token: adminToken,
+			expectedStatus: http.StatusOK, expectedBody: `{"tag":"newsletter","links":2,"clicks":4,"bot_clicks":1}`},
+		{name: "Etiquetar enlace ajeno", method: http.MethodPatch, path: "/api/urls/promo/tags", token: bobToken,
+			body: `{"tags": ["x"]}`, expectedStatus: http.StatusForbidden},
+		{name: "Cuerpo inválido", method: http.MethodPatch, path: "/api/urls/promo/tags", token: aliceToken,
+			body: `{"tags": "x"}`, expectedStatus: http.StatusBadRequest},
+		{name: "Reemplazar etiquetas", method: http.MethodPatch, path: "/api/urls/promo/tags", token: aliceToken,
+			body: `{"tags": ["ventas"]}`, expectedStatus: http.StatusOK, expectedBody: `"tags":["ventas"]`},
+		{name: "Etiqueta reemplazada", method: http.MethodGet, path: "/api/urls?filter=tag:newsletter", token: aliceToken,
+			expectedStatus: http.StatusOK, expectedBody: `"total":0`},
+		{name: "Enlace inexistente", method: http.MethodPatch, path: "/api/urls/nada/tags", token: aliceToken,
+			body: `{"tags": []}`, expectedStatus: http.StatusNotFound},
+		{name: "Sin token", method: http.MethodGet, path: "/api/tags", expectedStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if !strings.Contains(rr.Body.String(), tt.expectedBody) {
+				t.Errorf("Expected body to contain %q, got %s", tt.expectedBody, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestHandler_SummaryReport(t *testing.T) {
+	ctx := context.Background()
+	aggregator := analytics.NewAggregator(30 * 24 * time.Hour)
+	service := shortener.NewService(shortener.NewStore(), shortener.WithEventListener(shortener.EventListenerFunc(aggregator.Record)))
+	handler := NewHandler(service, WithSummaryReports(aggregator), WithCountryHeader("CF-IPCountry"))
+	tokens := auth.NewTokenManager([]byte("secreto-de-prueba"), time.Hour)
+
+	r := chi.NewRouter()
+	r.Use(Authenticate(tokens))
+	r.Get("/{short_code}", handler.RedirectURL)
+	r.With(RequireAuth).Get("/api/reports/summary", handler.SummaryReport)
+
+	alice, _, _ := service.Shorten(ctx, shortener.ShortenInput{LongURL: "https://www.example.com/alice", Owner: "alice"})
+	bob, _, _ := service.Shorten(ctx, shortener.ShortenInput{LongURL: "https://www.example.com/bob", Owner: "bob"})
+	visit := func(code, referer, country string) {
+		req := httptest.NewRequest(http.MethodGet, "/"+code, nil)
+		req.Header.Set("User-Agent", "Mozilla/5.0 (X11; Linux x86_64) Firefox/126.0")
+		req.Header.Set("Referer", referer)
+		req.Header.Set("CF-IPCountry", country)
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	visit(alice.ShortCode, "https://news.example/", "ES")
+	visit(alice.ShortCode, "https://news.example/otra", "MX")
+	visit(bob.ShortCode, "", "ES")
+	aliceToken, _ := tokens.Issue("alice", auth.RoleUser)
+	adminToken, _ := tokens.Issue("admin", auth.RoleAdmin)
+
+	tests := []struct {
+		name           string
+		path           string
+		token          string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{name: "Resumen de todos", path: "/api/reports/summary", token: adminToken, expectedStatus: http.StatusOK,
+			expectedBody: `"period":"7d"`},
+		{name: "Resumen de todos con clasificaciones", path: "/api/reports/summary?period=30d", token: adminToken, expectedStatus: http.StatusOK,
+			expectedBody: `"clicks":3,"bot_clicks":0,"new_links":2,"top_links":[{"short_code":"` + alice.ShortCode + `","owner":"alice","clicks":2},` +
+				`{"short_code":"` + bob.ShortCode + `","owner":"bob","clicks":1}],"top_referrers":[{"referrer":"news.example","clicks":2}],` +
+				`"top_countries":[{"country":"ES","clicks":2},{"country":"MX","clicks":1}]`},
+		{name: "Resumen propio", path: "/api/reports/summary?period=1d", token: aliceToken, expectedStatus: http.StatusOK,
+			expectedBody: `"clicks":2,"bot_clicks":0,"new_links":1`},
+		{name: "Resumen de otro usuario", path: "/api/reports/summary?owner=bob", token: aliceToken,
+			expectedStatus: http.StatusForbidden, expectedBody: `"error":"forbidden"`},
+		{name: "Periodo sin sufijo", path: "/api/reports/summary?period=7", token: adminToken,
+			expectedStatus: http.StatusBadRequest, expectedBody: `"field":"period"`},
+		{name: "Periodo mayor que la retención", path: "/api/reports/summary?period=31d", token: adminToken,
+			expectedStatus: http.StatusBadRequest, expectedBody: `entre 1d y 30d`},
+		{name: "Sin token", path: "/api/reports/summary", expectedStatus: http.StatusUnauthorized, expectedBody: `"error":"unauthorized"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if !strings.Contains(rr.Body.String(), tt.expectedBody) {
+				t.Errorf("Expected body to contain %q, got %s", tt.expectedBody, rr.Body.String())
+			}
+		})
+	}
+
+	t.Run("Informes deshabilitados", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		NewHandler(service).SummaryReport(rr, httptest.NewRequest(http.MethodGet, "/api/reports/summary", nil))
+		if rr.Code != http.StatusNotFound || !strings.Contains(rr.Body.String(), `"error":"reports_disabled"`) {
+			t.Errorf("Expected 404 reports_disabled, got %d: %s", rr.Code, rr.Body.String())
+		}
+	})
+}
+
+func TestHandler_Stats(t *testing.T) {
+	ctx := context.Background()
+	service := shortener.NewService(shortener.NewStore())
+	handler := NewHandler(service)
+	tokens := auth.NewTokenManager([]byte("secreto-de-prueba"), time.Hour)
+
+	r := chi.NewRouter()
+	r.Use(Authenticate(tokens))
+	r.Get("/{short_code}", handler.RedirectURL)
+	r.With(RequireAuth, RequireAdmin).Get("/api/stats", handler.Stats)
+
+	link, _, _ := service.Shorten(ctx, shortener.ShortenInput{LongURL: "https://www.example.com/activo"})
+	disabled, _, _ := service.Shorten(ctx, shortener.ShortenInput{LongURL: "https://www.example.com/desactivado"})
+	service.DisableURL(ctx, shortener.Actor{UserID: "admin", Admin: true}, disabled.ShortCode, "Revisión")
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/"+link.ShortCode, nil))
+	userToken, _ := tokens.Issue("alice", auth.RoleUser)
+	adminToken, _ := tokens.Issue("admin", auth.RoleAdmin)
+
+	tests := []struct {
+		name           string
+		token          string
+		expectedStatus int
+		expectedBody   []string
+	}{
+		{name: "Administrador", token: adminToken, expectedStatus: http.StatusOK, expectedBody: []string{
+			`{"total_links":2,"active_links":1,"expired_links":0,"disabled_links":1,"broken_links":0,"clicks_today":1,` +
+				`"store":{"backend":"memory","links":2,"capacity":0,"evictions":0,"memory":{"bytes":`,
+			`"reclaimable_bytes":0,"reclaimable":0,"peak_links":2}},` +
+				`"code_generation":{"generated":2,"retries":0,"warnings":0,"saturated":0}}`,
+		}},
+		{name: "Usuario sin permisos", token: userToken, expectedStatus: http.StatusForbidden, expectedBody: []string{`"error":"forbidden"`}},
+		{name: "Sin token", expectedStatus: http.StatusUnauthorized, expectedBody: []string{`"error":"unauthorized"`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/stats", nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+			for _, expected := range tt.expectedBody {
+				if !strings.Contains(rr.Body.String(), expected) {
+					t.Errorf("Expected body to contain %q, got %s", expected, rr.Body.String())
+				}
+			}
+		})
+	}
+}
+
+func TestHandler_ExportLinkEvents(t *testing.T) {
+	ctx := context.Background()
+	aggregator := analytics.NewAggregator(30 * 24 * time.Hour)
+	service := shortener.NewService(shortener.NewStore(), shortener.WithEventListener(shortener.EventListenerFunc(aggregator.Record)))
+	handler := NewHandler(service, WithSummaryReports(aggregator), WithCountryHeader("CF-IPCountry"))
+	tokens := auth.NewTokenManager([]byte("secreto-de-prueba"), time.Hour)
+
+	r := chi.NewRouter()
+	r.Use(Authenticate(tokens))
+	r.Get("/{short_code}", handler.RedirectURL)
+	r.With(RequireAuth).Get("/api/urls/{short_code}/events/export", handler.ExportLinkEvents)
+
+	link, _, _ := service.Shorten(ctx, shortener.ShortenInput{LongURL: "https://www.example.com/alice", Owner: "alice"})
+	for _, ua := range []string{"Mozilla/5.0 (X11; Linux x86_64) Firefox/126.0", "curl/8.5.0"} {
+		req := httptest.NewRequest(http.MethodGet, "/"+link.ShortCode, nil)
+		req.Header.Set("User-Agent", ua)
+		req.Header.Set("Referer", "https://news.example/")
+		req.Header.Set("CF-IPCountry", "ES")
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	aliceToken, _ := tokens.Issue("alice", auth.RoleUser)
+	bobToken, _ := tokens.Issue("bob", auth.RoleUser)
+	path := "/api/urls/" + link.ShortCode + "/events/export"
+	today := time.Now().UTC().Format(time.DateOnly)
+
+	tests := []struct {
+		name                string
+		query               string
+		token               string
+		expectedStatus      int
+		expectedContentType string
+		expectedBody        []string
+	}{
+		{name: "Visitas en CSV", token: aliceToken, expectedStatus: http.StatusOK, expectedContentType: "text/csv; charset=utf-8",
+			expectedBody: []string{"time,short_code,variant,bot,referrer,country\n", "," + link.ShortCode + ",,false,news.example,ES\n",
+				"," + link.ShortCode + ",,true,news.example,ES\n"}},
+		{name: "Visitas por día", query: "?aggregate=day&from=" + today, token: aliceToken, expectedStatus: http.StatusOK,
+			expectedContentType: "text/csv; charset=utf-8",
+			expectedBody:        []string{"day,short_code,clicks,bot_clicks\n" + today + "," + link.ShortCode + ",2,1\n"}},
+		{name: "Visitas en Parquet", query: "?format=parquet", token: aliceToken, expectedStatus: http.StatusOK,
+			expectedContentType: ParquetContentType, expectedBody: []string{"PAR1", "news.example"}},
+		{name: "Periodo sin visitas", query: "?to=2000-01-01", token: aliceToken, expectedStatus: http.StatusOK,
+			expectedContentType: "text/csv; charset=utf-8", expectedBody: []string{"time,short_code,variant,bot,referrer,country\n"}},
+		{name: "Enlace de otro usuario", token: bobToken, expectedStatus: http.StatusForbidden, expectedBody: []string{`"error":"forbidden"`}},
+		{name: "Formato desconocido", query: "?format=xlsx", token: aliceToken, expectedStatus: http.StatusBadRequest,
+			expectedBody: []string{`"error":"invalid_format"`}},
+		{name: "Periodo invertido", query: "?from=2024-02-01&to=2024-01-01", token: aliceToken, expectedStatus: http.StatusBadRequest,
+			expectedBody: []string{`"field":"to"`}},
+		{name: "Fecha inválida", query: "?from=ayer", token: aliceToken, expectedStatus: http.StatusBadRequest,
+			expectedBody: []string{`"field":"from"`}},
+		{name: "Agregación desconocida", query: "?aggregate=hour", token: aliceToken, expectedStatus: http.StatusBadRequest,
+			expectedBody: []string{`"field":"aggregate"`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, path+tt.query, nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if tt.expectedContentType != "" && rr.Header().Get("Content-Type") != tt.expectedContentType {
+				t.Errorf("Expected Content-Type %q, got %q", tt.expectedContentType, rr.Header().Get("Content-Type"))
+			}
+			for _, expected := range tt.expectedBody {
+				if !strings.Contains(rr.Body.String(), expected) {
+					t.Errorf("Expected body to contain %q, got %q", expected, rr.Body.String())
+				}
+			}
+		})
+	}
+}
+
+func TestHandler_UserData(t *testing.T) {
+	ctx := context.Background()
+	store := shortener.NewStore()
+	service := shortener.NewService(store)
+	tracker := analytics.NewTracker(time.Minute)
+	handler := NewHandler(service, WithLiveAnalytics(tracker, time.Second),
+		WithUserDataConfirmation([]byte("secreto-de-prueba"), time.Minute))
+	tokens := auth.NewTokenManager([]byte("secreto-de-prueba"), time.Hour)
+
+	r := chi.NewRouter()
+	r.Use(Authenticate(tokens))
+	r.Route("/api", func(r chi.Router) {
+		r.Use(RequireAuth)
+		r.Get("/users/{id}/export", handler.ExportUserData)
+		r.Delete("/users/{id}/data", handler.DeleteUserData)
+	})
+
+	link, _, _ := service.Shorten(ctx, shortener.ShortenInput{LongURL: "https://www.example.com/alice", Owner: "alice"})
+	service.Shorten(ctx, shortener.ShortenInput{LongURL: "https://www.example.com/bob", Owner: "bob"})
+	tracker.Record(shortener.Event{Type: shortener.EventClicked, Link: link, Visitor: "v1"})
+	aliceToken, _ := tokens.Issue("alice", auth.RoleUser)
+	bobToken, _ := tokens.Issue("bob", auth.RoleUser)
+
+	do := func(method, path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+	confirm := func(method, path, token string) string {
+		rr := do(method, path, token)
+		var confirmation UserDataConfirmationResponse
+		json.NewDecoder(rr.Body).Decode(&confirmation)
+		if rr.Code != http.StatusAccepted || confirmation.ConfirmationToken == "" || confirmation.Links != 1 || confirmation.AuditEntries != 1 {
+			t.Fatalf("Expected a confirmation covering 1 link and 1 audit entry, got %d %+v", rr.Code, confirmation)
+		}
+		return confirmation.ConfirmationToken
+	}
+
+	exportToken := confirm(http.MethodGet, "/api/users/alice/export", aliceToken)
+	deleteToken := confirm(http.MethodDelete, "/api/users/alice/data", aliceToken)
+	// El token firmado con otra clave no es válido
+	foreign := NewHandler(service).signConfirmation(confirmation{Operation: userDataDelete, UserID: "alice", Actor: "alice",
+		ExpiresAt: time.Now().Add(time.Minute).Unix()})
+	expired := handler.signConfirmation(confirmation{Operation: userDataDelete, UserID: "alice", Actor: "alice",
+		ExpiresAt: time.Now().Add(-time.Second).Unix()})
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		token          string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{name: "Datos de otro usuario", method: http.MethodGet, path: "/api/users/alice/export", token: bobToken,
+			expectedStatus: http.StatusForbidden, expectedBody: `"error":"forbidden"`},
+		{name: "Token de otra operación", method: http.MethodDelete, path: "/api/users/alice/data?confirm=" + exportToken, token: aliceToken,
+			expectedStatus: http.StatusForbidden, expectedBody: `"error":"invalid_confirmation"`},
+		{name: "Token de otra clave", method: http.MethodDelete, path: "/api/users/alice/data?confirm=" + foreign, token: aliceToken,
+			expectedStatus: http.StatusForbidden, expectedBody: `"error":"invalid_confirmation"`},
+		{name: "Token expirado", method: http.MethodDelete, path: "/api/users/alice/data?confirm=" + expired, token: aliceToken,
+			expectedStatus: http.StatusForbidden, expectedBody: `"error":"invalid_confirmation"`},
+		{name: "Token pedido por otro", method: http.MethodDelete, path: "/api/users/bob/data?confirm=" + deleteToken, token: bobToken,
+			expectedStatus: http.StatusForbidden, expectedBody: `"error":"invalid_confirmation"`},
+		{name: "Exportación confirmada", method: http.MethodGet, path: "/api/users/alice/export?confirm=" + exportToken, token: aliceToken,
+			expectedStatus: http.StatusOK, expectedBody: `"live_analytics":[{"short_code":"` + link.ShortCode},
+		{name: "Borrado confirmado", method: http.MethodDelete, path: "/api/users/alice/data?confirm=" + deleteToken, token: aliceToken,
+			expectedStatus: http.StatusOK, expectedBody: `{"user_id":"alice","links":1,"collections":0,"audit_entries":1,"webhook_deliveries":0}`},
+		{name: "Exportación tras el borrado", method: http.MethodGet, path: "/api/users/alice/export?confirm=" + exportToken, token: aliceToken,
+			expectedStatus: http.StatusOK, expectedBody: `"links":[],"collections":[],"audit":[],"live_analytics":[]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := do(tt.method, tt.path, tt.token)
+			if rr.Code != tt.expectedStatus || !strings.Contains(rr.Body.String(), tt.expectedBody) {
+				t.Errorf("Expected %d with %s, got %d %s", tt.expectedStatus, tt.expectedBody, rr.Code, rr.Body.String())
+			}
+		})
+	}
+
+	if _, found, _ := store.GetLink(ctx, link.ShortCode); found {
+		t.Errorf("Expected alice's link to be deleted")
+	}
+}
+
+func TestHandler_UserDataSharedCode(t *testing.T) {
+	ctx := context.Background()
+	store := shortener.NewStore()
+	service := shortener.NewService(store)
+	tracker := analytics.NewTracker(time.Minute)
+	dispatcher := webhooks.NewDispatcher([]webhooks.Endpoint{{URL: "https://hooks.example.com/"}})
+	handler := NewHandler(service, WithLiveAnalytics(tracker, time.Second), WithWebhookLog(dispatcher),
+		WithUserDataConfirmation([]byte("secreto-de-prueba"), time.Minute))
+	tokens := auth.NewTokenManager([]byte("secreto-de-prueba"), time.Hour)
+
+	r := chi.NewRouter()
+	r.Use(Authenticate(tokens))
+	r.Route("/api", func(r chi.Router) {
+		r.Use(RequireAuth)
+		r.Get("/users/{id}/export", handler.ExportUserData)
+		r.Delete("/users/{id}/data", handler.DeleteUserData)
+	})
+
+	// El mismo código en dos tenants son enlaces distintos, de propietarios distintos
+	alice := shortener.Link{ShortCode: "promo", LongURL: "https://www.example.com/alice", Owner: "alice"}
+	carol := shortener.Link{ShortCode: "promo", LongURL: "https://www.example.com/carol", Owner: "carol", Tenant: "equipo-a"}
+	for _, link := range []shortener.Link{alice, carol} {
+		store.SaveLink(ctx, link)
+		event := shortener.Event{Type: shortener.EventClicked, Link: link, Visitor: "v1"}
+		tracker.Record(event)
+		dispatcher.HandleEvent(event)
+	}
+	aliceToken, _ := tokens.Issue("alice", auth.RoleUser)
+	carolToken, _ := tokens.Issue("carol", auth.RoleUser)
+
+	// confirmed pide el token de confirmación y repite la petición con él
+	confirmed := func(method, path, token string) *httptest.ResponseRecorder {
+		do := func(path string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(method, path, nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+			return rr
+		}
+		var confirmation UserDataConfirmationResponse
+		json.NewDecoder(do(path).Body).Decode(&confirmation)
+		return do(path + "?confirm=" + confirmation.ConfirmationToken)
+	}
+
+	var export UserDataExportResponse
+	json.NewDecoder(confirmed(http.MethodGet, "/api/users/carol/export", carolToken).Body).Decode(&export)
+	if len(export.WebhookDeliveries) != 1 || len(export.LiveAnalytics) != 1 || export.LiveAnalytics[0].Owner != "carol" {
+		t.Fatalf("Expected only carol's delivery and counters, got %+v %+v", export.WebhookDeliveries, export.LiveAnalytics)
+	}
+
+	rr := confirmed(http.MethodDelete, "/api/users/alice/data", aliceToken)
+	if expected := `"links":1,"collections":0,"audit_entries":0,"webhook_deliveries":1`; !strings.Contains(rr.Body.String(), expected) {
+		t.Errorf("Expected %s, got %d %s", expected, rr.Code, rr.Body.String())
+	}
+	if deliveries, total := dispatcher.Deliveries(webhooks.DeliveryQuery{}); total != 1 || deliveries[0].LinkKey != carol.Key() {
+		t.Errorf("Expected carol's delivery to be kept, got %+v", deliveries)
+	}
+	if counters := tracker.Snapshot(analytics.Filter{}); len(counters) != 1 || counters[0].Owner != "carol" {
+		t.Errorf("Expected carol's counters to be kept, got %+v", counters)
+	}
+}
+
+func TestHandler_Collections(t *testing.T) {
+	store := shortener.NewStore()
+	service := shortener.NewService(store)
+	handler := NewHandler(service)
+	tokens := auth.NewTokenManager([]byte("secreto-de-prueba"), time.Hour)
+
+	r := chi.NewRouter()
+	r.Use(Authenticate(tokens))
+	r.Route("/api", func(r chi.Router) {
+		r.Use(RequireAuth)
+		r.Get("/urls", handler.ListURLs)
+		r.Get("/collections", handler.ListCollections)
+		r.Post("/collections", handler.CreateCollection)
+		r.Patch("/collections/{id}", handler.RenameCollection)
+		r.Delete("/collections/{id}", handler.DeleteCollection)
+		r.Post("/collections/{id}/links", handler.AddCollectionLinks)
+		r.Post("/collections/{id}/links:remove", handler.RemoveCollectionLinks)
+	})
+
+	ctx := context.Background()
+	store.SaveLink(ctx, shortener.Link{ShortCode: "promo", LongURL: "https://www.example.com/promo", Owner: "alice", Clicks: 5})
+	store.SaveLink(ctx, shortener.Link{ShortCode: "blog", LongURL: "https://www.example.com/blog", Owner: "alice"})
+	store.SaveLink(ctx, shortener.Link{ShortCode: "otro", LongURL: "https://www.example.com/otro", Owner: "bob"})
+	aliceToken, _ := tokens.Issue("alice", auth.RoleUser)
+	bobToken, _ := tokens.Issue("bob", auth.RoleUser)
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		token          string
+		body           string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{name: "Crear colección", method: http.MethodPost, path: "/api/collections", token: aliceToken,
+			body: `{"name": "Otoño"}`, expectedStatus: http.StatusCreated, expectedBody: `"id":1,"name":"Otoño"`},
+		{name: "Nombre repetido", method: http.MethodPost, path: "/api/collections", token: aliceToken,
+			body: `{"name": "otoño"}`, expectedStatus: http.StatusConflict, expectedBody: `"error":"collection_exists"`},
+		{name: "Nombre vacío", method: http.MethodPost, path: "/api/collections", token: aliceToken,
+			body: `{"name": ""}`, expectedStatus: http.StatusBadRequest, expectedBody: `"field":"name"`},
+		{name: "Mover enlaces", method: http.MethodPost, path: "/api/collections/1/links", token: aliceToken,
+			body: `{"short_codes": ["promo", "otro"]}`, expectedStatus: http.StatusOK,
+			expectedBody: `{"results":[{"short_code":"promo","moved":true},{"short_code":"otro","moved":false,"error":{"error":"forbidden"`},
+		{name: "Mover sin códigos", method: http.MethodPost, path: "/api/collections/1/links", token: aliceToken,
+			body: `{"short_codes": []}`, expectedStatus: http.StatusBadRequest, expectedBody: `"error":"empty_batch"`},
+		{name: "Colección ajena", method: http.MethodPost, path: "/api/collections/1/links", token: bobToken,
+			body: `{"short_codes": ["otro"]}`, expectedStatus: http.StatusNotFound, expectedBody: `"error":"collection_not_found"`},
+		{name: "Listado por colección", method: http.MethodGet, path: "/api/urls?filter=collection_id:1", token: aliceToken,
+			expectedStatus: http.StatusOK, expectedBody: `"collection_id":1`},
+		{name: "Filtro de colección inválido", method: http.MethodGet, path: "/api/urls?filter=collection_id:x", token: aliceToken,
+			expectedStatus: http.StatusBadRequest, expectedBody: `"field":"filter"`},
+		{name: "Colecciones con totales", method: http.MethodGet, path: "/api/collections", token: aliceToken,
+			expectedStatus: http.StatusOK, expectedBody: `"links":1,"clicks":5`},
+		{name: "Otro usuario no las ve", method: http.MethodGet, path: "/api/collections", token: bobToken,
+			expectedStatus: http.StatusOK, expectedBody: `{"collections":[]}`},
+		{name: "Renombrar", method: http.MethodPatch, path: "/api/collections/1", token: aliceToken,
+			body: `{"name": "Invierno"}`, expectedStatus: http.StatusOK, expectedBody: `"name":"Invierno"`},
+		{name: "ID inválido", method: http.MethodPatch, path: "/api/collections/abc", token: aliceToken,
+			body: `{"name": "x"}`, expectedStatus: http.StatusNotFound},
+		{name: "Sacar enlaces", method: http.MethodPost, path: "/api/collections/1/links:remove", token: aliceToken,
+			body: `{"short_codes": ["promo"]}`, expectedStatus: http.StatusOK, expectedBody: `"moved":true`},
+		{name: "Colección vacía", method: http.MethodGet, path: "/api/urls?filter=collection_id:1", token: aliceToken,
+			expectedStatus: http.StatusOK, expectedBody: `"total":0`},
+		{name: "Eliminar ajena", method: http.MethodDelete, path: "/api/collections/1", token: bobToken, expectedStatus: http.StatusNotFound},
+		{name: "Eliminar", method: http.MethodDelete, path: "/api/collections/1", token: aliceToken, expectedStatus: http.StatusNoContent},
+		{name: "Eliminar de nuevo", method: http.MethodDelete, path: "/api/collections/1", token: aliceToken, expectedStatus: http.StatusNotFound},
+		{name: "Sin token", method: http.MethodGet, path: "/api/collections", expectedStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if !strings.Contains(rr.Body.String(), tt.expectedBody) {
+				t.Errorf("Expected body to contain %q, got %s", tt.expectedBody, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestHandler_AnomalyThrottle(t *testing.T) {
+	store := shortener.NewStore()
+	service := shortener.NewService(store, shortener.WithAnomalyDetection(shortener.AnomalyPolicy{
+		LinkClicks: 2, Action: shortener.AnomalyThrottle, ThrottleFor: time.Minute}))
+	handler := NewHandler(service)
+	store.SaveLink(context.Background(), shortener.Link{ShortCode: "viral", LongURL: "https://www.example.com/viral"})
+
+	r := chi.NewRouter()
+	r.Get("/{short_code}", handler.RedirectURL)
+
+	// La visita que supera el límite aún se sirve; las siguientes reciben 429
+	for i, expected := range []int{http.StatusTemporaryRedirect, http.StatusTemporaryRedirect, http.StatusTemporaryRedirect, http.StatusTooManyRequests} {
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/viral", nil))
+		if rr.Code != expected {
+			t.Fatalf("Visit %d: expected status %d, got %d", i, expected, rr.Code)
+		}
+		if expected != http.StatusTooManyRequests {
+			continue
+		}
+		if retryAfter, err := strconv.Atoi(rr.Header().Get("Retry-After")); err != nil || retryAfter < 1 || retryAfter > 60 {
+			t.Errorf("Expected Retry-After within the throttle, got %q", rr.Header().Get("Retry-After"))
+		}
+		var response ErrorResponse
+		if err := json.NewDecoder(rr.Body).Decode(&response); err != nil || response.Error != "link_throttled" {
+			t.Errorf("Expected link_throttled error, got %+v (%v)", response, err)
+		}
+	}
+}
+
+func TestHandler_Reports(t *testing.T) {
+	store := shortener.NewStore()
+	store.SaveLink(context.Background(), shortener.Link{ShortCode: "gratis", LongURL: "https://www.example.com/premio", Owner: "alice"})
+	service := shortener.NewService(store, shortener.WithQuarantineThreshold(2))
+	handler := NewHandler(service)
+	tokens := auth.NewTokenManager([]byte("secreto-de-prueba"), time.Hour)
+
+	r := chi.NewRouter()
+	r.Use(Authenticate(tokens))
+	r.Get("/{short_code}", handler.RedirectURL)
+	r.Post("/report/{short_code}", handler.ReportURL)
+	r.Route("/admin", func(r chi.Router) {
+		r.Use(RequireAuth, RequireAdmin)
+		r.Get("/reports", handler.ListReports)
+		r.Post("/reports/disable", handler.DisableReported)
+		r.Post("/reports/{short_code}:dismiss", handler.DismissReports)
+	})
+
+	adminToken, _ := tokens.Issue("root", auth.RoleAdmin)
+	userToken, _ := tokens.Issue("alice", auth.RoleUser)
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		token          string
+		remoteAddr     string
+		body           string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{name: "Motivo inválido", method: http.MethodPost, path: "/report/gratis", body: `{"reason": "feo"}`,
+			expectedStatus: http.StatusBadRequest, expectedBody: `"field":"reason"`},
+		{name: "Denunciar enlace inexistente", method: http.MethodPost, path: "/report/nada", body: `{"reason": "spam"}`, expectedStatus: http.StatusNotFound},
+		{name: "Primera denuncia", method: http.MethodPost, path: "/report/gratis", remoteAddr: "203.0.113.1:5000",
+			body: `{"reason": "phishing", "comment": "pide la contraseña del banco"}`, expectedStatus: http.StatusAccepted, expectedBody: `"status":"open"`},
+		{name: "Redirección sin cuarentena", method: http.MethodGet, path: "/gratis", expectedStatus: http.StatusTemporaryRedirect},
+		{name: "Segunda denuncia", method: http.MethodPost, path: "/report/gratis", remoteAddr: "203.0.113.2:5000",
+			body: `{"reason": "phishing"}`, expectedStatus: http.StatusAccepted},
+		{name: "Redirección en cuarentena", method: http.MethodGet, path: "/gratis", expectedStatus: http.StatusOK, expectedBody: "denunciado"},
+		{name: "Usuario sin permisos lista", method: http.MethodGet, path: "/admin/reports", token: userToken, expectedStatus: http.StatusForbidden},
+		{name: "Listar denuncias abiertas", method: http.MethodGet, path: "/admin/reports?status=open&short_code=gratis", token: adminToken,
+			expectedStatus: http.StatusOK, expectedBody: `"total":2`},
+		{name: "Estado desconocido", method: http.MethodGet, path: "/admin/reports?status=pendiente", token: adminToken, expectedStatus: http.StatusBadRequest},
+		{name: "Descartar denuncias", method: http.MethodPost, path: "/admin/reports/gratis:dismiss", token: adminToken, expectedStatus: http.StatusOK},
+		{name: "Redirección tras descartar", method: http.MethodGet, path: "/gratis", expectedStatus: http.StatusTemporaryRedirect},
+		{name: "Desactivación masiva vacía", method: http.MethodPost, path: "/admin/reports/disable", token: adminToken, body: `{"short_codes": []}`, expectedStatus: http.StatusBadRequest},
+		{name: "Desactivación masiva", method: http.MethodPost, path: "/admin/reports/disable", token: adminToken,
+			body: `{"short_codes": ["gratis", "nada"], "reason": "Phishing confirmado"}`, expectedStatus: http.StatusOK,
+			expectedBody: `{"results":[{"short_code":"gratis","disabled":true},{"short_code":"nada","disabled":false,"error":{"error":"not_found"`},
+		{name: "Redirección tras desactivar", method: http.MethodGet, path: "/gratis", expectedStatus: http.StatusGone, expectedBody: "Phishing confirmado"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.remoteAddr != "" {
+				req.RemoteAddr = tt.remoteAddr
+			}
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if !strings.Contains(rr.Body.String(), tt.expectedBody) {
+				t.Errorf("Expected body to contain %q, got %s", tt.expectedBody, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestHandler_BrokenLinks(t *testing.T) {
+	store := shortener.NewStore()
+	store.SaveLink(context.Background(), shortener.Link{ShortCode: "roto", LongURL: "https://www.example.com/roto", Owner: "alice",
+		Health: shortener.LinkHealth{CheckedAt: time.Now(), StatusCode: http.StatusNotFound, Failures: 3, FailingSince: time.Now().Add(-72 * time.Hour), Broken: true}})
+	store.SaveLink(context.Background(), shortener.Link{ShortCode: "sano", LongURL: "https://www.example.com/ok", Owner: "alice",
+		Health: shortener.LinkHealth{CheckedAt: time.Now(), StatusCode: http.StatusOK}})
+	handler := NewHandler(shortener.NewService(store))
+	tokens := auth.NewTokenManager([]byte("secreto-de-prueba"), time.Hour)
+
+	r := chi.NewRouter()
+	r.Use(Authenticate(tokens))
+	r.Route("/admin", func(r chi.Router) {
+		r.Use(RequireAuth, RequireAdmin)
+		r.Get("/broken-links", handler.BrokenLinks)
+	})
+
+	adminToken, _ := tokens.Issue("root", auth.RoleAdmin)
+	userToken, _ := tokens.Issue("alice", auth.RoleUser)
+
+	tests := []struct {
+		name           string
+		path           string
+		token          string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{name: "Sin autenticación", path: "/admin/broken-links", expectedStatus: http.StatusUnauthorized},
+		{name: "Usuario sin permisos", path: "/admin/broken-links", token: userToken, expectedStatus: http.StatusForbidden},
+		{name: "Listar enlaces rotos", path: "/admin/broken-links", token: adminToken, expectedStatus: http.StatusOK,
+			expectedBody: `{"links":[{"short_code":"roto","long_url":"https://www.example.com/roto","owner":"alice","status_code":404,`},
+		{name: "Filtrar por propietario", path: "/admin/broken-links?owner=bob", token: adminToken, expectedStatus: http.StatusOK,
+			expectedBody: `{"links":[],"total":0`},
+		{name: "Página inválida", path: "/admin/broken-links?page=0", token: adminToken, expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if !strings.Contains(rr.Body.String(), tt.expectedBody) {
+				t.Errorf("Expected body to contain %q, got %s", tt.expectedBody, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestHandler_LinkMetadata(t *testing.T) {
+	store := shortener.NewStore()
+	store.SaveLink(context.Background(), shortener.Link{ShortCode: "blog", LongURL: "https://www.example.com/blog", Owner: "alice"})
+	store.SaveLink(context.Background(), shortener.Link{ShortCode: "caido", LongURL: "https://www.example.com/caido", Owner: "alice"})
+	store.SaveLink(context.Background(), shortener.Link{ShortCode: "viejo", LongURL: "https://www.example.com/blog", ExpiresAt: time.Now().Add(-time.Hour)})
+	fetcher := shortener.MetadataFetcherFunc(func(ctx context.Context, rawURL string) (shortener.LinkMetadata, error) {
+		if rawURL == "https://www.example.com/caido" {
+			return shortener.LinkMetadata{}, fmt.Errorf("HTTP 503")
+		}
+		return shortener.LinkMetadata{Title: "Mi blog", Image: "https://www.example.com/logo.png"}, nil
+	})
+	handler := NewHandler(shortener.NewService(store, shortener.WithMetadataFetcher(fetcher, time.Hour, false)))
+	tokens := auth.NewTokenManager([]byte("secreto-de-prueba"), time.Hour)
+
+	r := chi.NewRouter()
+	r.Use(Authenticate(tokens))
+	r.Get("/api/urls/{short_code}/preview", handler.LinkMetadata)
+	bobToken, _ := tokens.Issue("bob", auth.RoleUser)
+	aliceToken, _ := tokens.Issue("alice", auth.RoleUser)
+
+	tests := []struct {
+		name           string
+		path           string
+		token          string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{name: "Metadatos del destino", path: "/api/urls/blog/preview", expectedStatus: http.StatusOK,
+			expectedBody: `"short_code":"blog","long_url":"https://www.example.com/blog","title":"Mi blog","image":"https://www.example.com/logo.png"`},
+		{name: "Destino sin respuesta", path: "/api/urls/caido/preview", expectedStatus: http.StatusBadGateway, expectedBody: `"error":"metadata_unavailable"`},
+		{name: "Enlace expirado", path: "/api/urls/viejo/preview", expectedStatus: http.StatusGone},
+		{name: "Código inexistente", path: "/api/urls/nada/preview", expectedStatus: http.StatusNotFound},
+		{name: "Refrescar enlace ajeno", path: "/api/urls/blog/preview?refresh=true", token: bobToken, expectedStatus: http.StatusForbidden},
+		{name: "Refrescar enlace propio", path: "/api/urls/blog/preview?refresh=true", token: aliceToken, expectedStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if !strings.Contains(rr.Body.String(), tt.expectedBody) {
+				t.Errorf("Expected body to contain %q, got %s", tt.expectedBody, rr.Body.String())
+			}
+		})
+	}
+
+	t.Run("Sin vista previa enriquecida", func(t *testing.T) {
+		r := chi.NewRouter()
+		r.Get("/api/urls/{short_code}/preview", NewHandler(shortener.NewService(store)).LinkMetadata)
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/urls/blog/preview", nil))
+		if rr.Code != http.StatusNotFound || !strings.Contains(rr.Body.String(), "metadata_disabled") {
+			t.Errorf("Expected 404 metadata_disabled, got %d: %s", rr.Code, rr.Body.String())
+		}
+	})
+}
+
+func TestHandler_RedirectRules(t *testing.T) {
+	service := shortener.NewService(shortener.NewStore())
+	handler := NewHandler(service)
+
+	r := chi.NewRouter()
+	r.Post("/shorten", handler.ShortenURL)
+	r.Get("/{short_code}", handler.RedirectURL)
+
+	create := func(body string) string {
+		req := httptest.NewRequest(http.MethodPost, "/shorten", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("Expected status %d creating link, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
+		}
+		var response ShortenResponse
+		json.NewDecoder(rr.Body).Decode(&response)
+		return response.ShortURL[strings.LastIndex(response.ShortURL, "/")+1:]
+	}
+
+	forwarding := create(`{"long_url": "https://www.example.com/promo?lang=es", "forward_query": true}`)
+	plain := create(`{"long_url": "https://www.example.com/promo?lang=es"}`)
+	tagged := create(`{"long_url": "https://www.example.com/promo", "alias": "promo-utm", "utm": {"source": "newsletter", "medium": "email", "campaign": "{code}"}}`)
+
+	tests := []struct {
+		name             string
+		path             string
+		expectedLocation string
+	}{
+		{"Reenvía la query de la campaña", "/" + forwarding + "?utm_campaign=otono", "https://www.example.com/promo?lang=es&utm_campaign=otono"},
+		{"Sin reenvío ignora la query", "/" + plain + "?utm_campaign=otono", "https://www.example.com/promo?lang=es"},
+		{"Parámetros UTM del enlace", "/" + tagged, "https://www.example.com/promo?utm_source=newsletter&utm_medium=email&utm_campaign=promo-utm"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+			if rr.Code != http.StatusTemporaryRedirect {
+				t.Fatalf("Expected status %d, got %d", http.StatusTemporaryRedirect, rr.Code)
+			}
+			if location := rr.Header().Get("Location"); location != tt.expectedLocation {
+				t.Errorf("Expected Location %s, got %s", tt.expectedLocation, location)
+			}
+		})
+	}
+
+	r.Post("/{short_code}", handler.RedirectURL)
+	r.Get("/{short_code}+", handler.PreviewURL)
+	protected := create(`{"long_url": "https://www.example.com/privado", "password": "abre-sesamo"}`)
+
+	passwordTests := []struct {
+		name             string
+		method           string
+		path             string
+		header           http.Header
+		body             string
+		expectedStatus   int
+		expectedLocation string
+		expectedBody     string
+	}{
+		{name: "JSON sin contraseña", method: http.MethodGet, path: "/" + protected, expectedStatus: http.StatusUnauthorized, expectedBody: "password_required"},
+		{name: "Navegador recibe el formulario", method: http.MethodGet, path: "/" + protected, header: http.Header{"Accept": {"text/html"}}, expectedStatus: http.StatusUnauthorized, expectedBody: `<form method="post"`},
+		{name: "Contraseña incorrecta por cabecera", method: http.MethodGet, path: "/" + protected, header: http.Header{LinkPasswordHeader: {"otra"}}, expectedStatus: http.StatusForbidden, expectedBody: "invalid_password"},
+		{name: "Contraseña por cabecera", method: http.MethodGet, path: "/" + protected, header: http.Header{LinkPasswordHeader: {"abre-sesamo"}}, expectedStatus: http.StatusTemporaryRedirect, expectedLocation: "https://www.example.com/privado"},
+		{name: "Contraseña por query", method: http.MethodGet, path: "/" + protected + "?key=abre-sesamo", expectedStatus: http.StatusTemporaryRedirect, expectedLocation: "https://www.example.com/privado"},
+		{name: "Formulario correcto", method: http.MethodPost, path: "/" + protected, header: http.Header{"Content-Type": {"application/x-www-form-urlencoded"}}, body: "password=abre-sesamo", expectedStatus: http.StatusSeeOther, expectedLocation: "https://www.example.com/privado"},
+		{name: "Formulario incorrecto", method: http.MethodPost, path: "/" + protected, header: http.Header{"Content-Type": {"application/x-www-form-urlencoded"}, "Accept": {"text/html"}}, body: "password=nop", expectedStatus: http.StatusForbidden, expectedBody: "La contraseña no es correcta"},
+		{name: "La vista previa oculta el destino", method: http.MethodGet, path: "/" + protected + "+", expectedStatus: http.StatusOK, expectedBody: `"password_protected":true`},
+	}
+	for _, tt := range passwordTests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			for key, values := range tt.header {
+				req.Header[key] = values
+			}
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+			if location := rr.Header().Get("Location"); location != tt.expectedLocation {
+				t.Errorf("Expected Location %q, got %q", tt.expectedLocation, location)
+			}
+			if !strings.Contains(rr.Body.String(), tt.expectedBody) || strings.Contains(rr.Body.String(), "/privado") {
+				t.Errorf("Unexpected body: %s", rr.Body.String())
+			}
+		})
+	}
+	// Las contraseñas incorrectas por cualquier método bloquean el enlace con 429
+	for i := 0; i < shortener.MaxPasswordFailures; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/"+protected+"?key=nop", nil)
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	lockedReq := httptest.NewRequest(http.MethodGet, "/"+protected, nil)
+	lockedReq.Header.Set(LinkPasswordHeader, "abre-sesamo")
+	lockedRR := httptest.NewRecorder()
+	r.ServeHTTP(lockedRR, lockedReq)
+	if lockedRR.Code != http.StatusTooManyRequests || !strings.Contains(lockedRR.Body.String(), "password_locked") || lockedRR.Header().Get("Retry-After") == "" {
+		t.Errorf("Expected 429 password_locked with Retry-After, got %d %q: %s", lockedRR.Code, lockedRR.Header().Get("Retry-After"), lockedRR.Body.String())
+	}
+
+	// El país lo aporta la cabecera del CDN configurada en el handler
+	geoRouter := chi.NewRouter()
+	geoRouter.Get("/{short_code}", NewHandler(service, WithCountryHeader("CF-IPCountry")).RedirectURL)
+	localized := create(`{"long_url": "https://www.example.com/", "geo_targets": {"DE": "https://www.example.de/", "EU": "https://www.example.eu/"}}`)
+
+	geoTests := []struct {
+		name             string
+		country          string
+		expectedLocation string
+	}{
+		{"País exacto", "DE", "https://www.example.de/"},
+		{"Región", "FR", "https://www.example.eu/"},
+		{"País sin destino", "US", "https://www.example.com/"},
+		{"Sin cabecera", "", "https://www.example.com/"},
+	}
+	for _, tt := range geoTests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/"+localized, nil)
+			if tt.country != "" {
+				req.Header.Set("CF-IPCountry", tt.country)
+			}
+			rr := httptest.NewRecorder()
+			geoRouter.ServeHTTP(rr, req)
+			if location := rr.Header().Get("Location"); location != tt.expectedLocation {
+				t.Errorf("Expected Location %s, got %s", tt.expectedLocation, location)
+			}
+		})
+	}
+
+	app := create(`{"long_url": "https://www.example.com/app", "device_targets": {"ios": "https://apps.apple.com/app/id123", "android": "market://details?id=com.example"}}`)
+	deviceTests := []struct {
+		name             string
+		userAgent        string
+		expectedLocation string
+	}{
+		{"iOS a la App Store", "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X)", "https://apps.apple.com/app/id123"},
+		{"Android a Play Store", "Mozilla/5.0 (Linux; Android 14; Pixel 8)", "market://details?id=com.example"},
+		{"Escritorio a la web", "Mozilla/5.0 (Windows NT 10.0; Win64; x64)", "https://www.example.com/app"},
+	}
+	for _, tt := range deviceTests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/"+app, nil)
+			req.Header.Set("User-Agent", tt.userAgent)
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+			if location := rr.Header().Get("Location"); location != tt.expectedLocation {
+				t.Errorf("Expected Location %s, got %s", tt.expectedLocation, location)
+			}
+		})
+	}
+
+	// Prueba A/B con variante fija por cookie
+	ab := create(`{"long_url": "https://www.example.com/", "variants": [{"name": "a", "url": "https://www.example.com/a", "weight": 1}, {"name": "b", "url": "https://www.example.com/b", "weight": 0}], "sticky_variants": true}`)
+	req := httptest.NewRequest(http.MethodGet, "/"+ab, nil)
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	cookies := rr.Result().Cookies()
+	if rr.Header().Get("Location") != "https://www.example.com/a" || len(cookies) != 1 || cookies[0].Name != VariantCookiePrefix+ab || cookies[0].Value != "a" {
+		t.Fatalf("Expected variant a with cookie, got %s %v", rr.Header().Get("Location"), cookies)
+	}
+	req = httptest.NewRequest(http.MethodGet, "/"+ab, nil)
+	req.AddCookie(&http.Cookie{Name: VariantCookiePrefix + ab, Value: "b"})
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	if location := rr.Header().Get("Location"); location != "https://www.example.com/b" {
+		t.Errorf("Expected sticky variant b, got %s", location)
+	}
+	link, _ := service.GetLink(context.Background(), ab)
+	if response := handler.toLinkResponse(req, link); len(response.Variants) != 2 || response.Variants[0].Clicks != 1 || response.Variants[1].Clicks != 1 {
+		t.Errorf("Expected one click per variant, got %+v", response.Variants)
+	}
+
+	// Página de aviso: se responde 200 con el destino en lugar de redirigir
+	warned := create(`{"long_url": "https://www.example.com/fuera?a=1", "interstitial": true}`)
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/"+warned, nil))
+	if rr.Code != http.StatusOK || rr.Header().Get("Location") != "" {
+		t.Fatalf("Expected interstitial page, got %d %s", rr.Code, rr.Header().Get("Location"))
+	}
+	if body := rr.Body.String(); !strings.Contains(body, `content="5; url=https://www.example.com/fuera?a=1"`) || !strings.Contains(body, "<strong>www.example.com</strong>") {
+		t.Errorf("Unexpected interstitial body: %s", body)
+	}
+	rr = httptest.NewRecorder()
+	NewHandler(service, WithInterstitialCountdown(0)).sendInterstitial(rr, shortener.Redirect{URL: "https://www.example.com/"})
+	if strings.Contains(rr.Body.String(), "http-equiv") {
+		t.Errorf("Expected no automatic redirect without countdown")
+	}
+}
+
+func TestHandler_Cloak(t *testing.T) {
+	service := shortener.NewService(shortener.NewStore())
+	handler := NewHandler(service)
+
+	r := chi.NewRouter()
+	r.Post("/shorten", handler.ShortenURL)
+	r.Get("/{short_code}", handler.RedirectURL)
+
+	create := func(body string) {
+		req := httptest.NewRequest(http.MethodPost, "/shorten", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("Expected status %d creating link, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
+		}
+	}
+	create(`{"long_url": "https://www.example.com/rebajas", "alias": "marco", "cloak": {"mode": "frame", "title": "Rebajas <de> otoño", "image": "https://cdn.example.com/otono.png"}}`)
+	create(`{"long_url": "https://www.example.com/rebajas", "alias": "refresco", "cloak": {"mode": "refresh", "description": "Hasta un 50%"}}`)
+	create(`{"long_url": "https://www.example.com/rebajas", "alias": "app", "device_targets": {"ios": "itms-apps://apps.apple.com/app/id1"}, "cloak": {"mode": "frame"}}`)
+
+	tests := []struct {
+		name        string
+		code        string
+		userAgent   string
+		contains    []string
+		notContains []string
+	}{
+		{name: "Frame con etiquetas propias", code: "marco",
+			contains: []string{`<iframe src="https://www.example.com/rebajas"`, `<title>Rebajas &lt;de&gt; otoño</title>`,
+				`<meta property="og:image" content="https://cdn.example.com/otono.png">`, `<meta property="og:url" content="http://example.com/marco">`},
+			notContains: []string{"http-equiv"}},
+		{name: "Refresh con el host como título", code: "refresco",
+			contains:    []string{`<meta http-equiv="refresh" content="0; url=https://www.example.com/rebajas">`, `<title>www.example.com</title>`, `content="Hasta un 50%"`},
+			notContains: []string{"<iframe"}},
+		{name: "Frame con enlace profundo usa refresh", code: "app", userAgent: "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X)",
+			contains:    []string{`url=itms-apps://apps.apple.com/app/id1`},
+			notContains: []string{"<iframe"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/"+tt.code, nil)
+			req.Header.Set("User-Agent", tt.userAgent)
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+			if rr.Code != http.StatusOK || rr.Header().Get("Location") != "" {
+				t.Fatalf("Expected cloaked page, got %d %s", rr.Code, rr.Header().Get("Location"))
+			}
+			body := rr.Body.String()
+			for _, want := range tt.contains {
+				if !strings.Contains(body, want) {
+					t.Errorf("Expected body to contain %q, got %s", want, body)
+				}
+			}
+			for _, unwanted := range tt.notContains {
+				if strings.Contains(body, unwanted) {
+					t.Errorf("Expected body not to contain %q, got %s", unwanted, body)
+				}
+			}
+		})
+	}
+
+	// Las visitas a la página enmascarada se contabilizan y el enlace describe su modo
+	link, _ := service.GetLink(context.Background(), "marco")
+	if link.Clicks != 1 {
+		t.Errorf("Expected 1 click, got %d", link.Clicks)
+	}
+	response := handler.toLinkResponse(httptest.NewRequest(http.MethodGet, "/", nil), link)
+	if response.Cloak == nil || response.Cloak.Mode != shortener.CloakFrame || response.Cloak.Title != "Rebajas <de> otoño" {
+		t.Errorf("Expected cloak in link response, got %+v", response.Cloak)
+	}
+}
+
+func TestHandler_ReferrerPolicy(t *testing.T) {
+	service := shortener.NewService(shortener.NewStore())
+	handler := NewHandler(service)
+
+	r := chi.NewRouter()
+	r.Post("/shorten", handler.ShortenURL)
+	r.Get("/{short_code}", handler.RedirectURL)
+
+	for _, body := range []string{
+		`{"long_url": "https://www.example.com/campana", "alias": "boletin", "referrers": {"domains": ["newsletter.example.com"]}}`,
+		`{"long_url": "https://www.example.com/campana", "alias": "aviso", "referrers": {"domains": ["example.com"], "fallback": "interstitial"}}`,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/shorten", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("Expected status %d creating link, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
+		}
+	}
+
+	tests := []struct {
+		name           string
+		code           string
+		referer        string
+		expectedStatus int
+		expectedError  string
+	}{
+		{name: "Desde el dominio permitido", code: "boletin", referer: "https://newsletter.example.com/edicion/12", expectedStatus: http.StatusTemporaryRedirect},
+		{name: "Desde otro sitio", code: "boletin", referer: "https://otro.example.net/", expectedStatus: http.StatusForbidden, expectedError: "referrer_not_allowed"},
+		{name: "Sin Referer", code: "boletin", expectedStatus: http.StatusForbidden, expectedError: "referrer_not_allowed"},
+		{name: "Subdominio con aviso permitido", code: "aviso", referer: "https://www.blog.example.com/", expectedStatus: http.StatusTemporaryRedirect},
+		{name: "Otro sitio con aviso", code: "aviso", referer: "https://otro.example.net/", expectedStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/"+tt.code, nil)
+			if tt.referer != "" {
+				req.Header.Set("Referer", tt.referer)
+			}
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if tt.expectedError != "" {
+				var response ErrorResponse
+				json.NewDecoder(rr.Body).Decode(&response)
+				if string(response.Error) != tt.expectedError {
+					t.Errorf("Expected error %q, got %q", tt.expectedError, response.Error)
+				}
+			}
+			if tt.expectedStatus == http.StatusOK && !strings.Contains(rr.Body.String(), "https://www.example.com/campana") {
+				t.Errorf("Expected interstitial with destination, got %s", rr.Body.String())
+			}
+		})
+	}
+
+	link, _ := service.GetLink(context.Background(), "boletin")
+	response := handler.toLinkResponse(httptest.NewRequest(http.MethodGet, "/", nil), link)
+	if response.Referrers == nil || response.Referrers.Fallback != shortener.ReferrerBlock || len(response.Referrers.Domains) != 1 {
+		t.Errorf("Expected referrers in link response, got %+v", response.Referrers)
+	}
+}
+
+func TestHandler_IPAccess(t *testing.T) {
+	service := shortener.NewService(shortener.NewStore())
+	handler := NewHandler(service)
+
+	r := chi.NewRouter()
+	r.Post("/shorten", handler.ShortenURL)
+	r.Get("/api/urls/{short_code}", handler.PreviewURL)
+	r.Get("/{short_code}", handler.RedirectURL)
+
+	req := httptest.NewRequest(http.MethodPost, "/shorten", strings.NewReader(
+		`{"long_url": "https://intranet.example.com/nominas", "alias": "nominas", "ip_access": {"allow": ["10.0.0.0/8"], "deny": ["10.66.0.0/16"]}}`))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d creating link, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+
+	tests := []struct {
+		name            string
+		path            string
+		remoteAddr      string
+		expectedStatus  int
+		expectedError   string
+		expectedLongURL string
+	}{
+		{name: "Redirección desde la red interna", path: "/nominas", remoteAddr: "10.1.2.3:4321", expectedStatus: http.StatusTemporaryRedirect},
+		{name: "Redirección desde fuera", path: "/nominas", remoteAddr: "198.51.100.7:4321", expectedStatus: http.StatusForbidden, expectedError: "ip_not_allowed"},
+		{name: "Redirección desde una red rechazada", path: "/nominas", remoteAddr: "10.66.0.1:4321", expectedStatus: http.StatusForbidden, expectedError: "ip_not_allowed"},
+		{name: "Vista previa desde la red interna", path: "/api/urls/nominas", remoteAddr: "10.1.2.3:4321", expectedStatus: http.StatusOK,
+			expectedLongURL: "https://intranet.example.com/nominas"},
+		{name: "Vista previa desde fuera oculta el destino", path: "/api/urls/nominas", remoteAddr: "198.51.100.7:4321", expectedStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.RemoteAddr = tt.remoteAddr
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if tt.expectedError != "" {
+				var response ErrorResponse
+				json.NewDecoder(rr.Body).Decode(&response)
+				if string(response.Error) != tt.expectedError {
+					t.Errorf("Expected error %q, got %q", tt.expectedError, response.Error)
+				}
+			}
+			if tt.expectedStatus == http.StatusOK {
+				var preview PreviewResponse
+				json.NewDecoder(rr.Body).Decode(&preview)
+				if preview.LongURL != tt.expectedLongURL {
+					t.Errorf("Expected long_url %q, got %q", tt.expectedLongURL, preview.LongURL)
+				}
+			}
+		})
+	}
+
+	link, _ := service.GetLink(context.Background(), "nominas")
+	response := handler.toLinkResponse(httptest.NewRequest(http.MethodGet, "/", nil), link)
+	if response.IPAccess == nil || len(response.IPAccess.Allow) != 1 || len(response.IPAccess.Deny) != 1 {
+		t.Errorf("Expected ip_access in link response, got %+v", response.IPAccess)
+	}
+}
+
+func TestHandler_Backups(t *testing.T) {
+	store := shortener.NewStore()
+	service := shortener.NewService(store)
+	store.SaveLink(context.Background(), shortener.Link{ShortCode: "promo", LongURL: "https://www.example.com/promo"})
+	target, err := backup.NewDirTarget(t.TempDir())
+	if err != nil {
+		t.Fatalf("Unexpected error creating target: %v", err)
+	}
+	tokens := auth.NewTokenManager([]byte("secreto-de-prueba"), time.Hour)
+	adminToken, _ := tokens.Issue("root", auth.RoleAdmin)
+
+	router := func(handler *Handler) http.Handler {
+		r := chi.NewRouter()
+		r.Use(Authenticate(tokens))
+		r.Route("/admin", func(r chi.Router) {
+			r.Use(RequireAuth, RequireAdmin)
+			r.Get("/backups", handler.ListBackups)
+			r.Post("/backups", handler.CreateBackup)
+			r.Post("/restore", handler.RestoreBackup)
+		})
+		return r
+	}
+	enabled := router(NewHandler(service, WithBackups(backup.NewManager(service, target))))
+	disabled := router(NewHandler(service))
+	do := func(r http.Handler, method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+adminToken)
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := do(enabled, http.MethodPost, "/admin/backups", "")
+	var created BackupResponse
+	if rr.Code != http.StatusCreated || json.Unmarshal(rr.Body.Bytes(), &created) != nil || created.Links != 1 {
+		t.Fatalf("Expected a backup with 1 link, got %d: %s", rr.Code, rr.Body.String())
+	}
+	store.Delete(context.Background(), "promo")
+
+	tests := []struct {
+		name           string
+		router         http.Handler
+		method         string
+		path           string
+		body           string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{name: "Listar copias", router: enabled, method: http.MethodGet, path: "/admin/backups", expectedStatus: http.StatusOK,
+			expectedBody: `"name":"` + created.Name + `"`},
+		{name: "Restaurar", router: enabled, method: http.MethodPost, path: "/admin/restore",
+			body: `{"snapshot": "` + created.Name + `"}`, expectedStatus: http.StatusOK, expectedBody: `"restored":1`},
+		{name: "Copia inexistente", router: enabled, method: http.MethodPost, path: "/admin/restore",
+			body: `{"snapshot": "links-20000101T000000.000Z.jsonl.gz"}`, expectedStatus: http.StatusNotFound, expectedBody: "snapshot_not_found"},
+		{name: "Cuerpo inválido", router: enabled, method: http.MethodPost, path: "/admin/restore", body: `{`,
+			expectedStatus: http.StatusBadRequest},
+		{name: "Copias sin configurar", router: disabled, method: http.MethodGet, path: "/admin/backups",
+			expectedStatus: http.StatusNotFound, expectedBody: "backups_disabled"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := do(tt.router, tt.method, tt.path, tt.body)
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if !strings.Contains(rr.Body.String(), tt.expectedBody) {
+				t.Errorf("Expected body to contain %q, got %s", tt.expectedBody, rr.Body.String())
+			}
+		})
+	}
+
+	if _, found, _ := store.GetLink(context.Background(), "promo"); !found {
+		t.Errorf("Expected the deleted link to be restored")
+	}
+}
+
+func TestHandler_WebhookDeliveries(t *testing.T) {
+	dispatcher := webhooks.NewDispatcher([]webhooks.Endpoint{{URL: "https://hooks.example.com/"}})
+	dispatcher.HandleEvent(shortener.Event{Type: shortener.EventCreated, Time: time.Now(), Link: shortener.Link{ShortCode: "abc123"}})
+	tokens := auth.NewTokenManager([]byte("secreto-de-prueba"), time.Hour)
+	adminToken, _ := tokens.Issue("root", auth.RoleAdmin)
+
+	router := func(handler *Handler) http.Handler {
+		r := chi.NewRouter()
+		r.Use(Authenticate(tokens))
+		r.Route("/admin", func(r chi.Router) {
+			r.Use(RequireAuth, RequireAdmin)
+			r.Get("/webhooks/deliveries", handler.WebhookDeliveries)
+		})
+		return r
+	}
+	enabled := router(NewHandler(shortener.NewService(shortener.NewStore()), WithWebhookLog(dispatcher)))
+	disabled := router(NewHandler(shortener.NewService(shortener.NewStore())))
+
+	tests := []struct {
+		name           string
+		router         http.Handler
+		path           string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{name: "Listar entregas", router: enabled, path: "/admin/webhooks/deliveries", expectedStatus: http.StatusOK,
+			expectedBody: `"event":"link.created","short_code":"abc123","endpoint":"https://hooks.example.com/","status":"pending"`},
+		{name: "Filtrar por estado", router: enabled, path: "/admin/webhooks/deliveries?status=failed", expectedStatus: http.StatusOK,
+			expectedBody: `{"deliveries":[],"total":0`},
+		{name: "Estado desconocido", router: enabled, path: "/admin/webhooks/deliveries?status=perdido", expectedStatus: http.StatusBadRequest},
+		{name: "Evento desconocido", router: enabled, path: "/admin/webhooks/deliveries?event=link.viewed", expectedStatus: http.StatusBadRequest},
+		{name: "Tamaño de página excesivo", router: enabled, path: "/admin/webhooks/deliveries?per_page=1000", expectedStatus: http.StatusBadRequest},
+		{name: "Webhooks sin configurar", router: disabled, path: "/admin/webhooks/deliveries", expectedStatus: http.StatusNotFound,
+			expectedBody: "webhooks_disabled"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.Header.Set("Authorization", "Bearer "+adminToken)
+			rr := httptest.NewRecorder()
+			tt.router.ServeHTTP(rr, req)
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if !strings.Contains(rr.Body.String(), tt.expectedBody) {
+				t.Errorf("Expected body to contain %q, got %s", tt.expectedBody, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestHandler_ShortenForm(t *testing.T) {
+	service := shortener.NewService(shortener.NewStore())
+	service.Shorten(context.Background(), shortener.ShortenInput{LongURL: "https://www.example.com/ocupado", Alias: "ocupado"})
+	handler := NewHandler(service)
+	r := chi.NewRouter()
+	r.Get("/", handler.Home)
+	r.Post("/shorten/form", handler.ShortenForm)
+
+	tests := []struct {
+		name           string
+		form           url.Values
+		expectedStatus int
+		expectedBody   []string
+	}{
+		{name: "Enlace creado", form: url.Values{"long_url": {"https://www.example.com/pagina"}, "alias": {"inicio"}},
+			expectedStatus: http.StatusCreated, expectedBody: []string{`value="http://example.com/inicio"`, "<svg", `href="http://example.com/inicio+"`}},
+		{name: "URL inválida", form: url.Values{"long_url": {"no-es-una-url"}}, expectedStatus: http.StatusBadRequest,
+			expectedBody: []string{`class="error"`, `value="no-es-una-url"`}},
+		{name: "Alias ocupado", form: url.Values{"long_url": {"https://www.example.com/"}, "alias": {"ocupado"}}, expectedStatus: http.StatusConflict,
+			expectedBody: []string{`class="error"`, `value="ocupado"`}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/shorten/form", strings.NewReader(tt.form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if ct := rr.Header().Get("Content-Type"); ct != "text/html; charset=utf-8" {
+				t.Errorf("Expected HTML, got %q", ct)
+			}
+			for _, expected := range tt.expectedBody {
+				if !strings.Contains(rr.Body.String(), expected) {
+					t.Errorf("Expected body to contain %q, got %s", expected, rr.Body.String())
+				}
+			}
+		})
+	}
+
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `action="/shorten/form"`) {
+		t.Errorf("Expected homepage with the form, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestHandler_AdminUI(t *testing.T) {
+	service := shortener.NewService(shortener.NewStore())
+	service.Shorten(context.Background(), shortener.ShortenInput{LongURL: "https://www.example.com/existente", Alias: "existente"})
+	collection, _ := service.CreateCollection(context.Background(), shortener.Actor{UserID: "root", Admin: true}, "", "Campaña de otoño")
+	service.MoveLinks(context.Background(), shortener.Actor{UserID: "root", Admin: true}, "", collection.ID, []string{"existente"})
+	tokens := auth.NewTokenManager([]byte("secreto-de-prueba"), time.Hour)
+	adminToken, _ := tokens.Issue("root", auth.RoleAdmin)
+	userToken, _ := tokens.Issue("alice", auth.RoleUser)
+
+	r := chi.NewRouter()
+	r.Use(Authenticate(tokens))
+	r.Mount(AdminUIPath, NewHandler(service).AdminUI(tokens))
+
+	form := func(values url.Values) (io.Reader, string) {
+		return strings.NewReader(values.Encode()), "application/x-www-form-urlencoded"
+	}
+	upload := func(csrf, content string) (io.Reader, string) {
+		var body strings.Builder
+		writer := multipart.NewWriter(&body)
+		if csrf != "" {
+			writer.WriteField("csrf", csrf)
+		}
+		file, _ := writer.CreateFormFile("file", "enlaces.csv")
+		io.WriteString(file, content)
+		writer.Close()
+		return strings.NewReader(body.String()), writer.FormDataContentType()
+	}
+	csrf := csrfToken(adminToken)
+
+	tests := []struct {
+		name             string
+		method           string
+		path             string
+		session          string
+		body             func() (io.Reader, string)
+		expectedStatus   int
+		expectedBody     string
+		expectedLocation string
+	}{
+		{name: "Sin sesión", method: http.MethodGet, path: "/admin/ui/", expectedStatus: http.StatusSeeOther, expectedLocation: "/admin/ui/login"},
+		{name: "Sesión sin permisos de administrador", method: http.MethodGet, path: "/admin/ui/", session: userToken,
+			expectedStatus: http.StatusSeeOther, expectedLocation: "/admin/ui/login"},
+		{name: "Página de inicio de sesión", method: http.MethodGet, path: "/admin/ui/login", expectedStatus: http.StatusOK, expectedBody: `name="token"`},
+		{name: "Inicio de sesión", method: http.MethodPost, path: "/admin/ui/login",
+			body:           func() (io.Reader, string) { return form(url.Values{"token": {adminToken}}) },
+			expectedStatus: http.StatusSeeOther, expectedLocation: "/admin/ui/"},
+		{name: "Inicio de sesión sin ser administrador", method: http.MethodPost, path: "/admin/ui/login",
+			body:           func() (io.Reader, string) { return form(url.Values{"token": {userToken}}) },
+			expectedStatus: http.StatusForbidden, expectedBody: "Se requieren permisos de administrador"},
+		{name: "Listado", method: http.MethodGet, path: "/admin/ui/", session: adminToken, expectedStatus: http.StatusOK,
+			expectedBody: "https://www.example.com/existente"},
+		{name: "Listado agrupado por colección", method: http.MethodGet, path: "/admin/ui/?collection_id=1", session: adminToken,
+			expectedStatus: http.StatusOK, expectedBody: `<td><a href="/admin/ui/?collection_id=1">Campaña de otoño</a></td>`},
+		{name: "Listado con estado inválido", method: http.MethodGet, path: "/admin/ui/?status=perdido", session: adminToken,
+			expectedStatus: http.StatusBadRequest},
+		{name: "Detalle", method: http.MethodGet, path: "/admin/ui/links/existente", session: adminToken, expectedStatus: http.StatusOK,
+			expectedBody: `value="` + csrf + `"`},
+		{name: "Detalle inexistente", method: http.MethodGet, path: "/admin/ui/links/noexiste", session: adminToken,
+			expectedStatus: http.StatusNotFound, expectedBody: "Código corto no encontrado"},
+		{name: "Crear enlace", method: http.MethodPost, path: "/admin/ui/links", session: adminToken,
+			body: func() (io.Reader, string) {
+				return form(url.Values{"csrf": {csrf}, "long_url": {"https://www.example.com/nuevo"}, "alias": {"nuevo"}})
+			},
+			expectedStatus: http.StatusSeeOther, expectedLocation: "/admin/ui/links/nuevo?code=nuevo&done=created"},
+		{name: "Crear enlace con URL inválida", method: http.MethodPost, path: "/admin/ui/links", session: adminToken,
+			body:           func() (io.Reader, string) { return form(url.Values{"csrf": {csrf}, "long_url": {"no-es-una-url"}}) },
+			expectedStatus: http.StatusBadRequest},
+		{name: "Crear enlace sin token CSRF", method: http.MethodPost, path: "/admin/ui/links", session: adminToken,
+			body:           func() (io.Reader, string) { return form(url.Values{"long_url": {"https://www.example.com/"}}) },
+			expectedStatus: http.StatusForbidden},
+		{name: "Desactivar enlace", method: http.MethodPost, path: "/admin/ui/links/existente/disable", session: adminToken,
+			body:           func() (io.Reader, string) { return form(url.Values{"csrf": {csrf}, "reason": {"Spam"}}) },
+			expectedStatus: http.StatusSeeOther, expectedLocation: "/admin/ui/links/existente?code=existente&done=disabled"},
+		{name: "Importar CSV", method: http.MethodPost, path: "/admin/ui/import", session: adminToken,
+			body: func() (io.Reader, string) {
+				return upload(csrf, "long_url,alias\nhttps://www.example.com/a,importado\nno-es-una-url\n")
+			},
+			expectedStatus: http.StatusOK, expectedBody: "1 enlaces importados, 1 filas con errores"},
+		{name: "Importar sin token CSRF", method: http.MethodPost, path: "/admin/ui/import", session: adminToken,
+			body:           func() (io.Reader, string) { return upload("", "https://www.example.com/b\n") },
+			expectedStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body io.Reader
+			contentType := ""
+			if tt.body != nil {
+				body, contentType = tt.body()
+			}
+			req := httptest.NewRequest(tt.method, tt.path, body)
+			if contentType != "" {
+				req.Header.Set("Content-Type", contentType)
+			}
+			if tt.session != "" {
+				req.AddCookie(&http.Cookie{Name: adminSessionCookie, Value: tt.session})
+			}
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if !strings.Contains(rr.Body.String(), tt.expectedBody) {
+				t.Errorf("Expected body to contain %q, got %s", tt.expectedBody, rr.Body.String())
+			}
+			if location := rr.Header().Get("Location"); location != tt.expectedLocation {
+				t.Errorf("Expected location %q, got %q", tt.expectedLocation, location)
+			}
+		})
+	}
+
+	if link, _ := service.GetLink(context.Background(), "existente"); !link.IsDisabled() || link.DisabledReason != "Spam" {
+		t.Errorf("Expected link to be disabled from the dashboard, got %+v", link)
+	}
+	if _, err := service.GetLink(context.Background(), "importado"); err != nil {
+		t.Errorf("Expected imported link to exist, got %v", err)
+	}
+}
+
+func TestHandler_StreamEvents(t *testing.T) {
+	broker := shortener.NewEventBroker()
+	service := shortener.NewService(shortener.NewStore(), shortener.WithEventListener(broker))
+	tokens := auth.NewTokenManager([]byte("secreto-de-prueba"), time.Hour)
+	aliceToken, _ := tokens.Issue("alice", auth.RoleUser)
+
+	router := func(handler *Handler) http.Handler {
+		r := chi.NewRouter()
+		r.Use(Authenticate(tokens))
+		r.With(RequireAuth).Get("/api/events/stream", handler.StreamEvents)
+		return r
+	}
+	server := httptest.NewServer(router(NewHandler(service, WithEventStream(broker))))
+	defer server.Close()
+
+	t.Run("Eventos del propietario", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/api/events/stream", nil)
+		req.Header.Set("Authorization", "Bearer "+aliceToken)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer resp.Body.Close()
+		if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+			t.Fatalf("Expected text/event-stream, got %q", ct)
+		}
+
+		// Los enlaces de otros usuarios no aparecen en el stream de alice
+		service.Shorten(context.Background(), shortener.ShortenInput{LongURL: "https://www.example.com/bob", Owner: "bob"})
+		link, _, _ := service.Shorten(context.Background(), shortener.ShortenInput{LongURL: "https://www.example.com/alice", Owner: "alice"})
+		service.RecordClick(context.Background(), link.ShortCode, shortener.Click{})
+
+		reader := bufio.NewReader(resp.Body)
+		var events []string
+		for len(events) < 2 {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				t.Fatalf("Stream closed after %v: %v", events, err)
+			}
+			if strings.HasPrefix(line, "event: ") {
+				events = append(events, strings.TrimSpace(strings.TrimPrefix(line, "event: ")))
+			}
+			if strings.HasPrefix(line, "data: ") && !strings.Contains(line, `"owner":"alice"`) {
+				t.Errorf("Expected only alice's events, got %s", line)
+			}
+		}
+		if events[0] != shortener.EventCreated || events[1] != shortener.EventClicked {
+			t.Errorf("Expected created and clicked events, got %v", events)
+		}
+	})
+
+	tests := []struct {
+		name           string
+		handler        *Handler
+		path           string
+		expectedStatus int
+	}{
+		{name: "Propietario ajeno", handler: NewHandler(service, WithEventStream(broker)), path: "/api/events/stream?owner=bob", expectedStatus: http.StatusForbidden},
+		{name: "Stream deshabilitado", handler: NewHandler(service), path: "/api/events/stream", expectedStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.Header.Set("Authorization", "Bearer "+aliceToken)
+			rr := httptest.NewRecorder()
+			router(tt.handler).ServeHTTP(rr, req)
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestHandler_LiveAnalytics(t *testing.T) {
+	broker := shortener.NewEventBroker()
+	service := shortener.NewService(shortener.NewStore(), shortener.WithEventListener(broker))
+	tracker := analytics.NewTracker(time.Minute)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go tracker.Run(ctx, broker)
+	tokens := auth.NewTokenManager([]byte("secreto-de-prueba"), time.Hour)
+	aliceToken, _ := tokens.Issue("alice", auth.RoleUser)
+
+	router := func(handler *Handler) http.Handler {
+		r := chi.NewRouter()
+		r.Use(Authenticate(tokens))
+		r.With(RequireAuth).Get("/api/analytics/live", handler.LiveAnalytics)
+		return r
+	}
+	server := httptest.NewServer(router(NewHandler(service, WithLiveAnalytics(tracker, 20*time.Millisecond))))
+	defer server.Close()
+
+	t.Run("Métricas del propietario", func(t *testing.T) {
+		for broker.Subscribers() == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		mine, _, _ := service.Shorten(context.Background(), shortener.ShortenInput{LongURL: "https://www.example.com/alice", Owner: "alice"})
+		other, _, _ := service.Shorten(context.Background(), shortener.ShortenInput{LongURL: "https://www.example.com/bob", Owner: "bob"})
+		service.RecordClick(context.Background(), mine.ShortCode, shortener.Click{Visitor: "v1"})
+		service.RecordClick(context.Background(), mine.ShortCode, shortener.Click{Visitor: "v2"})
+		service.RecordClick(context.Background(), other.ShortCode, shortener.Click{Visitor: "v1"})
+
+		conn, err := net.Dial("tcp", strings.TrimPrefix(server.URL, "http://"))
+		if err != nil {
+			t.Fatalf("Unexpected dial error: %v", err)
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(2 * time.Second))
+		fmt.Fprintf(conn, "GET /api/analytics/live HTTP/1.1\r\nHost: test\r\nAuthorization: Bearer %s\r\nConnection: Upgrade\r\n"+
+			"Upgrade: websocket\r\nSec-WebSocket-Version: 13\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n\r\n", aliceToken)
+		reader := bufio.NewReader(conn)
+		resp, err := http.ReadResponse(reader, nil)
+		if err != nil || resp.StatusCode != http.StatusSwitchingProtocols {
+			t.Fatalf("Expected 101 Switching Protocols, got %v (%v)", resp, err)
+		}
+
+		// Se espera al primer mensaje que ya refleje las dos visitas
+		for {
+			var header [2]byte
+			if _, err := io.ReadFull(reader, header[:]); err != nil {
+				t.Fatalf("Unexpected read error: %v", err)
+			}
+			length := int(header[1] & 0x7F)
+			if length == 126 {
+				var extended [2]byte
+				io.ReadFull(reader, extended[:])
+				length = int(extended[0])<<8 | int(extended[1])
+			}
+			payload := make([]byte, length)
+			io.ReadFull(reader, payload)
+
+			var message LiveAnalyticsMessage
+			if err := json.Unmarshal(payload, &message); err != nil {
+				t.Fatalf("Unexpected message %s: %v", payload, err)
+			}
+			if len(message.Links) == 0 {
+				continue
+			}
+			if len(message.Links) != 1 || message.Links[0].ShortCode != mine.ShortCode || message.Links[0].UniqueVisitors != 2 || message.Links[0].Clicks != 2 {
+				t.Errorf("Expected only alice's link with 2 visitors, got %s", payload)
+			}
+			break
+		}
+	})
+
+	tests := []struct {
+		name           string
+		handler        *Handler
+		path           string
+		expectedStatus int
+	}{
+		{name: "Sin WebSocket", handler: NewHandler(service, WithLiveAnalytics(tracker, time.Second)), path: "/api/analytics/live", expectedStatus: http.StatusBadRequest},
+		{name: "Propietario ajeno", handler: NewHandler(service, WithLiveAnalytics(tracker, time.Second)), path: "/api/analytics/live?owner=bob", expectedStatus: http.StatusForbidden},
+		{name: "Métricas deshabilitadas", handler: NewHandler(service), path: "/api/analytics/live", expectedStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.Header.Set("Authorization", "Bearer "+aliceToken)
+			rr := httptest.NewRecorder()
+			router(tt.handler).ServeHTTP(rr, req)
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestHandler_CompactStore(t *testing.T) {
+	ctx := context.Background()
+	service := shortener.NewService(shortener.NewStore())
+	handler := NewHandler(service)
+	tokens := auth.NewTokenManager([]byte("secreto-de-prueba"), time.Hour)
+	adminToken, _ := tokens.Issue("root", auth.RoleAdmin)
+	userToken, _ := tokens.Issue("alice", auth.RoleUser)
+	for i := 0; i < 4; i++ {
+		link, _, _ := service.Shorten(ctx, shortener.ShortenInput{LongURL: fmt.Sprintf("https://www.example.com/%d", i)})
+		if i > 0 {
+			service.DeleteURL(ctx, shortener.Actor{UserID: "root", Admin: true}, link.ShortCode)
+		}
+	}
+
+	r := chi.NewRouter()
+	r.Use(Authenticate(tokens))
+	r.With(RequireAuth, RequireAdmin).Post("/admin/store/compact", handler.CompactStore)
+
+	tests := []struct {
+		name           string
+		token          string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{name: "Administrador", token: adminToken, expectedStatus: http.StatusOK, expectedBody: `"peak_links":1`},
+		{name: "Usuario sin permisos", token: userToken, expectedStatus: http.StatusForbidden, expectedBody: `"error":"forbidden"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/admin/store/compact", nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if !strings.Contains(rr.Body.String(), tt.expectedBody) {
+				t.Errorf("Expected body to contain %q, got %s", tt.expectedBody, rr.Body.String())
+			}
+		})
+	}
+
+	var response CompactionResponse
+	req := httptest.NewRequest(http.MethodPost, "/admin/store/compact", nil)
+	req.Header.Set("Authorization", "Bearer "+adminToken)
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Unexpected error decoding response: %v", err)
+	}
+	if response.FreedBytes != 0 || response.After.CompactedAt == nil {
+		t.Errorf("Expected a second compaction to free nothing, got %+v", response)
 	}
 }
@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"acortador-urls/internal/errcode"
+)
+
+// Idiomas de los mensajes de error. Los mensajes de los handlers están escritos en
+// DefaultLanguage; el campo error no se traduce nunca.
+const (
+	LanguageES = "es"
+	LanguageEN = "en"
+	// DefaultLanguage es el idioma de las peticiones sin Accept-Language o con idiomas que el
+	// catálogo no tiene
+	DefaultLanguage = LanguageES
+)
+
+// errorMessages es el catálogo de mensajes por código de error e idioma. Con DefaultLanguage se
+// conserva el mensaje del handler, que puede incluir detalles (un límite, el valor rechazado);
+// en los demás idiomas se usa el del catálogo y, si el código no está, el del handler.
+var errorMessages = map[errcode.Code]map[string]string{
+	errcode.AccessDenied:          {LanguageES: "El proveedor de identidad no autorizó el inicio de sesión", LanguageEN: "The identity provider did not authorize the sign-in"},
+	errcode.AliasNotAllowed:       {LanguageES: "El alias solicitado no está permitido", LanguageEN: "The requested alias is not allowed"},
+	errcode.AliasTaken:            {LanguageES: "El alias solicitado ya está en uso", LanguageEN: "The requested alias is already in use"},
+	errcode.BackupsDisabled:       {LanguageES: "Las copias de seguridad no están habilitadas", LanguageEN: "Backups are not enabled"},
+	errcode.BatchTooLarge:         {LanguageES: "El lote supera el máximo de elementos", LanguageEN: "The batch exceeds the maximum number of items"},
+	errcode.CodeSpaceSaturated:    {LanguageES: "El espacio de códigos está saturado; aumenta la longitud de los códigos (CODE_LENGTH) o el alfabeto", LanguageEN: "The code space is saturated; increase the code length (CODE_LENGTH) or the alphabet"},
+	errcode.CollectionExists:      {LanguageES: "Ya existe una colección con ese nombre", LanguageEN: "A collection with that name already exists"},
+	errcode.CollectionNotFound:    {LanguageES: "Colección no encontrada", LanguageEN: "Collection not found"},
+	errcode.CompactionUnsupported: {LanguageES: "El almacén no admite compactación", LanguageEN: "The store does not support compaction"},
+	errcode.Critical:              {LanguageES: "Error crítico del sistema", LanguageEN: "Critical system error"},
+	errcode.Disabled:              {LanguageES: "El enlace está desactivado", LanguageEN: "The link is disabled"},
+	errcode.DomainNotFound:        {LanguageES: "Dominio personalizado no encontrado", LanguageEN: "Custom domain not found"},
+	errcode.DomainPolicyInvalid:   {LanguageES: "Las listas de dominios no son válidas", LanguageEN: "The domain lists are invalid"},
+	errcode.DomainTaken:           {LanguageES: "El dominio ya pertenece a otro usuario", LanguageEN: "The domain already belongs to another user"},
+	errcode.EmptyBatch:            {LanguageES: "El lote no puede estar vacío", LanguageEN: "The batch cannot be empty"},
+	errcode.EmptyURL:              {LanguageES: "La URL no puede estar vacía", LanguageEN: "The URL cannot be empty"},
+	errcode.EventStreamDisabled:   {LanguageES: "El stream de eventos no está habilitado", LanguageEN: "The event stream is not enabled"},
+	errcode.Expired:               {LanguageES: "El enlace ha expirado", LanguageEN: "The link has expired"},
+	errcode.ExpiredToken:          {LanguageES: "El token ha expirado", LanguageEN: "The token has expired"},
+	errcode.Forbidden:             {LanguageES: "No tienes permiso para realizar esta operación", LanguageEN: "You are not allowed to perform this operation"},
+	errcode.GenerationFailed:      {LanguageES: "No se pudo generar un código único", LanguageEN: "A unique code could not be generated"},
+	errcode.IdempotencyKeyReused:  {LanguageES: "La clave de idempotencia ya se usó con una petición distinta", LanguageEN: "The idempotency key was already used with a different request"},
+	errcode.IdentityProviderError: {LanguageES: "No se pudo completar el inicio de sesión con el proveedor de identidad", LanguageEN: "The sign-in with the identity provider could not be completed"},
+	errcode.Internal:              {LanguageES: "Error interno", LanguageEN: "Internal error"},
+	errcode.InvalidAlias:          {LanguageES: "Alias inválido", LanguageEN: "Invalid alias"},
+	errcode.InvalidArgument:       {LanguageES: "Argumento inválido", LanguageEN: "Invalid argument"},
+	errcode.InvalidBody:           {LanguageES: "Cuerpo inválido", LanguageEN: "Invalid body"},
+	errcode.InvalidCollection:     {LanguageES: "Colección inválida", LanguageEN: "Invalid collection"},
+	errcode.InvalidConfirmation:   {LanguageES: "Token de confirmación inválido o expirado", LanguageEN: "Invalid or expired confirmation token"},
+	errcode.InvalidContentType:    {LanguageES: "Content-Type no soportado", LanguageEN: "Unsupported Content-Type"},
+	errcode.InvalidCSV:            {LanguageES: "El archivo no tiene un formato CSV o TSV válido", LanguageEN: "The file is not valid CSV or TSV"},
+	errcode.InvalidDomain:         {LanguageES: "Dominio personalizado inválido", LanguageEN: "Invalid custom domain"},
+	errcode.InvalidExpiry:         {LanguageES: "expires_at debe ser una fecha RFC 3339 en el futuro", LanguageEN: "expires_at must be an RFC 3339 date in the future"},
+	errcode.InvalidForm:           {LanguageES: "Formulario inválido", LanguageEN: "Invalid form"},
+	errcode.InvalidFormat:         {LanguageES: "Formato no soportado", LanguageEN: "Unsupported format"},
+	errcode.InvalidIdempotencyKey: {LanguageES: "Clave de idempotencia inválida", LanguageEN: "Invalid idempotency key"},
+	errcode.InvalidJSON:           {LanguageES: "JSON inválido", LanguageEN: "Invalid JSON"},
+	errcode.InvalidKeyID:          {LanguageES: "El identificador de la clave son los 16 primeros caracteres hexadecimales de su SHA-256", LanguageEN: "The key ID is the first 16 hex characters of its SHA-256"},
+	errcode.InvalidPassword:       {LanguageES: "Contraseña incorrecta", LanguageEN: "Wrong password"},
+	errcode.InvalidQuery:          {LanguageES: "Parámetros de consulta inválidos", LanguageEN: "Invalid query parameters"},
+	errcode.InvalidReport:         {LanguageES: "Denuncia inválida", LanguageEN: "Invalid report"},
+	errcode.InvalidRow:            {LanguageES: "Fila inválida", LanguageEN: "Invalid row"},
+	errcode.InvalidSignature:      {LanguageES: "La firma de la URL no es válida", LanguageEN: "The URL signature is not valid"},
+	errcode.InvalidSnapshot:       {LanguageES: "La copia de seguridad está dañada o tiene un formato no soportado", LanguageEN: "The backup is corrupt or has an unsupported format"},
+	errcode.InvalidState:          {LanguageES: "El inicio de sesión expiró o no se inició aquí, vuelve a intentarlo", LanguageEN: "The sign-in expired or was not started here, please try again"},
+	errcode.InvalidToken:          {LanguageES: "Token inválido", LanguageEN: "Invalid token"},
+	errcode.InvalidURL:            {LanguageES: "URL inválida", LanguageEN: "Invalid URL"},
+	errcode.IPNotAllowed:          {LanguageES: "Este enlace no está disponible desde tu red", LanguageEN: "This link is not available from your network"},
+	errcode.LinkThrottled:         {LanguageES: "El enlace recibe un tráfico anómalo, intenta de nuevo más tarde", LanguageEN: "The link is receiving unusual traffic, please try again later"},
+	errcode.LiveAnalyticsDisabled: {LanguageES: "Las métricas en vivo no están habilitadas", LanguageEN: "Live analytics are not enabled"},
+	errcode.MaliciousURL:          {LanguageES: "El destino figura en una lista de sitios maliciosos", LanguageEN: "The destination is listed as a malicious site"},
+	errcode.MetadataDisabled:      {LanguageES: "La obtención de metadatos no está habilitada", LanguageEN: "Metadata fetching is not enabled"},
+	errcode.MetadataUnavailable:   {LanguageES: "No se pudieron obtener los metadatos del destino", LanguageEN: "The destination metadata could not be fetched"},
+	errcode.MethodNotAllowed:      {LanguageES: "Método no permitido", LanguageEN: "Method not allowed"},
+	errcode.MissingCode:           {LanguageES: "Código corto requerido", LanguageEN: "Short code required"},
+	errcode.MissingQuery:          {LanguageES: "Consulta requerida", LanguageEN: "Query required"},
+	errcode.NotFound:              {LanguageES: "Código corto no encontrado", LanguageEN: "Short code not found"},
+	errcode.Panic:                 {LanguageES: "Error crítico", LanguageEN: "Critical error"},
+	errcode.PasswordLocked:        {LanguageES: "Demasiados intentos de contraseña, intenta de nuevo más tarde", LanguageEN: "Too many password attempts, please try again later"},
+	errcode.PasswordProtected:     {LanguageES: "El enlace está protegido con contraseña", LanguageEN: "The link is password protected"},
+	errcode.PasswordRequired:      {LanguageES: "El enlace requiere contraseña", LanguageEN: "The link requires a password"},
+	errcode.PayloadTooLarge:       {LanguageES: "El cuerpo de la petición supera el tamaño máximo", LanguageEN: "The request body exceeds the maximum size"},
+	errcode.QuotaExceeded:         {LanguageES: "Alcanzaste el máximo de enlaces permitidos", LanguageEN: "You reached the maximum number of links allowed"},
+	errcode.RateLimited:           {LanguageES: "Demasiadas peticiones, intenta de nuevo más tarde", LanguageEN: "Too many requests, please try again later"},
+	errcode.ReferrerNotAllowed:    {LanguageES: "Este enlace solo se puede abrir desde los sitios autorizados", LanguageEN: "This link can only be opened from authorized sites"},
+	errcode.ReportsDisabled:       {LanguageES: "Los informes de analítica no están habilitados", LanguageEN: "Analytics reports are not enabled"},
+	errcode.RequestCanceled:       {LanguageES: "La petición fue cancelada", LanguageEN: "The request was canceled"},
+	errcode.RequestTimeout:        {LanguageES: "La petición superó el tiempo límite", LanguageEN: "The request exceeded the time limit"},
+	errcode.ServiceUnavailable:    {LanguageES: "Servicio no disponible temporalmente", LanguageEN: "Service temporarily unavailable"},
+	errcode.SignatureExpired:      {LanguageES: "La URL firmada ha caducado", LanguageEN: "The signed URL has expired"},
+	errcode.SignatureRequired:     {LanguageES: "Este enlace solo se puede abrir con una URL firmada", LanguageEN: "This link can only be opened with a signed URL"},
+	errcode.SigningDisabled:       {LanguageES: "La firma de URLs no está habilitada", LanguageEN: "URL signing is not enabled"},
+	errcode.SnapshotNotFound:      {LanguageES: "Copia de seguridad no encontrada", LanguageEN: "Backup not found"},
+	errcode.StoreFull:             {LanguageES: "El servicio alcanzó el máximo de enlaces almacenados", LanguageEN: "The service reached the maximum number of stored links"},
+	errcode.StreamingUnsupported:  {LanguageES: "La conexión no admite streaming", LanguageEN: "The connection does not support streaming"},
+	errcode.TenantNotFound:        {LanguageES: "Tenant no encontrado", LanguageEN: "Tenant not found"},
+	errcode.TenantQuotaExceeded:   {LanguageES: "El tenant alcanzó el máximo de enlaces permitidos", LanguageEN: "The tenant reached the maximum number of links allowed"},
+	errcode.Timeout:               {LanguageES: "La operación excedió el tiempo límite", LanguageEN: "The operation exceeded the time limit"},
+	errcode.TooEarly:              {LanguageES: "Repite la petición cuando termine el handshake TLS", LanguageEN: "Retry the request once the TLS handshake completes"},
+	errcode.Unauthorized:          {LanguageES: "Se requiere autenticación", LanguageEN: "Authentication required"},
+	errcode.UnknownIdentity:       {LanguageES: "Tu cuenta no tiene acceso a este servicio", LanguageEN: "Your account has no access to this service"},
+	errcode.UnreachableURL:        {LanguageES: "El destino no responde", LanguageEN: "The destination does not respond"},
+	errcode.URLTooLong:            {LanguageES: "La URL supera la longitud máxima permitida", LanguageEN: "The URL exceeds the maximum allowed length"},
+	errcode.UsageQuotaExceeded:    {LanguageES: "La clave de API agotó su cuota mensual", LanguageEN: "The API key used up its monthly quota"},
+	errcode.WebhooksDisabled:      {LanguageES: "Los webhooks no están habilitados", LanguageEN: "Webhooks are not enabled"},
+	errcode.WebSocketRequired:     {LanguageES: "Se requiere una conexión WebSocket", LanguageEN: "A WebSocket connection is required"},
+}
+
+// requestLanguage negocia el idioma de los mensajes con Accept-Language: el de mayor peso (q)
+// que el catálogo tiene, comparando solo el idioma principal (en-US es en)
+func requestLanguage(r *http.Request) string {
+	best, bestQ := DefaultLanguage, 0.0
+	for _, part := range strings.Split(r.Header.Get("Accept-Language"), ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		language, _, _ := strings.Cut(strings.ToLower(tag), "-")
+		if (language == LanguageES || language == LanguageEN) && q > bestQ {
+			best, bestQ = language, q
+		}
+	}
+	return best
+}
+
+// localizeError traduce el mensaje al idioma de la petición y declara el idioma en la respuesta
+func localizeError(w http.ResponseWriter, r *http.Request, response ErrorResponse) ErrorResponse {
+	language := requestLanguage(r)
+	w.Header().Set("Content-Language", language)
+	w.Header().Add("Vary", "Accept-Language")
+	return translateError(language, response)
+}
+
+// translateError traduce el mensaje de un error al idioma indicado según errorMessages
+func translateError(language string, response ErrorResponse) ErrorResponse {
+	if language == DefaultLanguage {
+		return response
+	}
+	if message, ok := errorMessages[response.Error][language]; ok {
+		response.Message = message
+	}
+	return response
+}
+
+// itemError traduce el error de un elemento de una operación masiva al idioma de la petición
+func itemError(r *http.Request, response ErrorResponse) *ErrorResponse {
+	localized := translateError(requestLanguage(r), response)
+	return &localized
+}
@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"acortador-urls/internal/errcode"
+	"acortador-urls/internal/shortener"
+)
+
+// InspectRequest representa la petición POST /api/inspect
+type InspectRequest struct {
+	// URL es la URL corta completa, tal como aparece en el mensaje
+	URL string `json:"url" example:"https://go.example.com/promo"`
+}
+
+// InspectResponse describe el destino y la seguridad de un enlace sin seguir la redirección
+type InspectResponse struct {
+	ShortCode string `json:"short_code"`
+	ShortURL  string `json:"short_url"`
+	// Destination es el destino por defecto; se omite en los enlaces con contraseña, firmados,
+	// desactivados o que no redirigen desde la red del llamador, aunque su seguridad se
+	// comprueba igualmente
+	Destination string     `json:"destination,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	Expired     bool       `json:"expired"`
+	Disabled    bool       `json:"disabled"`
+	// PasswordProtected indica que el destino solo se revela tras aportar la contraseña
+	PasswordProtected bool `json:"password_protected,omitempty"`
+	// Quarantined indica que el enlace muestra una página de aviso por denuncias de abuso
+	Quarantined bool `json:"quarantined,omitempty"`
+	// Verdict es safe, suspicious, blocked, malicious o unknown (el proveedor no respondió)
+	Verdict string `json:"verdict" example:"safe"`
+	// ThreatCheck es clean, malicious, unavailable o disabled (sin proveedor configurado)
+	ThreatCheck string `json:"threat_check" example:"clean"`
+	// Findings son los destinos bloqueados o marcados como amenaza
+	Findings []InspectFinding `json:"findings,omitempty"`
+}
+
+// InspectFinding es un destino que no superó una comprobación
+type InspectFinding struct {
+	Field   string `json:"field" example:"long_url"`
+	URL     string `json:"url"`
+	Verdict string `json:"verdict" example:"blocked"`
+	Reason  string `json:"reason"`
+}
+
+// InspectURL maneja POST /api/inspect: recibe una URL corta completa y retorna su destino, si
+// expiró y el veredicto de seguridad de todos sus destinos, sin contabilizar una visita. Está
+// pensado para que las pasarelas de correo corporativas resuelvan los enlaces antes de entregar
+// los mensajes.
+func (h *Handler) InspectURL(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Content-Type") != "application/json" {
+		h.sendErrorResponse(w, r, http.StatusBadRequest, errcode.InvalidContentType, "Content-Type debe ser application/json")
+		return
+	}
+	var req InspectRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.sendDecodeError(w, r, err)
+		return
+	}
+	key, ok := h.inspectedLinkKey(r, req.URL)
+	if !ok {
+		h.sendErrorResponse(w, r, http.StatusBadRequest, errcode.InvalidURL, "url debe ser una URL corta http o https absoluta")
+		return
+	}
+
+	inspection, err := h.service.InspectLink(r.Context(), key)
+	if err != nil {
+		if status, code, message, ok := storeErrorStatus(err); ok {
+			h.sendErrorResponse(w, r, status, code, message)
+			return
+		}
+		switch {
+		case errors.Is(err, shortener.ErrURLNotFound):
+			h.sendErrorResponse(w, r, http.StatusNotFound, errcode.NotFound, "Código corto no encontrado")
+		default:
+			h.sendErrorResponse(w, r, http.StatusInternalServerError, errcode.Internal, fmt.Sprintf("Error interno: %v", err))
+		}
+		return
+	}
+
+	link := inspection.Link
+	response := InspectResponse{
+		ShortCode:         link.ShortCode,
+		ShortURL:          h.shortURL(r, link),
+		Expired:           link.IsExpired(time.Now()),
+		Disabled:          link.IsDisabled(),
+		PasswordProtected: link.PasswordProtected(),
+		Quarantined:       link.Quarantined,
+		Verdict:           inspection.Verdict,
+		ThreatCheck:       inspection.ThreatCheck,
+	}
+	if !h.hidesDestination(r, link) {
+		response.Destination = link.LongURL
+	}
+	if !link.ExpiresAt.IsZero() {
+		response.ExpiresAt = &link.ExpiresAt
+	}
+	for _, finding := range inspection.Findings {
+		item := InspectFinding{Field: finding.Field, URL: finding.URL, Verdict: finding.Verdict, Reason: finding.Reason}
+		if response.Destination == "" {
+			item.URL = ""
+		}
+		response.Findings = append(response.Findings, item)
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	h.sendJSON(w, http.StatusOK, response)
+}
+
+// inspectedLinkKey retorna la clave del enlace de una URL corta completa: el host elige el
+// dominio personalizado o el tenant como en una visita, /t/{tenant}/ el tenant sin host propio,
+// y el sufijo + de la vista previa se ignora
+func (h *Handler) inspectedLinkKey(r *http.Request, rawURL string) (string, bool) {
+	parsed, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return "", false
+	}
+	path := strings.TrimSuffix(strings.TrimPrefix(parsed.Path, "/"), "+")
+	tenant := ""
+	if rest, ok := strings.CutPrefix(path, "t/"); ok {
+		tenant, path, _ = strings.Cut(rest, "/")
+	} else {
+		tenant = h.service.ResolveTenant(apiKeyFromRequest(r), parsed.Host)
+	}
+	if path == "" || strings.Contains(path, "/") {
+		return "", false
+	}
+	return shortener.TenantKey(tenant, h.service.ScopeCode(parsed.Host, path)), true
+}
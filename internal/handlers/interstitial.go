@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"html/template"
+	"net/http"
+	"net/url"
+	"time"
+
+	"acortador-urls/internal/shortener"
+)
+
+// DefaultInterstitialCountdown es la espera de la página de aviso antes de continuar sola
+const DefaultInterstitialCountdown = 5 * time.Second
+
+// interstitialTemplate es la página de aviso mostrada antes de salir hacia el destino. La
+// cuenta atrás usa meta refresh para funcionar sin JavaScript; el script solo actualiza el
+// contador visible.
+var interstitialTemplate = template.Must(template.New("interstitial").Parse(`<!DOCTYPE html>
+<html lang="es">
+<head>
+<meta charset="utf-8">
+<meta name="robots" content="noindex">
+{{if .Seconds}}<meta http-equiv="refresh" content="{{.Seconds}}; url={{.Destination}}">{{end}}
+<title>Estás saliendo del sitio</title>
+</head>
+<body>
+<h1>Estás saliendo del sitio</h1>
+{{if .Reported}}<p><strong>Atención:</strong> varios visitantes han denunciado este enlace como posiblemente malicioso y está pendiente de revisión.</p>
+{{end}}<p>Este enlace te lleva a <strong>{{.Host}}</strong>:</p>
+<p><a id="destino" href="{{.Destination}}" rel="noopener noreferrer nofollow">{{.Destination}}</a></p>
+{{if .Seconds}}<p>Continuarás automáticamente en <span id="cuenta">{{.Seconds}}</span> segundos.</p>
+<script>
+(function () {
+  var restante = {{.Seconds}};
+  var cuenta = document.getElementById("cuenta");
+  var timer = setInterval(function () {
+    restante--;
+    if (restante <= 0) { clearInterval(timer); return; }
+    cuenta.textContent = restante;
+  }, 1000);
+})();
+</script>{{end}}
+<p><a href="{{.Destination}}" rel="noopener noreferrer nofollow">Continuar</a></p>
+</body>
+</html>
+`))
+
+// interstitialPage son los datos de la página de aviso
+type interstitialPage struct {
+	// Destination es template.URL para no anular los enlaces profundos (itms-apps://, intent://);
+	// el servicio ya rechaza los esquemas peligrosos al crear el enlace
+	Destination template.URL
+	Host        string
+	Seconds     int
+	// Reported advierte de que el enlace está en cuarentena por denuncias
+	Reported bool
+}
+
+// WithInterstitialCountdown define la espera de la página de aviso antes de redirigir; cero
+// exige que el visitante pulse Continuar
+func WithInterstitialCountdown(countdown time.Duration) Option {
+	return func(h *Handler) {
+		h.interstitialCountdown = countdown
+	}
+}
+
+// sendInterstitial responde con la página de aviso en lugar de la redirección. Los enlaces en
+// cuarentena no continúan solos: el visitante debe pulsar Continuar.
+func (h *Handler) sendInterstitial(w http.ResponseWriter, redirect shortener.Redirect) {
+	destination := redirect.URL
+	page := interstitialPage{Destination: template.URL(destination), Host: destination, Seconds: int(h.interstitialCountdown.Seconds()), Reported: redirect.Quarantined}
+	if redirect.Quarantined {
+		page.Seconds = 0
+	}
+	if parsed, err := url.Parse(destination); err == nil && parsed.Host != "" {
+		page.Host = parsed.Host
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	interstitialTemplate.Execute(w, page)
+}
@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"net/http"
+	"net/netip"
+
+	"acortador-urls/internal/shortener"
+)
+
+// IPAccessParams limita las redirecciones de un enlace a las visitas desde ciertas redes
+type IPAccessParams struct {
+	// Allow son las IPs o CIDRs desde las que redirige; vacío admite todas salvo las de Deny
+	Allow []string `json:"allow,omitempty" example:"10.0.0.0/8"`
+	// Deny son las IPs o CIDRs rechazadas aunque estén en Allow
+	Deny []string `json:"deny,omitempty" example:"10.66.0.0/16"`
+}
+
+// toIPAccessPolicy convierte los parámetros de la petición en los del servicio
+func (p *IPAccessParams) toIPAccessPolicy() shortener.IPAccessPolicy {
+	if p == nil {
+		return shortener.IPAccessPolicy{}
+	}
+	return shortener.IPAccessPolicy{Allow: p.Allow, Deny: p.Deny}
+}
+
+// ipAccessResponse convierte las reglas de red del enlace en su representación HTTP
+func ipAccessResponse(policy shortener.IPAccessPolicy) *IPAccessParams {
+	if policy.IsZero() {
+		return nil
+	}
+	return &IPAccessParams{Allow: policy.Allow, Deny: policy.Deny}
+}
+
+// ipRestricted indica si la IP de la petición no puede resolver el enlace; las vistas públicas
+// ocultan entonces su destino como el de los enlaces con contraseña
+func (h *Handler) ipRestricted(r *http.Request, link shortener.Link) bool {
+	ip, _ := netip.ParseAddr(ClientIP(r))
+	return !h.service.AllowsIP(link, ip)
+}
+
+// hidesDestination indica si las vistas públicas (vista previa, /api/resolve, /api/inspect y
+// la consulta GraphQL url) deben ocultar el destino: enlaces con contraseña, firmados,
+// desactivados o restringidos a otras redes, que no redirigen a quien los consulta
+func (h *Handler) hidesDestination(r *http.Request, link shortener.Link) bool {
+	return link.PasswordProtected() || link.Signed || link.IsDisabled() || h.ipRestricted(r, link)
+}
@@ -0,0 +1,539 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"acortador-urls/internal/auth"
+	"acortador-urls/internal/errcode"
+	"acortador-urls/internal/shortener"
+)
+
+// LinkResponse representa un enlace con sus metadatos en las respuestas de gestión
+type LinkResponse struct {
+	ShortCode string `json:"short_code"`
+	ShortURL  string `json:"short_url"`
+	LongURL   string `json:"long_url"`
+	Owner     string `json:"owner,omitempty"`
+	// Domain es el dominio personalizado del enlace; vacío en el dominio principal
+	Domain string `json:"domain,omitempty"`
+	// Workspace es el espacio compartido en el que lo creó un editor
+	Workspace string     `json:"workspace,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// ForwardQuery indica si la query de la URL corta se agrega al destino
+	ForwardQuery bool `json:"forward_query,omitempty"`
+	// UTM son los parámetros de campaña agregados al destino
+	UTM *UTMParams `json:"utm,omitempty"`
+	// PasswordProtected indica si la redirección requiere contraseña
+	PasswordProtected bool `json:"password_protected,omitempty"`
+	// GeoTargets son los destinos alternativos por país o región
+	GeoTargets map[string]string `json:"geo_targets,omitempty"`
+	// DeviceTargets son los destinos alternativos por dispositivo
+	DeviceTargets map[string]string `json:"device_targets,omitempty"`
+	// Variants son los destinos de la prueba A/B con los clics servidos por cada uno
+	Variants []Variant `json:"variants,omitempty"`
+	// StickyVariants indica si cada visitante conserva su variante
+	StickyVariants bool `json:"sticky_variants,omitempty"`
+	// Interstitial indica si se muestra una página de aviso antes de redirigir
+	Interstitial bool `json:"interstitial,omitempty"`
+	// RedirectType es el tipo de redirección: temporary (307) o permanent (301)
+	RedirectType string `json:"redirect_type"`
+	// Cloak es la página que se sirve en lugar de la redirección; se omite si no tiene
+	Cloak *CloakParams `json:"cloak,omitempty"`
+	// Referrers son las procedencias desde las que redirige; se omite si admite todas
+	Referrers *ReferrerParams `json:"referrers,omitempty"`
+	// IPAccess son las redes desde las que redirige; se omite si admite todas
+	IPAccess *IPAccessParams `json:"ip_access,omitempty"`
+	// Signed indica que solo redirige con una URL firmada
+	Signed bool `json:"signed,omitempty"`
+	// DisabledAt y DisabledReason describen la desactivación; se omiten en enlaces activos
+	DisabledAt     *time.Time `json:"disabled_at,omitempty"`
+	DisabledReason string     `json:"disabled_reason,omitempty"`
+	// Quarantined indica que el enlace está en cuarentena por denuncias de abuso
+	Quarantined bool `json:"quarantined,omitempty"`
+	// Health es el resultado de la última comprobación del destino; se omite si no se comprobó
+	Health *LinkHealthResponse `json:"health,omitempty"`
+	// Metadata son los metadatos Open Graph del destino; se omiten si no se obtuvieron
+	Metadata *LinkMetadataSummary `json:"metadata,omitempty"`
+	// Tags son las etiquetas del enlace en orden alfabético
+	Tags []string `json:"tags,omitempty"`
+	// CollectionID es la colección a la que pertenece; se omite si no está en ninguna
+	CollectionID int64 `json:"collection_id,omitempty"`
+	// Description y CustomMetadata son la nota y los metadatos propios del enlace; metadata es
+	// la vista previa del destino
+	Description    string          `json:"description,omitempty"`
+	CustomMetadata json.RawMessage `json:"custom_metadata,omitempty"`
+}
+
+// LinkHealthResponse representa la última comprobación del destino de un enlace
+type LinkHealthResponse struct {
+	CheckedAt  time.Time `json:"checked_at"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	// Failures son las comprobaciones fallidas seguidas
+	Failures int  `json:"failures,omitempty"`
+	Broken   bool `json:"broken"`
+}
+
+// LinkMetadataSummary resume los metadatos Open Graph del destino de un enlace
+type LinkMetadataSummary struct {
+	Title       string    `json:"title,omitempty"`
+	Description string    `json:"description,omitempty"`
+	Image       string    `json:"image,omitempty"`
+	FetchedAt   time.Time `json:"fetched_at"`
+}
+
+// LinkListResponse representa una colección de enlaces; Page y PerPage solo se informan en
+// los listados paginados
+type LinkListResponse struct {
+	URLs    []LinkResponse `json:"urls"`
+	Total   int            `json:"total"`
+	Page    int            `json:"page,omitempty"`
+	PerPage int            `json:"per_page,omitempty"`
+}
+
+// DisableURLRequest representa el cuerpo opcional de la petición para desactivar un enlace
+type DisableURLRequest struct {
+	Reason string `json:"reason,omitempty"`
+}
+
+// UpdateURLRequest representa la petición para cambiar el destino de un enlace
+type UpdateURLRequest struct {
+	LongURL string `json:"long_url"`
+}
+
+// DetailsRequest representa la petición para cambiar la descripción o los metadatos propios de
+// un enlace; los campos ausentes no se modifican y custom_metadata null los elimina
+type DetailsRequest struct {
+	Description    *string         `json:"description,omitempty"`
+	CustomMetadata json.RawMessage `json:"custom_metadata,omitempty"`
+}
+
+// ExtendRequest representa la petición para renovar la expiración de un enlace; se indica una
+// fecha o un plazo que se suma a la expiración actual
+type ExtendRequest struct {
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	TTLSeconds int64      `json:"ttl_seconds,omitempty" example:"2592000"`
+}
+
+// TagsRequest representa la petición para reemplazar las etiquetas de un enlace
+type TagsRequest struct {
+	Tags []string `json:"tags"`
+}
+
+// TagStatsResponse representa los enlaces y visitas de una etiqueta
+type TagStatsResponse struct {
+	Tag    string `json:"tag"`
+	Links  int    `json:"links"`
+	Clicks int64  `json:"clicks"`
+	// BotClicks son las visitas de bots incluidas en Clicks
+	BotClicks int64 `json:"bot_clicks"`
+}
+
+// TagListResponse representa las etiquetas en uso con sus estadísticas
+type TagListResponse struct {
+	Tags []TagStatsResponse `json:"tags"`
+}
+
+// ListMyURLs maneja GET /api/me/urls retornando solo los enlaces del usuario autenticado
+func (h *Handler) ListMyURLs(w http.ResponseWriter, r *http.Request) {
+	claims, ok := auth.ClaimsFromContext(r.Context())
+	if !ok {
+		h.sendErrorResponse(w, r, http.StatusUnauthorized, errcode.Unauthorized, "Se requiere autenticación")
+		return
+	}
+
+	links, err := h.service.ListByOwner(r.Context(), h.tenant(r), claims.Subject)
+	if err != nil {
+		h.sendManagementError(w, r, err)
+		return
+	}
+	response := LinkListResponse{
+		URLs:  make([]LinkResponse, 0, len(links)),
+		Total: len(links),
+	}
+	for _, link := range links {
+		response.URLs = append(response.URLs, h.toLinkResponse(r, link))
+	}
+
+	h.sendJSON(w, http.StatusOK, response)
+}
+
+// ListURLs maneja GET /api/urls?page=&per_page=&sort=&filter=. Los filtros tienen la forma
+// clave:valor (domain, owner, status, tag, collection_id) y pueden repetirse o separarse por comas. Los usuarios
+// ven sus propios enlaces; los administradores, todos.
+func (h *Handler) ListURLs(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	query := shortener.ListQuery{AnyOwner: true, Tenant: h.tenant(r), Sort: params.Get("sort")}
+
+	page, perPage, errs := pageParams(params)
+	for _, filter := range params["filter"] {
+		for _, expr := range strings.Split(filter, ",") {
+			key, value, _ := strings.Cut(strings.TrimSpace(expr), ":")
+			switch key {
+			case "domain":
+				query.Domain = value
+			case "owner":
+				query.Owner, query.AnyOwner = value, false
+			case "status":
+				query.Status = value
+			case "tag":
+				query.Tag = value
+			case "collection_id":
+				id, err := strconv.ParseInt(value, 10, 64)
+				if err != nil || id < 1 {
+					errs = append(errs, &shortener.ValidationError{Field: "filter", Value: expr, Msg: "collection_id debe ser un entero positivo"})
+				}
+				query.CollectionID = id
+			default:
+				errs = append(errs, &shortener.ValidationError{Field: "filter", Value: expr, Msg: "debe tener la forma domain:, owner:, status:, tag: o collection_id:"})
+			}
+		}
+	}
+	if len(errs) > 0 {
+		h.sendQueryError(w, r, errors.Join(errs...))
+		return
+	}
+	query.Offset, query.Limit = (page-1)*perPage, perPage
+
+	result, err := h.service.ListLinks(r.Context(), actorFromRequest(r), query)
+	if err != nil {
+		if errors.As(err, new(*shortener.ValidationError)) {
+			h.sendQueryError(w, r, err)
+			return
+		}
+		h.sendManagementError(w, r, err)
+		return
+	}
+	response := LinkListResponse{
+		URLs:    make([]LinkResponse, 0, len(result.Links)),
+		Total:   result.Total,
+		Page:    page,
+		PerPage: perPage,
+	}
+	for _, link := range result.Links {
+		response.URLs = append(response.URLs, h.toLinkResponse(r, link))
+	}
+
+	h.sendJSON(w, http.StatusOK, response)
+}
+
+// pageParams lee los parámetros page y per_page de un listado paginado
+func pageParams(params url.Values) (page, perPage int, errs []error) {
+	page, perPage = 1, shortener.DefaultListLimit
+	if value := params.Get("page"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 {
+			errs = append(errs, &shortener.ValidationError{Field: "page", Value: value, Msg: "debe ser un entero mayor o igual que 1"})
+		}
+		page = parsed
+	}
+	if value := params.Get("per_page"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			errs = append(errs, &shortener.ValidationError{Field: "per_page", Value: value, Msg: "debe ser un entero"})
+		}
+		perPage = parsed
+	}
+	return page, perPage, errs
+}
+
+// SearchURLs maneja GET /api/urls/search?q=&limit= buscando por URL larga o alias. Todos los
+// términos de q deben aparecer; los usuarios buscan en sus enlaces y los administradores en todos.
+func (h *Handler) SearchURLs(w http.ResponseWriter, r *http.Request) {
+	query := shortener.SearchQuery{Text: r.URL.Query().Get("q"), AnyOwner: true, Tenant: h.tenant(r)}
+	if value := r.URL.Query().Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil {
+			h.sendQueryError(w, r, &shortener.ValidationError{Field: "limit", Value: value, Msg: "debe ser un entero"})
+			return
+		}
+		query.Limit = limit
+	}
+
+	result, err := h.service.SearchLinks(r.Context(), actorFromRequest(r), query)
+	if err != nil {
+		if errors.As(err, new(*shortener.ValidationError)) {
+			h.sendQueryError(w, r, err)
+			return
+		}
+		h.sendManagementError(w, r, err)
+		return
+	}
+	response := LinkListResponse{URLs: make([]LinkResponse, 0, len(result.Links)), Total: result.Total}
+	for _, link := range result.Links {
+		response.URLs = append(response.URLs, h.toLinkResponse(r, link))
+	}
+
+	h.sendJSON(w, http.StatusOK, response)
+}
+
+// sendQueryError responde 400 a parámetros de listado inválidos con el detalle por campo
+func (h *Handler) sendQueryError(w http.ResponseWriter, r *http.Request, err error) {
+	h.sendJSON(w, http.StatusBadRequest, localizeError(w, r, ErrorResponse{
+		Error:   errcode.InvalidQuery,
+		Message: "Parámetros de consulta inválidos",
+		Errors:  validationErrors(err),
+	}))
+}
+
+// UpdateURL maneja PATCH /api/urls/{short_code}; solo el propietario o un admin pueden editar
+func (h *Handler) UpdateURL(w http.ResponseWriter, r *http.Request) {
+	var req UpdateURLRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.sendDecodeError(w, r, err)
+		return
+	}
+
+	link, err := h.service.UpdateURL(r.Context(), actorFromRequest(r), h.managedLinkKey(r), req.LongURL)
+	if err != nil {
+		h.sendManagementError(w, r, err)
+		return
+	}
+
+	h.sendJSON(w, http.StatusOK, h.toLinkResponse(r, link))
+}
+
+// UpdateDetails maneja PATCH /api/urls/{short_code}/details; solo el propietario o un admin
+// pueden cambiar la descripción y los metadatos propios
+func (h *Handler) UpdateDetails(w http.ResponseWriter, r *http.Request) {
+	var req DetailsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.sendDecodeError(w, r, err)
+		return
+	}
+
+	details := shortener.LinkDetails{Description: req.Description, CustomMetadata: req.CustomMetadata}
+	link, err := h.service.UpdateDetails(r.Context(), actorFromRequest(r), h.managedLinkKey(r), details)
+	if err != nil {
+		h.sendManagementError(w, r, err)
+		return
+	}
+
+	h.sendJSON(w, http.StatusOK, h.toLinkResponse(r, link))
+}
+
+// ExtendURL maneja POST /api/urls/{short_code}/extend renovando la expiración del enlace;
+// solo el propietario o un admin pueden renovarla
+func (h *Handler) ExtendURL(w http.ResponseWriter, r *http.Request) {
+	var req ExtendRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.sendDecodeError(w, r, err)
+		return
+	}
+
+	extension := shortener.Extension{TTL: time.Duration(req.TTLSeconds) * time.Second}
+	if req.ExpiresAt != nil {
+		extension.ExpiresAt = *req.ExpiresAt
+	}
+	link, err := h.service.ExtendExpiry(r.Context(), actorFromRequest(r), h.managedLinkKey(r), extension)
+	if err != nil {
+		h.sendManagementError(w, r, err)
+		return
+	}
+
+	h.sendJSON(w, http.StatusOK, h.toLinkResponse(r, link))
+}
+
+// UpdateTags maneja PATCH /api/urls/{short_code}/tags reemplazando las etiquetas del enlace;
+// {"tags": []} las elimina. Solo el propietario o un admin pueden cambiarlas.
+func (h *Handler) UpdateTags(w http.ResponseWriter, r *http.Request) {
+	var req TagsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.sendDecodeError(w, r, err)
+		return
+	}
+
+	link, err := h.service.SetTags(r.Context(), actorFromRequest(r), h.managedLinkKey(r), req.Tags)
+	if err != nil {
+		h.sendManagementError(w, r, err)
+		return
+	}
+
+	h.sendJSON(w, http.StatusOK, h.toLinkResponse(r, link))
+}
+
+// ListTags maneja GET /api/tags con los enlaces y visitas de cada etiqueta. Los usuarios ven
+// las de sus enlaces; los administradores, las de todos.
+func (h *Handler) ListTags(w http.ResponseWriter, r *http.Request) {
+	stats, err := h.service.TagStatistics(r.Context(), actorFromRequest(r), h.tenant(r))
+	if err != nil {
+		h.sendManagementError(w, r, err)
+		return
+	}
+	response := TagListResponse{Tags: make([]TagStatsResponse, 0, len(stats))}
+	for _, s := range stats {
+		response.Tags = append(response.Tags, TagStatsResponse{Tag: s.Tag, Links: s.Links, Clicks: s.Clicks, BotClicks: s.BotClicks})
+	}
+
+	h.sendCacheableJSON(w, r, response)
+}
+
+// DeleteURL maneja DELETE /api/urls/{short_code}; solo el propietario o un admin pueden eliminar.
+// El propietario lo desactiva (borrado lógico) y un admin lo purga definitivamente.
+func (h *Handler) DeleteURL(w http.ResponseWriter, r *http.Request) {
+	if err := h.service.DeleteURL(r.Context(), actorFromRequest(r), h.managedLinkKey(r)); err != nil {
+		h.sendManagementError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DisableURL maneja POST /api/urls/{short_code}:disable; el cuerpo {"reason": "..."} es opcional
+func (h *Handler) DisableURL(w http.ResponseWriter, r *http.Request) {
+	var req DisableURLRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+			h.sendDecodeError(w, r, err)
+			return
+		}
+	}
+
+	link, err := h.service.DisableURL(r.Context(), actorFromRequest(r), h.managedLinkKey(r), req.Reason)
+	if err != nil {
+		h.sendManagementError(w, r, err)
+		return
+	}
+
+	h.sendJSON(w, http.StatusOK, h.toLinkResponse(r, link))
+}
+
+// EnableURL maneja POST /api/urls/{short_code}:enable restaurando un enlace desactivado
+func (h *Handler) EnableURL(w http.ResponseWriter, r *http.Request) {
+	link, err := h.service.EnableURL(r.Context(), actorFromRequest(r), h.managedLinkKey(r))
+	if err != nil {
+		h.sendManagementError(w, r, err)
+		return
+	}
+
+	h.sendJSON(w, http.StatusOK, h.toLinkResponse(r, link))
+}
+
+// sendManagementError traduce errores del servicio a respuestas HTTP en endpoints de gestión
+func (h *Handler) sendManagementError(w http.ResponseWriter, r *http.Request, err error) {
+	status, response := managementErrorResponse(err)
+	h.sendJSON(w, status, localizeError(w, r, response))
+}
+
+// managementErrorResponse construye el estado y el cuerpo de error de una operación de gestión
+func managementErrorResponse(err error) (int, ErrorResponse) {
+	if status, code, message, ok := storeErrorStatus(err); ok {
+		return status, ErrorResponse{Error: code, Message: message}
+	}
+
+	switch {
+	case errors.Is(err, shortener.ErrURLNotFound):
+		return http.StatusNotFound, ErrorResponse{Error: errcode.NotFound, Message: "Código corto no encontrado"}
+	case errors.Is(err, shortener.ErrEmptyURL):
+		return http.StatusBadRequest, ErrorResponse{Error: errcode.MissingCode, Message: "Código corto requerido"}
+	case errors.Is(err, shortener.ErrForbidden):
+		return http.StatusForbidden, ErrorResponse{Error: errcode.Forbidden, Message: "No tienes permiso para gestionar este enlace"}
+	case errors.Is(err, shortener.ErrCollectionNotFound):
+		return http.StatusNotFound, ErrorResponse{Error: errcode.CollectionNotFound, Message: "Colección no encontrada"}
+	case errors.Is(err, shortener.ErrCollectionExists):
+		return http.StatusConflict, ErrorResponse{Error: errcode.CollectionExists, Message: "Ya existe una colección con ese nombre"}
+	case errors.Is(err, shortener.ErrInvalidExpiry):
+		return http.StatusBadRequest, ErrorResponse{Error: errcode.InvalidExpiry, Message: "expires_at debe ser una fecha RFC 3339 en el futuro", Errors: validationErrors(err)}
+	case errors.Is(err, shortener.ErrTransferInvalid):
+		return http.StatusForbidden, ErrorResponse{Error: errcode.InvalidConfirmation, Message: "El traspaso ya no corresponde al enlace ni a su propietario"}
+	case errors.Is(err, shortener.ErrCompactionUnsupported):
+		return http.StatusNotImplemented, ErrorResponse{Error: errcode.CompactionUnsupported, Message: "El almacén no admite compactación"}
+	case errors.Is(err, shortener.ErrSigningDisabled):
+		return http.StatusNotFound, ErrorResponse{Error: errcode.SigningDisabled, Message: "La firma de URLs no está habilitada"}
+	case errors.Is(err, shortener.ErrInvalidCollection):
+		return http.StatusBadRequest, ErrorResponse{Error: errcode.InvalidCollection, Message: "Colección inválida", Errors: validationErrors(err)}
+	case errors.As(err, new(*shortener.ValidationError)):
+		return shortenErrorResponse(err)
+	default:
+		return http.StatusInternalServerError, ErrorResponse{Error: errcode.Internal, Message: fmt.Sprintf("Error interno: %v", err)}
+	}
+}
+
+// toLinkResponse convierte un enlace del dominio en su representación HTTP
+func (h *Handler) toLinkResponse(r *http.Request, link shortener.Link) LinkResponse {
+	response := LinkResponse{
+		ShortCode: link.ShortCode,
+		ShortURL:  h.shortURL(r, link),
+		LongURL:   link.LongURL,
+		Owner:     link.Owner,
+		Domain:    link.Domain,
+		Workspace: link.Workspace,
+		CreatedAt: link.CreatedAt,
+		UpdatedAt: link.UpdatedAt,
+
+		ForwardQuery: link.ForwardQuery,
+		UTM:          utmResponse(link.UTM),
+
+		PasswordProtected: link.PasswordProtected(),
+		GeoTargets:        link.GeoTargets,
+		DeviceTargets:     link.DeviceTargets,
+
+		Variants:       variantsResponse(link.Variants),
+		StickyVariants: link.StickyVariants,
+		Interstitial:   link.Interstitial,
+		RedirectType:   shortener.RedirectTemporary,
+		Cloak:          cloakResponse(link.Cloak),
+		Referrers:      referrerResponse(link.Referrers),
+		IPAccess:       ipAccessResponse(link.IPAccess),
+		Signed:         link.Signed,
+		Quarantined:    link.Quarantined,
+		Tags:           link.Tags,
+		CollectionID:   link.CollectionID,
+		Description:    link.Description,
+		CustomMetadata: link.CustomMetadata,
+	}
+	if link.PermanentRedirect() {
+		response.RedirectType = shortener.RedirectPermanent
+	}
+	if !link.ExpiresAt.IsZero() {
+		response.ExpiresAt = &link.ExpiresAt
+	}
+	if link.IsDisabled() {
+		response.DisabledAt = &link.DisabledAt
+		response.DisabledReason = link.DisabledReason
+	}
+	if link.Health.Checked() {
+		response.Health = &LinkHealthResponse{
+			CheckedAt:  link.Health.CheckedAt,
+			StatusCode: link.Health.StatusCode,
+			Error:      link.Health.Error,
+			Failures:   link.Health.Failures,
+			Broken:     link.Health.Broken,
+		}
+	}
+	if link.Metadata.Fetched() && link.Metadata.Error == "" {
+		response.Metadata = &LinkMetadataSummary{
+			Title:       link.Metadata.Title,
+			Description: link.Metadata.Description,
+			Image:       link.Metadata.Image,
+			FetchedAt:   link.Metadata.FetchedAt,
+		}
+	}
+	return response
+}
+
+// sendJSON envía una respuesta JSON exitosa
+func (h *Handler) sendJSON(w http.ResponseWriter, statusCode int, payload interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(payload)
+}
+
+// actorFromRequest construye el actor del servicio a partir de las claims autenticadas
+func actorFromRequest(r *http.Request) shortener.Actor {
+	claims, ok := auth.ClaimsFromContext(r.Context())
+	if !ok {
+		return shortener.Actor{}
+	}
+	return shortener.Actor{UserID: claims.Subject, Admin: claims.IsAdmin(), Workspace: workspaceFromRequest(r)}
+}
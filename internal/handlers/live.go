@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"acortador-urls/internal/analytics"
+	"acortador-urls/internal/errcode"
+	"acortador-urls/internal/shortener"
+	"acortador-urls/internal/websocket"
+)
+
+// DefaultLiveInterval es la frecuencia por defecto con la que se envían las métricas en vivo
+const DefaultLiveInterval = 5 * time.Second
+
+// visitorKey firma los identificadores de visitante; es aleatoria por proceso para que no se
+// puedan revertir a la IP probando direcciones
+var visitorKey = func() []byte {
+	key := make([]byte, 32)
+	rand.Read(key)
+	return key
+}()
+
+// visitorID identifica de forma anónima al visitante por su IP y User-Agent
+func visitorID(r *http.Request) string {
+	mac := hmac.New(sha256.New, visitorKey)
+	mac.Write([]byte(ClientIP(r)))
+	mac.Write([]byte{0})
+	mac.Write([]byte(r.UserAgent()))
+	return hex.EncodeToString(mac.Sum(nil)[:8])
+}
+
+// WithLiveAnalytics habilita GET /api/analytics/live con las métricas del tracker, enviadas
+// cada interval
+func WithLiveAnalytics(tracker *analytics.Tracker, interval time.Duration) Option {
+	return func(h *Handler) {
+		h.live = tracker
+		h.liveInterval = interval
+	}
+}
+
+// LiveCountersResponse son las métricas en vivo de un enlace
+type LiveCountersResponse struct {
+	ShortCode       string  `json:"short_code"`
+	Owner           string  `json:"owner,omitempty"`
+	Clicks          int64   `json:"clicks"`
+	ClicksPerMinute float64 `json:"clicks_per_minute"`
+	UniqueVisitors  int     `json:"unique_visitors"`
+}
+
+// LiveAnalyticsMessage es cada mensaje del canal de métricas en vivo
+type LiveAnalyticsMessage struct {
+	Time time.Time `json:"time"`
+	// Window es el periodo en segundos sobre el que se calculan las métricas
+	Window int                    `json:"window"`
+	Links  []LiveCountersResponse `json:"links"`
+}
+
+// LiveAnalytics maneja GET /api/analytics/live?short_code=&owner=&tag=, un canal WebSocket que envía
+// periódicamente las visitas por minuto y los visitantes únicos de los enlaces con actividad
+// reciente. Los usuarios reciben sus enlaces; los administradores, todos o los de owner.
+func (h *Handler) LiveAnalytics(w http.ResponseWriter, r *http.Request) {
+	if h.live == nil {
+		h.sendErrorResponse(w, r, http.StatusNotFound, errcode.LiveAnalyticsDisabled, "Las métricas en vivo no están habilitadas")
+		return
+	}
+	params := r.URL.Query()
+	filter := analytics.Filter{ShortCode: params.Get("short_code"), Owner: params.Get("owner"), Tag: params.Get("tag")}
+	actor := actorFromRequest(r)
+	if !actor.Admin {
+		if filter.Owner != "" && filter.Owner != actor.UserID {
+			h.sendManagementError(w, r, shortener.ErrForbidden)
+			return
+		}
+		filter.Owner = actor.UserID
+	}
+
+	conn, err := websocket.Upgrade(w, r)
+	if err != nil {
+		h.sendErrorResponse(w, r, http.StatusBadRequest, errcode.WebSocketRequired, "Se requiere una conexión WebSocket")
+		return
+	}
+	defer conn.Close(websocket.CloseGoingAway)
+
+	interval := h.liveInterval
+	if interval <= 0 {
+		interval = DefaultLiveInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := conn.WriteText(h.liveMessage(filter)); err != nil {
+			return
+		}
+		select {
+		case <-conn.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// liveMessage serializa las métricas actuales que pasan el filtro
+func (h *Handler) liveMessage(filter analytics.Filter) []byte {
+	counters := h.live.Snapshot(filter)
+	message := LiveAnalyticsMessage{
+		Time:   time.Now().UTC(),
+		Window: int(h.live.Window().Seconds()),
+		Links:  make([]LiveCountersResponse, 0, len(counters)),
+	}
+	for _, c := range counters {
+		message.Links = append(message.Links, liveCountersResponse(c))
+	}
+	data, _ := json.Marshal(message)
+	return data
+}
+
+// liveCountersResponse convierte las métricas en vivo de un enlace en su representación HTTP
+func liveCountersResponse(c analytics.LinkCounters) LiveCountersResponse {
+	return LiveCountersResponse{
+		ShortCode:       c.ShortCode,
+		Owner:           c.Owner,
+		Clicks:          c.Clicks,
+		ClicksPerMinute: c.ClicksPerMinute,
+		UniqueVisitors:  c.UniqueVisitors,
+	}
+}
@@ -0,0 +1,380 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+
+	"acortador-urls/internal/auth"
+	"acortador-urls/internal/errcode"
+	"acortador-urls/internal/ratelimit"
+	"acortador-urls/internal/shortener"
+)
+
+// APIKeyHeader es la cabecera con la que los integradores identifican su clave de API
+const APIKeyHeader = "X-API-Key"
+
+// APIKeyParam es el parámetro de query equivalente a APIKeyHeader para los clientes que no
+// pueden enviar cabeceras, como los bookmarklets o las fórmulas de hojas de cálculo
+const APIKeyParam = "api_key"
+
+// Authenticate valida el token Bearer cuando está presente y agrega sus claims al contexto.
+// Las peticiones sin cabecera Authorization continúan como anónimas.
+func Authenticate(tokens *auth.TokenManager) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			header := r.Header.Get("Authorization")
+			if header == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			token, found := strings.CutPrefix(header, "Bearer ")
+			if !found || strings.TrimSpace(token) == "" {
+				writeErrorResponse(w, r, http.StatusUnauthorized, errcode.InvalidToken, "Cabecera Authorization debe usar el esquema Bearer")
+				return
+			}
+
+			claims, err := tokens.Verify(strings.TrimSpace(token))
+			if err != nil {
+				switch {
+				case errors.Is(err, auth.ErrExpiredToken):
+					writeErrorResponse(w, r, http.StatusUnauthorized, errcode.ExpiredToken, "El token ha expirado")
+				default:
+					writeErrorResponse(w, r, http.StatusUnauthorized, errcode.InvalidToken, "Token inválido")
+				}
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(auth.WithClaims(r.Context(), claims)))
+		})
+	}
+}
+
+// AuthenticateAPIKeys autentica con su clave de API las peticiones que no traen token: si la
+// clave tiene una identidad registrada, sus claims se agregan al contexto como las de un token.
+// Debe ir después de Authenticate. Las claves sin identidad siguen siendo anónimas y solo
+// identifican al cliente ante el limitador, las cuotas y los tenants.
+func AuthenticateAPIKeys(keys auth.APIKeys) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, ok := auth.ClaimsFromContext(r.Context()); !ok {
+				if claims, found := keys[apiKeyFromRequest(r)]; found {
+					r = r.WithContext(auth.WithClaims(r.Context(), claims))
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireAuth rechaza con 401 las peticiones que no traen una identidad autenticada
+func RequireAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := auth.ClaimsFromContext(r.Context()); !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="acortador"`)
+			writeErrorResponse(w, r, http.StatusUnauthorized, errcode.Unauthorized, "Se requiere autenticación")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireAdmin rechaza con 403 a los usuarios que no son administradores. Debe ir después de
+// RequireAuth; sin identidad también responde 403.
+func RequireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if claims, ok := auth.ClaimsFromContext(r.Context()); !ok || !claims.IsAdmin() {
+			writeErrorResponse(w, r, http.StatusForbidden, errcode.Forbidden, "Se requieren permisos de administrador")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireRole rechaza con 403 a los usuarios sin alguno de los roles indicados. Debe ir
+// después de RequireAuth; sin identidad también responde 403. La propiedad de cada enlace la
+// comprueba además el servicio.
+func RequireRole(roles ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if claims, ok := auth.ClaimsFromContext(r.Context()); !ok || !claims.HasRole(roles...) {
+				writeErrorResponse(w, r, http.StatusForbidden, errcode.Forbidden,
+					fmt.Sprintf("Se requiere uno de los roles: %s", strings.Join(roles, ", ")))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RateLimit aplica el limitador por cliente: por clave de API si known la reconoce como
+// configurada, si no por IP, de modo que inventar una clave en cada petición no da un bucket
+// nuevo. Con known nil se limita siempre por IP. Cuando se agota el bucket responde 429 con la
+// cabecera Retry-After en segundos.
+func RateLimit(limiter ratelimit.Limiter, known func(apiKey string) bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			allowed, retryAfter := limiter.Allow(rateLimitKey(r, known))
+			if !allowed {
+				seconds := int(math.Ceil(retryAfter.Seconds()))
+				if seconds < 1 {
+					seconds = 1
+				}
+				w.Header().Set("Retry-After", strconv.Itoa(seconds))
+				writeErrorResponse(w, r, http.StatusTooManyRequests, errcode.RateLimited, "Demasiadas peticiones, intenta de nuevo más tarde")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RateLimitPasswords aplica el limitador solo a las peticiones que aportan la contraseña de un
+// enlace protegido en la cabecera o con ?key=, de modo que las redirecciones normales no
+// consumen el bucket pero cada contraseña probada sí
+func RateLimitPasswords(limiter ratelimit.Limiter, known func(apiKey string) bool) func(http.Handler) http.Handler {
+	limit := RateLimit(limiter, known)
+	return func(next http.Handler) http.Handler {
+		limited := limit(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get(LinkPasswordHeader) == "" && !r.URL.Query().Has(shortener.PasswordQueryParam) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			limited.ServeHTTP(w, r)
+		})
+	}
+}
+
+// rateLimitKey identifica al cliente para el limitador
+func rateLimitKey(r *http.Request, known func(apiKey string) bool) string {
+	if apiKey := apiKeyFromRequest(r); apiKey != "" && known != nil && known(apiKey) {
+		return "key:" + apiKey
+	}
+	return "ip:" + ClientIP(r)
+}
+
+// apiKeyFromRequest retorna la clave de API de la cabecera o, en su defecto, de la query
+func apiKeyFromRequest(r *http.Request) string {
+	if apiKey := strings.TrimSpace(r.Header.Get(APIKeyHeader)); apiKey != "" {
+		return apiKey
+	}
+	return strings.TrimSpace(r.URL.Query().Get(APIKeyParam))
+}
+
+// Timeout limita la duración de cada petición. El handler recibe un contexto con deadline y
+// escribe sobre un buffer; si el deadline vence antes de que termine se responde 408 y su
+// salida se descarta. Una duración cero o negativa desactiva el límite.
+func Timeout(timeout time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if timeout <= 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+
+			tw := &timeoutWriter{header: make(http.Header)}
+			done := make(chan struct{})
+			panicked := make(chan interface{}, 1)
+			go func() {
+				defer func() {
+					if p := recover(); p != nil {
+						panicked <- p
+					}
+				}()
+				next.ServeHTTP(tw, r.WithContext(ctx))
+				close(done)
+			}()
+
+			select {
+			case p := <-panicked:
+				// Se relanza en la goroutine del servidor para que actúe Recoverer
+				panic(p)
+			case <-done:
+				tw.flushTo(w)
+			case <-ctx.Done():
+				tw.abandon()
+				if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+					writeErrorResponse(w, r, http.StatusRequestTimeout, errcode.RequestTimeout,
+						fmt.Sprintf("La petición superó el tiempo límite de %s", timeout))
+				}
+			}
+		})
+	}
+}
+
+// timeoutWriter acumula la respuesta del handler hasta saber si terminó dentro del plazo
+type timeoutWriter struct {
+	mu        sync.Mutex
+	header    http.Header
+	body      bytes.Buffer
+	status    int
+	abandoned bool
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.header
+}
+
+func (tw *timeoutWriter) WriteHeader(status int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.status == 0 {
+		tw.status = status
+	}
+}
+
+func (tw *timeoutWriter) Write(p []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.abandoned {
+		return 0, http.ErrHandlerTimeout
+	}
+	if tw.status == 0 {
+		tw.status = http.StatusOK
+	}
+	return tw.body.Write(p)
+}
+
+// abandon marca la respuesta como descartada; las escrituras posteriores fallan
+func (tw *timeoutWriter) abandon() {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	tw.abandoned = true
+}
+
+// flushTo copia cabeceras, estado y cuerpo acumulados al ResponseWriter real
+func (tw *timeoutWriter) flushTo(w http.ResponseWriter) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	for key, values := range tw.header {
+		w.Header()[key] = values
+	}
+	if tw.status == 0 {
+		tw.status = http.StatusOK
+	}
+	w.WriteHeader(tw.status)
+	w.Write(tw.body.Bytes())
+}
+
+// MaxBodySize rechaza con 413 los cuerpos que superan el límite indicado. Las peticiones que
+// declaran Content-Length se rechazan sin leerlas; el resto se envuelve con http.MaxBytesReader
+// y el handler traduce el error de lectura a 413.
+func MaxBodySize(limit int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > limit {
+				writeErrorResponse(w, r, http.StatusRequestEntityTooLarge, errcode.PayloadTooLarge, bodyTooLargeMessage(limit))
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, limit)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RejectEarlyData responde 425 Too Early (RFC 8470) a las peticiones no idempotentes que llegan
+// en datos 0-RTT, antes de completar el handshake TLS: un atacante podría repetirlas. Las GET y
+// HEAD, como las redirecciones, se atienden sin esperar al handshake.
+func RejectEarlyData(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS != nil && !r.TLS.HandshakeComplete && r.Method != http.MethodGet && r.Method != http.MethodHead {
+			writeErrorResponse(w, r, http.StatusTooEarly, errcode.TooEarly, "Repite la petición cuando termine el handshake TLS")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// bodyTooLargeMessage describe el límite de tamaño de cuerpo superado
+func bodyTooLargeMessage(limit int64) string {
+	return fmt.Sprintf("El cuerpo de la petición no puede superar %d bytes", limit)
+}
+
+// CORSOptions configura las cabeceras CORS para clientes web de otros dominios
+type CORSOptions struct {
+	// AllowedOrigins son los orígenes permitidos; "*" admite cualquiera
+	AllowedOrigins []string
+	// AllowedMethods son los métodos anunciados en las respuestas preflight
+	AllowedMethods []string
+	// AllowedHeaders son las cabeceras que el navegador puede enviar
+	AllowedHeaders []string
+	// MaxAge es el tiempo que el navegador puede cachear la respuesta preflight
+	MaxAge time.Duration
+}
+
+// CORS agrega las cabeceras Access-Control-* a las peticiones de orígenes permitidos y
+// responde directamente las peticiones preflight con 204. Sin orígenes configurados el
+// middleware no modifica ninguna respuesta.
+func CORS(opts CORSOptions) func(http.Handler) http.Handler {
+	allowAll := false
+	allowed := make(map[string]bool, len(opts.AllowedOrigins))
+	for _, origin := range opts.AllowedOrigins {
+		if origin == "*" {
+			allowAll = true
+		}
+		allowed[strings.TrimSuffix(origin, "/")] = true
+	}
+	methods := strings.Join(opts.AllowedMethods, ", ")
+	headers := strings.Join(opts.AllowedHeaders, ", ")
+	maxAge := strconv.Itoa(int(opts.MaxAge.Seconds()))
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			if origin == "" || (!allowAll && !allowed[origin]) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// La respuesta depende del origen, por lo que las cachés deben distinguirlo
+			w.Header().Add("Vary", "Origin")
+			if allowAll {
+				w.Header().Set("Access-Control-Allow-Origin", "*")
+			} else {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+			}
+
+			if r.Method != http.MethodOptions || r.Header.Get("Access-Control-Request-Method") == "" {
+				w.Header().Set("Access-Control-Expose-Headers", "Location, Retry-After")
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// Preflight: se responde sin llegar al router
+			w.Header().Add("Vary", "Access-Control-Request-Method")
+			w.Header().Add("Vary", "Access-Control-Request-Headers")
+			w.Header().Set("Access-Control-Allow-Methods", methods)
+			w.Header().Set("Access-Control-Allow-Headers", headers)
+			if opts.MaxAge > 0 {
+				w.Header().Set("Access-Control-Max-Age", maxAge)
+			}
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
+
+// CompressibleContentTypes son los tipos de respuesta que Compress comprime
+var CompressibleContentTypes = []string{"application/json", "text/html", "text/csv"}
+
+// Compress negocia gzip o deflate según Accept-Encoding para las respuestas JSON, HTML y CSV.
+// El nivel va de 1 (más rápido) a 9 (mejor compresión); 0 desactiva la compresión.
+func Compress(level int) func(http.Handler) http.Handler {
+	if level == 0 {
+		return func(next http.Handler) http.Handler {
+			return next
+		}
+	}
+	return middleware.Compress(level, CompressibleContentTypes...)
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"html/template"
+	"net/http"
+	"strings"
+
+	"acortador-urls/internal/errcode"
+)
+
+// notFoundPage son los datos disponibles en la plantilla de NOT_FOUND_PAGE
+type notFoundPage struct {
+	// ShortCode es el código visitado
+	ShortCode string
+	// Expired distingue un enlace expirado (410) de uno inexistente (404)
+	Expired bool
+	// Disabled indica un enlace desactivado (410); Message incluye entonces el motivo
+	Disabled bool
+	// Message es el mensaje que recibiría un cliente JSON
+	Message string
+	// Status es el código HTTP de la respuesta
+	Status int
+}
+
+// WithNotFoundPage sirve la plantilla indicada cuando un código de redirección no existe o
+// expiró, en lugar del error JSON
+func WithNotFoundPage(page *template.Template) Option {
+	return func(h *Handler) {
+		h.notFoundPage = page
+	}
+}
+
+// WithFallbackURL redirige a la URL indicada cuando un código de redirección no existe o expiró
+func WithFallbackURL(fallback string) Option {
+	return func(h *Handler) {
+		h.fallbackURL = fallback
+	}
+}
+
+// sendMissingLink responde a una visita de un código inexistente, expirado o desactivado con la página de
+// marca o la URL de respaldo si están configuradas. Los clientes que piden JSON explícitamente
+// siguen recibiendo el error JSON.
+func (h *Handler) sendMissingLink(w http.ResponseWriter, r *http.Request, status int, code errcode.Code, message string) {
+	if strings.Contains(r.Header.Get("Accept"), "application/json") {
+		h.sendErrorResponse(w, r, status, code, message)
+		return
+	}
+
+	switch {
+	case h.fallbackURL != "":
+		w.Header().Set("Cache-Control", "no-store")
+		http.Redirect(w, r, h.fallbackURL, http.StatusFound)
+	case h.notFoundPage != nil:
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(status)
+		h.notFoundPage.Execute(w, notFoundPage{
+			ShortCode: shortCodeParam(r),
+			Expired:   status == http.StatusGone,
+			Status:    status,
+		})
+	default:
+		h.sendErrorResponse(w, r, status, code, message)
+	}
+}
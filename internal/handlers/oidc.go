@@ -0,0 +1,242 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"acortador-urls/internal/auth"
+	"acortador-urls/internal/errcode"
+	"acortador-urls/internal/oidc"
+)
+
+// OIDCPath es la ruta en la que se monta el inicio de sesión con el proveedor de identidad
+const OIDCPath = "/auth/oidc"
+
+// oidcFlowCookie guarda el state, el nonce y el verificador PKCE mientras el usuario está en
+// el proveedor
+const oidcFlowCookie = "oidc_flow"
+
+// oidcFlowTTL es el tiempo del que dispone el usuario para completar el inicio de sesión
+const oidcFlowTTL = 10 * time.Minute
+
+// Modos del inicio de sesión: el panel guarda la sesión en su cookie y la API responde el token
+const (
+	oidcModeUI  = "ui"
+	oidcModeAPI = "api"
+)
+
+// oidcContinueTemplate lleva al panel tras el callback. Es una navegación nueva en lugar de
+// una redirección porque la cookie SameSite=Strict de la sesión no se envía en una cadena de
+// redirecciones iniciada por el proveedor.
+var oidcContinueTemplate = template.Must(template.New("oidc").Parse(`<!DOCTYPE html>
+<html lang="es">
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="0;url={{.}}">
+<title>Iniciando sesión</title>
+</head>
+<body><p><a href="{{.}}">Continuar al panel</a></p></body>
+</html>
+`))
+
+// OIDCLogin configura el inicio de sesión con un proveedor de identidad externo
+type OIDCLogin struct {
+	Provider *oidc.Provider
+	// Name es el nombre del proveedor mostrado en el panel (p. ej. GitHub)
+	Name string
+	// SubjectClaim es el claim de la identidad con el que se busca al usuario interno
+	SubjectClaim string
+	// Users son los usuarios internos de cada identidad, en minúsculas
+	Users map[string]*auth.Claims
+	// DefaultRole es el rol de las identidades sin usuario interno, que actúan con su propio
+	// nombre; vacío las rechaza
+	DefaultRole string
+}
+
+// WithOIDCLogin habilita el inicio de sesión con el proveedor en OIDCPath y su botón en el
+// panel de administración
+func WithOIDCLogin(login *OIDCLogin) Option {
+	return func(h *Handler) {
+		h.oidc = login
+	}
+}
+
+// claims traduce la identidad externa al usuario interno. Si la identidad se busca por email,
+// el proveedor no debe declararlo como no verificado.
+func (l *OIDCLogin) claims(identity oidc.Identity) (auth.Claims, bool) {
+	subject := strings.ToLower(identity.Claim(l.SubjectClaim))
+	if subject == "" || (l.SubjectClaim == "email" && !identity.EmailVerified()) {
+		return auth.Claims{}, false
+	}
+	if claims, ok := l.Users[subject]; ok {
+		return *claims, true
+	}
+	if l.DefaultRole == "" {
+		return auth.Claims{}, false
+	}
+	return auth.Claims{Subject: subject, Role: l.DefaultRole}, true
+}
+
+// OIDCTokenResponse es la respuesta del callback en modo API
+type OIDCTokenResponse struct {
+	Token     string     `json:"token"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Subject   string     `json:"subject"`
+	Role      string     `json:"role"`
+	Workspace string     `json:"workspace,omitempty"`
+}
+
+// OIDC retorna el inicio de sesión con el proveedor de identidad, que se monta en OIDCPath.
+// GET /login redirige al proveedor y GET /callback canjea el código, traduce la identidad al
+// usuario interno con su rol y emite un token propio con tokens: en el modo por defecto abre
+// la sesión del panel (solo administradores) y con ?mode=api responde el token en JSON para
+// usarlo como Bearer en la API.
+func (h *Handler) OIDC(tokens *auth.TokenManager) http.Handler {
+	r := chi.NewRouter()
+	r.Get("/login", h.oidcLogin)
+	r.Get("/callback", h.oidcCallback(tokens))
+	return r
+}
+
+// oidcLogin maneja GET /auth/oidc/login guardando el flujo en una cookie firmada
+func (h *Handler) oidcLogin(w http.ResponseWriter, r *http.Request) {
+	mode := oidcModeUI
+	if r.URL.Query().Get("mode") == oidcModeAPI {
+		mode = oidcModeAPI
+	}
+	state, nonce, verifier := oidc.RandomString(), oidc.RandomString(), oidc.RandomString()
+	value := strings.Join([]string{state, nonce, verifier, mode}, ".")
+
+	// SameSite=Lax para que la cookie llegue en la vuelta desde el proveedor
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcFlowCookie,
+		Value:    value + "." + signOIDCFlow(value),
+		Path:     OIDCPath,
+		MaxAge:   int(oidcFlowTTL / time.Second),
+		HttpOnly: true,
+		Secure:   RequestScheme(r) == "https",
+		SameSite: http.SameSiteLaxMode,
+	})
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, r, h.oidc.Provider.AuthCodeURL(state, nonce, verifier), http.StatusFound)
+}
+
+// signOIDCFlow firma el flujo con la clave de los tokens CSRF del panel
+func signOIDCFlow(value string) string {
+	mac := hmac.New(sha256.New, csrfKey)
+	mac.Write([]byte(value))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// oidcFlow es el inicio de sesión en curso guardado en la cookie
+type oidcFlow struct {
+	state, nonce, verifier, mode string
+}
+
+// readOIDCFlow lee y borra la cookie del flujo; ok es false si falta o su firma no es válida
+func readOIDCFlow(w http.ResponseWriter, r *http.Request) (flow oidcFlow, ok bool) {
+	cookie, err := r.Cookie(oidcFlowCookie)
+	if err != nil {
+		return oidcFlow{mode: oidcModeUI}, false
+	}
+	http.SetCookie(w, &http.Cookie{Name: oidcFlowCookie, Path: OIDCPath, MaxAge: -1, HttpOnly: true,
+		Secure: RequestScheme(r) == "https", SameSite: http.SameSiteLaxMode})
+
+	parts := strings.Split(cookie.Value, ".")
+	if len(parts) != 5 {
+		return oidcFlow{mode: oidcModeUI}, false
+	}
+	value := strings.Join(parts[:4], ".")
+	flow = oidcFlow{state: parts[0], nonce: parts[1], verifier: parts[2], mode: parts[3]}
+	return flow, hmac.Equal([]byte(parts[4]), []byte(signOIDCFlow(value)))
+}
+
+// oidcCallback maneja GET /auth/oidc/callback, al que vuelve el usuario desde el proveedor
+func (h *Handler) oidcCallback(tokens *auth.TokenManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		flow, ok := readOIDCFlow(w, r)
+		query := r.URL.Query()
+		if !ok || !hmac.Equal([]byte(query.Get("state")), []byte(flow.state)) {
+			h.sendOIDCError(w, r, flow.mode, http.StatusBadRequest, errcode.InvalidState,
+				"El inicio de sesión expiró o no se inició aquí, vuelve a intentarlo")
+			return
+		}
+		if query.Get("error") != "" || query.Get("code") == "" {
+			h.sendOIDCError(w, r, flow.mode, http.StatusUnauthorized, errcode.AccessDenied,
+				"El proveedor de identidad no autorizó el inicio de sesión")
+			return
+		}
+
+		identity, err := h.oidc.Provider.Exchange(r.Context(), query.Get("code"), flow.verifier, flow.nonce)
+		if err != nil {
+			if errors.Is(err, oidc.ErrInvalidIDToken) {
+				h.sendOIDCError(w, r, flow.mode, http.StatusUnauthorized, errcode.InvalidToken,
+					"El proveedor de identidad retornó un token inválido")
+				return
+			}
+			log.Printf("Error en el inicio de sesión con %s: %v", h.oidc.Name, err)
+			h.sendOIDCError(w, r, flow.mode, http.StatusBadGateway, errcode.IdentityProviderError,
+				"No se pudo completar el inicio de sesión con el proveedor de identidad")
+			return
+		}
+		claims, ok := h.oidc.claims(identity)
+		if !ok {
+			h.sendOIDCError(w, r, flow.mode, http.StatusForbidden, errcode.UnknownIdentity,
+				"Tu cuenta no tiene acceso a este servicio")
+			return
+		}
+		if flow.mode == oidcModeUI && !claims.IsAdmin() {
+			h.sendOIDCError(w, r, flow.mode, http.StatusForbidden, errcode.Forbidden,
+				"Se requieren permisos de administrador")
+			return
+		}
+
+		token, err := tokens.IssueClaims(claims)
+		if err != nil {
+			log.Printf("Error emitiendo el token de %s: %v", claims.Subject, err)
+			h.sendOIDCError(w, r, flow.mode, http.StatusInternalServerError, errcode.Internal,
+				"No se pudo emitir el token de sesión")
+			return
+		}
+		issued, err := tokens.Verify(token)
+		if err != nil {
+			h.sendOIDCError(w, r, flow.mode, http.StatusInternalServerError, errcode.Internal,
+				"No se pudo emitir el token de sesión")
+			return
+		}
+
+		if flow.mode == oidcModeAPI {
+			response := OIDCTokenResponse{Token: token, Subject: issued.Subject, Role: issued.Role, Workspace: issued.Workspace}
+			if issued.ExpiresAt > 0 {
+				expiresAt := time.Unix(issued.ExpiresAt, 0).UTC()
+				response.ExpiresAt = &expiresAt
+			}
+			w.Header().Set("Cache-Control", "no-store")
+			h.sendJSON(w, http.StatusOK, response)
+			return
+		}
+		setAdminSession(w, r, token, issued)
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		oidcContinueTemplate.Execute(w, AdminUIPath+"/")
+	}
+}
+
+// sendOIDCError responde al error del callback: en el modo del panel con su página de inicio
+// de sesión y en el modo API con un ErrorResponse
+func (h *Handler) sendOIDCError(w http.ResponseWriter, r *http.Request, mode string, status int, code errcode.Code, message string) {
+	if mode == oidcModeAPI {
+		writeErrorResponse(w, r, status, code, message)
+		return
+	}
+	h.renderAdminUI(w, r, status, "login", adminUIPage{Title: "Iniciar sesión", Error: message})
+}
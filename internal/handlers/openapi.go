@@ -0,0 +1,914 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"acortador-urls/internal/errcode"
+)
+
+// openAPISchemas son los tipos publicados en components.schemas. Los esquemas se derivan por
+// reflexión de las etiquetas json de cada struct, de modo que la especificación no se
+// desincroniza al agregar o renombrar campos.
+var openAPISchemas = []interface{}{
+	ShortenRequest{},
+	UTMParams{},
+	Variant{},
+	CloakParams{},
+	ReferrerParams{},
+	IPAccessParams{},
+	ShortenResponse{},
+	ErrorResponse{},
+	FieldError{},
+	BatchShortenRequest{},
+	BatchItemResult{},
+	BatchShortenResponse{},
+	ResolveRequest{},
+	ResolveItemResult{},
+	ResolveResponse{},
+	InspectRequest{},
+	InspectResponse{},
+	InspectFinding{},
+	PreviewResponse{},
+	LinkMetadataResponse{},
+	LinkResponse{},
+	LinkListResponse{},
+	UpdateURLRequest{},
+	DetailsRequest{},
+	ExtendRequest{},
+	SignRequest{},
+	SignedURLResponse{},
+	TransferRequest{},
+	TransferResponse{},
+	TagsRequest{},
+	TagStatsResponse{},
+	TagListResponse{},
+	CollectionRequest{},
+	CollectionResponse{},
+	CollectionListResponse{},
+	CollectionLinksRequest{},
+	CollectionLinkResult{},
+	CollectionLinksResponse{},
+	DisableURLRequest{},
+	ImportRowError{},
+	ImportResponse{},
+	AuditEntryResponse{},
+	AuditListResponse{},
+	ReportRequest{},
+	ReportResponse{},
+	ReportListResponse{},
+	BulkDisableRequest{},
+	BulkDisableResult{},
+	BulkDisableResponse{},
+	BatchUpdateRequest{},
+	BatchUpdateResult{},
+	BatchUpdateResponse{},
+	BatchDeleteRequest{},
+	BatchDeleteResult{},
+	BatchDeleteResponse{},
+	DomainPolicyResponse{},
+	CustomDomainRequest{},
+	CustomDomainResponse{},
+	CustomDomainListResponse{},
+	TenantStatsResponse{},
+	TenantListResponse{},
+	OIDCTokenResponse{},
+	KeyUsageResponse{},
+	DebugStatsResponse{},
+	HeapStatsResponse{},
+	StoreStatsResponse{},
+	StoreMemoryResponse{},
+	CompactionResponse{},
+	StatsResponse{},
+	CodeGenerationStatsResponse{},
+	CacheStatsResponse{},
+	BrokenLinkResponse{},
+	BrokenLinksResponse{},
+	WebhookDeliveryResponse{},
+	WebhookDeliveriesResponse{},
+	BackupResponse{},
+	BackupListResponse{},
+	RestoreRequest{},
+	RestoreResponse{},
+	StreamEventResponse{},
+	LiveCountersResponse{},
+	LiveAnalyticsMessage{},
+	SummaryReportResponse{},
+	TopLinkResponse{},
+	TopReferrerResponse{},
+	TopCountryResponse{},
+	UserDataConfirmationResponse{},
+	UserDataExportResponse{},
+	UserDataDeletionResponse{},
+}
+
+// errorCodeSchema es el esquema publicado con todos los códigos de errcode, al que se refieren
+// los campos error de las respuestas
+const errorCodeSchema = "ErrorCode"
+
+// openAPIOperation describe una operación de la API para la especificación
+type openAPIOperation struct {
+	method    string
+	path      string
+	summary   string
+	tag       string
+	auth      bool     // requiere token Bearer
+	pathParam bool     // recibe los parámetros de ruta entre llaves (p. ej. {short_code})
+	query     []string // parámetros de query opcionales
+	request   string   // esquema del cuerpo, vacío si no tiene
+	optional  bool     // el cuerpo puede omitirse
+	// plainText acepta también el cuerpo como formulario o text/plain y responde en text/plain
+	// si Accept lo prefiere
+	plainText bool
+	responses map[int]string
+}
+
+// openAPIOperations enumera los endpoints registrados en cmd/api/main.go
+var openAPIOperations = []openAPIOperation{
+	{
+		method: http.MethodPost, path: "/shorten", tag: "enlaces",
+		summary: "Acorta una URL", request: "ShortenRequest", plainText: true,
+		responses: map[int]string{
+			http.StatusOK: "ShortenResponse", http.StatusCreated: "ShortenResponse",
+			http.StatusBadRequest: "ErrorResponse", http.StatusConflict: "ErrorResponse",
+			http.StatusRequestEntityTooLarge: "ErrorResponse", http.StatusUnprocessableEntity: "ErrorResponse",
+			http.StatusPaymentRequired: "ErrorResponse", http.StatusTooManyRequests: "ErrorResponse",
+			http.StatusServiceUnavailable: "ErrorResponse",
+		},
+	},
+	{
+		method: http.MethodPost, path: "/shorten/batch", tag: "enlaces",
+		summary: "Acorta un lote de URLs", request: "BatchShortenRequest",
+		responses: map[int]string{
+			http.StatusOK: "BatchShortenResponse", http.StatusBadRequest: "ErrorResponse",
+			http.StatusRequestEntityTooLarge: "ErrorResponse", http.StatusTooManyRequests: "ErrorResponse",
+		},
+	},
+	{
+		method: http.MethodPost, path: "/shorten/form", tag: "enlaces",
+		summary: "Acorta una URL desde el formulario HTML de la página de inicio (campos long_url y alias)",
+		responses: map[int]string{
+			http.StatusOK: "", http.StatusCreated: "", http.StatusBadRequest: "", http.StatusConflict: "",
+			http.StatusRequestEntityTooLarge: "ErrorResponse", http.StatusTooManyRequests: "ErrorResponse",
+		},
+	},
+	{
+		method: http.MethodGet, path: "/api/shorten", tag: "enlaces", query: []string{"url", APIKeyParam},
+		summary: "Acorta una URL con un GET y responde la URL corta en texto plano (bookmarklets); reutiliza el enlace existente",
+		responses: map[int]string{
+			http.StatusOK: "", http.StatusCreated: "", http.StatusBadRequest: "", http.StatusUnprocessableEntity: "",
+			http.StatusPaymentRequired: "", http.StatusTooManyRequests: "",
+		},
+	},
+	{
+		method: http.MethodPost, path: "/graphql", tag: "graphql",
+		summary: "Consultas y mutaciones GraphQL sobre los enlaces",
+		responses: map[int]string{
+			http.StatusOK: "", http.StatusBadRequest: "ErrorResponse", http.StatusTooManyRequests: "ErrorResponse",
+		},
+	},
+	{
+		method: http.MethodGet, path: "/{short_code}", tag: "redirección", pathParam: true,
+		summary: "Redirige a la URL larga",
+		responses: map[int]string{
+			http.StatusTemporaryRedirect: "", http.StatusMovedPermanently: "", http.StatusUnauthorized: "ErrorResponse", http.StatusForbidden: "ErrorResponse",
+			http.StatusNotFound: "ErrorResponse", http.StatusGone: "ErrorResponse", http.StatusTooManyRequests: "ErrorResponse",
+		},
+	},
+	{
+		method: http.MethodPost, path: "/{short_code}", tag: "redirección", pathParam: true,
+		summary: "Envía la contraseña de un enlace protegido (formulario con el campo password)",
+		responses: map[int]string{
+			http.StatusSeeOther: "", http.StatusUnauthorized: "ErrorResponse", http.StatusForbidden: "ErrorResponse",
+			http.StatusNotFound: "ErrorResponse", http.StatusTooManyRequests: "ErrorResponse",
+		},
+	},
+	{
+		method: http.MethodPost, path: "/report/{short_code}", tag: "redirección", pathParam: true,
+		summary: "Denuncia un enlace malicioso", request: "ReportRequest",
+		responses: map[int]string{
+			http.StatusAccepted: "ReportResponse", http.StatusBadRequest: "ErrorResponse",
+			http.StatusNotFound: "ErrorResponse", http.StatusTooManyRequests: "ErrorResponse",
+		},
+	},
+	{
+		method: http.MethodGet, path: "/{short_code}+", tag: "redirección", pathParam: true,
+		summary: "Vista previa del destino sin contabilizar la visita",
+		responses: map[int]string{
+			http.StatusOK: "PreviewResponse", http.StatusNotModified: "", http.StatusNotFound: "ErrorResponse",
+		},
+	},
+	{
+		method: http.MethodGet, path: "/t/{tenant}/{short_code}", tag: "redirección", pathParam: true,
+		summary: "Redirige a la URL larga de un enlace de un tenant sin host propio",
+		responses: map[int]string{
+			http.StatusTemporaryRedirect: "", http.StatusMovedPermanently: "", http.StatusUnauthorized: "ErrorResponse", http.StatusForbidden: "ErrorResponse",
+			http.StatusNotFound: "ErrorResponse", http.StatusGone: "ErrorResponse",
+		},
+	},
+	{
+		method: http.MethodPost, path: "/api/resolve", tag: "enlaces",
+		summary: "Resuelve varios códigos cortos", request: "ResolveRequest",
+		responses: map[int]string{
+			http.StatusOK: "ResolveResponse", http.StatusBadRequest: "ErrorResponse",
+		},
+	},
+	{
+		method: http.MethodPost, path: "/api/inspect", tag: "enlaces",
+		summary: "Destino y veredicto de seguridad de una URL corta, sin contabilizar la visita", request: "InspectRequest",
+		responses: map[int]string{
+			http.StatusOK: "InspectResponse", http.StatusBadRequest: "ErrorResponse", http.StatusNotFound: "ErrorResponse",
+			http.StatusTooManyRequests: "ErrorResponse",
+		},
+	},
+	{
+		method: http.MethodGet, path: "/api/urls/{short_code}", tag: "enlaces", pathParam: true, query: []string{DomainParam},
+		summary: "Vista previa de un enlace",
+		responses: map[int]string{
+			http.StatusOK: "PreviewResponse", http.StatusNotModified: "", http.StatusNotFound: "ErrorResponse",
+		},
+	},
+	{
+		method: http.MethodGet, path: "/api/urls/{short_code}/preview", tag: "enlaces", pathParam: true,
+		summary: "Título, descripción e imagen Open Graph del destino", query: []string{DomainParam, "refresh"},
+		responses: map[int]string{
+			http.StatusOK: "LinkMetadataResponse", http.StatusNotModified: "", http.StatusForbidden: "ErrorResponse",
+			http.StatusNotFound: "ErrorResponse", http.StatusGone: "ErrorResponse", http.StatusBadGateway: "ErrorResponse",
+		},
+	},
+	{
+		method: http.MethodGet, path: "/api/me/urls", tag: "gestión", auth: true,
+		summary: "Lista los enlaces del usuario autenticado",
+		responses: map[int]string{
+			http.StatusOK: "LinkListResponse", http.StatusUnauthorized: "ErrorResponse",
+		},
+	},
+	{
+		method: http.MethodGet, path: "/api/urls", tag: "gestión", auth: true,
+		query:   []string{"page", "per_page", "sort", "filter"},
+		summary: "Lista enlaces paginados; filter admite domain:, owner: (solo admins), status:, tag: y collection_id:",
+		responses: map[int]string{
+			http.StatusOK: "LinkListResponse", http.StatusBadRequest: "ErrorResponse",
+			http.StatusUnauthorized: "ErrorResponse", http.StatusForbidden: "ErrorResponse",
+		},
+	},
+	{
+		method: http.MethodGet, path: "/api/events/stream", tag: "gestión", auth: true,
+		query:   []string{"short_code", "owner"},
+		summary: "Stream Server-Sent Events de creaciones y visitas; data es un StreamEventResponse",
+		responses: map[int]string{
+			http.StatusOK: "", http.StatusUnauthorized: "ErrorResponse",
+			http.StatusForbidden: "ErrorResponse", http.StatusNotFound: "ErrorResponse",
+		},
+	},
+	{
+		method: http.MethodGet, path: "/api/analytics/live", tag: "gestión", auth: true,
+		query:   []string{"short_code", "owner", "tag"},
+		summary: "Canal WebSocket con las visitas por minuto y visitantes únicos; cada mensaje es un LiveAnalyticsMessage",
+		responses: map[int]string{
+			http.StatusSwitchingProtocols: "", http.StatusBadRequest: "ErrorResponse",
+			http.StatusUnauthorized: "ErrorResponse", http.StatusForbidden: "ErrorResponse",
+			http.StatusNotFound: "ErrorResponse",
+		},
+	},
+	{
+		method: http.MethodGet, path: "/api/urls/{short_code}/events/export", tag: "gestión", auth: true, pathParam: true,
+		query:   []string{"format", "from", "to", "aggregate", DomainParam},
+		summary: "Exporta las visitas del enlace, una por fila o por día (aggregate=day), como CSV o Parquet",
+		responses: map[int]string{
+			http.StatusOK: "", http.StatusBadRequest: "ErrorResponse", http.StatusUnauthorized: "ErrorResponse",
+			http.StatusForbidden: "ErrorResponse", http.StatusNotFound: "ErrorResponse",
+		},
+	},
+	{
+		method: http.MethodGet, path: "/api/reports/summary", tag: "gestión", auth: true,
+		query:   []string{"period", "owner", "tag"},
+		summary: "Resumen de visitas, enlaces nuevos y los enlaces, referrers y países con más visitas de los últimos días (period, p. ej. 7d)",
+		responses: map[int]string{
+			http.StatusOK: "SummaryReportResponse", http.StatusBadRequest: "ErrorResponse",
+			http.StatusUnauthorized: "ErrorResponse", http.StatusForbidden: "ErrorResponse",
+			http.StatusNotFound: "ErrorResponse",
+		},
+	},
+	{
+		method: http.MethodGet, path: "/api/stats", tag: "administración", auth: true,
+		summary: "Enlaces activos, expirados, desactivados y rotos, visitas de hoy y estado del almacén",
+		responses: map[int]string{
+			http.StatusOK: "StatsResponse", http.StatusUnauthorized: "ErrorResponse", http.StatusForbidden: "ErrorResponse",
+			http.StatusServiceUnavailable: "ErrorResponse",
+		},
+	},
+	{
+		method: http.MethodGet, path: "/api/urls/search", tag: "gestión", auth: true,
+		query:   []string{"q", "limit"},
+		summary: "Busca enlaces por URL larga, alias, descripción o metadatos propios",
+		responses: map[int]string{
+			http.StatusOK: "LinkListResponse", http.StatusBadRequest: "ErrorResponse", http.StatusUnauthorized: "ErrorResponse",
+		},
+	},
+	{
+		method: http.MethodPatch, path: "/api/urls/{short_code}", tag: "gestión", auth: true, pathParam: true, query: []string{DomainParam},
+		summary: "Cambia el destino de un enlace", request: "UpdateURLRequest",
+		responses: map[int]string{
+			http.StatusOK: "LinkResponse", http.StatusBadRequest: "ErrorResponse", http.StatusUnauthorized: "ErrorResponse",
+			http.StatusForbidden: "ErrorResponse", http.StatusNotFound: "ErrorResponse",
+			http.StatusRequestEntityTooLarge: "ErrorResponse", http.StatusUnprocessableEntity: "ErrorResponse",
+		},
+	},
+	{
+		method: http.MethodPatch, path: "/api/urls/{short_code}/details", tag: "gestión", auth: true, pathParam: true, query: []string{DomainParam},
+		summary: "Cambia la descripción o los metadatos propios de un enlace", request: "DetailsRequest",
+		responses: map[int]string{
+			http.StatusOK: "LinkResponse", http.StatusBadRequest: "ErrorResponse", http.StatusUnauthorized: "ErrorResponse",
+			http.StatusForbidden: "ErrorResponse", http.StatusNotFound: "ErrorResponse",
+			http.StatusRequestEntityTooLarge: "ErrorResponse",
+		},
+	},
+	{
+		method: http.MethodPost, path: "/api/urls/{short_code}/sign", tag: "gestión", auth: true, pathParam: true, query: []string{DomainParam},
+		summary: "Emite una URL firmada, con caducidad opcional, de un enlace creado con signed", request: "SignRequest",
+		responses: map[int]string{
+			http.StatusOK: "SignedURLResponse", http.StatusBadRequest: "ErrorResponse", http.StatusUnauthorized: "ErrorResponse",
+			http.StatusForbidden: "ErrorResponse", http.StatusNotFound: "ErrorResponse",
+		},
+	},
+	{
+		method: http.MethodPost, path: "/api/urls/{short_code}/transfer", tag: "gestión", auth: true, pathParam: true, query: []string{DomainParam, ConfirmParam},
+		summary: "Cede el enlace a otro usuario; sin confirm responde 202 con el token que el receptor usa para aceptarlo", request: "TransferRequest",
+		responses: map[int]string{
+			http.StatusOK: "LinkResponse", http.StatusAccepted: "TransferResponse", http.StatusBadRequest: "ErrorResponse",
+			http.StatusUnauthorized: "ErrorResponse", http.StatusForbidden: "ErrorResponse", http.StatusNotFound: "ErrorResponse",
+		},
+	},
+	{
+		method: http.MethodDelete, path: "/api/urls/{short_code}/transfer", tag: "gestión", auth: true, pathParam: true, query: []string{DomainParam},
+		summary: "Retira la oferta de traspaso pendiente; su token de confirmación deja de servir",
+		responses: map[int]string{
+			http.StatusNoContent: "", http.StatusUnauthorized: "ErrorResponse", http.StatusForbidden: "ErrorResponse", http.StatusNotFound: "ErrorResponse",
+		},
+	},
+	{
+		method: http.MethodPost, path: "/api/urls/{short_code}/extend", tag: "gestión", auth: true, pathParam: true, query: []string{DomainParam},
+		summary: "Renueva la expiración de un enlace con una fecha o un plazo sumado a la actual", request: "ExtendRequest",
+		responses: map[int]string{
+			http.StatusOK: "LinkResponse", http.StatusBadRequest: "ErrorResponse", http.StatusUnauthorized: "ErrorResponse",
+			http.StatusForbidden: "ErrorResponse", http.StatusNotFound: "ErrorResponse",
+			http.StatusRequestEntityTooLarge: "ErrorResponse",
+		},
+	},
+	{
+		method: http.MethodPatch, path: "/api/urls/{short_code}/tags", tag: "gestión", auth: true, pathParam: true, query: []string{DomainParam},
+		summary: "Reemplaza las etiquetas de un enlace; una lista vacía las elimina", request: "TagsRequest",
+		responses: map[int]string{
+			http.StatusOK: "LinkResponse", http.StatusBadRequest: "ErrorResponse", http.StatusUnauthorized: "ErrorResponse",
+			http.StatusForbidden: "ErrorResponse", http.StatusNotFound: "ErrorResponse",
+			http.StatusRequestEntityTooLarge: "ErrorResponse", http.StatusUnprocessableEntity: "ErrorResponse",
+		},
+	},
+	{
+		method: http.MethodGet, path: "/api/tags", tag: "gestión", auth: true,
+		summary: "Lista las etiquetas en uso con sus enlaces y visitas",
+		responses: map[int]string{
+			http.StatusOK: "TagListResponse", http.StatusNotModified: "", http.StatusUnauthorized: "ErrorResponse",
+		},
+	},
+	{
+		method: http.MethodGet, path: "/api/collections", tag: "gestión", auth: true,
+		summary: "Lista las colecciones con sus enlaces y visitas",
+		responses: map[int]string{
+			http.StatusOK: "CollectionListResponse", http.StatusNotModified: "", http.StatusUnauthorized: "ErrorResponse",
+		},
+	},
+	{
+		method: http.MethodPost, path: "/api/collections", tag: "gestión", auth: true,
+		summary: "Crea una colección", request: "CollectionRequest",
+		responses: map[int]string{
+			http.StatusCreated: "CollectionResponse", http.StatusBadRequest: "ErrorResponse",
+			http.StatusUnauthorized: "ErrorResponse", http.StatusConflict: "ErrorResponse",
+		},
+	},
+	{
+		method: http.MethodPatch, path: "/api/collections/{id}", tag: "gestión", auth: true, pathParam: true,
+		summary: "Renombra una colección", request: "CollectionRequest",
+		responses: map[int]string{
+			http.StatusOK: "CollectionResponse", http.StatusBadRequest: "ErrorResponse", http.StatusUnauthorized: "ErrorResponse",
+			http.StatusNotFound: "ErrorResponse", http.StatusConflict: "ErrorResponse",
+		},
+	},
+	{
+		method: http.MethodDelete, path: "/api/collections/{id}", tag: "gestión", auth: true, pathParam: true,
+		summary: "Elimina una colección; sus enlaces se conservan fuera de cualquier colección",
+		responses: map[int]string{
+			http.StatusNoContent: "", http.StatusUnauthorized: "ErrorResponse", http.StatusNotFound: "ErrorResponse",
+		},
+	},
+	{
+		method: http.MethodPost, path: "/api/collections/{id}/links", tag: "gestión", auth: true, pathParam: true, query: []string{DomainParam},
+		summary: "Mueve enlaces a la colección, con un resultado por código", request: "CollectionLinksRequest",
+		responses: map[int]string{
+			http.StatusOK: "CollectionLinksResponse", http.StatusBadRequest: "ErrorResponse", http.StatusUnauthorized: "ErrorResponse",
+			http.StatusNotFound: "ErrorResponse", http.StatusRequestEntityTooLarge: "ErrorResponse",
+		},
+	},
+	{
+		method: http.MethodPost, path: "/api/collections/{id}/links:remove", tag: "gestión", auth: true, pathParam: true, query: []string{DomainParam},
+		summary: "Saca enlaces de la colección, con un resultado por código", request: "CollectionLinksRequest",
+		responses: map[int]string{
+			http.StatusOK: "CollectionLinksResponse", http.StatusBadRequest: "ErrorResponse", http.StatusUnauthorized: "ErrorResponse",
+			http.StatusNotFound: "ErrorResponse", http.StatusRequestEntityTooLarge: "ErrorResponse",
+		},
+	},
+	{
+		method: http.MethodGet, path: "/api/users/{id}/export", tag: "gestión", auth: true, pathParam: true, query: []string{ConfirmParam},
+		summary: "Exporta los datos del usuario; sin confirm responde 202 con el token de confirmación",
+		responses: map[int]string{
+			http.StatusOK: "UserDataExportResponse", http.StatusAccepted: "UserDataConfirmationResponse",
+			http.StatusUnauthorized: "ErrorResponse", http.StatusForbidden: "ErrorResponse",
+		},
+	},
+	{
+		method: http.MethodDelete, path: "/api/users/{id}/data", tag: "gestión", auth: true, pathParam: true, query: []string{ConfirmParam},
+		summary: "Borra definitivamente los datos del usuario; sin confirm responde 202 con el token de confirmación",
+		responses: map[int]string{
+			http.StatusOK: "UserDataDeletionResponse", http.StatusAccepted: "UserDataConfirmationResponse",
+			http.StatusUnauthorized: "ErrorResponse", http.StatusForbidden: "ErrorResponse",
+		},
+	},
+	{
+		method: http.MethodDelete, path: "/api/urls/{short_code}", tag: "gestión", auth: true, pathParam: true, query: []string{DomainParam},
+		summary: "Elimina un enlace: el propietario lo desactiva y un admin lo purga",
+		responses: map[int]string{
+			http.StatusNoContent: "", http.StatusUnauthorized: "ErrorResponse",
+			http.StatusForbidden: "ErrorResponse", http.StatusNotFound: "ErrorResponse",
+		},
+	},
+	{
+		method: http.MethodPost, path: "/api/urls/{short_code}:disable", tag: "gestión", auth: true, pathParam: true, query: []string{DomainParam},
+		summary: "Desactiva un enlace sin eliminarlo", request: "DisableURLRequest", optional: true,
+		responses: map[int]string{
+			http.StatusOK: "LinkResponse", http.StatusBadRequest: "ErrorResponse", http.StatusUnauthorized: "ErrorResponse",
+			http.StatusForbidden: "ErrorResponse", http.StatusNotFound: "ErrorResponse",
+		},
+	},
+	{
+		method: http.MethodPost, path: "/api/urls:batchUpdate", tag: "gestión", auth: true, query: []string{DomainParam},
+		summary: "Aplica los mismos cambios (tags, expiración, redirect_type) a varios enlaces con resultados por elemento", request: "BatchUpdateRequest",
+		responses: map[int]string{
+			http.StatusOK: "BatchUpdateResponse", http.StatusBadRequest: "ErrorResponse", http.StatusUnauthorized: "ErrorResponse",
+			http.StatusRequestEntityTooLarge: "ErrorResponse",
+		},
+	},
+	{
+		method: http.MethodPost, path: "/api/urls:batchDelete", tag: "gestión", auth: true, query: []string{DomainParam},
+		summary: "Elimina varios enlaces con resultados por elemento", request: "BatchDeleteRequest",
+		responses: map[int]string{
+			http.StatusOK: "BatchDeleteResponse", http.StatusBadRequest: "ErrorResponse", http.StatusUnauthorized: "ErrorResponse",
+			http.StatusForbidden: "ErrorResponse", http.StatusRequestEntityTooLarge: "ErrorResponse",
+		},
+	},
+	{
+		method: http.MethodPost, path: "/api/urls/{short_code}:enable", tag: "gestión", auth: true, pathParam: true, query: []string{DomainParam},
+		summary: "Restaura un enlace desactivado",
+		responses: map[int]string{
+			http.StatusOK: "LinkResponse", http.StatusUnauthorized: "ErrorResponse",
+			http.StatusForbidden: "ErrorResponse", http.StatusNotFound: "ErrorResponse",
+		},
+	},
+	{
+		method: http.MethodGet, path: "/auth/oidc/login", tag: "autenticación", query: []string{"mode"},
+		summary:   "Redirige al proveedor de identidad (mode=api para recibir el token en el callback)",
+		responses: map[int]string{http.StatusFound: ""},
+	},
+	{
+		method: http.MethodGet, path: "/auth/oidc/callback", tag: "autenticación", query: []string{"code", "state"},
+		summary: "Canjea el código del proveedor y abre la sesión del panel o responde un token propio",
+		responses: map[int]string{
+			http.StatusOK: "OIDCTokenResponse", http.StatusBadRequest: "ErrorResponse",
+			http.StatusUnauthorized: "ErrorResponse", http.StatusForbidden: "ErrorResponse",
+			http.StatusBadGateway: "ErrorResponse",
+		},
+	},
+	{
+		method: http.MethodPost, path: "/admin/import", tag: "administración", auth: true, query: []string{TenantParam},
+		summary: "Importa enlaces desde un CSV o TSV (long_url, alias, expires_at)",
+		responses: map[int]string{
+			http.StatusOK: "ImportResponse", http.StatusBadRequest: "ErrorResponse",
+			http.StatusUnauthorized: "ErrorResponse", http.StatusForbidden: "ErrorResponse",
+			http.StatusNotFound: "ErrorResponse",
+		},
+	},
+	{
+		method: http.MethodGet, path: "/admin/export", tag: "administración", auth: true, query: []string{"format", TenantParam},
+		summary: "Exporta los enlaces de un tenant como CSV o TSV",
+		responses: map[int]string{
+			http.StatusOK: "", http.StatusBadRequest: "ErrorResponse",
+			http.StatusUnauthorized: "ErrorResponse", http.StatusForbidden: "ErrorResponse",
+			http.StatusNotFound: "ErrorResponse",
+		},
+	},
+	{
+		method: http.MethodGet, path: "/admin/audit", tag: "administración", auth: true,
+		query:   []string{"actor", "short_code", "action", "since", "until", "page", "per_page"},
+		summary: "Consulta el log de auditoría de creaciones, ediciones, desactivaciones y eliminaciones",
+		responses: map[int]string{
+			http.StatusOK: "AuditListResponse", http.StatusBadRequest: "ErrorResponse",
+			http.StatusUnauthorized: "ErrorResponse", http.StatusForbidden: "ErrorResponse",
+		},
+	},
+	{
+		method: http.MethodPost, path: "/admin/domains/reload", tag: "administración", auth: true,
+		summary: "Recarga las listas de dominios bloqueados y permitidos",
+		responses: map[int]string{
+			http.StatusOK: "DomainPolicyResponse", http.StatusUnauthorized: "ErrorResponse",
+			http.StatusForbidden: "ErrorResponse", http.StatusInternalServerError: "ErrorResponse",
+		},
+	},
+	{
+		method: http.MethodGet, path: "/admin/custom-domains", tag: "administración", auth: true,
+		summary: "Lista los dominios personalizados y sus propietarios",
+		responses: map[int]string{
+			http.StatusOK: "CustomDomainListResponse", http.StatusUnauthorized: "ErrorResponse",
+			http.StatusForbidden: "ErrorResponse",
+		},
+	},
+	{
+		method: http.MethodPut, path: "/admin/custom-domains/{host}", tag: "administración", auth: true, pathParam: true,
+		summary: "Asigna un dominio personalizado a un propietario", request: "CustomDomainRequest",
+		responses: map[int]string{
+			http.StatusOK: "CustomDomainResponse", http.StatusBadRequest: "ErrorResponse",
+			http.StatusUnauthorized: "ErrorResponse", http.StatusForbidden: "ErrorResponse",
+			http.StatusConflict: "ErrorResponse",
+		},
+	},
+	{
+		method: http.MethodDelete, path: "/admin/custom-domains/{host}", tag: "administración", auth: true, pathParam: true,
+		summary: "Elimina un dominio personalizado; sus enlaces se conservan",
+		responses: map[int]string{
+			http.StatusNoContent: "", http.StatusUnauthorized: "ErrorResponse",
+			http.StatusForbidden: "ErrorResponse", http.StatusNotFound: "ErrorResponse",
+		},
+	},
+	{
+		method: http.MethodGet, path: "/admin/tenants", tag: "administración", auth: true,
+		summary: "Lista los enlaces y visitas de cada tenant",
+		responses: map[int]string{
+			http.StatusOK: "TenantListResponse", http.StatusNotModified: "", http.StatusUnauthorized: "ErrorResponse",
+			http.StatusForbidden: "ErrorResponse",
+		},
+	},
+	{
+		method: http.MethodGet, path: "/admin/keys/{id}/usage", tag: "administración", auth: true, pathParam: true,
+		summary: "Consumo del mes en curso y cuotas de una clave de API (id: 16 primeros caracteres hex de su SHA-256)",
+		responses: map[int]string{
+			http.StatusOK: "KeyUsageResponse", http.StatusNotModified: "", http.StatusBadRequest: "ErrorResponse",
+			http.StatusUnauthorized: "ErrorResponse", http.StatusForbidden: "ErrorResponse",
+		},
+	},
+	{
+		method: http.MethodGet, path: "/debug/stats", tag: "administración", auth: true,
+		summary: "Goroutines, heap, ocupación del almacén y aciertos de la caché del proceso (los perfiles de pprof están en /debug/pprof/)",
+		responses: map[int]string{
+			http.StatusOK: "DebugStatsResponse", http.StatusUnauthorized: "ErrorResponse", http.StatusForbidden: "ErrorResponse",
+		},
+	},
+	{
+		method: http.MethodGet, path: "/admin/reports", tag: "administración", auth: true,
+		query:   []string{"short_code", "status", "page", "per_page"},
+		summary: "Lista las denuncias de abuso",
+		responses: map[int]string{
+			http.StatusOK: "ReportListResponse", http.StatusBadRequest: "ErrorResponse",
+			http.StatusUnauthorized: "ErrorResponse", http.StatusForbidden: "ErrorResponse",
+		},
+	},
+	{
+		method: http.MethodPost, path: "/admin/reports/disable", tag: "administración", auth: true,
+		summary: "Desactiva varios enlaces denunciados y resuelve sus denuncias", request: "BulkDisableRequest",
+		responses: map[int]string{
+			http.StatusOK: "BulkDisableResponse", http.StatusBadRequest: "ErrorResponse", http.StatusUnauthorized: "ErrorResponse",
+			http.StatusForbidden: "ErrorResponse", http.StatusRequestEntityTooLarge: "ErrorResponse",
+		},
+	},
+	{
+		method: http.MethodGet, path: "/admin/broken-links", tag: "administración", auth: true,
+		query:   []string{"owner", "domain", TenantParam, "page", "per_page"},
+		summary: "Lista los enlaces cuyo destino falla de forma persistente",
+		responses: map[int]string{
+			http.StatusOK: "BrokenLinksResponse", http.StatusBadRequest: "ErrorResponse",
+			http.StatusUnauthorized: "ErrorResponse", http.StatusForbidden: "ErrorResponse",
+			http.StatusNotFound: "ErrorResponse",
+		},
+	},
+	{
+		method: http.MethodGet, path: "/admin/webhooks/deliveries", tag: "administración", auth: true,
+		query:   []string{"status", "event", "short_code", "page", "per_page"},
+		summary: "Lista las entregas recientes de webhooks",
+		responses: map[int]string{
+			http.StatusOK: "WebhookDeliveriesResponse", http.StatusBadRequest: "ErrorResponse",
+			http.StatusUnauthorized: "ErrorResponse", http.StatusForbidden: "ErrorResponse",
+			http.StatusNotFound: "ErrorResponse",
+		},
+	},
+	{
+		method: http.MethodGet, path: "/admin/backups", tag: "administración", auth: true,
+		summary: "Lista las copias de seguridad de la más reciente a la más antigua",
+		responses: map[int]string{
+			http.StatusOK: "BackupListResponse", http.StatusUnauthorized: "ErrorResponse", http.StatusForbidden: "ErrorResponse",
+			http.StatusNotFound: "ErrorResponse", http.StatusServiceUnavailable: "ErrorResponse",
+		},
+	},
+	{
+		method: http.MethodPost, path: "/admin/backups", tag: "administración", auth: true,
+		summary: "Crea una copia de seguridad de los enlaces en el momento",
+		responses: map[int]string{
+			http.StatusCreated: "BackupResponse", http.StatusUnauthorized: "ErrorResponse", http.StatusForbidden: "ErrorResponse",
+			http.StatusNotFound: "ErrorResponse", http.StatusServiceUnavailable: "ErrorResponse",
+		},
+	},
+	{
+		method: http.MethodPost, path: "/admin/restore", tag: "administración", auth: true,
+		summary: "Restaura los enlaces de una copia de seguridad; reemplazan a los que tengan el mismo código",
+		request: "RestoreRequest",
+		responses: map[int]string{
+			http.StatusOK: "RestoreResponse", http.StatusBadRequest: "ErrorResponse", http.StatusUnauthorized: "ErrorResponse",
+			http.StatusForbidden: "ErrorResponse", http.StatusNotFound: "ErrorResponse",
+			http.StatusUnprocessableEntity: "ErrorResponse", http.StatusServiceUnavailable: "ErrorResponse",
+		},
+	},
+	{
+		method: http.MethodPost, path: "/admin/store/compact", tag: "administración", auth: true,
+		summary: "Reconstruye los mapas del almacén en memoria para liberar los huecos de los enlaces borrados",
+		responses: map[int]string{
+			http.StatusOK: "CompactionResponse", http.StatusUnauthorized: "ErrorResponse", http.StatusForbidden: "ErrorResponse",
+			http.StatusNotImplemented: "ErrorResponse",
+		},
+	},
+	{
+		method: http.MethodPost, path: "/admin/reports/{short_code}:dismiss", tag: "administración", auth: true, pathParam: true,
+		summary: "Descarta las denuncias abiertas de un enlace y lo saca de la cuarentena",
+		responses: map[int]string{
+			http.StatusOK: "LinkResponse", http.StatusUnauthorized: "ErrorResponse",
+			http.StatusForbidden: "ErrorResponse", http.StatusNotFound: "ErrorResponse",
+		},
+	},
+}
+
+// OpenAPISpec construye el documento OpenAPI 3 de la API usando serverURL como servidor
+func OpenAPISpec(serverURL string) map[string]interface{} {
+	schemas := make(map[string]interface{}, len(openAPISchemas))
+	for _, v := range openAPISchemas {
+		t := reflect.TypeOf(v)
+		schemas[t.Name()] = schemaFor(t, false)
+	}
+	schemas[errorCodeSchema] = map[string]interface{}{
+		"type":        "string",
+		"enum":        errcode.All(),
+		"description": "Código de error estable: no cambia con el idioma del mensaje ni entre versiones",
+	}
+
+	paths := make(map[string]interface{})
+	for _, op := range openAPIOperations {
+		item, ok := paths[op.path].(map[string]interface{})
+		if !ok {
+			item = make(map[string]interface{})
+			paths[op.path] = item
+		}
+		item[strings.ToLower(op.method)] = op.document()
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":       "Acortador de URLs",
+			"version":     "1.0.0",
+			"description": "API para acortar URLs, redirigir y gestionar enlaces por usuario",
+		},
+		"servers": []interface{}{map[string]interface{}{"url": serverURL}},
+		"paths":   paths,
+		"components": map[string]interface{}{
+			"schemas": schemas,
+			"securitySchemes": map[string]interface{}{
+				"bearerAuth": map[string]interface{}{"type": "http", "scheme": "bearer", "bearerFormat": "JWT"},
+				"apiKey":     map[string]interface{}{"type": "apiKey", "in": "header", "name": APIKeyHeader},
+			},
+		},
+	}
+}
+
+// document convierte la operación en su objeto OpenAPI
+func (op openAPIOperation) document() map[string]interface{} {
+	doc := map[string]interface{}{
+		"summary": op.summary,
+		"tags":    []string{op.tag},
+	}
+	var params []interface{}
+	if op.pathParam {
+		for _, name := range pathParamNames(op.path) {
+			params = append(params, map[string]interface{}{
+				"name": name, "in": "path", "required": true,
+				"schema": map[string]interface{}{"type": "string"},
+			})
+		}
+	}
+	for _, name := range op.query {
+		params = append(params, map[string]interface{}{
+			"name": name, "in": "query", "schema": map[string]interface{}{"type": "string"},
+		})
+	}
+	if len(params) > 0 {
+		doc["parameters"] = params
+	}
+	if op.auth {
+		doc["security"] = []interface{}{map[string]interface{}{"bearerAuth": []string{}}}
+	}
+	if op.request != "" {
+		content := jsonContent(op.request)
+		if op.plainText {
+			content["application/x-www-form-urlencoded"] = map[string]interface{}{"schema": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"long_url":    map[string]interface{}{"type": "string"},
+					"alias":       map[string]interface{}{"type": "string"},
+					"ttl_seconds": map[string]interface{}{"type": "integer"},
+				},
+				"required": []string{"long_url"},
+			}}
+			content["text/plain"] = plainTextContent
+		}
+		doc["requestBody"] = map[string]interface{}{
+			"required": !op.optional,
+			"content":  content,
+		}
+	}
+
+	responses := make(map[string]interface{}, len(op.responses))
+	for status, schema := range op.responses {
+		response := map[string]interface{}{"description": http.StatusText(status)}
+		if schema != "" {
+			content := jsonContent(schema)
+			if op.plainText {
+				content["text/plain"] = plainTextContent
+			}
+			response["content"] = content
+		}
+		responses[strconv.Itoa(status)] = response
+	}
+	doc["responses"] = responses
+	return doc
+}
+
+// pathParamNames retorna los nombres de los parámetros entre llaves de la ruta
+func pathParamNames(path string) []string {
+	var names []string
+	for rest := path; ; {
+		_, after, found := strings.Cut(rest, "{")
+		if !found {
+			return names
+		}
+		name, tail, _ := strings.Cut(after, "}")
+		names = append(names, name)
+		rest = tail
+	}
+}
+
+// jsonContent referencia un esquema de components como cuerpo application/json
+func jsonContent(schema string) map[string]interface{} {
+	return map[string]interface{}{
+		"application/json": map[string]interface{}{"schema": schemaRef(schema)},
+	}
+}
+
+// plainTextContent es un cuerpo text/plain de una línea
+var plainTextContent = map[string]interface{}{"schema": map[string]interface{}{"type": "string"}}
+
+// schemaRef construye una referencia a components.schemas
+func schemaRef(name string) map[string]interface{} {
+	return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+}
+
+// schemaFor deriva el esquema JSON de un tipo Go. Los structs publicados en openAPISchemas se
+// referencian por nombre cuando aparecen anidados (nested) y se describen completos en la raíz.
+func schemaFor(t reflect.Type, nested bool) map[string]interface{} {
+	if t.Kind() == reflect.Pointer {
+		schema := schemaFor(t.Elem(), nested)
+		if _, isRef := schema["$ref"]; !isRef {
+			schema["nullable"] = true
+		}
+		return schema
+	}
+
+	switch {
+	case t == reflect.TypeOf(errcode.Code("")):
+		return schemaRef(errorCodeSchema)
+	case t == reflect.TypeOf(time.Time{}):
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case t == reflect.TypeOf(json.RawMessage{}):
+		return map[string]interface{}{"type": "object", "additionalProperties": true}
+	case t.Kind() == reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case t.Kind() == reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Uint64:
+		format := "int32"
+		if t.Bits() == 64 || t.Kind() == reflect.Int || t.Kind() == reflect.Uint {
+			format = "int64"
+		}
+		return map[string]interface{}{"type": "integer", "format": format}
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case t.Kind() == reflect.Slice || t.Kind() == reflect.Array:
+		return map[string]interface{}{"type": "array", "items": schemaFor(t.Elem(), true)}
+	case t.Kind() == reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": schemaFor(t.Elem(), true)}
+	case t.Kind() == reflect.Struct:
+		if nested && isPublishedSchema(t) {
+			return schemaRef(t.Name())
+		}
+		return structSchema(t)
+	default:
+		return map[string]interface{}{}
+	}
+}
+
+// structSchema describe las propiedades exportadas de un struct según sus etiquetas json
+func structSchema(t reflect.Type) map[string]interface{} {
+	properties := make(map[string]interface{})
+	required := make([]string, 0)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, opts, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		schema := schemaFor(field.Type, true)
+		if example := field.Tag.Get("example"); example != "" {
+			schema["example"] = example
+			if n, err := strconv.ParseInt(example, 10, 64); err == nil && schema["type"] == "integer" {
+				schema["example"] = n
+			}
+		}
+		properties[name] = schema
+
+		if !strings.Contains(opts, "omitempty") && field.Type.Kind() != reflect.Pointer {
+			required = append(required, name)
+		}
+	}
+
+	schema := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// isPublishedSchema indica si el tipo aparece en components.schemas
+func isPublishedSchema(t reflect.Type) bool {
+	for _, v := range openAPISchemas {
+		if reflect.TypeOf(v) == t {
+			return true
+		}
+	}
+	return false
+}
+
+// OpenAPI maneja GET /openapi.json
+func (h *Handler) OpenAPI(w http.ResponseWriter, r *http.Request) {
+	h.sendJSON(w, http.StatusOK, OpenAPISpec(h.getBaseURL(r)))
+}
+
+// swaggerUIPage carga Swagger UI desde su CDN y lo apunta a /openapi.json
+const swaggerUIPage = `<!DOCTYPE html>
+<html lang="es">
+<head>
+<meta charset="utf-8">
+<title>Acortador de URLs - API</title>
+<link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+<div id="swagger-ui"></div>
+<script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js" crossorigin></script>
+<script>
+window.onload = function () {
+  window.ui = SwaggerUIBundle({ url: "/openapi.json", dom_id: "#swagger-ui" });
+};
+</script>
+</body>
+</html>
+`
+
+// SwaggerUI maneja GET /docs sirviendo la interfaz interactiva de la especificación
+func (h *Handler) SwaggerUI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(swaggerUIPage))
+}
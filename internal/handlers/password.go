@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"html/template"
+	"net/http"
+
+	"acortador-urls/internal/shortener"
+)
+
+// LinkPasswordHeader es la cabecera con la que los clientes no interactivos aportan la
+// contraseña de un enlace protegido
+const LinkPasswordHeader = "X-Link-Password"
+
+// passwordFormTemplate es el formulario mostrado a navegadores al visitar un enlace protegido
+var passwordFormTemplate = template.Must(template.New("password").Parse(`<!DOCTYPE html>
+<html lang="es">
+<head>
+<meta charset="utf-8">
+<meta name="robots" content="noindex">
+<title>Enlace protegido</title>
+</head>
+<body>
+<h1>Enlace protegido</h1>
+<p>Este enlace requiere una contraseña.</p>
+{{if .Invalid}}<p role="alert">La contraseña no es correcta.</p>{{end}}
+<form method="post" action="{{.Action}}">
+<label for="password">Contraseña</label>
+<input type="password" id="password" name="password" autocomplete="off" required autofocus>
+<button type="submit">Continuar</button>
+</form>
+</body>
+</html>
+`))
+
+// passwordForm son los datos del formulario de contraseña
+type passwordForm struct {
+	Action  string
+	Invalid bool
+}
+
+// sendPasswordForm responde con el formulario de contraseña y el estado indicado
+func (h *Handler) sendPasswordForm(w http.ResponseWriter, r *http.Request, status int) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	passwordFormTemplate.Execute(w, passwordForm{
+		Action:  signedAction(r),
+		Invalid: status == http.StatusForbidden,
+	})
+}
+
+// linkPassword obtiene la contraseña aportada en la cabecera, el formulario o ?key=
+func linkPassword(r *http.Request) string {
+	if password := r.Header.Get(LinkPasswordHeader); password != "" {
+		return password
+	}
+	if r.Method == http.MethodPost {
+		if password := r.PostFormValue("password"); password != "" {
+			return password
+		}
+	}
+	return r.URL.Query().Get(shortener.PasswordQueryParam)
+}
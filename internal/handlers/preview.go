@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"acortador-urls/internal/errcode"
+	"acortador-urls/internal/shortener"
+)
+
+// PreviewResponse describe a dónde apunta un enlace corto sin redirigir
+type PreviewResponse struct {
+	ShortCode string `json:"short_code"`
+	ShortURL  string `json:"short_url"`
+	// LongURL se omite en los enlaces con contraseña, firmados, desactivados o que no redirigen
+	// desde la red del visitante
+	LongURL   string     `json:"long_url,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Expired   bool       `json:"expired"`
+	Clicks    int64      `json:"clicks"`
+	// BotClicks son las visitas de bots y rastreadores incluidas en Clicks
+	BotClicks int64 `json:"bot_clicks"`
+	// UniqueVisitors es la estimación de personas distintas; cada día se vuelven a contar
+	UniqueVisitors int64 `json:"unique_visitors"`
+	// PasswordProtected oculta el destino: solo se revela tras aportar la contraseña
+	PasswordProtected bool `json:"password_protected,omitempty"`
+	// Signed oculta el destino de los enlaces que solo se abren con una URL firmada
+	Signed bool `json:"signed,omitempty"`
+	// Disabled oculta también el destino de los enlaces desactivados e informa el motivo
+	Disabled       bool   `json:"disabled,omitempty"`
+	DisabledReason string `json:"disabled_reason,omitempty"`
+}
+
+// LinkMetadataResponse son los metadatos del destino de un enlace para mostrar una vista
+// previa enriquecida
+type LinkMetadataResponse struct {
+	ShortCode   string    `json:"short_code"`
+	LongURL     string    `json:"long_url"`
+	Title       string    `json:"title,omitempty"`
+	Description string    `json:"description,omitempty"`
+	Image       string    `json:"image,omitempty"`
+	FetchedAt   time.Time `json:"fetched_at"`
+}
+
+// previewTemplate es la página HTML mostrada a navegadores en GET /{short_code}+
+var previewTemplate = template.Must(template.New("preview").Parse(`<!DOCTYPE html>
+<html lang="es">
+<head>
+<meta charset="utf-8">
+<title>Vista previa de {{.ShortURL}}</title>
+</head>
+<body>
+<h1>Vista previa del enlace</h1>
+{{if .Disabled}}<p><strong>{{.ShortURL}}</strong> está desactivado{{with .DisabledReason}}: {{.}}{{end}}.</p>
+{{else if .PasswordProtected}}<p><strong>{{.ShortURL}}</strong> está protegido con contraseña; su destino no se muestra.</p>
+{{else if .Signed}}<p><strong>{{.ShortURL}}</strong> solo se abre con una URL firmada; su destino no se muestra.</p>
+{{else if .LongURL}}<p><strong>{{.ShortURL}}</strong> redirige a:</p>
+<p><a href="{{.LongURL}}" rel="noopener noreferrer nofollow">{{.LongURL}}</a></p>
+{{else}}<p><strong>{{.ShortURL}}</strong> no está disponible desde tu red; su destino no se muestra.</p>{{end}}
+<ul>
+<li>Creado: {{.CreatedAt.Format "2006-01-02 15:04 MST"}}</li>
+{{if .ExpiresAt}}<li>Expira: {{.ExpiresAt.Format "2006-01-02 15:04 MST"}}{{if .Expired}} (expirado){{end}}</li>{{end}}
+<li>Visitas: {{.Clicks}} ({{.UniqueVisitors}} visitantes únicos, {{.BotClicks}} de bots)</li>
+</ul>
+</body>
+</html>
+`))
+
+// PreviewURL maneja GET /{short_code}+ y GET /api/urls/{short_code}; responde JSON o HTML
+// según la cabecera Accept y no contabiliza la visita. La respuesta lleva un ETag para las
+// peticiones condicionales.
+func (h *Handler) PreviewURL(w http.ResponseWriter, r *http.Request) {
+	link, err := h.service.GetLink(r.Context(), h.managedLinkKey(r))
+	if err != nil {
+		if status, code, message, ok := storeErrorStatus(err); ok {
+			h.sendErrorResponse(w, r, status, code, message)
+			return
+		}
+
+		switch {
+		case errors.Is(err, shortener.ErrURLNotFound):
+			h.sendErrorResponse(w, r, http.StatusNotFound, errcode.NotFound, "Código corto no encontrado")
+		case errors.Is(err, shortener.ErrEmptyURL):
+			h.sendErrorResponse(w, r, http.StatusBadRequest, errcode.MissingCode, "Código corto requerido")
+		default:
+			h.sendErrorResponse(w, r, http.StatusInternalServerError, errcode.Internal, fmt.Sprintf("Error interno: %v", err))
+		}
+		return
+	}
+
+	preview := PreviewResponse{
+		ShortCode: link.ShortCode,
+		ShortURL:  h.shortURL(r, link),
+		LongURL:   link.LongURL,
+		CreatedAt: link.CreatedAt,
+		Expired:   link.IsExpired(time.Now()),
+		Clicks:    link.Clicks,
+
+		BotClicks:      link.BotClicks,
+		UniqueVisitors: link.UniqueVisitors(),
+
+		PasswordProtected: link.PasswordProtected(),
+		Signed:            link.Signed,
+		Disabled:          link.IsDisabled(),
+		DisabledReason:    link.DisabledReason,
+	}
+	if h.hidesDestination(r, link) {
+		preview.LongURL = ""
+	}
+	if !link.ExpiresAt.IsZero() {
+		preview.ExpiresAt = &link.ExpiresAt
+	}
+
+	// La misma URL responde HTML o JSON, así que cada uno tiene su propio ETag
+	w.Header().Add("Vary", "Accept")
+	if wantsHTML(r) {
+		var page bytes.Buffer
+		if err := previewTemplate.Execute(&page, preview); err != nil {
+			h.sendErrorResponse(w, r, http.StatusInternalServerError, errcode.Internal, fmt.Sprintf("Error interno: %v", err))
+			return
+		}
+		h.sendCacheable(w, r, "text/html; charset=utf-8", page.Bytes())
+		return
+	}
+
+	h.sendCacheableJSON(w, r, preview)
+}
+
+// LinkMetadata maneja GET /api/urls/{short_code}/preview: retorna el título, la descripción y
+// la imagen Open Graph del destino, obteniéndolos si no están en caché. Con refresh=true el
+// propietario o un admin fuerza una nueva obtención.
+func (h *Handler) LinkMetadata(w http.ResponseWriter, r *http.Request) {
+	refresh, _ := strconv.ParseBool(r.URL.Query().Get("refresh"))
+	link, err := h.service.FetchMetadata(r.Context(), actorFromRequest(r), h.managedLinkKey(r), refresh)
+	if err != nil {
+		switch {
+		case errors.Is(err, shortener.ErrMetadataDisabled):
+			h.sendErrorResponse(w, r, http.StatusNotFound, errcode.MetadataDisabled, "La vista previa enriquecida no está activada")
+		case errors.Is(err, shortener.ErrMetadataUnavailable):
+			h.sendErrorResponse(w, r, http.StatusBadGateway, errcode.MetadataUnavailable, err.Error())
+		case errors.Is(err, shortener.ErrURLExpired):
+			h.sendErrorResponse(w, r, http.StatusGone, errcode.Expired, "El enlace ha expirado")
+		case errors.Is(err, shortener.ErrLinkDisabled):
+			h.sendErrorResponse(w, r, http.StatusGone, errcode.Disabled, "El enlace está desactivado")
+		case errors.Is(err, shortener.ErrPasswordRequired):
+			h.sendErrorResponse(w, r, http.StatusForbidden, errcode.PasswordProtected, "El enlace está protegido con contraseña")
+		case errors.Is(err, shortener.ErrSignatureRequired):
+			h.sendErrorResponse(w, r, http.StatusForbidden, errcode.SignatureRequired, "Este enlace solo se puede abrir con una URL firmada")
+		default:
+			h.sendManagementError(w, r, err)
+		}
+		return
+	}
+	if h.ipRestricted(r, link) {
+		h.sendErrorResponse(w, r, http.StatusForbidden, errcode.IPNotAllowed, "Este enlace no está disponible desde tu red")
+		return
+	}
+
+	h.sendCacheableJSON(w, r, LinkMetadataResponse{
+		ShortCode:   link.ShortCode,
+		LongURL:     link.LongURL,
+		Title:       link.Metadata.Title,
+		Description: link.Metadata.Description,
+		Image:       link.Metadata.Image,
+		FetchedAt:   link.Metadata.FetchedAt,
+	})
+}
+
+// wantsHTML indica si el cliente prefiere HTML (navegadores) sobre JSON
+func wantsHTML(r *http.Request) bool {
+	accept := r.Header.Get("Accept")
+	return strings.Contains(accept, "text/html") && !strings.Contains(accept, "application/json")
+}
@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"acortador-urls/internal/shortener"
+)
+
+// WithPrivacyMode trata todas las visitas como si pidieran no ser rastreadas (ver
+// TrackingOptOut), para despliegues que no recogen consentimiento
+func WithPrivacyMode(enabled bool) Option {
+	return func(h *Handler) {
+		h.privacyMode = enabled
+	}
+}
+
+// TrackingOptOut indica si la petición pide no ser rastreada con Do Not Track (DNT: 1) o Global
+// Privacy Control (Sec-GPC: 1)
+func TrackingOptOut(r *http.Request) bool {
+	return strings.TrimSpace(r.Header.Get("DNT")) == "1" || strings.TrimSpace(r.Header.Get("Sec-GPC")) == "1"
+}
+
+// privateVisit indica si la visita solo debe sumarse a los contadores agregados, sin guardar
+// ni publicar nada derivado de su IP, User-Agent o Referer
+func (h *Handler) privateVisit(r *http.Request) bool {
+	return h.privacyMode || TrackingOptOut(r)
+}
+
+// visitClick describe la visita que se contabiliza. Las visitas privadas no llevan visitante,
+// referrer ni país, de modo que no cuentan como visitantes únicos ni en los informes por
+// procedencia; sí conservan la variante A/B y la clasificación como bot, que solo se guardan
+// como contadores.
+func (h *Handler) visitClick(r *http.Request, redirect shortener.Redirect) shortener.Click {
+	click := shortener.Click{Variant: redirect.Variant, Bot: redirect.Bot}
+	if !h.privateVisit(r) {
+		click.Visitor = visitorID(r)
+		click.Referrer = referrerHost(r)
+		click.Country = redirect.Country
+	}
+	return click
+}
+
+// referrerHost retorna el dominio de la cabecera Referer sin "www."; vacío si no hay
+func referrerHost(r *http.Request) string {
+	referer, err := url.Parse(r.Referer())
+	if err != nil {
+		return ""
+	}
+	return strings.TrimPrefix(strings.ToLower(referer.Hostname()), "www.")
+}
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// forwardedSchemeKey guarda en el contexto el esquema original de la petición declarado por un
+// proxy de confianza
+type forwardedSchemeKey struct{}
+
+// ParseTrustedProxies convierte la lista de proxies de confianza, en CIDR o como IPs sueltas, a
+// prefijos de red
+func ParseTrustedProxies(entries []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(entries))
+	for _, entry := range entries {
+		if prefix, err := netip.ParsePrefix(entry); err == nil {
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(entry)
+		if err != nil {
+			return nil, fmt.Errorf("proxy de confianza inválido %q: se espera una IP o un CIDR", entry)
+		}
+		addr = addr.Unmap()
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return prefixes, nil
+}
+
+// TrustedProxies atiende las cabeceras X-Forwarded-For, X-Forwarded-Proto y X-Forwarded-Host
+// solo cuando la conexión llega de uno de los proxies indicados; de cualquier otro origen se
+// ignoran, porque el cliente puede escribirlas. Debe ir antes que el resto de middlewares.
+//
+// La IP del cliente es la primera de X-Forwarded-For, de derecha a izquierda, que no es un
+// proxy de confianza, y reemplaza a RemoteAddr. Sin proxies de confianza las peticiones pasan
+// sin cambios.
+func TrustedProxies(trusted []netip.Prefix) func(http.Handler) http.Handler {
+	isTrusted := func(addr netip.Addr) bool {
+		for _, prefix := range trusted {
+			if prefix.Contains(addr) {
+				return true
+			}
+		}
+		return false
+	}
+	return func(next http.Handler) http.Handler {
+		if len(trusted) == 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			peer, err := netip.ParseAddr(ClientIP(r))
+			if err != nil || !isTrusted(peer.Unmap()) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			client := peer.Unmap()
+			hops := forwardedValues(r.Header.Values("X-Forwarded-For"))
+			for i := len(hops) - 1; i >= 0; i-- {
+				hop, ok := parseForwardedAddr(hops[i])
+				if !ok {
+					break
+				}
+				client = hop
+				if !isTrusted(hop) {
+					break
+				}
+			}
+			r.RemoteAddr = client.String()
+
+			// El primer valor es el que vio el proxy más cercano al cliente
+			if proto := forwardedValues(r.Header.Values("X-Forwarded-Proto")); len(proto) > 0 {
+				if scheme := strings.ToLower(proto[0]); scheme == "http" || scheme == "https" {
+					r = r.WithContext(context.WithValue(r.Context(), forwardedSchemeKey{}, scheme))
+				}
+			}
+			if host := forwardedValues(r.Header.Values("X-Forwarded-Host")); len(host) > 0 && validForwardedHost(host[0]) {
+				r.Host = host[0]
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// forwardedValues separa los valores de una cabecera X-Forwarded-*, que puede repetirse o
+// traer varios valores separados por comas
+func forwardedValues(headers []string) []string {
+	var values []string
+	for _, header := range headers {
+		for _, value := range strings.Split(header, ",") {
+			if value = strings.TrimSpace(value); value != "" {
+				values = append(values, value)
+			}
+		}
+	}
+	return values
+}
+
+// parseForwardedAddr interpreta una entrada de X-Forwarded-For, con o sin puerto
+func parseForwardedAddr(value string) (netip.Addr, bool) {
+	if addrPort, err := netip.ParseAddrPort(value); err == nil {
+		return addrPort.Addr().Unmap(), true
+	}
+	addr, err := netip.ParseAddr(strings.Trim(value, "[]"))
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap(), true
+}
+
+// validForwardedHost descarta los hosts con caracteres que no pueden formar parte de uno
+func validForwardedHost(host string) bool {
+	return !strings.ContainsAny(host, "/\\@ ?#")
+}
+
+// ClientIP retorna la IP del cliente: la de la conexión o, detrás de un proxy de confianza, la
+// que este declara (ver TrustedProxies). Es la IP que usan el limitador, las cuotas, las
+// denuncias, la geolocalización y las métricas.
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// RequestScheme retorna el esquema con el que el cliente hizo la petición: "https" si llegó
+// por TLS o si un proxy de confianza lo declara, y "http" en otro caso
+func RequestScheme(r *http.Request) string {
+	if scheme, ok := r.Context().Value(forwardedSchemeKey{}).(string); ok {
+		return scheme
+	}
+	if r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
@@ -0,0 +1,32 @@
+package handlers
+
+import "acortador-urls/internal/shortener"
+
+// ReferrerParams limita las redirecciones de un enlace a las visitas procedentes de ciertos
+// dominios
+type ReferrerParams struct {
+	// Domains son los dominios de procedencia admitidos, incluidos sus subdominios
+	Domains []string `json:"domains" example:"newsletter.example.com"`
+	// Fallback es block (403, por defecto) o interstitial (página de aviso con el destino)
+	Fallback string `json:"fallback,omitempty" example:"block"`
+}
+
+// toReferrerPolicy convierte los parámetros de la petición en los del servicio
+func (p *ReferrerParams) toReferrerPolicy() shortener.ReferrerPolicy {
+	if p == nil {
+		return shortener.ReferrerPolicy{}
+	}
+	return shortener.ReferrerPolicy{Domains: p.Domains, Fallback: p.Fallback}
+}
+
+// referrerResponse convierte las procedencias permitidas del enlace en su representación HTTP
+func referrerResponse(policy shortener.ReferrerPolicy) *ReferrerParams {
+	if policy.IsZero() {
+		return nil
+	}
+	response := &ReferrerParams{Domains: policy.Domains, Fallback: policy.Fallback}
+	if response.Fallback == "" {
+		response.Fallback = shortener.ReferrerBlock
+	}
+	return response
+}
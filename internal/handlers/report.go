@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"acortador-urls/internal/errcode"
+	"acortador-urls/internal/shortener"
+)
+
+// ReportRequest representa la denuncia pública de un enlace
+type ReportRequest struct {
+	// Reason es malware, phishing, spam u other
+	Reason  string `json:"reason"`
+	Comment string `json:"comment,omitempty"`
+}
+
+// ReportResponse representa una denuncia
+type ReportResponse struct {
+	ID        int64     `json:"id"`
+	ShortCode string    `json:"short_code"`
+	Reason    string    `json:"reason"`
+	Comment   string    `json:"comment,omitempty"`
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ReportListResponse es una página de denuncias
+type ReportListResponse struct {
+	Reports []ReportResponse `json:"reports"`
+	Total   int              `json:"total"`
+	Page    int              `json:"page"`
+	PerPage int              `json:"per_page"`
+}
+
+// BulkDisableRequest representa la desactivación masiva de enlaces denunciados
+type BulkDisableRequest struct {
+	ShortCodes []string `json:"short_codes"`
+	Reason     string   `json:"reason,omitempty"`
+}
+
+// BulkDisableResult es el resultado de desactivar uno de los enlaces
+type BulkDisableResult struct {
+	ShortCode string         `json:"short_code"`
+	Disabled  bool           `json:"disabled"`
+	Error     *ErrorResponse `json:"error,omitempty"`
+}
+
+// BulkDisableResponse agrupa los resultados de la desactivación masiva
+type BulkDisableResponse struct {
+	Results []BulkDisableResult `json:"results"`
+}
+
+// ReportURL maneja POST /report/{short_code}, la denuncia pública de un enlace malicioso. No
+// requiere autenticación; la IP del cliente identifica al denunciante para la cuarentena.
+func (h *Handler) ReportURL(w http.ResponseWriter, r *http.Request) {
+	var req ReportRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.sendDecodeError(w, r, err)
+		return
+	}
+
+	report, err := h.service.ReportLink(r.Context(), h.linkKey(r), shortener.ReportInput{
+		Reason:   req.Reason,
+		Comment:  req.Comment,
+		Reporter: ClientIP(r),
+	})
+	if err != nil {
+		if errors.As(err, new(*shortener.ValidationError)) {
+			h.sendJSON(w, http.StatusBadRequest, localizeError(w, r, ErrorResponse{
+				Error:   errcode.InvalidReport,
+				Message: "Denuncia inválida",
+				Errors:  validationErrors(err),
+			}))
+			return
+		}
+		h.sendManagementError(w, r, err)
+		return
+	}
+
+	h.sendJSON(w, http.StatusAccepted, reportResponse(report))
+}
+
+// ListReports maneja GET /admin/reports?short_code=&status=&page=&per_page=
+func (h *Handler) ListReports(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	page, perPage, errs := pageParams(params)
+	if len(errs) > 0 {
+		h.sendQueryError(w, r, errors.Join(errs...))
+		return
+	}
+
+	result, err := h.service.ListReports(r.Context(), actorFromRequest(r), shortener.ReportQuery{
+		ShortCode: params.Get("short_code"),
+		Status:    params.Get("status"),
+		Offset:    (page - 1) * perPage,
+		Limit:     perPage,
+	})
+	if err != nil {
+		if errors.As(err, new(*shortener.ValidationError)) {
+			h.sendQueryError(w, r, err)
+			return
+		}
+		h.sendManagementError(w, r, err)
+		return
+	}
+	response := ReportListResponse{
+		Reports: make([]ReportResponse, 0, len(result.Reports)),
+		Total:   result.Total,
+		Page:    page,
+		PerPage: perPage,
+	}
+	for _, report := range result.Reports {
+		response.Reports = append(response.Reports, reportResponse(report))
+	}
+
+	h.sendJSON(w, http.StatusOK, response)
+}
+
+// DismissReports maneja POST /admin/reports/{short_code}:dismiss, que descarta las denuncias
+// abiertas del enlace y lo saca de la cuarentena
+func (h *Handler) DismissReports(w http.ResponseWriter, r *http.Request) {
+	link, err := h.service.DismissReports(r.Context(), actorFromRequest(r), h.managedLinkKey(r))
+	if err != nil {
+		h.sendManagementError(w, r, err)
+		return
+	}
+
+	h.sendJSON(w, http.StatusOK, h.toLinkResponse(r, link))
+}
+
+// DisableReported maneja POST /admin/reports/disable desactivando varios enlaces a la vez y
+// resolviendo sus denuncias abiertas
+func (h *Handler) DisableReported(w http.ResponseWriter, r *http.Request) {
+	var req BulkDisableRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.sendDecodeError(w, r, err)
+		return
+	}
+
+	switch {
+	case len(req.ShortCodes) == 0:
+		h.sendErrorResponse(w, r, http.StatusBadRequest, errcode.EmptyBatch, "Se debe indicar al menos un código")
+		return
+	case len(req.ShortCodes) > h.maxBatchSize:
+		h.sendErrorResponse(w, r, http.StatusRequestEntityTooLarge, errcode.BatchTooLarge,
+			fmt.Sprintf("No se pueden desactivar más de %d códigos por petición", h.maxBatchSize))
+		return
+	}
+
+	errs, err := h.service.DisableReported(r.Context(), actorFromRequest(r), req.ShortCodes, req.Reason)
+	if err != nil {
+		h.sendManagementError(w, r, err)
+		return
+	}
+	response := BulkDisableResponse{Results: make([]BulkDisableResult, 0, len(req.ShortCodes))}
+	for i, code := range req.ShortCodes {
+		result := BulkDisableResult{ShortCode: code, Disabled: errs[i] == nil}
+		if errs[i] != nil {
+			_, errResponse := managementErrorResponse(errs[i])
+			result.Error = itemError(r, errResponse)
+		}
+		response.Results = append(response.Results, result)
+	}
+
+	h.sendJSON(w, http.StatusOK, response)
+}
+
+// reportResponse convierte una denuncia en su representación HTTP; el denunciante no se expone
+func reportResponse(report shortener.Report) ReportResponse {
+	return ReportResponse{
+		ID:        report.ID,
+		ShortCode: report.ShortCode,
+		Reason:    report.Reason,
+		Comment:   report.Comment,
+		Status:    report.Status,
+		CreatedAt: report.CreatedAt,
+	}
+}
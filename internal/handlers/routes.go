@@ -0,0 +1,19 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"acortador-urls/internal/shortener"
+)
+
+// ReserveRoutes registra en routes los patrones del router, incluidos los de los subrouters
+// montados, para que el filtro de códigos rechace los alias que las rutas taparían. Se llama
+// una vez definido el router, así que un endpoint nuevo queda reservado sin más cambios.
+func ReserveRoutes(router chi.Routes, routes *shortener.RouteRegistry) error {
+	return chi.Walk(router, func(_ string, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		routes.Register(route)
+		return nil
+	})
+}
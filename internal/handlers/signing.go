@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+
+	"acortador-urls/internal/errcode"
+	"acortador-urls/internal/shortener"
+)
+
+// SignRequest representa la petición de una URL firmada; sin expires_at ni ttl_seconds la
+// firma no caduca
+type SignRequest struct {
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	TTLSeconds int64      `json:"ttl_seconds,omitempty" example:"86400"`
+}
+
+// SignedURLResponse es una URL firmada lista para compartir
+type SignedURLResponse struct {
+	ShortCode string `json:"short_code"`
+	// SignedURL es la URL corta con los parámetros sig y, si caduca, exp
+	SignedURL string     `json:"signed_url" example:"https://go.example.com/abc123?exp=1767225600&sig=Jx3..."`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// SignURL maneja POST /api/urls/{short_code}/sign: emite una URL firmada de un enlace creado con
+// "signed": true, p. ej. para compartirlo durante un día. Solo el propietario, los editores de
+// su espacio o un admin pueden pedirla.
+func (h *Handler) SignURL(w http.ResponseWriter, r *http.Request) {
+	var req SignRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.sendDecodeError(w, r, err)
+		return
+	}
+
+	expiry := shortener.SignatureExpiry{TTL: time.Duration(req.TTLSeconds) * time.Second}
+	if req.ExpiresAt != nil {
+		expiry.ExpiresAt = *req.ExpiresAt
+	}
+	signed, err := h.service.SignLink(r.Context(), actorFromRequest(r), h.managedLinkKey(r), expiry)
+	if err != nil {
+		h.sendManagementError(w, r, err)
+		return
+	}
+
+	response := SignedURLResponse{
+		ShortCode: signed.Link.ShortCode,
+		SignedURL: h.shortURL(r, signed.Link) + "?" + signed.Query.Encode(),
+	}
+	if !signed.ExpiresAt.IsZero() {
+		response.ExpiresAt = &signed.ExpiresAt
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	h.sendJSON(w, http.StatusOK, response)
+}
+
+// sendSignatureError responde a una visita a un enlace firmado sin una firma válida; las firmas
+// caducadas responden 410 como los enlaces expirados
+func (h *Handler) sendSignatureError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, shortener.ErrSignatureExpired):
+		h.sendErrorResponse(w, r, http.StatusGone, errcode.SignatureExpired, "La URL firmada ha caducado")
+	case errors.Is(err, shortener.ErrInvalidSignature):
+		h.sendErrorResponse(w, r, http.StatusForbidden, errcode.InvalidSignature, "La firma de la URL no es válida")
+	default:
+		h.sendErrorResponse(w, r, http.StatusForbidden, errcode.SignatureRequired, "Este enlace solo se puede abrir con una URL firmada")
+	}
+}
+
+// signedAction retorna la ruta de la visita con su firma, para que el formulario de contraseña
+// de un enlace firmado la conserve al enviarse
+func signedAction(r *http.Request) string {
+	query := url.Values{}
+	for _, key := range []string{shortener.SignatureQueryParam, shortener.SignatureExpiryQueryParam} {
+		if value := r.URL.Query().Get(key); value != "" {
+			query.Set(key, value)
+		}
+	}
+	if len(query) == 0 {
+		return r.URL.Path
+	}
+	return r.URL.Path + "?" + query.Encode()
+}
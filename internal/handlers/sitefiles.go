@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	_ "embed"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"acortador-urls/internal/errcode"
+)
+
+// DefaultRobotsTxt permite rastrear la página de inicio e impide rastrear el resto: las URLs
+// cortas solo redirigen y la API no tiene nada que indexar
+const DefaultRobotsTxt = "User-agent: *\nAllow: /$\nDisallow: /\n"
+
+// SecurityTxtValidity es la vigencia que anuncia el campo Expires de security.txt, contada
+// desde cada petición; RFC 9116 recomienda que no supere un año
+const SecurityTxtValidity = 180 * 24 * time.Hour
+
+// siteFilesMaxAge es el tiempo durante el que navegadores y proxies reutilizan estos archivos
+const siteFilesMaxAge = 24 * time.Hour
+
+//go:embed static/favicon.ico
+var defaultFavicon []byte
+
+// SecurityTxt son los campos de /.well-known/security.txt (RFC 9116)
+type SecurityTxt struct {
+	// Contacts son las URIs de contacto (mailto:, https: o tel:) en orden de preferencia
+	Contacts []string
+	// Policy es la URL de la política de divulgación de vulnerabilidades; opcional
+	Policy string
+}
+
+// WithRobotsTxt reemplaza el robots.txt por defecto (DefaultRobotsTxt)
+func WithRobotsTxt(content string) Option {
+	return func(h *Handler) {
+		h.robotsTxt = content
+	}
+}
+
+// WithFavicon reemplaza el favicon incluido en el binario; el tipo se deduce del contenido, así
+// que admite ICO y PNG
+func WithFavicon(icon []byte) Option {
+	return func(h *Handler) {
+		h.favicon = icon
+	}
+}
+
+// WithSecurityTxt publica /.well-known/security.txt; sin contactos responde 404
+func WithSecurityTxt(security SecurityTxt) Option {
+	return func(h *Handler) {
+		h.securityTxt = security
+	}
+}
+
+// RobotsTxt maneja GET /robots.txt
+func (h *Handler) RobotsTxt(w http.ResponseWriter, r *http.Request) {
+	sendSiteFile(w, "text/plain; charset=utf-8", []byte(h.robotsTxt))
+}
+
+// Favicon maneja GET /favicon.ico, que los navegadores piden al visitar cualquier URL corta
+func (h *Handler) Favicon(w http.ResponseWriter, r *http.Request) {
+	sendSiteFile(w, http.DetectContentType(h.favicon), h.favicon)
+}
+
+// SecurityTxt maneja GET /.well-known/security.txt. Canonical es la URL de la petición, de modo
+// que cada dominio de redirección publica la suya, y Expires se renueva en cada petición.
+func (h *Handler) SecurityTxt(w http.ResponseWriter, r *http.Request) {
+	if len(h.securityTxt.Contacts) == 0 {
+		h.sendErrorResponse(w, r, http.StatusNotFound, errcode.NotFound, "security.txt no configurado")
+		return
+	}
+	var body strings.Builder
+	for _, contact := range h.securityTxt.Contacts {
+		fmt.Fprintf(&body, "Contact: %s\n", contact)
+	}
+	fmt.Fprintf(&body, "Expires: %s\n", time.Now().UTC().Add(SecurityTxtValidity).Truncate(24*time.Hour).Format(time.RFC3339))
+	if h.securityTxt.Policy != "" {
+		fmt.Fprintf(&body, "Policy: %s\n", h.securityTxt.Policy)
+	}
+	body.WriteString("Preferred-Languages: es, en\n")
+	fmt.Fprintf(&body, "Canonical: %s/.well-known/security.txt\n", h.getBaseURL(r))
+	sendSiteFile(w, "text/plain; charset=utf-8", []byte(body.String()))
+}
+
+// sendSiteFile responde con un archivo que navegadores y proxies pueden guardar en caché
+func sendSiteFile(w http.ResponseWriter, contentType string, content []byte) {
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(siteFilesMaxAge.Seconds())))
+	w.WriteHeader(http.StatusOK)
+	w.Write(content)
+}
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"net/http"
+
+	"acortador-urls/internal/shortener"
+)
+
+// StatsResponse es el estado de los enlaces del servicio para los paneles de control
+type StatsResponse struct {
+	// TotalLinks es la suma de ActiveLinks, ExpiredLinks y DisabledLinks
+	TotalLinks    int `json:"total_links"`
+	ActiveLinks   int `json:"active_links"`
+	ExpiredLinks  int `json:"expired_links"`
+	DisabledLinks int `json:"disabled_links"`
+	BrokenLinks   int `json:"broken_links"`
+	// ClicksToday son las visitas que registró esta instancia desde la medianoche UTC
+	ClicksToday    int64                       `json:"clicks_today"`
+	Store          StoreStatsResponse          `json:"store"`
+	CodeGeneration CodeGenerationStatsResponse `json:"code_generation"`
+}
+
+// CodeGenerationStatsResponse son los reintentos por colisión al generar códigos desde el
+// arranque. Si warnings o saturated crecen, el espacio de códigos se está llenando.
+type CodeGenerationStatsResponse struct {
+	Generated uint64 `json:"generated"`
+	Retries   uint64 `json:"retries"`
+	Warnings  uint64 `json:"warnings"`
+	Saturated uint64 `json:"saturated"`
+}
+
+// Stats maneja GET /api/stats, que recorre los enlaces para contar los activos, expirados,
+// desactivados y con el destino roto, junto con las visitas de hoy y el estado del almacén.
+// Es solo para administradores porque abarca todos los espacios.
+func (h *Handler) Stats(w http.ResponseWriter, r *http.Request) {
+	stats, err := h.service.GetStats(r.Context())
+	if err != nil {
+		h.sendManagementError(w, r, err)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	h.sendJSON(w, http.StatusOK, StatsResponse{
+		TotalLinks:     stats.TotalLinks,
+		ActiveLinks:    stats.ActiveLinks,
+		ExpiredLinks:   stats.ExpiredLinks,
+		DisabledLinks:  stats.DisabledLinks,
+		BrokenLinks:    stats.BrokenLinks,
+		ClicksToday:    stats.ClicksToday,
+		Store:          storeStatsResponse(stats.Store),
+		CodeGeneration: codeGenerationStatsResponse(stats.Collisions),
+	})
+}
+
+// codeGenerationStatsResponse convierte los reintentos de generación en su respuesta
+func codeGenerationStatsResponse(stats shortener.CollisionStats) CodeGenerationStatsResponse {
+	return CodeGenerationStatsResponse{Generated: stats.Generated, Retries: stats.Retries, Warnings: stats.Warnings, Saturated: stats.Saturated}
+}
+
+// storeStatsResponse convierte la ocupación del almacén en su respuesta
+func storeStatsResponse(store shortener.StoreStats) StoreStatsResponse {
+	return StoreStatsResponse{
+		Backend:   store.Backend,
+		Links:     store.Links,
+		Capacity:  store.Capacity,
+		Policy:    store.Policy,
+		Evictions: store.Evictions,
+		Memory:    storeMemoryResponse(store.Memory),
+	}
+}
+
+// storeMemoryResponse convierte la estimación de memoria del almacén en su respuesta
+func storeMemoryResponse(usage *shortener.MemoryUsage) *StoreMemoryResponse {
+	if usage == nil {
+		return nil
+	}
+	response := &StoreMemoryResponse{
+		Bytes:            usage.Bytes,
+		ReclaimableBytes: usage.ReclaimableBytes,
+		Reclaimable:      usage.Reclaimable(),
+		PeakLinks:        usage.PeakLinks,
+	}
+	if !usage.CompactedAt.IsZero() {
+		response.CompactedAt = &usage.CompactedAt
+	}
+	return response
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"acortador-urls/internal/errcode"
+	"acortador-urls/internal/shortener"
+)
+
+// streamHeartbeat es la frecuencia de los comentarios que mantienen abierta la conexión del
+// stream a través de proxies que cierran las conexiones inactivas
+const streamHeartbeat = 15 * time.Second
+
+// streamEventTypes son los eventos que se transmiten por el stream
+var streamEventTypes = []string{shortener.EventCreated, shortener.EventClicked}
+
+// WithEventStream habilita GET /api/events/stream con los eventos del broker
+func WithEventStream(broker *shortener.EventBroker) Option {
+	return func(h *Handler) {
+		h.events = broker
+	}
+}
+
+// StreamEventResponse es el campo data de cada evento del stream
+type StreamEventResponse struct {
+	Time      time.Time `json:"time"`
+	ShortCode string    `json:"short_code"`
+	LongURL   string    `json:"long_url"`
+	Owner     string    `json:"owner,omitempty"`
+	Clicks    int64     `json:"clicks"`
+	Variant   string    `json:"variant,omitempty"`
+}
+
+// StreamEvents maneja GET /api/events/stream?short_code=&owner=, un stream Server-Sent Events
+// con las creaciones (link.created) y visitas (link.clicked) en tiempo real. Los usuarios
+// reciben los eventos de sus enlaces; los administradores, los de todos o los de owner.
+func (h *Handler) StreamEvents(w http.ResponseWriter, r *http.Request) {
+	if h.events == nil {
+		h.sendErrorResponse(w, r, http.StatusNotFound, errcode.EventStreamDisabled, "El stream de eventos no está habilitado")
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		h.sendErrorResponse(w, r, http.StatusInternalServerError, errcode.StreamingUnsupported, "La conexión no admite streaming")
+		return
+	}
+
+	params := r.URL.Query()
+	filter := shortener.EventFilter{ShortCode: params.Get("short_code"), Owner: params.Get("owner"), Types: streamEventTypes}
+	actor := actorFromRequest(r)
+	if !actor.Admin {
+		if filter.Owner != "" && filter.Owner != actor.UserID {
+			h.sendManagementError(w, r, shortener.ErrForbidden)
+			return
+		}
+		filter.Owner = actor.UserID
+	}
+
+	events, cancel := h.events.Subscribe(filter, 0)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	// Reconexión del navegador tras 3s si se corta el stream
+	fmt.Fprint(w, "retry: 3000\n\n")
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+		case event := <-events:
+			data, err := json.Marshal(StreamEventResponse{
+				Time:      event.Time.UTC(),
+				ShortCode: event.Link.ShortCode,
+				LongURL:   event.Link.LongURL,
+				Owner:     event.Link.Owner,
+				Clicks:    event.Link.Clicks,
+				Variant:   event.Variant,
+			})
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+		}
+		flusher.Flush()
+	}
+}
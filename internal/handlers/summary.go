@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"acortador-urls/internal/analytics"
+	"acortador-urls/internal/errcode"
+	"acortador-urls/internal/shortener"
+)
+
+// DefaultSummaryPeriod es el periodo de GET /api/reports/summary si no se indica
+const DefaultSummaryPeriod = "7d"
+
+// WithSummaryReports habilita GET /api/reports/summary con los agregados diarios del aggregator
+func WithSummaryReports(aggregator *analytics.Aggregator) Option {
+	return func(h *Handler) {
+		h.summaries = aggregator
+	}
+}
+
+// SummaryReportResponse resume la actividad de los enlaces en un periodo
+type SummaryReportResponse struct {
+	Period string    `json:"period"`
+	From   time.Time `json:"from"`
+	To     time.Time `json:"to"`
+	// Clicks incluye las visitas de bots, que se detallan en BotClicks
+	Clicks       int64                 `json:"clicks"`
+	BotClicks    int64                 `json:"bot_clicks"`
+	NewLinks     int                   `json:"new_links"`
+	TopLinks     []TopLinkResponse     `json:"top_links"`
+	TopReferrers []TopReferrerResponse `json:"top_referrers"`
+	TopCountries []TopCountryResponse  `json:"top_countries"`
+}
+
+// TopLinkResponse son las visitas de un enlace en el periodo
+type TopLinkResponse struct {
+	ShortCode string `json:"short_code"`
+	Owner     string `json:"owner,omitempty"`
+	Clicks    int64  `json:"clicks"`
+}
+
+// TopReferrerResponse son las visitas procedentes de un dominio en el periodo
+type TopReferrerResponse struct {
+	Referrer string `json:"referrer"`
+	Clicks   int64  `json:"clicks"`
+}
+
+// TopCountryResponse son las visitas desde un país en el periodo
+type TopCountryResponse struct {
+	Country string `json:"country"`
+	Clicks  int64  `json:"clicks"`
+}
+
+// SummaryReport maneja GET /api/reports/summary?period=7d&owner=&tag=, el resumen de los
+// últimos días (incluido el actual, en UTC): visitas, enlaces nuevos y los 10 enlaces,
+// referrers y países con más visitas. Los usuarios reciben el de sus enlaces; los
+// administradores, el de todos o el de owner.
+func (h *Handler) SummaryReport(w http.ResponseWriter, r *http.Request) {
+	if h.summaries == nil {
+		h.sendErrorResponse(w, r, http.StatusNotFound, errcode.ReportsDisabled, "Los informes de analítica no están habilitados")
+		return
+	}
+	params := r.URL.Query()
+	period := params.Get("period")
+	if period == "" {
+		period = DefaultSummaryPeriod
+	}
+	days, err := summaryDays(period, h.summaries.RetentionDays())
+	if err != nil {
+		h.sendQueryError(w, r, err)
+		return
+	}
+	filter := analytics.Filter{Owner: params.Get("owner"), Tag: params.Get("tag")}
+	actor := actorFromRequest(r)
+	if !actor.Admin {
+		if filter.Owner != "" && filter.Owner != actor.UserID {
+			h.sendManagementError(w, r, shortener.ErrForbidden)
+			return
+		}
+		filter.Owner = actor.UserID
+	}
+
+	summary := h.summaries.Summary(filter, days, analytics.DefaultTop)
+	response := SummaryReportResponse{
+		Period:       period,
+		From:         summary.From,
+		To:           summary.To,
+		Clicks:       summary.Clicks,
+		BotClicks:    summary.BotClicks,
+		NewLinks:     summary.NewLinks,
+		TopLinks:     make([]TopLinkResponse, 0, len(summary.TopLinks)),
+		TopReferrers: make([]TopReferrerResponse, 0, len(summary.TopReferrers)),
+		TopCountries: make([]TopCountryResponse, 0, len(summary.TopCountries)),
+	}
+	for _, link := range summary.TopLinks {
+		response.TopLinks = append(response.TopLinks, TopLinkResponse{ShortCode: link.ShortCode, Owner: link.Owner, Clicks: link.Clicks})
+	}
+	for _, referrer := range summary.TopReferrers {
+		response.TopReferrers = append(response.TopReferrers, TopReferrerResponse{Referrer: referrer.Key, Clicks: referrer.Clicks})
+	}
+	for _, country := range summary.TopCountries {
+		response.TopCountries = append(response.TopCountries, TopCountryResponse{Country: country.Key, Clicks: country.Clicks})
+	}
+
+	h.sendJSON(w, http.StatusOK, response)
+}
+
+// summaryDays interpreta el periodo de un resumen, un número de días con el sufijo d (p. ej.
+// 7d o 30d), entre 1 y los días que conservan los agregados
+func summaryDays(period string, maxDays int) (int, error) {
+	days, err := strconv.Atoi(strings.TrimSuffix(period, "d"))
+	if err != nil || !strings.HasSuffix(period, "d") || days < 1 || days > maxDays {
+		return 0, &shortener.ValidationError{Field: "period", Value: period,
+			Msg: fmt.Sprintf("debe ser un número de días entre 1d y %dd", maxDays)}
+	}
+	return days, nil
+}
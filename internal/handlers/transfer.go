@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"acortador-urls/internal/errcode"
+	"acortador-urls/internal/shortener"
+)
+
+// DefaultTransferTTL es la vigencia de una solicitud de traspaso; el receptor debe confirmarla
+// antes de que caduque, así que es más larga que la de las operaciones sobre los datos de usuario
+const DefaultTransferTTL = 72 * time.Hour
+
+// linkTransfer es la operación de los tokens de confirmación de traspasos
+const linkTransfer = "transfer"
+
+// TransferRequest representa la solicitud de ceder un enlace a otro usuario
+type TransferRequest struct {
+	// To es el usuario o el sujeto de la clave de API que recibirá el enlace
+	To string `json:"to" example:"bob"`
+}
+
+// TransferResponse es un traspaso pendiente: el receptor lo acepta repitiendo la petición con
+// ?confirm=ConfirmationToken
+type TransferResponse struct {
+	ShortCode         string    `json:"short_code"`
+	From              string    `json:"from"`
+	To                string    `json:"to"`
+	ConfirmationToken string    `json:"confirmation_token"`
+	ExpiresAt         time.Time `json:"expires_at"`
+}
+
+// TransferURL maneja POST /api/urls/{short_code}/transfer. Sin confirm, el propietario o un admin
+// pide ceder el enlace al usuario de "to" y recibe 202 con el token de confirmación, que anula
+// el de cualquier oferta anterior; con ?confirm=, el receptor acepta el traspaso y recibe el
+// enlace, con sus estadísticas, como propio. Cada token se acepta una sola vez.
+func (h *Handler) TransferURL(w http.ResponseWriter, r *http.Request) {
+	actor := actorFromRequest(r)
+	if token := r.URL.Query().Get(ConfirmParam); token != "" {
+		claims, ok := h.verifyConfirmation(token)
+		switch {
+		case !ok || claims.Operation != linkTransfer || actor.UserID == "" || claims.Actor != actor.UserID:
+			h.sendErrorResponse(w, r, http.StatusForbidden, errcode.InvalidConfirmation, "Token de confirmación inválido")
+			return
+		case time.Now().Unix() >= claims.ExpiresAt:
+			h.sendErrorResponse(w, r, http.StatusForbidden, errcode.InvalidConfirmation, "El token de confirmación ha expirado")
+			return
+		}
+
+		transfer := shortener.Transfer{Link: claims.Link, From: claims.UserID, Nonce: claims.Nonce}
+		link, err := h.service.AcceptTransfer(r.Context(), actor, h.managedLinkKey(r), transfer, apiKeyFromRequest(r))
+		if err != nil {
+			h.sendManagementError(w, r, err)
+			return
+		}
+		h.sendJSON(w, http.StatusOK, h.toLinkResponse(r, link))
+		return
+	}
+
+	var req TransferRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.sendDecodeError(w, r, err)
+		return
+	}
+	link, err := h.service.RequestTransfer(r.Context(), actor, h.managedLinkKey(r), req.To)
+	if err != nil {
+		h.sendManagementError(w, r, err)
+		return
+	}
+
+	to := strings.TrimSpace(req.To)
+	expiresAt := time.Now().Add(DefaultTransferTTL).UTC().Truncate(time.Second)
+	token := h.signConfirmation(confirmation{Operation: linkTransfer, UserID: link.Owner, Actor: to, Link: link.Key(),
+		Nonce: link.PendingTransfer, ExpiresAt: expiresAt.Unix()})
+	w.Header().Set("Cache-Control", "no-store")
+	h.sendJSON(w, http.StatusAccepted, TransferResponse{
+		ShortCode:         link.ShortCode,
+		From:              link.Owner,
+		To:                to,
+		ConfirmationToken: token,
+		ExpiresAt:         expiresAt,
+	})
+}
+
+// CancelTransfer maneja DELETE /api/urls/{short_code}/transfer: el propietario o un admin
+// retira la oferta de traspaso pendiente y su token deja de servir. Responde 204 haya o no una
+// oferta pendiente.
+func (h *Handler) CancelTransfer(w http.ResponseWriter, r *http.Request) {
+	if err := h.service.CancelTransfer(r.Context(), actorFromRequest(r), h.managedLinkKey(r)); err != nil {
+		h.sendManagementError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
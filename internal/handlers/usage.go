@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"acortador-urls/internal/errcode"
+	"acortador-urls/internal/shortener"
+)
+
+// keyIDPattern valida los identificadores de clave de API (ver shortener.APIKeyID)
+var keyIDPattern = regexp.MustCompile(`^[0-9a-f]{16}$`)
+
+// KeyUsageResponse es el consumo del mes en curso de una clave de API. Las cuotas en cero no
+// limitan.
+type KeyUsageResponse struct {
+	KeyID         string    `json:"key_id"`
+	Period        string    `json:"period"`
+	Shortens      int64     `json:"shortens"`
+	Redirects     int64     `json:"redirects"`
+	ShortenQuota  int64     `json:"shorten_quota"`
+	RedirectQuota int64     `json:"redirect_quota"`
+	ResetsAt      time.Time `json:"resets_at"`
+}
+
+// KeyUsage maneja GET /admin/keys/{id}/usage. {id} es el identificador de la clave, los 16
+// primeros caracteres hexadecimales de su SHA-256, para no exponer la clave en URLs ni logs.
+func (h *Handler) KeyUsage(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if !keyIDPattern.MatchString(id) {
+		h.sendErrorResponse(w, r, http.StatusBadRequest, errcode.InvalidKeyID,
+			"El identificador de la clave son los 16 primeros caracteres hexadecimales de su SHA-256")
+		return
+	}
+	usage := h.service.KeyUsage(id)
+	h.sendCacheableJSON(w, r, KeyUsageResponse{
+		KeyID:         usage.KeyID,
+		Period:        usage.Period,
+		Shortens:      usage.Shortens,
+		Redirects:     usage.Redirects,
+		ShortenQuota:  usage.Limits.Shortens,
+		RedirectQuota: usage.Limits.Redirects,
+		ResetsAt:      usage.ResetAt,
+	})
+}
+
+// sendUsageQuotaError responde 429 a las visitas de un enlace cuya clave agotó su cuota de
+// redirecciones, con Retry-After hasta que se renueva
+func (h *Handler) sendUsageQuotaError(w http.ResponseWriter, r *http.Request, err error) {
+	var quota *shortener.UsageQuotaError
+	if errors.As(err, &quota) {
+		if seconds := int(time.Until(quota.ResetAt).Seconds()); seconds > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(seconds))
+		}
+	}
+	h.sendErrorResponse(w, r, http.StatusTooManyRequests, errcode.UsageQuotaExceeded,
+		"El enlace superó su cuota mensual de redirecciones")
+}
@@ -0,0 +1,283 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"acortador-urls/internal/analytics"
+	"acortador-urls/internal/errcode"
+	"acortador-urls/internal/shortener"
+	"acortador-urls/internal/webhooks"
+)
+
+// DefaultConfirmationTTL es la vigencia de los tokens que confirman la exportación o el borrado
+// de los datos de un usuario
+const DefaultConfirmationTTL = 10 * time.Minute
+
+// ConfirmParam es el parámetro de query con el token de confirmación
+const ConfirmParam = "confirm"
+
+// Operaciones sobre los datos de un usuario que requieren confirmación
+const (
+	userDataExport = "export"
+	userDataDelete = "delete"
+)
+
+// confirmationKey firma los tokens de confirmación si no se configura una clave; es aleatoria por
+// proceso, así que los tokens no sobreviven a un reinicio ni sirven en otras instancias
+var confirmationKey = func() []byte {
+	key := make([]byte, 32)
+	rand.Read(key)
+	return key
+}()
+
+// WithUserDataConfirmation firma los tokens de confirmación de GET /api/users/{id}/export y
+// DELETE /api/users/{id}/data con una clave derivada de secret (p. ej. JWT_SECRET), para que
+// sirvan en cualquier instancia, y fija su vigencia. La clave derivada impide usar un token de
+// confirmación como token de sesión y al revés. La misma clave firma las confirmaciones de los
+// traspasos de enlaces.
+func WithUserDataConfirmation(secret []byte, ttl time.Duration) Option {
+	return func(h *Handler) {
+		if len(secret) > 0 {
+			mac := hmac.New(sha256.New, secret)
+			mac.Write([]byte("confirmacion-datos-de-usuario"))
+			h.confirmationKey = mac.Sum(nil)
+		}
+		if ttl > 0 {
+			h.confirmationTTL = ttl
+		}
+	}
+}
+
+// confirmation es el contenido firmado de un token de confirmación: la operación, el usuario
+// cuyos datos se tratan y quien la pidió, que es el único que puede confirmarla. En los
+// traspasos, el usuario es el propietario que cede el enlace, Link su clave y Actor quien lo
+// recibe.
+type confirmation struct {
+	Operation string `json:"op"`
+	UserID    string `json:"sub"`
+	Actor     string `json:"act"`
+	Link      string `json:"lnk,omitempty"`
+	Nonce     string `json:"nce,omitempty"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// UserDataConfirmationResponse es la respuesta a la primera petición de exportación o borrado:
+// lo que abarca la operación y el token con el que hay que repetir la petición para confirmarla
+type UserDataConfirmationResponse struct {
+	UserID            string    `json:"user_id"`
+	Operation         string    `json:"operation"`
+	ConfirmationToken string    `json:"confirmation_token"`
+	ExpiresAt         time.Time `json:"expires_at"`
+	Links             int       `json:"links"`
+	Collections       int       `json:"collections"`
+	AuditEntries      int       `json:"audit_entries"`
+}
+
+// UserDataDeletionResponse resume los datos eliminados
+type UserDataDeletionResponse struct {
+	UserID       string `json:"user_id"`
+	Links        int    `json:"links"`
+	Collections  int    `json:"collections"`
+	AuditEntries int    `json:"audit_entries"`
+	// WebhookDeliveries son las entregas de eventos de sus enlaces eliminadas del log
+	WebhookDeliveries int `json:"webhook_deliveries"`
+}
+
+// UserDataExportResponse son todos los datos atribuibles a un usuario
+type UserDataExportResponse struct {
+	UserID     string    `json:"user_id"`
+	ExportedAt time.Time `json:"exported_at"`
+	// Links incluye las estadísticas acumuladas de cada enlace
+	Links       []LinkResponse       `json:"links"`
+	Collections []CollectionResponse `json:"collections"`
+	Audit       []AuditEntryResponse `json:"audit"`
+	// LiveAnalytics es la actividad reciente de sus enlaces; vacía si no hay métricas en vivo
+	LiveAnalytics []LiveCountersResponse `json:"live_analytics"`
+	// WebhookDeliveries son las entregas de eventos de sus enlaces que conserva el log
+	WebhookDeliveries []WebhookDeliveryResponse `json:"webhook_deliveries"`
+}
+
+// ExportUserData maneja GET /api/users/{id}/export?confirm=. Sin confirm responde 202 con el
+// token de confirmación; con él, todos los datos del usuario como un JSON descargable.
+func (h *Handler) ExportUserData(w http.ResponseWriter, r *http.Request) {
+	userID, actor := chi.URLParam(r, "id"), actorFromRequest(r)
+	data, err := h.service.ExportUserData(r.Context(), actor, userID)
+	if err != nil {
+		h.sendManagementError(w, r, err)
+		return
+	}
+	if !h.confirmed(w, r, userDataExport, data) {
+		return
+	}
+
+	keys := make([]string, 0, len(data.Links))
+	response := UserDataExportResponse{
+		UserID:            userID,
+		ExportedAt:        time.Now().UTC(),
+		Links:             make([]LinkResponse, 0, len(data.Links)),
+		Collections:       make([]CollectionResponse, 0, len(data.Collections)),
+		Audit:             make([]AuditEntryResponse, 0, len(data.Audit)),
+		LiveAnalytics:     make([]LiveCountersResponse, 0),
+		WebhookDeliveries: make([]WebhookDeliveryResponse, 0),
+	}
+	for _, link := range data.Links {
+		keys = append(keys, link.Key())
+		response.Links = append(response.Links, h.toLinkResponse(r, link))
+	}
+	for _, collection := range data.Collections {
+		stats := shortener.CollectionStats{Collection: collection}
+		for _, link := range data.Links {
+			if link.CollectionID == collection.ID {
+				stats.Links++
+				stats.Clicks += link.Clicks
+				stats.BotClicks += link.BotClicks
+			}
+		}
+		response.Collections = append(response.Collections, collectionResponse(stats))
+	}
+	for _, entry := range data.Audit {
+		response.Audit = append(response.Audit, h.auditEntryResponse(r, entry))
+	}
+	if h.live != nil {
+		for _, counters := range h.live.Snapshot(analytics.Filter{Owner: userID}) {
+			response.LiveAnalytics = append(response.LiveAnalytics, liveCountersResponse(counters))
+		}
+	}
+	// Sin enlaces no hay entregas suyas, y una consulta sin claves las retornaría todas
+	if h.webhooks != nil && len(keys) > 0 {
+		deliveries, _ := h.webhooks.Deliveries(webhooks.DeliveryQuery{LinkKeys: keys})
+		for _, delivery := range deliveries {
+			response.WebhookDeliveries = append(response.WebhookDeliveries, webhookDeliveryResponse(delivery))
+		}
+	}
+
+	// FormatMediaType escapa el identificador del usuario; retorna vacío si no es representable
+	if disposition := mime.FormatMediaType("attachment", map[string]string{"filename": "datos-" + userID + ".json"}); disposition != "" {
+		w.Header().Set("Content-Disposition", disposition)
+	}
+	h.sendJSON(w, http.StatusOK, response)
+}
+
+// DeleteUserData maneja DELETE /api/users/{id}/data?confirm=. Sin confirm responde 202 con el
+// token de confirmación y lo que se borraría; con él, elimina definitivamente los enlaces y
+// colecciones del usuario, sus entradas del log de auditoría y la actividad en memoria de sus
+// enlaces (métricas en vivo, agregados de los informes y log de webhooks).
+func (h *Handler) DeleteUserData(w http.ResponseWriter, r *http.Request) {
+	userID, actor := chi.URLParam(r, "id"), actorFromRequest(r)
+	if r.URL.Query().Get(ConfirmParam) == "" {
+		data, err := h.service.ExportUserData(r.Context(), actor, userID)
+		if err != nil {
+			h.sendManagementError(w, r, err)
+			return
+		}
+		h.confirmed(w, r, userDataDelete, data)
+		return
+	}
+	if !h.confirmed(w, r, userDataDelete, shortener.UserData{UserID: userID}) {
+		return
+	}
+
+	data, err := h.service.DeleteUserData(r.Context(), actor, userID)
+	if err != nil {
+		h.sendManagementError(w, r, err)
+		return
+	}
+	keys := make([]string, 0, len(data.Links))
+	for _, link := range data.Links {
+		keys = append(keys, link.Key())
+	}
+	response := UserDataDeletionResponse{UserID: userID, Links: len(data.Links), Collections: len(data.Collections),
+		AuditEntries: len(data.Audit)}
+	if h.live != nil {
+		h.live.Forget(keys...)
+	}
+	if h.summaries != nil {
+		h.summaries.Forget(keys...)
+	}
+	if h.webhooks != nil {
+		response.WebhookDeliveries = h.webhooks.Forget(keys...)
+	}
+	log.Printf("Datos de usuario eliminados a petición de %q: %d enlaces, %d colecciones, %d entradas de auditoría",
+		actor.UserID, response.Links, response.Collections, response.AuditEntries)
+
+	h.sendJSON(w, http.StatusOK, response)
+}
+
+// confirmed comprueba el token de confirmación de la operación. Sin token responde 202 con uno
+// nuevo y el resumen de data; con un token inválido, expirado o emitido para otra operación,
+// usuario o actor responde 403. Solo retorna true si el token es válido.
+func (h *Handler) confirmed(w http.ResponseWriter, r *http.Request, operation string, data shortener.UserData) bool {
+	actor := actorFromRequest(r).UserID
+	token := r.URL.Query().Get(ConfirmParam)
+	if token == "" {
+		expiresAt := time.Now().Add(h.confirmationTTL).UTC().Truncate(time.Second)
+		h.sendJSON(w, http.StatusAccepted, UserDataConfirmationResponse{
+			UserID:            data.UserID,
+			Operation:         operation,
+			ConfirmationToken: h.signConfirmation(confirmation{Operation: operation, UserID: data.UserID, Actor: actor, ExpiresAt: expiresAt.Unix()}),
+			ExpiresAt:         expiresAt,
+			Links:             len(data.Links),
+			Collections:       len(data.Collections),
+			AuditEntries:      len(data.Audit),
+		})
+		return false
+	}
+
+	claims, ok := h.verifyConfirmation(token)
+	switch {
+	case !ok || claims.Operation != operation || claims.UserID != data.UserID || claims.Actor != actor:
+		h.sendErrorResponse(w, r, http.StatusForbidden, errcode.InvalidConfirmation, "Token de confirmación inválido")
+		return false
+	case time.Now().Unix() >= claims.ExpiresAt:
+		h.sendErrorResponse(w, r, http.StatusForbidden, errcode.InvalidConfirmation, "El token de confirmación ha expirado")
+		return false
+	}
+	return true
+}
+
+// signConfirmation codifica el contenido en base64url seguido de su HMAC-SHA256
+func (h *Handler) signConfirmation(claims confirmation) string {
+	payload, _ := json.Marshal(claims)
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(h.confirmationMAC(encoded))
+}
+
+// verifyConfirmation comprueba la firma del token y retorna su contenido
+func (h *Handler) verifyConfirmation(token string) (confirmation, bool) {
+	encoded, signature, found := strings.Cut(token, ".")
+	if !found {
+		return confirmation{}, false
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(mac, h.confirmationMAC(encoded)) {
+		return confirmation{}, false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	var claims confirmation
+	if err != nil || json.Unmarshal(payload, &claims) != nil {
+		return confirmation{}, false
+	}
+	return claims, true
+}
+
+// confirmationMAC firma el contenido codificado de un token de confirmación
+func (h *Handler) confirmationMAC(encoded string) []byte {
+	key := h.confirmationKey
+	if key == nil {
+		key = confirmationKey
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(encoded))
+	return mac.Sum(nil)
+}
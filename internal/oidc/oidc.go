@@ -0,0 +1,329 @@
+// Package oidc implementa el inicio de sesión con un proveedor de identidad externo mediante el
+// flujo authorization code de OAuth 2.0 con PKCE. Con proveedores OpenID Connect (Google,
+// Keycloak...) los endpoints se descubren a partir del emisor y la identidad se toma del ID
+// token; con proveedores solo OAuth 2.0 (GitHub) se indican los endpoints y la identidad se lee
+// del endpoint de usuario.
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Valores por defecto del cliente HTTP y de la validación de los ID tokens
+const (
+	defaultHTTPTimeout = 10 * time.Second
+	maxResponseBytes   = 1 << 20
+	// clockSkew es la desviación de reloj tolerada al comprobar la expiración del ID token
+	clockSkew = time.Minute
+)
+
+// Errores del inicio de sesión
+var (
+	// ErrProvider indica que el proveedor no respondió o respondió con un error
+	ErrProvider = errors.New("proveedor de identidad no disponible")
+	// ErrInvalidIDToken indica un ID token mal formado, expirado o emitido para otro cliente
+	ErrInvalidIDToken = errors.New("ID token inválido")
+	// ErrNoIdentity indica que el proveedor no retornó ni ID token ni endpoint de usuario
+	ErrNoIdentity = errors.New("el proveedor no retornó la identidad")
+)
+
+// Endpoints son las URLs del proveedor usadas en el flujo
+type Endpoints struct {
+	AuthURL     string
+	TokenURL    string
+	UserInfoURL string
+}
+
+// GitHub son los endpoints de GitHub, que solo implementa OAuth 2.0: la identidad es la del
+// usuario de la API y su claim "login" el nombre de usuario
+var GitHub = Endpoints{
+	AuthURL:     "https://github.com/login/oauth/authorize",
+	TokenURL:    "https://github.com/login/oauth/access_token",
+	UserInfoURL: "https://api.github.com/user",
+}
+
+// Provider es un proveedor de identidad con el cliente registrado en él
+type Provider struct {
+	// Issuer es el emisor OpenID Connect; vacío en proveedores solo OAuth 2.0, que no emiten
+	// ID token
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL es la URL de callback registrada en el proveedor
+	RedirectURL string
+	Scopes      []string
+	Endpoints   Endpoints
+	Client      *http.Client
+
+	now func() time.Time
+}
+
+// NewProvider crea un proveedor solo OAuth 2.0 con endpoints explícitos, como GitHub
+func NewProvider(endpoints Endpoints, clientID, clientSecret, redirectURL string, scopes []string) *Provider {
+	return &Provider{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		RedirectURL:  redirectURL,
+		Scopes:       scopes,
+		Endpoints:    endpoints,
+		Client:       &http.Client{Timeout: defaultHTTPTimeout},
+		now:          time.Now,
+	}
+}
+
+// Discover crea un proveedor OpenID Connect leyendo los endpoints de
+// issuer/.well-known/openid-configuration. El alcance "openid" se agrega si falta.
+func Discover(ctx context.Context, issuer, clientID, clientSecret, redirectURL string, scopes []string) (*Provider, error) {
+	issuer = strings.TrimSuffix(issuer, "/")
+	p := NewProvider(Endpoints{}, clientID, clientSecret, redirectURL, scopes)
+	p.Issuer = issuer
+	if !containsScope(p.Scopes, "openid") {
+		p.Scopes = append([]string{"openid"}, p.Scopes...)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrProvider, err)
+	}
+	var discovery struct {
+		Issuer                string `json:"issuer"`
+		AuthorizationEndpoint string `json:"authorization_endpoint"`
+		TokenEndpoint         string `json:"token_endpoint"`
+		UserInfoEndpoint      string `json:"userinfo_endpoint"`
+	}
+	if err := doJSON(p.Client, req, &discovery); err != nil {
+		return nil, err
+	}
+	// El emisor publicado debe ser exactamente el configurado (OpenID Connect Discovery 4.3)
+	if discovery.Issuer != issuer {
+		return nil, fmt.Errorf("%w: el emisor publicado %q no coincide con %q", ErrProvider, discovery.Issuer, issuer)
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" {
+		return nil, fmt.Errorf("%w: la configuración de %s no incluye los endpoints de autorización y tokens", ErrProvider, issuer)
+	}
+	p.Endpoints = Endpoints{
+		AuthURL:     discovery.AuthorizationEndpoint,
+		TokenURL:    discovery.TokenEndpoint,
+		UserInfoURL: discovery.UserInfoEndpoint,
+	}
+	return p, nil
+}
+
+// containsScope indica si scopes incluye scope
+func containsScope(scopes []string, scope string) bool {
+	for _, current := range scopes {
+		if current == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// RandomString genera un valor aleatorio apto para state, nonce y el verificador PKCE
+func RandomString() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// AuthCodeURL retorna la URL del proveedor a la que se redirige al usuario. state protege el
+// callback frente a CSRF, nonce liga el ID token a este inicio de sesión y verifier es el
+// verificador PKCE, del que solo se envía el desafío S256.
+func (p *Provider) AuthCodeURL(state, nonce, verifier string) string {
+	challenge := sha256.Sum256([]byte(verifier))
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.ClientID},
+		"redirect_uri":          {p.RedirectURL},
+		"state":                 {state},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	if len(p.Scopes) > 0 {
+		query.Set("scope", strings.Join(p.Scopes, " "))
+	}
+	if p.Issuer != "" {
+		query.Set("nonce", nonce)
+	}
+	separator := "?"
+	if strings.Contains(p.Endpoints.AuthURL, "?") {
+		separator = "&"
+	}
+	return p.Endpoints.AuthURL + separator + query.Encode()
+}
+
+// Identity son los claims de la identidad autenticada: los del ID token completados con los
+// del endpoint de usuario
+type Identity map[string]interface{}
+
+// Claim retorna el claim como texto; los números (p. ej. el id de GitHub) se formatean sin
+// decimales y los demás tipos retornan vacío
+func (i Identity) Claim(name string) string {
+	switch value := i[name].(type) {
+	case string:
+		return value
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	default:
+		return ""
+	}
+}
+
+// EmailVerified indica si el proveedor no declara el email como no verificado. Los proveedores
+// que no publican email_verified (GitHub solo expone el email público) se consideran fiables.
+func (i Identity) EmailVerified() bool {
+	verified, ok := i["email_verified"].(bool)
+	return !ok || verified
+}
+
+// Exchange canjea el código del callback por tokens y retorna la identidad. Con OpenID Connect
+// valida los claims iss, aud, exp y nonce del ID token; su firma no se comprueba porque se
+// recibe directamente del endpoint de tokens por TLS (OpenID Connect Core 3.1.3.7).
+func (p *Provider) Exchange(ctx context.Context, code, verifier, nonce string) (Identity, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.RedirectURL},
+		"client_id":     {p.ClientID},
+		"client_secret": {p.ClientSecret},
+		"code_verifier": {verifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.Endpoints.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrProvider, err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	var tokens struct {
+		AccessToken string `json:"access_token"`
+		IDToken     string `json:"id_token"`
+		Error       string `json:"error"`
+	}
+	if err := doJSON(p.Client, req, &tokens); err != nil {
+		return nil, err
+	}
+	// GitHub responde 200 con el error en el cuerpo
+	if tokens.Error != "" {
+		return nil, fmt.Errorf("%w: %s", ErrProvider, tokens.Error)
+	}
+
+	identity := make(Identity)
+	if p.Issuer != "" {
+		if identity, err = p.verifyIDToken(tokens.IDToken, nonce); err != nil {
+			return nil, err
+		}
+	}
+	if p.Endpoints.UserInfoURL != "" && tokens.AccessToken != "" {
+		info, err := p.userInfo(ctx, tokens.AccessToken)
+		if err != nil {
+			return nil, err
+		}
+		// El sujeto de userinfo debe ser el del ID token (OpenID Connect Core 5.3.2)
+		if sub, ok := identity["sub"]; ok && info["sub"] != sub {
+			return nil, fmt.Errorf("%w: el sujeto de userinfo no coincide con el del ID token", ErrProvider)
+		}
+		for name, value := range info {
+			if _, ok := identity[name]; !ok {
+				identity[name] = value
+			}
+		}
+	}
+	if len(identity) == 0 {
+		return nil, ErrNoIdentity
+	}
+	return identity, nil
+}
+
+// verifyIDToken decodifica el ID token y comprueba que sea de este emisor y cliente, que no
+// haya expirado y que su nonce sea el de este inicio de sesión
+func (p *Provider) verifyIDToken(token, nonce string) (Identity, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidIDToken
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrInvalidIDToken
+	}
+	var claims Identity
+	if err := json.Unmarshal(raw, &claims); err != nil {
+		return nil, ErrInvalidIDToken
+	}
+
+	if claims.Claim("iss") != p.Issuer || claims.Claim("sub") == "" {
+		return nil, ErrInvalidIDToken
+	}
+	if !audienceIncludes(claims["aud"], p.ClientID) {
+		return nil, ErrInvalidIDToken
+	}
+	exp, ok := claims["exp"].(float64)
+	if !ok || p.now().Add(-clockSkew).Unix() >= int64(exp) {
+		return nil, fmt.Errorf("%w: expirado", ErrInvalidIDToken)
+	}
+	if claims.Claim("nonce") != nonce {
+		return nil, fmt.Errorf("%w: nonce distinto", ErrInvalidIDToken)
+	}
+	return claims, nil
+}
+
+// audienceIncludes indica si el claim aud, texto o lista, incluye al cliente
+func audienceIncludes(aud interface{}, clientID string) bool {
+	switch value := aud.(type) {
+	case string:
+		return value == clientID
+	case []interface{}:
+		for _, current := range value {
+			if current == clientID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// userInfo consulta el endpoint de usuario con el access token
+func (p *Provider) userInfo(ctx context.Context, accessToken string) (Identity, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.Endpoints.UserInfoURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrProvider, err)
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	var info Identity
+	if err := doJSON(p.Client, req, &info); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// doJSON ejecuta la petición y decodifica la respuesta JSON, que debe ser 200
+func doJSON(client *http.Client, req *http.Request, v interface{}) error {
+	// GitHub responde con un formulario si no se pide JSON
+	req.Header.Set("Accept", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		if ctxErr := req.Context().Err(); ctxErr != nil {
+			return ctxErr
+		}
+		return fmt.Errorf("%w: %v", ErrProvider, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: %s respondió %s", ErrProvider, req.URL.Host, resp.Status)
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponseBytes)).Decode(v); err != nil {
+		return fmt.Errorf("%w: respuesta inválida de %s: %v", ErrProvider, req.URL.Host, err)
+	}
+	return nil
+}
@@ -0,0 +1,173 @@
+package oidc
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// fakeProvider es un proveedor OpenID Connect de prueba que emite un ID token sin firmar con
+// los claims de idToken para el código "codigo"
+type fakeProvider struct {
+	server    *httptest.Server
+	challenge string
+	idToken   map[string]interface{}
+	userInfo  map[string]interface{}
+}
+
+func newFakeProvider(t *testing.T) *fakeProvider {
+	f := &fakeProvider{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 f.server.URL,
+			"authorization_endpoint": f.server.URL + "/authorize",
+			"token_endpoint":         f.server.URL + "/token",
+			"userinfo_endpoint":      f.server.URL + "/userinfo",
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		verifier := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+		if r.PostFormValue("code") != "codigo" || r.PostFormValue("client_secret") != "secreto" ||
+			base64.RawURLEncoding.EncodeToString(verifier[:]) != f.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		payload, _ := json.Marshal(f.idToken)
+		json.NewEncoder(w).Encode(map[string]string{
+			"access_token": "acceso",
+			"id_token":     "e30." + base64.RawURLEncoding.EncodeToString(payload) + ".",
+		})
+	})
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer acceso" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(f.userInfo)
+	})
+	f.server = httptest.NewServer(mux)
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+func TestDiscover(t *testing.T) {
+	fake := newFakeProvider(t)
+	p, err := Discover(context.Background(), fake.server.URL+"/", "cliente", "secreto", "https://sho.rt/auth/oidc/callback", []string{"email"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if p.Endpoints.TokenURL != fake.server.URL+"/token" || p.Endpoints.UserInfoURL != fake.server.URL+"/userinfo" {
+		t.Errorf("Unexpected endpoints: %+v", p.Endpoints)
+	}
+
+	authURL, err := url.Parse(p.AuthCodeURL("estado", "nonce", "verificador"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	query := authURL.Query()
+	challenge := sha256.Sum256([]byte("verificador"))
+	if query.Get("scope") != "openid email" || query.Get("nonce") != "nonce" || query.Get("state") != "estado" ||
+		query.Get("code_challenge") != base64.RawURLEncoding.EncodeToString(challenge[:]) ||
+		query.Get("code_challenge_method") != "S256" {
+		t.Errorf("Unexpected authorization query: %v", query)
+	}
+
+	// Un emisor distinto del publicado se rechaza
+	if _, err := Discover(context.Background(), fake.server.URL+"/otro", "cliente", "secreto", "", nil); !errors.Is(err, ErrProvider) {
+		t.Errorf("Expected ErrProvider, got %v", err)
+	}
+}
+
+func TestProvider_Exchange(t *testing.T) {
+	fake := newFakeProvider(t)
+	p, err := Discover(context.Background(), fake.server.URL, "cliente", "secreto", "https://sho.rt/auth/oidc/callback", nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	p.now = func() time.Time { return time.Unix(1000, 0) }
+	challenge := sha256.Sum256([]byte("verificador"))
+	fake.challenge = base64.RawURLEncoding.EncodeToString(challenge[:])
+
+	valid := func() map[string]interface{} {
+		return map[string]interface{}{"iss": fake.server.URL, "sub": "123", "aud": "cliente", "exp": 2000, "nonce": "nonce"}
+	}
+	tests := []struct {
+		name        string
+		claims      func(map[string]interface{})
+		verifier    string
+		expectedErr error
+	}{
+		{"ID token válido", func(map[string]interface{}) {}, "verificador", nil},
+		{"Audiencia en lista", func(c map[string]interface{}) { c["aud"] = []string{"otro", "cliente"} }, "verificador", nil},
+		{"Otro cliente", func(c map[string]interface{}) { c["aud"] = "otro" }, "verificador", ErrInvalidIDToken},
+		{"Otro emisor", func(c map[string]interface{}) { c["iss"] = "https://otro.example" }, "verificador", ErrInvalidIDToken},
+		{"Expirado", func(c map[string]interface{}) { c["exp"] = 900 }, "verificador", ErrInvalidIDToken},
+		{"Nonce distinto", func(c map[string]interface{}) { c["nonce"] = "repetido" }, "verificador", ErrInvalidIDToken},
+		{"Verificador PKCE distinto", func(map[string]interface{}) {}, "otro", ErrProvider},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake.idToken = valid()
+			tt.claims(fake.idToken)
+			fake.userInfo = map[string]interface{}{"sub": "123", "email": "ana@example.com", "email_verified": true}
+
+			identity, err := p.Exchange(context.Background(), "codigo", tt.verifier, "nonce")
+			if !errors.Is(err, tt.expectedErr) {
+				t.Fatalf("Expected error %v, got %v", tt.expectedErr, err)
+			}
+			if err == nil && (identity.Claim("sub") != "123" || identity.Claim("email") != "ana@example.com" || !identity.EmailVerified()) {
+				t.Errorf("Unexpected identity: %v", identity)
+			}
+		})
+	}
+
+	// userinfo debe describir al mismo sujeto que el ID token
+	fake.idToken = valid()
+	fake.userInfo = map[string]interface{}{"sub": "456", "email": "otro@example.com"}
+	if _, err := p.Exchange(context.Background(), "codigo", "verificador", "nonce"); !errors.Is(err, ErrProvider) {
+		t.Errorf("Expected ErrProvider, got %v", err)
+	}
+}
+
+func TestProvider_ExchangeOAuth2(t *testing.T) {
+	// Proveedor solo OAuth 2.0, como GitHub: sin ID token y con el error en una respuesta 200
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/token":
+			if r.Header.Get("Accept") != "application/json" || r.PostFormValue("code") != "codigo" {
+				json.NewEncoder(w).Encode(map[string]string{"error": "bad_verification_code"})
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]string{"access_token": "acceso"})
+		case "/user":
+			json.NewEncoder(w).Encode(map[string]interface{}{"login": "Ana", "id": 583231})
+		}
+	}))
+	defer server.Close()
+
+	p := NewProvider(Endpoints{AuthURL: server.URL + "/authorize", TokenURL: server.URL + "/token", UserInfoURL: server.URL + "/user"},
+		"cliente", "secreto", "https://sho.rt/auth/oidc/callback", []string{"read:user"})
+	if query, _ := url.ParseQuery(p.AuthCodeURL("estado", "nonce", "v")[len(server.URL+"/authorize?"):]); query.Has("nonce") {
+		t.Errorf("Expected no nonce without OpenID Connect, got %v", query)
+	}
+
+	identity, err := p.Exchange(context.Background(), "codigo", "v", "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if identity.Claim("login") != "Ana" || identity.Claim("id") != "583231" {
+		t.Errorf("Unexpected identity: %v", identity)
+	}
+	if _, err := p.Exchange(context.Background(), "caducado", "v", ""); !errors.Is(err, ErrProvider) {
+		t.Errorf("Expected ErrProvider, got %v", err)
+	}
+}
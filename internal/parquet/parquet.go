@@ -0,0 +1,350 @@
+// Package parquet escribe ficheros Apache Parquet en la medida en que lo necesitan las
+// exportaciones del servicio: columnas planas obligatorias de texto, enteros, booleanos y
+// marcas de tiempo, en un único grupo de filas con una página por columna, codificación PLAIN
+// y sin compresión. Los metadatos se serializan con el protocolo compacto de Thrift.
+package parquet
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// magic abre y cierra todo fichero Parquet
+const magic = "PAR1"
+
+// createdBy identifica al escritor en los metadatos del fichero
+const createdBy = "acortador-urls"
+
+// Type es el tipo de una columna
+type Type int
+
+// Tipos de columna admitidos
+const (
+	// String es texto UTF-8 (BYTE_ARRAY con tipo lógico UTF8)
+	String Type = iota
+	// Int64 es un entero con signo de 64 bits
+	Int64
+	// Bool es un booleano
+	Bool
+	// Timestamp es una marca de tiempo en milisegundos UTC (INT64 con tipo lógico TIMESTAMP_MILLIS)
+	Timestamp
+)
+
+// Tipos físicos, tipos convertidos y enumeraciones del formato
+const (
+	physicalBoolean   = 0
+	physicalInt64     = 2
+	physicalByteArray = 6
+
+	convertedUTF8            = 0
+	convertedTimestampMillis = 9
+
+	repetitionRequired = 0
+	encodingPlain      = 0
+	encodingRLE        = 3
+	codecUncompressed  = 0
+	pageData           = 0
+)
+
+// ErrClosed indica que se escribió en un Writer ya cerrado
+var ErrClosed = errors.New("parquet: writer cerrado")
+
+// Column describe una columna del fichero
+type Column struct {
+	Name string
+	Type Type
+}
+
+// Writer acumula las filas en memoria, ya codificadas por columna, y escribe el fichero al
+// cerrarse: el formato guarda cada columna contigua y el índice al final
+type Writer struct {
+	out     io.Writer
+	columns []Column
+	data    [][]byte
+	rows    int
+	closed  bool
+}
+
+// NewWriter crea un escritor con las columnas indicadas
+func NewWriter(out io.Writer, columns []Column) *Writer {
+	return &Writer{out: out, columns: columns, data: make([][]byte, len(columns))}
+}
+
+// Write agrega una fila con un valor por columna: string para String, int64 para Int64, bool
+// para Bool y time.Time para Timestamp
+func (w *Writer) Write(values ...any) error {
+	if w.closed {
+		return ErrClosed
+	}
+	if len(values) != len(w.columns) {
+		return fmt.Errorf("parquet: se esperaban %d valores, se recibieron %d", len(w.columns), len(values))
+	}
+	// Se valida la fila completa antes de codificarla para no dejar columnas desiguales
+	for i, column := range w.columns {
+		if !column.Type.accepts(values[i]) {
+			return fmt.Errorf("parquet: valor %T inválido para la columna %q", values[i], column.Name)
+		}
+	}
+	for i, value := range values {
+		switch v := value.(type) {
+		case string:
+			w.data[i] = binary.LittleEndian.AppendUint32(w.data[i], uint32(len(v)))
+			w.data[i] = append(w.data[i], v...)
+		case int64:
+			w.data[i] = binary.LittleEndian.AppendUint64(w.data[i], uint64(v))
+		case time.Time:
+			w.data[i] = binary.LittleEndian.AppendUint64(w.data[i], uint64(v.UnixMilli()))
+		case bool:
+			// PLAIN empaqueta los booleanos de ocho en ocho, empezando por el bit menos significativo
+			if w.rows%8 == 0 {
+				w.data[i] = append(w.data[i], 0)
+			}
+			if v {
+				w.data[i][len(w.data[i])-1] |= 1 << (w.rows % 8)
+			}
+		}
+	}
+	w.rows++
+	return nil
+}
+
+// accepts indica si value es del tipo Go que corresponde a la columna
+func (t Type) accepts(value any) bool {
+	switch value.(type) {
+	case string:
+		return t == String
+	case int64:
+		return t == Int64
+	case bool:
+		return t == Bool
+	case time.Time:
+		return t == Timestamp
+	}
+	return false
+}
+
+// Close escribe el fichero completo. No cierra el io.Writer subyacente.
+func (w *Writer) Close() error {
+	if w.closed {
+		return ErrClosed
+	}
+	w.closed = true
+
+	offset := int64(len(magic))
+	if _, err := io.WriteString(w.out, magic); err != nil {
+		return err
+	}
+	chunks := make([]columnChunk, len(w.columns))
+	for i, data := range w.data {
+		if len(data) > math.MaxInt32 {
+			return fmt.Errorf("parquet: la columna %q supera el tamaño máximo de página", w.columns[i].Name)
+		}
+		header := pageHeader(len(data), w.rows)
+		if _, err := w.out.Write(header); err != nil {
+			return err
+		}
+		if _, err := w.out.Write(data); err != nil {
+			return err
+		}
+		chunks[i] = columnChunk{offset: offset, size: int64(len(header) + len(data))}
+		offset += chunks[i].size
+	}
+
+	footer := w.fileMetaData(chunks)
+	footer = binary.LittleEndian.AppendUint32(footer, uint32(len(footer)))
+	footer = append(footer, magic...)
+	_, err := w.out.Write(footer)
+	return err
+}
+
+// columnChunk es la posición y el tamaño, cabecera de página incluida, de una columna
+type columnChunk struct {
+	offset int64
+	size   int64
+}
+
+// pageHeader serializa la cabecera de la página de datos de una columna. Las columnas
+// obligatorias y planas no llevan niveles de repetición ni de definición.
+func pageHeader(size, rows int) []byte {
+	var t compact
+	t.i32(1, pageData)
+	t.i32(2, int32(size))
+	t.i32(3, int32(size))
+	t.beginStruct(5)
+	t.i32(1, int32(rows))
+	t.i32(2, encodingPlain)
+	t.i32(3, encodingRLE)
+	t.i32(4, encodingRLE)
+	t.endStruct()
+	t.stop()
+	return t.buf
+}
+
+// fileMetaData serializa el esquema y el único grupo de filas
+func (w *Writer) fileMetaData(chunks []columnChunk) []byte {
+	var t compact
+	t.i32(1, 1)
+
+	t.list(2, typeStruct, len(w.columns)+1)
+	t.beginElement()
+	t.binary(4, "schema")
+	t.i32(5, int32(len(w.columns)))
+	t.endStruct()
+	for _, column := range w.columns {
+		t.beginElement()
+		t.i32(1, column.Type.physical())
+		t.i32(3, repetitionRequired)
+		t.binary(4, column.Name)
+		if converted, ok := column.Type.converted(); ok {
+			t.i32(6, converted)
+		}
+		t.endStruct()
+	}
+	t.i64(3, int64(w.rows))
+
+	var total int64
+	for _, chunk := range chunks {
+		total += chunk.size
+	}
+	t.list(4, typeStruct, 1)
+	t.beginElement()
+	t.list(1, typeStruct, len(chunks))
+	for i, chunk := range chunks {
+		t.beginElement()
+		t.i64(2, chunk.offset)
+		t.beginStruct(3)
+		t.i32(1, w.columns[i].Type.physical())
+		t.list(2, typeI32, 1)
+		t.varint(encodingPlain)
+		t.list(3, typeBinary, 1)
+		t.bytes(w.columns[i].Name)
+		t.i32(4, codecUncompressed)
+		t.i64(5, int64(w.rows))
+		t.i64(6, chunk.size)
+		t.i64(7, chunk.size)
+		t.i64(9, chunk.offset)
+		t.endStruct()
+		t.endStruct()
+	}
+	t.i64(2, total)
+	t.i64(3, int64(w.rows))
+	t.endStruct()
+
+	t.binary(6, createdBy)
+	t.stop()
+	return t.buf
+}
+
+// physical es el tipo físico de la columna
+func (t Type) physical() int32 {
+	switch t {
+	case String:
+		return physicalByteArray
+	case Bool:
+		return physicalBoolean
+	}
+	return physicalInt64
+}
+
+// converted es el tipo lógico de la columna, si tiene
+func (t Type) converted() (int32, bool) {
+	switch t {
+	case String:
+		return convertedUTF8, true
+	case Timestamp:
+		return convertedTimestampMillis, true
+	}
+	return 0, false
+}
+
+// Tipos de campo del protocolo compacto de Thrift
+const (
+	typeI32    = 5
+	typeI64    = 6
+	typeBinary = 8
+	typeList   = 9
+	typeStruct = 12
+)
+
+// compact serializa structs con el protocolo compacto de Thrift. Cada campo se identifica por
+// la diferencia con el anterior del mismo struct, así que hay que apilar el último campo al
+// entrar en un struct anidado.
+type compact struct {
+	buf    []byte
+	last   int16
+	parent []int16
+}
+
+func (t *compact) field(id int16, fieldType byte) {
+	if delta := id - t.last; delta > 0 && delta <= 15 {
+		t.buf = append(t.buf, byte(delta)<<4|fieldType)
+	} else {
+		t.buf = append(t.buf, fieldType)
+		t.varint(int64(id))
+	}
+	t.last = id
+}
+
+// varint escribe un entero en zigzag, como los i16, i32 e i64 del protocolo
+func (t *compact) varint(v int64) {
+	t.buf = binary.AppendUvarint(t.buf, uint64(v<<1)^uint64(v>>63))
+}
+
+func (t *compact) bytes(s string) {
+	t.buf = binary.AppendUvarint(t.buf, uint64(len(s)))
+	t.buf = append(t.buf, s...)
+}
+
+func (t *compact) i32(id int16, v int32) {
+	t.field(id, typeI32)
+	t.varint(int64(v))
+}
+
+func (t *compact) i64(id int16, v int64) {
+	t.field(id, typeI64)
+	t.varint(v)
+}
+
+func (t *compact) binary(id int16, s string) {
+	t.field(id, typeBinary)
+	t.bytes(s)
+}
+
+// list escribe la cabecera de una lista; los elementos se escriben a continuación
+func (t *compact) list(id int16, elementType byte, size int) {
+	t.field(id, typeList)
+	if size < 15 {
+		t.buf = append(t.buf, byte(size)<<4|elementType)
+	} else {
+		t.buf = append(t.buf, 0xF0|elementType)
+		t.buf = binary.AppendUvarint(t.buf, uint64(size))
+	}
+}
+
+// beginStruct abre un campo de tipo struct
+func (t *compact) beginStruct(id int16) {
+	t.field(id, typeStruct)
+	t.beginElement()
+}
+
+// beginElement abre un struct que es elemento de una lista, sin cabecera de campo
+func (t *compact) beginElement() {
+	t.parent = append(t.parent, t.last)
+	t.last = 0
+}
+
+// endStruct cierra el struct abierto
+func (t *compact) endStruct() {
+	t.stop()
+	t.last = t.parent[len(t.parent)-1]
+	t.parent = t.parent[:len(t.parent)-1]
+}
+
+// stop marca el final de un struct
+func (t *compact) stop() {
+	t.buf = append(t.buf, 0)
+}
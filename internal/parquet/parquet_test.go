@@ -0,0 +1,156 @@
+package parquet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// decoder lee structs del protocolo compacto de Thrift como mapas de id de campo a valor, para
+// comprobar los metadatos sin depender de un lector externo
+type decoder struct {
+	buf []byte
+	pos int
+}
+
+func (d *decoder) uvarint() uint64 {
+	v, n := binary.Uvarint(d.buf[d.pos:])
+	d.pos += n
+	return v
+}
+
+func (d *decoder) varint() int64 {
+	v := d.uvarint()
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+func (d *decoder) value(fieldType byte) any {
+	switch fieldType {
+	case typeI32, typeI64:
+		return d.varint()
+	case typeBinary:
+		n := int(d.uvarint())
+		d.pos += n
+		return string(d.buf[d.pos-n : d.pos])
+	case typeList:
+		header := d.buf[d.pos]
+		d.pos++
+		size, elementType := int(header>>4), header&0x0F
+		if size == 15 {
+			size = int(d.uvarint())
+		}
+		values := make([]any, size)
+		for i := range values {
+			values[i] = d.value(elementType)
+		}
+		return values
+	case typeStruct:
+		return d.structure()
+	}
+	panic("tipo de campo no soportado")
+}
+
+func (d *decoder) structure() map[int16]any {
+	fields := make(map[int16]any)
+	var last int16
+	for {
+		header := d.buf[d.pos]
+		d.pos++
+		if header == 0 {
+			return fields
+		}
+		if delta := int16(header >> 4); delta != 0 {
+			last += delta
+		} else {
+			last = int16(d.varint())
+		}
+		fields[last] = d.value(header & 0x0F)
+	}
+}
+
+func TestWriter(t *testing.T) {
+	var out bytes.Buffer
+	w := NewWriter(&out, []Column{{Name: "time", Type: Timestamp}, {Name: "referrer", Type: String},
+		{Name: "clicks", Type: Int64}, {Name: "bot", Type: Bool}})
+	at := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	rows := [][]any{
+		{at, "news.example", int64(3), false},
+		{at.Add(time.Second), "", int64(-1), true},
+	}
+	// Más de ocho booleanos para ocupar un segundo byte
+	for i := 0; i < 8; i++ {
+		rows = append(rows, []any{at, "x", int64(i), i%2 == 0})
+	}
+	for _, row := range rows {
+		if err := w.Write(row...); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	errorTests := []struct {
+		name   string
+		values []any
+	}{
+		{name: "Faltan valores", values: []any{at, "x", int64(1)}},
+		{name: "Tipo incorrecto", values: []any{at, "x", 1, true}},
+	}
+	for _, tt := range errorTests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := w.Write(tt.values...); err == nil {
+				t.Errorf("Expected error for %v", tt.values)
+			}
+		})
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := w.Write(rows[0]...); !errors.Is(err, ErrClosed) {
+		t.Errorf("Expected ErrClosed, got %v", err)
+	}
+
+	file := out.Bytes()
+	if string(file[:4]) != magic || string(file[len(file)-4:]) != magic {
+		t.Fatalf("Expected PAR1 at both ends")
+	}
+	footerSize := int(binary.LittleEndian.Uint32(file[len(file)-8:]))
+	footer := (&decoder{buf: file[len(file)-8-footerSize : len(file)-8]}).structure()
+
+	if footer[3] != int64(len(rows)) || footer[6] != createdBy {
+		t.Errorf("Expected %d rows created by %s, got %v and %v", len(rows), createdBy, footer[3], footer[6])
+	}
+	schema := footer[2].([]any)
+	var names []any
+	for _, element := range schema[1:] {
+		names = append(names, element.(map[int16]any)[4])
+	}
+	if root := schema[0].(map[int16]any); root[5] != int64(4) || !reflect.DeepEqual(names, []any{"time", "referrer", "clicks", "bot"}) {
+		t.Errorf("Unexpected schema: %v", schema)
+	}
+	if converted := schema[1].(map[int16]any)[6]; converted != int64(convertedTimestampMillis) {
+		t.Errorf("Expected TIMESTAMP_MILLIS on time, got %v", converted)
+	}
+
+	// Cada columna empieza donde indican sus metadatos, con una página de todas las filas
+	chunks := footer[4].([]any)[0].(map[int16]any)[1].([]any)
+	expectedData := [][]byte{
+		binary.LittleEndian.AppendUint64(nil, uint64(at.UnixMilli())),
+		append(binary.LittleEndian.AppendUint32(nil, 12), "news.example"...),
+		binary.LittleEndian.AppendUint64(nil, 3),
+		{0b01010110, 0b00000001},
+	}
+	for i, chunk := range chunks {
+		meta := chunk.(map[int16]any)[3].(map[int16]any)
+		page := &decoder{buf: file, pos: int(meta[9].(int64))}
+		header := page.structure()
+		if values := header[5].(map[int16]any)[1]; values != int64(len(rows)) || meta[5] != int64(len(rows)) {
+			t.Errorf("Column %d: expected %d values, got %v and %v", i, len(rows), values, meta[5])
+		}
+		data := file[page.pos : page.pos+int(header[3].(int64))]
+		if !bytes.HasPrefix(data, expectedData[i]) {
+			t.Errorf("Column %d: expected data to start with %v, got %v", i, expectedData[i], data[:len(expectedData[i])])
+		}
+	}
+}
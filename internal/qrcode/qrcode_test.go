@@ -0,0 +1,205 @@
+package qrcode
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestReedSolomon(t *testing.T) {
+	// "HELLO WORLD" en 1-M, del ejemplo de la norma
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	expected := []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}
+	if got := reedSolomonRemainder(data, reedSolomonDivisor(10)); !bytes.Equal(got, expected) {
+		t.Errorf("Expected ECC %v, got %v", expected, got)
+	}
+}
+
+func TestTables(t *testing.T) {
+	tests := []struct {
+		name     string
+		got      int
+		expected int
+	}{
+		{name: "Formato M máscara 0", got: formatBits(Medium, 0), expected: 0x5412},
+		{name: "Formato L máscara 4", got: formatBits(Low, 4), expected: 0x662F},
+		{name: "Formato H máscara 7", got: formatBits(High, 7), expected: 0x083B},
+		{name: "Versión 7", got: versionBits(7), expected: 0x07C94},
+		{name: "Versión 40", got: versionBits(40), expected: 0x28C69},
+		{name: "Capacidad 1-M", got: dataCodewords(1, Medium), expected: 16},
+		{name: "Capacidad 10-Q", got: dataCodewords(10, Quartile), expected: 154},
+		{name: "Capacidad 40-L", got: dataCodewords(40, Low), expected: 2956},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.got != tt.expected {
+				t.Errorf("Expected %#x, got %#x", tt.expected, tt.got)
+			}
+		})
+	}
+
+	for version, expected := range map[int][]int{2: {6, 18}, 7: {6, 22, 38}, 32: {6, 34, 60, 86, 112, 138}} {
+		c := &Code{Version: version, size: 17 + 4*version}
+		got := c.alignmentPositions()
+		if len(got) != len(expected) {
+			t.Fatalf("Expected alignment %v for version %d, got %v", expected, version, got)
+		}
+		for i := range got {
+			if got[i] != expected[i] {
+				t.Errorf("Expected alignment %v for version %d, got %v", expected, version, got)
+				break
+			}
+		}
+	}
+}
+
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		name            string
+		text            string
+		level           Level
+		expectedVersion int
+		expectError     bool
+	}{
+		{name: "Cabe en la versión 1", text: strings.Repeat("a", 14), level: Medium, expectedVersion: 1},
+		{name: "Pasa a la versión 2", text: strings.Repeat("a", 15), level: Medium, expectedVersion: 2},
+		{name: "URL corta", text: "https://sho.rt/abc123", level: Medium, expectedVersion: 2},
+		{name: "Con información de versión y bloques de dos tamaños", text: strings.Repeat("x", 300), level: Quartile, expectedVersion: 16},
+		{name: "Demasiado largo", text: strings.Repeat("x", 3000), level: Low, expectError: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, err := Encode(tt.text, tt.level)
+			if tt.expectError {
+				if err != ErrTooLong {
+					t.Errorf("Expected ErrTooLong, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if code.Version != tt.expectedVersion || code.Size() != 17+4*tt.expectedVersion {
+				t.Fatalf("Expected version %d, got %d (size %d)", tt.expectedVersion, code.Version, code.Size())
+			}
+			if got := decode(t, code); got != tt.text {
+				t.Errorf("Expected to decode %q, got %q", tt.text, got)
+			}
+		})
+	}
+}
+
+// decode lee el código como lo haría un lector: formato, máscara, zigzag, bloques y segmento
+func decode(t *testing.T, c *Code) string {
+	t.Helper()
+	bits := 0
+	for i := 0; i <= 5; i++ {
+		bits |= boolBit(c.Dark(8, i)) << uint(i)
+	}
+	bits |= boolBit(c.Dark(8, 7))<<6 | boolBit(c.Dark(8, 8))<<7 | boolBit(c.Dark(7, 8))<<8
+	for i := 9; i < 15; i++ {
+		bits |= boolBit(c.Dark(14-i, 8)) << uint(i)
+	}
+	if bits != formatBits(c.Level, c.Mask) {
+		t.Fatalf("Unexpected format bits %#x", bits)
+	}
+	if !c.Dark(8, c.Size()-8) {
+		t.Fatalf("Expected dark module")
+	}
+
+	var raw []byte
+	var current byte
+	count := 0
+	for right := c.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := 0; vert < c.size; vert++ {
+			for j := 0; j < 2; j++ {
+				x, y := right-j, vert
+				if (right+1)&2 == 0 {
+					y = c.size - 1 - vert
+				}
+				if c.function[y][x] {
+					continue
+				}
+				current = current<<1 | byte(boolBit(c.Dark(x, y) != maskBit(c.Mask, x, y)))
+				if count++; count%8 == 0 {
+					raw = append(raw, current)
+				}
+			}
+		}
+	}
+
+	numBlocks := errorCorrectionBlocks[c.Level][c.Version]
+	eccLen := eccCodewordsPerBlock[c.Level][c.Version]
+	total := rawDataModules(c.Version) / 8
+	numShort := numBlocks - total%numBlocks
+	shortLen := total/numBlocks - eccLen
+	blocks := make([][]byte, numBlocks)
+	k := 0
+	for i := 0; i < shortLen+1; i++ {
+		for j := range blocks {
+			if i < shortLen || j >= numShort {
+				blocks[j] = append(blocks[j], raw[k])
+				k++
+			}
+		}
+	}
+	var data []byte
+	for i := 0; i < eccLen; i++ {
+		for j := range blocks {
+			blocks[j] = append(blocks[j], raw[k])
+			k++
+		}
+	}
+	for _, block := range blocks {
+		payload, ecc := block[:len(block)-eccLen], block[len(block)-eccLen:]
+		if !bytes.Equal(reedSolomonRemainder(payload, reedSolomonDivisor(eccLen)), ecc) {
+			t.Fatalf("ECC mismatch in block %v", block)
+		}
+		data = append(data, payload...)
+	}
+
+	if data[0]>>4 != 0x4 {
+		t.Fatalf("Expected byte mode, got %x", data[0]>>4)
+	}
+	var reader bitBuffer
+	for _, b := range data {
+		reader.append(int(b), 8)
+	}
+	read := func(pos, length int) int {
+		value := 0
+		for _, bit := range reader[pos : pos+length] {
+			value = value<<1 | boolBit(bit)
+		}
+		return value
+	}
+	length := read(4, charCountBits(c.Version))
+	pos := 4 + charCountBits(c.Version)
+	text := make([]byte, length)
+	for i := range text {
+		text[i] = byte(read(pos+8*i, 8))
+	}
+	return string(text)
+}
+
+func boolBit(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func TestCode_SVG(t *testing.T) {
+	code, _ := Encode("https://sho.rt/abc123", Medium)
+	svg := code.SVG(4)
+	side := code.Size() + 2*QuietZone
+	if !strings.HasPrefix(svg, "<svg") || !strings.Contains(svg, `viewBox="0 0 33 33"`) || side != 33 {
+		t.Errorf("Unexpected SVG header: %.120s", svg)
+	}
+	// El módulo superior izquierdo del patrón de posición es oscuro y empieza tras el margen
+	if !strings.Contains(svg, "M4,4h1v1h-1z") {
+		t.Errorf("Expected finder module at the quiet zone offset")
+	}
+}
@@ -0,0 +1,88 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Limiter decide si un cliente identificado por key puede realizar una petición.
+// TokenBucket limita en memoria: con varias réplicas cada una limita por separado, así que el
+// límite efectivo se multiplica por el número de réplicas. RedisTokenBucket comparte el bucket
+// de cada cliente entre todas ellas.
+type Limiter interface {
+	Allow(key string) (allowed bool, retryAfter time.Duration)
+}
+
+// bucket guarda el estado de un cliente
+type bucket struct {
+	tokens   float64
+	lastSeen time.Time
+}
+
+// TokenBucket implementa un limitador token bucket por clave en memoria
+type TokenBucket struct {
+	rate    float64 // tokens por segundo
+	burst   float64 // capacidad máxima
+	buckets map[string]*bucket
+	mu      sync.Mutex
+	now     func() time.Time
+
+	lastSweep time.Time
+}
+
+// sweepInterval define cada cuánto se eliminan buckets inactivos
+const sweepInterval = time.Minute
+
+// NewTokenBucket crea un limitador con la tasa (tokens/segundo) y ráfaga indicadas
+func NewTokenBucket(rate float64, burst int) *TokenBucket {
+	return &TokenBucket{
+		rate:    rate,
+		burst:   float64(burst),
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+// Allow consume un token del bucket de la clave y retorna el tiempo de espera si no hay disponibles
+func (tb *TokenBucket) Allow(key string) (bool, time.Duration) {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	now := tb.now()
+	tb.sweep(now)
+
+	b, exists := tb.buckets[key]
+	if !exists {
+		b = &bucket{tokens: tb.burst, lastSeen: now}
+		tb.buckets[key] = b
+	}
+
+	// Reponer tokens según el tiempo transcurrido
+	elapsed := now.Sub(b.lastSeen).Seconds()
+	b.tokens = math.Min(tb.burst, b.tokens+elapsed*tb.rate)
+	b.lastSeen = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+
+	missing := 1 - b.tokens
+	return false, time.Duration(missing / tb.rate * float64(time.Second))
+}
+
+// sweep elimina los buckets que ya se habrían rellenado por completo
+func (tb *TokenBucket) sweep(now time.Time) {
+	if now.Sub(tb.lastSweep) < sweepInterval {
+		return
+	}
+	tb.lastSweep = now
+
+	refill := time.Duration(tb.burst / tb.rate * float64(time.Second))
+	for key, b := range tb.buckets {
+		if now.Sub(b.lastSeen) > refill {
+			delete(tb.buckets, key)
+		}
+	}
+}
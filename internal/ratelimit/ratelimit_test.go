@@ -0,0 +1,164 @@
+package ratelimit
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"acortador-urls/internal/redis"
+)
+
+func TestTokenBucket_BurstAndRefill(t *testing.T) {
+	limiter := NewTokenBucket(1, 3)
+	now := time.Now()
+	limiter.now = func() time.Time { return now }
+
+	// La ráfaga inicial permite exactamente burst peticiones
+	for i := 0; i < 3; i++ {
+		if allowed, _ := limiter.Allow("ip:1.2.3.4"); !allowed {
+			t.Fatalf("Expected request %d to be allowed", i)
+		}
+	}
+
+	allowed, retryAfter := limiter.Allow("ip:1.2.3.4")
+	if allowed {
+		t.Fatal("Expected request beyond burst to be rejected")
+	}
+	if retryAfter <= 0 || retryAfter > time.Second {
+		t.Errorf("Expected retryAfter in (0, 1s], got %v", retryAfter)
+	}
+
+	// Otro cliente tiene su propio bucket
+	if allowed, _ := limiter.Allow("ip:5.6.7.8"); !allowed {
+		t.Error("Expected independent bucket for a different key")
+	}
+
+	// Tras un segundo se repone un token
+	now = now.Add(time.Second)
+	if allowed, _ := limiter.Allow("ip:1.2.3.4"); !allowed {
+		t.Error("Expected request to be allowed after refill")
+	}
+}
+
+func TestTokenBucket_SweepsIdleBuckets(t *testing.T) {
+	limiter := NewTokenBucket(10, 1)
+	now := time.Now()
+	limiter.now = func() time.Time { return now }
+
+	limiter.Allow("a")
+	now = now.Add(2 * sweepInterval)
+	limiter.Allow("b")
+
+	if _, exists := limiter.buckets["a"]; exists {
+		t.Error("Expected idle bucket to be swept")
+	}
+}
+
+// fakeRedis atiende EVAL como tokenBucketScript, con un TokenBucket en memoria por clave.
+// Retorna su URL, las claves que recibió y una función que lo detiene cerrando las conexiones.
+func fakeRedis(t *testing.T) (string, *[]string, func()) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var mu sync.Mutex
+	var keys []string
+	var conns []net.Conn
+	buckets := make(map[string]*TokenBucket)
+	stop := func() {
+		listener.Close()
+		mu.Lock()
+		defer mu.Unlock()
+		for _, conn := range conns {
+			conn.Close()
+		}
+	}
+	t.Cleanup(stop)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			conns = append(conns, conn)
+			mu.Unlock()
+			go func() {
+				defer conn.Close()
+				reader := redis.NewConn(conn)
+				for {
+					reply, err := reader.Read()
+					if err != nil {
+						return
+					}
+					// EVAL script 1 clave tasa ráfaga
+					args, _ := reply.([]interface{})
+					if len(args) != 6 || args[0] != "EVAL" || args[2] != "1" {
+						fmt.Fprint(conn, "-ERR unknown command\r\n")
+						continue
+					}
+					key := args[3].(string)
+					rate, _ := strconv.ParseFloat(args[4].(string), 64)
+					burst, _ := strconv.Atoi(args[5].(string))
+					mu.Lock()
+					keys = append(keys, key)
+					if buckets[key] == nil {
+						buckets[key] = NewTokenBucket(rate, burst)
+					}
+					allowed, retryAfter := buckets[key].Allow(key)
+					mu.Unlock()
+					result := 0
+					if allowed {
+						result = 1
+					}
+					fmt.Fprintf(conn, "*2\r\n:%d\r\n:%d\r\n", result, retryAfter.Milliseconds())
+				}
+			}()
+		}
+	}()
+	return "redis://" + listener.Addr().String(), &keys, stop
+}
+
+func TestRedisTokenBucket(t *testing.T) {
+	if _, err := NewRedisTokenBucket("http://localhost:6379", 1, 2); err == nil {
+		t.Errorf("Expected an error for a non redis:// URL")
+	}
+
+	rawURL, keys, stop := fakeRedis(t)
+	// Dos réplicas comparten el bucket de cada cliente
+	first, err := NewRedisTokenBucket(rawURL, 1, 2)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	second, _ := NewRedisTokenBucket(rawURL, 1, 2)
+
+	if allowed, _ := first.Allow("ip:1.2.3.4"); !allowed {
+		t.Fatal("Expected the first request to be allowed")
+	}
+	if allowed, _ := second.Allow("ip:1.2.3.4"); !allowed {
+		t.Fatal("Expected the second request to be allowed")
+	}
+	allowed, retryAfter := first.Allow("ip:1.2.3.4")
+	if allowed || retryAfter <= 0 || retryAfter > time.Second {
+		t.Errorf("Expected the shared burst to be exhausted with retryAfter in (0, 1s], got %t %v", allowed, retryAfter)
+	}
+	if (*keys)[0] != DefaultRedisPrefix+"ip:1.2.3.4" {
+		t.Errorf("Expected prefixed bucket key, got %q", (*keys)[0])
+	}
+
+	// Sin Redis cada réplica limita con su bucket en memoria, que aún no ha gastado nada
+	stop()
+	for i := 0; i < 2; i++ {
+		if allowed, _ := first.Allow("ip:1.2.3.4"); !allowed {
+			t.Fatalf("Expected request %d to be allowed by the local fallback", i)
+		}
+	}
+	if allowed, _ := first.Allow("ip:1.2.3.4"); allowed {
+		t.Error("Expected the local fallback to enforce the burst")
+	}
+}
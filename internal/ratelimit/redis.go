@@ -0,0 +1,113 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"acortador-urls/internal/redis"
+)
+
+// DefaultRedisPrefix es el prefijo de las claves de los buckets en Redis
+const DefaultRedisPrefix = "acortador:ratelimit:"
+
+// redisTimeout acota cada consulta a Redis: una petición no espera más que eso al limitador
+const redisTimeout = 500 * time.Millisecond
+
+// tokenBucketScript aplica el token bucket de forma atómica en Redis. Usa el reloj de Redis
+// para que todas las réplicas repongan tokens con la misma hora, y guarda los tokens como
+// texto porque Redis trunca a entero los números de Lua. El bucket expira cuando ya se habría
+// rellenado por completo. Retorna {permitido, espera en milisegundos}.
+const tokenBucketScript = `
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1]) or burst
+local ts = tonumber(state[2]) or now
+tokens = math.min(burst, tokens + math.max(0, now - ts) * rate / 1000)
+local allowed, wait = 0, 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+else
+	wait = math.ceil((1 - tokens) * 1000 / rate)
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', now)
+redis.call('PEXPIRE', KEYS[1], math.ceil(burst * 1000 / rate))
+return {allowed, wait}
+`
+
+// RedisTokenBucket implementa el token bucket en Redis para que todas las réplicas compartan
+// el límite de cada cliente. Si Redis no responde, cada réplica limita con su propio bucket en
+// memoria hasta que vuelva, en lugar de rechazar o dejar pasar todas las peticiones.
+type RedisTokenBucket struct {
+	client   *redis.Client
+	prefix   string
+	rate     string
+	burst    string
+	fallback *TokenBucket
+
+	// unavailable evita repetir el aviso en el log mientras Redis siga caído
+	unavailable atomic.Bool
+}
+
+// Verificación en compilación de que RedisTokenBucket implementa Limiter
+var _ Limiter = (*RedisTokenBucket)(nil)
+
+// NewRedisTokenBucket crea un limitador con la tasa (tokens/segundo) y ráfaga indicadas sobre
+// el servidor de rawURL (redis://[usuario:contraseña@]host:puerto). No se conecta hasta el
+// primer uso.
+func NewRedisTokenBucket(rawURL string, rate float64, burst int) (*RedisTokenBucket, error) {
+	client, err := redis.NewClient(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	return &RedisTokenBucket{
+		client:   client,
+		prefix:   DefaultRedisPrefix,
+		rate:     strconv.FormatFloat(rate, 'f', -1, 64),
+		burst:    strconv.Itoa(burst),
+		fallback: NewTokenBucket(rate, burst),
+	}, nil
+}
+
+// Allow consume un token del bucket compartido de la clave y retorna el tiempo de espera si no
+// hay disponibles
+func (rb *RedisTokenBucket) Allow(key string) (bool, time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	allowed, retryAfter, err := rb.eval(ctx, key)
+	if err != nil {
+		if !rb.unavailable.Swap(true) {
+			log.Printf("Limitador en Redis no disponible, se limita en memoria: %v", err)
+		}
+		return rb.fallback.Allow(key)
+	}
+	if rb.unavailable.Swap(false) {
+		log.Printf("Limitador en Redis disponible de nuevo")
+	}
+	return allowed, retryAfter
+}
+
+// eval ejecuta tokenBucketScript sobre el bucket de la clave
+func (rb *RedisTokenBucket) eval(ctx context.Context, key string) (bool, time.Duration, error) {
+	reply, err := rb.client.Do(ctx, "EVAL", tokenBucketScript, "1", rb.prefix+key, rb.rate, rb.burst)
+	if err != nil {
+		return false, 0, err
+	}
+	parts, ok := reply.([]interface{})
+	if !ok || len(parts) != 2 {
+		return false, 0, fmt.Errorf("respuesta del limitador inesperada: %v", reply)
+	}
+	allowed, okAllowed := parts[0].(int64)
+	wait, okWait := parts[1].(int64)
+	if !okAllowed || !okWait {
+		return false, 0, fmt.Errorf("respuesta del limitador inesperada: %v", reply)
+	}
+	return allowed == 1, time.Duration(wait) * time.Millisecond, nil
+}
@@ -0,0 +1,174 @@
+// Package redis es un cliente mínimo de Redis que habla RESP directamente para no depender de
+// una biblioteca externa. Lo comparten el bus de invalidaciones de la caché y el limitador de
+// peticiones entre réplicas; solo cubre lo que ellos necesitan.
+package redis
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// dialTimeout acota la conexión con Redis
+const dialTimeout = 5 * time.Second
+
+// Client envía comandos al servidor de una URL redis://. Do reutiliza una única conexión, que
+// se reabre tras un error; las suscripciones abren la suya con Dial.
+type Client struct {
+	addr     string
+	username string
+	password string
+
+	// mu protege la conexión que usa Do
+	mu   sync.Mutex
+	conn *Conn
+}
+
+// NewClient crea un cliente para rawURL (redis://[usuario:contraseña@]host:puerto). No se
+// conecta hasta el primer uso.
+func NewClient(rawURL string) (*Client, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme != "redis" || u.Host == "" {
+		return nil, fmt.Errorf("URL de Redis inválida: %q", rawURL)
+	}
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	client := &Client{addr: addr}
+	if u.User != nil {
+		client.username = u.User.Username()
+		client.password, _ = u.User.Password()
+	}
+	return client, nil
+}
+
+// Do envía un comando por la conexión compartida y retorna su respuesta
+func (c *Client) Do(ctx context.Context, args ...string) (interface{}, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn == nil {
+		conn, err := c.Dial(ctx)
+		if err != nil {
+			return nil, err
+		}
+		c.conn = conn
+	}
+	reply, err := c.conn.Do(ctx, args...)
+	var redisErr Error
+	if err != nil && !errors.As(err, &redisErr) {
+		// Tras un fallo de red la conexión puede tener una respuesta a medias
+		c.conn.Close()
+		c.conn = nil
+	}
+	return reply, err
+}
+
+// Dial abre una conexión autenticada propia, p. ej. para SUBSCRIBE
+func (c *Client) Dial(ctx context.Context) (*Conn, error) {
+	dialer := net.Dialer{Timeout: dialTimeout}
+	netConn, err := dialer.DialContext(ctx, "tcp", c.addr)
+	if err != nil {
+		return nil, err
+	}
+	conn := NewConn(netConn)
+	if c.password != "" {
+		args := []string{"AUTH", c.password}
+		if c.username != "" {
+			args = []string{"AUTH", c.username, c.password}
+		}
+		if _, err := conn.Do(ctx, args...); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// Error es un error respondido por Redis; la conexión sigue siendo válida
+type Error string
+
+func (e Error) Error() string {
+	return "redis: " + string(e)
+}
+
+// Conn es una conexión que envía comandos y lee respuestas en formato RESP
+type Conn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+// NewConn envuelve una conexión de red ya abierta
+func NewConn(conn net.Conn) *Conn {
+	return &Conn{Conn: conn, reader: bufio.NewReader(conn)}
+}
+
+// Do envía un comando y lee su respuesta respetando el deadline de ctx
+func (c *Conn) Do(ctx context.Context, args ...string) (interface{}, error) {
+	deadline, _ := ctx.Deadline()
+	c.SetDeadline(deadline)
+	defer c.SetDeadline(time.Time{})
+
+	var cmd strings.Builder
+	fmt.Fprintf(&cmd, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&cmd, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := c.Write([]byte(cmd.String())); err != nil {
+		return nil, err
+	}
+	return c.Read()
+}
+
+// Read lee una respuesta: string para simples y bulk, int64 para enteros, []interface{} para
+// arrays y Error para los errores de Redis. El bulk nulo se lee como nil.
+func (c *Conn) Read() (interface{}, error) {
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("respuesta de Redis vacía")
+	}
+	switch kind, payload := line[0], line[1:]; kind {
+	case '+':
+		return payload, nil
+	case '-':
+		return nil, Error(payload)
+	case ':':
+		return strconv.ParseInt(payload, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(payload)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(c.reader, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(payload)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		items := make([]interface{}, n)
+		for i := range items {
+			if items[i], err = c.Read(); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("respuesta de Redis desconocida: %q", line)
+	}
+}
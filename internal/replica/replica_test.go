@@ -0,0 +1,106 @@
+package replica
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"acortador-urls/internal/shortener"
+)
+
+func TestStore_GetLink(t *testing.T) {
+	ctx := context.Background()
+	primary, replica := shortener.NewStore(), shortener.NewStore()
+	store := NewStore(primary, replica, WithMaxLag(time.Minute))
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	store.now = func() time.Time { return now }
+
+	// "viejo" ya se replicó con su destino anterior; "ajeno" lo creó otra instancia y aún no
+	// llegó a la réplica
+	replica.SaveLink(ctx, shortener.Link{ShortCode: "viejo", LongURL: "https://www.example.com/antes"})
+	primary.SaveLink(ctx, shortener.Link{ShortCode: "viejo", LongURL: "https://www.example.com/antes"})
+	primary.SaveLink(ctx, shortener.Link{ShortCode: "ajeno", LongURL: "https://www.example.com/ajeno"})
+	store.SaveLink(ctx, shortener.Link{ShortCode: "nuevo", LongURL: "https://www.example.com/nuevo"})
+
+	tests := []struct {
+		name          string
+		code          string
+		expectedURL   string
+		expectedStats Stats
+	}{
+		{name: "Replicado", code: "viejo", expectedURL: "https://www.example.com/antes", expectedStats: Stats{ReplicaReads: 1}},
+		{name: "Escrito por esta instancia", code: "nuevo", expectedURL: "https://www.example.com/nuevo", expectedStats: Stats{PrimaryReads: 1}},
+		{name: "Aún no replicado", code: "ajeno", expectedURL: "https://www.example.com/ajeno", expectedStats: Stats{Fallbacks: 1}},
+		{name: "Inexistente", code: "nada", expectedStats: Stats{Fallbacks: 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := store.Stats()
+			link, found, err := store.GetLink(ctx, tt.code)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if found != (tt.expectedURL != "") || link.LongURL != tt.expectedURL {
+				t.Errorf("Expected %q, got %q (found=%v)", tt.expectedURL, link.LongURL, found)
+			}
+			after := store.Stats()
+			got := Stats{after.ReplicaReads - before.ReplicaReads, after.PrimaryReads - before.PrimaryReads, after.Fallbacks - before.Fallbacks}
+			if got != tt.expectedStats {
+				t.Errorf("Expected stats %+v, got %+v", tt.expectedStats, got)
+			}
+		})
+	}
+
+	// Una edición se lee del primario hasta que pasa el retraso máximo
+	store.SaveLink(ctx, shortener.Link{ShortCode: "viejo", LongURL: "https://www.example.com/despues"})
+	if link, _, _ := store.GetLink(ctx, "viejo"); link.LongURL != "https://www.example.com/despues" {
+		t.Errorf("Expected the edited destination, got %q", link.LongURL)
+	}
+	now = now.Add(time.Minute)
+	if link, _, _ := store.GetLink(ctx, "viejo"); link.LongURL != "https://www.example.com/antes" {
+		t.Errorf("Expected the replica to serve the link after the lag, got %q", link.LongURL)
+	}
+
+	// Un enlace eliminado no se sirve desde la copia de la réplica
+	store.Delete(ctx, "viejo")
+	if _, found, _ := store.GetLink(ctx, "viejo"); found {
+		t.Errorf("Expected the deleted link not to be found")
+	}
+}
+
+func TestStore_Routing(t *testing.T) {
+	ctx := context.Background()
+	primary, replica := shortener.NewStore(), shortener.NewStore()
+	store := NewStore(primary, replica)
+	service := shortener.NewService(store, shortener.WithDeduplication(true))
+
+	link, _, err := service.Shorten(ctx, shortener.ShortenInput{LongURL: "https://www.example.com", Owner: "alice"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if exists, _ := replica.Exists(ctx, link.ShortCode); exists {
+		t.Fatalf("Expected writes to go only to the primary")
+	}
+	if _, err := service.GetLink(ctx, link.ShortCode); err != nil {
+		t.Errorf("Expected the new link to resolve before it reaches the replica: %v", err)
+	}
+	// La deduplicación consulta el primario aunque la réplica no tenga el enlace
+	if again, _, _ := service.Shorten(ctx, shortener.ShortenInput{LongURL: "https://www.example.com", Owner: "alice"}); again.ShortCode != link.ShortCode {
+		t.Errorf("Expected the existing code %s, got %s", link.ShortCode, again.ShortCode)
+	}
+	if count, _ := store.Count(ctx); count != 0 {
+		t.Errorf("Expected the total to be read from the replica, got %d", count)
+	}
+	// Each recorre el primario, que es el que tienen que ver las operaciones que escriben
+	var seen int
+	store.Each(ctx, func(shortener.Link) error {
+		seen++
+		return nil
+	})
+	if seen != 1 {
+		t.Errorf("Expected Each to walk the primary, got %d links", seen)
+	}
+	if backend := shortener.BackendName(store); backend != "replica/memory" {
+		t.Errorf("Expected backend replica/memory, got %s", backend)
+	}
+}
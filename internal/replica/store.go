@@ -0,0 +1,236 @@
+// Package replica separa las lecturas de las escrituras cuando el almacén tiene réplicas de
+// solo lectura: las redirecciones y los listados se leen de una réplica y todo lo demás va al
+// primario, que es el único que se escribe.
+package replica
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"acortador-urls/internal/shortener"
+)
+
+// DefaultMaxLag es el retraso de replicación que se asume si no se indica otro
+const DefaultMaxLag = 5 * time.Second
+
+// sweepEvery es cada cuántas escrituras se descartan las claves recientes que ya pasaron el
+// retraso máximo
+const sweepEvery = 1024
+
+// Option configura un Store
+type Option func(*Store)
+
+// WithMaxLag configura durante cuánto tiempo tras escribir un enlace se lee del primario,
+// porque la réplica podría no tenerlo aún. Debe cubrir el retraso de replicación habitual.
+func WithMaxLag(lag time.Duration) Option {
+	return func(s *Store) {
+		if lag > 0 {
+			s.maxLag = lag
+		}
+	}
+}
+
+// Stats resume de dónde se sirvieron las lecturas de enlaces
+type Stats struct {
+	// ReplicaReads son las lecturas de enlaces servidas por la réplica
+	ReplicaReads uint64
+	// PrimaryReads son las de enlaces escritos por esta instancia hace menos de MaxLag
+	PrimaryReads uint64
+	// Fallbacks son las lecturas que no encontraron el enlace en la réplica y se repitieron en
+	// el primario; si crecen, la réplica va más atrasada de lo previsto o se visitan muchos
+	// códigos inexistentes
+	Fallbacks uint64
+}
+
+// Store es un shortener.LinkStore que lee de una réplica y escribe en el primario. Para no
+// servir datos anteriores a una escritura:
+//
+//   - GetLink lee del primario los enlaces que esta instancia escribió hace menos de MaxLag y,
+//     si la réplica no encuentra un código, repite la lectura en el primario, de modo que un
+//     enlace recién creado desde otra instancia redirige aunque la réplica no lo tenga aún.
+//   - Las lecturas previas a una escritura o que aplican un límite (Exists, FindByURL,
+//     CountByClient, CountByTenant, GetCollection y las claves de idempotencia) van siempre al
+//     primario.
+//   - Each también va al primario: además de la exportación lo usan operaciones que escriben
+//     sobre los enlaces recorridos, como eliminar una colección o los datos de un usuario, y
+//     con la réplica se saltarían los enlaces que aún no le llegaron.
+//
+// Los listados, la búsqueda, los recuentos totales y los logs de auditoría y denuncias se leen
+// de la réplica y pueden no incluir aún los últimos cambios. Las ediciones
+// hechas desde otras instancias se ven en las redirecciones cuando llegan a la réplica.
+type Store struct {
+	// LinkStore es el primario; los métodos que Store no redefine van a él
+	shortener.LinkStore
+	replica shortener.LinkStore
+	maxLag  time.Duration
+
+	// recent son las claves escritas por esta instancia y cuándo
+	mu     sync.Mutex
+	recent map[string]time.Time
+	writes int
+
+	replicaReads atomic.Uint64
+	primaryReads atomic.Uint64
+	fallbacks    atomic.Uint64
+
+	now func() time.Time
+}
+
+// Verificación en compilación de que Store implementa LinkStore
+var _ shortener.LinkStore = (*Store)(nil)
+
+// NewStore crea un almacén que escribe en primary y lee de replica
+func NewStore(primary, replica shortener.LinkStore, opts ...Option) *Store {
+	s := &Store{
+		LinkStore: primary,
+		replica:   replica,
+		maxLag:    DefaultMaxLag,
+		recent:    make(map[string]time.Time),
+		now:       time.Now,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Stats retorna de dónde se sirvieron las lecturas de enlaces desde el arranque
+func (s *Store) Stats() Stats {
+	return Stats{
+		ReplicaReads: s.replicaReads.Load(),
+		PrimaryReads: s.primaryReads.Load(),
+		Fallbacks:    s.fallbacks.Load(),
+	}
+}
+
+// Backend implementa shortener.BackendReporter anteponiendo la réplica al primario
+func (s *Store) Backend() string {
+	return "replica/" + shortener.BackendName(s.LinkStore)
+}
+
+// written registra que esta instancia escribió la clave
+func (s *Store) written(key string) {
+	now := s.now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.recent[key] = now
+	if s.writes++; s.writes >= sweepEvery {
+		s.writes = 0
+		for key, at := range s.recent {
+			if now.Sub(at) >= s.maxLag {
+				delete(s.recent, key)
+			}
+		}
+	}
+}
+
+// fresh indica si la clave se escribió hace menos de maxLag, y la réplica podría no tenerla
+func (s *Store) fresh(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	at, ok := s.recent[key]
+	return ok && s.now().Sub(at) < s.maxLag
+}
+
+// GetLink lee el enlace de la réplica salvo que esta instancia lo haya escrito hace poco, y
+// repite en el primario las lecturas que la réplica no encuentra
+func (s *Store) GetLink(ctx context.Context, shortCode string) (shortener.Link, bool, error) {
+	if s.fresh(shortCode) {
+		s.primaryReads.Add(1)
+		return s.LinkStore.GetLink(ctx, shortCode)
+	}
+	link, found, err := s.replica.GetLink(ctx, shortCode)
+	if err != nil || found {
+		s.replicaReads.Add(1)
+		return link, found, err
+	}
+	s.fallbacks.Add(1)
+	return s.LinkStore.GetLink(ctx, shortCode)
+}
+
+// SaveLink escribe el enlace en el primario
+func (s *Store) SaveLink(ctx context.Context, link shortener.Link) error {
+	defer s.written(link.Key())
+	return s.LinkStore.SaveLink(ctx, link)
+}
+
+// SaveLinkIfAbsent escribe el enlace en el primario si el código está libre
+func (s *Store) SaveLinkIfAbsent(ctx context.Context, link shortener.Link) (bool, error) {
+	created, err := s.LinkStore.SaveLinkIfAbsent(ctx, link)
+	if created {
+		s.written(link.Key())
+	}
+	return created, err
+}
+
+// GetOrSave deduplica y escribe en el primario
+func (s *Store) GetOrSave(ctx context.Context, link shortener.Link) (shortener.Link, bool, error) {
+	result, created, err := s.LinkStore.GetOrSave(ctx, link)
+	if created {
+		s.written(result.Key())
+	}
+	return result, created, err
+}
+
+// Delete elimina el enlace en el primario; hasta MaxLag después se sigue leyendo de él para no
+// redirigir con la copia de la réplica
+func (s *Store) Delete(ctx context.Context, shortCode string) (bool, error) {
+	defer s.written(shortCode)
+	return s.LinkStore.Delete(ctx, shortCode)
+}
+
+// SetHealth guarda el estado del destino en el primario
+func (s *Store) SetHealth(ctx context.Context, shortCode, longURL string, health shortener.LinkHealth) (bool, error) {
+	defer s.written(shortCode)
+	return s.LinkStore.SetHealth(ctx, shortCode, longURL, health)
+}
+
+// SetMetadata guarda los metadatos del destino en el primario
+func (s *Store) SetMetadata(ctx context.Context, shortCode, longURL string, metadata shortener.LinkMetadata) (bool, error) {
+	defer s.written(shortCode)
+	return s.LinkStore.SetMetadata(ctx, shortCode, longURL, metadata)
+}
+
+// Each no se redefine: recorre los enlaces del primario porque quien lo llama puede escribir
+// sobre ellos.
+
+// IncrementClicks no se redefine: las visitas se suman en el primario sin marcar el enlace
+// como reciente, de modo que los enlaces más visitados se siguen leyendo de la réplica aunque
+// su contador llegue con retraso.
+
+// ListByOwner lee de la réplica
+func (s *Store) ListByOwner(ctx context.Context, owner string) ([]shortener.Link, error) {
+	return s.replica.ListByOwner(ctx, owner)
+}
+
+// List lee de la réplica
+func (s *Store) List(ctx context.Context, query shortener.ListQuery) (shortener.LinkPage, error) {
+	return s.replica.List(ctx, query)
+}
+
+// Search lee de la réplica
+func (s *Store) Search(ctx context.Context, query shortener.SearchQuery) (shortener.LinkPage, error) {
+	return s.replica.Search(ctx, query)
+}
+
+// Count lee de la réplica
+func (s *Store) Count(ctx context.Context) (int, error) {
+	return s.replica.Count(ctx)
+}
+
+// QueryAudit lee de la réplica
+func (s *Store) QueryAudit(ctx context.Context, query shortener.AuditQuery) (shortener.AuditPage, error) {
+	return s.replica.QueryAudit(ctx, query)
+}
+
+// ListReports lee de la réplica
+func (s *Store) ListReports(ctx context.Context, query shortener.ReportQuery) (shortener.ReportPage, error) {
+	return s.replica.ListReports(ctx, query)
+}
+
+// ListCollections lee de la réplica
+func (s *Store) ListCollections(ctx context.Context, tenant string) ([]shortener.Collection, error) {
+	return s.replica.ListCollections(ctx, tenant)
+}
@@ -0,0 +1,123 @@
+// Package shard reparte los enlaces entre varios almacenes con hashing consistente, de modo que
+// cada nodo guarda solo una parte de los códigos y agregar o quitar un nodo mueve únicamente los
+// enlaces que le corresponden, alrededor de 1/N del total.
+//
+// Por ahora es solo una biblioteca: cmd/api no monta un ClusterStore porque el único backend es
+// el almacén en memoria.
+package shard
+
+import (
+	"hash/fnv"
+	"sort"
+	"strconv"
+)
+
+// DefaultReplicas es el número de puntos de cada nodo en el anillo. Con 128 puntos por nodo el
+// reparto entre nodos se desvía del uniforme en torno a un 10%.
+const DefaultReplicas = 128
+
+// point es una posición de un nodo en el anillo
+type point struct {
+	hash uint64
+	node string
+}
+
+// Ring es un anillo de hashing consistente. Cada nodo ocupa replicas puntos (nodos virtuales)
+// y cada clave pertenece al primer punto igual o posterior a su hash. Es inmutable: with y
+// without retornan un anillo nuevo, así que se puede consultar sin locks.
+type Ring struct {
+	replicas int
+	points   []point
+	nodes    []string
+}
+
+// NewRing crea un anillo con los nodos indicados y replicas puntos por nodo (DefaultReplicas
+// si no es positivo)
+func NewRing(replicas int, nodes ...string) *Ring {
+	if replicas <= 0 {
+		replicas = DefaultReplicas
+	}
+	ring := &Ring{replicas: replicas}
+	for _, node := range nodes {
+		ring = ring.with(node)
+	}
+	return ring
+}
+
+// Node retorna el nodo al que pertenece la clave; vacío si el anillo no tiene nodos
+func (r *Ring) Node(key string) string {
+	if len(r.points) == 0 {
+		return ""
+	}
+	hash := hashKey(key)
+	i := sort.Search(len(r.points), func(i int) bool { return r.points[i].hash >= hash })
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.points[i].node
+}
+
+// Nodes retorna los nodos del anillo en el orden en que se agregaron
+func (r *Ring) Nodes() []string {
+	return append([]string(nil), r.nodes...)
+}
+
+// has indica si el nodo está en el anillo
+func (r *Ring) has(node string) bool {
+	for _, candidate := range r.nodes {
+		if candidate == node {
+			return true
+		}
+	}
+	return false
+}
+
+// with retorna un anillo con el nodo agregado
+func (r *Ring) with(node string) *Ring {
+	ring := &Ring{
+		replicas: r.replicas,
+		points:   make([]point, 0, len(r.points)+r.replicas),
+		nodes:    append(r.Nodes(), node),
+	}
+	ring.points = append(ring.points, r.points...)
+	for i := 0; i < r.replicas; i++ {
+		ring.points = append(ring.points, point{hash: hashKey(node + "#" + strconv.Itoa(i)), node: node})
+	}
+	sort.Slice(ring.points, func(i, j int) bool {
+		if ring.points[i].hash == ring.points[j].hash {
+			return ring.points[i].node < ring.points[j].node
+		}
+		return ring.points[i].hash < ring.points[j].hash
+	})
+	return ring
+}
+
+// without retorna un anillo sin el nodo; el resto de puntos no se mueve
+func (r *Ring) without(node string) *Ring {
+	ring := &Ring{replicas: r.replicas}
+	for _, candidate := range r.nodes {
+		if candidate != node {
+			ring.nodes = append(ring.nodes, candidate)
+		}
+	}
+	for _, p := range r.points {
+		if p.node != node {
+			ring.points = append(ring.points, p)
+		}
+	}
+	return ring
+}
+
+// hashKey es FNV-1a de 64 bits seguido de la mezcla final de MurmurHash3, porque FNV por sí solo
+// apenas cambia los bits altos entre claves cortas parecidas como "nodo#1" y "nodo#2"
+func hashKey(key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
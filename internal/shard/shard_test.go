@@ -0,0 +1,300 @@
+package shard
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"acortador-urls/internal/shortener"
+)
+
+func TestRing(t *testing.T) {
+	keys := make([]string, 10000)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("c%05d", i)
+	}
+	ring := NewRing(0, "a", "b", "c")
+	owners := make(map[string]string, len(keys))
+	counts := make(map[string]int)
+	for _, key := range keys {
+		owners[key] = ring.Node(key)
+		counts[owners[key]]++
+	}
+	for _, node := range ring.Nodes() {
+		if share := float64(counts[node]) / float64(len(keys)); share < 0.25 || share > 0.42 {
+			t.Errorf("Expected node %s to own about a third of the keys, got %.2f", node, share)
+		}
+	}
+
+	tests := []struct {
+		name           string
+		ring           *Ring
+		expectedTarget string // nodo al que van todas las claves movidas; vacío si salen de "b"
+		expectedMoved  float64
+	}{
+		{name: "Agregar un nodo", ring: ring.with("d"), expectedTarget: "d", expectedMoved: 0.25},
+		{name: "Quitar un nodo", ring: ring.without("b"), expectedMoved: float64(counts["b"]) / float64(len(keys))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			moved := 0
+			for _, key := range keys {
+				owner := tt.ring.Node(key)
+				if owner == owners[key] {
+					continue
+				}
+				moved++
+				if tt.expectedTarget != "" && owner != tt.expectedTarget {
+					t.Fatalf("Expected %s to move only to %s, got %s", key, tt.expectedTarget, owner)
+				}
+				if tt.expectedTarget == "" && owners[key] != "b" {
+					t.Fatalf("Expected only the keys of b to move, %s moved from %s", key, owners[key])
+				}
+			}
+			if share := float64(moved) / float64(len(keys)); share < tt.expectedMoved-0.08 || share > tt.expectedMoved+0.08 {
+				t.Errorf("Expected about %.2f of the keys to move, got %.2f", tt.expectedMoved, share)
+			}
+		})
+	}
+
+	if node := NewRing(0).Node("abc"); node != "" {
+		t.Errorf("Expected an empty ring to own no keys, got %q", node)
+	}
+}
+
+// newTestCluster crea un clúster con almacenes en memoria
+func newTestCluster(t *testing.T, names ...string) (*ClusterStore, map[string]*shortener.Store) {
+	t.Helper()
+	stores := make(map[string]*shortener.Store)
+	nodes := make([]Node, len(names))
+	for i, name := range names {
+		stores[name] = shortener.NewStore()
+		nodes[i] = Node{Name: name, Store: stores[name]}
+	}
+	cluster, err := NewClusterStore(nodes)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return cluster, stores
+}
+
+// checkPlacement comprueba que cada enlace esté solo en el nodo que le corresponde
+func checkPlacement(t *testing.T, cluster *ClusterStore, stores map[string]*shortener.Store, total int) {
+	t.Helper()
+	ctx := context.Background()
+	sum := 0
+	for name, store := range stores {
+		store.Each(ctx, func(link shortener.Link) error {
+			sum++
+			if owner := cluster.NodeFor(link.Key()); owner != name {
+				t.Errorf("Expected %s on node %s, found on %s", link.Key(), owner, name)
+			}
+			return nil
+		})
+	}
+	if sum != total {
+		t.Errorf("Expected %d links across the nodes, got %d", total, sum)
+	}
+}
+
+func TestClusterStore(t *testing.T) {
+	ctx := context.Background()
+	cluster, stores := newTestCluster(t, "a", "b", "c")
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 60; i++ {
+		cluster.SaveLink(ctx, shortener.Link{ShortCode: fmt.Sprintf("c%02d", i), LongURL: fmt.Sprintf("https://www.example.com/%d", i),
+			Owner: "alice", CreatedAt: base.Add(time.Duration(i) * time.Minute), Clicks: int64(i % 7)})
+	}
+	checkPlacement(t, cluster, stores, 60)
+	for name, store := range stores {
+		if count, _ := store.Count(ctx); count == 0 {
+			t.Errorf("Expected node %s to hold some links", name)
+		}
+	}
+
+	t.Run("Operaciones por enlace", func(t *testing.T) {
+		if _, found, _ := cluster.GetLink(ctx, "c42"); !found {
+			t.Fatalf("Expected to find c42")
+		}
+		cluster.IncrementClicks(ctx, "c42", shortener.Visit{})
+		if link, _, _ := cluster.GetLink(ctx, "c42"); link.Clicks != 1 {
+			t.Errorf("Expected 1 click, got %d", link.Clicks)
+		}
+		if created, _ := cluster.SaveLinkIfAbsent(ctx, shortener.Link{ShortCode: "c42", LongURL: "https://otro.example.com"}); created {
+			t.Errorf("Expected an existing code to be rejected")
+		}
+		if count, _ := cluster.Count(ctx); count != 60 {
+			t.Errorf("Expected 60 links, got %d", count)
+		}
+	})
+
+	t.Run("Listado combinado", func(t *testing.T) {
+		single := shortener.NewStore()
+		cluster.Each(ctx, func(link shortener.Link) error { return single.SaveLink(ctx, link) })
+		for _, query := range []shortener.ListQuery{
+			{Owner: "alice", Sort: "-clicks", Offset: 10, Limit: 15},
+			{AnyOwner: true, Sort: "created_at", Offset: 50, Limit: 20},
+		} {
+			expected, _ := single.List(ctx, query)
+			got, err := cluster.List(ctx, query)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if got.Total != expected.Total || fmt.Sprint(codes(got.Links)) != fmt.Sprint(codes(expected.Links)) {
+				t.Errorf("Expected page %v (total %d), got %v (total %d)", codes(expected.Links), expected.Total, codes(got.Links), got.Total)
+			}
+		}
+		owned, _ := cluster.ListByOwner(ctx, "alice")
+		if len(owned) != 60 || owned[0].ShortCode != "c00" || owned[59].ShortCode != "c59" {
+			t.Errorf("Expected the links ordered by creation, got %v", codes(owned))
+		}
+	})
+
+	t.Run("Recorrido ordenado", func(t *testing.T) {
+		var visited []string
+		cluster.Each(ctx, func(link shortener.Link) error {
+			visited = append(visited, link.ShortCode)
+			return nil
+		})
+		if len(visited) != 60 || !sort.StringsAreSorted(visited) {
+			t.Errorf("Expected the 60 codes in order, got %v", visited)
+		}
+		stop := errors.New("stop")
+		if err := cluster.Each(ctx, func(shortener.Link) error { return stop }); err != stop {
+			t.Errorf("Expected the callback error, got %v", err)
+		}
+	})
+
+	t.Run("Deduplicación entre nodos", func(t *testing.T) {
+		link, created, err := cluster.GetOrSave(ctx, shortener.Link{ShortCode: "nuevo", LongURL: "https://www.example.com/7", Owner: "alice"})
+		if err != nil || created || link.ShortCode != "c07" {
+			t.Errorf("Expected the existing c07, got %s (created=%v, err=%v)", link.ShortCode, created, err)
+		}
+	})
+}
+
+func TestClusterStore_ConcurrentGetOrSave(t *testing.T) {
+	ctx := context.Background()
+	cluster, stores := newTestCluster(t, "a", "b", "c")
+
+	// Las creaciones simultáneas de la misma URL con códigos de nodos distintos dejan un enlace
+	var wg sync.WaitGroup
+	var created atomic.Int32
+	for i := 0; i < 30; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			link := shortener.Link{ShortCode: fmt.Sprintf("d%02d", i), LongURL: "https://www.example.com/concurrente", Owner: "alice"}
+			if _, ok, err := cluster.GetOrSave(ctx, link); err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			} else if ok {
+				created.Add(1)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if created.Load() != 1 {
+		t.Errorf("Expected exactly one link to be created, got %d", created.Load())
+	}
+	checkPlacement(t, cluster, stores, 1)
+}
+
+func TestClusterStore_Rebalance(t *testing.T) {
+	ctx := context.Background()
+	cluster, stores := newTestCluster(t, "a", "b", "c")
+	for i := 0; i < 300; i++ {
+		cluster.SaveLink(ctx, shortener.Link{ShortCode: fmt.Sprintf("c%03d", i), LongURL: fmt.Sprintf("https://www.example.com/%d", i)})
+	}
+	before := make(map[string]string)
+	for i := 0; i < 300; i++ {
+		key := fmt.Sprintf("c%03d", i)
+		before[key] = cluster.NodeFor(key)
+	}
+
+	stores["d"] = shortener.NewStore()
+	if err := cluster.AddNode(ctx, Node{Name: "d", Store: stores["d"]}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	checkPlacement(t, cluster, stores, 300)
+	moved, _ := stores["d"].Count(ctx)
+	if moved == 0 || moved > 150 {
+		t.Errorf("Expected about a quarter of the links to move to the new node, got %d", moved)
+	}
+	for key, owner := range before {
+		if now := cluster.NodeFor(key); now != owner && now != "d" {
+			t.Errorf("Expected %s to stay on %s or move to d, got %s", key, owner, now)
+		}
+	}
+
+	if err := cluster.RemoveNode(ctx, "b"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if left, _ := stores["b"].Count(ctx); left != 0 {
+		t.Errorf("Expected the removed node to be emptied, got %d links", left)
+	}
+	delete(stores, "b")
+	checkPlacement(t, cluster, stores, 300)
+	if nodes := cluster.Nodes(); fmt.Sprint(nodes) != "[a c d]" {
+		t.Errorf("Expected nodes [a c d], got %v", nodes)
+	}
+
+	if err := cluster.RemoveNode(ctx, "a"); !errors.Is(err, ErrCoordinator) {
+		t.Errorf("Expected ErrCoordinator, got %v", err)
+	}
+	if err := cluster.AddNode(ctx, Node{Name: "c", Store: shortener.NewStore()}); err == nil {
+		t.Errorf("Expected an error adding a repeated node")
+	}
+}
+
+func TestClusterStore_MoveOnAccess(t *testing.T) {
+	ctx := context.Background()
+	cluster, stores := newTestCluster(t, "a", "b")
+	for i := 0; i < 50; i++ {
+		cluster.SaveLink(ctx, shortener.Link{ShortCode: fmt.Sprintf("c%02d", i), LongURL: "https://www.example.com"})
+	}
+	// Una migración interrumpida deja los enlaces en su nodo anterior
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	stores["c"] = shortener.NewStore()
+	if err := cluster.AddNode(canceled, Node{Name: "c", Store: stores["c"]}); err == nil {
+		t.Fatalf("Expected the canceled migration to fail")
+	}
+	if err := cluster.AddNode(ctx, Node{Name: "d", Store: shortener.NewStore()}); !errors.Is(err, ErrRebalancing) {
+		t.Errorf("Expected ErrRebalancing, got %v", err)
+	}
+
+	var moving string
+	for i := 0; i < 50 && moving == ""; i++ {
+		if key := fmt.Sprintf("c%02d", i); cluster.NodeFor(key) == "c" {
+			moving = key
+		}
+	}
+	if moving == "" {
+		t.Fatalf("Expected some link to belong to the new node")
+	}
+	if _, found, _ := cluster.GetLink(ctx, moving); !found {
+		t.Fatalf("Expected %s to be found during the migration", moving)
+	}
+	if exists, _ := stores["c"].Exists(ctx, moving); !exists {
+		t.Errorf("Expected %s to move on access", moving)
+	}
+
+	if err := cluster.Rebalance(ctx); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	checkPlacement(t, cluster, stores, 50)
+}
+
+// codes retorna los códigos de los enlaces
+func codes(links []shortener.Link) []string {
+	result := make([]string, len(links))
+	for i, link := range links {
+		result[i] = link.ShortCode
+	}
+	return result
+}
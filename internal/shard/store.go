@@ -0,0 +1,648 @@
+package shard
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"sync"
+	"time"
+
+	"acortador-urls/internal/shortener"
+)
+
+var (
+	// ErrRebalancing indica que hay una migración pendiente tras agregar o quitar un nodo; se
+	// completa con Rebalance
+	ErrRebalancing = errors.New("hay una migración de enlaces entre nodos pendiente")
+	// ErrCoordinator indica que se intentó quitar el nodo coordinador
+	ErrCoordinator = errors.New("el nodo coordinador no se puede quitar")
+)
+
+// urlLockStripes es el número de mutex entre los que se reparten las URLs deduplicadas
+const urlLockStripes = 64
+
+// Node es un almacén del clúster con el nombre que lo ubica en el anillo. El nombre debe ser
+// estable entre reinicios (p. ej. host:puerto de su Redis): cambiarlo reubica sus enlaces.
+type Node struct {
+	Name  string
+	Store shortener.LinkStore
+}
+
+// Option configura un ClusterStore
+type Option func(*ClusterStore)
+
+// WithReplicas configura los puntos de cada nodo en el anillo (DefaultReplicas por defecto).
+// Debe ser el mismo en todas las instancias que comparten los nodos.
+func WithReplicas(replicas int) Option {
+	return func(s *ClusterStore) {
+		if replicas > 0 {
+			s.ring = NewRing(replicas)
+		}
+	}
+}
+
+// ClusterStore es un shortener.LinkStore que reparte los enlaces entre varios almacenes según
+// el hash de su clave (Link.Key). Las operaciones sobre un enlace van a un solo nodo; los
+// listados, búsquedas y recuentos consultan todos en paralelo y combinan los resultados. La
+// deduplicación por URL (GetOrSave) busca primero en todos los nodos y guarda después en el del
+// código, con un bloqueo por propietario y URL entre ambos pasos; el bloqueo es del proceso, así
+// que dos instancias con sus propios ClusterStore sobre los mismos nodos aún pueden crear dos
+// enlaces para la misma URL.
+//
+// El log de auditoría, las denuncias, las colecciones y las claves de idempotencia no se reparten:
+// los guarda el coordinador, el primer nodo de NewClusterStore, que no se puede quitar.
+//
+// AddNode y RemoveNode migran los enlaces que cambian de nodo sin detener el servicio: mientras
+// dura la migración, cada operación sobre un enlace que cambia de nodo lo mueve antes si aún no
+// se movió. Los listados y recuentos pueden contar dos veces un enlace que se está moviendo.
+type ClusterStore struct {
+	// mu protege ring, previous y nodes. Las operaciones sobre un enlace lo mantienen durante la
+	// llamada al nodo para que ninguna escriba en un nodo que la migración ya recorrió.
+	mu    sync.RWMutex
+	ring  *Ring
+	nodes map[string]shortener.LinkStore
+	// previous es el anillo anterior mientras dura una migración; nil si no hay ninguna
+	previous    *Ring
+	coordinator shortener.LinkStore
+
+	// moveMu serializa los movimientos de enlaces entre nodos con las operaciones sobre ellos
+	moveMu sync.Mutex
+	// rebalanceMu serializa AddNode, RemoveNode y Rebalance
+	rebalanceMu sync.Mutex
+	// urlLocks serializa GetOrSave por propietario y URL (ver urlLock)
+	urlLocks [urlLockStripes]sync.Mutex
+}
+
+// Verificación en compilación de que ClusterStore implementa LinkStore
+var _ shortener.LinkStore = (*ClusterStore)(nil)
+
+// NewClusterStore crea un almacén repartido entre los nodos indicados; el primero es el
+// coordinador. Los nodos deben estar vacíos o contener ya los enlaces que les corresponden con
+// el mismo anillo; para agregar nodos a un clúster con datos se usa AddNode.
+func NewClusterStore(nodes []Node, opts ...Option) (*ClusterStore, error) {
+	if len(nodes) == 0 {
+		return nil, errors.New("el clúster necesita al menos un nodo")
+	}
+	s := &ClusterStore{
+		ring:        NewRing(DefaultReplicas),
+		nodes:       make(map[string]shortener.LinkStore, len(nodes)),
+		coordinator: nodes[0].Store,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	for _, node := range nodes {
+		if err := s.checkNewNode(node); err != nil {
+			return nil, err
+		}
+		s.ring = s.ring.with(node.Name)
+		s.nodes[node.Name] = node.Store
+	}
+	return s, nil
+}
+
+// checkNewNode comprueba que el nodo se pueda agregar; requiere mu o que s no se comparta aún
+func (s *ClusterStore) checkNewNode(node Node) error {
+	switch {
+	case node.Name == "" || node.Store == nil:
+		return errors.New("cada nodo necesita nombre y almacén")
+	case s.nodes[node.Name] != nil:
+		return fmt.Errorf("el nodo %q ya está en el clúster", node.Name)
+	}
+	return nil
+}
+
+// Nodes retorna los nombres de los nodos del anillo en el orden en que se agregaron
+func (s *ClusterStore) Nodes() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.ring.Nodes()
+}
+
+// NodeFor retorna el nombre del nodo que guarda la clave de un enlace
+func (s *ClusterStore) NodeFor(key string) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.ring.Node(key)
+}
+
+// Backend implementa shortener.BackendReporter anteponiendo el reparto al backend del
+// coordinador
+func (s *ClusterStore) Backend() string {
+	return "shard/" + shortener.BackendName(s.coordinator)
+}
+
+// AddNode agrega un nodo vacío al anillo y le mueve los enlaces que pasan a corresponderle
+func (s *ClusterStore) AddNode(ctx context.Context, node Node) error {
+	s.rebalanceMu.Lock()
+	defer s.rebalanceMu.Unlock()
+
+	s.mu.Lock()
+	switch {
+	case s.previous != nil:
+		s.mu.Unlock()
+		return ErrRebalancing
+	default:
+		if err := s.checkNewNode(node); err != nil {
+			s.mu.Unlock()
+			return err
+		}
+	}
+	s.previous, s.ring = s.ring, s.ring.with(node.Name)
+	s.nodes[node.Name] = node.Store
+	s.mu.Unlock()
+
+	return s.rebalance(ctx)
+}
+
+// RemoveNode quita un nodo del anillo y mueve sus enlaces a los nodos que pasan a
+// corresponderles. El almacén del nodo queda vacío pero no se cierra.
+func (s *ClusterStore) RemoveNode(ctx context.Context, name string) error {
+	s.rebalanceMu.Lock()
+	defer s.rebalanceMu.Unlock()
+
+	s.mu.Lock()
+	switch store := s.nodes[name]; {
+	case s.previous != nil:
+		s.mu.Unlock()
+		return ErrRebalancing
+	case store == nil || !s.ring.has(name):
+		s.mu.Unlock()
+		return fmt.Errorf("el nodo %q no está en el clúster", name)
+	case store == s.coordinator:
+		s.mu.Unlock()
+		return ErrCoordinator
+	}
+	s.previous, s.ring = s.ring, s.ring.without(name)
+	s.mu.Unlock()
+
+	return s.rebalance(ctx)
+}
+
+// Rebalance completa una migración interrumpida por un error de AddNode o RemoveNode
+func (s *ClusterStore) Rebalance(ctx context.Context) error {
+	s.rebalanceMu.Lock()
+	defer s.rebalanceMu.Unlock()
+	return s.rebalance(ctx)
+}
+
+// rebalance recorre los nodos moviendo los enlaces que no están en el que les corresponde y
+// termina la migración; si falla, la migración sigue pendiente. Requiere rebalanceMu.
+func (s *ClusterStore) rebalance(ctx context.Context) error {
+	s.mu.RLock()
+	ring, nodes := s.ring, make(map[string]shortener.LinkStore, len(s.nodes))
+	for name, store := range s.nodes {
+		nodes[name] = store
+	}
+	s.mu.RUnlock()
+
+	for name, store := range nodes {
+		err := store.Each(ctx, func(link shortener.Link) error {
+			key := link.Key()
+			target := ring.Node(key)
+			if target == name {
+				return nil
+			}
+			s.moveMu.Lock()
+			defer s.moveMu.Unlock()
+			return moveLink(ctx, key, store, nodes[target])
+		})
+		if err != nil {
+			return fmt.Errorf("migración de los enlaces del nodo %q: %w", name, err)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.previous = nil
+	for name := range s.nodes {
+		if !ring.has(name) {
+			delete(s.nodes, name)
+		}
+	}
+	return nil
+}
+
+// moveLink mueve un enlace de un nodo a otro si sigue en el de origen. Si el destino ya tiene
+// el código, porque se escribió allí durante la migración, conserva esa versión. Requiere moveMu.
+func moveLink(ctx context.Context, key string, from, to shortener.LinkStore) error {
+	link, found, err := from.GetLink(ctx, key)
+	if err != nil || !found {
+		return err
+	}
+	if _, err := to.SaveLinkIfAbsent(ctx, link); err != nil {
+		return err
+	}
+	_, err = from.Delete(ctx, key)
+	return err
+}
+
+// withLink llama a fn con el nodo del enlace. Durante una migración, si el enlace cambia de
+// nodo, primero lo mueve desde el anterior.
+func (s *ClusterStore) withLink(ctx context.Context, key string, fn func(shortener.LinkStore) error) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	store := s.nodes[s.ring.Node(key)]
+	if s.previous == nil {
+		return fn(store)
+	}
+	previous := s.nodes[s.previous.Node(key)]
+	if previous == store {
+		return fn(store)
+	}
+	s.moveMu.Lock()
+	defer s.moveMu.Unlock()
+	if err := moveLink(ctx, key, previous, store); err != nil {
+		return err
+	}
+	return fn(store)
+}
+
+// stores retorna los almacenes de todos los nodos, incluidos los que se están quitando
+func (s *ClusterStore) stores() []shortener.LinkStore {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	names := make([]string, 0, len(s.nodes))
+	for name := range s.nodes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	stores := make([]shortener.LinkStore, len(names))
+	for i, name := range names {
+		stores[i] = s.nodes[name]
+	}
+	return stores
+}
+
+// gather llama a fn en todos los nodos en paralelo y retorna sus resultados en el orden de
+// stores, o el primer error
+func gather[T any](s *ClusterStore, fn func(shortener.LinkStore) (T, error)) ([]T, error) {
+	stores := s.stores()
+	results := make([]T, len(stores))
+	errs := make([]error, len(stores))
+	var wg sync.WaitGroup
+	for i, store := range stores {
+		wg.Add(1)
+		go func(i int, store shortener.LinkStore) {
+			defer wg.Done()
+			results[i], errs[i] = fn(store)
+		}(i, store)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
+
+// sum suma los recuentos de todos los nodos
+func (s *ClusterStore) sum(fn func(shortener.LinkStore) (int, error)) (int, error) {
+	counts, err := gather(s, fn)
+	total := 0
+	for _, count := range counts {
+		total += count
+	}
+	return total, err
+}
+
+// SaveLink implementa shortener.LinkStore
+func (s *ClusterStore) SaveLink(ctx context.Context, link shortener.Link) error {
+	return s.withLink(ctx, link.Key(), func(store shortener.LinkStore) error {
+		return store.SaveLink(ctx, link)
+	})
+}
+
+// SaveLinkIfAbsent implementa shortener.LinkStore
+func (s *ClusterStore) SaveLinkIfAbsent(ctx context.Context, link shortener.Link) (created bool, err error) {
+	err = s.withLink(ctx, link.Key(), func(store shortener.LinkStore) error {
+		created, err = store.SaveLinkIfAbsent(ctx, link)
+		return err
+	})
+	return created, err
+}
+
+// GetLink implementa shortener.LinkStore
+func (s *ClusterStore) GetLink(ctx context.Context, shortCode string) (link shortener.Link, found bool, err error) {
+	err = s.withLink(ctx, shortCode, func(store shortener.LinkStore) error {
+		link, found, err = store.GetLink(ctx, shortCode)
+		return err
+	})
+	return link, found, err
+}
+
+// urlLock retorna el mutex de la URL de un propietario; las URLs que comparten mutex solo se
+// esperan entre sí
+func (s *ClusterStore) urlLock(owner, longURL string) *sync.Mutex {
+	h := fnv.New32a()
+	h.Write([]byte(owner))
+	h.Write([]byte{0})
+	h.Write([]byte(longURL))
+	return &s.urlLocks[h.Sum32()%urlLockStripes]
+}
+
+// GetOrSave implementa shortener.LinkStore buscando el enlace vigente de la URL en todos los
+// nodos antes de guardarlo en el suyo. El bloqueo de la URL cubre la búsqueda y el guardado
+// para que dos creaciones simultáneas no se salten la una a la otra.
+func (s *ClusterStore) GetOrSave(ctx context.Context, link shortener.Link) (shortener.Link, bool, error) {
+	owner := shortener.TenantKey(link.Tenant, link.Owner)
+	lock := s.urlLock(owner, link.LongURL)
+	lock.Lock()
+	defer lock.Unlock()
+
+	existing, found, err := s.FindByURL(ctx, owner, link.LongURL)
+	if err != nil {
+		return shortener.Link{}, false, err
+	}
+	if found && !existing.IsExpired(time.Now()) && !existing.IsDisabled() {
+		return existing, false, nil
+	}
+	var (
+		result  shortener.Link
+		created bool
+	)
+	err = s.withLink(ctx, link.Key(), func(store shortener.LinkStore) error {
+		result, created, err = store.GetOrSave(ctx, link)
+		return err
+	})
+	return result, created, err
+}
+
+// FindByURL implementa shortener.LinkStore consultando todos los nodos
+func (s *ClusterStore) FindByURL(ctx context.Context, owner, longURL string) (shortener.Link, bool, error) {
+	type result struct {
+		link  shortener.Link
+		found bool
+	}
+	results, err := gather(s, func(store shortener.LinkStore) (result, error) {
+		link, found, err := store.FindByURL(ctx, owner, longURL)
+		return result{link, found}, err
+	})
+	if err != nil {
+		return shortener.Link{}, false, err
+	}
+	for _, r := range results {
+		if r.found {
+			return r.link, true, nil
+		}
+	}
+	return shortener.Link{}, false, nil
+}
+
+// IncrementClicks implementa shortener.LinkStore
+func (s *ClusterStore) IncrementClicks(ctx context.Context, shortCode string, visit shortener.Visit) error {
+	return s.withLink(ctx, shortCode, func(store shortener.LinkStore) error {
+		return store.IncrementClicks(ctx, shortCode, visit)
+	})
+}
+
+// Delete implementa shortener.LinkStore
+func (s *ClusterStore) Delete(ctx context.Context, shortCode string) (deleted bool, err error) {
+	err = s.withLink(ctx, shortCode, func(store shortener.LinkStore) error {
+		deleted, err = store.Delete(ctx, shortCode)
+		return err
+	})
+	return deleted, err
+}
+
+// Exists implementa shortener.LinkStore
+func (s *ClusterStore) Exists(ctx context.Context, shortCode string) (exists bool, err error) {
+	err = s.withLink(ctx, shortCode, func(store shortener.LinkStore) error {
+		exists, err = store.Exists(ctx, shortCode)
+		return err
+	})
+	return exists, err
+}
+
+// SetHealth implementa shortener.LinkStore
+func (s *ClusterStore) SetHealth(ctx context.Context, shortCode, longURL string, health shortener.LinkHealth) (updated bool, err error) {
+	err = s.withLink(ctx, shortCode, func(store shortener.LinkStore) error {
+		updated, err = store.SetHealth(ctx, shortCode, longURL, health)
+		return err
+	})
+	return updated, err
+}
+
+// SetMetadata implementa shortener.LinkStore
+func (s *ClusterStore) SetMetadata(ctx context.Context, shortCode, longURL string, metadata shortener.LinkMetadata) (updated bool, err error) {
+	err = s.withLink(ctx, shortCode, func(store shortener.LinkStore) error {
+		updated, err = store.SetMetadata(ctx, shortCode, longURL, metadata)
+		return err
+	})
+	return updated, err
+}
+
+// ListByOwner implementa shortener.LinkStore combinando los enlaces de todos los nodos
+func (s *ClusterStore) ListByOwner(ctx context.Context, owner string) ([]shortener.Link, error) {
+	lists, err := gather(s, func(store shortener.LinkStore) ([]shortener.Link, error) {
+		return store.ListByOwner(ctx, owner)
+	})
+	if err != nil {
+		return nil, err
+	}
+	links := make([]shortener.Link, 0)
+	for _, list := range lists {
+		links = append(links, list...)
+	}
+	sort.Slice(links, func(i, j int) bool {
+		if links[i].CreatedAt.Equal(links[j].CreatedAt) {
+			return links[i].ShortCode < links[j].ShortCode
+		}
+		return links[i].CreatedAt.Before(links[j].CreatedAt)
+	})
+	return links, nil
+}
+
+// List implementa shortener.LinkStore pidiendo a cada nodo sus Offset+Limit primeros enlaces y
+// paginando la combinación
+func (s *ClusterStore) List(ctx context.Context, query shortener.ListQuery) (shortener.LinkPage, error) {
+	head := query
+	head.Offset, head.Limit = 0, query.Offset+query.Limit
+	pages, err := gather(s, func(store shortener.LinkStore) (shortener.LinkPage, error) {
+		return store.List(ctx, head)
+	})
+	if err != nil {
+		return shortener.LinkPage{}, err
+	}
+	links, total := mergePages(pages)
+	page := query.Page(links)
+	page.Total = total
+	return page, nil
+}
+
+// Search implementa shortener.LinkStore combinando los mejores resultados de cada nodo
+func (s *ClusterStore) Search(ctx context.Context, query shortener.SearchQuery) (shortener.LinkPage, error) {
+	pages, err := gather(s, func(store shortener.LinkStore) (shortener.LinkPage, error) {
+		return store.Search(ctx, query)
+	})
+	if err != nil {
+		return shortener.LinkPage{}, err
+	}
+	links, total := mergePages(pages)
+	page := query.Page(links)
+	page.Total = total
+	return page, nil
+}
+
+// mergePages junta los enlaces de varias páginas y suma sus totales
+func mergePages(pages []shortener.LinkPage) ([]shortener.Link, int) {
+	links := make([]shortener.Link, 0)
+	total := 0
+	for _, page := range pages {
+		links = append(links, page.Links...)
+		total += page.Total
+	}
+	return links, total
+}
+
+// Count implementa shortener.LinkStore
+func (s *ClusterStore) Count(ctx context.Context) (int, error) {
+	return s.sum(func(store shortener.LinkStore) (int, error) { return store.Count(ctx) })
+}
+
+// CountByClient implementa shortener.LinkStore
+func (s *ClusterStore) CountByClient(ctx context.Context, client string) (int, error) {
+	return s.sum(func(store shortener.LinkStore) (int, error) { return store.CountByClient(ctx, client) })
+}
+
+// CountByTenant implementa shortener.LinkStore
+func (s *ClusterStore) CountByTenant(ctx context.Context, tenant string) (int, error) {
+	return s.sum(func(store shortener.LinkStore) (int, error) { return store.CountByTenant(ctx, tenant) })
+}
+
+// eachBuffer son los enlaces que cada nodo adelanta en Each mientras se combinan
+const eachBuffer = 64
+
+// cursor es el recorrido de un nodo en Each: head es su siguiente enlace si ok
+type cursor struct {
+	links chan shortener.Link
+	err   error
+	head  shortener.Link
+	ok    bool
+}
+
+// next avanza el cursor; retorna el error del nodo cuando termina su recorrido
+func (c *cursor) next() error {
+	c.head, c.ok = <-c.links
+	if !c.ok {
+		return c.err
+	}
+	return nil
+}
+
+// Each implementa shortener.LinkStore recorriendo todos los nodos a la vez y combinando sus
+// enlaces por código, sin materializar el almacén
+func (s *ClusterStore) Each(ctx context.Context, fn func(shortener.Link) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+
+	stores := s.stores()
+	cursors := make([]*cursor, len(stores))
+	for i, store := range stores {
+		c := &cursor{links: make(chan shortener.Link, eachBuffer)}
+		cursors[i] = c
+		wg.Add(1)
+		go func(store shortener.LinkStore) {
+			defer wg.Done()
+			defer close(c.links)
+			c.err = store.Each(ctx, func(link shortener.Link) error {
+				select {
+				case c.links <- link:
+					return nil
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			})
+		}(store)
+	}
+
+	for _, c := range cursors {
+		if err := c.next(); err != nil {
+			return err
+		}
+	}
+	for {
+		var first *cursor
+		for _, c := range cursors {
+			if c.ok && (first == nil || c.head.ShortCode < first.head.ShortCode) {
+				first = c
+			}
+		}
+		if first == nil {
+			return nil
+		}
+		if err := fn(first.head); err != nil {
+			return err
+		}
+		if err := first.next(); err != nil {
+			return err
+		}
+	}
+}
+
+// GetIdempotencyKey implementa shortener.LinkStore en el coordinador
+func (s *ClusterStore) GetIdempotencyKey(ctx context.Context, key string) (shortener.IdempotencyRecord, bool, error) {
+	return s.coordinator.GetIdempotencyKey(ctx, key)
+}
+
+// SaveIdempotencyKey implementa shortener.LinkStore en el coordinador
+func (s *ClusterStore) SaveIdempotencyKey(ctx context.Context, record shortener.IdempotencyRecord) (shortener.IdempotencyRecord, bool, error) {
+	return s.coordinator.SaveIdempotencyKey(ctx, record)
+}
+
+// AppendAudit implementa shortener.LinkStore en el coordinador
+func (s *ClusterStore) AppendAudit(ctx context.Context, entry shortener.AuditEntry) (shortener.AuditEntry, error) {
+	return s.coordinator.AppendAudit(ctx, entry)
+}
+
+// QueryAudit implementa shortener.LinkStore en el coordinador
+func (s *ClusterStore) QueryAudit(ctx context.Context, query shortener.AuditQuery) (shortener.AuditPage, error) {
+	return s.coordinator.QueryAudit(ctx, query)
+}
+
+// PurgeAudit implementa shortener.LinkStore en el coordinador
+func (s *ClusterStore) PurgeAudit(ctx context.Context, user string) (int, error) {
+	return s.coordinator.PurgeAudit(ctx, user)
+}
+
+// AddReport implementa shortener.LinkStore en el coordinador
+func (s *ClusterStore) AddReport(ctx context.Context, report shortener.Report) (shortener.Report, int, error) {
+	return s.coordinator.AddReport(ctx, report)
+}
+
+// ListReports implementa shortener.LinkStore en el coordinador
+func (s *ClusterStore) ListReports(ctx context.Context, query shortener.ReportQuery) (shortener.ReportPage, error) {
+	return s.coordinator.ListReports(ctx, query)
+}
+
+// CloseReports implementa shortener.LinkStore en el coordinador
+func (s *ClusterStore) CloseReports(ctx context.Context, shortCode, status string) (int, error) {
+	return s.coordinator.CloseReports(ctx, shortCode, status)
+}
+
+// SaveCollection implementa shortener.LinkStore en el coordinador
+func (s *ClusterStore) SaveCollection(ctx context.Context, collection shortener.Collection) (shortener.Collection, error) {
+	return s.coordinator.SaveCollection(ctx, collection)
+}
+
+// GetCollection implementa shortener.LinkStore en el coordinador
+func (s *ClusterStore) GetCollection(ctx context.Context, id int64) (shortener.Collection, bool, error) {
+	return s.coordinator.GetCollection(ctx, id)
+}
+
+// DeleteCollection implementa shortener.LinkStore en el coordinador
+func (s *ClusterStore) DeleteCollection(ctx context.Context, id int64) (bool, error) {
+	return s.coordinator.DeleteCollection(ctx, id)
+}
+
+// ListCollections implementa shortener.LinkStore en el coordinador
+func (s *ClusterStore) ListCollections(ctx context.Context, tenant string) ([]shortener.Collection, error) {
+	return s.coordinator.ListCollections(ctx, tenant)
+}
@@ -0,0 +1,365 @@
+package shortener
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/netip"
+	"sync"
+	"time"
+
+	"acortador-urls/internal/errcode"
+)
+
+// Tipos de anomalía de tráfico (Anomaly.Type)
+const (
+	// AnomalyLinkRate es un enlace que superó AnomalyPolicy.LinkClicks visitas en la ventana
+	AnomalyLinkRate = "link_rate"
+	// AnomalyLinkSpike es un enlace cuyas visitas en la ventana superan SpikeFactor veces su
+	// media móvil exponencial (EWMA) de las ventanas anteriores
+	AnomalyLinkSpike = "link_spike"
+	// AnomalySourceRate es una IP que superó AnomalyPolicy.SourceClicks visitas en la ventana,
+	// sumando todos los enlaces
+	AnomalySourceRate = "source_rate"
+)
+
+// Acciones ante una anomalía (AnomalyPolicy.Action)
+const (
+	// AnomalyAlert solo avisa con OnAnomaly y el evento EventAnomaly
+	AnomalyAlert = "alert"
+	// AnomalyThrottle además rechaza durante ThrottleFor las visitas al enlace o, en las
+	// anomalías por IP, las de esa IP
+	AnomalyThrottle = "throttle"
+	// AnomalyQuarantine además pone el enlace en cuarentena tras la página de aviso hasta que
+	// un administrador lo libere
+	AnomalyQuarantine = "quarantine"
+)
+
+// AnomalyActions son las acciones admitidas ante una anomalía
+var AnomalyActions = []string{AnomalyAlert, AnomalyThrottle, AnomalyQuarantine}
+
+// Valores por defecto de AnomalyPolicy
+const (
+	DefaultAnomalyWindow   = time.Minute
+	DefaultAnomalyThrottle = 10 * time.Minute
+	DefaultSpikeMinClicks  = 20
+	DefaultSpikeAlpha      = 0.3
+)
+
+// anomalyIdleWindows son las ventanas sin visitas tras las que se olvida la media de un enlace;
+// con el alpha por defecto ya es despreciable
+const anomalyIdleWindows = 30
+
+// ErrLinkThrottled indica que las visitas al enlace o de la IP se rechazan temporalmente por
+// tráfico anómalo
+var ErrLinkThrottled = errcode.New(errcode.LinkThrottled, "visitas limitadas por tráfico anómalo")
+
+// ThrottledError acompaña a ErrLinkThrottled con el momento en que se levanta la limitación
+type ThrottledError struct {
+	Until time.Time
+}
+
+func (e *ThrottledError) Error() string {
+	return fmt.Sprintf("%v hasta %s", ErrLinkThrottled, e.Until.UTC().Format(time.RFC3339))
+}
+
+// Unwrap permite comprobar el error con errors.Is(err, ErrLinkThrottled)
+func (e *ThrottledError) Unwrap() error {
+	return ErrLinkThrottled
+}
+
+// AnomalyPolicy configura la detección de picos de visitas. Los contadores son de esta
+// instancia y se cuentan todas las redirecciones servidas, incluidas las de bots.
+type AnomalyPolicy struct {
+	// Window es la ventana en la que se cuentan las visitas (DefaultAnomalyWindow si no es
+	// positiva)
+	Window time.Duration
+	// LinkClicks es el máximo de visitas por enlace en la ventana; cero no lo comprueba
+	LinkClicks int
+	// SourceClicks es el máximo de visitas de una IP en la ventana; cero no lo comprueba
+	SourceClicks int
+	// SpikeFactor activa la comparación con la media móvil de cada enlace: hay pico si las
+	// visitas de la ventana superan SpikeFactor veces la media; cero no la comprueba
+	SpikeFactor float64
+	// SpikeMinClicks son las visitas mínimas en la ventana para considerar un pico, de modo que
+	// los enlaces con poco tráfico no avisen por unas pocas visitas (DefaultSpikeMinClicks si
+	// no es positivo)
+	SpikeMinClicks int
+	// SpikeAlpha es el peso de la última ventana en la media, entre 0 y 1 (DefaultSpikeAlpha
+	// si está fuera de rango)
+	SpikeAlpha float64
+	// Action es una de AnomalyActions; vacía equivale a AnomalyAlert
+	Action string
+	// ThrottleFor es la duración de la limitación con AnomalyThrottle (DefaultAnomalyThrottle
+	// si no es positiva)
+	ThrottleFor time.Duration
+	// OnAnomaly recibe cada anomalía detectada, p. ej. para registrarla en el log. Se llama de
+	// forma síncrona desde la redirección, así que no debe bloquear.
+	OnAnomaly func(Anomaly)
+}
+
+// enabled indica si la política comprueba algo
+func (p AnomalyPolicy) enabled() bool {
+	return p.LinkClicks > 0 || p.SourceClicks > 0 || p.SpikeFactor > 0
+}
+
+// Anomaly describe un pico de visitas detectado. Cada enlace o IP avisa como mucho una vez por
+// ventana y tipo.
+type Anomaly struct {
+	Type string
+	// ShortCode es la clave del enlace visitado al detectarla
+	ShortCode string
+	// Source es la IP en las anomalías AnomalySourceRate
+	Source string
+	// Clicks son las visitas en la ventana al detectarla
+	Clicks int
+	// Threshold es el límite superado: LinkClicks, SourceClicks o SpikeFactor por la media
+	Threshold float64
+	// Baseline es la media móvil de visitas por ventana en las anomalías AnomalyLinkSpike
+	Baseline float64
+	Window   time.Duration
+	// Action es la acción aplicada
+	Action string
+	Time   time.Time
+}
+
+// WithAnomalyDetection activa la detección de picos de visitas por enlace y por IP. Cada
+// anomalía se entrega a policy.OnAnomaly y a los receptores de eventos como EventAnomaly, y
+// según policy.Action se limita el enlace o la IP o se pone el enlace en cuarentena.
+func WithAnomalyDetection(policy AnomalyPolicy) ServiceOption {
+	return func(s *Service) {
+		if !policy.enabled() {
+			s.anomalies = nil
+			return
+		}
+		if policy.Window <= 0 {
+			policy.Window = DefaultAnomalyWindow
+		}
+		if policy.SpikeMinClicks <= 0 {
+			policy.SpikeMinClicks = DefaultSpikeMinClicks
+		}
+		if policy.SpikeAlpha <= 0 || policy.SpikeAlpha > 1 {
+			policy.SpikeAlpha = DefaultSpikeAlpha
+		}
+		if policy.Action == "" {
+			policy.Action = AnomalyAlert
+		}
+		if policy.ThrottleFor <= 0 {
+			policy.ThrottleFor = DefaultAnomalyThrottle
+		}
+		s.anomalies = &anomalyDetector{
+			policy:           policy,
+			links:            make(map[string]*linkTraffic),
+			sources:          make(map[string]*windowCount),
+			throttledLinks:   make(map[string]time.Time),
+			throttledSources: make(map[string]time.Time),
+		}
+	}
+}
+
+// windowCount cuenta las visitas de la ventana en curso
+type windowCount struct {
+	start time.Time
+	count int
+	// alerted indica que ya se avisó en esta ventana
+	alerted bool
+}
+
+// roll pasa a la ventana de now si la actual terminó y retorna cuántas ventanas se cerraron
+func (w *windowCount) roll(now time.Time, window time.Duration) int {
+	if w.start.IsZero() {
+		w.start = now
+		return 0
+	}
+	elapsed := int(now.Sub(w.start) / window)
+	if elapsed < 1 {
+		return 0
+	}
+	w.start = w.start.Add(time.Duration(elapsed) * window)
+	w.count, w.alerted = 0, false
+	return elapsed
+}
+
+// linkTraffic son las visitas de un enlace y su media móvil por ventana
+type linkTraffic struct {
+	windowCount
+	// baseline es la media móvil exponencial de las ventanas cerradas; warm indica que hay al
+	// menos una
+	baseline float64
+	warm     bool
+	// spikeAlerted indica que ya se avisó de un pico en esta ventana
+	spikeAlerted bool
+}
+
+// anomalyDetector cuenta las visitas por enlace y por IP y recuerda las limitaciones vigentes
+type anomalyDetector struct {
+	policy AnomalyPolicy
+
+	mu               sync.Mutex
+	links            map[string]*linkTraffic
+	sources          map[string]*windowCount
+	throttledLinks   map[string]time.Time
+	throttledSources map[string]time.Time
+	lastSweep        time.Time
+}
+
+// throttled retorna hasta cuándo se rechazan las visitas al enlace o de la IP
+func (d *anomalyDetector) throttled(key, source string, now time.Time) (time.Time, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	until, ok := d.throttledLinks[key]
+	if sourceUntil, sourceOK := d.throttledSources[source]; source != "" && sourceOK && sourceUntil.After(until) {
+		until, ok = sourceUntil, true
+	}
+	return until, ok && now.Before(until)
+}
+
+// observe cuenta una visita al enlace desde source y retorna las anomalías que provoca
+func (d *anomalyDetector) observe(key, source string, now time.Time) []Anomaly {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.sweep(now)
+	policy := d.policy
+	var anomalies []Anomaly
+
+	traffic := d.links[key]
+	if traffic == nil {
+		traffic = &linkTraffic{}
+		d.links[key] = traffic
+	}
+	count := traffic.count
+	if closed := traffic.roll(now, policy.Window); closed > 0 {
+		// La ventana cerrada actualiza la media y las vacías posteriores la reducen
+		if traffic.warm {
+			traffic.baseline = policy.SpikeAlpha*float64(count) + (1-policy.SpikeAlpha)*traffic.baseline
+		} else {
+			traffic.baseline, traffic.warm = float64(count), true
+		}
+		traffic.baseline *= math.Pow(1-policy.SpikeAlpha, float64(closed-1))
+		traffic.spikeAlerted = false
+	}
+	traffic.count++
+	anomaly := Anomaly{ShortCode: key, Clicks: traffic.count, Window: policy.Window, Action: policy.Action, Time: now}
+	if policy.LinkClicks > 0 && traffic.count > policy.LinkClicks && !traffic.alerted {
+		traffic.alerted = true
+		anomaly.Type, anomaly.Threshold = AnomalyLinkRate, float64(policy.LinkClicks)
+		anomalies = append(anomalies, anomaly)
+	}
+	if threshold := policy.SpikeFactor * traffic.baseline; policy.SpikeFactor > 0 && traffic.warm && !traffic.spikeAlerted &&
+		traffic.count >= policy.SpikeMinClicks && float64(traffic.count) > threshold {
+		traffic.spikeAlerted = true
+		anomaly.Type, anomaly.Threshold, anomaly.Baseline = AnomalyLinkSpike, threshold, traffic.baseline
+		anomalies = append(anomalies, anomaly)
+	}
+
+	if policy.SourceClicks > 0 && source != "" {
+		window := d.sources[source]
+		if window == nil {
+			window = &windowCount{}
+			d.sources[source] = window
+		}
+		window.roll(now, policy.Window)
+		window.count++
+		if window.count > policy.SourceClicks && !window.alerted {
+			window.alerted = true
+			anomalies = append(anomalies, Anomaly{Type: AnomalySourceRate, ShortCode: key, Source: source, Clicks: window.count,
+				Threshold: float64(policy.SourceClicks), Window: policy.Window, Action: policy.Action, Time: now})
+		}
+	}
+
+	if policy.Action == AnomalyThrottle {
+		until := now.Add(policy.ThrottleFor)
+		for _, anomaly := range anomalies {
+			if anomaly.Type == AnomalySourceRate {
+				d.throttledSources[source] = until
+			} else {
+				d.throttledLinks[key] = until
+			}
+		}
+	}
+	return anomalies
+}
+
+// sweep olvida, como mucho una vez por ventana, las IPs sin visitas en la ventana anterior, los
+// enlaces inactivos y las limitaciones vencidas para que la memoria no crezca sin límite
+func (d *anomalyDetector) sweep(now time.Time) {
+	window := d.policy.Window
+	if now.Sub(d.lastSweep) < window {
+		return
+	}
+	d.lastSweep = now
+	for source, count := range d.sources {
+		if now.Sub(count.start) >= 2*window {
+			delete(d.sources, source)
+		}
+	}
+	for key, traffic := range d.links {
+		if now.Sub(traffic.start) >= anomalyIdleWindows*window {
+			delete(d.links, key)
+		}
+	}
+	for _, throttled := range []map[string]time.Time{d.throttledLinks, d.throttledSources} {
+		for key, until := range throttled {
+			if !now.Before(until) {
+				delete(throttled, key)
+			}
+		}
+	}
+}
+
+// checkThrottled rechaza la visita si el enlace o la IP del visitante están limitados
+func (s *Service) checkThrottled(link Link, clientIP netip.Addr, now time.Time) error {
+	if s.anomalies == nil {
+		return nil
+	}
+	if until, ok := s.anomalies.throttled(link.Key(), sourceKey(clientIP), now); ok {
+		return &ThrottledError{Until: until}
+	}
+	return nil
+}
+
+// observeVisit cuenta la visita servida y aplica la política a las anomalías que provoca.
+// Retorna el enlace actualizado si se puso en cuarentena; un fallo al guardarlo no impide la
+// redirección y la anomalía se avisa igualmente.
+func (s *Service) observeVisit(ctx context.Context, link Link, clientIP netip.Addr, now time.Time) Link {
+	if s.anomalies == nil {
+		return link
+	}
+	anomalies := s.anomalies.observe(link.Key(), sourceKey(clientIP), now)
+	if len(anomalies) == 0 {
+		return link
+	}
+	if s.anomalies.policy.Action == AnomalyQuarantine && !link.Quarantined {
+		before := link
+		link.Quarantined = true
+		link.UpdatedAt = now
+		if err := s.store.SaveLink(ctx, link); err != nil {
+			link = before
+		} else {
+			_ = s.audit(ctx, Actor{}, AuditQuarantine, &before, &link)
+		}
+	}
+	for _, anomaly := range anomalies {
+		if s.anomalies.policy.OnAnomaly != nil {
+			s.anomalies.policy.OnAnomaly(anomaly)
+		}
+		if len(s.listeners) > 0 {
+			s.publish(Event{Type: EventAnomaly, Time: now, Link: link, Anomaly: anomaly})
+		}
+	}
+	return link
+}
+
+// sourceKey identifica la IP del visitante; las IPv6 se agrupan por su /64, que suele
+// corresponder a un mismo cliente
+func sourceKey(ip netip.Addr) string {
+	if !ip.IsValid() {
+		return ""
+	}
+	ip = ip.Unmap()
+	if ip.Is6() {
+		prefix, _ := ip.Prefix(64)
+		return prefix.String()
+	}
+	return ip.String()
+}
@@ -0,0 +1,32 @@
+package shortener
+
+// WithAPIKeys registra las claves de API con identidad propia. Junto con las de los tenants y
+// las que tienen cuotas propias son las claves configuradas que reconoce KnownAPIKey.
+func WithAPIKeys(apiKeys ...string) ServiceOption {
+	return func(s *Service) {
+		for _, apiKey := range apiKeys {
+			if apiKey == "" {
+				continue
+			}
+			if s.apiKeys == nil {
+				s.apiKeys = make(map[string]bool)
+			}
+			s.apiKeys[APIKeyID(apiKey)] = true
+		}
+	}
+}
+
+// KnownAPIKey indica si la clave de API está configurada: registrada con WithAPIKeys, asignada
+// a un tenant o con cuotas propias. Las demás son valores arbitrarios del cliente y no deben
+// identificarlo, porque cambiarlos en cada petición no cuesta nada.
+func (s *Service) KnownAPIKey(apiKey string) bool {
+	if apiKey == "" {
+		return false
+	}
+	if _, ok := s.tenants.byAPIKey[apiKey]; ok {
+		return true
+	}
+	id := APIKeyID(apiKey)
+	_, limited := s.usage.limits[id]
+	return limited || s.apiKeys[id]
+}
@@ -0,0 +1,206 @@
+package shortener
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Acciones registradas en el log de auditoría
+const (
+	AuditCreate  = "create"
+	AuditUpdate  = "update"
+	AuditDelete  = "delete"
+	AuditDisable = "disable"
+	AuditEnable  = "enable"
+	// AuditQuarantine y AuditRelease registran la entrada y salida de la cuarentena por denuncias
+	AuditQuarantine = "quarantine"
+	AuditRelease    = "release"
+	// AuditTransfer registra el traspaso de un enlace a otro propietario, a nombre de quien lo
+	// recibe
+	AuditTransfer = "transfer"
+)
+
+// AuditActions son las acciones por las que se puede filtrar el log de auditoría
+var AuditActions = []string{AuditCreate, AuditUpdate, AuditDelete, AuditDisable, AuditEnable, AuditQuarantine, AuditRelease, AuditTransfer}
+
+// AuditEntry es una operación de gestión registrada en el log de auditoría. Las entradas solo
+// se agregan: nunca se modifican ni se eliminan, tampoco al purgar el enlace, salvo al borrar
+// los datos de un usuario (DeleteUserData).
+type AuditEntry struct {
+	// ID es correlativo y lo asigna el almacén al agregar la entrada
+	ID        int64
+	Time      time.Time
+	Actor     Actor
+	Action    string
+	ShortCode string
+	// Before es el enlace antes de la operación; nil al crear
+	Before *Link
+	// After es el enlace tras la operación; nil al eliminarlo definitivamente
+	After *Link
+}
+
+// AuditQuery filtra el log de auditoría; los campos vacíos no filtran. Las entradas se
+// retornan de la más reciente a la más antigua.
+type AuditQuery struct {
+	Actor     string
+	ShortCode string
+	Action    string
+	// User selecciona las entradas atribuibles al usuario: las que hizo y las de sus enlaces
+	User string
+	// Since y Until acotan el intervalo [Since, Until)
+	Since time.Time
+	Until time.Time
+	// Offset y Limit delimitan la página
+	Offset int
+	Limit  int
+}
+
+// AuditPage es una página del log de auditoría con el total de entradas que cumplen el filtro
+type AuditPage struct {
+	Entries []AuditEntry
+	Total   int
+}
+
+// validate comprueba la acción, el intervalo y los límites de la consulta
+func (q AuditQuery) validate() error {
+	var errs []error
+	if q.Action != "" && !isAuditAction(q.Action) {
+		errs = append(errs, &ValidationError{Field: "action", Value: q.Action,
+			Msg: fmt.Sprintf("debe ser una de %s", strings.Join(AuditActions, ", "))})
+	}
+	if !q.Since.IsZero() && !q.Until.IsZero() && !q.Until.After(q.Since) {
+		errs = append(errs, &ValidationError{Field: "until", Value: q.Until, Msg: "debe ser posterior a since"})
+	}
+	if q.Offset < 0 {
+		errs = append(errs, &ValidationError{Field: "page", Value: q.Offset, Msg: "debe ser al menos 1"})
+	}
+	if q.Limit < 1 || q.Limit > MaxListLimit {
+		errs = append(errs, &ValidationError{Field: "per_page", Value: q.Limit, Msg: fmt.Sprintf("debe estar entre 1 y %d", MaxListLimit)})
+	}
+	return errors.Join(errs...)
+}
+
+// isAuditAction indica si action es una acción auditada
+func isAuditAction(action string) bool {
+	for _, candidate := range AuditActions {
+		if candidate == action {
+			return true
+		}
+	}
+	return false
+}
+
+// matches indica si la entrada cumple los filtros de la consulta
+func (q AuditQuery) matches(entry AuditEntry) bool {
+	switch {
+	case q.Actor != "" && entry.Actor.UserID != q.Actor:
+		return false
+	case q.User != "" && !entry.attributableTo(q.User):
+		return false
+	case q.ShortCode != "" && entry.ShortCode != q.ShortCode:
+		return false
+	case q.Action != "" && entry.Action != q.Action:
+		return false
+	case !q.Since.IsZero() && entry.Time.Before(q.Since):
+		return false
+	case !q.Until.IsZero() && !entry.Time.Before(q.Until):
+		return false
+	}
+	return true
+}
+
+// attributableTo indica si la entrada es del usuario: la hizo él o afecta a uno de sus enlaces
+func (e AuditEntry) attributableTo(user string) bool {
+	return e.Actor.UserID == user || (e.Before != nil && e.Before.Owner == user) || (e.After != nil && e.After.Owner == user)
+}
+
+// AuditLog retorna una página del log de auditoría; solo está disponible para administradores
+func (s *Service) AuditLog(ctx context.Context, actor Actor, query AuditQuery) (AuditPage, error) {
+	if !actor.Admin {
+		return AuditPage{}, ErrForbidden
+	}
+	if query.Limit == 0 {
+		query.Limit = DefaultListLimit
+	}
+	if err := query.validate(); err != nil {
+		return AuditPage{}, err
+	}
+
+	page, err := s.store.QueryAudit(ctx, query)
+	if err != nil {
+		return AuditPage{}, storeError(err)
+	}
+	return page, nil
+}
+
+// audit registra una operación ya aplicada. Usa un contexto sin cancelación para que una
+// petición abortada tras escribir el enlace no deje la operación sin auditar.
+func (s *Service) audit(ctx context.Context, actor Actor, action string, before, after *Link) error {
+	entry := AuditEntry{Time: time.Now(), Actor: actor, Action: action, Before: before, After: after}
+	if before != nil {
+		entry.ShortCode = before.Key()
+	} else if after != nil {
+		entry.ShortCode = after.Key()
+	}
+	if _, err := s.store.AppendAudit(context.WithoutCancel(ctx), entry); err != nil {
+		return storeError(err)
+	}
+	return nil
+}
+
+// AppendAudit agrega la entrada al log asignándole el siguiente ID
+func (s *Store) AppendAudit(ctx context.Context, entry AuditEntry) (AuditEntry, error) {
+	if err := ctx.Err(); err != nil {
+		return AuditEntry{}, err
+	}
+	s.auditMu.Lock()
+	defer s.auditMu.Unlock()
+	s.auditSeq++
+	entry.ID = s.auditSeq
+	s.audit = append(s.audit, entry)
+	return entry, nil
+}
+
+// QueryAudit retorna la página de entradas que cumple la consulta, de la más reciente a la
+// más antigua
+func (s *Store) QueryAudit(ctx context.Context, query AuditQuery) (AuditPage, error) {
+	if err := ctx.Err(); err != nil {
+		return AuditPage{}, err
+	}
+	s.auditMu.RLock()
+	defer s.auditMu.RUnlock()
+
+	page := AuditPage{Entries: make([]AuditEntry, 0)}
+	for i := len(s.audit) - 1; i >= 0; i-- {
+		if !query.matches(s.audit[i]) {
+			continue
+		}
+		if page.Total >= query.Offset && len(page.Entries) < query.Limit {
+			page.Entries = append(page.Entries, s.audit[i])
+		}
+		page.Total++
+	}
+	return page, nil
+}
+
+// PurgeAudit elimina las entradas atribuibles al usuario y retorna cuántas eran. Las demás
+// conservan su ID.
+func (s *Store) PurgeAudit(ctx context.Context, user string) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	s.auditMu.Lock()
+	defer s.auditMu.Unlock()
+	kept := make([]AuditEntry, 0, len(s.audit))
+	for _, entry := range s.audit {
+		if !entry.attributableTo(user) {
+			kept = append(kept, entry)
+		}
+	}
+	purged := len(s.audit) - len(kept)
+	s.audit = kept
+	return purged, nil
+}
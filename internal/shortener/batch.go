@@ -0,0 +1,136 @@
+package shortener
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// LinkChanges son los cambios que BatchUpdate aplica a cada enlace; los campos nil no cambian
+type LinkChanges struct {
+	// Tags reemplaza las etiquetas; una lista vacía las elimina
+	Tags *[]string
+	// Expiry renueva la expiración como ExtendExpiry
+	Expiry *Extension
+	// RedirectType cambia el tipo de redirección. Volver a RedirectTemporary no retira las
+	// redirecciones permanentes que navegadores y proxies ya guardaron.
+	RedirectType *string
+}
+
+// IsZero indica si no hay ningún cambio que aplicar
+func (c LinkChanges) IsZero() bool {
+	return c.Tags == nil && c.Expiry == nil && c.RedirectType == nil
+}
+
+// validate comprueba los cambios antes de aplicarlos a ningún enlace
+func (c LinkChanges) validate(now time.Time) error {
+	if c.IsZero() {
+		return &ValidationError{Field: "changes", Msg: "se debe indicar al menos un cambio: tags, expiración o redirect_type"}
+	}
+	var errs []error
+	if c.Tags != nil {
+		if err := validateTags(*c.Tags); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if c.Expiry != nil {
+		if err := c.Expiry.validate(now); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if c.RedirectType != nil {
+		if err := validateRedirectType(*c.RedirectType); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// apply retorna el enlace con los cambios aplicados, o un error si el enlace no los admite
+func (c LinkChanges) apply(link Link, now time.Time) (Link, error) {
+	if c.RedirectType != nil {
+		redirectType := normalizeRedirectType(*c.RedirectType)
+		// Igual que al crearlo: la redirección guardada en caché no volvería a comprobar la visita
+		if redirectType == RedirectPermanent && (!link.Cloak.IsZero() || !link.Referrers.IsZero() || !link.IPAccess.IsZero() || link.Signed) {
+			return Link{}, &ValidationError{Field: "redirect_type", Value: redirectType,
+				Msg: "no se puede combinar con cloak, referrers, ip_access ni signed"}
+		}
+		link.RedirectType = redirectType
+	}
+	if c.Tags != nil {
+		link.Tags = normalizeTags(*c.Tags)
+	}
+	if c.Expiry != nil {
+		link.ExpiresAt = c.Expiry.expiry(link.ExpiresAt, now)
+	}
+	link.UpdatedAt = now
+	return link, nil
+}
+
+// BatchUpdate aplica los mismos cambios a varios enlaces, p. ej. para renovar o etiquetar una
+// campaña. Cada enlace recibe todos los cambios o ninguno; links y errs tienen un elemento por
+// código, con el enlace actualizado o el error que lo impidió. err solo informa de cambios
+// inválidos, que no se aplican a ningún enlace.
+func (s *Service) BatchUpdate(ctx context.Context, actor Actor, shortCodes []string, changes LinkChanges) (links []Link, errs []error, err error) {
+	now := time.Now()
+	if err := changes.validate(now); err != nil {
+		return nil, nil, err
+	}
+
+	links = make([]Link, len(shortCodes))
+	errs = make([]error, len(shortCodes))
+	for i, code := range shortCodes {
+		if errs[i] = repeatedCode(shortCodes[:i], code); errs[i] != nil {
+			continue
+		}
+		links[i], errs[i] = s.updateLink(ctx, actor, code, changes, now)
+	}
+	return links, errs, nil
+}
+
+// updateLink aplica los cambios de BatchUpdate a un enlace con una sola escritura y una entrada
+// de auditoría
+func (s *Service) updateLink(ctx context.Context, actor Actor, shortCode string, changes LinkChanges, now time.Time) (Link, error) {
+	link, err := s.GetLink(ctx, shortCode)
+	if err != nil {
+		return Link{}, err
+	}
+	if !actor.canManage(link) {
+		return Link{}, ErrForbidden
+	}
+
+	updated, err := changes.apply(link, now)
+	if err != nil {
+		return Link{}, err
+	}
+	if err := s.store.SaveLink(ctx, updated); err != nil {
+		return Link{}, storeError(err)
+	}
+	if err := s.audit(ctx, actor, AuditUpdate, &link, &updated); err != nil {
+		return Link{}, err
+	}
+	return updated, nil
+}
+
+// BatchDelete elimina varios enlaces como DeleteURL: los propietarios los desactivan y los
+// administradores los eliminan definitivamente. errs tiene un elemento por código, nil si se
+// eliminó.
+func (s *Service) BatchDelete(ctx context.Context, actor Actor, shortCodes []string) (errs []error) {
+	errs = make([]error, len(shortCodes))
+	for i, code := range shortCodes {
+		if errs[i] = repeatedCode(shortCodes[:i], code); errs[i] != nil {
+			continue
+		}
+		errs[i] = s.DeleteURL(ctx, actor, code)
+	}
+	return errs
+}
+
+// repeatedCode rechaza un código que ya apareció antes en el lote, para que una renovación por
+// plazo no se sume dos veces
+func repeatedCode(previous []string, code string) error {
+	if containsString(previous, code) {
+		return &ValidationError{Field: "short_codes", Value: code, Msg: "está repetido en el lote"}
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package shortener
+
+import (
+	"context"
+	"hash/fnv"
+	"math"
+	"sync/atomic"
+)
+
+// DefaultBloomFalsePositiveRate es la tasa de falsos positivos por defecto del filtro de códigos
+const DefaultBloomFalsePositiveRate = 0.01
+
+// BloomFilter es un filtro de Bloom de códigos cortos: MayContain nunca da falso para un código
+// agregado con Add y solo da verdadero para uno no agregado con la probabilidad configurada.
+// Admite lecturas y escrituras concurrentes sin locks.
+type BloomFilter struct {
+	bits   []atomic.Uint64
+	m      uint64 // número de bits
+	hashes uint64 // número de funciones hash
+}
+
+// NewBloomFilter dimensiona un filtro para expected códigos con la tasa de falsos positivos
+// indicada. Con más códigos sigue siendo correcto, pero los falsos positivos aumentan.
+func NewBloomFilter(expected int, falsePositiveRate float64) *BloomFilter {
+	if expected < 1 {
+		expected = 1
+	}
+	if falsePositiveRate <= 0 || falsePositiveRate >= 1 {
+		falsePositiveRate = DefaultBloomFalsePositiveRate
+	}
+	n := float64(expected)
+	m := math.Ceil(-n * math.Log(falsePositiveRate) / (math.Ln2 * math.Ln2))
+	k := math.Max(1, math.Round(m/n*math.Ln2))
+
+	words := (uint64(m) + 63) / 64
+	return &BloomFilter{bits: make([]atomic.Uint64, words), m: words * 64, hashes: uint64(k)}
+}
+
+// Add agrega el código al filtro
+func (f *BloomFilter) Add(shortCode string) {
+	h1, h2 := bloomHashes(shortCode)
+	for i := uint64(0); i < f.hashes; i++ {
+		bit := (h1 + i*h2) % f.m
+		word, mask := &f.bits[bit/64], uint64(1)<<(bit%64)
+		for {
+			old := word.Load()
+			if old&mask != 0 || word.CompareAndSwap(old, old|mask) {
+				break
+			}
+		}
+	}
+}
+
+// MayContain indica si el código pudo agregarse al filtro; false asegura que no
+func (f *BloomFilter) MayContain(shortCode string) bool {
+	h1, h2 := bloomHashes(shortCode)
+	for i := uint64(0); i < f.hashes; i++ {
+		bit := (h1 + i*h2) % f.m
+		if f.bits[bit/64].Load()&(uint64(1)<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// bloomHashes deriva los dos hashes del doble hashing de Kirsch-Mitzenmacher
+func bloomHashes(shortCode string) (uint64, uint64) {
+	h := fnv.New64a()
+	h.Write([]byte(shortCode))
+	sum := h.Sum64()
+	// h2 impar para que recorra posiciones distintas en cada función
+	return sum, (sum>>32 | sum<<32) | 1
+}
+
+// WithBloomFilter mantiene un filtro de Bloom de los códigos existentes para que la generación
+// de códigos consulte al almacén solo cuando el filtro da un posible acierto. El filtro se llena
+// con LoadBloomFilter y no se usa hasta entonces. Solo conoce los códigos creados por este
+// servicio: con varias instancias sobre un mismo almacén no debe activarse.
+func WithBloomFilter(expected int, falsePositiveRate float64) ServiceOption {
+	return func(s *Service) {
+		s.bloom = NewBloomFilter(expected, falsePositiveRate)
+	}
+}
+
+// LoadBloomFilter agrega al filtro de Bloom todos los códigos del almacén y lo activa. Los
+// códigos creados mientras tanto se agregan igualmente, así que puede llamarse con el
+// servicio en marcha. Retorna el número de códigos leídos.
+func (s *Service) LoadBloomFilter(ctx context.Context) (int, error) {
+	if s.bloom == nil {
+		return 0, nil
+	}
+	loaded := 0
+	err := s.store.Each(ctx, func(link Link) error {
+		s.bloom.Add(link.Key())
+		loaded++
+		return nil
+	})
+	if err != nil {
+		return 0, storeError(err)
+	}
+	s.bloomReady.Store(true)
+	return loaded, nil
+}
+
+// codeMayExist indica si hace falta consultar al almacén por el código; sin filtro activo
+// siempre hace falta
+func (s *Service) codeMayExist(shortCode string) bool {
+	return s.bloom == nil || !s.bloomReady.Load() || s.bloom.MayContain(shortCode)
+}
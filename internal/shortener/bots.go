@@ -0,0 +1,64 @@
+package shortener
+
+import "strings"
+
+// KnownCrawlers son fragmentos, en minúsculas, del User-Agent de rastreadores conocidos:
+// buscadores, redes sociales y mensajería que generan vistas previas de los enlaces, servicios
+// de monitorización y clientes HTTP de línea de comandos o de librerías
+var KnownCrawlers = []string{
+	"googlebot", "google-inspectiontool", "bingbot", "yandex", "baiduspider", "duckduckbot", "slurp",
+	"applebot", "petalbot", "seznambot", "sogou", "exabot",
+	"facebookexternalhit", "facebot", "twitterbot", "linkedinbot", "slackbot", "discordbot",
+	"telegrambot", "whatsapp", "skypeuripreview", "pinterest", "redditbot", "embedly", "vkshare",
+	"ahrefsbot", "semrushbot", "mj12bot", "dotbot", "gptbot", "ccbot", "claudebot", "bytespider",
+	"uptimerobot", "pingdom", "statuscake", "site24x7", "lighthouse", "headlesschrome", "phantomjs",
+	"curl/", "wget/", "httpie/", "python-requests", "python-urllib", "aiohttp", "go-http-client",
+	"java/", "okhttp", "apache-httpclient", "axios/", "node-fetch", "undici", "libwww-perl",
+}
+
+// botMarkers delatan a rastreadores que no están en la lista: casi todos se identifican con
+// alguna de estas palabras o con la URL de su documentación
+var botMarkers = []string{"bot", "crawl", "spider", "scrape", "http://", "https://"}
+
+// WithBotPatterns agrega fragmentos de User-Agent (p. ej. el del monitor propio) a los que
+// identifican bots, además de KnownCrawlers
+func WithBotPatterns(patterns []string) ServiceOption {
+	return func(s *Service) {
+		for _, pattern := range patterns {
+			if pattern = strings.ToLower(strings.TrimSpace(pattern)); pattern != "" {
+				s.botPatterns = append(s.botPatterns, pattern)
+			}
+		}
+	}
+}
+
+// WithBotExclusion hace que las visitas de bots no consuman la cuota de redirecciones de las
+// claves de API ni participen en las pruebas A/B: reciben el destino por defecto y no suman
+// clics a ninguna variante. Se siguen contabilizando como visitas de bots.
+func WithBotExclusion(enabled bool) ServiceOption {
+	return func(s *Service) {
+		s.excludeBots = enabled
+	}
+}
+
+// IsBot clasifica un User-Agent como bot o rastreador. Los User-Agent vacíos también cuentan
+// como bots: los navegadores siempre lo envían.
+func (s *Service) IsBot(userAgent string) bool {
+	ua := strings.ToLower(strings.TrimSpace(userAgent))
+	if ua == "" {
+		return true
+	}
+	for _, patterns := range [][]string{KnownCrawlers, botMarkers, s.botPatterns} {
+		for _, pattern := range patterns {
+			if strings.Contains(ua, pattern) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// HumanClicks son las visitas del enlace que no se clasificaron como bots
+func (l Link) HumanClicks() int64 {
+	return l.Clicks - l.BotClicks
+}
@@ -0,0 +1,111 @@
+package shortener
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultSubscriptionBuffer es el número de eventos que un suscriptor puede tener sin leer antes
+// de que se le descarten
+const DefaultSubscriptionBuffer = 64
+
+// EventFilter selecciona los eventos de una suscripción; los campos vacíos no filtran
+type EventFilter struct {
+	ShortCode string
+	Owner     string
+	Types     []string
+}
+
+// Matches indica si el evento pasa el filtro
+func (f EventFilter) Matches(event Event) bool {
+	if f.ShortCode != "" && event.Link.ShortCode != f.ShortCode {
+		return false
+	}
+	if f.Owner != "" && event.Link.Owner != f.Owner {
+		return false
+	}
+	if len(f.Types) == 0 {
+		return true
+	}
+	for _, eventType := range f.Types {
+		if event.Type == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// subscription es un suscriptor del broker
+type subscription struct {
+	filter EventFilter
+	events chan Event
+}
+
+// EventBroker reparte los eventos de los enlaces entre suscriptores en memoria, como los
+// clientes del stream de eventos. Se registra en el servicio con WithEventListener. Un
+// suscriptor lento no frena al servicio: los eventos que no caben en su buffer se descartan.
+type EventBroker struct {
+	mu   sync.RWMutex
+	subs map[*subscription]struct{}
+
+	dropped atomic.Uint64
+}
+
+// Verificación en compilación de que EventBroker implementa EventListener
+var _ EventListener = (*EventBroker)(nil)
+
+// NewEventBroker crea un broker sin suscriptores
+func NewEventBroker() *EventBroker {
+	return &EventBroker{subs: make(map[*subscription]struct{})}
+}
+
+// HandleEvent entrega el evento a los suscriptores cuyo filtro lo acepta
+func (b *EventBroker) HandleEvent(event Event) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for sub := range b.subs {
+		if !sub.filter.Matches(event) {
+			continue
+		}
+		select {
+		case sub.events <- event:
+		default:
+			b.dropped.Add(1)
+		}
+	}
+}
+
+// Subscribe registra un suscriptor con un buffer de buffer eventos (DefaultSubscriptionBuffer
+// si no es positivo). La función retornada cancela la suscripción y cierra el canal; debe
+// llamarse siempre.
+func (b *EventBroker) Subscribe(filter EventFilter, buffer int) (<-chan Event, func()) {
+	if buffer <= 0 {
+		buffer = DefaultSubscriptionBuffer
+	}
+	sub := &subscription{filter: filter, events: make(chan Event, buffer)}
+	b.mu.Lock()
+	b.subs[sub] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	return sub.events, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subs, sub)
+			b.mu.Unlock()
+			close(sub.events)
+		})
+	}
+}
+
+// Subscribers retorna el número de suscriptores activos
+func (b *EventBroker) Subscribers() int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return len(b.subs)
+}
+
+// Dropped retorna el número de eventos descartados por suscriptores lentos
+func (b *EventBroker) Dropped() uint64 {
+	return b.dropped.Load()
+}
@@ -0,0 +1,26 @@
+package shortener
+
+import "strings"
+
+// LowercaseChars es el alfabeto por defecto de los códigos cuando no distinguen mayúsculas
+const LowercaseChars = "abcdefghijklmnopqrstuvwxyz0123456789"
+
+// WithCaseInsensitiveCodes hace que los códigos no distingan mayúsculas de minúsculas: los
+// alias y los códigos generados se guardan en minúsculas y las búsquedas convierten el código
+// pedido, de modo que /Promo y /PROMO llevan al enlace promo. Conviene combinarlo con un
+// alfabeto sin mayúsculas (LowercaseChars) para no desperdiciar el espacio de códigos.
+func WithCaseInsensitiveCodes(enabled bool) ServiceOption {
+	return func(s *Service) {
+		s.caseInsensitive = enabled
+	}
+}
+
+// foldCode retorna la clave con la que se guarda y se busca un código: en minúsculas si los
+// códigos no distinguen mayúsculas y sin cambios si no. Los tenants y los dominios de la
+// clave ya están en minúsculas.
+func (s *Service) foldCode(code string) string {
+	if !s.caseInsensitive {
+		return code
+	}
+	return strings.ToLower(code)
+}
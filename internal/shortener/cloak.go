@@ -0,0 +1,91 @@
+package shortener
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Modos de enmascaramiento de un enlace (Cloak.Mode)
+const (
+	// CloakRefresh sirve una página con las etiquetas Open Graph configuradas que redirige con
+	// meta refresh: las redes sociales muestran la vista previa del enlace corto, pero la barra
+	// de direcciones termina en el destino
+	CloakRefresh = "refresh"
+	// CloakFrame sirve el destino dentro de un iframe a pantalla completa, de modo que la barra
+	// de direcciones conserva la URL corta. No funciona con destinos que prohíben ser
+	// enmarcados (X-Frame-Options o CSP frame-ancestors).
+	CloakFrame = "frame"
+)
+
+// MaxCloakTextLength acota el título y la descripción de la página de enmascaramiento
+const MaxCloakTextLength = 300
+
+// Cloak configura la página HTML que se sirve en lugar de la redirección HTTP. Title,
+// Description e Image son las etiquetas de la página; vacías se toman de los metadatos del
+// destino (Link.Metadata).
+type Cloak struct {
+	Mode        string
+	Title       string
+	Description string
+	// Image es la URL absoluta de og:image
+	Image string
+}
+
+// IsZero indica si el enlace redirige sin enmascaramiento
+func (c Cloak) IsZero() bool {
+	return c == Cloak{}
+}
+
+// normalize recorta los espacios de los textos
+func (c Cloak) normalize() Cloak {
+	c.Title = strings.TrimSpace(c.Title)
+	c.Description = strings.TrimSpace(c.Description)
+	c.Image = strings.TrimSpace(c.Image)
+	return c
+}
+
+// validate comprueba el modo, la longitud de los textos y la imagen. Las etiquetas sin modo no
+// tienen efecto y se rechazan.
+func (c Cloak) validate() error {
+	if c.IsZero() {
+		return nil
+	}
+	var errs []error
+	if c.Mode != CloakRefresh && c.Mode != CloakFrame {
+		errs = append(errs, &ValidationError{Field: "cloak.mode", Value: c.Mode,
+			Msg: fmt.Sprintf("debe ser %s o %s", CloakRefresh, CloakFrame)})
+	}
+	for _, field := range [][2]string{{"cloak.title", c.Title}, {"cloak.description", c.Description}} {
+		if len(field[1]) > MaxCloakTextLength {
+			errs = append(errs, &ValidationError{Field: field[0], Value: field[1],
+				Msg: fmt.Sprintf("no puede superar %d caracteres", MaxCloakTextLength)})
+		}
+	}
+	if c.Image != "" {
+		if parsed, err := url.Parse(c.Image); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			errs = append(errs, &ValidationError{Field: "cloak.image", Value: c.Image, Msg: "debe ser una URL http o https absoluta"})
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// pageCloak retorna el enmascaramiento del enlace con las etiquetas vacías completadas con los
+// metadatos del destino
+func (l Link) pageCloak() Cloak {
+	cloak := l.Cloak
+	if cloak.IsZero() {
+		return cloak
+	}
+	if cloak.Title == "" {
+		cloak.Title = l.Metadata.Title
+	}
+	if cloak.Description == "" {
+		cloak.Description = l.Metadata.Description
+	}
+	if cloak.Image == "" {
+		cloak.Image = l.Metadata.Image
+	}
+	return cloak
+}
@@ -0,0 +1,331 @@
+package shortener
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"acortador-urls/internal/errcode"
+)
+
+// MaxCollectionNameLength acota la longitud del nombre de una colección
+const MaxCollectionNameLength = 100
+
+// Errores de las colecciones
+var (
+	ErrInvalidCollection  = errcode.New(errcode.InvalidCollection, "colección inválida")
+	ErrCollectionNotFound = errcode.New(errcode.CollectionNotFound, "colección no encontrada")
+	ErrCollectionExists   = errcode.New(errcode.CollectionExists, "ya existe una colección con ese nombre")
+)
+
+// Collection es una carpeta con la que un usuario o un espacio compartido organizan sus
+// enlaces. Cada enlace pertenece como mucho a una colección (Link.CollectionID).
+type Collection struct {
+	// ID es correlativo y lo asigna el almacén al crear la colección
+	ID     int64
+	Name   string
+	Tenant string
+	Owner  string
+	// Workspace es el espacio compartido en el que la creó un editor; sus editores la gestionan
+	Workspace string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// CollectionStats es una colección con el número de enlaces y visitas que contiene
+type CollectionStats struct {
+	Collection
+	Links  int
+	Clicks int64
+	// BotClicks son las visitas de bots incluidas en Clicks
+	BotClicks int64
+}
+
+// canManageCollection indica si el actor puede renombrar, eliminar o mover enlaces a la
+// colección; sigue las mismas reglas que canManage con los enlaces
+func (a Actor) canManageCollection(c Collection) bool {
+	return a.canManage(Link{Owner: c.Owner, Workspace: c.Workspace})
+}
+
+// normalizeCollectionName quita los espacios sobrantes del nombre y comprueba su longitud
+func normalizeCollectionName(name string) (string, error) {
+	name = strings.Join(strings.Fields(name), " ")
+	if name == "" || utf8.RuneCountInString(name) > MaxCollectionNameLength {
+		return "", &ValidationError{Field: "name", Value: name, Err: ErrInvalidCollection,
+			Msg: fmt.Sprintf("debe tener entre 1 y %d caracteres", MaxCollectionNameLength)}
+	}
+	return name, nil
+}
+
+// CreateCollection crea una colección del actor en el espacio del tenant. Los nombres no se
+// repiten entre las colecciones del mismo propietario o espacio compartido.
+func (s *Service) CreateCollection(ctx context.Context, actor Actor, tenant, name string) (Collection, error) {
+	name, err := normalizeCollectionName(name)
+	if err != nil {
+		return Collection{}, err
+	}
+
+	now := time.Now()
+	collection, err := s.store.SaveCollection(ctx, Collection{
+		Name:      name,
+		Tenant:    tenant,
+		Owner:     actor.UserID,
+		Workspace: actor.Workspace,
+		CreatedAt: now,
+		UpdatedAt: now,
+	})
+	if err != nil {
+		return Collection{}, collectionStoreError(err)
+	}
+	return collection, nil
+}
+
+// collectionStoreError conserva los errores de las colecciones que retorna el almacén y
+// traduce el resto con storeError
+func collectionStoreError(err error) error {
+	if errors.Is(err, ErrCollectionExists) || errors.Is(err, ErrCollectionNotFound) {
+		return err
+	}
+	return storeError(err)
+}
+
+// GetCollection obtiene una colección del tenant que el actor puede gestionar; las del resto
+// se tratan como inexistentes para no revelar sus nombres
+func (s *Service) GetCollection(ctx context.Context, actor Actor, tenant string, id int64) (Collection, error) {
+	collection, found, err := s.store.GetCollection(ctx, id)
+	if err != nil {
+		return Collection{}, storeError(err)
+	}
+	if !found || collection.Tenant != tenant || !actor.canManageCollection(collection) {
+		return Collection{}, ErrCollectionNotFound
+	}
+	return collection, nil
+}
+
+// RenameCollection cambia el nombre de una colección
+func (s *Service) RenameCollection(ctx context.Context, actor Actor, tenant string, id int64, name string) (Collection, error) {
+	name, err := normalizeCollectionName(name)
+	if err != nil {
+		return Collection{}, err
+	}
+	collection, err := s.GetCollection(ctx, actor, tenant, id)
+	if err != nil {
+		return Collection{}, err
+	}
+
+	collection.Name = name
+	collection.UpdatedAt = time.Now()
+	if collection, err = s.store.SaveCollection(ctx, collection); err != nil {
+		return Collection{}, collectionStoreError(err)
+	}
+	return collection, nil
+}
+
+// DeleteCollection elimina una colección; sus enlaces no se eliminan, solo dejan de
+// pertenecer a ella. Los enlaces se guardan uno a uno con SaveLink para que las cachés y los
+// backends remotos vean el cambio.
+func (s *Service) DeleteCollection(ctx context.Context, actor Actor, tenant string, id int64) error {
+	if _, err := s.GetCollection(ctx, actor, tenant, id); err != nil {
+		return err
+	}
+
+	var members []Link
+	if err := s.EachLink(ctx, func(link Link) error {
+		if link.CollectionID == id && link.Tenant == tenant {
+			members = append(members, link)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	for _, link := range members {
+		link.CollectionID = 0
+		if err := s.store.SaveLink(ctx, link); err != nil {
+			return storeError(err)
+		}
+	}
+	if _, err := s.store.DeleteCollection(ctx, id); err != nil {
+		return storeError(err)
+	}
+	return nil
+}
+
+// ListCollections retorna las colecciones del tenant que el actor puede gestionar, en orden
+// alfabético, con sus enlaces y visitas. Recorre el almacén completo para contarlos.
+func (s *Service) ListCollections(ctx context.Context, actor Actor, tenant string) ([]CollectionStats, error) {
+	collections, err := s.store.ListCollections(ctx, tenant)
+	if err != nil {
+		return nil, storeError(err)
+	}
+	stats := make([]CollectionStats, 0, len(collections))
+	byID := make(map[int64]*CollectionStats, len(collections))
+	for _, collection := range collections {
+		if actor.canManageCollection(collection) {
+			stats = append(stats, CollectionStats{Collection: collection})
+		}
+	}
+	for i := range stats {
+		byID[stats[i].ID] = &stats[i]
+	}
+	if len(byID) == 0 {
+		return stats, nil
+	}
+
+	if err := s.EachLink(ctx, func(link Link) error {
+		if collection, ok := byID[link.CollectionID]; ok && link.Tenant == tenant {
+			collection.Links++
+			collection.Clicks += link.Clicks
+			collection.BotClicks += link.BotClicks
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// MoveLinks mueve los enlaces (por clave) a la colección, aunque estuvieran en otra. errs
+// tiene un error por enlace, nil si se movió; err es un fallo de toda la operación, como una
+// colección inexistente.
+func (s *Service) MoveLinks(ctx context.Context, actor Actor, tenant string, id int64, shortCodes []string) (errs []error, err error) {
+	return s.moveLinks(ctx, actor, tenant, id, shortCodes, false)
+}
+
+// RemoveLinks saca los enlaces (por clave) de la colección; los que estén en otra o en
+// ninguna no cambian. Los errores son los de MoveLinks.
+func (s *Service) RemoveLinks(ctx context.Context, actor Actor, tenant string, id int64, shortCodes []string) (errs []error, err error) {
+	return s.moveLinks(ctx, actor, tenant, id, shortCodes, true)
+}
+
+// moveLinks implementa MoveLinks y RemoveLinks
+func (s *Service) moveLinks(ctx context.Context, actor Actor, tenant string, id int64, shortCodes []string, remove bool) ([]error, error) {
+	if _, err := s.GetCollection(ctx, actor, tenant, id); err != nil {
+		return nil, err
+	}
+
+	errs := make([]error, len(shortCodes))
+	for i, code := range shortCodes {
+		errs[i] = s.moveLink(ctx, actor, tenant, code, id, remove)
+	}
+	return errs, nil
+}
+
+// moveLink mete el enlace en la colección id o, con remove, lo saca de ella, y audita el cambio
+func (s *Service) moveLink(ctx context.Context, actor Actor, tenant, shortCode string, id int64, remove bool) error {
+	link, err := s.GetLink(ctx, shortCode)
+	if err != nil {
+		return err
+	}
+	if link.Tenant != tenant {
+		return ErrURLNotFound
+	}
+	if !actor.canManage(link) {
+		return ErrForbidden
+	}
+	target := id
+	if remove {
+		if link.CollectionID != id {
+			return nil
+		}
+		target = 0
+	}
+	if link.CollectionID == target {
+		return nil
+	}
+
+	before := link
+	link.CollectionID = target
+	link.UpdatedAt = time.Now()
+	if err := s.store.SaveLink(ctx, link); err != nil {
+		return storeError(err)
+	}
+	return s.audit(ctx, actor, AuditUpdate, &before, &link)
+}
+
+// sameCollectionScope indica si dos colecciones comparten el espacio de nombres: el mismo
+// tenant y el mismo propietario o espacio compartido
+func sameCollectionScope(a, b Collection) bool {
+	if a.Tenant != b.Tenant || a.Workspace != b.Workspace {
+		return false
+	}
+	return a.Workspace != "" || a.Owner == b.Owner
+}
+
+// SaveCollection crea la colección si no tiene ID o reemplaza la existente. Retorna
+// ErrCollectionExists si otra colección del mismo ámbito tiene el mismo nombre y
+// ErrCollectionNotFound si el ID no existe.
+func (s *Store) SaveCollection(ctx context.Context, collection Collection) (Collection, error) {
+	if err := ctx.Err(); err != nil {
+		return Collection{}, err
+	}
+	s.collectionsMu.Lock()
+	defer s.collectionsMu.Unlock()
+	if collection.ID != 0 {
+		if _, ok := s.collections[collection.ID]; !ok {
+			return Collection{}, ErrCollectionNotFound
+		}
+	}
+	for _, existing := range s.collections {
+		if existing.ID != collection.ID && sameCollectionScope(existing, collection) &&
+			strings.EqualFold(existing.Name, collection.Name) {
+			return Collection{}, ErrCollectionExists
+		}
+	}
+
+	if collection.ID == 0 {
+		s.collectionSeq++
+		collection.ID = s.collectionSeq
+	}
+	s.collections[collection.ID] = collection
+	return collection, nil
+}
+
+// GetCollection obtiene una colección por su ID
+func (s *Store) GetCollection(ctx context.Context, id int64) (Collection, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return Collection{}, false, err
+	}
+	s.collectionsMu.RLock()
+	defer s.collectionsMu.RUnlock()
+	collection, ok := s.collections[id]
+	return collection, ok, nil
+}
+
+// DeleteCollection elimina la colección y reporta si existía; no modifica sus enlaces
+func (s *Store) DeleteCollection(ctx context.Context, id int64) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	s.collectionsMu.Lock()
+	defer s.collectionsMu.Unlock()
+	_, ok := s.collections[id]
+	delete(s.collections, id)
+	return ok, nil
+}
+
+// ListCollections retorna las colecciones del tenant ordenadas por nombre
+func (s *Store) ListCollections(ctx context.Context, tenant string) ([]Collection, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.collectionsMu.RLock()
+	collections := make([]Collection, 0)
+	for _, collection := range s.collections {
+		if collection.Tenant == tenant {
+			collections = append(collections, collection)
+		}
+	}
+	s.collectionsMu.RUnlock()
+
+	sort.Slice(collections, func(i, j int) bool {
+		if a, b := strings.ToLower(collections[i].Name), strings.ToLower(collections[j].Name); a != b {
+			return a < b
+		}
+		return collections[i].ID < collections[j].ID
+	})
+	return collections, nil
+}
@@ -0,0 +1,107 @@
+package shortener
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"acortador-urls/internal/errcode"
+)
+
+// DefaultRetryWarnAfter es el número de candidatos a partir del cual una generación se
+// considera reintentada en exceso si la política no indica otro
+const DefaultRetryWarnAfter = 3
+
+// ErrCodeSpaceSaturated indica que no se encontró un código libre en MaxRetries intentos: el
+// espacio de códigos está tan ocupado que las colisiones son la norma y hay que ampliarlo
+var ErrCodeSpaceSaturated = errcode.New(errcode.CodeSpaceSaturated, "espacio de códigos saturado")
+
+// RetryPolicy configura los reintentos ante colisiones al generar códigos
+type RetryPolicy struct {
+	// MaxRetries es el máximo de candidatos por creación (MaxRetries si no es positivo)
+	MaxRetries int
+	// WarnAfter es el número de candidatos a partir del cual se avisa con OnWarning; cero usa
+	// DefaultRetryWarnAfter y un valor negativo no avisa
+	WarnAfter int
+	// OnWarning recibe las generaciones que necesitaron más de WarnAfter candidatos, incluidas
+	// las que no encontraron ninguno libre
+	OnWarning func(CollisionWarning)
+}
+
+// CollisionWarning describe una generación de código reintentada en exceso
+type CollisionWarning struct {
+	// Attempts son los candidatos generados
+	Attempts int
+	// Saturated indica que se agotaron los intentos sin encontrar un código libre
+	Saturated bool
+	// Tenant y Domain identifican el espacio de códigos; vacíos en el espacio común
+	Tenant string
+	Domain string
+}
+
+// CollisionStats resume los reintentos de generación de códigos desde el arranque
+type CollisionStats struct {
+	// Generated son los códigos generados con éxito
+	Generated uint64
+	// Retries son los candidatos descartados por colisión o por el filtro de palabras
+	Retries uint64
+	// Warnings son las generaciones que superaron RetryPolicy.WarnAfter
+	Warnings uint64
+	// Saturated son las generaciones que agotaron RetryPolicy.MaxRetries
+	Saturated uint64
+}
+
+// collisionCounters acumula CollisionStats sin bloqueos
+type collisionCounters struct {
+	generated atomic.Uint64
+	retries   atomic.Uint64
+	warnings  atomic.Uint64
+	saturated atomic.Uint64
+}
+
+// WithRetryPolicy reemplaza la política de reintentos ante colisiones
+func WithRetryPolicy(policy RetryPolicy) ServiceOption {
+	return func(s *Service) {
+		if policy.MaxRetries <= 0 {
+			policy.MaxRetries = MaxRetries
+		}
+		if policy.WarnAfter == 0 {
+			policy.WarnAfter = DefaultRetryWarnAfter
+		}
+		s.retry = policy
+	}
+}
+
+// CollisionStats retorna los reintentos de generación de códigos desde el arranque
+func (s *Service) CollisionStats() CollisionStats {
+	return CollisionStats{
+		Generated: s.collisions.generated.Load(),
+		Retries:   s.collisions.retries.Load(),
+		Warnings:  s.collisions.warnings.Load(),
+		Saturated: s.collisions.saturated.Load(),
+	}
+}
+
+// recordGeneration cuenta una generación que necesitó attempts candidatos y avisa si superó
+// el umbral de la política
+func (s *Service) recordGeneration(tenant, domain string, attempts int, saturated bool) {
+	if saturated {
+		s.collisions.saturated.Add(1)
+		s.collisions.retries.Add(uint64(attempts))
+	} else {
+		s.collisions.generated.Add(1)
+		s.collisions.retries.Add(uint64(attempts - 1))
+	}
+	if s.retry.WarnAfter < 0 || (attempts <= s.retry.WarnAfter && !saturated) {
+		return
+	}
+	s.collisions.warnings.Add(1)
+	if s.retry.OnWarning != nil {
+		s.retry.OnWarning(CollisionWarning{Attempts: attempts, Saturated: saturated, Tenant: tenant, Domain: domain})
+	}
+}
+
+// saturationError es el error de una generación sin código libre; errors.Is lo reconoce como
+// ErrCodeSpaceSaturated y como ErrMaxRetries
+func saturationError(attempts int) error {
+	return fmt.Errorf("%w: %w tras %d intentos", ErrCodeSpaceSaturated, ErrMaxRetries, attempts)
+}
@@ -0,0 +1,243 @@
+package shortener
+
+import (
+	"context"
+	"time"
+	"unsafe"
+
+	"acortador-urls/internal/errcode"
+)
+
+// ErrCompactionUnsupported indica que el almacén no estima su memoria ni se puede compactar,
+// como los backends SQL
+var ErrCompactionUnsupported = errcode.New(errcode.CompactionUnsupported, "el almacén no admite compactación")
+
+// Tamaños aproximados de las estructuras de Go en 64 bits para estimar la memoria del almacén
+const (
+	stringHeaderSize = 16
+	mapHeaderSize    = 48
+	// mapEntryOverhead es el tophash y el relleno de cada entrada en los buckets de un mapa
+	mapEntryOverhead = 8
+)
+
+// linkSlotSize es lo que ocupa en los mapas del almacén cada enlace, con o sin enlace: la
+// entrada de urls y la del índice inverso. Los mapas de Go no liberan sus buckets al borrar.
+var linkSlotSize = int64(stringHeaderSize+unsafe.Sizeof(Link{})+mapEntryOverhead) + 2*stringHeaderSize + mapEntryOverhead
+
+// MemoryUsage es la estimación de la memoria que ocupa el almacén en memoria. Es aproximada:
+// cuenta los enlaces, sus índices y los huecos que dejan los borrados en los mapas, pero no la
+// fragmentación del heap ni las copias que aún retienen los lectores.
+type MemoryUsage struct {
+	Bytes int64
+	// ReclaimableBytes es la parte de Bytes que ocupan los huecos de los enlaces borrados y que
+	// Compact libera
+	ReclaimableBytes int64
+	Links            int
+	// PeakLinks es el máximo de enlaces desde la última compactación, que es el tamaño que
+	// conservan los mapas
+	PeakLinks int
+	// CompactedAt es la última compactación; cero si no hubo ninguna desde el arranque
+	CompactedAt time.Time
+}
+
+// Reclaimable es la fracción de los huecos de los mapas que ocupaban enlaces ya borrados
+func (u MemoryUsage) Reclaimable() float64 {
+	if u.PeakLinks == 0 {
+		return 0
+	}
+	return float64(u.PeakLinks-u.Links) / float64(u.PeakLinks)
+}
+
+// CompactionResult es la memoria estimada antes y después de una compactación
+type CompactionResult struct {
+	Before   MemoryUsage
+	After    MemoryUsage
+	Duration time.Duration
+}
+
+// Compactor lo implementan los almacenes que estiman su memoria y pueden reconstruir sus mapas
+// tras muchos borrados. ok es false en los que envuelven a un almacén que no lo admite.
+type Compactor interface {
+	MemoryUsage() (usage MemoryUsage, ok bool)
+	Compact(ctx context.Context) (CompactionResult, error)
+}
+
+// MemoryUsage implementa Compactor sin recorrer los enlaces: la estimación se actualiza con
+// cada escritura
+func (s *Store) MemoryUsage() (MemoryUsage, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.memoryUsageLocked(), true
+}
+
+// memoryUsageLocked calcula la estimación; requiere al menos el lock de lectura
+func (s *Store) memoryUsageLocked() MemoryUsage {
+	reclaimable := int64(s.peakLinks-len(s.urls)) * linkSlotSize
+	return MemoryUsage{
+		Bytes:            s.memory + reclaimable + 8*mapHeaderSize,
+		ReclaimableBytes: reclaimable,
+		Links:            len(s.urls),
+		PeakLinks:        s.peakLinks,
+		CompactedAt:      s.compactedAt,
+	}
+}
+
+// Compact reconstruye los mapas del almacén con el tamaño justo para liberar los huecos de los
+// enlaces borrados o expulsados, y recalcula la estimación de memoria. Bloquea las escrituras y
+// las lecturas mientras copia, así que conviene ejecutarlo con poco tráfico o con
+// CompactIfNeeded.
+func (s *Store) Compact(ctx context.Context) (CompactionResult, error) {
+	if err := ctx.Err(); err != nil {
+		return CompactionResult{}, err
+	}
+	start := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	before := s.memoryUsageLocked()
+
+	urls := make(map[string]Link, len(s.urls))
+	s.memory = 0
+	for key, link := range s.urls {
+		urls[key] = link
+		s.memory += linkBytes(link)
+	}
+	s.urls = urls
+	s.byURL = copyMap(s.byURL)
+	s.byClient = copyMap(s.byClient)
+	s.byTenant = copyMap(s.byTenant)
+	s.usage = copyMap(s.usage)
+	s.trigrams = trigramIndex(copyPostings(s.trigrams))
+	s.tags = tagIndex(copyPostings(s.tags))
+
+	s.idempotencyMu.Lock()
+	s.idempotency = copyMap(s.idempotency)
+	s.idempotencyMu.Unlock()
+
+	s.peakLinks = len(s.urls)
+	s.compactedAt = time.Now()
+	return CompactionResult{Before: before, After: s.memoryUsageLocked(), Duration: time.Since(start)}, nil
+}
+
+// copyMap copia un mapa en uno nuevo del tamaño justo
+func copyMap[K comparable, V any](m map[K]V) map[K]V {
+	copied := make(map[K]V, len(m))
+	for key, value := range m {
+		copied[key] = value
+	}
+	return copied
+}
+
+// copyPostings copia un índice invertido junto con sus listas de claves
+func copyPostings(index map[string]map[string]struct{}) map[string]map[string]struct{} {
+	copied := make(map[string]map[string]struct{}, len(index))
+	for term, keys := range index {
+		copied[term] = copyMap(keys)
+	}
+	return copied
+}
+
+// trackLocked actualiza la estimación de memoria al reemplazar previous por link; un Link vacío
+// es la ausencia de enlace. Requiere el lock de escritura.
+func (s *Store) trackLocked(previous, link Link) {
+	if previous.ShortCode != "" {
+		s.memory -= linkBytes(previous)
+	}
+	if link.ShortCode != "" {
+		s.memory += linkBytes(link)
+	}
+	if len(s.urls) > s.peakLinks {
+		s.peakLinks = len(s.urls)
+	}
+}
+
+// linkBytes estima la memoria de un enlace y de sus entradas en los índices del almacén. Los
+// trigramas se aproximan por la longitud de los textos de búsqueda, su máximo.
+func linkBytes(link Link) int64 {
+	key := int64(len(link.Key()))
+	size := int64(unsafe.Sizeof(link)) + stringHeaderSize + key + mapEntryOverhead
+	size += stringBytes(link.ShortCode, link.LongURL, link.Owner, link.Domain, link.Tenant, link.Workspace,
+		link.Client, link.APIKeyID, link.PasswordHash, link.RedirectType, link.DisabledReason, link.Description, link.PendingTransfer,
+		link.UTM.Source, link.UTM.Medium, link.UTM.Campaign,
+		link.Cloak.Mode, link.Cloak.Title, link.Cloak.Description, link.Cloak.Image, link.Referrers.Fallback,
+		link.Health.Error, link.Metadata.Title, link.Metadata.Description, link.Metadata.Image, link.Metadata.Error)
+	size += int64(len(link.Visitors) + len(link.CustomMetadata))
+	size += targetBytes(link.GeoTargets) + targetBytes(link.DeviceTargets)
+	size += stringSliceBytes(link.Tags) + stringSliceBytes(link.Referrers.Domains)
+	size += stringSliceBytes(link.IPAccess.Allow) + stringSliceBytes(link.IPAccess.Deny)
+	for _, variant := range link.Variants {
+		size += int64(unsafe.Sizeof(variant)) + stringBytes(variant.Name, variant.URL)
+	}
+
+	// Índice inverso, trigramas y etiquetas
+	size += 2*stringHeaderSize + int64(len(link.Owner)+len(link.LongURL)) + key + mapEntryOverhead
+	for _, text := range link.searchTexts() {
+		size += int64(len(text)) * (stringHeaderSize + key + mapEntryOverhead)
+	}
+	size += int64(len(link.Tags)) * (stringHeaderSize + key + mapEntryOverhead)
+	return size
+}
+
+// stringBytes suma la longitud de los textos; las cabeceras ya cuentan en el tamaño del struct
+func stringBytes(values ...string) int64 {
+	var size int64
+	for _, value := range values {
+		size += int64(len(value))
+	}
+	return size
+}
+
+// stringSliceBytes estima la memoria del arreglo de una lista de textos
+func stringSliceBytes(values []string) int64 {
+	return int64(len(values))*stringHeaderSize + stringBytes(values...)
+}
+
+// targetBytes estima la memoria de un mapa de destinos por país o dispositivo
+func targetBytes(targets map[string]string) int64 {
+	if targets == nil {
+		return 0
+	}
+	size := int64(mapHeaderSize)
+	for key, value := range targets {
+		size += 2*stringHeaderSize + int64(len(key)+len(value)) + mapEntryOverhead
+	}
+	return size
+}
+
+// StoreMemory retorna la estimación de memoria del almacén; ok es false si no la informa
+func (s *Service) StoreMemory() (usage MemoryUsage, ok bool) {
+	if compactor, isCompactor := s.store.(Compactor); isCompactor {
+		return compactor.MemoryUsage()
+	}
+	return MemoryUsage{}, false
+}
+
+// CompactStore compacta el almacén; solo los administradores pueden pedirlo
+func (s *Service) CompactStore(ctx context.Context, actor Actor) (CompactionResult, error) {
+	if !actor.Admin {
+		return CompactionResult{}, ErrForbidden
+	}
+	return s.compactStore(ctx)
+}
+
+// CompactIfNeeded compacta el almacén si al menos la fracción threshold de los huecos de sus
+// mapas es de enlaces borrados; compacted es false si no hizo falta o no se admite
+func (s *Service) CompactIfNeeded(ctx context.Context, threshold float64) (result CompactionResult, compacted bool, err error) {
+	usage, ok := s.StoreMemory()
+	if !ok || usage.PeakLinks == usage.Links || usage.Reclaimable() < threshold {
+		return CompactionResult{}, false, nil
+	}
+	result, err = s.compactStore(ctx)
+	return result, err == nil, err
+}
+
+// compactStore compacta el almacén si lo admite
+func (s *Service) compactStore(ctx context.Context) (CompactionResult, error) {
+	if _, ok := s.StoreMemory(); !ok {
+		return CompactionResult{}, ErrCompactionUnsupported
+	}
+	result, err := s.store.(Compactor).Compact(ctx)
+	if err != nil {
+		return CompactionResult{}, storeError(err)
+	}
+	return result, nil
+}
@@ -0,0 +1,152 @@
+package shortener
+
+import (
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"acortador-urls/internal/errcode"
+)
+
+// Errores de los dominios personalizados
+var (
+	ErrInvalidDomain = errcode.New(errcode.InvalidDomain, "dominio personalizado inválido")
+	ErrDomainTaken   = errcode.New(errcode.DomainTaken, "el dominio ya está asignado a otro propietario")
+	ErrDomainUnknown = errcode.New(errcode.DomainNotFound, "dominio personalizado no registrado")
+)
+
+// hostnamePattern valida un nombre de host con al menos dos etiquetas (p. ej. go.acme.com)
+var hostnamePattern = regexp.MustCompile(`^([a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?\.)+[a-z]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+// LinkKey construye la clave de almacenamiento de un código: el propio código en el dominio
+// principal y "dominio/código" en un dominio personalizado. Los códigos no admiten '/', así
+// que las claves de dominios distintos nunca coinciden.
+func LinkKey(domain, shortCode string) string {
+	if domain == "" {
+		return shortCode
+	}
+	return domain + "/" + shortCode
+}
+
+// DomainLinkKey es LinkKey para un dominio escrito por el cliente (p. ej. el parámetro domain de
+// la API): lo normaliza igual que al crear y redirigir, con Punycode y sin puerto
+func DomainLinkKey(domain, shortCode string) string {
+	return LinkKey(normalizeHost(domain), shortCode)
+}
+
+// CustomDomain es un nombre de host adicional que sirve los enlaces de un propietario
+type CustomDomain struct {
+	Host  string
+	Owner string
+}
+
+// customDomains es el registro de dominios personalizados (host -> propietario)
+type customDomains struct {
+	mu     sync.RWMutex
+	owners map[string]string
+}
+
+// WithCustomDomains registra dominios personalizados al crear el servicio (host -> propietario).
+// Los hosts inválidos se ignoran; config.Validate los rechaza antes de llegar aquí.
+func WithCustomDomains(domains map[string]string) ServiceOption {
+	return func(s *Service) {
+		for host, owner := range domains {
+			s.RegisterDomain(host, owner)
+		}
+	}
+}
+
+// normalizeHost pasa el host a minúsculas, quita el puerto y el punto final y convierte a
+// Punycode los dominios internacionalizados
+func normalizeHost(host string) string {
+	host = strings.ToLower(strings.TrimSpace(host))
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return toASCIIHost(strings.TrimSuffix(host, "."))
+}
+
+// RegisterDomain asigna un host al propietario. Volver a registrarlo para el mismo propietario
+// no tiene efecto; si pertenece a otro retorna ErrDomainTaken.
+func (s *Service) RegisterDomain(host, owner string) (CustomDomain, error) {
+	host = normalizeHost(host)
+	if !hostnamePattern.MatchString(host) || len(host) > 253 {
+		return CustomDomain{}, &ValidationError{Field: "host", Value: host, Err: ErrInvalidDomain,
+			Msg: "debe ser un nombre de host como go.example.com"}
+	}
+	if strings.TrimSpace(owner) == "" {
+		return CustomDomain{}, &ValidationError{Field: "owner", Value: owner, Err: ErrInvalidDomain,
+			Msg: "no puede estar vacío"}
+	}
+
+	s.domains.mu.Lock()
+	defer s.domains.mu.Unlock()
+	if current, ok := s.domains.owners[host]; ok && current != owner {
+		return CustomDomain{}, ErrDomainTaken
+	}
+	if s.domains.owners == nil {
+		s.domains.owners = make(map[string]string)
+	}
+	s.domains.owners[host] = owner
+	return CustomDomain{Host: host, Owner: owner}, nil
+}
+
+// RemoveDomain elimina un dominio del registro. Sus enlaces se conservan pero dejan de
+// redirigir hasta que el dominio se vuelva a registrar.
+func (s *Service) RemoveDomain(host string) error {
+	host = normalizeHost(host)
+	s.domains.mu.Lock()
+	defer s.domains.mu.Unlock()
+	if _, ok := s.domains.owners[host]; !ok {
+		return ErrDomainUnknown
+	}
+	delete(s.domains.owners, host)
+	return nil
+}
+
+// CustomDomains retorna los dominios registrados ordenados por host
+func (s *Service) CustomDomains() []CustomDomain {
+	s.domains.mu.RLock()
+	domains := make([]CustomDomain, 0, len(s.domains.owners))
+	for host, owner := range s.domains.owners {
+		domains = append(domains, CustomDomain{Host: host, Owner: owner})
+	}
+	s.domains.mu.RUnlock()
+
+	sort.Slice(domains, func(i, j int) bool {
+		return domains[i].Host < domains[j].Host
+	})
+	return domains
+}
+
+// ScopeCode retorna la clave del código pedido a través de host (la cabecera Host, con o sin
+// puerto): la de su espacio si es un dominio personalizado y el propio código si no
+func (s *Service) ScopeCode(host, shortCode string) string {
+	host = normalizeHost(host)
+	s.domains.mu.RLock()
+	_, custom := s.domains.owners[host]
+	s.domains.mu.RUnlock()
+	if !custom {
+		return shortCode
+	}
+	return LinkKey(host, shortCode)
+}
+
+// ownerDomain retorna el dominio en el que se crean los enlaces del propietario: el primero en
+// orden alfabético de los suyos, o vacío si no tiene ninguno
+func (s *Service) ownerDomain(owner string) string {
+	if owner == "" {
+		return ""
+	}
+	s.domains.mu.RLock()
+	defer s.domains.mu.RUnlock()
+	domain := ""
+	for host, current := range s.domains.owners {
+		if current == owner && (domain == "" || host < domain) {
+			domain = host
+		}
+	}
+	return domain
+}
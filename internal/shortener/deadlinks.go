@@ -0,0 +1,106 @@
+package shortener
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// deadLinkScanWorkers es el número de destinos que ScanLinks comprueba a la vez
+const deadLinkScanWorkers = 4
+
+// LinkScanResult resume una pasada del escáner de enlaces rotos
+type LinkScanResult struct {
+	// Checked es el número de destinos comprobados
+	Checked int
+	// Broken es el número de enlaces marcados como rotos tras la pasada
+	Broken int
+	// Recovered es el número de enlaces rotos que volvieron a responder
+	Recovered int
+}
+
+// WithDeadLinkScanner configura el escáner de enlaces rotos: prober comprueba los destinos y
+// brokenAfter es el número de comprobaciones seguidas con error 4xx/5xx o sin respuesta a partir
+// del cual un destino se marca como roto. Un único fallo puntual no basta si brokenAfter es
+// mayor que uno. La misma regla se aplica a la verificación en segundo plano.
+func WithDeadLinkScanner(prober Prober, brokenAfter int) ServiceOption {
+	return func(s *Service) {
+		s.prober = prober
+		if brokenAfter > 0 {
+			s.brokenAfter = brokenAfter
+		}
+	}
+}
+
+// ScanLinks vuelve a comprobar los destinos de todos los enlaces activos y guarda su estado.
+// Se ejecuta periódicamente; los destinos que fallan en una comprobación aislada no se marcan
+// como rotos hasta acumular brokenAfter fallos seguidos.
+func (s *Service) ScanLinks(ctx context.Context) (LinkScanResult, error) {
+	if s.prober == nil {
+		return LinkScanResult{}, nil
+	}
+
+	var pending []Link
+	now := time.Now()
+	if err := s.EachLink(ctx, func(link Link) error {
+		if !link.IsDisabled() && !link.IsExpired(now) {
+			pending = append(pending, link)
+		}
+		return nil
+	}); err != nil {
+		return LinkScanResult{}, err
+	}
+
+	var (
+		result   LinkScanResult
+		storeErr error
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+	)
+	jobs := make(chan Link)
+	for i := 0; i < deadLinkScanWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for link := range jobs {
+				health := s.probeHealth(ctx, link.LongURL, link.Health)
+				if ctx.Err() != nil {
+					continue
+				}
+				updated, err := s.store.SetHealth(ctx, link.Key(), link.LongURL, health)
+
+				mu.Lock()
+				switch {
+				case err != nil:
+					if storeErr == nil {
+						storeErr = storeError(err)
+					}
+				case updated:
+					result.Checked++
+					if health.Broken {
+						result.Broken++
+					} else if link.Health.Broken {
+						result.Recovered++
+					}
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+feed:
+	for _, link := range pending {
+		select {
+		case jobs <- link:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return result, err
+	}
+	return result, storeErr
+}
@@ -0,0 +1,100 @@
+package shortener
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+	"unicode/utf8"
+)
+
+// Límites de la descripción y de los metadatos propios de un enlace
+const (
+	MaxDescriptionLength    = 1000
+	MaxCustomMetadataLength = 4096
+)
+
+// normalizeCustomMetadata valida que metadata sea un objeto JSON de hasta
+// MaxCustomMetadataLength bytes y lo retorna compactado; null o vacío retornan nil
+func normalizeCustomMetadata(metadata json.RawMessage) (json.RawMessage, error) {
+	trimmed := bytes.TrimSpace(metadata)
+	if len(trimmed) == 0 || bytes.Equal(trimmed, []byte("null")) {
+		return nil, nil
+	}
+
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(trimmed, &object); err != nil {
+		return nil, &ValidationError{Field: "custom_metadata", Value: string(trimmed), Msg: "debe ser un objeto JSON"}
+	}
+	var compacted bytes.Buffer
+	if err := json.Compact(&compacted, trimmed); err != nil {
+		return nil, &ValidationError{Field: "custom_metadata", Value: string(trimmed), Msg: "debe ser un objeto JSON"}
+	}
+	if compacted.Len() > MaxCustomMetadataLength {
+		return nil, &ValidationError{Field: "custom_metadata", Value: compacted.Len(),
+			Msg: fmt.Sprintf("no puede superar %d bytes", MaxCustomMetadataLength)}
+	}
+	if len(object) == 0 {
+		return nil, nil
+	}
+	return compacted.Bytes(), nil
+}
+
+// validateDescription comprueba la longitud de la descripción
+func validateDescription(description string) error {
+	if utf8.RuneCountInString(description) > MaxDescriptionLength {
+		return &ValidationError{Field: "description", Value: description,
+			Msg: fmt.Sprintf("no puede superar %d caracteres", MaxDescriptionLength)}
+	}
+	return nil
+}
+
+// LinkDetails son la descripción y los metadatos propios de un enlace; los campos nil no se
+// modifican. CustomMetadata con el JSON null los elimina.
+type LinkDetails struct {
+	Description    *string
+	CustomMetadata json.RawMessage
+}
+
+// UpdateDetails cambia la descripción o los metadatos propios de un enlace. Solo el
+// propietario o un admin pueden cambiarlos.
+func (s *Service) UpdateDetails(ctx context.Context, actor Actor, shortCode string, details LinkDetails) (Link, error) {
+	link, err := s.GetLink(ctx, shortCode)
+	if err != nil {
+		return Link{}, err
+	}
+
+	if !actor.canManage(link) {
+		return Link{}, ErrForbidden
+	}
+
+	before := link
+	var errs []error
+	if details.Description != nil {
+		if err := validateDescription(*details.Description); err != nil {
+			errs = append(errs, err)
+		}
+		link.Description = *details.Description
+	}
+	if details.CustomMetadata != nil {
+		metadata, err := normalizeCustomMetadata(details.CustomMetadata)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		link.CustomMetadata = metadata
+	}
+	if err := errors.Join(errs...); err != nil {
+		return Link{}, err
+	}
+
+	link.UpdatedAt = time.Now()
+	if err := s.store.SaveLink(ctx, link); err != nil {
+		return Link{}, storeError(err)
+	}
+	if err := s.audit(ctx, actor, AuditUpdate, &before, &link); err != nil {
+		return Link{}, err
+	}
+	return link, nil
+}
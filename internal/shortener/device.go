@@ -0,0 +1,94 @@
+package shortener
+
+import (
+	"errors"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Clases de dispositivo admitidas como claves de DeviceTargets
+const (
+	DeviceIOS     = "ios"
+	DeviceAndroid = "android"
+	DeviceDesktop = "desktop"
+)
+
+// blockedTargetSchemes son los esquemas que nunca se aceptan como destino por dispositivo
+var blockedTargetSchemes = map[string]bool{"javascript": true, "data": true, "vbscript": true, "file": true}
+
+// DeviceFromUserAgent clasifica el User-Agent en ios, android o desktop. Los móviles de otras
+// plataformas y los User-Agent vacíos retornan "" y reciben el destino por defecto.
+func DeviceFromUserAgent(userAgent string) string {
+	ua := strings.ToLower(userAgent)
+	switch {
+	case ua == "":
+		return ""
+	case strings.Contains(ua, "iphone"), strings.Contains(ua, "ipad"), strings.Contains(ua, "ipod"):
+		return DeviceIOS
+	case strings.Contains(ua, "android"):
+		return DeviceAndroid
+	case strings.Contains(ua, "mobile"), strings.Contains(ua, "windows phone"):
+		return ""
+	default:
+		return DeviceDesktop
+	}
+}
+
+// validDevice indica si la clave es una clase de dispositivo conocida
+func validDevice(device string) bool {
+	return device == DeviceIOS || device == DeviceAndroid || device == DeviceDesktop
+}
+
+// validateDeviceTargets valida las clases de dispositivo y sus destinos. Además de URLs
+// http/https se aceptan enlaces profundos con esquema propio (itms-apps://, market://,
+// intent://, miapp://), salvo los esquemas que ejecutan contenido en el navegador.
+func (s *Service) validateDeviceTargets(targets map[string]string) error {
+	devices := make([]string, 0, len(targets))
+	for device := range targets {
+		devices = append(devices, device)
+	}
+	sort.Strings(devices)
+
+	var errs []error
+	for _, device := range devices {
+		target := targets[device]
+		field := "device_targets." + device
+		if !validDevice(strings.ToLower(device)) {
+			errs = append(errs, &ValidationError{Field: field, Value: device, Msg: "debe ser ios, android o desktop"})
+			continue
+		}
+
+		parsed, err := url.Parse(strings.TrimSpace(target))
+		switch {
+		case strings.TrimSpace(target) == "":
+			errs = append(errs, &ValidationError{Field: field, Value: target, Msg: "no puede estar vacía", Err: ErrEmptyURL})
+		case err != nil || parsed.Scheme == "" || (parsed.Host == "" && parsed.Opaque == ""):
+			errs = append(errs, &ValidationError{Field: field, Value: target, Msg: "debe ser una URL absoluta o un enlace profundo con esquema", Err: ErrInvalidURL})
+		case blockedTargetSchemes[strings.ToLower(parsed.Scheme)]:
+			errs = append(errs, &ValidationError{Field: field, Value: target, Msg: "esquema no permitido", Err: ErrInvalidURL})
+		case parsed.Scheme == "http" || parsed.Scheme == "https":
+			if err := s.validateURL(target); err != nil {
+				var validationErr *ValidationError
+				if errors.As(err, &validationErr) {
+					errs = append(errs, &ValidationError{Field: field, Value: target, Msg: validationErr.Msg, Err: validationErr.Err})
+					continue
+				}
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// normalizeDeviceTargets copia los destinos con las clases de dispositivo en minúsculas
+func normalizeDeviceTargets(targets map[string]string) map[string]string {
+	if len(targets) == 0 {
+		return nil
+	}
+	normalized := make(map[string]string, len(targets))
+	for device, target := range targets {
+		normalized[strings.ToLower(device)] = strings.TrimSpace(target)
+	}
+	return normalized
+}
@@ -0,0 +1,114 @@
+package shortener
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"acortador-urls/internal/errcode"
+)
+
+// MaxDisableReasonLength acota la longitud del motivo de desactivación
+const MaxDisableReasonLength = 500
+
+// Motivos por defecto de la desactivación
+const (
+	// DefaultDisableReason se usa cuando se desactiva un enlace sin indicar motivo
+	DefaultDisableReason = "Desactivado por su propietario"
+	// DeletedReason es el motivo de los enlaces borrados por su propietario
+	DeletedReason = "Eliminado por su propietario"
+)
+
+// ErrLinkDisabled indica que el enlace existe pero está desactivado
+var ErrLinkDisabled = errcode.New(errcode.Disabled, "enlace desactivado")
+
+// DisabledError acompaña a ErrLinkDisabled con el motivo de la desactivación
+type DisabledError struct {
+	Reason string
+}
+
+func (e *DisabledError) Error() string {
+	return fmt.Sprintf("%v: %s", ErrLinkDisabled, e.Reason)
+}
+
+// Unwrap permite comprobar el error con errors.Is(err, ErrLinkDisabled)
+func (e *DisabledError) Unwrap() error {
+	return ErrLinkDisabled
+}
+
+// DisableURL desactiva un enlace sin eliminarlo: deja de redirigir y las visitas reciben el
+// motivo indicado. Desactivar un enlace ya desactivado actualiza el motivo.
+func (s *Service) DisableURL(ctx context.Context, actor Actor, shortCode, reason string) (Link, error) {
+	link, err := s.GetLink(ctx, shortCode)
+	if err != nil {
+		return Link{}, err
+	}
+
+	if !actor.canManage(link) {
+		return Link{}, ErrForbidden
+	}
+
+	reason = strings.TrimSpace(reason)
+	if utf8.RuneCountInString(reason) > MaxDisableReasonLength {
+		return Link{}, &ValidationError{Field: "reason", Value: reason,
+			Msg: fmt.Sprintf("no puede superar %d caracteres", MaxDisableReasonLength)}
+	}
+	if reason == "" {
+		reason = DefaultDisableReason
+	}
+	disabled, err := s.disable(ctx, link, reason)
+	if err != nil {
+		return Link{}, err
+	}
+	if err := s.audit(ctx, actor, AuditDisable, &link, &disabled); err != nil {
+		return Link{}, err
+	}
+	return disabled, nil
+}
+
+// disable marca el enlace como desactivado y lo guarda
+func (s *Service) disable(ctx context.Context, link Link, reason string) (Link, error) {
+	now := time.Now()
+	wasDisabled := link.IsDisabled()
+	if !wasDisabled {
+		link.DisabledAt = now
+	}
+	link.DisabledReason = reason
+	link.UpdatedAt = now
+	if err := s.store.SaveLink(ctx, link); err != nil {
+		return Link{}, storeError(err)
+	}
+	if !wasDisabled {
+		s.emit(EventDisabled, link, "", "")
+	}
+	return link, nil
+}
+
+// EnableURL restaura un enlace desactivado; si ya estaba activo lo retorna sin cambios
+func (s *Service) EnableURL(ctx context.Context, actor Actor, shortCode string) (Link, error) {
+	link, err := s.GetLink(ctx, shortCode)
+	if err != nil {
+		return Link{}, err
+	}
+
+	if !actor.canManage(link) {
+		return Link{}, ErrForbidden
+	}
+	if !link.IsDisabled() {
+		return link, nil
+	}
+
+	before := link
+	link.DisabledAt = time.Time{}
+	link.DisabledReason = ""
+	link.UpdatedAt = time.Now()
+	if err := s.store.SaveLink(ctx, link); err != nil {
+		return Link{}, storeError(err)
+	}
+	if err := s.audit(ctx, actor, AuditEnable, &before, &link); err != nil {
+		return Link{}, err
+	}
+	return link, nil
+}
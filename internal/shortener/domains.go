@@ -0,0 +1,238 @@
+package shortener
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"acortador-urls/internal/errcode"
+)
+
+// DefaultBlockedDomains es la lista de bloqueo usada si no se configura ninguna
+var DefaultBlockedDomains = []string{
+	"malware.com", "*.malware.com",
+	"phishing.net", "*.phishing.net",
+	"spam.org", "*.spam.org",
+}
+
+// Límites de la descarga de listas de dominios desde una URL
+const (
+	domainListFetchTimeout = 10 * time.Second
+	maxDomainListBytes     = 10 << 20
+)
+
+// ErrInvalidDomainPolicy indica que las listas de dominios no se pudieron cargar o contienen
+// reglas inválidas; la política vigente se conserva
+var ErrInvalidDomainPolicy = errcode.New(errcode.DomainPolicyInvalid, "política de dominios inválida")
+
+// domainRule es una regla de dominio: exacta ("example.com"), comodín ("*.example.com", solo
+// subdominios) o expresión regular entre barras ("/^ads[0-9]*\.example\.com$/")
+type domainRule struct {
+	exact  string
+	suffix string
+	re     *regexp.Regexp
+}
+
+// parseDomainRule interpreta una regla de una lista de dominios
+func parseDomainRule(rule string) (domainRule, error) {
+	if len(rule) > 2 && strings.HasPrefix(rule, "/") && strings.HasSuffix(rule, "/") {
+		re, err := regexp.Compile(rule[1 : len(rule)-1])
+		if err != nil {
+			return domainRule{}, fmt.Errorf("expresión regular %q inválida: %v", rule, err)
+		}
+		return domainRule{re: re}, nil
+	}
+
+	rule = strings.ToLower(rule)
+	if strings.HasPrefix(rule, "*.") {
+		if strings.ContainsAny(rule[2:], "*/") || rule[2:] == "" {
+			return domainRule{}, fmt.Errorf("comodín %q inválido: solo se admite al inicio", rule)
+		}
+		return domainRule{suffix: rule[1:]}, nil
+	}
+	if strings.ContainsAny(rule, "*/ ") {
+		return domainRule{}, fmt.Errorf("dominio %q inválido", rule)
+	}
+	return domainRule{exact: rule}, nil
+}
+
+// matches indica si el host (en minúsculas y sin puerto) cumple la regla
+func (r domainRule) matches(host string) bool {
+	switch {
+	case r.re != nil:
+		return r.re.MatchString(host)
+	case r.suffix != "":
+		return strings.HasSuffix(host, r.suffix)
+	default:
+		return host == r.exact
+	}
+}
+
+// DomainPolicy decide qué dominios de destino se aceptan. La lista de bloqueo siempre se aplica;
+// si la lista de permitidos no está vacía, solo se aceptan los dominios que la cumplen.
+type DomainPolicy struct {
+	blocked []domainRule
+	allowed []domainRule
+}
+
+// NewDomainPolicy construye una política a partir de las reglas de cada lista
+func NewDomainPolicy(blocklist, allowlist []string) (*DomainPolicy, error) {
+	policy := &DomainPolicy{}
+	var errs []error
+	for _, list := range []struct {
+		rules []string
+		dest  *[]domainRule
+	}{{blocklist, &policy.blocked}, {allowlist, &policy.allowed}} {
+		for _, rule := range list.rules {
+			parsed, err := parseDomainRule(rule)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			*list.dest = append(*list.dest, parsed)
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidDomainPolicy, err)
+	}
+	return policy, nil
+}
+
+// Blocked retorna el número de reglas de la lista de bloqueo
+func (p *DomainPolicy) Blocked() int {
+	return len(p.blocked)
+}
+
+// Allowed retorna el número de reglas de la lista de permitidos
+func (p *DomainPolicy) Allowed() int {
+	return len(p.allowed)
+}
+
+// check retorna el motivo por el que se rechaza el host, o vacío si se acepta
+func (p *DomainPolicy) check(host string) string {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	for _, rule := range p.blocked {
+		if rule.matches(host) {
+			return "dominio bloqueado por seguridad"
+		}
+	}
+	if len(p.allowed) == 0 {
+		return ""
+	}
+	for _, rule := range p.allowed {
+		if rule.matches(host) {
+			return ""
+		}
+	}
+	return "dominio no permitido"
+}
+
+// DomainPolicySource indica de dónde se cargan las listas de dominios. Cada lista combina las
+// reglas en línea con las de su origen: una ruta de archivo o una URL http(s) con una regla por
+// línea (las líneas vacías y las que empiezan por '#' se ignoran).
+type DomainPolicySource struct {
+	Blocklist       []string
+	BlocklistSource string
+	Allowlist       []string
+	AllowlistSource string
+}
+
+// IsZero indica si no se configuró ninguna lista
+func (src DomainPolicySource) IsZero() bool {
+	return len(src.Blocklist) == 0 && src.BlocklistSource == "" && len(src.Allowlist) == 0 && src.AllowlistSource == ""
+}
+
+// Load lee los orígenes y construye la política; sin configuración usa DefaultBlockedDomains
+func (src DomainPolicySource) Load(ctx context.Context) (*DomainPolicy, error) {
+	if src.IsZero() {
+		return NewDomainPolicy(DefaultBlockedDomains, nil)
+	}
+
+	blocklist, err := loadDomainList(ctx, src.Blocklist, src.BlocklistSource)
+	if err != nil {
+		return nil, err
+	}
+	allowlist, err := loadDomainList(ctx, src.Allowlist, src.AllowlistSource)
+	if err != nil {
+		return nil, err
+	}
+	return NewDomainPolicy(blocklist, allowlist)
+}
+
+// loadDomainList agrega a las reglas en línea las leídas del origen, si lo hay
+func loadDomainList(ctx context.Context, inline []string, source string) ([]string, error) {
+	rules := append([]string{}, inline...)
+	if source == "" {
+		return rules, nil
+	}
+
+	var body io.ReadCloser
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		ctx, cancel := context.WithTimeout(ctx, domainListFetchTimeout)
+		defer cancel()
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidDomainPolicy, err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("%w: no se pudo descargar %s: %v", ErrInvalidDomainPolicy, source, err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, fmt.Errorf("%w: %s respondió %s", ErrInvalidDomainPolicy, source, resp.Status)
+		}
+		body = resp.Body
+	} else {
+		file, err := os.Open(source)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidDomainPolicy, err)
+		}
+		body = file
+	}
+	defer body.Close()
+
+	scanner := bufio.NewScanner(io.LimitReader(body, maxDomainListBytes))
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" && !strings.HasPrefix(line, "#") {
+			rules = append(rules, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%w: error leyendo %s: %v", ErrInvalidDomainPolicy, source, err)
+	}
+	return rules, nil
+}
+
+// WithDomainPolicySource configura de dónde se cargan las listas de dominios. La política se
+// lee con ReloadDomainPolicy, al arrancar y cada vez que se quiera recargar.
+func WithDomainPolicySource(src DomainPolicySource) ServiceOption {
+	return func(s *Service) {
+		s.domainSource = src
+	}
+}
+
+// WithDomainPolicy fija la política de dominios
+func WithDomainPolicy(policy *DomainPolicy) ServiceOption {
+	return func(s *Service) {
+		s.domainPolicy.Store(policy)
+	}
+}
+
+// ReloadDomainPolicy vuelve a leer las listas de dominios y reemplaza la política sin afectar a
+// las peticiones en curso. Si la carga falla se conserva la política anterior.
+func (s *Service) ReloadDomainPolicy(ctx context.Context) (*DomainPolicy, error) {
+	policy, err := s.domainSource.Load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.domainPolicy.Store(policy)
+	return policy, nil
+}
@@ -0,0 +1,136 @@
+package shortener
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Tipos de evento de los enlaces
+const (
+	EventCreated  = "link.created"
+	EventClicked  = "link.clicked"
+	EventExpiring = "link.expiring"
+	EventExpired  = "link.expired"
+	EventDisabled = "link.disabled"
+	// EventAnomaly es un pico de visitas detectado con WithAnomalyDetection
+	EventAnomaly = "link.anomaly"
+)
+
+// EventTypes son todos los tipos de evento, en el orden en que se documentan
+var EventTypes = []string{EventCreated, EventClicked, EventExpiring, EventExpired, EventDisabled, EventAnomaly}
+
+// Event es algo que le ocurrió a un enlace. Link es el estado del enlace tras el evento.
+type Event struct {
+	Type string
+	Time time.Time
+	Link Link
+	// Variant es la variante A/B servida en los eventos EventClicked
+	Variant string
+	// Visitor identifica de forma anónima al visitante en los eventos EventClicked; vacío si
+	// se desconoce
+	Visitor string
+	// Bot indica en los eventos EventClicked que la visita es de un bot o rastreador
+	Bot bool
+	// Referrer es el dominio de procedencia en los eventos EventClicked; vacío en las visitas
+	// directas o privadas
+	Referrer string
+	// Country es el país del visitante en los eventos EventClicked; vacío si se desconoce
+	Country string
+	// Anomaly describe el pico de visitas en los eventos EventAnomaly
+	Anomaly Anomaly
+}
+
+// EventListener recibe los eventos de los enlaces. HandleEvent se llama de forma síncrona
+// desde la operación que lo produce, así que no debe bloquear: los trabajos lentos, como
+// notificar por HTTP, deben encolarse.
+type EventListener interface {
+	HandleEvent(event Event)
+}
+
+// EventListenerFunc adapta una función a EventListener
+type EventListenerFunc func(event Event)
+
+// HandleEvent implementa EventListener
+func (f EventListenerFunc) HandleEvent(event Event) {
+	f(event)
+}
+
+// WithEventListener agrega un receptor de los eventos de los enlaces
+func WithEventListener(listener EventListener) ServiceOption {
+	return func(s *Service) {
+		s.listeners = append(s.listeners, listener)
+	}
+}
+
+// emit entrega el evento a los receptores
+func (s *Service) emit(eventType string, link Link, variant, visitor string) {
+	if len(s.listeners) == 0 {
+		return
+	}
+	s.publish(Event{Type: eventType, Time: time.Now(), Link: link, Variant: variant, Visitor: visitor})
+}
+
+// publish entrega el evento a los listeners
+func (s *Service) publish(event Event) {
+	for _, listener := range s.listeners {
+		listener.HandleEvent(event)
+	}
+}
+
+// expiryWatch recuerda hasta cuándo se notificaron las expiraciones
+type expiryWatch struct {
+	mu   sync.Mutex
+	last time.Time
+	// notice es la antelación con la que se avisa de que un enlace va a expirar; cero no avisa
+	notice time.Duration
+}
+
+// WithExpiryNotice hace que NotifyExpired emita también EventExpiring cuando falte notice
+// para que expire cada enlace; cero lo desactiva
+func WithExpiryNotice(notice time.Duration) ServiceOption {
+	return func(s *Service) {
+		if notice > 0 {
+			s.expiry.notice = notice
+		}
+	}
+}
+
+// NotifyExpired emite EventExpired por cada enlace cuya expiración llegó desde la llamada
+// anterior (o desde la creación del servicio, en la primera) y, con WithExpiryNotice,
+// EventExpiring por cada enlace que entró en el plazo de aviso en ese intervalo. Retorna
+// cuántos eventos emitió. Debe llamarse periódicamente; los avisos y expiraciones ocurridos
+// con el proceso detenido no se notifican. Un enlace cuya expiración se prolonga vuelve a
+// avisarse al entrar en el plazo de la nueva fecha.
+func (s *Service) NotifyExpired(ctx context.Context) (int, error) {
+	if len(s.listeners) == 0 {
+		return 0, nil
+	}
+	s.expiry.mu.Lock()
+	defer s.expiry.mu.Unlock()
+
+	now := time.Now()
+	notified := 0
+	err := s.store.Each(ctx, func(link Link) error {
+		if link.ExpiresAt.IsZero() {
+			return nil
+		}
+		if link.ExpiresAt.After(s.expiry.last) && !link.ExpiresAt.After(now) {
+			s.emit(EventExpired, link, "", "")
+			notified++
+		}
+		if s.expiry.notice > 0 && link.ExpiresAt.After(now) {
+			noticeAt := link.ExpiresAt.Add(-s.expiry.notice)
+			if noticeAt.After(s.expiry.last) && !noticeAt.After(now) {
+				s.emit(EventExpiring, link, "", "")
+				notified++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return notified, storeError(err)
+	}
+	s.expiry.last = now
+	return notified, nil
+}
@@ -0,0 +1,108 @@
+package shortener
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Políticas de expulsión del almacén en memoria al alcanzar su capacidad
+const (
+	// EvictionLRU expulsa el enlace usado hace más tiempo
+	EvictionLRU = "lru"
+	// EvictionLFU expulsa el enlace con menos usos
+	EvictionLFU = "lfu"
+)
+
+// evictionSamples es el número de enlaces entre los que se elige cuál expulsar. Como en Redis,
+// la política se aproxima sobre una muestra para no mantener una lista ordenada que obligaría a
+// tomar el lock de escritura en cada lectura. Con menos enlaces que muestras es exacta.
+const evictionSamples = 16
+
+// StoreOption configura comportamientos opcionales del almacén en memoria
+type StoreOption func(*Store)
+
+// WithEviction limita el almacén a maxEntries enlaces: al guardar uno nuevo con el almacén
+// lleno se expulsa otro según policy (EvictionLRU o EvictionLFU). Cero no limita el tamaño. Un
+// enlace se usa cada vez que se lee, p. ej. al redirigir.
+func WithEviction(maxEntries int, policy string) StoreOption {
+	return func(s *Store) {
+		if policy != EvictionLFU {
+			policy = EvictionLRU
+		}
+		s.maxEntries = maxEntries
+		s.evictionPolicy = policy
+	}
+}
+
+// EvictionStats resume la actividad de expulsión del almacén
+type EvictionStats struct {
+	// Capacity es el máximo de enlaces; cero si no hay límite
+	Capacity int
+	// Policy es EvictionLRU o EvictionLFU
+	Policy string
+	// Evictions es el número de enlaces expulsados desde el arranque
+	Evictions uint64
+}
+
+// EvictionReporter lo implementan los almacenes que expulsan enlaces al llenarse
+type EvictionReporter interface {
+	EvictionStats() EvictionStats
+}
+
+// linkUsage registra el uso de un enlace; se actualiza con el lock de lectura
+type linkUsage struct {
+	lastUsed atomic.Int64 // UnixNano del último uso
+	uses     atomic.Uint64
+}
+
+// EvictionStats implementa EvictionReporter
+func (s *Store) EvictionStats() EvictionStats {
+	return EvictionStats{Capacity: s.maxEntries, Policy: s.evictionPolicy, Evictions: s.evictions.Load()}
+}
+
+// touchLocked registra un uso del enlace; requiere al menos el lock de lectura
+func (s *Store) touchLocked(shortCode string) {
+	if usage, ok := s.usage[shortCode]; ok {
+		usage.lastUsed.Store(time.Now().UnixNano())
+		usage.uses.Add(1)
+	}
+}
+
+// makeRoomLocked expulsa enlaces hasta que quepa uno nuevo; requiere el lock de escritura
+func (s *Store) makeRoomLocked() {
+	for s.maxEntries > 0 && len(s.urls) >= s.maxEntries {
+		victim, found := s.evictionCandidateLocked()
+		if !found {
+			return
+		}
+		s.removeLocked(s.urls[victim])
+		s.evictions.Add(1)
+	}
+}
+
+// evictionCandidateLocked elige el enlace a expulsar entre una muestra de evictionSamples. En
+// LFU los empates se resuelven por antigüedad del último uso.
+func (s *Store) evictionCandidateLocked() (string, bool) {
+	var (
+		victim     string
+		victimUsed int64
+		victimUses uint64
+		found      bool
+		sampled    int
+	)
+	// El orden de recorrido de los mapas es aleatorio, lo que da una muestra distinta cada vez
+	for code, usage := range s.usage {
+		used, uses := usage.lastUsed.Load(), usage.uses.Load()
+		better := used < victimUsed
+		if s.evictionPolicy == EvictionLFU {
+			better = uses < victimUses || (uses == victimUses && used < victimUsed)
+		}
+		if !found || better {
+			victim, victimUsed, victimUses, found = code, used, uses, true
+		}
+		if sampled++; sampled >= evictionSamples {
+			break
+		}
+	}
+	return victim, found
+}
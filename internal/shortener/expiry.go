@@ -0,0 +1,73 @@
+package shortener
+
+import (
+	"context"
+	"time"
+
+	"acortador-urls/internal/errcode"
+)
+
+// ErrInvalidExpiry indica una renovación sin fecha ni plazo válidos
+var ErrInvalidExpiry = errcode.New(errcode.InvalidExpiry, "expiración inválida")
+
+// Extension es la renovación de la expiración de un enlace: una fecha ExpiresAt o un plazo TTL
+// que se suma a la expiración actual (o al momento presente si ya pasó o el enlace no expiraba)
+type Extension struct {
+	ExpiresAt time.Time
+	TTL       time.Duration
+}
+
+// ExtendExpiry renueva la expiración de un enlace; un enlace expirado vuelve a redirigir. Solo
+// el propietario o un admin pueden renovarla.
+func (s *Service) ExtendExpiry(ctx context.Context, actor Actor, shortCode string, extension Extension) (Link, error) {
+	now := time.Now()
+	if err := extension.validate(now); err != nil {
+		return Link{}, err
+	}
+
+	link, err := s.GetLink(ctx, shortCode)
+	if err != nil {
+		return Link{}, err
+	}
+	if !actor.canManage(link) {
+		return Link{}, ErrForbidden
+	}
+
+	before := link
+	link.ExpiresAt = extension.expiry(link.ExpiresAt, now)
+	link.UpdatedAt = now
+	if err := s.store.SaveLink(ctx, link); err != nil {
+		return Link{}, storeError(err)
+	}
+	if err := s.audit(ctx, actor, AuditUpdate, &before, &link); err != nil {
+		return Link{}, err
+	}
+	return link, nil
+}
+
+// validate comprueba que la renovación indique una fecha futura o un plazo positivo, pero no ambos
+func (e Extension) validate(now time.Time) error {
+	switch {
+	case e.ExpiresAt.IsZero() == (e.TTL == 0):
+		return &ValidationError{Field: "expires_at", Err: ErrInvalidExpiry,
+			Msg: "se debe indicar expires_at o ttl_seconds, pero no ambos"}
+	case e.TTL < 0:
+		return &ValidationError{Field: "ttl_seconds", Value: e.TTL.Seconds(), Err: ErrInvalidExpiry,
+			Msg: "debe ser positivo"}
+	case !e.ExpiresAt.IsZero() && !e.ExpiresAt.After(now):
+		return &ValidationError{Field: "expires_at", Value: e.ExpiresAt, Err: ErrInvalidExpiry,
+			Msg: "debe estar en el futuro"}
+	}
+	return nil
+}
+
+// expiry retorna la expiración renovada de un enlace que expiraba en current
+func (e Extension) expiry(current, now time.Time) time.Time {
+	if e.TTL <= 0 {
+		return e.ExpiresAt
+	}
+	if current.Before(now) {
+		current = now
+	}
+	return current.Add(e.TTL)
+}
@@ -0,0 +1,75 @@
+package shortener
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"acortador-urls/internal/errcode"
+)
+
+// DefaultReservedWords contiene los códigos que colisionarían con rutas del servidor que no
+// pasan por el router principal, como las de un puerto de métricas aparte. Las del router se
+// reservan con WithRoutes.
+var DefaultReservedWords = []string{"shorten", "api", "admin", "metrics", "healthz", "search"}
+
+// Errores del filtro de códigos
+var (
+	ErrAliasNotAllowed = errcode.New(errcode.AliasNotAllowed, "alias no permitido")
+	errReservedCode    = errors.New("coincide con una ruta reservada")
+	errProfaneCode     = errors.New("contiene una palabra no permitida")
+)
+
+// CodeFilter rechaza códigos que coinciden con rutas reservadas o contienen palabras ofensivas.
+// La comparación no distingue mayúsculas de minúsculas.
+type CodeFilter struct {
+	reserved  map[string]bool
+	profanity []string
+	routes    *RouteRegistry
+}
+
+// NewCodeFilter crea un filtro con las palabras reservadas (coincidencia exacta) y la lista
+// de palabras ofensivas (coincidencia como subcadena)
+func NewCodeFilter(reserved, profanity []string) *CodeFilter {
+	f := &CodeFilter{
+		reserved: make(map[string]bool, len(reserved)),
+	}
+	for _, word := range reserved {
+		if word = strings.ToLower(strings.TrimSpace(word)); word != "" {
+			f.reserved[word] = true
+		}
+	}
+	for _, word := range profanity {
+		if word = strings.ToLower(strings.TrimSpace(word)); word != "" {
+			f.profanity = append(f.profanity, word)
+		}
+	}
+	return f
+}
+
+// Check retorna un error si el código no puede usarse
+func (f *CodeFilter) Check(code string) error {
+	lower := strings.ToLower(code)
+	if f.reserved[lower] {
+		return errReservedCode
+	}
+	if f.routes != nil {
+		if _, ok := f.routes.Route(lower); ok {
+			return errReservedCode
+		}
+	}
+	for _, word := range f.profanity {
+		if strings.Contains(lower, word) {
+			return errProfaneCode
+		}
+	}
+	return nil
+}
+
+// checkAlias aplica el filtro a un alias personalizado envolviendo el motivo en ErrAliasNotAllowed
+func (f *CodeFilter) checkAlias(alias string) error {
+	if err := f.Check(alias); err != nil {
+		return fmt.Errorf("%w: %v", ErrAliasNotAllowed, err)
+	}
+	return nil
+}
@@ -0,0 +1,388 @@
+package shortener
+
+import (
+	"crypto/md5"
+	cryptorand "crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"math/rand"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Estrategias de generación seleccionables por configuración
+const (
+	StrategyHash       = "hash"
+	StrategySequential = "sequential"
+	StrategyRandom     = "random"
+	StrategySnowflake  = "snowflake"
+)
+
+// Límites de validación del formato de código configurable
+const (
+	// MinCodeLength es la longitud mínima aceptada para códigos generados
+	MinCodeLength = 4
+	// MaxCodeLength es la longitud máxima (limitada por los 32 caracteres hex de MD5)
+	MaxCodeLength = 32
+	// MinAlphabetSize es el número mínimo de caracteres distintos del alfabeto
+	MinAlphabetSize = 10
+	// MinKeyspace es el número mínimo de códigos posibles para mantener bajo el riesgo de colisión
+	MinKeyspace = 1e9
+)
+
+// CodeFormat define la longitud y el alfabeto de los códigos generados
+type CodeFormat struct {
+	Length   int
+	Alphabet string
+}
+
+// DefaultCodeFormat retorna el formato por defecto (ShortCodeLength sobre ValidChars)
+func DefaultCodeFormat() CodeFormat {
+	return CodeFormat{Length: ShortCodeLength, Alphabet: ValidChars}
+}
+
+// Keyspace retorna el número de códigos distintos que admite el formato
+func (f CodeFormat) Keyspace() float64 {
+	return math.Pow(float64(len(f.Alphabet)), float64(f.Length))
+}
+
+// Validate comprueba que el formato sea utilizable en URLs y con un espacio de códigos suficiente
+func (f CodeFormat) Validate() error {
+	if f.Length < MinCodeLength || f.Length > MaxCodeLength {
+		return fmt.Errorf("la longitud del código debe estar entre %d y %d, se recibió %d", MinCodeLength, MaxCodeLength, f.Length)
+	}
+
+	seen := make(map[rune]bool, len(f.Alphabet))
+	for _, c := range f.Alphabet {
+		if !isURLSafe(c) {
+			return fmt.Errorf("el alfabeto contiene el carácter no permitido %q (solo a-z, A-Z, 0-9, '-' y '_')", c)
+		}
+		if seen[c] {
+			return fmt.Errorf("el alfabeto contiene el carácter %q repetido", c)
+		}
+		seen[c] = true
+	}
+
+	if len(f.Alphabet) < MinAlphabetSize {
+		return fmt.Errorf("el alfabeto debe tener al menos %d caracteres, tiene %d", MinAlphabetSize, len(f.Alphabet))
+	}
+
+	if keyspace := f.Keyspace(); keyspace < MinKeyspace {
+		return fmt.Errorf("espacio de códigos demasiado pequeño (%.0f combinaciones, mínimo %.0f): aumenta la longitud o el alfabeto", keyspace, float64(MinKeyspace))
+	}
+	return nil
+}
+
+// isURLSafe indica si el carácter puede aparecer sin codificar en la ruta del código
+func isURLSafe(c rune) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c == '-' || c == '_'
+}
+
+// CodeGenerator produce candidatos de código corto. El servicio verifica cada candidato
+// contra el almacén y vuelve a pedir otro (incrementando attempt) si ya existe.
+type CodeGenerator interface {
+	Generate(longURL string, attempt int) string
+}
+
+// UniqueCodeGenerator lo implementan los generadores que garantizan códigos irrepetibles
+// incluso entre varias réplicas; el servicio no consulta al almacén si el código existe.
+type UniqueCodeGenerator interface {
+	CodeGenerator
+	Unique() bool
+}
+
+// GeneratorConfig agrupa los parámetros para construir un CodeGenerator
+type GeneratorConfig struct {
+	Strategy string
+	Format   CodeFormat
+	// NodeID identifica a la réplica en la estrategia snowflake (0 a MaxNodeID)
+	NodeID int64
+	// Stages son los intentos en los que la estrategia hash cambia de entrada; el valor cero
+	// usa DefaultAttemptStages
+	Stages AttemptStages
+}
+
+// AttemptStages son los intentos a partir de los cuales HashGenerator agrega más entropía a la
+// entrada del hash y, después, la marca de tiempo en nanosegundos
+type AttemptStages struct {
+	EntropyAfter   int
+	TimestampAfter int
+}
+
+// DefaultAttemptStages retorna las etapas por defecto: tres intentos normales, cuatro con más
+// entropía y el resto con la marca de tiempo
+func DefaultAttemptStages() AttemptStages {
+	return AttemptStages{EntropyAfter: 3, TimestampAfter: 7}
+}
+
+// Validate comprueba que las etapas estén en orden
+func (s AttemptStages) Validate() error {
+	if s.EntropyAfter < 0 || s.TimestampAfter < s.EntropyAfter {
+		return fmt.Errorf("las etapas de reintento deben cumplir 0 <= entropía (%d) <= marca de tiempo (%d)", s.EntropyAfter, s.TimestampAfter)
+	}
+	return nil
+}
+
+// NewCodeGenerator crea el generador correspondiente a la estrategia y formato configurados
+func NewCodeGenerator(cfg GeneratorConfig) (CodeGenerator, error) {
+	if err := cfg.Format.Validate(); err != nil {
+		return nil, err
+	}
+
+	switch cfg.Strategy {
+	case "", StrategyHash:
+		generator := NewHashGenerator(cfg.Format)
+		if cfg.Stages != (AttemptStages{}) {
+			if err := cfg.Stages.Validate(); err != nil {
+				return nil, err
+			}
+			generator.stages = cfg.Stages
+		}
+		return generator, nil
+	case StrategySequential:
+		return NewSequentialGenerator(cfg.Format, 0), nil
+	case StrategyRandom:
+		return NewRandomGenerator(cfg.Format), nil
+	case StrategySnowflake:
+		return NewSnowflakeGenerator(cfg.Format, cfg.NodeID)
+	default:
+		return nil, fmt.Errorf("estrategia de generación desconocida: %q", cfg.Strategy)
+	}
+}
+
+// HashGenerator genera códigos a partir del hash MD5 de la URL con timestamp y valor aleatorio
+type HashGenerator struct {
+	format CodeFormat
+	stages AttemptStages
+	mu     sync.Mutex // rand.Rand no es seguro para uso concurrente
+	rand   *rand.Rand
+}
+
+// NewHashGenerator crea el generador basado en hash
+func NewHashGenerator(format CodeFormat) *HashGenerator {
+	return &HashGenerator{
+		format: format,
+		stages: DefaultAttemptStages(),
+		rand:   rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// Generate implementa CodeGenerator variando la entrada del hash según el intento
+func (g *HashGenerator) Generate(longURL string, attempt int) string {
+	// Switch para manejar diferentes estrategias según el intento
+	switch {
+	case attempt < g.stages.EntropyAfter:
+		// Primeros intentos: estrategia normal
+		return g.generateShortCode(longURL, attempt)
+	case attempt < g.stages.TimestampAfter:
+		// Intentos intermedios: agregar más entropía
+		return g.generateShortCode(longURL, attempt*2) // Más variación
+	default:
+		// Últimos intentos: estrategia agresiva con timestamp
+		return g.generateShortCode(longURL+fmt.Sprintf("_%d", time.Now().UnixNano()), attempt)
+	}
+}
+
+// generateShortCode genera un código corto usando closure para entrada única
+func (g *HashGenerator) generateShortCode(longURL string, attempt int) string {
+	// Usar closure para generar entrada única
+	entryGenerator := g.createEntryGenerator(longURL, attempt)
+	entry := entryGenerator()
+
+	// Generar hash MD5
+	hash := md5.Sum([]byte(entry))
+	hashString := hex.EncodeToString(hash[:])
+
+	// Tomar los primeros caracteres y convertir a base alfanumérica
+	alphabet := g.format.Alphabet
+	result := make([]byte, g.format.Length)
+	for i := 0; i < g.format.Length; i++ {
+		index := int(hashString[i]) % len(alphabet)
+		result[i] = alphabet[index]
+	}
+
+	return string(result)
+}
+
+// createEntryGenerator crea un closure para generar entradas únicas
+func (g *HashGenerator) createEntryGenerator(longURL string, attempt int) func() string {
+	// Variables capturadas por el closure
+	timestamp := time.Now().UnixNano()
+	g.mu.Lock()
+	randomValue := g.rand.Int63()
+	g.mu.Unlock()
+
+	return func() string {
+		var builder strings.Builder
+		builder.Grow(len(longURL) + 50) // Pre-allocar para mejor performance
+
+		builder.WriteString(longURL)
+		builder.WriteString("_")
+		builder.WriteString(fmt.Sprintf("%d", timestamp))
+		builder.WriteString("_")
+		builder.WriteString(fmt.Sprintf("%d", attempt))
+		builder.WriteString("_")
+		builder.WriteString(fmt.Sprintf("%d", randomValue))
+
+		return builder.String()
+	}
+}
+
+// SequentialGenerator asigna códigos a partir de un contador atómico codificado en la base
+// del alfabeto (base62 con el alfabeto por defecto). Cada llamada produce un valor distinto,
+// por lo que solo hay reintentos si un alias personalizado ocupa casualmente el siguiente código.
+type SequentialGenerator struct {
+	format  CodeFormat
+	counter atomic.Uint64
+}
+
+// NewSequentialGenerator crea un generador secuencial que empieza en start
+func NewSequentialGenerator(format CodeFormat, start uint64) *SequentialGenerator {
+	g := &SequentialGenerator{format: format}
+	g.counter.Store(start)
+	return g
+}
+
+// Generate implementa CodeGenerator; la URL y el intento no influyen en el resultado
+func (g *SequentialGenerator) Generate(_ string, _ int) string {
+	return encodeBaseN(g.counter.Add(1)-1, g.format.Alphabet, g.format.Length)
+}
+
+// encodeBaseN codifica n en la base del alfabeto, rellenando a la izquierda hasta minLength
+func encodeBaseN(n uint64, alphabet string, minLength int) string {
+	base := uint64(len(alphabet))
+	buf := make([]byte, 0, minLength)
+	for n > 0 {
+		buf = append(buf, alphabet[n%base])
+		n /= base
+	}
+	for len(buf) < minLength {
+		buf = append(buf, alphabet[0])
+	}
+
+	// Invertir para que el dígito más significativo quede a la izquierda
+	for i, j := 0, len(buf)-1; i < j; i, j = i+1, j-1 {
+		buf[i], buf[j] = buf[j], buf[i]
+	}
+	return string(buf)
+}
+
+// RandomGenerator genera códigos con bytes de crypto/rand, impredecibles para terceros.
+// A diferencia de HashGenerator no usa "% len(ValidChars)" directamente sobre cada byte:
+// descarta los bytes por encima del mayor múltiplo del alfabeto (muestreo por rechazo)
+// para que todos los caracteres tengan la misma probabilidad.
+type RandomGenerator struct {
+	format CodeFormat
+	read   func([]byte) (int, error)
+}
+
+// NewRandomGenerator crea el generador criptográficamente aleatorio
+func NewRandomGenerator(format CodeFormat) *RandomGenerator {
+	return &RandomGenerator{format: format, read: cryptorand.Read}
+}
+
+// Generate implementa CodeGenerator; cada intento es una muestra independiente
+func (g *RandomGenerator) Generate(_ string, _ int) string {
+	alphabet := g.format.Alphabet
+	length := g.format.Length
+	alphabetSize := len(alphabet)
+	// Mayor valor de byte (exclusivo) que es múltiplo exacto del tamaño del alfabeto
+	limit := 256 - (256 % alphabetSize)
+
+	result := make([]byte, 0, length)
+	buf := make([]byte, length*2)
+	for len(result) < length {
+		if _, err := g.read(buf); err != nil {
+			// Sin fuente de entropía no es posible generar códigos seguros
+			panic(fmt.Errorf("crypto/rand no disponible: %w", err))
+		}
+		for _, b := range buf {
+			if int(b) >= limit {
+				continue
+			}
+			result = append(result, alphabet[int(b)%alphabetSize])
+			if len(result) == length {
+				break
+			}
+		}
+	}
+	return string(result)
+}
+
+// Distribución de bits de los identificadores snowflake (63 bits útiles)
+const (
+	snowflakeNodeBits     = 10
+	snowflakeSequenceBits = 12
+	// MaxNodeID es el mayor identificador de nodo admitido por la estrategia snowflake
+	MaxNodeID            = 1<<snowflakeNodeBits - 1
+	maxSnowflakeSequence = 1<<snowflakeSequenceBits - 1
+)
+
+// SnowflakeEpoch es el instante cero de los timestamps snowflake; una época reciente
+// mantiene los códigos cortos (≈ 10 caracteres en base62 durante décadas)
+var SnowflakeEpoch = time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// SnowflakeGenerator compone identificadores únicos con timestamp en milisegundos,
+// identificador de nodo y secuencia, al estilo Snowflake. Réplicas con NodeID distinto
+// nunca producen el mismo código, por lo que no necesitan coordinarse a través del almacén.
+type SnowflakeGenerator struct {
+	format CodeFormat
+	nodeID int64
+
+	mu            sync.Mutex
+	lastTimestamp int64
+	sequence      int64
+	now           func() time.Time
+}
+
+// NewSnowflakeGenerator crea un generador snowflake para el nodo indicado
+func NewSnowflakeGenerator(format CodeFormat, nodeID int64) (*SnowflakeGenerator, error) {
+	if nodeID < 0 || nodeID > MaxNodeID {
+		return nil, fmt.Errorf("el identificador de nodo debe estar entre 0 y %d, se recibió %d", MaxNodeID, nodeID)
+	}
+	return &SnowflakeGenerator{
+		format: format,
+		nodeID: nodeID,
+		now:    time.Now,
+	}, nil
+}
+
+// Generate implementa CodeGenerator
+func (g *SnowflakeGenerator) Generate(_ string, _ int) string {
+	return encodeBaseN(uint64(g.nextID()), g.format.Alphabet, g.format.Length)
+}
+
+// Unique implementa UniqueCodeGenerator
+func (g *SnowflakeGenerator) Unique() bool {
+	return true
+}
+
+// nextID retorna el siguiente identificador garantizando monotonía aunque el reloj retroceda
+func (g *SnowflakeGenerator) nextID() int64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	timestamp := g.now().Sub(SnowflakeEpoch).Milliseconds()
+	if timestamp < g.lastTimestamp {
+		// Reloj desplazado hacia atrás: seguir sobre el último timestamp emitido
+		timestamp = g.lastTimestamp
+	}
+
+	if timestamp == g.lastTimestamp {
+		g.sequence = (g.sequence + 1) & maxSnowflakeSequence
+		if g.sequence == 0 {
+			// Secuencia agotada en este milisegundo: avanzar al siguiente
+			timestamp++
+		}
+	} else {
+		g.sequence = 0
+	}
+	g.lastTimestamp = timestamp
+
+	return timestamp<<(snowflakeNodeBits+snowflakeSequenceBits) |
+		g.nodeID<<snowflakeSequenceBits |
+		g.sequence
+}
@@ -0,0 +1,165 @@
+package shortener
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"acortador-urls/internal/errcode"
+)
+
+// DefaultIdempotencyTTL es el tiempo durante el que se recuerda una clave de idempotencia
+const DefaultIdempotencyTTL = 24 * time.Hour
+
+// idempotencySweepEvery es cada cuántas escrituras el almacén purga las claves expiradas
+const idempotencySweepEvery = 1000
+
+// ErrIdempotencyKeyReused indica que una clave de idempotencia se reutilizó con otra petición
+var ErrIdempotencyKeyReused = errcode.New(errcode.IdempotencyKeyReused, "la clave de idempotencia ya se usó con una petición distinta")
+
+// IdempotencyRecord asocia una clave de idempotencia con el enlace que produjo
+type IdempotencyRecord struct {
+	Key         string
+	Fingerprint string // Huella de la petición original para detectar reutilizaciones
+	ShortCode   string
+	Created     bool // Si la petición original creó el enlace o reutilizó uno existente
+	ExpiresAt   time.Time
+}
+
+// WithIdempotencyTTL configura durante cuánto tiempo se recuerdan las claves de idempotencia
+func WithIdempotencyTTL(ttl time.Duration) ServiceOption {
+	return func(s *Service) {
+		s.idempotencyTTL = ttl
+	}
+}
+
+// ShortenIdempotent se comporta como Shorten, pero una clave ya usada por el mismo propietario
+// con la misma entrada retorna el enlace creado originalmente en lugar de acortar de nuevo.
+// Reutilizar la clave con una entrada distinta retorna ErrIdempotencyKeyReused.
+func (s *Service) ShortenIdempotent(ctx context.Context, key string, input ShortenInput) (link Link, created bool, err error) {
+	if key == "" {
+		return s.Shorten(ctx, input)
+	}
+
+	// Las claves se aíslan por propietario para que un usuario no pueda leer enlaces ajenos
+	scopedKey := input.Owner + "\x00" + key
+	fingerprint := shortenFingerprint(input)
+
+	if link, created, found, err := s.replayIdempotent(ctx, scopedKey, fingerprint); found || err != nil {
+		return link, created, err
+	}
+
+	link, created, err = s.Shorten(ctx, input)
+	if err != nil {
+		return Link{}, false, err
+	}
+
+	existing, saved, err := s.store.SaveIdempotencyKey(ctx, IdempotencyRecord{
+		Key:         scopedKey,
+		Fingerprint: fingerprint,
+		ShortCode:   link.Key(),
+		Created:     created,
+		ExpiresAt:   time.Now().Add(s.idempotencyTTL),
+	})
+	if err != nil {
+		return Link{}, false, storeError(err)
+	}
+	if saved {
+		return link, created, nil
+	}
+
+	// Otra petición con la misma clave terminó antes: se descarta el enlace recién creado
+	// para que el reintento no deje duplicados y se responde con el de la ganadora
+	if created {
+		if _, err := s.store.Delete(ctx, link.Key()); err != nil {
+			return Link{}, false, storeError(err)
+		}
+	}
+	if existing.Fingerprint != fingerprint {
+		return Link{}, false, ErrIdempotencyKeyReused
+	}
+	return s.idempotentLink(ctx, existing)
+}
+
+// replayIdempotent busca una respuesta previa para la clave; found es false si no existe
+func (s *Service) replayIdempotent(ctx context.Context, key, fingerprint string) (link Link, created, found bool, err error) {
+	record, found, err := s.store.GetIdempotencyKey(ctx, key)
+	if err != nil {
+		return Link{}, false, false, storeError(err)
+	}
+	if !found {
+		return Link{}, false, false, nil
+	}
+	if record.Fingerprint != fingerprint {
+		return Link{}, false, true, ErrIdempotencyKeyReused
+	}
+	link, created, err = s.idempotentLink(ctx, record)
+	return link, created, true, err
+}
+
+// idempotentLink obtiene el enlace de un registro de idempotencia
+func (s *Service) idempotentLink(ctx context.Context, record IdempotencyRecord) (Link, bool, error) {
+	link, err := s.GetLink(ctx, record.ShortCode)
+	if err != nil {
+		return Link{}, false, err
+	}
+	return link, record.Created, nil
+}
+
+// shortenFingerprint resume los campos de la entrada que determinan el enlace creado. La
+// contraseña solo aporta si existe: su texto no debe quedar en una huella de hash rápido.
+func shortenFingerprint(input ShortenInput) string {
+	if input.Password != "" {
+		input.Password = "***"
+	}
+	// json.Marshal ordena las claves de los mapas, así que la huella es determinista
+	encoded, _ := json.Marshal(input)
+	sum := sha256.Sum256(encoded)
+	return hex.EncodeToString(sum[:])
+}
+
+// GetIdempotencyKey obtiene el registro vigente de una clave; las claves expiradas se eliminan
+func (s *Store) GetIdempotencyKey(ctx context.Context, key string) (IdempotencyRecord, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return IdempotencyRecord{}, false, err
+	}
+	s.idempotencyMu.Lock()
+	defer s.idempotencyMu.Unlock()
+	record, exists := s.idempotency[key]
+	if !exists {
+		return IdempotencyRecord{}, false, nil
+	}
+	if !time.Now().Before(record.ExpiresAt) {
+		delete(s.idempotency, key)
+		return IdempotencyRecord{}, false, nil
+	}
+	return record, true, nil
+}
+
+// SaveIdempotencyKey guarda el registro salvo que la clave tenga uno vigente. Cada
+// idempotencySweepEvery escrituras purga las claves expiradas que nadie volvió a consultar.
+func (s *Store) SaveIdempotencyKey(ctx context.Context, record IdempotencyRecord) (IdempotencyRecord, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return IdempotencyRecord{}, false, err
+	}
+	s.idempotencyMu.Lock()
+	defer s.idempotencyMu.Unlock()
+
+	now := time.Now()
+	if existing, exists := s.idempotency[record.Key]; exists && now.Before(existing.ExpiresAt) {
+		return existing, false, nil
+	}
+	s.idempotency[record.Key] = record
+
+	if s.idempotencySaves++; s.idempotencySaves >= idempotencySweepEvery {
+		s.idempotencySaves = 0
+		for key, existing := range s.idempotency {
+			if !now.Before(existing.ExpiresAt) {
+				delete(s.idempotency, key)
+			}
+		}
+	}
+	return record, true, nil
+}
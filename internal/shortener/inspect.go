@@ -0,0 +1,121 @@
+package shortener
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+)
+
+// Veredictos de seguridad de InspectLink, de más a menos grave
+const (
+	// VerdictMalicious indica que el proveedor de reputación marca algún destino como amenaza
+	VerdictMalicious = "malicious"
+	// VerdictBlocked indica que la política de dominios vigente rechaza algún destino, p. ej.
+	// porque la lista de bloqueo se actualizó después de crear el enlace
+	VerdictBlocked = "blocked"
+	// VerdictSuspicious indica que el enlace está en cuarentena por denuncias o por una revisión
+	// anterior, aunque ahora ningún destino esté marcado
+	VerdictSuspicious = "suspicious"
+	// VerdictUnknown indica que el proveedor de reputación no respondió y no hay otros indicios
+	VerdictUnknown = "unknown"
+	// VerdictSafe indica que ninguna comprobación encontró problemas
+	VerdictSafe = "safe"
+)
+
+// Resultados de la consulta al proveedor de reputación (Inspection.ThreatCheck)
+const (
+	ThreatCheckClean       = "clean"
+	ThreatCheckMalicious   = "malicious"
+	ThreatCheckUnavailable = "unavailable"
+	ThreatCheckDisabled    = "disabled"
+)
+
+// Inspection es el resultado de inspeccionar un enlace sin seguir la redirección
+type Inspection struct {
+	Link Link
+	// Verdict resume las comprobaciones con uno de los veredictos Verdict*
+	Verdict string
+	// ThreatCheck es el resultado de la consulta al proveedor de reputación (ThreatCheck*)
+	ThreatCheck string
+	// Findings son los destinos bloqueados o marcados como amenaza
+	Findings []InspectionFinding
+}
+
+// InspectionFinding es un destino que no superó una comprobación
+type InspectionFinding struct {
+	// Field es el campo del enlace con el destino (long_url, geo_targets.DE, variants[0].url...)
+	Field string
+	URL   string
+	// Verdict es VerdictBlocked o VerdictMalicious
+	Verdict string
+	Reason  string
+}
+
+// InspectLink comprueba todos los destinos web del enlace contra la política de dominios y el
+// proveedor de reputación, para que las pasarelas de correo puedan resolver enlaces antes de
+// entregarlos. No contabiliza una visita ni consume cuota, y los destinos de los enlaces con
+// contraseña o desactivados también se comprueban aunque el llamador no deba verlos.
+func (s *Service) InspectLink(ctx context.Context, shortCode string) (Inspection, error) {
+	link, err := s.GetLink(ctx, shortCode)
+	if err != nil {
+		return Inspection{}, err
+	}
+	inspection := Inspection{Link: link, ThreatCheck: ThreatCheckDisabled}
+	targets := threatTargets(link)
+
+	policy := s.domainPolicy.Load()
+	for _, target := range targets {
+		parsed, err := url.Parse(target.url)
+		if err != nil {
+			continue
+		}
+		if reason := policy.check(parsed.Hostname()); reason != "" {
+			inspection.Findings = append(inspection.Findings, InspectionFinding{Field: target.field, URL: target.url,
+				Verdict: VerdictBlocked, Reason: reason})
+		}
+	}
+
+	if s.threatChecker != nil {
+		inspection.ThreatCheck = s.inspectThreats(ctx, targets, &inspection)
+	}
+
+	switch {
+	case inspection.ThreatCheck == ThreatCheckMalicious:
+		inspection.Verdict = VerdictMalicious
+	case len(inspection.Findings) > 0:
+		inspection.Verdict = VerdictBlocked
+	case link.Quarantined:
+		inspection.Verdict = VerdictSuspicious
+	case inspection.ThreatCheck == ThreatCheckUnavailable:
+		inspection.Verdict = VerdictUnknown
+	default:
+		inspection.Verdict = VerdictSafe
+	}
+	return inspection, nil
+}
+
+// inspectThreats consulta cada destino al proveedor, acotado como al crear enlaces, y agrega a
+// inspection los marcados. Un fallo en cualquier destino sin amenazas en el resto deja el
+// resultado como no disponible.
+func (s *Service) inspectThreats(ctx context.Context, targets []threatTarget, inspection *Inspection) string {
+	if s.threatTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.threatTimeout)
+		defer cancel()
+	}
+	result := ThreatCheckClean
+	for _, target := range targets {
+		verdict, err := s.threatChecker.Check(ctx, target.url)
+		switch {
+		case err != nil:
+			if result == ThreatCheckClean {
+				result = ThreatCheckUnavailable
+			}
+		case verdict.Malicious:
+			result = ThreatCheckMalicious
+			inspection.Findings = append(inspection.Findings, InspectionFinding{Field: target.field, URL: target.url,
+				Verdict: VerdictMalicious, Reason: fmt.Sprintf("figura como amenaza (%s) en %s", verdict.Threat, verdict.Source)})
+		}
+	}
+	return result
+}
@@ -0,0 +1,135 @@
+package shortener
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"strconv"
+
+	"acortador-urls/internal/errcode"
+)
+
+// MaxIPAccessRules acota las reglas de red (Allow más Deny) de un enlace
+const MaxIPAccessRules = 50
+
+// ErrIPNotAllowed indica que la IP del visitante no puede resolver el enlace por las reglas
+// de red globales o las del enlace
+var ErrIPNotAllowed = errcode.New(errcode.IPNotAllowed, "IP no permitida")
+
+// IPAccessPolicy restringe las redirecciones según la IP del visitante, p. ej. los enlaces
+// internos que solo deben resolverse desde la red corporativa. Las reglas son IPs o CIDRs;
+// Deny tiene prioridad y, si Allow no está vacío, la IP debe estar en alguna de sus redes.
+type IPAccessPolicy struct {
+	Allow []string
+	Deny  []string
+}
+
+// IsZero indica si la política admite visitas desde cualquier IP
+func (p IPAccessPolicy) IsZero() bool {
+	return len(p.Allow) == 0 && len(p.Deny) == 0
+}
+
+// normalize guarda las reglas como CIDR canónicos (10.1.2.3 es 10.1.2.3/32 y 10.1.2.0/16 es
+// 10.1.0.0/16) y sin repetir. Las reglas inválidas se conservan tal cual para que validate las
+// informe.
+func (p IPAccessPolicy) normalize() IPAccessPolicy {
+	if p.IsZero() {
+		return IPAccessPolicy{}
+	}
+	return IPAccessPolicy{Allow: normalizeIPRules(p.Allow), Deny: normalizeIPRules(p.Deny)}
+}
+
+// normalizeIPRules normaliza una lista de reglas de red
+func normalizeIPRules(rules []string) []string {
+	if len(rules) == 0 {
+		return nil
+	}
+	normalized := make([]string, 0, len(rules))
+	for _, rule := range rules {
+		if prefix, ok := parseIPRule(rule); ok {
+			rule = prefix.String()
+		}
+		if !containsString(normalized, rule) {
+			normalized = append(normalized, rule)
+		}
+	}
+	return normalized
+}
+
+// parseIPRule interpreta una regla de red como CIDR o como IP suelta
+func parseIPRule(rule string) (netip.Prefix, bool) {
+	if prefix, err := netip.ParsePrefix(rule); err == nil {
+		return prefix.Masked(), true
+	}
+	addr, err := netip.ParseAddr(rule)
+	if err != nil {
+		return netip.Prefix{}, false
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), true
+}
+
+// validate comprueba que las reglas sean IPs o CIDRs y no superen MaxIPAccessRules
+func (p IPAccessPolicy) validate() error {
+	var errs []error
+	if total := len(p.Allow) + len(p.Deny); total > MaxIPAccessRules {
+		errs = append(errs, &ValidationError{Field: "ip_access", Value: total,
+			Msg: fmt.Sprintf("no puede tener más de %d reglas", MaxIPAccessRules)})
+	}
+	errs = append(errs, validateIPRules("ip_access.allow", p.Allow)...)
+	errs = append(errs, validateIPRules("ip_access.deny", p.Deny)...)
+	return errors.Join(errs...)
+}
+
+// validateIPRules retorna un *ValidationError por cada regla inválida de la lista field
+func validateIPRules(field string, rules []string) []error {
+	var errs []error
+	for i, rule := range rules {
+		if _, ok := parseIPRule(rule); !ok {
+			errs = append(errs, &ValidationError{Field: field + "[" + strconv.Itoa(i) + "]", Value: rule,
+				Msg: "debe ser una IP o un CIDR como 10.0.0.0/8"})
+		}
+	}
+	return errs
+}
+
+// allows indica si una visita desde ip puede redirigir. Una IP desconocida solo se admite si
+// la política no tiene Allow, ya que no se puede comprobar que pertenezca a la red permitida.
+func (p IPAccessPolicy) allows(ip netip.Addr) bool {
+	if p.IsZero() {
+		return true
+	}
+	if !ip.IsValid() {
+		return len(p.Allow) == 0
+	}
+	ip = ip.Unmap()
+	if matchIPRules(p.Deny, ip) {
+		return false
+	}
+	return len(p.Allow) == 0 || matchIPRules(p.Allow, ip)
+}
+
+// matchIPRules indica si ip pertenece a alguna de las redes; las reglas inválidas no coinciden
+func matchIPRules(rules []string, ip netip.Addr) bool {
+	for _, rule := range rules {
+		if prefix, ok := parseIPRule(rule); ok && prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// WithIPAccess aplica reglas de red a las redirecciones de todos los enlaces, además de las de
+// cada enlace; basta con que unas u otras rechacen la IP para que la visita se rechace
+func WithIPAccess(policy IPAccessPolicy) ServiceOption {
+	return func(s *Service) {
+		s.ipAccess = policy.normalize()
+	}
+}
+
+// AllowsIP indica si una visita desde ip puede resolver el enlace según las reglas de red
+// globales y las del enlace. Las vistas públicas del enlace lo usan para no revelar el destino
+// fuera de la red permitida.
+func (s *Service) AllowsIP(link Link, ip netip.Addr) bool {
+	return s.ipAccess.allows(ip) && link.IPAccess.allows(ip)
+}
@@ -0,0 +1,261 @@
+package shortener
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Límites de paginación de ListLinks
+const (
+	DefaultListLimit = 20
+	MaxListLimit     = 100
+)
+
+// Estados por los que se puede filtrar un listado
+const (
+	ListStatusActive   = "active"
+	ListStatusExpired  = "expired"
+	ListStatusDisabled = "disabled"
+	// ListStatusBroken son los enlaces cuyo destino se marcó como roto
+	ListStatusBroken = "broken"
+)
+
+// ListSortFields son los campos por los que se puede ordenar un listado; con el prefijo "-"
+// el orden es descendente
+var ListSortFields = []string{"created_at", "updated_at", "expires_at", "clicks", "short_code", "long_url"}
+
+// ListQuery describe una página de enlaces filtrada y ordenada. Los backends SQL la traducen
+// a WHERE / ORDER BY / LIMIT OFFSET sobre columnas indexadas.
+type ListQuery struct {
+	// Owner restringe el listado a un propietario; se ignora si AnyOwner es true
+	Owner    string
+	AnyOwner bool
+	// Workspace agrega al listado de Owner los enlaces de ese espacio compartido
+	Workspace string
+	// Tenant es el espacio de códigos listado; vacío es el espacio común. Se aplica siempre,
+	// también a los administradores.
+	Tenant string
+	// Domain filtra por el host de la URL larga, incluidos sus subdominios
+	Domain string
+	// Tag filtra por los enlaces con esa etiqueta
+	Tag string
+	// CollectionID filtra por los enlaces de esa colección
+	CollectionID int64
+	// Status filtra por enlaces vigentes (active), expirados (expired), desactivados
+	// (disabled) o con el destino roto (broken); vacío incluye todos
+	Status string
+	// Sort es el campo de orden, p. ej. "created_at" o "-clicks"; vacío equivale a created_at
+	Sort string
+	// Offset y Limit delimitan la página
+	Offset int
+	Limit  int
+}
+
+// LinkPage es una página de un listado con el total de enlaces que cumplen el filtro
+type LinkPage struct {
+	Links []Link
+	Total int
+}
+
+// ListLinks retorna una página de enlaces. Los administradores pueden listar todos los enlaces;
+// el resto de usuarios solo los propios, más los de su espacio compartido si son editores, y
+// recibe ErrForbidden si filtra por otro propietario.
+func (s *Service) ListLinks(ctx context.Context, actor Actor, query ListQuery) (LinkPage, error) {
+	if !actor.Admin {
+		if !query.AnyOwner && query.Owner != actor.UserID {
+			return LinkPage{}, ErrForbidden
+		}
+		query.AnyOwner = false
+		query.Owner = actor.UserID
+		query.Workspace = actor.Workspace
+	}
+	if query.Limit == 0 {
+		query.Limit = DefaultListLimit
+	}
+	if err := query.validate(); err != nil {
+		return LinkPage{}, err
+	}
+	query.Domain = strings.ToLower(strings.TrimPrefix(query.Domain, "."))
+	query.Tag = normalizeTag(query.Tag)
+
+	page, err := s.store.List(ctx, query)
+	if err != nil {
+		return LinkPage{}, storeError(err)
+	}
+	return page, nil
+}
+
+// validate comprueba orden, estado, etiqueta y límites de la consulta
+func (q ListQuery) validate() error {
+	var errs []error
+	if q.Sort != "" && !isListSortField(strings.TrimPrefix(q.Sort, "-")) {
+		errs = append(errs, &ValidationError{Field: "sort", Value: q.Sort,
+			Msg: fmt.Sprintf("debe ser uno de %s, con '-' para orden descendente", strings.Join(ListSortFields, ", "))})
+	}
+	switch q.Status {
+	case "", ListStatusActive, ListStatusExpired, ListStatusDisabled, ListStatusBroken:
+	default:
+		errs = append(errs, &ValidationError{Field: "status", Value: q.Status, Msg: "debe ser active, expired, disabled o broken"})
+	}
+	if q.Tag != "" {
+		if err := validateTag(normalizeTag(q.Tag)); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if q.Offset < 0 {
+		errs = append(errs, &ValidationError{Field: "page", Value: q.Offset, Msg: "debe ser al menos 1"})
+	}
+	if q.Limit < 1 || q.Limit > MaxListLimit {
+		errs = append(errs, &ValidationError{Field: "per_page", Value: q.Limit, Msg: fmt.Sprintf("debe estar entre 1 y %d", MaxListLimit)})
+	}
+	return errors.Join(errs...)
+}
+
+// isListSortField indica si field admite ordenación
+func isListSortField(field string) bool {
+	for _, candidate := range ListSortFields {
+		if candidate == field {
+			return true
+		}
+	}
+	return false
+}
+
+// matches indica si el enlace cumple los filtros de la consulta
+func (q ListQuery) matches(link Link, now time.Time) bool {
+	if link.Tenant != q.Tenant {
+		return false
+	}
+	if !q.AnyOwner && link.Owner != q.Owner && (q.Workspace == "" || link.Workspace != q.Workspace) {
+		return false
+	}
+	switch q.Status {
+	case ListStatusActive:
+		if link.IsExpired(now) || link.IsDisabled() {
+			return false
+		}
+	case ListStatusExpired:
+		if !link.IsExpired(now) {
+			return false
+		}
+	case ListStatusDisabled:
+		if !link.IsDisabled() {
+			return false
+		}
+	case ListStatusBroken:
+		if !link.Health.Broken {
+			return false
+		}
+	}
+	if q.Tag != "" && !link.HasTag(q.Tag) {
+		return false
+	}
+	if q.CollectionID != 0 && link.CollectionID != q.CollectionID {
+		return false
+	}
+	if q.Domain != "" {
+		parsed, err := url.Parse(link.LongURL)
+		if err != nil {
+			return false
+		}
+		host := strings.ToLower(parsed.Hostname())
+		if host != q.Domain && !strings.HasSuffix(host, "."+q.Domain) {
+			return false
+		}
+	}
+	return true
+}
+
+// sortLinks ordena los enlaces según q.Sort usando el código corto como desempate, de modo
+// que las páginas son estables entre peticiones
+func (q ListQuery) sortLinks(links []Link) {
+	field, desc := strings.TrimPrefix(q.Sort, "-"), strings.HasPrefix(q.Sort, "-")
+	compare := func(a, b Link) int {
+		switch field {
+		case "updated_at":
+			return a.UpdatedAt.Compare(b.UpdatedAt)
+		case "expires_at":
+			return a.ExpiresAt.Compare(b.ExpiresAt)
+		case "clicks":
+			return compareInt64(a.Clicks, b.Clicks)
+		case "short_code":
+			return 0
+		case "long_url":
+			return strings.Compare(a.LongURL, b.LongURL)
+		default:
+			return a.CreatedAt.Compare(b.CreatedAt)
+		}
+	}
+	sort.Slice(links, func(i, j int) bool {
+		c := compare(links[i], links[j])
+		if c == 0 {
+			c = strings.Compare(links[i].ShortCode, links[j].ShortCode)
+		}
+		if desc {
+			return c > 0
+		}
+		return c < 0
+	})
+}
+
+// compareInt64 compara dos enteros al estilo de strings.Compare
+func compareInt64(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// List retorna la página de enlaces que cumple la consulta. Filtra bajo el lock de lectura y
+// ordena fuera de él; solo se copian los enlaces que cumplen el filtro. Con Tag solo se
+// revisan los enlaces del índice de etiquetas.
+func (s *Store) List(ctx context.Context, query ListQuery) (LinkPage, error) {
+	if err := ctx.Err(); err != nil {
+		return LinkPage{}, err
+	}
+	now := time.Now()
+	s.mu.RLock()
+	links := make([]Link, 0)
+	if query.Tag != "" {
+		for key := range s.tags[TenantKey(query.Tenant, query.Tag)] {
+			if link := s.urls[key]; query.matches(link, now) {
+				links = append(links, link)
+			}
+		}
+	} else {
+		for _, link := range s.urls {
+			if query.matches(link, now) {
+				links = append(links, link)
+			}
+		}
+	}
+	s.mu.RUnlock()
+	return query.Page(links), nil
+}
+
+// Page ordena los enlaces que cumplen la consulta y retorna la página pedida. Lo usan también
+// los almacenes que reparten los enlaces entre varios backends para combinar sus resultados.
+func (q ListQuery) Page(links []Link) LinkPage {
+	q.sortLinks(links)
+	page := LinkPage{Total: len(links)}
+	if q.Offset < len(links) {
+		end := q.Offset + q.Limit
+		if end > len(links) {
+			end = len(links)
+		}
+		page.Links = links[q.Offset:end]
+	}
+	if page.Links == nil {
+		page.Links = []Link{}
+	}
+	return page
+}
@@ -0,0 +1,287 @@
+package shortener
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"acortador-urls/internal/errcode"
+)
+
+// Límites de la obtención de metadatos Open Graph
+const (
+	DefaultMetadataTimeout  = 5 * time.Second
+	DefaultMetadataMaxBytes = 512 << 10
+	DefaultMetadataTTL      = 24 * time.Hour
+	metadataQueueSize       = 1000
+
+	maxMetadataTitle       = 300
+	maxMetadataDescription = 1000
+	maxMetadataImageURL    = 2048
+)
+
+// Errores de la vista previa enriquecida
+var (
+	// ErrMetadataDisabled indica que el servicio no obtiene metadatos de los destinos
+	ErrMetadataDisabled = errcode.New(errcode.MetadataDisabled, "vista previa enriquecida desactivada")
+	// ErrMetadataUnavailable indica que no se pudieron obtener los metadatos del destino
+	ErrMetadataUnavailable = errcode.New(errcode.MetadataUnavailable, "no se pudieron obtener los metadatos del destino")
+)
+
+// LinkMetadata son el título, la descripción y la imagen del destino de un enlace, tomados de
+// sus etiquetas Open Graph (o Twitter Card, o el <title> de la página)
+type LinkMetadata struct {
+	// FetchedAt es el momento de la obtención; cero si nunca se obtuvo
+	FetchedAt   time.Time
+	Title       string
+	Description string
+	// Image es la URL absoluta de og:image
+	Image string
+	// Error describe el fallo de la última obtención, si lo hubo
+	Error string
+}
+
+// Fetched indica si los metadatos se obtuvieron alguna vez, con éxito o no
+func (m LinkMetadata) Fetched() bool {
+	return !m.FetchedAt.IsZero()
+}
+
+// MetadataFetcher obtiene los metadatos de la página de destino
+type MetadataFetcher interface {
+	Fetch(ctx context.Context, rawURL string) (LinkMetadata, error)
+}
+
+// MetadataFetcherFunc adapta una función a MetadataFetcher
+type MetadataFetcherFunc func(ctx context.Context, rawURL string) (LinkMetadata, error)
+
+// Fetch implementa MetadataFetcher
+func (f MetadataFetcherFunc) Fetch(ctx context.Context, rawURL string) (LinkMetadata, error) {
+	return f(ctx, rawURL)
+}
+
+// HTMLMetadataFetcher descarga el comienzo de la página de destino y extrae sus metadatos
+type HTMLMetadataFetcher struct {
+	client   *http.Client
+	maxBytes int64
+}
+
+// NewHTMLMetadataFetcher crea un MetadataFetcher que lee como máximo maxBytes de cada página en
+// timeout. Salvo allowPrivate, se niega a conectar con direcciones internas aunque se llegue a
+// ellas por redirección.
+func NewHTMLMetadataFetcher(timeout time.Duration, maxBytes int64, allowPrivate bool) *HTMLMetadataFetcher {
+	return &HTMLMetadataFetcher{client: safeHTTPClient(timeout, allowPrivate), maxBytes: maxBytes}
+}
+
+// Fetch implementa MetadataFetcher. Las páginas que no son HTML no tienen metadatos y no se
+// consideran un error.
+func (f *HTMLMetadataFetcher) Fetch(ctx context.Context, rawURL string) (LinkMetadata, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return LinkMetadata{}, err
+	}
+	req.Header.Set("User-Agent", "acortador-urls/1.0 (vista previa de enlaces)")
+	req.Header.Set("Accept", "text/html,application/xhtml+xml;q=0.9,*/*;q=0.1")
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return LinkMetadata{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return LinkMetadata{}, fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	if contentType := resp.Header.Get("Content-Type"); contentType != "" && !strings.Contains(contentType, "html") {
+		return LinkMetadata{}, nil
+	}
+	// La cabecera está al principio: una página truncada conserva sus metadatos
+	body, err := io.ReadAll(io.LimitReader(resp.Body, f.maxBytes))
+	if err != nil {
+		return LinkMetadata{}, err
+	}
+	return parseMetadata(string(body), resp.Request.URL), nil
+}
+
+// Expresiones de parseMetadata. No es un parser HTML completo, pero basta para las etiquetas
+// <title> y <meta> de la cabecera.
+var (
+	metaTagPattern   = regexp.MustCompile(`(?is)<meta\s[^>]*>`)
+	attributePattern = regexp.MustCompile(`(?is)([a-z_:-]+)\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'>]+))`)
+	titlePattern     = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+)
+
+// parseMetadata extrae los metadatos de la página. Las etiquetas Open Graph tienen prioridad
+// sobre las de Twitter Card y estas sobre <title> y la descripción estándar. La imagen se
+// resuelve respecto a base y solo se conserva si es http(s).
+func parseMetadata(document string, base *url.URL) LinkMetadata {
+	values := make(map[string]string)
+	for _, tag := range metaTagPattern.FindAllString(document, -1) {
+		attrs := make(map[string]string)
+		for _, m := range attributePattern.FindAllStringSubmatch(tag, -1) {
+			attrs[strings.ToLower(m[1])] = m[2] + m[3] + m[4]
+		}
+		key := attrs["property"]
+		if key == "" {
+			key = attrs["name"]
+		}
+		key = strings.ToLower(key)
+		if _, seen := values[key]; key != "" && !seen {
+			values[key] = attrs["content"]
+		}
+	}
+	if m := titlePattern.FindStringSubmatch(document); m != nil {
+		values["title"] = m[1]
+	}
+
+	first := func(keys ...string) string {
+		for _, key := range keys {
+			if v := cleanMetadata(values[key]); v != "" {
+				return v
+			}
+		}
+		return ""
+	}
+	metadata := LinkMetadata{
+		Title:       truncateRunes(first("og:title", "twitter:title", "title"), maxMetadataTitle),
+		Description: truncateRunes(first("og:description", "twitter:description", "description"), maxMetadataDescription),
+	}
+	if image := first("og:image", "og:image:url", "twitter:image"); image != "" {
+		if ref, err := url.Parse(image); err == nil && base != nil {
+			resolved := base.ResolveReference(ref)
+			if (resolved.Scheme == "http" || resolved.Scheme == "https") && len(resolved.String()) <= maxMetadataImageURL {
+				metadata.Image = resolved.String()
+			}
+		}
+	}
+	return metadata
+}
+
+// cleanMetadata decodifica las entidades HTML y colapsa los espacios
+func cleanMetadata(value string) string {
+	return strings.Join(strings.Fields(html.UnescapeString(value)), " ")
+}
+
+// truncateRunes recorta value a max caracteres sin partir ninguno
+func truncateRunes(value string, max int) string {
+	if utf8.RuneCountInString(value) <= max {
+		return value
+	}
+	return string([]rune(value)[:max])
+}
+
+// WithMetadataFetcher activa la vista previa enriquecida: los metadatos de cada destino se
+// obtienen con fetcher bajo demanda y se guardan durante ttl. Con onCreate los enlaces creados
+// o editados se encolan además para RunMetadataWorker.
+func WithMetadataFetcher(fetcher MetadataFetcher, ttl time.Duration, onCreate bool) ServiceOption {
+	return func(s *Service) {
+		s.metadataFetcher = fetcher
+		s.metadataTTL = ttl
+		if onCreate {
+			s.metadataQueue = make(chan string, metadataQueueSize)
+		}
+	}
+}
+
+// enqueueMetadata encola el enlace para obtener sus metadatos en segundo plano. Si la cola está
+// llena se descarta: los metadatos se obtendrán en la primera consulta.
+func (s *Service) enqueueMetadata(shortCode string) {
+	if s.metadataQueue == nil {
+		return
+	}
+	select {
+	case s.metadataQueue <- shortCode:
+	default:
+	}
+}
+
+// RunMetadataWorker obtiene los metadatos de los enlaces encolados hasta que se cancela ctx
+func (s *Service) RunMetadataWorker(ctx context.Context) {
+	if s.metadataQueue == nil {
+		return
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case code := <-s.metadataQueue:
+			if link, err := s.GetLink(ctx, code); err == nil {
+				s.refreshMetadata(ctx, link)
+			}
+		}
+	}
+}
+
+// FetchMetadata retorna los metadatos del destino de un enlace, obteniéndolos si no se tienen o
+// han caducado. refresh fuerza una nueva obtención y solo lo puede pedir quien gestiona el
+// enlace. Los enlaces desactivados, expirados, con contraseña o firmados no revelan su destino.
+func (s *Service) FetchMetadata(ctx context.Context, actor Actor, shortCode string, refresh bool) (Link, error) {
+	if s.metadataFetcher == nil {
+		return Link{}, ErrMetadataDisabled
+	}
+	link, err := s.GetLink(ctx, shortCode)
+	if err != nil {
+		return Link{}, err
+	}
+	switch {
+	case link.IsDisabled():
+		return Link{}, ErrLinkDisabled
+	case link.IsExpired(time.Now()):
+		return Link{}, ErrURLExpired
+	case link.PasswordProtected():
+		return Link{}, ErrPasswordRequired
+	case link.Signed:
+		return Link{}, ErrSignatureRequired
+	case refresh && !actor.canManage(link):
+		return Link{}, ErrForbidden
+	}
+
+	if refresh || !link.Metadata.Fetched() || time.Since(link.Metadata.FetchedAt) >= s.metadataTTL {
+		link.Metadata = s.refreshMetadata(ctx, link)
+		if err := ctx.Err(); err != nil {
+			return Link{}, err
+		}
+	}
+	if link.Metadata.Error != "" {
+		return link, fmt.Errorf("%w: %s", ErrMetadataUnavailable, link.Metadata.Error)
+	}
+	return link, nil
+}
+
+// refreshMetadata obtiene y guarda los metadatos del destino. Los fallos también se guardan
+// para no repetir la petición en cada consulta hasta que caduquen.
+func (s *Service) refreshMetadata(ctx context.Context, link Link) LinkMetadata {
+	metadata, err := s.metadataFetcher.Fetch(ctx, link.LongURL)
+	if err != nil {
+		metadata = LinkMetadata{Error: err.Error()}
+	}
+	metadata.FetchedAt = time.Now()
+	if ctx.Err() == nil {
+		s.store.SetMetadata(ctx, link.Key(), link.LongURL, metadata)
+	}
+	return metadata
+}
+
+// SetMetadata guarda los metadatos del destino si el enlace existe y su URL larga sigue siendo
+// longURL; updated es false en otro caso, p. ej. si se editó durante la obtención
+func (s *Store) SetMetadata(ctx context.Context, shortCode, longURL string, metadata LinkMetadata) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	link, exists := s.urls[shortCode]
+	if !exists || link.LongURL != longURL {
+		return false, nil
+	}
+	previous := link
+	link.Metadata = metadata
+	s.urls[shortCode] = link
+	s.trackLocked(previous, link)
+	return true, nil
+}
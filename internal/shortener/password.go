@@ -0,0 +1,191 @@
+package shortener
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"acortador-urls/internal/errcode"
+)
+
+// Límites de las contraseñas de enlaces protegidos
+const (
+	MinPasswordLength = 4
+	MaxPasswordLength = 128
+)
+
+// passwordIterations es el costo de PBKDF2-HMAC-SHA256 para las contraseñas nuevas
+const passwordIterations = 120000
+
+// passwordSaltLength es el tamaño en bytes de la sal aleatoria de cada contraseña
+const passwordSaltLength = 16
+
+// Bloqueo de un enlace protegido tras contraseñas incorrectas: MaxPasswordFailures fallos en
+// PasswordLockout desde el primero bloquean el enlace hasta que termina ese periodo
+const (
+	MaxPasswordFailures = 10
+	PasswordLockout     = 15 * time.Minute
+)
+
+// Errores de los enlaces protegidos con contraseña
+var (
+	ErrPasswordRequired = errcode.New(errcode.PasswordRequired, "el enlace requiere contraseña")
+	ErrInvalidPassword  = errcode.New(errcode.InvalidPassword, "contraseña incorrecta")
+	ErrPasswordLocked   = errcode.New(errcode.PasswordLocked, "demasiados intentos de contraseña")
+)
+
+// PasswordLockedError acompaña a ErrPasswordLocked con el momento en que se vuelven a admitir
+// contraseñas
+type PasswordLockedError struct {
+	Until time.Time
+}
+
+func (e *PasswordLockedError) Error() string {
+	return fmt.Sprintf("%v hasta %s", ErrPasswordLocked, e.Until.UTC().Format(time.RFC3339))
+}
+
+// Unwrap permite comprobar el error con errors.Is(err, ErrPasswordLocked)
+func (e *PasswordLockedError) Unwrap() error {
+	return ErrPasswordLocked
+}
+
+// passwordFailure son los fallos de un enlace desde since
+type passwordFailure struct {
+	count int
+	since time.Time
+}
+
+// passwordFailures cuenta las contraseñas incorrectas de cada enlace protegido, en esta
+// instancia, para que la fuerza bruta no pueda probar más de MaxPasswordFailures contraseñas por
+// enlace y periodo sin importar desde cuántas IPs llegue. Solo tiene entradas de enlaces
+// protegidos existentes, y las vencidas se descartan al registrar fallos.
+type passwordFailures struct {
+	mu      sync.Mutex
+	entries map[string]passwordFailure
+}
+
+// check retorna un *PasswordLockedError si el enlace está bloqueado; se llama antes de derivar
+// la contraseña para que los intentos bloqueados no cuesten PBKDF2
+func (p *passwordFailures) check(key string, now time.Time) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	entry, ok := p.entries[key]
+	if !ok || entry.count < MaxPasswordFailures {
+		return nil
+	}
+	if until := entry.since.Add(PasswordLockout); now.Before(until) {
+		return &PasswordLockedError{Until: until}
+	}
+	delete(p.entries, key)
+	return nil
+}
+
+// fail registra una contraseña incorrecta
+func (p *passwordFailures) fail(key string, now time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.entries == nil {
+		p.entries = make(map[string]passwordFailure)
+	}
+	entry, ok := p.entries[key]
+	if !ok || now.Sub(entry.since) >= PasswordLockout {
+		// Se aprovecha cada periodo nuevo para descartar los que ya vencieron
+		for other, old := range p.entries {
+			if now.Sub(old.since) >= PasswordLockout {
+				delete(p.entries, other)
+			}
+		}
+		entry = passwordFailure{since: now}
+	}
+	entry.count++
+	p.entries[key] = entry
+}
+
+// reset olvida los fallos de un enlace tras una contraseña correcta
+func (p *passwordFailures) reset(key string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.entries, key)
+}
+
+// hashPassword deriva el hash almacenable de una contraseña con PBKDF2-HMAC-SHA256 y una sal
+// aleatoria. El formato pbkdf2-sha256$iteraciones$sal$hash incluye los parámetros para poder
+// subir el costo sin invalidar los hashes existentes.
+func hashPassword(password string) (string, error) {
+	salt := make([]byte, passwordSaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("no se pudo generar la sal: %w", err)
+	}
+	key := pbkdf2SHA256([]byte(password), salt, passwordIterations, sha256.Size)
+	return fmt.Sprintf("pbkdf2-sha256$%d$%s$%s", passwordIterations,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// checkPassword compara en tiempo constante una contraseña con un hash de hashPassword
+func checkPassword(encoded, password string) bool {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 4 || parts[0] != "pbkdf2-sha256" {
+		return false
+	}
+	iterations, err := strconv.Atoi(parts[1])
+	if err != nil || iterations < 1 {
+		return false
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+	expected, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return false
+	}
+	key := pbkdf2SHA256([]byte(password), salt, iterations, len(expected))
+	return subtle.ConstantTimeCompare(key, expected) == 1
+}
+
+// pbkdf2SHA256 implementa PBKDF2 (RFC 8018) con HMAC-SHA256
+func pbkdf2SHA256(password, salt []byte, iterations, keyLength int) []byte {
+	prf := hmac.New(sha256.New, password)
+	blocks := (keyLength + sha256.Size - 1) / sha256.Size
+	key := make([]byte, 0, blocks*sha256.Size)
+	counter := make([]byte, 4)
+	u := make([]byte, sha256.Size)
+	t := make([]byte, sha256.Size)
+
+	for block := 1; block <= blocks; block++ {
+		binary.BigEndian.PutUint32(counter, uint32(block))
+		prf.Reset()
+		prf.Write(salt)
+		prf.Write(counter)
+		u = prf.Sum(u[:0])
+		copy(t, u)
+
+		for i := 1; i < iterations; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		key = append(key, t...)
+	}
+	return key[:keyLength]
+}
+
+// validatePassword comprueba la longitud de la contraseña de un enlace
+func validatePassword(password string) error {
+	if len(password) < MinPasswordLength || len(password) > MaxPasswordLength {
+		return &ValidationError{Field: "password", Value: "***",
+			Msg: fmt.Sprintf("debe tener entre %d y %d caracteres", MinPasswordLength, MaxPasswordLength)}
+	}
+	return nil
+}
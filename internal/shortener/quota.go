@@ -0,0 +1,95 @@
+package shortener
+
+import (
+	"context"
+	"fmt"
+
+	"acortador-urls/internal/errcode"
+)
+
+// DefaultMaxURLLength es la longitud máxima por defecto de las URLs de destino
+const DefaultMaxURLLength = 2048
+
+// Errores de los límites de almacenamiento
+var (
+	// ErrURLTooLong indica que una URL de destino supera la longitud máxima
+	ErrURLTooLong = errcode.New(errcode.URLTooLong, "URL demasiado larga")
+	// ErrQuotaExceeded indica que el cliente alcanzó su cuota de enlaces almacenados
+	ErrQuotaExceeded = errcode.New(errcode.QuotaExceeded, "cuota de enlaces del cliente agotada")
+	// ErrStoreFull indica que se alcanzó el máximo global de enlaces almacenados
+	ErrStoreFull = errcode.New(errcode.StoreFull, "límite global de enlaces alcanzado")
+)
+
+// WithMaxURLLength cambia la longitud máxima de las URLs de destino (DefaultMaxURLLength por
+// defecto); cero o negativo la elimina
+func WithMaxURLLength(length int) ServiceOption {
+	return func(s *Service) {
+		s.maxURLLength = length
+	}
+}
+
+// WithLinkQuotas limita el número de enlaces almacenados: maxLinks en total y maxPerClient por
+// cliente (ShortenInput.Client). Cero desactiva cada límite. Los enlaces sin cliente, como los
+// importados por un admin, solo cuentan para el límite global.
+func WithLinkQuotas(maxLinks, maxPerClient int) ServiceOption {
+	return func(s *Service) {
+		s.maxLinks = maxLinks
+		s.maxLinksPerClient = maxPerClient
+	}
+}
+
+// lockQuota comprueba las cuotas antes de guardar un enlace del cliente en el tenant. Si hay
+// cuotas retorna con el lock tomado para que peticiones concurrentes no las superen entre la
+// comprobación y la escritura; unlock lo libera y debe llamarse siempre.
+func (s *Service) lockQuota(ctx context.Context, client, tenant string) (unlock func(), err error) {
+	if s.maxLinks <= 0 && s.maxLinksPerClient <= 0 && (s.maxLinksPerTenant <= 0 || tenant == "") {
+		return func() {}, nil
+	}
+	s.quotaMu.Lock()
+	unlock = s.quotaMu.Unlock
+
+	if s.maxLinks > 0 {
+		count, err := s.store.Count(ctx)
+		if err != nil {
+			unlock()
+			return nil, storeError(err)
+		}
+		if count >= s.maxLinks {
+			unlock()
+			return nil, fmt.Errorf("%w: máximo de %d enlaces", ErrStoreFull, s.maxLinks)
+		}
+	}
+	if s.maxLinksPerClient > 0 && client != "" {
+		count, err := s.store.CountByClient(ctx, client)
+		if err != nil {
+			unlock()
+			return nil, storeError(err)
+		}
+		if count >= s.maxLinksPerClient {
+			unlock()
+			return nil, fmt.Errorf("%w: máximo de %d enlaces", ErrQuotaExceeded, s.maxLinksPerClient)
+		}
+	}
+	if s.maxLinksPerTenant > 0 && tenant != "" {
+		count, err := s.store.CountByTenant(ctx, tenant)
+		if err != nil {
+			unlock()
+			return nil, storeError(err)
+		}
+		if count >= s.maxLinksPerTenant {
+			unlock()
+			return nil, fmt.Errorf("%w: máximo de %d enlaces", ErrTenantQuotaExceeded, s.maxLinksPerTenant)
+		}
+	}
+	return unlock, nil
+}
+
+// CountByClient retorna el número de enlaces almacenados creados por el cliente
+func (s *Store) CountByClient(ctx context.Context, client string) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.byClient[client], nil
+}
@@ -0,0 +1,218 @@
+package shortener
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"acortador-urls/internal/errcode"
+)
+
+// Modos de verificación del destino al crear o editar un enlace
+const (
+	// ReachabilityOff no comprueba los destinos
+	ReachabilityOff = "off"
+	// ReachabilityAsync acepta el enlace y comprueba el destino en segundo plano
+	ReachabilityAsync = "async"
+	// ReachabilityReject comprueba el destino antes de guardar y rechaza los inaccesibles
+	ReachabilityReject = "reject"
+)
+
+// Límites de la verificación de destinos
+const (
+	DefaultProbeTimeout   = 5 * time.Second
+	reachabilityQueueSize = 1000
+	maxProbeBodyBytes     = 64 << 10
+)
+
+// ErrUnreachableURL indica que el destino no respondió o respondió con un error
+var ErrUnreachableURL = errcode.New(errcode.UnreachableURL, "destino inaccesible")
+
+// LinkHealth es el resultado de la última comprobación del destino de un enlace
+type LinkHealth struct {
+	// CheckedAt es el momento de la comprobación; cero si nunca se comprobó
+	CheckedAt time.Time
+	// StatusCode es el código HTTP final tras las redirecciones; 0 si no hubo respuesta
+	StatusCode int
+	// Error describe el fallo de red o de protocolo, si lo hubo
+	Error string
+	// Failures cuenta las comprobaciones fallidas consecutivas
+	Failures int
+	// FailingSince es el momento de la primera de esas comprobaciones fallidas
+	FailingSince time.Time
+	// Broken marca el destino como roto tras fallar en brokenAfter comprobaciones seguidas
+	Broken bool
+}
+
+// Checked indica si el destino se comprobó alguna vez
+func (h LinkHealth) Checked() bool {
+	return !h.CheckedAt.IsZero()
+}
+
+// Prober comprueba si un destino responde. statusCode es el código HTTP final; err describe
+// los fallos sin respuesta (DNS, conexión, timeout).
+type Prober interface {
+	Probe(ctx context.Context, rawURL string) (statusCode int, err error)
+}
+
+// HTTPProber comprueba los destinos con HEAD y, si el servidor no lo admite o responde con un
+// error, con GET
+type HTTPProber struct {
+	client *http.Client
+}
+
+// NewHTTPProber crea un Prober HTTP con el timeout indicado por petición. Salvo allowPrivate,
+// se niega a conectar con direcciones internas aunque se llegue a ellas por redirección.
+func NewHTTPProber(timeout time.Duration, allowPrivate bool) *HTTPProber {
+	return &HTTPProber{client: safeHTTPClient(timeout, allowPrivate)}
+}
+
+// Probe implementa Prober
+func (p *HTTPProber) Probe(ctx context.Context, rawURL string) (int, error) {
+	status, err := p.do(ctx, http.MethodHead, rawURL)
+	if err == nil && status < http.StatusBadRequest {
+		return status, nil
+	}
+	// Muchos servidores responden 403, 404 o 405 a HEAD y sirven GET sin problema
+	return p.do(ctx, http.MethodGet, rawURL)
+}
+
+// do envía la petición y retorna el código de estado descartando el cuerpo
+func (p *HTTPProber) do(ctx context.Context, method, rawURL string) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("User-Agent", "acortador-urls/1.0 (verificación de enlaces)")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxProbeBodyBytes))
+	return resp.StatusCode, nil
+}
+
+// WithReachabilityCheck activa la verificación del destino con el modo indicado
+// (ReachabilityAsync o ReachabilityReject). En modo async los enlaces creados o editados se
+// encolan para RunReachabilityWorker.
+func WithReachabilityCheck(mode string, prober Prober) ServiceOption {
+	return func(s *Service) {
+		if mode != ReachabilityAsync && mode != ReachabilityReject {
+			return
+		}
+		s.reachabilityMode = mode
+		s.prober = prober
+		if mode == ReachabilityAsync {
+			s.reachabilityQueue = make(chan string, reachabilityQueueSize)
+		}
+	}
+}
+
+// probeHealth comprueba el destino y calcula su estado a partir del anterior
+func (s *Service) probeHealth(ctx context.Context, rawURL string, previous LinkHealth) LinkHealth {
+	status, err := s.prober.Probe(ctx, rawURL)
+	health := LinkHealth{CheckedAt: time.Now(), StatusCode: status}
+	if err != nil {
+		health.Error = err.Error()
+	}
+	if err != nil || status >= http.StatusBadRequest {
+		health.Failures = previous.Failures + 1
+		health.FailingSince = previous.FailingSince
+		if health.Failures == 1 {
+			health.FailingSince = health.CheckedAt
+		}
+	}
+	health.Broken = health.Failures > 0 && health.Failures >= s.brokenAfter
+	return health
+}
+
+// verifyReachability comprueba el destino antes de guardarlo en modo reject y retorna su
+// estado; en los demás modos no hace nada
+func (s *Service) verifyReachability(ctx context.Context, longURL string) (LinkHealth, error) {
+	if s.reachabilityMode != ReachabilityReject {
+		return LinkHealth{}, nil
+	}
+	health := s.probeHealth(ctx, longURL, LinkHealth{})
+	if err := ctx.Err(); err != nil {
+		return LinkHealth{}, err
+	}
+	if health.Failures > 0 {
+		reason := health.Error
+		if reason == "" {
+			reason = fmt.Sprintf("HTTP %d", health.StatusCode)
+		}
+		return LinkHealth{}, &ValidationError{Field: "long_url", Value: longURL, Err: ErrUnreachableURL,
+			Msg: fmt.Sprintf("el destino no responde correctamente (%s)", reason)}
+	}
+	return health, nil
+}
+
+// enqueueReachability encola el enlace para comprobarlo en segundo plano. Si la cola está
+// llena se descarta: el enlace queda sin comprobar hasta que vuelva a editarse.
+func (s *Service) enqueueReachability(shortCode string) {
+	if s.reachabilityQueue == nil {
+		return
+	}
+	select {
+	case s.reachabilityQueue <- shortCode:
+	default:
+	}
+}
+
+// RunReachabilityWorker comprueba los destinos encolados en modo async hasta que se cancela
+// ctx. Los fallos de una comprobación no detienen al worker.
+func (s *Service) RunReachabilityWorker(ctx context.Context) {
+	if s.reachabilityQueue == nil {
+		return
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case code := <-s.reachabilityQueue:
+			s.CheckReachability(ctx, code)
+		}
+	}
+}
+
+// CheckReachability comprueba ahora el destino de un enlace y guarda el resultado
+func (s *Service) CheckReachability(ctx context.Context, shortCode string) (LinkHealth, error) {
+	if s.prober == nil {
+		return LinkHealth{}, nil
+	}
+	link, err := s.GetLink(ctx, shortCode)
+	if err != nil {
+		return LinkHealth{}, err
+	}
+
+	health := s.probeHealth(ctx, link.LongURL, link.Health)
+	if err := ctx.Err(); err != nil {
+		return LinkHealth{}, err
+	}
+	if _, err := s.store.SetHealth(ctx, link.Key(), link.LongURL, health); err != nil {
+		return LinkHealth{}, storeError(err)
+	}
+	return health, nil
+}
+
+// SetHealth guarda el estado del destino si el enlace existe y su URL larga sigue siendo
+// longURL; updated es false en otro caso, p. ej. si se editó durante la comprobación
+func (s *Store) SetHealth(ctx context.Context, shortCode, longURL string, health LinkHealth) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	link, exists := s.urls[shortCode]
+	if !exists || link.LongURL != longURL {
+		return false, nil
+	}
+	previous := link
+	link.Health = health
+	s.urls[shortCode] = link
+	s.trackLocked(previous, link)
+	return true, nil
+}
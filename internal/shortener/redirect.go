@@ -0,0 +1,509 @@
+package shortener
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"acortador-urls/internal/geo"
+)
+
+// RedirectRequest reúne los datos de la visita que influyen en el destino de una redirección
+type RedirectRequest struct {
+	// Query son los parámetros de la URL corta visitada
+	Query url.Values
+	// Password es la contraseña aportada por el visitante para los enlaces protegidos
+	Password string
+	// ClientIP es la IP del visitante; se geolocaliza solo si el enlace tiene GeoTargets o se
+	// pide con Locate
+	ClientIP netip.Addr
+	// Country es el país ya conocido del visitante (p. ej. por una cabecera del CDN); si está
+	// vacío se usa el geo.Resolver del servicio
+	Country string
+	// UserAgent identifica el dispositivo del visitante para los enlaces con DeviceTargets
+	UserAgent string
+	// Variant es la variante A/B asignada previamente al visitante (p. ej. desde una cookie);
+	// se respeta si el enlace la sigue teniendo
+	Variant string
+	// Locate pide el país del visitante (Redirect.Country) para las estadísticas aunque el
+	// enlace no tenga GeoTargets
+	Locate bool
+	// Referrer es el host de la cabecera Referer; vacío si la visita no la trae. Se compara con
+	// las procedencias permitidas del enlace.
+	Referrer string
+}
+
+// Redirect es el resultado de resolver una visita
+type Redirect struct {
+	// URL es el destino final con las reglas del enlace aplicadas
+	URL string
+	// Variant es la variante A/B servida; vacía si el enlace no tiene variantes o la visita
+	// recibió un destino por dispositivo o país
+	Variant string
+	// Sticky indica que la variante debe recordarse para las próximas visitas
+	Sticky bool
+	// Interstitial indica que antes de redirigir se debe mostrar la página de aviso
+	Interstitial bool
+	// Quarantined indica que el enlace está en cuarentena por denuncias; la página de aviso
+	// debe advertirlo y no continuar sola
+	Quarantined bool
+	// Bot indica que la visita es de un bot o rastreador según su User-Agent (ver IsBot)
+	Bot bool
+	// Country es el país del visitante si se conoce y se pidió con Locate o hizo falta para
+	// elegir el destino
+	Country string
+	// Permanent indica que el enlace se creó con redirección permanente (RedirectPermanent)
+	Permanent bool
+	// Cloak es la página que se sirve en lugar de la redirección, con las etiquetas vacías
+	// completadas con los metadatos del destino; vacío si el enlace redirige con normalidad
+	Cloak Cloak
+	// Cacheable indica que la misma URL corta lleva siempre al mismo destino y la redirección
+	// puede guardarse en caché; es falso si el destino depende del visitante (variantes,
+	// dispositivo, país, contraseña, procedencia, red o firma)
+	Cacheable bool
+	// ValidUntil es el momento a partir del cual el destino puede cambiar por sí solo: la
+	// expiración del enlace o el cambio de día de los UTM con {date}. Cero si no cambia.
+	ValidUntil time.Time
+}
+
+// Tipos de redirección de un enlace (Link.RedirectType)
+const (
+	// RedirectTemporary responde 307 y es el tipo por defecto: el destino puede cambiar y cada
+	// visita llega al servidor y se contabiliza
+	RedirectTemporary = "temporary"
+	// RedirectPermanent responde 301 y permite a navegadores y proxies guardar la redirección
+	// en caché, a costa de que las visitas repetidas no lleguen al servidor
+	RedirectPermanent = "permanent"
+)
+
+// validateRedirectType comprueba el tipo de redirección solicitado; vacío es temporal
+func validateRedirectType(redirectType string) error {
+	switch redirectType {
+	case "", RedirectTemporary, RedirectPermanent:
+		return nil
+	}
+	return &ValidationError{Field: "redirect_type", Value: redirectType,
+		Msg: fmt.Sprintf("debe ser %s o %s", RedirectTemporary, RedirectPermanent)}
+}
+
+// normalizeRedirectType guarda el tipo por defecto como vacío
+func normalizeRedirectType(redirectType string) string {
+	if redirectType == RedirectTemporary {
+		return ""
+	}
+	return redirectType
+}
+
+// PermanentRedirect indica si el enlace usa redirección permanente
+func (l Link) PermanentRedirect() bool {
+	return l.RedirectType == RedirectPermanent
+}
+
+// WithInterstitialDomains exige la página de aviso antes de redirigir a destinos de estos
+// dominios o sus subdominios; "*" la exige para todos los destinos
+func WithInterstitialDomains(domains []string) ServiceOption {
+	return func(s *Service) {
+		s.interstitialDomains = domains
+	}
+}
+
+// WithGeoResolver configura la geolocalización de visitantes para los enlaces con GeoTargets
+func WithGeoResolver(resolver geo.Resolver) ServiceOption {
+	return func(s *Service) {
+		s.geoResolver = resolver
+	}
+}
+
+// PasswordQueryParam es el parámetro con el que se puede aportar la contraseña en la URL
+// corta; en los enlaces protegidos nunca se reenvía al destino
+const PasswordQueryParam = "key"
+
+// WithQueryForwarding hace que todas las redirecciones agreguen los parámetros de la URL corta
+// al destino, sin necesidad de activarlo enlace por enlace
+func WithQueryForwarding(enabled bool) ServiceOption {
+	return func(s *Service) {
+		s.forwardQuery = enabled
+	}
+}
+
+// ResolveRedirect obtiene la URL a la que debe redirigir una visita al código corto. Parte de
+// la URL larga del enlace y le aplica las reglas del enlace según los datos de la visita. Los
+// enlaces protegidos retornan ErrPasswordRequired o ErrInvalidPassword sin revelar el destino,
+// las visitas desde redes no permitidas ErrIPNotAllowed, las visitas a enlaces firmados sin una
+// firma válida ErrSignatureRequired, ErrInvalidSignature o ErrSignatureExpired y los enlaces
+// desactivados un *DisabledError con el motivo.
+func (s *Service) ResolveRedirect(ctx context.Context, shortCode string, req RedirectRequest) (redirect Redirect, err error) {
+	// Defer para logging y cleanup siguiendo la Guía 2
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%w en ResolveRedirect: %v", ErrCritical, r)
+			redirect = Redirect{}
+		}
+	}()
+
+	link, err := s.GetLink(ctx, shortCode)
+	if err != nil {
+		return Redirect{}, err
+	}
+	if link.IsDisabled() {
+		return Redirect{}, &DisabledError{Reason: link.DisabledReason}
+	}
+	now := time.Now()
+	if link.IsExpired(now) {
+		return Redirect{}, ErrURLExpired
+	}
+	if !s.AllowsIP(link, req.ClientIP) {
+		return Redirect{}, ErrIPNotAllowed
+	}
+	if err := s.checkThrottled(link, req.ClientIP, now); err != nil {
+		return Redirect{}, err
+	}
+	// Una procedencia no permitida se rechaza o pasa por la página de aviso según el enlace
+	foreignReferrer := !link.Referrers.allows(req.Referrer)
+	if foreignReferrer && link.Referrers.Fallback != ReferrerInterstitial {
+		return Redirect{}, ErrReferrerNotAllowed
+	}
+
+	if link.Signed {
+		if err := s.checkSignature(link, req.Query, now); err != nil {
+			return Redirect{}, err
+		}
+		req.Query = withoutParams(req.Query, SignatureQueryParam, SignatureExpiryQueryParam)
+	}
+
+	if link.PasswordProtected() {
+		if req.Password == "" {
+			return Redirect{}, ErrPasswordRequired
+		}
+		if err := s.passwordFailures.check(link.Key(), now); err != nil {
+			return Redirect{}, err
+		}
+		if !checkPassword(link.PasswordHash, req.Password) {
+			s.passwordFailures.fail(link.Key(), now)
+			return Redirect{}, ErrInvalidPassword
+		}
+		s.passwordFailures.reset(link.Key())
+		req.Query = withoutParams(req.Query, PasswordQueryParam)
+	}
+
+	// Solo se cuentan las visitas que reciben destino y, con WithBotExclusion, las de personas
+	bot := s.IsBot(req.UserAgent)
+	excluded := bot && s.excludeBots
+	if !excluded {
+		if err := s.usage.reserve(link.APIKeyID, UsageRedirects); err != nil {
+			return Redirect{}, err
+		}
+	}
+	// La detección de anomalías cuenta todas las visitas que reciben destino, incluidas las de
+	// bots, y una cuarentena aplicada ahora ya lleva esta visita a la página de aviso
+	link = s.observeVisit(ctx, link, req.ClientIP, now)
+	// El país se resuelve una sola vez, para el destino y para las estadísticas
+	country := ""
+	if req.Locate || len(link.GeoTargets) > 0 {
+		country = s.visitorCountry(ctx, req)
+		req.Country = country
+	}
+	redirect = s.destination(ctx, link, req, !excluded)
+	redirect.Bot = bot
+	redirect.Country = country
+	if !link.UTM.IsZero() {
+		redirect.URL = applyUTM(redirect.URL, link.UTM, link.ShortCode, now)
+	}
+	if (s.forwardQuery || link.ForwardQuery) && len(req.Query) > 0 {
+		redirect.URL = mergeQuery(redirect.URL, req.Query)
+	}
+	redirect.Quarantined = link.Quarantined
+	redirect.Interstitial = link.Interstitial || link.Quarantined || foreignReferrer || s.requiresInterstitial(redirect.URL)
+	redirect.Permanent = link.PermanentRedirect()
+	redirect.Cloak = link.pageCloak()
+	redirect.Cacheable = !link.PasswordProtected() && len(link.DeviceTargets) == 0 && len(link.GeoTargets) == 0 &&
+		len(link.Variants) == 0 && len(link.Referrers.Domains) == 0 && link.IPAccess.IsZero() && !link.Signed
+	redirect.ValidUntil = link.ExpiresAt
+	if link.UTM.usesDate() {
+		tomorrow := now.UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
+		if redirect.ValidUntil.IsZero() || tomorrow.Before(redirect.ValidUntil) {
+			redirect.ValidUntil = tomorrow
+		}
+	}
+	return redirect, nil
+}
+
+// withoutParams retorna una copia de query sin los parámetros keys, o query si no tiene ninguno,
+// para que las credenciales de la visita no se reenvíen al destino
+func withoutParams(query url.Values, keys ...string) url.Values {
+	found := false
+	for _, key := range keys {
+		if _, ok := query[key]; ok {
+			found = true
+		}
+	}
+	if !found {
+		return query
+	}
+	filtered := make(url.Values, len(query))
+	for key, values := range query {
+		if !containsString(keys, key) {
+			filtered[key] = values
+		}
+	}
+	return filtered
+}
+
+// requiresInterstitial aplica la política de dominios con aviso al destino final
+func (s *Service) requiresInterstitial(destination string) bool {
+	if len(s.interstitialDomains) == 0 {
+		return false
+	}
+	parsed, err := url.Parse(destination)
+	if err != nil {
+		return true
+	}
+	host := strings.ToLower(parsed.Hostname())
+	for _, domain := range s.interstitialDomains {
+		domain = strings.ToLower(strings.TrimPrefix(domain, "."))
+		if domain == "*" || host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// destination elige la URL larga que corresponde a la visita según las reglas del enlace. El
+// destino por dispositivo tiene prioridad sobre el de país: un enlace profundo a la aplicación
+// solo sirve en la plataforma para la que se configuró. Las variantes A/B reparten el resto
+// de visitas en lugar de la URL larga, salvo que assignVariant sea false.
+func (s *Service) destination(ctx context.Context, link Link, req RedirectRequest, assignVariant bool) Redirect {
+	if len(link.DeviceTargets) > 0 {
+		if target, ok := link.DeviceTargets[DeviceFromUserAgent(req.UserAgent)]; ok {
+			return Redirect{URL: target}
+		}
+	}
+	if len(link.GeoTargets) > 0 {
+		if target, ok := link.geoTarget(s.visitorCountry(ctx, req)); ok {
+			return Redirect{URL: target}
+		}
+	}
+	if len(link.Variants) > 0 && assignVariant {
+		variant, ok := link.variant(req.Variant)
+		if !ok || !link.StickyVariants {
+			variant, ok = pickVariant(link.Variants)
+		}
+		if ok {
+			return Redirect{URL: variant.URL, Variant: variant.Name, Sticky: link.StickyVariants}
+		}
+	}
+	return Redirect{URL: link.LongURL}
+}
+
+// visitorCountry obtiene el país de la visita; un fallo de geolocalización deja el país vacío
+// para que la redirección use el destino por defecto en lugar de fallar
+func (s *Service) visitorCountry(ctx context.Context, req RedirectRequest) string {
+	if country, ok := geo.NormalizeCountry(req.Country); ok {
+		return country
+	}
+	if s.geoResolver == nil || !req.ClientIP.IsValid() {
+		return ""
+	}
+	country, err := s.geoResolver.Country(ctx, req.ClientIP)
+	if err != nil {
+		return ""
+	}
+	return strings.ToUpper(country)
+}
+
+// geoTarget busca el destino del país: primero el país exacto y después sus regiones
+func (l Link) geoTarget(country string) (string, bool) {
+	if country == "" {
+		return "", false
+	}
+	if target, ok := l.GeoTargets[country]; ok {
+		return target, true
+	}
+	for region, target := range l.GeoTargets {
+		if geo.InRegion(country, region) {
+			return target, true
+		}
+	}
+	return "", false
+}
+
+// validateGeoTargets valida los códigos de país o región y las URLs de destino
+func (s *Service) validateGeoTargets(targets map[string]string) error {
+	codes := make([]string, 0, len(targets))
+	for code := range targets {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+
+	var errs []error
+	for _, code := range codes {
+		target := targets[code]
+		field := "geo_targets." + code
+		if _, ok := geo.NormalizeCountry(code); !ok {
+			errs = append(errs, &ValidationError{Field: field, Value: code, Msg: "debe ser un código de país ISO 3166-1 alfa-2 o una región (EU)"})
+			continue
+		}
+		if err := s.validateURL(target); err != nil {
+			var validationErr *ValidationError
+			if errors.As(err, &validationErr) {
+				errs = append(errs, &ValidationError{Field: field, Value: target, Msg: validationErr.Msg, Err: validationErr.Err})
+				continue
+			}
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// normalizeGeoTargets copia los destinos con los códigos en mayúsculas
+func normalizeGeoTargets(targets map[string]string) map[string]string {
+	if len(targets) == 0 {
+		return nil
+	}
+	normalized := make(map[string]string, len(targets))
+	for code, target := range targets {
+		country, _ := geo.NormalizeCountry(code)
+		normalized[country] = target
+	}
+	return normalized
+}
+
+// mergeQuery agrega a destination los parámetros de query que no define ya; los parámetros
+// del destino tienen prioridad para que el visitante no pueda sobrescribirlos. La query del
+// destino se conserva tal cual, con su orden y sus parámetros sin valor (?flag), y los nuevos
+// se añaden al final.
+func mergeQuery(destination string, query url.Values) string {
+	parsed, err := url.Parse(destination)
+	if err != nil {
+		return destination
+	}
+
+	defined := parsed.Query()
+	added := url.Values{}
+	for key, list := range query {
+		if _, ok := defined[key]; !ok {
+			added[key] = list
+		}
+	}
+	if len(added) == 0 {
+		return destination
+	}
+	parsed.RawQuery = joinQuery(parsed.RawQuery, added.Encode())
+	return parsed.String()
+}
+
+// joinQuery une dos queries ya codificadas
+func joinQuery(rawQuery, extra string) string {
+	switch {
+	case rawQuery == "":
+		return extra
+	case extra == "":
+		return rawQuery
+	}
+	return rawQuery + "&" + extra
+}
+
+// queryKey retorna el nombre decodificado de un parámetro de una query codificada ("a=1", "flag")
+func queryKey(param string) string {
+	key, _, _ := strings.Cut(param, "=")
+	if unescaped, err := url.QueryUnescape(key); err == nil {
+		return unescaped
+	}
+	return key
+}
+
+// UTMParams son los parámetros de campaña que se agregan al destino en cada redirección.
+// Los valores admiten los marcadores {code} (código corto) y {date} (fecha UTC AAAA-MM-DD).
+type UTMParams struct {
+	Source   string
+	Medium   string
+	Campaign string
+}
+
+// IsZero indica si no hay ningún parámetro configurado
+func (u UTMParams) IsZero() bool {
+	return u == UTMParams{}
+}
+
+// usesDate indica si algún parámetro usa el marcador {date} y cambia cada día
+func (u UTMParams) usesDate() bool {
+	return strings.Contains(u.Source+u.Medium+u.Campaign, "{date}")
+}
+
+// MaxUTMValueLength acota la longitud de cada parámetro UTM
+const MaxUTMValueLength = 200
+
+// utmPlaceholder reconoce los marcadores de las plantillas UTM
+var utmPlaceholder = regexp.MustCompile(`\{[^{}]*\}`)
+
+// fields retorna los parámetros con su nombre en la query, en orden estable
+func (u UTMParams) fields() [][2]string {
+	return [][2]string{{"utm_source", u.Source}, {"utm_medium", u.Medium}, {"utm_campaign", u.Campaign}}
+}
+
+// validate comprueba longitud y marcadores de cada parámetro
+func (u UTMParams) validate() error {
+	var errs []error
+	for _, field := range u.fields() {
+		name, value := "utm."+strings.TrimPrefix(field[0], "utm_"), field[1]
+		if len(value) > MaxUTMValueLength {
+			errs = append(errs, &ValidationError{Field: name, Value: value, Msg: fmt.Sprintf("no puede superar %d caracteres", MaxUTMValueLength)})
+			continue
+		}
+		for _, placeholder := range utmPlaceholder.FindAllString(value, -1) {
+			if placeholder != "{code}" && placeholder != "{date}" {
+				errs = append(errs, &ValidationError{Field: name, Value: value, Msg: fmt.Sprintf("marcador %s desconocido; se admiten {code} y {date}", placeholder)})
+				break
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// applyUTM fija en destination los parámetros UTM configurados, expandiendo los marcadores.
+// Sustituyen en su sitio a los parámetros homónimos del destino y los demás se añaden al final;
+// el resto de la query no se toca.
+func applyUTM(destination string, utm UTMParams, shortCode string, now time.Time) string {
+	parsed, err := url.Parse(destination)
+	if err != nil {
+		return destination
+	}
+
+	replacer := strings.NewReplacer("{code}", shortCode, "{date}", now.UTC().Format("2006-01-02"))
+	values := make(map[string]string)
+	for _, field := range utm.fields() {
+		if field[1] != "" {
+			values[field[0]] = url.QueryEscape(field[0]) + "=" + url.QueryEscape(replacer.Replace(field[1]))
+		}
+	}
+
+	var params []string
+	set := make(map[string]bool)
+	if parsed.RawQuery != "" {
+		for _, param := range strings.Split(parsed.RawQuery, "&") {
+			key := queryKey(param)
+			if value, ok := values[key]; ok {
+				// Solo la primera aparición se sustituye; las repetidas se descartan
+				if !set[key] {
+					params = append(params, value)
+					set[key] = true
+				}
+				continue
+			}
+			params = append(params, param)
+		}
+	}
+	for _, field := range utm.fields() {
+		if value, ok := values[field[0]]; ok && !set[field[0]] {
+			params = append(params, value)
+		}
+	}
+	parsed.RawQuery = strings.Join(params, "&")
+	return parsed.String()
+}
@@ -0,0 +1,112 @@
+package shortener
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"acortador-urls/internal/errcode"
+)
+
+// Respuestas a las visitas cuya procedencia no está permitida (ReferrerPolicy.Fallback)
+const (
+	// ReferrerBlock rechaza la visita con ErrReferrerNotAllowed y es la respuesta por defecto
+	ReferrerBlock = "block"
+	// ReferrerInterstitial muestra la página de aviso con el destino en lugar de redirigir
+	ReferrerInterstitial = "interstitial"
+)
+
+// MaxAllowedReferrers acota los dominios de procedencia admitidos de un enlace
+const MaxAllowedReferrers = 20
+
+// ErrReferrerNotAllowed indica que el enlace solo admite visitas procedentes de ciertos
+// dominios y la visita no viene de ninguno
+var ErrReferrerNotAllowed = errcode.New(errcode.ReferrerNotAllowed, "procedencia no permitida")
+
+// ReferrerPolicy restringe las redirecciones de un enlace a las visitas cuyo Referer es uno de
+// Domains o un subdominio, p. ej. los enlaces de campaña que solo deben abrirse desde la
+// newsletter. Las visitas sin Referer (escritas a mano o desde clientes que no lo envían)
+// tampoco se admiten.
+type ReferrerPolicy struct {
+	Domains []string
+	// Fallback es ReferrerBlock o ReferrerInterstitial; vacío es ReferrerBlock
+	Fallback string
+}
+
+// IsZero indica si el enlace admite visitas de cualquier procedencia
+func (p ReferrerPolicy) IsZero() bool {
+	return len(p.Domains) == 0 && p.Fallback == ""
+}
+
+// normalize guarda los dominios en minúsculas, sin "www." ni comodines y sin repetir, y el
+// fallback por defecto como vacío
+func (p ReferrerPolicy) normalize() ReferrerPolicy {
+	if p.IsZero() {
+		return ReferrerPolicy{}
+	}
+	domains := make([]string, 0, len(p.Domains))
+	for _, domain := range p.Domains {
+		domain = referrerDomain(domain)
+		if !containsString(domains, domain) {
+			domains = append(domains, domain)
+		}
+	}
+	p.Domains = domains
+	if p.Fallback == ReferrerBlock {
+		p.Fallback = ""
+	}
+	return p
+}
+
+// referrerDomain normaliza un dominio de procedencia: *.example.com y www.example.com admiten
+// lo mismo que example.com
+func referrerDomain(domain string) string {
+	domain = normalizeHost(domain)
+	domain = strings.TrimPrefix(domain, "*.")
+	return strings.TrimPrefix(domain, "www.")
+}
+
+// validate comprueba los dominios y el fallback. Un fallback sin dominios no tiene efecto y se
+// rechaza.
+func (p ReferrerPolicy) validate() error {
+	if p.IsZero() {
+		return nil
+	}
+	var errs []error
+	if p.Fallback != "" && p.Fallback != ReferrerBlock && p.Fallback != ReferrerInterstitial {
+		errs = append(errs, &ValidationError{Field: "referrers.fallback", Value: p.Fallback,
+			Msg: fmt.Sprintf("debe ser %s o %s", ReferrerBlock, ReferrerInterstitial)})
+	}
+	switch {
+	case len(p.Domains) == 0:
+		errs = append(errs, &ValidationError{Field: "referrers.domains", Value: p.Domains, Msg: "debe tener al menos un dominio"})
+	case len(p.Domains) > MaxAllowedReferrers:
+		errs = append(errs, &ValidationError{Field: "referrers.domains", Value: len(p.Domains),
+			Msg: fmt.Sprintf("no puede tener más de %d dominios", MaxAllowedReferrers)})
+	}
+	for i, domain := range p.Domains {
+		if normalized := referrerDomain(domain); !hostnamePattern.MatchString(normalized) || len(normalized) > 253 {
+			errs = append(errs, &ValidationError{Field: "referrers.domains[" + strconv.Itoa(i) + "]", Value: domain,
+				Msg: "debe ser un nombre de host como newsletter.example.com"})
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// allows indica si una visita desde referrer, el host de su cabecera Referer, puede redirigir
+func (p ReferrerPolicy) allows(referrer string) bool {
+	if len(p.Domains) == 0 {
+		return true
+	}
+	host := strings.TrimPrefix(normalizeHost(referrer), "www.")
+	if host == "" {
+		return false
+	}
+	for _, domain := range p.Domains {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
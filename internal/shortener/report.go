@@ -0,0 +1,276 @@
+package shortener
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// MaxReportCommentLength acota la longitud del comentario de una denuncia
+const MaxReportCommentLength = 1000
+
+// Motivos de denuncia de un enlace
+const (
+	ReportMalware  = "malware"
+	ReportPhishing = "phishing"
+	ReportSpam     = "spam"
+	ReportOther    = "other"
+)
+
+// ReportReasons son los motivos admitidos al denunciar un enlace
+var ReportReasons = []string{ReportMalware, ReportPhishing, ReportSpam, ReportOther}
+
+// Estados de una denuncia
+const (
+	// ReportOpen es una denuncia pendiente de revisión
+	ReportOpen = "open"
+	// ReportResolved es una denuncia atendida desactivando el enlace
+	ReportResolved = "resolved"
+	// ReportDismissed es una denuncia descartada por un administrador
+	ReportDismissed = "dismissed"
+)
+
+// Report es una denuncia de un visitante sobre un enlace malicioso
+type Report struct {
+	// ID es correlativo y lo asigna el almacén al guardar la denuncia
+	ID        int64
+	ShortCode string
+	Reason    string
+	Comment   string
+	// Reporter identifica a quien denuncia (la IP del cliente); varias denuncias del mismo
+	// reporter cuentan una sola vez para la cuarentena
+	Reporter  string
+	Status    string
+	CreatedAt time.Time
+}
+
+// ReportInput son los datos de una denuncia pública
+type ReportInput struct {
+	Reason   string
+	Comment  string
+	Reporter string
+}
+
+// ReportQuery filtra las denuncias; los campos vacíos no filtran. Se retornan de la más
+// reciente a la más antigua.
+type ReportQuery struct {
+	ShortCode string
+	Status    string
+	Offset    int
+	Limit     int
+}
+
+// ReportPage es una página de denuncias con el total que cumple el filtro
+type ReportPage struct {
+	Reports []Report
+	Total   int
+}
+
+// WithQuarantineThreshold pone en cuarentena los enlaces que acumulan denuncias abiertas de al
+// menos threshold visitantes distintos: sus visitas pasan por la página de aviso hasta que un
+// administrador descarta las denuncias. Cero desactiva la cuarentena automática.
+func WithQuarantineThreshold(threshold int) ServiceOption {
+	return func(s *Service) {
+		s.quarantineThreshold = threshold
+	}
+}
+
+// ReportLink registra una denuncia pública sobre un enlace y lo pone en cuarentena si alcanza
+// el umbral configurado
+func (s *Service) ReportLink(ctx context.Context, shortCode string, input ReportInput) (Report, error) {
+	link, err := s.GetLink(ctx, shortCode)
+	if err != nil {
+		return Report{}, err
+	}
+
+	var errs []error
+	if !containsString(ReportReasons, input.Reason) {
+		errs = append(errs, &ValidationError{Field: "reason", Value: input.Reason,
+			Msg: fmt.Sprintf("debe ser uno de %s", strings.Join(ReportReasons, ", "))})
+	}
+	input.Comment = strings.TrimSpace(input.Comment)
+	if utf8.RuneCountInString(input.Comment) > MaxReportCommentLength {
+		errs = append(errs, &ValidationError{Field: "comment", Value: input.Comment,
+			Msg: fmt.Sprintf("no puede superar %d caracteres", MaxReportCommentLength)})
+	}
+	if err := errors.Join(errs...); err != nil {
+		return Report{}, err
+	}
+
+	report, reporters, err := s.store.AddReport(ctx, Report{
+		ShortCode: link.Key(),
+		Reason:    input.Reason,
+		Comment:   input.Comment,
+		Reporter:  input.Reporter,
+		Status:    ReportOpen,
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		return Report{}, storeError(err)
+	}
+
+	if s.quarantineThreshold > 0 && reporters >= s.quarantineThreshold && !link.Quarantined {
+		before := link
+		link.Quarantined = true
+		link.UpdatedAt = time.Now()
+		if err := s.store.SaveLink(ctx, link); err != nil {
+			return Report{}, storeError(err)
+		}
+		if err := s.audit(ctx, Actor{}, AuditQuarantine, &before, &link); err != nil {
+			return Report{}, err
+		}
+	}
+	return report, nil
+}
+
+// ListReports retorna una página de denuncias; solo está disponible para administradores
+func (s *Service) ListReports(ctx context.Context, actor Actor, query ReportQuery) (ReportPage, error) {
+	if !actor.Admin {
+		return ReportPage{}, ErrForbidden
+	}
+	if query.Limit == 0 {
+		query.Limit = DefaultListLimit
+	}
+
+	var errs []error
+	if query.Status != "" && query.Status != ReportOpen && query.Status != ReportResolved && query.Status != ReportDismissed {
+		errs = append(errs, &ValidationError{Field: "status", Value: query.Status, Msg: "debe ser open, resolved o dismissed"})
+	}
+	if query.Offset < 0 {
+		errs = append(errs, &ValidationError{Field: "page", Value: query.Offset, Msg: "debe ser al menos 1"})
+	}
+	if query.Limit < 1 || query.Limit > MaxListLimit {
+		errs = append(errs, &ValidationError{Field: "per_page", Value: query.Limit, Msg: fmt.Sprintf("debe estar entre 1 y %d", MaxListLimit)})
+	}
+	if err := errors.Join(errs...); err != nil {
+		return ReportPage{}, err
+	}
+
+	page, err := s.store.ListReports(ctx, query)
+	if err != nil {
+		return ReportPage{}, storeError(err)
+	}
+	return page, nil
+}
+
+// DismissReports descarta las denuncias abiertas de un enlace y lo saca de la cuarentena
+func (s *Service) DismissReports(ctx context.Context, actor Actor, shortCode string) (Link, error) {
+	if !actor.Admin {
+		return Link{}, ErrForbidden
+	}
+	link, err := s.GetLink(ctx, shortCode)
+	if err != nil {
+		return Link{}, err
+	}
+
+	if _, err := s.store.CloseReports(ctx, link.Key(), ReportDismissed); err != nil {
+		return Link{}, storeError(err)
+	}
+	if !link.Quarantined {
+		return link, nil
+	}
+
+	before := link
+	link.Quarantined = false
+	link.UpdatedAt = time.Now()
+	if err := s.store.SaveLink(ctx, link); err != nil {
+		return Link{}, storeError(err)
+	}
+	if err := s.audit(ctx, actor, AuditRelease, &before, &link); err != nil {
+		return Link{}, err
+	}
+	return link, nil
+}
+
+// DisableReported desactiva varios enlaces denunciados con el mismo motivo y marca sus
+// denuncias abiertas como resueltas. errs tiene un elemento por código, nil si se desactivó.
+func (s *Service) DisableReported(ctx context.Context, actor Actor, shortCodes []string, reason string) (errs []error, err error) {
+	if !actor.Admin {
+		return nil, ErrForbidden
+	}
+
+	errs = make([]error, len(shortCodes))
+	for i, code := range shortCodes {
+		if _, errs[i] = s.DisableURL(ctx, actor, code, reason); errs[i] != nil {
+			continue
+		}
+		if _, err := s.store.CloseReports(ctx, code, ReportResolved); err != nil {
+			errs[i] = storeError(err)
+		}
+	}
+	return errs, nil
+}
+
+// containsString indica si values contiene value
+func containsString(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
+
+// AddReport guarda la denuncia asignándole el siguiente ID y retorna cuántos reporters
+// distintos tienen denuncias abiertas sobre el enlace
+func (s *Store) AddReport(ctx context.Context, report Report) (Report, int, error) {
+	if err := ctx.Err(); err != nil {
+		return Report{}, 0, err
+	}
+	s.reportsMu.Lock()
+	defer s.reportsMu.Unlock()
+	report.ID = int64(len(s.reports) + 1)
+	s.reports = append(s.reports, report)
+
+	reporters := make(map[string]struct{})
+	for _, existing := range s.reports {
+		if existing.ShortCode == report.ShortCode && existing.Status == ReportOpen {
+			reporters[existing.Reporter] = struct{}{}
+		}
+	}
+	return report, len(reporters), nil
+}
+
+// ListReports retorna la página de denuncias que cumple la consulta, de la más reciente a la
+// más antigua
+func (s *Store) ListReports(ctx context.Context, query ReportQuery) (ReportPage, error) {
+	if err := ctx.Err(); err != nil {
+		return ReportPage{}, err
+	}
+	s.reportsMu.RLock()
+	defer s.reportsMu.RUnlock()
+
+	page := ReportPage{Reports: make([]Report, 0)}
+	for i := len(s.reports) - 1; i >= 0; i-- {
+		report := s.reports[i]
+		if (query.ShortCode != "" && report.ShortCode != query.ShortCode) || (query.Status != "" && report.Status != query.Status) {
+			continue
+		}
+		if page.Total >= query.Offset && len(page.Reports) < query.Limit {
+			page.Reports = append(page.Reports, report)
+		}
+		page.Total++
+	}
+	return page, nil
+}
+
+// CloseReports cambia al estado indicado las denuncias abiertas de un enlace y retorna cuántas
+// se cerraron
+func (s *Store) CloseReports(ctx context.Context, shortCode, status string) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	s.reportsMu.Lock()
+	defer s.reportsMu.Unlock()
+	closed := 0
+	for i := range s.reports {
+		if s.reports[i].ShortCode == shortCode && s.reports[i].Status == ReportOpen {
+			s.reports[i].Status = status
+			closed++
+		}
+	}
+	return closed, nil
+}
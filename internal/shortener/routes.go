@@ -0,0 +1,87 @@
+package shortener
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// RouteRegistry lleva los primeros segmentos estáticos de las rutas del servidor (api, admin,
+// robots.txt...). El router registra en él sus rutas y CodeFilter lo consulta, de modo que un
+// endpoint nuevo queda reservado como código sin mantener una lista aparte.
+type RouteRegistry struct {
+	mu       sync.RWMutex
+	segments map[string]string // segmento en minúsculas → patrón que lo registró
+}
+
+// NewRouteRegistry crea un registro con los patrones indicados
+func NewRouteRegistry(patterns ...string) *RouteRegistry {
+	routes := &RouteRegistry{segments: make(map[string]string)}
+	for _, pattern := range patterns {
+		routes.Register(pattern)
+	}
+	return routes
+}
+
+// Register reserva el primer segmento del patrón de una ruta (p. ej. "metrics" de
+// "/metrics/{name}"). Los patrones que empiezan por un parámetro o un comodín, como
+// "/{short_code}", no reservan nada.
+func (r *RouteRegistry) Register(pattern string) {
+	segment, _, _ := strings.Cut(strings.TrimPrefix(pattern, "/"), "/")
+	if segment == "" || strings.ContainsAny(segment, "{*") {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.segments[strings.ToLower(segment)]; !ok {
+		r.segments[strings.ToLower(segment)] = pattern
+	}
+}
+
+// Route retorna el patrón de la ruta que reserva el código; la comparación no distingue
+// mayúsculas porque los códigos pueden no distinguirlas
+func (r *RouteRegistry) Route(code string) (pattern string, ok bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	pattern, ok = r.segments[strings.ToLower(code)]
+	return pattern, ok
+}
+
+// Segments retorna los segmentos reservados en orden alfabético
+func (r *RouteRegistry) Segments() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	segments := make([]string, 0, len(r.segments))
+	for segment := range r.segments {
+		segments = append(segments, segment)
+	}
+	sort.Strings(segments)
+	return segments
+}
+
+// WithRoutes hace que el filtro rechace también los códigos reservados por las rutas del
+// registro, incluidas las que se registren después
+func (f *CodeFilter) WithRoutes(routes *RouteRegistry) *CodeFilter {
+	f.routes = routes
+	return f
+}
+
+// ShadowedLinks retorna los enlaces del espacio común cuyo código coincide con una ruta del
+// registro: se crearon antes de que existiera la ruta y ya no se puede llegar a ellos. El
+// servidor los informa al arrancar para que se renombren.
+func (s *Service) ShadowedLinks(ctx context.Context, routes *RouteRegistry) ([]Link, error) {
+	var shadowed []Link
+	for _, segment := range routes.Segments() {
+		link, err := s.GetLink(ctx, segment)
+		switch {
+		case errors.Is(err, ErrURLNotFound):
+			continue
+		case err != nil:
+			return nil, err
+		}
+		shadowed = append(shadowed, link)
+	}
+	return shadowed, nil
+}
@@ -0,0 +1,218 @@
+package shortener
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// MaxSearchQueryLength acota la longitud del texto de búsqueda
+const MaxSearchQueryLength = 200
+
+// SearchQuery busca enlaces cuya URL larga, código, descripción o metadatos propios contienen
+// todos los términos de Text, sin distinguir mayúsculas. Los backends SQL la traducen a LIKE '%término%' apoyados en un
+// índice de trigramas (pg_trgm en PostgreSQL).
+type SearchQuery struct {
+	Text string
+	// Owner restringe la búsqueda a un propietario; se ignora si AnyOwner es true
+	Owner    string
+	AnyOwner bool
+	// Tenant es el espacio de códigos en el que se busca; vacío es el espacio común
+	Tenant string
+	// Limit es el número máximo de resultados
+	Limit int
+}
+
+// terms separa el texto en términos en minúsculas
+func (q SearchQuery) terms() []string {
+	return strings.Fields(strings.ToLower(q.Text))
+}
+
+// SearchLinks busca enlaces por URL larga, alias, descripción o metadatos propios. Como ListLinks, los usuarios solo buscan
+// entre sus enlaces y los administradores entre todos.
+func (s *Service) SearchLinks(ctx context.Context, actor Actor, query SearchQuery) (LinkPage, error) {
+	if !actor.Admin {
+		query.AnyOwner = false
+		query.Owner = actor.UserID
+	}
+	if query.Limit == 0 {
+		query.Limit = DefaultListLimit
+	}
+
+	var errs []error
+	if text := strings.TrimSpace(query.Text); text == "" || len(text) > MaxSearchQueryLength {
+		errs = append(errs, &ValidationError{Field: "q", Value: query.Text, Msg: fmt.Sprintf("debe tener entre 1 y %d caracteres", MaxSearchQueryLength)})
+	}
+	if query.Limit < 1 || query.Limit > MaxListLimit {
+		errs = append(errs, &ValidationError{Field: "limit", Value: query.Limit, Msg: fmt.Sprintf("debe estar entre 1 y %d", MaxListLimit)})
+	}
+	if err := errors.Join(errs...); err != nil {
+		return LinkPage{}, err
+	}
+
+	page, err := s.store.Search(ctx, query)
+	if err != nil {
+		return LinkPage{}, storeError(err)
+	}
+	return page, nil
+}
+
+// Search retorna los enlaces que contienen todos los términos. Los términos de tres o más
+// caracteres acotan los candidatos con el índice de trigramas; el resultado se verifica
+// siempre contra el texto completo.
+func (s *Store) Search(ctx context.Context, query SearchQuery) (LinkPage, error) {
+	if err := ctx.Err(); err != nil {
+		return LinkPage{}, err
+	}
+	terms := query.terms()
+
+	s.mu.RLock()
+	candidates, narrowed := s.trigrams.candidates(terms)
+	matches := make([]Link, 0)
+	check := func(link Link) {
+		if link.Tenant == query.Tenant && (query.AnyOwner || link.Owner == query.Owner) && linkMatches(link, terms) {
+			matches = append(matches, link)
+		}
+	}
+	if narrowed {
+		for code := range candidates {
+			if link, exists := s.urls[code]; exists {
+				check(link)
+			}
+		}
+	} else {
+		for _, link := range s.urls {
+			check(link)
+		}
+	}
+	s.mu.RUnlock()
+	return query.Page(matches), nil
+}
+
+// Page ordena los resultados de la búsqueda y retorna los Limit primeros; Total cuenta todos.
+// Lo usan también los almacenes que reparten los enlaces entre varios backends.
+func (q SearchQuery) Page(matches []Link) LinkPage {
+	sortSearchResults(matches, strings.ToLower(strings.TrimSpace(q.Text)))
+	page := LinkPage{Links: matches, Total: len(matches)}
+	if len(page.Links) > q.Limit {
+		page.Links = page.Links[:q.Limit]
+	}
+	return page
+}
+
+// searchTexts son los textos del enlace en los que se busca
+func (l Link) searchTexts() []string {
+	return []string{l.LongURL, l.ShortCode, l.Description, string(l.CustomMetadata)}
+}
+
+// linkMatches indica si cada término aparece en alguno de los textos de búsqueda del enlace
+func linkMatches(link Link, terms []string) bool {
+	texts := link.searchTexts()
+	for i, text := range texts {
+		texts[i] = strings.ToLower(text)
+	}
+	for _, term := range terms {
+		found := false
+		for _, text := range texts {
+			if strings.Contains(text, term) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// sortSearchResults ordena por relevancia: primero el código idéntico a la búsqueda, luego los
+// códigos que empiezan por ella y después el resto, del más reciente al más antiguo
+func sortSearchResults(links []Link, text string) {
+	rank := func(link Link) int {
+		code := strings.ToLower(link.ShortCode)
+		switch {
+		case code == text:
+			return 0
+		case strings.HasPrefix(code, text):
+			return 1
+		default:
+			return 2
+		}
+	}
+	sort.Slice(links, func(i, j int) bool {
+		if ri, rj := rank(links[i]), rank(links[j]); ri != rj {
+			return ri < rj
+		}
+		if !links[i].CreatedAt.Equal(links[j].CreatedAt) {
+			return links[i].CreatedAt.After(links[j].CreatedAt)
+		}
+		return links[i].ShortCode < links[j].ShortCode
+	})
+}
+
+// trigramIndex asocia cada secuencia de tres caracteres (en minúsculas) de los textos de
+// búsqueda de los enlaces con los códigos que la contienen. Lo mantiene Store bajo su lock de escritura.
+type trigramIndex map[string]map[string]struct{}
+
+// trigramsOf retorna los trigramas distintos de los textos indicados
+func trigramsOf(texts ...string) map[string]struct{} {
+	grams := make(map[string]struct{})
+	for _, text := range texts {
+		text = strings.ToLower(text)
+		for i := 0; i+3 <= len(text); i++ {
+			grams[text[i:i+3]] = struct{}{}
+		}
+	}
+	return grams
+}
+
+// add indexa el enlace
+func (idx trigramIndex) add(link Link) {
+	for gram := range trigramsOf(link.searchTexts()...) {
+		codes, ok := idx[gram]
+		if !ok {
+			codes = make(map[string]struct{})
+			idx[gram] = codes
+		}
+		codes[link.Key()] = struct{}{}
+	}
+}
+
+// remove elimina el enlace del índice
+func (idx trigramIndex) remove(link Link) {
+	for gram := range trigramsOf(link.searchTexts()...) {
+		if codes, ok := idx[gram]; ok {
+			delete(codes, link.Key())
+			if len(codes) == 0 {
+				delete(idx, gram)
+			}
+		}
+	}
+}
+
+// candidates intersecta los códigos de los trigramas de cada término. narrowed es false si
+// ningún término tiene tres caracteres y hay que recorrer todos los enlaces.
+func (idx trigramIndex) candidates(terms []string) (codes map[string]struct{}, narrowed bool) {
+	for _, term := range terms {
+		for gram := range trigramsOf(term) {
+			posting := idx[gram]
+			if !narrowed {
+				codes = make(map[string]struct{}, len(posting))
+				for code := range posting {
+					codes[code] = struct{}{}
+				}
+				narrowed = true
+				continue
+			}
+			for code := range codes {
+				if _, ok := posting[code]; !ok {
+					delete(codes, code)
+				}
+			}
+		}
+	}
+	return codes, narrowed
+}
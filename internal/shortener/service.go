@@ -1,24 +1,33 @@
 package shortener
 
 import (
-	"crypto/md5"
-	"encoding/hex"
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
-	"math/rand"
 	"net/url"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
+
+	"acortador-urls/internal/errcode"
+	"acortador-urls/internal/geo"
+	"acortador-urls/internal/threat"
 )
 
 // Configuración del servicio de acortador
 const (
 	// ShortCodeLength define la longitud fija del código corto generado
 	ShortCodeLength = 6
-	// MaxRetries define el máximo número de reintentos para evitar colisiones
+	// MaxRetries define el máximo número de reintentos para evitar colisiones por defecto
+	// (véase WithRetryPolicy)
 	MaxRetries = 10
 	// ValidChars contiene todos los caracteres válidos para el código corto
 	ValidChars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	// MinAliasLength y MaxAliasLength acotan la longitud de los alias personalizados
+	MinAliasLength = 3
+	MaxAliasLength = 32
 )
 
 // Estados de validación usando iota
@@ -33,86 +42,759 @@ const (
 
 // Errores predefinidos del servicio siguiendo mejores prácticas
 var (
-	ErrInvalidURL     = errors.New("URL inválida")
-	ErrEmptyURL       = errors.New("URL no puede estar vacía")
-	ErrMaxRetries     = errors.New("máximo número de reintentos alcanzado para generar código único")
-	ErrURLNotFound    = errors.New("URL no encontrada")
-	ErrServiceUnavailable = errors.New("servicio no disponible")
+	ErrInvalidURL         = errcode.New(errcode.InvalidURL, "URL inválida")
+	ErrEmptyURL           = errcode.New(errcode.EmptyURL, "URL no puede estar vacía")
+	ErrMaxRetries         = errcode.New(errcode.GenerationFailed, "máximo número de reintentos alcanzado para generar código único")
+	ErrURLNotFound        = errcode.New(errcode.NotFound, "URL no encontrada")
+	ErrServiceUnavailable = errcode.New(errcode.ServiceUnavailable, "servicio no disponible")
+	ErrForbidden          = errcode.New(errcode.Forbidden, "no autorizado para gestionar este enlace")
+	ErrURLExpired         = errcode.New(errcode.Expired, "URL expirada")
+	ErrInvalidAlias       = errcode.New(errcode.InvalidAlias, "alias inválido")
+	ErrAliasTaken         = errcode.New(errcode.AliasTaken, "el alias solicitado ya está en uso")
+	// ErrCritical envuelve los panics recuperados en las operaciones del servicio
+	ErrCritical = errcode.New(errcode.Critical, "error crítico")
 )
 
-// ValidationError representa un error de validación con contexto
+// ValidationError representa un error de validación con contexto. Err es el error predefinido
+// de la categoría (p. ej. ErrInvalidURL), de modo que errors.Is sigue funcionando.
 type ValidationError struct {
 	Field string
 	Value interface{}
 	Msg   string
+	Err   error
 }
 
 func (e *ValidationError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%v: %s", e.Err, e.Msg)
+	}
 	return fmt.Sprintf("validación falló en campo '%s' con valor '%v': %s", e.Field, e.Value, e.Msg)
 }
 
+// Unwrap expone el error predefinido de la categoría
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// Actor identifica a quién realiza una operación de gestión sobre un enlace
+type Actor struct {
+	UserID string
+	Admin  bool
+	// Workspace es el espacio compartido de un editor; vacío para propietarios y administradores
+	Workspace string
+}
+
+// canManage indica si el actor puede modificar el enlace: es administrador, su propietario o
+// un editor de su espacio compartido
+func (a Actor) canManage(link Link) bool {
+	if a.Admin {
+		return true
+	}
+	if a.Workspace != "" && link.Workspace == a.Workspace {
+		return true
+	}
+	return link.Owner != "" && link.Owner == a.UserID
+}
+
+// canDelete indica si el actor puede eliminar el enlace: los editores no eliminan enlaces,
+// ni siquiera los que crearon
+func (a Actor) canDelete(link Link) bool {
+	if a.Admin {
+		return true
+	}
+	return a.Workspace == "" && link.Owner != "" && link.Owner == a.UserID
+}
+
+// ShortenInput agrupa los datos de entrada para crear un enlace corto
+type ShortenInput struct {
+	LongURL string
+	Owner   string
+	Alias   string        // Código personalizado opcional; si está vacío se genera uno
+	TTL     time.Duration // Tiempo de vida opcional; cero significa sin expiración
+	// ForwardQuery agrega la query de la URL corta al destino al redirigir
+	ForwardQuery bool
+	// UTM son los parámetros de campaña agregados al destino al redirigir
+	UTM UTMParams
+	// Password protege la redirección; solo se almacena su hash
+	Password string
+	// GeoTargets son destinos alternativos por país o región; LongURL es el destino por defecto
+	GeoTargets map[string]string
+	// DeviceTargets son destinos por clase de dispositivo (ios, android, desktop), p. ej.
+	// enlaces a la tienda de aplicaciones o enlaces profundos
+	DeviceTargets map[string]string
+	// Variants reparten las visitas entre varios destinos según su peso (prueba A/B)
+	Variants []Variant
+	// StickyVariants hace que cada visitante reciba siempre la misma variante
+	StickyVariants bool
+	// Interstitial muestra una página de aviso con el destino antes de redirigir
+	Interstitial bool
+	// RedirectType es RedirectTemporary (por defecto) o RedirectPermanent. Solo se elige al
+	// crear el enlace: una redirección permanente guardada en caché no se puede retirar.
+	RedirectType string
+	// Cloak sirve el destino dentro de una página HTML (meta refresh o iframe) en lugar de
+	// redirigir; no admite RedirectPermanent
+	Cloak Cloak
+	// Referrers limita las redirecciones a las visitas procedentes de ciertos dominios; no
+	// admite RedirectPermanent
+	Referrers ReferrerPolicy
+	// IPAccess limita las redirecciones a las visitas desde ciertas redes (p. ej. enlaces
+	// internos de la red corporativa); no admite RedirectPermanent
+	IPAccess IPAccessPolicy
+	// Signed exige que las visitas traigan una firma emitida con SignLink o SignURL; no admite
+	// RedirectPermanent y requiere WithURLSigning
+	Signed bool
+	// Client identifica a quien crea el enlace para la cuota por cliente; vacío no la aplica
+	Client string
+	// APIKey es la clave de API con la que se crea el enlace; su consumo mensual se mide y
+	// limita con WithUsageQuotas. Vacío si la petición no trae clave.
+	APIKey string
+	// Tenant es el espacio de códigos en el que se crea el enlace (ver ResolveTenant); vacío
+	// es el espacio común
+	Tenant string
+	// Workspace es el espacio compartido del editor que crea el enlace; sus editores podrán
+	// modificarlo
+	Workspace string
+	// Tags son etiquetas libres para agrupar y filtrar enlaces (p. ej. "newsletter")
+	Tags []string
+	// Description es una nota libre sobre el enlace
+	Description string
+	// CustomMetadata es un objeto JSON del integrador (p. ej. el ticket o la campaña)
+	CustomMetadata json.RawMessage
+	// Deduplicate reutiliza el enlace existente del propietario para la misma URL aunque el
+	// servicio no tenga activado el modo deduplicación
+	Deduplicate bool
+}
+
 // Service contiene la lógica de negocio del acortador
 type Service struct {
-	store *Store
-	rand  *rand.Rand
+	store     LinkStore
+	generator CodeGenerator
+	filter    *CodeFilter
+
+	// retry son los reintentos ante colisiones y collisions cuenta los realizados
+	retry      RetryPolicy
+	collisions collisionCounters
+	// aliasSuggestions es el número de alternativas que se sugieren a un alias ocupado
+	aliasSuggestions int
+	// caseInsensitive guarda y busca los códigos en minúsculas
+	caseInsensitive bool
+	// unicodeAliases admite alias con letras no ASCII y emoji
+	unicodeAliases bool
+
+	// deduplicate hace que una URL ya acortada por el mismo propietario reutilice su código
+	deduplicate bool
+
+	// idempotencyTTL es el tiempo durante el que ShortenIdempotent recuerda cada clave
+	idempotencyTTL time.Duration
+
+	// forwardQuery agrega la query de la URL corta al destino en todos los enlaces
+	forwardQuery bool
+
+	// geoResolver obtiene el país del visitante para los enlaces con GeoTargets
+	geoResolver geo.Resolver
+
+	// interstitialDomains son los dominios de destino que exigen la página de aviso
+	interstitialDomains []string
+
+	// ipAccess son las reglas de red que se aplican a las redirecciones de todos los enlaces
+	ipAccess IPAccessPolicy
+	// signingKey firma las URLs de los enlaces firmados; nil no admite crearlos
+	signingKey []byte
+
+	// quarantineThreshold es el número de reporters distintos que pone un enlace en cuarentena
+	quarantineThreshold int
+
+	// domainPolicy son las listas de dominios vigentes; se reemplaza entera al recargarlas
+	domainPolicy atomic.Pointer[DomainPolicy]
+	// domainSource indica de dónde recargar las listas de dominios
+	domainSource DomainPolicySource
+
+	// domains son los dominios personalizados de los propietarios
+	domains customDomains
+	// tenants son los espacios de códigos independientes por clave de API o host
+	tenants tenants
+
+	// threatChecker consulta la reputación de los destinos; nil desactiva la comprobación
+	threatChecker threat.Checker
+	// threatTimeout acota la consulta de reputación al crear o editar un enlace
+	threatTimeout time.Duration
+
+	// allowPrivateDestinations desactiva el rechazo de destinos en redes privadas o internas
+	allowPrivateDestinations bool
+	// destinationResolver resuelve los dominios de destino para detectar los que apuntan a la
+	// red interna; nil limita la comprobación a IPs literales y nombres conocidos
+	destinationResolver HostResolver
+
+	// reachabilityMode es ReachabilityAsync, ReachabilityReject o vacío si no se comprueban
+	// los destinos
+	reachabilityMode string
+	// prober comprueba si los destinos responden
+	prober Prober
+	// reachabilityQueue son los códigos pendientes de comprobar en modo async
+	reachabilityQueue chan string
+	// brokenAfter es el número de comprobaciones fallidas seguidas que marca un destino roto
+	brokenAfter int
+
+	// metadataFetcher obtiene los metadatos de los destinos; nil desactiva la vista previa
+	// enriquecida
+	metadataFetcher MetadataFetcher
+	// metadataTTL es el tiempo durante el que se reutilizan los metadatos obtenidos
+	metadataTTL time.Duration
+	// metadataQueue son los códigos pendientes de obtener sus metadatos al crearse o editarse
+	metadataQueue chan string
+
+	// maxURLLength es la longitud máxima de las URLs de destino; cero no la limita
+	maxURLLength int
+	// maxLinks, maxLinksPerClient y maxLinksPerTenant limitan los enlaces almacenados; cero
+	// no los limita
+	maxLinks          int
+	maxLinksPerClient int
+	maxLinksPerTenant int
+	// quotaMu serializa la comprobación de cuotas y la escritura del enlace
+	quotaMu sync.Mutex
+	// transferMu serializa la comprobación y la escritura de las ofertas de traspaso
+	transferMu sync.Mutex
+
+	// apiKeys son los identificadores (APIKeyID) de las claves de API de WithAPIKeys
+	apiKeys map[string]bool
+	// usage mide el consumo mensual de cada clave de API y aplica sus cuotas
+	usage usageMeter
+
+	// visitors cifra los visitantes con una sal rotativa para contar los únicos
+	visitors *visitorHasher
+	// botPatterns son fragmentos de User-Agent de bots además de KnownCrawlers
+	botPatterns []string
+	// excludeBots saca a los bots de las cuotas de redirecciones y de las pruebas A/B
+	excludeBots bool
+	// clicksToday cuenta las visitas del día para GetStats
+	clicksToday dailyClicks
+	// anomalies detecta picos de visitas por enlace y por IP; nil si no se detectan
+	anomalies *anomalyDetector
+	// passwordFailures bloquea los enlaces protegidos tras varias contraseñas incorrectas
+	passwordFailures passwordFailures
+
+	// bloom son los códigos existentes; nil si la generación consulta siempre al almacén
+	bloom *BloomFilter
+	// bloomReady indica que bloom ya contiene los códigos del almacén
+	bloomReady atomic.Bool
+
+	// listeners reciben los eventos de los enlaces
+	listeners []EventListener
+	// expiry recuerda hasta cuándo se notificaron las expiraciones
+	expiry expiryWatch
+}
+
+// ServiceOption configura comportamientos opcionales del servicio
+type ServiceOption func(*Service)
+
+// WithDeduplication activa el modo en que la misma URL larga retorna el mismo código
+// para un mismo propietario (los enlaces anónimos comparten un único espacio)
+func WithDeduplication(enabled bool) ServiceOption {
+	return func(s *Service) {
+		s.deduplicate = enabled
+	}
+}
+
+// WithCodeGenerator reemplaza la estrategia de generación de códigos (por defecto HashGenerator
+// con DefaultCodeFormat)
+func WithCodeGenerator(generator CodeGenerator) ServiceOption {
+	return func(s *Service) {
+		s.generator = generator
+	}
+}
+
+// WithCodeFilter reemplaza el filtro de palabras reservadas y ofensivas
+func WithCodeFilter(filter *CodeFilter) ServiceOption {
+	return func(s *Service) {
+		s.filter = filter
+	}
 }
 
-// NewService crea una nueva instancia del servicio
-func NewService(store *Store) *Service {
-	return &Service{
-		store: store,
-		rand:  rand.New(rand.NewSource(time.Now().UnixNano())),
+// NewService crea una nueva instancia del servicio sobre cualquier implementación de LinkStore
+func NewService(store LinkStore, opts ...ServiceOption) *Service {
+	s := &Service{
+		store:     store,
+		generator: NewHashGenerator(DefaultCodeFormat()),
+		filter:    NewCodeFilter(DefaultReservedWords, nil),
+		retry:     RetryPolicy{MaxRetries: MaxRetries, WarnAfter: DefaultRetryWarnAfter},
+
+		aliasSuggestions: DefaultAliasSuggestions,
+
+		idempotencyTTL: DefaultIdempotencyTTL,
+		brokenAfter:    1,
+		maxURLLength:   DefaultMaxURLLength,
+		visitors:       newVisitorHasher(),
+	}
+	s.expiry.last = time.Now()
+	defaultPolicy, _ := NewDomainPolicy(DefaultBlockedDomains, nil)
+	s.domainPolicy.Store(defaultPolicy)
+	for _, opt := range opts {
+		opt(s)
 	}
+	return s
 }
 
 // ShortenURL acorta una URL larga y retorna el código corto usando patrones idiomáticos de Go
-func (s *Service) ShortenURL(longURL string) (shortCode string, err error) {
+func (s *Service) ShortenURL(ctx context.Context, longURL string) (shortCode string, err error) {
+	link, _, err := s.Shorten(ctx, ShortenInput{LongURL: longURL})
+	if err != nil {
+		return "", err
+	}
+	return link.ShortCode, nil
+}
+
+// Shorten crea un enlace corto registrando su propietario y metadatos. El valor created es
+// false cuando el modo de deduplicación retorna un enlace ya existente para la misma URL.
+func (s *Service) Shorten(ctx context.Context, input ShortenInput) (link Link, created bool, err error) {
 	// Defer para logging y cleanup siguiendo la Guía 2
 	defer func() {
 		if r := recover(); r != nil {
 			// Recover de panic crítico
-			err = fmt.Errorf("error crítico en ShortenURL: %v", r)
-			shortCode = ""
+			err = fmt.Errorf("%w en ShortenURL: %v", ErrCritical, r)
+			link = Link{}
+			created = false
 		}
 	}()
 
-	// Validación temprana con if idiomático
-	if err := s.validateURL(longURL); err != nil {
-		return "", err
+	// Validación temprana con if idiomático; se reportan todos los campos inválidos a la vez
+	input.Alias = s.foldCode(input.Alias)
+	if err := s.validateInput(input); err != nil {
+		return Link{}, false, err
+	}
+	// El enlace se cuenta en la cuota de la clave al empezar y se devuelve si no se crea, para
+	// que peticiones concurrentes no la superen
+	keyID := s.usageKeyID(input.APIKey)
+	if err := s.usage.reserve(keyID, UsageShortens); err != nil {
+		return Link{}, false, err
+	}
+	defer func() {
+		if err != nil {
+			s.usage.release(keyID, UsageShortens)
+		}
+	}()
+	if err := s.checkThreats(ctx, threatTargets(Link{
+		LongURL:       input.LongURL,
+		GeoTargets:    input.GeoTargets,
+		DeviceTargets: input.DeviceTargets,
+		Variants:      input.Variants,
+	})); err != nil {
+		return Link{}, false, err
+	}
+	health, err := s.verifyReachability(ctx, input.LongURL)
+	if err != nil {
+		return Link{}, false, err
 	}
 
-	// Generar código corto único con manejo robusto
-	if shortCode, err := s.generateUniqueShortCode(longURL); err != nil {
-		return "", err
-	} else {
-		// Almacenar la relación solo si la generación fue exitosa
-		s.store.Save(shortCode, longURL)
-		return shortCode, nil
+	// La deduplicación no aplica cuando se pide un alias, una expiración, una contraseña,
+	// destinos alternativos, reenvío de la query o UTM, redirección permanente o enmascarada,
+	// procedencias o redes permitidas, firma, etiquetas, notas o un espacio compartido, ya que
+	// el enlace existente no tendría las mismas reglas ni los mismos datos
+	dedupe := (s.deduplicate || input.Deduplicate) && input.Alias == "" && input.TTL == 0 && input.Password == "" &&
+		len(input.GeoTargets) == 0 && len(input.DeviceTargets) == 0 && len(input.Variants) == 0 && !input.StickyVariants && !input.Interstitial &&
+		!input.ForwardQuery && input.UTM.IsZero() &&
+		normalizeRedirectType(input.RedirectType) == "" && input.Cloak.IsZero() && input.Referrers.IsZero() && input.IPAccess.IsZero() && !input.Signed &&
+		len(input.Tags) == 0 && input.Description == "" && len(input.CustomMetadata) == 0 && input.Workspace == ""
+	if dedupe {
+		existing, found, err := s.store.FindByURL(ctx, TenantKey(input.Tenant, input.Owner), input.LongURL)
+		if err != nil {
+			return Link{}, false, storeError(err)
+		}
+		if found && !existing.IsExpired(time.Now()) && !existing.IsDisabled() {
+			return existing, false, nil
+		}
+	}
+
+	// Los enlaces de un propietario con dominio personalizado viven en el espacio de códigos de
+	// ese dominio; los dominios personalizados solo aplican fuera de los tenants
+	domain := ""
+	if input.Tenant == "" {
+		domain = s.ownerDomain(input.Owner)
+	}
+
+	// Usar el alias solicitado o generar un código corto único
+	var shortCode string
+	if input.Alias != "" {
+		if err := s.filter.checkAlias(input.Alias); err != nil {
+			return Link{}, false, err
+		}
+		taken, err := s.store.Exists(ctx, TenantKey(input.Tenant, LinkKey(domain, input.Alias)))
+		if err != nil {
+			return Link{}, false, storeError(err)
+		}
+		if taken {
+			return Link{}, false, s.aliasTaken(ctx, input.Tenant, domain, input.Alias)
+		}
+		shortCode = input.Alias
+	} else if shortCode, err = s.generateUniqueShortCode(ctx, input.Tenant, domain, input.LongURL); err != nil {
+		return Link{}, false, err
+	}
+
+	// Almacenar la relación solo si la generación fue exitosa; validateInput ya comprobó los
+	// metadatos
+	customMetadata, _ := normalizeCustomMetadata(input.CustomMetadata)
+	now := time.Now()
+	link = Link{
+		ShortCode: shortCode,
+		LongURL:   input.LongURL,
+		Owner:     input.Owner,
+		Domain:    domain,
+		Tenant:    input.Tenant,
+		Workspace: input.Workspace,
+		Client:    input.Client,
+		APIKeyID:  keyID,
+		CreatedAt: now,
+		UpdatedAt: now,
+
+		ForwardQuery: input.ForwardQuery,
+		UTM:          input.UTM,
+		GeoTargets:   normalizeGeoTargets(input.GeoTargets),
+
+		DeviceTargets: normalizeDeviceTargets(input.DeviceTargets),
+
+		Variants:       normalizeVariants(input.Variants),
+		StickyVariants: input.StickyVariants,
+		Interstitial:   input.Interstitial,
+		RedirectType:   normalizeRedirectType(input.RedirectType),
+		Cloak:          input.Cloak.normalize(),
+		Referrers:      input.Referrers.normalize(),
+		IPAccess:       input.IPAccess.normalize(),
+		Signed:         input.Signed,
+		Health:         health,
+		Tags:           normalizeTags(input.Tags),
+		Description:    input.Description,
+		CustomMetadata: customMetadata,
+	}
+	if input.TTL > 0 {
+		link.ExpiresAt = now.Add(input.TTL)
+	}
+	if input.Password != "" {
+		if link.PasswordHash, err = hashPassword(input.Password); err != nil {
+			return Link{}, false, err
+		}
+	}
+
+	unlock, err := s.lockQuota(ctx, input.Client, input.Tenant)
+	if err != nil {
+		return Link{}, false, err
+	}
+	defer unlock()
+
+	// En modo deduplicación otra petición concurrente puede haber creado el enlace mientras se
+	// generaba el código: GetOrSave decide de forma atómica. Ni GetOrSave ni SaveLinkIfAbsent
+	// sobrescriben un código que otra petición ocupó después de comprobarlo (o que no se
+	// comprobó, como los de los generadores únicos); los códigos generados se regeneran y los
+	// alias se rechazan
+	for attempt := 1; ; attempt++ {
+		if dedupe {
+			var result Link
+			if result, created, err = s.store.GetOrSave(ctx, link); err != nil {
+				return Link{}, false, storeError(err)
+			}
+			// Un result vacío es un código ocupado; si no, es el enlace creado o el existente
+			if result.ShortCode != "" {
+				link = result
+				break
+			}
+		} else {
+			if created, err = s.store.SaveLinkIfAbsent(ctx, link); err != nil {
+				return Link{}, false, storeError(err)
+			}
+			if created {
+				break
+			}
+		}
+		if input.Alias != "" {
+			return Link{}, false, s.aliasTaken(ctx, input.Tenant, domain, input.Alias)
+		}
+		if attempt >= s.retry.MaxRetries {
+			s.recordGeneration(input.Tenant, domain, attempt, true)
+			return Link{}, false, saturationError(attempt)
+		}
+		if s.bloom != nil {
+			s.bloom.Add(link.Key())
+		}
+		if link.ShortCode, err = s.generateUniqueShortCode(ctx, input.Tenant, domain, input.LongURL); err != nil {
+			return Link{}, false, err
+		}
+	}
+
+	if created {
+		if s.bloom != nil {
+			s.bloom.Add(link.Key())
+		}
+		if err := s.audit(ctx, Actor{UserID: input.Owner}, AuditCreate, nil, &link); err != nil {
+			return Link{}, false, err
+		}
+		s.enqueueReachability(link.Key())
+		s.enqueueMetadata(link.Key())
+		s.emit(EventCreated, link, "", "")
+	}
+	return link, created, nil
+}
+
+// validateInput valida los campos de la entrada y combina con errors.Join los
+// *ValidationError de cada campo inválido
+func (s *Service) validateInput(input ShortenInput) error {
+	var errs []error
+	if err := s.validateURL(input.LongURL); err != nil {
+		errs = append(errs, err)
+	}
+	if input.TTL < 0 {
+		errs = append(errs, &ValidationError{Field: "ttl_seconds", Value: input.TTL.Seconds(), Msg: "no puede ser negativo"})
+	}
+	if input.Alias != "" {
+		if err := s.checkAliasFormat(input.Alias); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if input.Password != "" {
+		if err := validatePassword(input.Password); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := input.UTM.validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := s.validateGeoTargets(input.GeoTargets); err != nil {
+		errs = append(errs, err)
+	}
+	if err := s.validateDeviceTargets(input.DeviceTargets); err != nil {
+		errs = append(errs, err)
+	}
+	if err := s.validateVariants(input.Variants); err != nil {
+		errs = append(errs, err)
+	}
+	if err := validateRedirectType(input.RedirectType); err != nil {
+		errs = append(errs, err)
+	}
+	if err := input.Cloak.normalize().validate(); err != nil {
+		errs = append(errs, err)
+	} else if !input.Cloak.IsZero() && input.RedirectType == RedirectPermanent {
+		errs = append(errs, &ValidationError{Field: "cloak.mode", Value: input.Cloak.Mode,
+			Msg: "no se puede combinar con redirect_type permanent"})
+	}
+	if err := input.Referrers.validate(); err != nil {
+		errs = append(errs, err)
+	} else if !input.Referrers.IsZero() && input.RedirectType == RedirectPermanent {
+		// Los navegadores repetirían la redirección guardada en caché sin comprobar la procedencia
+		errs = append(errs, &ValidationError{Field: "referrers.domains", Value: input.Referrers.Domains,
+			Msg: "no se puede combinar con redirect_type permanent"})
+	}
+	if err := input.IPAccess.validate(); err != nil {
+		errs = append(errs, err)
+	} else if !input.IPAccess.IsZero() && input.RedirectType == RedirectPermanent {
+		errs = append(errs, &ValidationError{Field: "ip_access", Value: input.IPAccess,
+			Msg: "no se puede combinar con redirect_type permanent"})
+	}
+	switch {
+	case input.Signed && s.signingKey == nil:
+		errs = append(errs, &ValidationError{Field: "signed", Value: true, Msg: "el servicio no tiene clave de firma de URLs"})
+	case input.Signed && input.RedirectType == RedirectPermanent:
+		errs = append(errs, &ValidationError{Field: "signed", Value: true, Msg: "no se puede combinar con redirect_type permanent"})
+	}
+	if err := validateTags(input.Tags); err != nil {
+		errs = append(errs, err)
+	}
+	if err := validateDescription(input.Description); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := normalizeCustomMetadata(input.CustomMetadata); err != nil {
+		errs = append(errs, err)
 	}
+	return errors.Join(errs...)
+}
+
+// validateAlias comprueba longitud y caracteres de un alias personalizado
+func validateAlias(alias string) error {
+	if len(alias) < MinAliasLength || len(alias) > MaxAliasLength {
+		return &ValidationError{Field: "alias", Value: alias, Err: ErrInvalidAlias,
+			Msg: fmt.Sprintf("debe tener entre %d y %d caracteres", MinAliasLength, MaxAliasLength)}
+	}
+
+	for _, c := range alias {
+		if !strings.ContainsRune(ValidChars, c) && c != '-' && c != '_' {
+			return &ValidationError{Field: "alias", Value: alias, Err: ErrInvalidAlias,
+				Msg: "solo se permiten letras, números, '-' y '_'"}
+		}
+	}
+	return nil
 }
 
 // GetLongURL obtiene la URL larga asociada a un código corto con patrones idiomáticos
-func (s *Service) GetLongURL(shortCode string) (longURL string, err error) {
+func (s *Service) GetLongURL(ctx context.Context, shortCode string) (longURL string, err error) {
 	// Defer para logging y cleanup siguiendo la Guía 2
 	defer func() {
 		if r := recover(); r != nil {
 			// Recover de panic crítico
-			err = fmt.Errorf("error crítico en GetLongURL: %v", r)
+			err = fmt.Errorf("%w en GetLongURL: %v", ErrCritical, r)
 			longURL = ""
 		}
 	}()
 
-	// Validación temprana con if idiomático
-	if trimmedCode := strings.TrimSpace(shortCode); trimmedCode == "" {
-		return "", ErrEmptyURL
-	} else {
-		// Buscar en el almacén con manejo idiomático
-		if longURL, exists := s.store.Get(trimmedCode); !exists {
-			return "", ErrURLNotFound
-		} else {
-			return longURL, nil
+	// Buscar en el almacén con manejo idiomático
+	link, err := s.GetLink(ctx, shortCode)
+	if err != nil {
+		return "", err
+	}
+
+	// Los enlaces desactivados o expirados dejan de redirigir pero se conservan para su gestión
+	if link.IsDisabled() {
+		return "", &DisabledError{Reason: link.DisabledReason}
+	}
+	if link.IsExpired(time.Now()) {
+		return "", ErrURLExpired
+	}
+	return link.LongURL, nil
+}
+
+// GetLink obtiene el enlace completo asociado a un código corto
+func (s *Service) GetLink(ctx context.Context, shortCode string) (Link, error) {
+	trimmedCode := s.foldCode(strings.TrimSpace(shortCode))
+	if trimmedCode == "" {
+		return Link{}, ErrEmptyURL
+	}
+
+	link, exists, err := s.store.GetLink(ctx, trimmedCode)
+	if err != nil {
+		return Link{}, storeError(err)
+	}
+	if !exists {
+		return Link{}, ErrURLNotFound
+	}
+	return link, nil
+}
+
+// ManagedLink obtiene el enlace si el actor es su propietario, editor de su espacio o
+// administrador, p. ej. para exportar su analítica
+func (s *Service) ManagedLink(ctx context.Context, actor Actor, shortCode string) (Link, error) {
+	link, err := s.GetLink(ctx, shortCode)
+	if err != nil {
+		return Link{}, err
+	}
+	if !actor.canManage(link) {
+		return Link{}, ErrForbidden
+	}
+	return link, nil
+}
+
+// Click describe una redirección servida
+type Click struct {
+	// Variant es la variante A/B servida (Redirect.Variant); vacía si no hubo
+	Variant string
+	// Visitor identifica de forma anónima al visitante en los eventos (p. ej. un hash de su IP
+	// y User-Agent) y en la cuenta de visitantes únicos, que solo guarda un hash con sal
+	// rotativa (ver VisitorSketch); puede ir vacío
+	Visitor string
+	// Bot indica que la visita es de un bot (Redirect.Bot); los bots no cuentan como visitantes
+	// únicos
+	Bot bool
+	// Referrer es el dominio del que procede la visita y Country su país (Redirect.Country);
+	// solo se publican en los eventos y pueden ir vacíos
+	Referrer string
+	Country  string
+}
+
+// RecordClick registra una redirección servida para el código corto y, si la visita recibió
+// una variante A/B, también para esa variante
+func (s *Service) RecordClick(ctx context.Context, shortCode string, click Click) error {
+	shortCode = s.foldCode(strings.TrimSpace(shortCode))
+	visit := Visit{Variant: click.Variant, Bot: click.Bot}
+	if !click.Bot {
+		visit.Visitor = s.visitors.hash(click.Visitor)
+	}
+	if err := s.store.IncrementClicks(ctx, shortCode, visit); err != nil {
+		return storeError(err)
+	}
+	s.clicksToday.add(time.Now())
+	// Solo se relee el enlace si alguien escucha los eventos
+	if len(s.listeners) > 0 {
+		if link, found, err := s.store.GetLink(ctx, shortCode); err == nil && found {
+			s.publish(Event{Type: EventClicked, Time: time.Now(), Link: link, Variant: click.Variant, Visitor: click.Visitor, Bot: click.Bot,
+				Referrer: click.Referrer, Country: click.Country})
 		}
 	}
+	return nil
+}
+
+// ListByOwner retorna los enlaces creados por un usuario en el espacio del tenant
+func (s *Service) ListByOwner(ctx context.Context, tenant, owner string) ([]Link, error) {
+	links, err := s.store.ListByOwner(ctx, TenantKey(tenant, owner))
+	if err != nil {
+		return nil, storeError(err)
+	}
+	return links, nil
+}
+
+// UpdateURL cambia el destino de un enlace si el actor es su propietario o administrador
+func (s *Service) UpdateURL(ctx context.Context, actor Actor, shortCode, longURL string) (Link, error) {
+	link, err := s.GetLink(ctx, shortCode)
+	if err != nil {
+		return Link{}, err
+	}
+
+	if !actor.canManage(link) {
+		return Link{}, ErrForbidden
+	}
+
+	if err := s.validateURL(longURL); err != nil {
+		return Link{}, err
+	}
+	if err := s.checkThreats(ctx, []threatTarget{{field: "long_url", url: longURL}}); err != nil {
+		return Link{}, err
+	}
+	health, err := s.verifyReachability(ctx, longURL)
+	if err != nil {
+		return Link{}, err
+	}
+
+	before := link
+	link.LongURL = longURL
+	link.UpdatedAt = time.Now()
+	link.Health = health
+	link.Metadata = LinkMetadata{}
+	if err := s.store.SaveLink(ctx, link); err != nil {
+		return Link{}, storeError(err)
+	}
+	if err := s.audit(ctx, actor, AuditUpdate, &before, &link); err != nil {
+		return Link{}, err
+	}
+	s.enqueueReachability(link.Key())
+	s.enqueueMetadata(link.Key())
+	return link, nil
+}
+
+// DeleteURL elimina un enlace si el actor es su propietario o administrador. Para los
+// propietarios el borrado es lógico: el enlace queda desactivado y puede restaurarse con
+// EnableURL. Solo los administradores lo eliminan definitivamente.
+func (s *Service) DeleteURL(ctx context.Context, actor Actor, shortCode string) error {
+	link, err := s.GetLink(ctx, shortCode)
+	if err != nil {
+		return err
+	}
+
+	if !actor.canDelete(link) {
+		return ErrForbidden
+	}
+
+	if !actor.Admin {
+		if link.IsDisabled() {
+			return nil
+		}
+		disabled, err := s.disable(ctx, link, DeletedReason)
+		if err != nil {
+			return err
+		}
+		return s.audit(ctx, actor, AuditDelete, &link, &disabled)
+	}
+
+	deleted, err := s.store.Delete(ctx, link.Key())
+	if err != nil {
+		return storeError(err)
+	}
+	if !deleted {
+		return ErrURLNotFound
+	}
+	return s.audit(ctx, actor, AuditDelete, &link, nil)
 }
 
 // validateURL valida que la URL sea válida usando named return values y validaciones múltiples
@@ -135,12 +817,12 @@ func (s *Service) validateURL(longURL string) (err error) {
 
 // validateURLBasics realiza validaciones básicas
 func (s *Service) validateURLBasics(longURL string) error {
-	if longURL == "" {
-		return &ValidationError{Field: "long_url", Value: longURL, Msg: "no puede estar vacía"}
-	}
-
 	if strings.TrimSpace(longURL) == "" {
-		return &ValidationError{Field: "long_url", Value: longURL, Msg: "no puede contener solo espacios"}
+		return &ValidationError{Field: "long_url", Value: longURL, Msg: "no puede estar vacía", Err: ErrEmptyURL}
+	}
+	if s.maxURLLength > 0 && len(longURL) > s.maxURLLength {
+		return &ValidationError{Field: "long_url", Value: longURL, Err: ErrURLTooLong,
+			Msg: fmt.Sprintf("supera la longitud máxima de %d caracteres", s.maxURLLength)}
 	}
 
 	return nil
@@ -150,114 +832,121 @@ func (s *Service) validateURLBasics(longURL string) error {
 func (s *Service) validateURLFormat(longURL string) error {
 	parsedURL, err := url.Parse(longURL)
 	if err != nil {
-		return &ValidationError{Field: "long_url", Value: longURL, Msg: "formato inválido"}
+		return &ValidationError{Field: "long_url", Value: longURL, Msg: "no tiene un formato de URL válido", Err: ErrInvalidURL}
 	}
 
+	// Solo se aceptan URLs absolutas http/https con host
 	if parsedURL.Scheme != "http" && parsedURL.Scheme != "https" {
-		return &ValidationError{Field: "long_url", Value: longURL, Msg: "debe usar esquema http o https"}
+		return &ValidationError{Field: "long_url", Value: longURL, Msg: "debe usar esquema http o https", Err: ErrInvalidURL}
 	}
 
 	if parsedURL.Host == "" {
-		return &ValidationError{Field: "long_url", Value: longURL, Msg: "debe tener un host válido"}
+		return &ValidationError{Field: "long_url", Value: longURL, Msg: "debe incluir un dominio", Err: ErrInvalidURL}
 	}
 
 	return nil
 }
 
-// validateURLSecurity realiza validaciones de seguridad
+// validateURLSecurity aplica las listas de dominios bloqueados y permitidos y rechaza los
+// destinos en la red interna
 func (s *Service) validateURLSecurity(longURL string) error {
-	// Lista de dominios bloqueados (ejemplo de validación de seguridad)
-	blockedDomains := []string{"malware.com", "phishing.net", "spam.org"}
-	
 	parsedURL, _ := url.Parse(longURL)
-	for _, blocked := range blockedDomains {
-		if strings.Contains(parsedURL.Host, blocked) {
-			return &ValidationError{Field: "long_url", Value: longURL, Msg: "dominio bloqueado por seguridad"}
-		}
+	if reason := s.domainPolicy.Load().check(parsedURL.Hostname()); reason != "" {
+		return &ValidationError{Field: "long_url", Value: longURL, Msg: reason, Err: ErrInvalidURL}
+	}
+	if reason := s.checkDestinationHost(parsedURL.Hostname()); reason != "" {
+		return &ValidationError{Field: "long_url", Value: longURL, Msg: reason, Err: ErrInvalidURL}
 	}
 
 	return nil
 }
 
-// generateUniqueShortCode genera un código corto único resistente a colisiones con retry pattern
-func (s *Service) generateUniqueShortCode(longURL string) (string, error) {
+// generateUniqueShortCode genera un código corto único en el tenant y el dominio indicados
+// (vacíos para el espacio común y el dominio principal) resistente a colisiones con retry pattern
+func (s *Service) generateUniqueShortCode(ctx context.Context, tenant, domain, longURL string) (string, error) {
 	// Defer para logging de intentos siguiendo la Guía 2
 	defer func() {
 		if r := recover(); r != nil {
-			panic(fmt.Errorf("error crítico en generación de código: %v", r))
+			panic(fmt.Errorf("%w en generación de código: %v", ErrCritical, r))
 		}
 	}()
 
-	// Retry pattern con for loop idiomático
-	for attempt := 0; attempt < MaxRetries; attempt++ {
-		// Switch para manejar diferentes estrategias según el intento
-		var shortCode string
-		switch {
-		case attempt < 3:
-			// Primeros intentos: estrategia normal
-			shortCode = s.generateShortCode(longURL, attempt)
-		case attempt < 7:
-			// Intentos intermedios: agregar más entropía
-			shortCode = s.generateShortCode(longURL, attempt*2) // Más variación
-		default:
-			// Últimos intentos: estrategia agresiva con timestamp
-			shortCode = s.generateShortCode(longURL+fmt.Sprintf("_%d", time.Now().UnixNano()), attempt)
+	// Los generadores únicos (p. ej. snowflake) no necesitan consultar al almacén
+	unique := false
+	if g, ok := s.generator.(UniqueCodeGenerator); ok {
+		unique = g.Unique()
+	}
+
+	// Retry pattern con for loop idiomático; la estrategia de cada intento la decide el generador
+	for attempt := 0; attempt < s.retry.MaxRetries; attempt++ {
+		generated := s.generator.Generate(longURL, attempt)
+		shortCode := s.foldCode(generated)
+		// Un código único deja de serlo si pasarlo a minúsculas lo cambia: "AbC" y "abc" son
+		// códigos distintos del generador pero la misma clave
+		checked := unique && shortCode == generated
+
+		// Los códigos reservados u ofensivos se descartan y se genera otro
+		if s.filter.Check(shortCode) != nil {
+			continue
 		}
-		
-		// Verificar si el código ya existe
-		if !s.store.Exists(shortCode) {
+
+		// Verificar si el código ya existe (p. ej. un alias personalizado); el filtro de Bloom
+		// descarta sin consultar al almacén la mayoría de los códigos libres
+		key := TenantKey(tenant, LinkKey(domain, shortCode))
+		if checked || !s.codeMayExist(key) {
+			s.recordGeneration(tenant, domain, attempt+1, false)
 			return shortCode, nil
 		}
+		exists, err := s.store.Exists(ctx, key)
+		if err != nil {
+			return "", storeError(err)
+		}
+		if !exists {
+			s.recordGeneration(tenant, domain, attempt+1, false)
+			return shortCode, nil
+		}
+	}
+
+	s.recordGeneration(tenant, domain, s.retry.MaxRetries, true)
+	return "", saturationError(s.retry.MaxRetries)
+}
+
+// EachLink recorre todos los enlaces del almacén (p. ej. para exportarlos); los errores del
+// almacén se normalizan y los de fn se retornan sin cambios
+func (s *Service) EachLink(ctx context.Context, fn func(Link) error) error {
+	var fnErr error
+	err := s.store.Each(ctx, func(link Link) error {
+		if fnErr = fn(link); fnErr != nil {
+			return fnErr
+		}
+		return nil
+	})
+	if err != nil && fnErr == nil {
+		return storeError(err)
+	}
+	return err
+}
+
+// RestoreLink guarda un enlace leído de una copia de seguridad tal cual, reemplazando al que
+// tenga el mismo código, y lo agrega al filtro de Bloom. Si los códigos no distinguen
+// mayúsculas, el código se guarda en minúsculas.
+func (s *Service) RestoreLink(ctx context.Context, link Link) error {
+	link.ShortCode = s.foldCode(link.ShortCode)
+	if err := s.store.SaveLink(ctx, link); err != nil {
+		return storeError(err)
 	}
-	
-	return "", ErrMaxRetries
-}
-
-// generateShortCode genera un código corto usando closure para entrada única
-func (s *Service) generateShortCode(longURL string, attempt int) string {
-	// Usar closure para generar entrada única
-	entryGenerator := s.createEntryGenerator(longURL, attempt)
-	entry := entryGenerator()
-	
-	// Generar hash MD5
-	hash := md5.Sum([]byte(entry))
-	hashString := hex.EncodeToString(hash[:])
-	
-	// Tomar los primeros caracteres y convertir a base alfanumérica
-	result := make([]byte, ShortCodeLength)
-	for i := 0; i < ShortCodeLength; i++ {
-		index := int(hashString[i]) % len(ValidChars)
-		result[i] = ValidChars[index]
-	}
-	
-	return string(result)
-}
-
-// createEntryGenerator crea un closure para generar entradas únicas
-func (s *Service) createEntryGenerator(longURL string, attempt int) func() string {
-	// Variables capturadas por el closure
-	timestamp := time.Now().UnixNano()
-	randomValue := s.rand.Int63()
-	
-	return func() string {
-		var builder strings.Builder
-		builder.Grow(len(longURL) + 50) // Pre-allocar para mejor performance
-		
-		builder.WriteString(longURL)
-		builder.WriteString("_")
-		builder.WriteString(fmt.Sprintf("%d", timestamp))
-		builder.WriteString("_")
-		builder.WriteString(fmt.Sprintf("%d", attempt))
-		builder.WriteString("_")
-		builder.WriteString(fmt.Sprintf("%d", randomValue))
-		
-		return builder.String()
-	}
-}
-
-// GetStats retorna estadísticas del servicio
-func (s *Service) GetStats() map[string]interface{} {
-	return map[string]interface{}{
-		"total_urls": s.store.Count(),
+	if s.bloom != nil {
+		s.bloom.Add(link.Key())
+	}
+	return nil
+}
+
+// storeError normaliza los fallos del almacén: la cancelación o el vencimiento del contexto
+// se propagan tal cual para que el llamador distinga un timeout, y el resto se envuelve
+// en ErrServiceUnavailable
+func storeError(err error) error {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return err
 	}
+	return fmt.Errorf("%w: %v", ErrServiceUnavailable, err)
 }
@@ -1,9 +1,29 @@
 package shortener
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"acortador-urls/internal/errcode"
+	"acortador-urls/internal/geo"
+	"acortador-urls/internal/threat"
 )
 
 func TestStore_ConcurrentAccess(t *testing.T) {
@@ -23,7 +43,7 @@ func TestStore_ConcurrentAccess(t *testing.T) {
 			for j := 0; j < numOperations; j++ {
 				shortCode := fmt.Sprintf("code%d_%d", id, j)
 				longURL := fmt.Sprintf("https://example.com/%d/%d", id, j)
-				store.Save(shortCode, longURL)
+				store.Save(context.Background(), shortCode, longURL)
 			}
 		}(i)
 	}
@@ -32,8 +52,8 @@ func TestStore_ConcurrentAccess(t *testing.T) {
 
 	// Verificar que todas las URLs se guardaron
 	expectedCount := numGoroutines * numOperations
-	if store.Count() != expectedCount {
-		t.Errorf("Expected %d URLs, got %d", expectedCount, store.Count())
+	if count, _ := store.Count(context.Background()); count != expectedCount {
+		t.Errorf("Expected %d URLs, got %d", expectedCount, count)
 	}
 
 	// Test lecturas concurrentes
@@ -45,7 +65,7 @@ func TestStore_ConcurrentAccess(t *testing.T) {
 				shortCode := fmt.Sprintf("code%d_%d", id, j)
 				expectedURL := fmt.Sprintf("https://example.com/%d/%d", id, j)
 
-				if url, exists := store.Get(shortCode); !exists || url != expectedURL {
+				if url, exists, _ := store.Get(context.Background(), shortCode); !exists || url != expectedURL {
 					t.Errorf("Expected URL %s for code %s, got %s (exists: %v)",
 						expectedURL, shortCode, url, exists)
 				}
@@ -56,6 +76,106 @@ func TestStore_ConcurrentAccess(t *testing.T) {
 	wg.Wait()
 }
 
+func TestStore_SaveIfAbsent(t *testing.T) {
+	store := NewStore()
+	numGoroutines := 50
+
+	// De muchas escrituras concurrentes del mismo código solo una lo obtiene
+	var wg sync.WaitGroup
+	var created atomic.Int32
+	winner := make(chan string, numGoroutines)
+	wg.Add(numGoroutines)
+	for i := 0; i < numGoroutines; i++ {
+		go func(id int) {
+			defer wg.Done()
+			longURL := fmt.Sprintf("https://example.com/%d", id)
+			if ok, err := store.SaveIfAbsent(context.Background(), "shared", longURL); err == nil && ok {
+				created.Add(1)
+				winner <- longURL
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if created.Load() != 1 {
+		t.Fatalf("Expected exactly one creation, got %d", created.Load())
+	}
+	if url, _, _ := store.Get(context.Background(), "shared"); url != <-winner {
+		t.Errorf("Expected the first mapping to be kept, got %s", url)
+	}
+}
+
+func TestStore_DedupIndex(t *testing.T) {
+	ctx := context.Background()
+	const testURL = "https://www.example.com/indice"
+	store := NewStore()
+
+	tests := []struct {
+		name         string
+		link         Link
+		expectedCode string
+	}{
+		{name: "Enlace reutilizable", link: Link{ShortCode: "simple", LongURL: testURL, Owner: "alice"}, expectedCode: "simple"},
+		{name: "Con contraseña no se indexa", link: Link{ShortCode: "privado", LongURL: testURL, Owner: "alice", PasswordHash: "hash"}, expectedCode: "simple"},
+		{name: "Con etiquetas no se indexa", link: Link{ShortCode: "etiquetado", LongURL: testURL, Owner: "alice", Tags: []string{"promo"}}, expectedCode: "simple"},
+		{name: "Otro reutilizable conserva el indexado", link: Link{ShortCode: "otro", LongURL: testURL, Owner: "alice"}, expectedCode: "simple"},
+		{name: "Con expiración sale del índice", link: Link{ShortCode: "simple", LongURL: testURL, Owner: "alice", ExpiresAt: time.Now().Add(-time.Hour)}, expectedCode: ""},
+		{name: "Reutilizable tras sacar el indexado", link: Link{ShortCode: "nuevo", LongURL: testURL, Owner: "alice"}, expectedCode: "nuevo"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store.SaveLink(ctx, tt.link)
+			link, found, _ := store.FindByURL(ctx, "alice", testURL)
+			if found != (tt.expectedCode != "") || link.ShortCode != tt.expectedCode {
+				t.Errorf("Expected indexed code %q, got %q (found %v)", tt.expectedCode, link.ShortCode, found)
+			}
+		})
+	}
+}
+
+// staleExistsStore simula la carrera entre Exists y la escritura: el código parece libre al
+// comprobarlo aunque otra petición ya lo ocupó
+type staleExistsStore struct {
+	*Store
+}
+
+func (staleExistsStore) Exists(ctx context.Context, shortCode string) (bool, error) {
+	return false, nil
+}
+
+func TestService_SaveIfAbsentRace(t *testing.T) {
+	ctx := context.Background()
+	store := staleExistsStore{NewStore()}
+	store.Save(ctx, "taken1", "https://www.example.com/original")
+	service := NewService(store, WithCodeGenerator(&stubGenerator{codes: []string{"taken1", "free01"}}))
+
+	tests := []struct {
+		name         string
+		input        ShortenInput
+		expectedCode string
+		expectedErr  error
+	}{
+		{name: "Código generado ocupado se regenera", input: ShortenInput{LongURL: "https://www.example.com/a"}, expectedCode: "free01"},
+		{name: "Alias ocupado se rechaza", input: ShortenInput{LongURL: "https://www.example.com/b", Alias: "taken1"}, expectedErr: ErrAliasTaken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			link, _, err := service.Shorten(ctx, tt.input)
+			if !errors.Is(err, tt.expectedErr) {
+				t.Fatalf("Expected error %v, got %v", tt.expectedErr, err)
+			}
+			if link.ShortCode != tt.expectedCode {
+				t.Errorf("Expected code %q, got %q", tt.expectedCode, link.ShortCode)
+			}
+		})
+	}
+
+	// El enlace existente no se sobrescribió
+	if url, _, _ := store.Get(ctx, "taken1"); url != "https://www.example.com/original" {
+		t.Errorf("Expected original mapping to be kept, got %s", url)
+	}
+}
+
 func TestService_ShortenURL(t *testing.T) {
 	store := NewStore()
 	service := NewService(store)
@@ -104,13 +224,13 @@ func TestService_ShortenURL(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			shortCode, err := service.ShortenURL(tt.longURL)
+			shortCode, err := service.ShortenURL(context.Background(), tt.longURL)
 
 			if tt.expectError {
 				if err == nil {
 					t.Errorf("Expected error, got nil")
 				}
-				if tt.errorType != nil && err != tt.errorType {
+				if tt.errorType != nil && !errors.Is(err, tt.errorType) {
 					t.Errorf("Expected error %v, got %v", tt.errorType, err)
 				}
 			} else {
@@ -122,7 +242,7 @@ func TestService_ShortenURL(t *testing.T) {
 				}
 
 				// Verificar que el código se guardó correctamente
-				retrievedURL, err := service.GetLongURL(shortCode)
+				retrievedURL, err := service.GetLongURL(context.Background(), shortCode)
 				if err != nil {
 					t.Errorf("Error retrieving URL: %v", err)
 				}
@@ -140,13 +260,13 @@ func TestService_GetLongURL(t *testing.T) {
 
 	// Agregar una URL de prueba
 	testURL := "https://www.example.com"
-	shortCode, err := service.ShortenURL(testURL)
+	shortCode, err := service.ShortenURL(context.Background(), testURL)
 	if err != nil {
 		t.Fatalf("Error creating short URL: %v", err)
 	}
 
 	// Test obtener URL existente
-	retrievedURL, err := service.GetLongURL(shortCode)
+	retrievedURL, err := service.GetLongURL(context.Background(), shortCode)
 	if err != nil {
 		t.Errorf("Unexpected error: %v", err)
 	}
@@ -155,7 +275,7 @@ func TestService_GetLongURL(t *testing.T) {
 	}
 
 	// Test obtener URL no existente
-	_, err = service.GetLongURL("nonexistent")
+	_, err = service.GetLongURL(context.Background(), "nonexistent")
 	if err != ErrURLNotFound {
 		t.Errorf("Expected ErrURLNotFound, got %v", err)
 	}
@@ -170,7 +290,7 @@ func TestService_UniqueCodeGeneration(t *testing.T) {
 	codes := make(map[string]bool)
 
 	for i := 0; i < 100; i++ {
-		shortCode, err := service.ShortenURL(testURL)
+		shortCode, err := service.ShortenURL(context.Background(), testURL)
 		if err != nil {
 			t.Errorf("Error generating short code: %v", err)
 		}
@@ -189,7 +309,7 @@ func TestService_CollisionResistance(t *testing.T) {
 	// Llenar el store con códigos para forzar colisiones
 	for i := 0; i < 1000; i++ {
 		testURL := fmt.Sprintf("https://example%d.com", i)
-		_, err := service.ShortenURL(testURL)
+		_, err := service.ShortenURL(context.Background(), testURL)
 		if err != nil {
 			t.Errorf("Error generating short code %d: %v", i, err)
 		}
@@ -197,13 +317,13 @@ func TestService_CollisionResistance(t *testing.T) {
 
 	// Verificar que aún puede generar códigos únicos
 	newURL := "https://newexample.com"
-	shortCode, err := service.ShortenURL(newURL)
+	shortCode, err := service.ShortenURL(context.Background(), newURL)
 	if err != nil {
 		t.Errorf("Error generating short code after many insertions: %v", err)
 	}
 
 	// Verificar que el código es único
-	retrievedURL, err := service.GetLongURL(shortCode)
+	retrievedURL, err := service.GetLongURL(context.Background(), shortCode)
 	if err != nil {
 		t.Errorf("Error retrieving URL: %v", err)
 	}
@@ -212,6 +332,66 @@ func TestService_CollisionResistance(t *testing.T) {
 	}
 }
 
+func TestService_RetryPolicy(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name             string
+		codes            []string
+		policy           RetryPolicy
+		expectedErr      error
+		expectedWarnings []CollisionWarning
+		expectedStats    CollisionStats
+	}{
+		{name: "Código libre tras colisiones", codes: []string{"aaaaaa", "bbbbbb", "cccccc"},
+			policy:           RetryPolicy{MaxRetries: 5, WarnAfter: 2},
+			expectedWarnings: []CollisionWarning{{Attempts: 3}},
+			expectedStats:    CollisionStats{Generated: 1, Retries: 2, Warnings: 1}},
+		{name: "Reintentos bajo el umbral", codes: []string{"aaaaaa", "cccccc"},
+			policy:        RetryPolicy{MaxRetries: 5, WarnAfter: 2},
+			expectedStats: CollisionStats{Generated: 1, Retries: 1}},
+		{name: "Espacio saturado", codes: []string{"aaaaaa", "bbbbbb"},
+			policy:           RetryPolicy{MaxRetries: 4},
+			expectedErr:      ErrCodeSpaceSaturated,
+			expectedWarnings: []CollisionWarning{{Attempts: 4, Saturated: true}},
+			expectedStats:    CollisionStats{Retries: 4, Warnings: 1, Saturated: 1}},
+		{name: "Avisos desactivados", codes: []string{"aaaaaa"},
+			policy:        RetryPolicy{MaxRetries: 3, WarnAfter: -1},
+			expectedErr:   ErrMaxRetries,
+			expectedStats: CollisionStats{Retries: 3, Saturated: 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewStore()
+			store.SaveLink(ctx, Link{ShortCode: "aaaaaa", LongURL: "https://www.example.com/a"})
+			store.SaveLink(ctx, Link{ShortCode: "bbbbbb", LongURL: "https://www.example.com/b"})
+			var warnings []CollisionWarning
+			tt.policy.OnWarning = func(warning CollisionWarning) { warnings = append(warnings, warning) }
+			service := NewService(store, WithCodeGenerator(&stubGenerator{codes: tt.codes}), WithRetryPolicy(tt.policy))
+
+			_, _, err := service.Shorten(ctx, ShortenInput{LongURL: "https://www.example.com/nuevo"})
+			if !errors.Is(err, tt.expectedErr) {
+				t.Fatalf("Expected %v, got %v", tt.expectedErr, err)
+			}
+			if err != nil && (errcode.Of(err) != errcode.CodeSpaceSaturated || !errors.Is(err, ErrMaxRetries)) {
+				t.Errorf("Expected %s wrapping ErrMaxRetries, got %s (%v)", errcode.CodeSpaceSaturated, errcode.Of(err), err)
+			}
+			if !reflect.DeepEqual(warnings, tt.expectedWarnings) {
+				t.Errorf("Expected warnings %+v, got %+v", tt.expectedWarnings, warnings)
+			}
+			if stats := service.CollisionStats(); stats != tt.expectedStats {
+				t.Errorf("Expected stats %+v, got %+v", tt.expectedStats, stats)
+			}
+		})
+	}
+
+	t.Run("Etapas de la estrategia hash desordenadas", func(t *testing.T) {
+		_, err := NewCodeGenerator(GeneratorConfig{Format: DefaultCodeFormat(), Stages: AttemptStages{EntropyAfter: 5, TimestampAfter: 2}})
+		if err == nil {
+			t.Errorf("Expected error for unordered stages")
+		}
+	})
+}
+
 func TestService_ConcurrentAccess(t *testing.T) {
 	store := NewStore()
 	service := NewService(store)
@@ -246,12 +426,12 @@ func TestService_ConcurrentAccess(t *testing.T) {
 		urlLoop:
 			for j := 0; j < urlsPerGoroutine; j++ {
 				testURL := fmt.Sprintf("https://example%d-%d.com", goroutineID, j)
-				
+
 				// Switch para diferentes estrategias según el índice
 				switch {
 				case j < 3:
 					// URLs normales
-					if shortCode, err := service.ShortenURL(testURL); err != nil {
+					if shortCode, err := service.ShortenURL(context.Background(), testURL); err != nil {
 						errors <- fmt.Errorf("error en goroutine %d, URL %d: %v", goroutineID, j, err)
 						break urlLoop // Salir del loop interno
 					} else {
@@ -260,7 +440,7 @@ func TestService_ConcurrentAccess(t *testing.T) {
 				case j < 7:
 					// URLs con parámetros
 					testURLWithParams := fmt.Sprintf("%s?param=%d", testURL, j)
-					if shortCode, err := service.ShortenURL(testURLWithParams); err != nil {
+					if shortCode, err := service.ShortenURL(context.Background(), testURLWithParams); err != nil {
 						errors <- fmt.Errorf("error en goroutine %d, URL con params %d: %v", goroutineID, j, err)
 						continue urlLoop // Continuar con la siguiente URL
 					} else {
@@ -269,7 +449,7 @@ func TestService_ConcurrentAccess(t *testing.T) {
 				default:
 					// URLs complejas
 					complexURL := fmt.Sprintf("%s/path/to/resource?param1=%d&param2=value", testURL, j)
-					if shortCode, err := service.ShortenURL(complexURL); err != nil {
+					if shortCode, err := service.ShortenURL(context.Background(), complexURL); err != nil {
 						errors <- fmt.Errorf("error en goroutine %d, URL compleja %d: %v", goroutineID, j, err)
 						return // Salir de la goroutine si hay error crítico
 					} else {
@@ -305,38 +485,4207 @@ func TestService_ConcurrentAccess(t *testing.T) {
 	}
 }
 
-func BenchmarkService_ShortenURL(b *testing.B) {
+func TestService_DisableURL(t *testing.T) {
+	ctx := context.Background()
 	store := NewStore()
-	service := NewService(store)
+	service := NewService(store, WithDeduplication(true))
+	alice, admin := Actor{UserID: "alice"}, Actor{UserID: "root", Admin: true}
 
-	b.ResetTimer()
-	for i := 0; i < b.N; i++ {
-		testURL := fmt.Sprintf("https://benchmark%d.com", i)
-		_, err := service.ShortenURL(testURL)
-		if err != nil {
-			b.Errorf("Error in benchmark: %v", err)
+	link, _, err := service.Shorten(ctx, ShortenInput{LongURL: "https://www.example.com/disable", Owner: "alice"})
+	if err != nil {
+		t.Fatalf("Error creating link: %v", err)
+	}
+
+	if _, err := service.DisableURL(ctx, Actor{UserID: "bob"}, link.ShortCode, ""); err != ErrForbidden {
+		t.Errorf("Expected ErrForbidden on disable, got %v", err)
+	}
+	if _, err := service.DisableURL(ctx, alice, link.ShortCode, strings.Repeat("x", MaxDisableReasonLength+1)); !errors.As(err, new(*ValidationError)) {
+		t.Errorf("Expected validation error for long reason, got %v", err)
+	}
+
+	disabled, err := service.DisableURL(ctx, alice, link.ShortCode, "  Campaña finalizada ")
+	if err != nil {
+		t.Fatalf("Unexpected error disabling: %v", err)
+	}
+	if !disabled.IsDisabled() || disabled.DisabledReason != "Campaña finalizada" {
+		t.Errorf("Expected disabled link with trimmed reason, got %+v", disabled)
+	}
+
+	// Las visitas reciben el motivo y el enlace no se reutiliza al deduplicar
+	_, err = service.ResolveRedirect(ctx, link.ShortCode, RedirectRequest{})
+	var disabledErr *DisabledError
+	if !errors.Is(err, ErrLinkDisabled) || !errors.As(err, &disabledErr) || disabledErr.Reason != "Campaña finalizada" {
+		t.Errorf("Expected DisabledError with reason, got %v", err)
+	}
+	if _, err := service.GetLongURL(ctx, link.ShortCode); !errors.Is(err, ErrLinkDisabled) {
+		t.Errorf("Expected ErrLinkDisabled from GetLongURL, got %v", err)
+	}
+	if other, created, err := service.Shorten(ctx, ShortenInput{LongURL: link.LongURL, Owner: "alice"}); err != nil || !created || other.ShortCode == link.ShortCode {
+		t.Errorf("Expected a new link instead of the disabled one, got %s (created %v, err %v)", other.ShortCode, created, err)
+	}
+
+	// Restaurar devuelve el enlace a su estado activo
+	enabled, err := service.EnableURL(ctx, alice, link.ShortCode)
+	if err != nil || enabled.IsDisabled() || enabled.DisabledReason != "" {
+		t.Fatalf("Expected enabled link, got %+v (err %v)", enabled, err)
+	}
+	if redirect, err := service.ResolveRedirect(ctx, link.ShortCode, RedirectRequest{}); err != nil || redirect.URL != link.LongURL {
+		t.Errorf("Expected redirect after enabling, got %+v (err %v)", redirect, err)
+	}
+
+	// El propietario solo desactiva al eliminar; el administrador purga
+	if err := service.DeleteURL(ctx, alice, link.ShortCode); err != nil {
+		t.Fatalf("Unexpected error deleting as owner: %v", err)
+	}
+	if stored, _ := service.GetLink(ctx, link.ShortCode); !stored.IsDisabled() || stored.DisabledReason != DeletedReason {
+		t.Errorf("Expected owner delete to disable the link, got %+v", stored)
+	}
+	if err := service.DeleteURL(ctx, admin, link.ShortCode); err != nil {
+		t.Fatalf("Unexpected error purging as admin: %v", err)
+	}
+	if _, err := service.EnableURL(ctx, alice, link.ShortCode); err != ErrURLNotFound {
+		t.Errorf("Expected ErrURLNotFound after purge, got %v", err)
+	}
+}
+
+func TestService_AuditLog(t *testing.T) {
+	ctx := context.Background()
+	service := NewService(NewStore(), WithDeduplication(true))
+	alice, admin := Actor{UserID: "alice"}, Actor{UserID: "root", Admin: true}
+
+	link, _, err := service.Shorten(ctx, ShortenInput{LongURL: "https://www.example.com/audit", Owner: "alice"})
+	if err != nil {
+		t.Fatalf("Error creating link: %v", err)
+	}
+	// Reutilizar un enlace deduplicado no es una creación
+	service.Shorten(ctx, ShortenInput{LongURL: "https://www.example.com/audit", Owner: "alice"})
+	service.UpdateURL(ctx, alice, link.ShortCode, "https://www.example.com/audit-v2")
+	service.DisableURL(ctx, alice, link.ShortCode, "Revisión")
+	service.EnableURL(ctx, admin, link.ShortCode)
+	service.DeleteURL(ctx, admin, link.ShortCode)
+
+	if _, err := service.AuditLog(ctx, alice, AuditQuery{}); err != ErrForbidden {
+		t.Errorf("Expected ErrForbidden for non-admin, got %v", err)
+	}
+
+	page, err := service.AuditLog(ctx, admin, AuditQuery{ShortCode: link.ShortCode})
+	if err != nil {
+		t.Fatalf("Unexpected error querying audit log: %v", err)
+	}
+	var actions []string
+	for _, entry := range page.Entries {
+		actions = append(actions, entry.Action)
+	}
+	if got, want := strings.Join(actions, ","), "delete,enable,disable,update,create"; got != want || page.Total != 5 {
+		t.Fatalf("Expected actions %s newest first, got %s (total %d)", want, got, page.Total)
+	}
+
+	update := page.Entries[3]
+	if update.Actor != alice || update.Before.LongURL != "https://www.example.com/audit" || update.After.LongURL != "https://www.example.com/audit-v2" {
+		t.Errorf("Expected update entry with before/after values, got %+v", update)
+	}
+	if purge := page.Entries[0]; purge.Actor != admin || purge.Before == nil || purge.After != nil {
+		t.Errorf("Expected purge entry without after value, got %+v", purge)
+	}
+	if create := page.Entries[4]; create.Before != nil || create.After == nil || create.Actor.UserID != "alice" {
+		t.Errorf("Expected create entry without before value, got %+v", create)
+	}
+
+	tests := []struct {
+		name          string
+		query         AuditQuery
+		expectedTotal int
+		invalidFields []string
+	}{
+		{name: "Por actor", query: AuditQuery{Actor: "root"}, expectedTotal: 2},
+		{name: "Por acción", query: AuditQuery{Action: AuditDisable}, expectedTotal: 1},
+		{name: "Desde el futuro", query: AuditQuery{Since: time.Now().Add(time.Hour)}, expectedTotal: 0},
+		{name: "Hasta ahora", query: AuditQuery{Until: time.Now().Add(time.Second)}, expectedTotal: 5},
+		{name: "Acción desconocida", query: AuditQuery{Action: "purge"}, invalidFields: []string{"action"}},
+		{name: "Intervalo invertido", query: AuditQuery{Since: time.Now(), Until: time.Now().Add(-time.Hour), Limit: 500}, invalidFields: []string{"until", "per_page"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := service.AuditLog(ctx, admin, tt.query)
+			if tt.invalidFields != nil {
+				if got := validationFields(err); strings.Join(got, ",") != strings.Join(tt.invalidFields, ",") {
+					t.Errorf("Expected invalid fields %v, got %v (err %v)", tt.invalidFields, got, err)
+				}
+				return
+			}
+			if err != nil || page.Total != tt.expectedTotal {
+				t.Errorf("Expected %d entries, got %d (err %v)", tt.expectedTotal, page.Total, err)
+			}
+		})
+	}
+}
+
+func TestService_ReportLink(t *testing.T) {
+	ctx := context.Background()
+	service := NewService(NewStore(), WithQuarantineThreshold(2))
+	admin := Actor{UserID: "root", Admin: true}
+
+	link, _, err := service.Shorten(ctx, ShortenInput{LongURL: "https://www.example.com/sospechoso", Owner: "alice"})
+	if err != nil {
+		t.Fatalf("Error creating link: %v", err)
+	}
+
+	if _, err := service.ReportLink(ctx, "noexiste", ReportInput{Reason: ReportSpam}); err != ErrURLNotFound {
+		t.Errorf("Expected ErrURLNotFound, got %v", err)
+	}
+	_, err = service.ReportLink(ctx, link.ShortCode, ReportInput{Reason: "aburrido", Comment: strings.Repeat("x", MaxReportCommentLength+1)})
+	if got := validationFields(err); strings.Join(got, ",") != "reason,comment" {
+		t.Errorf("Expected invalid reason and comment, got %v (err %v)", got, err)
+	}
+
+	// Varias denuncias del mismo visitante cuentan una sola vez
+	for i := 0; i < 3; i++ {
+		if _, err := service.ReportLink(ctx, link.ShortCode, ReportInput{Reason: ReportPhishing, Reporter: "203.0.113.1"}); err != nil {
+			t.Fatalf("Unexpected error reporting: %v", err)
 		}
 	}
+	if redirect, _ := service.ResolveRedirect(ctx, link.ShortCode, RedirectRequest{}); redirect.Quarantined || redirect.Interstitial {
+		t.Errorf("Expected no quarantine with a single reporter, got %+v", redirect)
+	}
+
+	report, err := service.ReportLink(ctx, link.ShortCode, ReportInput{Reason: ReportMalware, Comment: " descarga un .exe ", Reporter: "203.0.113.2"})
+	if err != nil || report.ID != 4 || report.Status != ReportOpen || report.Comment != "descarga un .exe" {
+		t.Fatalf("Unexpected report %+v (err %v)", report, err)
+	}
+	if redirect, _ := service.ResolveRedirect(ctx, link.ShortCode, RedirectRequest{}); !redirect.Quarantined || !redirect.Interstitial {
+		t.Errorf("Expected quarantine behind the interstitial, got %+v", redirect)
+	}
+
+	if _, err := service.ListReports(ctx, Actor{UserID: "alice"}, ReportQuery{}); err != ErrForbidden {
+		t.Errorf("Expected ErrForbidden listing reports as non-admin, got %v", err)
+	}
+	page, err := service.ListReports(ctx, admin, ReportQuery{ShortCode: link.ShortCode, Status: ReportOpen, Limit: 1})
+	if err != nil || page.Total != 4 || len(page.Reports) != 1 || page.Reports[0].ID != 4 {
+		t.Errorf("Expected newest of four open reports, got %+v (err %v)", page, err)
+	}
+
+	// Descartar las denuncias levanta la cuarentena
+	released, err := service.DismissReports(ctx, admin, link.ShortCode)
+	if err != nil || released.Quarantined {
+		t.Fatalf("Expected link released from quarantine, got %+v (err %v)", released, err)
+	}
+	if page, _ := service.ListReports(ctx, admin, ReportQuery{Status: ReportDismissed}); page.Total != 4 {
+		t.Errorf("Expected four dismissed reports, got %d", page.Total)
+	}
+
+	// La desactivación masiva resuelve las denuncias abiertas y reporta cada código
+	service.ReportLink(ctx, link.ShortCode, ReportInput{Reason: ReportSpam, Reporter: "203.0.113.3"})
+	errs, err := service.DisableReported(ctx, admin, []string{link.ShortCode, "noexiste"}, "Phishing confirmado")
+	if err != nil || len(errs) != 2 || errs[0] != nil || errs[1] != ErrURLNotFound {
+		t.Fatalf("Unexpected bulk disable result %v (err %v)", errs, err)
+	}
+	if page, _ := service.ListReports(ctx, admin, ReportQuery{Status: ReportResolved}); page.Total != 1 {
+		t.Errorf("Expected one resolved report, got %d", page.Total)
+	}
+	if _, err := service.ResolveRedirect(ctx, link.ShortCode, RedirectRequest{}); !errors.Is(err, ErrLinkDisabled) {
+		t.Errorf("Expected disabled link after bulk disable, got %v", err)
+	}
+	if audit, _ := service.AuditLog(ctx, admin, AuditQuery{Action: AuditQuarantine}); audit.Total != 1 {
+		t.Errorf("Expected quarantine in audit log, got %d entries", audit.Total)
+	}
 }
 
-func BenchmarkService_GetLongURL(b *testing.B) {
+func TestDomainPolicy(t *testing.T) {
+	policy, err := NewDomainPolicy(
+		[]string{"Evil.example", "*.tracker.example", `/^ads[0-9]*\.example\.org$/`},
+		[]string{"example.com", "*.example.com", "*.tracker.example", "ads1.example.org", "evil.example"},
+	)
+	if err != nil {
+		t.Fatalf("Unexpected error building policy: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		url      string
+		expected string
+	}{
+		{name: "Dominio permitido", url: "https://example.com/a", expected: ""},
+		{name: "Subdominio permitido con puerto", url: "https://www.example.com:8443/a", expected: ""},
+		{name: "Bloqueo exacto sin distinguir mayúsculas", url: "https://EVIL.example/", expected: "dominio bloqueado por seguridad"},
+		{name: "Bloqueo por comodín", url: "https://a.b.tracker.example/", expected: "dominio bloqueado por seguridad"},
+		{name: "El comodín no incluye el dominio base", url: "https://tracker.example/", expected: "dominio no permitido"},
+		{name: "Bloqueo por expresión regular", url: "https://ads1.example.org/", expected: "dominio bloqueado por seguridad"},
+		{name: "Fuera de la lista de permitidos", url: "https://example.net/", expected: "dominio no permitido"},
+	}
+	service := NewService(NewStore(), WithDomainPolicy(policy))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := service.validateURLSecurity(tt.url)
+			var validationErr *ValidationError
+			switch {
+			case tt.expected == "" && err != nil:
+				t.Errorf("Expected URL to be accepted, got %v", err)
+			case tt.expected != "" && (!errors.As(err, &validationErr) || validationErr.Msg != tt.expected):
+				t.Errorf("Expected %q, got %v", tt.expected, err)
+			}
+		})
+	}
+
+	if _, err := NewDomainPolicy([]string{"/[/", "a*.example.com", "*."}, nil); !errors.Is(err, ErrInvalidDomainPolicy) {
+		t.Errorf("Expected ErrInvalidDomainPolicy for invalid rules, got %v", err)
+	}
+}
+
+func TestService_ReloadDomainPolicy(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "bloqueados.txt")
+	os.WriteFile(path, []byte("# dominios de phishing\nbanco-falso.example\n\n"), 0o600)
+	remote := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "*.example.com")
+	}))
+	defer remote.Close()
+
+	service := NewService(NewStore(), WithDomainPolicySource(DomainPolicySource{
+		Blocklist:       []string{"otro.example"},
+		BlocklistSource: path,
+		AllowlistSource: remote.URL,
+	}))
+
+	// Antes de cargar rige la lista por defecto
+	if err := service.validateURL("https://www.malware.com/"); err == nil {
+		t.Errorf("Expected default blocklist before loading")
+	}
+	policy, err := service.ReloadDomainPolicy(ctx)
+	if err != nil || policy.Blocked() != 2 || policy.Allowed() != 1 {
+		t.Fatalf("Unexpected policy %+v (err %v)", policy, err)
+	}
+	if err := service.validateURL("https://banco-falso.example/login"); err == nil {
+		t.Errorf("Expected blocked domain from file")
+	}
+	if err := service.validateURL("https://www.example.com/"); err != nil {
+		t.Errorf("Expected allowed domain from URL, got %v", err)
+	}
+
+	// Una recarga fallida conserva la política anterior
+	os.WriteFile(path, []byte("/[/\n"), 0o600)
+	if _, err := service.ReloadDomainPolicy(ctx); !errors.Is(err, ErrInvalidDomainPolicy) {
+		t.Errorf("Expected ErrInvalidDomainPolicy, got %v", err)
+	}
+	if err := service.validateURL("https://banco-falso.example/login"); err == nil {
+		t.Errorf("Expected previous policy to remain after failed reload")
+	}
+
+	// Sin configuración se usan los dominios por defecto
+	if policy, err := NewService(NewStore()).ReloadDomainPolicy(ctx); err != nil || policy.Blocked() != len(DefaultBlockedDomains) {
+		t.Errorf("Expected default blocklist, got %+v (err %v)", policy, err)
+	}
+}
+
+func TestService_ThreatChecks(t *testing.T) {
+	ctx := context.Background()
+	malicious := map[string]bool{"https://malo.example/descarga": true}
+	unavailable := false
+	checker := threat.CheckerFunc(func(ctx context.Context, rawURL string) (threat.Verdict, error) {
+		if unavailable {
+			return threat.Verdict{}, threat.ErrProvider
+		}
+		if malicious[rawURL] {
+			return threat.Verdict{Malicious: true, Threat: "MALWARE", Source: "prueba"}, nil
+		}
+		return threat.Verdict{Source: "prueba"}, nil
+	})
+	service := NewService(NewStore(), WithThreatChecker(checker, time.Second))
+	admin := Actor{UserID: "root", Admin: true}
+
+	// Se rechazan los destinos marcados, también los alternativos
+	_, _, err := service.Shorten(ctx, ShortenInput{LongURL: "https://malo.example/descarga"})
+	if !errors.Is(err, ErrMaliciousURL) {
+		t.Errorf("Expected ErrMaliciousURL, got %v", err)
+	}
+	_, _, err = service.Shorten(ctx, ShortenInput{
+		LongURL:       "https://www.example.com",
+		GeoTargets:    map[string]string{"ES": "https://malo.example/descarga"},
+		DeviceTargets: map[string]string{"ios": "miapp://abrir"},
+	})
+	if got := validationFields(err); strings.Join(got, ",") != "geo_targets.ES" {
+		t.Errorf("Expected malicious geo target, got %v (err %v)", got, err)
+	}
+
+	// Sin respuesta del proveedor el enlace se acepta y la revisión lo pone en cuarentena
+	unavailable = true
+	link, _, err := service.Shorten(ctx, ShortenInput{LongURL: "https://www.example.com/descarga", Owner: "alice"})
+	if err != nil {
+		t.Fatalf("Expected link accepted while provider is unavailable, got %v", err)
+	}
+	unavailable = false
+	clean, _, _ := service.Shorten(ctx, ShortenInput{LongURL: "https://www.example.com/limpio"})
+
+	malicious["https://www.example.com/descarga"] = true
+	quarantined, err := service.RescanThreats(ctx)
+	if err != nil || quarantined != 1 {
+		t.Fatalf("Expected one link quarantined, got %d (err %v)", quarantined, err)
+	}
+	if redirect, _ := service.ResolveRedirect(ctx, link.ShortCode, RedirectRequest{}); !redirect.Quarantined {
+		t.Errorf("Expected rescanned link in quarantine, got %+v", redirect)
+	}
+	if redirect, _ := service.ResolveRedirect(ctx, clean.ShortCode, RedirectRequest{}); redirect.Quarantined {
+		t.Errorf("Expected clean link not quarantined, got %+v", redirect)
+	}
+	page, _ := service.AuditLog(ctx, admin, AuditQuery{Action: AuditQuarantine})
+	if page.Total != 1 || page.Entries[0].ShortCode != link.ShortCode {
+		t.Errorf("Expected quarantine audit entry, got %+v", page)
+	}
+
+	// Los enlaces ya en cuarentena no se vuelven a contar
+	if quarantined, _ := service.RescanThreats(ctx); quarantined != 0 {
+		t.Errorf("Expected no new quarantines, got %d", quarantined)
+	}
+
+	// Editar el destino también se comprueba
+	if _, err := service.UpdateURL(ctx, admin, clean.ShortCode, "https://malo.example/descarga"); !errors.Is(err, ErrMaliciousURL) {
+		t.Errorf("Expected ErrMaliciousURL updating destination, got %v", err)
+	}
+}
+
+func TestService_InspectLink(t *testing.T) {
+	ctx := context.Background()
+	checker := threat.CheckerFunc(func(ctx context.Context, rawURL string) (threat.Verdict, error) {
+		switch {
+		case strings.Contains(rawURL, "malo.example"):
+			return threat.Verdict{Malicious: true, Threat: "MALWARE", Source: "prueba"}, nil
+		case strings.Contains(rawURL, "caido.example"):
+			return threat.Verdict{}, threat.ErrProvider
+		}
+		return threat.Verdict{Source: "prueba"}, nil
+	})
+	policy, err := NewDomainPolicy([]string{"bloqueado.example", "*.bloqueado.example"}, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
 	store := NewStore()
-	service := NewService(store)
+	for _, link := range []Link{
+		{ShortCode: "seguro", LongURL: "https://www.example.com/"},
+		{ShortCode: "variante", LongURL: "https://www.example.com/", Variants: []Variant{{Name: "a", URL: "https://malo.example/x", Weight: 1}}},
+		{ShortCode: "bloqueado", LongURL: "https://bloqueado.example/", GeoTargets: map[string]string{"DE": "https://malo.example/de"}},
+		{ShortCode: "lista", LongURL: "https://www.bloqueado.example/"},
+		{ShortCode: "cuarentena", LongURL: "https://www.example.com/", Quarantined: true},
+		{ShortCode: "caido", LongURL: "https://caido.example/"},
+	} {
+		store.SaveLink(ctx, link)
+	}
 
-	// Preparar datos de prueba
-	testCodes := make([]string, 1000)
-	for i := 0; i < 1000; i++ {
-		testURL := fmt.Sprintf("https://benchmark%d.com", i)
-		shortCode, _ := service.ShortenURL(testURL)
-		testCodes[i] = shortCode
+	tests := []struct {
+		name             string
+		opts             []ServiceOption
+		code             string
+		expectedVerdict  string
+		expectedCheck    string
+		expectedFindings []string
+	}{
+		{name: "Seguro", code: "seguro", expectedVerdict: VerdictSafe, expectedCheck: ThreatCheckClean},
+		{name: "Variante maliciosa", code: "variante", expectedVerdict: VerdictMalicious, expectedCheck: ThreatCheckMalicious,
+			expectedFindings: []string{"variants[0].url"}},
+		{name: "Malicioso y bloqueado", code: "bloqueado", expectedVerdict: VerdictMalicious, expectedCheck: ThreatCheckMalicious,
+			expectedFindings: []string{"long_url", "geo_targets.DE"}},
+		{name: "Bloqueado por la lista vigente", code: "lista", expectedVerdict: VerdictBlocked, expectedCheck: ThreatCheckClean,
+			expectedFindings: []string{"long_url"}},
+		{name: "En cuarentena", code: "cuarentena", expectedVerdict: VerdictSuspicious, expectedCheck: ThreatCheckClean},
+		{name: "Proveedor caído", code: "caido", expectedVerdict: VerdictUnknown, expectedCheck: ThreatCheckUnavailable},
+		{name: "Sin proveedor", opts: []ServiceOption{WithThreatChecker(nil, 0)}, code: "caido", expectedVerdict: VerdictSafe,
+			expectedCheck: ThreatCheckDisabled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := append([]ServiceOption{WithThreatChecker(checker, time.Second), WithDomainPolicy(policy)}, tt.opts...)
+			service := NewService(store, opts...)
+			inspection, err := service.InspectLink(ctx, tt.code)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if inspection.Verdict != tt.expectedVerdict || inspection.ThreatCheck != tt.expectedCheck {
+				t.Errorf("Expected verdict %s and check %s, got %s and %s", tt.expectedVerdict, tt.expectedCheck, inspection.Verdict, inspection.ThreatCheck)
+			}
+			var fields []string
+			for _, finding := range inspection.Findings {
+				fields = append(fields, finding.Field)
+			}
+			if !reflect.DeepEqual(fields, tt.expectedFindings) {
+				t.Errorf("Expected findings %v, got %v", tt.expectedFindings, fields)
+			}
+		})
 	}
 
-	b.ResetTimer()
-	for i := 0; i < b.N; i++ {
-		code := testCodes[i%len(testCodes)]
-		_, err := service.GetLongURL(code)
-		if err != nil {
-			b.Errorf("Error in benchmark: %v", err)
+	// La inspección no contabiliza visitas
+	if link, _, _ := store.GetLink(ctx, "seguro"); link.Clicks != 0 {
+		t.Errorf("Expected no clicks after inspection, got %d", link.Clicks)
+	}
+	if _, err := NewService(store).InspectLink(ctx, "noexiste"); !errors.Is(err, ErrURLNotFound) {
+		t.Errorf("Expected ErrURLNotFound, got %v", err)
+	}
+}
+
+// fakeHostResolver resuelve nombres a partir de un mapa; los ausentes no existen
+type fakeHostResolver map[string][]string
+
+func (r fakeHostResolver) LookupNetIP(ctx context.Context, network, host string) ([]netip.Addr, error) {
+	ips, ok := r[host]
+	if !ok {
+		return nil, fmt.Errorf("lookup %s: no such host", host)
+	}
+	addrs := make([]netip.Addr, 0, len(ips))
+	for _, ip := range ips {
+		addrs = append(addrs, netip.MustParseAddr(ip))
+	}
+	return addrs, nil
+}
+
+func TestService_PrivateDestinations(t *testing.T) {
+	resolver := fakeHostResolver{
+		"www.example.com":     {"93.184.216.34", "2606:2800:220:1:248:1893:25c8:1946"},
+		"interno.example.com": {"93.184.216.34", "10.1.2.3"},
+		"rebind.example.com":  {"::ffff:127.0.0.1"},
+	}
+
+	tests := []struct {
+		name      string
+		url       string
+		resolve   bool
+		expectErr bool
+	}{
+		{name: "Dominio público", url: "https://www.example.com/", resolve: true},
+		{name: "IP pública", url: "http://93.184.216.34/"},
+		{name: "Dominio que empieza por 0x", url: "https://0xfeed.example.org/"},
+		{name: "Loopback", url: "http://127.0.0.1:8080/admin", expectErr: true},
+		{name: "Loopback IPv6", url: "http://[::1]/", expectErr: true},
+		{name: "IPv4 embebida en IPv6", url: "http://[::ffff:10.0.0.1]/", expectErr: true},
+		{name: "RFC 1918", url: "http://192.168.1.1/", expectErr: true},
+		{name: "Metadata de la nube", url: "http://169.254.169.254/latest/meta-data/", expectErr: true},
+		{name: "Metadata de Alibaba", url: "http://100.100.100.200/", expectErr: true},
+		{name: "Sin especificar", url: "http://0.0.0.0/", expectErr: true},
+		{name: "IP en decimal", url: "http://2130706433/", expectErr: true},
+		{name: "IP en hexadecimal", url: "http://0x7f.1/", expectErr: true},
+		{name: "localhost", url: "http://localhost:6379/", expectErr: true},
+		{name: "Subdominio de localhost", url: "http://api.localhost/", expectErr: true},
+		{name: "Metadata de Google", url: "http://metadata.google.internal/computeMetadata/v1/", expectErr: true},
+		{name: "Sin resolución no se consulta el DNS", url: "https://interno.example.com/"},
+		{name: "Dominio que resuelve a una IP privada", url: "https://interno.example.com/", resolve: true, expectErr: true},
+		{name: "Dominio que resuelve a loopback mapeado", url: "https://rebind.example.com/", resolve: true, expectErr: true},
+		{name: "Dominio que no resuelve", url: "https://noexiste.example.com/", resolve: true, expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := []ServiceOption{}
+			if tt.resolve {
+				opts = append(opts, WithDestinationResolver(resolver))
+			}
+			service := NewService(NewStore(), opts...)
+
+			_, _, err := service.Shorten(context.Background(), ShortenInput{LongURL: tt.url})
+			if tt.expectErr && !errors.Is(err, ErrInvalidURL) {
+				t.Errorf("Expected ErrInvalidURL for %s, got %v", tt.url, err)
+			}
+			if !tt.expectErr && err != nil {
+				t.Errorf("Unexpected error for %s: %v", tt.url, err)
+			}
+		})
+	}
+
+	// Los destinos alternativos también se comprueban
+	_, _, err := NewService(NewStore()).Shorten(context.Background(), ShortenInput{
+		LongURL:    "https://www.example.com",
+		GeoTargets: map[string]string{"ES": "http://10.0.0.5/"},
+	})
+	if got := validationFields(err); strings.Join(got, ",") != "geo_targets.ES" {
+		t.Errorf("Expected private geo target rejected, got %v (err %v)", got, err)
+	}
+
+	// En una intranet se pueden permitir
+	intranet := NewService(NewStore(), WithPrivateDestinations(true), WithDestinationResolver(resolver))
+	if _, _, err := intranet.Shorten(context.Background(), ShortenInput{LongURL: "http://192.168.1.1/wiki"}); err != nil {
+		t.Errorf("Expected private destination allowed, got %v", err)
+	}
+}
+
+func TestHTTPProber(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/sin-head":
+			if r.Method == http.MethodHead {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			fmt.Fprint(w, "ok")
+		case "/movido":
+			http.Redirect(w, r, "/sin-head", http.StatusMovedPermanently)
+		case "/bucle":
+			http.Redirect(w, r, "/bucle", http.StatusFound)
+		case "/caido":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			http.NotFound(w, r)
 		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name           string
+		path           string
+		allowPrivate   bool
+		expectedStatus int
+		expectErr      bool
+	}{
+		{name: "GET si HEAD no está permitido", path: "/sin-head", allowPrivate: true, expectedStatus: http.StatusOK},
+		{name: "Sigue redirecciones", path: "/movido", allowPrivate: true, expectedStatus: http.StatusOK},
+		{name: "Demasiadas redirecciones", path: "/bucle", allowPrivate: true, expectErr: true},
+		{name: "Error del servidor", path: "/caido", allowPrivate: true, expectedStatus: http.StatusServiceUnavailable},
+		{name: "No encontrado", path: "/noexiste", allowPrivate: true, expectedStatus: http.StatusNotFound},
+		{name: "Dirección interna bloqueada al conectar", path: "/sin-head", expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, err := NewHTTPProber(time.Second, tt.allowPrivate).Probe(context.Background(), server.URL+tt.path)
+			if tt.expectErr {
+				if err == nil {
+					t.Errorf("Expected error, got status %d", status)
+				}
+				return
+			}
+			if err != nil || status != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d (err %v)", tt.expectedStatus, status, err)
+			}
+		})
+	}
+}
+
+// fakeProber responde con el estado configurado para cada URL; las ausentes no tienen respuesta
+type fakeProber map[string]int
+
+func (p fakeProber) Probe(ctx context.Context, rawURL string) (int, error) {
+	status, ok := p[rawURL]
+	if !ok {
+		return 0, errors.New("dial tcp: connection refused")
+	}
+	return status, nil
+}
+
+func TestService_Reachability(t *testing.T) {
+	ctx := context.Background()
+	prober := fakeProber{
+		"https://www.example.com/ok":     http.StatusOK,
+		"https://www.example.com/roto":   http.StatusNotFound,
+		"https://www.example.com/movido": http.StatusOK,
+	}
+
+	t.Run("Modo reject", func(t *testing.T) {
+		service := NewService(NewStore(), WithReachabilityCheck(ReachabilityReject, prober))
+
+		link, _, err := service.Shorten(ctx, ShortenInput{LongURL: "https://www.example.com/ok", Owner: "alice"})
+		if err != nil || !link.Health.Checked() || link.Health.Broken || link.Health.StatusCode != http.StatusOK {
+			t.Fatalf("Expected healthy link, got %+v (err %v)", link.Health, err)
+		}
+		for _, longURL := range []string{"https://www.example.com/roto", "https://caido.example.com/"} {
+			if _, _, err := service.Shorten(ctx, ShortenInput{LongURL: longURL}); !errors.Is(err, ErrUnreachableURL) {
+				t.Errorf("Expected ErrUnreachableURL for %s, got %v", longURL, err)
+			}
+		}
+		if _, err := service.UpdateURL(ctx, Actor{UserID: "alice"}, link.ShortCode, "https://www.example.com/roto"); !errors.Is(err, ErrUnreachableURL) {
+			t.Errorf("Expected ErrUnreachableURL updating destination, got %v", err)
+		}
+	})
+
+	t.Run("Modo async", func(t *testing.T) {
+		service := NewService(NewStore(), WithReachabilityCheck(ReachabilityAsync, prober))
+
+		link, _, err := service.Shorten(ctx, ShortenInput{LongURL: "https://www.example.com/roto", Owner: "alice"})
+		if err != nil || link.Health.Checked() {
+			t.Fatalf("Expected link accepted without checking, got %+v (err %v)", link.Health, err)
+		}
+
+		workerCtx, cancel := context.WithCancel(ctx)
+		done := make(chan struct{})
+		go func() {
+			service.RunReachabilityWorker(workerCtx)
+			close(done)
+		}()
+		deadline := time.Now().Add(time.Second)
+		for {
+			stored, _ := service.GetLink(ctx, link.ShortCode)
+			if stored.Health.Checked() {
+				if !stored.Health.Broken || stored.Health.StatusCode != http.StatusNotFound || stored.Health.Failures != 1 {
+					t.Errorf("Expected broken destination, got %+v", stored.Health)
+				}
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("Worker did not check the link")
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+		cancel()
+		<-done
+
+		stats, err := service.GetStats(ctx)
+		if err != nil || stats.BrokenLinks != 1 {
+			t.Errorf("Expected one broken link in stats, got %v (err %v)", stats, err)
+		}
+
+		// Los fallos consecutivos se acumulan y una respuesta correcta los reinicia
+		if health, _ := service.CheckReachability(ctx, link.ShortCode); health.Failures != 2 {
+			t.Errorf("Expected two consecutive failures, got %+v", health)
+		}
+		updated, err := service.UpdateURL(ctx, Actor{UserID: "alice"}, link.ShortCode, "https://www.example.com/movido")
+		if err != nil || updated.Health.Checked() {
+			t.Fatalf("Expected health reset on update, got %+v (err %v)", updated.Health, err)
+		}
+		if health, _ := service.CheckReachability(ctx, link.ShortCode); health.Broken || health.Failures != 0 {
+			t.Errorf("Expected healthy destination, got %+v", health)
+		}
+	})
+
+	t.Run("Resultado obsoleto tras editar", func(t *testing.T) {
+		store := NewStore()
+		service := NewService(store)
+		link, _, _ := service.Shorten(ctx, ShortenInput{LongURL: "https://www.example.com/ok"})
+		updated, err := store.SetHealth(ctx, link.ShortCode, "https://www.example.com/anterior", LinkHealth{CheckedAt: time.Now(), Broken: true})
+		if err != nil || updated {
+			t.Errorf("Expected stale health result to be discarded, got updated=%v (err %v)", updated, err)
+		}
+	})
+}
+
+func TestService_ScanLinks(t *testing.T) {
+	ctx := context.Background()
+	prober := fakeProber{
+		"https://www.example.com/ok":   http.StatusOK,
+		"https://www.example.com/roto": http.StatusServiceUnavailable,
+	}
+	service := NewService(NewStore(), WithDeadLinkScanner(prober, 2))
+	admin := Actor{UserID: "root", Admin: true}
+
+	ok, _, _ := service.Shorten(ctx, ShortenInput{LongURL: "https://www.example.com/ok", Owner: "alice"})
+	broken, _, _ := service.Shorten(ctx, ShortenInput{LongURL: "https://www.example.com/roto", Owner: "alice"})
+	disabled, _, _ := service.Shorten(ctx, ShortenInput{LongURL: "https://caido.example.com/", Owner: "alice"})
+	if _, err := service.DisableURL(ctx, admin, disabled.ShortCode, "Retirado"); err != nil {
+		t.Fatalf("Unexpected error disabling link: %v", err)
+	}
+
+	scan := func(expected LinkScanResult) {
+		t.Helper()
+		result, err := service.ScanLinks(ctx)
+		if err != nil || result != expected {
+			t.Errorf("Expected scan result %+v, got %+v (err %v)", expected, result, err)
+		}
+	}
+	brokenCodes := func() []string {
+		t.Helper()
+		page, err := service.ListLinks(ctx, admin, ListQuery{AnyOwner: true, Status: ListStatusBroken})
+		if err != nil {
+			t.Fatalf("Unexpected error listing broken links: %v", err)
+		}
+		codes := []string{}
+		for _, link := range page.Links {
+			codes = append(codes, link.ShortCode)
+		}
+		return codes
+	}
+
+	// Un fallo aislado no basta para marcar el enlace como roto
+	scan(LinkScanResult{Checked: 2})
+	if codes := brokenCodes(); len(codes) != 0 {
+		t.Errorf("Expected no broken links after one failure, got %v", codes)
+	}
+
+	// El segundo fallo seguido lo marca como roto y conserva el inicio de los fallos
+	first, _ := service.GetLink(ctx, broken.ShortCode)
+	scan(LinkScanResult{Checked: 2, Broken: 1})
+	if codes := brokenCodes(); len(codes) != 1 || codes[0] != broken.ShortCode {
+		t.Errorf("Expected %s listed as broken, got %v", broken.ShortCode, codes)
+	}
+	stored, _ := service.GetLink(ctx, broken.ShortCode)
+	if stored.Health.Failures != 2 || !stored.Health.FailingSince.Equal(first.Health.FailingSince) {
+		t.Errorf("Expected two failures since %v, got %+v", first.Health.FailingSince, stored.Health)
+	}
+
+	// Los enlaces desactivados no se comprueban
+	if stored, _ := service.GetLink(ctx, disabled.ShortCode); stored.Health.Checked() {
+		t.Errorf("Expected disabled link to be skipped, got %+v", stored.Health)
+	}
+
+	// Cuando el destino vuelve a responder el enlace se recupera
+	prober["https://www.example.com/roto"] = http.StatusOK
+	scan(LinkScanResult{Checked: 2, Recovered: 1})
+	if stored, _ := service.GetLink(ctx, broken.ShortCode); stored.Health.Broken || stored.Health.Failures != 0 || !stored.Health.FailingSince.IsZero() {
+		t.Errorf("Expected recovered destination, got %+v", stored.Health)
+	}
+	if stored, _ := service.GetLink(ctx, ok.ShortCode); !stored.Health.Checked() || stored.Health.Broken {
+		t.Errorf("Expected healthy destination, got %+v", stored.Health)
+	}
+
+	t.Run("Sin escáner", func(t *testing.T) {
+		result, err := NewService(NewStore()).ScanLinks(ctx)
+		if err != nil || result != (LinkScanResult{}) {
+			t.Errorf("Expected empty result, got %+v (err %v)", result, err)
+		}
+	})
+}
+
+func TestHTMLMetadataFetcher(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/articulo":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			fmt.Fprint(w, `<html><head><title>Título de la página</title>
+<meta property="og:title" content="Caf&eacute; &amp; t&eacute;">
+<meta name="description" content="Descripción estándar">
+<meta content='Descripción
+  Open Graph' property='og:description'>
+<meta property="og:image" content="/img/portada.png">
+</head><body>...</body></html>`)
+		case "/sin-og":
+			fmt.Fprint(w, `<title> Solo
+ título </title><meta name="twitter:image" content="javascript:alert(1)">`)
+		case "/grande":
+			fmt.Fprint(w, `<title>Cabecera</title>`+strings.Repeat(" ", 2048)+`<meta property="og:title" content="Tarde">`)
+		case "/pdf":
+			w.Header().Set("Content-Type", "application/pdf")
+			fmt.Fprint(w, "%PDF-1.4")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name         string
+		path         string
+		allowPrivate bool
+		expected     LinkMetadata
+		expectErr    bool
+	}{
+		{name: "Open Graph con prioridad", path: "/articulo", allowPrivate: true,
+			expected: LinkMetadata{Title: "Café & té", Description: "Descripción Open Graph", Image: server.URL + "/img/portada.png"}},
+		{name: "Título de la página e imagen no web", path: "/sin-og", allowPrivate: true, expected: LinkMetadata{Title: "Solo título"}},
+		{name: "Solo se lee el comienzo", path: "/grande", allowPrivate: true, expected: LinkMetadata{Title: "Cabecera"}},
+		{name: "Contenido no HTML", path: "/pdf", allowPrivate: true},
+		{name: "Destino no encontrado", path: "/noexiste", allowPrivate: true, expectErr: true},
+		{name: "Dirección interna bloqueada al conectar", path: "/articulo", expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metadata, err := NewHTMLMetadataFetcher(time.Second, 1024, tt.allowPrivate).Fetch(context.Background(), server.URL+tt.path)
+			if tt.expectErr {
+				if err == nil {
+					t.Errorf("Expected error, got %+v", metadata)
+				}
+				return
+			}
+			if err != nil || metadata != tt.expected {
+				t.Errorf("Expected %+v, got %+v (err %v)", tt.expected, metadata, err)
+			}
+		})
+	}
+}
+
+// fakeMetadataFetcher cuenta las obtenciones y falla con las URLs que no conoce
+type fakeMetadataFetcher struct {
+	mu    sync.Mutex
+	calls int
+	pages map[string]LinkMetadata
+}
+
+func (f *fakeMetadataFetcher) Fetch(ctx context.Context, rawURL string) (LinkMetadata, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	metadata, ok := f.pages[rawURL]
+	if !ok {
+		return LinkMetadata{}, errors.New("HTTP 404")
+	}
+	return metadata, nil
+}
+
+func TestService_FetchMetadata(t *testing.T) {
+	ctx := context.Background()
+	fetcher := &fakeMetadataFetcher{pages: map[string]LinkMetadata{
+		"https://www.example.com/articulo": {Title: "Artículo", Image: "https://www.example.com/portada.png"},
+		"https://www.example.com/otro":     {Title: "Otro"},
+	}}
+	service := NewService(NewStore(), WithMetadataFetcher(fetcher, time.Hour, false))
+	alice := Actor{UserID: "alice"}
+
+	link, _, _ := service.Shorten(ctx, ShortenInput{LongURL: "https://www.example.com/articulo", Owner: "alice"})
+	missing, _, _ := service.Shorten(ctx, ShortenInput{LongURL: "https://www.example.com/borrado"})
+	protected, _, _ := service.Shorten(ctx, ShortenInput{LongURL: "https://www.example.com/articulo", Password: "secreto123"})
+
+	// Primera consulta: se obtienen y se guardan; la segunda sale de la caché
+	for i := 0; i < 2; i++ {
+		got, err := service.FetchMetadata(ctx, Actor{}, link.ShortCode, false)
+		if err != nil || got.Metadata.Title != "Artículo" || !got.Metadata.Fetched() {
+			t.Fatalf("Expected cached metadata, got %+v (err %v)", got.Metadata, err)
+		}
+	}
+	if fetcher.calls != 1 {
+		t.Errorf("Expected one fetch, got %d", fetcher.calls)
+	}
+
+	// Forzar la obtención solo está permitido a quien gestiona el enlace
+	if _, err := service.FetchMetadata(ctx, Actor{UserID: "bob"}, link.ShortCode, true); !errors.Is(err, ErrForbidden) {
+		t.Errorf("Expected ErrForbidden refreshing another user's link, got %v", err)
+	}
+	if _, err := service.FetchMetadata(ctx, alice, link.ShortCode, true); err != nil || fetcher.calls != 2 {
+		t.Errorf("Expected forced fetch, got %d calls (err %v)", fetcher.calls, err)
+	}
+
+	// Los fallos se guardan también para no repetir la petición
+	for i := 0; i < 2; i++ {
+		if _, err := service.FetchMetadata(ctx, Actor{}, missing.ShortCode, false); !errors.Is(err, ErrMetadataUnavailable) {
+			t.Errorf("Expected ErrMetadataUnavailable, got %v", err)
+		}
+	}
+	if fetcher.calls != 3 {
+		t.Errorf("Expected failed fetch to be cached, got %d calls", fetcher.calls)
+	}
+
+	// Los enlaces con contraseña no revelan su destino
+	if _, err := service.FetchMetadata(ctx, Actor{}, protected.ShortCode, false); !errors.Is(err, ErrPasswordRequired) {
+		t.Errorf("Expected ErrPasswordRequired, got %v", err)
+	}
+
+	// Editar el destino descarta los metadatos anteriores
+	updated, err := service.UpdateURL(ctx, alice, link.ShortCode, "https://www.example.com/otro")
+	if err != nil || updated.Metadata.Fetched() {
+		t.Fatalf("Expected metadata reset on update, got %+v (err %v)", updated.Metadata, err)
+	}
+	if got, err := service.FetchMetadata(ctx, Actor{}, link.ShortCode, false); err != nil || got.Metadata.Title != "Otro" {
+		t.Errorf("Expected metadata of new destination, got %+v (err %v)", got.Metadata, err)
+	}
+
+	t.Run("Desactivada", func(t *testing.T) {
+		if _, err := NewService(NewStore()).FetchMetadata(ctx, Actor{}, link.ShortCode, false); !errors.Is(err, ErrMetadataDisabled) {
+			t.Errorf("Expected ErrMetadataDisabled, got %v", err)
+		}
+	})
+
+	t.Run("Al crear", func(t *testing.T) {
+		service := NewService(NewStore(), WithMetadataFetcher(fetcher, time.Hour, true))
+		link, _, _ := service.Shorten(ctx, ShortenInput{LongURL: "https://www.example.com/articulo"})
+
+		workerCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		go service.RunMetadataWorker(workerCtx)
+		deadline := time.Now().Add(time.Second)
+		for {
+			stored, _ := service.GetLink(ctx, link.ShortCode)
+			if stored.Metadata.Fetched() {
+				if stored.Metadata.Title != "Artículo" {
+					t.Errorf("Expected fetched metadata, got %+v", stored.Metadata)
+				}
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("Worker did not fetch the metadata")
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	})
+}
+
+func TestService_LinkQuotas(t *testing.T) {
+	ctx := context.Background()
+	service := NewService(NewStore(), WithLinkQuotas(0, 2), WithMaxURLLength(40))
+	admin := Actor{UserID: "root", Admin: true}
+
+	if _, _, err := service.Shorten(ctx, ShortenInput{LongURL: "https://www.example.com/" + strings.Repeat("a", 20)}); !errors.Is(err, ErrURLTooLong) {
+		t.Errorf("Expected ErrURLTooLong, got %v", err)
+	}
+
+	first, _, err := service.Shorten(ctx, ShortenInput{LongURL: "https://www.example.com/1", Client: "ip:203.0.113.1"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, _, err := service.Shorten(ctx, ShortenInput{LongURL: "https://www.example.com/2", Client: "ip:203.0.113.1"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, _, err := service.Shorten(ctx, ShortenInput{LongURL: "https://www.example.com/3", Client: "ip:203.0.113.1"}); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("Expected ErrQuotaExceeded, got %v", err)
+	}
+
+	// Otros clientes y los enlaces sin cliente no comparten la cuota
+	if _, _, err := service.Shorten(ctx, ShortenInput{LongURL: "https://www.example.com/3", Client: "ip:203.0.113.2"}); err != nil {
+		t.Errorf("Unexpected error for another client: %v", err)
+	}
+	if _, _, err := service.Shorten(ctx, ShortenInput{LongURL: "https://www.example.com/3"}); err != nil {
+		t.Errorf("Unexpected error without client: %v", err)
+	}
+
+	// Eliminar un enlace libera su hueco en la cuota
+	if err := service.DeleteURL(ctx, admin, first.ShortCode); err != nil {
+		t.Fatalf("Unexpected error deleting link: %v", err)
+	}
+	if _, _, err := service.Shorten(ctx, ShortenInput{LongURL: "https://www.example.com/4", Client: "ip:203.0.113.1"}); err != nil {
+		t.Errorf("Expected quota to be released after delete, got %v", err)
+	}
+
+	t.Run("Límite global concurrente", func(t *testing.T) {
+		service := NewService(NewStore(), WithLinkQuotas(10, 0))
+		var wg sync.WaitGroup
+		var created atomic.Int32
+		for i := 0; i < 50; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				_, _, err := service.Shorten(ctx, ShortenInput{LongURL: fmt.Sprintf("https://www.example.com/%d", i)})
+				if err == nil {
+					created.Add(1)
+				} else if !errors.Is(err, ErrStoreFull) {
+					t.Errorf("Expected ErrStoreFull, got %v", err)
+				}
+			}(i)
+		}
+		wg.Wait()
+		if created.Load() != 10 {
+			t.Errorf("Expected exactly 10 links, got %d", created.Load())
+		}
+	})
+}
+
+func TestStore_Eviction(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name        string
+		policy      string
+		reads       []string
+		expectedOut string
+	}{
+		{name: "LRU expulsa el usado hace más tiempo", policy: EvictionLRU, reads: []string{"ccc", "aaa", "aaa"}, expectedOut: "bbb"},
+		{name: "LFU expulsa el menos usado", policy: EvictionLFU, reads: []string{"aaa", "bbb", "aaa", "ccc", "ccc", "ccc"}, expectedOut: "bbb"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewStore(WithEviction(3, tt.policy))
+			for _, code := range []string{"aaa", "bbb", "ccc"} {
+				store.SaveLink(ctx, Link{ShortCode: code, LongURL: "https://www.example.com/" + code})
+			}
+			for _, code := range tt.reads {
+				store.GetLink(ctx, code)
+			}
+			// Reemplazar un enlace existente no expulsa a otro
+			store.SaveLink(ctx, Link{ShortCode: "aaa", LongURL: "https://www.example.com/editado"})
+			if stats := store.EvictionStats(); stats.Evictions != 0 {
+				t.Fatalf("Expected no evictions when replacing a link, got %d", stats.Evictions)
+			}
+
+			store.SaveLink(ctx, Link{ShortCode: "ddd", LongURL: "https://www.example.com/ddd"})
+			if count, _ := store.Count(ctx); count != 3 {
+				t.Errorf("Expected store to stay at capacity, got %d links", count)
+			}
+			if _, exists, _ := store.GetLink(ctx, tt.expectedOut); exists {
+				t.Errorf("Expected %s to be evicted", tt.expectedOut)
+			}
+			if _, exists, _ := store.GetLink(ctx, "ddd"); !exists {
+				t.Errorf("Expected new link to be stored")
+			}
+			if stats := store.EvictionStats(); stats.Evictions != 1 || stats.Policy != tt.policy || stats.Capacity != 3 {
+				t.Errorf("Unexpected eviction stats %+v", stats)
+			}
+		})
+	}
+
+	t.Run("Estadísticas del servicio", func(t *testing.T) {
+		service := NewService(NewStore(WithEviction(2, EvictionLRU)))
+		for i := 0; i < 5; i++ {
+			if _, _, err := service.Shorten(ctx, ShortenInput{LongURL: fmt.Sprintf("https://www.example.com/%d", i)}); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+		}
+		stats, err := service.GetStats(ctx)
+		if err != nil || stats.TotalLinks != 2 || stats.Store.Evictions != 3 || stats.Store.Capacity != 2 {
+			t.Errorf("Expected 2 stored and 3 evicted links, got %+v (err %v)", stats, err)
+		}
+
+		if stats, _ := NewService(NewStore()).GetStats(ctx); stats.Store.Capacity != 0 || stats.Store.Evictions != 0 {
+			t.Errorf("Expected no eviction stats without capacity, got %v", stats)
+		}
+	})
+}
+
+func TestService_DeduplicationMode(t *testing.T) {
+	store := NewStore()
+	service := NewService(store, WithDeduplication(true))
+
+	const numGoroutines = 50
+	testURL := "https://www.example.com/dedup"
+
+	var wg sync.WaitGroup
+	codes := make(chan string, numGoroutines)
+	created := make(chan bool, numGoroutines)
+
+	// Todas las peticiones concurrentes para la misma URL deben obtener el mismo código
+	wg.Add(numGoroutines)
+	for i := 0; i < numGoroutines; i++ {
+		go func() {
+			defer wg.Done()
+			link, isNew, err := service.Shorten(context.Background(), ShortenInput{LongURL: testURL})
+			if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+				return
+			}
+			codes <- link.ShortCode
+			created <- isNew
+		}()
+	}
+	wg.Wait()
+	close(codes)
+	close(created)
+
+	unique := make(map[string]bool)
+	for code := range codes {
+		unique[code] = true
+	}
+	if len(unique) != 1 {
+		t.Errorf("Expected a single code for the same URL, got %d", len(unique))
+	}
+
+	newLinks := 0
+	for isNew := range created {
+		if isNew {
+			newLinks++
+		}
+	}
+	if count, _ := store.Count(context.Background()); newLinks != 1 || count != 1 {
+		t.Errorf("Expected exactly one created link, got %d (store has %d)", newLinks, count)
+	}
+
+	// Un alias explícito no se deduplica
+	if link, isNew, err := service.Shorten(context.Background(), ShortenInput{LongURL: testURL, Alias: "dedup-alias"}); err != nil || !isNew || link.ShortCode != "dedup-alias" {
+		t.Errorf("Expected alias to create a new link, got %s (created %v, err %v)", link.ShortCode, isNew, err)
+	}
+
+	// Tras eliminar el enlace indexado se genera uno nuevo
+	original, _, _ := store.FindByURL(context.Background(), "", testURL)
+	store.Delete(context.Background(), original.ShortCode)
+	if _, isNew, err := service.Shorten(context.Background(), ShortenInput{LongURL: testURL}); err != nil || !isNew {
+		t.Errorf("Expected a new link after deleting the indexed one (created %v, err %v)", isNew, err)
+	}
+}
+
+func TestService_DeduplicationPerOwner(t *testing.T) {
+	store := NewStore()
+	service := NewService(store, WithDeduplication(true))
+	testURL := "https://www.example.com/per-owner"
+
+	alice1, _, _ := service.Shorten(context.Background(), ShortenInput{LongURL: testURL, Owner: "alice"})
+	alice2, created, _ := service.Shorten(context.Background(), ShortenInput{LongURL: testURL, Owner: "alice"})
+	bob, _, _ := service.Shorten(context.Background(), ShortenInput{LongURL: testURL, Owner: "bob"})
+	anonymous, _, _ := service.Shorten(context.Background(), ShortenInput{LongURL: testURL})
+
+	if alice1.ShortCode != alice2.ShortCode || created {
+		t.Errorf("Expected same code for the same owner, got %s and %s", alice1.ShortCode, alice2.ShortCode)
+	}
+	if bob.ShortCode == alice1.ShortCode || anonymous.ShortCode == alice1.ShortCode || anonymous.ShortCode == bob.ShortCode {
+		t.Errorf("Expected distinct codes per owner, got alice=%s bob=%s anonymous=%s",
+			alice1.ShortCode, bob.ShortCode, anonymous.ShortCode)
+	}
+}
+
+func TestService_DeduplicationPerRequest(t *testing.T) {
+	service := NewService(NewStore())
+	testURL := "https://www.example.com/per-request"
+
+	first, _, _ := service.Shorten(context.Background(), ShortenInput{LongURL: testURL, Deduplicate: true})
+	second, created, _ := service.Shorten(context.Background(), ShortenInput{LongURL: testURL, Deduplicate: true})
+	if first.ShortCode != second.ShortCode || created {
+		t.Errorf("Expected the request to reuse %s, got %s (created %v)", first.ShortCode, second.ShortCode, created)
+	}
+	// Sin pedirlo, el servicio sin modo deduplicación crea otro enlace
+	if third, created, _ := service.Shorten(context.Background(), ShortenInput{LongURL: testURL}); third.ShortCode == first.ShortCode || !created {
+		t.Errorf("Expected a new link without Deduplicate, got %s", third.ShortCode)
+	}
+}
+
+func TestService_DeduplicationRules(t *testing.T) {
+	ctx := context.Background()
+	testURL := "https://www.example.com/reglas"
+
+	tests := []struct {
+		name  string
+		input ShortenInput
+	}{
+		{name: "Con UTM", input: ShortenInput{LongURL: testURL, Owner: "alice", UTM: UTMParams{Source: "newsletter"}}},
+		{name: "Con reenvío de la query", input: ShortenInput{LongURL: testURL, Owner: "alice", ForwardQuery: true}},
+		{name: "Con espacio compartido", input: ShortenInput{LongURL: testURL, Owner: "alice", Workspace: "marketing"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := NewService(NewStore(), WithDeduplication(true))
+			plain, _, err := service.Shorten(ctx, ShortenInput{LongURL: testURL, Owner: "alice"})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			link, created, err := service.Shorten(ctx, tt.input)
+			if err != nil || !created || link.ShortCode == plain.ShortCode {
+				t.Errorf("Expected a distinct link from %s, got %s (created %v, err %v)", plain.ShortCode, link.ShortCode, created, err)
+			}
+		})
+	}
+}
+
+// uniqueStubGenerator es un stubGenerator que se declara único, como snowflake, de modo que el
+// servicio no comprueba sus códigos antes de guardarlos
+type uniqueStubGenerator struct {
+	stubGenerator
+}
+
+func (g *uniqueStubGenerator) Unique() bool {
+	return true
+}
+
+func TestService_DeduplicationOccupiedCode(t *testing.T) {
+	ctx := context.Background()
+	store := NewStore()
+	store.SaveLink(ctx, Link{ShortCode: "ocupado", LongURL: "https://www.example.com/antes", Owner: "bob"})
+
+	// GetOrSave no reemplaza un código ocupado por otro enlace
+	if result, created, err := store.GetOrSave(ctx, Link{ShortCode: "ocupado", LongURL: "https://www.example.com/despues"}); err != nil || created || result.ShortCode != "" {
+		t.Errorf("Expected an empty result for an occupied code, got %+v (created %v, err %v)", result, created, err)
+	}
+
+	// El servicio regenera el código aunque el generador sea único
+	generator := &uniqueStubGenerator{stubGenerator{codes: []string{"ocupado", "libre"}}}
+	service := NewService(store, WithDeduplication(true), WithCodeGenerator(generator))
+	link, created, err := service.Shorten(ctx, ShortenInput{LongURL: "https://www.example.com/despues"})
+	if err != nil || !created || link.ShortCode != "libre" {
+		t.Fatalf("Expected a new link on the next code, got %s (created %v, err %v)", link.ShortCode, created, err)
+	}
+	if existing, _, _ := store.GetLink(ctx, "ocupado"); existing.LongURL != "https://www.example.com/antes" || existing.Owner != "bob" {
+		t.Errorf("Expected the occupied link to be kept, got %+v", existing)
+	}
+}
+
+func TestService_CustomDomains(t *testing.T) {
+	ctx := context.Background()
+	service := NewService(NewStore(), WithCustomDomains(map[string]string{"Go.Acme.com": "acme"}))
+
+	if _, err := service.RegisterDomain("go.acme.com", "otro"); !errors.Is(err, ErrDomainTaken) {
+		t.Errorf("Expected ErrDomainTaken, got %v", err)
+	}
+	for _, host := range []string{"localhost", "acme.com/x", ""} {
+		if _, err := service.RegisterDomain(host, "acme"); !errors.Is(err, ErrInvalidDomain) {
+			t.Errorf("Expected ErrInvalidDomain for %q, got %v", host, err)
+		}
+	}
+
+	// El mismo alias puede existir en el dominio principal y en el personalizado
+	scoped, _, err := service.Shorten(ctx, ShortenInput{LongURL: "https://www.acme.com/", Owner: "acme", Alias: "promo"})
+	if err != nil || scoped.Domain != "go.acme.com" || scoped.Key() != "go.acme.com/promo" {
+		t.Fatalf("Expected link scoped to go.acme.com, got %+v (%v)", scoped, err)
+	}
+	main, _, err := service.Shorten(ctx, ShortenInput{LongURL: "https://www.example.com/", Alias: "promo"})
+	if err != nil || main.Domain != "" {
+		t.Fatalf("Expected link on the main domain, got %+v (%v)", main, err)
+	}
+	if _, _, err := service.Shorten(ctx, ShortenInput{LongURL: "https://www.acme.com/otra", Owner: "acme", Alias: "promo"}); !errors.Is(err, ErrAliasTaken) {
+		t.Errorf("Expected ErrAliasTaken inside the domain, got %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		host        string
+		expectedURL string
+	}{
+		{name: "Dominio personalizado con puerto", host: "go.acme.com:8080", expectedURL: "https://www.acme.com/"},
+		{name: "Dominio personalizado en mayúsculas", host: "GO.ACME.COM", expectedURL: "https://www.acme.com/"},
+		{name: "Dominio principal", host: "localhost:8080", expectedURL: "https://www.example.com/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			longURL, err := service.GetLongURL(ctx, service.ScopeCode(tt.host, "promo"))
+			if err != nil || longURL != tt.expectedURL {
+				t.Errorf("Expected %s, got %s (%v)", tt.expectedURL, longURL, err)
+			}
+		})
+	}
+
+	// Sin el dominio registrado sus enlaces dejan de resolverse pero se conservan
+	if err := service.RemoveDomain("go.acme.com"); err != nil {
+		t.Fatalf("Unexpected error removing domain: %v", err)
+	}
+	if key := service.ScopeCode("go.acme.com", "promo"); key != "promo" {
+		t.Errorf("Expected unscoped key after removal, got %s", key)
+	}
+	if _, err := service.GetLink(ctx, "go.acme.com/promo"); err != nil {
+		t.Errorf("Expected scoped link to be kept, got %v", err)
+	}
+	if err := service.RemoveDomain("go.acme.com"); !errors.Is(err, ErrDomainUnknown) {
+		t.Errorf("Expected ErrDomainUnknown, got %v", err)
+	}
+}
+
+func TestService_Tenants(t *testing.T) {
+	ctx := context.Background()
+	service := NewService(NewStore(),
+		WithTenants(map[string]string{"clave-a": "equipo-a", "clave-x": "Inválido"}, map[string]string{"Go.Equipo-B.com": "equipo-b"}),
+		WithTenantQuota(2), WithDeduplication(true))
+
+	resolveTests := []struct {
+		name     string
+		apiKey   string
+		host     string
+		expected string
+	}{
+		{name: "Por clave de API", apiKey: "clave-a", host: "go.equipo-b.com", expected: "equipo-a"},
+		{name: "Por host con puerto", host: "GO.EQUIPO-B.COM:8080", expected: "equipo-b"},
+		{name: "Clave desconocida", apiKey: "otra", host: "localhost", expected: ""},
+		{name: "Tenant inválido ignorado", apiKey: "clave-x", expected: ""},
+	}
+	for _, tt := range resolveTests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tenant := service.ResolveTenant(tt.apiKey, tt.host); tenant != tt.expected {
+				t.Errorf("Expected tenant %q, got %q", tt.expected, tenant)
+			}
+		})
+	}
+
+	// El mismo alias existe a la vez en el espacio común y en cada tenant
+	for _, tenant := range []string{"", "equipo-a", "equipo-b"} {
+		link, _, err := service.Shorten(ctx, ShortenInput{LongURL: "https://www.example.com/" + tenant, Alias: "promo", Tenant: tenant})
+		if err != nil || link.Key() != TenantKey(tenant, "promo") {
+			t.Fatalf("Expected promo in tenant %q, got %+v (%v)", tenant, link, err)
+		}
+	}
+	if _, _, err := service.Shorten(ctx, ShortenInput{LongURL: "https://www.example.com/otra", Alias: "promo", Tenant: "equipo-a"}); !errors.Is(err, ErrAliasTaken) {
+		t.Errorf("Expected ErrAliasTaken inside the tenant, got %v", err)
+	}
+	if longURL, err := service.GetLongURL(ctx, TenantKey("equipo-b", "promo")); err != nil || longURL != "https://www.example.com/equipo-b" {
+		t.Errorf("Expected equipo-b destination, got %s (%v)", longURL, err)
+	}
+
+	// La deduplicación no cruza tenants
+	common, _, _ := service.Shorten(ctx, ShortenInput{LongURL: "https://www.example.com/compartida"})
+	scoped, created, err := service.Shorten(ctx, ShortenInput{LongURL: "https://www.example.com/compartida", Tenant: "equipo-a"})
+	if err != nil || !created || scoped.Tenant != "equipo-a" || scoped.Key() == common.Key() {
+		t.Errorf("Expected a new link in equipo-a, got %+v (created %v, %v)", scoped, created, err)
+	}
+
+	// equipo-a ya tiene dos enlaces; el espacio común no tiene cuota por tenant
+	if _, _, err := service.Shorten(ctx, ShortenInput{LongURL: "https://www.example.com/tercera", Tenant: "equipo-a"}); !errors.Is(err, ErrTenantQuotaExceeded) {
+		t.Errorf("Expected ErrTenantQuotaExceeded, got %v", err)
+	}
+	if _, _, err := service.Shorten(ctx, ShortenInput{LongURL: "https://www.example.com/tercera"}); err != nil {
+		t.Errorf("Unexpected error in the common space: %v", err)
+	}
+
+	page, err := service.ListLinks(ctx, Actor{Admin: true}, ListQuery{AnyOwner: true, Tenant: "equipo-b"})
+	if err != nil || page.Total != 1 || page.Links[0].Tenant != "equipo-b" {
+		t.Errorf("Expected only equipo-b links, got %+v (%v)", page, err)
+	}
+
+	stats, err := service.TenantStatistics(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []TenantStats{{Tenant: "", Links: 3}, {Tenant: "equipo-a", Links: 2}, {Tenant: "equipo-b", Links: 1}}
+	if !reflect.DeepEqual(stats, expected) {
+		t.Errorf("Expected stats %+v, got %+v", expected, stats)
+	}
+	if host := service.TenantHost("equipo-b"); host != "go.equipo-b.com" {
+		t.Errorf("Expected host go.equipo-b.com, got %q", host)
+	}
+}
+
+func TestService_EditorWorkspaces(t *testing.T) {
+	ctx := context.Background()
+	service := NewService(NewStore())
+	ana := Actor{UserID: "ana", Workspace: "marketing"}
+
+	shared, _, err := service.Shorten(ctx, ShortenInput{LongURL: "https://www.example.com/campaña", Owner: "ana", Workspace: "marketing"})
+	if err != nil || shared.Workspace != "marketing" {
+		t.Fatalf("Expected link in marketing, got %+v (%v)", shared, err)
+	}
+	own, _, _ := service.Shorten(ctx, ShortenInput{LongURL: "https://www.example.com/propio", Owner: "luis"})
+
+	tests := []struct {
+		name          string
+		actor         Actor
+		code          string
+		delete        bool
+		expectedError error
+	}{
+		{name: "Editor del mismo espacio edita", actor: Actor{UserID: "beto", Workspace: "marketing"}, code: shared.ShortCode},
+		{name: "Editor de otro espacio", actor: Actor{UserID: "carla", Workspace: "ventas"}, code: shared.ShortCode, expectedError: ErrForbidden},
+		{name: "Editor fuera de su espacio", actor: ana, code: own.ShortCode, expectedError: ErrForbidden},
+		{name: "Editor no elimina ni los propios", actor: ana, code: shared.ShortCode, delete: true, expectedError: ErrForbidden},
+		{name: "Propietario elimina", actor: Actor{UserID: "luis"}, code: own.ShortCode, delete: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var err error
+			if tt.delete {
+				err = service.DeleteURL(ctx, tt.actor, tt.code)
+			} else {
+				_, err = service.UpdateURL(ctx, tt.actor, tt.code, "https://www.example.com/nueva")
+			}
+			if !errors.Is(err, tt.expectedError) {
+				t.Errorf("Expected %v, got %v", tt.expectedError, err)
+			}
+		})
+	}
+
+	page, err := service.ListLinks(ctx, Actor{UserID: "beto", Workspace: "marketing"}, ListQuery{AnyOwner: true})
+	if err != nil || page.Total != 1 || page.Links[0].ShortCode != shared.ShortCode {
+		t.Errorf("Expected the shared link listed for the editor, got %+v (%v)", page, err)
+	}
+}
+
+func TestSequentialGenerator(t *testing.T) {
+	generator := NewSequentialGenerator(DefaultCodeFormat(), 0)
+
+	if code := generator.Generate("", 0); code != "aaaaaa" {
+		t.Errorf("Expected first code aaaaaa, got %s", code)
+	}
+	if code := generator.Generate("", 0); code != "aaaaab" {
+		t.Errorf("Expected second code aaaaab, got %s", code)
+	}
+
+	tests := []struct {
+		value    uint64
+		expected string
+	}{
+		{value: 61, expected: "aaaaa9"},
+		{value: 62, expected: "aaaaba"},
+		{value: 62 * 62 * 62 * 62 * 62 * 62, expected: "baaaaaa"},
+	}
+	for _, tt := range tests {
+		if code := encodeBaseN(tt.value, ValidChars, ShortCodeLength); code != tt.expected {
+			t.Errorf("encodeBaseN(%d): expected %s, got %s", tt.value, tt.expected, code)
+		}
+	}
+}
+
+func TestService_SequentialStrategyConcurrent(t *testing.T) {
+	store := NewStore()
+	generator, err := NewCodeGenerator(GeneratorConfig{Strategy: StrategySequential, Format: DefaultCodeFormat()})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	service := NewService(store, WithCodeGenerator(generator))
+
+	// Un alias que ocupa el siguiente código secuencial obliga a un único reintento
+	if _, _, err := service.Shorten(context.Background(), ShortenInput{LongURL: "https://www.example.com", Alias: "aaaaaa"}); err != nil {
+		t.Fatalf("Unexpected error creating alias: %v", err)
+	}
+
+	const numGoroutines = 50
+	var wg sync.WaitGroup
+	codes := make(chan string, numGoroutines)
+	wg.Add(numGoroutines)
+	for i := 0; i < numGoroutines; i++ {
+		go func(id int) {
+			defer wg.Done()
+			code, err := service.ShortenURL(context.Background(), fmt.Sprintf("https://example%d.com", id))
+			if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			codes <- code
+		}(i)
+	}
+	wg.Wait()
+	close(codes)
+
+	unique := make(map[string]bool)
+	for code := range codes {
+		if unique[code] || code == "aaaaaa" {
+			t.Errorf("Duplicate code generated: %s", code)
+		}
+		unique[code] = true
+	}
+
+	if _, err := NewCodeGenerator(GeneratorConfig{Strategy: "desconocida", Format: DefaultCodeFormat()}); err == nil {
+		t.Error("Expected error for unknown strategy")
+	}
+}
+
+func TestRandomGenerator_RejectsBiasedBytes(t *testing.T) {
+	// Bytes >= 248 deben descartarse; 0 y 61 mapean al primer y último carácter
+	source := []byte{255, 248, 0, 61, 62, 247, 250, 1, 2, 3, 4, 5}
+	generator := &RandomGenerator{format: DefaultCodeFormat(), read: func(buf []byte) (int, error) {
+		n := copy(buf, source)
+		source = source[n:]
+		return n, nil
+	}}
+
+	code := generator.Generate("", 0)
+	expected := string([]byte{ValidChars[0], ValidChars[61], ValidChars[0], ValidChars[247%62], ValidChars[1], ValidChars[2]})
+	if code != expected {
+		t.Errorf("Expected %s, got %s", expected, code)
+	}
+}
+
+func TestRandomGenerator_Distribution(t *testing.T) {
+	generator := NewRandomGenerator(DefaultCodeFormat())
+	counts := make(map[byte]int)
+	const samples = 2000
+
+	for i := 0; i < samples; i++ {
+		code := generator.Generate("https://www.example.com", 0)
+		if len(code) != ShortCodeLength {
+			t.Fatalf("Expected length %d, got %d", ShortCodeLength, len(code))
+		}
+		for j := 0; j < len(code); j++ {
+			if !strings.ContainsRune(ValidChars, rune(code[j])) {
+				t.Fatalf("Unexpected character %q in %s", code[j], code)
+			}
+			counts[code[j]]++
+		}
+	}
+
+	// Con 12000 caracteres cada símbolo debería aparecer ~194 veces; se usa un margen amplio
+	for _, c := range []byte(ValidChars) {
+		if counts[c] < 100 || counts[c] > 300 {
+			t.Errorf("Character %q appeared %d times, distribution looks biased", c, counts[c])
+		}
+	}
+}
+
+func TestCodeFormat_Validate(t *testing.T) {
+	tests := []struct {
+		name        string
+		format      CodeFormat
+		expectError bool
+	}{
+		{name: "Formato por defecto", format: DefaultCodeFormat()},
+		{name: "Sin caracteres ambiguos", format: CodeFormat{Length: 8, Alphabet: "abcdefghijkmnpqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ23456789"}},
+		{name: "Longitud muy corta", format: CodeFormat{Length: 3, Alphabet: ValidChars}, expectError: true},
+		{name: "Longitud excesiva", format: CodeFormat{Length: 33, Alphabet: ValidChars}, expectError: true},
+		{name: "Carácter no seguro en URL", format: CodeFormat{Length: 8, Alphabet: ValidChars + "/"}, expectError: true},
+		{name: "Carácter repetido", format: CodeFormat{Length: 8, Alphabet: ValidChars + "a"}, expectError: true},
+		{name: "Alfabeto muy pequeño", format: CodeFormat{Length: 20, Alphabet: "abc"}, expectError: true},
+		{name: "Espacio de códigos insuficiente", format: CodeFormat{Length: 4, Alphabet: ValidChars}, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.format.Validate(); (err != nil) != tt.expectError {
+				t.Errorf("Expected error %v, got %v", tt.expectError, err)
+			}
+		})
+	}
+}
+
+func TestService_CustomCodeFormat(t *testing.T) {
+	format := CodeFormat{Length: 9, Alphabet: "abcdefghijkmnpqrstuvwxyz23456789"}
+
+	for _, strategy := range []string{StrategyHash, StrategyRandom, StrategySequential} {
+		t.Run(strategy, func(t *testing.T) {
+			generator, err := NewCodeGenerator(GeneratorConfig{Strategy: strategy, Format: format})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			service := NewService(NewStore(), WithCodeGenerator(generator))
+
+			for i := 0; i < 20; i++ {
+				code, err := service.ShortenURL(context.Background(), fmt.Sprintf("https://example%d.com", i))
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				if len(code) != format.Length {
+					t.Errorf("Expected length %d, got %d (%s)", format.Length, len(code), code)
+				}
+				for _, c := range code {
+					if !strings.ContainsRune(format.Alphabet, c) {
+						t.Errorf("Character %q of %s is outside the configured alphabet", c, code)
+					}
+				}
+			}
+		})
+	}
+}
+
+// stubGenerator retorna los códigos indicados en orden
+type stubGenerator struct {
+	codes []string
+	calls int
+}
+
+func (g *stubGenerator) Generate(_ string, _ int) string {
+	code := g.codes[g.calls%len(g.codes)]
+	g.calls++
+	return code
+}
+
+func TestService_ErrorCodes(t *testing.T) {
+	// Un generador sin códigos entra en pánico, que el servicio recupera como ErrCritical
+	service := NewService(NewStore(), WithCodeGenerator(&stubGenerator{}))
+	_, _, err := service.Shorten(context.Background(), ShortenInput{LongURL: "https://www.example.com"})
+	if !errors.Is(err, ErrCritical) || errcode.Of(err) != errcode.Critical {
+		t.Errorf("Expected critical error, got %v", err)
+	}
+
+	service = NewService(NewStore())
+	_, _, err = service.Shorten(context.Background(), ShortenInput{LongURL: "ftp://example.com"})
+	if code := errcode.Of(err); code != errcode.InvalidURL {
+		t.Errorf("Expected code %s for a validation error, got %s", errcode.InvalidURL, code)
+	}
+	if _, err := service.GetLink(context.Background(), "noexiste"); errcode.Of(err) != errcode.NotFound {
+		t.Errorf("Expected code %s, got %s", errcode.NotFound, errcode.Of(err))
+	}
+}
+
+func TestService_CodeFilter(t *testing.T) {
+	filter := NewCodeFilter(DefaultReservedWords, []string{"caca"})
+	generator := &stubGenerator{codes: []string{"Admin", "xcacax", "ok1234"}}
+	service := NewService(NewStore(), WithCodeGenerator(generator), WithCodeFilter(filter))
+
+	// Los códigos generados reservados u ofensivos se regeneran automáticamente
+	code, err := service.ShortenURL(context.Background(), "https://www.example.com")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if code != "ok1234" || generator.calls != 3 {
+		t.Errorf("Expected ok1234 after 3 attempts, got %s after %d", code, generator.calls)
+	}
+
+	// Los alias personalizados se rechazan con ErrAliasNotAllowed
+	for _, alias := range []string{"shorten", "HEALTHZ", "mi-CACA-link"} {
+		if _, _, err := service.Shorten(context.Background(), ShortenInput{LongURL: "https://www.example.com", Alias: alias}); !errors.Is(err, ErrAliasNotAllowed) {
+			t.Errorf("Expected ErrAliasNotAllowed for %s, got %v", alias, err)
+		}
+	}
+}
+
+func TestService_RouteRegistry(t *testing.T) {
+	ctx := context.Background()
+	store := NewStore()
+	store.SaveLink(ctx, Link{ShortCode: "status", LongURL: "https://www.example.com/status"})
+	routes := NewRouteRegistry("/api/urls/{short_code}", "/{short_code}+", "/t/{tenant}/{short_code}", "/*")
+	filter := NewCodeFilter(nil, nil).WithRoutes(routes)
+	service := NewService(store, WithCodeFilter(filter))
+
+	// Las rutas registradas después de crear el filtro también quedan reservadas
+	routes.Register("/status")
+	routes.Register("/Metrics/{name}")
+
+	if got := strings.Join(routes.Segments(), ","); got != "api,metrics,status,t" {
+		t.Errorf("Expected reserved segments api,metrics,status,t, got %s", got)
+	}
+	if pattern, ok := routes.Route("METRICS"); !ok || pattern != "/Metrics/{name}" {
+		t.Errorf("Expected METRICS reserved by /Metrics/{name}, got %q (%t)", pattern, ok)
+	}
+
+	tests := []struct {
+		name        string
+		alias       string
+		expectedErr error
+	}{
+		{name: "Ruta de la API", alias: "api", expectedErr: ErrAliasNotAllowed},
+		{name: "Ruta registrada después", alias: "metrics", expectedErr: ErrAliasNotAllowed},
+		{name: "Sin distinguir mayúsculas", alias: "MeTrIcS", expectedErr: ErrAliasNotAllowed},
+		{name: "Prefijo de una ruta", alias: "apis"},
+		{name: "Parámetro de ruta", alias: "short_code"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := service.Shorten(ctx, ShortenInput{LongURL: "https://www.example.com", Alias: tt.alias})
+			if !errors.Is(err, tt.expectedErr) {
+				t.Errorf("Expected error %v, got %v", tt.expectedErr, err)
+			}
+		})
+	}
+
+	shadowed, err := service.ShadowedLinks(ctx, routes)
+	if err != nil || len(shadowed) != 1 || shadowed[0].ShortCode != "status" {
+		t.Errorf("Expected the status link shadowed by its route, got %+v (err %v)", shadowed, err)
+	}
+}
+
+func TestSnowflakeGenerator_UniqueAcrossNodes(t *testing.T) {
+	if _, err := NewSnowflakeGenerator(DefaultCodeFormat(), MaxNodeID+1); err == nil {
+		t.Error("Expected error for node ID out of range")
+	}
+
+	// Dos réplicas con el mismo reloj congelado nunca comparten códigos
+	frozen := time.Now()
+	nodes := make([]*SnowflakeGenerator, 2)
+	for i := range nodes {
+		generator, err := NewSnowflakeGenerator(DefaultCodeFormat(), int64(i+1))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		generator.now = func() time.Time { return frozen }
+		nodes[i] = generator
+	}
+
+	codes := make(map[string]bool)
+	for i := 0; i < 2*(maxSnowflakeSequence+1)+10; i++ {
+		for _, node := range nodes {
+			code := node.Generate("", 0)
+			if codes[code] {
+				t.Fatalf("Duplicate snowflake code %s", code)
+			}
+			codes[code] = true
+		}
+	}
+
+	// Un retroceso del reloj no produce identificadores repetidos
+	last := nodes[0].nextID()
+	nodes[0].now = func() time.Time { return frozen.Add(-time.Hour) }
+	if next := nodes[0].nextID(); next <= last {
+		t.Errorf("Expected monotonic IDs after clock regression, got %d after %d", next, last)
+	}
+}
+
+func TestService_SnowflakeSkipsExistenceCheck(t *testing.T) {
+	generator, err := NewCodeGenerator(GeneratorConfig{Strategy: StrategySnowflake, Format: DefaultCodeFormat(), NodeID: 7})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	service := NewService(NewStore(), WithCodeGenerator(generator))
+
+	codes := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		code, err := service.ShortenURL(context.Background(), fmt.Sprintf("https://example%d.com", i))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if codes[code] {
+			t.Fatalf("Duplicate code %s", code)
+		}
+		codes[code] = true
+	}
+}
+
+func BenchmarkService_ShortenURL(b *testing.B) {
+	store := NewStore()
+	service := NewService(store)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		testURL := fmt.Sprintf("https://benchmark%d.com", i)
+		_, err := service.ShortenURL(context.Background(), testURL)
+		if err != nil {
+			b.Errorf("Error in benchmark: %v", err)
+		}
+	}
+}
+
+func BenchmarkService_GetLongURL(b *testing.B) {
+	store := NewStore()
+	service := NewService(store)
+
+	// Preparar datos de prueba
+	testCodes := make([]string, 1000)
+	for i := 0; i < 1000; i++ {
+		testURL := fmt.Sprintf("https://benchmark%d.com", i)
+		shortCode, _ := service.ShortenURL(context.Background(), testURL)
+		testCodes[i] = shortCode
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		code := testCodes[i%len(testCodes)]
+		_, err := service.GetLongURL(context.Background(), code)
+		if err != nil {
+			b.Errorf("Error in benchmark: %v", err)
+		}
+	}
+}
+
+func TestService_OwnershipRules(t *testing.T) {
+	store := NewStore()
+	service := NewService(store)
+
+	link, _, err := service.Shorten(context.Background(), ShortenInput{LongURL: "https://www.example.com/owned", Owner: "alice"})
+	if err != nil {
+		t.Fatalf("Error creating owned URL: %v", err)
+	}
+	if _, _, err := service.Shorten(context.Background(), ShortenInput{LongURL: "https://www.example.com/other", Owner: "bob"}); err != nil {
+		t.Fatalf("Error creating owned URL: %v", err)
+	}
+
+	// Solo los enlaces propios aparecen en el listado
+	if links, _ := service.ListByOwner(context.Background(), "", "alice"); len(links) != 1 || links[0].ShortCode != link.ShortCode {
+		t.Errorf("Expected only alice's link, got %+v", links)
+	}
+
+	// Otro usuario no puede editar ni eliminar
+	if _, err := service.UpdateURL(context.Background(), Actor{UserID: "bob"}, link.ShortCode, "https://evil.example.com"); err != ErrForbidden {
+		t.Errorf("Expected ErrForbidden on update, got %v", err)
+	}
+	if err := service.DeleteURL(context.Background(), Actor{UserID: "bob"}, link.ShortCode); err != ErrForbidden {
+		t.Errorf("Expected ErrForbidden on delete, got %v", err)
+	}
+
+	// El propietario puede editar
+	updated, err := service.UpdateURL(context.Background(), Actor{UserID: "alice"}, link.ShortCode, "https://www.example.com/new")
+	if err != nil {
+		t.Fatalf("Unexpected error updating own link: %v", err)
+	}
+	if updated.LongURL != "https://www.example.com/new" {
+		t.Errorf("Expected updated URL, got %s", updated.LongURL)
+	}
+
+	// Un administrador puede eliminar cualquier enlace
+	if err := service.DeleteURL(context.Background(), Actor{UserID: "root", Admin: true}, link.ShortCode); err != nil {
+		t.Errorf("Unexpected error deleting as admin: %v", err)
+	}
+	if _, err := service.GetLongURL(context.Background(), link.ShortCode); err != ErrURLNotFound {
+		t.Errorf("Expected ErrURLNotFound after delete, got %v", err)
+	}
+}
+
+func TestService_AliasAndExpiration(t *testing.T) {
+	store := NewStore()
+	service := NewService(store)
+
+	link, _, err := service.Shorten(context.Background(), ShortenInput{LongURL: "https://www.example.com", Alias: "mi-campania"})
+	if err != nil {
+		t.Fatalf("Unexpected error creating alias: %v", err)
+	}
+	if link.ShortCode != "mi-campania" {
+		t.Errorf("Expected alias as short code, got %s", link.ShortCode)
+	}
+
+	tests := []struct {
+		name      string
+		input     ShortenInput
+		errorType error
+	}{
+		{name: "Alias duplicado", input: ShortenInput{LongURL: "https://www.example.com", Alias: "mi-campania"}, errorType: ErrAliasTaken},
+		{name: "Alias muy corto", input: ShortenInput{LongURL: "https://www.example.com", Alias: "ab"}, errorType: ErrInvalidAlias},
+		{name: "Alias con caracteres inválidos", input: ShortenInput{LongURL: "https://www.example.com", Alias: "hola mundo"}, errorType: ErrInvalidAlias},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := service.Shorten(context.Background(), tt.input); !errors.Is(err, tt.errorType) {
+				t.Errorf("Expected error %v, got %v", tt.errorType, err)
+			}
+		})
+	}
+
+	// Un enlace con TTL expira y deja de resolverse
+	expiring, _, err := service.Shorten(context.Background(), ShortenInput{LongURL: "https://www.example.com/temporal", TTL: time.Millisecond})
+	if err != nil {
+		t.Fatalf("Unexpected error creating expiring link: %v", err)
+	}
+	if expiring.ExpiresAt.IsZero() {
+		t.Error("Expected ExpiresAt to be set")
+	}
+	time.Sleep(5 * time.Millisecond)
+	if _, err := service.GetLongURL(context.Background(), expiring.ShortCode); err != ErrURLExpired {
+		t.Errorf("Expected ErrURLExpired, got %v", err)
+	}
+}
+
+func TestService_AliasSuggestions(t *testing.T) {
+	ctx := context.Background()
+	year := strconv.Itoa(time.Now().Year())
+	long := strings.Repeat("a", MaxAliasLength)
+
+	tests := []struct {
+		name                string
+		alias               string
+		taken               []string
+		opts                []ServiceOption
+		expectedSuggestions []string
+	}{
+		{name: "Sufijos numéricos y año", alias: "promo", taken: []string{"promo"},
+			expectedSuggestions: []string{"promo-2", "promo" + year, "promo-3"}},
+		{name: "Se omiten las alternativas ocupadas", alias: "promo", taken: []string{"promo", "promo-2", "promo-3"},
+			expectedSuggestions: []string{"promo" + year, "promo-4", aliasCandidates("promo", 0)[4]}},
+		{name: "Alias en el máximo de longitud", alias: long, taken: []string{long},
+			expectedSuggestions: []string{long[:MaxAliasLength-2] + "-2", long[:MaxAliasLength-4] + year, long[:MaxAliasLength-2] + "-3"}},
+		{name: "Número de sugerencias configurado", alias: "promo", taken: []string{"promo"}, opts: []ServiceOption{WithAliasSuggestions(1)},
+			expectedSuggestions: []string{"promo-2"}},
+		{name: "Sugerencias desactivadas", alias: "promo", taken: []string{"promo"}, opts: []ServiceOption{WithAliasSuggestions(0)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewStore()
+			for _, code := range tt.taken {
+				store.SaveLink(ctx, Link{ShortCode: code, LongURL: "https://www.example.com/" + code})
+			}
+			service := NewService(store, tt.opts...)
+			_, _, err := service.Shorten(ctx, ShortenInput{LongURL: "https://www.example.com/nuevo", Alias: tt.alias})
+			var aliasErr *AliasTakenError
+			if !errors.As(err, &aliasErr) || !errors.Is(err, ErrAliasTaken) {
+				t.Fatalf("Expected AliasTakenError, got %v", err)
+			}
+			if !reflect.DeepEqual(aliasErr.Suggestions, tt.expectedSuggestions) && len(aliasErr.Suggestions)+len(tt.expectedSuggestions) > 0 {
+				t.Errorf("Expected suggestions %v, got %v", tt.expectedSuggestions, aliasErr.Suggestions)
+			}
+			// Todas las sugerencias se pueden usar tal cual
+			for _, suggestion := range aliasErr.Suggestions {
+				if _, _, err := service.Shorten(ctx, ShortenInput{LongURL: "https://www.example.com/nuevo", Alias: suggestion}); err != nil {
+					t.Errorf("Expected suggestion %q to be available, got %v", suggestion, err)
+				}
+			}
+		})
+	}
+}
+
+func TestService_CaseInsensitiveCodes(t *testing.T) {
+	ctx := context.Background()
+	service := NewService(NewStore(), WithCaseInsensitiveCodes(true), WithCodeGenerator(&stubGenerator{codes: []string{"AbC123"}}))
+
+	link, _, err := service.Shorten(ctx, ShortenInput{LongURL: "https://www.example.com/promo", Alias: "Promo"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if link.ShortCode != "promo" {
+		t.Errorf("Expected alias stored as promo, got %s", link.ShortCode)
+	}
+	for _, code := range []string{"promo", "PROMO", "pRoMo"} {
+		if got, err := service.GetLongURL(ctx, code); err != nil || got != "https://www.example.com/promo" {
+			t.Errorf("Expected %s to resolve, got %q (%v)", code, got, err)
+		}
+	}
+	if _, _, err := service.Shorten(ctx, ShortenInput{LongURL: "https://www.example.com/otra", Alias: "PROMO"}); !errors.Is(err, ErrAliasTaken) {
+		t.Errorf("Expected alias taken regardless of case, got %v", err)
+	}
+
+	generated, _, err := service.Shorten(ctx, ShortenInput{LongURL: "https://www.example.com/generado"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if generated.ShortCode != "abc123" {
+		t.Errorf("Expected generated code in lowercase, got %s", generated.ShortCode)
+	}
+	if err := service.RecordClick(ctx, "ABC123", Click{}); err != nil {
+		t.Errorf("Expected click on uppercase code to be recorded, got %v", err)
+	}
+	if link, _ := service.GetLink(ctx, "abc123"); link.Clicks != 1 {
+		t.Errorf("Expected 1 click, got %d", link.Clicks)
+	}
+
+	// Un generador único deja de serlo al pasar sus códigos a minúsculas, así que se comprueban
+	service = NewService(NewStore(), WithCaseInsensitiveCodes(true), WithCodeGenerator(&uniqueStubGenerator{stubGenerator{codes: []string{"AbC123", "Libre"}}}))
+	service.store.SaveLink(ctx, Link{ShortCode: "abc123", LongURL: "https://www.example.com/antes"})
+	if code, err := service.generateUniqueShortCode(ctx, "", "", "https://www.example.com/despues"); err != nil || code != "libre" {
+		t.Errorf("Expected the folded collision to be skipped, got %q (%v)", code, err)
+	}
+
+	// Sin la opción los códigos distinguen mayúsculas
+	service = NewService(NewStore())
+	if _, _, err := service.Shorten(ctx, ShortenInput{LongURL: "https://www.example.com/promo", Alias: "Promo"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := service.GetLink(ctx, "promo"); !errors.Is(err, ErrURLNotFound) {
+		t.Errorf("Expected promo not found when codes are case-sensitive, got %v", err)
+	}
+}
+
+func TestService_UnicodeAliases(t *testing.T) {
+	ctx := context.Background()
+	emoji := strings.Repeat("🔥", MaxAliasLength)
+
+	tests := []struct {
+		name    string
+		alias   string
+		opts    []ServiceOption
+		wantErr bool
+	}{
+		{name: "Emoji y ASCII", alias: "🔥sale"},
+		{name: "Letras acentuadas", alias: "café"},
+		{name: "Secuencia de emoji con unión", alias: "👩‍💻dev"},
+		{name: "Otro alfabeto", alias: "東京駅"},
+		{name: "Máximo de caracteres aunque supere los bytes", alias: emoji},
+		{name: "Demasiados caracteres", alias: emoji + "🔥", wantErr: true},
+		{name: "Barra", alias: "🔥/sale", wantErr: true},
+		{name: "Porcentaje", alias: "sale%20", wantErr: true},
+		{name: "Espacio no ASCII", alias: "🔥\u00a0sale", wantErr: true},
+		{name: "Puntuación no ASCII", alias: "¿sale?", wantErr: true},
+		{name: "UTF-8 inválido", alias: "sale\xff", wantErr: true},
+		{name: "Sin la opción", alias: "🔥sale", opts: []ServiceOption{WithUnicodeAliases(false)}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := append([]ServiceOption{WithUnicodeAliases(true)}, tt.opts...)
+			service := NewService(NewStore(), opts...)
+			link, _, err := service.Shorten(ctx, ShortenInput{LongURL: "https://www.example.com/oferta", Alias: tt.alias})
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidAlias) {
+					t.Errorf("Expected ErrInvalidAlias, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if longURL, err := service.GetLongURL(ctx, link.ShortCode); err != nil || longURL != "https://www.example.com/oferta" {
+				t.Errorf("Expected alias %q to resolve, got %q (%v)", tt.alias, longURL, err)
+			}
+		})
+	}
+
+	// Las alternativas a un alias Unicode ocupado se recortan sin partir caracteres
+	service := NewService(NewStore(), WithUnicodeAliases(true))
+	if _, _, err := service.Shorten(ctx, ShortenInput{LongURL: "https://www.example.com/oferta", Alias: emoji}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	_, _, err := service.Shorten(ctx, ShortenInput{LongURL: "https://www.example.com/otra", Alias: emoji})
+	var aliasErr *AliasTakenError
+	if !errors.As(err, &aliasErr) || len(aliasErr.Suggestions) == 0 {
+		t.Fatalf("Expected suggestions for a taken Unicode alias, got %v", err)
+	}
+	if suggestion := aliasErr.Suggestions[0]; suggestion != strings.Repeat("🔥", MaxAliasLength-2)+"-2" {
+		t.Errorf("Expected suggestion truncated by characters, got %q", suggestion)
+	}
+}
+
+func TestService_InternationalizedDomains(t *testing.T) {
+	service := NewService(NewStore(), WithCustomDomains(map[string]string{"Ñandú.Example.com": "acme"}))
+
+	// Los navegadores envían el host en Punycode
+	domains := service.CustomDomains()
+	if len(domains) != 1 || domains[0].Host != "xn--and-6ma2c.example.com" {
+		t.Fatalf("Expected domain stored in Punycode, got %+v", domains)
+	}
+	for _, host := range []string{"xn--and-6ma2c.example.com:8080", "ñandú.example.com"} {
+		if key := service.ScopeCode(host, "promo"); key != "xn--and-6ma2c.example.com/promo" {
+			t.Errorf("Expected %s to resolve to the IDN domain, got %s", host, key)
+		}
+	}
+	// El parámetro domain de la API se normaliza igual que el host de la petición
+	for _, domain := range []string{"Ñandú.Example.com", "xn--and-6ma2c.example.com:443"} {
+		if key := DomainLinkKey(domain, "promo"); key != "xn--and-6ma2c.example.com/promo" {
+			t.Errorf("Expected domain %s to select the IDN domain, got %s", domain, key)
+		}
+	}
+
+	tests := []struct {
+		label    string
+		expected string
+	}{
+		{label: "bücher", expected: "bcher-kva"},
+		{label: "münchen", expected: "mnchen-3ya"},
+		{label: "☃", expected: "n3h"},
+		{label: "例え", expected: "r8jz45g"},
+	}
+	for _, tt := range tests {
+		if encoded := punycodeEncode(tt.label); encoded != tt.expected {
+			t.Errorf("Expected %s encoded as %s, got %s", tt.label, tt.expected, encoded)
+		}
+	}
+}
+
+// failingStore simula un backend remoto caído para las consultas de existencia
+type failingStore struct {
+	*Store
+}
+
+func (failingStore) Exists(ctx context.Context, shortCode string) (bool, error) {
+	return false, errors.New("conexión rechazada")
+}
+
+func TestService_ContextPropagation(t *testing.T) {
+	service := NewService(NewStore())
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := service.ShortenURL(canceled, "https://www.example.com"); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled when shortening, got %v", err)
+	}
+	if _, err := service.GetLongURL(canceled, "abc123"); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled when resolving, got %v", err)
+	}
+
+	expired, cancelTimeout := context.WithTimeout(context.Background(), -time.Second)
+	defer cancelTimeout()
+	if _, err := service.ListByOwner(expired, "", "alice"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected context.DeadlineExceeded when listing, got %v", err)
+	}
+
+	// Los fallos del backend que no son del contexto se reportan como servicio no disponible
+	broken := NewService(failingStore{NewStore()})
+	if _, err := broken.ShortenURL(context.Background(), "https://www.example.com"); !errors.Is(err, ErrServiceUnavailable) {
+		t.Errorf("Expected ErrServiceUnavailable, got %v", err)
+	}
+}
+
+func TestService_ShortenIdempotent(t *testing.T) {
+	ctx := context.Background()
+	service := NewService(NewStore())
+	input := ShortenInput{LongURL: "https://www.example.com/idem", Owner: "alice"}
+
+	first, created, err := service.ShortenIdempotent(ctx, "clave-1", input)
+	if err != nil || !created {
+		t.Fatalf("Expected link created, got %v (created=%v)", err, created)
+	}
+
+	tests := []struct {
+		name         string
+		key          string
+		input        ShortenInput
+		sameCode     bool
+		expectedErr  error
+		expectedSize int
+	}{
+		{name: "Reintento con la misma clave", key: "clave-1", input: input, sameCode: true, expectedSize: 1},
+		{name: "Misma clave con otra URL", key: "clave-1", input: ShortenInput{LongURL: "https://www.example.com/otra", Owner: "alice"}, expectedErr: ErrIdempotencyKeyReused, expectedSize: 1},
+		{name: "Misma clave de otro propietario", key: "clave-1", input: ShortenInput{LongURL: input.LongURL, Owner: "bob"}, expectedSize: 2},
+		{name: "Sin clave crea otro enlace", key: "", input: input, expectedSize: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			link, _, err := service.ShortenIdempotent(ctx, tt.key, tt.input)
+			if !errors.Is(err, tt.expectedErr) {
+				t.Fatalf("Expected error %v, got %v", tt.expectedErr, err)
+			}
+			if err == nil && (link.ShortCode == first.ShortCode) != tt.sameCode {
+				t.Errorf("Expected same code %v, got %s (original %s)", tt.sameCode, link.ShortCode, first.ShortCode)
+			}
+			if count, _ := service.store.Count(ctx); count != tt.expectedSize {
+				t.Errorf("Expected %d links stored, got %d", tt.expectedSize, count)
+			}
+		})
+	}
+
+	// Las claves expiradas se olvidan y el reintento crea un enlace nuevo
+	short := NewService(NewStore(), WithIdempotencyTTL(time.Millisecond))
+	original, _, _ := short.ShortenIdempotent(ctx, "clave-2", input)
+	time.Sleep(5 * time.Millisecond)
+	retried, created, err := short.ShortenIdempotent(ctx, "clave-2", input)
+	if err != nil || !created || retried.ShortCode == original.ShortCode {
+		t.Errorf("Expected a new link after key expiry, got %s (created=%v, err=%v)", retried.ShortCode, created, err)
+	}
+
+	// Peticiones concurrentes con la misma clave terminan con un único enlace
+	concurrent := NewService(NewStore())
+	var wg sync.WaitGroup
+	codes := make([]string, 20)
+	for i := range codes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			link, _, err := concurrent.ShortenIdempotent(ctx, "clave-3", input)
+			if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			codes[i] = link.ShortCode
+		}(i)
+	}
+	wg.Wait()
+	for _, code := range codes {
+		if code != codes[0] {
+			t.Fatalf("Expected a single code, got %v", codes)
+		}
+	}
+	if count, _ := concurrent.store.Count(ctx); count != 1 {
+		t.Errorf("Expected 1 link stored, got %d", count)
+	}
+}
+
+// validationFields retorna los campos de los ValidationError combinados en err
+func validationFields(err error) []string {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		var fields []string
+		for _, e := range joined.Unwrap() {
+			fields = append(fields, validationFields(e)...)
+		}
+		return fields
+	}
+	var validationErr *ValidationError
+	if errors.As(err, &validationErr) {
+		return []string{validationErr.Field}
+	}
+	return nil
+}
+
+func TestDeviceFromUserAgent(t *testing.T) {
+	tests := []struct {
+		name      string
+		userAgent string
+		expected  string
+	}{
+		{"iPhone", "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 Mobile/15E148", DeviceIOS},
+		{"iPad", "Mozilla/5.0 (iPad; CPU OS 16_6 like Mac OS X) AppleWebKit/605.1.15", DeviceIOS},
+		{"Android", "Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 Mobile Safari/537.36", DeviceAndroid},
+		{"Escritorio Windows", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 Chrome/120.0", DeviceDesktop},
+		{"Escritorio macOS", "Mozilla/5.0 (Macintosh; Intel Mac OS X 14_0) AppleWebKit/605.1.15 Safari/605.1.15", DeviceDesktop},
+		{"Otro móvil", "Mozilla/5.0 (Mobile; rv:48.0) Gecko/48.0 Firefox/48.0 KAIOS/2.5", ""},
+		{"Vacío", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if device := DeviceFromUserAgent(tt.userAgent); device != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, device)
+			}
+		})
+	}
+}
+
+func TestService_ResolveRedirect(t *testing.T) {
+	ctx := context.Background()
+	service := NewService(NewStore())
+
+	plain, _, _ := service.Shorten(ctx, ShortenInput{LongURL: "https://www.example.com/landing?ref=corto"})
+	forwarding, _, _ := service.Shorten(ctx, ShortenInput{LongURL: "https://www.example.com/landing?ref=corto", ForwardQuery: true})
+	noQuery, _, _ := service.Shorten(ctx, ShortenInput{LongURL: "https://www.example.com/", ForwardQuery: true})
+	utm, _, _ := service.Shorten(ctx, ShortenInput{
+		LongURL:      "https://www.example.com/?utm_source=viejo",
+		Alias:        "campania",
+		ForwardQuery: true,
+		UTM:          UTMParams{Source: "newsletter", Campaign: "{code}-{date}"},
+	})
+	rawQuery, _, _ := service.Shorten(ctx, ShortenInput{LongURL: "https://www.example.com/landing?z=1&flag&a=2", ForwardQuery: true})
+	rawUTM, _, _ := service.Shorten(ctx, ShortenInput{LongURL: "https://www.example.com/?z=1&flag&utm_source=viejo&a=2&utm_source=otro", UTM: UTMParams{Source: "news", Medium: "email"}})
+	today := time.Now().UTC().Format("2006-01-02")
+
+	tests := []struct {
+		name     string
+		code     string
+		req      RedirectRequest
+		expected string
+	}{
+		{name: "Sin reenvío de query", code: plain.ShortCode, req: RedirectRequest{Query: url.Values{"utm_source": {"news"}}}, expected: "https://www.example.com/landing?ref=corto"},
+		{name: "Reenvío combina parámetros", code: forwarding.ShortCode, req: RedirectRequest{Query: url.Values{"utm_source": {"news"}}}, expected: "https://www.example.com/landing?ref=corto&utm_source=news"},
+		{name: "El destino conserva sus parámetros", code: forwarding.ShortCode, req: RedirectRequest{Query: url.Values{"ref": {"otro"}}}, expected: "https://www.example.com/landing?ref=corto"},
+		{name: "Destino sin query", code: noQuery.ShortCode, req: RedirectRequest{Query: url.Values{"a": {"1", "2"}}}, expected: "https://www.example.com/?a=1&a=2"},
+		{name: "Visita sin query", code: forwarding.ShortCode, expected: "https://www.example.com/landing?ref=corto"},
+		{name: "Plantilla UTM", code: utm.ShortCode, req: RedirectRequest{Query: url.Values{"utm_source": {"visitante"}, "x": {"1"}}}, expected: "https://www.example.com/?utm_source=newsletter&utm_campaign=campania-" + today + "&x=1"},
+		{name: "Reenvío conserva la query del destino", code: rawQuery.ShortCode, req: RedirectRequest{Query: url.Values{"b": {"3"}, "flag": {"x"}}}, expected: "https://www.example.com/landing?z=1&flag&a=2&b=3"},
+		{name: "UTM conserva la query del destino", code: rawUTM.ShortCode, expected: "https://www.example.com/?z=1&flag&utm_source=news&a=2&utm_medium=email"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			redirect, err := service.ResolveRedirect(ctx, tt.code, tt.req)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if redirect.URL != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, redirect.URL)
+			}
+		})
+	}
+
+	// La opción global aplica a todos los enlaces
+	global := NewService(NewStore(), WithQueryForwarding(true))
+	link, _, _ := global.Shorten(ctx, ShortenInput{LongURL: "https://www.example.com/"})
+	if redirect, _ := global.ResolveRedirect(ctx, link.ShortCode, RedirectRequest{Query: url.Values{"utm_medium": {"email"}}}); redirect.URL != "https://www.example.com/?utm_medium=email" {
+		t.Errorf("Expected global query forwarding, got %s", redirect.URL)
+	}
+
+	_, _, err := service.Shorten(ctx, ShortenInput{LongURL: "https://www.example.com/", UTM: UTMParams{Medium: "{semana}"}})
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) || validationErr.Field != "utm.medium" {
+		t.Errorf("Expected validation error on utm.medium, got %v", err)
+	}
+
+	// Enlaces protegidos con contraseña: el hash no contiene la contraseña en claro
+	protected, _, err := service.Shorten(ctx, ShortenInput{LongURL: "https://www.example.com/privado", Password: "s3creta", ForwardQuery: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !protected.PasswordProtected() || strings.Contains(protected.PasswordHash, "s3creta") {
+		t.Fatalf("Expected hashed password, got %q", protected.PasswordHash)
+	}
+	passwordTests := []struct {
+		name        string
+		req         RedirectRequest
+		expected    string
+		expectedErr error
+	}{
+		{name: "Sin contraseña", expectedErr: ErrPasswordRequired},
+		{name: "Contraseña incorrecta", req: RedirectRequest{Password: "otra"}, expectedErr: ErrInvalidPassword},
+		{name: "Contraseña correcta sin reenviar key", req: RedirectRequest{Password: "s3creta", Query: url.Values{PasswordQueryParam: {"s3creta"}, "a": {"1"}}}, expected: "https://www.example.com/privado?a=1"},
+	}
+	for _, tt := range passwordTests {
+		t.Run(tt.name, func(t *testing.T) {
+			redirect, err := service.ResolveRedirect(ctx, protected.ShortCode, tt.req)
+			if !errors.Is(err, tt.expectedErr) || redirect.URL != tt.expected {
+				t.Errorf("Expected (%q, %v), got (%q, %v)", tt.expected, tt.expectedErr, redirect.URL, err)
+			}
+		})
+	}
+	// Tras MaxPasswordFailures contraseñas incorrectas el enlace rechaza incluso la correcta,
+	// sin derivarla, hasta que termina el bloqueo
+	for i := 0; i < MaxPasswordFailures; i++ {
+		if _, err := service.ResolveRedirect(ctx, protected.ShortCode, RedirectRequest{Password: "otra"}); !errors.Is(err, ErrInvalidPassword) {
+			t.Fatalf("Expected ErrInvalidPassword on attempt %d, got %v", i+1, err)
+		}
+	}
+	var locked *PasswordLockedError
+	if _, err := service.ResolveRedirect(ctx, protected.ShortCode, RedirectRequest{Password: "s3creta"}); !errors.As(err, &locked) || !errors.Is(err, ErrPasswordLocked) {
+		t.Fatalf("Expected PasswordLockedError, got %v", err)
+	}
+	if err := service.passwordFailures.check(protected.Key(), locked.Until); err != nil {
+		t.Errorf("Expected the lock to end at %v, got %v", locked.Until, err)
+	}
+	if _, err := service.ResolveRedirect(ctx, protected.ShortCode, RedirectRequest{Password: "s3creta"}); err != nil {
+		t.Errorf("Expected the correct password after the lock, got %v", err)
+	}
+	if _, _, err := service.Shorten(ctx, ShortenInput{LongURL: "https://www.example.com/", Password: "abc"}); !errors.As(err, &validationErr) || validationErr.Field != "password" {
+		t.Errorf("Expected validation error on password, got %v", err)
+	}
+
+	// Destinos por país con respaldo por región y destino por defecto
+	geoService := NewService(NewStore(), WithGeoResolver(geo.NewRangeResolver(map[netip.Prefix]string{
+		netip.MustParsePrefix("2.16.0.0/13"): "DE",
+		netip.MustParsePrefix("5.39.0.0/17"): "FR",
+		netip.MustParsePrefix("8.8.8.0/24"):  "US",
+	})))
+	geoLink, _, err := geoService.Shorten(ctx, ShortenInput{
+		LongURL:    "https://www.example.com/",
+		GeoTargets: map[string]string{"de": "https://www.example.de/", "EU": "https://www.example.eu/"},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	geoTests := []struct {
+		name     string
+		req      RedirectRequest
+		expected string
+	}{
+		{name: "País exacto", req: RedirectRequest{ClientIP: netip.MustParseAddr("2.16.1.1")}, expected: "https://www.example.de/"},
+		{name: "Región", req: RedirectRequest{ClientIP: netip.MustParseAddr("5.39.1.1")}, expected: "https://www.example.eu/"},
+		{name: "País sin destino", req: RedirectRequest{ClientIP: netip.MustParseAddr("8.8.8.8")}, expected: "https://www.example.com/"},
+		{name: "IP desconocida", req: RedirectRequest{ClientIP: netip.MustParseAddr("192.0.2.1")}, expected: "https://www.example.com/"},
+		{name: "País aportado por cabecera", req: RedirectRequest{ClientIP: netip.MustParseAddr("8.8.8.8"), Country: "it"}, expected: "https://www.example.eu/"},
+	}
+	for _, tt := range geoTests {
+		t.Run(tt.name, func(t *testing.T) {
+			if redirect, _ := geoService.ResolveRedirect(ctx, geoLink.ShortCode, tt.req); redirect.URL != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, redirect.URL)
+			}
+		})
+	}
+	// Sin GeoTargets solo se geolocaliza la visita si se pide el país para las estadísticas
+	plainLink, _, _ := geoService.Shorten(ctx, ShortenInput{LongURL: "https://www.example.com/sin-pais"})
+	visitor := netip.MustParseAddr("2.16.1.1")
+	if redirect, _ := geoService.ResolveRedirect(ctx, plainLink.ShortCode, RedirectRequest{ClientIP: visitor}); redirect.Country != "" {
+		t.Errorf("Expected no country without Locate, got %q", redirect.Country)
+	}
+	if redirect, _ := geoService.ResolveRedirect(ctx, plainLink.ShortCode, RedirectRequest{ClientIP: visitor, Locate: true}); redirect.Country != "DE" {
+		t.Errorf("Expected country DE with Locate, got %q", redirect.Country)
+	}
+	_, _, err = service.Shorten(ctx, ShortenInput{LongURL: "https://www.example.com/", GeoTargets: map[string]string{"Alemania": "https://www.example.de/", "FR": "ftp://example.fr"}})
+	if fields := fmt.Sprint(err); !strings.Contains(fields, "geo_targets.Alemania") || !errors.Is(err, ErrInvalidURL) {
+		t.Errorf("Expected validation errors on geo_targets, got %v", err)
+	}
+
+	// Destinos por dispositivo: tienen prioridad sobre los de país
+	appLink, _, err := geoService.Shorten(ctx, ShortenInput{
+		LongURL:       "https://www.example.com/app",
+		GeoTargets:    map[string]string{"DE": "https://www.example.de/app"},
+		DeviceTargets: map[string]string{"iOS": "itms-apps://apps.apple.com/app/id123", "android": "intent://abrir#Intent;scheme=ejemplo;package=com.example;end"},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	deviceTests := []struct {
+		name     string
+		req      RedirectRequest
+		expected string
+	}{
+		{name: "iPhone", req: RedirectRequest{UserAgent: "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) Mobile/15E148"}, expected: "itms-apps://apps.apple.com/app/id123"},
+		{name: "Android", req: RedirectRequest{UserAgent: "Mozilla/5.0 (Linux; Android 14; Pixel 8) Mobile Safari/537.36"}, expected: "intent://abrir#Intent;scheme=ejemplo;package=com.example;end"},
+		{name: "Escritorio sin destino propio", req: RedirectRequest{UserAgent: "Mozilla/5.0 (Windows NT 10.0; Win64; x64)"}, expected: "https://www.example.com/app"},
+		{name: "Escritorio en Alemania", req: RedirectRequest{UserAgent: "Mozilla/5.0 (X11; Linux x86_64)", Country: "DE"}, expected: "https://www.example.de/app"},
+		{name: "iPhone en Alemania", req: RedirectRequest{UserAgent: "Mozilla/5.0 (iPhone)", Country: "DE"}, expected: "itms-apps://apps.apple.com/app/id123"},
+	}
+	for _, tt := range deviceTests {
+		t.Run(tt.name, func(t *testing.T) {
+			if redirect, _ := geoService.ResolveRedirect(ctx, appLink.ShortCode, tt.req); redirect.URL != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, redirect.URL)
+			}
+		})
+	}
+	_, _, err = service.Shorten(ctx, ShortenInput{LongURL: "https://www.example.com/", DeviceTargets: map[string]string{"tablet": "https://www.example.com/t", "ios": "javascript:alert(1)", "android": "/relativa"}})
+	fields := strings.Join(validationFields(err), ",")
+	for _, field := range []string{"device_targets.tablet", "device_targets.ios", "device_targets.android"} {
+		if !strings.Contains(fields, field) {
+			t.Errorf("Expected validation error on %s, got %v", field, err)
+		}
+	}
+
+	// Pruebas A/B: la variante pausada solo la recibe quien ya la tenía asignada
+	abLink, _, err := service.Shorten(ctx, ShortenInput{
+		LongURL:        "https://www.example.com/",
+		Variants:       []Variant{{URL: "https://www.example.com/a", Weight: 1}, {Name: "nueva", URL: "https://www.example.com/b", Weight: 0}},
+		StickyVariants: true,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	variantTests := []struct {
+		name            string
+		req             RedirectRequest
+		expectedURL     string
+		expectedVariant string
+	}{
+		{name: "Reparto por peso", expectedURL: "https://www.example.com/a", expectedVariant: "a"},
+		{name: "Variante asignada", req: RedirectRequest{Variant: "nueva"}, expectedURL: "https://www.example.com/b", expectedVariant: "nueva"},
+		{name: "Variante desconocida", req: RedirectRequest{Variant: "vieja"}, expectedURL: "https://www.example.com/a", expectedVariant: "a"},
+	}
+	for _, tt := range variantTests {
+		t.Run(tt.name, func(t *testing.T) {
+			redirect, err := service.ResolveRedirect(ctx, abLink.ShortCode, tt.req)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if redirect.URL != tt.expectedURL || redirect.Variant != tt.expectedVariant || !redirect.Sticky {
+				t.Errorf("Expected %s (%s), got %+v", tt.expectedURL, tt.expectedVariant, redirect)
+			}
+			if err := service.RecordClick(ctx, abLink.ShortCode, Click{Variant: redirect.Variant}); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+		})
+	}
+	abLink, _ = service.GetLink(ctx, abLink.ShortCode)
+	if abLink.Clicks != 3 || abLink.Variants[0].Clicks != 2 || abLink.Variants[1].Clicks != 1 {
+		t.Errorf("Expected clicks 3 (a=2, nueva=1), got %d (%+v)", abLink.Clicks, abLink.Variants)
+	}
+	_, _, err = service.Shorten(ctx, ShortenInput{LongURL: "https://www.example.com/", Variants: []Variant{{Name: "x", URL: "https://www.example.com/x"}, {Name: "x", URL: "ftp://example.com", Weight: -1}}})
+	fields = strings.Join(validationFields(err), ",")
+	for _, field := range []string{"variants[1].name", "variants[1].weight", "variants[1].url"} {
+		if !strings.Contains(fields, field) {
+			t.Errorf("Expected validation error on %s, got %v", field, err)
+		}
+	}
+
+	// Página de aviso por enlace o por política de dominios de destino
+	warned := NewService(NewStore(), WithInterstitialDomains([]string{"externo.com"}))
+	interstitialTests := []struct {
+		name     string
+		input    ShortenInput
+		expected bool
+	}{
+		{name: "Sin aviso", input: ShortenInput{LongURL: "https://www.example.com/"}, expected: false},
+		{name: "Aviso por enlace", input: ShortenInput{LongURL: "https://www.example.com/", Interstitial: true}, expected: true},
+		{name: "Dominio con aviso", input: ShortenInput{LongURL: "https://externo.com/"}, expected: true},
+		{name: "Subdominio con aviso", input: ShortenInput{LongURL: "https://www.EXTERNO.com/x"}, expected: true},
+		{name: "Dominio parecido", input: ShortenInput{LongURL: "https://noexterno.com/"}, expected: false},
+	}
+	for _, tt := range interstitialTests {
+		t.Run(tt.name, func(t *testing.T) {
+			link, _, err := warned.Shorten(ctx, tt.input)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if redirect, _ := warned.ResolveRedirect(ctx, link.ShortCode, RedirectRequest{}); redirect.Interstitial != tt.expected {
+				t.Errorf("Expected interstitial %v, got %v", tt.expected, redirect.Interstitial)
+			}
+		})
+	}
+
+	if _, err := service.ResolveRedirect(ctx, "no-existe", RedirectRequest{}); !errors.Is(err, ErrURLNotFound) {
+		t.Errorf("Expected ErrURLNotFound, got %v", err)
+	}
+}
+
+func TestService_Cloak(t *testing.T) {
+	ctx := context.Background()
+	store := NewStore()
+	service := NewService(store, WithDeduplication(true))
+
+	plain, _, _ := service.Shorten(ctx, ShortenInput{LongURL: "https://www.example.com/"})
+	framed, created, err := service.Shorten(ctx, ShortenInput{LongURL: "https://www.example.com/",
+		Cloak: Cloak{Mode: CloakFrame, Title: "  Rebajas  "}})
+	if err != nil || !created || framed.ShortCode == plain.ShortCode {
+		t.Fatalf("Expected a new cloaked link instead of the deduplicated one, got %+v (%v)", framed, err)
+	}
+	if framed.Cloak.Title != "Rebajas" {
+		t.Errorf("Expected trimmed title, got %q", framed.Cloak.Title)
+	}
+	store.SaveLink(ctx, Link{ShortCode: "metadatos", LongURL: "https://www.example.com/post",
+		Cloak:    Cloak{Mode: CloakRefresh, Title: "Propio"},
+		Metadata: LinkMetadata{Title: "Del destino", Description: "Descripción del destino", Image: "https://www.example.com/og.png"}})
+
+	resolveTests := []struct {
+		name     string
+		code     string
+		expected Cloak
+	}{
+		{name: "Sin enmascaramiento", code: plain.ShortCode},
+		{name: "Frame", code: framed.ShortCode, expected: Cloak{Mode: CloakFrame, Title: "Rebajas"}},
+		{name: "Etiquetas vacías desde los metadatos", code: "metadatos",
+			expected: Cloak{Mode: CloakRefresh, Title: "Propio", Description: "Descripción del destino", Image: "https://www.example.com/og.png"}},
+	}
+	for _, tt := range resolveTests {
+		t.Run(tt.name, func(t *testing.T) {
+			redirect, err := service.ResolveRedirect(ctx, tt.code, RedirectRequest{})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if redirect.Cloak != tt.expected {
+				t.Errorf("Expected cloak %+v, got %+v", tt.expected, redirect.Cloak)
+			}
+		})
+	}
+
+	validationTests := []struct {
+		name          string
+		input         ShortenInput
+		expectedField string
+	}{
+		{name: "Modo desconocido", input: ShortenInput{Cloak: Cloak{Mode: "popup"}}, expectedField: "cloak.mode"},
+		{name: "Etiquetas sin modo", input: ShortenInput{Cloak: Cloak{Title: "Rebajas"}}, expectedField: "cloak.mode"},
+		{name: "Título demasiado largo", input: ShortenInput{Cloak: Cloak{Mode: CloakFrame, Title: strings.Repeat("a", MaxCloakTextLength+1)}},
+			expectedField: "cloak.title"},
+		{name: "Imagen relativa", input: ShortenInput{Cloak: Cloak{Mode: CloakRefresh, Image: "/og.png"}}, expectedField: "cloak.image"},
+		{name: "Con redirección permanente", input: ShortenInput{Cloak: Cloak{Mode: CloakFrame}, RedirectType: RedirectPermanent},
+			expectedField: "cloak.mode"},
+	}
+	for _, tt := range validationTests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.input.LongURL = "https://www.example.com/"
+			_, _, err := service.Shorten(ctx, tt.input)
+			var validationErr *ValidationError
+			if !errors.As(err, &validationErr) || validationErr.Field != tt.expectedField {
+				t.Errorf("Expected validation error on %s, got %v", tt.expectedField, err)
+			}
+		})
+	}
+}
+
+func TestService_ReferrerPolicy(t *testing.T) {
+	ctx := context.Background()
+	service := NewService(NewStore())
+
+	gated, _, err := service.Shorten(ctx, ShortenInput{LongURL: "https://www.example.com/campania",
+		Referrers: ReferrerPolicy{Domains: []string{"Newsletter.Example.com", "*.partner.example", "www.newsletter.example.com"}}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if expected := []string{"newsletter.example.com", "partner.example"}; !reflect.DeepEqual(gated.Referrers.Domains, expected) {
+		t.Errorf("Expected normalized domains %v, got %v", expected, gated.Referrers.Domains)
+	}
+	warned, _, err := service.Shorten(ctx, ShortenInput{LongURL: "https://www.example.com/campania",
+		Referrers: ReferrerPolicy{Domains: []string{"newsletter.example.com"}, Fallback: ReferrerInterstitial}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	resolveTests := []struct {
+		name                 string
+		code                 string
+		referrer             string
+		expectedErr          error
+		expectedInterstitial bool
+	}{
+		{name: "Desde el dominio permitido", code: gated.ShortCode, referrer: "newsletter.example.com"},
+		{name: "Desde un subdominio", code: gated.ShortCode, referrer: "mail.partner.example"},
+		{name: "Desde otro dominio", code: gated.ShortCode, referrer: "evil-newsletter.example.com", expectedErr: ErrReferrerNotAllowed},
+		{name: "Sin Referer", code: gated.ShortCode, expectedErr: ErrReferrerNotAllowed},
+		{name: "Otro dominio con aviso", code: warned.ShortCode, referrer: "social.example", expectedInterstitial: true},
+		{name: "Dominio permitido sin aviso", code: warned.ShortCode, referrer: "newsletter.example.com"},
+	}
+	for _, tt := range resolveTests {
+		t.Run(tt.name, func(t *testing.T) {
+			redirect, err := service.ResolveRedirect(ctx, tt.code, RedirectRequest{Referrer: tt.referrer})
+			if !errors.Is(err, tt.expectedErr) {
+				t.Fatalf("Expected error %v, got %v", tt.expectedErr, err)
+			}
+			if err == nil && (redirect.Interstitial != tt.expectedInterstitial || redirect.Cacheable) {
+				t.Errorf("Expected interstitial %v and no caching, got %+v", tt.expectedInterstitial, redirect)
+			}
+		})
+	}
+
+	validationTests := []struct {
+		name          string
+		input         ShortenInput
+		expectedField string
+	}{
+		{name: "Dominio con ruta", input: ShortenInput{Referrers: ReferrerPolicy{Domains: []string{"example.com/news"}}},
+			expectedField: "referrers.domains[0]"},
+		{name: "Fallback sin dominios", input: ShortenInput{Referrers: ReferrerPolicy{Fallback: ReferrerInterstitial}},
+			expectedField: "referrers.domains"},
+		{name: "Fallback desconocido", input: ShortenInput{Referrers: ReferrerPolicy{Domains: []string{"example.com"}, Fallback: "redirect"}},
+			expectedField: "referrers.fallback"},
+		{name: "Con redirección permanente", input: ShortenInput{Referrers: ReferrerPolicy{Domains: []string{"example.com"}},
+			RedirectType: RedirectPermanent}, expectedField: "referrers.domains"},
+	}
+	for _, tt := range validationTests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.input.LongURL = "https://www.example.com/"
+			_, _, err := service.Shorten(ctx, tt.input)
+			var validationErr *ValidationError
+			if !errors.As(err, &validationErr) || validationErr.Field != tt.expectedField {
+				t.Errorf("Expected validation error on %s, got %v", tt.expectedField, err)
+			}
+		})
+	}
+}
+
+func TestService_IPAccess(t *testing.T) {
+	ctx := context.Background()
+	service := NewService(NewStore(), WithIPAccess(IPAccessPolicy{Deny: []string{"203.0.113.0/24"}}))
+
+	internal, _, err := service.Shorten(ctx, ShortenInput{LongURL: "https://intranet.example.com/nominas",
+		IPAccess: IPAccessPolicy{Allow: []string{"10.1.2.3/16", "192.168.1.10", "fd00::/8"}, Deny: []string{"10.1.66.0/24"}}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if expected := []string{"10.1.0.0/16", "192.168.1.10/32", "fd00::/8"}; !reflect.DeepEqual(internal.IPAccess.Allow, expected) {
+		t.Errorf("Expected normalized rules %v, got %v", expected, internal.IPAccess.Allow)
+	}
+	public, _, err := service.Shorten(ctx, ShortenInput{LongURL: "https://www.example.com/"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	resolveTests := []struct {
+		name        string
+		code        string
+		ip          string
+		expectedErr error
+	}{
+		{name: "Desde la red permitida", code: internal.ShortCode, ip: "10.1.20.30"},
+		{name: "Desde una IP suelta permitida", code: internal.ShortCode, ip: "192.168.1.10"},
+		{name: "Desde IPv6 permitida", code: internal.ShortCode, ip: "fd12::1"},
+		{name: "IPv4 mapeada en IPv6", code: internal.ShortCode, ip: "::ffff:10.1.20.30"},
+		{name: "Desde fuera de la red", code: internal.ShortCode, ip: "198.51.100.7", expectedErr: ErrIPNotAllowed},
+		{name: "Red rechazada dentro de la permitida", code: internal.ShortCode, ip: "10.1.66.1", expectedErr: ErrIPNotAllowed},
+		{name: "IP desconocida con lista permitida", code: internal.ShortCode, expectedErr: ErrIPNotAllowed},
+		{name: "Enlace sin reglas", code: public.ShortCode, ip: "198.51.100.7"},
+		{name: "IP desconocida sin lista permitida", code: public.ShortCode},
+		{name: "Regla global", code: public.ShortCode, ip: "203.0.113.9", expectedErr: ErrIPNotAllowed},
+	}
+	for _, tt := range resolveTests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ip netip.Addr
+			if tt.ip != "" {
+				ip = netip.MustParseAddr(tt.ip)
+			}
+			redirect, err := service.ResolveRedirect(ctx, tt.code, RedirectRequest{ClientIP: ip})
+			if !errors.Is(err, tt.expectedErr) {
+				t.Fatalf("Expected error %v, got %v", tt.expectedErr, err)
+			}
+			if err == nil && tt.code == internal.ShortCode && redirect.Cacheable {
+				t.Errorf("Expected restricted link not to be cacheable")
+			}
+		})
+	}
+
+	validationTests := []struct {
+		name          string
+		input         ShortenInput
+		expectedField string
+	}{
+		{name: "Red sin prefijo válido", input: ShortenInput{IPAccess: IPAccessPolicy{Allow: []string{"10.0.0.0/33"}}},
+			expectedField: "ip_access.allow[0]"},
+		{name: "Host en lugar de IP", input: ShortenInput{IPAccess: IPAccessPolicy{Deny: []string{"10.0.0.0/8", "vpn.example.com"}}},
+			expectedField: "ip_access.deny[1]"},
+		{name: "Con redirección permanente", input: ShortenInput{IPAccess: IPAccessPolicy{Allow: []string{"10.0.0.0/8"}},
+			RedirectType: RedirectPermanent}, expectedField: "ip_access"},
+	}
+	for _, tt := range validationTests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.input.LongURL = "https://www.example.com/"
+			_, _, err := service.Shorten(ctx, tt.input)
+			var validationErr *ValidationError
+			if !errors.As(err, &validationErr) || validationErr.Field != tt.expectedField {
+				t.Errorf("Expected validation error on %s, got %v", tt.expectedField, err)
+			}
+		})
+	}
+}
+
+func TestService_SignedLinks(t *testing.T) {
+	ctx := context.Background()
+	secret := []byte("clave-de-firma")
+	service := NewService(NewStore(), WithURLSigning(secret))
+
+	link, _, err := service.Shorten(ctx, ShortenInput{LongURL: "https://www.example.com/informe", Owner: "alice",
+		Signed: true, ForwardQuery: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	plain, _, _ := service.Shorten(ctx, ShortenInput{LongURL: "https://www.example.com/", Owner: "alice"})
+
+	signed, err := service.SignLink(ctx, Actor{UserID: "alice"}, link.ShortCode, SignatureExpiry{TTL: time.Hour})
+	if err != nil {
+		t.Fatalf("Unexpected error signing: %v", err)
+	}
+	if signed.ExpiresAt.IsZero() || signed.Query.Get(SignatureExpiryQueryParam) == "" {
+		t.Fatalf("Expected expiring signature, got %+v", signed)
+	}
+
+	withParams := func(query url.Values, extra ...string) url.Values {
+		copied := url.Values{}
+		for key, values := range query {
+			copied[key] = values
+		}
+		for i := 0; i+1 < len(extra); i += 2 {
+			copied.Set(extra[i], extra[i+1])
+		}
+		return copied
+	}
+	expired := time.Now().Add(-time.Minute).Truncate(time.Second)
+	resolveTests := []struct {
+		name        string
+		query       url.Values
+		expectedErr error
+	}{
+		{name: "Firma emitida", query: withParams(signed.Query, "utm_source", "correo")},
+		{name: "Firma sin caducidad", query: url.Values{SignatureQueryParam: {SignURL(secret, link.Key(), time.Time{})}}},
+		{name: "Sin firma", query: url.Values{"utm_source": {"correo"}}, expectedErr: ErrSignatureRequired},
+		{name: "Firma de otra clave", query: url.Values{SignatureQueryParam: {SignURL([]byte("otra"), link.Key(), time.Time{})}},
+			expectedErr: ErrInvalidSignature},
+		{name: "Caducidad manipulada", query: withParams(signed.Query, SignatureExpiryQueryParam, "4102444800"), expectedErr: ErrInvalidSignature},
+		{name: "Caducidad no numérica", query: withParams(signed.Query, SignatureExpiryQueryParam, "mañana"), expectedErr: ErrInvalidSignature},
+		{name: "Firma caducada", query: url.Values{SignatureQueryParam: {SignURL(secret, link.Key(), expired)},
+			SignatureExpiryQueryParam: {strconv.FormatInt(expired.Unix(), 10)}}, expectedErr: ErrSignatureExpired},
+	}
+	for _, tt := range resolveTests {
+		t.Run(tt.name, func(t *testing.T) {
+			redirect, err := service.ResolveRedirect(ctx, link.ShortCode, RedirectRequest{Query: tt.query})
+			if !errors.Is(err, tt.expectedErr) {
+				t.Fatalf("Expected error %v, got %v", tt.expectedErr, err)
+			}
+			if err != nil {
+				return
+			}
+			if strings.Contains(redirect.URL, SignatureQueryParam+"=") || strings.Contains(redirect.URL, SignatureExpiryQueryParam+"=") || redirect.Cacheable {
+				t.Errorf("Expected signature stripped from a non-cacheable redirect, got %+v", redirect)
+			}
+		})
+	}
+
+	signTests := []struct {
+		name        string
+		service     *Service
+		actor       Actor
+		code        string
+		expiry      SignatureExpiry
+		expectedErr error
+		validation  bool
+	}{
+		{name: "Otro usuario", service: service, actor: Actor{UserID: "bob"}, code: link.ShortCode, expectedErr: ErrForbidden},
+		{name: "Enlace sin firma", service: service, actor: Actor{UserID: "alice"}, code: plain.ShortCode, validation: true},
+		{name: "Caducidad pasada", service: service, actor: Actor{UserID: "alice"}, code: link.ShortCode,
+			expiry: SignatureExpiry{ExpiresAt: expired}, expectedErr: ErrInvalidExpiry},
+		{name: "Servicio sin clave", service: NewService(NewStore()), actor: Actor{Admin: true}, code: link.ShortCode, expectedErr: ErrSigningDisabled},
+	}
+	for _, tt := range signTests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.service.SignLink(ctx, tt.actor, tt.code, tt.expiry)
+			if tt.validation {
+				if !errors.As(err, new(*ValidationError)) {
+					t.Errorf("Expected validation error, got %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.expectedErr) {
+				t.Errorf("Expected error %v, got %v", tt.expectedErr, err)
+			}
+		})
+	}
+
+	_, _, err = NewService(NewStore()).Shorten(ctx, ShortenInput{LongURL: "https://www.example.com/", Signed: true})
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) || validationErr.Field != "signed" {
+		t.Errorf("Expected validation error on signed without signing key, got %v", err)
+	}
+}
+
+func TestService_Transfer(t *testing.T) {
+	ctx := context.Background()
+	service := NewService(NewStore(), WithAPIKeys("clave-alice", "clave-bob"))
+	alice := Actor{UserID: "alice"}
+	bob := Actor{UserID: "bob"}
+
+	link, _, err := service.Shorten(ctx, ShortenInput{LongURL: "https://www.example.com/traspaso", Owner: "alice", APIKey: "clave-alice"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	requestTests := []struct {
+		name          string
+		actor         Actor
+		recipient     string
+		expectedErr   error
+		invalidFields []string
+	}{
+		{name: "Otro usuario", actor: bob, recipient: "bob", expectedErr: ErrForbidden},
+		{name: "Editor del espacio", actor: Actor{UserID: "alice", Workspace: "marketing"}, recipient: "bob", expectedErr: ErrForbidden},
+		{name: "Sin receptor", actor: alice, recipient: "  ", invalidFields: []string{"to"}},
+		{name: "A sí mismo", actor: alice, recipient: "alice", invalidFields: []string{"to"}},
+		{name: "Propietario", actor: alice, recipient: " bob "},
+		{name: "Administrador", actor: Actor{UserID: "root", Admin: true}, recipient: "bob"},
+	}
+	for _, tt := range requestTests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := service.RequestTransfer(ctx, tt.actor, link.ShortCode, tt.recipient)
+			if tt.invalidFields != nil {
+				if fields := validationFields(err); strings.Join(fields, ",") != strings.Join(tt.invalidFields, ",") {
+					t.Errorf("Expected invalid fields %v, got %v (err %v)", tt.invalidFields, fields, err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.expectedErr) {
+				t.Fatalf("Expected error %v, got %v", tt.expectedErr, err)
+			}
+			if err == nil && got.Owner != "alice" {
+				t.Errorf("Expected current owner alice, got %q", got.Owner)
+			}
+		})
+	}
+
+	// Cada oferta reemplaza a la anterior; solo sirve la última
+	offer, err := service.RequestTransfer(ctx, alice, link.ShortCode, "bob")
+	if err != nil || offer.PendingTransfer == "" {
+		t.Fatalf("Expected a pending transfer, got %q (%v)", offer.PendingTransfer, err)
+	}
+	transfer := Transfer{Link: link.Key(), From: "alice", Nonce: offer.PendingTransfer}
+	acceptTests := []struct {
+		name        string
+		actor       Actor
+		transfer    Transfer
+		expectedErr error
+	}{
+		{name: "Sin usuario", transfer: transfer, expectedErr: ErrForbidden},
+		{name: "Otro enlace", actor: bob, transfer: Transfer{Link: "otro", From: "alice", Nonce: transfer.Nonce}, expectedErr: ErrTransferInvalid},
+		{name: "Otro propietario", actor: bob, transfer: Transfer{Link: link.Key(), From: "carol", Nonce: transfer.Nonce}, expectedErr: ErrTransferInvalid},
+		{name: "Oferta reemplazada", actor: bob, transfer: Transfer{Link: link.Key(), From: "alice", Nonce: "anterior"}, expectedErr: ErrTransferInvalid},
+		{name: "Sin oferta", actor: bob, transfer: Transfer{Link: link.Key(), From: "alice"}, expectedErr: ErrTransferInvalid},
+	}
+	for _, tt := range acceptTests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := service.AcceptTransfer(ctx, tt.actor, link.ShortCode, tt.transfer, ""); !errors.Is(err, tt.expectedErr) {
+				t.Errorf("Expected error %v, got %v", tt.expectedErr, err)
+			}
+		})
+	}
+
+	moved, err := service.AcceptTransfer(ctx, bob, link.ShortCode, transfer, "clave-bob")
+	if err != nil {
+		t.Fatalf("Unexpected error accepting: %v", err)
+	}
+	if moved.Owner != "bob" || moved.Workspace != "" || moved.CollectionID != 0 || moved.APIKeyID != APIKeyID("clave-bob") {
+		t.Errorf("Expected link owned by bob under his API key, got %+v", moved)
+	}
+	if _, err := service.AcceptTransfer(ctx, bob, link.ShortCode, transfer, ""); !errors.Is(err, ErrTransferInvalid) {
+		t.Errorf("Expected a replayed confirmation to fail with ErrTransferInvalid, got %v", err)
+	}
+
+	page, err := service.AuditLog(ctx, Actor{UserID: "root", Admin: true}, AuditQuery{Action: AuditTransfer})
+	if err != nil {
+		t.Fatalf("Unexpected error querying audit log: %v", err)
+	}
+	if page.Total != 1 || page.Entries[0].Before.Owner != "alice" || page.Entries[0].After.Owner != "bob" {
+		t.Errorf("Expected one transfer entry from alice to bob, got %+v", page.Entries)
+	}
+
+	// Tras devolver el enlace a alice, la confirmación ya usada no se lo vuelve a dar a bob
+	back, _ := service.RequestTransfer(ctx, bob, link.ShortCode, "alice")
+	if _, err := service.AcceptTransfer(ctx, alice, link.ShortCode, Transfer{Link: link.Key(), From: "bob", Nonce: back.PendingTransfer}, ""); err != nil {
+		t.Fatalf("Unexpected error returning the link: %v", err)
+	}
+	if _, err := service.AcceptTransfer(ctx, bob, link.ShortCode, transfer, ""); !errors.Is(err, ErrTransferInvalid) {
+		t.Errorf("Expected the old confirmation to fail after the round trip, got %v", err)
+	}
+
+	// Una oferta retirada deja de servir; solo la retira quien puede ceder el enlace
+	withdrawn, _ := service.RequestTransfer(ctx, alice, link.ShortCode, "carol")
+	if err := service.CancelTransfer(ctx, bob, link.ShortCode); !errors.Is(err, ErrForbidden) {
+		t.Errorf("Expected ErrForbidden canceling another owner's transfer, got %v", err)
+	}
+	if err := service.CancelTransfer(ctx, alice, link.ShortCode); err != nil {
+		t.Fatalf("Unexpected error canceling: %v", err)
+	}
+	carol := Actor{UserID: "carol"}
+	if _, err := service.AcceptTransfer(ctx, carol, link.ShortCode, Transfer{Link: link.Key(), From: "alice", Nonce: withdrawn.PendingTransfer}, ""); !errors.Is(err, ErrTransferInvalid) {
+		t.Errorf("Expected a withdrawn transfer to fail with ErrTransferInvalid, got %v", err)
+	}
+}
+
+func TestService_BatchUpdate(t *testing.T) {
+	ctx := context.Background()
+	service := NewService(NewStore(), WithURLSigning([]byte("clave-de-firma")))
+	alice := Actor{UserID: "alice"}
+
+	var codes []string
+	for _, input := range []ShortenInput{
+		{LongURL: "https://www.example.com/a", Owner: "alice", Tags: []string{"q3"}},
+		{LongURL: "https://www.example.com/b", Owner: "alice", Signed: true},
+		{LongURL: "https://www.example.com/c", Owner: "bob"},
+	} {
+		link, _, err := service.Shorten(ctx, input)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		codes = append(codes, link.ShortCode)
+	}
+
+	// errValidation marca los elementos que deben fallar con un *ValidationError
+	errValidation := errors.New("validación")
+	permanent, temporary := RedirectPermanent, RedirectTemporary
+	tags := []string{"Q4", "black-friday"}
+	tests := []struct {
+		name          string
+		codes         []string
+		changes       LinkChanges
+		invalidFields []string
+		itemErrs      []error
+	}{
+		{name: "Sin cambios", codes: codes, invalidFields: []string{"changes"}},
+		{name: "Cambios inválidos", codes: codes, changes: LinkChanges{Tags: &[]string{"no válida"}, Expiry: &Extension{TTL: -time.Hour}},
+			invalidFields: []string{"tags", "ttl_seconds"}},
+		{name: "Etiquetas y plazo", codes: []string{codes[0], "no-existe", codes[2], codes[0]},
+			changes:  LinkChanges{Tags: &tags, Expiry: &Extension{TTL: time.Hour}},
+			itemErrs: []error{nil, ErrURLNotFound, ErrForbidden, errValidation}},
+		{name: "Permanente en enlace firmado", codes: codes[:2], changes: LinkChanges{RedirectType: &permanent},
+			itemErrs: []error{nil, errValidation}},
+		{name: "Vuelta a temporal", codes: codes[:1], changes: LinkChanges{RedirectType: &temporary}, itemErrs: []error{nil}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			links, errs, err := service.BatchUpdate(ctx, alice, tt.codes, tt.changes)
+			if tt.invalidFields != nil {
+				if fields := validationFields(err); strings.Join(fields, ",") != strings.Join(tt.invalidFields, ",") {
+					t.Errorf("Expected invalid fields %v, got %v (err %v)", tt.invalidFields, fields, err)
+				}
+				return
+			}
+			if err != nil || len(errs) != len(tt.itemErrs) {
+				t.Fatalf("Expected %d item results, got %d (err %v)", len(tt.itemErrs), len(errs), err)
+			}
+			for i, expected := range tt.itemErrs {
+				switch {
+				case expected == errValidation:
+					if !errors.As(errs[i], new(*ValidationError)) {
+						t.Errorf("Item %d: expected validation error, got %v", i, errs[i])
+					}
+				case !errors.Is(errs[i], expected):
+					t.Errorf("Item %d: expected error %v, got %v", i, expected, errs[i])
+				case expected == nil && links[i].ShortCode != tt.codes[i]:
+					t.Errorf("Item %d: expected updated link %s, got %+v", i, tt.codes[i], links[i])
+				}
+			}
+		})
+	}
+
+	link, _ := service.GetLink(ctx, codes[0])
+	if strings.Join(link.Tags, ",") != "black-friday,q4" || link.ExpiresAt.IsZero() || link.PermanentRedirect() {
+		t.Errorf("Expected tags, expiry and temporary redirect applied once, got %+v", link)
+	}
+	if signed, _ := service.GetLink(ctx, codes[1]); signed.PermanentRedirect() {
+		t.Errorf("Expected signed link to keep its temporary redirect, got %+v", signed)
+	}
+
+	errs := service.BatchDelete(ctx, alice, []string{codes[0], codes[2], codes[0]})
+	if errs[0] != nil || !errors.Is(errs[1], ErrForbidden) || !errors.As(errs[2], new(*ValidationError)) {
+		t.Fatalf("Expected own link deleted and the rest rejected, got %v", errs)
+	}
+	if deleted, _ := service.GetLink(ctx, codes[0]); !deleted.IsDisabled() {
+		t.Errorf("Expected owner deletion to disable the link, got %+v", deleted)
+	}
+}
+
+func TestService_RedirectType(t *testing.T) {
+	ctx := context.Background()
+	store := NewStore()
+	service := NewService(store, WithDeduplication(true))
+	expiresAt := time.Now().Add(time.Hour)
+	store.SaveLink(ctx, Link{ShortCode: "caduca", LongURL: "https://www.example.com/caduca", RedirectType: RedirectPermanent, ExpiresAt: expiresAt})
+
+	temporary, _, _ := service.Shorten(ctx, ShortenInput{LongURL: "https://www.example.com/"})
+	permanent, created, err := service.Shorten(ctx, ShortenInput{LongURL: "https://www.example.com/", RedirectType: RedirectPermanent})
+	if err != nil || !created || permanent.ShortCode == temporary.ShortCode || !permanent.PermanentRedirect() {
+		t.Fatalf("Expected a new permanent link instead of the deduplicated one, got %+v (%v)", permanent, err)
+	}
+	explicit, _, _ := service.Shorten(ctx, ShortenInput{LongURL: "https://www.example.com/otra", RedirectType: RedirectTemporary})
+	if explicit.RedirectType != "" {
+		t.Errorf("Expected the default redirect type to be stored empty, got %q", explicit.RedirectType)
+	}
+	dated, _, _ := service.Shorten(ctx, ShortenInput{LongURL: "https://www.example.com/campania", UTM: UTMParams{Campaign: "{date}"}})
+	variants, _, err := service.Shorten(ctx, ShortenInput{LongURL: "https://www.example.com/", RedirectType: RedirectPermanent,
+		Variants: []Variant{{Name: "a", URL: "https://www.example.com/a", Weight: 1}, {Name: "b", URL: "https://www.example.com/b", Weight: 1}}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	tomorrow := time.Now().UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
+
+	tests := []struct {
+		name      string
+		code      string
+		permanent bool
+		cacheable bool
+		until     time.Time
+	}{
+		{name: "Temporal por defecto", code: temporary.ShortCode, cacheable: true},
+		{name: "Permanente", code: permanent.ShortCode, permanent: true, cacheable: true},
+		{name: "Permanente con expiración", code: "caduca", permanent: true, cacheable: true, until: expiresAt},
+		{name: "UTM con fecha", code: dated.ShortCode, cacheable: true, until: tomorrow},
+		{name: "Variantes A/B", code: variants.ShortCode, permanent: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			redirect, err := service.ResolveRedirect(ctx, tt.code, RedirectRequest{})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if redirect.Permanent != tt.permanent || redirect.Cacheable != tt.cacheable || !redirect.ValidUntil.Equal(tt.until) {
+				t.Errorf("Expected permanent=%v cacheable=%v until %v, got %+v", tt.permanent, tt.cacheable, tt.until, redirect)
+			}
+		})
+	}
+
+	_, _, err = service.Shorten(ctx, ShortenInput{LongURL: "https://www.example.com/", RedirectType: "301"})
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) || validationErr.Field != "redirect_type" {
+		t.Errorf("Expected validation error on redirect_type, got %v", err)
+	}
+}
+
+func TestPBKDF2SHA256(t *testing.T) {
+	// Vector de prueba de RFC 7914, sección 11
+	key := pbkdf2SHA256([]byte("passwd"), []byte("salt"), 1, 64)
+	expected := "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc49ca9cccf179b645991664b39d77ef317c71b845b1e30bd509112041d3a19783"
+	if fmt.Sprintf("%x", key) != expected {
+		t.Errorf("Expected %s, got %x", expected, key)
+	}
+
+	hash, err := hashPassword("correcta")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !checkPassword(hash, "correcta") || checkPassword(hash, "incorrecta") || checkPassword("texto-plano", "texto-plano") {
+		t.Error("Unexpected password check result")
+	}
+}
+
+func TestService_ListLinks(t *testing.T) {
+	ctx := context.Background()
+	store := NewStore()
+	service := NewService(store)
+	base := time.Now().Add(-time.Hour)
+	for i, link := range []Link{
+		{ShortCode: "a1", LongURL: "https://example.com/1", Owner: "alice", Clicks: 5, Tags: []string{"newsletter"}},
+		{ShortCode: "a2", LongURL: "https://blog.example.com/2", Owner: "alice", Clicks: 1},
+		{ShortCode: "a3", LongURL: "https://otro.org/3", Owner: "alice", Clicks: 9, ExpiresAt: base, Tags: []string{"newsletter", "q3"}},
+		{ShortCode: "b1", LongURL: "https://example.com/b", Owner: "bob", Tags: []string{"newsletter"}},
+	} {
+		link.CreatedAt = base.Add(time.Duration(i) * time.Minute)
+		store.SaveLink(ctx, link)
+	}
+	alice := Actor{UserID: "alice"}
+
+	tests := []struct {
+		name          string
+		actor         Actor
+		query         ListQuery
+		expectedCodes string
+		expectedTotal int
+		expectedErr   error
+	}{
+		{name: "Propios por creación", actor: alice, query: ListQuery{AnyOwner: true}, expectedCodes: "a1,a2,a3", expectedTotal: 3},
+		{name: "Paginado", actor: alice, query: ListQuery{AnyOwner: true, Offset: 2, Limit: 2}, expectedCodes: "a3", expectedTotal: 3},
+		{name: "Página fuera de rango", actor: alice, query: ListQuery{AnyOwner: true, Offset: 10, Limit: 2}, expectedCodes: "", expectedTotal: 3},
+		{name: "Clics descendente", actor: alice, query: ListQuery{AnyOwner: true, Sort: "-clicks"}, expectedCodes: "a3,a1,a2", expectedTotal: 3},
+		{name: "Dominio con subdominios", actor: alice, query: ListQuery{AnyOwner: true, Domain: "Example.com"}, expectedCodes: "a1,a2", expectedTotal: 2},
+		{name: "Solo vigentes", actor: alice, query: ListQuery{AnyOwner: true, Status: ListStatusActive}, expectedCodes: "a1,a2", expectedTotal: 2},
+		{name: "Admin ve todos", actor: Actor{UserID: "root", Admin: true}, query: ListQuery{AnyOwner: true, Domain: "example.com", Sort: "short_code"}, expectedCodes: "a1,a2,b1", expectedTotal: 3},
+		{name: "Admin filtra por propietario", actor: Actor{UserID: "root", Admin: true}, query: ListQuery{Owner: "bob"}, expectedCodes: "b1", expectedTotal: 1},
+		{name: "Por etiqueta", actor: alice, query: ListQuery{AnyOwner: true, Tag: " Newsletter "}, expectedCodes: "a1,a3", expectedTotal: 2},
+		{name: "Por etiqueta y estado", actor: alice, query: ListQuery{AnyOwner: true, Tag: "newsletter", Status: ListStatusActive}, expectedCodes: "a1", expectedTotal: 1},
+		{name: "Admin por etiqueta", actor: Actor{UserID: "root", Admin: true}, query: ListQuery{AnyOwner: true, Tag: "newsletter", Sort: "short_code"}, expectedCodes: "a1,a3,b1", expectedTotal: 3},
+		{name: "Etiqueta sin enlaces", actor: alice, query: ListQuery{AnyOwner: true, Tag: "otra"}, expectedCodes: "", expectedTotal: 0},
+		{name: "Usuario no puede filtrar por otro", actor: alice, query: ListQuery{Owner: "bob"}, expectedErr: ErrForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := service.ListLinks(ctx, tt.actor, tt.query)
+			if !errors.Is(err, tt.expectedErr) {
+				t.Fatalf("Expected error %v, got %v", tt.expectedErr, err)
+			}
+			codes := make([]string, 0, len(page.Links))
+			for _, link := range page.Links {
+				codes = append(codes, link.ShortCode)
+			}
+			if strings.Join(codes, ",") != tt.expectedCodes || page.Total != tt.expectedTotal {
+				t.Errorf("Expected %q (total %d), got %q (total %d)", tt.expectedCodes, tt.expectedTotal, strings.Join(codes, ","), page.Total)
+			}
+		})
+	}
+
+	_, err := service.ListLinks(ctx, alice, ListQuery{AnyOwner: true, Sort: "popularidad", Limit: MaxListLimit + 1})
+	if fields := strings.Join(validationFields(err), ","); fields != "sort,per_page" {
+		t.Errorf("Expected validation errors on sort and per_page, got %v", err)
+	}
+	_, err = service.ListLinks(ctx, alice, ListQuery{AnyOwner: true, Tag: "con espacio"})
+	if fields := strings.Join(validationFields(err), ","); fields != "tags" {
+		t.Errorf("Expected validation error on tags, got %v", err)
+	}
+}
+
+func TestService_SetTags(t *testing.T) {
+	ctx := context.Background()
+	store := NewStore()
+	service := NewService(store)
+	alice := Actor{UserID: "alice"}
+
+	link, _, err := service.Shorten(ctx, ShortenInput{LongURL: "https://example.com/a", Owner: "alice", Tags: []string{"Q3-Campaign", "newsletter", "newsletter"}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if strings.Join(link.Tags, ",") != "newsletter,q3-campaign" {
+		t.Fatalf("Expected normalized tags, got %v", link.Tags)
+	}
+	code := link.ShortCode
+	// Con etiquetas no se reutiliza un enlace existente al deduplicar
+	if other, created, err := service.Shorten(ctx, ShortenInput{LongURL: link.LongURL, Owner: "alice", Tags: []string{"otra"}, Deduplicate: true}); err != nil || !created || other.ShortCode == code {
+		t.Fatalf("Expected a new link, got %+v (%v)", other, err)
+	}
+	if _, _, err := service.Shorten(ctx, ShortenInput{LongURL: link.LongURL, Owner: "alice", Tags: []string{"mal etiquetada"}}); strings.Join(validationFields(err), ",") != "tags" {
+		t.Errorf("Expected validation error on tags, got %v", err)
+	}
+
+	tests := []struct {
+		name         string
+		actor        Actor
+		tags         []string
+		expectedTags string
+		expectedErr  error
+		expectedVal  string
+	}{
+		{name: "Reemplaza", actor: alice, tags: []string{"ventas"}, expectedTags: "ventas"},
+		{name: "Otro usuario", actor: Actor{UserID: "bob"}, tags: []string{"x"}, expectedErr: ErrForbidden},
+		{name: "Caracteres inválidos", actor: alice, tags: []string{"con espacio", "ok"}, expectedVal: "tags"},
+		{name: "Demasiado larga", actor: alice, tags: []string{strings.Repeat("a", MaxTagLength+1)}, expectedVal: "tags"},
+		{name: "Demasiadas", actor: alice, tags: strings.Split("a,b,c,d,e,f,g,h,i,j,k", ","), expectedVal: "tags"},
+		{name: "Admin las elimina", actor: Actor{UserID: "root", Admin: true}, tags: []string{}, expectedTags: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			link, err := service.SetTags(ctx, tt.actor, code, tt.tags)
+			if tt.expectedVal != "" {
+				if fields := strings.Join(validationFields(err), ","); fields != tt.expectedVal {
+					t.Fatalf("Expected validation error on %s, got %v", tt.expectedVal, err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.expectedErr) {
+				t.Fatalf("Expected error %v, got %v", tt.expectedErr, err)
+			}
+			if err == nil && strings.Join(link.Tags, ",") != tt.expectedTags {
+				t.Errorf("Expected tags %q, got %v", tt.expectedTags, link.Tags)
+			}
+		})
+	}
+
+	// El índice de etiquetas sigue los cambios: la etiqueta reemplazada ya no lista el enlace
+	page, err := service.ListLinks(ctx, alice, ListQuery{AnyOwner: true, Tag: "q3-campaign"})
+	if err != nil || page.Total != 0 {
+		t.Errorf("Expected no links tagged q3-campaign, got %+v (%v)", page, err)
+	}
+	service.SetTags(ctx, alice, code, []string{"ventas"})
+	if page, _ := service.ListLinks(ctx, alice, ListQuery{AnyOwner: true, Tag: "ventas"}); page.Total != 1 {
+		t.Errorf("Expected 1 link tagged ventas, got %d", page.Total)
+	}
+	if err := service.DeleteURL(ctx, Actor{UserID: "root", Admin: true}, code); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, ok := store.tags[TenantKey("", "ventas")]; ok {
+		t.Errorf("Expected purged link to leave the tag index, got %v", store.tags)
+	}
+}
+
+func TestService_Collections(t *testing.T) {
+	ctx := context.Background()
+	store := NewStore()
+	service := NewService(store)
+	alice := Actor{UserID: "alice"}
+	bob := Actor{UserID: "bob"}
+	admin := Actor{UserID: "root", Admin: true}
+	for _, link := range []Link{
+		{ShortCode: "a1", LongURL: "https://example.com/1", Owner: "alice", Clicks: 3},
+		{ShortCode: "a2", LongURL: "https://example.com/2", Owner: "alice", Clicks: 4},
+		{ShortCode: "b1", LongURL: "https://example.com/b", Owner: "bob"},
+	} {
+		store.SaveLink(ctx, link)
+	}
+
+	otono, err := service.CreateCollection(ctx, alice, "", "  Campaña   de otoño ")
+	if err != nil || otono.ID == 0 || otono.Name != "Campaña de otoño" || otono.Owner != "alice" {
+		t.Fatalf("Unexpected collection %+v (%v)", otono, err)
+	}
+	ventas, _ := service.CreateCollection(ctx, alice, "", "Ventas")
+
+	// Creación y renombrado
+	if _, err := service.CreateCollection(ctx, alice, "", "ventas"); !errors.Is(err, ErrCollectionExists) {
+		t.Errorf("Expected ErrCollectionExists, got %v", err)
+	}
+	if _, err := service.CreateCollection(ctx, bob, "", "Ventas"); err != nil {
+		t.Errorf("Expected another owner to reuse the name, got %v", err)
+	}
+	if _, err := service.CreateCollection(ctx, alice, "", " "); strings.Join(validationFields(err), ",") != "name" || !errors.Is(err, ErrInvalidCollection) {
+		t.Errorf("Expected validation error on name, got %v", err)
+	}
+	if _, err := service.RenameCollection(ctx, alice, "", ventas.ID, "Campaña de otoño"); !errors.Is(err, ErrCollectionExists) {
+		t.Errorf("Expected ErrCollectionExists on rename, got %v", err)
+	}
+	if _, err := service.RenameCollection(ctx, bob, "", ventas.ID, "Mías"); !errors.Is(err, ErrCollectionNotFound) {
+		t.Errorf("Expected other users not to see the collection, got %v", err)
+	}
+	if renamed, err := service.RenameCollection(ctx, alice, "", ventas.ID, "Ventas Q3"); err != nil || renamed.Name != "Ventas Q3" {
+		t.Errorf("Unexpected rename result %+v (%v)", renamed, err)
+	}
+	if _, err := service.GetCollection(ctx, alice, "acme", otono.ID); !errors.Is(err, ErrCollectionNotFound) {
+		t.Errorf("Expected collections not to cross tenants, got %v", err)
+	}
+
+	// Movimiento de enlaces
+	errs, err := service.MoveLinks(ctx, alice, "", otono.ID, []string{"a1", "a2", "b1", "nada"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for i, expected := range []error{nil, nil, ErrForbidden, ErrURLNotFound} {
+		if !errors.Is(errs[i], expected) {
+			t.Errorf("Expected item %d error %v, got %v", i, expected, errs[i])
+		}
+	}
+	if _, err := service.MoveLinks(ctx, bob, "", otono.ID, []string{"b1"}); !errors.Is(err, ErrCollectionNotFound) {
+		t.Errorf("Expected ErrCollectionNotFound moving into another user's collection, got %v", err)
+	}
+	if errs, _ := service.MoveLinks(ctx, alice, "", ventas.ID, []string{"a2"}); errs[0] != nil {
+		t.Fatalf("Unexpected error: %v", errs[0])
+	}
+	// Sacar de otoño un enlace que ya está en ventas no lo cambia
+	service.RemoveLinks(ctx, alice, "", otono.ID, []string{"a2"})
+	if link, _ := service.GetLink(ctx, "a2"); link.CollectionID != ventas.ID {
+		t.Errorf("Expected a2 to stay in %d, got %d", ventas.ID, link.CollectionID)
+	}
+	page, _ := service.ListLinks(ctx, alice, ListQuery{AnyOwner: true, CollectionID: otono.ID})
+	if page.Total != 1 || page.Links[0].ShortCode != "a1" {
+		t.Errorf("Expected only a1 in the collection, got %+v", page.Links)
+	}
+
+	// Listado con totales
+	stats, err := service.ListCollections(ctx, alice, "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var summary []string
+	for _, s := range stats {
+		summary = append(summary, fmt.Sprintf("%s:%d:%d", s.Name, s.Links, s.Clicks))
+	}
+	if got := strings.Join(summary, ","); got != "Campaña de otoño:1:3,Ventas Q3:1:4" {
+		t.Errorf("Unexpected collections %q", got)
+	}
+	if stats, _ := service.ListCollections(ctx, admin, ""); len(stats) != 3 {
+		t.Errorf("Expected admin to see 3 collections, got %d", len(stats))
+	}
+
+	// Al eliminar la colección sus enlaces se conservan fuera de ella
+	if err := service.DeleteCollection(ctx, bob, "", otono.ID); !errors.Is(err, ErrCollectionNotFound) {
+		t.Errorf("Expected ErrCollectionNotFound, got %v", err)
+	}
+	if err := service.DeleteCollection(ctx, alice, "", otono.ID); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if link, found, _ := store.GetLink(ctx, "a1"); !found || link.CollectionID != 0 {
+		t.Errorf("Expected a1 to be kept without collection, got %+v", link)
+	}
+	if _, err := service.GetCollection(ctx, alice, "", otono.ID); !errors.Is(err, ErrCollectionNotFound) {
+		t.Errorf("Expected deleted collection to be gone, got %v", err)
+	}
+}
+
+func TestService_TagStatistics(t *testing.T) {
+	ctx := context.Background()
+	store := NewStore()
+	service := NewService(store)
+	for _, link := range []Link{
+		{ShortCode: "a1", LongURL: "https://example.com/1", Owner: "alice", Clicks: 5, Tags: []string{"newsletter"}},
+		{ShortCode: "a2", LongURL: "https://example.com/2", Owner: "alice", Clicks: 2, Tags: []string{"newsletter", "q3"}},
+		{ShortCode: "a3", LongURL: "https://example.com/3", Owner: "alice"},
+		{ShortCode: "b1", LongURL: "https://example.com/b", Owner: "bob", Clicks: 7, Tags: []string{"q3"}},
+		{ShortCode: "t1", LongURL: "https://example.com/t", Owner: "alice", Tenant: "acme", Clicks: 1, Tags: []string{"acme"}},
+	} {
+		store.SaveLink(ctx, link)
+	}
+
+	tests := []struct {
+		name     string
+		actor    Actor
+		expected []TagStats
+	}{
+		{name: "Usuario", actor: Actor{UserID: "alice"}, expected: []TagStats{
+			{Tag: "newsletter", Links: 2, Clicks: 7},
+			{Tag: "q3", Links: 1, Clicks: 2},
+		}},
+		{name: "Admin", actor: Actor{UserID: "root", Admin: true}, expected: []TagStats{
+			{Tag: "newsletter", Links: 2, Clicks: 7},
+			{Tag: "q3", Links: 2, Clicks: 9},
+		}},
+		{name: "Sin etiquetas", actor: Actor{UserID: "carol"}, expected: []TagStats{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stats, err := service.TagStatistics(ctx, tt.actor, "")
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(stats, tt.expected) {
+				t.Errorf("Expected %+v, got %+v", tt.expected, stats)
+			}
+		})
+	}
+}
+
+func TestService_SearchLinks(t *testing.T) {
+	ctx := context.Background()
+	store := NewStore()
+	service := NewService(store)
+	base := time.Now().Add(-time.Hour)
+	for i, link := range []Link{
+		{ShortCode: "promo", LongURL: "https://tienda.example.com/ofertas/verano", Owner: "alice"},
+		{ShortCode: "promo-otono", LongURL: "https://tienda.example.com/ofertas/otono", Owner: "alice"},
+		{ShortCode: "x1", LongURL: "https://blog.example.org/promo", Owner: "alice"},
+		{ShortCode: "x2", LongURL: "https://tienda.example.com/ofertas/verano", Owner: "bob"},
+		{ShortCode: "x3", LongURL: "https://tienda.example.com/", Owner: "alice", Description: "Campaña de Navidad",
+			CustomMetadata: json.RawMessage(`{"ticket":"OPS-4521"}`)},
+	} {
+		link.CreatedAt = base.Add(time.Duration(i) * time.Minute)
+		store.SaveLink(ctx, link)
+	}
+	alice := Actor{UserID: "alice"}
+	admin := Actor{UserID: "root", Admin: true}
+
+	tests := []struct {
+		name          string
+		actor         Actor
+		text          string
+		expectedCodes string
+	}{
+		{name: "Alias exacto primero", actor: alice, text: "promo", expectedCodes: "promo,promo-otono,x1"},
+		{name: "Varios términos", actor: alice, text: "TIENDA verano", expectedCodes: "promo"},
+		{name: "Término corto sin índice", actor: alice, text: "x1", expectedCodes: "x1"},
+		{name: "Sin coincidencias", actor: alice, text: "inexistente", expectedCodes: ""},
+		{name: "Admin busca en todos", actor: admin, text: "ofertas/verano", expectedCodes: "x2,promo"},
+		{name: "Por descripción", actor: alice, text: "navidad", expectedCodes: "x3"},
+		{name: "Por metadatos propios", actor: alice, text: "ops-4521 tienda", expectedCodes: "x3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := service.SearchLinks(ctx, tt.actor, SearchQuery{Text: tt.text, AnyOwner: true})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			codes := make([]string, 0, len(page.Links))
+			for _, link := range page.Links {
+				codes = append(codes, link.ShortCode)
+			}
+			if strings.Join(codes, ",") != tt.expectedCodes {
+				t.Errorf("Expected %q, got %q", tt.expectedCodes, strings.Join(codes, ","))
+			}
+		})
+	}
+
+	// El índice sigue a los cambios de destino y a las eliminaciones
+	if _, err := service.UpdateURL(ctx, alice, "x1", "https://blog.example.org/novedades"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	store.Delete(ctx, "promo")
+	if page, _ := service.SearchLinks(ctx, alice, SearchQuery{Text: "promo"}); page.Total != 1 || page.Links[0].ShortCode != "promo-otono" {
+		t.Errorf("Expected only promo-otono after update and delete, got %+v", page.Links)
+	}
+	if page, _ := service.SearchLinks(ctx, alice, SearchQuery{Text: "novedades"}); page.Total != 1 {
+		t.Errorf("Expected updated destination to be indexed, got %+v", page.Links)
+	}
+
+	if _, err := service.SearchLinks(ctx, alice, SearchQuery{Text: "  "}); !errors.As(err, new(*ValidationError)) {
+		t.Errorf("Expected validation error for empty query, got %v", err)
+	}
+}
+
+func TestService_UpdateDetails(t *testing.T) {
+	ctx := context.Background()
+	store := NewStore()
+	service := NewService(store)
+	alice := Actor{UserID: "alice"}
+
+	link, _, err := service.Shorten(ctx, ShortenInput{LongURL: "https://example.com/a", Owner: "alice",
+		Description: "Landing de otoño", CustomMetadata: json.RawMessage(`{ "ticket": "OPS-1", "prioridad": 2 }`)})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if link.Description != "Landing de otoño" || string(link.CustomMetadata) != `{"ticket":"OPS-1","prioridad":2}` {
+		t.Fatalf("Unexpected details %q %s", link.Description, link.CustomMetadata)
+	}
+	if _, _, err := service.Shorten(ctx, ShortenInput{LongURL: "https://example.com/b", CustomMetadata: json.RawMessage(`["no"]`)}); strings.Join(validationFields(err), ",") != "custom_metadata" {
+		t.Errorf("Expected validation error on custom_metadata, got %v", err)
+	}
+
+	description := "Landing de invierno"
+	tests := []struct {
+		name                string
+		actor               Actor
+		details             LinkDetails
+		expectedDescription string
+		expectedMetadata    string
+		expectedErr         error
+		expectedFields      string
+	}{
+		{name: "Solo descripción", actor: alice, details: LinkDetails{Description: &description},
+			expectedDescription: description, expectedMetadata: `{"ticket":"OPS-1","prioridad":2}`},
+		{name: "Solo metadatos", actor: alice, details: LinkDetails{CustomMetadata: json.RawMessage(`{"ticket":"OPS-2"}`)},
+			expectedDescription: description, expectedMetadata: `{"ticket":"OPS-2"}`},
+		{name: "Metadatos null los elimina", actor: alice, details: LinkDetails{CustomMetadata: json.RawMessage(`null`)},
+			expectedDescription: description},
+		{name: "Otro usuario", actor: Actor{UserID: "bob"}, details: LinkDetails{Description: &description}, expectedErr: ErrForbidden},
+		{name: "Inválidos", actor: alice, details: LinkDetails{
+			Description:    func() *string { d := strings.Repeat("x", MaxDescriptionLength+1); return &d }(),
+			CustomMetadata: json.RawMessage(`{"datos":"` + strings.Repeat("x", MaxCustomMetadataLength) + `"}`),
+		}, expectedFields: "description,custom_metadata"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			link, err := service.UpdateDetails(ctx, tt.actor, link.ShortCode, tt.details)
+			if tt.expectedFields != "" {
+				if fields := strings.Join(validationFields(err), ","); fields != tt.expectedFields {
+					t.Fatalf("Expected validation errors on %s, got %v", tt.expectedFields, err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.expectedErr) {
+				t.Fatalf("Expected error %v, got %v", tt.expectedErr, err)
+			}
+			if err == nil && (link.Description != tt.expectedDescription || string(link.CustomMetadata) != tt.expectedMetadata) {
+				t.Errorf("Expected %q %s, got %q %s", tt.expectedDescription, tt.expectedMetadata, link.Description, link.CustomMetadata)
+			}
+		})
+	}
+
+	// El índice de búsqueda sigue a los cambios de descripción
+	if page, _ := service.SearchLinks(ctx, alice, SearchQuery{Text: "invierno"}); page.Total != 1 {
+		t.Errorf("Expected updated description to be indexed, got %+v", page.Links)
+	}
+	if page, _ := service.SearchLinks(ctx, alice, SearchQuery{Text: "otoño"}); page.Total != 0 {
+		t.Errorf("Expected old description to leave the index, got %+v", page.Links)
+	}
+}
+
+// existsCountingStore cuenta las consultas de existencia que llegan al almacén
+type existsCountingStore struct {
+	*Store
+	exists int
+}
+
+func (s *existsCountingStore) Exists(ctx context.Context, shortCode string) (bool, error) {
+	s.exists++
+	return s.Store.Exists(ctx, shortCode)
+}
+
+func TestBloomFilter(t *testing.T) {
+	filter := NewBloomFilter(1000, 0.01)
+	for i := 0; i < 1000; i++ {
+		filter.Add(fmt.Sprintf("code%d", i))
+	}
+
+	// Sin falsos negativos
+	for i := 0; i < 1000; i++ {
+		if !filter.MayContain(fmt.Sprintf("code%d", i)) {
+			t.Fatalf("Expected code%d to be in the filter", i)
+		}
+	}
+
+	// Falsos positivos cercanos a la tasa configurada
+	falsePositives := 0
+	for i := 0; i < 10000; i++ {
+		if filter.MayContain(fmt.Sprintf("other%d", i)) {
+			falsePositives++
+		}
+	}
+	if falsePositives > 300 {
+		t.Errorf("Expected around 1%% false positives, got %d of 10000", falsePositives)
+	}
+}
+
+func TestService_BloomFilter(t *testing.T) {
+	ctx := context.Background()
+	store := &existsCountingStore{Store: NewStore()}
+	store.Save(ctx, "taken1", "https://www.example.com/")
+	generator := &stubGenerator{codes: []string{"taken1", "free01", "free02"}}
+	service := NewService(store, WithCodeGenerator(generator), WithBloomFilter(100, 0.01))
+
+	// Hasta cargarlo el filtro no se usa y cada intento consulta al almacén
+	if code, err := service.ShortenURL(ctx, "https://www.example.com/a"); err != nil || code != "free01" {
+		t.Fatalf("Expected free01, got %s (err %v)", code, err)
+	}
+	if store.exists != 2 {
+		t.Errorf("Expected 2 store lookups before loading, got %d", store.exists)
+	}
+
+	loaded, err := service.LoadBloomFilter(ctx)
+	if err != nil || loaded != 2 {
+		t.Fatalf("Expected 2 loaded codes, got %d (err %v)", loaded, err)
+	}
+
+	// Los códigos existentes se confirman en el almacén y los libres no lo consultan
+	store.exists, generator.calls = 0, 0
+	if code, err := service.ShortenURL(ctx, "https://www.example.com/b"); err != nil || code != "free02" {
+		t.Fatalf("Expected free02, got %s (err %v)", code, err)
+	}
+	if store.exists != 2 {
+		t.Errorf("Expected lookups only for taken1 and free01, got %d", store.exists)
+	}
+
+	// Los códigos creados después de cargarlo también se detectan
+	if !service.bloom.MayContain("free02") {
+		t.Errorf("Expected new code to be added to the filter")
+	}
+}
+
+func TestService_Events(t *testing.T) {
+	ctx := context.Background()
+	store := NewStore()
+	var events []Event
+	service := NewService(store, WithEventListener(EventListenerFunc(func(event Event) {
+		events = append(events, event)
+	})))
+	alice := Actor{UserID: "alice"}
+
+	link, _, err := service.Shorten(ctx, ShortenInput{LongURL: "https://www.example.com/eventos", Owner: "alice"})
+	if err != nil {
+		t.Fatalf("Error creating link: %v", err)
+	}
+	if err := service.RecordClick(ctx, link.ShortCode, Click{}); err != nil {
+		t.Fatalf("Unexpected error recording click: %v", err)
+	}
+	if _, err := service.DisableURL(ctx, alice, link.ShortCode, ""); err != nil {
+		t.Fatalf("Unexpected error disabling: %v", err)
+	}
+	// Desactivar de nuevo un enlace desactivado no es un evento
+	service.DisableURL(ctx, alice, link.ShortCode, "otro motivo")
+
+	store.SaveLink(ctx, Link{ShortCode: "caduca", LongURL: "https://www.example.com/caduca", ExpiresAt: time.Now()})
+	if notified, err := service.NotifyExpired(ctx); err != nil || notified != 1 {
+		t.Errorf("Expected 1 expiration notified, got %d (%v)", notified, err)
+	}
+	if notified, _ := service.NotifyExpired(ctx); notified != 0 {
+		t.Errorf("Expected expirations to be notified once, got %d", notified)
+	}
+
+	expected := []struct{ eventType, code string }{
+		{EventCreated, link.ShortCode},
+		{EventClicked, link.ShortCode},
+		{EventDisabled, link.ShortCode},
+		{EventExpired, "caduca"},
+	}
+	if len(events) != len(expected) {
+		t.Fatalf("Expected %d events, got %+v", len(expected), events)
+	}
+	for i, want := range expected {
+		if events[i].Type != want.eventType || events[i].Link.ShortCode != want.code {
+			t.Errorf("Event %d: expected %s for %s, got %s for %s", i, want.eventType, want.code, events[i].Type, events[i].Link.ShortCode)
+		}
+	}
+	if events[1].Link.Clicks != 1 {
+		t.Errorf("Expected clicked event to carry the updated counter, got %d", events[1].Link.Clicks)
+	}
+}
+
+func TestService_AnomalyDetection(t *testing.T) {
+	ctx := context.Background()
+	first := netip.MustParseAddr("203.0.113.7")
+	second := netip.MustParseAddr("198.51.100.9")
+
+	tests := []struct {
+		name   string
+		policy AnomalyPolicy
+		// visits son las IPs de las visitas, en orden
+		visits              []netip.Addr
+		expectedTypes       []string
+		expectedQuarantined bool
+		// blocked y allowed son IPs cuya siguiente visita se rechaza o se sirve
+		blocked []netip.Addr
+		allowed []netip.Addr
+	}{
+		{name: "Pico por enlace solo avisa", policy: AnomalyPolicy{LinkClicks: 3},
+			visits: []netip.Addr{first, second, first, second, first}, expectedTypes: []string{AnomalyLinkRate}, allowed: []netip.Addr{first}},
+		{name: "Pico por enlace limita el enlace", policy: AnomalyPolicy{LinkClicks: 3, Action: AnomalyThrottle},
+			visits: []netip.Addr{first, second, first, second}, expectedTypes: []string{AnomalyLinkRate}, blocked: []netip.Addr{first, second}},
+		{name: "Pico por IP limita la IP", policy: AnomalyPolicy{SourceClicks: 2, Action: AnomalyThrottle},
+			visits: []netip.Addr{first, second, first, first}, expectedTypes: []string{AnomalySourceRate},
+			blocked: []netip.Addr{first}, allowed: []netip.Addr{second}},
+		{name: "Pico por enlace pone en cuarentena", policy: AnomalyPolicy{LinkClicks: 2, Action: AnomalyQuarantine},
+			visits: []netip.Addr{first, second, first}, expectedTypes: []string{AnomalyLinkRate}, expectedQuarantined: true,
+			allowed: []netip.Addr{second}},
+		{name: "Tráfico normal", policy: AnomalyPolicy{LinkClicks: 10, SourceClicks: 5, Action: AnomalyThrottle},
+			visits: []netip.Addr{first, second, first}, allowed: []netip.Addr{first}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var alerts []Anomaly
+			var events []Event
+			tt.policy.OnAnomaly = func(anomaly Anomaly) { alerts = append(alerts, anomaly) }
+			store := NewStore()
+			service := NewService(store, WithAnomalyDetection(tt.policy), WithEventListener(EventListenerFunc(func(event Event) {
+				if event.Type == EventAnomaly {
+					events = append(events, event)
+				}
+			})))
+			store.SaveLink(ctx, Link{ShortCode: "viral", LongURL: "https://www.example.com/viral"})
+
+			var last Redirect
+			for i, ip := range tt.visits {
+				redirect, err := service.ResolveRedirect(ctx, "viral", RedirectRequest{ClientIP: ip})
+				if err != nil {
+					t.Fatalf("Unexpected error on visit %d: %v", i, err)
+				}
+				last = redirect
+			}
+
+			var types []string
+			for _, alert := range alerts {
+				types = append(types, alert.Type)
+			}
+			if !reflect.DeepEqual(types, tt.expectedTypes) {
+				t.Errorf("Expected anomalies %v, got %v", tt.expectedTypes, types)
+			}
+			if len(events) != len(alerts) {
+				t.Errorf("Expected one event per anomaly, got %d events for %d anomalies", len(events), len(alerts))
+			}
+			if last.Quarantined != tt.expectedQuarantined {
+				t.Errorf("Expected quarantined %v on the last visit, got %v", tt.expectedQuarantined, last.Quarantined)
+			}
+			for _, ip := range tt.blocked {
+				_, err := service.ResolveRedirect(ctx, "viral", RedirectRequest{ClientIP: ip})
+				var throttled *ThrottledError
+				if !errors.As(err, &throttled) || !errors.Is(err, ErrLinkThrottled) || !throttled.Until.After(time.Now()) {
+					t.Errorf("Expected visit from %s to be throttled, got %v", ip, err)
+				}
+			}
+			for _, ip := range tt.allowed {
+				if _, err := service.ResolveRedirect(ctx, "viral", RedirectRequest{ClientIP: ip}); err != nil {
+					t.Errorf("Expected visit from %s to be served, got %v", ip, err)
+				}
+			}
+		})
+	}
+}
+
+func TestAnomalyDetector_Spike(t *testing.T) {
+	detector := &anomalyDetector{
+		policy:           AnomalyPolicy{Window: time.Minute, SpikeFactor: 3, SpikeMinClicks: 5, SpikeAlpha: 0.5, Action: AnomalyAlert},
+		links:            make(map[string]*linkTraffic),
+		sources:          make(map[string]*windowCount),
+		throttledLinks:   make(map[string]time.Time),
+		throttledSources: make(map[string]time.Time),
+	}
+	start := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	visit := func(at time.Time, n int) []Anomaly {
+		var anomalies []Anomaly
+		for i := 0; i < n; i++ {
+			anomalies = append(anomalies, detector.observe("promo", "", at)...)
+		}
+		return anomalies
+	}
+
+	// Sin ventanas anteriores no hay media con la que comparar
+	if anomalies := visit(start, 4); len(anomalies) != 0 {
+		t.Errorf("Expected no spike without a baseline, got %+v", anomalies)
+	}
+	// Ventanas de 4 visitas: 12 o menos es tráfico normal
+	if anomalies := visit(start.Add(time.Minute), 4); len(anomalies) != 0 {
+		t.Errorf("Expected no spike at the baseline, got %+v", anomalies)
+	}
+	if anomalies := visit(start.Add(2*time.Minute), 12); len(anomalies) != 0 {
+		t.Errorf("Expected no spike up to three times the baseline, got %+v", anomalies)
+	}
+	// La media pasa a 8 y el pico llega con la visita 25, avisando una sola vez
+	anomalies := visit(start.Add(3*time.Minute), 30)
+	if len(anomalies) != 1 || anomalies[0].Type != AnomalyLinkSpike || anomalies[0].Clicks != 25 || anomalies[0].Baseline != 8 {
+		t.Fatalf("Expected one spike at click 25 over a baseline of 8, got %+v", anomalies)
+	}
+	// Tras varias ventanas vacías la media decae y vuelve a avisar con menos visitas
+	anomalies = visit(start.Add(10*time.Minute), 5)
+	if len(anomalies) != 1 || anomalies[0].Baseline >= 1 {
+		t.Errorf("Expected a spike over a decayed baseline, got %+v", anomalies)
+	}
+}
+
+func TestService_ExpiryNotice(t *testing.T) {
+	ctx := context.Background()
+	store := NewStore()
+	var events []Event
+	service := NewService(store, WithExpiryNotice(72*time.Hour), WithEventListener(EventListenerFunc(func(event Event) {
+		events = append(events, event)
+	})))
+	now := time.Now()
+
+	// Entra en el plazo de aviso ahora, queda fuera del plazo o ya expiró
+	store.SaveLink(ctx, Link{ShortCode: "aviso", LongURL: "https://www.example.com/aviso", ExpiresAt: now.Add(72 * time.Hour)})
+	store.SaveLink(ctx, Link{ShortCode: "lejos", LongURL: "https://www.example.com/lejos", ExpiresAt: now.Add(96 * time.Hour)})
+	store.SaveLink(ctx, Link{ShortCode: "caduca", LongURL: "https://www.example.com/caduca", ExpiresAt: now})
+	if notified, err := service.NotifyExpired(ctx); err != nil || notified != 2 {
+		t.Fatalf("Expected 2 notifications, got %d (%v)", notified, err)
+	}
+	if notified, _ := service.NotifyExpired(ctx); notified != 0 {
+		t.Errorf("Expected notices to be sent once, got %d", notified)
+	}
+
+	got := map[string]string{}
+	for _, event := range events {
+		got[event.Link.ShortCode] = event.Type
+	}
+	if len(got) != 2 || got["aviso"] != EventExpiring || got["caduca"] != EventExpired {
+		t.Errorf("Expected expiring notice for aviso and expiration for caduca, got %v", got)
+	}
+}
+
+func TestService_ExtendExpiry(t *testing.T) {
+	ctx := context.Background()
+	store := NewStore()
+	service := NewService(store)
+	alice := Actor{UserID: "alice"}
+	now := time.Now()
+
+	store.SaveLink(ctx, Link{ShortCode: "vigente", LongURL: "https://www.example.com/a", Owner: "alice", ExpiresAt: now.Add(time.Hour)})
+	store.SaveLink(ctx, Link{ShortCode: "caducado", LongURL: "https://www.example.com/b", Owner: "alice", ExpiresAt: now.Add(-time.Hour)})
+	store.SaveLink(ctx, Link{ShortCode: "eterno", LongURL: "https://www.example.com/c", Owner: "alice"})
+	date := now.Add(30 * 24 * time.Hour).Truncate(time.Second)
+
+	tests := []struct {
+		name        string
+		actor       Actor
+		code        string
+		extension   Extension
+		expectedMin time.Time
+		expectedMax time.Time
+		expectedErr error
+	}{
+		{name: "Plazo sumado a la expiración", actor: alice, code: "vigente", extension: Extension{TTL: 24 * time.Hour},
+			expectedMin: now.Add(25 * time.Hour), expectedMax: now.Add(25 * time.Hour)},
+		{name: "Plazo desde ahora si ya expiró", actor: alice, code: "caducado", extension: Extension{TTL: 24 * time.Hour},
+			expectedMin: now.Add(24 * time.Hour), expectedMax: time.Now().Add(24 * time.Hour).Add(time.Second)},
+		{name: "Fecha concreta", actor: alice, code: "eterno", extension: Extension{ExpiresAt: date},
+			expectedMin: date, expectedMax: date},
+		{name: "Otro usuario", actor: Actor{UserID: "bob"}, code: "vigente", extension: Extension{TTL: time.Hour}, expectedErr: ErrForbidden},
+		{name: "Inexistente", actor: alice, code: "nada", extension: Extension{TTL: time.Hour}, expectedErr: ErrURLNotFound},
+		{name: "Sin fecha ni plazo", actor: alice, code: "vigente", expectedErr: ErrInvalidExpiry},
+		{name: "Fecha y plazo", actor: alice, code: "vigente", extension: Extension{ExpiresAt: date, TTL: time.Hour}, expectedErr: ErrInvalidExpiry},
+		{name: "Fecha pasada", actor: alice, code: "vigente", extension: Extension{ExpiresAt: now.Add(-time.Minute)}, expectedErr: ErrInvalidExpiry},
+		{name: "Plazo negativo", actor: alice, code: "vigente", extension: Extension{TTL: -time.Hour}, expectedErr: ErrInvalidExpiry},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			link, err := service.ExtendExpiry(ctx, tt.actor, tt.code, tt.extension)
+			if !errors.Is(err, tt.expectedErr) {
+				t.Fatalf("Expected error %v, got %v", tt.expectedErr, err)
+			}
+			if err == nil && (link.ExpiresAt.Before(tt.expectedMin) || link.ExpiresAt.After(tt.expectedMax)) {
+				t.Errorf("Expected expiry between %v and %v, got %v", tt.expectedMin, tt.expectedMax, link.ExpiresAt)
+			}
+		})
+	}
+
+	// El enlace renovado vuelve a redirigir
+	if _, err := service.GetLongURL(ctx, "caducado"); err != nil {
+		t.Errorf("Expected extended link to resolve, got %v", err)
+	}
+}
+
+func TestEventBroker(t *testing.T) {
+	broker := NewEventBroker()
+	all, cancelAll := broker.Subscribe(EventFilter{}, 0)
+	defer cancelAll()
+	alice, cancelAlice := broker.Subscribe(EventFilter{Owner: "alice", Types: []string{EventClicked}}, 0)
+	defer cancelAlice()
+	slow, cancelSlow := broker.Subscribe(EventFilter{ShortCode: "uno"}, 1)
+
+	broker.HandleEvent(Event{Type: EventCreated, Link: Link{ShortCode: "uno", Owner: "alice"}})
+	broker.HandleEvent(Event{Type: EventClicked, Link: Link{ShortCode: "uno", Owner: "alice"}})
+	broker.HandleEvent(Event{Type: EventClicked, Link: Link{ShortCode: "dos", Owner: "bob"}})
+
+	tests := []struct {
+		name     string
+		events   <-chan Event
+		expected int
+	}{
+		{name: "Sin filtro", events: all, expected: 3},
+		{name: "Por propietario y tipo", events: alice, expected: 1},
+		// El buffer de una posición descarta la segunda visita de uno
+		{name: "Suscriptor lento", events: slow, expected: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := len(tt.events); got != tt.expected {
+				t.Errorf("Expected %d events, got %d", tt.expected, got)
+			}
+		})
+	}
+	if broker.Dropped() != 1 {
+		t.Errorf("Expected 1 dropped event, got %d", broker.Dropped())
+	}
+
+	cancelSlow()
+	cancelSlow()
+	if _, open := <-slow; !open {
+		t.Errorf("Expected buffered event to be readable after cancel")
+	}
+	if broker.Subscribers() != 2 {
+		t.Errorf("Expected 2 subscribers after cancel, got %d", broker.Subscribers())
+	}
+}
+
+func TestService_UsageQuotas(t *testing.T) {
+	ctx := context.Background()
+	service := NewService(NewStore(), WithAPIKeys("clave"), WithUsageQuotas(UsageLimits{Shortens: 2, Redirects: 1},
+		map[string]UsageLimits{"socio": {Shortens: 3}}))
+	now := time.Date(2026, time.October, 31, 23, 0, 0, 0, time.UTC)
+	service.usage.now = func() time.Time { return now }
+
+	// Los enlaces fallidos no consumen cuota y sin clave no se mide nada
+	if _, _, err := service.Shorten(ctx, ShortenInput{LongURL: "no-es-url", APIKey: "clave"}); err == nil {
+		t.Fatal("Expected validation error")
+	}
+	first, _, err := service.Shorten(ctx, ShortenInput{LongURL: "https://www.example.com/1", APIKey: "clave"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if first.APIKeyID != APIKeyID("clave") || len(first.APIKeyID) != 16 {
+		t.Errorf("Expected link attributed to the key, got %q", first.APIKeyID)
+	}
+	service.Shorten(ctx, ShortenInput{LongURL: "https://www.example.com/2", APIKey: "clave"})
+	var quotaErr *UsageQuotaError
+	if _, _, err := service.Shorten(ctx, ShortenInput{LongURL: "https://www.example.com/3", APIKey: "clave"}); !errors.As(err, &quotaErr) ||
+		quotaErr.Usage != UsageShortens || !quotaErr.ResetAt.Equal(time.Date(2026, time.November, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("Expected shorten quota error until November, got %v", err)
+	}
+	if _, _, err := service.Shorten(ctx, ShortenInput{LongURL: "https://www.example.com/3"}); err != nil {
+		t.Errorf("Expected anonymous shorten without quota, got %v", err)
+	}
+
+	// Una clave no configurada se trata como anónima: ni consume cuota ni crea contadores
+	for i := 0; i < 3; i++ {
+		invented := fmt.Sprintf("inventada-%d", i)
+		unknown, _, err := service.Shorten(ctx, ShortenInput{LongURL: "https://www.example.com/anonimo", APIKey: invented})
+		if err != nil || unknown.APIKeyID != "" {
+			t.Fatalf("Expected an unattributed link for an unknown key, got %q (%v)", unknown.APIKeyID, err)
+		}
+	}
+	if counted := len(service.usage.counts); counted != 1 {
+		t.Errorf("Expected counters only for the configured key, got %d", counted)
+	}
+
+	// Las cuotas propias de una clave reemplazan a las generales; cero no limita
+	for i := 0; i < 3; i++ {
+		if _, _, err := service.Shorten(ctx, ShortenInput{LongURL: fmt.Sprintf("https://www.example.com/socio/%d", i), APIKey: "socio"}); err != nil {
+			t.Fatalf("Unexpected error for partner link %d: %v", i, err)
+		}
+	}
+
+	// Las redirecciones se atribuyen a la clave con la que se creó el enlace
+	if _, err := service.ResolveRedirect(ctx, first.ShortCode, RedirectRequest{}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := service.ResolveRedirect(ctx, first.ShortCode, RedirectRequest{}); !errors.Is(err, ErrUsageQuotaExceeded) {
+		t.Errorf("Expected ErrUsageQuotaExceeded, got %v", err)
+	}
+	usage := service.KeyUsage(APIKeyID("clave"))
+	if usage.Period != "2026-10" || usage.Shortens != 2 || usage.Redirects != 1 || usage.Limits.Shortens != 2 {
+		t.Errorf("Unexpected usage: %+v", usage)
+	}
+
+	// El consumo empieza de cero cada mes
+	now = now.Add(2 * time.Hour)
+	if _, err := service.ResolveRedirect(ctx, first.ShortCode, RedirectRequest{}); err != nil {
+		t.Errorf("Expected redirect in the new month, got %v", err)
+	}
+	if usage := service.KeyUsage(APIKeyID("clave")); usage.Period != "2026-11" || usage.Shortens != 0 || usage.Redirects != 1 {
+		t.Errorf("Unexpected usage in the new month: %+v", usage)
+	}
+}
+
+func TestService_KnownAPIKey(t *testing.T) {
+	service := NewService(NewStore(), WithAPIKeys("integrador"), WithTenants(map[string]string{"clave-acme": "acme"}, nil),
+		WithUsageQuotas(UsageLimits{}, map[string]UsageLimits{"socio": {Shortens: 3}}))
+
+	tests := []struct {
+		name     string
+		apiKey   string
+		expected bool
+	}{
+		{name: "Registrada", apiKey: "integrador", expected: true},
+		{name: "De un tenant", apiKey: "clave-acme", expected: true},
+		{name: "Con cuotas propias", apiKey: "socio", expected: true},
+		{name: "Inventada", apiKey: "cualquiera"},
+		{name: "Vacía"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := service.KnownAPIKey(tt.apiKey); got != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestVisitorSketch(t *testing.T) {
+	tests := []struct {
+		name      string
+		visitors  int
+		tolerance float64
+	}{
+		{name: "Sin visitantes", visitors: 0},
+		{name: "Un visitante", visitors: 1},
+		{name: "Pocos visitantes", visitors: 50, tolerance: 0.02},
+		{name: "Muchos visitantes", visitors: 100000, tolerance: 0.05},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sketch VisitorSketch
+			// Con una sal fija el resultado no depende del azar
+			hasher := newVisitorHasher()
+			hasher.random = strings.NewReader(strings.Repeat("sal", 11))
+			for i := 0; i < tt.visitors; i++ {
+				visitor := fmt.Sprintf("visitante-%d", i)
+				// Las visitas repetidas no cambian la estimación
+				sketch = sketch.With(hasher.hash(visitor)).With(hasher.hash(visitor))
+			}
+			got := float64(sketch.Estimate())
+			if diff := math.Abs(got - float64(tt.visitors)); diff > tt.tolerance*float64(tt.visitors) {
+				t.Errorf("Expected about %d visitors, got %v", tt.visitors, got)
+			}
+		})
+	}
+
+	// Agregar un hash no modifica el sketch compartido con los lectores
+	shared := VisitorSketch(nil).With(1 << 63)
+	before := append(VisitorSketch(nil), shared...)
+	shared.With(1)
+	if !bytes.Equal(shared, before) {
+		t.Errorf("Expected With to copy the sketch before changing it")
+	}
+}
+
+func TestService_UniqueVisitors(t *testing.T) {
+	ctx := context.Background()
+	service := NewService(NewStore())
+	link, _, _ := service.Shorten(ctx, ShortenInput{LongURL: "https://www.example.com/"})
+
+	day := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	service.visitors.now = func() time.Time { return day }
+	service.visitors.random = strings.NewReader(strings.Repeat("sal", 22))
+	for _, visitor := range []string{"a", "b", "a", "", "c", "b"} {
+		if err := service.RecordClick(ctx, link.ShortCode, Click{Visitor: visitor}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	got, _ := service.GetLink(ctx, link.ShortCode)
+	if got.Clicks != 6 || got.UniqueVisitors() != 3 {
+		t.Errorf("Expected 6 clicks from 3 visitors, got %d from %d", got.Clicks, got.UniqueVisitors())
+	}
+
+	// Con la sal del día siguiente el mismo visitante no se puede relacionar y cuenta de nuevo
+	day = day.Add(VisitorSaltPeriod)
+	service.RecordClick(ctx, link.ShortCode, Click{Visitor: "a"})
+	if got, _ := service.GetLink(ctx, link.ShortCode); got.UniqueVisitors() != 4 {
+		t.Errorf("Expected the rotated salt to count the visitor again, got %d", got.UniqueVisitors())
+	}
+}
+
+func TestService_IsBot(t *testing.T) {
+	service := NewService(NewStore(), WithBotPatterns([]string{" Monitor-Interno ", ""}))
+	tests := []struct {
+		name      string
+		userAgent string
+		expected  bool
+	}{
+		{name: "Navegador de escritorio", userAgent: "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:121.0) Gecko/20100101 Firefox/121.0"},
+		{name: "Navegador móvil", userAgent: "Mozilla/5.0 (iPhone; CPU iPhone OS 17_2 like Mac OS X) AppleWebKit/605.1.15 Mobile/15E148 Safari/604.1"},
+		{name: "Buscador", userAgent: "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)", expected: true},
+		{name: "Vista previa de red social", userAgent: "facebookexternalhit/1.1", expected: true},
+		{name: "Mensajería", userAgent: "WhatsApp/2.23.20.0", expected: true},
+		{name: "Cliente de línea de comandos", userAgent: "curl/8.4.0", expected: true},
+		{name: "Rastreador desconocido", userAgent: "NuevoCrawler/0.1", expected: true},
+		{name: "Patrón configurado", userAgent: "monitor-interno/2.0", expected: true},
+		{name: "Sin User-Agent", userAgent: "", expected: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := service.IsBot(tt.userAgent); got != tt.expected {
+				t.Errorf("Expected IsBot(%q) = %v, got %v", tt.userAgent, tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestService_BotTraffic(t *testing.T) {
+	ctx := context.Background()
+	const browser = "Mozilla/5.0 (X11; Linux x86_64; rv:121.0) Gecko/20100101 Firefox/121.0"
+	variants := []Variant{{Name: "a", URL: "https://www.example.com/a", Weight: 1}, {Name: "b", URL: "https://www.example.com/b", Weight: 1}}
+
+	tests := []struct {
+		name            string
+		exclude         bool
+		expectedVariant bool
+		expectedUsage   int64
+	}{
+		{name: "Bots como cualquier visita", expectedVariant: true, expectedUsage: 2},
+		{name: "Bots excluidos", exclude: true, expectedUsage: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := NewService(NewStore(), WithBotExclusion(tt.exclude), WithAPIKeys("clave"),
+				WithUsageQuotas(UsageLimits{Redirects: 10}, nil))
+			link, _, err := service.Shorten(ctx, ShortenInput{LongURL: "https://www.example.com/", Variants: variants, APIKey: "clave",
+				Tags: []string{"ventas"}})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			human, err := service.ResolveRedirect(ctx, link.ShortCode, RedirectRequest{UserAgent: browser})
+			if err != nil || human.Bot || human.Variant == "" {
+				t.Fatalf("Expected a human visit with a variant, got %+v (%v)", human, err)
+			}
+			bot, err := service.ResolveRedirect(ctx, link.ShortCode, RedirectRequest{UserAgent: "Googlebot/2.1"})
+			if err != nil || !bot.Bot {
+				t.Fatalf("Expected a bot visit, got %+v (%v)", bot, err)
+			}
+			if got := bot.Variant != ""; got != tt.expectedVariant {
+				t.Errorf("Expected variant assigned to bots = %v, got %+v", tt.expectedVariant, bot)
+			}
+			if !tt.expectedVariant && bot.URL != link.LongURL {
+				t.Errorf("Expected excluded bots to get the default destination, got %s", bot.URL)
+			}
+			if usage := service.KeyUsage(APIKeyID("clave")); usage.Redirects != tt.expectedUsage {
+				t.Errorf("Expected %d redirects charged, got %d", tt.expectedUsage, usage.Redirects)
+			}
+
+			// Las visitas de bots se cuentan aparte y no como visitantes
+			service.RecordClick(ctx, link.ShortCode, Click{Variant: human.Variant, Visitor: "persona"})
+			service.RecordClick(ctx, link.ShortCode, Click{Variant: bot.Variant, Visitor: "rastreador", Bot: true})
+			got, _ := service.GetLink(ctx, link.ShortCode)
+			if got.Clicks != 2 || got.BotClicks != 1 || got.HumanClicks() != 1 || got.UniqueVisitors() != 1 {
+				t.Errorf("Expected 2 clicks with 1 from bots and 1 visitor, got %d/%d/%d", got.Clicks, got.BotClicks, got.UniqueVisitors())
+			}
+			stats, _ := service.TagStatistics(ctx, Actor{UserID: "root", Admin: true}, "")
+			if len(stats) != 1 || stats[0].Clicks != 2 || stats[0].BotClicks != 1 {
+				t.Errorf("Expected tag stats with 1 bot click, got %+v", stats)
+			}
+		})
+	}
+}
+
+func TestService_UserData(t *testing.T) {
+	ctx := context.Background()
+	store := NewStore()
+	service := NewService(store)
+	alice, bob, admin := Actor{UserID: "alice"}, Actor{UserID: "bob"}, Actor{UserID: "root", Admin: true}
+
+	own, _, _ := service.Shorten(ctx, ShortenInput{LongURL: "https://www.example.com/alice", Owner: "alice"})
+	disabled, _, _ := service.Shorten(ctx, ShortenInput{LongURL: "https://www.example.com/alice-2", Owner: "alice"})
+	other, _, _ := service.Shorten(ctx, ShortenInput{LongURL: "https://www.example.com/bob", Owner: "bob"})
+	// Las acciones de otros sobre sus enlaces también son suyas
+	service.DisableURL(ctx, admin, disabled.ShortCode, "Revisión")
+	collection, err := service.CreateCollection(ctx, alice, "", "Campaña")
+	if err != nil {
+		t.Fatalf("Unexpected error creating collection: %v", err)
+	}
+	// Un enlace ajeno dentro de su colección
+	other.CollectionID = collection.ID
+	store.SaveLink(ctx, other)
+
+	tests := []struct {
+		name        string
+		actor       Actor
+		expectedErr error
+	}{
+		{name: "Propio usuario", actor: alice},
+		{name: "Administrador", actor: admin},
+		{name: "Otro usuario", actor: bob, expectedErr: ErrForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := service.ExportUserData(ctx, tt.actor, "alice")
+			if !errors.Is(err, tt.expectedErr) {
+				t.Fatalf("Expected %v, got %v", tt.expectedErr, err)
+			}
+			if tt.expectedErr != nil {
+				return
+			}
+			if len(data.Links) != 2 || len(data.Collections) != 1 || len(data.Audit) != 3 {
+				t.Errorf("Expected 2 links, 1 collection and 3 audit entries, got %d, %d and %d",
+					len(data.Links), len(data.Collections), len(data.Audit))
+			}
+		})
+	}
+
+	deleted, err := service.DeleteUserData(ctx, alice, "alice")
+	if err != nil || len(deleted.Links) != 2 || len(deleted.Audit) != 3 {
+		t.Fatalf("Expected the exported data to be deleted, got %+v (%v)", deleted, err)
+	}
+	for _, code := range []string{own.ShortCode, disabled.ShortCode} {
+		if _, found, _ := store.GetLink(ctx, code); found {
+			t.Errorf("Expected %s to be purged", code)
+		}
+	}
+	if _, err := service.GetCollection(ctx, admin, "", collection.ID); !errors.Is(err, ErrCollectionNotFound) {
+		t.Errorf("Expected the collection to be deleted, got %v", err)
+	}
+	if link, err := service.GetLink(ctx, other.ShortCode); err != nil || link.CollectionID != 0 {
+		t.Errorf("Expected the other user's link to be kept outside the collection, got %+v (%v)", link, err)
+	}
+
+	page, _ := service.AuditLog(ctx, admin, AuditQuery{})
+	if page.Total != 1 || page.Entries[0].ShortCode != other.ShortCode {
+		t.Fatalf("Expected only bob's audit entry to remain, got %+v", page.Entries)
+	}
+	// Los IDs purgados no se reutilizan
+	service.Shorten(ctx, ShortenInput{LongURL: "https://www.example.com/bob-2", Owner: "bob"})
+	if page, _ := service.AuditLog(ctx, admin, AuditQuery{}); page.Entries[0].ID != 5 {
+		t.Errorf("Expected the next audit ID to be 5, got %d", page.Entries[0].ID)
+	}
+}
+
+func TestService_GetStats(t *testing.T) {
+	ctx := context.Background()
+	store := NewStore()
+	service := NewService(store)
+	admin := Actor{UserID: "root", Admin: true}
+
+	active, _, _ := service.Shorten(ctx, ShortenInput{LongURL: "https://www.example.com/active"})
+	disabled, _, _ := service.Shorten(ctx, ShortenInput{LongURL: "https://www.example.com/disabled"})
+	service.DisableURL(ctx, admin, disabled.ShortCode, "Revisión")
+	store.SaveLink(ctx, Link{ShortCode: "expired", LongURL: "https://www.example.com/expired", ExpiresAt: time.Now().Add(-time.Hour)})
+	// Un enlace desactivado y expirado cuenta solo como desactivado
+	store.SaveLink(ctx, Link{ShortCode: "both", LongURL: "https://www.example.com/both", ExpiresAt: time.Now().Add(-time.Hour), DisabledAt: time.Now()})
+	for i := 0; i < 3; i++ {
+		if err := service.RecordClick(ctx, active.ShortCode, Click{}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	stats, err := service.GetStats(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if stats.Store.Memory == nil || stats.Store.Memory.Links != 4 {
+		t.Errorf("Expected the memory usage of 4 links, got %+v", stats.Store.Memory)
+	}
+	stats.Store.Memory = nil
+	expected := Stats{TotalLinks: 4, ActiveLinks: 1, ExpiredLinks: 1, DisabledLinks: 2, ClicksToday: 3,
+		Store: StoreStats{Backend: BackendMemory, Links: 4}, Collisions: CollisionStats{Generated: 2}}
+	if stats != expected {
+		t.Errorf("Expected %+v, got %+v", expected, stats)
+	}
+
+	// La cuenta de visitas se reinicia al cambiar de día
+	var clicks dailyClicks
+	today := time.Date(2024, 1, 2, 23, 59, 0, 0, time.UTC)
+	clicks.add(today)
+	clicks.add(today)
+	if count := clicks.today(today); count != 2 {
+		t.Errorf("Expected 2 clicks today, got %d", count)
+	}
+	if count := clicks.today(today.Add(time.Minute)); count != 0 {
+		t.Errorf("Expected no clicks on the next day, got %d", count)
+	}
+	clicks.add(today.Add(time.Minute))
+	if count := clicks.today(today.Add(time.Minute)); count != 1 {
+		t.Errorf("Expected the count to restart, got %d", count)
+	}
+}
+
+func TestStore_Compaction(t *testing.T) {
+	ctx := context.Background()
+	// Los impares tienen etiquetas y los pares están en el índice de deduplicación
+	link := func(i int) Link {
+		l := Link{ShortCode: fmt.Sprintf("c%03d", i), LongURL: fmt.Sprintf("https://www.example.com/%d", i), Owner: "alice"}
+		if i%2 == 1 {
+			l.Tags = []string{"promo"}
+		}
+		return l
+	}
+	store := NewStore()
+	empty, _ := store.MemoryUsage()
+	for i := 0; i < 100; i++ {
+		store.SaveLink(ctx, link(i))
+	}
+	full, _ := store.MemoryUsage()
+	if full.Bytes <= empty.Bytes || full.Links != 100 || full.PeakLinks != 100 || full.ReclaimableBytes != 0 {
+		t.Fatalf("Unexpected usage after saving: %+v", full)
+	}
+	for i := 0; i < 90; i++ {
+		store.Delete(ctx, link(i).ShortCode)
+	}
+	deleted, _ := store.MemoryUsage()
+	if deleted.Links != 10 || deleted.PeakLinks != 100 || deleted.ReclaimableBytes == 0 || deleted.Reclaimable() != 0.9 {
+		t.Fatalf("Expected the deleted slots to be reclaimable, got %+v", deleted)
+	}
+
+	result, err := store.Compact(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Before != deleted || result.After.Bytes >= deleted.Bytes || result.After.ReclaimableBytes != 0 ||
+		result.After.PeakLinks != 10 || result.After.CompactedAt.IsZero() {
+		t.Errorf("Unexpected compaction result %+v", result)
+	}
+
+	// La estimación tras compactar coincide con la de un almacén que solo tuvo esos enlaces
+	fresh := NewStore()
+	for i := 90; i < 100; i++ {
+		fresh.SaveLink(ctx, link(i))
+	}
+	if expected, _ := fresh.MemoryUsage(); result.After.Bytes != expected.Bytes {
+		t.Errorf("Expected %d bytes after compacting, got %d", expected.Bytes, result.After.Bytes)
+	}
+
+	// Los índices siguen respondiendo tras reconstruirlos
+	if _, exists, _ := store.FindByURL(ctx, "alice", "https://www.example.com/96"); !exists {
+		t.Errorf("Expected to find the link by URL after compacting")
+	}
+	if page, _ := store.Search(ctx, SearchQuery{Text: "example", Owner: "alice", Limit: 20}); page.Total != 10 {
+		t.Errorf("Expected 10 search results after compacting, got %d", page.Total)
+	}
+	store.SaveLink(ctx, link(0))
+	if usage, _ := store.MemoryUsage(); usage.Links != 11 || usage.PeakLinks != 11 {
+		t.Errorf("Expected the store to keep tracking after compacting, got %+v", usage)
+	}
+}
+
+func TestService_CompactStore(t *testing.T) {
+	ctx := context.Background()
+	service := NewService(NewStore())
+	admin := Actor{UserID: "root", Admin: true}
+	var codes []string
+	for i := 0; i < 4; i++ {
+		link, _, err := service.Shorten(ctx, ShortenInput{LongURL: fmt.Sprintf("https://www.example.com/%d", i)})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		codes = append(codes, link.ShortCode)
+	}
+	service.DeleteURL(ctx, admin, codes[0])
+
+	tests := []struct {
+		name              string
+		threshold         float64
+		expectedCompacted bool
+	}{
+		{name: "Por debajo del umbral", threshold: 0.5, expectedCompacted: false},
+		{name: "Alcanza el umbral", threshold: 0.25, expectedCompacted: true},
+		{name: "Recién compactado", threshold: 0.25, expectedCompacted: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, compacted, err := service.CompactIfNeeded(ctx, tt.threshold)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if compacted != tt.expectedCompacted {
+				t.Errorf("Expected compacted=%v, got %v", tt.expectedCompacted, compacted)
+			}
+		})
+	}
+
+	if _, err := service.CompactStore(ctx, Actor{UserID: "alice"}); !errors.Is(err, ErrForbidden) {
+		t.Errorf("Expected ErrForbidden for a non-admin, got %v", err)
+	}
+	if _, err := service.CompactStore(ctx, admin); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	stats, _ := service.StoreStats(ctx)
+	if stats.Memory == nil || stats.Memory.Links != 3 || stats.Memory.CompactedAt.IsZero() {
+		t.Errorf("Expected the store stats to include the memory usage, got %+v", stats.Memory)
 	}
 }
@@ -0,0 +1,149 @@
+package shortener
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/url"
+	"strconv"
+	"time"
+
+	"acortador-urls/internal/errcode"
+)
+
+// Parámetros de la URL corta con la firma de los enlaces firmados; nunca se reenvían al destino
+const (
+	// SignatureQueryParam es la firma HMAC-SHA256 en base64url sin relleno
+	SignatureQueryParam = "sig"
+	// SignatureExpiryQueryParam es la caducidad de la firma en segundos Unix; si falta, la
+	// firma no caduca
+	SignatureExpiryQueryParam = "exp"
+)
+
+var (
+	// ErrSignatureRequired indica que el enlace solo redirige con una URL firmada
+	ErrSignatureRequired = errcode.New(errcode.SignatureRequired, "firma requerida")
+	// ErrInvalidSignature indica que la firma no corresponde al enlace y la caducidad
+	ErrInvalidSignature = errcode.New(errcode.InvalidSignature, "firma inválida")
+	// ErrSignatureExpired indica que la firma es válida pero ya caducó
+	ErrSignatureExpired = errcode.New(errcode.SignatureExpired, "firma caducada")
+	// ErrSigningDisabled indica que el servicio no tiene clave para firmar URLs
+	ErrSigningDisabled = errcode.New(errcode.SigningDisabled, "firma de URLs desactivada")
+)
+
+// WithURLSigning configura la clave con la que se firman y comprueban las URLs de los enlaces
+// firmados (Link.Signed). Los integradores que la conocen pueden firmar URLs por su cuenta con
+// SignURL sin llamar a la API.
+func WithURLSigning(secret []byte) ServiceOption {
+	return func(s *Service) {
+		if len(secret) > 0 {
+			s.signingKey = secret
+		}
+	}
+}
+
+// SignURL calcula la firma de la clave de un enlace (Link.Key: el código, precedido de
+// "dominio/" o "@tenant/" si corresponde) con caducidad expiresAt; cero no caduca. El mensaje
+// firmado es "clave:exp", con exp vacío si no caduca.
+func SignURL(secret []byte, key string, expiresAt time.Time) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(key + ":" + signatureExpiry(expiresAt)))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// signatureExpiry es el valor de exp para una caducidad; vacío si no caduca
+func signatureExpiry(expiresAt time.Time) string {
+	if expiresAt.IsZero() {
+		return ""
+	}
+	return strconv.FormatInt(expiresAt.Unix(), 10)
+}
+
+// SignatureExpiry es la caducidad pedida para una URL firmada: TTL desde ahora o ExpiresAt, pero
+// no ambos. Sin ninguno la firma no caduca.
+type SignatureExpiry struct {
+	TTL       time.Duration
+	ExpiresAt time.Time
+}
+
+// SignedURL es una firma emitida para un enlace
+type SignedURL struct {
+	Link Link
+	// Query son los parámetros que se agregan a la URL corta (sig y, si caduca, exp)
+	Query url.Values
+	// ExpiresAt es la caducidad de la firma; cero si no caduca
+	ExpiresAt time.Time
+}
+
+// SignLink emite una firma para compartir un enlace firmado durante un tiempo limitado. Solo el
+// propietario, los editores de su espacio o un admin pueden pedirla.
+func (s *Service) SignLink(ctx context.Context, actor Actor, shortCode string, expiry SignatureExpiry) (SignedURL, error) {
+	if s.signingKey == nil {
+		return SignedURL{}, ErrSigningDisabled
+	}
+	now := time.Now()
+	switch {
+	case !expiry.ExpiresAt.IsZero() && expiry.TTL != 0:
+		return SignedURL{}, &ValidationError{Field: "expires_at", Err: ErrInvalidExpiry,
+			Msg: "se puede indicar expires_at o ttl_seconds, pero no ambos"}
+	case expiry.TTL < 0:
+		return SignedURL{}, &ValidationError{Field: "ttl_seconds", Value: expiry.TTL.Seconds(), Err: ErrInvalidExpiry,
+			Msg: "debe ser positivo"}
+	case !expiry.ExpiresAt.IsZero() && !expiry.ExpiresAt.After(now):
+		return SignedURL{}, &ValidationError{Field: "expires_at", Value: expiry.ExpiresAt, Err: ErrInvalidExpiry,
+			Msg: "debe estar en el futuro"}
+	}
+
+	link, err := s.GetLink(ctx, shortCode)
+	if err != nil {
+		return SignedURL{}, err
+	}
+	if !actor.canManage(link) {
+		return SignedURL{}, ErrForbidden
+	}
+	if !link.Signed {
+		return SignedURL{}, &ValidationError{Field: "signed", Value: false, Msg: "el enlace no exige URLs firmadas"}
+	}
+
+	expiresAt := expiry.ExpiresAt
+	if expiry.TTL > 0 {
+		expiresAt = now.Add(expiry.TTL)
+	}
+	// La caducidad viaja en segundos, así que se descartan las fracciones para que coincida
+	expiresAt = expiresAt.Truncate(time.Second)
+	query := url.Values{SignatureQueryParam: {SignURL(s.signingKey, link.Key(), expiresAt)}}
+	if !expiresAt.IsZero() {
+		query.Set(SignatureExpiryQueryParam, signatureExpiry(expiresAt))
+	}
+	return SignedURL{Link: link, Query: query, ExpiresAt: expiresAt}, nil
+}
+
+// checkSignature comprueba la firma de una visita a un enlace firmado. La firma se compara antes
+// que la caducidad para no revelar si una exp manipulada habría caducado.
+func (s *Service) checkSignature(link Link, query url.Values, now time.Time) error {
+	signature := query.Get(SignatureQueryParam)
+	if signature == "" {
+		return ErrSignatureRequired
+	}
+	if s.signingKey == nil {
+		return ErrInvalidSignature
+	}
+	exp := query.Get(SignatureExpiryQueryParam)
+	var expiresAt time.Time
+	if exp != "" {
+		seconds, err := strconv.ParseInt(exp, 10, 64)
+		if err != nil {
+			return ErrInvalidSignature
+		}
+		expiresAt = time.Unix(seconds, 0)
+	}
+	expected := SignURL(s.signingKey, link.Key(), expiresAt)
+	if !hmac.Equal([]byte(signature), []byte(expected)) {
+		return ErrInvalidSignature
+	}
+	if !expiresAt.IsZero() && !now.Before(expiresAt) {
+		return ErrSignatureExpired
+	}
+	return nil
+}
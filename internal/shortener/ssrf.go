@@ -0,0 +1,192 @@
+package shortener
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// destinationLookupTimeout acota la resolución DNS de cada destino
+const destinationLookupTimeout = 2 * time.Second
+
+// maxFetchRedirects es el número máximo de redirecciones que siguen los clientes HTTP que
+// visitan destinos
+const maxFetchRedirects = 5
+
+// errInternalAddress indica que una conexión hacia un destino se negó por ser interna
+var errInternalAddress = errors.New("conexión a una dirección privada o interna bloqueada")
+
+// HostResolver resuelve un nombre de host a sus direcciones IP; *net.Resolver lo implementa
+type HostResolver interface {
+	LookupNetIP(ctx context.Context, network, host string) ([]netip.Addr, error)
+}
+
+// internalPrefixes son rangos sin uso público que no cubren los métodos de netip.Addr: la red
+// "esta red", el espacio compartido CGNAT (incluye el metadata de Alibaba, 100.100.100.200),
+// las asignaciones del IETF (incluye el metadata de Oracle, 192.0.0.192), la red de pruebas de
+// rendimiento y el rango reservado junto con el broadcast
+var internalPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+}
+
+// internalHostnames son nombres que siempre apuntan a la propia máquina o a servicios internos
+// de la nube; internalSuffixes son dominios reservados para uso local
+var (
+	internalHostnames = []string{"localhost", "metadata", "metadata.google.internal", "instance-data"}
+	internalSuffixes  = []string{".localhost", ".local", ".internal", ".home.arpa"}
+)
+
+// WithPrivateDestinations permite acortar destinos en redes privadas o internas (loopback,
+// RFC 1918, link-local, metadata de la nube), pensado para acortadores de una intranet. Por
+// defecto se rechazan porque las vistas previas y comprobaciones que visitan el destino
+// permitirían alcanzar la red interna del servidor (SSRF).
+func WithPrivateDestinations(allowed bool) ServiceOption {
+	return func(s *Service) {
+		s.allowPrivateDestinations = allowed
+	}
+}
+
+// WithDestinationResolver resuelve el dominio de cada destino y lo rechaza si alguna de sus
+// direcciones es privada o interna, o si no se puede resolver. Sin resolver solo se comprueban
+// las IPs literales y los nombres internos conocidos.
+func WithDestinationResolver(resolver HostResolver) ServiceOption {
+	return func(s *Service) {
+		s.destinationResolver = resolver
+	}
+}
+
+// checkDestinationHost retorna el motivo por el que el host apunta a la red interna, o vacío si
+// se acepta
+func (s *Service) checkDestinationHost(host string) string {
+	if s.allowPrivateDestinations {
+		return ""
+	}
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+
+	if addr, err := netip.ParseAddr(host); err == nil {
+		if isInternalAddr(addr) {
+			return "apunta a una dirección privada o interna"
+		}
+		return ""
+	}
+	if isNumericHost(host) {
+		return "dirección IP en formato no admitido"
+	}
+	if isInternalHostname(host) {
+		return "apunta a un host interno"
+	}
+
+	if s.destinationResolver == nil {
+		return ""
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), destinationLookupTimeout)
+	defer cancel()
+	addrs, err := s.destinationResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil || len(addrs) == 0 {
+		return "no se pudo resolver el dominio"
+	}
+	for _, addr := range addrs {
+		if isInternalAddr(addr) {
+			return "el dominio resuelve a una dirección privada o interna"
+		}
+	}
+	return ""
+}
+
+// isInternalAddr indica si la dirección no es enrutable públicamente: loopback, privada
+// (RFC 1918 y fc00::/7), link-local (incluye el metadata 169.254.169.254), multicast, sin
+// especificar o de los rangos de internalPrefixes. Las IPv6 con IPv4 embebida se evalúan como
+// IPv4.
+func isInternalAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if addr.IsLoopback() || addr.IsPrivate() || addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() || addr.IsMulticast() || addr.IsUnspecified() {
+		return true
+	}
+	for _, prefix := range internalPrefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// isNumericHost indica si todas las etiquetas del host son números decimales, octales o
+// hexadecimales: formas alternativas de una IPv4 (2130706433, 0x7f.1, 017700000001) que algunos
+// clientes HTTP interpretan como direcciones
+func isNumericHost(host string) bool {
+	for _, label := range strings.Split(host, ".") {
+		if _, err := strconv.ParseUint(label, 0, 64); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// isInternalHostname indica si el nombre (en minúsculas) es local o de un servicio interno
+func isInternalHostname(host string) bool {
+	for _, name := range internalHostnames {
+		if host == name {
+			return true
+		}
+	}
+	for _, suffix := range internalSuffixes {
+		if strings.HasSuffix(host, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// safeHTTPClient crea el cliente HTTP con el que el servicio visita los destinos. Sigue como
+// máximo maxFetchRedirects redirecciones http(s) y, salvo allowPrivate, se niega a conectar con
+// direcciones internas. La comprobación se hace al conectar, con la IP ya resuelta, de modo
+// que tampoco se alcanza la red interna con redirecciones ni con dominios que cambian de IP
+// después de validarse (DNS rebinding). No usa el proxy del entorno.
+func safeHTTPClient(timeout time.Duration, allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout}
+	if !allowPrivate {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			addr, err := netip.ParseAddr(host)
+			if err != nil || isInternalAddr(addr) {
+				return fmt.Errorf("%w: %s", errInternalAddress, host)
+			}
+			return nil
+		}
+	}
+
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext:           dialer.DialContext,
+			TLSHandshakeTimeout:   timeout,
+			ResponseHeaderTimeout: timeout,
+			MaxIdleConnsPerHost:   2,
+			IdleConnTimeout:       30 * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxFetchRedirects {
+				return fmt.Errorf("más de %d redirecciones", maxFetchRedirects)
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return fmt.Errorf("redirección a un esquema no permitido: %s", req.URL.Scheme)
+			}
+			return nil
+		},
+	}
+}
@@ -0,0 +1,134 @@
+package shortener
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// BackendMemory identifica el almacén en memoria en StoreStats.Backend
+const BackendMemory = "memory"
+
+// Stats resume el estado de los enlaces del servicio para los paneles de control
+type Stats struct {
+	// TotalLinks son todos los enlaces almacenados, que se reparten entre ActiveLinks,
+	// ExpiredLinks y DisabledLinks; un enlace desactivado y expirado cuenta como desactivado
+	TotalLinks    int
+	ActiveLinks   int
+	ExpiredLinks  int
+	DisabledLinks int
+	// BrokenLinks son los enlaces cuyo destino se marcó como roto en la última comprobación
+	BrokenLinks int
+	// ClicksToday son las visitas registradas por esta instancia desde la medianoche UTC
+	ClicksToday int64
+	// Store describe el almacén
+	Store StoreStats
+	// Collisions son los reintentos al generar códigos desde el arranque
+	Collisions CollisionStats
+}
+
+// StoreStats resume la ocupación del almacén sin recorrer los enlaces
+type StoreStats struct {
+	// Backend identifica el almacén y sus capas, de fuera a dentro, p. ej. "cache/memory"
+	Backend string
+	Links   int
+	EvictionStats
+	// Memory es la estimación de memoria; nil si el almacén no la informa (ver Compactor)
+	Memory *MemoryUsage
+}
+
+// BackendReporter lo implementan los almacenes que se identifican en StoreStats.Backend. Los
+// que envuelven a otro almacén anteponen su nombre al del envuelto.
+type BackendReporter interface {
+	Backend() string
+}
+
+// Backend implementa BackendReporter
+func (s *Store) Backend() string {
+	return BackendMemory
+}
+
+// BackendName identifica el almacén; "unknown" si no implementa BackendReporter
+func BackendName(store LinkStore) string {
+	if reporter, ok := store.(BackendReporter); ok {
+		return reporter.Backend()
+	}
+	return "unknown"
+}
+
+// dailyClicks cuenta las visitas del día UTC en curso
+type dailyClicks struct {
+	mu    sync.Mutex
+	day   int64
+	count int64
+}
+
+// add suma una visita y reinicia la cuenta al cambiar de día
+func (d *dailyClicks) add(now time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if day := now.Unix() / secondsPerDay; day != d.day {
+		d.day, d.count = day, 0
+	}
+	d.count++
+}
+
+// today retorna las visitas del día de now
+func (d *dailyClicks) today(now time.Time) int64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if now.Unix()/secondsPerDay != d.day {
+		return 0
+	}
+	return d.count
+}
+
+// secondsPerDay es la duración de un día UTC en segundos
+const secondsPerDay = int64(24 * time.Hour / time.Second)
+
+// GetStats recorre los enlaces y retorna cuántos hay activos, expirados, desactivados y rotos,
+// las visitas de hoy y el estado del almacén
+func (s *Service) GetStats(ctx context.Context) (Stats, error) {
+	store, err := s.StoreStats(ctx)
+	if err != nil {
+		return Stats{}, err
+	}
+	now := time.Now()
+	stats := Stats{Store: store, ClicksToday: s.clicksToday.today(now), Collisions: s.CollisionStats()}
+	if err := s.EachLink(ctx, func(link Link) error {
+		stats.TotalLinks++
+		switch {
+		case link.IsDisabled():
+			stats.DisabledLinks++
+		case link.IsExpired(now):
+			stats.ExpiredLinks++
+		default:
+			stats.ActiveLinks++
+		}
+		if link.Health.Broken {
+			stats.BrokenLinks++
+		}
+		return nil
+	}); err != nil {
+		return Stats{}, err
+	}
+	return stats, nil
+}
+
+// StoreStats retorna el backend y el número de enlaces almacenados; si el almacén expulsa
+// enlaces al llenarse, su capacidad y las expulsiones; y si la estima, su memoria. A diferencia de GetStats no recorre los
+// enlaces.
+func (s *Service) StoreStats(ctx context.Context) (StoreStats, error) {
+	links, err := s.store.Count(ctx)
+	if err != nil {
+		return StoreStats{}, storeError(err)
+	}
+	stats := StoreStats{Backend: BackendName(s.store), Links: links}
+	if reporter, ok := s.store.(EvictionReporter); ok {
+		stats.EvictionStats = reporter.EvictionStats()
+	}
+	if usage, ok := s.StoreMemory(); ok {
+		stats.Memory = &usage
+	}
+	return stats, nil
+}
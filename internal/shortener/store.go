@@ -1,48 +1,570 @@
 package shortener
 
 import (
+	"context"
+	"encoding/json"
+	"sort"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// Link representa un enlace acortado junto con sus metadatos
+type Link struct {
+	ShortCode string
+	LongURL   string
+	Owner     string // Identificador del usuario propietario (vacío si es anónimo)
+	// Domain es el dominio personalizado del propietario en el que vive el código; vacío en el
+	// dominio principal. El mismo código puede existir a la vez en dominios distintos.
+	Domain string
+	// Tenant es el espacio de códigos independiente al que pertenece el enlace; vacío en el
+	// espacio común. Cada tenant tiene sus propios códigos, cuota y estadísticas.
+	Tenant string
+	// Workspace es el espacio compartido en el que lo creó un editor; los editores de ese
+	// espacio pueden modificarlo
+	Workspace string
+	Client    string // Cliente que lo creó, para las cuotas (usuario, API key o IP)
+	APIKeyID  string // Identificador (APIKeyID) de la clave de API con la que se creó
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	ExpiresAt time.Time // Cero si el enlace no expira
+	Clicks    int64     // Número de redirecciones servidas
+	BotClicks int64     // Redirecciones servidas a bots y rastreadores; incluidas en Clicks
+	// Visitors estima los visitantes únicos sin guardar IPs (ver UniqueVisitors)
+	Visitors VisitorSketch
+
+	// ForwardQuery agrega la query de la URL corta al destino al redirigir
+	ForwardQuery bool
+	// UTM son los parámetros de campaña agregados al destino al redirigir
+	UTM UTMParams
+	// PasswordHash es el hash PBKDF2 de la contraseña; vacío si el enlace no está protegido
+	PasswordHash string
+	// GeoTargets son destinos alternativos por país o región (p. ej. "DE" o "EU")
+	GeoTargets map[string]string
+	// DeviceTargets son destinos por clase de dispositivo ("ios", "android" o "desktop")
+	DeviceTargets map[string]string
+	// Variants son los destinos de una prueba A/B con sus pesos y clics; reemplazan a LongURL
+	// en las visitas que no reciben un destino por dispositivo o país
+	Variants []Variant
+	// StickyVariants hace que cada visitante reciba siempre la misma variante
+	StickyVariants bool
+	// Interstitial muestra una página de aviso con el destino antes de redirigir
+	Interstitial bool
+	// RedirectType es RedirectPermanent para responder 301; vacío es RedirectTemporary (307)
+	RedirectType string
+	// Cloak sirve una página HTML con el destino en lugar de la redirección HTTP; vacío
+	// redirige con normalidad
+	Cloak Cloak
+	// Referrers son los dominios de procedencia desde los que redirige; vacío admite todos
+	Referrers ReferrerPolicy
+	// IPAccess son las redes desde las que redirige; vacío admite todas
+	IPAccess IPAccessPolicy
+	// Signed exige una URL firmada con la clave del servicio para redirigir (ver SignURL)
+	Signed bool
+	// DisabledAt es el momento en que se desactivó el enlace; cero si está activo
+	DisabledAt time.Time
+	// DisabledReason explica a los visitantes por qué el enlace está desactivado
+	DisabledReason string
+	// Quarantined fuerza la página de aviso tras acumular denuncias de abuso
+	Quarantined bool
+	// Health es el resultado de la última comprobación de la URL larga
+	Health LinkHealth
+	// Metadata son el título, la descripción y la imagen del destino para la vista previa
+	Metadata LinkMetadata
+	// Tags son las etiquetas del enlace, normalizadas y en orden alfabético
+	Tags []string
+	// CollectionID es la colección a la que pertenece el enlace; cero si no está en ninguna
+	CollectionID int64
+	// PendingTransfer identifica la oferta de traspaso pendiente de confirmar; vacío si no hay
+	// ninguna. Los tokens de confirmación la incluyen para que cada uno sirva una sola vez.
+	PendingTransfer string
+	// Description es una nota libre del propietario sobre el enlace
+	Description string
+	// CustomMetadata es un objeto JSON compacto del integrador; no confundir con Metadata, que
+	// describe el destino
+	CustomMetadata json.RawMessage
+}
+
+// Key es la clave del enlace en el almacén: el código en el dominio principal,
+// "dominio/código" en los dominios personalizados (ver LinkKey) y con el prefijo "@tenant/"
+// en el espacio de un tenant (ver TenantKey)
+func (l Link) Key() string {
+	return TenantKey(l.Tenant, LinkKey(l.Domain, l.ShortCode))
+}
+
+// IsExpired indica si el enlace tiene expiración y ya se alcanzó
+func (l Link) IsExpired(now time.Time) bool {
+	return !l.ExpiresAt.IsZero() && !now.Before(l.ExpiresAt)
+}
+
+// IsDisabled indica si el enlace está desactivado (borrado lógico)
+func (l Link) IsDisabled() bool {
+	return !l.DisabledAt.IsZero()
+}
+
+// Dedupable indica si el enlace puede reutilizarse al acortar de nuevo su URL en modo
+// deduplicación: no expira y no tiene reglas ni datos propios (contraseña, destinos
+// alternativos, reenvío de la query o UTM, redirección permanente o enmascarada, procedencias o
+// redes permitidas, firma, etiquetas, notas ni espacio compartido). Es la misma condición que
+// aplica Shorten a la petición, salvo el alias, que no cambia el comportamiento del enlace.
+func (l Link) Dedupable() bool {
+	return l.ExpiresAt.IsZero() && l.PasswordHash == "" && len(l.GeoTargets) == 0 && len(l.DeviceTargets) == 0 &&
+		len(l.Variants) == 0 && !l.StickyVariants && !l.Interstitial && !l.ForwardQuery && l.UTM.IsZero() &&
+		l.RedirectType == "" && l.Cloak.IsZero() && l.Referrers.IsZero() && l.IPAccess.IsZero() && !l.Signed &&
+		len(l.Tags) == 0 && l.Description == "" && len(l.CustomMetadata) == 0 && l.Workspace == ""
+}
+
+// PasswordProtected indica si la redirección requiere contraseña
+func (l Link) PasswordProtected() bool {
+	return l.PasswordHash != ""
+}
+
+// Visit es una visita que el almacén suma a los contadores de un enlace
+type Visit struct {
+	// Variant es la variante A/B servida; vacía si no se sirvió ninguna
+	Variant string
+	// Visitor es el hash del visitante para el sketch de únicos; cero si no se cuenta
+	Visitor uint64
+	// Bot indica que la visita es de un bot o rastreador
+	Bot bool
+}
+
+// WithVisit retorna el enlace con la visita sumada. Las variantes y el sketch se copian antes de
+// modificarlos: los enlaces ya entregados a los lectores comparten los anteriores.
+func (l Link) WithVisit(visit Visit) Link {
+	l.Clicks++
+	if visit.Bot {
+		l.BotClicks++
+	}
+	if visit.Variant != "" {
+		variants := make([]Variant, len(l.Variants))
+		copy(variants, l.Variants)
+		for i := range variants {
+			if variants[i].Name == visit.Variant {
+				variants[i].Clicks++
+			}
+		}
+		l.Variants = variants
+	}
+	if visit.Visitor != 0 {
+		l.Visitors = l.Visitors.With(visit.Visitor)
+	}
+	return l
+}
+
+// LinkStore es el contrato de almacenamiento que usa el servicio. Todas las operaciones
+// reciben el contexto de la petición para que los backends remotos respeten cancelaciones
+// y deadlines; Store es la implementación en memoria. Los parámetros shortCode son la clave
+// del enlace (Link.Key), que coincide con el código salvo en los dominios personalizados y
+// los tenants. Los parámetros owner son TenantKey(tenant, propietario), de modo que la
+// deduplicación y los listados por propietario no cruzan tenants.
+type LinkStore interface {
+	// SaveLink almacena (o reemplaza) un enlace completo
+	SaveLink(ctx context.Context, link Link) error
+	// SaveLinkIfAbsent almacena el enlace solo si su código no existe, de forma atómica;
+	// created es false si el código ya estaba ocupado
+	SaveLinkIfAbsent(ctx context.Context, link Link) (created bool, err error)
+	// GetLink obtiene el enlace de un código; found es false si no existe
+	GetLink(ctx context.Context, shortCode string) (link Link, found bool, err error)
+	// GetOrSave retorna el enlace vigente del mismo propietario y URL o guarda el recibido si su
+	// código está libre, de forma atómica; si no hay enlace vigente y el código está ocupado no
+	// guarda nada y retorna un result vacío con created false
+	GetOrSave(ctx context.Context, link Link) (result Link, created bool, err error)
+	// FindByURL busca el enlace indexado de un propietario para una URL larga
+	FindByURL(ctx context.Context, owner, longURL string) (link Link, found bool, err error)
+	// IncrementClicks suma una visita al contador del enlace (y al de bots si visit.Bot) y, si
+	// visit.Variant no está vacía, al de esa variante. Si visit.Visitor no es cero lo agrega al
+	// sketch de visitantes (Link.Visitors).
+	IncrementClicks(ctx context.Context, shortCode string, visit Visit) error
+	// Delete elimina un enlace y reporta si existía
+	Delete(ctx context.Context, shortCode string) (bool, error)
+	// ListByOwner retorna los enlaces de un propietario ordenados por fecha de creación
+	ListByOwner(ctx context.Context, owner string) ([]Link, error)
+	// List retorna una página filtrada y ordenada junto con el total de coincidencias
+	List(ctx context.Context, query ListQuery) (LinkPage, error)
+	// Search retorna los enlaces cuya URL larga o código contienen los términos buscados
+	Search(ctx context.Context, query SearchQuery) (LinkPage, error)
+	// Exists verifica si un código corto ya existe
+	Exists(ctx context.Context, shortCode string) (bool, error)
+	// Count retorna el número total de enlaces almacenados
+	Count(ctx context.Context) (int, error)
+	// CountByClient retorna el número de enlaces almacenados creados por un cliente
+	CountByClient(ctx context.Context, client string) (int, error)
+	// CountByTenant retorna el número de enlaces almacenados en el espacio de un tenant
+	CountByTenant(ctx context.Context, tenant string) (int, error)
+	// Each recorre todos los enlaces ordenados por código llamando a fn; un error de fn
+	// detiene el recorrido y se retorna. Permite exportar sin materializar todo el almacén.
+	Each(ctx context.Context, fn func(Link) error) error
+	// GetIdempotencyKey obtiene el registro vigente de una clave de idempotencia
+	GetIdempotencyKey(ctx context.Context, key string) (record IdempotencyRecord, found bool, err error)
+	// SaveIdempotencyKey guarda el registro si la clave no tiene uno vigente; si lo tiene
+	// retorna el existente con saved en false
+	SaveIdempotencyKey(ctx context.Context, record IdempotencyRecord) (existing IdempotencyRecord, saved bool, err error)
+	// AppendAudit agrega una entrada al log de auditoría asignándole su ID; el log solo crece
+	AppendAudit(ctx context.Context, entry AuditEntry) (AuditEntry, error)
+	// QueryAudit retorna una página del log de auditoría, de la entrada más reciente a la más antigua
+	QueryAudit(ctx context.Context, query AuditQuery) (AuditPage, error)
+	// PurgeAudit elimina las entradas del log atribuibles a un usuario (las que hizo y las de sus
+	// enlaces) y retorna cuántas eran; solo se usa al borrar sus datos
+	PurgeAudit(ctx context.Context, user string) (int, error)
+	// AddReport guarda una denuncia asignándole su ID y retorna cuántos reporters distintos
+	// tienen denuncias abiertas sobre el enlace
+	AddReport(ctx context.Context, report Report) (saved Report, openReporters int, err error)
+	// ListReports retorna una página de denuncias, de la más reciente a la más antigua
+	ListReports(ctx context.Context, query ReportQuery) (ReportPage, error)
+	// CloseReports cambia al estado indicado las denuncias abiertas de un enlace
+	CloseReports(ctx context.Context, shortCode, status string) (int, error)
+	// SetHealth guarda el estado del destino si la URL larga del enlace sigue siendo longURL
+	SetHealth(ctx context.Context, shortCode, longURL string, health LinkHealth) (updated bool, err error)
+	// SetMetadata guarda los metadatos del destino si la URL larga del enlace sigue siendo longURL
+	SetMetadata(ctx context.Context, shortCode, longURL string, metadata LinkMetadata) (updated bool, err error)
+	// SaveCollection crea la colección asignándole su ID si no lo tiene o la reemplaza;
+	// rechaza nombres repetidos en el mismo ámbito con ErrCollectionExists
+	SaveCollection(ctx context.Context, collection Collection) (Collection, error)
+	// GetCollection obtiene una colección; found es false si no existe
+	GetCollection(ctx context.Context, id int64) (collection Collection, found bool, err error)
+	// DeleteCollection elimina una colección y reporta si existía
+	DeleteCollection(ctx context.Context, id int64) (bool, error)
+	// ListCollections retorna las colecciones de un tenant ordenadas por nombre
+	ListCollections(ctx context.Context, tenant string) ([]Collection, error)
+}
+
 // Store maneja el almacenamiento concurrente de URLs
 type Store struct {
-	urls map[string]string // short_code -> long_url
-	mu   sync.RWMutex      // Mutex para operaciones concurrentes
+	urls  map[string]Link   // clave (Link.Key) -> enlace
+	byURL map[string]string // propietario + long_url -> clave (índice inverso para deduplicación)
+	mu    sync.RWMutex      // Mutex para operaciones concurrentes
+
+	byClient map[string]int // cliente -> enlaces almacenados, para las cuotas
+	byTenant map[string]int // tenant -> enlaces almacenados, para las cuotas
+
+	maxEntries     int                   // capacidad máxima; cero sin límite
+	evictionPolicy string                // EvictionLRU o EvictionLFU
+	usage          map[string]*linkUsage // short_code -> uso, solo con capacidad máxima
+	evictions      atomic.Uint64         // enlaces expulsados por falta de capacidad
+
+	trigrams trigramIndex // índice de búsqueda sobre URLs largas y códigos
+	tags     tagIndex     // etiqueta -> claves de los enlaces, para los listados por etiqueta
+
+	memory      int64     // memoria estimada de los enlaces y sus índices (ver MemoryUsage)
+	peakLinks   int       // máximo de enlaces desde la última compactación
+	compactedAt time.Time // última compactación
+
+	idempotency      map[string]IdempotencyRecord // clave de idempotencia -> enlace creado
+	idempotencyMu    sync.Mutex
+	idempotencySaves int // escrituras desde la última purga de claves expiradas
+
+	audit    []AuditEntry // log de auditoría en orden de llegada; solo PurgeAudit elimina entradas
+	auditSeq int64        // último ID asignado; no se reutiliza aunque se purguen entradas
+	auditMu  sync.RWMutex
+
+	reports   []Report // denuncias de abuso en orden de llegada
+	reportsMu sync.RWMutex
+
+	collections   map[int64]Collection // ID -> colección
+	collectionSeq int64                // último ID asignado
+	collectionsMu sync.RWMutex
 }
 
+// Verificación en compilación de que Store implementa LinkStore
+var _ LinkStore = (*Store)(nil)
+
 // NewStore crea una nueva instancia del almacén
-func NewStore() *Store {
-	return &Store{
-		urls: make(map[string]string),
+func NewStore(opts ...StoreOption) *Store {
+	s := &Store{
+		urls:        make(map[string]Link),
+		byURL:       make(map[string]string),
+		byClient:    make(map[string]int),
+		byTenant:    make(map[string]int),
+		trigrams:    make(trigramIndex),
+		tags:        make(tagIndex),
+		idempotency: make(map[string]IdempotencyRecord),
+		usage:       make(map[string]*linkUsage),
+		collections: make(map[int64]Collection),
 	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
 // Save almacena una nueva relación short_code -> long_url
-func (s *Store) Save(shortCode, longURL string) {
+func (s *Store) Save(ctx context.Context, shortCode, longURL string) error {
+	now := time.Now()
+	return s.SaveLink(ctx, Link{
+		ShortCode: shortCode,
+		LongURL:   longURL,
+		CreatedAt: now,
+		UpdatedAt: now,
+	})
+}
+
+// SaveLink almacena (o reemplaza) un enlace completo
+func (s *Store) SaveLink(ctx context.Context, link Link) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.saveLocked(link)
+	return nil
+}
+
+// SaveIfAbsent almacena una nueva relación short_code -> long_url solo si el código no existe
+func (s *Store) SaveIfAbsent(ctx context.Context, shortCode, longURL string) (bool, error) {
+	now := time.Now()
+	return s.SaveLinkIfAbsent(ctx, Link{
+		ShortCode: shortCode,
+		LongURL:   longURL,
+		CreatedAt: now,
+		UpdatedAt: now,
+	})
+}
+
+// SaveLinkIfAbsent almacena el enlace si su código no existe. La comprobación y la escritura
+// ocurren bajo el mismo lock, por lo que de dos peticiones concurrentes con el mismo código
+// solo una lo obtiene y la otra no sobrescribe su enlace.
+func (s *Store) SaveLinkIfAbsent(ctx context.Context, link Link) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	s.urls[shortCode] = longURL
+	if _, exists := s.urls[link.Key()]; exists {
+		return false, nil
+	}
+	s.saveLocked(link)
+	return true, nil
+}
+
+// dedupKey construye la clave del índice inverso: la deduplicación es por propietario
+// (TenantKey(tenant, propietario)), de modo que dos usuarios que acortan la misma URL obtienen
+// códigos (y analíticas) distintos. Los enlaces anónimos de un tenant comparten el propietario
+// vacío.
+func dedupKey(owner, longURL string) string {
+	return owner + "\x00" + longURL
+}
+
+// GetOrSave retorna el enlace vigente y activo existente del mismo propietario para la misma URL
+// larga o, si no hay ninguno, guarda el enlace recibido salvo que su código esté ocupado, como
+// SaveLinkIfAbsent. La comprobación y la escritura ocurren bajo el mismo lock, por lo que
+// peticiones concurrentes obtienen un único código.
+func (s *Store) GetOrSave(ctx context.Context, link Link) (Link, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return Link{}, false, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if code, indexed := s.byURL[dedupKey(TenantKey(link.Tenant, link.Owner), link.LongURL)]; indexed {
+		if existing, exists := s.urls[code]; exists && !existing.IsExpired(time.Now()) && !existing.IsDisabled() {
+			return existing, false, nil
+		}
+	}
+	if _, taken := s.urls[link.Key()]; taken {
+		return Link{}, false, nil
+	}
+
+	s.saveLocked(link)
+	return link, true, nil
+}
+
+// FindByURL busca el enlace indexado de un propietario para una URL larga
+func (s *Store) FindByURL(ctx context.Context, owner, longURL string) (Link, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return Link{}, false, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	code, indexed := s.byURL[dedupKey(owner, longURL)]
+	if !indexed {
+		return Link{}, false, nil
+	}
+	link, exists := s.urls[code]
+	return link, exists, nil
+}
+
+// saveLocked guarda el enlace y mantiene el índice inverso; requiere el lock de escritura
+func (s *Store) saveLocked(link Link) {
+	previous, exists := s.urls[link.Key()]
+	if exists {
+		s.unindexLocked(previous)
+		s.trigrams.remove(previous)
+		s.tags.remove(previous)
+	} else if s.maxEntries > 0 {
+		s.makeRoomLocked()
+		usage := &linkUsage{}
+		usage.lastUsed.Store(time.Now().UnixNano())
+		s.usage[link.Key()] = usage
+	}
+	s.urls[link.Key()] = link
+	s.trigrams.add(link)
+	s.tags.add(link)
+	s.trackLocked(previous, link)
+
+	// El índice solo contiene enlaces reutilizables y conserva el que ya apunta a uno vigente;
+	// si no, apunta al más reciente de cada propietario para cada URL
+	if link.Dedupable() {
+		key := dedupKey(TenantKey(link.Tenant, link.Owner), link.LongURL)
+		indexed, ok := s.urls[s.byURL[key]]
+		if !ok || indexed.IsExpired(time.Now()) || indexed.IsDisabled() {
+			s.byURL[key] = link.Key()
+		}
+	}
+	if link.Client != "" {
+		s.byClient[link.Client]++
+	}
+	if link.Tenant != "" {
+		s.byTenant[link.Tenant]++
+	}
+}
+
+// unindexLocked elimina la entrada del índice inverso si apunta al enlace indicado y lo
+// descuenta de su cliente y su tenant
+func (s *Store) unindexLocked(link Link) {
+	key := dedupKey(TenantKey(link.Tenant, link.Owner), link.LongURL)
+	if s.byURL[key] == link.Key() {
+		delete(s.byURL, key)
+	}
+	if link.Client != "" {
+		if s.byClient[link.Client]--; s.byClient[link.Client] <= 0 {
+			delete(s.byClient, link.Client)
+		}
+	}
+	if link.Tenant != "" {
+		if s.byTenant[link.Tenant]--; s.byTenant[link.Tenant] <= 0 {
+			delete(s.byTenant, link.Tenant)
+		}
+	}
 }
 
 // Get obtiene la URL larga asociada a un código corto
-func (s *Store) Get(shortCode string) (string, bool) {
+func (s *Store) Get(ctx context.Context, shortCode string) (string, bool, error) {
+	link, exists, err := s.GetLink(ctx, shortCode)
+	return link.LongURL, exists, err
+}
+
+// GetLink obtiene una copia del enlace asociado a un código corto
+func (s *Store) GetLink(ctx context.Context, shortCode string) (Link, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return Link{}, false, err
+	}
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	longURL, exists := s.urls[shortCode]
-	return longURL, exists
+	link, exists := s.urls[shortCode]
+	if exists && s.maxEntries > 0 {
+		s.touchLocked(shortCode)
+	}
+	return link, exists, nil
+}
+
+// IncrementClicks suma la visita al enlace; ignora códigos y variantes inexistentes
+func (s *Store) IncrementClicks(ctx context.Context, shortCode string, visit Visit) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if link, exists := s.urls[shortCode]; exists {
+		s.urls[shortCode] = link.WithVisit(visit)
+		s.trackLocked(link, s.urls[shortCode])
+	}
+	return nil
+}
+
+// Delete elimina un enlace y reporta si existía
+func (s *Store) Delete(ctx context.Context, shortCode string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	link, exists := s.urls[shortCode]
+	if !exists {
+		return false, nil
+	}
+	s.removeLocked(link)
+	return true, nil
+}
+
+// removeLocked elimina el enlace y sus índices; requiere el lock de escritura
+func (s *Store) removeLocked(link Link) {
+	s.unindexLocked(link)
+	s.trigrams.remove(link)
+	s.tags.remove(link)
+	delete(s.urls, link.Key())
+	s.trackLocked(link, Link{})
+	delete(s.usage, link.Key())
+}
+
+// ListByOwner retorna los enlaces de un propietario (TenantKey(tenant, propietario)) ordenados
+// por fecha de creación
+func (s *Store) ListByOwner(ctx context.Context, owner string) ([]Link, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	links := make([]Link, 0)
+	for _, link := range s.urls {
+		if TenantKey(link.Tenant, link.Owner) == owner {
+			links = append(links, link)
+		}
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(links, func(i, j int) bool {
+		if links[i].CreatedAt.Equal(links[j].CreatedAt) {
+			return links[i].ShortCode < links[j].ShortCode
+		}
+		return links[i].CreatedAt.Before(links[j].CreatedAt)
+	})
+	return links, nil
 }
 
 // Exists verifica si un código corto ya existe
-func (s *Store) Exists(shortCode string) bool {
+func (s *Store) Exists(ctx context.Context, shortCode string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 	_, exists := s.urls[shortCode]
-	return exists
+	return exists, nil
 }
 
 // Count retorna el número total de URLs almacenadas
-func (s *Store) Count() int {
+func (s *Store) Count(ctx context.Context) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	return len(s.urls)
+	return len(s.urls), nil
+}
+
+// Each recorre los enlaces ordenados por código. Toma una instantánea bajo el lock de lectura
+// y llama a fn sin mantenerlo, para que un consumidor lento no bloquee las escrituras.
+func (s *Store) Each(ctx context.Context, fn func(Link) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.RLock()
+	links := make([]Link, 0, len(s.urls))
+	for _, link := range s.urls {
+		links = append(links, link)
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(links, func(i, j int) bool {
+		return links[i].ShortCode < links[j].ShortCode
+	})
+	for _, link := range links {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(link); err != nil {
+			return err
+		}
+	}
+	return nil
 }
@@ -0,0 +1,104 @@
+package shortener
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// DefaultAliasSuggestions es el número de alternativas que acompañan a un alias ocupado
+const DefaultAliasSuggestions = 3
+
+// maxSuggestionCandidates acota los candidatos que se comprueban en el almacén por alias
+// ocupado, para que un espacio muy lleno no multiplique las consultas
+const maxSuggestionCandidates = 12
+
+// AliasTakenError acompaña a ErrAliasTaken con alternativas libres al alias solicitado
+type AliasTakenError struct {
+	Alias string
+	// Suggestions son alias libres en el mismo espacio de códigos, en orden de preferencia
+	Suggestions []string
+}
+
+func (e *AliasTakenError) Error() string {
+	return fmt.Sprintf("%v: %s", ErrAliasTaken, e.Alias)
+}
+
+// Unwrap permite comprobar el error con errors.Is(err, ErrAliasTaken)
+func (e *AliasTakenError) Unwrap() error {
+	return ErrAliasTaken
+}
+
+// WithAliasSuggestions fija cuántas alternativas se sugieren cuando el alias solicitado está
+// ocupado (DefaultAliasSuggestions por defecto); cero no sugiere ninguna
+func WithAliasSuggestions(n int) ServiceOption {
+	return func(s *Service) {
+		if n < 0 {
+			n = 0
+		}
+		s.aliasSuggestions = n
+	}
+}
+
+// aliasTaken construye el error de un alias ocupado con sus alternativas. Si el almacén falla
+// al buscarlas, el alias se rechaza igualmente sin sugerencias.
+func (s *Service) aliasTaken(ctx context.Context, tenant, domain, alias string) error {
+	suggestions, _ := s.SuggestAliases(ctx, tenant, domain, alias, s.aliasSuggestions)
+	return &AliasTakenError{Alias: alias, Suggestions: suggestions}
+}
+
+// SuggestAliases retorna hasta n alias libres parecidos a alias en el espacio de códigos del
+// tenant y el dominio: primero con sufijos numéricos y el año (alias-2, alias2024, alias-3) y
+// después con sufijos derivados de un hash (alias-3f9a). Se descartan los que no son alias
+// válidos o están reservados.
+func (s *Service) SuggestAliases(ctx context.Context, tenant, domain, alias string, n int) ([]string, error) {
+	suggestions := make([]string, 0, n)
+	if n <= 0 {
+		return suggestions, nil
+	}
+	for _, candidate := range aliasCandidates(alias, time.Now().Year()) {
+		if s.checkAliasFormat(candidate) != nil || s.filter.checkAlias(candidate) != nil {
+			continue
+		}
+		taken, err := s.store.Exists(ctx, TenantKey(tenant, LinkKey(domain, candidate)))
+		if err != nil {
+			return suggestions, storeError(err)
+		}
+		if !taken {
+			suggestions = append(suggestions, candidate)
+			if len(suggestions) == n {
+				break
+			}
+		}
+	}
+	return suggestions, nil
+}
+
+// aliasCandidates genera las alternativas de alias en orden de preferencia, sin repetir y
+// recortando alias para que cada una quepa en MaxAliasLength. El recorte es por caracteres
+// para no partir los de los alias Unicode.
+func aliasCandidates(alias string, year int) []string {
+	suffixes := []string{"-2", strconv.Itoa(year), "-3", "-4"}
+	for i := 0; len(suffixes) < maxSuggestionCandidates; i++ {
+		hash := md5.Sum([]byte(alias + "#" + strconv.Itoa(i)))
+		suffixes = append(suffixes, "-"+hex.EncodeToString(hash[:2]))
+	}
+
+	runes := []rune(alias)
+	candidates := make([]string, 0, len(suffixes))
+	seen := make(map[string]bool, len(suffixes))
+	for _, suffix := range suffixes {
+		base := alias
+		if len(runes)+len(suffix) > MaxAliasLength {
+			base = string(runes[:MaxAliasLength-len(suffix)])
+		}
+		if candidate := base + suffix; !seen[candidate] {
+			seen[candidate] = true
+			candidates = append(candidates, candidate)
+		}
+	}
+	return candidates
+}
@@ -0,0 +1,170 @@
+package shortener
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Límites de las etiquetas de un enlace
+const (
+	MaxTags      = 10
+	MaxTagLength = 32
+)
+
+// normalizeTag lleva una etiqueta a su forma almacenada: sin espacios y en minúsculas
+func normalizeTag(tag string) string {
+	return strings.ToLower(strings.TrimSpace(tag))
+}
+
+// normalizeTags retorna las etiquetas normalizadas, sin repetir y en orden alfabético; nil si
+// no hay ninguna
+func normalizeTags(tags []string) []string {
+	seen := make(map[string]bool, len(tags))
+	var normalized []string
+	for _, tag := range tags {
+		if tag = normalizeTag(tag); tag != "" && !seen[tag] {
+			seen[tag] = true
+			normalized = append(normalized, tag)
+		}
+	}
+	sort.Strings(normalized)
+	return normalized
+}
+
+// validateTags comprueba el número de etiquetas y que cada una tenga entre 1 y MaxTagLength
+// letras minúsculas, números, '-' o '_'
+func validateTags(tags []string) error {
+	var errs []error
+	for _, tag := range tags {
+		if err := validateTag(normalizeTag(tag)); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if n := len(normalizeTags(tags)); n > MaxTags {
+		errs = append(errs, &ValidationError{Field: "tags", Value: n, Msg: fmt.Sprintf("no puede haber más de %d etiquetas", MaxTags)})
+	}
+	return errors.Join(errs...)
+}
+
+// validateTag comprueba el formato de una etiqueta ya normalizada
+func validateTag(tag string) error {
+	if tag == "" || len(tag) > MaxTagLength {
+		return &ValidationError{Field: "tags", Value: tag, Msg: fmt.Sprintf("cada etiqueta debe tener entre 1 y %d caracteres", MaxTagLength)}
+	}
+	for _, c := range tag {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '-' && c != '_' {
+			return &ValidationError{Field: "tags", Value: tag, Msg: "solo se permiten letras, números, '-' y '_'"}
+		}
+	}
+	return nil
+}
+
+// HasTag indica si el enlace tiene la etiqueta; la comparación no distingue mayúsculas
+func (l Link) HasTag(tag string) bool {
+	tag = normalizeTag(tag)
+	for _, candidate := range l.Tags {
+		if candidate == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// SetTags reemplaza las etiquetas de un enlace; una lista vacía las elimina todas. Solo el
+// propietario o un admin pueden cambiarlas.
+func (s *Service) SetTags(ctx context.Context, actor Actor, shortCode string, tags []string) (Link, error) {
+	link, err := s.GetLink(ctx, shortCode)
+	if err != nil {
+		return Link{}, err
+	}
+
+	if !actor.canManage(link) {
+		return Link{}, ErrForbidden
+	}
+	if err := validateTags(tags); err != nil {
+		return Link{}, err
+	}
+
+	before := link
+	link.Tags = normalizeTags(tags)
+	link.UpdatedAt = time.Now()
+	if err := s.store.SaveLink(ctx, link); err != nil {
+		return Link{}, storeError(err)
+	}
+	if err := s.audit(ctx, actor, AuditUpdate, &before, &link); err != nil {
+		return Link{}, err
+	}
+	return link, nil
+}
+
+// TagStats son los enlaces y visitas de una etiqueta
+type TagStats struct {
+	Tag    string
+	Links  int
+	Clicks int64
+	// BotClicks son las visitas de bots incluidas en Clicks
+	BotClicks int64
+}
+
+// TagStatistics retorna los enlaces y visitas de cada etiqueta usada en el espacio del tenant,
+// en orden alfabético. Los usuarios reciben las de sus enlaces y los de su espacio compartido;
+// los administradores, las de todos. Recorre el almacén completo.
+func (s *Service) TagStatistics(ctx context.Context, actor Actor, tenant string) ([]TagStats, error) {
+	byTag := make(map[string]*TagStats)
+	if err := s.EachLink(ctx, func(link Link) error {
+		if link.Tenant != tenant || !actor.canManage(link) {
+			return nil
+		}
+		for _, tag := range link.Tags {
+			stats, ok := byTag[tag]
+			if !ok {
+				stats = &TagStats{Tag: tag}
+				byTag[tag] = stats
+			}
+			stats.Links++
+			stats.Clicks += link.Clicks
+			stats.BotClicks += link.BotClicks
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	stats := make([]TagStats, 0, len(byTag))
+	for _, tagStats := range byTag {
+		stats = append(stats, *tagStats)
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Tag < stats[j].Tag })
+	return stats, nil
+}
+
+// tagIndex asocia cada etiqueta de cada tenant (TenantKey(tenant, etiqueta)) con las claves de
+// los enlaces que la tienen, para que los listados por etiqueta no recorran el almacén. Lo
+// mantiene Store bajo su lock de escritura.
+type tagIndex map[string]map[string]struct{}
+
+// add indexa las etiquetas del enlace
+func (idx tagIndex) add(link Link) {
+	for _, tag := range link.Tags {
+		key := TenantKey(link.Tenant, tag)
+		if idx[key] == nil {
+			idx[key] = make(map[string]struct{})
+		}
+		idx[key][link.Key()] = struct{}{}
+	}
+}
+
+// remove retira el enlace del índice
+func (idx tagIndex) remove(link Link) {
+	for _, tag := range link.Tags {
+		key := TenantKey(link.Tenant, tag)
+		delete(idx[key], link.Key())
+		if len(idx[key]) == 0 {
+			delete(idx, key)
+		}
+	}
+}
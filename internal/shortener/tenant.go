@@ -0,0 +1,157 @@
+package shortener
+
+import (
+	"context"
+	"regexp"
+	"sort"
+
+	"acortador-urls/internal/errcode"
+)
+
+// ErrTenantQuotaExceeded indica que el tenant alcanzó su cuota de enlaces almacenados
+var ErrTenantQuotaExceeded = errcode.New(errcode.TenantQuotaExceeded, "cuota de enlaces del tenant agotada")
+
+// TenantPattern valida los identificadores de tenant: letras minúsculas, números y '-'
+var TenantPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,62}$`)
+
+// TenantKey construye la clave de almacenamiento de key (un código, una clave de LinkKey o un
+// propietario) en el espacio de un tenant: la propia key sin tenant y "@tenant/key" con él.
+// Ni los códigos ni los hosts admiten '@', así que los espacios de tenants distintos nunca
+// coinciden entre sí ni con el espacio común.
+func TenantKey(tenant, key string) string {
+	if tenant == "" {
+		return key
+	}
+	return "@" + tenant + "/" + key
+}
+
+// tenants es el registro de tenants, fijo desde la creación del servicio
+type tenants struct {
+	byAPIKey map[string]string // clave de API -> tenant
+	byHost   map[string]string // host -> tenant
+}
+
+// WithTenants registra los tenants del despliegue por clave de API y por host (clave o host ->
+// tenant). Cada tenant tiene su propio espacio de códigos, cuota y estadísticas; las peticiones
+// que no corresponden a ninguno usan el espacio común. Los identificadores inválidos se
+// ignoran; config.Validate los rechaza antes de llegar aquí.
+func WithTenants(apiKeys, hosts map[string]string) ServiceOption {
+	return func(s *Service) {
+		for apiKey, tenant := range apiKeys {
+			if TenantPattern.MatchString(tenant) {
+				if s.tenants.byAPIKey == nil {
+					s.tenants.byAPIKey = make(map[string]string)
+				}
+				s.tenants.byAPIKey[apiKey] = tenant
+			}
+		}
+		for host, tenant := range hosts {
+			if TenantPattern.MatchString(tenant) {
+				if s.tenants.byHost == nil {
+					s.tenants.byHost = make(map[string]string)
+				}
+				s.tenants.byHost[normalizeHost(host)] = tenant
+			}
+		}
+	}
+}
+
+// WithTenantQuota limita el número de enlaces almacenados por tenant; cero lo desactiva. El
+// espacio común solo cuenta para el límite global de WithLinkQuotas.
+func WithTenantQuota(maxPerTenant int) ServiceOption {
+	return func(s *Service) {
+		s.maxLinksPerTenant = maxPerTenant
+	}
+}
+
+// ResolveTenant retorna el tenant de una petición: el de su clave de API si tiene una
+// registrada y si no el de su host (la cabecera Host, con o sin puerto). Vacío es el espacio
+// común.
+func (s *Service) ResolveTenant(apiKey, host string) string {
+	if tenant, ok := s.tenants.byAPIKey[apiKey]; ok && apiKey != "" {
+		return tenant
+	}
+	return s.tenants.byHost[normalizeHost(host)]
+}
+
+// HasTenant indica si el tenant está registrado
+func (s *Service) HasTenant(tenant string) bool {
+	for _, current := range s.tenants.byAPIKey {
+		if current == tenant {
+			return true
+		}
+	}
+	return s.TenantHost(tenant) != ""
+}
+
+// TenantHost retorna el host que sirve los enlaces del tenant: el primero en orden alfabético
+// de los suyos, o vacío si solo se identifica por clave de API
+func (s *Service) TenantHost(tenant string) string {
+	host := ""
+	for current, owner := range s.tenants.byHost {
+		if owner == tenant && (host == "" || current < host) {
+			host = current
+		}
+	}
+	return host
+}
+
+// Tenants retorna los tenants registrados en orden alfabético
+func (s *Service) Tenants() []string {
+	seen := make(map[string]bool)
+	for _, tenant := range s.tenants.byAPIKey {
+		seen[tenant] = true
+	}
+	for _, tenant := range s.tenants.byHost {
+		seen[tenant] = true
+	}
+	names := make([]string, 0, len(seen))
+	for tenant := range seen {
+		names = append(names, tenant)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// TenantStats son los enlaces y visitas de un tenant
+type TenantStats struct {
+	Tenant string
+	Links  int
+	Clicks int64
+	// BotClicks son las visitas de bots incluidas en Clicks
+	BotClicks int64
+}
+
+// TenantStatistics retorna las estadísticas de cada tenant registrado, en orden alfabético y
+// precedidas por las del espacio común (Tenant vacío). Recorre el almacén completo.
+func (s *Service) TenantStatistics(ctx context.Context) ([]TenantStats, error) {
+	names := append([]string{""}, s.Tenants()...)
+	index := make(map[string]int, len(names))
+	stats := make([]TenantStats, len(names))
+	for i, tenant := range names {
+		index[tenant] = i
+		stats[i].Tenant = tenant
+	}
+	if err := s.EachLink(ctx, func(link Link) error {
+		// Los enlaces de tenants que ya no están registrados no se reportan
+		if i, ok := index[link.Tenant]; ok {
+			stats[i].Links++
+			stats[i].Clicks += link.Clicks
+			stats[i].BotClicks += link.BotClicks
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// CountByTenant retorna el número de enlaces almacenados en el espacio del tenant
+func (s *Store) CountByTenant(ctx context.Context, tenant string) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.byTenant[tenant], nil
+}
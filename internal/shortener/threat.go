@@ -0,0 +1,148 @@
+package shortener
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"time"
+
+	"acortador-urls/internal/errcode"
+	"acortador-urls/internal/threat"
+)
+
+// DefaultThreatCheckTimeout acota la consulta de reputación al crear o editar un enlace
+const DefaultThreatCheckTimeout = 2 * time.Second
+
+// ErrMaliciousURL indica que un destino figura en las listas de amenazas del proveedor de
+// reputación
+var ErrMaliciousURL = errcode.New(errcode.MaliciousURL, "URL marcada como maliciosa")
+
+// WithThreatChecker comprueba los destinos contra un servicio de reputación (Safe Browsing,
+// URLhaus). Al crear o editar un enlace la consulta se acota a timeout: si el proveedor falla o
+// no responde a tiempo el enlace se acepta y RescanThreats lo revisa más tarde. Conviene
+// envolver checker en un threat.Cache para respetar las cuotas del proveedor.
+func WithThreatChecker(checker threat.Checker, timeout time.Duration) ServiceOption {
+	return func(s *Service) {
+		s.threatChecker = checker
+		s.threatTimeout = timeout
+	}
+}
+
+// threatTarget es un destino http(s) de un enlace junto al campo que lo contiene
+type threatTarget struct {
+	field string
+	url   string
+}
+
+// threatTargets retorna los destinos web del enlace: la URL larga, los destinos por país y
+// por dispositivo y las variantes. Los enlaces profundos a aplicaciones no se consultan.
+func threatTargets(link Link) []threatTarget {
+	targets := []threatTarget{{field: "long_url", url: link.LongURL}}
+	for _, group := range []struct {
+		prefix  string
+		targets map[string]string
+	}{{"geo_targets.", link.GeoTargets}, {"device_targets.", link.DeviceTargets}} {
+		keys := make([]string, 0, len(group.targets))
+		for key := range group.targets {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if parsed, err := url.Parse(group.targets[key]); err == nil && (parsed.Scheme == "http" || parsed.Scheme == "https") {
+				targets = append(targets, threatTarget{field: group.prefix + key, url: group.targets[key]})
+			}
+		}
+	}
+	for i, v := range link.Variants {
+		targets = append(targets, threatTarget{field: fmt.Sprintf("variants[%d].url", i), url: v.URL})
+	}
+	return targets
+}
+
+// checkThreats rechaza los destinos marcados como maliciosos. Los fallos del proveedor no
+// bloquean la operación: el destino queda pendiente de la siguiente revisión.
+func (s *Service) checkThreats(ctx context.Context, targets []threatTarget) error {
+	if s.threatChecker == nil {
+		return nil
+	}
+	if s.threatTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.threatTimeout)
+		defer cancel()
+	}
+
+	var errs []error
+	for _, target := range targets {
+		verdict, err := s.threatChecker.Check(ctx, target.url)
+		if err != nil {
+			continue
+		}
+		if verdict.Malicious {
+			errs = append(errs, &ValidationError{Field: target.field, Value: target.url, Err: ErrMaliciousURL,
+				Msg: fmt.Sprintf("figura como amenaza (%s) en %s", verdict.Threat, verdict.Source)})
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// RescanThreats vuelve a consultar los destinos de los enlaces activos y pone en cuarentena los
+// que el proveedor marca como maliciosos desde su creación. Retorna cuántos enlaces se
+// pusieron en cuarentena; los fallos del proveedor en un enlace no detienen la revisión.
+func (s *Service) RescanThreats(ctx context.Context) (int, error) {
+	if s.threatChecker == nil {
+		return 0, nil
+	}
+
+	var pending []Link
+	now := time.Now()
+	if err := s.EachLink(ctx, func(link Link) error {
+		if !link.Quarantined && !link.IsDisabled() && !link.IsExpired(now) {
+			pending = append(pending, link)
+		}
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+
+	quarantined := 0
+	for _, link := range pending {
+		if err := ctx.Err(); err != nil {
+			return quarantined, err
+		}
+		malicious := false
+		for _, target := range threatTargets(link) {
+			if verdict, err := s.threatChecker.Check(ctx, target.url); err == nil && verdict.Malicious {
+				malicious = true
+				break
+			}
+		}
+		if !malicious {
+			continue
+		}
+
+		// El enlace pudo cambiar durante la revisión; se pone en cuarentena su versión actual
+		current, err := s.GetLink(ctx, link.Key())
+		if errors.Is(err, ErrURLNotFound) {
+			continue
+		}
+		if err != nil {
+			return quarantined, err
+		}
+		if current.Quarantined {
+			continue
+		}
+		before := current
+		current.Quarantined = true
+		current.UpdatedAt = time.Now()
+		if err := s.store.SaveLink(ctx, current); err != nil {
+			return quarantined, storeError(err)
+		}
+		if err := s.audit(ctx, Actor{}, AuditQuarantine, &before, &current); err != nil {
+			return quarantined, err
+		}
+		quarantined++
+	}
+	return quarantined, nil
+}
@@ -0,0 +1,126 @@
+package shortener
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"acortador-urls/internal/errcode"
+)
+
+// ErrTransferInvalid indica que la confirmación de un traspaso no corresponde al enlace, que
+// este cambió de propietario desde que se pidió o que el traspaso ya no está pendiente
+var ErrTransferInvalid = errcode.New(errcode.InvalidConfirmation, "el traspaso no corresponde al enlace ni a su propietario actual")
+
+// Transfer es un traspaso pendiente de confirmar: el enlace (Link.Key), su propietario cuando
+// se pidió y el identificador de la oferta (Link.PendingTransfer)
+type Transfer struct {
+	Link  string
+	From  string
+	Nonce string
+}
+
+// newTransferNonce genera el identificador aleatorio de una oferta de traspaso
+func newTransferNonce() (string, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("no se pudo generar el identificador del traspaso: %w", err)
+	}
+	return hex.EncodeToString(nonce), nil
+}
+
+// canTransfer indica si el actor puede ceder el enlace: su propietario o un administrador. Los
+// editores de un espacio compartido no ceden enlaces, igual que no los eliminan.
+func (a Actor) canTransfer(link Link) bool {
+	return a.Admin || (a.Workspace == "" && link.Owner != "" && link.Owner == a.UserID)
+}
+
+// RequestTransfer comprueba que actor pueda ceder el enlace a recipient y guarda en él una oferta
+// nueva (Link.PendingTransfer), que reemplaza a la anterior si la había. Retorna el enlace con su
+// propietario actual y la oferta: la confirmación debe corresponder a ambos para que el
+// traspaso se complete.
+func (s *Service) RequestTransfer(ctx context.Context, actor Actor, shortCode, recipient string) (Link, error) {
+	s.transferMu.Lock()
+	defer s.transferMu.Unlock()
+	link, err := s.GetLink(ctx, shortCode)
+	if err != nil {
+		return Link{}, err
+	}
+	if !actor.canTransfer(link) {
+		return Link{}, ErrForbidden
+	}
+	switch recipient = strings.TrimSpace(recipient); {
+	case recipient == "":
+		return Link{}, &ValidationError{Field: "to", Value: recipient, Msg: "es obligatorio"}
+	case recipient == link.Owner:
+		return Link{}, &ValidationError{Field: "to", Value: recipient, Msg: "ya es el propietario del enlace"}
+	}
+	if link.PendingTransfer, err = newTransferNonce(); err != nil {
+		return Link{}, err
+	}
+	if err := s.store.SaveLink(ctx, link); err != nil {
+		return Link{}, storeError(err)
+	}
+	return link, nil
+}
+
+// CancelTransfer retira la oferta de traspaso pendiente del enlace, de modo que su token de
+// confirmación deja de servir. Puede hacerlo quien puede cederlo; sin oferta pendiente no hace
+// nada.
+func (s *Service) CancelTransfer(ctx context.Context, actor Actor, shortCode string) error {
+	s.transferMu.Lock()
+	defer s.transferMu.Unlock()
+	link, err := s.GetLink(ctx, shortCode)
+	if err != nil {
+		return err
+	}
+	if !actor.canTransfer(link) {
+		return ErrForbidden
+	}
+	if link.PendingTransfer == "" {
+		return nil
+	}
+	link.PendingTransfer = ""
+	if err := s.store.SaveLink(ctx, link); err != nil {
+		return storeError(err)
+	}
+	return nil
+}
+
+// AcceptTransfer completa el traspaso del enlace a actor, que es quien lo recibe. Cada oferta
+// se acepta una sola vez: aceptarla, retirarla o pedir otra la anula. El enlace conserva su
+// código y sus estadísticas, y deja el espacio compartido y la colección del propietario
+// anterior. Si el receptor acepta con una clave de API, el consumo de las redirecciones pasa a
+// esa clave; si no, deja de contar para la clave con la que se creó.
+func (s *Service) AcceptTransfer(ctx context.Context, actor Actor, shortCode string, transfer Transfer, apiKey string) (Link, error) {
+	if actor.UserID == "" {
+		return Link{}, ErrForbidden
+	}
+	s.transferMu.Lock()
+	defer s.transferMu.Unlock()
+	link, err := s.GetLink(ctx, shortCode)
+	if err != nil {
+		return Link{}, err
+	}
+	if link.Key() != transfer.Link || link.Owner != transfer.From || link.PendingTransfer == "" || link.PendingTransfer != transfer.Nonce {
+		return Link{}, ErrTransferInvalid
+	}
+
+	before := link
+	link.PendingTransfer = ""
+	link.Owner = actor.UserID
+	link.Workspace = ""
+	link.CollectionID = 0
+	link.APIKeyID = s.usageKeyID(apiKey)
+	link.UpdatedAt = time.Now()
+	if err := s.store.SaveLink(ctx, link); err != nil {
+		return Link{}, storeError(err)
+	}
+	if err := s.audit(ctx, actor, AuditTransfer, &before, &link); err != nil {
+		return Link{}, err
+	}
+	return link, nil
+}
@@ -0,0 +1,58 @@
+package shortener
+
+import (
+	"fmt"
+	"unicode"
+	"unicode/utf8"
+)
+
+// zeroWidthJoiner une los emoji de una secuencia, como 👩‍💻
+const zeroWidthJoiner = '\u200d'
+
+// WithUnicodeAliases admite alias con letras de cualquier alfabeto y emoji (/🔥sale, /café)
+// además de los caracteres ASCII de siempre. La longitud de los alias se cuenta en caracteres
+// y no en bytes.
+func WithUnicodeAliases(enabled bool) ServiceOption {
+	return func(s *Service) {
+		s.unicodeAliases = enabled
+	}
+}
+
+// checkAliasFormat valida un alias con las reglas del servicio: validateUnicodeAlias si admite
+// alias Unicode y validateAlias si no
+func (s *Service) checkAliasFormat(alias string) error {
+	if s.unicodeAliases {
+		return validateUnicodeAlias(alias)
+	}
+	return validateAlias(alias)
+}
+
+// validateUnicodeAlias comprueba un alias Unicode: UTF-8 válido, entre MinAliasLength y
+// MaxAliasLength caracteres y, fuera de ASCII, solo letras, números, marcas combinantes,
+// símbolos (los emoji lo son) y el carácter de unión de las secuencias de emoji. En ASCII se
+// mantienen las reglas de validateAlias, de modo que '/', '%', '?' o '#' siguen prohibidos y el
+// alias siempre es un único segmento de ruta.
+func validateUnicodeAlias(alias string) error {
+	if !utf8.ValidString(alias) {
+		return &ValidationError{Field: "alias", Value: alias, Err: ErrInvalidAlias, Msg: "no es UTF-8 válido"}
+	}
+	if n := utf8.RuneCountInString(alias); n < MinAliasLength || n > MaxAliasLength {
+		return &ValidationError{Field: "alias", Value: alias, Err: ErrInvalidAlias,
+			Msg: fmt.Sprintf("debe tener entre %d y %d caracteres", MinAliasLength, MaxAliasLength)}
+	}
+	for _, c := range alias {
+		if !unicodeAliasRune(c) {
+			return &ValidationError{Field: "alias", Value: alias, Err: ErrInvalidAlias,
+				Msg: "solo se permiten letras, números, emoji, '-' y '_'"}
+		}
+	}
+	return nil
+}
+
+// unicodeAliasRune indica si c puede formar parte de un alias Unicode
+func unicodeAliasRune(c rune) bool {
+	if c < utf8.RuneSelf {
+		return c == '-' || c == '_' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9')
+	}
+	return c == zeroWidthJoiner || unicode.In(c, unicode.L, unicode.N, unicode.M, unicode.So, unicode.Sk)
+}
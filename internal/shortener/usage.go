@@ -0,0 +1,204 @@
+package shortener
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"acortador-urls/internal/errcode"
+)
+
+// ErrUsageQuotaExceeded indica que la clave de API agotó su cuota mensual de enlaces creados o
+// de redirecciones
+var ErrUsageQuotaExceeded = errcode.New(errcode.UsageQuotaExceeded, "cuota mensual de la clave de API agotada")
+
+// Usos medidos por clave de API
+const (
+	UsageShortens  = "shortens"
+	UsageRedirects = "redirects"
+)
+
+// UsageLimits son las cuotas mensuales de una clave de API; cero no limita
+type UsageLimits struct {
+	Shortens  int64
+	Redirects int64
+}
+
+// limit retorna la cuota del uso indicado
+func (l UsageLimits) limit(usage string) int64 {
+	if usage == UsageShortens {
+		return l.Shortens
+	}
+	return l.Redirects
+}
+
+// UsageQuotaError indica el uso cuya cuota se agotó y cuándo se renueva
+type UsageQuotaError struct {
+	Usage   string
+	Limit   int64
+	ResetAt time.Time
+}
+
+// Error implementa error
+func (e *UsageQuotaError) Error() string {
+	return fmt.Sprintf("%v: máximo de %d %s al mes", ErrUsageQuotaExceeded, e.Limit, e.Usage)
+}
+
+// Unwrap permite comparar con errors.Is(err, ErrUsageQuotaExceeded)
+func (e *UsageQuotaError) Unwrap() error {
+	return ErrUsageQuotaExceeded
+}
+
+// KeyUsage es el consumo de una clave de API en el mes en curso (UTC)
+type KeyUsage struct {
+	KeyID     string
+	Period    string // "2006-01"
+	Shortens  int64
+	Redirects int64
+	Limits    UsageLimits
+	ResetAt   time.Time
+}
+
+// APIKeyID identifica una clave de API sin revelarla: los 16 primeros caracteres hexadecimales
+// de su SHA-256. Vacío para las peticiones sin clave.
+func APIKeyID(apiKey string) string {
+	if apiKey == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(apiKey))
+	return hex.EncodeToString(sum[:8])
+}
+
+// usageKeyID retorna el identificador con el que se mide el consumo de la clave: el de
+// APIKeyID si es una clave configurada (ver KnownAPIKey) y vacío si no, de modo que una clave
+// inventada se trata como una petición anónima en lugar de estrenar cuota y contadores
+func (s *Service) usageKeyID(apiKey string) string {
+	if !s.KnownAPIKey(apiKey) {
+		return ""
+	}
+	return APIKeyID(apiKey)
+}
+
+// usageMeter cuenta los enlaces creados con cada clave de API configurada y las redirecciones
+// de esos enlaces durante el mes en curso. Los contadores viven en memoria y empiezan de cero
+// al cambiar de mes o reiniciar el proceso.
+type usageMeter struct {
+	mu       sync.Mutex
+	period   string
+	counts   map[string]*[2]int64 // id de clave -> acortados, redirecciones
+	defaults UsageLimits
+	limits   map[string]UsageLimits // id de clave -> cuotas propias
+	now      func() time.Time
+}
+
+// WithUsageQuotas limita los enlaces creados y las redirecciones al mes de cada clave de API
+// configurada: defaults para todas y perKey para claves concretas (clave -> cuotas), que con
+// ello quedan configuradas. Las redirecciones se atribuyen a la clave con la que se creó el
+// enlace. El consumo se mide aunque no haya cuotas.
+func WithUsageQuotas(defaults UsageLimits, perKey map[string]UsageLimits) ServiceOption {
+	return func(s *Service) {
+		s.usage.defaults = defaults
+		for apiKey, limits := range perKey {
+			if s.usage.limits == nil {
+				s.usage.limits = make(map[string]UsageLimits)
+			}
+			s.usage.limits[APIKeyID(apiKey)] = limits
+		}
+	}
+}
+
+// usagePeriod retorna el mes de now y el inicio del siguiente, cuando se renuevan las cuotas
+func usagePeriod(now time.Time) (string, time.Time) {
+	now = now.UTC()
+	start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	return start.Format("2006-01"), start.AddDate(0, 1, 0)
+}
+
+// limitsFor retorna las cuotas de la clave
+func (m *usageMeter) limitsFor(id string) UsageLimits {
+	if limits, ok := m.limits[id]; ok {
+		return limits
+	}
+	return m.defaults
+}
+
+// current descarta los contadores de meses anteriores; requiere m.mu
+func (m *usageMeter) current() {
+	if m.now == nil {
+		m.now = time.Now
+	}
+	if period, _ := usagePeriod(m.now()); period != m.period || m.counts == nil {
+		m.period = period
+		m.counts = make(map[string]*[2]int64)
+	}
+}
+
+// counters retorna los contadores de la clave en el mes en curso; requiere m.mu
+func (m *usageMeter) counters(id string) *[2]int64 {
+	m.current()
+	c, ok := m.counts[id]
+	if !ok {
+		c = new([2]int64)
+		m.counts[id] = c
+	}
+	return c
+}
+
+// usageIndex es la posición del uso en los contadores
+func usageIndex(usage string) int {
+	if usage == UsageShortens {
+		return 0
+	}
+	return 1
+}
+
+// reserve cuenta un uso de la clave si no agota su cuota; sin clave no hace nada
+func (m *usageMeter) reserve(id, usage string) error {
+	if id == "" {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c := m.counters(id)
+	if limit := m.limitsFor(id).limit(usage); limit > 0 && c[usageIndex(usage)] >= limit {
+		_, resetAt := usagePeriod(m.now())
+		return &UsageQuotaError{Usage: usage, Limit: limit, ResetAt: resetAt}
+	}
+	c[usageIndex(usage)]++
+	return nil
+}
+
+// release devuelve un uso reservado cuya operación falló
+func (m *usageMeter) release(id, usage string) {
+	if id == "" {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if c := m.counters(id); c[usageIndex(usage)] > 0 {
+		c[usageIndex(usage)]--
+	}
+}
+
+// KeyUsage retorna el consumo del mes en curso de la clave con el identificador de APIKeyID
+func (s *Service) KeyUsage(id string) KeyUsage {
+	s.usage.mu.Lock()
+	defer s.usage.mu.Unlock()
+	// Consultar una clave sin consumo no le crea contadores
+	s.usage.current()
+	var c [2]int64
+	if counts, ok := s.usage.counts[id]; ok {
+		c = *counts
+	}
+	period, resetAt := usagePeriod(s.usage.now())
+	return KeyUsage{
+		KeyID:     id,
+		Period:    period,
+		Shortens:  c[0],
+		Redirects: c[1],
+		Limits:    s.usage.limitsFor(id),
+		ResetAt:   resetAt,
+	}
+}
@@ -0,0 +1,88 @@
+package shortener
+
+import (
+	"context"
+	"errors"
+	"sort"
+)
+
+// UserData son los datos atribuibles a un usuario: sus enlaces, con sus estadísticas, sus
+// colecciones y las entradas del log de auditoría que hizo o que afectan a sus enlaces
+type UserData struct {
+	UserID      string
+	Links       []Link
+	Collections []Collection
+	// Audit son las entradas de la más reciente a la más antigua
+	Audit []AuditEntry
+}
+
+// ExportUserData reúne los datos del usuario en todos los tenants. Solo el propio usuario o un
+// administrador pueden exportarlos. Recorre el almacén completo.
+func (s *Service) ExportUserData(ctx context.Context, actor Actor, userID string) (UserData, error) {
+	if !actor.Admin && actor.UserID != userID {
+		return UserData{}, ErrForbidden
+	}
+	data := UserData{UserID: userID, Links: make([]Link, 0), Collections: make([]Collection, 0), Audit: make([]AuditEntry, 0)}
+	if err := s.EachLink(ctx, func(link Link) error {
+		if link.Owner == userID {
+			data.Links = append(data.Links, link)
+		}
+		return nil
+	}); err != nil {
+		return UserData{}, err
+	}
+
+	for _, tenant := range append([]string{""}, s.Tenants()...) {
+		collections, err := s.store.ListCollections(ctx, tenant)
+		if err != nil {
+			return UserData{}, storeError(err)
+		}
+		for _, collection := range collections {
+			if collection.Owner == userID {
+				data.Collections = append(data.Collections, collection)
+			}
+		}
+	}
+	sort.Slice(data.Collections, func(i, j int) bool { return data.Collections[i].ID < data.Collections[j].ID })
+
+	query := AuditQuery{User: userID, Limit: MaxListLimit}
+	for {
+		page, err := s.store.QueryAudit(ctx, query)
+		if err != nil {
+			return UserData{}, storeError(err)
+		}
+		data.Audit = append(data.Audit, page.Entries...)
+		if query.Offset += len(page.Entries); len(page.Entries) == 0 || query.Offset >= page.Total {
+			break
+		}
+	}
+	return data, nil
+}
+
+// DeleteUserData elimina definitivamente los enlaces y colecciones del usuario y purga sus
+// entradas del log de auditoría, incluidas las de sus enlaces hechas por otros. Retorna los
+// datos eliminados. A diferencia de DeleteURL, los enlaces no se desactivan sino que se
+// eliminan aunque quien lo pida no sea administrador, y el borrado no se audita: la entrada
+// volvería a contener los enlaces.
+func (s *Service) DeleteUserData(ctx context.Context, actor Actor, userID string) (UserData, error) {
+	data, err := s.ExportUserData(ctx, actor, userID)
+	if err != nil {
+		return UserData{}, err
+	}
+	for _, link := range data.Links {
+		if _, err := s.store.Delete(ctx, link.Key()); err != nil {
+			return UserData{}, storeError(err)
+		}
+	}
+	// Los enlaces de otros usuarios que estaban en sus colecciones quedan fuera de colección
+	for _, collection := range data.Collections {
+		if err := s.DeleteCollection(ctx, actor, collection.Tenant, collection.ID); err != nil && !errors.Is(err, ErrCollectionNotFound) {
+			return UserData{}, err
+		}
+	}
+	// Al final, para purgar también lo que se haya auditado mientras tanto
+	if _, err := s.store.PurgeAudit(ctx, userID); err != nil {
+		return UserData{}, storeError(err)
+	}
+	return data, nil
+}
@@ -0,0 +1,121 @@
+package shortener
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+)
+
+// Límites de las pruebas A/B por enlace
+const (
+	MaxVariants          = 10
+	MaxVariantWeight     = 1000
+	MaxVariantNameLength = 32
+)
+
+// Variant es uno de los destinos alternativos de una prueba A/B. Weight es su peso relativo
+// frente al resto; con peso cero la variante queda pausada y solo la reciben los visitantes
+// que ya la tenían asignada.
+type Variant struct {
+	Name   string
+	URL    string
+	Weight int
+	Clicks int64 // Redirecciones servidas con esta variante
+}
+
+// variant busca una variante por nombre
+func (l Link) variant(name string) (Variant, bool) {
+	for _, v := range l.Variants {
+		if v.Name == name {
+			return v, true
+		}
+	}
+	return Variant{}, false
+}
+
+// pickVariant elige una variante al azar en proporción a su peso
+func pickVariant(variants []Variant) (Variant, bool) {
+	total := 0
+	for _, v := range variants {
+		total += v.Weight
+	}
+	if total == 0 {
+		return Variant{}, false
+	}
+	n := rand.Intn(total)
+	for _, v := range variants {
+		if n < v.Weight {
+			return v, true
+		}
+		n -= v.Weight
+	}
+	return Variant{}, false
+}
+
+// validateVariants comprueba número, nombres, pesos y URLs de las variantes
+func (s *Service) validateVariants(variants []Variant) error {
+	if len(variants) == 0 {
+		return nil
+	}
+	if len(variants) < 2 || len(variants) > MaxVariants {
+		return &ValidationError{Field: "variants", Value: len(variants), Msg: fmt.Sprintf("debe tener entre 2 y %d variantes", MaxVariants)}
+	}
+
+	var errs []error
+	seen := make(map[string]bool, len(variants))
+	total := 0
+	for i, v := range variants {
+		field := fmt.Sprintf("variants[%d]", i)
+		name := variantName(v, i)
+		switch {
+		case len(name) > MaxVariantNameLength:
+			errs = append(errs, &ValidationError{Field: field + ".name", Value: v.Name, Msg: fmt.Sprintf("no puede superar %d caracteres", MaxVariantNameLength)})
+		case strings.IndexFunc(name, func(c rune) bool { return !strings.ContainsRune(ValidChars, c) && c != '-' && c != '_' }) >= 0:
+			errs = append(errs, &ValidationError{Field: field + ".name", Value: v.Name, Msg: "solo se permiten letras, números, '-' y '_'"})
+		case seen[name]:
+			errs = append(errs, &ValidationError{Field: field + ".name", Value: v.Name, Msg: "está repetido"})
+		}
+		seen[name] = true
+
+		if v.Weight < 0 || v.Weight > MaxVariantWeight {
+			errs = append(errs, &ValidationError{Field: field + ".weight", Value: v.Weight, Msg: fmt.Sprintf("debe estar entre 0 y %d", MaxVariantWeight)})
+		} else {
+			total += v.Weight
+		}
+
+		if err := s.validateURL(v.URL); err != nil {
+			var validationErr *ValidationError
+			if errors.As(err, &validationErr) {
+				errs = append(errs, &ValidationError{Field: field + ".url", Value: v.URL, Msg: validationErr.Msg, Err: validationErr.Err})
+			} else {
+				errs = append(errs, err)
+			}
+		}
+	}
+	if len(errs) == 0 && total == 0 {
+		errs = append(errs, &ValidationError{Field: "variants", Value: total, Msg: "al menos una variante debe tener peso mayor que cero"})
+	}
+	return errors.Join(errs...)
+}
+
+// variantName retorna el nombre de la variante o, si no tiene, su letra según la posición
+// ("a", "b", ...)
+func variantName(v Variant, i int) string {
+	if name := strings.TrimSpace(v.Name); name != "" {
+		return name
+	}
+	return string(rune('a' + i))
+}
+
+// normalizeVariants copia las variantes asignando nombre a las que no lo traen y sin clics
+func normalizeVariants(variants []Variant) []Variant {
+	if len(variants) == 0 {
+		return nil
+	}
+	normalized := make([]Variant, len(variants))
+	for i, v := range variants {
+		normalized[i] = Variant{Name: variantName(v, i), URL: v.URL, Weight: v.Weight}
+	}
+	return normalized
+}
@@ -0,0 +1,104 @@
+package shortener
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"io"
+	"math"
+	"math/bits"
+	"sync"
+	"time"
+)
+
+// VisitorSaltPeriod es la vigencia de la sal con la que se cifran los visitantes. Al cambiar
+// la sal un mismo visitante produce otro hash, de modo que nadie (ni el propio servicio) puede
+// seguirlo de un periodo a otro; a cambio, cada periodo vuelve a contarlo como único.
+const VisitorSaltPeriod = 24 * time.Hour
+
+// Dimensiones del sketch HyperLogLog: 2^10 registros de un byte dan un error típico del 3 %
+const (
+	visitorPrecision = 10
+	visitorRegisters = 1 << visitorPrecision
+)
+
+// VisitorSketch es un sketch HyperLogLog de los visitantes de un enlace. Solo guarda, por
+// registro, el máximo de ceros iniciales de los hashes recibidos, por lo que no permite
+// recuperar ningún visitante. Nil hasta la primera visita con visitante conocido.
+type VisitorSketch []byte
+
+// With retorna el sketch con el hash agregado. No modifica el receptor: los enlaces ya
+// entregados a los lectores lo comparten, así que si cambia algún registro retorna una copia.
+func (v VisitorSketch) With(hash uint64) VisitorSketch {
+	index := hash >> (64 - visitorPrecision)
+	// El bit centinela acota el rango a los bits restantes del hash
+	rank := byte(bits.LeadingZeros64(hash<<visitorPrecision|1<<(visitorPrecision-1)) + 1)
+	if len(v) == visitorRegisters && v[index] >= rank {
+		return v
+	}
+	sketch := make(VisitorSketch, visitorRegisters)
+	copy(sketch, v)
+	sketch[index] = rank
+	return sketch
+}
+
+// Estimate estima el número de visitantes distintos. Con pocos visitantes usa conteo lineal
+// (registros vacíos), que en ese rango es prácticamente exacto.
+func (v VisitorSketch) Estimate() int64 {
+	if len(v) != visitorRegisters {
+		return 0
+	}
+	m := float64(visitorRegisters)
+	sum, zeros := 0.0, 0
+	for _, rank := range v {
+		sum += math.Ldexp(1, -int(rank))
+		if rank == 0 {
+			zeros++
+		}
+	}
+	estimate := 0.7213 / (1 + 1.079/m) * m * m / sum
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return int64(math.Round(estimate))
+}
+
+// UniqueVisitors es la estimación de visitantes únicos del enlace. Un visitante que vuelve en
+// otro periodo de sal (VisitorSaltPeriod) cuenta de nuevo.
+func (l Link) UniqueVisitors() int64 {
+	return l.Visitors.Estimate()
+}
+
+// visitorHasher convierte los identificadores de visitante en hashes con una sal aleatoria que
+// se renueva cada VisitorSaltPeriod y nunca se guarda
+type visitorHasher struct {
+	mu     sync.Mutex
+	period int64
+	salt   []byte
+	now    func() time.Time
+	random io.Reader
+}
+
+// newVisitorHasher crea el hasher; la primera sal se genera con el primer visitante
+func newVisitorHasher() *visitorHasher {
+	return &visitorHasher{period: -1, now: time.Now, random: rand.Reader}
+}
+
+// hash retorna el hash del visitante en el periodo actual; cero si el visitante es desconocido
+func (h *visitorHasher) hash(visitor string) uint64 {
+	if visitor == "" {
+		return 0
+	}
+	h.mu.Lock()
+	if period := h.now().UnixNano() / int64(VisitorSaltPeriod); period != h.period {
+		salt := make([]byte, 32)
+		io.ReadFull(h.random, salt)
+		h.period, h.salt = period, salt
+	}
+	mac := hmac.New(sha256.New, h.salt)
+	h.mu.Unlock()
+
+	mac.Write([]byte(visitor))
+	return binary.BigEndian.Uint64(mac.Sum(nil))
+}
@@ -0,0 +1,136 @@
+package threat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Endpoints públicos de los proveedores
+const (
+	SafeBrowsingEndpoint = "https://safebrowsing.googleapis.com/v4/threatMatches:find"
+	URLhausEndpoint      = "https://urlhaus-api.abuse.ch/v1/url/"
+)
+
+// safeBrowsingThreatTypes son las listas de Safe Browsing consultadas
+var safeBrowsingThreatTypes = []string{"MALWARE", "SOCIAL_ENGINEERING", "UNWANTED_SOFTWARE", "POTENTIALLY_HARMFUL_APPLICATION"}
+
+// SafeBrowsing consulta la API Lookup v4 de Google Safe Browsing
+type SafeBrowsing struct {
+	APIKey   string
+	Endpoint string
+	Client   *http.Client
+}
+
+// NewSafeBrowsing crea un cliente de Safe Browsing con el endpoint público
+func NewSafeBrowsing(apiKey string) *SafeBrowsing {
+	return &SafeBrowsing{
+		APIKey:   apiKey,
+		Endpoint: SafeBrowsingEndpoint,
+		Client:   &http.Client{Timeout: defaultHTTPTimeout},
+	}
+}
+
+// safeBrowsingEntry es una URL consultada o encontrada en Safe Browsing
+type safeBrowsingEntry struct {
+	URL string `json:"url"`
+}
+
+// Check implementa Checker con threatMatches:find; la URL es maliciosa si hay alguna coincidencia
+func (sb *SafeBrowsing) Check(ctx context.Context, rawURL string) (Verdict, error) {
+	var body struct {
+		Client struct {
+			ClientID      string `json:"clientId"`
+			ClientVersion string `json:"clientVersion"`
+		} `json:"client"`
+		ThreatInfo struct {
+			ThreatTypes      []string            `json:"threatTypes"`
+			PlatformTypes    []string            `json:"platformTypes"`
+			ThreatEntryTypes []string            `json:"threatEntryTypes"`
+			ThreatEntries    []safeBrowsingEntry `json:"threatEntries"`
+		} `json:"threatInfo"`
+	}
+	body.Client.ClientID = "acortador-urls"
+	body.Client.ClientVersion = "1.0.0"
+	body.ThreatInfo.ThreatTypes = safeBrowsingThreatTypes
+	body.ThreatInfo.PlatformTypes = []string{"ANY_PLATFORM"}
+	body.ThreatInfo.ThreatEntryTypes = []string{"URL"}
+	body.ThreatInfo.ThreatEntries = []safeBrowsingEntry{{URL: rawURL}}
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return Verdict{}, err
+	}
+
+	endpoint := sb.Endpoint + "?key=" + url.QueryEscape(sb.APIKey)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return Verdict{}, fmt.Errorf("%w: %v", ErrProvider, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	var result struct {
+		Matches []struct {
+			ThreatType string `json:"threatType"`
+		} `json:"matches"`
+	}
+	if err := doJSON(sb.Client, req, &result); err != nil {
+		return Verdict{}, err
+	}
+	verdict := Verdict{Source: ProviderSafeBrowsing}
+	if len(result.Matches) > 0 {
+		verdict.Malicious = true
+		verdict.Threat = result.Matches[0].ThreatType
+	}
+	return verdict, nil
+}
+
+// URLhaus consulta la API de URLhaus (abuse.ch), la base de URLs que distribuyen malware
+type URLhaus struct {
+	// AuthKey es la Auth-Key de abuse.ch; se envía solo si no está vacía
+	AuthKey  string
+	Endpoint string
+	Client   *http.Client
+}
+
+// NewURLhaus crea un cliente de URLhaus con el endpoint público
+func NewURLhaus(authKey string) *URLhaus {
+	return &URLhaus{
+		AuthKey:  authKey,
+		Endpoint: URLhausEndpoint,
+		Client:   &http.Client{Timeout: defaultHTTPTimeout},
+	}
+}
+
+// Check implementa Checker; la URL es maliciosa si URLhaus la tiene registrada, aunque ya no
+// esté activa
+func (uh *URLhaus) Check(ctx context.Context, rawURL string) (Verdict, error) {
+	form := url.Values{"url": {rawURL}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, uh.Endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return Verdict{}, fmt.Errorf("%w: %v", ErrProvider, err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if uh.AuthKey != "" {
+		req.Header.Set("Auth-Key", uh.AuthKey)
+	}
+
+	var result struct {
+		QueryStatus string `json:"query_status"`
+		Threat      string `json:"threat"`
+	}
+	if err := doJSON(uh.Client, req, &result); err != nil {
+		return Verdict{}, err
+	}
+	switch result.QueryStatus {
+	case "ok":
+		return Verdict{Malicious: true, Threat: result.Threat, Source: ProviderURLhaus}, nil
+	case "no_results":
+		return Verdict{Source: ProviderURLhaus}, nil
+	default:
+		return Verdict{}, fmt.Errorf("%w: URLhaus respondió %q", ErrProvider, result.QueryStatus)
+	}
+}
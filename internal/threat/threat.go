@@ -0,0 +1,165 @@
+// Package threat consulta servicios de reputación de URLs (Google Safe Browsing, URLhaus) para
+// detectar destinos maliciosos. Checker es el punto de extensión; Cache guarda los veredictos
+// para no repetir consultas a los proveedores, que limitan el número de peticiones.
+package threat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Proveedores admitidos por NewChecker
+const (
+	ProviderSafeBrowsing = "safebrowsing"
+	ProviderURLhaus      = "urlhaus"
+)
+
+// Providers son los proveedores que se pueden configurar
+var Providers = []string{ProviderSafeBrowsing, ProviderURLhaus}
+
+// Valores por defecto de la caché y del cliente HTTP de los proveedores
+const (
+	DefaultCacheTTL    = time.Hour
+	DefaultCacheSize   = 100000
+	defaultHTTPTimeout = 10 * time.Second
+	maxResponseBytes   = 1 << 20
+)
+
+// ErrProvider indica que el proveedor no respondió o respondió con un error; el veredicto es
+// desconocido
+var ErrProvider = errors.New("proveedor de reputación no disponible")
+
+// Verdict es el resultado de consultar una URL
+type Verdict struct {
+	// Malicious indica si la URL figura en las listas del proveedor
+	Malicious bool
+	// Threat es el tipo de amenaza según el proveedor (p. ej. MALWARE o malware_download)
+	Threat string
+	// Source es el proveedor que emitió el veredicto
+	Source string
+}
+
+// Checker consulta la reputación de una URL
+type Checker interface {
+	Check(ctx context.Context, rawURL string) (Verdict, error)
+}
+
+// CheckerFunc adapta una función al interfaz Checker
+type CheckerFunc func(ctx context.Context, rawURL string) (Verdict, error)
+
+// Check implementa Checker
+func (f CheckerFunc) Check(ctx context.Context, rawURL string) (Verdict, error) {
+	return f(ctx, rawURL)
+}
+
+// NewChecker crea el cliente del proveedor indicado. Safe Browsing exige apiKey; en URLhaus es
+// la Auth-Key de abuse.ch.
+func NewChecker(provider, apiKey string) (Checker, error) {
+	switch provider {
+	case ProviderSafeBrowsing:
+		if apiKey == "" {
+			return nil, fmt.Errorf("el proveedor %s requiere una API key", provider)
+		}
+		return NewSafeBrowsing(apiKey), nil
+	case ProviderURLhaus:
+		return NewURLhaus(apiKey), nil
+	default:
+		return nil, fmt.Errorf("proveedor de reputación %q desconocido", provider)
+	}
+}
+
+// doJSON envía la petición y decodifica la respuesta JSON en v; cualquier fallo se envuelve en
+// ErrProvider salvo la cancelación del contexto
+func doJSON(client *http.Client, req *http.Request, v interface{}) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		if ctxErr := req.Context().Err(); ctxErr != nil {
+			return ctxErr
+		}
+		return fmt.Errorf("%w: %v", ErrProvider, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: %s respondió %s", ErrProvider, req.URL.Host, resp.Status)
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponseBytes)).Decode(v); err != nil {
+		return fmt.Errorf("%w: respuesta inválida de %s: %v", ErrProvider, req.URL.Host, err)
+	}
+	return nil
+}
+
+// Cache recuerda durante ttl los veredictos de otro Checker, tanto positivos como negativos.
+// Los errores no se guardan, de modo que la siguiente consulta vuelve a intentarlo.
+type Cache struct {
+	checker    Checker
+	ttl        time.Duration
+	maxEntries int
+	now        func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+}
+
+// cacheEntry es un veredicto guardado con su vencimiento
+type cacheEntry struct {
+	verdict Verdict
+	expires time.Time
+}
+
+// NewCache envuelve checker con una caché de hasta maxEntries URLs
+func NewCache(checker Checker, ttl time.Duration, maxEntries int) *Cache {
+	return &Cache{
+		checker:    checker,
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		now:        time.Now,
+		entries:    make(map[string]cacheEntry),
+	}
+}
+
+// Check implementa Checker consultando al proveedor solo si la URL no está en caché o venció
+func (c *Cache) Check(ctx context.Context, rawURL string) (Verdict, error) {
+	c.mu.Lock()
+	entry, ok := c.entries[rawURL]
+	c.mu.Unlock()
+	if ok && c.now().Before(entry.expires) {
+		return entry.verdict, nil
+	}
+
+	verdict, err := c.checker.Check(ctx, rawURL)
+	if err != nil {
+		return Verdict{}, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, exists := c.entries[rawURL]; !exists && len(c.entries) >= c.maxEntries {
+		c.evict()
+	}
+	c.entries[rawURL] = cacheEntry{verdict: verdict, expires: c.now().Add(c.ttl)}
+	return verdict, nil
+}
+
+// evict descarta las entradas vencidas y, si la caché sigue llena, una entrada cualquiera.
+// Se llama con mu tomado.
+func (c *Cache) evict() {
+	now := c.now()
+	for url, entry := range c.entries {
+		if !now.Before(entry.expires) {
+			delete(c.entries, url)
+		}
+	}
+	for url := range c.entries {
+		if len(c.entries) < c.maxEntries {
+			break
+		}
+		delete(c.entries, url)
+	}
+}
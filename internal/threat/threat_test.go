@@ -0,0 +1,202 @@
+package threat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSafeBrowsing_Check(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("key") != "clave" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		var body struct {
+			ThreatInfo struct {
+				ThreatEntries []struct {
+					URL string `json:"url"`
+				} `json:"threatEntries"`
+			} `json:"threatInfo"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || len(body.ThreatInfo.ThreatEntries) != 1 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if body.ThreatInfo.ThreatEntries[0].URL == "https://malo.example/descarga" {
+			w.Write([]byte(`{"matches":[{"threatType":"MALWARE","threat":{"url":"https://malo.example/descarga"}}]}`))
+			return
+		}
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name          string
+		apiKey        string
+		url           string
+		expected      Verdict
+		expectedError error
+	}{
+		{name: "URL maliciosa", apiKey: "clave", url: "https://malo.example/descarga",
+			expected: Verdict{Malicious: true, Threat: "MALWARE", Source: ProviderSafeBrowsing}},
+		{name: "URL limpia", apiKey: "clave", url: "https://example.com",
+			expected: Verdict{Source: ProviderSafeBrowsing}},
+		{name: "API key rechazada", apiKey: "otra", url: "https://example.com", expectedError: ErrProvider},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checker := NewSafeBrowsing(tt.apiKey)
+			checker.Endpoint = server.URL
+
+			verdict, err := checker.Check(context.Background(), tt.url)
+			if !errors.Is(err, tt.expectedError) {
+				t.Fatalf("Expected error %v, got %v", tt.expectedError, err)
+			}
+			if verdict != tt.expected {
+				t.Errorf("Expected verdict %+v, got %+v", tt.expected, verdict)
+			}
+		})
+	}
+}
+
+func TestURLhaus_Check(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Auth-Key") != "clave" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.PostFormValue("url") {
+		case "http://malo.example/bot.exe":
+			w.Write([]byte(`{"query_status":"ok","url_status":"offline","threat":"malware_download"}`))
+		case "http://roto.example":
+			w.Write([]byte(`{"query_status":"invalid_url"}`))
+		default:
+			w.Write([]byte(`{"query_status":"no_results"}`))
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name          string
+		authKey       string
+		url           string
+		expected      Verdict
+		expectedError error
+	}{
+		{name: "URL registrada aunque inactiva", authKey: "clave", url: "http://malo.example/bot.exe",
+			expected: Verdict{Malicious: true, Threat: "malware_download", Source: ProviderURLhaus}},
+		{name: "URL sin resultados", authKey: "clave", url: "https://example.com",
+			expected: Verdict{Source: ProviderURLhaus}},
+		{name: "Estado desconocido", authKey: "clave", url: "http://roto.example", expectedError: ErrProvider},
+		{name: "Sin Auth-Key", url: "https://example.com", expectedError: ErrProvider},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checker := NewURLhaus(tt.authKey)
+			checker.Endpoint = server.URL
+
+			verdict, err := checker.Check(context.Background(), tt.url)
+			if !errors.Is(err, tt.expectedError) {
+				t.Fatalf("Expected error %v, got %v", tt.expectedError, err)
+			}
+			if verdict != tt.expected {
+				t.Errorf("Expected verdict %+v, got %+v", tt.expected, verdict)
+			}
+		})
+	}
+}
+
+func TestNewChecker(t *testing.T) {
+	tests := []struct {
+		name        string
+		provider    string
+		apiKey      string
+		expectError bool
+	}{
+		{name: "Safe Browsing", provider: ProviderSafeBrowsing, apiKey: "clave"},
+		{name: "Safe Browsing sin API key", provider: ProviderSafeBrowsing, expectError: true},
+		{name: "URLhaus sin Auth-Key", provider: ProviderURLhaus},
+		{name: "Proveedor desconocido", provider: "virustotal", apiKey: "clave", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checker, err := NewChecker(tt.provider, tt.apiKey)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Expected error, got checker %T", checker)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestCache(t *testing.T) {
+	calls := map[string]int{}
+	failing := false
+	checker := CheckerFunc(func(ctx context.Context, rawURL string) (Verdict, error) {
+		calls[rawURL]++
+		if failing {
+			return Verdict{}, ErrProvider
+		}
+		return Verdict{Malicious: rawURL == "https://malo.example", Source: "prueba"}, nil
+	})
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cache := NewCache(checker, time.Hour, 2)
+	cache.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	check := func(rawURL string, malicious bool) {
+		t.Helper()
+		verdict, err := cache.Check(ctx, rawURL)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if verdict.Malicious != malicious {
+			t.Errorf("Expected malicious=%v for %s, got %v", malicious, rawURL, verdict.Malicious)
+		}
+	}
+
+	// Los veredictos positivos y negativos se sirven desde la caché
+	check("https://malo.example", true)
+	check("https://malo.example", true)
+	check("https://example.com", false)
+	check("https://example.com", false)
+	if calls["https://malo.example"] != 1 || calls["https://example.com"] != 1 {
+		t.Errorf("Expected one provider call per URL, got %v", calls)
+	}
+
+	// Al vencer el TTL se vuelve a consultar
+	now = now.Add(time.Hour)
+	check("https://malo.example", true)
+	if calls["https://malo.example"] != 2 {
+		t.Errorf("Expected expired entry to be refreshed, got %d calls", calls["https://malo.example"])
+	}
+
+	// Los errores no se guardan
+	failing = true
+	if _, err := cache.Check(ctx, "https://nuevo.example"); !errors.Is(err, ErrProvider) {
+		t.Fatalf("Expected ErrProvider, got %v", err)
+	}
+	failing = false
+	check("https://nuevo.example", false)
+	if calls["https://nuevo.example"] != 2 {
+		t.Errorf("Expected failed lookup to be retried, got %d calls", calls["https://nuevo.example"])
+	}
+
+	// La caché no supera el tamaño máximo
+	if len(cache.entries) > 2 {
+		t.Errorf("Expected at most 2 cached entries, got %d", len(cache.entries))
+	}
+}
@@ -0,0 +1,468 @@
+// Package webhooks notifica por HTTP los eventos de los enlaces (creación, visita, expiración,
+// desactivación y picos de visitas anómalos) a endpoints externos. Cada evento se envía como JSON firmado con HMAC-SHA256,
+// se reintenta con espera exponencial si el endpoint falla y queda registrado en un log de
+// entregas consultable desde la API de administración.
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"acortador-urls/internal/shortener"
+)
+
+// Cabeceras de cada entrega
+const (
+	// SignatureHeader lleva "sha256=" seguido del HMAC-SHA256 en hexadecimal de
+	// "<timestamp>.<cuerpo>" con el secreto del endpoint
+	SignatureHeader = "X-Webhook-Signature"
+	// TimestampHeader es el momento del envío en segundos Unix; los receptores deberían
+	// rechazar los muy antiguos para evitar reenvíos
+	TimestampHeader = "X-Webhook-Timestamp"
+	// EventHeader es el tipo de evento
+	EventHeader = "X-Webhook-Event"
+	// DeliveryHeader identifica el evento; se repite en los reintentos para que el receptor
+	// pueda descartar duplicados
+	DeliveryHeader = "X-Webhook-Delivery"
+)
+
+// Estados de una entrega
+const (
+	StatusPending   = "pending"
+	StatusDelivered = "delivered"
+	StatusFailed    = "failed"
+)
+
+// Valores por defecto del despachador
+const (
+	DefaultMaxAttempts = 5
+	DefaultBackoff     = time.Second
+	DefaultLogSize     = 1000
+	DefaultTimeout     = 10 * time.Second
+)
+
+// queueSize es el máximo de entregas pendientes; si se llena las nuevas se registran como
+// fallidas
+const queueSize = 1000
+
+// Endpoint es un destino de las notificaciones
+type Endpoint struct {
+	URL string
+	// Secret firma las entregas; vacío las envía sin firma
+	Secret string
+	// Events son los tipos de evento que recibe; vacío recibe todos
+	Events []string
+}
+
+// accepts indica si el endpoint recibe el tipo de evento
+func (e Endpoint) accepts(eventType string) bool {
+	if len(e.Events) == 0 {
+		return true
+	}
+	for _, accepted := range e.Events {
+		if accepted == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Payload es el cuerpo JSON de cada entrega
+type Payload struct {
+	ID    string    `json:"id"`
+	Event string    `json:"event"`
+	Time  time.Time `json:"time"`
+	Data  LinkData  `json:"data"`
+}
+
+// LinkData describe el enlace del evento
+type LinkData struct {
+	ShortCode      string     `json:"short_code"`
+	LongURL        string     `json:"long_url"`
+	Owner          string     `json:"owner,omitempty"`
+	Clicks         int64      `json:"clicks"`
+	Variant        string     `json:"variant,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	ExpiresAt      *time.Time `json:"expires_at,omitempty"`
+	DisabledReason string     `json:"disabled_reason,omitempty"`
+	// Anomaly describe el pico de visitas en los eventos link.anomaly
+	Anomaly *AnomalyData `json:"anomaly,omitempty"`
+}
+
+// AnomalyData describe un pico de visitas detectado
+type AnomalyData struct {
+	// Type es link_rate, link_spike o source_rate
+	Type string `json:"type"`
+	// Source es la IP en las anomalías source_rate
+	Source        string  `json:"source,omitempty"`
+	Clicks        int     `json:"clicks"`
+	Threshold     float64 `json:"threshold"`
+	Baseline      float64 `json:"baseline,omitempty"`
+	WindowSeconds int64   `json:"window_seconds"`
+	// Action es alert, throttle o quarantine
+	Action string `json:"action"`
+}
+
+// Delivery es el registro de la entrega de un evento a un endpoint
+type Delivery struct {
+	ID        int64
+	EventID   string
+	Event     string
+	ShortCode string
+	// LinkKey es la clave del enlace (shortener.Link.Key); el código solo es único en su
+	// tenant y dominio
+	LinkKey  string
+	Endpoint string
+	Status   string
+	Attempts int
+	// StatusCode es el código HTTP de la última respuesta; cero si no hubo respuesta
+	StatusCode int
+	// Error describe el último fallo
+	Error     string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// DeliveryQuery filtra el log de entregas
+type DeliveryQuery struct {
+	Status    string
+	Event     string
+	ShortCode string
+	// LinkKeys selecciona las entregas de los enlaces con esas claves; vacío no filtra
+	LinkKeys []string
+	Offset   int
+	Limit    int
+}
+
+// job es una entrega pendiente
+type job struct {
+	id       int64
+	endpoint Endpoint
+	payload  Payload
+	body     []byte
+}
+
+// Option configura el despachador
+type Option func(*Dispatcher)
+
+// WithMaxAttempts cambia el número máximo de intentos de cada entrega
+func WithMaxAttempts(attempts int) Option {
+	return func(d *Dispatcher) {
+		if attempts > 0 {
+			d.maxAttempts = attempts
+		}
+	}
+}
+
+// WithBackoff cambia la espera antes del primer reintento; se duplica en cada uno
+func WithBackoff(backoff time.Duration) Option {
+	return func(d *Dispatcher) {
+		d.backoff = backoff
+	}
+}
+
+// WithLogSize cambia el número de entregas que conserva el log
+func WithLogSize(size int) Option {
+	return func(d *Dispatcher) {
+		if size > 0 {
+			d.logSize = size
+		}
+	}
+}
+
+// WithHTTPClient reemplaza el cliente HTTP de las entregas
+func WithHTTPClient(client *http.Client) Option {
+	return func(d *Dispatcher) {
+		d.client = client
+	}
+}
+
+// Dispatcher recibe los eventos del servicio y los entrega a los endpoints en segundo plano.
+// Implementa shortener.EventListener.
+type Dispatcher struct {
+	endpoints   []Endpoint
+	client      *http.Client
+	maxAttempts int
+	backoff     time.Duration
+	logSize     int
+
+	queue chan job
+
+	mu     sync.Mutex
+	log    []Delivery // de la más antigua a la más reciente; se descartan las más antiguas
+	nextID int64
+
+	now func() time.Time
+}
+
+// Verificación en compilación de que Dispatcher implementa EventListener
+var _ shortener.EventListener = (*Dispatcher)(nil)
+
+// NewDispatcher crea un despachador para los endpoints; las entregas empiezan con Run
+func NewDispatcher(endpoints []Endpoint, opts ...Option) *Dispatcher {
+	d := &Dispatcher{
+		endpoints:   endpoints,
+		client:      &http.Client{Timeout: DefaultTimeout},
+		maxAttempts: DefaultMaxAttempts,
+		backoff:     DefaultBackoff,
+		logSize:     DefaultLogSize,
+		queue:       make(chan job, queueSize),
+		now:         time.Now,
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	return d
+}
+
+// HandleEvent encola la entrega del evento a cada endpoint que lo recibe
+func (d *Dispatcher) HandleEvent(event shortener.Event) {
+	payload := Payload{ID: newEventID(), Event: event.Type, Time: event.Time.UTC(), Data: linkData(event)}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return
+	}
+	for _, endpoint := range d.endpoints {
+		if !endpoint.accepts(event.Type) {
+			continue
+		}
+		id := d.record(payload, event.Link.Key(), endpoint.URL)
+		select {
+		case d.queue <- job{id: id, endpoint: endpoint, payload: payload, body: body}:
+		default:
+			d.update(id, func(delivery *Delivery) {
+				delivery.Status = StatusFailed
+				delivery.Error = "cola de entregas llena"
+			})
+		}
+	}
+}
+
+// linkData extrae los datos públicos del enlace del evento
+func linkData(event shortener.Event) LinkData {
+	link := event.Link
+	data := LinkData{
+		ShortCode:      link.ShortCode,
+		LongURL:        link.LongURL,
+		Owner:          link.Owner,
+		Clicks:         link.Clicks,
+		Variant:        event.Variant,
+		CreatedAt:      link.CreatedAt.UTC(),
+		DisabledReason: link.DisabledReason,
+	}
+	if !link.ExpiresAt.IsZero() {
+		expiresAt := link.ExpiresAt.UTC()
+		data.ExpiresAt = &expiresAt
+	}
+	if event.Type == shortener.EventAnomaly {
+		anomaly := event.Anomaly
+		data.Anomaly = &AnomalyData{Type: anomaly.Type, Source: anomaly.Source, Clicks: anomaly.Clicks, Threshold: anomaly.Threshold,
+			Baseline: anomaly.Baseline, WindowSeconds: int64(anomaly.Window / time.Second), Action: anomaly.Action}
+	}
+	return data
+}
+
+// newEventID genera un identificador aleatorio de evento
+func newEventID() string {
+	id := make([]byte, 16)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// Run entrega los eventos encolados con workers entregas en paralelo hasta que se cancela ctx
+func (d *Dispatcher) Run(ctx context.Context, workers int) {
+	if workers < 1 {
+		workers = 1
+	}
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case j := <-d.queue:
+					d.deliver(ctx, j)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// deliver envía la entrega reintentando con espera exponencial los fallos transitorios
+func (d *Dispatcher) deliver(ctx context.Context, j job) {
+	wait := d.backoff
+	for attempt := 1; ; attempt++ {
+		statusCode, err := d.send(ctx, j)
+		retry := err != nil && retryable(statusCode)
+		d.update(j.id, func(delivery *Delivery) {
+			delivery.Attempts = attempt
+			delivery.StatusCode = statusCode
+			delivery.Error = ""
+			switch {
+			case err == nil:
+				delivery.Status = StatusDelivered
+			case !retry || attempt >= d.maxAttempts:
+				delivery.Status = StatusFailed
+				delivery.Error = err.Error()
+			default:
+				delivery.Error = err.Error()
+			}
+		})
+		if !retry || attempt >= d.maxAttempts {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+		wait *= 2
+	}
+}
+
+// retryable indica si un fallo con ese código HTTP puede resolverse reintentando: sin
+// respuesta, errores del servidor, 408 y 429
+func retryable(statusCode int) bool {
+	return statusCode == 0 || statusCode >= 500 || statusCode == http.StatusRequestTimeout || statusCode == http.StatusTooManyRequests
+}
+
+// send hace un intento de entrega y retorna el código HTTP de la respuesta
+func (d *Dispatcher) send(ctx context.Context, j job) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, j.endpoint.URL, bytes.NewReader(j.body))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := strconv.FormatInt(d.now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "acortador-urls-webhooks/1.0")
+	req.Header.Set(EventHeader, j.payload.Event)
+	req.Header.Set(DeliveryHeader, j.payload.ID)
+	req.Header.Set(TimestampHeader, timestamp)
+	if j.endpoint.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(j.endpoint.Secret, timestamp, j.body))
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return resp.StatusCode, fmt.Errorf("el endpoint respondió %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// Sign calcula la firma de una entrega tal como la envía SignatureHeader
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// record agrega una entrega pendiente al log y retorna su ID
+func (d *Dispatcher) record(payload Payload, linkKey, endpoint string) int64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.nextID++
+	now := d.now()
+	d.log = append(d.log, Delivery{
+		ID:        d.nextID,
+		EventID:   payload.ID,
+		Event:     payload.Event,
+		ShortCode: payload.Data.ShortCode,
+		LinkKey:   linkKey,
+		Endpoint:  endpoint,
+		Status:    StatusPending,
+		CreatedAt: now,
+		UpdatedAt: now,
+	})
+	if len(d.log) > d.logSize {
+		d.log = append(d.log[:0:0], d.log[len(d.log)-d.logSize:]...)
+	}
+	return d.nextID
+}
+
+// update modifica una entrega del log si aún se conserva
+func (d *Dispatcher) update(id int64, fn func(*Delivery)) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	// Los IDs son crecientes, aunque Forget puede dejar huecos
+	i := sort.Search(len(d.log), func(i int) bool { return d.log[i].ID >= id })
+	if i == len(d.log) || d.log[i].ID != id {
+		return
+	}
+	fn(&d.log[i])
+	d.log[i].UpdatedAt = d.now()
+}
+
+// Forget elimina del log las entregas de los enlaces con las claves indicadas, p. ej. al borrar
+// los datos de su propietario, y retorna cuántas eran. Las entregas pendientes se siguen
+// intentando, pero su resultado ya no se registra.
+func (d *Dispatcher) Forget(keys ...string) int {
+	forget := keySet(keys)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	kept := make([]Delivery, 0, len(d.log))
+	for _, delivery := range d.log {
+		if !forget[delivery.LinkKey] {
+			kept = append(kept, delivery)
+		}
+	}
+	forgotten := len(d.log) - len(kept)
+	d.log = kept
+	return forgotten
+}
+
+// Deliveries retorna una página del log de entregas, de la más reciente a la más antigua,
+// junto con el total de coincidencias
+func (d *Dispatcher) Deliveries(query DeliveryQuery) ([]Delivery, int) {
+	keys := keySet(query.LinkKeys)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var matches []Delivery
+	for i := len(d.log) - 1; i >= 0; i-- {
+		delivery := d.log[i]
+		if (query.Status == "" || delivery.Status == query.Status) &&
+			(query.Event == "" || delivery.Event == query.Event) &&
+			(query.ShortCode == "" || delivery.ShortCode == query.ShortCode) &&
+			(len(keys) == 0 || keys[delivery.LinkKey]) {
+			matches = append(matches, delivery)
+		}
+	}
+	total := len(matches)
+	if query.Offset >= total {
+		return []Delivery{}, total
+	}
+	matches = matches[query.Offset:]
+	if query.Limit > 0 && len(matches) > query.Limit {
+		matches = matches[:query.Limit]
+	}
+	return matches, total
+}
+
+// keySet convierte una lista de claves de enlaces en un conjunto
+func keySet(keys []string) map[string]bool {
+	set := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		set[key] = true
+	}
+	return set
+}
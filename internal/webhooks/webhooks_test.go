@@ -0,0 +1,150 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"acortador-urls/internal/shortener"
+)
+
+func event(eventType, code string) shortener.Event {
+	return shortener.Event{
+		Type: eventType,
+		Time: time.Now(),
+		Link: shortener.Link{ShortCode: code, LongURL: "https://www.example.com/" + code, CreatedAt: time.Now()},
+	}
+}
+
+// waitForStatus espera a que la entrega más reciente deje de estar pendiente
+func waitForStatus(t *testing.T, d *Dispatcher) Delivery {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		deliveries, _ := d.Deliveries(DeliveryQuery{Limit: 1})
+		if len(deliveries) == 1 && deliveries[0].Status != StatusPending {
+			return deliveries[0]
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("Delivery still pending")
+	return Delivery{}
+}
+
+func TestDispatcher_Deliver(t *testing.T) {
+	tests := []struct {
+		name             string
+		responses        []int // estado de cada intento; el último se repite
+		expectedStatus   string
+		expectedAttempts int
+	}{
+		{name: "Entrega al primer intento", responses: []int{http.StatusNoContent}, expectedStatus: StatusDelivered, expectedAttempts: 1},
+		{name: "Reintento tras error del servidor", responses: []int{http.StatusInternalServerError, http.StatusTooManyRequests, http.StatusOK}, expectedStatus: StatusDelivered, expectedAttempts: 3},
+		{name: "Error del cliente sin reintentos", responses: []int{http.StatusBadRequest}, expectedStatus: StatusFailed, expectedAttempts: 1},
+		{name: "Intentos agotados", responses: []int{http.StatusBadGateway}, expectedStatus: StatusFailed, expectedAttempts: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			var payload Payload
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				signature := Sign("secreto", r.Header.Get(TimestampHeader), body)
+				if r.Header.Get(SignatureHeader) != signature {
+					t.Errorf("Expected signature %s, got %s", signature, r.Header.Get(SignatureHeader))
+				}
+				json.Unmarshal(body, &payload)
+				if r.Header.Get(DeliveryHeader) != payload.ID || r.Header.Get(EventHeader) != payload.Event {
+					t.Errorf("Expected headers to match payload %+v, got %v", payload, r.Header)
+				}
+				i := int(calls.Add(1)) - 1
+				if i >= len(tt.responses) {
+					i = len(tt.responses) - 1
+				}
+				w.WriteHeader(tt.responses[i])
+			}))
+			defer server.Close()
+
+			d := NewDispatcher([]Endpoint{{URL: server.URL, Secret: "secreto"}}, WithMaxAttempts(3), WithBackoff(time.Millisecond))
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go d.Run(ctx, 1)
+
+			d.HandleEvent(event(shortener.EventCreated, "abc123"))
+			delivery := waitForStatus(t, d)
+			if delivery.Status != tt.expectedStatus || delivery.Attempts != tt.expectedAttempts {
+				t.Errorf("Expected %s after %d attempts, got %+v", tt.expectedStatus, tt.expectedAttempts, delivery)
+			}
+			if payload.Event != shortener.EventCreated || payload.Data.ShortCode != "abc123" {
+				t.Errorf("Unexpected payload: %+v", payload)
+			}
+		})
+	}
+}
+
+func TestDispatcher_Deliveries(t *testing.T) {
+	d := NewDispatcher([]Endpoint{
+		{URL: "https://a.example.com/hook"},
+		{URL: "https://b.example.com/hook", Events: []string{shortener.EventDisabled}},
+	}, WithLogSize(3))
+
+	d.HandleEvent(event(shortener.EventCreated, "uno"))
+	d.HandleEvent(event(shortener.EventDisabled, "uno"))
+	d.HandleEvent(event(shortener.EventClicked, "dos"))
+
+	tests := []struct {
+		name          string
+		query         DeliveryQuery
+		expectedCodes []string
+		expectedTotal int
+	}{
+		// Se conservan las tres más recientes: la creación de uno quedó fuera del log
+		{name: "Todas", query: DeliveryQuery{}, expectedCodes: []string{"dos", "uno", "uno"}, expectedTotal: 3},
+		{name: "Por evento", query: DeliveryQuery{Event: shortener.EventDisabled}, expectedCodes: []string{"uno", "uno"}, expectedTotal: 2},
+		{name: "Por código", query: DeliveryQuery{ShortCode: "dos"}, expectedCodes: []string{"dos"}, expectedTotal: 1},
+		{name: "Paginado", query: DeliveryQuery{Offset: 1, Limit: 1}, expectedCodes: []string{"uno"}, expectedTotal: 3},
+		{name: "Por estado", query: DeliveryQuery{Status: StatusDelivered}, expectedTotal: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			deliveries, total := d.Deliveries(tt.query)
+			if total != tt.expectedTotal || len(deliveries) != len(tt.expectedCodes) {
+				t.Fatalf("Expected %d of %d deliveries, got %d of %d", len(tt.expectedCodes), tt.expectedTotal, len(deliveries), total)
+			}
+			for i, code := range tt.expectedCodes {
+				if deliveries[i].ShortCode != code {
+					t.Errorf("Expected delivery %d for %s, got %s", i, code, deliveries[i].ShortCode)
+				}
+			}
+		})
+	}
+}
+
+func TestDispatcher_LinkKeys(t *testing.T) {
+	d := NewDispatcher([]Endpoint{{URL: "https://a.example.com/hook"}})
+
+	// El mismo código en dos tenants corresponde a enlaces distintos
+	own := event(shortener.EventCreated, "uno")
+	other := event(shortener.EventCreated, "uno")
+	other.Link.Tenant = "equipo-a"
+	d.HandleEvent(own)
+	d.HandleEvent(other)
+
+	deliveries, total := d.Deliveries(DeliveryQuery{LinkKeys: []string{other.Link.Key()}})
+	if total != 1 || deliveries[0].LinkKey != other.Link.Key() {
+		t.Fatalf("Expected only the delivery of %s, got %+v", other.Link.Key(), deliveries)
+	}
+
+	if forgotten := d.Forget(own.Link.Key()); forgotten != 1 {
+		t.Errorf("Expected 1 forgotten delivery, got %d", forgotten)
+	}
+	deliveries, total = d.Deliveries(DeliveryQuery{})
+	if total != 1 || deliveries[0].LinkKey != other.Link.Key() {
+		t.Errorf("Expected the delivery of %s to be kept, got %+v", other.Link.Key(), deliveries)
+	}
+}
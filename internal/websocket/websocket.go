@@ -0,0 +1,263 @@
+// Package websocket implementa el lado servidor del protocolo WebSocket (RFC 6455) en la medida
+// en que lo necesita el servicio: aceptar el handshake, enviar mensajes de texto y responder a
+// los pings y al cierre del cliente. Los mensajes que envía el cliente se descartan.
+package websocket
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// acceptGUID es la constante del RFC 6455 con la que se calcula Sec-WebSocket-Accept
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// writeTimeout acota cada escritura para que un cliente que no lee no bloquee al servidor
+const writeTimeout = 10 * time.Second
+
+// maxFrameSize es el tamaño máximo aceptado de los frames del cliente
+const maxFrameSize = 64 << 10
+
+// Opcodes de los frames
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xA
+)
+
+// Códigos de cierre
+const (
+	CloseNormal        = 1000
+	CloseGoingAway     = 1001
+	CloseProtocolError = 1002
+	CloseTooBig        = 1009
+)
+
+// ErrNotWebSocket indica que la petición no es un handshake WebSocket válido; la conexión no se
+// tomó, así que aún se puede responder por HTTP
+var ErrNotWebSocket = errors.New("la petición no es un handshake WebSocket")
+
+// ErrClosed indica que la conexión ya está cerrada
+var ErrClosed = errors.New("conexión WebSocket cerrada")
+
+// Conn es una conexión WebSocket aceptada
+type Conn struct {
+	conn net.Conn
+	rw   *bufio.ReadWriter
+
+	// mu serializa las escrituras de frames
+	mu     sync.Mutex
+	closed bool
+
+	done chan struct{}
+}
+
+// IsUpgrade indica si la petición solicita cambiar a WebSocket
+func IsUpgrade(r *http.Request) bool {
+	return headerHasToken(r.Header, "Connection", "upgrade") && strings.EqualFold(r.Header.Get("Upgrade"), "websocket")
+}
+
+// headerHasToken indica si alguna de las listas separadas por comas de la cabecera contiene token
+func headerHasToken(header http.Header, name, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, item := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(item), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Upgrade completa el handshake y toma la conexión. Si la petición no es un handshake válido
+// retorna ErrNotWebSocket sin escribir nada en w.
+func Upgrade(w http.ResponseWriter, r *http.Request) (*Conn, error) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if decoded, err := base64.StdEncoding.DecodeString(key); r.Method != http.MethodGet || !IsUpgrade(r) ||
+		r.Header.Get("Sec-WebSocket-Version") != "13" || err != nil || len(decoded) != 16 {
+		return nil, ErrNotWebSocket
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		return nil, errors.New("la conexión no admite WebSocket")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n", AcceptKey(key))
+	conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	if err := rw.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	// La conexión ya no tiene los límites de tiempo del servidor HTTP
+	conn.SetDeadline(time.Time{})
+
+	c := &Conn{conn: conn, rw: rw, done: make(chan struct{})}
+	go c.readLoop()
+	return c, nil
+}
+
+// AcceptKey calcula Sec-WebSocket-Accept a partir de Sec-WebSocket-Key
+func AcceptKey(key string) string {
+	sum := sha1.Sum([]byte(key + acceptGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// Done se cierra cuando la conexión termina, por el cliente o por Close
+func (c *Conn) Done() <-chan struct{} {
+	return c.done
+}
+
+// WriteText envía un mensaje de texto
+func (c *Conn) WriteText(data []byte) error {
+	return c.writeFrame(opText, data)
+}
+
+// Close envía el frame de cierre con el código indicado y cierra la conexión
+func (c *Conn) Close(code int) error {
+	payload := make([]byte, 2)
+	binary.BigEndian.PutUint16(payload, uint16(code))
+	err := c.writeFrame(opClose, payload)
+	c.shutdown()
+	if errors.Is(err, ErrClosed) {
+		return nil
+	}
+	return err
+}
+
+// shutdown cierra la conexión de red una sola vez
+func (c *Conn) shutdown() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return
+	}
+	c.closed = true
+	c.conn.Close()
+	close(c.done)
+}
+
+// writeFrame escribe un frame completo sin máscara, como corresponde al servidor
+func (c *Conn) writeFrame(opcode byte, payload []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return ErrClosed
+	}
+	header := []byte{0x80 | opcode, 0}
+	switch n := len(payload); {
+	case n < 126:
+		header[1] = byte(n)
+	case n <= 0xFFFF:
+		header[1] = 126
+		header = binary.BigEndian.AppendUint16(header, uint16(n))
+	default:
+		header[1] = 127
+		header = binary.BigEndian.AppendUint64(header, uint64(n))
+	}
+	c.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	c.rw.Write(header)
+	c.rw.Write(payload)
+	return c.rw.Flush()
+}
+
+// readLoop atiende los frames del cliente hasta que cierra la conexión
+func (c *Conn) readLoop() {
+	defer c.shutdown()
+	for {
+		opcode, payload, err := c.readFrame()
+		if err != nil {
+			var protocolErr *protocolError
+			if errors.As(err, &protocolErr) {
+				c.Close(protocolErr.code)
+			}
+			return
+		}
+		switch opcode {
+		case opPing:
+			c.writeFrame(opPong, payload)
+		case opClose:
+			// Se devuelve el código del cliente, como pide el protocolo
+			code := CloseNormal
+			if len(payload) >= 2 {
+				code = int(binary.BigEndian.Uint16(payload))
+			}
+			c.Close(code)
+			return
+		}
+	}
+}
+
+// protocolError es un frame inválido del cliente que se responde cerrando con code
+type protocolError struct {
+	code int
+	msg  string
+}
+
+func (e *protocolError) Error() string {
+	return e.msg
+}
+
+// readFrame lee un frame del cliente y retorna su opcode y contenido sin máscara
+func (c *Conn) readFrame() (byte, []byte, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(c.rw, header[:]); err != nil {
+		return 0, nil, err
+	}
+	opcode := header[0] & 0x0F
+	if header[1]&0x80 == 0 {
+		return 0, nil, &protocolError{code: CloseProtocolError, msg: "frame del cliente sin máscara"}
+	}
+	switch opcode {
+	case opContinuation, opText, opBinary, opClose, opPing, opPong:
+	default:
+		return 0, nil, &protocolError{code: CloseProtocolError, msg: "opcode desconocido"}
+	}
+
+	length := uint64(header[1] & 0x7F)
+	switch length {
+	case 126:
+		var extended [2]byte
+		if _, err := io.ReadFull(c.rw, extended[:]); err != nil {
+			return 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(extended[:]))
+	case 127:
+		var extended [8]byte
+		if _, err := io.ReadFull(c.rw, extended[:]); err != nil {
+			return 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(extended[:])
+	}
+	if length > maxFrameSize || (opcode >= opClose && length > 125) {
+		return 0, nil, &protocolError{code: CloseTooBig, msg: "frame demasiado grande"}
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(c.rw, mask[:]); err != nil {
+		return 0, nil, err
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.rw, payload); err != nil {
+		return 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return opcode, payload, nil
+}
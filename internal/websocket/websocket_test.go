@@ -0,0 +1,152 @@
+package websocket
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testKey = "dGhlIHNhbXBsZSBub25jZQ=="
+
+func TestAcceptKey(t *testing.T) {
+	// Ejemplo del RFC 6455, sección 1.3
+	if got := AcceptKey(testKey); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("Unexpected accept key %s", got)
+	}
+}
+
+func TestUpgrade_Invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		method  string
+		headers map[string]string
+	}{
+		{name: "Sin cabeceras de upgrade", method: http.MethodGet},
+		{name: "Método POST", method: http.MethodPost, headers: map[string]string{"Connection": "Upgrade", "Upgrade": "websocket", "Sec-WebSocket-Version": "13", "Sec-WebSocket-Key": testKey}},
+		{name: "Versión no soportada", method: http.MethodGet, headers: map[string]string{"Connection": "Upgrade", "Upgrade": "websocket", "Sec-WebSocket-Version": "8", "Sec-WebSocket-Key": testKey}},
+		{name: "Clave inválida", method: http.MethodGet, headers: map[string]string{"Connection": "keep-alive, Upgrade", "Upgrade": "websocket", "Sec-WebSocket-Version": "13", "Sec-WebSocket-Key": "corta"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/", nil)
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+			if _, err := Upgrade(httptest.NewRecorder(), req); !errors.Is(err, ErrNotWebSocket) {
+				t.Errorf("Expected ErrNotWebSocket, got %v", err)
+			}
+		})
+	}
+}
+
+// dial abre una conexión WebSocket de prueba contra el servidor y retorna su lector
+func dial(t *testing.T, server *httptest.Server) (net.Conn, *bufio.Reader) {
+	t.Helper()
+	conn, err := net.Dial("tcp", strings.TrimPrefix(server.URL, "http://"))
+	if err != nil {
+		t.Fatalf("Unexpected dial error: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+	io.WriteString(conn, "GET / HTTP/1.1\r\nHost: test\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n"+
+		"Sec-WebSocket-Version: 13\r\nSec-WebSocket-Key: "+testKey+"\r\n\r\n")
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatalf("Unexpected handshake error: %v", err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Sec-WebSocket-Accept") != AcceptKey(testKey) {
+		t.Fatalf("Unexpected handshake response: %d %v", resp.StatusCode, resp.Header)
+	}
+	return conn, reader
+}
+
+// writeClientFrame escribe un frame con máscara, como los clientes
+func writeClientFrame(conn net.Conn, opcode byte, payload []byte) {
+	mask := []byte{1, 2, 3, 4}
+	frame := []byte{0x80 | opcode, 0x80 | byte(len(payload))}
+	frame = append(frame, mask...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	conn.Write(frame)
+}
+
+// readServerFrame lee un frame sin máscara del servidor
+func readServerFrame(t *testing.T, reader *bufio.Reader) (byte, []byte) {
+	t.Helper()
+	var header [2]byte
+	if _, err := io.ReadFull(reader, header[:]); err != nil {
+		t.Fatalf("Unexpected read error: %v", err)
+	}
+	length := int(header[1] & 0x7F)
+	if length == 126 {
+		var extended [2]byte
+		io.ReadFull(reader, extended[:])
+		length = int(binary.BigEndian.Uint16(extended[:]))
+	}
+	payload := make([]byte, length)
+	io.ReadFull(reader, payload)
+	return header[0] & 0x0F, payload
+}
+
+func TestConn(t *testing.T) {
+	closed := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := Upgrade(w, r)
+		if err != nil {
+			t.Errorf("Unexpected upgrade error: %v", err)
+			return
+		}
+		conn.WriteText([]byte("hola"))
+		conn.WriteText([]byte(strings.Repeat("x", 300)))
+		<-conn.Done()
+		close(closed)
+	}))
+	defer server.Close()
+
+	conn, reader := dial(t, server)
+	if opcode, payload := readServerFrame(t, reader); opcode != opText || string(payload) != "hola" {
+		t.Errorf("Expected text frame hola, got %d %q", opcode, payload)
+	}
+	if _, payload := readServerFrame(t, reader); len(payload) != 300 {
+		t.Errorf("Expected 300 bytes with extended length, got %d", len(payload))
+	}
+
+	writeClientFrame(conn, opPing, []byte("ping"))
+	if opcode, payload := readServerFrame(t, reader); opcode != opPong || string(payload) != "ping" {
+		t.Errorf("Expected pong echoing ping, got %d %q", opcode, payload)
+	}
+
+	writeClientFrame(conn, opClose, []byte{0x03, 0xE8})
+	if opcode, payload := readServerFrame(t, reader); opcode != opClose || binary.BigEndian.Uint16(payload) != CloseNormal {
+		t.Errorf("Expected close frame 1000, got %d %v", opcode, payload)
+	}
+	select {
+	case <-closed:
+	case <-time.After(2 * time.Second):
+		t.Errorf("Expected Done to be closed after client close")
+	}
+}
+
+func TestConn_UnmaskedFrame(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if conn, err := Upgrade(w, r); err == nil {
+			<-conn.Done()
+		}
+	}))
+	defer server.Close()
+
+	conn, reader := dial(t, server)
+	conn.Write([]byte{0x80 | opText, 2, 'h', 'i'})
+	if opcode, payload := readServerFrame(t, reader); opcode != opClose || binary.BigEndian.Uint16(payload) != CloseProtocolError {
+		t.Errorf("Expected close frame 1002, got %d %v", opcode, payload)
+	}
+}
@@ -0,0 +1,380 @@
+// Package writebehind implementa un búfer de escritura delante de un shortener.LinkStore: los
+// enlaces guardados se acumulan en memoria y se escriben en lotes al backend, lo que sostiene
+// el ritmo de creación (p. ej. durante una importación) con backends en red. A cambio, los
+// enlaces aún no escritos se pierden si el proceso termina sin vaciar el búfer.
+package writebehind
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"acortador-urls/internal/shortener"
+)
+
+// BatchSaver lo implementan los backends que pueden guardar varios enlaces en una sola
+// operación (p. ej. un INSERT con varias filas o un pipeline de Redis). Con los demás el búfer
+// guarda los enlaces de uno en uno.
+type BatchSaver interface {
+	SaveLinks(ctx context.Context, links []shortener.Link) error
+}
+
+// pendingLink es un enlace aún no escrito; seq distingue una escritura posterior del mismo
+// código que llegó mientras se vaciaba el búfer
+type pendingLink struct {
+	link shortener.Link
+	seq  uint64
+}
+
+// Store es un shortener.LinkStore que retiene los SaveLink hasta reunir maxPending enlaces o
+// hasta el siguiente Flush, que el llamador programa cada cierto intervalo. Los enlaces
+// pendientes son visibles en GetLink, Get, Exists y FindByURL; el resto de operaciones sobre
+// un código pendiente, y las que recorren el almacén, vacían antes el búfer.
+type Store struct {
+	shortener.LinkStore
+
+	maxPending int
+
+	mu      sync.Mutex
+	pending map[string]pendingLink
+	seq     uint64
+
+	// flushMu serializa los vaciados para que los lotes se escriban en orden
+	flushMu sync.Mutex
+
+	flushes atomic.Uint64
+	written atomic.Uint64
+}
+
+// Verificación en compilación de que Store implementa LinkStore
+var _ shortener.LinkStore = (*Store)(nil)
+
+// Stats resume la actividad del búfer
+type Stats struct {
+	// Pending es el número de enlaces aún no escritos en el backend
+	Pending int
+	// Flushes es el número de lotes escritos desde el arranque
+	Flushes uint64
+	// Written es el número de enlaces escritos desde el arranque
+	Written uint64
+}
+
+// NewStore envuelve backend con un búfer de hasta maxPending enlaces; al alcanzarlo, el
+// SaveLink que lo llena escribe el lote antes de retornar
+func NewStore(backend shortener.LinkStore, maxPending int) *Store {
+	if maxPending < 1 {
+		maxPending = 1
+	}
+	return &Store{LinkStore: backend, maxPending: maxPending, pending: make(map[string]pendingLink)}
+}
+
+// Stats retorna el estado del búfer
+func (s *Store) Stats() Stats {
+	s.mu.Lock()
+	pending := len(s.pending)
+	s.mu.Unlock()
+	return Stats{Pending: pending, Flushes: s.flushes.Load(), Written: s.written.Load()}
+}
+
+// Flush escribe en el backend los enlaces pendientes. Si falla, los no escritos siguen
+// pendientes y se reintentan en el siguiente vaciado.
+func (s *Store) Flush(ctx context.Context) error {
+	s.flushMu.Lock()
+	defer s.flushMu.Unlock()
+
+	s.mu.Lock()
+	batch := make([]pendingLink, 0, len(s.pending))
+	for _, entry := range s.pending {
+		batch = append(batch, entry)
+	}
+	s.mu.Unlock()
+	if len(batch) == 0 {
+		return nil
+	}
+
+	written, err := s.write(ctx, batch)
+
+	// Solo se descartan las entradas escritas que no se reemplazaron mientras tanto
+	s.mu.Lock()
+	for _, entry := range batch[:written] {
+		if current, ok := s.pending[entry.link.Key()]; ok && current.seq == entry.seq {
+			delete(s.pending, entry.link.Key())
+		}
+	}
+	s.mu.Unlock()
+	if written > 0 {
+		s.flushes.Add(1)
+		s.written.Add(uint64(written))
+	}
+	return err
+}
+
+// write guarda el lote y retorna cuántos enlaces, desde el principio, quedaron escritos
+func (s *Store) write(ctx context.Context, batch []pendingLink) (int, error) {
+	links := make([]shortener.Link, len(batch))
+	for i, entry := range batch {
+		links[i] = entry.link
+	}
+	if saver, ok := s.LinkStore.(BatchSaver); ok {
+		if err := saver.SaveLinks(ctx, links); err != nil {
+			return 0, err
+		}
+		return len(links), nil
+	}
+	for i, link := range links {
+		if err := s.LinkStore.SaveLink(ctx, link); err != nil {
+			return i, err
+		}
+	}
+	return len(links), nil
+}
+
+// flushIfPending vacía el búfer si el código tiene una escritura pendiente
+func (s *Store) flushIfPending(ctx context.Context, shortCode string) error {
+	s.mu.Lock()
+	_, pending := s.pending[shortCode]
+	s.mu.Unlock()
+	if !pending {
+		return nil
+	}
+	return s.Flush(ctx)
+}
+
+// flushAll vacía el búfer si hay escrituras pendientes
+func (s *Store) flushAll(ctx context.Context) error {
+	s.mu.Lock()
+	pending := len(s.pending)
+	s.mu.Unlock()
+	if pending == 0 {
+		return nil
+	}
+	return s.Flush(ctx)
+}
+
+// pendingFor retorna la escritura pendiente del código, si la hay
+func (s *Store) pendingFor(shortCode string) (shortener.Link, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.pending[shortCode]
+	return entry.link, ok
+}
+
+// SaveLink deja el enlace pendiente de escritura y vacía el búfer si se llenó
+func (s *Store) SaveLink(ctx context.Context, link shortener.Link) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.seq++
+	s.pending[link.Key()] = pendingLink{link: link, seq: s.seq}
+	full := len(s.pending) >= s.maxPending
+	s.mu.Unlock()
+	if full {
+		return s.Flush(ctx)
+	}
+	return nil
+}
+
+// SaveLinkIfAbsent deja el enlace pendiente de escritura si el código no está pendiente ni en
+// el backend. Es atómico frente a las demás escrituras de esta instancia, pero no frente a las
+// de otras instancias sobre el mismo backend, ya que el lote se escribe más tarde.
+func (s *Store) SaveLinkIfAbsent(ctx context.Context, link shortener.Link) (bool, error) {
+	if _, ok := s.pendingFor(link.Key()); ok {
+		return false, nil
+	}
+	exists, err := s.LinkStore.Exists(ctx, link.Key())
+	if err != nil || exists {
+		return false, err
+	}
+
+	s.mu.Lock()
+	if _, ok := s.pending[link.Key()]; ok {
+		s.mu.Unlock()
+		return false, nil
+	}
+	s.seq++
+	s.pending[link.Key()] = pendingLink{link: link, seq: s.seq}
+	full := len(s.pending) >= s.maxPending
+	s.mu.Unlock()
+	if full {
+		return true, s.Flush(ctx)
+	}
+	return true, nil
+}
+
+// GetLink obtiene el enlace pendiente o, si no lo hay, el del backend
+func (s *Store) GetLink(ctx context.Context, shortCode string) (shortener.Link, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return shortener.Link{}, false, err
+	}
+	if link, ok := s.pendingFor(shortCode); ok {
+		return link, true, nil
+	}
+	return s.LinkStore.GetLink(ctx, shortCode)
+}
+
+// Get obtiene la URL larga del enlace pendiente o del backend
+func (s *Store) Get(ctx context.Context, shortCode string) (string, bool, error) {
+	link, found, err := s.GetLink(ctx, shortCode)
+	return link.LongURL, found, err
+}
+
+// Exists verifica si el código está pendiente o en el backend
+func (s *Store) Exists(ctx context.Context, shortCode string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	if _, ok := s.pendingFor(shortCode); ok {
+		return true, nil
+	}
+	return s.LinkStore.Exists(ctx, shortCode)
+}
+
+// FindByURL busca primero entre los enlaces pendientes, para que la deduplicación no vacíe el
+// búfer en cada creación
+func (s *Store) FindByURL(ctx context.Context, owner, longURL string) (shortener.Link, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return shortener.Link{}, false, err
+	}
+	s.mu.Lock()
+	var (
+		found  shortener.Link
+		latest uint64
+	)
+	for _, entry := range s.pending {
+		if shortener.TenantKey(entry.link.Tenant, entry.link.Owner) == owner && entry.link.LongURL == longURL && entry.seq > latest {
+			found, latest = entry.link, entry.seq
+		}
+	}
+	s.mu.Unlock()
+	if latest > 0 {
+		return found, true, nil
+	}
+	return s.LinkStore.FindByURL(ctx, owner, longURL)
+}
+
+// GetOrSave vacía el búfer y delega en el backend, que decide de forma atómica
+func (s *Store) GetOrSave(ctx context.Context, link shortener.Link) (shortener.Link, bool, error) {
+	if err := s.flushAll(ctx); err != nil {
+		return shortener.Link{}, false, err
+	}
+	return s.LinkStore.GetOrSave(ctx, link)
+}
+
+// IncrementClicks escribe el enlace si está pendiente y suma la visita en el backend
+func (s *Store) IncrementClicks(ctx context.Context, shortCode string, visit shortener.Visit) error {
+	if err := s.flushIfPending(ctx, shortCode); err != nil {
+		return err
+	}
+	return s.LinkStore.IncrementClicks(ctx, shortCode, visit)
+}
+
+// Delete escribe el enlace si está pendiente y lo elimina del backend
+func (s *Store) Delete(ctx context.Context, shortCode string) (bool, error) {
+	if err := s.flushIfPending(ctx, shortCode); err != nil {
+		return false, err
+	}
+	return s.LinkStore.Delete(ctx, shortCode)
+}
+
+// SetHealth escribe el enlace si está pendiente y guarda el estado del destino
+func (s *Store) SetHealth(ctx context.Context, shortCode, longURL string, health shortener.LinkHealth) (bool, error) {
+	if err := s.flushIfPending(ctx, shortCode); err != nil {
+		return false, err
+	}
+	return s.LinkStore.SetHealth(ctx, shortCode, longURL, health)
+}
+
+// SetMetadata escribe el enlace si está pendiente y guarda los metadatos del destino
+func (s *Store) SetMetadata(ctx context.Context, shortCode, longURL string, metadata shortener.LinkMetadata) (bool, error) {
+	if err := s.flushIfPending(ctx, shortCode); err != nil {
+		return false, err
+	}
+	return s.LinkStore.SetMetadata(ctx, shortCode, longURL, metadata)
+}
+
+// ListByOwner vacía el búfer y delega en el backend
+func (s *Store) ListByOwner(ctx context.Context, owner string) ([]shortener.Link, error) {
+	if err := s.flushAll(ctx); err != nil {
+		return nil, err
+	}
+	return s.LinkStore.ListByOwner(ctx, owner)
+}
+
+// List vacía el búfer y delega en el backend
+func (s *Store) List(ctx context.Context, query shortener.ListQuery) (shortener.LinkPage, error) {
+	if err := s.flushAll(ctx); err != nil {
+		return shortener.LinkPage{}, err
+	}
+	return s.LinkStore.List(ctx, query)
+}
+
+// Search vacía el búfer y delega en el backend
+func (s *Store) Search(ctx context.Context, query shortener.SearchQuery) (shortener.LinkPage, error) {
+	if err := s.flushAll(ctx); err != nil {
+		return shortener.LinkPage{}, err
+	}
+	return s.LinkStore.Search(ctx, query)
+}
+
+// Count vacía el búfer y delega en el backend. Con cuotas de enlaces se llama en cada
+// creación, por lo que el búfer deja de agrupar escrituras.
+func (s *Store) Count(ctx context.Context) (int, error) {
+	if err := s.flushAll(ctx); err != nil {
+		return 0, err
+	}
+	return s.LinkStore.Count(ctx)
+}
+
+// CountByClient vacía el búfer y delega en el backend
+func (s *Store) CountByClient(ctx context.Context, client string) (int, error) {
+	if err := s.flushAll(ctx); err != nil {
+		return 0, err
+	}
+	return s.LinkStore.CountByClient(ctx, client)
+}
+
+// CountByTenant vacía el búfer y delega en el backend
+func (s *Store) CountByTenant(ctx context.Context, tenant string) (int, error) {
+	if err := s.flushAll(ctx); err != nil {
+		return 0, err
+	}
+	return s.LinkStore.CountByTenant(ctx, tenant)
+}
+
+// Each vacía el búfer y recorre el backend
+func (s *Store) Each(ctx context.Context, fn func(shortener.Link) error) error {
+	if err := s.flushAll(ctx); err != nil {
+		return err
+	}
+	return s.LinkStore.Each(ctx, fn)
+}
+
+// EvictionStats reenvía las estadísticas de expulsión del backend, si las tiene
+func (s *Store) EvictionStats() shortener.EvictionStats {
+	if reporter, ok := s.LinkStore.(shortener.EvictionReporter); ok {
+		return reporter.EvictionStats()
+	}
+	return shortener.EvictionStats{}
+}
+
+// MemoryUsage reenvía la estimación de memoria del backend, si la tiene
+func (s *Store) MemoryUsage() (shortener.MemoryUsage, bool) {
+	if compactor, ok := s.LinkStore.(shortener.Compactor); ok {
+		return compactor.MemoryUsage()
+	}
+	return shortener.MemoryUsage{}, false
+}
+
+// Compact compacta el backend, si lo admite; los enlaces pendientes del búfer no cambian
+func (s *Store) Compact(ctx context.Context) (shortener.CompactionResult, error) {
+	if compactor, ok := s.LinkStore.(shortener.Compactor); ok {
+		return compactor.Compact(ctx)
+	}
+	return shortener.CompactionResult{}, shortener.ErrCompactionUnsupported
+}
+
+// Backend implementa shortener.BackendReporter anteponiendo el búfer al backend
+func (s *Store) Backend() string {
+	return "write-behind/" + shortener.BackendName(s.LinkStore)
+}
@@ -0,0 +1,127 @@
+package writebehind
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"acortador-urls/internal/shortener"
+)
+
+// recordingStore cuenta las escrituras que llegan al backend y puede fallar a demanda
+type recordingStore struct {
+	*shortener.Store
+	saves int
+	fail  bool
+}
+
+func (s *recordingStore) SaveLink(ctx context.Context, link shortener.Link) error {
+	if s.fail {
+		return errors.New("conexión rechazada")
+	}
+	s.saves++
+	return s.Store.SaveLink(ctx, link)
+}
+
+// batchStore guarda los lotes en una sola operación
+type batchStore struct {
+	*shortener.Store
+	batches []int
+}
+
+func (s *batchStore) SaveLinks(ctx context.Context, links []shortener.Link) error {
+	s.batches = append(s.batches, len(links))
+	for _, link := range links {
+		if err := s.Store.SaveLink(ctx, link); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestStore(t *testing.T) {
+	ctx := context.Background()
+	backend := &recordingStore{Store: shortener.NewStore()}
+	store := NewStore(backend, 3)
+	link := func(code string) shortener.Link {
+		return shortener.Link{ShortCode: code, LongURL: "https://www.example.com/" + code, Owner: "alice"}
+	}
+
+	// Los enlaces pendientes se leen antes de llegar al backend
+	store.SaveLink(ctx, link("aaa"))
+	store.SaveLink(ctx, link("bbb"))
+	if backend.saves != 0 {
+		t.Fatalf("Expected writes to be buffered, got %d backend saves", backend.saves)
+	}
+	tests := []struct {
+		name  string
+		check func() bool
+	}{
+		{name: "GetLink", check: func() bool {
+			l, found, _ := store.GetLink(ctx, "aaa")
+			return found && l.LongURL == link("aaa").LongURL
+		}},
+		{name: "Exists", check: func() bool { exists, _ := store.Exists(ctx, "bbb"); return exists }},
+		{name: "FindByURL", check: func() bool { _, found, _ := store.FindByURL(ctx, "alice", link("bbb").LongURL); return found }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !tt.check() {
+				t.Errorf("Expected pending link to be visible")
+			}
+		})
+	}
+
+	// Un código pendiente no se puede volver a ocupar
+	if created, err := store.SaveLinkIfAbsent(ctx, link("aaa")); err != nil || created {
+		t.Errorf("Expected pending code to be taken, got created=%v (err %v)", created, err)
+	}
+
+	// Llenar el búfer escribe el lote
+	if created, err := store.SaveLinkIfAbsent(ctx, link("ccc")); err != nil || !created {
+		t.Fatalf("Expected free code to be saved, got created=%v (err %v)", created, err)
+	}
+	if stats := store.Stats(); backend.saves != 3 || stats.Pending != 0 || stats.Flushes != 1 {
+		t.Errorf("Expected a flush of 3 links, got %d saves and %+v", backend.saves, stats)
+	}
+
+	// Un fallo conserva los enlaces pendientes para el siguiente vaciado
+	store.SaveLink(ctx, link("ddd"))
+	backend.fail = true
+	if err := store.Flush(ctx); err == nil {
+		t.Errorf("Expected flush error")
+	}
+	if stats := store.Stats(); stats.Pending != 1 {
+		t.Errorf("Expected link to stay pending, got %+v", stats)
+	}
+	backend.fail = false
+
+	// Las operaciones que recorren el almacén vacían antes el búfer
+	if count, err := store.Count(ctx); err != nil || count != 4 {
+		t.Errorf("Expected 4 links after flushing, got %d (err %v)", count, err)
+	}
+
+	// Las visitas a un enlace pendiente llegan al backend
+	store.SaveLink(ctx, link("eee"))
+	if err := store.IncrementClicks(ctx, "eee", shortener.Visit{}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if l, _, _ := backend.GetLink(ctx, "eee"); l.Clicks != 1 {
+		t.Errorf("Expected click to be recorded in the backend, got %d", l.Clicks)
+	}
+
+	t.Run("Backend con escritura por lotes", func(t *testing.T) {
+		backend := &batchStore{Store: shortener.NewStore()}
+		store := NewStore(backend, 10)
+		for i := 0; i < 4; i++ {
+			store.SaveLink(ctx, link(fmt.Sprintf("code%d", i)))
+		}
+		if err := store.Flush(ctx); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(backend.batches) != 1 || backend.batches[0] != 4 {
+			t.Errorf("Expected one batch of 4 links, got %v", backend.batches)
+		}
+	})
+}
@@ -0,0 +1,403 @@
+// Package client es el cliente Go oficial del acortador de URLs. Envuelve la API HTTP con
+// tipos propios, reintentos con backoff exponencial, timeouts y errores tipados que
+// corresponden a los códigos de error del servidor.
+//
+//	c := client.New("https://acortador.example.com", client.WithAPIKey("mi-clave"))
+//	result, err := c.Shorten(ctx, "https://www.example.com", client.WithAlias("campania"))
+//	if errors.Is(err, client.ErrAliasTaken) {
+//		// ...
+//	}
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Valores por defecto del cliente
+const (
+	DefaultTimeout    = 10 * time.Second
+	DefaultMaxRetries = 3
+	DefaultBackoff    = 200 * time.Millisecond
+	// MaxBackoff acota la espera entre reintentos, incluida la indicada por Retry-After
+	MaxBackoff = 10 * time.Second
+)
+
+// Errores que corresponden a los códigos de error del servidor; se comparan con errors.Is
+var (
+	ErrInvalidURL      = errors.New("URL inválida")
+	ErrInvalidAlias    = errors.New("alias inválido")
+	ErrAliasTaken      = errors.New("el alias solicitado ya está en uso")
+	ErrAliasNotAllowed = errors.New("alias no permitido")
+	ErrNotFound        = errors.New("código corto no encontrado")
+	ErrExpired         = errors.New("el enlace ha expirado")
+	ErrUnauthorized    = errors.New("se requiere autenticación")
+	ErrForbidden       = errors.New("sin permiso para gestionar el enlace")
+	ErrRateLimited     = errors.New("límite de peticiones excedido")
+	ErrTooLarge        = errors.New("petición demasiado grande")
+	ErrUnavailable     = errors.New("servicio no disponible")
+)
+
+// errorCodes asocia cada código de error del servidor con su error del cliente
+var errorCodes = map[string]error{
+	"invalid_url":         ErrInvalidURL,
+	"empty_url":           ErrInvalidURL,
+	"invalid_alias":       ErrInvalidAlias,
+	"alias_taken":         ErrAliasTaken,
+	"alias_not_allowed":   ErrAliasNotAllowed,
+	"not_found":           ErrNotFound,
+	"expired":             ErrExpired,
+	"unauthorized":        ErrUnauthorized,
+	"invalid_token":       ErrUnauthorized,
+	"expired_token":       ErrUnauthorized,
+	"forbidden":           ErrForbidden,
+	"rate_limited":        ErrRateLimited,
+	"payload_too_large":   ErrTooLarge,
+	"batch_too_large":     ErrTooLarge,
+	"service_unavailable": ErrUnavailable,
+	"timeout":             ErrUnavailable,
+	"request_timeout":     ErrUnavailable,
+}
+
+// APIError es una respuesta de error del servidor
+type APIError struct {
+	StatusCode int
+	Code       string // código de error del servidor, p. ej. "alias_taken"
+	Message    string
+	RetryAfter time.Duration // presente en respuestas 429
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("acortador: %d %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+// Is permite comparar con los errores del paquete: errors.Is(err, client.ErrNotFound)
+func (e *APIError) Is(target error) bool {
+	if mapped, ok := errorCodes[e.Code]; ok && mapped == target {
+		return true
+	}
+	return target == ErrUnavailable && e.StatusCode == http.StatusServiceUnavailable
+}
+
+// Client es el cliente HTTP de la API
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	apiKey     string
+	token      string
+	maxRetries int
+	backoff    time.Duration
+	sleep      func(ctx context.Context, d time.Duration) error
+}
+
+// Option configura aspectos opcionales del cliente
+type Option func(*Client)
+
+// WithHTTPClient reemplaza el http.Client usado (por defecto uno con DefaultTimeout)
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithTimeout define el timeout total de cada intento
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.httpClient.Timeout = timeout
+	}
+}
+
+// WithAPIKey envía la clave en la cabecera X-API-Key
+func WithAPIKey(apiKey string) Option {
+	return func(c *Client) {
+		c.apiKey = apiKey
+	}
+}
+
+// WithToken envía el token JWT como Authorization: Bearer
+func WithToken(token string) Option {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+// WithRetries define el número máximo de reintentos y la espera inicial entre ellos
+func WithRetries(maxRetries int, backoff time.Duration) Option {
+	return func(c *Client) {
+		c.maxRetries = maxRetries
+		c.backoff = backoff
+	}
+}
+
+// New crea un cliente para el servidor en baseURL (p. ej. "http://localhost:8089")
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		httpClient: &http.Client{Timeout: DefaultTimeout},
+		maxRetries: DefaultMaxRetries,
+		backoff:    DefaultBackoff,
+		sleep:      sleepContext,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// ShortenResult es el resultado de acortar una URL
+type ShortenResult struct {
+	ShortURL  string
+	ShortCode string
+	// Created es false cuando el servidor reutilizó un enlace existente (modo deduplicación)
+	Created bool
+}
+
+// ShortenOption configura una petición de acortado
+type ShortenOption func(*shortenRequest)
+
+// WithAlias solicita un código personalizado
+func WithAlias(alias string) ShortenOption {
+	return func(r *shortenRequest) {
+		r.Alias = alias
+	}
+}
+
+// WithTTL hace que el enlace expire tras la duración indicada (redondeada a segundos)
+func WithTTL(ttl time.Duration) ShortenOption {
+	return func(r *shortenRequest) {
+		r.TTLSeconds = int64(ttl.Round(time.Second) / time.Second)
+	}
+}
+
+type shortenRequest struct {
+	LongURL    string `json:"long_url"`
+	Alias      string `json:"alias,omitempty"`
+	TTLSeconds int64  `json:"ttl_seconds,omitempty"`
+}
+
+type shortenResponse struct {
+	ShortURL string `json:"short_url"`
+}
+
+// Shorten acorta una URL larga
+func (c *Client) Shorten(ctx context.Context, longURL string, opts ...ShortenOption) (*ShortenResult, error) {
+	req := shortenRequest{LongURL: longURL}
+	for _, opt := range opts {
+		opt(&req)
+	}
+
+	var resp shortenResponse
+	status, err := c.do(ctx, http.MethodPost, "/shorten", req, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return &ShortenResult{
+		ShortURL:  resp.ShortURL,
+		ShortCode: resp.ShortURL[strings.LastIndex(resp.ShortURL, "/")+1:],
+		Created:   status == http.StatusCreated,
+	}, nil
+}
+
+// ResolveResult describe la resolución de un código corto
+type ResolveResult struct {
+	ShortCode string     `json:"short_code"`
+	Found     bool       `json:"found"`
+	LongURL   string     `json:"long_url,omitempty"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Expired   bool       `json:"expired,omitempty"`
+	// Err es el error de ese código concreto (p. ej. ErrNotFound); nil si se encontró
+	Err error `json:"-"`
+}
+
+type resolveResponse struct {
+	Results []struct {
+		ResolveResult
+		Error *errorBody `json:"error,omitempty"`
+	} `json:"results"`
+}
+
+// Resolve obtiene el destino de varios códigos cortos en una sola petición sin contabilizar
+// visitas. Los códigos inexistentes no producen error global: se reportan en ResolveResult.Err.
+func (c *Client) Resolve(ctx context.Context, codes ...string) ([]ResolveResult, error) {
+	var resp resolveResponse
+	if _, err := c.do(ctx, http.MethodPost, "/api/resolve", map[string][]string{"codes": codes}, &resp); err != nil {
+		return nil, err
+	}
+
+	results := make([]ResolveResult, 0, len(resp.Results))
+	for _, item := range resp.Results {
+		result := item.ResolveResult
+		if item.Error != nil {
+			result.Err = &APIError{StatusCode: http.StatusOK, Code: item.Error.Error, Message: item.Error.Message}
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// Link es un enlace del usuario autenticado
+type Link struct {
+	ShortCode string     `json:"short_code"`
+	ShortURL  string     `json:"short_url"`
+	LongURL   string     `json:"long_url"`
+	Owner     string     `json:"owner,omitempty"`
+	Domain    string     `json:"domain,omitempty"`    // Dominio personalizado; vacío en el principal
+	Workspace string     `json:"workspace,omitempty"` // Espacio compartido del editor que lo creó
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// List retorna los enlaces del usuario autenticado; requiere WithToken
+func (c *Client) List(ctx context.Context) ([]Link, error) {
+	var resp struct {
+		URLs []Link `json:"urls"`
+	}
+	if _, err := c.do(ctx, http.MethodGet, "/api/me/urls", nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.URLs, nil
+}
+
+// Stats son las estadísticas globales del servicio
+type Stats struct {
+	TotalURLs int `json:"totalUrls"`
+}
+
+// Stats obtiene las estadísticas del servicio a través del endpoint GraphQL. Requiere un token
+// o clave de administrador; sin ellos retorna ErrForbidden.
+func (c *Client) Stats(ctx context.Context) (*Stats, error) {
+	var resp struct {
+		Data struct {
+			Stats *Stats `json:"stats"`
+		} `json:"data"`
+		Errors []struct {
+			Message    string            `json:"message"`
+			Extensions map[string]string `json:"extensions"`
+		} `json:"errors"`
+	}
+	if _, err := c.do(ctx, http.MethodPost, "/graphql", map[string]string{"query": "{ stats { totalUrls } }"}, &resp); err != nil {
+		return nil, err
+	}
+	if len(resp.Errors) > 0 {
+		return nil, &APIError{StatusCode: http.StatusOK, Code: resp.Errors[0].Extensions["code"], Message: resp.Errors[0].Message}
+	}
+	if resp.Data.Stats == nil {
+		return nil, fmt.Errorf("acortador: respuesta de estadísticas vacía")
+	}
+	return resp.Data.Stats, nil
+}
+
+// errorBody es el cuerpo ErrorResponse del servidor
+type errorBody struct {
+	Error   string `json:"error"`
+	Message string `json:"message"`
+}
+
+// do envía la petición JSON con reintentos y decodifica la respuesta en out. Se reintenta ante
+// errores de red y respuestas 429, 502, 503 y 504, respetando Retry-After y el contexto.
+func (c *Client) do(ctx context.Context, method, path string, body, out interface{}) (int, error) {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return 0, fmt.Errorf("acortador: no se pudo serializar la petición: %w", err)
+		}
+	}
+
+	for attempt := 0; ; attempt++ {
+		status, wait, err := c.attempt(ctx, method, path, payload, out)
+		if err == nil || attempt >= c.maxRetries || !retryable(status, err) || ctx.Err() != nil {
+			return status, err
+		}
+
+		if wait <= 0 {
+			wait = c.backoff * time.Duration(math.Pow(2, float64(attempt)))
+		}
+		if wait > MaxBackoff {
+			wait = MaxBackoff
+		}
+		if err := c.sleep(ctx, wait); err != nil {
+			return status, err
+		}
+	}
+}
+
+// attempt realiza un único intento; retorna el estado HTTP y la espera sugerida por el servidor
+func (c *Client) attempt(ctx context.Context, method, path string, payload []byte, out interface{}) (int, time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, bytes.NewReader(payload))
+	if err != nil {
+		return 0, 0, fmt.Errorf("acortador: petición inválida: %w", err)
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.apiKey != "" {
+		req.Header.Set("X-API-Key", c.apiKey)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return 0, 0, fmt.Errorf("acortador: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		apiErr := &APIError{StatusCode: resp.StatusCode, Code: "http_error", Message: resp.Status}
+		var body errorBody
+		if data, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20)); json.Unmarshal(data, &body) == nil && body.Error != "" {
+			apiErr.Code = body.Error
+			apiErr.Message = body.Message
+		}
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+			apiErr.RetryAfter = time.Duration(seconds) * time.Second
+		}
+		return resp.StatusCode, apiErr.RetryAfter, apiErr
+	}
+
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return resp.StatusCode, 0, fmt.Errorf("acortador: respuesta inválida: %w", err)
+		}
+	}
+	return resp.StatusCode, 0, nil
+}
+
+// retryable indica si el fallo es transitorio
+func retryable(status int, err error) bool {
+	switch status {
+	case 0:
+		// Error de red: no hubo respuesta del servidor
+		return err != nil
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+// sleepContext espera la duración indicada o hasta que se cancele el contexto
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,141 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"acortador-urls/internal/auth"
+	"acortador-urls/internal/handlers"
+	"acortador-urls/internal/shortener"
+)
+
+// testTokens firma los tokens de los clientes autenticados de las pruebas
+var testTokens = auth.NewTokenManager([]byte("secreto-de-prueba"), time.Hour)
+
+// newTestServer levanta la API real sobre un almacén en memoria
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	handler := handlers.NewHandler(shortener.NewService(shortener.NewStore()))
+
+	r := chi.NewRouter()
+	r.Use(handlers.Authenticate(testTokens))
+	r.Post("/shorten", handler.ShortenURL)
+	r.Post("/api/resolve", handler.ResolveBatch)
+	r.Post("/graphql", handler.GraphQL)
+
+	server := httptest.NewServer(r)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestClient_API(t *testing.T) {
+	server := newTestServer(t)
+	c := New(server.URL)
+	ctx := context.Background()
+
+	result, err := c.Shorten(ctx, "https://www.example.com/sdk", WithAlias("sdk-alias"), WithTTL(time.Hour))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.ShortCode != "sdk-alias" || result.ShortURL != server.URL+"/sdk-alias" || !result.Created {
+		t.Errorf("Unexpected shorten result: %+v", result)
+	}
+
+	tests := []struct {
+		name      string
+		longURL   string
+		opts      []ShortenOption
+		errorType error
+	}{
+		{name: "Alias duplicado", longURL: "https://www.example.com", opts: []ShortenOption{WithAlias("sdk-alias")}, errorType: ErrAliasTaken},
+		{name: "Alias inválido", longURL: "https://www.example.com", opts: []ShortenOption{WithAlias("a")}, errorType: ErrInvalidAlias},
+		{name: "URL inválida", longURL: "ftp://example.com", errorType: ErrInvalidURL},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := c.Shorten(ctx, tt.longURL, tt.opts...)
+			if !errors.Is(err, tt.errorType) {
+				t.Errorf("Expected error %v, got %v", tt.errorType, err)
+			}
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) || apiErr.StatusCode < 400 {
+				t.Errorf("Expected *APIError with HTTP status, got %v", err)
+			}
+		})
+	}
+
+	resolved, err := c.Resolve(ctx, "sdk-alias", "no-existe")
+	if err != nil {
+		t.Fatalf("Unexpected error resolving: %v", err)
+	}
+	if len(resolved) != 2 || !resolved[0].Found || resolved[0].LongURL != "https://www.example.com/sdk" || resolved[0].ExpiresAt == nil {
+		t.Errorf("Unexpected resolve result: %+v", resolved)
+	}
+	if resolved[1].Found || !errors.Is(resolved[1].Err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for missing code, got %+v", resolved[1])
+	}
+
+	// Las estadísticas globales requieren un administrador
+	if _, err := c.Stats(ctx); !errors.Is(err, ErrForbidden) {
+		t.Errorf("Expected ErrForbidden for anonymous stats, got %v", err)
+	}
+	adminToken, _ := testTokens.Issue("root", auth.RoleAdmin)
+	stats, err := New(server.URL, WithToken(adminToken)).Stats(ctx)
+	if err != nil || stats.TotalURLs != 1 {
+		t.Errorf("Expected 1 URL in stats, got %+v (%v)", stats, err)
+	}
+}
+
+func TestClient_Retries(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch atomic.AddInt32(&calls, 1) {
+		case 1:
+			w.Header().Set("Retry-After", "2")
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`{"error":"rate_limited","message":"Demasiadas peticiones"}`))
+		case 2:
+			w.WriteHeader(http.StatusBadGateway)
+		default:
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"short_url":"http://sho.rt/abc123"}`))
+		}
+	}))
+	defer server.Close()
+
+	var waits []time.Duration
+	c := New(server.URL, WithRetries(3, 100*time.Millisecond))
+	c.sleep = func(ctx context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		return nil
+	}
+
+	result, err := c.Shorten(context.Background(), "https://www.example.com")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.ShortCode != "abc123" || calls != 3 {
+		t.Errorf("Expected success on third attempt, got %+v after %d calls", result, calls)
+	}
+
+	// La primera espera respeta Retry-After y la segunda usa el backoff exponencial
+	if len(waits) != 2 || waits[0] != 2*time.Second || waits[1] != 200*time.Millisecond {
+		t.Errorf("Unexpected waits: %v", waits)
+	}
+
+	// Sin reintentos el error se retorna tipado
+	atomic.StoreInt32(&calls, 0)
+	_, err = New(server.URL, WithRetries(0, 0)).Shorten(context.Background(), "https://www.example.com")
+	var apiErr *APIError
+	if !errors.Is(err, ErrRateLimited) || !errors.As(err, &apiErr) || apiErr.RetryAfter != 2*time.Second {
+		t.Errorf("Expected rate limited error with Retry-After, got %v", err)
+	}
+}